@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"nexusvalet/internal/cache"
+	"nexusvalet/internal/flood"
+	"nexusvalet/pkg/logger"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// knownTextTTL 记录消息最近一次已知文本的时间。超过后再编辑的消息按用户编辑处理
+const knownTextTTL = 5 * time.Minute
+
+// messageKey 对话中的一条消息
+type messageKey struct {
+	chatID    int64
+	messageID int
+}
+
+// editTracker 记录自己发出的命令消息和自己编辑过的消息的最新文本。
+// 收到编辑更新时文本与记录相同，说明是自己的响应编辑(或链接预览等文本未变的更新)，不再作为命令处理
+type editTracker struct {
+	texts  *cache.Cache[messageKey, string]
+	selfID func() int64
+}
+
+// newEditTracker 创建编辑记录，selfID 用于把收藏夹(InputPeerSelf)转换为对话ID
+func newEditTracker(selfID func() int64) *editTracker {
+	return &editTracker{
+		texts:  cache.New[messageKey, string]("edited_messages", cache.Options{TTL: knownTextTTL, MaxEntries: 4096}),
+		selfID: selfID,
+	}
+}
+
+// remember 记录消息当前的文本
+func (t *editTracker) remember(chatID int64, messageID int, text string) {
+	t.texts.Set(messageKey{chatID: chatID, messageID: messageID}, strings.TrimSpace(text))
+}
+
+// known 消息文本是否与最近一次记录的相同
+func (t *editTracker) known(chatID int64, messageID int, text string) bool {
+	last, ok := t.texts.Get(messageKey{chatID: chatID, messageID: messageID})
+	return ok && last == strings.TrimSpace(text)
+}
+
+// Middleware 返回Telegram客户端中间件，在发出编辑请求前记录要设置的文本，
+// 因此编辑更新先于请求结果到达时也能识别为自己的编辑
+func (t *editTracker) Middleware() telegram.Middleware {
+	return telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			if req, ok := input.(*tg.MessagesEditMessageRequest); ok && req.ScheduleDate == 0 {
+				if text, ok := req.GetMessage(); ok {
+					chatID := flood.PeerChatID(req.Peer)
+					if _, isSelf := req.Peer.(*tg.InputPeerSelf); isSelf {
+						chatID = t.selfID()
+					}
+					t.remember(chatID, req.ID, text)
+				}
+			}
+			return next.Invoke(ctx, input, output)
+		}
+	})
+}
+
+// handleEditMessage 处理消息编辑更新
+func (b *Bot) handleEditMessage(ctx context.Context, update *tg.UpdateEditMessage) error {
+	message, ok := update.Message.(*tg.Message)
+	if !ok {
+		return nil
+	}
+	return b.handleEditedMessage(ctx, message, update.Pts, update.PtsCount)
+}
+
+// handleEditChannelMessage 处理频道/超级群组的消息编辑更新
+func (b *Bot) handleEditChannelMessage(ctx context.Context, update *tg.UpdateEditChannelMessage) error {
+	message, ok := update.Message.(*tg.Message)
+	if !ok {
+		return nil
+	}
+	return b.handleEditedMessage(ctx, message, update.Pts, update.PtsCount)
+}
+
+// handleEditedMessage 自己的消息被编辑为命令时，按新消息交给命令处理流程。
+// 文本未变化、不显示为已编辑(EditHide，如生成链接预览)或与自己最近编辑的文本相同时忽略
+func (b *Bot) handleEditedMessage(ctx context.Context, message *tg.Message, pts, ptsCount int) error {
+	if !message.Out || message.EditHide || !b.commandParser.IsCommand(message.Message) {
+		return nil
+	}
+
+	chatID := getChatID(message)
+	if b.edits.known(chatID, message.ID, message.Message) {
+		logger.Ctx(ctx).Debugf("Ignoring own edit of message %d in chat %d", message.ID, chatID)
+		return nil
+	}
+
+	logger.Ctx(ctx).Debugf("Processing edited command message %d in chat %d", message.ID, chatID)
+	return b.handleNewMessage(ctx, &tg.UpdateNewMessage{
+		Message:  message,
+		Pts:      pts,
+		PtsCount: ptsCount,
+	})
+}
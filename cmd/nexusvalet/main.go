@@ -1,25 +1,37 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"flag"
 	"fmt"
+	"nexusvalet/internal/authflow"
 	"nexusvalet/internal/command"
 	"nexusvalet/internal/config"
 	"nexusvalet/internal/core"
+	"nexusvalet/internal/deprecation"
+	"nexusvalet/internal/download"
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/marketplace"
+	"nexusvalet/internal/mediacompress"
+	"nexusvalet/internal/metrics"
 	"nexusvalet/internal/peers"
 	"nexusvalet/internal/plugin"
 	"nexusvalet/internal/session"
+	"nexusvalet/internal/version"
 	"nexusvalet/pkg/logger"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/gotd/td/telegram"
-	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/auth/qrlogin"
 	"github.com/gotd/td/telegram/uploader"
 	"github.com/gotd/td/tg"
 )
@@ -37,19 +49,26 @@ type Bot struct {
 	ctx           context.Context
 	cancel        context.CancelFunc
 	currentPeer   tg.InputPeerClass // 存储当前对等体用于回复
+	selfMu        sync.RWMutex      // 保护 selfUserID 和 selfUsername，自身信息变化时在其他goroutine中更新
 	selfUserID    int64             // 机器人自己的用户ID
+	selfUsername  string            // 自己的用户名，机器人模式下用于识别 /command@botname
 	peerResolver  *peers.Resolver
 	accessHashMgr *peers.AccessHashManager
-	// 存储最后处理的消息用于编辑上下文
-	lastMessage *tg.Message
-	lastUpdate  interface{} // 存储原始更新
-	startTime   time.Time   // 机器人启动时间
+	startTime     time.Time // 机器人启动时间
+	startup       *core.StartupReport
+	firstUpdate   sync.Once
+	edits         *editTracker         // 命令消息和自己编辑过的消息的最新文本
+	downloader    *download.Downloader // 插件共用的文件下载器
+	// Prometheus 指标，未启用时均为空
+	metrics       *metrics.Collector
+	metricsServer *metrics.Server
 }
 
-// NewBot 创建一个新的机器人实例
-func NewBot(cfg *config.Config) (*Bot, error) {
+// NewBot 创建一个新的机器人实例。allowDowngrade 允许使用比数据库记录更旧的版本启动
+func NewBot(cfg *config.Config, allowDowngrade bool) (*Bot, error) {
 	// 创建上下文
 	ctx, cancel := context.WithCancel(context.Background())
+	startup := core.NewStartupReport()
 
 	// 确保数据库文件的目录存在
 	if err := os.MkdirAll(filepath.Dir(cfg.Telegram.Database), 0755); err != nil {
@@ -58,19 +77,91 @@ func NewBot(cfg *config.Config) (*Bot, error) {
 	}
 
 	// 初始化会话管理器
+	endSession := startup.Begin("session")
 	sessionMgr, err := session.NewManager(cfg.Telegram.Database)
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("failed to create session manager: %w", err)
 	}
 
+	// 检查数据库版本记录，防止降级后使用已迁移的数据库。必须在插件注册之前，
+	// 插件初始化时会读写自己的表
+	if err := sessionMgr.CheckVersion(allowDowngrade); err != nil {
+		sessionMgr.Close()
+		cancel()
+		return nil, fmt.Errorf("version check failed: %w", err)
+	}
+	endSession()
+
 	// 初始化核心组件
 	dispatcher := core.NewEventDispatcher()
 	hookManager := core.NewHookManager()
-	commandParser := command.NewParser(cfg.Bot.CommandPrefix, dispatcher, hookManager)
+	prefixes := cfg.Bot.CommandPrefixes()
+	commandParser := command.NewParser(prefixes[0], dispatcher, hookManager, prefixes[1:]...)
 
 	// 初始化Go插件管理器
 	pluginManager := plugin.NewGoManager(commandParser, dispatcher, hookManager, sessionMgr.GetDB())
+	pluginManager.SetStartupReport(startup)
+
+	// 记录使用了旧名称的配置项
+	deprecations := pluginManager.GetDeprecations()
+	deprecations.SetGrace(cfg.Deprecations.GraceVersions)
+	for _, k := range config.DeprecatedKeys() {
+		deprecations.Declare(deprecation.ConfigKey, k.Old, k.New)
+	}
+	for _, k := range cfg.RenamedKeys() {
+		deprecations.Observe(deprecation.ConfigKey, k.Old)
+	}
+
+	// 初始化插件索引
+	if keys, err := marketplace.ParsePublicKeys(cfg.Apt.PublicKeys); err != nil {
+		logger.Warnf("Invalid apt.public_keys, plugin index disabled: %v", err)
+	} else if store, err := marketplace.NewStore(sessionMgr.GetDB(), cfg.Apt.Indexes, keys); err != nil {
+		logger.Warnf("Failed to initialize plugin index: %v", err)
+	} else {
+		pluginManager.SetMarketplace(store, cfg.Bot.PluginsDir)
+	}
+
+	// 使用配置中的口令解锁密钥库
+	if cfg.Security.Passphrase != "" && pluginManager.GetSecretStore() != nil {
+		if migrated, err := pluginManager.GetSecretStore().Unlock(cfg.Security.Passphrase); err != nil {
+			logger.Warnf("Failed to unlock secret store: %v", err)
+		} else {
+			logger.Infof("Secret store unlocked (%d plaintext secrets migrated)", migrated)
+		}
+	}
+
+	// 上传前的媒体压缩
+	if level, err := mediacompress.ParseLevel(cfg.Media.Compress); err != nil {
+		logger.Warnf("Invalid media.compress, compression disabled: %v", err)
+	} else {
+		opts := mediacompress.OptionsFor(level)
+		if cfg.Media.JPEGQuality > 0 && cfg.Media.JPEGQuality <= 100 {
+			opts.JPEGQuality = cfg.Media.JPEGQuality
+		}
+		if cfg.Media.MaxDimension > 0 {
+			opts.MaxDimension = cfg.Media.MaxDimension
+		}
+		pluginManager.SetMediaCompression(opts)
+	}
+
+	// 以机器人账号运行时，需要用户账号的插件拒绝执行
+	pluginManager.SetBotMode(cfg.Telegram.BotMode())
+
+	// .dme 删除结果的显示时间
+	if cfg.Dme.StatusSeconds != 0 {
+		pluginManager.SetDmeStatusDelay(time.Duration(cfg.Dme.StatusSeconds) * time.Second)
+	}
+
+	// 按对话的发送频率限制
+	floodOpts := flood.DefaultOptions()
+	if cfg.RateLimit.MessagesPerMinute != 0 {
+		floodOpts.PerMinute = max(cfg.RateLimit.MessagesPerMinute, 0)
+	}
+	if cfg.RateLimit.MaxFloodWait > 0 {
+		floodOpts.MaxWait = time.Duration(cfg.RateLimit.MaxFloodWait) * time.Second
+	}
+	pluginManager.GetFloodLimiter().Configure(floodOpts)
 
 	bot := &Bot{
 		config:        cfg,
@@ -82,6 +173,13 @@ func NewBot(cfg *config.Config) (*Bot, error) {
 		ctx:           ctx,
 		cancel:        cancel,
 		startTime:     time.Now(),
+		startup:       startup,
+	}
+	bot.edits = newEditTracker(bot.selfID)
+	if cfg.Metrics.Enabled {
+		bot.metrics = metrics.NewCollector()
+		bot.metricsServer = metrics.NewServer(cfg.Metrics.Addr, bot.metrics)
+		commandParser.SetMetrics(bot.metrics)
 	}
 
 	// 创建 Telegram 客户端
@@ -110,8 +208,8 @@ func (b *Bot) createTelegramClient() error {
 	options := telegram.Options{
 		Device: telegram.DeviceConfig{
 			DeviceModel:    "NexusValet Bot",
-			SystemVersion:  "1.0.0",
-			AppVersion:     "1.0.0",
+			SystemVersion:  runtime.GOOS + "/" + runtime.GOARCH,
+			AppVersion:     version.AppVersion(),
 			SystemLangCode: "en",
 			LangPack:       "",
 			LangCode:       "en",
@@ -123,18 +221,31 @@ func (b *Bot) createTelegramClient() error {
 		MaxRetries:    -1, // 无限重试
 		DialTimeout:   10 * time.Second,
 		UpdateHandler: &UpdateHandler{bot: b},
+		// 记录发往阅后即焚对话的消息
+		// 记录自己编辑的消息文本，编辑后的命令消息据此区分用户编辑
+		Middlewares: []telegram.Middleware{b.pluginManager.GetEphemeralTracker().Middleware(), b.edits.Middleware()},
+	}
+	// 按错误码统计失败的API请求
+	if b.metrics != nil {
+		options.Middlewares = append(options.Middlewares, b.metrics.Middleware())
 	}
 
 	client := telegram.NewClient(b.config.Telegram.APIID, b.config.Telegram.APIHash, options)
 	b.client = client
 	b.api = client.API()
 
+	// 插件共用的下载器，文件在其他DC时通过客户端连接到该DC
+	b.downloader = download.New(b.api, client)
+	b.pluginManager.SetDownloader(b.downloader)
+
 	// 初始化 AccessHashManager（优先带数据库持久化）
 	if b.sessionMgr != nil {
 		b.accessHashMgr = peers.NewAccessHashManagerWithDB(b.api, b.sessionMgr.GetDB())
 	} else {
 		b.accessHashMgr = peers.NewAccessHashManager(b.api)
 	}
+	b.accessHashMgr.SetMetrics(b.metrics)
+	b.accessHashMgr.SetParticipantScanLimit(b.config.Peers.MaxParticipantScan)
 
 	// 初始化统一的 Peer 解析器，并注入 AccessHashManager
 	b.peerResolver = peers.NewResolver(b.accessHashMgr)
@@ -149,45 +260,77 @@ func (b *Bot) createTelegramClient() error {
 func (b *Bot) Start() error {
 	logger.Debugf("Starting NexusValet...")
 
-	// 执行 BeforeStart 钩子
-	if err := b.hookManager.ExecuteHooks(core.BeforeStart, map[string]interface{}{
-		"version": "v1.0.0",
-	}); err != nil {
+	// 执行 BeforeStart 钩子，钩子写入的数据会传递给 AfterStart
+	startData := map[string]interface{}{
+		"version": version.String(),
+	}
+	if err := b.hookManager.ExecuteHooks(core.BeforeStart, startData); err != nil {
 		return fmt.Errorf("beforeStart hooks failed: %w", err)
 	}
 
-	// 注册所有内置插件
+	// 注册所有内置插件，耗时的初始化推迟到连接之后
+	endPlugins := b.startup.Begin("builtin_plugins")
 	if err := plugin.RegisterBuiltinPlugins(b.pluginManager); err != nil {
 		logger.Errorf("Failed to register builtin plugins: %v", err)
 		// 仍然继续
 	}
+	endPlugins()
+
+	// 指标服务监听失败不影响机器人运行
+	if b.metricsServer != nil {
+		if err := b.metricsServer.Start(); err != nil {
+			logger.Warnf("Failed to start metrics endpoint, metrics disabled: %v", err)
+			b.metricsServer = nil
+		}
+	}
 
 	// 启动 Telegram 客户端
+	endConnect := b.startup.Begin("connect")
 	if err := b.client.Run(b.ctx, func(ctx context.Context) error {
 		logger.Debugf("Telegram client connected")
+		endConnect()
 
-		// 获取自身用户ID
-		self, err := b.api.UsersGetUsers(ctx, []tg.InputUserClass{&tg.InputUserSelf{}})
-		if err != nil {
-			logger.Errorf("Failed to get self user info: %v", err)
-		} else if len(self) > 0 {
-			if user, ok := self[0].(*tg.User); ok {
-				b.selfUserID = user.ID
-				logger.Debugf("Bot user ID: %d", b.selfUserID)
-			}
-		}
+		// 获取自身用户ID和Premium状态
+		endSelf := b.startup.Begin("self")
+		b.refreshSelf(ctx)
+		endSelf()
 
 		// 为插件设置 Peer 解析器和 Telegram 客户端
 		b.pluginManager.SetPeerResolver(b.peerResolver)
 		b.pluginManager.SetTelegramClient(b.api)
 
+		// 在后台并发执行插件连接后的初始化，不阻塞命令处理
+		b.pluginManager.StartPostConnectInit(ctx, 0)
+
+		// 能力检查发现缺失时通知到收藏夹
+		if report := b.pluginManager.GetCapabilityReport(); report != nil && !report.OK() {
+			if _, err := b.api.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+				Peer:     &tg.InputPeerSelf{},
+				Message:  report.Summary(),
+				RandomID: time.Now().UnixNano(),
+			}); err != nil {
+				logger.Warnf("Failed to post capability report: %v", err)
+			}
+		}
+
+		// 启动自检，关键检查失败时中止启动
+		if b.config.SelfTest.Enabled {
+			endSelfTest := b.startup.Begin("selftest")
+			if err := b.runSelfTest(ctx); err != nil {
+				return fmt.Errorf("self-test failed: %w", err)
+			}
+			endSelfTest()
+		}
+
 		// 执行 AfterStart 钩子
-		if err := b.hookManager.ExecuteHooks(core.AfterStart, map[string]interface{}{
-			"client": b.api,
-		}); err != nil {
+		startData["client"] = b.api
+		if err := b.hookManager.ExecuteHooks(core.AfterStart, startData); err != nil {
 			logger.Errorf("AfterStart hooks failed: %v", err)
 		}
 
+		b.startup.Mark("ready")
+		logger.Infof("Startup timing: %s", b.startup.Summary())
+
 		// 等待上下文取消
 		<-ctx.Done()
 		return ctx.Err()
@@ -198,6 +341,45 @@ func (b *Bot) Start() error {
 	return nil
 }
 
+// refreshSelf 获取自身用户信息，更新用户ID和Premium状态
+func (b *Bot) refreshSelf(ctx context.Context) {
+	self, err := b.api.UsersGetUsers(ctx, []tg.InputUserClass{&tg.InputUserSelf{}})
+	if err != nil {
+		logger.Errorf("Failed to get self user info: %v", err)
+		return
+	}
+	if len(self) > 0 {
+		if user, ok := self[0].(*tg.User); ok {
+			b.selfMu.Lock()
+			b.selfUserID = user.ID
+			b.selfUsername = user.Username
+			b.selfMu.Unlock()
+			if b.config.Telegram.BotMode() && !user.Bot {
+				logger.Warnf("telegram.bot_token is set but %s belongs to a user account, delete it to log in as the bot", b.config.Telegram.Session)
+			}
+			b.pluginManager.SetPremium(user.Premium)
+			logger.Debugf("Bot user ID: %d, premium: %v", user.ID, user.Premium)
+		}
+	}
+}
+
+// selfID 返回自己的用户ID，尚未获取时为0
+func (b *Bot) selfID() int64 {
+	b.selfMu.RLock()
+	defer b.selfMu.RUnlock()
+	return b.selfUserID
+}
+
+// selfName 返回自己的用户名
+func (b *Bot) selfName() string {
+	b.selfMu.RLock()
+	defer b.selfMu.RUnlock()
+	return b.selfUsername
+}
+
+// defaultShutdownGrace 关闭时等待正在执行的命令的默认时间
+const defaultShutdownGrace = 10 * time.Second
+
 // Stop 停止机器人
 func (b *Bot) Stop() error {
 	logger.Debugf("Stopping NexusValet...")
@@ -207,9 +389,34 @@ func (b *Bot) Stop() error {
 		logger.Errorf("BeforeStop hooks failed: %v", err)
 	}
 
+	// 在断开连接前等待正在执行的命令和延迟删除，超时后强制退出
+	grace := defaultShutdownGrace
+	if b.config.Bot.ShutdownGrace > 0 {
+		grace = time.Duration(b.config.Bot.ShutdownGrace) * time.Second
+	}
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), grace)
+	if remaining := b.commandParser.Drain(drainCtx); remaining > 0 {
+		logger.Warnf("Shutdown grace period %s exceeded, %d command handlers still running", grace, remaining)
+	}
+	cancelDrain()
+
+	// 关闭下载器到其他DC的连接
+	if b.downloader != nil {
+		if err := b.downloader.Close(); err != nil {
+			logger.Debugf("Failed to close download connections: %v", err)
+		}
+	}
+
 	// 取消上下文以停止客户端
 	b.cancel()
 
+	// 关闭指标服务，未完成的请求最多等待1秒
+	if b.metricsServer != nil {
+		stopCtx, cancelStop := context.WithTimeout(context.Background(), time.Second)
+		b.metricsServer.Stop(stopCtx)
+		cancelStop()
+	}
+
 	// 关闭插件管理器
 	if err := b.pluginManager.Shutdown(); err != nil {
 		logger.Errorf("Failed to shutdown plugin manager: %v", err)
@@ -231,9 +438,15 @@ func (b *Bot) Stop() error {
 
 // handleUpdates 处理传入的 Telegram 更新
 func (b *Bot) handleUpdates(ctx context.Context, updates tg.UpdatesClass) error {
+	// 首批更新处理完成后再在后台预热缓存，避免与首条命令争用数据库
+	defer b.firstUpdate.Do(b.afterFirstUpdate)
+
 	// 从更新类中提取单个更新
 	switch u := updates.(type) {
 	case *tg.Updates:
+		// 缓存更新附带的用户和频道，回复或编辑刚收到的消息时解析器可以直接命中缓存
+		b.accessHashMgr.CacheUsersFromUpdate(u.Users)
+		b.accessHashMgr.CacheChatsFromUpdate(u.Chats)
 		for _, update := range u.Updates {
 			if err := b.handleSingleUpdate(ctx, update); err != nil {
 				logger.Errorf("Failed to handle update: %v", err)
@@ -244,39 +457,85 @@ func (b *Bot) handleUpdates(ctx context.Context, updates tg.UpdatesClass) error
 	case *tg.UpdateShortMessage:
 		// 转换为 UpdateNewMessage 进行处理
 		message := &tg.Message{
-			ID:      u.ID,
-			Message: u.Message,
-			Date:    u.Date,
-			PeerID:  &tg.PeerUser{UserID: u.UserID},
+			ID:        u.ID,
+			Out:       u.Out,
+			Mentioned: u.Mentioned,
+			Message:   u.Message,
+			Date:      u.Date,
+			PeerID:    &tg.PeerUser{UserID: u.UserID},
+			ReplyTo:   u.ReplyTo,
+			Entities:  u.Entities,
 		}
 		return b.handleNewMessage(ctx, &tg.UpdateNewMessage{Message: message})
 	case *tg.UpdateShortChatMessage:
 		// 转换为 UpdateNewMessage 进行处理
 		message := &tg.Message{
-			ID:      u.ID,
-			Message: u.Message,
-			Date:    u.Date,
-			PeerID:  &tg.PeerChat{ChatID: u.ChatID},
-			FromID:  &tg.PeerUser{UserID: u.FromID},
+			ID:        u.ID,
+			Out:       u.Out,
+			Mentioned: u.Mentioned,
+			Message:   u.Message,
+			Date:      u.Date,
+			PeerID:    &tg.PeerChat{ChatID: u.ChatID},
+			FromID:    &tg.PeerUser{UserID: u.FromID},
+			ReplyTo:   u.ReplyTo,
+			Entities:  u.Entities,
 		}
 		return b.handleNewMessage(ctx, &tg.UpdateNewMessage{Message: message})
 	}
 	return nil
 }
 
+// afterFirstUpdate 记录首条更新的处理时间，并以低优先级后台任务预热缓存
+func (b *Bot) afterFirstUpdate() {
+	b.startup.Mark("first_update")
+
+	runner := b.pluginManager.GetTaskRunner()
+	runner.Start(b.ctx, core.TaskOptions{Name: "缓存预热"}, func(ctx context.Context, progress core.ProgressFunc) (string, error) {
+		start := time.Now()
+		if err := b.accessHashMgr.WarmFromDatabase(); err != nil {
+			logger.Warnf("Failed to warm access_hash cache: %v", err)
+			return "", err
+		}
+		b.startup.Record("cache_warmup", time.Since(start))
+		return "", nil
+	})
+}
+
 // handleSingleUpdate 处理单个更新
 func (b *Bot) handleSingleUpdate(ctx context.Context, update tg.UpdateClass) error {
+	// 每个更新分配一个关联ID，随 context 传递到命令和插件的日志与错误中
+	ctx = logger.WithFields(ctx, logger.Fields{CorrelationID: logger.NewCorrelationID()})
+	b.metrics.UpdateReceived(update)
+
 	// 将原始更新分发给原始监听器
 	if err := b.dispatcher.DispatchRaw(ctx, update); err != nil {
 		logger.Errorf("Failed to dispatch raw update: %v", err)
 	}
 
+	// 动态(Stories)相关更新分发给动态监听器
+	if storyEvent, ok := core.ParseStoryUpdate(update); ok {
+		if err := b.dispatcher.DispatchStory(ctx, storyEvent); err != nil {
+			logger.Errorf("Failed to dispatch story event: %v", err)
+		}
+	}
+
 	// 处理特定的更新类型
 	switch upd := update.(type) {
 	case *tg.UpdateNewMessage:
 		return b.handleNewMessage(ctx, upd)
 	case *tg.UpdateNewChannelMessage:
 		return b.handleNewChannelMessage(ctx, upd)
+	case *tg.UpdateEditMessage:
+		return b.handleEditMessage(ctx, upd)
+	case *tg.UpdateEditChannelMessage:
+		return b.handleEditChannelMessage(ctx, upd)
+	case *tg.UpdateStory:
+		// 已由动态监听器处理
+	case *tg.UpdateUser:
+		// 自身用户信息变化(如开通或到期Premium)时重新获取
+		if upd.UserID == b.selfID() {
+			go b.refreshSelf(b.ctx)
+		}
 	default:
 		// 其他更新类型可以在这里处理
 		logger.Debugf("Unhandled update type: %T", update)
@@ -306,28 +565,58 @@ func (b *Bot) handleNewMessage(ctx context.Context, update *tg.UpdateNewMessage)
 	userID := getUserID(message)
 	chatID := getChatID(message)
 
+	// 补充请求字段，UpdateShort* 等未经 handleSingleUpdate 的更新在此分配关联ID
+	fields, _ := logger.FieldsFrom(ctx)
+	if fields.CorrelationID == "" {
+		fields.CorrelationID = logger.NewCorrelationID()
+	}
+	fields.ChatID = chatID
+	fields.MessageID = message.ID
+	ctx = logger.WithFields(ctx, fields)
+	log := logger.Ctx(ctx)
+
+	selfUserID := b.selfID()
+
 	// 处理 getUserID 返回 0 的情况（可能是我们的发出消息）
 	if userID == 0 {
 		// 检查这是否是我们的发出消息
-		if message.Out && b.selfUserID != 0 {
-			userID = b.selfUserID
-			logger.Debugf("Detected outgoing message, setting userID to self: %d", userID)
+		if message.Out && selfUserID != 0 {
+			userID = selfUserID
+			log.Debugf("Detected outgoing message, setting userID to self: %d", userID)
 		} else {
-			logger.Debugf("Unknown user ID and not outgoing message, ignoring")
+			log.Debugf("Unknown user ID and not outgoing message, ignoring")
 			return nil
 		}
 	}
 
-	// 只处理机器人自己发送的消息（userbot 模式）
-	if b.selfUserID != 0 && userID != b.selfUserID {
-		logger.Debugf("Ignoring message from user %d (not self %d)", userID, b.selfUserID)
-		return nil
+	// 只处理自己发送的消息（userbot 模式）和sudo用户的命令，机器人模式下处理发给机器人的
+	// 管理员和sudo用户的命令。其他人的消息只分发给监听收到消息的监听器，命令解析器不会处理
+	fromSudo, fromOwner := false, false
+	if selfUserID != 0 && userID != selfUserID {
+		commandText, addressed := text, true
+		if b.config.Telegram.BotMode() {
+			commandText, addressed = b.botCommandText(chatID, text)
+		}
+		if !addressed || !b.canCommand(userID) || !b.commandParser.IsCommand(commandText) {
+			log.Debugf("Dispatching incoming message from user %d to listeners", userID)
+			return b.dispatcher.DispatchMessage(ctx, &core.MessageEvent{
+				Update:  update,
+				Message: message,
+				Text:    text,
+				UserID:  userID,
+				ChatID:  chatID,
+			})
+		}
+		text = commandText
+		fromSudo = true
+		fromOwner = b.isBotAdmin(userID)
+		log.Debugf("Processing command from user %d (sudo: %v, bot admin: %v)", userID, !fromOwner, fromOwner)
 	}
 
-	logger.Debugf("Processing self message from userID=%d", userID)
+	log.Debugf("Processing self message from userID=%d", userID)
 
 	// 记录消息详情用于调试
-	logger.Debugf("Processing self message: text='%s', userID=%d, chatID=%d, peerType=%T",
+	log.Debugf("Processing self message: text='%s', userID=%d, chatID=%d, peerType=%T",
 		text, userID, chatID, message.PeerID)
 
 	// 存储当前对等体用于回复
@@ -340,12 +629,14 @@ func (b *Bot) handleNewMessage(ctx context.Context, update *tg.UpdateNewMessage)
 		Text:    text,
 		UserID:  userID,
 		ChatID:  chatID,
+		Sudo:    fromSudo,
+		Owner:   fromOwner,
 	}
 
 	// 获取或创建会话
 	sess, err := b.sessionMgr.GetSession(userID, chatID)
 	if err != nil {
-		logger.Errorf("Failed to get session: %v", err)
+		log.Errorf("Failed to get session: %v", err)
 		return err
 	}
 	sess.Timestamp = time.Now().Unix()
@@ -353,24 +644,53 @@ func (b *Bot) handleNewMessage(ctx context.Context, update *tg.UpdateNewMessage)
 	// 创建会话上下文
 	sessionCtx := session.NewSessionContext(sess, b.sessionMgr)
 
-	// 为命令处理设置响应函数
+	// 记录命令消息的文本，之后文本未变的编辑更新不会再次执行命令
 	if b.commandParser.IsCommand(text) {
-		// 我们将在命令解析器中处理这个
+		b.edits.remember(chatID, message.ID, text)
 	}
 
 	// 分发消息事件
 	if err := b.dispatcher.DispatchMessage(ctx, msgEvent); err != nil {
-		logger.Errorf("Failed to dispatch message: %v", err)
+		log.Errorf("Failed to dispatch message: %v", err)
 	}
 
 	// 保存会话
 	if err := sessionCtx.Save(); err != nil {
-		logger.Errorf("Failed to save session: %v", err)
+		log.Errorf("Failed to save session: %v", err)
 	}
 
 	return nil
 }
 
+// canCommand 其他用户是否可以触发命令：sudo用户，以及机器人模式下的 telegram.bot_admins
+func (b *Bot) canCommand(userID int64) bool {
+	return b.isBotAdmin(userID) || b.pluginManager.GetSudo().IsSudo(userID)
+}
+
+// isBotAdmin 机器人模式下用户是否在 telegram.bot_admins 中。管理员是所有者，可以执行
+// 只限所有者的命令和管理sudo列表
+func (b *Bot) isBotAdmin(userID int64) bool {
+	return b.config.Telegram.BotMode() && slices.Contains(b.config.Telegram.BotAdmins, userID)
+}
+
+// botCommandText 机器人模式下判断消息是否发给机器人：私聊中的消息都是，群组中只有
+// 命令名后带 @机器人用户名 的命令是。返回去掉 @用户名 后的文本
+func (b *Bot) botCommandText(chatID int64, text string) (string, bool) {
+	if chatID > 0 {
+		return text, true
+	}
+	end := strings.IndexFunc(text, unicode.IsSpace)
+	if end < 0 {
+		end = len(text)
+	}
+	name, mention, ok := strings.Cut(text[:end], "@")
+	selfUsername := b.selfName()
+	if !ok || selfUsername == "" || !strings.EqualFold(mention, selfUsername) {
+		return text, false
+	}
+	return name + text[end:], true
+}
+
 // handleNewChannelMessage 处理新的频道/超级群组消息更新
 func (b *Bot) handleNewChannelMessage(ctx context.Context, update *tg.UpdateNewChannelMessage) error {
 	message, ok := update.Message.(*tg.Message)
@@ -380,10 +700,6 @@ func (b *Bot) handleNewChannelMessage(ctx context.Context, update *tg.UpdateNewC
 
 	logger.Debugf("Processing channel message: ID=%d, text='%s'", message.ID, message.Message)
 
-	// 存储消息和更新用于编辑上下文
-	b.lastMessage = message
-	b.lastUpdate = update
-
 	// 转换为 UpdateNewMessage 格式用于统一处理
 	newMessageUpdate := &tg.UpdateNewMessage{
 		Message:  message,
@@ -514,187 +830,19 @@ func (b *Bot) editWithPhoto(ctx context.Context, chatID int64, messageID int, im
 
 // editMessage 编辑现有消息
 func (b *Bot) editMessage(ctx context.Context, chatID int64, messageID int, text string) error {
-	if chatID > 0 {
-		// 用户 ID: 正整数 - 私聊
-		peer := &tg.InputPeerUser{UserID: chatID}
-		logger.Debugf("Attempting to edit message %d in private chat with peer type %T", messageID, peer)
-
-		_, err := b.api.MessagesEditMessage(ctx, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      messageID,
-			Message: text,
-		})
-
-		if err != nil {
-			logger.Errorf("Failed to edit message %d in chatID=%d: %v", messageID, chatID, err)
-		} else {
-			logger.Debugf("Successfully edited message %d in chatID=%d", messageID, chatID)
-		}
-		return err
-
-	} else if chatID > -1000000000000 {
-		// 普通群组 ID: 负整数 (e.g., -123456789)
-		peer := &tg.InputPeerChat{ChatID: -chatID}
-		logger.Debugf("Attempting to edit message %d in group chat with peer type %T", messageID, peer)
-
-		_, err := b.api.MessagesEditMessage(ctx, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      messageID,
-			Message: text,
-		})
-
-		if err != nil {
-			logger.Errorf("Failed to edit message %d in chatID=%d: %v", messageID, chatID, err)
-		} else {
-			logger.Debugf("Successfully edited message %d in chatID=%d", messageID, chatID)
-		}
-		return err
-
-	} else {
-		// 超级群组和频道 ID: 以 -100 开头的长负整数 (e.g., -1001234567890)
-		channelID := -chatID - 1000000000000
-		logger.Debugf("Supergroup/Channel edit detected: chatID=%d, channelID=%d", chatID, channelID)
-
-		// 对于频道消息编辑，我们需要检查是否从更新中获得了正确的对等体
-		var peer tg.InputPeerClass
-
-		// 检查我们是否有来自原始频道消息的存储更新
-		if b.lastUpdate != nil {
-			if channelUpdate, ok := b.lastUpdate.(*tg.UpdateNewChannelMessage); ok {
-				if lastMsg, ok := channelUpdate.Message.(*tg.Message); ok && lastMsg.ID == messageID {
-					// 我们正在编辑刚刚收到的消息，使用消息中的对等体
-					if peerChannel, ok := lastMsg.PeerID.(*tg.PeerChannel); ok {
-						peer = &tg.InputPeerChannel{
-							ChannelID:  peerChannel.ChannelID,
-							AccessHash: 0, // Try with 0 first for own messages
-						}
-						logger.Debugf("Using InputPeerChannel from stored update: ChannelID=%d", peerChannel.ChannelID)
-					} else {
-						peer = &tg.InputPeerSelf{}
-						logger.Debugf("Fallback to InputPeerSelf")
-					}
-				} else {
-					peer = &tg.InputPeerSelf{}
-					logger.Debugf("Message ID mismatch, using InputPeerSelf")
-				}
-			} else {
-				peer = &tg.InputPeerSelf{}
-				logger.Debugf("Not a channel update, using InputPeerSelf")
-			}
-		} else {
-			peer = &tg.InputPeerSelf{}
-			logger.Debugf("No stored update, using InputPeerSelf")
-		}
-
-		logger.Debugf("Attempting to edit message %d using messages.editMessage with peer type %T", messageID, peer)
-
-		_, err := b.api.MessagesEditMessage(ctx, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      messageID,
-			Message: text,
-		})
-
-		// 实现针对频道相关错误的重试机制
-		if err != nil {
-			errStr := err.Error()
-			if strings.Contains(errStr, "CHANNEL_INVALID") || strings.Contains(errStr, "PEER_ID_INVALID") || strings.Contains(errStr, "ACCESS_HASH_INVALID") {
-				logger.Debugf("Peer error detected (%v), attempting to resolve with alternative methods", err)
-
-				// 重试：尝试获取新的频道信息
-				if retryPeer, retryErr := b.resolveChannelPeer(ctx, channelID); retryErr == nil {
-					logger.Debugf("Retrying with resolved peer: %T", retryPeer)
-					_, retryEditErr := b.api.MessagesEditMessage(ctx, &tg.MessagesEditMessageRequest{
-						Peer:    retryPeer,
-						ID:      messageID,
-						Message: text,
-					})
-
-					if retryEditErr == nil {
-						logger.Debugf("Successfully edited message %d after peer resolution", messageID)
-						return nil
-					} else {
-						logger.Debugf("Retry with resolved peer failed: %v", retryEditErr)
-					}
-				} else {
-					logger.Debugf("Failed to resolve peer: %v", retryErr)
-				}
-			}
-
-			logger.Errorf("Failed to edit message %d in chatID=%d: %v", messageID, chatID, err)
-		} else {
-			logger.Debugf("Successfully edited message %d in chatID=%d", messageID, chatID)
-		}
+	peer, err := b.peerResolver.ResolveFromChatID(ctx, chatID)
+	if err != nil {
 		return err
 	}
-}
-
-// resolveChannelPeer 尝试使用新的访问哈希解析频道对等体
-func (b *Bot) resolveChannelPeer(ctx context.Context, channelID int64) (tg.InputPeerClass, error) {
-	logger.Debugf("Attempting to resolve channel peer for channelID: %d", channelID)
-
-	// 尝试使用 MessagesGetChannels 获取频道信息
-	channels, err := b.api.ChannelsGetChannels(ctx, []tg.InputChannelClass{
-		&tg.InputChannel{
-			ChannelID:  channelID,
-			AccessHash: 0, // Try with 0 first
-		},
+	_, err = b.api.MessagesEditMessage(ctx, &tg.MessagesEditMessageRequest{
+		Peer:    peer,
+		ID:      messageID,
+		Message: text,
 	})
-
 	if err != nil {
-		logger.Debugf("ChannelsGetChannels failed with access hash 0: %v", err)
-
-		// 替代方案：尝试从可能有缓存信息的对话/聊天中获取
-		dialogs, err := b.api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
-			OffsetDate: 0,
-			OffsetID:   0,
-			OffsetPeer: &tg.InputPeerEmpty{},
-			Limit:      100,
-		})
-
-		if err != nil {
-			return nil, fmt.Errorf("failed to get dialogs: %w", err)
-		}
-
-		// 在对话中查找我们的频道
-		if dialogsSlice, ok := dialogs.(*tg.MessagesDialogs); ok {
-			for _, chat := range dialogsSlice.Chats {
-				if channel, ok := chat.(*tg.Channel); ok && channel.ID == channelID {
-					logger.Debugf("Found channel in dialogs with AccessHash: %d", channel.AccessHash)
-					return &tg.InputPeerChannel{
-						ChannelID:  channel.ID,
-						AccessHash: channel.AccessHash,
-					}, nil
-				}
-			}
-		} else if dialogsSlice, ok := dialogs.(*tg.MessagesDialogsSlice); ok {
-			for _, chat := range dialogsSlice.Chats {
-				if channel, ok := chat.(*tg.Channel); ok && channel.ID == channelID {
-					logger.Debugf("Found channel in dialogs slice with AccessHash: %d", channel.AccessHash)
-					return &tg.InputPeerChannel{
-						ChannelID:  channel.ID,
-						AccessHash: channel.AccessHash,
-					}, nil
-				}
-			}
-		}
-
-		return nil, fmt.Errorf("channel not found in dialogs")
-	}
-
-	// 从响应中提取频道信息
-	if channelsSlice, ok := channels.(*tg.MessagesChats); ok {
-		for _, chat := range channelsSlice.Chats {
-			if channel, ok := chat.(*tg.Channel); ok && channel.ID == channelID {
-				logger.Debugf("Resolved channel with AccessHash: %d", channel.AccessHash)
-				return &tg.InputPeerChannel{
-					ChannelID:  channel.ID,
-					AccessHash: channel.AccessHash,
-				}, nil
-			}
-		}
+		logger.Errorf("Failed to edit message %d in chatID=%d: %v", messageID, chatID, err)
 	}
-
-	return nil, fmt.Errorf("channel not found in response")
+	return err
 }
 
 // 提取用户和聊天ID的辅助函数
@@ -720,6 +868,11 @@ func getUserID(message *tg.Message) int64 {
 		}
 	}
 
+	// 私聊中收到的消息可能没有 FromID，发送者就是对话的另一方
+	if peer, ok := message.PeerID.(*tg.PeerUser); ok && message.FromID == nil {
+		return peer.UserID
+	}
+
 	// 如果我们无法从 FromID 确定用户ID，记录消息详情
 	logger.Debugf("Could not determine user ID from incoming message. FromID: %T, PeerID: %T",
 		message.FromID, message.PeerID)
@@ -766,7 +919,7 @@ func createInputPeerFromMessage(message *tg.Message) tg.InputPeerClass {
 }
 
 // checkAndCreateSession 检查会话是否存在，如果不存在，引导登录
-func checkAndCreateSession(cfg *config.Config) error {
+func checkAndCreateSession(cfg *config.Config, loginQR bool) error {
 	sessionFile := cfg.Telegram.Session
 
 	// 确保会话文件的目录存在
@@ -777,7 +930,18 @@ func checkAndCreateSession(cfg *config.Config) error {
 	// 检查会话是否存在
 	if _, err := os.Stat(sessionFile); os.IsNotExist(err) {
 		logger.Infof("Session file not found, starting authentication process...")
-		return performAuthentication(cfg)
+		authenticate := func() error { return performAuthentication(cfg, loginQR) }
+		if value := cfg.Telegram.SessionStringValue(); value != "" {
+			authenticate = func() error { return importSession(cfg, value) }
+		} else if cfg.Telegram.BotMode() {
+			authenticate = func() error { return performBotAuthentication(cfg) }
+		}
+		if err := authenticate(); err != nil {
+			// 未完成登录的会话不能复用，删除后下次启动重新登录
+			os.Remove(sessionFile)
+			return err
+		}
+		return nil
 	}
 
 	logger.Infof("Session file found, will attempt to use existing session")
@@ -785,42 +949,37 @@ func checkAndCreateSession(cfg *config.Config) error {
 }
 
 // performAuthentication 执行 Telegram 身份验证流程
-func performAuthentication(cfg *config.Config) error {
-	logger.Infof("请输入您的手机号码 (格式: +1234567890):")
-
-	reader := bufio.NewReader(os.Stdin)
-	phone, err := reader.ReadString('\n')
-	if err != nil {
-		return fmt.Errorf("failed to read phone number: %w", err)
-	}
-	phone = strings.TrimSpace(phone)
+func performAuthentication(cfg *config.Config, loginQR bool) error {
+	// 二维码登录需要接收 updateLoginToken 更新
+	dispatcher := tg.NewUpdateDispatcher()
+	loggedIn := qrlogin.OnLoginToken(dispatcher)
 
 	// 为身份验证创建临时客户端
 	options := telegram.Options{
 		SessionStorage: &telegram.FileSessionStorage{
 			Path: cfg.Telegram.Session,
 		},
+		UpdateHandler: dispatcher,
 	}
 
 	client := telegram.NewClient(cfg.Telegram.APIID, cfg.Telegram.APIHash, options)
 
 	return client.Run(context.Background(), func(ctx context.Context) error {
-		// 开始身份验证流程
-		codeAuth := auth.CodeAuthenticatorFunc(func(ctx context.Context, sentCode *tg.AuthSentCode) (string, error) {
-			logger.Infof("验证码已发送，请输入验证码:")
-			code, err := reader.ReadString('\n')
-			if err != nil {
-				return "", fmt.Errorf("failed to read verification code: %w", err)
-			}
-			return strings.TrimSpace(code), nil
-		})
-
-		flow := auth.NewFlow(
-			auth.Constant(phone, "Bot", auth.CodeOnly(phone, codeAuth)),
-			auth.SendCodeOptions{},
-		)
+		status, err := client.Auth().Status(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get auth status: %w", err)
+		}
+		if status.Authorized {
+			return nil
+		}
 
-		if err := client.Auth().IfNecessary(ctx, flow); err != nil {
+		flow := authflow.New(authflow.NewStdTerminal(), authflow.NewTelegramClient(client, loggedIn))
+		if loginQR {
+			err = flow.QR(ctx)
+		} else {
+			err = flow.Phone(ctx)
+		}
+		if err != nil {
 			return fmt.Errorf("authentication failed: %w", err)
 		}
 
@@ -829,8 +988,65 @@ func performAuthentication(cfg *config.Config) error {
 	})
 }
 
+// importSession 导入会话字符串并确认会话仍然有效
+func importSession(cfg *config.Config, value string) error {
+	logger.Infof("Importing session from session string...")
+	ctx := context.Background()
+	if err := authflow.ImportSessionString(ctx, cfg.Telegram.Session, value); err != nil {
+		return err
+	}
+
+	client := telegram.NewClient(cfg.Telegram.APIID, cfg.Telegram.APIHash, telegram.Options{
+		SessionStorage: &telegram.FileSessionStorage{
+			Path: cfg.Telegram.Session,
+		},
+	})
+	return client.Run(ctx, func(ctx context.Context) error {
+		status, err := client.Auth().Status(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get auth status: %w", err)
+		}
+		if !status.Authorized {
+			return fmt.Errorf("imported session is not authorized, it may have been terminated")
+		}
+
+		logger.Infof("会话导入成功，会话已保存")
+		return nil
+	})
+}
+
+// performBotAuthentication 使用 telegram.bot_token 以机器人账号登录
+func performBotAuthentication(cfg *config.Config) error {
+	client := telegram.NewClient(cfg.Telegram.APIID, cfg.Telegram.APIHash, telegram.Options{
+		SessionStorage: &telegram.FileSessionStorage{
+			Path: cfg.Telegram.Session,
+		},
+	})
+
+	return client.Run(context.Background(), func(ctx context.Context) error {
+		status, err := client.Auth().Status(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get auth status: %w", err)
+		}
+		if status.Authorized {
+			return nil
+		}
+		if _, err := client.Auth().Bot(ctx, cfg.Telegram.BotToken); err != nil {
+			return fmt.Errorf("bot authentication failed: %w", err)
+		}
+
+		logger.Infof("机器人登录成功，会话已保存")
+		return nil
+	})
+}
+
 func main() {
-	logger.Infof("NexusValet v1.0.0 starting...")
+	allowDowngrade := flag.Bool("allow-downgrade", false, "允许使用比数据库记录更旧的版本启动")
+	loginQR := flag.Bool("login-qr", false, "首次登录时使用二维码代替手机号验证码")
+	flag.BoolVar(loginQR, "qr", false, "同 -login-qr")
+	flag.Parse()
+
+	logger.Infof("NexusValet %s starting...", version.Get().Full())
 
 	// 加载配置
 	configPath := config.GetConfigPath()
@@ -840,24 +1056,25 @@ func main() {
 	}
 
 	// 规范化会话文件路径，确保相对于配置文件位置
-	cfg.Telegram.Session = config.NormalizePath(configPath, cfg.Telegram.Session)
-	cfg.Telegram.Database = config.NormalizePath(configPath, cfg.Telegram.Database)
+	cfg.NormalizePaths(configPath)
 
 	// 从配置设置日志级别
 	logger.SetLevel(logger.ParseLevel(cfg.Logger.Level))
+	logger.SetModuleLevels(cfg.Logger.ModuleLevels())
 
 	logger.Infof("Configuration loaded successfully")
 
 	// 检查并在需要时创建会话
-	if err := checkAndCreateSession(cfg); err != nil {
+	if err := checkAndCreateSession(cfg, *loginQR || cfg.Telegram.LoginMethod == "qr"); err != nil {
 		logger.Fatalf("Authentication failed: %v", err)
 	}
 
 	// 创建机器人实例
-	bot, err := NewBot(cfg)
+	bot, err := NewBot(cfg, *allowDowngrade)
 	if err != nil {
 		logger.Fatalf("Failed to create bot: %v", err)
 	}
+	bot.pluginManager.SetConfig(configPath, cfg)
 
 	// 设置信号处理
 	sigChan := make(chan os.Signal, 1)
@@ -869,7 +1086,8 @@ func main() {
 		errChan <- bot.Start()
 	}()
 
-	// 等待信号或错误
+	// 等待信号、错误或 .restart/.shutdown 的请求
+	restart := false
 	select {
 	case sig := <-sigChan:
 		logger.Infof("Received signal: %v", sig)
@@ -877,10 +1095,18 @@ func main() {
 		if err != nil {
 			logger.Errorf("Bot error: %v", err)
 		}
+	case restart = <-bot.pluginManager.StopRequests():
+		logger.Infof("Stop requested by command (restart: %v)", restart)
 	}
 
 	// 停止机器人
 	if err := bot.Stop(); err != nil {
 		logger.Errorf("Failed to stop bot: %v", err)
 	}
+
+	if restart {
+		if err := restartProcess(); err != nil {
+			logger.Fatalf("Failed to restart: %v", err)
+		}
+	}
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestGetChatIDMatchesListenerFilterForm(t *testing.T) {
+	// 监听器的 ChatIDs 使用与 Bot API 相同的形式，频道和超级群以 -100 开头
+	tests := []struct {
+		peer tg.PeerClass
+		want int64
+	}{
+		{&tg.PeerChannel{ChannelID: 1234567890}, -1001234567890},
+		{&tg.PeerChannel{ChannelID: 1}, -1000000000001},
+		{&tg.PeerChat{ChatID: 1234567890}, -1234567890},
+		{&tg.PeerUser{UserID: 1234567890}, 1234567890},
+	}
+	for _, tt := range tests {
+		if got := getChatID(&tg.Message{PeerID: tt.peer}); got != tt.want {
+			t.Errorf("getChatID(%v) = %d, want %d", tt.peer, got, tt.want)
+		}
+	}
+	if got := getChatID(&tg.Message{}); got != 0 {
+		t.Errorf("getChatID without peer = %d", got)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/selftest"
+	"nexusvalet/internal/session"
+	"nexusvalet/pkg/logger"
+
+	"github.com/gotd/td/tg"
+)
+
+// runSelfTest 执行启动自检并把结果发送到收藏夹。关键检查失败时返回错误以中止启动
+func (b *Bot) runSelfTest(ctx context.Context) error {
+	checks := append(b.coreSelfTestChecks(), b.pluginManager.SelfTestChecks()...)
+	report := selftest.Run(ctx, checks)
+	b.pluginManager.SetSelfTestReport(report)
+
+	summary := report.Summary()
+	if report.Passed() {
+		logger.Infof("Self-test passed")
+	} else {
+		logger.Warnf("Self-test finished with failures:\n%s", summary)
+	}
+
+	if _, err := b.api.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+		Peer:     &tg.InputPeerSelf{},
+		Message:  summary,
+		RandomID: time.Now().UnixNano(),
+	}); err != nil {
+		logger.Warnf("Failed to post self-test summary: %v", err)
+	}
+
+	return report.CriticalFailure()
+}
+
+// coreSelfTestChecks 返回机器人自身的检查项
+func (b *Bot) coreSelfTestChecks() []selftest.Check {
+	return []selftest.Check{
+		{Name: "database", Critical: true, Timeout: 5 * time.Second, Run: b.checkDatabase},
+		{Name: "schema", Critical: true, Timeout: 5 * time.Second, Run: b.checkSchema},
+		{Name: "messages", Timeout: 20 * time.Second, Run: b.checkMessages},
+		{Name: "peers", Timeout: 15 * time.Second, Run: b.checkPeers},
+	}
+}
+
+// checkDatabase 验证SQLite可读写
+func (b *Bot) checkDatabase(ctx context.Context) error {
+	return probeDatabase(ctx, b.sessionMgr.GetDB())
+}
+
+// probeDatabase 在事务中创建探测表并读写一行，最后回滚，不在数据库中留下任何内容
+func probeDatabase(ctx context.Context, db *sql.DB) error {
+	// 旧版本的自检会留下 selftest_probe 表
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS selftest_probe"); err != nil {
+		return fmt.Errorf("database is not writable: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("database is not writable: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE selftest_probe (
+		id INTEGER PRIMARY KEY,
+		value TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("database is not writable: %w", err)
+	}
+
+	token := fmt.Sprintf("%d", time.Now().UnixNano())
+	if _, err := tx.ExecContext(ctx, "INSERT INTO selftest_probe (id, value) VALUES (1, ?)", token); err != nil {
+		return fmt.Errorf("database is not writable: %w", err)
+	}
+
+	var value string
+	if err := tx.QueryRowContext(ctx, "SELECT value FROM selftest_probe WHERE id = 1").Scan(&value); err != nil {
+		return fmt.Errorf("database is not readable: %w", err)
+	}
+	if value != token {
+		return fmt.Errorf("database read back %q, expected %q", value, token)
+	}
+	return nil
+}
+
+// checkSchema 验证没有未执行的数据库迁移
+func (b *Bot) checkSchema(ctx context.Context) error {
+	record, err := b.sessionMgr.GetVersionRecord()
+	if err != nil {
+		return err
+	}
+	if record.SchemaVersion < session.SchemaVersion {
+		return fmt.Errorf("pending migrations: database schema v%d, binary expects v%d", record.SchemaVersion, session.SchemaVersion)
+	}
+	return nil
+}
+
+// checkMessages 在收藏夹中发送、编辑并删除一条消息
+func (b *Bot) checkMessages(ctx context.Context) error {
+	peer := &tg.InputPeerSelf{}
+	updates, err := b.api.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+		Peer:     peer,
+		Message:  "🩺 self-test",
+		RandomID: time.Now().UnixNano(),
+	})
+	if err != nil {
+		return fmt.Errorf("send failed: %w", err)
+	}
+
+	msgID := command.SentMessageID(updates)
+	if msgID == 0 {
+		return fmt.Errorf("send succeeded but message ID is unknown")
+	}
+
+	if _, err := b.api.MessagesEditMessage(ctx, &tg.MessagesEditMessageRequest{
+		Peer:    peer,
+		ID:      msgID,
+		Message: "🩺 self-test (edited)",
+	}); err != nil {
+		return fmt.Errorf("edit failed: %w", err)
+	}
+
+	if _, err := b.api.MessagesDeleteMessages(ctx, &tg.MessagesDeleteMessagesRequest{
+		ID:     []int{msgID},
+		Revoke: true,
+	}); err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	return nil
+}
+
+// checkPeers 从对话列表取一个对话并通过Peer解析器解析
+func (b *Bot) checkPeers(ctx context.Context) error {
+	dialogs, err := b.api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
+		OffsetPeer: &tg.InputPeerEmpty{},
+		Limit:      10,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get dialogs: %w", err)
+	}
+
+	var list []tg.DialogClass
+	switch d := dialogs.(type) {
+	case *tg.MessagesDialogs:
+		list = d.Dialogs
+	case *tg.MessagesDialogsSlice:
+		list = d.Dialogs
+	}
+
+	for _, dialog := range list {
+		var chatID int64
+		switch p := dialog.GetPeer().(type) {
+		case *tg.PeerUser:
+			if p.UserID == b.selfID() {
+				continue
+			}
+			chatID = p.UserID
+		case *tg.PeerChat:
+			chatID = -p.ChatID
+		case *tg.PeerChannel:
+			chatID = -1000000000000 - p.ChannelID
+		}
+		if _, err := b.peerResolver.ResolveFromChatID(ctx, chatID); err != nil {
+			return fmt.Errorf("failed to resolve %d: %w", chatID, err)
+		}
+		return nil
+	}
+	return selftest.Skipf("no dialogs to resolve")
+}
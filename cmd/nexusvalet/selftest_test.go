@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestProbeDatabaseLeavesNoTable(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "probe.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// 旧版本的自检留下的表会被清理
+	if _, err := db.Exec("CREATE TABLE selftest_probe (id INTEGER PRIMARY KEY, value TEXT NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := probeDatabase(context.Background(), db); err != nil {
+			t.Fatalf("probeDatabase run %d: %v", i+1, err)
+		}
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'selftest_probe'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatal("probeDatabase left the selftest_probe table behind")
+	}
+}
+
+func TestProbeDatabaseReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ro.db")
+	rw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rw.Exec("CREATE TABLE t (x)"); err != nil {
+		t.Fatal(err)
+	}
+	rw.Close()
+
+	ro, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if err := probeDatabase(context.Background(), ro); err == nil {
+		t.Fatal("probeDatabase should fail on a read-only database")
+	}
+}
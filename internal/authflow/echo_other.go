@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package authflow
+
+import "errors"
+
+// disableEcho 当前平台不支持关闭回显，密码将以普通输入读取
+func disableEcho(fd int) (func(), error) {
+	return nil, errors.New("hiding input is not supported on this platform")
+}
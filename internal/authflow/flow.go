@@ -0,0 +1,255 @@
+package authflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrPasswordNeeded 账号开启了两步验证，需要输入云密码
+	ErrPasswordNeeded = errors.New("2FA password required")
+	// ErrPasswordInvalid 云密码错误
+	ErrPasswordInvalid = errors.New("invalid 2FA password")
+	// ErrCodeInvalid 验证码错误
+	ErrCodeInvalid = errors.New("invalid phone code")
+	// ErrCodeExpired 验证码已过期
+	ErrCodeExpired = errors.New("phone code expired")
+	// ErrAttemptsExceeded 重试次数用完
+	ErrAttemptsExceeded = errors.New("too many attempts")
+)
+
+// FloodWaitError 请求过于频繁，需要等待Duration后重试
+type FloodWaitError struct {
+	Duration time.Duration
+}
+
+// Error 实现error接口
+func (e *FloodWaitError) Error() string {
+	return fmt.Sprintf("flood wait %s", e.Duration)
+}
+
+// Terminal 登录过程的终端交互
+type Terminal interface {
+	// ReadLine 显示提示并读取一行输入
+	ReadLine(prompt string) (string, error)
+	// ReadPassword 显示提示并读取不回显的输入
+	ReadPassword(prompt string) (string, error)
+	// Println 输出一行信息
+	Println(msg string)
+}
+
+// Client 登录所需的Telegram操作，错误需要映射为本包定义的错误
+type Client interface {
+	// SendCode 发送验证码并返回code hash
+	SendCode(ctx context.Context, phone string) (string, error)
+	// SignIn 使用验证码登录，需要两步验证时返回ErrPasswordNeeded
+	SignIn(ctx context.Context, phone, code, codeHash string) error
+	// PasswordHint 返回云密码提示，可能为空
+	PasswordHint(ctx context.Context) (string, error)
+	// Password 使用云密码完成登录
+	Password(ctx context.Context, password string) error
+	// QR 执行二维码登录，show在每次生成新的登录链接时调用。需要两步验证时返回ErrPasswordNeeded
+	QR(ctx context.Context, show func(url string, expires time.Time) error) error
+}
+
+const (
+	// DefaultPasswordAttempts 云密码最多尝试次数
+	DefaultPasswordAttempts = 3
+	// DefaultCodeAttempts 验证码最多尝试次数
+	DefaultCodeAttempts = 3
+	// DefaultMaxFloodWait 自动等待的最长FloodWait，更长时提示稍后重试
+	DefaultMaxFloodWait = 2 * time.Minute
+)
+
+// Flow 交互式登录流程
+type Flow struct {
+	Term             Terminal
+	Client           Client
+	PasswordAttempts int
+	CodeAttempts     int
+	MaxFloodWait     time.Duration
+	// Sleep 等待FloodWait，为nil时使用可被ctx中断的time.After
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New 创建使用默认重试设置的登录流程
+func New(term Terminal, client Client) *Flow {
+	return &Flow{
+		Term:             term,
+		Client:           client,
+		PasswordAttempts: DefaultPasswordAttempts,
+		CodeAttempts:     DefaultCodeAttempts,
+		MaxFloodWait:     DefaultMaxFloodWait,
+	}
+}
+
+// Phone 手机号+验证码登录，必要时继续两步验证
+func (f *Flow) Phone(ctx context.Context) error {
+	phone, err := f.Term.ReadLine("请输入您的手机号码 (格式: +1234567890):")
+	if err != nil {
+		return fmt.Errorf("failed to read phone number: %w", err)
+	}
+	phone = strings.ReplaceAll(strings.TrimSpace(phone), " ", "")
+	if phone == "" {
+		return fmt.Errorf("phone number is empty")
+	}
+
+	codeHash, err := f.sendCode(ctx, phone)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		code, err := f.Term.ReadLine("验证码已发送，请输入验证码:")
+		if err != nil {
+			return fmt.Errorf("failed to read verification code: %w", err)
+		}
+		code = strings.TrimSpace(code)
+
+		err = f.retryFlood(ctx, func() error { return f.Client.SignIn(ctx, phone, code, codeHash) })
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, ErrPasswordNeeded):
+			return f.password(ctx)
+		case errors.Is(err, ErrCodeExpired):
+			f.Term.Println("验证码已过期，正在重新发送...")
+			if codeHash, err = f.sendCode(ctx, phone); err != nil {
+				return err
+			}
+			attempt = 0
+		case errors.Is(err, ErrCodeInvalid):
+			if attempt >= f.codeAttempts() {
+				return fmt.Errorf("验证码错误次数过多: %w", ErrAttemptsExceeded)
+			}
+			f.Term.Println(fmt.Sprintf("验证码错误，请重新输入 (剩余 %d 次)", f.codeAttempts()-attempt))
+		default:
+			return fmt.Errorf("sign in failed: %w", err)
+		}
+	}
+}
+
+// QR 二维码登录，必要时继续两步验证
+func (f *Flow) QR(ctx context.Context) error {
+	err := f.Client.QR(ctx, func(url string, expires time.Time) error {
+		f.Term.Println("请在已登录的 Telegram 客户端中打开 设置 > 设备 > 连接桌面设备，扫描以下二维码:")
+		if art, err := RenderQR(url); err == nil {
+			f.Term.Println(art)
+		} else {
+			f.Term.Println("无法生成二维码，请在已登录的设备上打开以下链接:")
+		}
+		f.Term.Println(url)
+		f.Term.Println(fmt.Sprintf("二维码将在 %s 过期，过期后会自动刷新", expires.Local().Format("15:04:05")))
+		return nil
+	})
+
+	var flood *FloodWaitError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrPasswordNeeded):
+		return f.password(ctx)
+	case errors.As(err, &flood):
+		return fmt.Errorf("请求过于频繁，请在 %s 后重试: %w", flood.Duration.Round(time.Second), err)
+	default:
+		return fmt.Errorf("QR login failed: %w", err)
+	}
+}
+
+// password 两步验证，显示密码提示并允许有限次重试
+func (f *Flow) password(ctx context.Context) error {
+	hint, err := f.Client.PasswordHint(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get password hint: %w", err)
+	}
+
+	f.Term.Println("该账号已开启两步验证")
+	if hint != "" {
+		f.Term.Println("密码提示: " + hint)
+	}
+
+	attempts := f.PasswordAttempts
+	if attempts <= 0 {
+		attempts = DefaultPasswordAttempts
+	}
+	for attempt := 1; attempt <= attempts; attempt++ {
+		password, err := f.Term.ReadPassword("请输入两步验证密码:")
+		if err != nil {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+
+		err = f.retryFlood(ctx, func() error { return f.Client.Password(ctx, password) })
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, ErrPasswordInvalid):
+			if attempt < attempts {
+				f.Term.Println(fmt.Sprintf("密码错误，请重新输入 (剩余 %d 次)", attempts-attempt))
+			}
+		default:
+			return fmt.Errorf("password check failed: %w", err)
+		}
+	}
+	return fmt.Errorf("两步验证密码错误次数过多: %w", ErrAttemptsExceeded)
+}
+
+// sendCode 发送验证码
+func (f *Flow) sendCode(ctx context.Context, phone string) (string, error) {
+	var codeHash string
+	err := f.retryFlood(ctx, func() error {
+		var err error
+		codeHash, err = f.Client.SendCode(ctx, phone)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send code: %w", err)
+	}
+	return codeHash, nil
+}
+
+// retryFlood 执行请求，遇到较短的FloodWait时等待后重试
+func (f *Flow) retryFlood(ctx context.Context, call func() error) error {
+	for {
+		err := call()
+		var flood *FloodWaitError
+		if !errors.As(err, &flood) {
+			return err
+		}
+		if err := f.waitFlood(ctx, flood); err != nil {
+			return err
+		}
+	}
+}
+
+// waitFlood 等待FloodWait。超过MaxFloodWait时返回带重试时间提示的错误
+func (f *Flow) waitFlood(ctx context.Context, flood *FloodWaitError) error {
+	limit := f.MaxFloodWait
+	if limit <= 0 {
+		limit = DefaultMaxFloodWait
+	}
+	if flood.Duration > limit {
+		return fmt.Errorf("请求过于频繁，请在 %s 后重试: %w", flood.Duration.Round(time.Second), flood)
+	}
+
+	f.Term.Println(fmt.Sprintf("请求过于频繁，%s 后自动重试...", flood.Duration.Round(time.Second)))
+	if f.Sleep != nil {
+		return f.Sleep(ctx, flood.Duration)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(flood.Duration):
+		return nil
+	}
+}
+
+// codeAttempts 返回验证码最多尝试次数
+func (f *Flow) codeAttempts() int {
+	if f.CodeAttempts <= 0 {
+		return DefaultCodeAttempts
+	}
+	return f.CodeAttempts
+}
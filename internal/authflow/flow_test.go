@@ -0,0 +1,364 @@
+package authflow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedTerminal 按顺序返回预设输入，并记录提示和输出
+type scriptedTerminal struct {
+	lines     []string
+	passwords []string
+	prompts   []string
+	printed   []string
+}
+
+func (t *scriptedTerminal) ReadLine(prompt string) (string, error) {
+	t.prompts = append(t.prompts, prompt)
+	if len(t.lines) == 0 {
+		return "", io.EOF
+	}
+	line := t.lines[0]
+	t.lines = t.lines[1:]
+	return line, nil
+}
+
+func (t *scriptedTerminal) ReadPassword(prompt string) (string, error) {
+	t.prompts = append(t.prompts, prompt)
+	if len(t.passwords) == 0 {
+		return "", io.EOF
+	}
+	password := t.passwords[0]
+	t.passwords = t.passwords[1:]
+	return password, nil
+}
+
+func (t *scriptedTerminal) Println(msg string) {
+	t.printed = append(t.printed, msg)
+}
+
+func (t *scriptedTerminal) printedText() string {
+	return strings.Join(t.printed, "\n")
+}
+
+// signInCall 记录一次 SignIn 调用
+type signInCall struct {
+	phone, code, hash string
+}
+
+// scriptedClient 每个方法按顺序返回预设结果，结果用完后返回nil
+type scriptedClient struct {
+	sendCodeErrs []error
+	signInErrs   []error
+	passwordErrs []error
+	hint         string
+	qr           func(show func(string, time.Time) error) error
+
+	sendCodes int
+	signIns   []signInCall
+	passwords []string
+}
+
+func next(errs *[]error) error {
+	if len(*errs) == 0 {
+		return nil
+	}
+	err := (*errs)[0]
+	*errs = (*errs)[1:]
+	return err
+}
+
+func (c *scriptedClient) SendCode(_ context.Context, phone string) (string, error) {
+	c.sendCodes++
+	if err := next(&c.sendCodeErrs); err != nil {
+		return "", err
+	}
+	return "hash" + strings.Repeat("'", c.sendCodes-1), nil
+}
+
+func (c *scriptedClient) SignIn(_ context.Context, phone, code, codeHash string) error {
+	c.signIns = append(c.signIns, signInCall{phone, code, codeHash})
+	return next(&c.signInErrs)
+}
+
+func (c *scriptedClient) PasswordHint(context.Context) (string, error) {
+	return c.hint, nil
+}
+
+func (c *scriptedClient) Password(_ context.Context, password string) error {
+	c.passwords = append(c.passwords, password)
+	return next(&c.passwordErrs)
+}
+
+func (c *scriptedClient) QR(_ context.Context, show func(url string, expires time.Time) error) error {
+	if c.qr == nil {
+		return errors.New("no QR script")
+	}
+	return c.qr(show)
+}
+
+// newTestFlow 创建不会真正等待FloodWait的登录流程，返回记录等待时长的切片
+func newTestFlow(term *scriptedTerminal, client *scriptedClient) (*Flow, *[]time.Duration) {
+	var waits []time.Duration
+	f := New(term, client)
+	f.Sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return f, &waits
+}
+
+func TestPhoneLogin(t *testing.T) {
+	term := &scriptedTerminal{lines: []string{" +1 234 5678 ", " 12345 "}}
+	client := &scriptedClient{}
+	f, _ := newTestFlow(term, client)
+
+	if err := f.Phone(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []signInCall{{"+12345678", "12345", "hash"}}; !reflect.DeepEqual(client.signIns, want) {
+		t.Errorf("SignIn calls = %+v, want %+v", client.signIns, want)
+	}
+}
+
+func TestPhoneLoginCodeRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		codes       []string
+		signInErrs  []error
+		wantErr     error
+		wantSignIns []signInCall
+		wantSends   int
+		wantPrinted []string
+	}{
+		{
+			name:        "invalid then valid",
+			codes:       []string{"1", "2", "3"},
+			signInErrs:  []error{ErrCodeInvalid, ErrCodeInvalid},
+			wantSignIns: []signInCall{{"+1", "1", "hash"}, {"+1", "2", "hash"}, {"+1", "3", "hash"}},
+			wantSends:   1,
+			wantPrinted: []string{"验证码错误，请重新输入 (剩余 2 次)", "验证码错误，请重新输入 (剩余 1 次)"},
+		},
+		{
+			name:        "attempts exhausted",
+			codes:       []string{"1", "2", "3", "4"},
+			signInErrs:  []error{ErrCodeInvalid, ErrCodeInvalid, ErrCodeInvalid},
+			wantErr:     ErrAttemptsExceeded,
+			wantSignIns: []signInCall{{"+1", "1", "hash"}, {"+1", "2", "hash"}, {"+1", "3", "hash"}},
+			wantSends:   1,
+			wantPrinted: []string{"验证码错误，请重新输入 (剩余 2 次)", "验证码错误，请重新输入 (剩余 1 次)"},
+		},
+		{
+			name:       "expired code is resent and resets attempts",
+			codes:      []string{"1", "2", "3", "4", "5"},
+			signInErrs: []error{ErrCodeInvalid, ErrCodeExpired, ErrCodeInvalid, ErrCodeInvalid},
+			wantSignIns: []signInCall{
+				{"+1", "1", "hash"}, {"+1", "2", "hash"}, {"+1", "3", "hash'"}, {"+1", "4", "hash'"}, {"+1", "5", "hash'"},
+			},
+			wantSends: 2,
+			wantPrinted: []string{
+				"验证码错误，请重新输入 (剩余 2 次)",
+				"验证码已过期，正在重新发送...",
+				"验证码错误，请重新输入 (剩余 2 次)",
+				"验证码错误，请重新输入 (剩余 1 次)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			term := &scriptedTerminal{lines: append([]string{"+1"}, tt.codes...)}
+			client := &scriptedClient{signInErrs: tt.signInErrs}
+			f, _ := newTestFlow(term, client)
+
+			err := f.Phone(context.Background())
+			if tt.wantErr == nil && err != nil || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Phone = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(client.signIns, tt.wantSignIns) {
+				t.Errorf("SignIn calls = %+v, want %+v", client.signIns, tt.wantSignIns)
+			}
+			if client.sendCodes != tt.wantSends {
+				t.Errorf("SendCode called %d times, want %d", client.sendCodes, tt.wantSends)
+			}
+			if !reflect.DeepEqual(term.printed, tt.wantPrinted) {
+				t.Errorf("printed = %q, want %q", term.printed, tt.wantPrinted)
+			}
+		})
+	}
+}
+
+func TestPhoneLoginPassword(t *testing.T) {
+	term := &scriptedTerminal{lines: []string{"+1", "12345"}, passwords: []string{"wrong", "right"}}
+	client := &scriptedClient{signInErrs: []error{ErrPasswordNeeded}, passwordErrs: []error{ErrPasswordInvalid}, hint: "宠物名字"}
+	f, _ := newTestFlow(term, client)
+
+	if err := f.Phone(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(client.passwords, []string{"wrong", "right"}) {
+		t.Errorf("Password calls = %q", client.passwords)
+	}
+	want := []string{"该账号已开启两步验证", "密码提示: 宠物名字", "密码错误，请重新输入 (剩余 2 次)"}
+	if !reflect.DeepEqual(term.printed, want) {
+		t.Errorf("printed = %q, want %q", term.printed, want)
+	}
+	// 密码通过不回显的方式读取
+	if got := term.prompts[len(term.prompts)-1]; got != "请输入两步验证密码:" {
+		t.Errorf("last prompt = %q", got)
+	}
+}
+
+func TestPasswordAttemptsExhausted(t *testing.T) {
+	term := &scriptedTerminal{passwords: []string{"a", "b", "c", "d"}}
+	client := &scriptedClient{passwordErrs: []error{ErrPasswordInvalid, ErrPasswordInvalid, ErrPasswordInvalid}}
+	f, _ := newTestFlow(term, client)
+	f.PasswordAttempts = 0 // 使用默认值
+
+	if err := f.password(context.Background()); !errors.Is(err, ErrAttemptsExceeded) {
+		t.Fatalf("password = %v, want ErrAttemptsExceeded", err)
+	}
+	if len(client.passwords) != DefaultPasswordAttempts {
+		t.Errorf("Password called %d times, want %d", len(client.passwords), DefaultPasswordAttempts)
+	}
+	// 没有提示时不输出提示行，最后一次失败不再提示剩余次数
+	want := []string{"该账号已开启两步验证", "密码错误，请重新输入 (剩余 2 次)", "密码错误，请重新输入 (剩余 1 次)"}
+	if !reflect.DeepEqual(term.printed, want) {
+		t.Errorf("printed = %q, want %q", term.printed, want)
+	}
+}
+
+func TestFloodWait(t *testing.T) {
+	term := &scriptedTerminal{lines: []string{"+1", "123"}}
+	client := &scriptedClient{
+		sendCodeErrs: []error{&FloodWaitError{Duration: 5 * time.Second}},
+		signInErrs:   []error{&FloodWaitError{Duration: 1500 * time.Millisecond}},
+	}
+	f, waits := newTestFlow(term, client)
+
+	if err := f.Phone(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Duration{5 * time.Second, 1500 * time.Millisecond}; !reflect.DeepEqual(*waits, want) {
+		t.Errorf("waits = %v, want %v", *waits, want)
+	}
+	if client.sendCodes != 2 || len(client.signIns) != 2 {
+		t.Errorf("SendCode %d times, SignIn %d times; want 2 each", client.sendCodes, len(client.signIns))
+	}
+	if !strings.Contains(term.printedText(), "请求过于频繁，5s 后自动重试...") {
+		t.Errorf("printed = %q", term.printed)
+	}
+
+	// 超过上限时不等待，提示稍后重试
+	term = &scriptedTerminal{lines: []string{"+1"}}
+	client = &scriptedClient{sendCodeErrs: []error{&FloodWaitError{Duration: 10 * time.Minute}}}
+	f, waits = newTestFlow(term, client)
+	err := f.Phone(context.Background())
+	var flood *FloodWaitError
+	if !errors.As(err, &flood) || flood.Duration != 10*time.Minute || !strings.Contains(err.Error(), "请在 10m0s 后重试") {
+		t.Fatalf("Phone = %v, want long flood wait error", err)
+	}
+	if len(*waits) != 0 || client.sendCodes != 1 {
+		t.Errorf("waited %v, SendCode %d times", *waits, client.sendCodes)
+	}
+}
+
+func TestFloodWaitInterruptedByContext(t *testing.T) {
+	f := New(&scriptedTerminal{}, &scriptedClient{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := f.waitFlood(ctx, &FloodWaitError{Duration: time.Minute}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("waitFlood = %v, want context.Canceled", err)
+	}
+}
+
+func TestPhoneLoginErrors(t *testing.T) {
+	failure := errors.New("network down")
+	tests := []struct {
+		name   string
+		lines  []string
+		client *scriptedClient
+		check  func(error) bool
+	}{
+		{"empty phone", []string{"   "}, &scriptedClient{}, func(err error) bool { return err != nil && strings.Contains(err.Error(), "empty") }},
+		{"phone read fails", nil, &scriptedClient{}, func(err error) bool { return errors.Is(err, io.EOF) }},
+		{"code read fails", []string{"+1"}, &scriptedClient{}, func(err error) bool { return errors.Is(err, io.EOF) }},
+		{"send code fails", []string{"+1"}, &scriptedClient{sendCodeErrs: []error{failure}}, func(err error) bool { return errors.Is(err, failure) }},
+		{"sign in fails", []string{"+1", "1"}, &scriptedClient{signInErrs: []error{failure}}, func(err error) bool {
+			return errors.Is(err, failure) && strings.Contains(err.Error(), "sign in failed")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _ := newTestFlow(&scriptedTerminal{lines: tt.lines}, tt.client)
+			if err := f.Phone(context.Background()); !tt.check(err) {
+				t.Fatalf("Phone = %v", err)
+			}
+		})
+	}
+}
+
+func TestQRLogin(t *testing.T) {
+	expires := time.Now().Add(30 * time.Second)
+	term := &scriptedTerminal{passwords: []string{"pw"}}
+	var shown int
+	client := &scriptedClient{qr: func(show func(string, time.Time) error) error {
+		// 二维码过期后刷新一次
+		for _, url := range []string{"tg://login?token=first", "tg://login?token=second"} {
+			shown++
+			if err := show(url, expires); err != nil {
+				return err
+			}
+		}
+		return ErrPasswordNeeded
+	}}
+	f, _ := newTestFlow(term, client)
+
+	if err := f.QR(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	text := term.printedText()
+	for _, want := range []string{"tg://login?token=first", "tg://login?token=second", "二维码将在 " + expires.Local().Format("15:04:05") + " 过期", "该账号已开启两步验证"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("printed text does not contain %q", want)
+		}
+	}
+	if !reflect.DeepEqual(client.passwords, []string{"pw"}) {
+		t.Errorf("Password calls = %q", client.passwords)
+	}
+
+	client.qr = func(func(string, time.Time) error) error { return &FloodWaitError{Duration: 42 * time.Second} }
+	if err := f.QR(context.Background()); err == nil || !strings.Contains(err.Error(), "请在 42s 后重试") {
+		t.Errorf("QR with flood wait = %v", err)
+	}
+}
+
+func TestStdTerminal(t *testing.T) {
+	var out bytes.Buffer
+	term := &StdTerminal{in: bufio.NewReader(strings.NewReader("first\r\nsecret\nlast")), out: &out, fd: -1}
+
+	if line, err := term.ReadLine("a:"); err != nil || line != "first" {
+		t.Fatalf("ReadLine = %q, %v", line, err)
+	}
+	// 不是终端时按普通输入读取
+	if line, err := term.ReadPassword("b:"); err != nil || line != "secret" {
+		t.Fatalf("ReadPassword = %q, %v", line, err)
+	}
+	// 没有结尾换行的最后一行也能读取
+	if line, err := term.ReadLine("c:"); err != nil || line != "last" {
+		t.Fatalf("ReadLine = %q, %v", line, err)
+	}
+	if _, err := term.ReadLine("d:"); !errors.Is(err, io.EOF) {
+		t.Fatalf("ReadLine at EOF = %v", err)
+	}
+	term.Println("done")
+	if got, want := out.String(), "a: b: c: d: done\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+package authflow
+
+import (
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// qrQuietZone 二维码四周的空白模块数
+const qrQuietZone = 2
+
+// RenderQR 将内容编码为二维码，并用半高方块字符渲染为终端文本。
+// 按深色背景终端输出：浅色模块绘制为方块，深色模块留空
+func RenderQR(content string) (string, error) {
+	code, err := qr.Encode(content, qr.L)
+	if err != nil {
+		return "", err
+	}
+
+	light := func(x, y int) bool {
+		return !code.Black(x, y)
+	}
+
+	var b strings.Builder
+	lo, hi := -qrQuietZone, code.Size+qrQuietZone
+	// 每个字符代表上下两个模块
+	for y := lo; y < hi; y += 2 {
+		for x := lo; x < hi; x++ {
+			top := light(x, y)
+			bottom := y+1 < hi && light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteRune('█')
+			case top:
+				b.WriteRune('▀')
+			case bottom:
+				b.WriteRune('▄')
+			default:
+				b.WriteRune(' ')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
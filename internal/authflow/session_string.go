@@ -0,0 +1,23 @@
+package authflow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gotd/td/session"
+)
+
+// ImportSessionString 把其他设备导出的会话字符串解码后写入path处的会话文件，
+// 之后连接时直接使用该会话，不再需要登录。目前支持 Telethon StringSession 格式
+func ImportSessionString(ctx context.Context, path, value string) error {
+	data, err := session.TelethonSession(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("failed to decode session string: %w", err)
+	}
+	loader := session.Loader{Storage: &session.FileStorage{Path: path}}
+	if err := loader.Save(ctx, data); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package authflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/auth/qrlogin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// TelegramClient 基于gotd客户端的Client实现
+type TelegramClient struct {
+	client   *telegram.Client
+	loggedIn qrlogin.LoggedIn
+}
+
+// NewTelegramClient 创建Client实现。loggedIn 来自 qrlogin.OnLoginToken，
+// 仅二维码登录需要，可为nil
+func NewTelegramClient(client *telegram.Client, loggedIn qrlogin.LoggedIn) *TelegramClient {
+	return &TelegramClient{
+		client:   client,
+		loggedIn: loggedIn,
+	}
+}
+
+// SendCode 实现Client接口
+func (c *TelegramClient) SendCode(ctx context.Context, phone string) (string, error) {
+	sent, err := c.client.Auth().SendCode(ctx, phone, auth.SendCodeOptions{})
+	if err != nil {
+		return "", mapError(err)
+	}
+	code, ok := sent.(*tg.AuthSentCode)
+	if !ok {
+		return "", fmt.Errorf("unexpected sent code type %T", sent)
+	}
+	return code.PhoneCodeHash, nil
+}
+
+// SignIn 实现Client接口
+func (c *TelegramClient) SignIn(ctx context.Context, phone, code, codeHash string) error {
+	_, err := c.client.Auth().SignIn(ctx, phone, code, codeHash)
+	return mapError(err)
+}
+
+// PasswordHint 实现Client接口
+func (c *TelegramClient) PasswordHint(ctx context.Context) (string, error) {
+	password, err := c.client.API().AccountGetPassword(ctx)
+	if err != nil {
+		return "", mapError(err)
+	}
+	hint, _ := password.GetHint()
+	return hint, nil
+}
+
+// Password 实现Client接口
+func (c *TelegramClient) Password(ctx context.Context, password string) error {
+	_, err := c.client.Auth().Password(ctx, password)
+	return mapError(err)
+}
+
+// QR 实现Client接口
+func (c *TelegramClient) QR(ctx context.Context, show func(url string, expires time.Time) error) error {
+	if c.loggedIn == nil {
+		return fmt.Errorf("QR login requires a login token update channel")
+	}
+	_, err := c.client.QR().Auth(ctx, c.loggedIn, func(ctx context.Context, token qrlogin.Token) error {
+		return show(token.URL(), token.Expires())
+	})
+	return mapError(err)
+}
+
+// mapError 将Telegram错误映射为本包定义的错误
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if d, ok := tgerr.AsFloodWait(err); ok {
+		return &FloodWaitError{Duration: d}
+	}
+	switch {
+	case errors.Is(err, auth.ErrPasswordAuthNeeded), tgerr.Is(err, "SESSION_PASSWORD_NEEDED"):
+		return ErrPasswordNeeded
+	case errors.Is(err, auth.ErrPasswordInvalid):
+		return ErrPasswordInvalid
+	case tgerr.Is(err, "PHONE_CODE_INVALID", "PHONE_CODE_EMPTY"):
+		return ErrCodeInvalid
+	case tgerr.Is(err, "PHONE_CODE_EXPIRED"):
+		return ErrCodeExpired
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package authflow
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tgerr"
+)
+
+func TestMapError(t *testing.T) {
+	other := errors.New("other")
+	tests := []struct {
+		name string
+		in   error
+		want error
+	}{
+		{"nil", nil, nil},
+		{"password needed", auth.ErrPasswordAuthNeeded, ErrPasswordNeeded},
+		{"session password needed", tgerr.New(401, "SESSION_PASSWORD_NEEDED"), ErrPasswordNeeded},
+		{"password invalid", auth.ErrPasswordInvalid, ErrPasswordInvalid},
+		{"code invalid", tgerr.New(400, "PHONE_CODE_INVALID"), ErrCodeInvalid},
+		{"code empty", tgerr.New(400, "PHONE_CODE_EMPTY"), ErrCodeInvalid},
+		{"code expired", tgerr.New(400, "PHONE_CODE_EXPIRED"), ErrCodeExpired},
+		{"other kept", other, other},
+	}
+	for _, tt := range tests {
+		if got := mapError(tt.in); got != tt.want {
+			t.Errorf("%s: mapError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	var flood *FloodWaitError
+	if err := mapError(tgerr.New(420, "FLOOD_WAIT_30")); !errors.As(err, &flood) || flood.Duration != 30*time.Second {
+		t.Errorf("mapError(FLOOD_WAIT_30) = %v", err)
+	}
+}
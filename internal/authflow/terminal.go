@@ -0,0 +1,54 @@
+package authflow
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// StdTerminal 基于标准输入输出的终端实现
+type StdTerminal struct {
+	in  *bufio.Reader
+	out io.Writer
+	fd  int
+}
+
+// NewStdTerminal 创建使用os.Stdin/os.Stdout的终端
+func NewStdTerminal() *StdTerminal {
+	return &StdTerminal{
+		in:  bufio.NewReader(os.Stdin),
+		out: os.Stdout,
+		fd:  int(os.Stdin.Fd()),
+	}
+}
+
+// ReadLine 实现Terminal接口
+func (t *StdTerminal) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(t.out, prompt+" ")
+	line, err := t.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ReadPassword 实现Terminal接口，输入期间关闭终端回显。
+// 标准输入不是终端(如管道)时按普通输入读取
+func (t *StdTerminal) ReadPassword(prompt string) (string, error) {
+	restore, err := disableEcho(t.fd)
+	if err != nil {
+		return t.ReadLine(prompt)
+	}
+	line, err := t.ReadLine(prompt)
+	restore()
+	// 回显关闭时用户输入的换行不会显示
+	fmt.Fprintln(t.out)
+	return line, err
+}
+
+// Println 实现Terminal接口
+func (t *StdTerminal) Println(msg string) {
+	fmt.Fprintln(t.out, msg)
+}
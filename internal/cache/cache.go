@@ -0,0 +1,302 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options 缓存选项
+type Options struct {
+	// TTL 默认的条目有效期，0表示不过期
+	TTL time.Duration
+	// MaxEntries 最多保留的条目数，超过时淘汰最久未使用的条目，0表示不限制
+	MaxEntries int
+	// Spill 可选的持久化存储。写入时同步保存，内存未命中时从中读取
+	Spill Spill
+}
+
+// Loader 缓存未命中时加载值。返回的ttl为0时使用缓存默认TTL
+type Loader[V any] func() (value V, ttl time.Duration, err error)
+
+// entry 缓存条目
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time // 零值表示不过期
+}
+
+// call 正在进行的加载，用于合并并发的相同请求
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// Cache 带TTL与LRU淘汰的并发安全缓存
+type Cache[K comparable, V any] struct {
+	name    string
+	opts    Options
+	items   map[K]*list.Element
+	order   *list.List // 前端为最近使用
+	loading map[K]*call[V]
+	now     func() time.Time
+	mutex   sync.Mutex
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+	expired   atomic.Uint64
+}
+
+// New 创建缓存并登记到全局统计。name 用于统计展示和持久化存储的命名空间，
+// 同名的多个实例在统计中以 #2、#3… 区分
+func New[K comparable, V any](name string, opts Options) *Cache[K, V] {
+	c := &Cache[K, V]{
+		name:    name,
+		opts:    opts,
+		items:   make(map[K]*list.Element),
+		order:   list.New(),
+		loading: make(map[K]*call[V]),
+		now:     time.Now,
+	}
+	c.name = register(c)
+	return c
+}
+
+// Name 返回缓存名称
+func (c *Cache[K, V]) Name() string {
+	return c.name
+}
+
+// Get 返回未过期的值。过期条目视为未命中，但在被淘汰前仍可通过 GetStale 读取
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mutex.Lock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		if !c.expiredAt(e, c.now()) {
+			c.order.MoveToFront(el)
+			c.mutex.Unlock()
+			c.hits.Add(1)
+			return e.value, true
+		}
+	}
+	c.mutex.Unlock()
+
+	if value, expires, ok := c.loadSpill(key); ok {
+		c.hits.Add(1)
+		c.store(key, value, expires, false)
+		return value, true
+	}
+
+	c.misses.Add(1)
+	var zero V
+	return zero, false
+}
+
+// GetStale 返回内存中的值，不检查是否过期，也不计入命中统计
+func (c *Cache[K, V]) GetStale(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if el, ok := c.items[key]; ok {
+		return el.Value.(*entry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set 使用默认TTL写入
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetTTL(key, value, c.opts.TTL)
+}
+
+// SetTTL 使用指定TTL写入，ttl为0表示不过期
+func (c *Cache[K, V]) SetTTL(key K, value V, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+	c.store(key, value, expires, true)
+}
+
+// SetUntil 写入并在指定时间过期，用于恢复已有时间戳的数据
+func (c *Cache[K, V]) SetUntil(key K, value V, expires time.Time) {
+	c.store(key, value, expires, true)
+}
+
+// Delete 删除条目
+func (c *Cache[K, V]) Delete(key K) {
+	c.mutex.Lock()
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+	c.mutex.Unlock()
+
+	if c.opts.Spill != nil {
+		c.opts.Spill.Delete(c.name, spillKey(key))
+	}
+}
+
+// Fill 返回缓存的值，未命中时调用loader加载并写入。
+// 同一个key的并发调用只会执行一次loader，其余调用等待并共享结果；加载失败不会写入缓存
+func (c *Cache[K, V]) Fill(key K, loader Loader[V]) (V, error) {
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+
+	c.mutex.Lock()
+	if el, ok := c.items[key]; ok && !c.expiredAt(el.Value.(*entry[K, V]), c.now()) {
+		// 等待锁期间已被其他调用写入
+		value := el.Value.(*entry[K, V]).value
+		c.mutex.Unlock()
+		return value, nil
+	}
+	if pending, ok := c.loading[key]; ok {
+		c.mutex.Unlock()
+		<-pending.done
+		return pending.value, pending.err
+	}
+	pending := &call[V]{done: make(chan struct{})}
+	c.loading[key] = pending
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		delete(c.loading, key)
+		c.mutex.Unlock()
+		close(pending.done)
+	}()
+
+	value, ttl, err := loader()
+	pending.value, pending.err = value, err
+	if err == nil {
+		if ttl == 0 {
+			ttl = c.opts.TTL
+		}
+		c.SetTTL(key, value, ttl)
+	}
+	return value, err
+}
+
+// Len 返回内存中的条目数(包括尚未清理的过期条目)
+func (c *Cache[K, V]) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// Range 按最近使用顺序遍历内存中的条目，fn返回false时停止
+func (c *Cache[K, V]) Range(fn func(key K, value V, expired bool) bool) {
+	c.mutex.Lock()
+	now := c.now()
+	// 复制条目，避免回调期间与写入同一条目的 store 产生数据竞争
+	entries := make([]entry[K, V], 0, c.order.Len())
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		entries = append(entries, *el.Value.(*entry[K, V]))
+	}
+	c.mutex.Unlock()
+
+	for i := range entries {
+		e := &entries[i]
+		if !fn(e.key, e.value, c.expiredAt(e, now)) {
+			return
+		}
+	}
+}
+
+// Purge 清理过期条目，返回清理的数量
+func (c *Cache[K, V]) Purge() int {
+	c.mutex.Lock()
+	now := c.now()
+	removed := 0
+	for el := c.order.Back(); el != nil; {
+		prev := el.Prev()
+		e := el.Value.(*entry[K, V])
+		if c.expiredAt(e, now) {
+			c.order.Remove(el)
+			delete(c.items, e.key)
+			removed++
+		}
+		el = prev
+	}
+	c.mutex.Unlock()
+
+	c.expired.Add(uint64(removed))
+	if c.opts.Spill != nil {
+		c.opts.Spill.Purge(c.name, now)
+	}
+	return removed
+}
+
+// Clear 清空内存和持久化存储中的所有条目
+func (c *Cache[K, V]) Clear() {
+	c.mutex.Lock()
+	c.items = make(map[K]*list.Element)
+	c.order.Init()
+	c.mutex.Unlock()
+
+	if c.opts.Spill != nil {
+		c.opts.Spill.Clear(c.name)
+	}
+}
+
+// Stats 返回统计信息
+func (c *Cache[K, V]) Stats() Stats {
+	return Stats{
+		Name:       c.name,
+		Size:       c.Len(),
+		MaxEntries: c.opts.MaxEntries,
+		TTL:        c.opts.TTL,
+		Persistent: c.opts.Spill != nil,
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Evictions:  c.evictions.Load(),
+		Expired:    c.expired.Load(),
+	}
+}
+
+// store 写入内存，必要时淘汰最久未使用的条目。persist 为true时同步写入持久化存储
+func (c *Cache[K, V]) store(key K, value V, expires time.Time, persist bool) {
+	c.mutex.Lock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+	} else {
+		c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+	}
+
+	evicted := 0
+	for c.opts.MaxEntries > 0 && c.order.Len() > c.opts.MaxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+		evicted++
+	}
+	c.mutex.Unlock()
+	c.evictions.Add(uint64(evicted))
+
+	if persist && c.opts.Spill != nil {
+		c.opts.Spill.Save(c.name, spillKey(key), value, expires)
+	}
+}
+
+// loadSpill 从持久化存储读取未过期的值
+func (c *Cache[K, V]) loadSpill(key K) (V, time.Time, bool) {
+	var value V
+	if c.opts.Spill == nil {
+		return value, time.Time{}, false
+	}
+	expires, ok := c.opts.Spill.Load(c.name, spillKey(key), &value)
+	if !ok || (!expires.IsZero() && !c.now().Before(expires)) {
+		return value, time.Time{}, false
+	}
+	return value, expires, true
+}
+
+// expiredAt 条目在now时是否已过期
+func (c *Cache[K, V]) expiredAt(e *entry[K, V], now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
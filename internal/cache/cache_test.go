@@ -0,0 +1,393 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock 可手动推进的时钟
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// newTestCache 创建使用 fakeClock 的缓存，名称取自测试名避免统计中重名
+func newTestCache[V any](t *testing.T, opts Options) (*Cache[string, V], *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	c := New[string, V](t.Name(), opts)
+	c.now = clock.Now
+	return c, clock
+}
+
+// keys 按最近使用顺序返回内存中的键
+func keys[V any](c *Cache[string, V]) []string {
+	var out []string
+	c.Range(func(key string, _ V, _ bool) bool {
+		out = append(out, key)
+		return true
+	})
+	return out
+}
+
+func TestEvictionOrder(t *testing.T) {
+	c, _ := newTestCache[int](t, Options{MaxEntries: 3})
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	if got := keys(c); !reflect.DeepEqual(got, []string{"c", "b", "a"}) {
+		t.Fatalf("order = %v", got)
+	}
+
+	// 读取和覆盖写入都会刷新顺序，淘汰最久未使用的条目
+	c.Get("a")
+	c.Set("b", 20)
+	c.Set("d", 4)
+	if got := keys(c); !reflect.DeepEqual(got, []string{"d", "b", "a"}) {
+		t.Fatalf("order after touching a and b = %v, want c evicted", got)
+	}
+	if _, ok := c.Get("c"); ok {
+		t.Error("c should have been evicted")
+	}
+	if v, _ := c.Get("b"); v != 20 {
+		t.Errorf("b = %d, want 20", v)
+	}
+
+	// GetStale 和 Range 不影响顺序
+	c.GetStale("d")
+	c.Set("e", 5)
+	c.Set("f", 6)
+	if got := keys(c); !reflect.DeepEqual(got, []string{"f", "e", "b"}) {
+		t.Errorf("order = %v, want [f e b]", got)
+	}
+	if s := c.Stats(); s.Evictions != 3 || s.Size != 3 {
+		t.Errorf("stats = %+v, want 3 evictions and size 3", s)
+	}
+}
+
+func TestUnlimitedEntries(t *testing.T) {
+	c, _ := newTestCache[int](t, Options{})
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint(i), i)
+	}
+	if c.Len() != 1000 || c.Stats().Evictions != 0 {
+		t.Errorf("len = %d, evictions = %d", c.Len(), c.Stats().Evictions)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c, clock := newTestCache[string](t, Options{TTL: time.Minute})
+	c.Set("default", "x")
+	c.SetTTL("long", "y", time.Hour)
+	c.SetTTL("forever", "z", 0)
+	c.SetUntil("until", "w", clock.Now().Add(30*time.Second))
+
+	clock.Advance(30 * time.Second)
+	if _, ok := c.Get("until"); ok {
+		t.Error("until should expire exactly at its deadline")
+	}
+	if _, ok := c.Get("default"); !ok {
+		t.Error("default should still be valid")
+	}
+
+	clock.Advance(time.Minute)
+	if _, ok := c.Get("default"); ok {
+		t.Error("default should have expired")
+	}
+	if v, ok := c.GetStale("default"); !ok || v != "x" {
+		t.Errorf("GetStale = %q, %v; expired entries stay readable until purged", v, ok)
+	}
+	for _, key := range []string{"long", "forever"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s should still be valid", key)
+		}
+	}
+
+	var expired []string
+	c.Range(func(key, _ string, isExpired bool) bool {
+		if isExpired {
+			expired = append(expired, key)
+		}
+		return true
+	})
+	if !reflect.DeepEqual(expired, []string{"default", "until"}) {
+		t.Errorf("expired = %v", expired)
+	}
+
+	if n := c.Purge(); n != 2 {
+		t.Errorf("Purge = %d, want 2", n)
+	}
+	if _, ok := c.GetStale("default"); ok {
+		t.Error("purged entry should be gone")
+	}
+	s := c.Stats()
+	if s.Size != 2 || s.Expired != 2 || s.Hits != 3 || s.Misses != 2 {
+		t.Errorf("stats = %+v", s)
+	}
+	if rate := s.HitRate(); rate != 0.6 {
+		t.Errorf("HitRate = %v, want 0.6", rate)
+	}
+}
+
+func TestDeleteAndClear(t *testing.T) {
+	c, _ := newTestCache[int](t, Options{})
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Delete("a")
+	c.Delete("missing")
+	if got := keys(c); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("keys after delete = %v", got)
+	}
+	c.Clear()
+	if c.Len() != 0 {
+		t.Errorf("len after clear = %d", c.Len())
+	}
+	c.Set("c", 3)
+	if got := keys(c); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Errorf("keys after reuse = %v", got)
+	}
+}
+
+func TestFill(t *testing.T) {
+	c, clock := newTestCache[int](t, Options{TTL: time.Minute})
+	loads := 0
+	loader := func(v int, ttl time.Duration) Loader[int] {
+		return func() (int, time.Duration, error) {
+			loads++
+			return v, ttl, nil
+		}
+	}
+
+	if v, err := c.Fill("a", loader(1, 0)); v != 1 || err != nil {
+		t.Fatalf("Fill = %d, %v", v, err)
+	}
+	if v, _ := c.Fill("a", loader(2, 0)); v != 1 || loads != 1 {
+		t.Errorf("second Fill = %d with %d loads; want cached 1", v, loads)
+	}
+
+	// loader返回的ttl优先于默认TTL
+	c.Fill("short", loader(3, time.Second))
+	clock.Advance(2 * time.Second)
+	if _, ok := c.Get("short"); ok {
+		t.Error("short should use the loader's ttl")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("a should use the default ttl")
+	}
+
+	clock.Advance(time.Minute)
+	if v, _ := c.Fill("a", loader(4, 0)); v != 4 {
+		t.Errorf("Fill after expiry = %d, want reloaded 4", v)
+	}
+
+	// 加载失败不写入缓存
+	boom := errors.New("boom")
+	if _, err := c.Fill("bad", func() (int, time.Duration, error) { return 0, 0, boom }); err != boom {
+		t.Errorf("err = %v, want boom", err)
+	}
+	if _, ok := c.GetStale("bad"); ok {
+		t.Error("failed load should not be cached")
+	}
+}
+
+func TestFillDedupesConcurrentLoads(t *testing.T) {
+	c, _ := newTestCache[int](t, Options{})
+	var loads atomic.Int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	loader := func() (int, time.Duration, error) {
+		if loads.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return 42, 0, nil
+	}
+
+	const n = 50
+	results := make(chan int, n)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		v, _ := c.Fill("k", loader)
+		results <- v
+	}()
+	<-started
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _ := c.Fill("k", loader)
+			results <- v
+		}()
+	}
+	// 等待其他调用进入等待状态后再完成加载
+	for {
+		c.mutex.Lock()
+		pending := c.loading["k"] != nil
+		c.mutex.Unlock()
+		if pending {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if got := loads.Load(); got != 1 {
+		t.Errorf("loader ran %d times, want 1", got)
+	}
+	for v := range results {
+		if v != 42 {
+			t.Fatalf("result = %d, want 42", v)
+		}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.loading) != 0 {
+		t.Errorf("loading = %v, want empty", c.loading)
+	}
+}
+
+func TestFillSharesErrors(t *testing.T) {
+	c, _ := newTestCache[int](t, Options{})
+	boom := errors.New("boom")
+	release := make(chan struct{})
+	var loads atomic.Int32
+	loader := func() (int, time.Duration, error) {
+		loads.Add(1)
+		<-release
+		return 0, 0, boom
+	}
+
+	errs := make(chan error, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Fill("k", loader)
+			errs <- err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != boom {
+			t.Fatalf("err = %v, want boom", err)
+		}
+	}
+	// 失败后下一次调用会重新加载
+	c.Fill("k", func() (int, time.Duration, error) { loads.Add(1); return 1, 0, nil })
+	if v, ok := c.Get("k"); !ok || v != 1 {
+		t.Errorf("Get after retry = %d, %v", v, ok)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	// 在 -race 下运行以检查数据竞争
+	c, clock := newTestCache[int](t, Options{TTL: time.Second, MaxEntries: 64})
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprint((g*7 + i) % 100)
+				switch i % 8 {
+				case 0:
+					c.Set(key, i)
+				case 1:
+					c.Get(key)
+				case 2:
+					c.Fill(key, func() (int, time.Duration, error) { return i, 0, nil })
+				case 3:
+					c.GetStale(key)
+				case 4:
+					c.Delete(key)
+				case 5:
+					c.Range(func(string, int, bool) bool { return true })
+				case 6:
+					c.Stats()
+					All()
+				case 7:
+					clock.Advance(time.Millisecond)
+					c.Purge()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if n := c.Len(); n > 64 {
+		t.Errorf("len = %d, exceeds MaxEntries", n)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.items) != c.order.Len() {
+		t.Errorf("items map has %d entries, list has %d", len(c.items), c.order.Len())
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	// 统计是全局的，-count 多次运行时使用不同的名称
+	name := fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+	first := New[string, int](name, Options{MaxEntries: 5, TTL: time.Minute})
+	second := New[int, string](name, Options{})
+	if first.Name() != name || second.Name() != name+"#2" {
+		t.Fatalf("names = %q, %q", first.Name(), second.Name())
+	}
+	first.Set("a", 1)
+	first.Get("a")
+	first.Get("b")
+	second.Set(1, "x")
+
+	var got []Stats
+	for _, s := range All() {
+		if s.Name == name || s.Name == name+"#2" {
+			got = append(got, s)
+		}
+	}
+	want := []Stats{
+		{Name: name, Size: 1, MaxEntries: 5, TTL: time.Minute, Hits: 1, Misses: 1},
+		{Name: name + "#2", Size: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stats =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if !Clear(name + "#2") {
+		t.Error("Clear should find the cache by its registered name")
+	}
+	if second.Len() != 0 || first.Len() != 1 {
+		t.Errorf("Clear affected the wrong cache: first=%d second=%d", first.Len(), second.Len())
+	}
+	if Clear(name + "#missing") {
+		t.Error("Clear of an unknown cache should return false")
+	}
+
+	first.SetTTL("old", 2, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if n := PurgeAll(); n < 1 {
+		t.Errorf("PurgeAll = %d, want at least 1", n)
+	}
+}
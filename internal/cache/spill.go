@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"nexusvalet/pkg/logger"
+	"time"
+)
+
+// Spill 缓存的持久化存储。value 以JSON编码，key 为缓存键的字符串形式
+type Spill interface {
+	Save(cache, key string, value interface{}, expires time.Time)
+	Load(cache, key string, value interface{}) (expires time.Time, ok bool)
+	Delete(cache, key string)
+	Purge(cache string, now time.Time)
+	Clear(cache string)
+}
+
+// SQLiteSpill 基于SQLite的持久化存储，所有命名缓存共用一张表
+type SQLiteSpill struct {
+	db *sql.DB
+}
+
+// NewSQLiteSpill 创建持久化存储并建表
+func NewSQLiteSpill(db *sql.DB) (*SQLiteSpill, error) {
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS cache_entries (
+		cache TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value BLOB NOT NULL,
+		expires_at INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (cache, key)
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create cache_entries table: %w", err)
+	}
+	return &SQLiteSpill{db: db}, nil
+}
+
+// Save 实现Spill接口
+func (s *SQLiteSpill) Save(cache, key string, value interface{}, expires time.Time) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		logger.Warnf("Cache %s: failed to encode %s: %v", cache, key, err)
+		return
+	}
+	if _, err := s.db.Exec(`INSERT OR REPLACE INTO cache_entries (cache, key, value, expires_at) VALUES (?, ?, ?, ?)`,
+		cache, key, data, unixOrZero(expires)); err != nil {
+		logger.Warnf("Cache %s: failed to save %s: %v", cache, key, err)
+	}
+}
+
+// Load 实现Spill接口
+func (s *SQLiteSpill) Load(cache, key string, value interface{}) (time.Time, bool) {
+	var data []byte
+	var expiresAt int64
+	err := s.db.QueryRow(`SELECT value, expires_at FROM cache_entries WHERE cache = ? AND key = ?`, cache, key).Scan(&data, &expiresAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Warnf("Cache %s: failed to load %s: %v", cache, key, err)
+		}
+		return time.Time{}, false
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		logger.Warnf("Cache %s: failed to decode %s: %v", cache, key, err)
+		return time.Time{}, false
+	}
+	var expires time.Time
+	if expiresAt > 0 {
+		expires = time.Unix(expiresAt, 0)
+	}
+	return expires, true
+}
+
+// Delete 实现Spill接口
+func (s *SQLiteSpill) Delete(cache, key string) {
+	if _, err := s.db.Exec(`DELETE FROM cache_entries WHERE cache = ? AND key = ?`, cache, key); err != nil {
+		logger.Warnf("Cache %s: failed to delete %s: %v", cache, key, err)
+	}
+}
+
+// Purge 实现Spill接口
+func (s *SQLiteSpill) Purge(cache string, now time.Time) {
+	if _, err := s.db.Exec(`DELETE FROM cache_entries WHERE cache = ? AND expires_at > 0 AND expires_at <= ?`, cache, now.Unix()); err != nil {
+		logger.Warnf("Cache %s: failed to purge: %v", cache, err)
+	}
+}
+
+// Clear 实现Spill接口
+func (s *SQLiteSpill) Clear(cache string) {
+	if _, err := s.db.Exec(`DELETE FROM cache_entries WHERE cache = ?`, cache); err != nil {
+		logger.Warnf("Cache %s: failed to clear: %v", cache, err)
+	}
+}
+
+// spillKey 缓存键的字符串形式
+func spillKey(key interface{}) string {
+	return fmt.Sprint(key)
+}
+
+// unixOrZero 零值时间保存为0
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
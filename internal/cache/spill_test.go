@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+type spilledValue struct {
+	Name  string
+	Count int
+}
+
+func openSpill(t *testing.T) (*SQLiteSpill, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	spill, err := NewSQLiteSpill(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spill, db
+}
+
+// restart 模拟进程重启：注销旧实例后以相同名称创建新缓存
+func restart[V any](old *Cache[string, V], opts Options, clock *fakeClock) *Cache[string, V] {
+	registryMutex.Lock()
+	delete(registry, old.Name())
+	registryMutex.Unlock()
+	c := New[string, V](old.Name(), opts)
+	c.now = clock.Now
+	return c
+}
+
+func spillRows(t *testing.T, db *sql.DB, cache string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM cache_entries WHERE cache = ?`, cache).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSQLiteSpillPersistsAcrossRestart(t *testing.T) {
+	spill, db := openSpill(t)
+	opts := Options{TTL: time.Hour, Spill: spill}
+	c, clock := newTestCache[spilledValue](t, opts)
+	clock.now = time.Now() // 持久化的过期时间精确到秒，使用真实时间附近的时钟
+
+	c.Set("a", spilledValue{"alpha", 1})
+	c.SetTTL("short", spilledValue{"short", 2}, time.Minute)
+	c.SetTTL("forever", spilledValue{"forever", 3}, 0)
+	if n := spillRows(t, db, c.Name()); n != 3 {
+		t.Fatalf("rows = %d, want 3", n)
+	}
+
+	c = restart(c, opts, clock)
+	if c.Len() != 0 {
+		t.Fatalf("new instance should start empty, len = %d", c.Len())
+	}
+	if v, ok := c.Get("a"); !ok || v != (spilledValue{"alpha", 1}) {
+		t.Errorf("Get(a) = %+v, %v; want loaded from spill", v, ok)
+	}
+	if c.Len() != 1 || c.Stats().Hits != 1 {
+		t.Errorf("spill hit should be cached in memory and counted, stats = %+v", c.Stats())
+	}
+
+	// 持久化存储中已过期的条目不返回
+	clock.Advance(2 * time.Minute)
+	if _, ok := c.Get("short"); ok {
+		t.Error("expired spilled entry should be a miss")
+	}
+	if v, ok := c.Get("forever"); !ok || v.Count != 3 {
+		t.Errorf("Get(forever) = %+v, %v", v, ok)
+	}
+
+	c.Purge()
+	if n := spillRows(t, db, c.Name()); n != 2 {
+		t.Errorf("rows after purge = %d, want 2", n)
+	}
+	c.Delete("a")
+	if n := spillRows(t, db, c.Name()); n != 1 {
+		t.Errorf("rows after delete = %d, want 1", n)
+	}
+	c = restart(c, opts, clock)
+	if _, ok := c.Get("a"); ok {
+		t.Error("deleted entry should not come back after restart")
+	}
+	c.Clear()
+	if n := spillRows(t, db, c.Name()); n != 0 {
+		t.Errorf("rows after clear = %d, want 0", n)
+	}
+}
+
+func TestSQLiteSpillNamespaces(t *testing.T) {
+	spill, db := openSpill(t)
+	a := New[int, string](t.Name()+"-a", Options{Spill: spill})
+	b := New[int, string](t.Name()+"-b", Options{Spill: spill})
+	a.Set(1, "from a")
+	b.Set(1, "from b")
+	b.Clear()
+
+	if n := spillRows(t, db, a.Name()); n != 1 {
+		t.Errorf("clearing b removed a's rows: %d left", n)
+	}
+	var value string
+	if _, ok := spill.Load(a.Name(), "1", &value); !ok || value != "from a" {
+		t.Errorf("Load = %q, %v", value, ok)
+	}
+	if !a.Stats().Persistent || New[int, int](t.Name()+"-c", Options{}).Stats().Persistent {
+		t.Error("Persistent should reflect whether a spill is configured")
+	}
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats 缓存的统计信息
+type Stats struct {
+	Name       string
+	Size       int
+	MaxEntries int
+	TTL        time.Duration
+	Persistent bool
+	Hits       uint64
+	Misses     uint64
+	Evictions  uint64 // 因容量淘汰的条目
+	Expired    uint64 // 因过期清理的条目
+}
+
+// HitRate 命中率，没有访问时为0
+func (s Stats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// named 登记到全局统计的缓存
+type named interface {
+	Name() string
+	Stats() Stats
+	Purge() int
+	Clear()
+}
+
+var (
+	registry      = make(map[string]named)
+	registryMutex sync.Mutex
+)
+
+// register 登记缓存。名称已被占用时追加 #2、#3… 后缀，返回最终名称
+func register(c named) string {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	name := c.Name()
+	for i := 2; registry[name] != nil; i++ {
+		name = fmt.Sprintf("%s#%d", c.Name(), i)
+	}
+	registry[name] = c
+	return name
+}
+
+// All 返回所有已登记缓存的统计，按名称排序
+func All() []Stats {
+	registryMutex.Lock()
+	caches := make([]named, 0, len(registry))
+	for _, c := range registry {
+		caches = append(caches, c)
+	}
+	registryMutex.Unlock()
+
+	stats := make([]Stats, 0, len(caches))
+	for _, c := range caches {
+		stats = append(stats, c.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// Clear 清空指定名称的缓存
+func Clear(name string) bool {
+	registryMutex.Lock()
+	c, ok := registry[name]
+	registryMutex.Unlock()
+	if ok {
+		c.Clear()
+	}
+	return ok
+}
+
+// PurgeAll 清理所有缓存中的过期条目，返回清理的总数
+func PurgeAll() int {
+	registryMutex.Lock()
+	caches := make([]named, 0, len(registry))
+	for _, c := range registry {
+		caches = append(caches, c)
+	}
+	registryMutex.Unlock()
+
+	total := 0
+	for _, c := range caches {
+		total += c.Purge()
+	}
+	return total
+}
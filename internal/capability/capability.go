@@ -0,0 +1,137 @@
+package capability
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Requirement 插件依赖的一个类型及其字段或方法
+type Requirement struct {
+	Type    reflect.Type
+	Members []string // 字段名或方法名，字段可用 A.B 访问嵌套结构体
+}
+
+// Require 创建依赖项。v 为类型的零值或nil指针，如 tg.MessagesSendMessageRequest{} 或 (*tg.Client)(nil)
+func Require(v interface{}, members ...string) Requirement {
+	return Requirement{Type: reflect.TypeOf(v), Members: members}
+}
+
+// Missing 缺失的成员
+type Missing struct {
+	Type   string
+	Member string
+}
+
+// String 返回 类型.成员 形式
+func (m Missing) String() string {
+	return m.Type + "." + m.Member
+}
+
+// Manifest 一个插件声明的全部依赖
+type Manifest struct {
+	Plugin       string
+	Requirements []Requirement
+}
+
+// Check 检查依赖项，返回缺失的成员
+func (r Requirement) Check() []Missing {
+	if r.Type == nil {
+		return []Missing{{Type: "<nil>", Member: strings.Join(r.Members, ",")}}
+	}
+
+	base := r.Type
+	for base.Kind() == reflect.Ptr {
+		base = base.Elem()
+	}
+
+	var missing []Missing
+	for _, member := range r.Members {
+		if !hasMember(base, member) {
+			missing = append(missing, Missing{Type: base.String(), Member: member})
+		}
+	}
+	return missing
+}
+
+// hasMember 判断类型是否有指定字段(支持嵌套路径)或方法(值或指针接收者)
+func hasMember(t reflect.Type, member string) bool {
+	if !strings.Contains(member, ".") {
+		if _, ok := t.MethodByName(member); ok {
+			return true
+		}
+		if _, ok := reflect.PointerTo(t).MethodByName(member); ok {
+			return true
+		}
+	}
+
+	current := t
+	for _, name := range strings.Split(member, ".") {
+		for current.Kind() == reflect.Ptr {
+			current = current.Elem()
+		}
+		if current.Kind() != reflect.Struct {
+			return false
+		}
+		field, ok := current.FieldByName(name)
+		if !ok {
+			return false
+		}
+		current = field.Type
+	}
+	return true
+}
+
+// Report 能力检查结果
+type Report struct {
+	Checked int                  // 检查的成员总数
+	Missing map[string][]Missing // 插件名 -> 缺失的成员
+}
+
+// Probe 检查所有插件声明的依赖
+func Probe(manifests []Manifest) *Report {
+	report := &Report{Missing: make(map[string][]Missing)}
+	for _, m := range manifests {
+		for _, req := range m.Requirements {
+			report.Checked += len(req.Members)
+			if missing := req.Check(); len(missing) > 0 {
+				report.Missing[m.Plugin] = append(report.Missing[m.Plugin], missing...)
+			}
+		}
+	}
+	return report
+}
+
+// OK 所有依赖均满足
+func (r *Report) OK() bool {
+	return len(r.Missing) == 0
+}
+
+// Affected 返回缺少依赖的插件，按名称排序
+func (r *Report) Affected() []string {
+	plugins := make([]string, 0, len(r.Missing))
+	for name := range r.Missing {
+		plugins = append(plugins, name)
+	}
+	sort.Strings(plugins)
+	return plugins
+}
+
+// Summary 返回多行的检查报告
+func (r *Report) Summary() string {
+	if r.OK() {
+		return fmt.Sprintf("✅ API能力检查通过 (%d 项)", r.Checked)
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("⚠️ API能力检查: %d 个插件缺少依赖 (共检查 %d 项)\n", len(r.Missing), r.Checked))
+	for _, name := range r.Affected() {
+		items := make([]string, 0, len(r.Missing[name]))
+		for _, m := range r.Missing[name] {
+			items = append(items, m.String())
+		}
+		b.WriteString(fmt.Sprintf("\n• %s: %s", name, strings.Join(items, ", ")))
+	}
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package capability
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 用于检查的假类型，模拟 tg 包中的请求、嵌套的权限结构体和客户端方法
+
+type fakeRights struct {
+	SendMessages bool
+	UntilDate    int
+}
+
+type fakeBanRequest struct {
+	Channel   string
+	Rights    fakeRights
+	RightsPtr *fakeRights
+	Count     int
+}
+
+type fakeEmbedded struct {
+	fakeRights
+	Extra string
+}
+
+type fakeClient struct{}
+
+func (fakeClient) GetUsers() {}
+
+func (*fakeClient) EditBanned() {}
+
+func TestRequirementCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Requirement
+		want []Missing
+	}{
+		{
+			name: "fields present",
+			req:  Require(fakeBanRequest{}, "Channel", "Rights", "Rights.SendMessages", "RightsPtr.UntilDate"),
+		},
+		{
+			name: "missing fields",
+			req:  Require(fakeBanRequest{}, "Channel", "BannedRights", "Rights.ViewMessages"),
+			want: []Missing{{"capability.fakeBanRequest", "BannedRights"}, {"capability.fakeBanRequest", "Rights.ViewMessages"}},
+		},
+		{
+			name: "path through non-struct field",
+			req:  Require(fakeBanRequest{}, "Count.Value", "Channel.Len"),
+			want: []Missing{{"capability.fakeBanRequest", "Count.Value"}, {"capability.fakeBanRequest", "Channel.Len"}},
+		},
+		{
+			name: "pointer type checks the struct",
+			req:  Require((*fakeBanRequest)(nil), "Rights.UntilDate", "Flags"),
+			want: []Missing{{"capability.fakeBanRequest", "Flags"}},
+		},
+		{
+			name: "promoted fields of embedded struct",
+			req:  Require(fakeEmbedded{}, "SendMessages", "fakeRights.UntilDate", "Extra"),
+		},
+		{
+			name: "value and pointer receiver methods",
+			req:  Require((*fakeClient)(nil), "GetUsers", "EditBanned", "DeleteHistory"),
+			want: []Missing{{"capability.fakeClient", "DeleteHistory"}},
+		},
+		{
+			name: "pointer receiver method on value type",
+			req:  Require(fakeClient{}, "EditBanned"),
+		},
+		{
+			name: "method names are not paths",
+			req:  Require(fakeClient{}, "GetUsers.X"),
+			want: []Missing{{"capability.fakeClient", "GetUsers.X"}},
+		},
+		{
+			name: "nil type",
+			req:  Require(nil, "A", "B"),
+			want: []Missing{{"<nil>", "A,B"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.Check(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingString(t *testing.T) {
+	if got := (Missing{Type: "tg.ChatBannedRights", Member: "SendMessages"}).String(); got != "tg.ChatBannedRights.SendMessages" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestProbeReport(t *testing.T) {
+	report := Probe([]Manifest{
+		{Plugin: "sb", Requirements: []Requirement{
+			Require((*fakeClient)(nil), "EditBanned", "DeleteHistory"),
+			Require(fakeBanRequest{}, "Channel", "BannedRights"),
+		}},
+		{Plugin: "antiflood", Requirements: []Requirement{
+			Require(fakeBanRequest{}, "Rights.SendMessages", "Rights.UntilDate"),
+		}},
+		{Plugin: "gif", Requirements: []Requirement{
+			Require(fakeRights{}, "ViewMessages"),
+		}},
+		{Plugin: "empty"},
+	})
+
+	if report.Checked != 7 {
+		t.Errorf("Checked = %d, want 7", report.Checked)
+	}
+	if report.OK() {
+		t.Error("report with missing members should not be OK")
+	}
+	if got := report.Affected(); !reflect.DeepEqual(got, []string{"gif", "sb"}) {
+		t.Errorf("Affected() = %q, want [gif sb]", got)
+	}
+	wantSB := []Missing{{"capability.fakeClient", "DeleteHistory"}, {"capability.fakeBanRequest", "BannedRights"}}
+	if !reflect.DeepEqual(report.Missing["sb"], wantSB) {
+		t.Errorf("Missing[sb] = %v, want %v", report.Missing["sb"], wantSB)
+	}
+
+	want := "⚠️ API能力检查: 2 个插件缺少依赖 (共检查 7 项)\n" +
+		"\n• gif: capability.fakeRights.ViewMessages" +
+		"\n• sb: capability.fakeClient.DeleteHistory, capability.fakeBanRequest.BannedRights"
+	if got := report.Summary(); got != want {
+		t.Errorf("Summary() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestProbeAllPresent(t *testing.T) {
+	report := Probe([]Manifest{
+		{Plugin: "a", Requirements: []Requirement{Require(fakeRights{}, "SendMessages", "UntilDate")}},
+		{Plugin: "b", Requirements: []Requirement{Require(fakeClient{}, "GetUsers")}},
+	})
+	if !report.OK() || len(report.Affected()) != 0 {
+		t.Errorf("report = %+v, want OK", report)
+	}
+	if got := report.Summary(); got != "✅ API能力检查通过 (3 项)" {
+		t.Errorf("Summary() = %q", got)
+	}
+}
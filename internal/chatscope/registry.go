@@ -0,0 +1,136 @@
+package chatscope
+
+import (
+	"database/sql"
+	"fmt"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registry 记录在单个对话中禁用的插件。全部数据在启动时加载到内存，每条命令执行前只查询内存
+type Registry struct {
+	db       *sql.DB
+	disabled map[string]map[int64]bool // 插件名 -> 禁用该插件的对话
+	mutex    sync.RWMutex
+}
+
+// NewRegistry 创建对话级插件开关，db为nil时只在内存中记录
+func NewRegistry(db *sql.DB) *Registry {
+	r := &Registry{
+		db:       db,
+		disabled: make(map[string]map[int64]bool),
+	}
+
+	if db != nil {
+		if err := r.initDatabase(); err != nil {
+			logger.Errorf("Failed to create plugin_chat_disabled table: %v", err)
+		} else if err := r.load(); err != nil {
+			logger.Errorf("Failed to load chat-scoped plugin toggles: %v", err)
+		}
+	}
+
+	return r
+}
+
+// initDatabase 初始化数据库表
+func (r *Registry) initDatabase() error {
+	_, err := r.db.Exec(`
+	CREATE TABLE IF NOT EXISTS plugin_chat_disabled (
+		plugin TEXT NOT NULL,
+		chat_id INTEGER NOT NULL,
+		disabled_at INTEGER NOT NULL,
+		PRIMARY KEY (plugin, chat_id)
+	)`)
+	return err
+}
+
+// load 从数据库加载已禁用的插件
+func (r *Registry) load() error {
+	rows, err := r.db.Query("SELECT plugin, chat_id FROM plugin_chat_disabled")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var plugin string
+		var chatID int64
+		if err := rows.Scan(&plugin, &chatID); err != nil {
+			return err
+		}
+		r.setLocked(plugin, chatID)
+	}
+	return rows.Err()
+}
+
+// setLocked 在内存中标记禁用，调用方需持有锁
+func (r *Registry) setLocked(plugin string, chatID int64) {
+	chats, ok := r.disabled[plugin]
+	if !ok {
+		chats = make(map[int64]bool)
+		r.disabled[plugin] = chats
+	}
+	chats[chatID] = true
+}
+
+// Disable 在对话中禁用插件
+func (r *Registry) Disable(plugin string, chatID int64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.disabled[plugin][chatID] {
+		return fmt.Errorf("plugin %s is already disabled in this chat", plugin)
+	}
+	if r.db != nil {
+		if _, err := r.db.Exec("INSERT OR REPLACE INTO plugin_chat_disabled (plugin, chat_id, disabled_at) VALUES (?, ?, ?)",
+			plugin, chatID, time.Now().Unix()); err != nil {
+			return err
+		}
+	}
+	r.setLocked(plugin, chatID)
+	return nil
+}
+
+// Enable 取消插件在对话中的禁用
+func (r *Registry) Enable(plugin string, chatID int64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.disabled[plugin][chatID] {
+		return fmt.Errorf("plugin %s is not disabled in this chat", plugin)
+	}
+	if r.db != nil {
+		if _, err := r.db.Exec("DELETE FROM plugin_chat_disabled WHERE plugin = ? AND chat_id = ?", plugin, chatID); err != nil {
+			return err
+		}
+	}
+	delete(r.disabled[plugin], chatID)
+	if len(r.disabled[plugin]) == 0 {
+		delete(r.disabled, plugin)
+	}
+	return nil
+}
+
+// IsDisabled 插件是否在对话中被禁用
+func (r *Registry) IsDisabled(plugin string, chatID int64) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.disabled[plugin][chatID]
+}
+
+// DisabledIn 返回在对话中被禁用的插件，按名称排序
+func (r *Registry) DisabledIn(chatID int64) []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var plugins []string
+	for plugin, chats := range r.disabled {
+		if chats[chatID] {
+			plugins = append(plugins, plugin)
+		}
+	}
+	sort.Strings(plugins)
+	return plugins
+}
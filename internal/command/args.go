@@ -0,0 +1,237 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// argToken 命令参数中的一个词
+type argToken struct {
+	Text  string // 去掉引号和转义后的内容
+	Start int    // 在原始参数文本中的起始位置
+	// Flag 为 --name 或 --name=value 形式时的参数名，普通参数为空
+	Flag     string
+	Value    string
+	HasValue bool // --name=value 形式
+	consumed bool // 已作为前一个 --name 的值被 Flag 取走
+}
+
+// commandArgs 一条命令解析后的参数
+type commandArgs struct {
+	raw    string // 命令名之后的原始文本
+	tokens []argToken
+}
+
+// splitCommand 把前缀之后的命令文本拆分为命令名和参数
+func splitCommand(text string) (string, *commandArgs) {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	end := strings.IndexFunc(text, unicode.IsSpace)
+	if end < 0 {
+		return text, &commandArgs{}
+	}
+	raw := text[end:]
+	return text[:end], &commandArgs{raw: raw, tokens: tokenizeArgs(raw)}
+}
+
+// tokenizeArgs 按空白拆分参数，支持双引号、单引号和反斜杠转义。
+// 双引号中只有 \" 和 \\ 是转义，单引号中的内容原样保留，未闭合的引号延续到文本末尾。
+// 单独的 -- 之后以及带引号的词都不作为标志
+func tokenizeArgs(text string) []argToken {
+	var tokens []argToken
+	var current strings.Builder
+	start := -1
+	quoted := false
+	var quote rune
+	escaped := false
+	flagsDone := false
+
+	flush := func() {
+		if start < 0 {
+			return
+		}
+		token := argToken{Text: current.String(), Start: start}
+		switch {
+		case quoted || flagsDone:
+		case token.Text == "--":
+			flagsDone = true
+			start = -1
+			current.Reset()
+			return
+		case strings.HasPrefix(token.Text, "--") && len(token.Text) > 2:
+			name, value, found := strings.Cut(token.Text[2:], "=")
+			if name != "" {
+				token.Flag, token.Value, token.HasValue = name, value, found
+			}
+		}
+		tokens = append(tokens, token)
+		start = -1
+		quoted = false
+		current.Reset()
+	}
+
+	for i, r := range text {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				if next := nextRune(text, i); next == '"' || next == '\\' {
+					escaped = true
+				} else {
+					current.WriteRune(r)
+				}
+			default:
+				current.WriteRune(r)
+			}
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			if start < 0 {
+				start = i
+			}
+			switch r {
+			case '\\':
+				escaped = true
+			case '"', '\'':
+				quote = r
+				quoted = true
+			default:
+				current.WriteRune(r)
+			}
+		}
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+	flush()
+	return tokens
+}
+
+// nextRune 返回text中位置i的字符之后的字符，没有时返回0
+func nextRune(text string, i int) rune {
+	for _, r := range text[i+1:] {
+		return r
+	}
+	return 0
+}
+
+// plain 返回不是标志也没有被取走的参数
+func (a *commandArgs) plain() []string {
+	args := make([]string, 0, len(a.tokens))
+	for _, token := range a.tokens {
+		if token.Flag == "" && !token.consumed {
+			args = append(args, token.Text)
+		}
+	}
+	return args
+}
+
+// flagIndex 返回标志在tokens中的位置，没有时返回-1
+func (a *commandArgs) flagIndex(name string) int {
+	for i, token := range a.tokens {
+		if token.Flag == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ArgsString 返回命令名之后的原始文本，保留引号、换行和标志，用于自由文本参数
+func (ctx *CommandContext) ArgsString() string {
+	return ctx.ArgsStringFrom(0)
+}
+
+// ArgsStringFrom 返回从第i个参数(对应 Args[i])开始的原始文本，保留引号、换行和之后的标志。
+// 参数被钩子替换过时退回为用空格连接 Args[i:]
+func (ctx *CommandContext) ArgsStringFrom(i int) string {
+	if ctx.args == nil || !ctx.argsParsed {
+		if i < 0 || i >= len(ctx.Args) {
+			return ""
+		}
+		return strings.Join(ctx.Args[i:], " ")
+	}
+	if i <= 0 {
+		return strings.TrimSpace(ctx.args.raw)
+	}
+	n := 0
+	for _, token := range ctx.args.tokens {
+		if token.Flag != "" || token.consumed {
+			continue
+		}
+		if n == i {
+			return strings.TrimRightFunc(ctx.args.raw[token.Start:], unicode.IsSpace)
+		}
+		n++
+	}
+	return ""
+}
+
+// HasFlag 判断命令中是否有 --name 或 --name=value 形式的标志
+func (ctx *CommandContext) HasFlag(name string) bool {
+	return ctx.args != nil && ctx.args.flagIndex(name) >= 0
+}
+
+// Flag 返回标志的值，支持 --name=value 和 --name value 两种写法。
+// 使用 --name value 写法时，value 会从 Args 中移除，所以应在读取 Args 之前调用
+func (ctx *CommandContext) Flag(name string) (string, bool) {
+	if ctx.args == nil {
+		return "", false
+	}
+	i := ctx.args.flagIndex(name)
+	if i < 0 {
+		return "", false
+	}
+	tokens := ctx.args.tokens
+	if tokens[i].HasValue {
+		return tokens[i].Value, true
+	}
+	if i+1 < len(tokens) && tokens[i+1].Flag == "" {
+		if !tokens[i+1].consumed {
+			tokens[i+1].consumed = true
+			if ctx.argsParsed {
+				ctx.Args = ctx.args.plain()
+			}
+		}
+		return tokens[i+1].Text, true
+	}
+	return "", true
+}
+
+// FlagInt 返回整数标志的值，没有该标志时返回def
+func (ctx *CommandContext) FlagInt(name string, def int) (int, error) {
+	value, ok := ctx.Flag(name)
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def, fmt.Errorf("--%s 需要一个整数: %q", name, value)
+	}
+	return n, nil
+}
+
+// FlagNames 按出现顺序返回命令中的所有标志名
+func (ctx *CommandContext) FlagNames() []string {
+	if ctx.args == nil {
+		return nil
+	}
+	var names []string
+	for _, token := range ctx.args.tokens {
+		if token.Flag != "" {
+			names = append(names, token.Flag)
+		}
+	}
+	return names
+}
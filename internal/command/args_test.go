@@ -0,0 +1,211 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+// tokenTexts 返回各个词的内容，标志以 --name 或 --name=value 表示
+func tokenTexts(tokens []argToken) []string {
+	texts := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		switch {
+		case token.Flag != "" && token.HasValue:
+			texts = append(texts, "--"+token.Flag+"="+token.Value)
+		case token.Flag != "":
+			texts = append(texts, "--"+token.Flag)
+		default:
+			texts = append(texts, token.Text)
+		}
+	}
+	return texts
+}
+
+func TestTokenizeArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"whitespace", "  a b\t\tc\n", []string{"a", "b", "c"}},
+		{"empty", "", []string{}},
+		{"double quotes", `"hello world" x`, []string{"hello world", "x"}},
+		{"single quotes keep everything", `'a "b" \c'`, []string{`a "b" \c`}},
+		{"escaped quote in double quotes", `"say \"hi\""`, []string{`say "hi"`}},
+		{"escaped backslash in double quotes", `"a\\b"`, []string{`a\b`}},
+		{"other backslash in double quotes kept", `"C:\path\to"`, []string{`C:\path\to`}},
+		{"backslash-escaped space", `hello\ world next`, []string{"hello world", "next"}},
+		{"backslash-escaped quote", `it\'s`, []string{"it's"}},
+		{"escaped backslash", `a\\b`, []string{`a\b`}},
+		{"trailing backslash kept", `abc\`, []string{`abc\`}},
+		{"unterminated double quote", `x "hello world`, []string{"x", "hello world"}},
+		{"unterminated single quote", `'abc def`, []string{"abc def"}},
+		{"quotes inside a word", `foo"bar baz"qux`, []string{"foobar bazqux"}},
+		{"empty quoted argument", `"" x`, []string{"", "x"}},
+		{"quoted emoji", `"🎉 派对" 🍕`, []string{"🎉 派对", "🍕"}},
+		{"unicode", "你好 世界 ñandú", []string{"你好", "世界", "ñandú"}},
+		{"flag with value", "--n=5 rest", []string{"--n=5", "rest"}},
+		{"flag then value", "--n 5", []string{"--n", "5"}},
+		{"flag with empty value", "--n=", []string{"--n="}},
+		{"flag with quoted value", `--msg="hello world"`, []string{"--msg=hello world"}},
+		{"single dash is not a flag", "-x -", []string{"-x", "-"}},
+		{"quoted flag is plain", `"--x"`, []string{"--x"}},
+		{"flag without name is plain", "--=v", []string{"--=v"}},
+		{"terminator", "a -- --b c", []string{"a", "--b", "c"}},
+		{"second terminator is plain", "-- --", []string{"--"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tokenTexts(tokenizeArgs(tt.in))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenizeArgs(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeArgsFlagFields(t *testing.T) {
+	tokens := tokenizeArgs(`--a --b=2 "--c" -- --d`)
+	want := []struct {
+		flag, value string
+		hasValue    bool
+	}{
+		{"a", "", false},
+		{"b", "2", true},
+		{"", "", false},
+		{"", "", false},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for i, w := range want {
+		if tokens[i].Flag != w.flag || tokens[i].Value != w.value || tokens[i].HasValue != w.hasValue {
+			t.Errorf("token %d = %+v, want %+v", i, tokens[i], w)
+		}
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		in, name, raw string
+	}{
+		{"help", "help", ""},
+		{"  help  ", "help", "  "},
+		{"echo hello world", "echo", " hello world"},
+		{"gm\n多行\n问题", "gm", "\n多行\n问题"},
+	}
+	for _, tt := range tests {
+		name, args := splitCommand(tt.in)
+		if name != tt.name || args.raw != tt.raw {
+			t.Errorf("splitCommand(%q) = %q, %q; want %q, %q", tt.in, name, args.raw, tt.name, tt.raw)
+		}
+	}
+}
+
+// newArgsContext 按解析器的方式从命令文本创建上下文
+func newArgsContext(text string) *CommandContext {
+	name, args := splitCommand(text)
+	return &CommandContext{Command: name, Args: args.plain(), args: args, argsParsed: true}
+}
+
+func TestContextArgsExcludeFlags(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"cmd a b", []string{"a", "b"}},
+		{"cmd --count=5 rest", []string{"rest"}},
+		{"cmd --count 5 rest", []string{"5", "rest"}}, // 调用 Flag 之前值仍在 Args 中
+		{`cmd "two words" --x`, []string{"two words"}},
+		{"cmd a -- --b", []string{"a", "--b"}},
+	}
+	for _, tt := range tests {
+		ctx := newArgsContext(tt.in)
+		if !reflect.DeepEqual(ctx.Args, tt.want) {
+			t.Errorf("%q: Args = %q, want %q", tt.in, ctx.Args, tt.want)
+		}
+	}
+}
+
+func TestContextFlag(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		flag     string
+		value    string
+		found    bool
+		wantArgs []string
+	}{
+		{"equals form", "cmd --n=5 rest", "n", "5", true, []string{"rest"}},
+		{"space form consumes value", "cmd --n 5 rest", "n", "5", true, []string{"rest"}},
+		{"quoted space form", `cmd --msg "hi there" rest`, "msg", "hi there", true, []string{"rest"}},
+		{"empty equals value", "cmd --n= rest", "n", "", true, []string{"rest"}},
+		{"bare flag at end", "cmd rest --verbose", "verbose", "", true, []string{"rest"}},
+		{"next token is a flag", "cmd --a --b x", "a", "", true, []string{"x"}},
+		{"missing flag", "cmd rest", "n", "", false, []string{"rest"}},
+		{"after terminator", "cmd -- --n 5", "n", "", false, []string{"--n", "5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newArgsContext(tt.in)
+			value, found := ctx.Flag(tt.flag)
+			if value != tt.value || found != tt.found {
+				t.Errorf("Flag(%q) = %q, %v; want %q, %v", tt.flag, value, found, tt.value, tt.found)
+			}
+			if !reflect.DeepEqual(ctx.Args, tt.wantArgs) {
+				t.Errorf("Args = %q, want %q", ctx.Args, tt.wantArgs)
+			}
+			// 重复调用结果相同，不会再取走参数
+			value2, _ := ctx.Flag(tt.flag)
+			if value2 != tt.value || !reflect.DeepEqual(ctx.Args, tt.wantArgs) {
+				t.Errorf("second Flag(%q) = %q, Args %q", tt.flag, value2, ctx.Args)
+			}
+		})
+	}
+}
+
+func TestContextFlagInt(t *testing.T) {
+	ctx := newArgsContext("cmd --n=12 --bad=x")
+	if n, err := ctx.FlagInt("n", 1); err != nil || n != 12 {
+		t.Errorf("FlagInt(n) = %d, %v; want 12", n, err)
+	}
+	if n, err := ctx.FlagInt("missing", 7); err != nil || n != 7 {
+		t.Errorf("FlagInt(missing) = %d, %v; want default 7", n, err)
+	}
+	if n, err := ctx.FlagInt("bad", 3); err == nil || n != 3 {
+		t.Errorf("FlagInt(bad) = %d, %v; want default and error", n, err)
+	}
+}
+
+func TestContextHasFlagAndNames(t *testing.T) {
+	ctx := newArgsContext(`cmd --b x --a=1 "--c" -- --d`)
+	if !ctx.HasFlag("a") || !ctx.HasFlag("b") {
+		t.Error("HasFlag should find --a and --b")
+	}
+	if ctx.HasFlag("c") || ctx.HasFlag("d") {
+		t.Error("quoted flags and flags after -- are plain arguments")
+	}
+	if got := ctx.FlagNames(); !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("FlagNames = %q, want [b a]", got)
+	}
+}
+
+func TestContextArgsString(t *testing.T) {
+	ctx := newArgsContext("cmd first  second \"third x\"\nline --f v  ")
+	if got, want := ctx.ArgsString(), "first  second \"third x\"\nline --f v"; got != want {
+		t.Errorf("ArgsString = %q, want %q", got, want)
+	}
+	if got, want := ctx.ArgsStringFrom(1), "second \"third x\"\nline --f v"; got != want {
+		t.Errorf("ArgsStringFrom(1) = %q, want %q", got, want)
+	}
+	if got := ctx.ArgsStringFrom(10); got != "" {
+		t.Errorf("ArgsStringFrom(10) = %q, want empty", got)
+	}
+
+	// 参数被钩子替换后退回为用空格连接 Args
+	ctx.argsParsed = false
+	ctx.Args = []string{"x", "y", "z"}
+	if got := ctx.ArgsStringFrom(1); got != "y z" {
+		t.Errorf("ArgsStringFrom(1) with replaced Args = %q, want %q", got, "y z")
+	}
+}
@@ -0,0 +1,81 @@
+package command
+
+import (
+	"fmt"
+	"nexusvalet/internal/flood"
+	"strings"
+	"sync"
+
+	"github.com/gotd/td/tg"
+)
+
+// Output 以捕获模式执行的命令通过 Respond 输出的内容，
+// 以及编辑或回复命令消息的内容
+type Output struct {
+	Text     string
+	Entities []tg.MessageEntityClass
+}
+
+// capture 捕获模式下保存命令的输出。Respond 会替换之前的响应，
+// 因此只保留最后一次输出
+type capture struct {
+	mutex  sync.Mutex
+	output *Output
+}
+
+func (c *capture) set(text string, entities []tg.MessageEntityClass) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.output = &Output{Text: text, Entities: entities}
+}
+
+func (c *capture) get() *Output {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.output
+}
+
+// Capturing 命令是否以捕获模式执行，此时 Respond 不发送消息
+func (c *CommandContext) Capturing() bool {
+	return c.capture != nil
+}
+
+// capturesMessage 捕获模式下peer中ID为id的消息是否为命令消息。
+// 插件通过 EditMessage 编辑命令消息或通过 SendMessage 回复命令消息时按 Respond 处理
+func (c *CommandContext) capturesMessage(peer tg.InputPeerClass, id int) bool {
+	if c.capture == nil || c.Message == nil || c.Message.Message == nil || id != c.Message.Message.ID {
+		return false
+	}
+	if _, ok := peer.(*tg.InputPeerSelf); ok {
+		return c.Message.ChatID > 0
+	}
+	return flood.PeerChatID(peer) == c.Message.ChatID
+}
+
+// RunCaptured 在c所在的对话中以捕获模式执行另一条命令，text 为不带前缀的命令名和参数。
+// 命令通过 Respond 输出、编辑命令消息或用 SendMessage 回复命令消息的内容不会发送，而是作为返回值；
+// 命令没有输出时返回nil，直接调用API发送的其他消息(如图片、文件)不会被捕获。
+// 与正常执行一样会执行钩子和对话禁用检查，被钩子否决时返回 *core.VetoError
+func (p *Parser) RunCaptured(c *CommandContext, text string) (*Output, error) {
+	commandName, parsed := splitCommand(strings.TrimSpace(text))
+	if commandName == "" {
+		return nil, fmt.Errorf("没有指定命令")
+	}
+	command, exists := p.GetCommand(commandName)
+	if !exists {
+		return nil, fmt.Errorf("未知命令: %s", commandName)
+	}
+	if p.disabledInChat(command.Plugin, c.Message.ChatID) {
+		return nil, fmt.Errorf("插件 %s 在当前对话中已禁用", command.Plugin)
+	}
+
+	// 内层命令看到的消息文本是它自己的命令
+	msgEvent := *c.Message
+	msgEvent.Text = c.Prefix + strings.TrimSpace(text)
+
+	out := &capture{}
+	if err := p.executeCommand(c.Context, c.Prefix, commandName, parsed, &msgEvent, out); err != nil {
+		return nil, err
+	}
+	return out.get(), nil
+}
@@ -0,0 +1,18 @@
+package command
+
+import "nexusvalet/internal/chatscope"
+
+// SetChatScope 设置对话级插件开关，在对话中被禁用的插件不再响应该对话中的命令
+func (p *Parser) SetChatScope(registry *chatscope.Registry) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.chatScope = registry
+}
+
+// disabledInChat 插件是否在对话中被禁用
+func (p *Parser) disabledInChat(plugin string, chatID int64) bool {
+	p.mutex.RLock()
+	registry := p.chatScope
+	p.mutex.RUnlock()
+	return registry != nil && registry.IsDisabled(plugin, chatID)
+}
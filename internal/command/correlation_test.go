@@ -0,0 +1,114 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/errctx"
+	"nexusvalet/internal/peers"
+	"nexusvalet/pkg/logger"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+// newFailingParser 创建已连接记录请求的 Telegram 客户端、注册了失败命令 fail 的解析器
+func newFailingParser(inv *recordingInvoker) *Parser {
+	parser := newTestParser()
+	parser.SetTelegramAPI(tg.NewClient(inv), peers.NewResolver(channelPeers{}))
+	parser.RegisterCommand("fail", "测试", "core", func(ctx *CommandContext) error {
+		return errors.New("boom")
+	})
+	return parser
+}
+
+// failingMessage 在带有关联ID的 context 中发送 .fail 命令
+func failingMessage(parser *Parser, cid string) error {
+	ctx := logger.WithFields(context.Background(), logger.Fields{CorrelationID: cid, ChatID: -1000000000123, MessageID: 100})
+	return parser.handleMessage(ctx, &core.MessageEvent{
+		Message: &tg.Message{ID: 100, Out: true},
+		ChatID:  -1000000000123,
+		Text:    ".fail",
+	})
+}
+
+// recentContaining 返回最近日志中包含s的行
+func recentContaining(s string) []string {
+	var lines []string
+	for _, line := range logger.Recent(500, "") {
+		if strings.Contains(line.Text, s) {
+			lines = append(lines, line.Text)
+		}
+	}
+	return lines
+}
+
+func TestCommandErrorCarriesCorrelationID(t *testing.T) {
+	inv := &recordingInvoker{}
+	parser := newFailingParser(inv)
+	cid := logger.NewCorrelationID()
+
+	err := failingMessage(parser, cid)
+	if err == nil {
+		t.Fatal("failing command should return its error")
+	}
+	if got := errctx.CorrelationID(err); got != cid {
+		t.Errorf("CorrelationID(err) = %q, want %q", got, cid)
+	}
+	want := "[cid=" + cid + " chat=-1000000000123 msg=100 cmd=fail] boom"
+	if err.Error() != want {
+		t.Errorf("err = %q, want %q", err, want)
+	}
+
+	// 失败日志带有相同的字段前缀
+	lines := recentContaining("cid=" + cid)
+	found := false
+	for _, line := range lines {
+		if line == "[cid="+cid+" chat=-1000000000123 msg=100 cmd=fail] Command fail failed: boom" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("failure log line with fields missing, got %q", lines)
+	}
+
+	// INFO 级别下不把错误编辑到命令消息中
+	if len(inv.edits) != 0 {
+		t.Errorf("edits at INFO level = %d, want 0", len(inv.edits))
+	}
+}
+
+func TestDebugCommandErrorShowsCorrelationID(t *testing.T) {
+	logger.SetLevel(logger.DEBUG)
+	t.Cleanup(func() { logger.SetLevel(logger.INFO) })
+
+	inv := &recordingInvoker{}
+	parser := newFailingParser(inv)
+	cid := logger.NewCorrelationID()
+
+	if err := failingMessage(parser, cid); errctx.CorrelationID(err) != cid {
+		t.Fatalf("err = %v, want correlation ID %s", err, cid)
+	}
+	if len(inv.edits) != 1 {
+		t.Fatalf("edits = %d, want 1", len(inv.edits))
+	}
+	if got, want := inv.edits[0].Message, "❌ 命令执行失败: boom\n关联ID: "+cid; got != want {
+		t.Errorf("edited text = %q, want %q", got, want)
+	}
+	if inv.edits[0].ID != 100 {
+		t.Errorf("edited message ID = %d, want 100", inv.edits[0].ID)
+	}
+}
+
+func TestCapturedCommandErrorNotWrapped(t *testing.T) {
+	// 捕获模式把原始错误交给外层命令，由外层命令的流程添加字段
+	parser := newFailingParser(&recordingInvoker{})
+	c := newTestContext(nil)
+	c.Context = logger.WithFields(c.Context, logger.Fields{CorrelationID: "deadbeef"})
+
+	_, err := parser.RunCaptured(c, "fail")
+	if err == nil || err.Error() != "boom" {
+		t.Errorf("RunCaptured error = %v, want the bare error", err)
+	}
+}
@@ -0,0 +1,138 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/deprecation"
+	"nexusvalet/pkg/logger"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// SetDeprecations 设置弃用项注册表，用于记录旧命令名的使用情况
+func (p *Parser) SetDeprecations(registry *deprecation.Registry) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.deprecations = registry
+}
+
+// RegisterDeprecatedAlias 将旧命令名注册为新命令的弃用别名。
+// 旧命令名仍可使用，但每个对话每天会提示一次新命令名；超过保留期限后不再注册
+func (p *Parser) RegisterDeprecatedAlias(alias, target string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.deprecations != nil && !p.deprecations.Declare(deprecation.Command, alias, target) {
+		return
+	}
+	p.aliases[alias] = target
+	logger.Debugf("Registered deprecated alias: %s -> %s", alias, target)
+}
+
+// deprecatedTarget 返回弃用别名对应的新命令名
+func (p *Parser) deprecatedTarget(name string) (string, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if _, exists := p.commands[name]; exists {
+		return "", false
+	}
+	target, ok := p.aliases[name]
+	return target, ok
+}
+
+// noticeDeprecatedAlias 使用弃用别名执行命令后记录使用，并按频率限制在命令消息末尾追加提示
+func (p *Parser) noticeDeprecatedAlias(ctx context.Context, prefix, name string, msgEvent *core.MessageEvent) {
+	target, ok := p.deprecatedTarget(name)
+	if !ok {
+		return
+	}
+	log := logger.Ctx(ctx)
+	log.Warnf("Deprecated command %s used, use %s instead", name, target)
+
+	p.mutex.RLock()
+	registry := p.deprecations
+	p.mutex.RUnlock()
+	if registry == nil {
+		return
+	}
+	registry.Observe(deprecation.Command, name)
+	if !registry.ShouldNotify(msgEvent.ChatID, deprecation.Command, name) {
+		return
+	}
+
+	notice := "⚠️ " + prefix + name + " 已弃用，请改用 " + prefix + target
+	if entry, ok := registry.Lookup(deprecation.Command, name); ok {
+		if removal := registry.Removal(entry); removal != "" {
+			notice += "（将于 " + removal + " 移除）"
+		}
+	}
+	p.appendToCommandMessage(ctx, msgEvent, notice)
+}
+
+// appendToCommandMessage 在命令消息(可能已被命令编辑过)末尾追加一行，保留原有格式；
+// 消息已被删除等无法编辑时改为发送新消息
+func (p *Parser) appendToCommandMessage(ctx context.Context, msgEvent *core.MessageEvent, line string) {
+	if p.telegramAPI == nil || p.peerResolver == nil || msgEvent.Message == nil {
+		return
+	}
+	log := logger.Ctx(ctx)
+	peer, err := p.peerResolver.ResolveFromChatID(ctx, msgEvent.ChatID)
+	if err != nil {
+		log.Errorf("Failed to resolve peer for deprecation notice: %v", err)
+		return
+	}
+
+	if current, err := p.fetchMessage(ctx, peer, msgEvent.Message.ID); err == nil {
+		req := &tg.MessagesEditMessageRequest{
+			Peer:    peer,
+			ID:      current.ID,
+			Message: current.Message + "\n\n" + line,
+		}
+		if len(current.Entities) > 0 {
+			req.SetEntities(current.Entities)
+		}
+		if _, err := p.telegramAPI.MessagesEditMessage(ctx, req); err == nil {
+			return
+		}
+	}
+
+	if _, err := p.telegramAPI.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+		Peer:     peer,
+		Message:  line,
+		RandomID: time.Now().UnixNano(),
+	}); err != nil {
+		log.Errorf("Failed to send deprecation notice: %v", err)
+	}
+}
+
+// fetchMessage 获取对话中的一条消息
+func (p *Parser) fetchMessage(ctx context.Context, peer tg.InputPeerClass, id int) (*tg.Message, error) {
+	var (
+		result tg.MessagesMessagesClass
+		err    error
+	)
+	ids := []tg.InputMessageClass{&tg.InputMessageID{ID: id}}
+	if channel, ok := peer.(*tg.InputPeerChannel); ok {
+		result, err = p.telegramAPI.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+			Channel: &tg.InputChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash},
+			ID:      ids,
+		})
+	} else {
+		result, err = p.telegramAPI.MessagesGetMessages(ctx, ids)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if modified, ok := result.AsModified(); ok {
+		for _, m := range modified.GetMessages() {
+			if msg, ok := m.(*tg.Message); ok {
+				return msg, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("message %d not found", id)
+}
@@ -0,0 +1,180 @@
+package command
+
+import (
+	"context"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/deprecation"
+	"nexusvalet/internal/peers"
+	"nexusvalet/internal/version"
+	"sync"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// messageStore 保存每条消息当前内容的 tg.Invoker，获取消息时返回编辑后的内容
+type messageStore struct {
+	mu    sync.Mutex
+	texts map[int]string
+	edits []*tg.MessagesEditMessageRequest
+	sends []*tg.MessagesSendMessageRequest
+}
+
+func (m *messageStore) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch req := input.(type) {
+	case *tg.MessagesEditMessageRequest:
+		m.edits = append(m.edits, req)
+		m.texts[req.ID] = req.Message
+		output.(*tg.UpdatesBox).Updates = &tg.Updates{}
+	case *tg.MessagesSendMessageRequest:
+		m.sends = append(m.sends, req)
+		output.(*tg.UpdatesBox).Updates = &tg.UpdateShortSentMessage{ID: 500}
+	case *tg.ChannelsGetMessagesRequest:
+		id := req.ID[0].(*tg.InputMessageID).ID
+		var msgs []tg.MessageClass
+		if text, ok := m.texts[id]; ok {
+			msgs = append(msgs, &tg.Message{ID: id, Message: text})
+		}
+		output.(*tg.MessagesMessagesBox).Messages = &tg.MessagesChannelMessages{Messages: msgs}
+	}
+	return nil
+}
+
+// takeEdits 返回并清空记录的编辑内容
+func (m *messageStore) takeEdits() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var texts []string
+	for _, req := range m.edits {
+		texts = append(texts, req.Message)
+	}
+	m.edits = nil
+	return texts
+}
+
+// newDeprecationParser 创建注册了 speedtest 命令和弃用别名 st 的解析器
+func newDeprecationParser(t *testing.T, store *messageStore) (*Parser, *deprecation.Registry) {
+	t.Helper()
+	saved := version.Version
+	version.Version = "v1.2.0"
+	t.Cleanup(func() { version.Version = saved })
+
+	registry := deprecation.NewRegistry(nil)
+	parser := newTestParser()
+	parser.SetTelegramAPI(tg.NewClient(store), peers.NewResolver(channelPeers{}))
+	parser.SetDeprecations(registry)
+	parser.RegisterCommand("speedtest", "测速", "speedtest", respondWith("🚀 done"))
+	parser.RegisterDeprecatedAlias("st", "speedtest")
+	return parser, registry
+}
+
+// sendCommand 在对话中发送ID为100的命令消息
+func sendCommand(t *testing.T, parser *Parser, store *messageStore, chatID int64, text string) []string {
+	t.Helper()
+	store.mu.Lock()
+	store.texts[100] = text
+	store.mu.Unlock()
+	msgEvent := &core.MessageEvent{Message: &tg.Message{ID: 100, Out: true, Message: text}, ChatID: chatID, Text: text}
+	if err := parser.handleMessage(context.Background(), msgEvent); err != nil {
+		t.Fatalf("%s: %v", text, err)
+	}
+	return store.takeEdits()
+}
+
+func TestDeprecatedAliasNoticeOncePerChat(t *testing.T) {
+	store := &messageStore{texts: make(map[int]string)}
+	parser, registry := newDeprecationParser(t, store)
+	notice := "🚀 done\n\n⚠️ .st 已弃用，请改用 .speedtest（将于 v1.4.0 移除）"
+
+	steps := []struct {
+		name   string
+		chatID int64
+		text   string
+		want   []string
+	}{
+		{"first use appends notice", -1000000000123, ".st", []string{"🚀 done", notice}},
+		{"second use in the same chat", -1000000000123, ".st", []string{"🚀 done"}},
+		{"new name has no notice", -1000000000123, ".speedtest", []string{"🚀 done"}},
+		{"other chat gets its own notice", -1000000000456, ".st", []string{"🚀 done", notice}},
+		{"other chat only once", -1000000000456, ".st", []string{"🚀 done"}},
+	}
+	for _, s := range steps {
+		got := sendCommand(t, parser, store, s.chatID, s.text)
+		if len(got) != len(s.want) {
+			t.Errorf("%s: edits = %q, want %q", s.name, got, s.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != s.want[i] {
+				t.Errorf("%s: edit %d = %q, want %q", s.name, i, got[i], s.want[i])
+			}
+		}
+	}
+
+	// 每次使用旧命令名都计入，新命令名不计入
+	e, ok := registry.Lookup(deprecation.Command, "st")
+	if !ok || e.Uses != 4 || e.New != "speedtest" {
+		t.Errorf("entry = %+v, %v; want 4 uses", e, ok)
+	}
+	if len(store.sends) != 0 {
+		t.Errorf("sent %d messages, want notices appended by editing", len(store.sends))
+	}
+}
+
+func TestDeprecatedAliasNoticeFallsBackToNewMessage(t *testing.T) {
+	store := &messageStore{texts: make(map[int]string)}
+	parser, _ := newDeprecationParser(t, store)
+	// 命令删除了自己的消息时无法追加，改为发送新消息
+	parser.RegisterCommand("speedtest", "测速", "speedtest", func(ctx *CommandContext) error {
+		store.mu.Lock()
+		delete(store.texts, ctx.Message.Message.ID)
+		store.mu.Unlock()
+		return nil
+	})
+
+	msgEvent := &core.MessageEvent{Message: &tg.Message{ID: 100, Out: true}, ChatID: -1000000000123, Text: ".st"}
+	if err := parser.handleMessage(context.Background(), msgEvent); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.sends) != 1 || store.sends[0].Message != "⚠️ .st 已弃用，请改用 .speedtest（将于 v1.4.0 移除）" {
+		t.Errorf("sends = %+v", store.sends)
+	}
+}
+
+func TestDeprecatedAliasCapturedHasNoNotice(t *testing.T) {
+	store := &messageStore{texts: make(map[int]string)}
+	parser, registry := newDeprecationParser(t, store)
+
+	// 别名在捕获模式下同样可以执行，但不提示也不计入使用
+	out, err := parser.RunCaptured(newTestContext(nil), "st")
+	if err != nil || out == nil || out.Text != "🚀 done" {
+		t.Fatalf("RunCaptured(st) = %+v, %v", out, err)
+	}
+	if e, _ := registry.Lookup(deprecation.Command, "st"); e.Uses != 0 {
+		t.Errorf("captured alias counted %d uses", e.Uses)
+	}
+	if len(store.edits) != 0 || len(store.sends) != 0 {
+		t.Error("captured alias should not edit or send messages")
+	}
+}
+
+func TestExpiredDeprecatedAliasNotRegistered(t *testing.T) {
+	store := &messageStore{texts: make(map[int]string)}
+	parser, registry := newDeprecationParser(t, store)
+
+	// 达到移除版本后启动时不再注册别名
+	version.Version = "v1.4.0"
+	restarted := newTestParser()
+	restarted.SetDeprecations(registry)
+	restarted.RegisterCommand("speedtest", "测速", "speedtest", respondWith("🚀 done"))
+	restarted.RegisterDeprecatedAlias("st", "speedtest")
+	if _, ok := restarted.GetCommand("st"); ok {
+		t.Error("expired alias should not be registered")
+	}
+	if _, ok := parser.GetCommand("st"); !ok {
+		t.Error("alias registered before expiry should still resolve")
+	}
+}
@@ -0,0 +1,32 @@
+package command
+
+import "sort"
+
+// RegisterLongHelp 注册插件的详细帮助，由 .help <插件名> 显示。
+// 插件的命令被移除(如重新加载插件)时一并移除
+func (p *Parser) RegisterLongHelp(plugin, text string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.longHelp[plugin] = text
+}
+
+// LongHelp 返回插件注册的详细帮助
+func (p *Parser) LongHelp(plugin string) (string, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	text, ok := p.longHelp[plugin]
+	return text, ok
+}
+
+// CommandList 按注册顺序返回所有已注册的命令
+func (p *Parser) CommandList() []*Command {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	result := make([]*Command, 0, len(p.commands))
+	for _, command := range p.commands {
+		result = append(result, command)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].seq < result[j].seq })
+	return result
+}
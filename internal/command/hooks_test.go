@@ -0,0 +1,157 @@
+package command
+
+import (
+	"errors"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBeforeCommandVeto(t *testing.T) {
+	parser := newTestParser()
+	ran := false
+	parser.RegisterCommand("ping", "pong", "core", func(ctx *CommandContext) error {
+		ran = true
+		return nil
+	})
+	parser.hookManager.RegisterHook(core.BeforeCommand, "deny", func(hc *core.HookContext) error {
+		if hc.Data["command"] == "ping" && hc.Data["plugin"] == "core" {
+			return core.Veto("不允许")
+		}
+		return nil
+	}, 0)
+	afterRan := false
+	parser.hookManager.RegisterHook(core.AfterCommand, "after", func(*core.HookContext) error {
+		afterRan = true
+		return nil
+	}, 0)
+
+	_, err := parser.RunCaptured(newTestContext(nil), "ping")
+	veto, ok := core.AsVeto(err)
+	if !ok || veto.Hook != "deny" || veto.Reason != "不允许" {
+		t.Fatalf("RunCaptured = %v, want veto from deny", err)
+	}
+	if ran || afterRan {
+		t.Errorf("vetoed command ran = %v, AfterCommand ran = %v", ran, afterRan)
+	}
+}
+
+func TestBeforeCommandError(t *testing.T) {
+	parser := newTestParser()
+	ran := false
+	parser.RegisterCommand("ping", "pong", "core", func(*CommandContext) error {
+		ran = true
+		return nil
+	})
+	failure := errors.New("hook failed")
+	parser.hookManager.RegisterHook(core.BeforeCommand, "broken", func(*core.HookContext) error { return failure }, 0)
+
+	if _, err := parser.RunCaptured(newTestContext(nil), "ping"); !errors.Is(err, failure) {
+		t.Fatalf("RunCaptured = %v, want hook error", err)
+	}
+	if ran {
+		t.Error("command ran after BeforeCommand failed")
+	}
+}
+
+func TestBeforeCommandRewritesArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		rewrite    func([]string) []string
+		wantArgs   []string
+		wantString string
+	}{
+		{"unchanged keeps raw args", func(a []string) []string { return a }, []string{"a", "b c"}, `a "b c"`},
+		{"replaced", func(a []string) []string { return append([]string{"x"}, a...) }, []string{"x", "a", "b c"}, "x a b c"},
+		{"cleared", func([]string) []string { return []string{} }, []string{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := newTestParser()
+			var gotArgs []string
+			var gotString string
+			parser.RegisterCommand("echo", "echo", "core", func(ctx *CommandContext) error {
+				gotArgs, gotString = ctx.Args, ctx.ArgsString()
+				_, err := ctx.Respond("ok", format.Plain)
+				return err
+			})
+			parser.hookManager.RegisterHook(core.BeforeCommand, "rewrite", func(hc *core.HookContext) error {
+				args, _ := hc.Get("args")
+				hc.Set("args", tt.rewrite(args.([]string)))
+				return nil
+			}, 0)
+
+			if _, err := parser.RunCaptured(newTestContext(nil), `echo a "b c"`); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) || gotString != tt.wantString {
+				t.Errorf("Args = %q, ArgsString = %q; want %q, %q", gotArgs, gotString, tt.wantArgs, tt.wantString)
+			}
+		})
+	}
+}
+
+func TestAfterCommandSeesResult(t *testing.T) {
+	parser := newTestParser()
+	failure := errors.New("command failed")
+	parser.RegisterCommand("fail", "fails", "demo", func(*CommandContext) error { return failure })
+	parser.RegisterCommand("ok", "succeeds", "demo", respondWith("done"))
+
+	var data map[string]interface{}
+	parser.hookManager.RegisterHook(core.BeforeCommand, "mark", func(hc *core.HookContext) error {
+		hc.Set("marked", true)
+		return nil
+	}, 0)
+	parser.hookManager.RegisterHook(core.AfterCommand, "observe", func(hc *core.HookContext) error {
+		data = hc.Data
+		return errors.New("after hook errors are only logged")
+	}, 0)
+
+	msgEvent := &core.MessageEvent{ChatID: -1001234, UserID: 9}
+	if _, err := parser.RunCaptured(newTestContext(msgEvent), "fail x"); !errors.Is(err, failure) {
+		t.Fatalf("RunCaptured(fail) = %v, want command error", err)
+	}
+	if data["error"] != failure || data["command"] != "fail" || data["plugin"] != "demo" {
+		t.Errorf("AfterCommand data = %v", data)
+	}
+	if data["chat_id"] != int64(-1001234) || data["user_id"] != int64(9) || data["marked"] != true {
+		t.Errorf("AfterCommand should extend BeforeCommand data, got %v", data)
+	}
+	if _, ok := data["duration"].(time.Duration); !ok {
+		t.Errorf("duration = %#v", data["duration"])
+	}
+	if !reflect.DeepEqual(data["args"], []string{"x"}) {
+		t.Errorf("args = %v", data["args"])
+	}
+	if msg, ok := data["message"].(*core.MessageEvent); !ok || !strings.HasSuffix(msg.Text, "fail x") {
+		t.Errorf("message = %#v", data["message"])
+	}
+
+	out, err := parser.RunCaptured(newTestContext(nil), "ok")
+	if err != nil || out.Text != "done" {
+		t.Fatalf("RunCaptured(ok) = %+v, %v", out, err)
+	}
+	if data["error"] != nil {
+		t.Errorf("error = %v, want nil", data["error"])
+	}
+}
+
+func TestCommandPanicReachesAfterCommand(t *testing.T) {
+	parser := newTestParser()
+	parser.RegisterCommand("boom", "panics", "demo", func(*CommandContext) error { panic("bad") })
+	var afterErr interface{}
+	parser.hookManager.RegisterHook(core.AfterCommand, "observe", func(hc *core.HookContext) error {
+		afterErr = hc.Data["error"]
+		return nil
+	}, 0)
+
+	if _, err := parser.RunCaptured(newTestContext(nil), "boom"); err == nil {
+		t.Fatal("panicking command should return an error")
+	}
+	if afterErr == nil {
+		t.Error("AfterCommand should see the recovered panic as error")
+	}
+}
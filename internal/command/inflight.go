@@ -0,0 +1,104 @@
+package command
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// inflight 记录正在执行的命令处理函数和它们启动的后台任务，关闭时等待它们结束
+type inflight struct {
+	mutex    sync.Mutex
+	count    int
+	draining bool
+	idle     chan struct{} // 关闭期间计数归零时关闭
+	shutdown chan struct{} // 开始关闭时关闭
+}
+
+// newInflight 创建执行记录
+func newInflight() *inflight {
+	return &inflight{shutdown: make(chan struct{})}
+}
+
+// add 登记一个执行单元。开始关闭后不再接受新的命令(background为false)，
+// 已在执行的命令启动的后台任务仍可登记
+func (f *inflight) add(background bool) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.draining && !background {
+		return false
+	}
+	f.count++
+	return true
+}
+
+// done 结束一个执行单元
+func (f *inflight) done() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.count--
+	if f.count == 0 && f.idle != nil {
+		close(f.idle)
+		f.idle = nil
+	}
+}
+
+// drain 开始关闭并等待所有执行单元结束，ctx结束时返回仍在执行的数量
+func (f *inflight) drain(ctx context.Context) int {
+	f.mutex.Lock()
+	if !f.draining {
+		f.draining = true
+		close(f.shutdown)
+	}
+	if f.count == 0 {
+		f.mutex.Unlock()
+		return 0
+	}
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+	}
+	idle := f.idle
+	f.mutex.Unlock()
+
+	select {
+	case <-idle:
+		return 0
+	case <-ctx.Done():
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		return f.count
+	}
+}
+
+// Drain 停止接受新命令，并等待正在执行的命令和通过 CommandContext.Go 启动的后台任务结束。
+// 通过 CommandContext.Delay 等待的延迟操作会立即执行。ctx结束时返回仍未结束的数量
+func (p *Parser) Drain(ctx context.Context) int {
+	return p.inflight.drain(ctx)
+}
+
+// Go 在后台执行fn，程序关闭时会等待它结束。命令返回后仍需执行的操作(如延迟删除消息)应使用它启动
+func (c *CommandContext) Go(fn func()) {
+	if c.inflight == nil {
+		go fn()
+		return
+	}
+	c.inflight.add(true)
+	go func() {
+		defer c.inflight.done()
+		fn()
+	}()
+}
+
+// Delay 等待d，程序开始关闭时立即返回，使延迟操作在关闭前执行完
+func (c *CommandContext) Delay(d time.Duration) {
+	var shutdown <-chan struct{}
+	if c.inflight != nil {
+		shutdown = c.inflight.shutdown
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-shutdown:
+	}
+}
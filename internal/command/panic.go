@@ -0,0 +1,20 @@
+package command
+
+import "nexusvalet/internal/core"
+
+// crashNotice 命令处理函数panic后编辑到命令消息中的提示
+const crashNotice = "💥 命令崩溃，详情请查看日志"
+
+// SetPanicHandler 设置命令处理函数panic后调用的处理函数
+func (p *Parser) SetPanicHandler(handler core.PanicHandler) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.onPanic = handler
+}
+
+// panicHandler 返回当前的panic处理函数，可能为nil
+func (p *Parser) panicHandler() core.PanicHandler {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.onPanic
+}
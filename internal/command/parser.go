@@ -4,12 +4,20 @@ import (
 	"context"
 	"fmt"
 
+	"nexusvalet/internal/chatscope"
 	"nexusvalet/internal/core"
+	"nexusvalet/internal/deletion"
+	"nexusvalet/internal/deprecation"
+	"nexusvalet/internal/errctx"
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/metrics"
 	"nexusvalet/internal/peers"
 	"nexusvalet/internal/session"
 	"nexusvalet/pkg/logger"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gotd/td/telegram/downloader"
 	"github.com/gotd/td/tg"
@@ -30,8 +38,14 @@ type Command struct {
 	Description string
 	Handler     CommandHandler
 	Plugin      string
+	OwnerOnly   bool // 只有所有者可以执行，sudo用户发送时拒绝
+
+	seq int // 注册顺序，重新注册同名命令时保持不变
 }
 
+// ownerOnlyReason sudo用户执行只限所有者的命令时的提示
+const ownerOnlyReason = "该命令只有账号所有者可以使用，sudo 用户不能执行"
+
 // CommandHandler 是处理命令执行的函数
 type CommandHandler func(*CommandContext) error
 
@@ -46,37 +60,57 @@ type CommandContext struct {
 	PeerResolver *peers.Resolver // 添加peer resolver用于解析聊天ID
 	DownloadFile func(document *tg.Document) ([]byte, error)
 	GetDocument  func() (*tg.Document, error)
+	Flood        *flood.Limiter // 发送频率限制，使用 SendMessage/EditMessage 等方法时生效
+	Prefix       string         // 触发本次命令的前缀
+
+	inflight   *inflight
+	plugin     string // 命令所属插件
+	deletions  *deletion.Scheduler
+	args       *commandArgs
+	argsParsed bool     // Args 由 args 生成，没有被钩子替换
+	capture    *capture // 不为nil时为捕获模式，Respond 的内容写入这里而不发送
 }
 
 // Parser 处理命令解析和执行
 type Parser struct {
 	commands     map[string]*Command
-	prefix       string
+	prefixes     []string // 按配置顺序，第一个为主前缀
+	matchOrder   []string // 按长度从长到短，匹配时使用
 	mutex        sync.RWMutex
 	dispatcher   *core.EventDispatcher
 	hookManager  *core.HookManager
 	sessionMgr   *session.Manager
 	telegramAPI  *tg.Client
 	peerResolver *peers.Resolver
+	aliases      map[string]string // 已弃用的命令名 -> 新命令名
+	deprecations *deprecation.Registry
+	flood        *flood.Limiter
+	deletions    *deletion.Scheduler
+	chatScope    *chatscope.Registry
+	inflight     *inflight
+	metrics      *metrics.Collector
+	onPanic      core.PanicHandler
+
+	seq      int               // 已注册的命令数，用于保持注册顺序
+	longHelp map[string]string // 插件名 -> 详细帮助
 }
 
-// NewParser 创建一个新的命令解析器
-func NewParser(prefix string, dispatcher *core.EventDispatcher, hookManager *core.HookManager) *Parser {
+// NewParser 创建一个新的命令解析器，可以传入多个前缀，第一个为主前缀
+func NewParser(prefix string, dispatcher *core.EventDispatcher, hookManager *core.HookManager, extraPrefixes ...string) *Parser {
 	parser := &Parser{
 		commands:    make(map[string]*Command),
-		prefix:      prefix,
+		longHelp:    make(map[string]string),
+		aliases:     make(map[string]string),
 		dispatcher:  dispatcher,
 		hookManager: hookManager,
+		inflight:    newInflight(),
 	}
+	parser.prefixes, parser.matchOrder = normalizePrefixes(append([]string{prefix}, extraPrefixes...))
 
-	// 将解析器注册为消息监听器 - 只处理发出消息（userbot 模式）
-	filter := core.ListenerFilter{
-		Outgoing: true,
-		Incoming: false,
-	}
-	dispatcher.RegisterPrefixListenerWithFilter("command_parser", prefix, parser.handleMessage, 100, filter)
+	// 将解析器注册为消息监听器 - 只处理自己和sudo用户的消息
+	parser.registerListener(parser.prefixes)
 
-	logger.Infof("Command parser initialized with prefix: %s", prefix)
+	logger.Infof("Command parser initialized with prefixes: %s", strings.Join(parser.prefixes, " "))
 	return parser
 }
 
@@ -91,6 +125,11 @@ func (p *Parser) SetTelegramAPI(api *tg.Client, peerResolver *peers.Resolver) {
 	p.peerResolver = peerResolver
 }
 
+// SetMetrics 设置指标收集器，为空时不记录命令耗时
+func (p *Parser) SetMetrics(collector *metrics.Collector) {
+	p.metrics = collector
+}
+
 // GetTelegramAPI 返回 Telegram API 客户端实例
 func (p *Parser) GetTelegramAPI() *tg.Client {
 	return p.telegramAPI
@@ -98,6 +137,17 @@ func (p *Parser) GetTelegramAPI() *tg.Client {
 
 // RegisterCommand 注册一个新命令
 func (p *Parser) RegisterCommand(name, description, plugin string, handler CommandHandler) {
+	p.register(name, description, plugin, handler, false)
+}
+
+// RegisterOwnerCommand 注册只有所有者(自己或机器人模式的管理员)可以执行的命令，
+// 用于停止程序、管理插件、读取日志等不应交给sudo用户的操作
+func (p *Parser) RegisterOwnerCommand(name, description, plugin string, handler CommandHandler) {
+	p.register(name, description, plugin, handler, true)
+}
+
+// register 注册命令，ownerOnly为true时sudo用户不能执行
+func (p *Parser) register(name, description, plugin string, handler CommandHandler, ownerOnly bool) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
@@ -106,6 +156,13 @@ func (p *Parser) RegisterCommand(name, description, plugin string, handler Comma
 		Description: description,
 		Handler:     handler,
 		Plugin:      plugin,
+		OwnerOnly:   ownerOnly,
+	}
+	if existing, ok := p.commands[name]; ok {
+		command.seq = existing.seq
+	} else {
+		p.seq++
+		command.seq = p.seq
 	}
 
 	p.commands[name] = command
@@ -134,6 +191,7 @@ func (p *Parser) UnregisterPluginCommands(plugin string) {
 			logger.Debugf("Unregistered command: %s from plugin: %s", name, plugin)
 		}
 	}
+	delete(p.longHelp, plugin)
 }
 
 // GetCommand 根据名称检索命令
@@ -142,6 +200,11 @@ func (p *Parser) GetCommand(name string) (*Command, bool) {
 	defer p.mutex.RUnlock()
 
 	command, exists := p.commands[name]
+	if !exists {
+		if target, ok := p.aliases[name]; ok {
+			command, exists = p.commands[target]
+		}
+	}
 	return command, exists
 }
 
@@ -178,25 +241,24 @@ func (p *Parser) handleMessage(ctx context.Context, event interface{}) error {
 		return nil
 	}
 
-	logger.Infof("Command parser received message: '%s'", msgEvent.Text)
+	log := logger.Ctx(ctx)
+	log.Infof("Command parser received message: '%s'", msgEvent.Text)
 
 	// 检查消息是否以命令前缀开始
-	if !strings.HasPrefix(msgEvent.Text, p.prefix) {
-		logger.Debugf("Message does not start with prefix '%s'", p.prefix)
+	prefix, ok := p.matchPrefix(msgEvent.Text)
+	if !ok {
+		log.Debugf("Message does not start with a command prefix")
 		return nil
 	}
 
-	logger.Infof("Processing command message: '%s'", msgEvent.Text)
+	log.Infof("Processing command message: '%s'", msgEvent.Text)
 
 	// 解析命令和参数
-	commandText := strings.TrimPrefix(msgEvent.Text, p.prefix)
-	parts := strings.Fields(commandText)
-	if len(parts) == 0 {
+	commandName, parsed := splitCommand(strings.TrimPrefix(msgEvent.Text, prefix))
+	if commandName == "" {
 		return nil
 	}
-
-	commandName := parts[0]
-	args := parts[1:]
+	args := parsed.plain()
 
 	// 创建命令事件
 	cmdEvent := &core.CommandEvent{
@@ -207,40 +269,83 @@ func (p *Parser) handleMessage(ctx context.Context, event interface{}) error {
 
 	// 首先分发给命令监听器
 	if err := p.dispatcher.DispatchCommand(ctx, cmdEvent); err != nil {
-		logger.Errorf("Failed to dispatch command event: %v", err)
+		log.Errorf("Failed to dispatch command event: %v", err)
 	}
 
 	// 如果命令存在则执行它
-	return p.executeCommand(ctx, commandName, args, msgEvent)
+	return p.executeCommand(ctx, prefix, commandName, parsed, msgEvent, nil)
 }
 
-// executeCommand executes a registered command
-func (p *Parser) executeCommand(ctx context.Context, commandName string, args []string, msgEvent *core.MessageEvent) error {
+// executeCommand executes a registered command. out 不为nil时以捕获模式执行，
+// 否决和命令错误作为返回值交给调用方，不编辑命令消息
+func (p *Parser) executeCommand(ctx context.Context, prefix, commandName string, parsed *commandArgs, msgEvent *core.MessageEvent, out *capture) error {
 	command, exists := p.GetCommand(commandName)
 	if !exists {
-		logger.Debugf("Unknown command: %s", commandName)
+		logger.Ctx(ctx).Debugf("Unknown command: %s", commandName)
 		return nil // Don't treat unknown commands as errors
 	}
+	if !p.inflight.add(false) {
+		logger.Ctx(ctx).Infof("Command %s ignored: shutting down", commandName)
+		return nil
+	}
+	defer p.inflight.done()
+	if p.disabledInChat(command.Plugin, msgEvent.ChatID) {
+		logger.Ctx(ctx).Debugf("Command %s ignored: plugin %s is disabled in chat %d", commandName, command.Plugin, msgEvent.ChatID)
+		return nil
+	}
+	p.dispatcher.Metrics().CommandInvoked(command.Plugin)
+
+	// 之后的日志和错误都带上命令名称
+	ctx = logger.WithCommand(ctx, commandName)
+	log := logger.Ctx(ctx)
+
+	if command.OwnerOnly && !msgEvent.IsOwner() {
+		log.Infof("Command %s rejected: owner only, sent by sudo user %d", commandName, msgEvent.UserID)
+		veto := &core.VetoError{Hook: "owner_only", Reason: ownerOnlyReason}
+		if out != nil {
+			return veto
+		}
+		p.replyVeto(ctx, msgEvent, veto)
+		return nil
+	}
 
 	// Execute BeforeCommand hooks
+	args := parsed.plain()
 	hookData := map[string]interface{}{
 		"command": commandName,
 		"args":    args,
 		"message": msgEvent,
 		"plugin":  command.Plugin,
+		"chat_id": msgEvent.ChatID,
+		"user_id": msgEvent.UserID,
 	}
 
 	if err := p.hookManager.ExecuteHooksWithContext(ctx, core.BeforeCommand, hookData); err != nil {
-		logger.Errorf("BeforeCommand hook failed: %v", err)
+		if veto, ok := core.AsVeto(err); ok {
+			log.Infof("Command %s vetoed by hook %s", commandName, veto.Hook)
+			if out != nil {
+				return veto
+			}
+			p.replyVeto(ctx, msgEvent, veto)
+			return nil
+		}
+		log.Errorf("BeforeCommand hook failed: %v", err)
 		return err
 	}
 
+	// 钩子可以替换命令参数
+	argsParsed := true
+	if hookArgs, ok := hookData["args"].([]string); ok && !slices.Equal(hookArgs, args) {
+		args = hookArgs
+		argsParsed = false
+	}
+
 	// Get or create session
 	var sessionCtx *session.SessionContext
 	if p.sessionMgr != nil {
 		sess, err := p.sessionMgr.GetSession(msgEvent.UserID, msgEvent.ChatID)
 		if err != nil {
-			logger.Errorf("Failed to get session: %v", err)
+			log.Errorf("Failed to get session: %v", err)
 		} else {
 			sessionCtx = session.NewSessionContext(sess, p.sessionMgr)
 		}
@@ -255,6 +360,14 @@ func (p *Parser) executeCommand(ctx context.Context, commandName string, args []
 		API:          p.telegramAPI,
 		Context:      ctx,
 		PeerResolver: p.peerResolver,
+		Flood:        p.floodLimiter(),
+		Prefix:       prefix,
+		inflight:     p.inflight,
+		plugin:       command.Plugin,
+		deletions:    p.deletionScheduler(),
+		args:         parsed,
+		argsParsed:   argsParsed,
+		capture:      out,
 		GetDocument: func() (*tg.Document, error) {
 			// First, check if the current message has media
 			if msgEvent.Message != nil && msgEvent.Message.Media != nil {
@@ -269,7 +382,7 @@ func (p *Parser) executeCommand(ctx context.Context, commandName string, args []
 			// If no media in current message, check if this message is replying to a message with media
 			if msgEvent.Message != nil && msgEvent.Message.ReplyTo != nil {
 				if replyToMsg, ok := msgEvent.Message.ReplyTo.(*tg.MessageReplyHeader); ok {
-					logger.Debugf("Message is replying to message ID %d, checking for media", replyToMsg.ReplyToMsgID)
+					log.Debugf("Message is replying to message ID %d, checking for media", replyToMsg.ReplyToMsgID)
 
 					// Try to get the replied message from Telegram API
 					if p.telegramAPI != nil {
@@ -278,7 +391,7 @@ func (p *Parser) executeCommand(ctx context.Context, commandName string, args []
 							&tg.InputMessageID{ID: replyToMsg.ReplyToMsgID},
 						})
 						if err != nil {
-							logger.Errorf("Failed to get replied message: %v", err)
+							log.Errorf("Failed to get replied message: %v", err)
 							return nil, fmt.Errorf("failed to get replied message: %w", err)
 						}
 
@@ -288,7 +401,7 @@ func (p *Parser) executeCommand(ctx context.Context, commandName string, args []
 								switch media := repliedMsg.Media.(type) {
 								case *tg.MessageMediaDocument:
 									if doc, ok := media.Document.(*tg.Document); ok {
-										logger.Debugf("Found document in replied message")
+										log.Debugf("Found document in replied message")
 										return doc, nil
 									}
 								}
@@ -298,7 +411,7 @@ func (p *Parser) executeCommand(ctx context.Context, commandName string, args []
 								switch media := repliedMsg.Media.(type) {
 								case *tg.MessageMediaDocument:
 									if doc, ok := media.Document.(*tg.Document); ok {
-										logger.Debugf("Found document in replied channel message")
+										log.Debugf("Found document in replied channel message")
 										return doc, nil
 									}
 								}
@@ -340,45 +453,109 @@ func (p *Parser) executeCommand(ctx context.Context, commandName string, args []
 
 	// Execute the command
 	var executeErr error
+	panicked := false
+	startedAt := time.Now()
 	func() {
 		defer func() {
-			if r := recover(); r != nil {
-				executeErr = fmt.Errorf("command panicked: %v", r)
-				logger.Errorf("Command %s panicked: %v", commandName, r)
+			if err := core.RecoverPanic(ctx, recover(), "command", commandName, command.Plugin, p.panicHandler()); err != nil {
+				executeErr, panicked = err, true
 			}
 		}()
 
 		executeErr = command.Handler(cmdCtx)
 	}()
 
+	duration := time.Since(startedAt)
+	p.metrics.CommandExecuted(commandName, duration)
+
 	// Execute AfterCommand hooks
+	hookData["duration"] = duration
 	hookData["error"] = executeErr
 	if err := p.hookManager.ExecuteHooksWithContext(ctx, core.AfterCommand, hookData); err != nil {
-		logger.Errorf("AfterCommand hook failed: %v", err)
+		log.Errorf("AfterCommand hook failed: %v", err)
 	}
 
 	if executeErr != nil {
-		logger.Errorf("Command %s failed: %v", commandName, executeErr)
-		return executeErr
+		log.Errorf("Command %s failed: %v", commandName, executeErr)
+		if out != nil {
+			return executeErr
+		}
+		if panicked {
+			p.editCommandMessage(ctx, msgEvent, crashNotice)
+		} else if logger.IsDebug() {
+			p.replyError(ctx, msgEvent, executeErr)
+		}
+		return errctx.Wrap(ctx, executeErr)
 	}
 
-	logger.Debugf("Command %s executed successfully", commandName)
+	log.Debugf("Command %s executed successfully", commandName)
+	if out == nil {
+		p.noticeDeprecatedAlias(ctx, prefix, commandName, msgEvent)
+	}
 	return nil
 }
 
+// replyVeto 命令被钩子否决且给出原因时，将原因编辑到命令消息中
+func (p *Parser) replyVeto(ctx context.Context, msgEvent *core.MessageEvent, veto *core.VetoError) {
+	if veto.Reason == "" {
+		return
+	}
+	p.editCommandMessage(ctx, msgEvent, "⛔ "+veto.Reason)
+}
+
+// replyError DEBUG 日志级别下将命令返回的错误连同关联ID编辑到命令消息中，便于对照日志
+func (p *Parser) replyError(ctx context.Context, msgEvent *core.MessageEvent, err error) {
+	text := "❌ 命令执行失败: " + err.Error()
+	if f, ok := logger.FieldsFrom(ctx); ok && f.CorrelationID != "" {
+		text += "\n关联ID: " + f.CorrelationID
+	}
+	p.editCommandMessage(ctx, msgEvent, text)
+}
+
+// editCommandMessage 将文本编辑到命令消息中。sudo用户的命令消息不能编辑，改为回复该消息
+func (p *Parser) editCommandMessage(ctx context.Context, msgEvent *core.MessageEvent, text string) {
+	if p.telegramAPI == nil || p.peerResolver == nil || msgEvent.Message == nil {
+		return
+	}
+	log := logger.Ctx(ctx)
+	peer, err := p.peerResolver.ResolveFromChatID(ctx, msgEvent.ChatID)
+	if err != nil {
+		log.Errorf("Failed to resolve peer for command reply: %v", err)
+		return
+	}
+	if msgEvent.Sudo {
+		if _, err := p.telegramAPI.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+			Peer:     peer,
+			Message:  text,
+			RandomID: time.Now().UnixNano(),
+			ReplyTo:  &tg.InputReplyToMessage{ReplyToMsgID: msgEvent.Message.ID},
+		}); err != nil {
+			log.Errorf("Failed to reply to command message: %v", err)
+		}
+		return
+	}
+	if _, err := p.telegramAPI.MessagesEditMessage(ctx, &tg.MessagesEditMessageRequest{
+		Peer:    peer,
+		ID:      msgEvent.Message.ID,
+		Message: text,
+	}); err != nil {
+		log.Errorf("Failed to edit command message: %v", err)
+	}
+}
+
 // ParseCommand parses a command string into command name and arguments
 func (p *Parser) ParseCommand(text string) (string, []string, bool) {
-	if !strings.HasPrefix(text, p.prefix) {
+	prefix, ok := p.matchPrefix(text)
+	if !ok {
 		return "", nil, false
 	}
 
-	commandText := strings.TrimPrefix(text, p.prefix)
-	parts := strings.Fields(commandText)
-	if len(parts) == 0 {
+	commandName, parsed := splitCommand(strings.TrimPrefix(text, prefix))
+	if commandName == "" {
 		return "", nil, false
 	}
 
-	return parts[0], parts[1:], true
+	return commandName, parsed.plain(), true
 }
 
 // IsCommand checks if a text is a command
@@ -387,26 +564,14 @@ func (p *Parser) IsCommand(text string) bool {
 	return isCmd
 }
 
-// GetPrefix returns the command prefix
+// GetPrefix returns the primary command prefix
 func (p *Parser) GetPrefix() string {
-	return p.prefix
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.prefixes[0]
 }
 
-// SetPrefix sets the command prefix
+// SetPrefix sets a single command prefix, replacing all configured prefixes
 func (p *Parser) SetPrefix(prefix string) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
-
-	oldPrefix := p.prefix
-	p.prefix = prefix
-
-	// Unregister old listener and register new one
-	p.dispatcher.UnregisterListener(core.MessageListener, "command_parser")
-	filter := core.ListenerFilter{
-		Outgoing: true,
-		Incoming: false,
-	}
-	p.dispatcher.RegisterPrefixListenerWithFilter("command_parser", prefix, p.handleMessage, 100, filter)
-
-	logger.Debugf("Command prefix changed from %s to %s", oldPrefix, prefix)
+	p.SetPrefixes([]string{prefix})
 }
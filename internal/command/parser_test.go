@@ -0,0 +1,81 @@
+package command
+
+import (
+	"context"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+// newTestParser 创建不连接Telegram的解析器，命令通过 RunCaptured 在捕获模式下执行
+func newTestParser() *Parser {
+	return NewParser(".", core.NewEventDispatcher(), core.NewHookManager())
+}
+
+// newTestContext 创建外层命令的上下文，msgEvent 为nil时使用自己发送的消息
+func newTestContext(msgEvent *core.MessageEvent) *CommandContext {
+	if msgEvent == nil {
+		msgEvent = &core.MessageEvent{}
+	}
+	if msgEvent.Message == nil {
+		msgEvent.Message = &tg.Message{ID: 1}
+	}
+	if msgEvent.ChatID == 0 {
+		msgEvent.ChatID = -100
+	}
+	return &CommandContext{Context: context.Background(), Message: msgEvent, Prefix: "."}
+}
+
+// respondWith 返回把text作为响应的命令处理函数
+func respondWith(text string) CommandHandler {
+	return func(ctx *CommandContext) error {
+		_, err := ctx.Respond(text, format.Plain)
+		return err
+	}
+}
+
+func TestOwnerOnlyCommands(t *testing.T) {
+	parser := newTestParser()
+	parser.RegisterOwnerCommand("shutdown", "停止程序", "core", respondWith("stopping"))
+	parser.RegisterCommand("ping", "pong", "core", respondWith("pong"))
+
+	tests := []struct {
+		name     string
+		msgEvent *core.MessageEvent
+		command  string
+		want     string
+		vetoed   bool
+	}{
+		{"self runs owner command", &core.MessageEvent{}, "shutdown", "stopping", false},
+		{"sudo user is rejected", &core.MessageEvent{Sudo: true, UserID: 42}, "shutdown", "", true},
+		{"bot admin runs owner command", &core.MessageEvent{Sudo: true, Owner: true, UserID: 7}, "shutdown", "stopping", false},
+		{"sudo user runs normal command", &core.MessageEvent{Sudo: true, UserID: 42}, "ping", "pong", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := parser.RunCaptured(newTestContext(tt.msgEvent), tt.command)
+			if tt.vetoed {
+				veto, ok := core.AsVeto(err)
+				if !ok || veto.Reason != ownerOnlyReason {
+					t.Fatalf("RunCaptured(%s) = %v, %v; want owner-only veto", tt.command, out, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunCaptured(%s) error: %v", tt.command, err)
+			}
+			if out == nil || out.Text != tt.want {
+				t.Fatalf("RunCaptured(%s) = %+v, want %q", tt.command, out, tt.want)
+			}
+		})
+	}
+
+	if cmd, _ := parser.GetCommand("shutdown"); !cmd.OwnerOnly {
+		t.Error("RegisterOwnerCommand should mark the command OwnerOnly")
+	}
+	if cmd, _ := parser.GetCommand("ping"); cmd.OwnerOnly {
+		t.Error("RegisterCommand should not mark the command OwnerOnly")
+	}
+}
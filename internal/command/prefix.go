@@ -0,0 +1,78 @@
+package command
+
+import (
+	"nexusvalet/internal/core"
+	"nexusvalet/pkg/logger"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// normalizePrefixes 去掉空前缀和重复前缀，返回按配置顺序和按长度从长到短排列的两份列表。
+// 一个前缀是另一个前缀的开头时(如 "." 和 "..")，较长的前缀优先匹配
+func normalizePrefixes(prefixes []string) (ordered, matchOrder []string) {
+	seen := make(map[string]bool)
+	for _, prefix := range prefixes {
+		if prefix == "" || seen[prefix] {
+			continue
+		}
+		seen[prefix] = true
+		ordered = append(ordered, prefix)
+	}
+	if len(ordered) == 0 {
+		ordered = []string{"."}
+	}
+
+	matchOrder = append([]string(nil), ordered...)
+	sort.SliceStable(matchOrder, func(i, j int) bool { return len(matchOrder[i]) > len(matchOrder[j]) })
+	return ordered, matchOrder
+}
+
+// matchPrefix 返回text开头最长的命令前缀
+func (p *Parser) matchPrefix(text string) (string, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	for _, prefix := range p.matchOrder {
+		if strings.HasPrefix(text, prefix) {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+// GetPrefixes 返回所有命令前缀，第一个为主前缀
+func (p *Parser) GetPrefixes() []string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return append([]string(nil), p.prefixes...)
+}
+
+// SetPrefixes 替换命令前缀。可以在处理命令的同时调用，之后收到的消息按新前缀解析
+func (p *Parser) SetPrefixes(prefixes []string) {
+	ordered, matchOrder := normalizePrefixes(prefixes)
+
+	p.mutex.Lock()
+	old := p.prefixes
+	p.prefixes = ordered
+	p.matchOrder = matchOrder
+	p.mutex.Unlock()
+
+	// Unregister old listener and register new one
+	p.dispatcher.UnregisterListener(core.MessageListener, "command_parser")
+	p.registerListener(matchOrder)
+
+	logger.Debugf("Command prefixes changed from %s to %s", strings.Join(old, " "), strings.Join(ordered, " "))
+}
+
+// registerListener 注册匹配任一前缀的消息监听器，只处理自己和sudo用户的消息。
+// 使用一个监听器而不是每个前缀一个，同一条消息只会被处理一次
+func (p *Parser) registerListener(prefixes []string) {
+	quoted := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		quoted[i] = regexp.QuoteMeta(prefix)
+	}
+	filter := core.ListenerFilter{SudoOnly: true}
+	if err := p.dispatcher.RegisterMessageListenerWithFilter("command_parser", "^(?:"+strings.Join(quoted, "|")+")", p.handleMessage, 100, filter); err != nil {
+		logger.Errorf("Failed to register command listener: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/deletion"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// SetDeletionScheduler 设置延迟删除服务，RespondEphemeral 用它安排删除，重启后仍会执行
+func (p *Parser) SetDeletionScheduler(scheduler *deletion.Scheduler) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.deletions = scheduler
+}
+
+// deletionScheduler 返回延迟删除服务
+func (p *Parser) deletionScheduler() *deletion.Scheduler {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.deletions
+}
+
+// Respond 把命令消息编辑为text，text按mode解析格式标记。编辑失败(如命令消息不可编辑)时回复命令消息，
+// sudo用户的命令消息不能编辑，直接回复该消息。
+// 超过单条消息长度时按换行拆分，第一段显示在命令消息中，其余各段依次回复上一段发送。
+// 返回显示第一段的消息ID，之后可以用它继续编辑响应。
+// 捕获模式(见 Parser.RunCaptured)下不发送，只记录内容，返回0
+func (c *CommandContext) Respond(text string, mode format.Mode) (int, error) {
+	ids, err := c.respond(text, mode, false)
+	if len(ids) == 0 {
+		return 0, err
+	}
+	return ids[0], err
+}
+
+// RespondNoPreview 与 Respond 相同，但不为文本中的链接生成网页预览
+func (c *CommandContext) RespondNoPreview(text string, mode format.Mode) (int, error) {
+	ids, err := c.respond(text, mode, true)
+	if len(ids) == 0 {
+		return 0, err
+	}
+	return ids[0], err
+}
+
+// RespondEphemeral 与 Respond 相同，并在ttl后删除响应的所有消息
+func (c *CommandContext) RespondEphemeral(text string, mode format.Mode, ttl time.Duration) (int, error) {
+	ids, err := c.respond(text, mode, false)
+	if len(ids) > 0 {
+		c.deleteAfter(ids, ttl)
+	}
+	if len(ids) == 0 {
+		return 0, err
+	}
+	return ids[0], err
+}
+
+// respond 发送响应，返回显示响应的各条消息ID。失败时返回已发送的部分。
+// noWebpage 为true时不生成链接预览
+func (c *CommandContext) respond(text string, mode format.Mode, noWebpage bool) ([]int, error) {
+	if c.capture != nil {
+		c.capture.set(format.Parse(mode, text))
+		return nil, nil
+	}
+
+	peer, err := c.PeerResolver.ResolveFromChatID(c.Context, c.Message.ChatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve peer: %w", err)
+	}
+
+	plain, entities := format.Parse(mode, text)
+	chunks := format.Split(plain, entities, format.MaxMessageLength)
+
+	// sudo用户的命令从第一段开始都作为回复发送
+	var ids []int
+	last := c.Message.Message.ID
+	replies := chunks
+	if !c.Message.Sudo {
+		_, err = c.EditMessage(&tg.MessagesEditMessageRequest{
+			Peer:      peer,
+			ID:        last,
+			Message:   chunks[0].Text,
+			Entities:  chunks[0].Entities,
+			NoWebpage: noWebpage,
+		})
+		if err == nil {
+			ids = append(ids, last)
+			replies = chunks[1:]
+		}
+	}
+
+	for _, chunk := range replies {
+		req := &tg.MessagesSendMessageRequest{
+			Peer:      peer,
+			Message:   chunk.Text,
+			Entities:  chunk.Entities,
+			RandomID:  time.Now().UnixNano(),
+			NoWebpage: noWebpage,
+		}
+		if last != 0 {
+			req.ReplyTo = &tg.InputReplyToMessage{ReplyToMsgID: last}
+		}
+		updates, err := c.SendMessage(req)
+		if err != nil {
+			return ids, err
+		}
+		last = SentMessageID(updates)
+		if last != 0 {
+			ids = append(ids, last)
+		}
+	}
+	return ids, nil
+}
+
+// deleteAfter 安排在d后删除当前对话中的消息。优先使用延迟删除服务，
+// 服务不可用时在后台等待后删除
+func (c *CommandContext) deleteAfter(ids []int, d time.Duration) {
+	if c.deletions != nil {
+		err := c.deletions.Schedule(c.Message.ChatID, ids, time.Now().Add(d), c.plugin)
+		if err == nil {
+			return
+		}
+		logger.Ctx(c.Context).Warnf("Failed to schedule deletion of messages %v: %v", ids, err)
+	}
+
+	c.Go(func() {
+		c.Delay(d)
+		// 使用独立的超时上下文，避免命令上下文被取消导致删除失败
+		deleteCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		dc := *c
+		dc.Context = deleteCtx
+		peer, err := dc.PeerResolver.ResolveFromChatID(deleteCtx, c.Message.ChatID)
+		if err == nil {
+			err = dc.DeleteMessages(peer, ids)
+		}
+		if err != nil {
+			logger.Ctx(c.Context).Warnf("Failed to delete messages %v: %v", ids, err)
+		}
+	})
+}
+
+// SentMessageID 从发送消息的返回中取出新消息的ID，取不到时返回0
+func SentMessageID(updates tg.UpdatesClass) int {
+	switch u := updates.(type) {
+	case *tg.UpdateShortSentMessage:
+		return u.ID
+	case *tg.Updates:
+		for _, update := range u.Updates {
+			switch upd := update.(type) {
+			case *tg.UpdateMessageID:
+				return upd.ID
+			case *tg.UpdateNewMessage:
+				return upd.Message.GetID()
+			case *tg.UpdateNewChannelMessage:
+				return upd.Message.GetID()
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,189 @@
+package command
+
+import (
+	"context"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// recordingInvoker 记录编辑和发送请求的 tg.Invoker。editErr 不为nil时编辑失败，
+// 发送的消息ID从 nextID 开始递增
+type recordingInvoker struct {
+	mu      sync.Mutex
+	edits   []*tg.MessagesEditMessageRequest
+	sends   []*tg.MessagesSendMessageRequest
+	editErr error
+	nextID  int
+}
+
+func (r *recordingInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	box := output.(*tg.UpdatesBox)
+	switch req := input.(type) {
+	case *tg.MessagesEditMessageRequest:
+		r.edits = append(r.edits, req)
+		if r.editErr != nil {
+			return r.editErr
+		}
+		box.Updates = &tg.Updates{}
+	case *tg.MessagesSendMessageRequest:
+		r.sends = append(r.sends, req)
+		r.nextID++
+		box.Updates = &tg.UpdateShortSentMessage{ID: r.nextID}
+	}
+	return nil
+}
+
+// channelPeers 把所有对话解析为频道
+type channelPeers struct{}
+
+func (channelPeers) GetInputPeer(_ context.Context, peerID int64) (tg.InputPeerClass, error) {
+	return &tg.InputPeerChannel{ChannelID: -peerID - 1000000000000, AccessHash: 1}, nil
+}
+
+func (channelPeers) GetUserPeerWithFallback(_ context.Context, userID int64, _ tg.InputChannelClass) (*tg.InputPeerUser, error) {
+	return &tg.InputPeerUser{UserID: userID}, nil
+}
+
+func (channelPeers) GetUserPeerFromMessage(_ context.Context, _ tg.InputPeerClass, _ int, userID int64) (*tg.InputPeerUser, error) {
+	return &tg.InputPeerUser{UserID: userID}, nil
+}
+
+// newRespondContext 创建频道中ID为100的命令消息的上下文
+func newRespondContext(inv *recordingInvoker, sudo bool) *CommandContext {
+	if inv.nextID == 0 {
+		inv.nextID = 200
+	}
+	return &CommandContext{
+		Context:      context.Background(),
+		API:          tg.NewClient(inv),
+		PeerResolver: peers.NewResolver(channelPeers{}),
+		Message: &core.MessageEvent{
+			Message: &tg.Message{ID: 100},
+			ChatID:  -1000000000123,
+			Sudo:    sudo,
+		},
+	}
+}
+
+func replyToID(t *testing.T, req *tg.MessagesSendMessageRequest) int {
+	t.Helper()
+	reply, ok := req.ReplyTo.(*tg.InputReplyToMessage)
+	if !ok {
+		t.Fatalf("send %q has no ReplyTo", req.Message)
+	}
+	return reply.ReplyToMsgID
+}
+
+func TestRespondEditsCommandMessage(t *testing.T) {
+	inv := &recordingInvoker{}
+	id, err := newRespondContext(inv, false).Respond("done", format.Plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 100 || len(inv.edits) != 1 || len(inv.sends) != 0 {
+		t.Fatalf("id = %d, %d edits, %d sends; want the command message edited", id, len(inv.edits), len(inv.sends))
+	}
+	if inv.edits[0].ID != 100 || inv.edits[0].Message != "done" {
+		t.Errorf("edit = %+v", inv.edits[0])
+	}
+}
+
+// 回归测试：命令消息已被删除，编辑失败后回复仍然指向命令消息，而不是发在群组底部
+func TestRespondFallbackRepliesToCommand(t *testing.T) {
+	inv := &recordingInvoker{editErr: tgerr.New(400, "MESSAGE_ID_INVALID")}
+	id, err := newRespondContext(inv, false).Respond("help text", format.Plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.edits) != 1 || len(inv.sends) != 1 {
+		t.Fatalf("%d edits, %d sends; want one failed edit and one send", len(inv.edits), len(inv.sends))
+	}
+	if got := replyToID(t, inv.sends[0]); got != 100 {
+		t.Errorf("fallback ReplyTo = %d, want the command message 100", got)
+	}
+	if _, ok := inv.sends[0].Peer.(*tg.InputPeerChannel); !ok {
+		t.Errorf("fallback peer = %T, want the channel", inv.sends[0].Peer)
+	}
+	if id != 201 {
+		t.Errorf("Respond returned %d, want the sent message 201", id)
+	}
+}
+
+func TestRespondSudoReplies(t *testing.T) {
+	inv := &recordingInvoker{}
+	if _, err := newRespondContext(inv, true).Respond("pong", format.Plain); err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.edits) != 0 {
+		t.Error("sudo user's message must not be edited")
+	}
+	if len(inv.sends) != 1 || replyToID(t, inv.sends[0]) != 100 {
+		t.Fatalf("sends = %+v, want one reply to 100", inv.sends)
+	}
+}
+
+func TestRespondChunksReplyChain(t *testing.T) {
+	text := strings.Repeat("a", format.MaxMessageLength) + "\n" + strings.Repeat("b", format.MaxMessageLength) + "\nc"
+	tests := []struct {
+		name      string
+		editErr   error
+		wantIDs   int // 返回的第一段ID
+		wantReply []int
+	}{
+		// 第一段编辑到命令消息中，之后每段回复上一段
+		{"edited first chunk", nil, 100, []int{100, 201}},
+		// 编辑失败时第一段也作为回复发送
+		{"failed edit", tgerr.New(400, "MESSAGE_ID_INVALID"), 201, []int{100, 201, 202}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := &recordingInvoker{editErr: tt.editErr}
+			id, err := newRespondContext(inv, false).RespondNoPreview(text, format.Plain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != tt.wantIDs {
+				t.Errorf("Respond returned %d, want %d", id, tt.wantIDs)
+			}
+			if len(inv.sends) != len(tt.wantReply) {
+				t.Fatalf("%d sends, want %d", len(inv.sends), len(tt.wantReply))
+			}
+			for i, want := range tt.wantReply {
+				if got := replyToID(t, inv.sends[i]); got != want {
+					t.Errorf("send %d ReplyTo = %d, want %d", i, got, want)
+				}
+				if !inv.sends[i].NoWebpage {
+					t.Errorf("send %d should keep NoWebpage", i)
+				}
+			}
+			if !inv.edits[0].NoWebpage {
+				t.Error("edit should keep NoWebpage")
+			}
+		})
+	}
+}
+
+func TestRespondCaptureDoesNotSend(t *testing.T) {
+	inv := &recordingInvoker{}
+	c := newRespondContext(inv, false)
+	c.capture = &capture{}
+	if id, err := c.Respond("**粗体**", format.Markdown); err != nil || id != 0 {
+		t.Fatalf("captured Respond = %d, %v", id, err)
+	}
+	if len(inv.edits)+len(inv.sends) != 0 {
+		t.Error("capture mode should not call Telegram")
+	}
+	if out := c.capture.get(); out == nil || out.Text != "粗体" || len(out.Entities) != 1 {
+		t.Errorf("captured output = %+v", out)
+	}
+}
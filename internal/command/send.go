@@ -0,0 +1,81 @@
+package command
+
+import (
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/format"
+
+	"github.com/gotd/td/tg"
+)
+
+// SetFloodLimiter 设置发送频率限制，命令上下文的发送方法会使用它
+func (p *Parser) SetFloodLimiter(limiter *flood.Limiter) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.flood = limiter
+}
+
+// floodLimiter 返回发送频率限制
+func (p *Parser) floodLimiter() *flood.Limiter {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.flood
+}
+
+// SendMessage 发送消息。遵守目标对话的发送频率限制，遇到FLOOD_WAIT时按返回的秒数等待后重试。
+// 捕获模式下回复命令消息的内容被捕获而不发送
+func (c *CommandContext) SendMessage(req *tg.MessagesSendMessageRequest) (tg.UpdatesClass, error) {
+	if reply, ok := req.ReplyTo.(*tg.InputReplyToMessage); ok && c.capturesMessage(req.Peer, reply.ReplyToMsgID) {
+		c.capture.set(req.Message, req.Entities)
+		return &tg.Updates{}, nil
+	}
+	return flood.Call(c.Context, c.Flood, flood.PeerChatID(req.Peer), func() (tg.UpdatesClass, error) {
+		return c.API.MessagesSendMessage(c.Context, req)
+	})
+}
+
+// EditMessage 编辑消息，与 SendMessage 共用发送频率限制。捕获模式下编辑命令消息的内容被捕获而不发送
+func (c *CommandContext) EditMessage(req *tg.MessagesEditMessageRequest) (tg.UpdatesClass, error) {
+	if c.capturesMessage(req.Peer, req.ID) {
+		c.capture.set(req.Message, req.Entities)
+		return &tg.Updates{}, nil
+	}
+	return flood.Call(c.Context, c.Flood, flood.PeerChatID(req.Peer), func() (tg.UpdatesClass, error) {
+		return c.API.MessagesEditMessage(c.Context, req)
+	})
+}
+
+// SendFormatted 按mode解析req.Message中的格式标记，以消息实体发送
+func (c *CommandContext) SendFormatted(req *tg.MessagesSendMessageRequest, mode format.Mode) (tg.UpdatesClass, error) {
+	req.Message, req.Entities = format.Parse(mode, req.Message)
+	return c.SendMessage(req)
+}
+
+// EditFormatted 按mode解析req.Message中的格式标记，以消息实体编辑
+func (c *CommandContext) EditFormatted(req *tg.MessagesEditMessageRequest, mode format.Mode) (tg.UpdatesClass, error) {
+	req.Message, req.Entities = format.Parse(mode, req.Message)
+	return c.EditMessage(req)
+}
+
+// DeleteMessages 删除对话中的消息，频道/超级群使用 ChannelsDeleteMessages。
+// 删除不计入发送频率，只在FLOOD_WAIT后等待重试
+func (c *CommandContext) DeleteMessages(peer tg.InputPeerClass, ids []int) error {
+	del := func() error {
+		var err error
+		if channel, ok := peer.(*tg.InputPeerChannel); ok {
+			_, err = c.API.ChannelsDeleteMessages(c.Context, &tg.ChannelsDeleteMessagesRequest{
+				Channel: &tg.InputChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash},
+				ID:      ids,
+			})
+		} else {
+			_, err = c.API.MessagesDeleteMessages(c.Context, &tg.MessagesDeleteMessagesRequest{
+				ID:     ids,
+				Revoke: true,
+			})
+		}
+		return err
+	}
+	if c.Flood == nil {
+		return del()
+	}
+	return c.Flood.Retry(c.Context, flood.PeerChatID(peer), del)
+}
@@ -3,8 +3,11 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"nexusvalet/pkg/logger"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 // Config 代表应用程序配置
@@ -12,6 +15,19 @@ type Config struct {
 	Telegram TelegramConfig `json:"telegram"`
 	Bot      BotConfig      `json:"bot"`
 	Logger   LoggerConfig   `json:"logger"`
+	Apt      AptConfig      `json:"apt"`
+	Security SecurityConfig `json:"security"`
+	SelfTest SelfTestConfig `json:"selftest"`
+	Media    MediaConfig    `json:"media"`
+	Dme      DmeConfig      `json:"dme"`
+	Metrics  MetricsConfig  `json:"metrics"`
+
+	Deprecations DeprecationConfig `json:"deprecations"`
+	RateLimit    RateLimitConfig   `json:"rate_limit"`
+	Peers        PeersConfig       `json:"peers"`
+	Plugins      PluginsConfig     `json:"plugins"`
+
+	renamed []RenamedKey // 加载时使用了旧名称的配置项
 }
 
 // TelegramConfig 包含 Telegram API 配置
@@ -20,17 +36,149 @@ type TelegramConfig struct {
 	APIHash  string `json:"api_hash"`
 	Session  string `json:"session_file"`
 	Database string `json:"database_file"`
+	// BotToken 设置后以机器人账号登录，代替手机号验证
+	BotToken string `json:"bot_token,omitempty"`
+	// BotAdmins 机器人模式下可以执行命令的用户ID，sudo用户也可以
+	BotAdmins []int64 `json:"bot_admins,omitempty"`
+	// SessionString 其他设备导出的会话字符串，会话文件不存在时导入，代替登录
+	SessionString string `json:"session_string,omitempty"`
+	// LoginMethod 首次登录的方式：phone(默认，手机号验证码)或 qr(二维码)
+	LoginMethod string `json:"login_method,omitempty"`
+}
+
+// BotMode 是否以机器人账号运行
+func (c TelegramConfig) BotMode() bool {
+	return c.BotToken != ""
+}
+
+// SessionStringValue 返回要导入的会话字符串，环境变量 TELEGRAM_SESSION_STRING 优先于配置
+func (c TelegramConfig) SessionStringValue() string {
+	if value := os.Getenv("TELEGRAM_SESSION_STRING"); value != "" {
+		return value
+	}
+	return c.SessionString
 }
 
 // BotConfig 包含机器人特定配置
 type BotConfig struct {
-	CommandPrefix string `json:"command_prefix"`
-	PluginsDir    string `json:"plugins_dir"`
+	CommandPrefix string   `json:"command_prefix"`
+	Prefixes      []string `json:"command_prefixes,omitempty"` // 同时使用多个命令前缀，设置后代替 command_prefix
+	PluginsDir    string   `json:"plugins_dir"`
+	ShutdownGrace int      `json:"shutdown_grace"` // 关闭时等待正在执行的命令和延迟操作的秒数，0表示默认值
+}
+
+// CommandPrefixes 返回生效的命令前缀：设置了 command_prefixes 时使用该列表，否则为 command_prefix
+func (c BotConfig) CommandPrefixes() []string {
+	if len(c.Prefixes) > 0 {
+		return c.Prefixes
+	}
+	return []string{c.CommandPrefix}
+}
+
+// AptConfig 包含插件索引配置
+type AptConfig struct {
+	Indexes    []string `json:"indexes"`     // 插件索引URL
+	PublicKeys []string `json:"public_keys"` // 用于校验索引签名的 ed25519 公钥(base64)
+}
+
+// SecurityConfig 包含密钥库配置
+type SecurityConfig struct {
+	Passphrase string `json:"passphrase"` // 启动时自动解锁密钥库的口令，留空则需使用 .unlock
+}
+
+// SelfTestConfig 包含启动自检配置
+type SelfTestConfig struct {
+	Enabled bool `json:"enabled"` // 连接后执行一次自检并把结果发送到收藏夹
+}
+
+// MediaConfig 上传前的媒体压缩配置
+type MediaConfig struct {
+	Compress     string `json:"compress"`      // off|balanced|aggressive，默认off
+	JPEGQuality  int    `json:"jpeg_quality"`  // 覆盖级别默认的JPEG质量，0表示使用默认值
+	MaxDimension int    `json:"max_dimension"` // 覆盖级别默认的最大边长，0表示使用默认值
+	DownloadDir  string `json:"download_dir"`  // .dl 保存文件的目录，留空时为 downloads
+	TGSConverter string `json:"tgs_converter"` // .gs --gif 转换动画贴纸的命令，{input}/{output} 替换为文件路径
+}
+
+// DmeConfig 删除我的消息配置
+type DmeConfig struct {
+	StatusSeconds int `json:"status_seconds"` // 删除完成后结果的显示秒数，0表示默认值，负数表示不显示
+}
+
+// MetricsConfig Prometheus 指标导出配置
+type MetricsConfig struct {
+	Enabled bool   `json:"enabled"` // 启动 HTTP 服务并在 /metrics 导出指标，默认关闭
+	Addr    string `json:"addr"`    // 监听地址，留空时为 127.0.0.1:9464
 }
 
+// DeprecationConfig 弃用项配置
+type DeprecationConfig struct {
+	GraceVersions int `json:"grace_versions"` // 弃用的命令在移除前保留的次版本数，0表示默认值
+}
+
+// RateLimitConfig 发送频率限制配置
+type RateLimitConfig struct {
+	MessagesPerMinute int `json:"messages_per_minute"` // 每个对话每分钟最多发送/编辑的消息数，0表示默认值，负数表示不限制
+	MaxFloodWait      int `json:"max_flood_wait"`      // 自动等待的最长FLOOD_WAIT秒数，0表示默认值
+}
+
+// PeersConfig 用户与群组解析配置
+type PeersConfig struct {
+	MaxParticipantScan int `json:"max_participant_scan"` // 在群组成员中查找用户时最多遍历的成员数，0表示默认值
+}
+
+// PluginsConfig 内置插件的配置
+type PluginsConfig struct {
+	Speedtest SpeedtestConfig `json:"speedtest"`
+	Autosend  AutosendConfig  `json:"autosend"`
+	Export    ExportConfig    `json:"export"`
+	Purge     PurgeConfig     `json:"purge"`
+}
+
+// ExportConfig 导出聊天记录插件配置
+type ExportConfig struct {
+	MaxMessages int `json:"max_messages,omitempty"` // 一次最多导出的消息数，0 表示使用默认值 10000
+}
+
+// PurgeConfig .purgefrom 命令配置
+type PurgeConfig struct {
+	MaxMessages int `json:"max_messages,omitempty"` // 一次最多删除的消息数，0 表示使用默认值 1000
+}
+
+// AutosendConfig 定时发送插件配置
+type AutosendConfig struct {
+	Timezone string `json:"timezone,omitempty"` // 未指定时区的任务使用的IANA时区，如 Asia/Shanghai，留空时使用服务器时区
+}
+
+// SpeedtestConfig 网速测试插件配置
+type SpeedtestConfig struct {
+	Path   string `json:"path"`   // speedtest CLI 的路径，留空时为 /tmp/nexusvalet/speedtest
+	SHA256 string `json:"sha256"` // 下载的安装包应有的SHA-256，留空时使用内置的校验值
+}
+
+// RenamedKey 已改名的配置项，Old/New 为以点分隔的路径，例如 "bot.prefix"
+type RenamedKey struct {
+	Old string
+	New string
+}
+
+// renamedKeys 已改名的配置项。加载时旧路径的值会被移动到新路径，并记录弃用警告
+var renamedKeys = []RenamedKey{}
+
 // LoggerConfig 包含日志配置
 type LoggerConfig struct {
 	Level string `json:"level"`
+	// Modules 各模块单独的日志级别，如 {"autosend": "debug"}，未列出的模块使用 level
+	Modules map[string]string `json:"modules,omitempty"`
+}
+
+// ModuleLevels 返回解析后的各模块日志级别
+func (c LoggerConfig) ModuleLevels() map[string]logger.LogLevel {
+	levels := make(map[string]logger.LogLevel, len(c.Modules))
+	for name, level := range c.Modules {
+		levels[name] = logger.ParseLevel(level)
+	}
+	return levels
 }
 
 // DefaultConfig 返回默认配置
@@ -70,11 +218,21 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	// 将改名前的配置项映射到新名称
+	data, renamed, err := migrateRenamedKeys(data, renamedKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	for _, k := range renamed {
+		logger.Warnf("Config key %s is deprecated, use %s instead", k.Old, k.New)
+	}
+
 	// Parse JSON
 	var config Config
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	config.renamed = renamed
 
 	// Validate required fields
 	if err := config.Validate(); err != nil {
@@ -84,6 +242,99 @@ func LoadConfig(configPath string) (*Config, error) {
 	return &config, nil
 }
 
+// DeprecatedKeys 返回所有已改名的配置项
+func DeprecatedKeys() []RenamedKey {
+	return append([]RenamedKey(nil), renamedKeys...)
+}
+
+// RenamedKeys 返回加载时使用了旧名称的配置项
+func (c *Config) RenamedKeys() []RenamedKey {
+	return c.renamed
+}
+
+// migrateRenamedKeys 把旧路径的值移动到新路径，新路径已有值时以新路径为准。
+// 返回修改后的JSON和实际使用了的旧配置项
+func migrateRenamedKeys(data []byte, keys []RenamedKey) ([]byte, []RenamedKey, error) {
+	if len(keys) == 0 {
+		return data, nil, nil
+	}
+
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, nil, err
+	}
+
+	var used []RenamedKey
+	for _, k := range keys {
+		value, ok := lookupPath(root, k.Old)
+		if !ok {
+			continue
+		}
+		used = append(used, k)
+		if _, exists := lookupPath(root, k.New); !exists {
+			setPath(root, k.New, value)
+		}
+		deletePath(root, k.Old)
+	}
+	if len(used) == 0 {
+		return data, nil, nil
+	}
+
+	migrated, err := json.Marshal(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	return migrated, used, nil
+}
+
+// lookupPath 按点分隔的路径读取值
+func lookupPath(root map[string]interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	node := root
+	for i, part := range parts {
+		value, ok := node[part]
+		if !ok {
+			return nil, false
+		}
+		if i == len(parts)-1 {
+			return value, true
+		}
+		if node, ok = value.(map[string]interface{}); !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// setPath 按点分隔的路径写入值，缺少的中间对象会被创建
+func setPath(root map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	node := root
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := node[part].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			node[part] = child
+		}
+		node = child
+	}
+	node[parts[len(parts)-1]] = value
+}
+
+// deletePath 按点分隔的路径删除值
+func deletePath(root map[string]interface{}, path string) {
+	parts := strings.Split(path, ".")
+	node := root
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := node[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		node = child
+	}
+	delete(node, parts[len(parts)-1])
+}
+
 // SaveConfig saves configuration to the specified file
 func SaveConfig(configPath string, config *Config) error {
 	// Create directory if it doesn't exist
@@ -113,7 +364,28 @@ func (c *Config) Validate() error {
 	if c.Telegram.APIHash == "" {
 		return fmt.Errorf("telegram.api_hash is required")
 	}
-	if c.Bot.CommandPrefix == "" {
+	switch c.Telegram.LoginMethod {
+	case "", "phone", "qr":
+	default:
+		return fmt.Errorf("telegram.login_method must be phone or qr")
+	}
+	if tz := c.Plugins.Autosend.Timezone; tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return fmt.Errorf("plugins.autosend.timezone is invalid: %w", err)
+		}
+	}
+	if c.Plugins.Export.MaxMessages < 0 {
+		return fmt.Errorf("plugins.export.max_messages must not be negative")
+	}
+	if c.Plugins.Purge.MaxMessages < 0 {
+		return fmt.Errorf("plugins.purge.max_messages must not be negative")
+	}
+	for _, prefix := range c.Bot.Prefixes {
+		if prefix == "" {
+			return fmt.Errorf("bot.command_prefixes must not contain empty prefixes")
+		}
+	}
+	if c.Bot.CommandPrefix == "" && len(c.Bot.Prefixes) == 0 {
 		return fmt.Errorf("bot.command_prefix is required")
 	}
 	if c.Bot.PluginsDir == "" {
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"encoding/json"
+	"nexusvalet/pkg/logger"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeJSON 解析迁移后的JSON
+func decodeJSON(t *testing.T, data []byte) map[string]interface{} {
+	t.Helper()
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		t.Fatalf("migrated config is not valid JSON: %v\n%s", err, data)
+	}
+	return root
+}
+
+func TestMigrateRenamedKeys(t *testing.T) {
+	keys := []RenamedKey{
+		{Old: "bot.prefix", New: "bot.command_prefix"},
+		{Old: "response_ttl", New: "bot.response.ttl"},
+		{Old: "old.deep.value", New: "top"},
+	}
+	tests := []struct {
+		name string
+		in   string
+		want string
+		used []string
+	}{
+		{
+			"rename within object",
+			`{"bot":{"prefix":"!","plugins_dir":"p"}}`,
+			`{"bot":{"command_prefix":"!","plugins_dir":"p"}}`,
+			[]string{"bot.prefix"},
+		},
+		{
+			"new path wins",
+			`{"bot":{"prefix":"!","command_prefix":","}}`,
+			`{"bot":{"command_prefix":","}}`,
+			[]string{"bot.prefix"},
+		},
+		{
+			"creates missing objects",
+			`{"response_ttl":{"default":30}}`,
+			`{"bot":{"response":{"ttl":{"default":30}}}}`,
+			[]string{"response_ttl"},
+		},
+		{
+			"moves nested value to top level",
+			`{"old":{"deep":{"value":false,"other":1}}}`,
+			`{"old":{"deep":{"other":1}},"top":false}`,
+			[]string{"old.deep.value"},
+		},
+		{
+			"null value is moved",
+			`{"bot":{"prefix":null}}`,
+			`{"bot":{"command_prefix":null}}`,
+			[]string{"bot.prefix"},
+		},
+		{
+			"several keys",
+			`{"bot":{"prefix":"!"},"response_ttl":5}`,
+			`{"bot":{"command_prefix":"!","response":{"ttl":5}}}`,
+			[]string{"bot.prefix", "response_ttl"},
+		},
+		{
+			"parent is not an object",
+			`{"bot":"x","old":{"deep":3}}`,
+			`{"bot":"x","old":{"deep":3}}`,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, used, err := migrateRenamedKeys([]byte(tt.in), keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var usedOld []string
+			for _, k := range used {
+				usedOld = append(usedOld, k.Old)
+			}
+			if !reflect.DeepEqual(usedOld, tt.used) {
+				t.Errorf("used = %q, want %q", usedOld, tt.used)
+			}
+			if got, want := decodeJSON(t, out), decodeJSON(t, []byte(tt.want)); !reflect.DeepEqual(got, want) {
+				t.Errorf("migrated = %s, want %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateRenamedKeysUnchanged(t *testing.T) {
+	// 没有使用旧配置项时原样返回，保留原有格式
+	in := []byte("{\n  \"bot\": {\"command_prefix\": \",\"}\n}")
+	out, used, err := migrateRenamedKeys(in, []RenamedKey{{Old: "bot.prefix", New: "bot.command_prefix"}})
+	if err != nil || used != nil || string(out) != string(in) {
+		t.Errorf("migrate = %s, %v, %v; want the input unchanged", out, used, err)
+	}
+
+	// 没有改名的配置项时不解析JSON
+	invalid := []byte("{not json")
+	if out, _, err := migrateRenamedKeys(invalid, nil); err != nil || string(out) != string(invalid) {
+		t.Errorf("migrate with no keys = %s, %v", out, err)
+	}
+	if _, _, err := migrateRenamedKeys(invalid, []RenamedKey{{Old: "a", New: "b"}}); err == nil {
+		t.Error("invalid JSON should fail when there are keys to migrate")
+	}
+}
+
+// withRenamedKeys 在测试期间替换已改名的配置项
+func withRenamedKeys(t *testing.T, keys []RenamedKey) {
+	t.Helper()
+	saved := renamedKeys
+	renamedKeys = keys
+	t.Cleanup(func() { renamedKeys = saved })
+}
+
+// writeConfig 把配置写入临时文件，返回路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigMapsRenamedKeys(t *testing.T) {
+	withRenamedKeys(t, []RenamedKey{
+		{Old: "bot.prefix", New: "bot.command_prefix"},
+		{Old: "logger.log_level", New: "logger.level"},
+		{Old: "bot.unused_old", New: "bot.plugins_dir"},
+	})
+	path := writeConfig(t, `{
+		"telegram": {"api_id": 1, "api_hash": "hash"},
+		"bot": {"prefix": "!", "plugins_dir": "plugins"},
+		"logger": {"log_level": "DEBUG", "level": "WARN"}
+	}`)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Bot.CommandPrefix != "!" {
+		t.Errorf("bot.command_prefix = %q, want the value of bot.prefix", cfg.Bot.CommandPrefix)
+	}
+	if cfg.Logger.Level != "WARN" {
+		t.Errorf("logger.level = %q, the new key should win", cfg.Logger.Level)
+	}
+	want := []RenamedKey{{Old: "bot.prefix", New: "bot.command_prefix"}, {Old: "logger.log_level", New: "logger.level"}}
+	if !reflect.DeepEqual(cfg.RenamedKeys(), want) {
+		t.Errorf("RenamedKeys = %+v, want %+v", cfg.RenamedKeys(), want)
+	}
+
+	// 每个使用了的旧配置项记录一条指向新名称的警告
+	var warnings []string
+	for _, line := range logger.Recent(50, "") {
+		if line.Level == logger.WARN && strings.HasPrefix(line.Text, "Config key ") {
+			warnings = append(warnings, line.Text)
+		}
+	}
+	wantWarnings := []string{
+		"Config key bot.prefix is deprecated, use bot.command_prefix instead",
+		"Config key logger.log_level is deprecated, use logger.level instead",
+	}
+	if len(warnings) < 2 || !reflect.DeepEqual(warnings[len(warnings)-2:], wantWarnings) {
+		t.Errorf("warnings = %q, want %q", warnings, wantWarnings)
+	}
+
+	// 配置文件本身不会被改写
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"prefix": "!"`) {
+		t.Error("LoadConfig should not rewrite the config file")
+	}
+}
+
+func TestLoadConfigWithoutRenamedKeys(t *testing.T) {
+	withRenamedKeys(t, []RenamedKey{{Old: "bot.prefix", New: "bot.command_prefix"}})
+	cfg, err := LoadConfig(writeConfig(t, `{"telegram": {"api_id": 1, "api_hash": "hash"}, "bot": {"command_prefix": ",", "plugins_dir": "plugins"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Bot.CommandPrefix != "," || cfg.RenamedKeys() != nil {
+		t.Errorf("prefix %q, renamed %+v", cfg.Bot.CommandPrefix, cfg.RenamedKeys())
+	}
+}
+
+func TestDeprecatedKeysReturnsCopy(t *testing.T) {
+	withRenamedKeys(t, []RenamedKey{{Old: "a", New: "b"}})
+	keys := DeprecatedKeys()
+	keys[0].New = "changed"
+	if renamedKeys[0].New != "b" {
+		t.Error("DeprecatedKeys should return a copy")
+	}
+}
+
+func TestValidateLoginMethod(t *testing.T) {
+	tests := []struct {
+		method string
+		valid  bool
+	}{
+		{"", true},
+		{"phone", true},
+		{"qr", true},
+		{"QR", false},
+		{"sms", false},
+	}
+	for _, tt := range tests {
+		cfg := &Config{
+			Telegram: TelegramConfig{APIID: 1, APIHash: "hash", LoginMethod: tt.method},
+			Bot:      BotConfig{CommandPrefix: ".", PluginsDir: "plugins"},
+		}
+		err := cfg.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("login_method %q: %v", tt.method, err)
+		}
+		if !tt.valid && (err == nil || !strings.Contains(err.Error(), "telegram.login_method")) {
+			t.Errorf("login_method %q = %v, want login_method error", tt.method, err)
+		}
+	}
+
+	// 通过 LoadConfig 加载时同样被拒绝
+	if _, err := LoadConfig(writeConfig(t, `{"telegram": {"api_id": 1, "api_hash": "hash", "login_method": "sms"}, "bot": {"command_prefix": ".", "plugins_dir": "plugins"}}`)); err == nil || !strings.Contains(err.Error(), "telegram.login_method") {
+		t.Errorf("LoadConfig with bad login_method = %v", err)
+	}
+}
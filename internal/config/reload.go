@@ -0,0 +1,165 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"strings"
+)
+
+// hotReloadable 可以在运行时重新加载的配置项，其他项的修改需要重启才能生效
+var hotReloadable = map[string]bool{
+	"logger.level":         true,
+	"bot.command_prefix":   true,
+	"bot.command_prefixes": true,
+}
+
+// hotReloadablePrefixes 以这些前缀开头的配置项也可以在运行时重新加载
+var hotReloadablePrefixes = []string{"logger.modules."}
+
+// secretKeys 显示配置时隐藏的配置项
+var secretKeys = map[string]bool{
+	"telegram.api_hash":       true,
+	"telegram.bot_token":      true,
+	"telegram.session_string": true,
+	"security.passphrase":     true,
+}
+
+// Entry 展开后的一个配置项，Key 为以点分隔的路径
+type Entry struct {
+	Key   string
+	Value string
+}
+
+// ReloadResult 重新加载配置的结果
+type ReloadResult struct {
+	Config   *Config  // 生效的配置：当前配置加上可以热加载的修改
+	Applied  []string // 已生效的修改
+	Rejected []string // 需要重启才能生效、本次被忽略的修改
+}
+
+// NormalizePaths 将会话、数据库、插件目录、下载目录和speedtest CLI的路径转换为相对于配置文件的路径
+func (c *Config) NormalizePaths(configPath string) {
+	c.Telegram.Session = NormalizePath(configPath, c.Telegram.Session)
+	c.Telegram.Database = NormalizePath(configPath, c.Telegram.Database)
+	c.Bot.PluginsDir = NormalizePath(configPath, c.Bot.PluginsDir)
+	if c.Media.DownloadDir != "" {
+		c.Media.DownloadDir = NormalizePath(configPath, c.Media.DownloadDir)
+	}
+	if c.Plugins.Speedtest.Path != "" {
+		c.Plugins.Speedtest.Path = NormalizePath(configPath, c.Plugins.Speedtest.Path)
+	}
+}
+
+// Reload 重新读取配置文件并与当前配置比较。只有 hotReloadable 中的配置项会生效，
+// 其他有修改的配置项记录警告后忽略；current 不会被修改
+func Reload(configPath string, current *Config) (*ReloadResult, error) {
+	next, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	next.NormalizePaths(configPath)
+
+	before, err := flatten(current)
+	if err != nil {
+		return nil, err
+	}
+	after, err := flatten(next)
+	if err != nil {
+		return nil, err
+	}
+
+	effective := *current
+	effective.Logger.Level = next.Logger.Level
+	effective.Logger.Modules = next.Logger.Modules
+	effective.Bot.CommandPrefix = next.Bot.CommandPrefix
+	effective.Bot.Prefixes = next.Bot.Prefixes
+
+	result := &ReloadResult{Config: &effective}
+	for _, key := range changedKeys(before, after) {
+		if isHotReloadable(key) {
+			result.Applied = append(result.Applied, key)
+		} else {
+			logger.Warnf("Config key %s changed but cannot be reloaded, restart to apply", key)
+			result.Rejected = append(result.Rejected, key)
+		}
+	}
+	return result, nil
+}
+
+// isHotReloadable 配置项是否可以在运行时重新加载
+func isHotReloadable(key string) bool {
+	if hotReloadable[key] {
+		return true
+	}
+	for _, prefix := range hotReloadablePrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Entries 返回展开并按路径排序的配置项，密钥类配置项只显示是否已设置
+func (c *Config) Entries() ([]Entry, error) {
+	values, err := flatten(c)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(values))
+	for key, value := range values {
+		if secretKeys[key] && value != `""` {
+			value = "******"
+		}
+		entries = append(entries, Entry{Key: key, Value: value})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// flatten 把配置展开为 路径 -> JSON 值
+func flatten(c *Config) (map[string]string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	values := make(map[string]string)
+	var walk func(prefix string, node map[string]interface{})
+	walk = func(prefix string, node map[string]interface{}) {
+		for key, value := range node {
+			path := strings.TrimPrefix(prefix+"."+key, ".")
+			if child, ok := value.(map[string]interface{}); ok {
+				walk(path, child)
+				continue
+			}
+			encoded, _ := json.Marshal(value)
+			values[path] = string(encoded)
+		}
+	}
+	walk("", root)
+	return values, nil
+}
+
+// changedKeys 返回两份展开的配置中值不同的路径，按路径排序
+func changedKeys(before, after map[string]string) []string {
+	var keys []string
+	for key, value := range after {
+		if old, ok := before[key]; !ok || old != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,14 +2,20 @@ package core
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"nexusvalet/pkg/logger"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 
 	"github.com/gotd/td/tg"
 )
 
+// coreLog 事件分发、钩子和任务的日志
+var coreLog = logger.Named("core")
+
 // MessageEvent 代表 Telegram 消息事件
 type MessageEvent struct {
 	Update  *tg.UpdateNewMessage
@@ -17,6 +23,17 @@ type MessageEvent struct {
 	Text    string
 	UserID  int64
 	ChatID  int64
+	Sudo    bool // 消息由其他账号发送(sudo用户或机器人模式的管理员)而不是自己，命令响应不能编辑该消息
+	// Owner 其他账号中的所有者：机器人模式下 telegram.bot_admins 中的账号。自己发送的消息不需要设置
+	Owner bool
+	// Matches 带正则的监听器收到的匹配结果：Matches[0] 为整个匹配，之后依次为各捕获组。
+	// 每个监听器收到的是事件的副本，没有正则的监听器为nil
+	Matches []string
+}
+
+// IsOwner 消息是否来自所有者：自己，或机器人模式的管理员。sudo用户不是所有者
+func (e *MessageEvent) IsOwner() bool {
+	return !e.Sudo || e.Owner
 }
 
 // CommandEvent 代表命令执行事件
@@ -26,9 +43,13 @@ type CommandEvent struct {
 	Message *MessageEvent
 }
 
-// EventHandler 是处理事件的函数
+// EventHandler 是处理事件的函数。返回 ErrStopPropagation 时不再把该事件交给后续的监听器
 type EventHandler func(context.Context, interface{}) error
 
+// ErrStopPropagation 监听器返回该错误表示已消费该事件：优先级更低的监听器不再收到它，
+// 消息事件也不会再交给命令解析器(优先级 100 的消息监听器)。不视为监听器失败
+var ErrStopPropagation = errors.New("event propagation stopped")
+
 // ListenerType 代表监听器的类型
 type ListenerType string
 
@@ -44,7 +65,11 @@ type ListenerFilter struct {
 	PrivatesOnly bool // Only handle private messages
 	Outgoing     bool // Handle outgoing messages (from self)
 	Incoming     bool // Handle incoming messages (from others)
-	SudoOnly     bool // Only handle messages from sudo users
+	SudoOnly     bool // Only handle messages from self or sudo users; other listeners never see sudo messages
+	// ChatIDs 非空时只处理这些对话的消息，ExcludeChatIDs 中的对话总是跳过。
+	// ID 与 MessageEvent.ChatID 的形式相同：用户为正数，普通群为 -ID，频道/超级群为 -100 开头
+	ChatIDs        []int64
+	ExcludeChatIDs []int64
 }
 
 // Listener 代表一个事件监听器
@@ -63,12 +88,15 @@ type Listener struct {
 type EventDispatcher struct {
 	listeners map[ListenerType][]*Listener
 	mutex     sync.RWMutex
+	metrics   *Metrics
+	onPanic   PanicHandler
 }
 
 // NewEventDispatcher 创建一个新的事件分发器
 func NewEventDispatcher() *EventDispatcher {
 	return &EventDispatcher{
 		listeners: make(map[ListenerType][]*Listener),
+		metrics:   NewMetrics(),
 	}
 }
 
@@ -80,7 +108,7 @@ func (ed *EventDispatcher) RegisterMessageListener(name string, pattern string,
 	if pattern != "" {
 		regex, err = regexp.Compile(pattern)
 		if err != nil {
-			return err
+			return fmt.Errorf("invalid pattern for listener %s: %w", name, err)
 		}
 	}
 
@@ -93,7 +121,7 @@ func (ed *EventDispatcher) RegisterMessageListener(name string, pattern string,
 	}
 
 	ed.addListener(listener)
-	logger.Debugf("Registered message listener: %s with pattern: %s", name, pattern)
+	coreLog.Debugf("Registered message listener: %s with pattern: %s", name, pattern)
 	return nil
 }
 
@@ -108,7 +136,7 @@ func (ed *EventDispatcher) RegisterPrefixListener(name string, prefix string, ha
 	}
 
 	ed.addListener(listener)
-	logger.Debugf("Registered prefix listener: %s with prefix: %s", name, prefix)
+	coreLog.Debugf("Registered prefix listener: %s with prefix: %s", name, prefix)
 }
 
 // RegisterCommandListener 注册命令监听器
@@ -122,7 +150,7 @@ func (ed *EventDispatcher) RegisterCommandListener(name string, command string,
 	}
 
 	ed.addListener(listener)
-	logger.Debugf("Registered command listener: %s for command: %s", name, command)
+	coreLog.Debugf("Registered command listener: %s for command: %s", name, command)
 }
 
 // RegisterRawListener 注册原始事件监听器
@@ -135,7 +163,7 @@ func (ed *EventDispatcher) RegisterRawListener(name string, handler EventHandler
 	}
 
 	ed.addListener(listener)
-	logger.Debugf("Registered raw listener: %s", name)
+	coreLog.Debugf("Registered raw listener: %s", name)
 }
 
 // RegisterMessageListenerWithFilter 注册具有模式匹配和过滤器的消息监听器
@@ -146,7 +174,7 @@ func (ed *EventDispatcher) RegisterMessageListenerWithFilter(name string, patter
 	if pattern != "" {
 		regex, err = regexp.Compile(pattern)
 		if err != nil {
-			return err
+			return fmt.Errorf("invalid pattern for listener %s: %w", name, err)
 		}
 	}
 
@@ -160,7 +188,7 @@ func (ed *EventDispatcher) RegisterMessageListenerWithFilter(name string, patter
 	}
 
 	ed.addListener(listener)
-	logger.Debugf("Registered message listener with filter: %s with pattern: %s", name, pattern)
+	coreLog.Debugf("Registered message listener with filter: %s with pattern: %s", name, pattern)
 	return nil
 }
 
@@ -176,7 +204,7 @@ func (ed *EventDispatcher) RegisterPrefixListenerWithFilter(name string, prefix
 	}
 
 	ed.addListener(listener)
-	logger.Debugf("Registered prefix listener with filter: %s with prefix: %s", name, prefix)
+	coreLog.Debugf("Registered prefix listener with filter: %s with prefix: %s", name, prefix)
 }
 
 // RegisterRawListenerWithFilter 注册具有过滤器的原始事件监听器
@@ -190,10 +218,10 @@ func (ed *EventDispatcher) RegisterRawListenerWithFilter(name string, handler Ev
 	}
 
 	ed.addListener(listener)
-	logger.Debugf("Registered raw listener with filter: %s", name)
+	coreLog.Debugf("Registered raw listener with filter: %s", name)
 }
 
-// addListener 添加监听器并按优先级排序
+// addListener 添加监听器并按优先级排序，优先级相同的监听器按注册顺序排列
 func (ed *EventDispatcher) addListener(listener *Listener) {
 	ed.mutex.Lock()
 	defer ed.mutex.Unlock()
@@ -220,61 +248,119 @@ func (ed *EventDispatcher) UnregisterListener(listenerType ListenerType, name st
 	for i, listener := range listeners {
 		if listener.Name == name {
 			ed.listeners[listenerType] = append(listeners[:i], listeners[i+1:]...)
-			logger.Debugf("Unregistered listener: %s:%s", listenerType, name)
+			coreLog.Debugf("Unregistered listener: %s:%s", listenerType, name)
 			return
 		}
 	}
 }
 
+// SetPanicHandler 设置监听器panic后调用的处理函数
+func (ed *EventDispatcher) SetPanicHandler(handler PanicHandler) {
+	ed.mutex.Lock()
+	defer ed.mutex.Unlock()
+	ed.onPanic = handler
+}
+
+// Metrics 返回消息和命令的运行时计数
+func (ed *EventDispatcher) Metrics() *Metrics {
+	return ed.metrics
+}
+
 // DispatchMessage 将消息事件分发给相关监听器
 func (ed *EventDispatcher) DispatchMessage(ctx context.Context, event *MessageEvent) error {
-	// First dispatch to raw listeners
-	if err := ed.dispatchToListeners(ctx, RawListener, event); err != nil {
+	ed.metrics.MessageHandled()
+
+	// First dispatch to raw listeners; 原始监听器停止传播时消息监听器和命令解析器都不再处理
+	stopped, err := ed.dispatchToListeners(ctx, RawListener, event)
+	if err != nil || stopped {
 		return err
 	}
 
 	// Then dispatch to message listeners
-	return ed.dispatchToListeners(ctx, MessageListener, event)
+	_, err = ed.dispatchToListeners(ctx, MessageListener, event)
+	return err
 }
 
 // DispatchCommand dispatches a command event to command listeners
 func (ed *EventDispatcher) DispatchCommand(ctx context.Context, event *CommandEvent) error {
-	return ed.dispatchToListeners(ctx, CommandListener, event)
+	_, err := ed.dispatchToListeners(ctx, CommandListener, event)
+	return err
 }
 
 // DispatchRaw dispatches any event to raw listeners
 func (ed *EventDispatcher) DispatchRaw(ctx context.Context, event interface{}) error {
-	return ed.dispatchToListeners(ctx, RawListener, event)
+	_, err := ed.dispatchToListeners(ctx, RawListener, event)
+	return err
 }
 
-// dispatchToListeners dispatches an event to all matching listeners of a type
-func (ed *EventDispatcher) dispatchToListeners(ctx context.Context, listenerType ListenerType, event interface{}) error {
+// dispatchToListeners 按优先级从高到低把事件交给匹配的监听器，
+// 某个监听器返回 ErrStopPropagation 时停止并返回 stopped 为true
+func (ed *EventDispatcher) dispatchToListeners(ctx context.Context, listenerType ListenerType, event interface{}) (stopped bool, err error) {
 	ed.mutex.RLock()
 	listeners := make([]*Listener, len(ed.listeners[listenerType]))
 	copy(listeners, ed.listeners[listenerType])
+	onPanic := ed.onPanic
 	ed.mutex.RUnlock()
 
 	for _, listener := range listeners {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return false, ctx.Err()
 		default:
-			if ed.shouldHandleEvent(listener, event) {
-				if err := listener.Handler(ctx, event); err != nil {
-					logger.Errorf("Listener %s failed: %v", listener.Name, err)
+			if matched, ok := ed.matchEvent(listener, event); ok {
+				if err := invokeListener(ctx, listener, matched, onPanic); err != nil {
+					if errors.Is(err, ErrStopPropagation) {
+						coreLog.Ctx(ctx).Debugf("Listener %s stopped propagation of %s event", listener.Name, listenerType)
+						return true, nil
+					}
+					coreLog.Ctx(ctx).Errorf("Listener %s failed: %v", listener.Name, err)
 					// Continue with other listeners
 				}
 			}
 		}
 	}
 
-	return nil
+	return false, nil
 }
 
-// shouldHandleEvent determines if a listener should handle an event
+// invokeListener 调用监听器，监听器panic时记录并返回错误，不影响其他监听器
+func invokeListener(ctx context.Context, listener *Listener, event interface{}, onPanic PanicHandler) (err error) {
+	defer func() {
+		if perr := RecoverPanic(ctx, recover(), "listener", listener.Name, "", onPanic); perr != nil {
+			err = perr
+		}
+	}()
+	return listener.Handler(ctx, event)
+}
+
+// matchEvent determines if a listener should handle an event and returns the event to pass.
+// 带正则的消息监听器收到带有匹配结果的事件副本
+func (ed *EventDispatcher) matchEvent(listener *Listener, event interface{}) (interface{}, bool) {
+	if !ed.shouldHandleEvent(listener, event) {
+		return nil, false
+	}
+	msgEvent, ok := event.(*MessageEvent)
+	if !ok || listener.Type != MessageListener || listener.Pattern == nil {
+		return event, true
+	}
+	// 过滤条件已在 shouldHandleEvent 中检查，只对通过的消息执行正则
+	matches := listener.Pattern.FindStringSubmatch(msgEvent.Text)
+	if matches == nil {
+		return nil, false
+	}
+	matched := *msgEvent
+	matched.Matches = matches
+	return &matched, true
+}
+
+// shouldHandleEvent determines if a listener should handle an event.
+// 带正则的消息监听器只检查过滤条件，正则由 matchEvent 匹配
 func (ed *EventDispatcher) shouldHandleEvent(listener *Listener, event interface{}) bool {
 	switch listener.Type {
 	case RawListener:
+		if isSudoMessage(event) && (listener.Filter == nil || !listener.Filter.SudoOnly) {
+			return false
+		}
 		// Apply filter if exists
 		if listener.Filter != nil {
 			return ed.passesFilter(listener.Filter, event)
@@ -282,14 +368,17 @@ func (ed *EventDispatcher) shouldHandleEvent(listener *Listener, event interface
 		return true
 	case MessageListener:
 		if msgEvent, ok := event.(*MessageEvent); ok {
+			if msgEvent.Sudo && (listener.Filter == nil || !listener.Filter.SudoOnly) {
+				return false
+			}
 			// First check filter if exists
 			if listener.Filter != nil && !ed.passesFilter(listener.Filter, event) {
 				return false
 			}
 
-			// Check pattern matching
+			// Pattern matching happens in matchEvent
 			if listener.Pattern != nil {
-				return listener.Pattern.MatchString(msgEvent.Text)
+				return true
 			}
 			// Check prefix matching
 			if listener.Prefix != "" {
@@ -306,6 +395,9 @@ func (ed *EventDispatcher) shouldHandleEvent(listener *Listener, event interface
 			}
 			return listener.Command == cmdEvent.Command
 		}
+	case StoryListener:
+		_, ok := event.(*StoryEvent)
+		return ok
 	}
 	return false
 }
@@ -318,6 +410,14 @@ func (ed *EventDispatcher) passesFilter(filter *ListenerFilter, event interface{
 		return true
 	}
 
+	// Check chat whitelist/blacklist
+	if len(filter.ChatIDs) > 0 && !slices.Contains(filter.ChatIDs, msgEvent.ChatID) {
+		return false
+	}
+	if slices.Contains(filter.ExcludeChatIDs, msgEvent.ChatID) {
+		return false
+	}
+
 	// Check group/private filter
 	isGroup := msgEvent.ChatID < 0 // Negative chat IDs are groups/channels
 	if filter.GroupsOnly && !isGroup {
@@ -332,6 +432,11 @@ func (ed *EventDispatcher) passesFilter(filter *ListenerFilter, event interface{
 	// For now, we'll use a simple heuristic based on the message source
 	isOutgoing := msgEvent.Message != nil && msgEvent.Message.Out
 
+	// SudoOnly 接受自己和sudo用户的消息，sudo用户的消息视同发出的消息
+	if filter.SudoOnly {
+		return isOutgoing || msgEvent.Sudo
+	}
+
 	if filter.Outgoing && !isOutgoing {
 		return false
 	}
@@ -339,14 +444,15 @@ func (ed *EventDispatcher) passesFilter(filter *ListenerFilter, event interface{
 		return false
 	}
 
-	// TODO: Implement SudoOnly filter when sudo user system is available
-	// if filter.SudoOnly && !isSudoUser(msgEvent.UserID) {
-	//     return false
-	// }
-
 	return true
 }
 
+// isSudoMessage 事件是否为sudo用户的消息
+func isSudoMessage(event interface{}) bool {
+	msgEvent, ok := event.(*MessageEvent)
+	return ok && msgEvent.Sudo
+}
+
 // GetListeners returns all listeners of a given type
 func (ed *EventDispatcher) GetListeners(listenerType ListenerType) []*Listener {
 	ed.mutex.RLock()
@@ -376,5 +482,5 @@ func (ed *EventDispatcher) Clear() {
 	defer ed.mutex.Unlock()
 
 	ed.listeners = make(map[ListenerType][]*Listener)
-	logger.Debugf("Cleared all listeners")
+	coreLog.Debugf("Cleared all listeners")
 }
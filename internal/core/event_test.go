@@ -0,0 +1,236 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+// callLog 记录监听器被调用的顺序
+type callLog struct {
+	mu    sync.Mutex
+	names []string
+}
+
+// handler 返回记录名称并返回err的监听器
+func (l *callLog) handler(name string, err error) EventHandler {
+	return func(context.Context, interface{}) error {
+		l.mu.Lock()
+		l.names = append(l.names, name)
+		l.mu.Unlock()
+		return err
+	}
+}
+
+func (l *callLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.names...)
+}
+
+func selfMessage(text string) *MessageEvent {
+	return &MessageEvent{Message: &tg.Message{ID: 1, Out: true, Message: text}, Text: text, ChatID: -1, UserID: 1}
+}
+
+func TestListenersRunByPriority(t *testing.T) {
+	ed := NewEventDispatcher()
+	var log callLog
+	// 注册顺序与优先级无关，相同优先级按注册顺序
+	ed.RegisterRawListener("low", log.handler("low", nil), -5)
+	ed.RegisterRawListener("mid-a", log.handler("mid-a", nil), 10)
+	ed.RegisterRawListener("high", log.handler("high", nil), 200)
+	ed.RegisterRawListener("mid-b", log.handler("mid-b", nil), 10)
+	ed.RegisterRawListener("zero", log.handler("zero", nil), 0)
+	ed.RegisterRawListener("mid-c", log.handler("mid-c", nil), 10)
+
+	if err := ed.DispatchRaw(context.Background(), "event"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"high", "mid-a", "mid-b", "mid-c", "zero", "low"}
+	if got := log.get(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+
+	var listed []string
+	for _, l := range ed.GetListeners(RawListener) {
+		listed = append(listed, l.Name)
+	}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("GetListeners order = %v, want %v", listed, want)
+	}
+}
+
+func TestListenerOrderAfterUnregister(t *testing.T) {
+	ed := NewEventDispatcher()
+	var log callLog
+	for i, p := range []int{5, 5, 1, 9} {
+		name := fmt.Sprintf("l%d", i)
+		ed.RegisterRawListener(name, log.handler(name, nil), p)
+	}
+	ed.UnregisterListener(RawListener, "l0")
+	ed.RegisterRawListener("l4", log.handler("l4", nil), 5)
+
+	ed.DispatchRaw(context.Background(), "event")
+	if got, want := log.get(), []string{"l3", "l1", "l4", "l2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+}
+
+func TestStopPropagationWithinType(t *testing.T) {
+	ed := NewEventDispatcher()
+	var log callLog
+	ed.RegisterPrefixListener("antispam", ".", log.handler("antispam", nil), 300)
+	ed.RegisterPrefixListener("filter", ".", log.handler("filter", ErrStopPropagation), 200)
+	ed.RegisterPrefixListener("command_parser", ".", log.handler("command_parser", nil), 100)
+	ed.RegisterPrefixListener("logger", ".", log.handler("logger", nil), 0)
+
+	if err := ed.DispatchMessage(context.Background(), selfMessage(".help")); err != nil {
+		t.Fatalf("stopped dispatch should not be an error: %v", err)
+	}
+	if got, want := log.get(), []string{"antispam", "filter"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("called %v, want %v", got, want)
+	}
+}
+
+func TestRawStopSkipsMessageListeners(t *testing.T) {
+	ed := NewEventDispatcher()
+	var log callLog
+	ed.RegisterRawListener("raw", log.handler("raw", fmt.Errorf("consumed: %w", ErrStopPropagation)), 0)
+	ed.RegisterRawListener("raw-low", log.handler("raw-low", nil), -1)
+	ed.RegisterPrefixListener("command_parser", ".", log.handler("command_parser", nil), 100)
+
+	if err := ed.DispatchMessage(context.Background(), selfMessage(".ping")); err != nil {
+		t.Fatal(err)
+	}
+	// 包装后的 ErrStopPropagation 同样生效
+	if got, want := log.get(), []string{"raw"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("called %v, want %v", got, want)
+	}
+}
+
+func TestListenerErrorsDoNotStop(t *testing.T) {
+	ed := NewEventDispatcher()
+	var log callLog
+	var panics []string
+	ed.SetPanicHandler(func(_ context.Context, info PanicInfo) { panics = append(panics, info.Name) })
+	ed.RegisterRawListener("fails", log.handler("fails", errors.New("boom")), 3)
+	ed.RegisterRawListener("panics", func(context.Context, interface{}) error { panic("bad") }, 2)
+	ed.RegisterRawListener("after", log.handler("after", nil), 1)
+
+	if err := ed.DispatchMessage(context.Background(), selfMessage("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := log.get(), []string{"fails", "after"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("called %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(panics, []string{"panics"}) {
+		t.Errorf("panic handler calls = %v", panics)
+	}
+}
+
+func TestDispatchCancelledContext(t *testing.T) {
+	ed := NewEventDispatcher()
+	var log callLog
+	ed.RegisterRawListener("a", log.handler("a", nil), 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ed.DispatchRaw(ctx, "event"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("DispatchRaw = %v, want context.Canceled", err)
+	}
+	if len(log.get()) != 0 {
+		t.Error("listeners should not run after cancellation")
+	}
+}
+
+func TestMessagePatternMatches(t *testing.T) {
+	ed := NewEventDispatcher()
+	var got []string
+	if err := ed.RegisterMessageListener("re", `^(\w+)=(\d+)$`, func(_ context.Context, e interface{}) error {
+		got = e.(*MessageEvent).Matches
+		return nil
+	}, 0); err != nil {
+		t.Fatal(err)
+	}
+	original := selfMessage("count=42")
+	ed.DispatchMessage(context.Background(), original)
+	if !reflect.DeepEqual(got, []string{"count=42", "count", "42"}) {
+		t.Fatalf("Matches = %q", got)
+	}
+	if original.Matches != nil {
+		t.Error("listener should get a copy, the original event must not be modified")
+	}
+
+	if err := ed.RegisterMessageListener("bad", `(`, nil, 0); err == nil {
+		t.Error("invalid pattern should fail")
+	}
+}
+
+// chatMessage 返回对话chatID中自己发送的消息
+func chatMessage(chatID int64) *MessageEvent {
+	return &MessageEvent{Message: &tg.Message{ID: 1, Out: true, Message: "hi"}, Text: "hi", ChatID: chatID, UserID: 1}
+}
+
+func TestListenerChatFilter(t *testing.T) {
+	const (
+		channel      int64 = -1001234567890 // 频道 1234567890
+		otherChannel int64 = -1009876543210
+		chat         int64 = -1234567890 // 普通群 1234567890，不能与同号频道混淆
+		user         int64 = 1234567890
+	)
+	ed := NewEventDispatcher()
+	seen := make(map[string][]int64)
+	record := func(name string) EventHandler {
+		return func(_ context.Context, e interface{}) error {
+			if msgEvent, ok := e.(*MessageEvent); ok {
+				seen[name] = append(seen[name], msgEvent.ChatID)
+			}
+			return nil
+		}
+	}
+	ed.RegisterMessageListenerWithFilter("only-channel", "", record("only-channel"), 0, ListenerFilter{ChatIDs: []int64{channel}})
+	ed.RegisterPrefixListenerWithFilter("two-chats", "h", record("two-chats"), 0, ListenerFilter{ChatIDs: []int64{chat, otherChannel}})
+	ed.RegisterMessageListenerWithFilter("not-channel", "", record("not-channel"), 0, ListenerFilter{ExcludeChatIDs: []int64{channel}})
+	// 同时出现在两个列表中时排除优先
+	ed.RegisterMessageListenerWithFilter("both", "", record("both"), 0, ListenerFilter{ChatIDs: []int64{channel, user}, ExcludeChatIDs: []int64{channel}})
+	// 与其他过滤条件同时生效
+	ed.RegisterMessageListenerWithFilter("groups-except", "", record("groups-except"), 0, ListenerFilter{GroupsOnly: true, ExcludeChatIDs: []int64{otherChannel}})
+	ed.RegisterRawListenerWithFilter("raw-channel", record("raw-channel"), 0, ListenerFilter{ChatIDs: []int64{channel}})
+
+	for _, id := range []int64{channel, otherChannel, chat, user} {
+		if err := ed.DispatchMessage(context.Background(), chatMessage(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string][]int64{
+		"only-channel":  {channel},
+		"two-chats":     {otherChannel, chat},
+		"not-channel":   {otherChannel, chat, user},
+		"both":          {user},
+		"groups-except": {channel, chat},
+		"raw-channel":   {channel},
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("dispatched chats = %v, want %v", seen, want)
+	}
+
+	// 非消息事件没有对话，不受对话过滤影响
+	var raw []string
+	ed.RegisterRawListenerWithFilter("raw-any", func(_ context.Context, e interface{}) error {
+		if _, ok := e.(*MessageEvent); !ok {
+			raw = append(raw, fmt.Sprint(e))
+		}
+		return nil
+	}, 1, ListenerFilter{ChatIDs: []int64{channel}})
+	if err := ed.DispatchRaw(context.Background(), "update"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(raw, []string{"update"}) {
+		t.Errorf("raw events = %q", raw)
+	}
+}
@@ -2,7 +2,8 @@ package core
 
 import (
 	"context"
-	"nexusvalet/pkg/logger"
+	"errors"
+	"fmt"
 	"sort"
 	"sync"
 )
@@ -11,25 +12,80 @@ import (
 type HookType string
 
 const (
-	BeforeStart   HookType = "before_start"
-	AfterStart    HookType = "after_start"
-	BeforeStop    HookType = "before_stop"
-	AfterStop     HookType = "after_stop"
+	// BeforeStart 启动前执行，Data: version。写入 Data 的值会保留到 AfterStart
+	BeforeStart HookType = "before_start"
+	// AfterStart 连接完成后执行，Data: client 以及 BeforeStart 写入的值
+	AfterStart HookType = "after_start"
+	BeforeStop HookType = "before_stop"
+	AfterStop  HookType = "after_stop"
+	// BeforeCommand 命令执行前执行，Data: command, args, message, plugin, chat_id, user_id。
+	// 修改 args 会改变传给命令的参数；否决或设置 Cancel 会跳过命令，Reason 非空时回复给用户
 	BeforeCommand HookType = "before_command"
-	AfterCommand  HookType = "after_command"
-	OnError       HookType = "on_error"
+	// AfterCommand 命令执行后执行，在 BeforeCommand 的 Data 基础上增加 duration 和 error
+	AfterCommand HookType = "after_command"
+	OnError      HookType = "on_error"
 )
 
-// HookContext 包含传递给钩子处理程序的数据
+// HookContext 包含传递给钩子处理程序的数据。
+// Data 可读写：同一次执行中的钩子共享同一个 Data，前面的钩子写入的值对后面的钩子可见，
+// 执行结束后调用方也能读取到修改
 type HookContext struct {
 	Type    HookType
 	Data    map[string]interface{}
 	Context context.Context
+	Hook    string // 当前正在执行的钩子名称
+
+	// Cancel 钩子返回后为true时，与返回 Veto(Reason) 相同：停止执行并否决当前操作
+	Cancel bool
+	Reason string
+}
+
+// Get 读取 Data 中的值
+func (hc *HookContext) Get(key string) (interface{}, bool) {
+	value, ok := hc.Data[key]
+	return value, ok
+}
+
+// Set 写入 Data，供后续钩子和调用方使用
+func (hc *HookContext) Set(key string, value interface{}) {
+	hc.Data[key] = value
 }
 
-// HookHandler 是处理钩子的函数
+// HookHandler 是处理钩子的函数。返回 ErrStopChain 停止执行后续钩子，
+// 返回 Veto(...) 停止执行并否决当前操作，返回其他错误视为钩子失败
 type HookHandler func(*HookContext) error
 
+// ErrStopChain 钩子返回该错误时不再执行后续钩子，但不视为失败，调用方照常继续
+var ErrStopChain = errors.New("hook chain stopped")
+
+// VetoError 钩子否决了当前操作，调用方应放弃该操作。Reason 可为空
+type VetoError struct {
+	Hook   string
+	Reason string
+}
+
+// Error 实现error接口
+func (e *VetoError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("vetoed by hook %s", e.Hook)
+	}
+	return fmt.Sprintf("vetoed by hook %s: %s", e.Hook, e.Reason)
+}
+
+// Veto 在钩子处理程序中返回，否决当前操作并停止执行后续钩子
+func Veto(reason string) error {
+	return &VetoError{Reason: reason}
+}
+
+// AsVeto 判断钩子执行结果是否为否决
+func AsVeto(err error) (*VetoError, bool) {
+	var veto *VetoError
+	if errors.As(err, &veto) {
+		return veto, true
+	}
+	return nil, false
+}
+
 // Hook 代表一个带优先级的已注册钩子
 type Hook struct {
 	Type     HookType
@@ -40,8 +96,9 @@ type Hook struct {
 
 // HookManager 管理系统中的所有钩子
 type HookManager struct {
-	hooks map[HookType][]*Hook
-	mutex sync.RWMutex
+	hooks   map[HookType][]*Hook
+	mutex   sync.RWMutex
+	onPanic PanicHandler
 }
 
 // NewHookManager 创建一个新的钩子管理器
@@ -65,12 +122,19 @@ func (hm *HookManager) RegisterHook(hookType HookType, name string, handler Hook
 
 	hm.hooks[hookType] = append(hm.hooks[hookType], hook)
 
-	// 按优先级排序钩子（高优先级在前）
-	sort.Slice(hm.hooks[hookType], func(i, j int) bool {
+	// 按优先级排序钩子（高优先级在前，相同优先级保持注册顺序）
+	sort.SliceStable(hm.hooks[hookType], func(i, j int) bool {
 		return hm.hooks[hookType][i].Priority > hm.hooks[hookType][j].Priority
 	})
 
-	logger.Debugf("Registered hook %s:%s with priority %d", hookType, name, priority)
+	coreLog.Debugf("Registered hook %s:%s with priority %d", hookType, name, priority)
+}
+
+// SetPanicHandler 设置钩子panic后调用的处理函数
+func (hm *HookManager) SetPanicHandler(handler PanicHandler) {
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+	hm.onPanic = handler
 }
 
 // UnregisterHook 根据名称和类型移除钩子
@@ -82,7 +146,7 @@ func (hm *HookManager) UnregisterHook(hookType HookType, name string) {
 	for i, hook := range hooks {
 		if hook.Name == name {
 			hm.hooks[hookType] = append(hooks[:i], hooks[i+1:]...)
-			logger.Debugf("Unregistered hook %s:%s", hookType, name)
+			coreLog.Debugf("Unregistered hook %s:%s", hookType, name)
 			return
 		}
 	}
@@ -93,28 +157,52 @@ func (hm *HookManager) ExecuteHooks(hookType HookType, data map[string]interface
 	return hm.ExecuteHooksWithContext(context.Background(), hookType, data)
 }
 
-// ExecuteHooksWithContext 使用上下文执行给定类型的所有钩子
+// ExecuteHooksWithContext 使用上下文执行给定类型的所有钩子。
+// 钩子按优先级从高到低依次同步执行，优先级相同时按注册顺序执行。
+// 某个钩子返回 ErrStopChain 时停止并返回nil；返回否决或设置 Cancel 时停止并返回 *VetoError，
+// 不会触发 OnError；返回其他错误时停止，先执行 OnError 钩子再返回该错误
 func (hm *HookManager) ExecuteHooksWithContext(ctx context.Context, hookType HookType, data map[string]interface{}) error {
 	hm.mutex.RLock()
 	hooks := make([]*Hook, len(hm.hooks[hookType]))
 	copy(hooks, hm.hooks[hookType])
+	onPanic := hm.onPanic
 	hm.mutex.RUnlock()
 
+	if data == nil {
+		data = make(map[string]interface{})
+	}
 	hookCtx := &HookContext{
 		Type:    hookType,
 		Data:    data,
 		Context: ctx,
 	}
 
-	logger.Debugf("Executing %d hooks for type %s", len(hooks), hookType)
+	coreLog.Debugf("Executing %d hooks for type %s", len(hooks), hookType)
 
 	for _, hook := range hooks {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			if err := hook.Handler(hookCtx); err != nil {
-				logger.Errorf("Hook %s:%s failed: %v", hookType, hook.Name, err)
+			hookCtx.Hook = hook.Name
+			err := invokeHook(hook, hookCtx, onPanic)
+			if err == nil && hookCtx.Cancel {
+				err = &VetoError{Hook: hook.Name, Reason: hookCtx.Reason}
+			}
+			if err != nil {
+				if errors.Is(err, ErrStopChain) {
+					coreLog.Debugf("Hook %s:%s stopped the chain", hookType, hook.Name)
+					return nil
+				}
+				if veto, ok := AsVeto(err); ok {
+					if veto.Hook == "" {
+						veto.Hook = hook.Name
+					}
+					coreLog.Infof("Hook %s:%s vetoed: %s", hookType, hook.Name, veto.Reason)
+					return veto
+				}
+
+				coreLog.Errorf("Hook %s:%s failed: %v", hookType, hook.Name, err)
 
 				// 如果这不是已经是一个错误钩子，则执行错误钩子
 				if hookType != OnError {
@@ -133,6 +221,16 @@ func (hm *HookManager) ExecuteHooksWithContext(ctx context.Context, hookType Hoo
 	return nil
 }
 
+// invokeHook 调用钩子，钩子panic时按返回错误处理
+func invokeHook(hook *Hook, hookCtx *HookContext, onPanic PanicHandler) (err error) {
+	defer func() {
+		if perr := RecoverPanic(hookCtx.Context, recover(), "hook", hook.Name, "", onPanic); perr != nil {
+			err = perr
+		}
+	}()
+	return hook.Handler(hookCtx)
+}
+
 // GetHooks 返回给定类型的所有钩子
 func (hm *HookManager) GetHooks(hookType HookType) []*Hook {
 	hm.mutex.RLock()
@@ -162,5 +260,5 @@ func (hm *HookManager) Clear() {
 	defer hm.mutex.Unlock()
 
 	hm.hooks = make(map[HookType][]*Hook)
-	logger.Debugf("Cleared all hooks")
+	coreLog.Debugf("Cleared all hooks")
 }
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recordHook 返回把名称追加到 Data["calls"] 并返回err的钩子
+func recordHook(name string, err error) HookHandler {
+	return func(hc *HookContext) error {
+		calls, _ := hc.Data["calls"].([]string)
+		hc.Set("calls", append(calls, name))
+		return err
+	}
+}
+
+func TestHooksRunByPriority(t *testing.T) {
+	hm := NewHookManager()
+	hm.RegisterHook(BeforeCommand, "low", recordHook("low", nil), 0)
+	hm.RegisterHook(BeforeCommand, "high", recordHook("high", nil), 10)
+	hm.RegisterHook(BeforeCommand, "low-2", recordHook("low-2", nil), 0)
+	hm.RegisterHook(BeforeCommand, "top", recordHook("top", nil), 50)
+
+	data := map[string]interface{}{}
+	if err := hm.ExecuteHooks(BeforeCommand, data); err != nil {
+		t.Fatal(err)
+	}
+	// 同一次执行共享 Data，调用方能读到钩子写入的值
+	if got, want := data["calls"], []string{"top", "high", "low", "low-2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("calls = %v, want %v", got, want)
+	}
+
+	hm.UnregisterHook(BeforeCommand, "high")
+	data = map[string]interface{}{}
+	hm.ExecuteHooks(BeforeCommand, data)
+	if got, want := data["calls"], []string{"top", "low", "low-2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("calls after unregister = %v, want %v", got, want)
+	}
+}
+
+func TestHooksSeeEarlierMutations(t *testing.T) {
+	hm := NewHookManager()
+	hm.RegisterHook(BeforeCommand, "rewrite", func(hc *HookContext) error {
+		args, _ := hc.Get("args")
+		hc.Set("args", append(args.([]string), "added"))
+		return nil
+	}, 10)
+	var seen []string
+	hm.RegisterHook(BeforeCommand, "observe", func(hc *HookContext) error {
+		args, _ := hc.Get("args")
+		seen = args.([]string)
+		return nil
+	}, 0)
+
+	data := map[string]interface{}{"args": []string{"a"}}
+	if err := hm.ExecuteHooks(BeforeCommand, data); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "added"}
+	if !reflect.DeepEqual(seen, want) || !reflect.DeepEqual(data["args"], want) {
+		t.Fatalf("later hook saw %v, caller saw %v; want %v", seen, data["args"], want)
+	}
+}
+
+func TestHookChainOutcomes(t *testing.T) {
+	failure := errors.New("boom")
+	tests := []struct {
+		name      string
+		handler   HookHandler
+		wantErr   func(error) bool
+		wantCalls []string
+		onError   bool
+	}{
+		{
+			name:      "stop chain is not an error",
+			handler:   recordHook("mid", ErrStopChain),
+			wantErr:   func(err error) bool { return err == nil },
+			wantCalls: []string{"first", "mid"},
+		},
+		{
+			name:    "veto",
+			handler: recordHook("mid", Veto("禁止")),
+			wantErr: func(err error) bool {
+				veto, ok := AsVeto(err)
+				return ok && veto.Hook == "mid" && veto.Reason == "禁止"
+			},
+			wantCalls: []string{"first", "mid"},
+		},
+		{
+			name: "cancel flag",
+			handler: func(hc *HookContext) error {
+				recordHook("mid", nil)(hc)
+				hc.Cancel, hc.Reason = true, "已取消"
+				return nil
+			},
+			wantErr: func(err error) bool {
+				veto, ok := AsVeto(err)
+				return ok && veto.Hook == "mid" && veto.Reason == "已取消"
+			},
+			wantCalls: []string{"first", "mid"},
+		},
+		{
+			name:      "error stops and runs OnError",
+			handler:   recordHook("mid", failure),
+			wantErr:   func(err error) bool { return errors.Is(err, failure) },
+			wantCalls: []string{"first", "mid"},
+			onError:   true,
+		},
+		{
+			name:      "panic is an error",
+			handler:   func(*HookContext) error { panic("bad hook") },
+			wantErr:   func(err error) bool { _, veto := AsVeto(err); return err != nil && !veto },
+			wantCalls: []string{"first"},
+			onError:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hm := NewHookManager()
+			hm.RegisterHook(BeforeCommand, "first", recordHook("first", nil), 2)
+			hm.RegisterHook(BeforeCommand, "mid", tt.handler, 1)
+			hm.RegisterHook(BeforeCommand, "last", recordHook("last", nil), 0)
+			var errorData map[string]interface{}
+			hm.RegisterHook(OnError, "capture", func(hc *HookContext) error {
+				errorData = hc.Data
+				return nil
+			}, 0)
+
+			data := map[string]interface{}{}
+			err := hm.ExecuteHooks(BeforeCommand, data)
+			if !tt.wantErr(err) {
+				t.Fatalf("ExecuteHooks error = %v", err)
+			}
+			if !reflect.DeepEqual(data["calls"], tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", data["calls"], tt.wantCalls)
+			}
+			if tt.onError != (errorData != nil) {
+				t.Fatalf("OnError ran = %v, want %v", errorData != nil, tt.onError)
+			}
+			if tt.onError && (errorData["hook_name"] != "mid" || errorData["original_hook_type"] != BeforeCommand) {
+				t.Errorf("OnError data = %v", errorData)
+			}
+		})
+	}
+}
+
+func TestExecuteHooksCancelledContext(t *testing.T) {
+	hm := NewHookManager()
+	hm.RegisterHook(AfterStart, "a", recordHook("a", nil), 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	data := map[string]interface{}{}
+	if err := hm.ExecuteHooksWithContext(ctx, AfterStart, data); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if _, ran := data["calls"]; ran {
+		t.Error("hook ran after cancellation")
+	}
+}
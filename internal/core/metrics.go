@@ -0,0 +1,94 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metricsWindow 统计每分钟处理量的时间窗口(秒)
+const metricsWindow = 60
+
+// Metrics 运行时计数：分发的消息数、各插件的命令调用次数，以及插件通过 Add 记录的自定义计数。
+// 只在内存中累计，重启后清零
+type Metrics struct {
+	messages atomic.Int64
+
+	mutex    sync.Mutex
+	seconds  [metricsWindow]int64 // 每个桶对应的unix秒
+	counts   [metricsWindow]int64 // 该秒内处理的消息数
+	commands map[string]int64     // 插件名 -> 命令调用次数
+	counters map[string]int64
+	now      func() time.Time
+}
+
+// MetricsSnapshot 某一时刻的计数
+type MetricsSnapshot struct {
+	Messages          int64            // 启动以来处理的消息数
+	MessagesPerMinute int64            // 最近一分钟处理的消息数
+	Commands          map[string]int64 // 各插件的命令调用次数
+	Counters          map[string]int64 // 插件自定义的计数
+}
+
+// NewMetrics 创建计数器
+func NewMetrics() *Metrics {
+	return &Metrics{
+		commands: make(map[string]int64),
+		counters: make(map[string]int64),
+		now:      time.Now,
+	}
+}
+
+// MessageHandled 记录一条分发的消息
+func (m *Metrics) MessageHandled() {
+	m.messages.Add(1)
+
+	sec := m.now().Unix()
+	i := sec % metricsWindow
+	m.mutex.Lock()
+	if m.seconds[i] != sec {
+		m.seconds[i] = sec
+		m.counts[i] = 0
+	}
+	m.counts[i]++
+	m.mutex.Unlock()
+}
+
+// CommandInvoked 记录插件的一次命令调用
+func (m *Metrics) CommandInvoked(plugin string) {
+	m.mutex.Lock()
+	m.commands[plugin]++
+	m.mutex.Unlock()
+}
+
+// Add 把delta累加到名为name的计数上，供插件记录自己的指标
+func (m *Metrics) Add(name string, delta int64) {
+	m.mutex.Lock()
+	m.counters[name] += delta
+	m.mutex.Unlock()
+}
+
+// Snapshot 返回当前计数的副本
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	snapshot := MetricsSnapshot{
+		Messages: m.messages.Load(),
+		Commands: make(map[string]int64),
+		Counters: make(map[string]int64),
+	}
+
+	sec := m.now().Unix()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i := range m.seconds {
+		if sec-m.seconds[i] < metricsWindow {
+			snapshot.MessagesPerMinute += m.counts[i]
+		}
+	}
+	for plugin, n := range m.commands {
+		snapshot.Commands[plugin] = n
+	}
+	for name, n := range m.counters {
+		snapshot.Counters[name] = n
+	}
+	return snapshot
+}
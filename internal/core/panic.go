@@ -0,0 +1,33 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicInfo 处理函数panic后恢复时的信息
+type PanicInfo struct {
+	Kind   string      // command、listener 或 hook
+	Name   string      // 命令名、监听器名或钩子名
+	Plugin string      // 命令所属的插件，监听器和钩子为空，由 PanicHandler 按名称查找
+	Value  interface{} // recover() 的返回值
+	Stack  []byte
+}
+
+// PanicHandler 处理函数panic并被恢复后调用，不能再panic
+type PanicHandler func(ctx context.Context, info PanicInfo)
+
+// RecoverPanic 在defer中调用：恢复panic，记录调用栈并交给handler(可为nil)，
+// 返回描述该panic的错误，没有panic时返回nil
+func RecoverPanic(ctx context.Context, r interface{}, kind, name, plugin string, handler PanicHandler) error {
+	if r == nil {
+		return nil
+	}
+	info := PanicInfo{Kind: kind, Name: name, Plugin: plugin, Value: r, Stack: debug.Stack()}
+	coreLog.Ctx(ctx).Errorf("%s %s panicked: %v\n%s", kind, name, r, info.Stack)
+	if handler != nil {
+		handler(ctx, info)
+	}
+	return fmt.Errorf("%s panicked: %v", kind, r)
+}
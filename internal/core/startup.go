@@ -0,0 +1,86 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StartupPhase 启动过程中的一个阶段
+type StartupPhase struct {
+	Name     string
+	Duration time.Duration
+	At       time.Duration // 阶段结束时距启动开始的时间
+}
+
+// StartupReport 记录启动各阶段的耗时，可并发写入
+type StartupReport struct {
+	started time.Time
+	phases  []StartupPhase
+	mutex   sync.Mutex
+
+	now func() time.Time
+}
+
+// NewStartupReport 创建启动耗时报告，从当前时间开始计时
+func NewStartupReport() *StartupReport {
+	return &StartupReport{started: time.Now(), now: time.Now}
+}
+
+// Begin 开始一个阶段，返回结束该阶段的函数
+func (r *StartupReport) Begin(name string) func() {
+	start := r.now()
+	return func() {
+		r.Record(name, r.now().Sub(start))
+	}
+}
+
+// Record 记录一个阶段的耗时
+func (r *StartupReport) Record(name string, d time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.phases = append(r.phases, StartupPhase{Name: name, Duration: d, At: r.now().Sub(r.started)})
+}
+
+// Mark 记录一个时间点(例如首条更新处理完成)，耗时为距启动开始的时间
+func (r *StartupReport) Mark(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	at := r.now().Sub(r.started)
+	r.phases = append(r.phases, StartupPhase{Name: name, Duration: at, At: at})
+}
+
+// Has 是否已记录指定阶段
+func (r *StartupReport) Has(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, p := range r.phases {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Phases 返回已记录的阶段，按结束时间排序
+func (r *StartupReport) Phases() []StartupPhase {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	phases := make([]StartupPhase, len(r.phases))
+	copy(phases, r.phases)
+	return phases
+}
+
+// Summary 返回单行摘要，例如 "session 12ms, plugins 40ms, connect 1.2s"
+func (r *StartupReport) Summary() string {
+	phases := r.Phases()
+	if len(phases) == 0 {
+		return "无记录"
+	}
+	parts := make([]string, 0, len(phases))
+	for _, p := range phases {
+		parts = append(parts, fmt.Sprintf("%s %s", p.Name, p.Duration.Round(time.Millisecond)))
+	}
+	return strings.Join(parts, ", ")
+}
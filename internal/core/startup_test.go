@@ -0,0 +1,60 @@
+package core
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStartupReport(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	now := base
+	r := &StartupReport{started: base, now: func() time.Time { return now }}
+	if got := r.Summary(); got != "无记录" {
+		t.Errorf("empty Summary = %q", got)
+	}
+
+	end := r.Begin("session")
+	now = now.Add(12 * time.Millisecond)
+	end()
+	endConnect := r.Begin("connect")
+	now = now.Add(1200 * time.Millisecond)
+	endConnect()
+	r.Record("post_connect_init", 300*time.Millisecond)
+	now = now.Add(88 * time.Millisecond)
+	r.Mark("first_update")
+
+	want := []StartupPhase{
+		{Name: "session", Duration: 12 * time.Millisecond, At: 12 * time.Millisecond},
+		{Name: "connect", Duration: 1200 * time.Millisecond, At: 1212 * time.Millisecond},
+		{Name: "post_connect_init", Duration: 300 * time.Millisecond, At: 1212 * time.Millisecond},
+		{Name: "first_update", Duration: 1300 * time.Millisecond, At: 1300 * time.Millisecond},
+	}
+	if got := r.Phases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Phases =\n%+v\nwant\n%+v", got, want)
+	}
+	if got, want := r.Summary(), "session 12ms, connect 1.2s, post_connect_init 300ms, first_update 1.3s"; got != want {
+		t.Errorf("Summary = %q, want %q", got, want)
+	}
+	if !r.Has("connect") || r.Has("ready") {
+		t.Error("Has should report recorded phases only")
+	}
+}
+
+func TestStartupReportConcurrentRecord(t *testing.T) {
+	r := NewStartupReport()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Begin("plugin")()
+			r.Summary()
+		}()
+	}
+	wg.Wait()
+	if n := len(r.Phases()); n != 20 {
+		t.Errorf("phases = %d, want 20", n)
+	}
+}
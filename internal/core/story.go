@@ -0,0 +1,148 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// StoryListener 动态(Stories)事件监听器类型
+const StoryListener ListenerType = "story"
+
+// StoryEvent 代表一条动态更新：联系人发布或删除动态，或者有人在动态中提到了自己
+type StoryEvent struct {
+	Update    tg.UpdateClass
+	AuthorID  int64 // 发布者的对话ID，用户为正数，频道为 -100 前缀形式
+	StoryID   int
+	MediaType string // photo、video，跳过或未知时为空
+	Date      time.Time
+	Expires   time.Time
+	Mention   bool // 通过提及消息收到，即发布者在动态中提到了自己
+	Deleted   bool // 动态已被删除
+	Item      *tg.StoryItem
+}
+
+// HasMedia 是否已知动态的媒体类型
+func (e *StoryEvent) HasMedia() bool {
+	return e.MediaType != ""
+}
+
+// ParseStoryUpdate 将与动态相关的更新解析为 StoryEvent。
+// 支持 UpdateStory，以及携带 MessageMediaStory 且 ViaMention 的新消息
+func ParseStoryUpdate(update tg.UpdateClass) (*StoryEvent, bool) {
+	switch upd := update.(type) {
+	case *tg.UpdateStory:
+		event := StoryFromItem(upd.Story)
+		if event == nil {
+			return nil, false
+		}
+		event.Update = update
+		event.AuthorID = storyPeerID(upd.Peer)
+		return event, event.AuthorID != 0
+	case *tg.UpdateNewMessage:
+		return storyMention(update, upd.Message)
+	case *tg.UpdateNewChannelMessage:
+		return storyMention(update, upd.Message)
+	}
+	return nil, false
+}
+
+// storyMention 解析动态提及消息
+func storyMention(update tg.UpdateClass, msg tg.MessageClass) (*StoryEvent, bool) {
+	message, ok := msg.(*tg.Message)
+	if !ok || message.Out {
+		return nil, false
+	}
+	media, ok := message.Media.(*tg.MessageMediaStory)
+	if !ok || !media.ViaMention {
+		return nil, false
+	}
+
+	event := &StoryEvent{StoryID: media.ID}
+	if item, ok := media.GetStory(); ok {
+		if parsed := StoryFromItem(item); parsed != nil {
+			event = parsed
+		}
+	}
+	event.Update = update
+	event.AuthorID = storyPeerID(media.Peer)
+	event.StoryID = media.ID
+	event.Mention = true
+	return event, event.AuthorID != 0
+}
+
+// StoryFromItem 从 StoryItemClass 提取动态信息，发布者需要由调用方填写
+func StoryFromItem(item tg.StoryItemClass) *StoryEvent {
+	switch story := item.(type) {
+	case *tg.StoryItem:
+		return &StoryEvent{
+			StoryID:   story.ID,
+			MediaType: StoryMediaType(story.Media),
+			Date:      time.Unix(int64(story.Date), 0),
+			Expires:   time.Unix(int64(story.ExpireDate), 0),
+			Item:      story,
+		}
+	case *tg.StoryItemSkipped:
+		return &StoryEvent{
+			StoryID: story.ID,
+			Date:    time.Unix(int64(story.Date), 0),
+			Expires: time.Unix(int64(story.ExpireDate), 0),
+		}
+	case *tg.StoryItemDeleted:
+		return &StoryEvent{StoryID: story.ID, Deleted: true}
+	}
+	return nil
+}
+
+// StoryMediaType 返回动态媒体的类型名称
+func StoryMediaType(media tg.MessageMediaClass) string {
+	switch m := media.(type) {
+	case *tg.MessageMediaPhoto:
+		return "photo"
+	case *tg.MessageMediaDocument:
+		if doc, ok := m.Document.(*tg.Document); ok {
+			for _, attr := range doc.Attributes {
+				if _, ok := attr.(*tg.DocumentAttributeVideo); ok {
+					return "video"
+				}
+			}
+		}
+		return "document"
+	case nil:
+		return ""
+	}
+	return "other"
+}
+
+// storyPeerID 将动态发布者转换为对话ID
+func storyPeerID(peer tg.PeerClass) int64 {
+	switch p := peer.(type) {
+	case *tg.PeerUser:
+		return p.UserID
+	case *tg.PeerChat:
+		return -p.ChatID
+	case *tg.PeerChannel:
+		return -1000000000000 - p.ChannelID
+	}
+	return 0
+}
+
+// RegisterStoryListener 注册动态事件监听器
+func (ed *EventDispatcher) RegisterStoryListener(name string, handler EventHandler, priority int) {
+	listener := &Listener{
+		Type:     StoryListener,
+		Handler:  handler,
+		Priority: priority,
+		Name:     name,
+	}
+
+	ed.addListener(listener)
+	coreLog.Debugf("Registered story listener: %s", name)
+}
+
+// DispatchStory 将动态事件分发给动态监听器
+func (ed *EventDispatcher) DispatchStory(ctx context.Context, event *StoryEvent) error {
+	_, err := ed.dispatchToListeners(ctx, StoryListener, event)
+	return err
+}
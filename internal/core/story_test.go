@@ -0,0 +1,180 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+func videoDocument() *tg.MessageMediaDocument {
+	return &tg.MessageMediaDocument{Document: &tg.Document{Attributes: []tg.DocumentAttributeClass{
+		&tg.DocumentAttributeFilename{FileName: "story.mp4"},
+		&tg.DocumentAttributeVideo{W: 720, H: 1280},
+	}}}
+}
+
+// storyMedia 创建动态消息媒体，item 不为nil时像解码后的消息一样带上动态内容
+func storyMedia(authorID int64, storyID int, viaMention bool, item tg.StoryItemClass) *tg.MessageMediaStory {
+	media := &tg.MessageMediaStory{ViaMention: viaMention, Peer: &tg.PeerUser{UserID: authorID}, ID: storyID}
+	if item != nil {
+		media.SetStory(item)
+	}
+	return media
+}
+
+func TestParseStoryUpdate(t *testing.T) {
+	photoItem := &tg.StoryItem{ID: 5, Date: 1700000000, ExpireDate: 1700086400, Media: &tg.MessageMediaPhoto{}}
+	tests := []struct {
+		name   string
+		update tg.UpdateClass
+		ok     bool
+		want   StoryEvent // 不比较 Update 和 Item
+	}{
+		{
+			name:   "new photo story from a user",
+			update: &tg.UpdateStory{Peer: &tg.PeerUser{UserID: 42}, Story: photoItem},
+			ok:     true,
+			want:   StoryEvent{AuthorID: 42, StoryID: 5, MediaType: "photo", Date: time.Unix(1700000000, 0), Expires: time.Unix(1700086400, 0)},
+		},
+		{
+			name:   "video story from a channel",
+			update: &tg.UpdateStory{Peer: &tg.PeerChannel{ChannelID: 777}, Story: &tg.StoryItem{ID: 6, Media: videoDocument()}},
+			ok:     true,
+			want:   StoryEvent{AuthorID: -1000000000777, StoryID: 6, MediaType: "video", Date: time.Unix(0, 0), Expires: time.Unix(0, 0)},
+		},
+		{
+			name: "document story",
+			update: &tg.UpdateStory{Peer: &tg.PeerUser{UserID: 42}, Story: &tg.StoryItem{ID: 7,
+				Media: &tg.MessageMediaDocument{Document: &tg.Document{}}}},
+			ok:   true,
+			want: StoryEvent{AuthorID: 42, StoryID: 7, MediaType: "document", Date: time.Unix(0, 0), Expires: time.Unix(0, 0)},
+		},
+		{
+			name:   "skipped story has no media",
+			update: &tg.UpdateStory{Peer: &tg.PeerUser{UserID: 42}, Story: &tg.StoryItemSkipped{ID: 8, Date: 1700000000, ExpireDate: 1700086400}},
+			ok:     true,
+			want:   StoryEvent{AuthorID: 42, StoryID: 8, Date: time.Unix(1700000000, 0), Expires: time.Unix(1700086400, 0)},
+		},
+		{
+			name:   "deleted story",
+			update: &tg.UpdateStory{Peer: &tg.PeerUser{UserID: 42}, Story: &tg.StoryItemDeleted{ID: 9}},
+			ok:     true,
+			want:   StoryEvent{AuthorID: 42, StoryID: 9, Deleted: true},
+		},
+		{
+			name:   "story without a known author",
+			update: &tg.UpdateStory{Story: photoItem},
+		},
+		{
+			name:   "mention with story content",
+			update: &tg.UpdateNewMessage{Message: &tg.Message{ID: 1, Media: storyMedia(43, 5, true, photoItem)}},
+			ok:     true,
+			want:   StoryEvent{AuthorID: 43, StoryID: 5, MediaType: "photo", Date: time.Unix(1700000000, 0), Expires: time.Unix(1700086400, 0), Mention: true},
+		},
+		{
+			name: "mention without story content",
+			update: &tg.UpdateNewChannelMessage{Message: &tg.Message{ID: 1, Media: &tg.MessageMediaStory{
+				ViaMention: true, Peer: &tg.PeerUser{UserID: 43}, ID: 11,
+			}}},
+			ok:   true,
+			want: StoryEvent{AuthorID: 43, StoryID: 11, Mention: true},
+		},
+		{
+			name: "forwarded story is not a mention",
+			update: &tg.UpdateNewMessage{Message: &tg.Message{ID: 1, Media: &tg.MessageMediaStory{
+				Peer: &tg.PeerUser{UserID: 43}, ID: 5,
+			}}},
+		},
+		{
+			name: "outgoing mention",
+			update: &tg.UpdateNewMessage{Message: &tg.Message{ID: 1, Out: true, Media: &tg.MessageMediaStory{
+				ViaMention: true, Peer: &tg.PeerUser{UserID: 43}, ID: 5,
+			}}},
+		},
+		{
+			name:   "ordinary message",
+			update: &tg.UpdateNewMessage{Message: &tg.Message{ID: 1, Message: "hi"}},
+		},
+		{
+			name:   "service message",
+			update: &tg.UpdateNewMessage{Message: &tg.MessageService{ID: 1}},
+		},
+		{
+			name:   "unrelated update",
+			update: &tg.UpdateUserTyping{UserID: 42},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := ParseStoryUpdate(tt.update)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if event.Update != tt.update {
+				t.Error("Update should be the original update")
+			}
+			got := *event
+			got.Update, got.Item = nil, nil
+			if got != tt.want {
+				t.Errorf("event =\n%+v\nwant\n%+v", got, tt.want)
+			}
+			if event.HasMedia() != (tt.want.MediaType != "") {
+				t.Errorf("HasMedia = %v", event.HasMedia())
+			}
+		})
+	}
+}
+
+func TestStoryFromItemKeepsItem(t *testing.T) {
+	item := &tg.StoryItem{ID: 5, Caption: "hello", Pinned: true}
+	if event := StoryFromItem(item); event == nil || event.Item != item {
+		t.Errorf("StoryFromItem = %+v, want Item set", event)
+	}
+	if event := StoryFromItem(nil); event != nil {
+		t.Errorf("StoryFromItem(nil) = %+v, want nil", event)
+	}
+	if got := StoryMediaType(&tg.MessageMediaGeo{}); got != "other" {
+		t.Errorf("StoryMediaType(geo) = %q, want other", got)
+	}
+}
+
+func TestDispatchStory(t *testing.T) {
+	ed := NewEventDispatcher()
+	var log callLog
+	var received []*StoryEvent
+	ed.RegisterStoryListener("watch", func(_ context.Context, event interface{}) error {
+		received = append(received, event.(*StoryEvent))
+		return nil
+	}, 10)
+	ed.RegisterStoryListener("stopper", log.handler("stopper", ErrStopPropagation), 5)
+	ed.RegisterStoryListener("after-stop", log.handler("after-stop", nil), 0)
+	ed.RegisterRawListener("raw", log.handler("raw", nil), 0)
+	ed.RegisterMessageListener("all", "", log.handler("message", nil), 0)
+
+	event, _ := ParseStoryUpdate(&tg.UpdateStory{Peer: &tg.PeerUser{UserID: 42}, Story: &tg.StoryItem{ID: 5}})
+	if err := ed.DispatchStory(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 || received[0] != event {
+		t.Fatalf("story listener received %v", received)
+	}
+	// 动态事件只交给动态监听器，且同样可以停止传播
+	if got := log.get(); len(got) != 1 || got[0] != "stopper" {
+		t.Errorf("called %v, want only stopper", got)
+	}
+
+	// 其他类型的事件不会交给动态监听器
+	ed.DispatchRaw(context.Background(), event)
+	ed.DispatchMessage(context.Background(), selfMessage("hi"))
+	if len(received) != 1 {
+		t.Errorf("story listener received %d events, want 1", len(received))
+	}
+	if n := len(ed.GetListeners(StoryListener)); n != 3 {
+		t.Errorf("GetListeners(story) = %d, want 3", n)
+	}
+}
@@ -0,0 +1,256 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProgressInterval 两次进度编辑之间的最短间隔，避免触发FloodWait
+const DefaultProgressInterval = 3 * time.Second
+
+// StatusEditor 编辑任务状态消息
+type StatusEditor func(ctx context.Context, text string) error
+
+// ProgressFunc 任务报告进度。total为0时不显示进度条
+type ProgressFunc func(done, total int, note string)
+
+// TaskFunc 长时间运行的任务，需要在ctx取消时尽快返回。返回的文本附加在完成状态之后
+type TaskFunc func(ctx context.Context, progress ProgressFunc) (string, error)
+
+// TaskOptions 启动任务的选项
+type TaskOptions struct {
+	ChatID  int64
+	Name    string
+	Status  StatusEditor  // 为nil时不编辑状态消息，任务仍可被取消和列出
+	Timeout time.Duration // 0表示不限制
+}
+
+// Task 正在运行的任务
+type Task struct {
+	ID      int
+	ChatID  int64
+	Name    string
+	Started time.Time
+	cancel  context.CancelFunc
+
+	mutex    sync.Mutex
+	done     int
+	total    int
+	note     string
+	lastEdit time.Time
+}
+
+// Progress 返回最近一次报告的进度
+func (t *Task) Progress() (done, total int, note string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.done, t.total, t.note
+}
+
+// TaskRunner 统一管理长时间运行的命令：限频编辑进度、按对话登记任务以支持取消、
+// 并保证在完成、取消或panic时都有最终状态编辑
+type TaskRunner struct {
+	tasks    map[int]*Task
+	nextID   int
+	interval time.Duration
+	now      func() time.Time
+	mutex    sync.Mutex
+}
+
+// NewTaskRunner 创建任务管理器
+func NewTaskRunner() *TaskRunner {
+	return &TaskRunner{
+		tasks:    make(map[int]*Task),
+		interval: DefaultProgressInterval,
+		now:      time.Now,
+	}
+}
+
+// Start 在后台运行任务并立即返回
+func (r *TaskRunner) Start(parent context.Context, opts TaskOptions, fn TaskFunc) *Task {
+	task, ctx := r.register(parent, opts)
+	go r.execute(ctx, task, opts, fn)
+	return task
+}
+
+// Run 同步运行任务，返回任务的错误
+func (r *TaskRunner) Run(parent context.Context, opts TaskOptions, fn TaskFunc) error {
+	task, ctx := r.register(parent, opts)
+	return r.execute(ctx, task, opts, fn)
+}
+
+// register 登记任务并创建可取消的上下文
+func (r *TaskRunner) register(parent context.Context, opts TaskOptions) (*Task, context.Context) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, opts.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.nextID++
+	task := &Task{
+		ID:      r.nextID,
+		ChatID:  opts.ChatID,
+		Name:    opts.Name,
+		Started: r.now(),
+		cancel:  cancel,
+	}
+	r.tasks[task.ID] = task
+	return task, ctx
+}
+
+// execute 执行任务并进行最终状态编辑
+func (r *TaskRunner) execute(ctx context.Context, task *Task, opts TaskOptions, fn TaskFunc) (err error) {
+	var result string
+	defer func() {
+		if p := recover(); p != nil {
+			coreLog.Errorf("Task %s (#%d) panicked: %v", task.Name, task.ID, p)
+			err = fmt.Errorf("panic: %v", p)
+		}
+
+		r.mutex.Lock()
+		delete(r.tasks, task.ID)
+		r.mutex.Unlock()
+		task.cancel()
+
+		if opts.Status != nil {
+			// 任务上下文可能已被取消，最终编辑使用独立的上下文
+			editCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if editErr := opts.Status(editCtx, r.finalStatus(task, result, err)); editErr != nil {
+				coreLog.Warnf("Failed to edit final status of task %s (#%d): %v", task.Name, task.ID, editErr)
+			}
+		}
+	}()
+
+	progress := func(done, total int, note string) {
+		task.mutex.Lock()
+		task.done, task.total, task.note = done, total, note
+		now := r.now()
+		due := now.Sub(task.lastEdit) >= r.interval
+		if due {
+			task.lastEdit = now
+		}
+		task.mutex.Unlock()
+
+		if due && opts.Status != nil && ctx.Err() == nil {
+			if editErr := opts.Status(ctx, r.progressStatus(task)); editErr != nil {
+				coreLog.Debugf("Failed to edit progress of task %s (#%d): %v", task.Name, task.ID, editErr)
+			}
+		}
+	}
+
+	result, err = fn(ctx, progress)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// progressStatus 返回进行中的状态文本
+func (r *TaskRunner) progressStatus(task *Task) string {
+	done, total, note := task.Progress()
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("⏳ %s (#%d) 进行中 · %s", task.Name, task.ID, formatElapsed(r.now().Sub(task.Started))))
+	if total > 0 {
+		b.WriteString("\n" + ProgressBar(done, total, 10))
+	} else if done > 0 {
+		b.WriteString(fmt.Sprintf("\n已处理 %d", done))
+	}
+	if note != "" {
+		b.WriteString("\n" + note)
+	}
+	b.WriteString(fmt.Sprintf("\n使用 .cancel %d 取消", task.ID))
+	return b.String()
+}
+
+// finalStatus 返回任务结束时的状态文本
+func (r *TaskRunner) finalStatus(task *Task, result string, err error) string {
+	elapsed := formatElapsed(r.now().Sub(task.Started))
+	var status string
+	switch {
+	case err == nil:
+		status = fmt.Sprintf("✅ %s 完成 · 用时 %s", task.Name, elapsed)
+	case errors.Is(err, context.Canceled):
+		status = fmt.Sprintf("⛔ %s 已取消 · 用时 %s", task.Name, elapsed)
+	case errors.Is(err, context.DeadlineExceeded):
+		status = fmt.Sprintf("⌛ %s 超时 · 用时 %s", task.Name, elapsed)
+	default:
+		status = fmt.Sprintf("❌ %s 失败 · 用时 %s\n%v", task.Name, elapsed, err)
+	}
+	if result != "" {
+		status += "\n\n" + result
+	}
+	return status
+}
+
+// Cancel 取消指定对话中的任务，id为0时取消该对话最近启动的任务。返回被取消的任务
+func (r *TaskRunner) Cancel(chatID int64, id int) (*Task, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var target *Task
+	for _, task := range r.tasks {
+		if task.ChatID != chatID || (id != 0 && task.ID != id) {
+			continue
+		}
+		if target == nil || task.ID > target.ID {
+			target = task
+		}
+	}
+	if target == nil {
+		return nil, false
+	}
+	target.cancel()
+	return target, true
+}
+
+// List 返回对话中正在运行的任务，chatID为0时返回全部，按启动顺序排序
+func (r *TaskRunner) List(chatID int64) []*Task {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var tasks []*Task
+	for _, task := range r.tasks {
+		if chatID == 0 || task.ChatID == chatID {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks
+}
+
+// Age 返回任务已运行的时长
+func (r *TaskRunner) Age(task *Task) time.Duration {
+	return r.now().Sub(task.Started)
+}
+
+// ProgressBar 返回 [████░░░░░░] 40% (4/10) 形式的进度条
+func ProgressBar(done, total, width int) string {
+	if total <= 0 {
+		return ""
+	}
+	if done > total {
+		done = total
+	}
+	filled := done * width / total
+	return fmt.Sprintf("[%s%s] %d%% (%d/%d)",
+		strings.Repeat("█", filled), strings.Repeat("░", width-filled), done*100/total, done, total)
+}
+
+// formatElapsed 格式化经过的时间
+func formatElapsed(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	return d.Round(time.Second).String()
+}
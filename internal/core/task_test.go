@@ -0,0 +1,250 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// statusLog 记录状态消息的每次编辑
+type statusLog struct {
+	mu    sync.Mutex
+	edits []string
+	final chan string // 最终编辑(不含⏳的编辑)写入该通道
+}
+
+func newStatusLog() *statusLog {
+	return &statusLog{final: make(chan string, 1)}
+}
+
+func (s *statusLog) editor(ctx context.Context, text string) error {
+	s.mu.Lock()
+	s.edits = append(s.edits, text)
+	s.mu.Unlock()
+	if !strings.HasPrefix(text, "⏳") {
+		s.final <- text
+	}
+	return nil
+}
+
+func (s *statusLog) get() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.edits...)
+}
+
+func newTestRunner() (*TaskRunner, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	r := NewTaskRunner()
+	r.now = clock.Now
+	return r, clock
+}
+
+func TestTaskProgressCadence(t *testing.T) {
+	r, clock := newTestRunner()
+	status := newStatusLog()
+
+	err := r.Run(context.Background(), TaskOptions{ChatID: 1, Name: "scan", Status: status.editor}, func(ctx context.Context, progress ProgressFunc) (string, error) {
+		// 在 0s、1s、2s、3s、4s、6.5s 报告进度，间隔3秒时只有 0s、3s、6.5s 会编辑
+		for i, step := range []time.Duration{0, time.Second, time.Second, time.Second, time.Second, 2500 * time.Millisecond} {
+			clock.Advance(step)
+			progress(i+1, 10, "")
+		}
+		clock.Advance(500 * time.Millisecond)
+		return "共 6 项", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"⏳ scan (#1) 进行中 · 0s\n[█░░░░░░░░░] 10% (1/10)\n使用 .cancel 1 取消",
+		"⏳ scan (#1) 进行中 · 3s\n[████░░░░░░] 40% (4/10)\n使用 .cancel 1 取消",
+		"⏳ scan (#1) 进行中 · 6s\n[██████░░░░] 60% (6/10)\n使用 .cancel 1 取消",
+		"✅ scan 完成 · 用时 7s\n\n共 6 项",
+	}
+	if got := status.get(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("edits =\n%q\nwant\n%q", got, want)
+	}
+	if len(r.List(0)) != 0 {
+		t.Error("finished task is still listed")
+	}
+}
+
+func TestTaskProgressText(t *testing.T) {
+	r, clock := newTestRunner()
+	task, _ := r.register(context.Background(), TaskOptions{ChatID: 1, Name: "count"})
+	clock.Advance(90 * time.Second)
+
+	task.done, task.note = 12, "正在处理 a.txt"
+	if got, want := r.progressStatus(task), "⏳ count (#1) 进行中 · 1m30s\n已处理 12\n正在处理 a.txt\n使用 .cancel 1 取消"; got != want {
+		t.Errorf("progressStatus = %q, want %q", got, want)
+	}
+}
+
+func TestTaskCancel(t *testing.T) {
+	r, _ := newTestRunner()
+	status := newStatusLog()
+	started := make(chan struct{})
+	var edited bool
+
+	first := r.Start(context.Background(), TaskOptions{ChatID: 5, Name: "first"}, func(ctx context.Context, _ ProgressFunc) (string, error) {
+		<-ctx.Done()
+		return "", nil
+	})
+	second := r.Start(context.Background(), TaskOptions{ChatID: 5, Name: "second", Status: status.editor}, func(ctx context.Context, progress ProgressFunc) (string, error) {
+		close(started)
+		<-ctx.Done()
+		// 取消后不再编辑进度
+		progress(1, 2, "")
+		edited = len(status.get()) > 0
+		return "部分结果", nil
+	})
+	other := r.Start(context.Background(), TaskOptions{ChatID: 6, Name: "other"}, func(ctx context.Context, _ ProgressFunc) (string, error) {
+		<-ctx.Done()
+		return "", nil
+	})
+	<-started
+
+	if got := r.List(5); len(got) != 2 || got[0] != first || got[1] != second {
+		t.Fatalf("List(5) = %v", got)
+	}
+	if got := r.List(0); len(got) != 3 {
+		t.Fatalf("List(0) has %d tasks, want 3", len(got))
+	}
+	if _, ok := r.Cancel(7, 0); ok {
+		t.Error("Cancel in a chat without tasks should fail")
+	}
+	if _, ok := r.Cancel(6, second.ID); ok {
+		t.Error("Cancel must not cancel tasks of other chats")
+	}
+
+	// id为0时取消该对话最近启动的任务
+	if task, ok := r.Cancel(5, 0); !ok || task != second {
+		t.Fatalf("Cancel(5, 0) = %v, %v; want second", task, ok)
+	}
+	if got, want := <-status.final, "⛔ second 已取消 · 用时 0s\n\n部分结果"; got != want {
+		t.Errorf("final status = %q, want %q", got, want)
+	}
+	if edited {
+		t.Error("progress was edited after cancellation")
+	}
+
+	r.Cancel(5, first.ID)
+	r.Cancel(6, other.ID)
+}
+
+func TestTaskPanicFinalEdit(t *testing.T) {
+	r, clock := newTestRunner()
+	status := newStatusLog()
+	err := r.Run(context.Background(), TaskOptions{ChatID: 1, Name: "boom", Status: status.editor}, func(ctx context.Context, _ ProgressFunc) (string, error) {
+		clock.Advance(2 * time.Second)
+		panic("bad state")
+	})
+	if err == nil || err.Error() != "panic: bad state" {
+		t.Fatalf("Run = %v, want panic error", err)
+	}
+	if got, want := <-status.final, "❌ boom 失败 · 用时 2s\npanic: bad state"; got != want {
+		t.Errorf("final status = %q, want %q", got, want)
+	}
+	if len(r.List(0)) != 0 {
+		t.Error("panicked task is still listed")
+	}
+}
+
+func TestTaskFinalStatuses(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   TaskFunc
+		opts TaskOptions
+		want string
+		err  error
+	}{
+		{
+			name: "error",
+			fn:   func(context.Context, ProgressFunc) (string, error) { return "", errors.New("网络错误") },
+			want: "❌ job 失败 · 用时 0s\n网络错误",
+		},
+		{
+			name: "timeout",
+			fn: func(ctx context.Context, _ ProgressFunc) (string, error) {
+				<-ctx.Done()
+				return "", ctx.Err()
+			},
+			opts: TaskOptions{Timeout: 10 * time.Millisecond},
+			want: "⌛ job 超时 · 用时 0s",
+			err:  context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestRunner()
+			status := newStatusLog()
+			tt.opts.Name, tt.opts.Status = "job", status.editor
+			err := r.Run(context.Background(), tt.opts, tt.fn)
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Run = %v, want %v", err, tt.err)
+			}
+			if got := <-status.final; got != tt.want {
+				t.Errorf("final status = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	tests := []struct {
+		done, total, width int
+		want               string
+	}{
+		{4, 10, 10, "[████░░░░░░] 40% (4/10)"},
+		{1, 3, 10, "[███░░░░░░░] 33% (1/3)"},
+		{15, 10, 10, "[██████████] 100% (10/10)"},
+		{0, 5, 4, "[░░░░] 0% (0/5)"},
+		{3, 0, 10, ""},
+	}
+	for _, tt := range tests {
+		if got := ProgressBar(tt.done, tt.total, tt.width); got != tt.want {
+			t.Errorf("ProgressBar(%d, %d, %d) = %q, want %q", tt.done, tt.total, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestFormatElapsed(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{59900 * time.Millisecond, "59s"},
+		{90 * time.Second, "1m30s"},
+		{time.Hour + 2*time.Minute + 3600*time.Millisecond, "1h2m4s"},
+	}
+	for _, tt := range tests {
+		if got := formatElapsed(tt.d); got != tt.want {
+			t.Errorf("formatElapsed(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package deletion
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/pkg/logger"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxAttempts 删除失败的最多重试次数，超过后放弃
+	maxAttempts = 5
+	// retryDelay 删除失败后的重试间隔
+	retryDelay = 30 * time.Second
+	// maxIdle 没有待删除消息时的最长等待时间
+	maxIdle = time.Minute
+	// batchSize 每次取出的到期消息数量，同时也是单次删除请求的消息数上限
+	batchSize = 100
+)
+
+// Deleter 删除一个对话中的一批消息
+type Deleter func(ctx context.Context, chatID int64, ids []int) error
+
+// Scheduler 持久化的延迟删除服务。待删除的消息保存在数据库中，重启后继续执行，
+// 已过期的消息在启动时立即删除
+type Scheduler struct {
+	db      *sql.DB
+	deleter Deleter
+	mutex   sync.Mutex
+	wakeCh  chan struct{}
+	stopCh  chan struct{}
+	running bool
+
+	now func() time.Time
+}
+
+// NewScheduler 创建延迟删除服务
+func NewScheduler(db *sql.DB) *Scheduler {
+	s := &Scheduler{
+		db:     db,
+		wakeCh: make(chan struct{}, 1),
+		now:    time.Now,
+	}
+
+	if db != nil {
+		if err := s.initDatabase(); err != nil {
+			logger.Errorf("Failed to create pending_deletions table: %v", err)
+		}
+	}
+
+	return s
+}
+
+// initDatabase 初始化数据库表
+func (s *Scheduler) initDatabase() error {
+	_, err := s.db.Exec(`
+	CREATE TABLE IF NOT EXISTS pending_deletions (
+		chat_id INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		delete_at INTEGER NOT NULL,
+		source TEXT NOT NULL DEFAULT '',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (chat_id, message_id)
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("CREATE INDEX IF NOT EXISTS idx_pending_deletions_delete_at ON pending_deletions(delete_at)")
+	return err
+}
+
+// Schedule 安排在at时刻删除消息。同一条消息重复安排时以最后一次为准
+func (s *Scheduler) Schedule(chatID int64, ids []int, at time.Time, source string) error {
+	if s.db == nil {
+		return fmt.Errorf("database not available")
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`
+	INSERT INTO pending_deletions (chat_id, message_id, delete_at, source, attempts)
+	VALUES (?, ?, ?, ?, 0)
+	ON CONFLICT(chat_id, message_id) DO UPDATE SET delete_at = excluded.delete_at, source = excluded.source, attempts = 0`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, id := range ids {
+		if _, err := stmt.Exec(chatID, id, at.Unix(), source); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.wake()
+	return nil
+}
+
+// Cancel 取消消息的删除安排
+func (s *Scheduler) Cancel(chatID int64, ids []int) error {
+	if s.db == nil || len(ids) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := []interface{}{chatID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	_, err := s.db.Exec("DELETE FROM pending_deletions WHERE chat_id = ? AND message_id IN ("+placeholders+")", args...)
+	return err
+}
+
+// Scheduled 返回消息是否已安排删除
+func (s *Scheduler) Scheduled(chatID int64, id int) bool {
+	if s.db == nil {
+		return false
+	}
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM pending_deletions WHERE chat_id = ? AND message_id = ?", chatID, id).Scan(&n)
+	return err == nil && n > 0
+}
+
+// Pending 返回待删除的消息数量。chatID为0时统计所有对话，source为空时不限来源
+func (s *Scheduler) Pending(chatID int64, source string) (int, error) {
+	if s.db == nil {
+		return 0, fmt.Errorf("database not available")
+	}
+	query := "SELECT COUNT(*) FROM pending_deletions WHERE 1 = 1"
+	var args []interface{}
+	if chatID != 0 {
+		query += " AND chat_id = ?"
+		args = append(args, chatID)
+	}
+	if source != "" {
+		query += " AND source = ?"
+		args = append(args, source)
+	}
+	var n int
+	err := s.db.QueryRow(query, args...).Scan(&n)
+	return n, err
+}
+
+// Start 使用deleter启动删除循环，重复调用只更新deleter
+func (s *Scheduler) Start(deleter Deleter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.deleter = deleter
+	if s.running || s.db == nil {
+		return
+	}
+	s.running = true
+	s.stopCh = make(chan struct{})
+	go s.loop(s.stopCh)
+}
+
+// Stop 停止删除循环，未执行的删除保留在数据库中
+func (s *Scheduler) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.running {
+		return
+	}
+	close(s.stopCh)
+	s.running = false
+}
+
+// wake 唤醒删除循环重新计算下一次到期时间
+func (s *Scheduler) wake() {
+	select {
+	case s.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// loop 等待到期时间并执行删除
+func (s *Scheduler) loop(stopCh chan struct{}) {
+	for {
+		s.runDue()
+
+		wait := maxIdle
+		if next, ok := s.nextDue(); ok {
+			if d := next.Sub(s.now()); d < wait {
+				wait = d
+			}
+		}
+		if wait < 0 {
+			wait = 0
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-stopCh:
+			timer.Stop()
+			return
+		case <-s.wakeCh:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// nextDue 返回最早的到期时间
+func (s *Scheduler) nextDue() (time.Time, bool) {
+	var at sql.NullInt64
+	if err := s.db.QueryRow("SELECT MIN(delete_at) FROM pending_deletions").Scan(&at); err != nil || !at.Valid {
+		return time.Time{}, false
+	}
+	return time.Unix(at.Int64, 0), true
+}
+
+// runDue 删除所有已到期的消息，按对话分批执行
+func (s *Scheduler) runDue() {
+	s.mutex.Lock()
+	deleter := s.deleter
+	s.mutex.Unlock()
+	if deleter == nil {
+		return
+	}
+
+	for {
+		due, err := s.due()
+		if err != nil {
+			logger.Errorf("Failed to load pending deletions: %v", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+
+		for chatID, ids := range due {
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			err := deleter(ctx, chatID, ids)
+			cancel()
+			if err != nil {
+				logger.Warnf("Failed to delete %d messages in chat %d: %v", len(ids), chatID, err)
+				s.retry(chatID, ids)
+				continue
+			}
+			if err := s.Cancel(chatID, ids); err != nil {
+				logger.Errorf("Failed to remove pending deletions: %v", err)
+				return
+			}
+			logger.Debugf("Deleted %d scheduled messages in chat %d", len(ids), chatID)
+		}
+	}
+}
+
+// due 取出一批已到期的消息，按对话分组
+func (s *Scheduler) due() (map[int64][]int, error) {
+	rows, err := s.db.Query("SELECT chat_id, message_id FROM pending_deletions WHERE delete_at <= ? ORDER BY delete_at LIMIT ?", s.now().Unix(), batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	due := make(map[int64][]int)
+	for rows.Next() {
+		var chatID int64
+		var id int
+		if err := rows.Scan(&chatID, &id); err != nil {
+			return nil, err
+		}
+		due[chatID] = append(due[chatID], id)
+	}
+	return due, rows.Err()
+}
+
+// retry 推迟删除失败的消息，超过重试次数后放弃
+func (s *Scheduler) retry(chatID int64, ids []int) {
+	for _, id := range ids {
+		if _, err := s.db.Exec("UPDATE pending_deletions SET attempts = attempts + 1, delete_at = ? WHERE chat_id = ? AND message_id = ?",
+			s.now().Add(retryDelay).Unix(), chatID, id); err != nil {
+			logger.Errorf("Failed to reschedule deletion: %v", err)
+		}
+	}
+	if res, err := s.db.Exec("DELETE FROM pending_deletions WHERE chat_id = ? AND attempts >= ?", chatID, maxAttempts); err == nil {
+		if n, _ := res.RowsAffected(); n > 0 {
+			logger.Warnf("Gave up deleting %d messages in chat %d after %d attempts", n, chatID, maxAttempts)
+		}
+	}
+}
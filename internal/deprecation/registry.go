@@ -0,0 +1,251 @@
+package deprecation
+
+import (
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/version"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultGrace 弃用项在被移除前保留的次版本数
+const DefaultGrace = 2
+
+// Kind 弃用项的类型
+type Kind string
+
+const (
+	Command   Kind = "command"
+	ConfigKey Kind = "config"
+)
+
+// Entry 一个弃用项。FirstVersion 为首次带着该弃用项运行的版本，移除时间从这里开始计算
+type Entry struct {
+	Kind         Kind
+	Old          string
+	New          string
+	FirstVersion string
+	Uses         int64
+	LastUsed     time.Time
+}
+
+// Registry 记录已声明的弃用项及其使用情况，并限制弃用提示的频率
+type Registry struct {
+	db       *sql.DB
+	grace    int
+	entries  map[string]*Entry
+	notified map[string]string // 对话+弃用项 -> 最近一次提示的日期
+	mutex    sync.Mutex
+
+	now     func() time.Time
+	current func() string
+}
+
+// NewRegistry 创建弃用项注册表，db为nil时只在内存中记录
+func NewRegistry(db *sql.DB) *Registry {
+	r := &Registry{
+		db:       db,
+		grace:    DefaultGrace,
+		entries:  make(map[string]*Entry),
+		notified: make(map[string]string),
+		now:      time.Now,
+		current:  version.String,
+	}
+
+	if db != nil {
+		if err := r.initDatabase(); err != nil {
+			logger.Errorf("Failed to create deprecations table: %v", err)
+		} else if err := r.load(); err != nil {
+			logger.Errorf("Failed to load deprecations: %v", err)
+		}
+	}
+
+	return r
+}
+
+// initDatabase 初始化数据库表
+func (r *Registry) initDatabase() error {
+	_, err := r.db.Exec(`
+	CREATE TABLE IF NOT EXISTS deprecations (
+		kind TEXT NOT NULL,
+		old_name TEXT NOT NULL,
+		first_version TEXT NOT NULL,
+		uses INTEGER NOT NULL DEFAULT 0,
+		last_used INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (kind, old_name)
+	)`)
+	return err
+}
+
+// load 从数据库加载已记录的弃用项，新名称在声明时补全
+func (r *Registry) load() error {
+	rows, err := r.db.Query("SELECT kind, old_name, first_version, uses, last_used FROM deprecations")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e Entry
+		var lastUsed int64
+		if err := rows.Scan(&e.Kind, &e.Old, &e.FirstVersion, &e.Uses, &lastUsed); err != nil {
+			return err
+		}
+		if lastUsed > 0 {
+			e.LastUsed = time.Unix(lastUsed, 0)
+		}
+		r.entries[key(e.Kind, e.Old)] = &e
+	}
+	return rows.Err()
+}
+
+// key 弃用项在map中的键
+func key(kind Kind, old string) string {
+	return string(kind) + ":" + old
+}
+
+// SetGrace 设置弃用项保留的次版本数
+func (r *Registry) SetGrace(n int) {
+	if n <= 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.grace = n
+}
+
+// Declare 声明一个弃用项。返回false表示已超过保留期限，调用方不应再提供兼容
+func (r *Registry) Declare(kind Kind, old, newName string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	current := r.current()
+	k := key(kind, old)
+	e, ok := r.entries[k]
+	if !ok {
+		e = &Entry{Kind: kind, Old: old}
+		r.entries[k] = e
+	}
+	e.New = newName
+
+	// 开发版本无法比较，等到第一个正式版本再开始计算
+	if (e.FirstVersion == "" || !version.Valid(e.FirstVersion)) && version.Valid(current) {
+		e.FirstVersion = current
+		r.save(e)
+	} else if e.FirstVersion == "" {
+		e.FirstVersion = current
+	}
+
+	if r.expiredLocked(e) {
+		logger.Warnf("Deprecated %s %q was removed in %s, use %q instead", kind, old, r.removalLocked(e), newName)
+		return false
+	}
+	return true
+}
+
+// Observe 记录一次弃用项的使用
+func (r *Registry) Observe(kind Kind, old string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	e, ok := r.entries[key(kind, old)]
+	if !ok {
+		return
+	}
+	e.Uses++
+	e.LastUsed = r.now()
+	r.save(e)
+}
+
+// Lookup 查找弃用项
+func (r *Registry) Lookup(kind Kind, old string) (Entry, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	e, ok := r.entries[key(kind, old)]
+	if !ok || e.New == "" {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// ShouldNotify 同一对话中每个弃用项每天最多提示一次，需要提示时返回true并记录
+func (r *Registry) ShouldNotify(chatID int64, kind Kind, old string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	day := r.now().Format("2006-01-02")
+	k := fmt.Sprintf("%s@%d", key(kind, old), chatID)
+	if r.notified[k] == day {
+		return false
+	}
+	r.notified[k] = day
+	return true
+}
+
+// Removal 弃用项计划移除的版本，首次版本无法解析时返回空字符串
+func (r *Registry) Removal(e Entry) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.removalLocked(&e)
+}
+
+// Entries 返回已声明的弃用项，usedOnly为true时只返回实际使用过的
+func (r *Registry) Entries(usedOnly bool) []Entry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var entries []Entry
+	for _, e := range r.entries {
+		// 数据库中有记录但本次运行未声明的弃用项已被移除
+		if e.New == "" || (usedOnly && e.Uses == 0) {
+			continue
+		}
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Old < entries[j].Old
+	})
+	return entries
+}
+
+// removalLocked 计算移除版本，调用方需持有锁
+func (r *Registry) removalLocked(e *Entry) string {
+	v, ok := version.BumpMinor(e.FirstVersion, r.grace)
+	if !ok {
+		return ""
+	}
+	return v
+}
+
+// expiredLocked 当前版本是否已达到移除版本，调用方需持有锁
+func (r *Registry) expiredLocked(e *Entry) bool {
+	removal := r.removalLocked(e)
+	current := r.current()
+	if removal == "" || !version.Valid(current) {
+		return false
+	}
+	return version.Compare(current, removal) >= 0
+}
+
+// save 保存弃用项，调用方需持有锁
+func (r *Registry) save(e *Entry) {
+	if r.db == nil {
+		return
+	}
+	var lastUsed int64
+	if !e.LastUsed.IsZero() {
+		lastUsed = e.LastUsed.Unix()
+	}
+	_, err := r.db.Exec(`INSERT INTO deprecations (kind, old_name, first_version, uses, last_used) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(kind, old_name) DO UPDATE SET first_version = excluded.first_version, uses = excluded.uses, last_used = excluded.last_used`,
+		string(e.Kind), e.Old, e.FirstVersion, e.Uses, lastUsed)
+	if err != nil {
+		logger.Errorf("Failed to save deprecation %s %q: %v", e.Kind, e.Old, err)
+	}
+}
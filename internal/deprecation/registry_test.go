@@ -0,0 +1,196 @@
+package deprecation
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// testClock 可以手动调整的时间和版本
+type testClock struct {
+	now     time.Time
+	version string
+}
+
+// newTestRegistry 创建使用 clock 的时间和版本的注册表
+func newTestRegistry(db *sql.DB, clock *testClock) *Registry {
+	r := NewRegistry(db)
+	r.now = func() time.Time { return clock.now }
+	r.current = func() string { return clock.version }
+	return r
+}
+
+// openTestDB 打开测试用的临时数据库
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "deprecations.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestShouldNotifyOncePerChatPerDay(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local), version: "v1.2.0"}
+	r := newTestRegistry(nil, clock)
+	r.Declare(Command, "st", "speedtest")
+	r.Declare(Command, "old", "new")
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		chatID  int64
+		old     string
+		want    bool
+	}{
+		{"first use", 0, -100, "st", true},
+		{"same chat same day", time.Hour, -100, "st", false},
+		{"late the same day", 13*time.Hour + 59*time.Minute, -100, "st", false},
+		{"other chat", 0, -200, "st", true},
+		{"other entry", 0, -100, "old", true},
+		{"after midnight", 2 * time.Minute, -100, "st", true}, // 次日 00:01
+		{"again the next day", 10 * time.Hour, -100, "st", false},
+		{"other chat keeps its own day", 0, -200, "st", true},
+		{"a week later", 7 * 24 * time.Hour, -100, "st", true},
+	}
+	for _, s := range steps {
+		clock.now = clock.now.Add(s.advance)
+		if got := r.ShouldNotify(s.chatID, Command, s.old); got != s.want {
+			t.Errorf("%s (%s, chat %d): ShouldNotify = %v, want %v", s.name, clock.now.Format("01-02 15:04"), s.chatID, got, s.want)
+		}
+	}
+
+	// 同名的命令和配置项分别计算
+	if !r.ShouldNotify(-100, ConfigKey, "st") {
+		t.Error("config entry with the same name should be throttled separately")
+	}
+}
+
+func TestDeclareRemovalVersion(t *testing.T) {
+	db := openTestDB(t)
+	clock := &testClock{now: time.Now(), version: "v1.2.3"}
+	r := newTestRegistry(db, clock)
+
+	if !r.Declare(Command, "st", "speedtest") {
+		t.Fatal("new deprecation should be kept")
+	}
+	e, ok := r.Lookup(Command, "st")
+	if !ok || e.New != "speedtest" || e.FirstVersion != "v1.2.3" {
+		t.Fatalf("Lookup = %+v, %v", e, ok)
+	}
+	if got := r.Removal(e); got != "v1.4.0" {
+		t.Errorf("Removal = %q, want v1.4.0", got)
+	}
+
+	// 首次版本在重启后保留，达到移除版本时不再提供兼容
+	tests := []struct {
+		version string
+		kept    bool
+	}{
+		{"v1.2.9", true},
+		{"v1.3.5", true},
+		{"v1.4.0-rc1", false},
+		{"v1.4.0", false},
+		{"v2.0.0", false},
+		{"dev", true}, // 开发版本无法比较
+	}
+	for _, tt := range tests {
+		clock.version = tt.version
+		restarted := newTestRegistry(db, clock)
+		if got := restarted.Declare(Command, "st", "speedtest"); got != tt.kept {
+			t.Errorf("version %s: Declare = %v, want %v", tt.version, got, tt.kept)
+		}
+		if e, _ := restarted.Lookup(Command, "st"); e.FirstVersion != "v1.2.3" {
+			t.Errorf("version %s: FirstVersion = %q, want v1.2.3", tt.version, e.FirstVersion)
+		}
+	}
+}
+
+func TestDeclareGrace(t *testing.T) {
+	clock := &testClock{version: "v1.2.3"}
+	r := newTestRegistry(nil, clock)
+	r.SetGrace(1)
+	r.SetGrace(0) // 忽略无效值
+	r.Declare(Command, "st", "speedtest")
+	e, _ := r.Lookup(Command, "st")
+	if got := r.Removal(e); got != "v1.3.0" {
+		t.Errorf("Removal with grace 1 = %q, want v1.3.0", got)
+	}
+	clock.version = "v1.3.0"
+	if r.Declare(Command, "st", "speedtest") {
+		t.Error("deprecation should expire after one minor release")
+	}
+}
+
+func TestDeclareDevVersion(t *testing.T) {
+	db := openTestDB(t)
+	clock := &testClock{version: "dev"}
+	r := newTestRegistry(db, clock)
+
+	// 开发版本不开始计算移除时间
+	if !r.Declare(Command, "st", "speedtest") {
+		t.Fatal("declare on dev should be kept")
+	}
+	e, _ := r.Lookup(Command, "st")
+	if e.FirstVersion != "dev" || r.Removal(e) != "" {
+		t.Errorf("dev entry = %+v, removal %q", e, r.Removal(e))
+	}
+
+	// 第一个正式版本开始计算并保存
+	clock.version = "v1.5.0"
+	r = newTestRegistry(db, clock)
+	r.Declare(Command, "st", "speedtest")
+	e, _ = r.Lookup(Command, "st")
+	if e.FirstVersion != "v1.5.0" || r.Removal(e) != "v1.7.0" {
+		t.Errorf("entry = %+v, removal %q", e, r.Removal(e))
+	}
+}
+
+func TestObserveAndEntries(t *testing.T) {
+	db := openTestDB(t)
+	clock := &testClock{now: time.Date(2026, 3, 1, 9, 30, 0, 0, time.Local), version: "v1.0.0"}
+	r := newTestRegistry(db, clock)
+	r.Declare(Command, "st", "speedtest")
+	r.Declare(Command, "aaa", "bbb")
+	r.Declare(ConfigKey, "bot.prefix", "bot.command_prefix")
+
+	r.Observe(Command, "st")
+	clock.now = clock.now.Add(time.Minute)
+	r.Observe(Command, "st")
+	r.Observe(ConfigKey, "bot.prefix")
+	r.Observe(Command, "undeclared") // 未声明的弃用项不记录
+
+	names := func(entries []Entry) []string {
+		var out []string
+		for _, e := range entries {
+			out = append(out, string(e.Kind)+":"+e.Old)
+		}
+		return out
+	}
+	if got := names(r.Entries(true)); !reflect.DeepEqual(got, []string{"command:st", "config:bot.prefix"}) {
+		t.Errorf("used entries = %q", got)
+	}
+	if got := names(r.Entries(false)); !reflect.DeepEqual(got, []string{"command:aaa", "command:st", "config:bot.prefix"}) {
+		t.Errorf("all entries = %q", got)
+	}
+
+	// 使用次数在重启后保留；本次运行未声明的弃用项视为已移除
+	restarted := newTestRegistry(db, clock)
+	restarted.Declare(Command, "st", "speedtest")
+	if got := names(restarted.Entries(false)); !reflect.DeepEqual(got, []string{"command:st"}) {
+		t.Errorf("entries after restart = %q", got)
+	}
+	e, ok := restarted.Lookup(Command, "st")
+	if !ok || e.Uses != 2 || !e.LastUsed.Equal(clock.now.Truncate(time.Second)) {
+		t.Errorf("restored entry = %+v", e)
+	}
+	if _, ok := restarted.Lookup(Command, "aaa"); ok {
+		t.Error("undeclared entry should not be found")
+	}
+}
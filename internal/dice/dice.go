@@ -0,0 +1,372 @@
+package dice
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxDice 一次掷骰的最大骰子总数
+	MaxDice = 100
+	// MaxSides 骰子的最大面数
+	MaxSides = 1000
+	// MaxTerms 表达式的最大项数
+	MaxTerms = 20
+	// MaxModifier 常数修正值的最大绝对值
+	MaxModifier = 1000000
+	// ShowDiceLimit 骰子总数不超过该值时显示每颗骰子的结果
+	ShowDiceLimit = 10
+)
+
+// Mode 优势/劣势模式
+type Mode int
+
+const (
+	Normal Mode = iota
+	Advantage
+	Disadvantage
+)
+
+// Term 表达式中的一项：Sides>0 时为 Count 颗 Sides 面骰，否则为常数 Value
+type Term struct {
+	Count    int
+	Sides    int
+	Value    int
+	Negative bool
+}
+
+// IsDice 是否为骰子项
+func (t Term) IsDice() bool {
+	return t.Sides > 0
+}
+
+// String 返回该项的规范写法(不含符号)
+func (t Term) String() string {
+	if t.IsDice() {
+		return fmt.Sprintf("%dd%d", t.Count, t.Sides)
+	}
+	return strconv.Itoa(t.Value)
+}
+
+// Expr 解析后的掷骰表达式
+type Expr struct {
+	Terms []Term
+	Mode  Mode
+}
+
+// DiceCount 表达式中骰子的总数
+func (e *Expr) DiceCount() int {
+	n := 0
+	for _, t := range e.Terms {
+		if t.IsDice() {
+			n += t.Count
+		}
+	}
+	return n
+}
+
+// String 返回表达式的规范写法，例如 "3d6+2 优势"
+func (e *Expr) String() string {
+	var b strings.Builder
+	for i, t := range e.Terms {
+		switch {
+		case t.Negative:
+			b.WriteString("-")
+		case i > 0:
+			b.WriteString("+")
+		}
+		b.WriteString(t.String())
+	}
+	switch e.Mode {
+	case Advantage:
+		b.WriteString(" 优势")
+	case Disadvantage:
+		b.WriteString(" 劣势")
+	}
+	return b.String()
+}
+
+// modeKeywords 优势/劣势关键字
+var modeKeywords = map[string]Mode{
+	"adv":          Advantage,
+	"advantage":    Advantage,
+	"优势":           Advantage,
+	"dis":          Disadvantage,
+	"disadv":       Disadvantage,
+	"disadvantage": Disadvantage,
+	"劣势":           Disadvantage,
+}
+
+// Parse 解析掷骰表达式。支持 NdM、dM、d%、常数修正值及其加减组合，
+// 以及 adv/dis(优势/劣势) 关键字。空表达式等同于 1d100，单个整数N等同于 1dN
+func Parse(input string) (*Expr, error) {
+	expr := &Expr{}
+	var parts []string
+	for _, field := range strings.Fields(input) {
+		if mode, ok := modeKeywords[strings.ToLower(field)]; ok {
+			if expr.Mode != Normal && expr.Mode != mode {
+				return nil, fmt.Errorf("不能同时使用优势和劣势")
+			}
+			expr.Mode = mode
+			continue
+		}
+		parts = append(parts, field)
+	}
+	text := strings.ToLower(strings.Join(parts, ""))
+
+	if text == "" {
+		expr.Terms = []Term{{Count: 1, Sides: 100}}
+		return expr, nil
+	}
+	if n, err := strconv.Atoi(text); err == nil {
+		if n < 2 {
+			return nil, fmt.Errorf("骰子至少需要2面")
+		}
+		if n > MaxSides {
+			return nil, fmt.Errorf("骰子最多 %d 面", MaxSides)
+		}
+		expr.Terms = []Term{{Count: 1, Sides: n}}
+		return expr, nil
+	}
+
+	pos := 0
+	for pos < len(text) {
+		term := Term{}
+		if pos > 0 || text[pos] == '+' || text[pos] == '-' {
+			switch text[pos] {
+			case '+':
+			case '-':
+				term.Negative = true
+			default:
+				return nil, fmt.Errorf("无法识别的字符 %q", text[pos:pos+1])
+			}
+			pos++
+		}
+
+		end := pos
+		for end < len(text) && text[end] != '+' && text[end] != '-' {
+			end++
+		}
+		if err := parseTerm(text[pos:end], &term); err != nil {
+			return nil, err
+		}
+		expr.Terms = append(expr.Terms, term)
+		if len(expr.Terms) > MaxTerms {
+			return nil, fmt.Errorf("表达式最多 %d 项", MaxTerms)
+		}
+		pos = end
+	}
+
+	hasDice := false
+	for _, t := range expr.Terms {
+		if t.IsDice() {
+			hasDice = true
+		}
+	}
+	if !hasDice {
+		return nil, fmt.Errorf("表达式中没有骰子")
+	}
+	if n := expr.DiceCount(); n > MaxDice {
+		return nil, fmt.Errorf("骰子太多了(%d)，一次最多掷 %d 颗", n, MaxDice)
+	}
+	return expr, nil
+}
+
+// parseTerm 解析单项，text 不含符号
+func parseTerm(text string, term *Term) error {
+	if text == "" {
+		return fmt.Errorf("表达式不完整")
+	}
+
+	d := strings.IndexByte(text, 'd')
+	if d < 0 {
+		value, err := parseNumber(text)
+		if err != nil {
+			return fmt.Errorf("无效的修正值 %q", text)
+		}
+		if value > MaxModifier {
+			return fmt.Errorf("修正值最大为 %d", MaxModifier)
+		}
+		term.Value = value
+		return nil
+	}
+
+	count := 1
+	if d > 0 {
+		n, err := parseNumber(text[:d])
+		if err != nil {
+			return fmt.Errorf("无效的骰子数量 %q", text[:d])
+		}
+		count = n
+	}
+	if count < 1 {
+		return fmt.Errorf("至少掷1颗骰子")
+	}
+	if count > MaxDice {
+		return fmt.Errorf("骰子太多了(%d)，一次最多掷 %d 颗", count, MaxDice)
+	}
+
+	sidesText := text[d+1:]
+	var sides int
+	if sidesText == "%" {
+		sides = 100
+	} else {
+		n, err := parseNumber(sidesText)
+		if err != nil {
+			return fmt.Errorf("无效的骰子面数 %q", sidesText)
+		}
+		sides = n
+	}
+	if sides < 2 {
+		return fmt.Errorf("骰子至少需要2面")
+	}
+	if sides > MaxSides {
+		return fmt.Errorf("骰子最多 %d 面", MaxSides)
+	}
+
+	term.Count = count
+	term.Sides = sides
+	return nil
+}
+
+// parseNumber 解析只包含数字的非负整数，过长的数字视为无效
+func parseNumber(text string) (int, error) {
+	if text == "" || len(text) > 9 {
+		return 0, fmt.Errorf("invalid number")
+	}
+	for _, c := range text {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid number")
+		}
+	}
+	return strconv.Atoi(text)
+}
+
+// Attempt 一轮掷骰的结果，Dice 与表达式的项一一对应，常数项为nil
+type Attempt struct {
+	Dice  [][]int
+	Total int
+}
+
+// Result 掷骰结果。优势/劣势模式下有两轮，Chosen 为采用的一轮
+type Result struct {
+	Expr     *Expr
+	Attempts []Attempt
+	Chosen   int
+}
+
+// Total 采用的总点数
+func (r *Result) Total() int {
+	return r.Attempts[r.Chosen].Total
+}
+
+// Roll 按表达式掷骰
+func (e *Expr) Roll(src *Source) (*Result, error) {
+	rounds := 1
+	if e.Mode != Normal {
+		rounds = 2
+	}
+
+	result := &Result{Expr: e}
+	for i := 0; i < rounds; i++ {
+		attempt := Attempt{Dice: make([][]int, len(e.Terms))}
+		for j, t := range e.Terms {
+			sign := 1
+			if t.Negative {
+				sign = -1
+			}
+			if !t.IsDice() {
+				attempt.Total += sign * t.Value
+				continue
+			}
+			rolls := make([]int, t.Count)
+			for k := range rolls {
+				n, err := src.Intn(t.Sides)
+				if err != nil {
+					return nil, err
+				}
+				rolls[k] = n + 1
+				attempt.Total += sign * rolls[k]
+			}
+			attempt.Dice[j] = rolls
+		}
+		result.Attempts = append(result.Attempts, attempt)
+	}
+
+	if len(result.Attempts) == 2 {
+		a, b := result.Attempts[0].Total, result.Attempts[1].Total
+		if (e.Mode == Advantage && b > a) || (e.Mode == Disadvantage && b < a) {
+			result.Chosen = 1
+		}
+	}
+	return result, nil
+}
+
+// Format 格式化掷骰结果，骰子不超过 ShowDiceLimit 颗时列出每颗骰子的点数
+func (r *Result) Format() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "🎲 %s", r.Expr.String())
+	showDice := r.Expr.DiceCount() <= ShowDiceLimit
+	for i, a := range r.Attempts {
+		b.WriteString("\n")
+		if len(r.Attempts) > 1 {
+			if i == r.Chosen {
+				b.WriteString("✅ ")
+			} else {
+				b.WriteString("▫️ ")
+			}
+		}
+		if showDice && (len(r.Expr.Terms) > 1 || r.Expr.DiceCount() > 1) {
+			b.WriteString(r.formatDetail(a))
+			b.WriteString(" = ")
+		}
+		fmt.Fprintf(&b, "%d", a.Total)
+	}
+	if len(r.Attempts) > 1 {
+		fmt.Fprintf(&b, "\n结果: %d", r.Total())
+	}
+	return b.String()
+}
+
+// formatDetail 格式化一轮中每一项的点数，例如 "[3, 5, 1] + 2"
+func (r *Result) formatDetail(a Attempt) string {
+	var b strings.Builder
+	for i, t := range r.Expr.Terms {
+		switch {
+		case t.Negative:
+			if i > 0 {
+				b.WriteString(" - ")
+			} else {
+				b.WriteString("-")
+			}
+		case i > 0:
+			b.WriteString(" + ")
+		}
+		if !t.IsDice() {
+			b.WriteString(strconv.Itoa(t.Value))
+			continue
+		}
+		parts := make([]string, len(a.Dice[i]))
+		for k, v := range a.Dice[i] {
+			parts[k] = strconv.Itoa(v)
+		}
+		b.WriteString("[" + strings.Join(parts, ", ") + "]")
+	}
+	return b.String()
+}
+
+// SplitOptions 拆分 .choose 的选项：有 | 时按 | 分隔，否则按行分隔，忽略空选项
+func SplitOptions(text string) []string {
+	sep := "\n"
+	if strings.Contains(text, "|") {
+		sep = "|"
+	}
+	var options []string
+	for _, opt := range strings.Split(text, sep) {
+		if opt = strings.TrimSpace(opt); opt != "" {
+			options = append(options, opt)
+		}
+	}
+	return options
+}
@@ -0,0 +1,198 @@
+package dice
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in    string
+		terms []Term
+		mode  Mode
+		str   string
+	}{
+		{"", []Term{{Count: 1, Sides: 100}}, Normal, "1d100"},
+		{"   ", []Term{{Count: 1, Sides: 100}}, Normal, "1d100"},
+		{"20", []Term{{Count: 1, Sides: 20}}, Normal, "1d20"},
+		{"d20", []Term{{Count: 1, Sides: 20}}, Normal, "1d20"},
+		{"d%", []Term{{Count: 1, Sides: 100}}, Normal, "1d100"},
+		{"3d6+2", []Term{{Count: 3, Sides: 6}, {Value: 2}}, Normal, "3d6+2"},
+		{"3D6 + 2", []Term{{Count: 3, Sides: 6}, {Value: 2}}, Normal, "3d6+2"},
+		{"2d8+1d4-1", []Term{{Count: 2, Sides: 8}, {Count: 1, Sides: 4}, {Value: 1, Negative: true}}, Normal, "2d8+1d4-1"},
+		{"-1+d6", []Term{{Value: 1, Negative: true}, {Count: 1, Sides: 6}}, Normal, "-1+1d6"},
+		{"+d6", []Term{{Count: 1, Sides: 6}}, Normal, "1d6"},
+		{"d6-d6", []Term{{Count: 1, Sides: 6}, {Count: 1, Sides: 6, Negative: true}}, Normal, "1d6-1d6"},
+		{"d20+0", []Term{{Count: 1, Sides: 20}, {Value: 0}}, Normal, "1d20+0"},
+		{"100d1000", []Term{{Count: 100, Sides: 1000}}, Normal, "100d1000"},
+		{"d20+1000000", []Term{{Count: 1, Sides: 20}, {Value: 1000000}}, Normal, "1d20+1000000"},
+		{"d20 adv", []Term{{Count: 1, Sides: 20}}, Advantage, "1d20 优势"},
+		{"ADV d20", []Term{{Count: 1, Sides: 20}}, Advantage, "1d20 优势"},
+		{"d20 advantage adv", []Term{{Count: 1, Sides: 20}}, Advantage, "1d20 优势"},
+		{"d20+5 dis", []Term{{Count: 1, Sides: 20}, {Value: 5}}, Disadvantage, "1d20+5 劣势"},
+		{"d20 disadv", []Term{{Count: 1, Sides: 20}}, Disadvantage, "1d20 劣势"},
+		{"d20 优势", []Term{{Count: 1, Sides: 20}}, Advantage, "1d20 优势"},
+		{"劣势", []Term{{Count: 1, Sides: 100}}, Disadvantage, "1d100 劣势"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			expr, err := Parse(tt.in)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.in, err)
+			}
+			if !reflect.DeepEqual(expr.Terms, tt.terms) || expr.Mode != tt.mode {
+				t.Errorf("Parse(%q) = %+v mode %d, want %+v mode %d", tt.in, expr.Terms, expr.Mode, tt.terms, tt.mode)
+			}
+			if got := expr.String(); got != tt.str {
+				t.Errorf("String() = %q, want %q", got, tt.str)
+			}
+			// 规范写法可以再次解析为相同的表达式
+			again, err := Parse(expr.String())
+			if err != nil || !reflect.DeepEqual(again, expr) {
+				t.Errorf("Parse(%q) round trip = %+v, %v", expr.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"d20 adv dis", "不能同时使用优势和劣势"},
+		{"1", "骰子至少需要2面"},
+		{"0", "骰子至少需要2面"},
+		{"1001", "骰子最多 1000 面"},
+		{"d1", "骰子至少需要2面"},
+		{"d1001", "骰子最多 1000 面"},
+		{"101d6", "骰子太多了(101)，一次最多掷 100 颗"},
+		{"60d6+50d6", "骰子太多了(110)，一次最多掷 100 颗"},
+		{"0d6", "至少掷1颗骰子"},
+		{"9999999999d6", `无效的骰子数量 "9999999999"`},
+		{"xd6", `无效的骰子数量 "x"`},
+		{"d", `无效的骰子面数 ""`},
+		{"3d6*2", `无效的骰子面数 "6*2"`},
+		{"3d6d6", `无效的骰子面数 "6d6"`},
+		{"3d6+", "表达式不完整"},
+		{"3d6++2", "表达式不完整"},
+		{"-", "表达式不完整"},
+		{"2+3", "表达式中没有骰子"},
+		{"-5", "骰子至少需要2面"},
+		{"1-5", "表达式中没有骰子"},
+		{"abc", `无效的修正值 "abc"`},
+		{"d6+1000001", "修正值最大为 1000000"},
+		{"d6" + strings.Repeat("+1", MaxTerms), "表达式最多 20 项"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			expr, err := Parse(tt.in)
+			if err == nil {
+				t.Fatalf("Parse(%q) = %v, want error", tt.in, expr)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Parse(%q) error = %q, want %q", tt.in, err, tt.want)
+			}
+		})
+	}
+}
+
+// rollWith 用依次返回 values 的随机来源掷骰，小于面数的值v得到点数v+1
+func rollWith(t *testing.T, input string, values ...uint64) *Result {
+	t.Helper()
+	expr, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := expr.Roll(NewSource(uint64Reader(values...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestRollAndFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		values []uint64
+		total  int
+		want   string
+	}{
+		{"single die", "d20", []uint64{6}, 7, "🎲 1d20\n7"},
+		{"dice and modifier", "3d6+2", []uint64{0, 4, 5}, 14, "🎲 3d6+2\n[1, 5, 6] + 2 = 14"},
+		{"negative terms", "-1+2d4-d6", []uint64{3, 1, 4}, 0, "🎲 -1+2d4-1d6\n-1 + [4, 2] - [5] = 0"},
+		{"single die with modifier", "d20-3", []uint64{0}, -2, "🎲 1d20-3\n[1] - 3 = -2"},
+		{"advantage takes higher", "d20 adv", []uint64{3, 10}, 11, "🎲 1d20 优势\n▫️ 4\n✅ 11\n结果: 11"},
+		{"advantage tie keeps first", "d20 adv", []uint64{9, 9}, 10, "🎲 1d20 优势\n✅ 10\n▫️ 10\n结果: 10"},
+		{"disadvantage takes lower", "d20+1 dis", []uint64{3, 10}, 5, "🎲 1d20+1 劣势\n✅ [4] + 1 = 5\n▫️ [11] + 1 = 12\n结果: 5"},
+		{"ten dice shown", "10d2", []uint64{0, 1, 0, 1, 0, 1, 0, 1, 0, 1}, 15, "🎲 10d2\n[1, 2, 1, 2, 1, 2, 1, 2, 1, 2] = 15"},
+		{"eleven dice hidden", "11d2", []uint64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, 22, "🎲 11d2\n22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := rollWith(t, tt.input, tt.values...)
+			if result.Total() != tt.total {
+				t.Errorf("Total = %d, want %d", result.Total(), tt.total)
+			}
+			if got := result.Format(); got != tt.want {
+				t.Errorf("Format =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollAttempts(t *testing.T) {
+	result := rollWith(t, "2d6+3", 1, 2)
+	want := []Attempt{{Dice: [][]int{{2, 3}, nil}, Total: 8}}
+	if !reflect.DeepEqual(result.Attempts, want) || result.Chosen != 0 {
+		t.Errorf("Attempts = %+v chosen %d, want %+v", result.Attempts, result.Chosen, want)
+	}
+
+	// 随机来源出错时返回错误
+	expr, _ := Parse("3d6")
+	if _, err := expr.Roll(NewSource(uint64Reader(1, 2))); err == nil {
+		t.Error("Roll should fail when the source runs out")
+	}
+}
+
+func TestRollBounds(t *testing.T) {
+	expr, err := Parse("100d1000+5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := NewSource(nil)
+	for i := 0; i < 20; i++ {
+		result, err := expr.Roll(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total := result.Total(); total < 105 || total > 100005 {
+			t.Fatalf("total %d out of range", total)
+		}
+		for _, v := range result.Attempts[0].Dice[0] {
+			if v < 1 || v > 1000 {
+				t.Fatalf("die %d out of range", v)
+			}
+		}
+	}
+}
+
+func TestSplitOptions(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"火锅 | 烧烤 | 日料", []string{"火锅", "烧烤", "日料"}},
+		{"a|b||  |c ", []string{"a", "b", "c"}},
+		{"第一行\n第二行\n\n 第三行 ", []string{"第一行", "第二行", "第三行"}},
+		{"a | b\nc", []string{"a", "b\nc"}},
+		{"一个选项", []string{"一个选项"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := SplitOptions(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitOptions(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package dice
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Source 随机数来源，默认使用 crypto/rand
+type Source struct {
+	r io.Reader
+}
+
+// NewSource 使用指定的随机字节来源创建 Source，r为nil时使用 crypto/rand
+func NewSource(r io.Reader) *Source {
+	if r == nil {
+		r = rand.Reader
+	}
+	return &Source{r: r}
+}
+
+// Intn 返回 [0, n) 内均匀分布的整数。
+// 使用拒绝采样：丢弃落在 2^64 对 n 取整后剩余区间的值，避免取模偏差
+func (s *Source) Intn(n int) (int, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid range: %d", n)
+	}
+	if n == 1 {
+		return 0, nil
+	}
+	bound := uint64(n)
+	limit := rejectionLimit(bound)
+	var buf [8]byte
+	for {
+		if _, err := io.ReadFull(s.r, buf[:]); err != nil {
+			return 0, fmt.Errorf("failed to read random bytes: %w", err)
+		}
+		v := binary.BigEndian.Uint64(buf[:])
+		if v <= limit {
+			return int(v % bound), nil
+		}
+	}
+}
+
+// rejectionLimit 返回不大于 2^64 的 bound 最大倍数减1，超过该值的随机数会产生偏差
+func rejectionLimit(bound uint64) uint64 {
+	return ^uint64(0) - (^uint64(0)%bound+1)%bound
+}
+
+// Choose 从选项中均匀选出一个，返回其下标
+func (s *Source) Choose(options []string) (int, error) {
+	if len(options) == 0 {
+		return 0, fmt.Errorf("没有可选的选项")
+	}
+	return s.Intn(len(options))
+}
@@ -0,0 +1,136 @@
+package dice
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/big"
+	"testing"
+)
+
+// uint64Reader 依次返回 values 的大端字节
+func uint64Reader(values ...uint64) *bytes.Reader {
+	buf := make([]byte, 0, 8*len(values))
+	for _, v := range values {
+		buf = binary.BigEndian.AppendUint64(buf, v)
+	}
+	return bytes.NewReader(buf)
+}
+
+func TestRejectionLimit(t *testing.T) {
+	// limit+1 必须是不大于 2^64 的 bound 的最大倍数，这样 [0, limit] 内每个余数出现的次数相同
+	two64 := new(big.Int).Lsh(big.NewInt(1), 64)
+	check := func(bound uint64) {
+		b := new(big.Int).SetUint64(bound)
+		want := new(big.Int).Sub(two64, new(big.Int).Mod(two64, b))
+		got := new(big.Int).Add(new(big.Int).SetUint64(rejectionLimit(bound)), big.NewInt(1))
+		if got.Cmp(want) != 0 {
+			t.Fatalf("rejectionLimit(%d)+1 = %s, want %s", bound, got, want)
+		}
+	}
+	for bound := uint64(1); bound <= MaxSides*10; bound++ {
+		check(bound)
+	}
+	for _, bound := range []uint64{1 << 32, 1<<32 + 1, 1<<62 + 1, 3 << 61, math.MaxInt64, 1 << 63, math.MaxUint64} {
+		check(bound)
+	}
+}
+
+func TestIntnRejectsBiasedValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		values []uint64
+		want   int
+		reads  int
+	}{
+		{"small value accepted", 6, []uint64{4}, 4, 1},
+		{"value reduced modulo n", 6, []uint64{6*1000 + 5}, 5, 1},
+		// 2^64 mod 3 = 1，最大值落在不完整的区间内
+		{"max rejected for 3", 3, []uint64{math.MaxUint64, 5}, 2, 2},
+		{"limit accepted for 3", 3, []uint64{math.MaxUint64 - 1}, int((math.MaxUint64 - 1) % 3), 1},
+		// 2^64 mod 100 = 16，最后16个值都被丢弃
+		{"tail rejected for 100", 100, []uint64{math.MaxUint64, math.MaxUint64 - 15, 42}, 42, 3},
+		{"below tail accepted for 100", 100, []uint64{math.MaxUint64 - 16}, int((math.MaxUint64 - 16) % 100), 1},
+		// 2的幂没有剩余区间
+		{"power of two never rejects", 64, []uint64{math.MaxUint64}, 63, 1},
+		// 2^64 mod (2^63-1) = 2
+		{"max int", math.MaxInt64, []uint64{math.MaxUint64, math.MaxUint64 - 1, math.MaxUint64 - 2}, math.MaxInt64 - 1, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := uint64Reader(tt.values...)
+			got, err := NewSource(r).Intn(tt.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Intn(%d) = %d, want %d", tt.n, got, tt.want)
+			}
+			if reads := len(tt.values) - r.Len()/8; reads != tt.reads {
+				t.Errorf("read %d values, want %d", reads, tt.reads)
+			}
+		})
+	}
+}
+
+func TestIntnUniformOverFullCycle(t *testing.T) {
+	// 每个余数各取一次时结果恰好均匀
+	for _, n := range []int{2, 6, 7, 20, 100} {
+		var values []uint64
+		for i := 0; i < n*3; i++ {
+			values = append(values, uint64(i))
+		}
+		src := NewSource(uint64Reader(values...))
+		counts := make([]int, n)
+		for range values {
+			v, err := src.Intn(n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts[v]++
+		}
+		for v, c := range counts {
+			if c != 3 {
+				t.Errorf("n=%d: value %d seen %d times, want 3", n, v, c)
+			}
+		}
+	}
+}
+
+func TestIntnErrors(t *testing.T) {
+	src := NewSource(bytes.NewReader(nil))
+	for _, n := range []int{0, -1} {
+		if _, err := src.Intn(n); err == nil {
+			t.Errorf("Intn(%d) should fail", n)
+		}
+	}
+	// n=1 不需要读取随机数
+	if v, err := src.Intn(1); err != nil || v != 0 {
+		t.Errorf("Intn(1) = %d, %v", v, err)
+	}
+	if _, err := src.Intn(6); err == nil {
+		t.Error("Intn should fail when the reader is exhausted")
+	}
+	if _, err := src.Choose(nil); err == nil {
+		t.Error("Choose with no options should fail")
+	}
+}
+
+func TestCryptoSourceInRange(t *testing.T) {
+	src := NewSource(nil)
+	seen := make(map[int]bool)
+	for i := 0; i < 2000; i++ {
+		v, err := src.Intn(6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v < 0 || v >= 6 {
+			t.Fatalf("Intn(6) = %d", v)
+		}
+		seen[v] = true
+	}
+	if len(seen) != 6 {
+		t.Errorf("2000 rolls produced only %d distinct values", len(seen))
+	}
+}
@@ -0,0 +1,200 @@
+package diff
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Op 差异行的类型
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Line 差异中的一行。OldNo/NewNo 为从1开始的行号，不存在时为0
+type Line struct {
+	Op    Op
+	Text  string
+	OldNo int
+	NewNo int
+}
+
+// edit Myers算法输出的单步操作，ai/bi 为两侧的下标
+type edit struct {
+	op Op
+	ai int
+	bi int
+}
+
+// SplitLines 按换行切分文本，忽略末尾换行
+func SplitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// Lines 计算两段文本的逐行差异
+func Lines(a, b string) []Line {
+	oldLines, newLines := SplitLines(a), SplitLines(b)
+	edits := myers(oldLines, newLines)
+
+	result := make([]Line, 0, len(edits))
+	for _, e := range edits {
+		switch e.op {
+		case Equal:
+			result = append(result, Line{Op: Equal, Text: oldLines[e.ai], OldNo: e.ai + 1, NewNo: e.bi + 1})
+		case Delete:
+			result = append(result, Line{Op: Delete, Text: oldLines[e.ai], OldNo: e.ai + 1})
+		case Insert:
+			result = append(result, Line{Op: Insert, Text: newLines[e.bi], NewNo: e.bi + 1})
+		}
+	}
+	return result
+}
+
+// Changed 是否存在差异
+func Changed(lines []Line) bool {
+	for _, l := range lines {
+		if l.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// myers 使用Myers O(ND)算法计算最短编辑序列，相同位置优先输出删除
+func myers[T comparable](a, b []T) []edit {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	// 从终点回溯
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{op: Equal, ai: x, bi: y})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				edits = append(edits, edit{op: Insert, ai: x, bi: y})
+			} else {
+				x--
+				edits = append(edits, edit{op: Delete, ai: x, bi: y})
+			}
+		}
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// wordTokens 将一行切分为单词级词元：连续字母数字为一个词元，CJK字符、空白和标点各自独立
+func wordTokens(s string) []string {
+	var tokens []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range s {
+		if (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') && !unicode.Is(unicode.Han, r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		tokens = append(tokens, string(r))
+	}
+	flush()
+	return tokens
+}
+
+// Words 对一对修改前后的行进行单词级比较，删除部分用 [-…-] 标记，新增部分用 {+…+} 标记
+func Words(oldLine, newLine string) (string, string) {
+	a, b := wordTokens(oldLine), wordTokens(newLine)
+	var oldOut, newOut strings.Builder
+	var pendingOp Op = Equal
+	var pending strings.Builder
+	flush := func() {
+		if pending.Len() == 0 {
+			return
+		}
+		switch pendingOp {
+		case Delete:
+			oldOut.WriteString("[-" + pending.String() + "-]")
+		case Insert:
+			newOut.WriteString("{+" + pending.String() + "+}")
+		}
+		pending.Reset()
+	}
+
+	for _, e := range myers(a, b) {
+		if e.op != pendingOp {
+			flush()
+			pendingOp = e.op
+		}
+		switch e.op {
+		case Equal:
+			oldOut.WriteString(a[e.ai])
+			newOut.WriteString(b[e.bi])
+		case Delete:
+			pending.WriteString(a[e.ai])
+		case Insert:
+			pending.WriteString(b[e.bi])
+		}
+	}
+	flush()
+	return oldOut.String(), newOut.String()
+}
@@ -0,0 +1,164 @@
+package diff
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"\n", nil},
+		{"a", []string{"a"}},
+		{"a\nb\n", []string{"a", "b"}},
+		{"a\r\nb\r\n", []string{"a", "b"}},
+		{"a\n\n", []string{"a", ""}},
+		{"  a  \n", []string{"  a  "}},
+	}
+	for _, tt := range tests {
+		if got := SplitLines(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitLines(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{"identical", "a\nb", "a\nb\n", []Line{{Equal, "a", 1, 1}, {Equal, "b", 2, 2}}},
+		{"both empty", "", "", []Line{}},
+		{"insert into empty", "", "x", []Line{{Insert, "x", 0, 1}}},
+		{"delete all", "x\ny", "", []Line{{Delete, "x", 1, 0}, {Delete, "y", 2, 0}}},
+		{
+			"replace keeps delete first", "a\nb\nc", "a\nx\nc",
+			[]Line{{Equal, "a", 1, 1}, {Delete, "b", 2, 0}, {Insert, "x", 0, 2}, {Equal, "c", 3, 3}},
+		},
+		{
+			"cjk lines", "你好\n世界\n再见", "你好\n世間\n再见",
+			[]Line{{Equal, "你好", 1, 1}, {Delete, "世界", 2, 0}, {Insert, "世間", 0, 2}, {Equal, "再见", 3, 3}},
+		},
+		{
+			"trailing whitespace differs", "a\nb  ", "a\nb",
+			[]Line{{Equal, "a", 1, 1}, {Delete, "b  ", 2, 0}, {Insert, "b", 0, 2}},
+		},
+		{
+			"moved line", "a\nb\nc", "b\nc\na",
+			[]Line{{Delete, "a", 1, 0}, {Equal, "b", 2, 1}, {Equal, "c", 3, 2}, {Insert, "a", 0, 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines = %+v, want %+v", got, tt.want)
+			}
+			if Changed(got) != (tt.a != tt.b && strings.TrimSuffix(tt.a, "\n") != strings.TrimSuffix(tt.b, "\n")) {
+				t.Errorf("Changed = %v", Changed(got))
+			}
+		})
+	}
+}
+
+// lcsLength 用动态规划独立计算最长公共子序列的长度
+func lcsLength(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestLinesMinimalAndComplete(t *testing.T) {
+	rng := rand.New(rand.NewSource(219))
+	alphabet := []string{"a", "b", "c", "中", ""}
+	randomText := func() []string {
+		lines := make([]string, rng.Intn(12))
+		for i := range lines {
+			lines[i] = alphabet[rng.Intn(len(alphabet))]
+		}
+		return lines
+	}
+
+	for iter := 0; iter < 500; iter++ {
+		oldLines, newLines := randomText(), randomText()
+		// 末尾空行会被 SplitLines 当作结尾换行忽略，用非空行结尾避免歧义
+		oldLines = append(oldLines, "end")
+		newLines = append(newLines, "end")
+		result := Lines(strings.Join(oldLines, "\n"), strings.Join(newLines, "\n"))
+
+		var gotOld, gotNew []string
+		equal := 0
+		for _, l := range result {
+			if l.Op != Insert {
+				gotOld = append(gotOld, l.Text)
+				if l.OldNo != len(gotOld) {
+					t.Fatalf("OldNo %d out of order in %+v", l.OldNo, result)
+				}
+			}
+			if l.Op != Delete {
+				gotNew = append(gotNew, l.Text)
+				if l.NewNo != len(gotNew) {
+					t.Fatalf("NewNo %d out of order in %+v", l.NewNo, result)
+				}
+			}
+			if l.Op == Equal {
+				equal++
+			}
+		}
+		if !reflect.DeepEqual(gotOld, oldLines) || !reflect.DeepEqual(gotNew, newLines) {
+			t.Fatalf("diff of %q -> %q does not reproduce both sides", oldLines, newLines)
+		}
+		if want := lcsLength(oldLines, newLines); equal != want {
+			t.Fatalf("diff of %q -> %q keeps %d lines, LCS is %d", oldLines, newLines, equal, want)
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name             string
+		old, new         string
+		wantOld, wantNew string
+	}{
+		{"one word", "the quick fox", "the slow fox", "the [-quick-] fox", "the {+slow+} fox"},
+		{"cjk per character", "我喜欢苹果", "我喜欢香蕉", "我喜欢[-苹果-]", "我喜欢{+香蕉+}"},
+		{"mixed cjk and latin", "hello 世界 foo", "hello 世間 bar", "hello 世[-界-] [-foo-]", "hello 世{+間+} {+bar+}"},
+		{"latin next to cjk", "版本v1发布", "版本v2发布", "版本[-v1-]发布", "版本{+v2+}发布"},
+		{"insert only", "a b", "a x b", "a b", "a {+x +}b"},
+		{"punctuation", "ok.", "ok!", "ok[-.-]", "ok{+!+}"},
+		{"trailing space", "end", "end ", "end", "end{+ +}"},
+		{"unchanged", "同样 same", "同样 same", "同样 same", "同样 same"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOld, gotNew := Words(tt.old, tt.new)
+			if gotOld != tt.wantOld || gotNew != tt.wantNew {
+				t.Errorf("Words(%q, %q) = %q, %q; want %q, %q", tt.old, tt.new, gotOld, gotNew, tt.wantOld, tt.wantNew)
+			}
+		})
+	}
+}
+
+func TestWordTokens(t *testing.T) {
+	got := wordTokens("go_1 语言,ok")
+	if want := []string{"go_1", " ", "语", "言", ",", "ok"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wordTokens = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,187 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultContext 变化行前后保留的未变化行数
+const DefaultContext = 3
+
+// RenderOptions 渲染选项
+type RenderOptions struct {
+	Context int  // 变化前后保留的未变化行数
+	Words   bool // 对成对修改的行做单词级标记
+}
+
+// Render 以 +/- 前缀渲染差异，较长的未变化区域折叠为 "… N 行未变化 …"。
+// 变化行末尾的空白显示为可见字符，便于发现只有行尾空白不同的修改
+func Render(lines []Line, opts RenderOptions) string {
+	if opts.Context < 0 {
+		opts.Context = 0
+	}
+
+	var b strings.Builder
+	writeLine := func(prefix, text string) {
+		b.WriteString(prefix)
+		b.WriteString(text)
+		b.WriteByte('\n')
+	}
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			// 找到完整的未变化区域
+			end := i
+			for end < len(lines) && lines[end].Op == Equal {
+				end++
+			}
+			keepHead, keepTail := opts.Context, opts.Context
+			if i == 0 {
+				keepHead = 0
+			}
+			if end == len(lines) {
+				keepTail = 0
+			}
+			if run := end - i; run > keepHead+keepTail+1 {
+				for _, l := range lines[i : i+keepHead] {
+					writeLine("  ", l.Text)
+				}
+				writeLine("", fmt.Sprintf("… %d 行未变化 …", run-keepHead-keepTail))
+				for _, l := range lines[end-keepTail : end] {
+					writeLine("  ", l.Text)
+				}
+			} else {
+				for _, l := range lines[i:end] {
+					writeLine("  ", l.Text)
+				}
+			}
+			i = end
+			continue
+		}
+
+		// 一组连续的删除和新增
+		end := i
+		for end < len(lines) && lines[end].Op != Equal {
+			end++
+		}
+		var dels, ins []string
+		for _, l := range lines[i:end] {
+			if l.Op == Delete {
+				dels = append(dels, l.Text)
+			} else {
+				ins = append(ins, l.Text)
+			}
+		}
+		if opts.Words && len(dels) == len(ins) {
+			for j := range dels {
+				dels[j], ins[j] = Words(dels[j], ins[j])
+			}
+		}
+		for _, text := range dels {
+			writeLine("- ", visibleTrailing(text))
+		}
+		for _, text := range ins {
+			writeLine("+ ", visibleTrailing(text))
+		}
+		i = end
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// visibleTrailing 将行尾的空格和制表符替换为 · 和 →
+func visibleTrailing(s string) string {
+	trimmed := strings.TrimRight(s, " \t")
+	if len(trimmed) == len(s) {
+		return s
+	}
+	tail := strings.NewReplacer(" ", "·", "\t", "→").Replace(s[len(trimmed):])
+	return trimmed + tail
+}
+
+// Unified 生成标准unified diff格式，可保存为 .patch 文件
+func Unified(lines []Line, oldName, newName string, context int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	for i := 0; i < len(lines); {
+		// 跳到下一处变化
+		for i < len(lines) && lines[i].Op == Equal {
+			i++
+		}
+		if i >= len(lines) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// 向后扩展，相距不超过2*context的变化合并为一个hunk
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Op == Equal {
+				run++
+			}
+			if run == len(lines) || run-end > 2*context {
+				end += min(context, run-end)
+				break
+			}
+			end = run
+		}
+
+		oldStart, newStart, oldCount, newCount := 0, 0, 0, 0
+		for _, l := range lines[start:end] {
+			if l.Op != Insert {
+				if oldStart == 0 {
+					oldStart = l.OldNo
+				}
+				oldCount++
+			}
+			if l.Op != Delete {
+				if newStart == 0 {
+					newStart = l.NewNo
+				}
+				newCount++
+			}
+		}
+		if oldStart == 0 {
+			oldStart = hunkAnchor(lines, start, true)
+		}
+		if newStart == 0 {
+			newStart = hunkAnchor(lines, start, false)
+		}
+
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, l := range lines[start:end] {
+			switch l.Op {
+			case Equal:
+				b.WriteString(" " + l.Text + "\n")
+			case Delete:
+				b.WriteString("-" + l.Text + "\n")
+			case Insert:
+				b.WriteString("+" + l.Text + "\n")
+			}
+		}
+		i = end
+	}
+	return b.String()
+}
+
+// hunkAnchor 一侧在hunk中没有行时，返回该侧在hunk之前的最后一行行号(unified格式约定)
+func hunkAnchor(lines []Line, start int, old bool) int {
+	for i := start - 1; i >= 0; i-- {
+		if old && lines[i].OldNo != 0 {
+			return lines[i].OldNo
+		}
+		if !old && lines[i].NewNo != 0 {
+			return lines[i].NewNo
+		}
+	}
+	return 0
+}
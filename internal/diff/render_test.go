@@ -0,0 +1,144 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numbered 返回 1..n 每行一个数字的文本，replace 中的行号替换为对应内容
+func numbered(n int, replace map[int]string) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprint(i + 1)
+		if s, ok := replace[i+1]; ok {
+			lines[i] = s
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		opts RenderOptions
+		want string
+	}{
+		{
+			name: "trailing whitespace made visible",
+			a:    "a\nb  \nc\t",
+			b:    "a\nb\nc",
+			opts: RenderOptions{Context: 3},
+			want: "  a\n- b··\n- c→\n+ b\n+ c",
+		},
+		{
+			name: "collapse long unchanged runs",
+			a:    numbered(10, nil),
+			b:    numbered(10, map[int]string{5: "five"}),
+			opts: RenderOptions{Context: 1},
+			want: "… 3 行未变化 …\n  4\n- 5\n+ five\n  6\n… 4 行未变化 …",
+		},
+		{
+			name: "no collapse when it would hide one line",
+			a:    numbered(5, nil),
+			b:    numbered(5, map[int]string{1: "one", 5: "five"}),
+			opts: RenderOptions{Context: 1},
+			want: "- 1\n+ one\n  2\n  3\n  4\n- 5\n+ five",
+		},
+		{
+			name: "collapse between changes",
+			a:    numbered(6, nil),
+			b:    numbered(6, map[int]string{1: "one", 6: "six"}),
+			opts: RenderOptions{Context: 1},
+			want: "- 1\n+ one\n  2\n… 2 行未变化 …\n  5\n- 6\n+ six",
+		},
+		{
+			name: "zero context",
+			a:    numbered(4, nil),
+			b:    numbered(4, map[int]string{2: "two"}),
+			opts: RenderOptions{Context: 0},
+			want: "  1\n- 2\n+ two\n… 2 行未变化 …",
+		},
+		{
+			name: "word marks for paired lines",
+			a:    "标题\n我喜欢苹果",
+			b:    "标题\n我喜欢香蕉",
+			opts: RenderOptions{Context: 3, Words: true},
+			want: "  标题\n- 我喜欢[-苹果-]\n+ 我喜欢{+香蕉+}",
+		},
+		{
+			name: "no word marks for unpaired lines",
+			a:    "a b",
+			b:    "a c\nd",
+			opts: RenderOptions{Context: 3, Words: true},
+			want: "- a b\n+ a c\n+ d",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(Lines(tt.a, tt.b), tt.opts); got != tt.want {
+				t.Errorf("Render =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{
+			name:    "single hunk",
+			a:       "a\nb\nc\nd\ne\nf\ng\nh",
+			b:       "a\nb\nc\nD\ne\nf\ng\nh",
+			context: 1,
+			want:    "--- a\n+++ b\n@@ -3,3 +3,3 @@\n c\n-d\n+D\n e\n",
+		},
+		{
+			name:    "nearby changes share a hunk",
+			a:       numbered(8, nil),
+			b:       numbered(8, map[int]string{2: "two", 5: "five"}),
+			context: 1,
+			want:    "--- a\n+++ b\n@@ -1,6 +1,6 @@\n 1\n-2\n+two\n 3\n 4\n-5\n+five\n 6\n",
+		},
+		{
+			name:    "distant changes get separate hunks",
+			a:       numbered(10, nil),
+			b:       numbered(10, map[int]string{2: "two", 9: "nine"}),
+			context: 1,
+			want:    "--- a\n+++ b\n@@ -1,3 +1,3 @@\n 1\n-2\n+two\n 3\n@@ -8,3 +8,3 @@\n 8\n-9\n+nine\n 10\n",
+		},
+		{
+			name:    "insert into empty file",
+			a:       "",
+			b:       "x\ny",
+			context: 3,
+			want:    "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			name:    "pure insertion anchors on previous line",
+			a:       "a\nb\nc\nd",
+			b:       "a\nb\nnew\nc\nd",
+			context: 0,
+			want:    "--- a\n+++ b\n@@ -2,0 +3,1 @@\n+new\n",
+		},
+		{
+			name:    "no changes",
+			a:       "same",
+			b:       "same",
+			context: 3,
+			want:    "--- a\n+++ b\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified(Lines(tt.a, tt.b), "a", "b", tt.context); got != tt.want {
+				t.Errorf("Unified =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"nexusvalet/pkg/logger"
+	"sync"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+const (
+	// ChunkSize 每次请求的分块大小。upload.getFile 要求 limit 能被 4KB 整除，且 1MB 能被 limit 整除
+	ChunkSize = 512 * 1024
+	// maxRefresh 一次下载中因文件引用过期重新获取位置的最多次数
+	maxRefresh = 2
+	// dcConnections 每个其他DC保持的最大连接数
+	dcConnections = 1
+)
+
+// DCDialer 连接到指定DC并导入当前授权，*telegram.Client 实现了该接口
+type DCDialer interface {
+	DC(ctx context.Context, dc int, max int64) (telegram.CloseInvoker, error)
+}
+
+// Progress 下载进度回调，done 为已写入的字节数，total 为文件大小，未知时为0
+type Progress func(done, total int64)
+
+// Options 单次下载的选项
+type Options struct {
+	// Size 文件大小，用于进度回调，未知时为0
+	Size int64
+	// Progress 每写入一个分块后调用，可以为nil
+	Progress Progress
+	// Refresh 返回FILE_REFERENCE_EXPIRED时调用，重新获取包含新文件引用的位置，为nil时直接返回错误
+	Refresh func(ctx context.Context) (tg.InputFileLocationClass, error)
+}
+
+// Downloader 分块下载Telegram文件，文件在其他DC时(FILE_MIGRATE_X)连接到该DC继续下载。
+// 到其他DC的连接在第一次需要时建立，之后复用，直到 Close
+type Downloader struct {
+	api    *tg.Client
+	dialer DCDialer
+
+	mutex sync.Mutex
+	dcs   map[int]*dcClient
+}
+
+// dcClient 到其他DC的连接
+type dcClient struct {
+	invoker telegram.CloseInvoker
+	api     *tg.Client
+}
+
+// New 创建下载器，dialer 为nil时不处理FILE_MIGRATE，遇到时返回错误
+func New(api *tg.Client, dialer DCDialer) *Downloader {
+	return &Downloader{
+		api:    api,
+		dialer: dialer,
+		dcs:    make(map[int]*dcClient),
+	}
+}
+
+// Download 把location指向的文件写入w，返回写入的字节数
+func (d *Downloader) Download(ctx context.Context, location tg.InputFileLocationClass, w io.Writer, opts Options) (int64, error) {
+	api := d.api
+	var offset int64
+	refreshed := 0
+
+	for {
+		resp, err := api.UploadGetFile(ctx, &tg.UploadGetFileRequest{
+			Location: location,
+			Offset:   offset,
+			Limit:    ChunkSize,
+		})
+		if rpcErr, ok := tgerr.As(err); ok && rpcErr.IsType("FILE_MIGRATE") {
+			// 文件存放在其他DC，之后的分块都从该DC下载
+			api, err = d.dcAPI(ctx, rpcErr.Argument)
+			if err != nil {
+				return offset, fmt.Errorf("连接到 DC %d 失败: %w", rpcErr.Argument, err)
+			}
+			continue
+		}
+		if tgerr.Is(err, "FILE_REFERENCE_EXPIRED") && opts.Refresh != nil && refreshed < maxRefresh {
+			refreshed++
+			location, err = opts.Refresh(ctx)
+			if err != nil {
+				return offset, fmt.Errorf("刷新文件引用失败: %w", err)
+			}
+			continue
+		}
+		if err != nil {
+			return offset, err
+		}
+
+		file, ok := resp.(*tg.UploadFile)
+		if !ok {
+			return offset, fmt.Errorf("意外的响应类型 %T", resp)
+		}
+		if _, err := w.Write(file.Bytes); err != nil {
+			return offset, fmt.Errorf("写入文件失败: %w", err)
+		}
+		offset += int64(len(file.Bytes))
+		if opts.Progress != nil {
+			opts.Progress(offset, opts.Size)
+		}
+
+		if len(file.Bytes) < ChunkSize {
+			return offset, nil // 最后一块
+		}
+	}
+}
+
+// dcAPI 返回到指定DC的客户端，没有时建立连接
+func (d *Downloader) dcAPI(ctx context.Context, dc int) (*tg.Client, error) {
+	if d.dialer == nil {
+		return nil, fmt.Errorf("file is stored in DC %d and DC migration is not available", dc)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if client, ok := d.dcs[dc]; ok {
+		return client.api, nil
+	}
+
+	invoker, err := d.dialer.DC(ctx, dc, dcConnections)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("Connected to DC %d for file download", dc)
+	client := &dcClient{invoker: invoker, api: tg.NewClient(invoker)}
+	d.dcs[dc] = client
+	return client.api, nil
+}
+
+// Close 关闭到其他DC的连接
+func (d *Downloader) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var firstErr error
+	for dc, client := range d.dcs {
+		if err := client.invoker.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(d.dcs, dc)
+	}
+	return firstErr
+}
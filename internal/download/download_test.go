@@ -0,0 +1,300 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// fileServer 模拟一个DC上的 upload.getFile，按请求的偏移返回文件内容
+type fileServer struct {
+	mu       sync.Mutex
+	data     []byte
+	reject   func(req *tg.UploadGetFileRequest) error // 返回非nil时以该错误响应请求
+	requests []*tg.UploadGetFileRequest
+	closed   bool
+}
+
+func (s *fileServer) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, ok := input.(*tg.UploadGetFileRequest)
+	if !ok {
+		return errors.New("unexpected request")
+	}
+	s.requests = append(s.requests, req)
+	if s.reject != nil {
+		if err := s.reject(req); err != nil {
+			return err
+		}
+	}
+	if req.Limit != ChunkSize || req.Offset%ChunkSize != 0 {
+		return tgerr.New(400, "LIMIT_INVALID")
+	}
+	start := min(int(req.Offset), len(s.data))
+	end := min(start+req.Limit, len(s.data))
+	output.(*tg.UploadFileBox).File = &tg.UploadFile{Bytes: s.data[start:end]}
+	return nil
+}
+
+func (s *fileServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// offsets 返回收到的请求偏移
+func (s *fileServer) offsets() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []int64
+	for _, req := range s.requests {
+		out = append(out, req.Offset)
+	}
+	return out
+}
+
+// fakeDialer 按DC编号返回对应的 fileServer
+type fakeDialer struct {
+	dcs   map[int]*fileServer
+	dials []int
+}
+
+func (d *fakeDialer) DC(_ context.Context, dc int, max int64) (telegram.CloseInvoker, error) {
+	d.dials = append(d.dials, dc)
+	if max != dcConnections {
+		return nil, errors.New("unexpected connection count")
+	}
+	s, ok := d.dcs[dc]
+	if !ok {
+		return nil, errors.New("AUTH_KEY_UNREGISTERED")
+	}
+	return s, nil
+}
+
+// testFile 返回长度为n的确定内容
+func testFile(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+var testLocation = &tg.InputDocumentFileLocation{ID: 1, AccessHash: 2, FileReference: []byte("ref")}
+
+func TestDownloadChunks(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		offsets []int64
+	}{
+		{"empty", 0, []int64{0}},
+		{"single chunk", 1000, []int64{0}},
+		// 大小正好是分块的整数倍时需要再请求一次才能确认结束
+		{"exact chunk", ChunkSize, []int64{0, ChunkSize}},
+		{"several chunks", 2*ChunkSize + 1234, []int64{0, ChunkSize, 2 * ChunkSize}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testFile(tt.size)
+			server := &fileServer{data: data}
+			var out bytes.Buffer
+			var progress []int64
+			n, err := New(tg.NewClient(server), nil).Download(context.Background(), testLocation, &out, Options{
+				Size: int64(tt.size),
+				Progress: func(done, total int64) {
+					if total != int64(tt.size) {
+						t.Errorf("progress total = %d, want %d", total, tt.size)
+					}
+					progress = append(progress, done)
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(tt.size) || !bytes.Equal(out.Bytes(), data) {
+				t.Errorf("downloaded %d bytes (%d written), want %d", n, out.Len(), tt.size)
+			}
+			if got := server.offsets(); !reflect.DeepEqual(got, tt.offsets) {
+				t.Errorf("offsets = %v, want %v", got, tt.offsets)
+			}
+			// 每个分块后报告一次累计进度
+			if len(progress) != len(tt.offsets) || progress[len(progress)-1] != int64(tt.size) {
+				t.Errorf("progress = %v", progress)
+			}
+		})
+	}
+}
+
+func TestDownloadFollowsFileMigrate(t *testing.T) {
+	data := testFile(2*ChunkSize + 10)
+	main := &fileServer{reject: func(*tg.UploadGetFileRequest) error { return tgerr.New(303, "FILE_MIGRATE_4") }}
+	dc4 := &fileServer{data: data}
+	dialer := &fakeDialer{dcs: map[int]*fileServer{4: dc4}}
+	d := New(tg.NewClient(main), dialer)
+
+	var out bytes.Buffer
+	n, err := d.Download(context.Background(), testLocation, &out, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("downloaded %d bytes, want %d", n, len(data))
+	}
+	// 迁移后剩余的分块都从DC 4下载
+	if got := main.offsets(); !reflect.DeepEqual(got, []int64{0}) {
+		t.Errorf("main DC offsets = %v", got)
+	}
+	if got := dc4.offsets(); !reflect.DeepEqual(got, []int64{0, ChunkSize, 2 * ChunkSize}) {
+		t.Errorf("DC 4 offsets = %v", got)
+	}
+
+	// 第二次下载复用已建立的连接
+	out.Reset()
+	if _, err := d.Download(context.Background(), testLocation, &out, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dialer.dials, []int{4}) {
+		t.Errorf("dials = %v, want one connection to DC 4", dialer.dials)
+	}
+
+	if err := d.Close(); err != nil || !dc4.closed {
+		t.Errorf("Close = %v, DC 4 closed %v", err, dc4.closed)
+	}
+	if len(d.dcs) != 0 {
+		t.Error("Close should forget the DC connections")
+	}
+}
+
+func TestDownloadMigrateMidway(t *testing.T) {
+	// 第一个分块在当前DC，之后的分块在DC 2，从已下载的偏移继续
+	data := testFile(ChunkSize + 100)
+	main := &fileServer{data: data, reject: func(req *tg.UploadGetFileRequest) error {
+		if req.Offset > 0 {
+			return tgerr.New(303, "FILE_MIGRATE_2")
+		}
+		return nil
+	}}
+	dc2 := &fileServer{data: data}
+	var out bytes.Buffer
+	n, err := New(tg.NewClient(main), &fakeDialer{dcs: map[int]*fileServer{2: dc2}}).Download(context.Background(), testLocation, &out, Options{})
+	if err != nil || n != int64(len(data)) || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("Download = %d, %v", n, err)
+	}
+	if got := dc2.offsets(); !reflect.DeepEqual(got, []int64{ChunkSize}) {
+		t.Errorf("DC 2 offsets = %v, want to resume at %d", got, ChunkSize)
+	}
+}
+
+func TestDownloadMigrateErrors(t *testing.T) {
+	main := &fileServer{reject: func(*tg.UploadGetFileRequest) error { return tgerr.New(303, "FILE_MIGRATE_5") }}
+
+	// 没有 dialer 时返回错误而不是静默失败
+	_, err := New(tg.NewClient(main), nil).Download(context.Background(), testLocation, &bytes.Buffer{}, Options{})
+	if err == nil || !strings.Contains(err.Error(), "连接到 DC 5 失败") || !strings.Contains(err.Error(), "DC migration is not available") {
+		t.Errorf("without dialer: %v", err)
+	}
+
+	// 连接失败时返回错误，不缓存失败的连接
+	dialer := &fakeDialer{dcs: map[int]*fileServer{}}
+	d := New(tg.NewClient(main), dialer)
+	for i := 0; i < 2; i++ {
+		if _, err := d.Download(context.Background(), testLocation, &bytes.Buffer{}, Options{}); err == nil || !strings.Contains(err.Error(), "AUTH_KEY_UNREGISTERED") {
+			t.Errorf("dial failure: %v", err)
+		}
+	}
+	if len(dialer.dials) != 2 {
+		t.Errorf("dials = %v, want a new attempt each time", dialer.dials)
+	}
+}
+
+func TestDownloadRefreshesFileReference(t *testing.T) {
+	data := testFile(ChunkSize + 5)
+	fresh := &tg.InputDocumentFileLocation{ID: 1, AccessHash: 2, FileReference: []byte("fresh")}
+	server := &fileServer{data: data, reject: func(req *tg.UploadGetFileRequest) error {
+		if string(req.Location.(*tg.InputDocumentFileLocation).FileReference) != "fresh" {
+			return tgerr.New(400, "FILE_REFERENCE_EXPIRED")
+		}
+		return nil
+	}}
+	refreshes := 0
+	var out bytes.Buffer
+	n, err := New(tg.NewClient(server), nil).Download(context.Background(), testLocation, &out, Options{
+		Refresh: func(context.Context) (tg.InputFileLocationClass, error) {
+			refreshes++
+			return fresh, nil
+		},
+	})
+	if err != nil || n != int64(len(data)) || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("Download = %d, %v", n, err)
+	}
+	// 只刷新一次，之后的分块使用新的位置
+	if refreshes != 1 || !reflect.DeepEqual(server.offsets(), []int64{0, 0, ChunkSize}) {
+		t.Errorf("refreshes = %d, offsets = %v", refreshes, server.offsets())
+	}
+}
+
+func TestDownloadRefreshLimits(t *testing.T) {
+	expired := &fileServer{reject: func(*tg.UploadGetFileRequest) error { return tgerr.New(400, "FILE_REFERENCE_EXPIRED") }}
+
+	// 没有 Refresh 时直接返回错误
+	if _, err := New(tg.NewClient(expired), nil).Download(context.Background(), testLocation, &bytes.Buffer{}, Options{}); !tgerr.Is(err, "FILE_REFERENCE_EXPIRED") {
+		t.Errorf("without refresh: %v", err)
+	}
+
+	// 刷新后仍然过期时最多重试 maxRefresh 次
+	refreshes := 0
+	_, err := New(tg.NewClient(expired), nil).Download(context.Background(), testLocation, &bytes.Buffer{}, Options{
+		Refresh: func(context.Context) (tg.InputFileLocationClass, error) {
+			refreshes++
+			return testLocation, nil
+		},
+	})
+	if !tgerr.Is(err, "FILE_REFERENCE_EXPIRED") || refreshes != maxRefresh {
+		t.Errorf("err = %v after %d refreshes, want %d", err, refreshes, maxRefresh)
+	}
+
+	// 刷新失败时返回刷新的错误
+	_, err = New(tg.NewClient(expired), nil).Download(context.Background(), testLocation, &bytes.Buffer{}, Options{
+		Refresh: func(context.Context) (tg.InputFileLocationClass, error) { return nil, errors.New("message deleted") },
+	})
+	if err == nil || err.Error() != "刷新文件引用失败: message deleted" {
+		t.Errorf("refresh failure: %v", err)
+	}
+}
+
+// failingWriter 在写入超过limit字节后返回错误
+type failingWriter struct {
+	written, limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.written+len(p) > w.limit {
+		return 0, errors.New("disk full")
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+func TestDownloadWriteError(t *testing.T) {
+	server := &fileServer{data: testFile(3 * ChunkSize)}
+	n, err := New(tg.NewClient(server), nil).Download(context.Background(), testLocation, &failingWriter{limit: ChunkSize}, Options{})
+	// 返回已写入的字节数，不再请求后续分块
+	if err == nil || err.Error() != "写入文件失败: disk full" || n != ChunkSize {
+		t.Errorf("Download = %d, %v", n, err)
+	}
+	if got := server.offsets(); !reflect.DeepEqual(got, []int64{0, ChunkSize}) {
+		t.Errorf("offsets = %v", got)
+	}
+}
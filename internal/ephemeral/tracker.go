@@ -0,0 +1,295 @@
+package ephemeral
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/deletion"
+	"nexusvalet/pkg/logger"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// Source 阅后即焚安排的删除在 pending_deletions 中的来源标记
+const Source = "ephemeral"
+
+// exemptKey 标记请求不受阅后即焚影响的上下文键
+type exemptKey struct{}
+
+// Exempt 返回不受阅后即焚影响的上下文，用于置顶倒计时、监控告警等需要保留的消息
+func Exempt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, exemptKey{}, true)
+}
+
+// IsExempt 上下文是否标记为不受阅后即焚影响
+func IsExempt(ctx context.Context) bool {
+	exempt, _ := ctx.Value(exemptKey{}).(bool)
+	return exempt
+}
+
+// Tracker 记录开启阅后即焚的对话，并把发往这些对话的消息交给删除服务
+type Tracker struct {
+	db        *sql.DB
+	scheduler *deletion.Scheduler
+	chats     map[int64]time.Duration
+	mutex     sync.RWMutex
+
+	now func() time.Time
+}
+
+// NewTracker 创建阅后即焚记录器，并从数据库加载已开启的对话
+func NewTracker(db *sql.DB, scheduler *deletion.Scheduler) *Tracker {
+	t := &Tracker{
+		db:        db,
+		scheduler: scheduler,
+		chats:     make(map[int64]time.Duration),
+		now:       time.Now,
+	}
+
+	if db != nil {
+		if err := t.initDatabase(); err != nil {
+			logger.Errorf("Failed to create ephemeral_chats table: %v", err)
+		} else if err := t.loadChats(); err != nil {
+			logger.Errorf("Failed to load ephemeral chats: %v", err)
+		}
+	}
+
+	return t
+}
+
+// initDatabase 初始化数据库表
+func (t *Tracker) initDatabase() error {
+	_, err := t.db.Exec(`
+	CREATE TABLE IF NOT EXISTS ephemeral_chats (
+		chat_id INTEGER PRIMARY KEY,
+		ttl_seconds INTEGER NOT NULL,
+		created INTEGER NOT NULL
+	)`)
+	return err
+}
+
+// loadChats 从数据库加载已开启的对话
+func (t *Tracker) loadChats() error {
+	rows, err := t.db.Query("SELECT chat_id, ttl_seconds FROM ephemeral_chats")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for rows.Next() {
+		var chatID, ttl int64
+		if err := rows.Scan(&chatID, &ttl); err != nil {
+			return err
+		}
+		t.chats[chatID] = time.Duration(ttl) * time.Second
+	}
+	return rows.Err()
+}
+
+// Enable 在对话中开启阅后即焚，已开启时更新TTL
+func (t *Tracker) Enable(chatID int64, ttl time.Duration) error {
+	if t.db == nil {
+		return fmt.Errorf("database not available")
+	}
+	if ttl < time.Second {
+		return fmt.Errorf("ttl must be at least 1s")
+	}
+	if _, err := t.db.Exec("INSERT OR REPLACE INTO ephemeral_chats (chat_id, ttl_seconds, created) VALUES (?, ?, ?)",
+		chatID, int64(ttl/time.Second), t.now().Unix()); err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	t.chats[chatID] = ttl
+	t.mutex.Unlock()
+	return nil
+}
+
+// Disable 关闭对话的阅后即焚。已安排的删除不受影响
+func (t *Tracker) Disable(chatID int64) (bool, error) {
+	t.mutex.Lock()
+	_, ok := t.chats[chatID]
+	delete(t.chats, chatID)
+	t.mutex.Unlock()
+
+	if t.db != nil {
+		if _, err := t.db.Exec("DELETE FROM ephemeral_chats WHERE chat_id = ?", chatID); err != nil {
+			return ok, err
+		}
+	}
+	return ok, nil
+}
+
+// TTL 返回对话的阅后即焚TTL，未开启时返回false
+func (t *Tracker) TTL(chatID int64) (time.Duration, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	ttl, ok := t.chats[chatID]
+	return ttl, ok
+}
+
+// Pending 返回对话中由阅后即焚安排、尚未执行的删除数量
+func (t *Tracker) Pending(chatID int64) (int, error) {
+	return t.scheduler.Pending(chatID, Source)
+}
+
+// Track 对话开启了阅后即焚时，安排在TTL后删除这些消息。
+// 同一次发送产生的多条消息(分段文本、相册)一起安排
+func (t *Tracker) Track(chatID int64, ids []int) {
+	ttl, ok := t.TTL(chatID)
+	if !ok || len(ids) == 0 {
+		return
+	}
+	if err := t.scheduler.Schedule(chatID, ids, t.now().Add(ttl), Source); err != nil {
+		logger.Errorf("Failed to schedule ephemeral deletion in chat %d: %v", chatID, err)
+	}
+}
+
+// DeleteNow 对话开启了阅后即焚时，尽快删除这些消息
+func (t *Tracker) DeleteNow(chatID int64, ids []int, delay time.Duration) {
+	if _, ok := t.TTL(chatID); !ok || len(ids) == 0 {
+		return
+	}
+	if err := t.scheduler.Schedule(chatID, ids, t.now().Add(delay), Source); err != nil {
+		logger.Errorf("Failed to schedule ephemeral deletion in chat %d: %v", chatID, err)
+	}
+}
+
+// Tracked 消息是否已安排删除
+func (t *Tracker) Tracked(chatID int64, id int) bool {
+	return t.scheduler.Scheduled(chatID, id)
+}
+
+// active 是否有对话开启了阅后即焚
+func (t *Tracker) active() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.chats) > 0
+}
+
+// Middleware 返回Telegram客户端中间件。所有发送、编辑消息的请求成功后，
+// 把结果中的消息ID交给 Track，因此插件无需修改即可支持阅后即焚
+func (t *Tracker) Middleware() telegram.Middleware {
+	return telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			if err := next.Invoke(ctx, input, output); err != nil {
+				return err
+			}
+			if !t.active() || IsExempt(ctx) {
+				return nil
+			}
+			if chatID, ids, ok := sentMessages(input, output); ok {
+				t.Track(chatID, ids)
+			}
+			return nil
+		}
+	})
+}
+
+// sentMessages 从发送或编辑请求及其结果中提取对话ID和消息ID。
+// 定时消息此时还不存在，不做记录
+func sentMessages(input bin.Encoder, output bin.Decoder) (int64, []int, bool) {
+	var peer tg.InputPeerClass
+	switch req := input.(type) {
+	case *tg.MessagesSendMessageRequest:
+		if req.ScheduleDate != 0 {
+			return 0, nil, false
+		}
+		peer = req.Peer
+	case *tg.MessagesSendMediaRequest:
+		if req.ScheduleDate != 0 {
+			return 0, nil, false
+		}
+		peer = req.Peer
+	case *tg.MessagesSendMultiMediaRequest:
+		if req.ScheduleDate != 0 {
+			return 0, nil, false
+		}
+		peer = req.Peer
+	case *tg.MessagesForwardMessagesRequest:
+		if req.ScheduleDate != 0 {
+			return 0, nil, false
+		}
+		peer = req.ToPeer
+	case *tg.MessagesSendInlineBotResultRequest:
+		if req.ScheduleDate != 0 {
+			return 0, nil, false
+		}
+		peer = req.Peer
+	case *tg.MessagesEditMessageRequest:
+		if req.ScheduleDate != 0 {
+			return 0, nil, false
+		}
+		chatID, ok := inputPeerToChatID(req.Peer)
+		return chatID, []int{req.ID}, ok
+	default:
+		return 0, nil, false
+	}
+
+	chatID, ok := inputPeerToChatID(peer)
+	if !ok {
+		return 0, nil, false
+	}
+	box, isBox := output.(*tg.UpdatesBox)
+	if !isBox {
+		return 0, nil, false
+	}
+	ids := updateMessageIDs(box.Updates)
+	return chatID, ids, len(ids) > 0
+}
+
+// updateMessageIDs 返回发送结果中新消息的ID
+func updateMessageIDs(updates tg.UpdatesClass) []int {
+	var list []tg.UpdateClass
+	switch u := updates.(type) {
+	case *tg.UpdateShortSentMessage:
+		return []int{u.ID}
+	case *tg.Updates:
+		list = u.Updates
+	case *tg.UpdatesCombined:
+		list = u.Updates
+	case *tg.UpdateShort:
+		list = []tg.UpdateClass{u.Update}
+	}
+
+	seen := make(map[int]bool)
+	var ids []int
+	add := func(id int) {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, update := range list {
+		switch upd := update.(type) {
+		case *tg.UpdateMessageID:
+			add(upd.ID)
+		case *tg.UpdateNewMessage:
+			add(upd.Message.GetID())
+		case *tg.UpdateNewChannelMessage:
+			add(upd.Message.GetID())
+		}
+	}
+	return ids
+}
+
+// inputPeerToChatID 将InputPeer转换为内部使用的对话ID。
+// 收藏夹(InputPeerSelf)没有对应的对话ID，不做记录
+func inputPeerToChatID(peer tg.InputPeerClass) (int64, bool) {
+	switch p := peer.(type) {
+	case *tg.InputPeerUser:
+		return p.UserID, true
+	case *tg.InputPeerChat:
+		return -p.ChatID, true
+	case *tg.InputPeerChannel:
+		return -1000000000000 - p.ChannelID, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,283 @@
+package ephemeral
+
+import (
+	"context"
+	"database/sql"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/deletion"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	_ "modernc.org/sqlite"
+)
+
+const chatID = -1000000000123
+
+// sendingInvoker 模拟发送成功的 tg.Invoker，新消息ID从 nextID 开始递增
+type sendingInvoker struct {
+	mu     sync.Mutex
+	nextID int
+}
+
+func (s *sendingInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	box := output.(*tg.UpdatesBox)
+	switch input.(type) {
+	case *tg.MessagesSendMessageRequest:
+		s.nextID++
+		box.Updates = &tg.UpdateShortSentMessage{ID: s.nextID}
+	case *tg.MessagesSendMultiMediaRequest:
+		// 相册的每张图片都是一条消息
+		var updates []tg.UpdateClass
+		for i := 0; i < 3; i++ {
+			s.nextID++
+			updates = append(updates, &tg.UpdateMessageID{ID: s.nextID, RandomID: int64(i)})
+		}
+		box.Updates = &tg.Updates{Updates: updates}
+	default:
+		box.Updates = &tg.Updates{}
+	}
+	return nil
+}
+
+// channelPeers 把所有对话解析为频道
+type channelPeers struct{}
+
+func (channelPeers) GetInputPeer(_ context.Context, peerID int64) (tg.InputPeerClass, error) {
+	return &tg.InputPeerChannel{ChannelID: -peerID - 1000000000000, AccessHash: 1}, nil
+}
+
+func (channelPeers) GetUserPeerWithFallback(_ context.Context, userID int64, _ tg.InputChannelClass) (*tg.InputPeerUser, error) {
+	return &tg.InputPeerUser{UserID: userID}, nil
+}
+
+func (channelPeers) GetUserPeerFromMessage(_ context.Context, _ tg.InputPeerClass, _ int, userID int64) (*tg.InputPeerUser, error) {
+	return &tg.InputPeerUser{UserID: userID}, nil
+}
+
+type trackerTest struct {
+	db      *sql.DB
+	tracker *Tracker
+	api     *tg.Client
+	now     time.Time
+}
+
+// newTrackerTest 创建使用临时数据库的记录器，api 的请求经过阅后即焚中间件
+func newTrackerTest(t *testing.T) *trackerTest {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "ephemeral.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	tt := &trackerTest{db: db, now: time.Unix(1700000000, 0)}
+	tt.tracker = NewTracker(db, deletion.NewScheduler(db))
+	tt.tracker.now = func() time.Time { return tt.now }
+	tt.api = tg.NewClient(tt.tracker.Middleware().Handle(&sendingInvoker{nextID: 200}))
+	return tt
+}
+
+// scheduled 返回对话中已安排删除的消息ID及其删除时间
+func (tt *trackerTest) scheduled(t *testing.T) map[int]int64 {
+	t.Helper()
+	rows, err := tt.db.Query("SELECT message_id, delete_at FROM pending_deletions WHERE chat_id = ? AND source = ?", chatID, Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	out := make(map[int]int64)
+	for rows.Next() {
+		var id int
+		var at int64
+		if err := rows.Scan(&id, &at); err != nil {
+			t.Fatal(err)
+		}
+		out[id] = at
+	}
+	return out
+}
+
+// commandContext 创建频道中ID为100的命令消息的上下文
+func (tt *trackerTest) commandContext(ctx context.Context) *command.CommandContext {
+	return &command.CommandContext{
+		Context:      ctx,
+		API:          tt.api,
+		PeerResolver: peers.NewResolver(channelPeers{}),
+		Message:      &core.MessageEvent{Message: &tg.Message{ID: 100}, ChatID: chatID},
+	}
+}
+
+func TestTrackMultiChunkResponse(t *testing.T) {
+	tt := newTrackerTest(t)
+	if err := tt.tracker.Enable(chatID, 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// 超长响应拆分为三段：第一段编辑命令消息，其余两段作为回复发送，三条消息一起安排删除
+	text := strings.Repeat("a", format.MaxMessageLength) + "\n" + strings.Repeat("b", format.MaxMessageLength) + "\nc"
+	if _, err := tt.commandContext(context.Background()).Respond(text, format.Plain); err != nil {
+		t.Fatal(err)
+	}
+	at := tt.now.Add(10 * time.Minute).Unix()
+	want := map[int]int64{100: at, 201: at, 202: at}
+	if got := tt.scheduled(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("scheduled = %v, want %v", got, want)
+	}
+	if n, err := tt.tracker.Pending(chatID); err != nil || n != 3 {
+		t.Errorf("Pending = %d, %v; want 3", n, err)
+	}
+	for _, id := range []int{100, 201, 202} {
+		if !tt.tracker.Tracked(chatID, id) {
+			t.Errorf("message %d should be tracked", id)
+		}
+	}
+}
+
+func TestTrackAlbum(t *testing.T) {
+	tt := newTrackerTest(t)
+	tt.tracker.Enable(chatID, time.Minute)
+	peer := &tg.InputPeerChannel{ChannelID: 123, AccessHash: 1}
+	if _, err := tt.api.MessagesSendMultiMedia(context.Background(), &tg.MessagesSendMultiMediaRequest{Peer: peer}); err != nil {
+		t.Fatal(err)
+	}
+	if got := tt.scheduled(t); len(got) != 3 || got[201] == 0 || got[203] == 0 {
+		t.Errorf("scheduled = %v, want all three album messages", got)
+	}
+}
+
+func TestExemptContext(t *testing.T) {
+	tt := newTrackerTest(t)
+	tt.tracker.Enable(chatID, time.Minute)
+
+	ctx := Exempt(context.Background())
+	if !IsExempt(ctx) || IsExempt(context.Background()) {
+		t.Fatal("IsExempt should only report contexts marked with Exempt")
+	}
+	text := strings.Repeat("x", format.MaxMessageLength) + "\ny"
+	if _, err := tt.commandContext(ctx).Respond(text, format.Plain); err != nil {
+		t.Fatal(err)
+	}
+	if got := tt.scheduled(t); len(got) != 0 {
+		t.Errorf("exempt response scheduled %v, want nothing", got)
+	}
+
+	// 同一对话中未豁免的响应仍然记录
+	if _, err := tt.commandContext(context.Background()).Respond("ok", format.Plain); err != nil {
+		t.Fatal(err)
+	}
+	if got := tt.scheduled(t); len(got) != 1 || got[100] == 0 {
+		t.Errorf("scheduled = %v, want only the edited command message", got)
+	}
+}
+
+func TestDisabledChatNotTracked(t *testing.T) {
+	tt := newTrackerTest(t)
+	tt.tracker.Enable(chatID-1, time.Minute)
+	if _, err := tt.commandContext(context.Background()).Respond("hello", format.Plain); err != nil {
+		t.Fatal(err)
+	}
+	if got := tt.scheduled(t); len(got) != 0 {
+		t.Errorf("scheduled = %v in a chat without ephemeral mode", got)
+	}
+
+	tt.tracker.Enable(chatID, time.Minute)
+	wasOn, err := tt.tracker.Disable(chatID)
+	if err != nil || !wasOn {
+		t.Fatalf("Disable = %v, %v", wasOn, err)
+	}
+	if wasOn, _ := tt.tracker.Disable(chatID); wasOn {
+		t.Error("second Disable should report it was already off")
+	}
+	tt.commandContext(context.Background()).Respond("hello", format.Plain)
+	if got := tt.scheduled(t); len(got) != 0 {
+		t.Errorf("scheduled = %v after disabling", got)
+	}
+}
+
+func TestDeleteNow(t *testing.T) {
+	tt := newTrackerTest(t)
+	tt.tracker.DeleteNow(chatID, []int{100}, 2*time.Second)
+	if len(tt.scheduled(t)) != 0 {
+		t.Fatal("DeleteNow should do nothing when ephemeral mode is off")
+	}
+	tt.tracker.Enable(chatID, time.Hour)
+	tt.tracker.DeleteNow(chatID, []int{100}, 2*time.Second)
+	if got := tt.scheduled(t); got[100] != tt.now.Add(2*time.Second).Unix() {
+		t.Errorf("scheduled = %v, want deletion after 2s instead of the TTL", got)
+	}
+}
+
+func TestEnablePersists(t *testing.T) {
+	tt := newTrackerTest(t)
+	if err := tt.tracker.Enable(chatID, 500*time.Millisecond); err == nil {
+		t.Error("Enable should reject TTLs under 1s")
+	}
+	if err := tt.tracker.Enable(chatID, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	tt.tracker.Enable(chatID, 10*time.Minute)
+	tt.tracker.Enable(42, time.Hour)
+	tt.tracker.Disable(42)
+
+	reloaded := NewTracker(tt.db, deletion.NewScheduler(tt.db))
+	if ttl, ok := reloaded.TTL(chatID); !ok || ttl != 10*time.Minute {
+		t.Errorf("reloaded TTL = %v, %v; want 10m", ttl, ok)
+	}
+	if _, ok := reloaded.TTL(42); ok {
+		t.Error("disabled chat should not be reloaded")
+	}
+
+	if err := NewTracker(nil, deletion.NewScheduler(nil)).Enable(chatID, time.Minute); err == nil {
+		t.Error("Enable without a database should fail")
+	}
+}
+
+func TestSentMessages(t *testing.T) {
+	channel := &tg.InputPeerChannel{ChannelID: 123}
+	sent := &tg.UpdatesBox{Updates: &tg.UpdateShortSentMessage{ID: 5}}
+	tests := []struct {
+		name   string
+		input  bin.Encoder
+		output bin.Decoder
+		chatID int64
+		ids    []int
+		ok     bool
+	}{
+		{"send to channel", &tg.MessagesSendMessageRequest{Peer: channel}, sent, chatID, []int{5}, true},
+		{"send to user", &tg.MessagesSendMessageRequest{Peer: &tg.InputPeerUser{UserID: 7}}, sent, 7, []int{5}, true},
+		{"send to group", &tg.MessagesSendMessageRequest{Peer: &tg.InputPeerChat{ChatID: 9}}, sent, -9, []int{5}, true},
+		{"saved messages", &tg.MessagesSendMessageRequest{Peer: &tg.InputPeerSelf{}}, sent, 0, nil, false},
+		{"scheduled message", &tg.MessagesSendMessageRequest{Peer: channel, ScheduleDate: 1}, sent, 0, nil, false},
+		{"edit", &tg.MessagesEditMessageRequest{Peer: channel, ID: 42}, &tg.UpdatesBox{Updates: &tg.Updates{}}, chatID, []int{42}, true},
+		{"media", &tg.MessagesSendMediaRequest{Peer: channel}, &tg.UpdatesBox{Updates: &tg.Updates{Updates: []tg.UpdateClass{
+			&tg.UpdateMessageID{ID: 6},
+			&tg.UpdateNewChannelMessage{Message: &tg.Message{ID: 6}},
+		}}}, chatID, []int{6}, true},
+		{"forward", &tg.MessagesForwardMessagesRequest{ToPeer: channel}, &tg.UpdatesBox{Updates: &tg.Updates{Updates: []tg.UpdateClass{
+			&tg.UpdateNewChannelMessage{Message: &tg.Message{ID: 7}},
+			&tg.UpdateNewChannelMessage{Message: &tg.Message{ID: 8}},
+		}}}, chatID, []int{7, 8}, true},
+		{"no new messages", &tg.MessagesSendMediaRequest{Peer: channel}, &tg.UpdatesBox{Updates: &tg.Updates{}}, chatID, nil, false},
+		{"other request", &tg.MessagesDeleteMessagesRequest{ID: []int{1}}, &tg.MessagesAffectedMessages{}, 0, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chatID, ids, ok := sentMessages(tt.input, tt.output)
+			if ok != tt.ok || (ok && (chatID != tt.chatID || !reflect.DeepEqual(ids, tt.ids))) {
+				t.Errorf("sentMessages = %d, %v, %v; want %d, %v, %v", chatID, ids, ok, tt.chatID, tt.ids, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package errctx
+
+import (
+	"context"
+	"errors"
+	"nexusvalet/pkg/logger"
+)
+
+// Error 附带请求字段(关联ID、对话、消息、命令)的错误
+type Error struct {
+	Fields logger.Fields
+	Err    error
+}
+
+// Error 实现error接口
+func (e *Error) Error() string {
+	return "[" + e.Fields.String() + "] " + e.Err.Error()
+}
+
+// Unwrap 返回原始错误
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap 用 context 中的日志字段包装错误。err为nil、context中没有字段或错误已被包装时原样返回
+func Wrap(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	var wrapped *Error
+	if errors.As(err, &wrapped) {
+		return err
+	}
+	f, ok := logger.FieldsFrom(ctx)
+	if !ok || f.String() == "" {
+		return err
+	}
+	return &Error{Fields: f, Err: err}
+}
+
+// CorrelationID 返回错误链中的关联ID，没有时返回空字符串
+func CorrelationID(err error) string {
+	var wrapped *Error
+	if errors.As(err, &wrapped) {
+		return wrapped.Fields.CorrelationID
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package errctx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nexusvalet/pkg/logger"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	base := errors.New("boom")
+	fields := logger.Fields{CorrelationID: "deadbeef", ChatID: -100, MessageID: 10, Command: "sb"}
+	ctx := logger.WithFields(context.Background(), fields)
+
+	err := Wrap(ctx, base)
+	if got, want := err.Error(), "[cid=deadbeef chat=-100 msg=10 cmd=sb] boom"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, base) || errors.Unwrap(err) != base {
+		t.Error("wrapped error should unwrap to the original")
+	}
+	if got := CorrelationID(err); got != "deadbeef" {
+		t.Errorf("CorrelationID = %q, want deadbeef", got)
+	}
+
+	// 已包装的错误不再重复添加字段，外层 fmt.Errorf 包装后仍然能取到关联ID
+	other := logger.WithFields(context.Background(), logger.Fields{CorrelationID: "cafebabe"})
+	if again := Wrap(other, err); again != err {
+		t.Errorf("Wrap of a wrapped error = %q, want it unchanged", again)
+	}
+	outer := fmt.Errorf("执行失败: %w", err)
+	if Wrap(other, outer) != outer || CorrelationID(outer) != "deadbeef" {
+		t.Errorf("outer error should keep the inner correlation ID, got %q", CorrelationID(outer))
+	}
+}
+
+func TestWrapWithoutFields(t *testing.T) {
+	base := errors.New("boom")
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"no fields", context.Background()},
+		{"zero fields", logger.WithFields(context.Background(), logger.Fields{})},
+	}
+	for _, tt := range tests {
+		if err := Wrap(tt.ctx, base); err != base {
+			t.Errorf("%s: Wrap = %q, want the original error", tt.name, err)
+		}
+	}
+	if Wrap(logger.WithFields(context.Background(), logger.Fields{CorrelationID: "x"}), nil) != nil {
+		t.Error("Wrap(nil) should be nil")
+	}
+	if CorrelationID(base) != "" || CorrelationID(nil) != "" {
+		t.Error("CorrelationID of an unwrapped error should be empty")
+	}
+}
@@ -0,0 +1,87 @@
+package flood
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// waitPattern 匹配错误文本中的等待秒数，兼容 "FLOOD_WAIT_30" 和 gotd 的 "FLOOD_WAIT (30)" 两种格式
+var waitPattern = regexp.MustCompile(`(FLOOD_WAIT|FLOOD_PREMIUM_WAIT|SLOWMODE_WAIT)(?:_| \()(\d+)`)
+
+// ParseWait 从错误中解析需要等待的时间，支持 FLOOD_WAIT、FLOOD_PREMIUM_WAIT 和 SLOWMODE_WAIT。
+// 错误被包装成文本后(例如经过 fmt.Errorf("%v"))也能识别
+func ParseWait(err error) (time.Duration, bool) {
+	if err == nil {
+		return 0, false
+	}
+	if d, ok := tgerr.AsFloodWait(err); ok {
+		return d, true
+	}
+	if rpcErr, ok := tgerr.As(err); ok && rpcErr.IsOneOf("SLOWMODE_WAIT") {
+		return time.Duration(rpcErr.Argument) * time.Second, true
+	}
+
+	m := waitPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0, false
+	}
+	seconds, convErr := strconv.Atoi(m[2])
+	if convErr != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// PeerChatID 把InputPeer转换为项目使用的chatID，用于选择对话的令牌桶。收藏夹和未知类型返回0
+func PeerChatID(peer tg.InputPeerClass) int64 {
+	switch p := peer.(type) {
+	case *tg.InputPeerUser:
+		return p.UserID
+	case *tg.InputPeerChat:
+		return -p.ChatID
+	case *tg.InputPeerChannel:
+		return -1000000000000 - p.ChannelID
+	}
+	return 0
+}
+
+// WaitTooLongError FLOOD_WAIT 超过允许自动等待的时间
+type WaitTooLongError struct {
+	Wait time.Duration
+	Err  error
+}
+
+func (e *WaitTooLongError) Error() string {
+	return "flood wait " + e.Wait.String() + " exceeds limit: " + e.Err.Error()
+}
+
+func (e *WaitTooLongError) Unwrap() error {
+	return e.Err
+}
+
+// IsWaitTooLong 错误是否为等待时间过长
+func IsWaitTooLong(err error) bool {
+	var e *WaitTooLongError
+	return errors.As(err, &e)
+}
+
+// sleepContext 等待d或ctx结束
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
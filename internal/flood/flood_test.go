@@ -0,0 +1,74 @@
+package flood
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+func TestParseWait(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		want   time.Duration
+		wantOK bool
+	}{
+		{"nil", nil, 0, false},
+		{"rpc FLOOD_WAIT", tgerr.New(420, "FLOOD_WAIT_30"), 30 * time.Second, true},
+		{"rpc FLOOD_PREMIUM_WAIT", tgerr.New(420, "FLOOD_PREMIUM_WAIT_5"), 5 * time.Second, true},
+		{"rpc SLOWMODE_WAIT", tgerr.New(420, "SLOWMODE_WAIT_15"), 15 * time.Second, true},
+		{"wrapped rpc error", fmt.Errorf("send: %w", tgerr.New(420, "FLOOD_WAIT_7")), 7 * time.Second, true},
+		{"underscore text format", errors.New("send failed: FLOOD_WAIT_42"), 42 * time.Second, true},
+		{"gotd text format", errors.New("rpc error code 420: FLOOD_WAIT (12)"), 12 * time.Second, true},
+		{"flattened rpc error", fmt.Errorf("edit: %v", tgerr.New(420, "FLOOD_WAIT_3")), 3 * time.Second, true},
+		{"slowmode text format", errors.New("rpc error code 400: SLOWMODE_WAIT (60)"), 60 * time.Second, true},
+		{"slowmode underscore text", errors.New("SLOWMODE_WAIT_9"), 9 * time.Second, true},
+		{"zero seconds", errors.New("FLOOD_WAIT_0"), 0, true},
+		{"other rpc error", tgerr.New(400, "MESSAGE_TOO_LONG"), 0, false},
+		{"no number", errors.New("FLOOD_WAIT"), 0, false},
+		{"plain error", errors.New("connection reset"), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseWait(tt.err)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ParseWait(%v) = %s, %v; want %s, %v", tt.err, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPeerChatID(t *testing.T) {
+	tests := []struct {
+		peer tg.InputPeerClass
+		want int64
+	}{
+		{&tg.InputPeerUser{UserID: 123}, 123},
+		{&tg.InputPeerChat{ChatID: 456}, -456},
+		{&tg.InputPeerChannel{ChannelID: 1234567890}, -1001234567890},
+		{&tg.InputPeerSelf{}, 0},
+	}
+	for _, tt := range tests {
+		if got := PeerChatID(tt.peer); got != tt.want {
+			t.Errorf("PeerChatID(%T) = %d, want %d", tt.peer, got, tt.want)
+		}
+	}
+}
+
+func TestWaitTooLongError(t *testing.T) {
+	cause := tgerr.New(420, "FLOOD_WAIT_300")
+	err := fmt.Errorf("send: %w", &WaitTooLongError{Wait: 300 * time.Second, Err: cause})
+	if !IsWaitTooLong(err) {
+		t.Fatal("IsWaitTooLong should see through wrapping")
+	}
+	if !tgerr.Is(err, "FLOOD_WAIT") {
+		t.Fatal("WaitTooLongError should unwrap to the rpc error")
+	}
+	if IsWaitTooLong(cause) {
+		t.Fatal("plain flood wait is not WaitTooLong")
+	}
+}
@@ -0,0 +1,228 @@
+package flood
+
+import (
+	"context"
+	"math"
+	"nexusvalet/pkg/logger"
+	"sync"
+	"time"
+)
+
+// Options 限流参数
+type Options struct {
+	PerMinute  int           // 每个对话每分钟最多发送/编辑的消息数，0表示不限制
+	Burst      int           // 短时间内允许连续发送的消息数，0表示等于PerMinute
+	MaxWait    time.Duration // 自动等待的最长FLOOD_WAIT，更长时直接返回错误
+	MaxRetries int           // 遇到FLOOD_WAIT后最多重试的次数
+}
+
+// DefaultOptions 默认参数
+func DefaultOptions() Options {
+	return Options{
+		PerMinute:  20,
+		MaxWait:    60 * time.Second,
+		MaxRetries: 3,
+	}
+}
+
+// idleBucketTTL 令牌桶闲置超过该时间且已回满时会被清理
+const idleBucketTTL = 10 * time.Minute
+
+// bucket 一个对话的令牌桶
+type bucket struct {
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time // 收到FLOOD_WAIT后在此之前不再发送
+}
+
+// Limiter 按对话限制发送频率，并在FLOOD_WAIT后等待重试。可并发使用
+type Limiter struct {
+	opts    Options
+	buckets map[int64]*bucket
+	mutex   sync.Mutex
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewLimiter 创建限流器
+func NewLimiter(opts Options) *Limiter {
+	return &Limiter{
+		opts:    opts,
+		buckets: make(map[int64]*bucket),
+		now:     time.Now,
+		sleep:   sleepContext,
+	}
+}
+
+// Configure 更新限流参数，已有的令牌桶按新的容量截断
+func (l *Limiter) Configure(opts Options) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.opts = opts
+	for _, b := range l.buckets {
+		if capacity := l.capacityLocked(); b.tokens > capacity {
+			b.tokens = capacity
+		}
+	}
+}
+
+// Options 返回当前限流参数
+func (l *Limiter) Options() Options {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.opts
+}
+
+// capacityLocked 令牌桶容量，调用方需持有锁
+func (l *Limiter) capacityLocked() float64 {
+	if l.opts.Burst > 0 {
+		return float64(l.opts.Burst)
+	}
+	return float64(l.opts.PerMinute)
+}
+
+// reserve 为对话预留一次发送并返回需要等待的时间。
+// 令牌不足时令牌数会变为负数，之后的调用依次排在后面，并发调用不会同时放行
+func (l *Limiter) reserve(chatID int64) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[chatID]
+	if !ok {
+		l.pruneLocked(now)
+		b = &bucket{tokens: l.capacityLocked(), last: now}
+		l.buckets[chatID] = b
+	}
+
+	var wait time.Duration
+	if b.blockedUntil.After(now) {
+		wait = b.blockedUntil.Sub(now)
+	}
+	if l.opts.PerMinute <= 0 {
+		return wait
+	}
+
+	rate := float64(l.opts.PerMinute) / float64(time.Minute) // 每纳秒补充的令牌
+	capacity := l.capacityLocked()
+	b.tokens += float64(now.Sub(b.last)) * rate
+	if b.tokens > capacity {
+		b.tokens = capacity
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens < 0 {
+		// 向上取整，避免浮点误差导致提前放行
+		if d := time.Duration(math.Ceil(-b.tokens / rate)); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// pruneLocked 清理闲置的令牌桶，调用方需持有锁
+func (l *Limiter) pruneLocked(now time.Time) {
+	if len(l.buckets) < 256 {
+		return
+	}
+	for id, b := range l.buckets {
+		if now.Sub(b.last) > idleBucketTTL && now.After(b.blockedUntil) {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+// Wait 等待对话的发送额度，ctx结束时返回其错误
+func (l *Limiter) Wait(ctx context.Context, chatID int64) error {
+	wait := l.reserve(chatID)
+	if wait <= 0 {
+		return nil
+	}
+	logger.Ctx(ctx).Debugf("Rate limit: waiting %s before sending to chat %d", wait.Round(time.Millisecond), chatID)
+	return l.sleep(ctx, wait)
+}
+
+// Block 收到FLOOD_WAIT后，在d时间内暂停向该对话发送
+func (l *Limiter) Block(chatID int64, d time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[chatID]
+	if !ok {
+		b = &bucket{tokens: l.capacityLocked(), last: now}
+		l.buckets[chatID] = b
+	}
+	if until := now.Add(d); until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+}
+
+// Do 在对话的发送额度内执行fn，遇到FLOOD_WAIT时等待后重试
+func (l *Limiter) Do(ctx context.Context, chatID int64, fn func() error) error {
+	return l.run(ctx, chatID, true, fn)
+}
+
+// Retry 执行fn并在FLOOD_WAIT后等待重试，不消耗发送额度，用于删除消息等不计入发送频率的请求
+func (l *Limiter) Retry(ctx context.Context, chatID int64, fn func() error) error {
+	return l.run(ctx, chatID, false, fn)
+}
+
+// run 执行请求，limited为true时先等待发送额度
+func (l *Limiter) run(ctx context.Context, chatID int64, limited bool, fn func() error) error {
+	opts := l.Options()
+	for attempt := 0; ; attempt++ {
+		if limited {
+			if err := l.Wait(ctx, chatID); err != nil {
+				return err
+			}
+		} else if err := l.waitBlocked(ctx, chatID); err != nil {
+			return err
+		}
+
+		err := fn()
+		wait, ok := ParseWait(err)
+		if !ok {
+			return err
+		}
+
+		l.Block(chatID, wait)
+		if wait > opts.MaxWait {
+			return &WaitTooLongError{Wait: wait, Err: err}
+		}
+		if attempt >= opts.MaxRetries {
+			return err
+		}
+		logger.Ctx(ctx).Warnf("FLOOD_WAIT %s for chat %d, retrying (%d/%d)", wait, chatID, attempt+1, opts.MaxRetries)
+	}
+}
+
+// waitBlocked 只等待FLOOD_WAIT造成的暂停
+func (l *Limiter) waitBlocked(ctx context.Context, chatID int64) error {
+	l.mutex.Lock()
+	var wait time.Duration
+	if b, ok := l.buckets[chatID]; ok {
+		wait = b.blockedUntil.Sub(l.now())
+	}
+	l.mutex.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	return l.sleep(ctx, wait)
+}
+
+// Call 在对话的发送额度内执行返回结果的请求，遇到FLOOD_WAIT时等待后重试。l为nil时直接执行
+func Call[T any](ctx context.Context, l *Limiter, chatID int64, fn func() (T, error)) (T, error) {
+	if l == nil {
+		return fn()
+	}
+	var result T
+	err := l.Do(ctx, chatID, func() error {
+		var err error
+		result, err = fn()
+		return err
+	})
+	return result, err
+}
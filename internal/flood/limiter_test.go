@@ -0,0 +1,277 @@
+package flood
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tgerr"
+)
+
+// fakeClock 替换限流器的时钟和等待，等待时直接把时间向前推
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(opts Options) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := NewLimiter(opts)
+	l.now = func() time.Time { return clock.now }
+	l.sleep = func(ctx context.Context, d time.Duration) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		clock.slept = append(clock.slept, d)
+		clock.advance(d)
+		return nil
+	}
+	return l, clock
+}
+
+func TestReserveBurstAndRefill(t *testing.T) {
+	l, clock := newTestLimiter(Options{PerMinute: 60, Burst: 3})
+
+	// 容量内的请求不需要等待
+	for i := 0; i < 3; i++ {
+		if wait := l.reserve(1); wait != 0 {
+			t.Fatalf("reserve %d within burst waited %s", i, wait)
+		}
+	}
+	// 每秒补充一个令牌，之后的请求依次排队
+	if wait := l.reserve(1); wait != time.Second {
+		t.Fatalf("4th reserve waited %s, want 1s", wait)
+	}
+	if wait := l.reserve(1); wait != 2*time.Second {
+		t.Fatalf("5th reserve waited %s, want 2s", wait)
+	}
+
+	// 其他对话有自己的令牌桶
+	if wait := l.reserve(2); wait != 0 {
+		t.Fatalf("other chat waited %s", wait)
+	}
+
+	// 补充的令牌不超过容量
+	clock.advance(time.Minute)
+	for i := 0; i < 3; i++ {
+		if wait := l.reserve(1); wait != 0 {
+			t.Fatalf("reserve %d after refill waited %s", i, wait)
+		}
+	}
+	if wait := l.reserve(1); wait != time.Second {
+		t.Fatalf("reserve beyond capacity after refill waited %s, want 1s", wait)
+	}
+}
+
+func TestReservePartialRefill(t *testing.T) {
+	l, clock := newTestLimiter(Options{PerMinute: 60, Burst: 1})
+	l.reserve(1)
+	clock.advance(500 * time.Millisecond)
+	if wait := l.reserve(1); wait != 500*time.Millisecond {
+		t.Fatalf("reserve after half a token waited %s, want 500ms", wait)
+	}
+}
+
+func TestReserveDefaultBurstAndUnlimited(t *testing.T) {
+	l, _ := newTestLimiter(Options{PerMinute: 20})
+	for i := 0; i < 20; i++ {
+		if wait := l.reserve(1); wait != 0 {
+			t.Fatalf("reserve %d waited %s with burst = PerMinute", i, wait)
+		}
+	}
+	if wait := l.reserve(1); wait != 3*time.Second {
+		t.Fatalf("21st reserve waited %s, want 3s", wait)
+	}
+
+	unlimited, _ := newTestLimiter(Options{PerMinute: 0})
+	for i := 0; i < 1000; i++ {
+		if wait := unlimited.reserve(1); wait != 0 {
+			t.Fatalf("unlimited reserve waited %s", wait)
+		}
+	}
+}
+
+func TestConfigureTruncatesTokens(t *testing.T) {
+	l, _ := newTestLimiter(Options{PerMinute: 60, Burst: 10})
+	l.reserve(1)
+	l.Configure(Options{PerMinute: 60, Burst: 2})
+	l.reserve(1)
+	l.reserve(1)
+	if wait := l.reserve(1); wait != time.Second {
+		t.Fatalf("reserve after shrinking burst waited %s, want 1s", wait)
+	}
+}
+
+func TestWaitSleepsForReservation(t *testing.T) {
+	l, clock := newTestLimiter(Options{PerMinute: 60, Burst: 1})
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []time.Duration{time.Second, time.Second}
+	if len(clock.slept) != len(want) || clock.slept[0] != want[0] || clock.slept[1] != want[1] {
+		t.Fatalf("slept %v, want %v", clock.slept, want)
+	}
+}
+
+func TestBlockDelaysSends(t *testing.T) {
+	l, clock := newTestLimiter(Options{PerMinute: 0})
+	l.Block(1, 5*time.Second)
+	if wait := l.reserve(1); wait != 5*time.Second {
+		t.Fatalf("reserve while blocked waited %s, want 5s", wait)
+	}
+	// 更短的暂停不会缩短已有的暂停
+	l.Block(1, time.Second)
+	clock.advance(2 * time.Second)
+	if wait := l.reserve(1); wait != 3*time.Second {
+		t.Fatalf("reserve waited %s, want remaining 3s", wait)
+	}
+	if wait := l.reserve(2); wait != 0 {
+		t.Fatalf("other chat waited %s", wait)
+	}
+}
+
+func TestDoRetriesAfterFloodWait(t *testing.T) {
+	l, clock := newTestLimiter(Options{PerMinute: 0, MaxWait: time.Minute, MaxRetries: 3})
+	calls := 0
+	err := l.Do(context.Background(), 1, func() error {
+		calls++
+		if calls == 1 {
+			return tgerr.New(420, "FLOOD_WAIT_3")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do = %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("fn called %d times, want 2", calls)
+	}
+	if len(clock.slept) != 1 || clock.slept[0] != 3*time.Second {
+		t.Fatalf("slept %v, want [3s]", clock.slept)
+	}
+}
+
+func TestRetryDoesNotConsumeTokens(t *testing.T) {
+	l, clock := newTestLimiter(Options{PerMinute: 60, Burst: 1, MaxWait: time.Minute, MaxRetries: 1})
+	for i := 0; i < 5; i++ {
+		if err := l.Retry(context.Background(), 1, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(clock.slept) != 0 {
+		t.Fatalf("Retry slept %v", clock.slept)
+	}
+	if wait := l.reserve(1); wait != 0 {
+		t.Fatalf("reserve after Retry waited %s", wait)
+	}
+
+	// FLOOD_WAIT 之后 Retry 也会等待暂停结束
+	calls := 0
+	err := l.Retry(context.Background(), 1, func() error {
+		calls++
+		if calls == 1 {
+			return tgerr.New(420, "FLOOD_WAIT_4")
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("Retry = %v after %d calls", err, calls)
+	}
+	if len(clock.slept) != 1 || clock.slept[0] != 4*time.Second {
+		t.Fatalf("slept %v, want [4s]", clock.slept)
+	}
+}
+
+func TestDoGivesUpAfterMaxRetries(t *testing.T) {
+	l, _ := newTestLimiter(Options{PerMinute: 0, MaxWait: time.Minute, MaxRetries: 2})
+	calls := 0
+	err := l.Do(context.Background(), 1, func() error {
+		calls++
+		return tgerr.New(420, "FLOOD_WAIT_1")
+	})
+	if !tgerr.Is(err, "FLOOD_WAIT") || IsWaitTooLong(err) {
+		t.Fatalf("Do = %v, want the last FLOOD_WAIT error", err)
+	}
+	if calls != 3 {
+		t.Fatalf("fn called %d times, want 3", calls)
+	}
+}
+
+func TestDoWaitTooLong(t *testing.T) {
+	l, clock := newTestLimiter(Options{PerMinute: 0, MaxWait: time.Minute, MaxRetries: 3})
+	calls := 0
+	err := l.Do(context.Background(), 1, func() error {
+		calls++
+		return tgerr.New(420, "FLOOD_WAIT_120")
+	})
+	var tooLong *WaitTooLongError
+	if !errors.As(err, &tooLong) {
+		t.Fatalf("Do = %v, want WaitTooLongError", err)
+	}
+	if tooLong.Wait != 120*time.Second || !tgerr.Is(err, "FLOOD_WAIT") {
+		t.Fatalf("WaitTooLongError = %+v", tooLong)
+	}
+	if calls != 1 || len(clock.slept) != 0 {
+		t.Fatalf("fn called %d times and slept %v, want one call and no sleep", calls, clock.slept)
+	}
+	// 对话仍然被暂停，之后的发送要等待
+	if wait := l.reserve(1); wait != 120*time.Second {
+		t.Fatalf("reserve after long flood wait waited %s, want 120s", wait)
+	}
+}
+
+func TestDoReturnsOtherErrors(t *testing.T) {
+	l, _ := newTestLimiter(DefaultOptions())
+	want := tgerr.New(400, "MESSAGE_TOO_LONG")
+	calls := 0
+	err := l.Do(context.Background(), 1, func() error {
+		calls++
+		return want
+	})
+	if !errors.Is(err, want) || calls != 1 {
+		t.Fatalf("Do = %v after %d calls", err, calls)
+	}
+}
+
+func TestDoStopsOnCancelledContext(t *testing.T) {
+	l, _ := newTestLimiter(Options{PerMinute: 60, Burst: 1})
+	l.reserve(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	err := l.Do(ctx, 1, func() error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || called {
+		t.Fatalf("Do = %v, called = %v; want context.Canceled without calling fn", err, called)
+	}
+}
+
+func TestCallWithNilLimiter(t *testing.T) {
+	got, err := Call(context.Background(), nil, 1, func() (int, error) { return 42, nil })
+	if err != nil || got != 42 {
+		t.Fatalf("Call(nil) = %d, %v", got, err)
+	}
+
+	l, _ := newTestLimiter(Options{PerMinute: 0, MaxWait: time.Minute, MaxRetries: 1})
+	calls := 0
+	got, err = Call(context.Background(), l, 1, func() (int, error) {
+		calls++
+		if calls == 1 {
+			return 0, tgerr.New(420, "FLOOD_WAIT_1")
+		}
+		return 7, nil
+	})
+	if err != nil || got != 7 {
+		t.Fatalf("Call = %d, %v; want 7 after retry", got, err)
+	}
+}
@@ -0,0 +1,125 @@
+package format
+
+import (
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/gotd/td/tg"
+)
+
+// Mode 消息文本的格式标记
+type Mode int
+
+const (
+	Plain    Mode = iota // 不解析，原样发送
+	HTML                 // <b> <i> <u> <s> <code> <pre> <a href> 子集
+	Markdown             // **粗体** *斜体* _斜体_ __下划线__ ~~删除线~~ `代码` ```代码块``` [文字](链接)
+)
+
+// Parse 按mode解析文本中的格式标记，返回去掉标记后的文本和对应的消息实体。
+// 实体的偏移和长度以UTF-16为单位。解析是宽松的：无法识别或未闭合的标记按原文保留
+func Parse(mode Mode, s string) (string, []tg.MessageEntityClass) {
+	switch mode {
+	case HTML:
+		return parseHTML(s)
+	case Markdown:
+		return parseMarkdown(s)
+	}
+	return s, nil
+}
+
+// EscapeHTML 转义HTML模式中有特殊含义的字符，用于把用户输入等动态内容拼接到HTML文本中
+func EscapeHTML(s string) string {
+	return html.EscapeString(s)
+}
+
+// markdownEscaper 转义Markdown模式中有特殊含义的字符
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "[", `\[`, "]", `\]`,
+)
+
+// EscapeMarkdown 转义Markdown模式中有特殊含义的字符
+func EscapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// utf16Len 返回字符串的UTF-16长度，与消息实体的偏移单位一致
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// builder 拼接输出文本并记录实体
+type builder struct {
+	text     strings.Builder
+	offset   int // 已写入文本的UTF-16长度
+	entities []tg.MessageEntityClass
+}
+
+// write 写入纯文本
+func (b *builder) write(s string) {
+	b.text.WriteString(s)
+	b.offset += utf16Len(s)
+}
+
+// add 添加从start到当前位置的实体，长度为0时忽略。newEntity根据偏移和长度创建实体
+func (b *builder) add(start int, newEntity func(offset, length int) tg.MessageEntityClass) {
+	if length := b.offset - start; length > 0 {
+		if entity := newEntity(start, length); entity != nil {
+			b.entities = append(b.entities, entity)
+		}
+	}
+}
+
+// result 返回文本和按偏移排序的实体。嵌套的实体先结束的先被添加，需要重新排序
+func (b *builder) result() (string, []tg.MessageEntityClass) {
+	sort.SliceStable(b.entities, func(i, j int) bool {
+		return b.entities[i].GetOffset() < b.entities[j].GetOffset()
+	})
+	return b.text.String(), b.entities
+}
+
+func bold(offset, length int) tg.MessageEntityClass {
+	return &tg.MessageEntityBold{Offset: offset, Length: length}
+}
+
+func italic(offset, length int) tg.MessageEntityClass {
+	return &tg.MessageEntityItalic{Offset: offset, Length: length}
+}
+
+func underline(offset, length int) tg.MessageEntityClass {
+	return &tg.MessageEntityUnderline{Offset: offset, Length: length}
+}
+
+func strike(offset, length int) tg.MessageEntityClass {
+	return &tg.MessageEntityStrike{Offset: offset, Length: length}
+}
+
+func code(offset, length int) tg.MessageEntityClass {
+	return &tg.MessageEntityCode{Offset: offset, Length: length}
+}
+
+// pre 返回指定语言的代码块实体
+func pre(language string) func(offset, length int) tg.MessageEntityClass {
+	return func(offset, length int) tg.MessageEntityClass {
+		return &tg.MessageEntityPre{Offset: offset, Length: length, Language: language}
+	}
+}
+
+// link 返回指向url的链接实体，url为空时不创建
+func link(url string) func(offset, length int) tg.MessageEntityClass {
+	return func(offset, length int) tg.MessageEntityClass {
+		if url == "" {
+			return nil
+		}
+		return &tg.MessageEntityTextURL{Offset: offset, Length: length, URL: url}
+	}
+}
@@ -0,0 +1,159 @@
+package format
+
+import (
+	"html"
+	"strings"
+
+	"github.com/gotd/td/tg"
+)
+
+// htmlTag 一个已打开的HTML标签
+type htmlTag struct {
+	name  string
+	start int
+	attr  string // a的href或pre的语言
+}
+
+// htmlEntities 支持的标签及其实体，a和pre需要属性，单独处理
+var htmlEntities = map[string]func(offset, length int) tg.MessageEntityClass{
+	"b":      bold,
+	"strong": bold,
+	"i":      italic,
+	"em":     italic,
+	"u":      underline,
+	"ins":    underline,
+	"s":      strike,
+	"strike": strike,
+	"del":    strike,
+	"code":   code,
+}
+
+// parseHTML 解析HTML子集
+func parseHTML(s string) (string, []tg.MessageEntityClass) {
+	var b builder
+	var stack []htmlTag
+
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			b.write(html.UnescapeString(s))
+			break
+		}
+		if lt > 0 {
+			b.write(html.UnescapeString(s[:lt]))
+			s = s[lt:]
+		}
+
+		gt := strings.IndexByte(s, '>')
+		if gt < 0 {
+			b.write(html.UnescapeString(s))
+			break
+		}
+		raw := s[:gt+1]
+		s = s[gt+1:]
+
+		name, attrs, closing := splitTag(raw[1:gt])
+		if !supportedTag(name) {
+			b.write(raw)
+			continue
+		}
+
+		if !closing {
+			tag := htmlTag{name: name, start: b.offset}
+			switch name {
+			case "a":
+				tag.attr = attrValue(attrs, "href")
+			case "code":
+				// <pre><code class="language-go"> 设置外层代码块的语言
+				if n := len(stack); n > 0 && stack[n-1].name == "pre" {
+					if lang, ok := strings.CutPrefix(attrValue(attrs, "class"), "language-"); ok {
+						stack[n-1].attr = lang
+					}
+				}
+			}
+			stack = append(stack, tag)
+			continue
+		}
+
+		// 关闭最近的同名标签，其中未闭合的标签一并在此结束
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].name != name {
+				continue
+			}
+			for j := len(stack) - 1; j >= i; j-- {
+				closeTag(&b, stack, j)
+			}
+			stack = stack[:i]
+			break
+		}
+	}
+
+	for j := len(stack) - 1; j >= 0; j-- {
+		closeTag(&b, stack, j)
+	}
+	return b.result()
+}
+
+// closeTag 结束stack[i]对应的实体
+func closeTag(b *builder, stack []htmlTag, i int) {
+	tag := stack[i]
+	switch tag.name {
+	case "a":
+		b.add(tag.start, link(tag.attr))
+	case "pre":
+		b.add(tag.start, pre(tag.attr))
+	case "code":
+		// 代码块内的code只用于指定语言
+		if i > 0 && stack[i-1].name == "pre" {
+			return
+		}
+		b.add(tag.start, code)
+	default:
+		b.add(tag.start, htmlEntities[tag.name])
+	}
+}
+
+// supportedTag 是否为支持的标签
+func supportedTag(name string) bool {
+	_, ok := htmlEntities[name]
+	return ok || name == "a" || name == "pre"
+}
+
+// splitTag 拆分标签内容为小写的标签名和属性部分
+func splitTag(content string) (name, attrs string, closing bool) {
+	content = strings.TrimSpace(content)
+	if rest, ok := strings.CutPrefix(content, "/"); ok {
+		closing = true
+		content = strings.TrimSpace(rest)
+	}
+	name, attrs, _ = strings.Cut(content, " ")
+	return strings.ToLower(name), attrs, closing
+}
+
+// attrValue 读取属性值，支持双引号、单引号和不带引号的写法
+func attrValue(attrs, key string) string {
+	for attrs != "" {
+		attrs = strings.TrimLeft(attrs, " \t\n")
+		eq := strings.IndexByte(attrs, '=')
+		if eq < 0 {
+			return ""
+		}
+		name := strings.ToLower(strings.TrimSpace(attrs[:eq]))
+		rest := strings.TrimLeft(attrs[eq+1:], " ")
+
+		var value string
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			end := strings.IndexByte(rest[1:], rest[0])
+			if end < 0 {
+				return ""
+			}
+			value, attrs = rest[1:end+1], rest[end+2:]
+		} else {
+			value, attrs, _ = strings.Cut(rest, " ")
+		}
+		if name == key {
+			return html.UnescapeString(value)
+		}
+	}
+	return ""
+}
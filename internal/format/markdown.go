@@ -0,0 +1,235 @@
+package format
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gotd/td/tg"
+)
+
+// mdKind Markdown词法单元的类型
+type mdKind int
+
+const (
+	mdText mdKind = iota
+	mdCode
+	mdPre
+	mdLink
+	mdDelim
+)
+
+// mdToken Markdown词法单元
+type mdToken struct {
+	kind     mdKind
+	text     string // 文本、代码内容、链接文字或分隔符
+	attr     string // 代码块语言或链接地址
+	canOpen  bool
+	canClose bool
+	match    int // 配对的分隔符下标，-1表示未配对
+}
+
+// mdDelims 成对使用的分隔符，较长的在前
+var mdDelims = []string{"**", "__", "~~", "*", "_"}
+
+// mdEntities 分隔符对应的实体
+var mdEntities = map[string]func(offset, length int) tg.MessageEntityClass{
+	"**": bold,
+	"__": underline,
+	"~~": strike,
+	"*":  italic,
+	"_":  italic,
+}
+
+// mdEscapable 可以用反斜杠转义的字符
+const mdEscapable = "\\*_~`[]()"
+
+// parseMarkdown 解析Markdown子集
+func parseMarkdown(s string) (string, []tg.MessageEntityClass) {
+	tokens := tokenizeMarkdown(s)
+	pairDelims(tokens)
+
+	var b builder
+	var starts []int
+	for i, t := range tokens {
+		switch t.kind {
+		case mdText:
+			b.write(t.text)
+		case mdCode:
+			start := b.offset
+			b.write(t.text)
+			b.add(start, code)
+		case mdPre:
+			start := b.offset
+			b.write(t.text)
+			b.add(start, pre(t.attr))
+		case mdLink:
+			start := b.offset
+			b.write(t.text)
+			b.add(start, link(t.attr))
+		case mdDelim:
+			switch {
+			case t.match < 0:
+				b.write(t.text)
+			case t.match > i:
+				starts = append(starts, b.offset)
+			default:
+				start := starts[len(starts)-1]
+				starts = starts[:len(starts)-1]
+				b.add(start, mdEntities[t.text])
+			}
+		}
+	}
+	return b.result()
+}
+
+// tokenizeMarkdown 把文本拆分为词法单元。代码、代码块和链接文字中的内容不再解析
+func tokenizeMarkdown(s string) []mdToken {
+	var tokens []mdToken
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			tokens = append(tokens, mdToken{kind: mdText, text: text.String(), match: -1})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		if c == '\\' && i+1 < len(s) && strings.IndexByte(mdEscapable, s[i+1]) >= 0 {
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+		}
+
+		if strings.HasPrefix(s[i:], "```") {
+			if end := strings.Index(s[i+3:], "```"); end >= 0 {
+				flush()
+				content := s[i+3 : i+3+end]
+				lang := ""
+				// 第一行只有一个单词时视为语言
+				if first, rest, ok := strings.Cut(content, "\n"); ok && first != "" && !strings.ContainsAny(first, " \t") {
+					lang, content = first, rest
+				}
+				content = strings.TrimPrefix(content, "\n")
+				content = strings.TrimSuffix(content, "\n")
+				tokens = append(tokens, mdToken{kind: mdPre, text: content, attr: lang, match: -1})
+				i += 3 + end + 3
+				continue
+			}
+		}
+
+		if c == '`' {
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				flush()
+				tokens = append(tokens, mdToken{kind: mdCode, text: s[i+1 : i+1+end], match: -1})
+				i += 1 + end + 1
+				continue
+			}
+		}
+
+		if c == '[' {
+			if label, url, n, ok := parseLink(s[i:]); ok {
+				flush()
+				tokens = append(tokens, mdToken{kind: mdLink, text: label, attr: url, match: -1})
+				i += n
+				continue
+			}
+		}
+
+		if d := delimAt(s[i:]); d != "" {
+			flush()
+			prev, _ := utf8.DecodeLastRuneInString(s[:i])
+			next, _ := utf8.DecodeRuneInString(s[i+len(d):])
+			if i == 0 {
+				prev = ' '
+			}
+			if i+len(d) >= len(s) {
+				next = ' '
+			}
+			t := mdToken{
+				kind:     mdDelim,
+				text:     d,
+				canOpen:  !unicode.IsSpace(next),
+				canClose: !unicode.IsSpace(prev),
+				match:    -1,
+			}
+			// 单个*和_不在单词内部生效，避免 snake_case 和 2*3*4 被误解析
+			if len(d) == 1 {
+				t.canOpen = t.canOpen && !isWordRune(prev)
+				t.canClose = t.canClose && !isWordRune(next)
+			}
+			tokens = append(tokens, t)
+			i += len(d)
+			continue
+		}
+
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+	return tokens
+}
+
+// pairDelims 为分隔符配对，未配对的分隔符按原文输出
+func pairDelims(tokens []mdToken) {
+	var open []int
+	for i := range tokens {
+		t := &tokens[i]
+		if t.kind != mdDelim {
+			continue
+		}
+		if t.canClose {
+			matched := false
+			for j := len(open) - 1; j >= 0; j-- {
+				if tokens[open[j]].text == t.text {
+					tokens[open[j]].match = i
+					t.match = open[j]
+					// 中间未闭合的分隔符不再参与配对
+					open = open[:j]
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+		}
+		if t.canOpen {
+			open = append(open, i)
+		}
+	}
+}
+
+// delimAt 返回s开头的分隔符
+func delimAt(s string) string {
+	for _, d := range mdDelims {
+		if strings.HasPrefix(s, d) {
+			return d
+		}
+	}
+	return ""
+}
+
+// parseLink 解析 [文字](链接)，返回文字、链接和消耗的字节数
+func parseLink(s string) (label, url string, n int, ok bool) {
+	closeLabel := strings.Index(s, "](")
+	if closeLabel < 1 || strings.ContainsAny(s[1:closeLabel], "[\n") {
+		return "", "", 0, false
+	}
+	closeURL := strings.IndexByte(s[closeLabel+2:], ')')
+	if closeURL < 1 {
+		return "", "", 0, false
+	}
+	url = s[closeLabel+2 : closeLabel+2+closeURL]
+	if strings.ContainsAny(url, " \n") {
+		return "", "", 0, false
+	}
+	return s[1:closeLabel], url, closeLabel + 2 + closeURL + 1, true
+}
+
+// isWordRune 是否为单词中的字符
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
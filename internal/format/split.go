@@ -0,0 +1,111 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/gotd/td/tg"
+)
+
+// MaxMessageLength 单条消息文本的最大长度(UTF-16)
+const MaxMessageLength = 4096
+
+// Chunk 拆分后的一段消息
+type Chunk struct {
+	Text     string
+	Entities []tg.MessageEntityClass
+}
+
+// Split 把解析后的文本和实体拆分为长度不超过limit(UTF-16)的多段，尽量在换行处拆分。
+// 跨越拆分位置的实体在两段中各保留一部分
+func Split(text string, entities []tg.MessageEntityClass, limit int) []Chunk {
+	var chunks []Chunk
+	start := 0 // 当前段在text中的UTF-16偏移
+	for {
+		cut := SplitIndex(text, limit)
+		if cut == len(text) {
+			chunks = append(chunks, Chunk{Text: text, Entities: clipEntities(entities, start, utf16Len(text))})
+			return chunks
+		}
+
+		// 拆分位置的换行不保留在段末
+		part := strings.TrimSuffix(text[:cut], "\n")
+		chunks = append(chunks, Chunk{Text: part, Entities: clipEntities(entities, start, utf16Len(part))})
+		start += utf16Len(text[:cut])
+		text = text[cut:]
+	}
+}
+
+// SplitIndex 返回s中长度不超过limit(UTF-16)的前缀的字节数，不会拆开一个字符。
+// 前缀后半部分有换行时在最后一个换行之后截断
+func SplitIndex(s string, limit int) int {
+	units := 0
+	lastNewline := -1
+	for i, r := range s {
+		n := 1
+		if r >= 0x10000 {
+			n = 2
+		}
+		if units+n > limit {
+			// 换行太靠前时直接在字符边界截断，避免产生很短的段
+			if lastNewline >= 0 && lastNewline >= i/2 {
+				return lastNewline + 1
+			}
+			if i == 0 {
+				// limit小于一个字符时至少保留一个字符
+				return len(string(r))
+			}
+			return i
+		}
+		units += n
+		if r == '\n' {
+			lastNewline = i
+		}
+	}
+	return len(s)
+}
+
+// clipEntities 返回落在[start, start+length)内的实体部分，偏移改为相对start
+func clipEntities(entities []tg.MessageEntityClass, start, length int) []tg.MessageEntityClass {
+	var clipped []tg.MessageEntityClass
+	end := start + length
+	for _, entity := range entities {
+		from := max(entity.GetOffset(), start)
+		to := min(entity.GetOffset()+entity.GetLength(), end)
+		if to <= from {
+			continue
+		}
+		if e := withRange(entity, from-start, to-from); e != nil {
+			clipped = append(clipped, e)
+		}
+	}
+	return clipped
+}
+
+// withRange 复制实体并设置新的偏移和长度，不支持的实体类型返回nil
+func withRange(entity tg.MessageEntityClass, offset, length int) tg.MessageEntityClass {
+	switch e := entity.(type) {
+	case *tg.MessageEntityBold:
+		return &tg.MessageEntityBold{Offset: offset, Length: length}
+	case *tg.MessageEntityItalic:
+		return &tg.MessageEntityItalic{Offset: offset, Length: length}
+	case *tg.MessageEntityUnderline:
+		return &tg.MessageEntityUnderline{Offset: offset, Length: length}
+	case *tg.MessageEntityStrike:
+		return &tg.MessageEntityStrike{Offset: offset, Length: length}
+	case *tg.MessageEntitySpoiler:
+		return &tg.MessageEntitySpoiler{Offset: offset, Length: length}
+	case *tg.MessageEntityCode:
+		return &tg.MessageEntityCode{Offset: offset, Length: length}
+	case *tg.MessageEntityPre:
+		return &tg.MessageEntityPre{Offset: offset, Length: length, Language: e.Language}
+	case *tg.MessageEntityTextURL:
+		return &tg.MessageEntityTextURL{Offset: offset, Length: length, URL: e.URL}
+	case *tg.MessageEntityBlockquote:
+		return &tg.MessageEntityBlockquote{Offset: offset, Length: length, Collapsed: e.Collapsed}
+	case *tg.MessageEntityCustomEmoji:
+		return &tg.MessageEntityCustomEmoji{Offset: offset, Length: length, DocumentID: e.DocumentID}
+	case *tg.InputMessageEntityMentionName:
+		return &tg.InputMessageEntityMentionName{Offset: offset, Length: length, UserID: e.UserID}
+	}
+	return nil
+}
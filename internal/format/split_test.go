@@ -0,0 +1,169 @@
+package format
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestSplitIndex(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		limit int
+		want  int // 字节数
+	}{
+		{"shorter than limit", "hello", 10, 5},
+		{"exactly limit", "hello", 5, 5},
+		{"cut at rune boundary", "abcdef", 4, 4},
+		{"cjk counts one unit per rune", "中文测试文本", 4, 12},
+		{"surrogate pair does not fit", "aaa😀b", 4, 3},
+		{"surrogate pair fits exactly", "aaa😀b", 5, 7},
+		{"surrogate pair at 4096 boundary", strings.Repeat("a", 4095) + "😀", MaxMessageLength, 4095},
+		{"surrogate pair ends at 4096", strings.Repeat("a", 4094) + "😀b", MaxMessageLength, 4098},
+		{"prefers newline in second half", "aaaa\nbbbbbb", 8, 5},
+		{"newline exactly at half", "aaa\nbbbbbbbb", 6, 4},
+		{"newline too early is ignored", "a\nbbbbbbbbbb", 8, 8},
+		{"last of several newlines", "ab\ncd\nefghij", 8, 6},
+		{"newline at the limit", "aaaaaaa\nbbb", 8, 8},
+		{"limit smaller than one rune", "😀x", 1, 4},
+		{"zero limit keeps one rune", "中x", 0, 3},
+		{"empty string", "", 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitIndex(tt.s, tt.limit); got != tt.want {
+				t.Errorf("SplitIndex(%q, %d) = %d, want %d", tt.s, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitTexts(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"single chunk", "short", 10, []string{"short"}},
+		{"drops newline at cut", "aaaa\nbbbb", 6, []string{"aaaa", "bbbb"}},
+		{"hard cut without newline", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"surrogate pairs never split", "😀😀😀", 3, []string{"😀", "😀", "😀"}},
+		{"limit smaller than one rune", "😀😀", 1, []string{"😀", "😀"}},
+		{"4096 boundary", strings.Repeat("a", 4095) + "😀", MaxMessageLength, []string{strings.Repeat("a", 4095), "😀"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range Split(tt.text, nil, tt.limit) {
+				got = append(got, c.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitChunksWithinLimit(t *testing.T) {
+	// 混合ASCII、中文、emoji和换行，检查每段长度和拼接结果
+	var b strings.Builder
+	for i := 0; i < 3000; i++ {
+		b.WriteString("第")
+		if i%7 == 0 {
+			b.WriteString("😀")
+		}
+		if i%50 == 49 {
+			b.WriteString("\n")
+		}
+		b.WriteString("x")
+	}
+	text := b.String()
+
+	chunks := Split(text, nil, MaxMessageLength)
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	var joined strings.Builder
+	for i, c := range chunks {
+		if n := utf16Len(c.Text); n > MaxMessageLength {
+			t.Errorf("chunk %d has %d UTF-16 units", i, n)
+		}
+		joined.WriteString(c.Text)
+	}
+	// 拆分位置的换行被去掉，其余内容不变
+	if strings.ReplaceAll(joined.String(), "\n", "") != strings.ReplaceAll(text, "\n", "") {
+		t.Error("joined chunks differ from the original text")
+	}
+}
+
+func TestSplitEntitiesAcrossBoundary(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []tg.MessageEntityClass
+		limit    int
+		want     [][]tg.MessageEntityClass
+	}{
+		{
+			name:     "bold across newline cut",
+			text:     "aaaa\nbbbb",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 2, Length: 5}},
+			limit:    6,
+			want: [][]tg.MessageEntityClass{
+				{&tg.MessageEntityBold{Offset: 2, Length: 2}},
+				{&tg.MessageEntityBold{Offset: 0, Length: 2}},
+			},
+		},
+		{
+			name:     "pre spanning three chunks keeps language",
+			text:     "abcdefghij",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityPre{Offset: 0, Length: 10, Language: "go"}},
+			limit:    4,
+			want: [][]tg.MessageEntityClass{
+				{&tg.MessageEntityPre{Offset: 0, Length: 4, Language: "go"}},
+				{&tg.MessageEntityPre{Offset: 0, Length: 4, Language: "go"}},
+				{&tg.MessageEntityPre{Offset: 0, Length: 2, Language: "go"}},
+			},
+		},
+		{
+			name:     "offsets counted in UTF-16 units",
+			text:     "😀😀😀",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityItalic{Offset: 2, Length: 4}},
+			limit:    4,
+			want: [][]tg.MessageEntityClass{
+				{&tg.MessageEntityItalic{Offset: 2, Length: 2}},
+				{&tg.MessageEntityItalic{Offset: 0, Length: 2}},
+			},
+		},
+		{
+			name: "entities on one side stay there",
+			text: "aaaa\nbbbb",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityCode{Offset: 0, Length: 2},
+				&tg.MessageEntityTextURL{Offset: 6, Length: 3, URL: "https://example.com"},
+			},
+			limit: 6,
+			want: [][]tg.MessageEntityClass{
+				{&tg.MessageEntityCode{Offset: 0, Length: 2}},
+				{&tg.MessageEntityTextURL{Offset: 1, Length: 3, URL: "https://example.com"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := Split(tt.text, tt.entities, tt.limit)
+			if len(chunks) != len(tt.want) {
+				t.Fatalf("got %d chunks, want %d", len(chunks), len(tt.want))
+			}
+			for i, c := range chunks {
+				if !reflect.DeepEqual(c.Entities, tt.want[i]) {
+					t.Errorf("chunk %d (%q) entities = %#v, want %#v", i, c.Text, c.Entities, tt.want[i])
+				}
+			}
+		})
+	}
+}
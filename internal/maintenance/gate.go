@@ -0,0 +1,529 @@
+package maintenance
+
+import (
+	"database/sql"
+	"fmt"
+	"nexusvalet/pkg/logger"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser 与 autosend 使用相同的6字段(含秒) cron 格式
+var cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// Window 维护窗口
+// 一次性窗口使用 StartAt/EndAt；周期窗口使用 CronExpr 和 Duration，每次触发后持续 Duration
+type Window struct {
+	ID        int64
+	CronExpr  string
+	Duration  time.Duration
+	StartAt   time.Time
+	EndAt     time.Time
+	SkipUntil time.Time // 周期窗口被提前结束时，跳过到此时间
+	Sources   []string  // 只拦截这些来源(插件名)的动作，为空时拦截所有来源
+	Reason    string
+	Created   time.Time
+
+	schedule cron.Schedule
+}
+
+// Recurring 是否为周期窗口
+func (w *Window) Recurring() bool {
+	return w.CronExpr != ""
+}
+
+// Covers 窗口是否拦截source的动作
+func (w *Window) Covers(source string) bool {
+	return len(w.Sources) == 0 || slices.Contains(w.Sources, source)
+}
+
+// ActiveAt 返回窗口在now时刻是否生效，以及本次生效的结束时间
+func (w *Window) ActiveAt(now time.Time) (bool, time.Time) {
+	if !w.Recurring() {
+		return !now.Before(w.StartAt) && now.Before(w.EndAt), w.EndAt
+	}
+
+	if w.schedule == nil {
+		return false, time.Time{}
+	}
+	// 最近一次触发时间落在 (now-Duration, now] 内即为生效
+	start := w.schedule.Next(now.Add(-w.Duration))
+	end := start.Add(w.Duration)
+	if start.After(now) || !now.Before(end) {
+		return false, time.Time{}
+	}
+	if !w.SkipUntil.IsZero() && now.Before(w.SkipUntil) {
+		return false, time.Time{}
+	}
+	return true, end
+}
+
+// NextStart 返回now之后窗口下一次开始的时间，没有则返回零值
+func (w *Window) NextStart(now time.Time) time.Time {
+	if !w.Recurring() {
+		if now.Before(w.StartAt) {
+			return w.StartAt
+		}
+		return time.Time{}
+	}
+	if w.schedule == nil {
+		return time.Time{}
+	}
+	return w.schedule.Next(now)
+}
+
+// deferredItem 等待窗口结束后执行的任务
+type deferredItem struct {
+	source string
+	key    string
+	flush  func()
+}
+
+// Gate 维护窗口中心服务，插件在发送非关键的自动化消息前查询它
+type Gate struct {
+	db       *sql.DB
+	windows  map[int64]*Window
+	deferred []deferredItem
+	dropped  map[string]int
+	mutex    sync.Mutex
+	stopCh   chan struct{}
+	running  bool
+
+	now func() time.Time
+}
+
+// NewGate 创建维护窗口服务，并从数据库加载已保存的窗口
+func NewGate(db *sql.DB) *Gate {
+	g := &Gate{
+		db:      db,
+		windows: make(map[int64]*Window),
+		dropped: make(map[string]int),
+		now:     time.Now,
+	}
+
+	if db != nil {
+		if err := g.initDatabase(); err != nil {
+			logger.Errorf("Failed to create maintenance_windows table: %v", err)
+		} else if err := g.loadWindows(); err != nil {
+			logger.Errorf("Failed to load maintenance windows: %v", err)
+		}
+	}
+
+	return g
+}
+
+// initDatabase 初始化数据库表。旧版本的表缺少的 sources 列由 session 中的数据库迁移添加
+func (g *Gate) initDatabase() error {
+	_, err := g.db.Exec(`
+	CREATE TABLE IF NOT EXISTS maintenance_windows (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cron_expr TEXT NOT NULL DEFAULT '',
+		duration_seconds INTEGER NOT NULL DEFAULT 0,
+		start_at INTEGER NOT NULL DEFAULT 0,
+		end_at INTEGER NOT NULL DEFAULT 0,
+		skip_until INTEGER NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL DEFAULT '',
+		created INTEGER NOT NULL,
+		sources TEXT NOT NULL DEFAULT ''
+	)`)
+	return err
+}
+
+// loadWindows 从数据库加载窗口，清理已过期的一次性窗口
+func (g *Gate) loadWindows() error {
+	rows, err := g.db.Query("SELECT id, cron_expr, duration_seconds, start_at, end_at, skip_until, sources, reason, created FROM maintenance_windows")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	now := g.now()
+	var expired []int64
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for rows.Next() {
+		var w Window
+		var durationSecs, startAt, endAt, skipUntil, created int64
+		var sources string
+		if err := rows.Scan(&w.ID, &w.CronExpr, &durationSecs, &startAt, &endAt, &skipUntil, &sources, &w.Reason, &created); err != nil {
+			logger.Errorf("Failed to scan maintenance window: %v", err)
+			continue
+		}
+
+		w.Duration = time.Duration(durationSecs) * time.Second
+		w.StartAt = unixTime(startAt)
+		w.EndAt = unixTime(endAt)
+		w.SkipUntil = unixTime(skipUntil)
+		w.Created = unixTime(created)
+		w.Sources = ParseSources(sources)
+
+		if w.Recurring() {
+			schedule, err := cronParser.Parse(w.CronExpr)
+			if err != nil {
+				logger.Errorf("Invalid cron expression for maintenance window %d: %v", w.ID, err)
+				continue
+			}
+			w.schedule = schedule
+		} else if !now.Before(w.EndAt) {
+			expired = append(expired, w.ID)
+			continue
+		}
+
+		g.windows[w.ID] = &w
+	}
+
+	for _, id := range expired {
+		g.db.Exec("DELETE FROM maintenance_windows WHERE id = ?", id)
+	}
+
+	logger.Infof("Loaded %d maintenance windows", len(g.windows))
+	return rows.Err()
+}
+
+// Run 启动后台检查，窗口结束时执行延迟的任务
+func (g *Gate) Run() {
+	g.mutex.Lock()
+	if g.running {
+		g.mutex.Unlock()
+		return
+	}
+	g.running = true
+	g.stopCh = make(chan struct{})
+	stopCh := g.stopCh
+	g.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				g.Tick()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台检查
+func (g *Gate) Stop() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if !g.running {
+		return
+	}
+	g.running = false
+	close(g.stopCh)
+}
+
+// Tick 检查窗口状态变化，拦截某个来源的窗口都不再生效时执行该来源延迟的任务
+func (g *Gate) Tick() {
+	g.mutex.Lock()
+	now := g.now()
+	var items, pending []deferredItem
+	for _, item := range g.deferred {
+		if _, _, active := g.activeForLocked(now, item.source); active {
+			pending = append(pending, item)
+		} else {
+			items = append(items, item)
+		}
+	}
+	g.deferred = pending
+
+	dropped := make(map[string]int)
+	for source, count := range g.dropped {
+		if _, _, active := g.activeForLocked(now, source); !active {
+			dropped[source] = count
+			delete(g.dropped, source)
+		}
+	}
+	g.cleanupLocked()
+	g.mutex.Unlock()
+
+	for source, count := range dropped {
+		logger.Infof("Maintenance window ended: dropped %d %s item(s)", count, source)
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	logger.Infof("Maintenance window ended: flushing %d deferred item(s)", len(items))
+	for _, item := range items {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Errorf("Deferred %s item %s panicked: %v", item.source, item.key, r)
+				}
+			}()
+			item.flush()
+		}()
+	}
+}
+
+// Suppress 在拦截source的维护窗口生效时拦截非关键的自动化动作，返回true表示调用方应跳过本次发送。
+// source 为插件名，只对该插件生效的窗口(Window.Sources)不会拦截其他插件。
+// flush 不为空时表示该动作允许延迟，会在窗口结束时执行；相同key的动作只保留最新一次。
+// flush 为空时本次动作被丢弃并记录日志。
+func (g *Gate) Suppress(source, key string, flush func()) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	w, _, active := g.activeForLocked(g.now(), source)
+	if !active {
+		return false
+	}
+
+	if flush == nil {
+		g.dropped[source]++
+		logger.Infof("Maintenance window %d active: dropped %s item %s", w.ID, source, key)
+		return true
+	}
+
+	for i, item := range g.deferred {
+		if item.key == key {
+			g.deferred[i].flush = flush
+			logger.Debugf("Maintenance window %d active: collapsed %s item %s", w.ID, source, key)
+			return true
+		}
+	}
+
+	g.deferred = append(g.deferred, deferredItem{source: source, key: key, flush: flush})
+	logger.Infof("Maintenance window %d active: deferred %s item %s", w.ID, source, key)
+	return true
+}
+
+// Active 返回当前生效的窗口及其结束时间
+func (g *Gate) Active() (*Window, time.Time, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.activeLocked(g.now())
+}
+
+// activeLocked 返回当前生效且结束最晚的窗口，调用方需持有锁
+func (g *Gate) activeLocked(now time.Time) (*Window, time.Time, bool) {
+	return g.activeForLocked(now, "")
+}
+
+// activeForLocked 返回拦截source且当前生效、结束最晚的窗口，source为空时不检查来源。
+// 调用方需持有锁
+func (g *Gate) activeForLocked(now time.Time, source string) (*Window, time.Time, bool) {
+	var found *Window
+	var foundEnd time.Time
+	for _, w := range g.windows {
+		if source != "" && !w.Covers(source) {
+			continue
+		}
+		if ok, end := w.ActiveAt(now); ok && end.After(foundEnd) {
+			found, foundEnd = w, end
+		}
+	}
+	return found, foundEnd, found != nil
+}
+
+// DeferredCount 返回等待窗口结束的任务数量
+func (g *Gate) DeferredCount() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return len(g.deferred)
+}
+
+// Open 立即开启一个持续d的一次性窗口，sources 为空时拦截所有来源
+func (g *Gate) Open(d time.Duration, sources []string, reason string) (*Window, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("持续时间必须大于0")
+	}
+
+	now := g.now()
+	w := &Window{
+		StartAt: now,
+		EndAt:   now.Add(d),
+		Sources: sources,
+		Reason:  reason,
+		Created: now,
+	}
+	if err := g.save(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Schedule 创建按cron表达式周期触发、每次持续d的窗口，sources 为空时拦截所有来源
+func (g *Gate) Schedule(cronExpr string, d time.Duration, sources []string, reason string) (*Window, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("持续时间必须大于0")
+	}
+
+	schedule, err := cronParser.Parse(cronExpr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的cron表达式: %w", err)
+	}
+
+	w := &Window{
+		CronExpr: cronExpr,
+		Duration: d,
+		Sources:  sources,
+		Reason:   reason,
+		Created:  g.now(),
+		schedule: schedule,
+	}
+	if err := g.save(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// End 提前结束窗口：一次性窗口被删除，周期窗口跳过本次，下次仍会触发
+func (g *Gate) End(id int64) error {
+	g.mutex.Lock()
+	w, ok := g.windows[id]
+	if !ok {
+		g.mutex.Unlock()
+		return fmt.Errorf("维护窗口 %d 不存在", id)
+	}
+
+	now := g.now()
+	var err error
+	if w.Recurring() {
+		active, end := w.ActiveAt(now)
+		if !active {
+			g.mutex.Unlock()
+			return fmt.Errorf("维护窗口 %d 当前未生效", id)
+		}
+		w.SkipUntil = end
+		_, err = g.db.Exec("UPDATE maintenance_windows SET skip_until = ? WHERE id = ?", end.Unix(), id)
+	} else {
+		delete(g.windows, id)
+		_, err = g.db.Exec("DELETE FROM maintenance_windows WHERE id = ?", id)
+	}
+	g.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// 立即检查，使延迟任务无需等待下一次tick
+	g.Tick()
+	return nil
+}
+
+// Remove 删除窗口（包括周期窗口）
+func (g *Gate) Remove(id int64) error {
+	g.mutex.Lock()
+	if _, ok := g.windows[id]; !ok {
+		g.mutex.Unlock()
+		return fmt.Errorf("维护窗口 %d 不存在", id)
+	}
+	delete(g.windows, id)
+	g.mutex.Unlock()
+
+	if _, err := g.db.Exec("DELETE FROM maintenance_windows WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	g.Tick()
+	return nil
+}
+
+// List 返回所有窗口，按ID排序
+func (g *Gate) List() []*Window {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	list := make([]*Window, 0, len(g.windows))
+	for _, w := range g.windows {
+		copied := *w
+		list = append(list, &copied)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Upcoming 返回下一个将要开始的窗口及开始时间
+func (g *Gate) Upcoming() (*Window, time.Time, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	now := g.now()
+	var found *Window
+	var foundStart time.Time
+	for _, w := range g.windows {
+		start := w.NextStart(now)
+		if start.IsZero() {
+			continue
+		}
+		if found == nil || start.Before(foundStart) {
+			found, foundStart = w, start
+		}
+	}
+	return found, foundStart, found != nil
+}
+
+// save 将窗口写入数据库并加入内存
+func (g *Gate) save(w *Window) error {
+	if g.db != nil {
+		result, err := g.db.Exec(`INSERT INTO maintenance_windows (cron_expr, duration_seconds, start_at, end_at, sources, reason, created)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			w.CronExpr, int64(w.Duration/time.Second), timeUnix(w.StartAt), timeUnix(w.EndAt), strings.Join(w.Sources, ","), w.Reason, w.Created.Unix())
+		if err != nil {
+			return fmt.Errorf("保存维护窗口失败: %w", err)
+		}
+		w.ID, _ = result.LastInsertId()
+	}
+
+	g.mutex.Lock()
+	if g.db == nil {
+		w.ID = int64(len(g.windows) + 1)
+	}
+	g.windows[w.ID] = w
+	g.mutex.Unlock()
+
+	logger.Infof("Maintenance window %d created", w.ID)
+	return nil
+}
+
+// cleanupLocked 清理已过期的一次性窗口，调用方需持有锁
+func (g *Gate) cleanupLocked() {
+	now := g.now()
+	for id, w := range g.windows {
+		if !w.Recurring() && !now.Before(w.EndAt) {
+			delete(g.windows, id)
+			if g.db != nil {
+				g.db.Exec("DELETE FROM maintenance_windows WHERE id = ?", id)
+			}
+		}
+	}
+}
+
+// ParseSources 解析以逗号分隔的来源列表，去掉空项和重复项
+func ParseSources(s string) []string {
+	var sources []string
+	for _, source := range strings.Split(s, ",") {
+		if source = strings.TrimSpace(source); source != "" && !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+func timeUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
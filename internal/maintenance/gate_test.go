@@ -0,0 +1,259 @@
+package maintenance
+
+import (
+	"database/sql"
+	"nexusvalet/internal/session"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "gate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestGate 创建使用可控时钟的维护窗口服务，返回修改时钟的函数
+func newTestGate(t *testing.T, db *sql.DB) (*Gate, *time.Time) {
+	t.Helper()
+	now := time.Now().Truncate(time.Second)
+	g := NewGate(db)
+	g.now = func() time.Time { return now }
+	return g, &now
+}
+
+// recorder 记录延迟任务的执行顺序
+type recorder []string
+
+func (r *recorder) flush(name string) func() {
+	return func() { *r = append(*r, name) }
+}
+
+func TestSuppressWithoutWindow(t *testing.T) {
+	g, _ := newTestGate(t, openTestDB(t))
+	if g.Suppress("autosend", "k", func() {}) {
+		t.Fatal("Suppress without an active window should not suppress")
+	}
+}
+
+func TestDeferredFlushAtWindowEnd(t *testing.T) {
+	g, now := newTestGate(t, openTestDB(t))
+	if _, err := g.Open(time.Hour, nil, "升级"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got recorder
+	if !g.Suppress("autosend", "autosend:1", got.flush("1-old")) {
+		t.Fatal("Suppress should suppress during the window")
+	}
+	g.Suppress("autosend", "autosend:2", got.flush("2"))
+	g.Suppress("autosend", "autosend:1", got.flush("1-new")) // 相同key只保留最新一次
+	if !g.Suppress("autosend", "autosend:3", nil) {
+		t.Fatal("Suppress without flush should drop and suppress")
+	}
+	if n := g.DeferredCount(); n != 2 {
+		t.Fatalf("DeferredCount = %d, want 2", n)
+	}
+
+	// 窗口结束之前不执行
+	*now = now.Add(59 * time.Minute)
+	g.Tick()
+	if len(got) != 0 {
+		t.Fatalf("flushed before the window ended: %v", got)
+	}
+
+	*now = now.Add(time.Minute)
+	g.Tick()
+	if want := (recorder{"1-new", "2"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("flushed %v, want %v", got, want)
+	}
+	g.Tick()
+	if len(got) != 2 || g.DeferredCount() != 0 {
+		t.Fatalf("second Tick flushed again: %v", got)
+	}
+	if len(g.List()) != 0 {
+		t.Error("expired one-time window should be cleaned up")
+	}
+}
+
+func TestFlushPanicIsRecovered(t *testing.T) {
+	g, now := newTestGate(t, openTestDB(t))
+	g.Open(time.Minute, nil, "")
+
+	var got recorder
+	g.Suppress("autosend", "a", func() { panic("boom") })
+	g.Suppress("autosend", "b", got.flush("b"))
+
+	*now = now.Add(time.Minute)
+	g.Tick()
+	if !reflect.DeepEqual(got, recorder{"b"}) {
+		t.Fatalf("flushed %v, want [b]", got)
+	}
+}
+
+func TestWindowSources(t *testing.T) {
+	g, now := newTestGate(t, openTestDB(t))
+	if _, err := g.Open(time.Hour, []string{"autosend"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Open(2*time.Hour, []string{"reminder"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if g.Suppress("weather", "w", func() {}) {
+		t.Error("window for other sources should not suppress weather")
+	}
+
+	var got recorder
+	if !g.Suppress("autosend", "a", got.flush("autosend")) || !g.Suppress("reminder", "r", got.flush("reminder")) {
+		t.Fatal("sources listed in the windows should be suppressed")
+	}
+
+	// autosend 的窗口结束后只补发 autosend，reminder 仍被拦截
+	*now = now.Add(90 * time.Minute)
+	g.Tick()
+	if !reflect.DeepEqual(got, recorder{"autosend"}) {
+		t.Fatalf("after first window: flushed %v, want [autosend]", got)
+	}
+	if g.Suppress("autosend", "a2", nil) {
+		t.Error("autosend should no longer be suppressed")
+	}
+	if _, _, active := g.Active(); !active {
+		t.Error("reminder window should still be active")
+	}
+
+	*now = now.Add(30 * time.Minute)
+	g.Tick()
+	if !reflect.DeepEqual(got, recorder{"autosend", "reminder"}) {
+		t.Fatalf("after second window: flushed %v", got)
+	}
+}
+
+func TestAllSourcesWindowCoversEverything(t *testing.T) {
+	w := &Window{}
+	if !w.Covers("autosend") || !w.Covers("anything") {
+		t.Error("window without sources should cover every source")
+	}
+	w.Sources = []string{"autosend"}
+	if !w.Covers("autosend") || w.Covers("reminder") {
+		t.Error("window with sources should only cover them")
+	}
+}
+
+func TestSourcesPersisted(t *testing.T) {
+	db := openTestDB(t)
+	g, _ := newTestGate(t, db)
+	if _, err := g.Open(time.Hour, []string{"autosend", "reminder"}, "只静默两个插件"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Schedule("0 0 3 * * *", time.Hour, nil, "每天"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新加载后来源列表不变
+	reloaded := NewGate(db).List()
+	if len(reloaded) != 2 {
+		t.Fatalf("reloaded %d windows, want 2", len(reloaded))
+	}
+	if want := []string{"autosend", "reminder"}; !reflect.DeepEqual(reloaded[0].Sources, want) {
+		t.Errorf("reloaded sources = %q, want %q", reloaded[0].Sources, want)
+	}
+	if reloaded[1].Sources != nil || !reloaded[1].Recurring() {
+		t.Errorf("reloaded recurring window = %+v", reloaded[1])
+	}
+}
+
+func TestOldTableGetsSourcesColumn(t *testing.T) {
+	m, err := session.NewManager(filepath.Join(t.TempDir(), "gate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	db := m.GetDB()
+	// 没有 sources 列的旧版本表
+	if _, err := db.Exec(`CREATE TABLE maintenance_windows (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cron_expr TEXT NOT NULL DEFAULT '',
+		duration_seconds INTEGER NOT NULL DEFAULT 0,
+		start_at INTEGER NOT NULL DEFAULT 0,
+		end_at INTEGER NOT NULL DEFAULT 0,
+		skip_until INTEGER NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL DEFAULT '',
+		created INTEGER NOT NULL
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	end := time.Now().Add(time.Hour).Unix()
+	if _, err := db.Exec("INSERT INTO maintenance_windows (start_at, end_at, created) VALUES (?, ?, ?)", time.Now().Unix(), end, time.Now().Unix()); err != nil {
+		t.Fatal(err)
+	}
+	// 数据库迁移为旧表添加 sources 列
+	if err := m.CheckVersion(false); err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewGate(db)
+	list := g.List()
+	if len(list) != 1 || list[0].Sources != nil {
+		t.Fatalf("old window = %+v, want one window covering all sources", list)
+	}
+	if !g.Suppress("autosend", "k", nil) {
+		t.Error("old window should suppress every source")
+	}
+}
+
+func TestEndRecurringWindowFlushes(t *testing.T) {
+	g, now := newTestGate(t, openTestDB(t))
+	// 每分钟第0秒开始，持续30秒
+	w, err := g.Schedule("0 * * * * *", 30*time.Second, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Truncate(time.Minute).Add(time.Minute + 10*time.Second)
+
+	var got recorder
+	if !g.Suppress("autosend", "a", got.flush("a")) {
+		t.Fatal("recurring window should be active")
+	}
+	if err := g.End(w.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, recorder{"a"}) {
+		t.Fatalf("End flushed %v, want [a]", got)
+	}
+	if g.Suppress("autosend", "b", nil) {
+		t.Error("skipped occurrence should not suppress")
+	}
+
+	// 下一次仍会触发
+	*now = now.Add(time.Minute)
+	if !g.Suppress("autosend", "c", nil) {
+		t.Error("next occurrence should be active again")
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"autosend", []string{"autosend"}},
+		{" autosend, reminder ,,autosend", []string{"autosend", "reminder"}},
+		{",", nil},
+	}
+	for _, tt := range tests {
+		if got := ParseSources(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSources(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
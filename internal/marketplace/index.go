@@ -0,0 +1,122 @@
+package marketplace
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"nexusvalet/internal/version"
+	"strings"
+	"time"
+)
+
+// Entry 索引中的一个插件
+type Entry struct {
+	Name          string   `json:"name"`
+	Version       string   `json:"version"`
+	Description   string   `json:"description"`
+	URL           string   `json:"url"`
+	SHA256        string   `json:"sha256"`
+	Permissions   []string `json:"permissions"`
+	MinBotVersion string   `json:"min_bot_version"`
+}
+
+// Manifest 插件索引清单
+type Manifest struct {
+	Name    string    `json:"name"`
+	Updated time.Time `json:"updated"`
+	Plugins []Entry   `json:"plugins"`
+}
+
+// SignedIndex 索引URL返回的内容：manifest 原文及其 ed25519 签名(base64)
+// 签名针对 manifest 字段的原始字节，避免重新序列化导致校验失败
+type SignedIndex struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Signature string          `json:"signature"`
+}
+
+// ParsePublicKeys 解析配置中的 base64 编码 ed25519 公钥
+func ParsePublicKeys(encoded []string) ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0, len(encoded))
+	for _, s := range encoded {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %q: %w", s, err)
+		}
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key %q: expected %d bytes, got %d", s, ed25519.PublicKeySize, len(raw))
+		}
+		keys = append(keys, ed25519.PublicKey(raw))
+	}
+	return keys, nil
+}
+
+// ParseIndex 解析已签名的索引并使用固定公钥校验签名，任一公钥通过即可
+func ParseIndex(data []byte, keys []ed25519.PublicKey) (*Manifest, error) {
+	var signed SignedIndex
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("failed to parse index: %w", err)
+	}
+	if len(signed.Manifest) == 0 {
+		return nil, fmt.Errorf("index has no manifest")
+	}
+
+	if err := VerifySignature(signed.Manifest, signed.Signature, keys); err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(signed.Manifest, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	for i, e := range manifest.Plugins {
+		if e.Name == "" || e.URL == "" || e.SHA256 == "" {
+			return nil, fmt.Errorf("manifest entry %d is missing name, url or sha256", i)
+		}
+	}
+	return &manifest, nil
+}
+
+// VerifySignature 校验 manifest 原文的签名
+func VerifySignature(manifest []byte, signature string, keys []ed25519.PublicKey) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no pinned public keys configured")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, manifest, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature does not match any pinned public key")
+}
+
+// VerifySHA256 校验数据的 sha256(十六进制)
+func VerifySHA256(data []byte, expected string) error {
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(actual, strings.TrimSpace(expected)) {
+		return fmt.Errorf("sha256 mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// Compatible 当前机器人版本是否满足插件的最低版本要求
+func (e *Entry) Compatible(botVersion string) bool {
+	if e.MinBotVersion == "" {
+		return true
+	}
+	return version.Compare(botVersion, e.MinBotVersion) >= 0
+}
+
+// Matches 名称或描述是否包含关键字(不区分大小写)
+func (e *Entry) Matches(keyword string) bool {
+	keyword = strings.ToLower(keyword)
+	return strings.Contains(strings.ToLower(e.Name), keyword) ||
+		strings.Contains(strings.ToLower(e.Description), keyword)
+}
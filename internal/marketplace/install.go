@@ -0,0 +1,93 @@
+package marketplace
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// InstalledManifest 写入插件目录的安装记录
+// 索引声明的权限只记录在 Requested 中，需要用户另行授予
+type InstalledManifest struct {
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	Description string    `json:"description"`
+	Source      string    `json:"source"`
+	Package     string    `json:"package"`
+	SHA256      string    `json:"sha256"`
+	Requested   []string  `json:"requested_permissions"`
+	Granted     []string  `json:"granted_permissions"`
+	Installed   time.Time `json:"installed"`
+}
+
+// Stage 将已校验的插件包写入 <dir>/<name>/ 并生成 plugin.json，返回插件目录
+func Stage(dir string, result *Result, data []byte) (string, error) {
+	if result.Name != filepath.Base(result.Name) || result.Name == "." || result.Name == ".." {
+		return "", fmt.Errorf("invalid plugin name %q", result.Name)
+	}
+
+	pluginDir := filepath.Join(dir, result.Name)
+	if err := os.MkdirAll(pluginDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create plugin directory: %w", err)
+	}
+
+	fileName := packageFileName(result)
+	if err := os.WriteFile(filepath.Join(pluginDir, fileName), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write package: %w", err)
+	}
+
+	manifest := InstalledManifest{
+		Name:        result.Name,
+		Version:     result.Version,
+		Description: result.Description,
+		Source:      result.Index,
+		Package:     fileName,
+		SHA256:      result.SHA256,
+		Requested:   result.Permissions,
+		Granted:     []string{},
+		Installed:   time.Now(),
+	}
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(pluginDir, "plugin.json"), raw, 0644); err != nil {
+		return "", fmt.Errorf("failed to write plugin.json: %w", err)
+	}
+
+	return pluginDir, nil
+}
+
+// packageFileName 根据下载URL确定包文件名
+func packageFileName(result *Result) string {
+	if u, err := url.Parse(result.URL); err == nil {
+		if base := path.Base(u.Path); base != "" && base != "." && base != "/" {
+			return base
+		}
+	}
+	return result.Name + "-" + result.Version + ".pkg"
+}
+
+// Remove 删除通过 Stage 安装到 <dir>/<name>/ 的插件。目录中没有 plugin.json 时
+// 不是由索引安装的插件，返回错误而不删除
+func Remove(dir, name string) error {
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return fmt.Errorf("invalid plugin name %q", name)
+	}
+
+	pluginDir := filepath.Join(dir, name)
+	if _, err := os.Stat(filepath.Join(pluginDir, "plugin.json")); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("plugin %s is not installed", name)
+		}
+		return err
+	}
+	if err := os.RemoveAll(pluginDir); err != nil {
+		return fmt.Errorf("failed to remove plugin directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package marketplace
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// testKey 由固定种子生成的签名密钥，n 不同得到不同的密钥
+func testKey(n byte) ed25519.PrivateKey {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = n
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+func publicKey(k ed25519.PrivateKey) ed25519.PublicKey {
+	return k.Public().(ed25519.PublicKey)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// signIndex 用key对manifest签名，返回索引URL的内容
+func signIndex(t *testing.T, key ed25519.PrivateKey, manifest Manifest) []byte {
+	t.Helper()
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(SignedIndex{Manifest: raw, Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, raw))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParsePublicKeys(t *testing.T) {
+	good := base64.StdEncoding.EncodeToString(publicKey(testKey(1)))
+	keys, err := ParsePublicKeys([]string{" " + good + "\n"})
+	if err != nil || len(keys) != 1 || !keys[0].Equal(publicKey(testKey(1))) {
+		t.Fatalf("ParsePublicKeys = %v, %v", keys, err)
+	}
+	for _, bad := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := ParsePublicKeys([]string{good, bad}); err == nil {
+			t.Errorf("ParsePublicKeys(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseIndexSignature(t *testing.T) {
+	signer := testKey(1)
+	manifest := Manifest{Name: "main", Plugins: []Entry{{Name: "hello", Version: "v1.0.0", URL: "https://example.com/hello.zip", SHA256: "00"}}}
+	data := signIndex(t, signer, manifest)
+
+	parsed, err := ParseIndex(data, []ed25519.PublicKey{publicKey(testKey(2)), publicKey(signer)})
+	if err != nil {
+		t.Fatalf("ParseIndex with one matching key: %v", err)
+	}
+	if parsed.Name != "main" || len(parsed.Plugins) != 1 || parsed.Plugins[0].Name != "hello" {
+		t.Fatalf("parsed manifest = %+v", parsed)
+	}
+
+	if _, err := ParseIndex(data, []ed25519.PublicKey{publicKey(testKey(2))}); err == nil {
+		t.Error("ParseIndex should reject an index signed by an unknown key")
+	}
+	if _, err := ParseIndex(data, nil); err == nil || !strings.Contains(err.Error(), "no pinned public keys") {
+		t.Errorf("ParseIndex without keys: err = %v", err)
+	}
+
+	// 签名针对原始字节，修改 manifest 的内容后校验失败
+	var signed SignedIndex
+	json.Unmarshal(data, &signed)
+	signed.Manifest = json.RawMessage(strings.Replace(string(signed.Manifest), "hello", "evil!", 1))
+	tampered, _ := json.Marshal(signed)
+	if _, err := ParseIndex(tampered, []ed25519.PublicKey{publicKey(signer)}); err == nil {
+		t.Error("ParseIndex should reject a tampered manifest")
+	}
+
+	for name, raw := range map[string]string{
+		"not json":          "{",
+		"missing manifest":  `{"signature": ""}`,
+		"invalid signature": `{"manifest": {}, "signature": "%%%"}`,
+	} {
+		if _, err := ParseIndex([]byte(raw), []ed25519.PublicKey{publicKey(signer)}); err == nil {
+			t.Errorf("%s: ParseIndex should fail", name)
+		}
+	}
+}
+
+func TestParseIndexRequiresEntryFields(t *testing.T) {
+	signer := testKey(1)
+	for _, entry := range []Entry{
+		{URL: "u", SHA256: "s"},
+		{Name: "n", SHA256: "s"},
+		{Name: "n", URL: "u"},
+	} {
+		data := signIndex(t, signer, Manifest{Plugins: []Entry{entry}})
+		if _, err := ParseIndex(data, []ed25519.PublicKey{publicKey(signer)}); err == nil {
+			t.Errorf("ParseIndex should reject entry %+v", entry)
+		}
+	}
+}
+
+func TestVerifySHA256(t *testing.T) {
+	data := []byte("plugin package")
+	sum := sha256Hex(data)
+	if err := VerifySHA256(data, strings.ToUpper(sum)+" "); err != nil {
+		t.Errorf("VerifySHA256 should ignore case and whitespace: %v", err)
+	}
+	if err := VerifySHA256([]byte("other"), sum); err == nil {
+		t.Error("VerifySHA256 should reject different data")
+	}
+}
+
+func TestEntryCompatible(t *testing.T) {
+	tests := []struct {
+		min, bot string
+		want     bool
+	}{
+		{"", "v0.1.0", true},
+		{"v1.2.0", "v1.2.0", true},
+		{"v1.2.0", "v1.10.0", true},
+		{"v1.2.0", "v1.1.9", false},
+		{"v2.0.0", "dev", true}, // 开发版本视为最新
+	}
+	for _, tt := range tests {
+		e := Entry{MinBotVersion: tt.min}
+		if got := e.Compatible(tt.bot); got != tt.want {
+			t.Errorf("Compatible(min %q, bot %q) = %v, want %v", tt.min, tt.bot, got, tt.want)
+		}
+	}
+}
+
+func TestEntryMatches(t *testing.T) {
+	e := Entry{Name: "Weather", Description: "天气预报 forecast"}
+	for keyword, want := range map[string]bool{"weath": true, "FORECAST": true, "天气": true, "rain": false} {
+		if got := e.Matches(keyword); got != want {
+			t.Errorf("Matches(%q) = %v, want %v", keyword, got, want)
+		}
+	}
+}
+
+// indexServer 提供两个索引和插件包的HTTP服务
+type indexServer struct {
+	*httptest.Server
+	files map[string][]byte
+}
+
+func newIndexServer(t *testing.T) *indexServer {
+	t.Helper()
+	s := &indexServer{files: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := s.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "apt.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestStoreRefreshFindAndDownload(t *testing.T) {
+	signer := testKey(1)
+	keys := []ed25519.PublicKey{publicKey(signer)}
+	srv := newIndexServer(t)
+
+	pkgOld, pkgNew := []byte("hello v1"), []byte("hello v2")
+	srv.files["/pkg/hello-1.zip"] = pkgOld
+	srv.files["/pkg/hello-2.zip"] = pkgNew
+	srv.files["/a.json"] = signIndex(t, signer, Manifest{Name: "a", Plugins: []Entry{
+		{Name: "hello", Version: "v1.0.0", URL: srv.URL + "/pkg/hello-1.zip", SHA256: sha256Hex(pkgOld)},
+		{Name: "broken", Version: "v1.0.0", URL: srv.URL + "/pkg/hello-1.zip", SHA256: sha256Hex(pkgNew)},
+	}})
+	srv.files["/b.json"] = signIndex(t, signer, Manifest{Name: "b", Plugins: []Entry{
+		{Name: "hello", Version: "v1.2.0", URL: srv.URL + "/pkg/hello-2.zip", SHA256: sha256Hex(pkgNew), Description: "newer"},
+	}})
+	// 未签名的索引不会被采用
+	srv.files["/evil.json"] = signIndex(t, testKey(9), Manifest{Name: "evil", Plugins: []Entry{
+		{Name: "hello", Version: "v9.0.0", URL: srv.URL + "/pkg/hello-1.zip", SHA256: sha256Hex(pkgOld)},
+	}})
+
+	db := openTestDB(t)
+	urls := []string{srv.URL + "/a.json", srv.URL + "/b.json", srv.URL + "/evil.json"}
+	store, err := NewStore(db, urls, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.Stale() {
+		t.Fatal("store without cached indexes should be stale")
+	}
+	store.Refresh(context.Background(), false)
+
+	statuses := store.Status()
+	if statuses[0].Plugins != 2 || statuses[1].Plugins != 1 || statuses[2].Err == nil {
+		t.Fatalf("statuses = %+v", statuses)
+	}
+
+	result, ok := store.Find("hello")
+	if !ok || result.Version != "v1.2.0" || result.Index != urls[1] {
+		t.Fatalf("Find(hello) = %+v, want v1.2.0 from index b", result)
+	}
+	data, err := store.Download(context.Background(), &result.Entry)
+	if err != nil || string(data) != string(pkgNew) {
+		t.Fatalf("Download = %q, %v", data, err)
+	}
+
+	broken, _ := store.Find("broken")
+	if _, err := store.Download(context.Background(), &broken.Entry); err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Errorf("Download with wrong sha256: err = %v", err)
+	}
+	if _, ok := store.Find("missing"); ok {
+		t.Error("Find(missing) should fail")
+	}
+	if got := store.Search("newer"); len(got) != 1 || got[0].Version != "v1.2.0" {
+		t.Errorf("Search(newer) = %+v", got)
+	}
+
+	// 缓存重新加载时再次校验签名，更换公钥后缓存失效
+	cached, err := NewStore(db, urls, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cached.Find("hello"); !ok {
+		t.Error("cached index should be loaded from the database")
+	}
+	rotated, err := NewStore(db, urls, []ed25519.PublicKey{publicKey(testKey(2))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rotated.Find("hello"); ok {
+		t.Error("cached index signed by a removed key should be discarded")
+	}
+}
+
+func TestStoreKeepsCacheOnFailedRefresh(t *testing.T) {
+	signer := testKey(1)
+	srv := newIndexServer(t)
+	srv.files["/a.json"] = signIndex(t, signer, Manifest{Plugins: []Entry{{Name: "hello", Version: "v1.0.0", URL: "u", SHA256: "s"}}})
+
+	store, err := NewStore(openTestDB(t), []string{srv.URL + "/a.json"}, []ed25519.PublicKey{publicKey(signer)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Refresh(context.Background(), false)
+
+	delete(srv.files, "/a.json")
+	store.Refresh(context.Background(), true)
+	if _, ok := store.Find("hello"); !ok {
+		t.Error("failed refresh should keep the cached index")
+	}
+	if status := store.Status()[0]; status.Err == nil || status.Plugins != 1 {
+		t.Errorf("status after failed refresh = %+v", status)
+	}
+}
+
+func TestStageAndRemove(t *testing.T) {
+	dir := t.TempDir()
+	result := &Result{Entry: Entry{
+		Name: "hello", Version: "v1.2.0", URL: "https://example.com/dl/hello.zip?token=x",
+		SHA256: "abc", Permissions: []string{"network"},
+	}, Index: "https://example.com/index.json"}
+
+	pluginDir, err := Stage(dir, result, []byte("package"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pluginDir != filepath.Join(dir, "hello") {
+		t.Errorf("Stage dir = %s", pluginDir)
+	}
+	if data, err := os.ReadFile(filepath.Join(pluginDir, "hello.zip")); err != nil || string(data) != "package" {
+		t.Fatalf("package file = %q, %v", data, err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(pluginDir, "plugin.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var installed InstalledManifest
+	if err := json.Unmarshal(raw, &installed); err != nil {
+		t.Fatal(err)
+	}
+	// 请求的权限只记录，不授予
+	if installed.Version != "v1.2.0" || installed.Package != "hello.zip" || installed.Source != result.Index ||
+		len(installed.Requested) != 1 || len(installed.Granted) != 0 {
+		t.Errorf("plugin.json = %+v", installed)
+	}
+
+	if err := Remove(dir, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(pluginDir); !os.IsNotExist(err) {
+		t.Error("Remove should delete the plugin directory")
+	}
+	if err := Remove(dir, "hello"); err == nil {
+		t.Error("Remove of a missing plugin should fail")
+	}
+
+	// 没有 plugin.json 的目录不是由索引安装的，不删除
+	os.Mkdir(filepath.Join(dir, "manual"), 0755)
+	if err := Remove(dir, "manual"); err == nil {
+		t.Error("Remove should refuse directories without plugin.json")
+	}
+
+	for _, name := range []string{"../escape", "..", "a/b"} {
+		if _, err := Stage(dir, &Result{Entry: Entry{Name: name}}, nil); err == nil {
+			t.Errorf("Stage(%q) should fail", name)
+		}
+		if err := Remove(dir, name); err == nil {
+			t.Errorf("Remove(%q) should fail", name)
+		}
+	}
+}
+
+func TestPackageFileName(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"https://example.com/files/plugin.tar.gz", "plugin.tar.gz"},
+		{"https://example.com/", "hello-v1.0.0.pkg"},
+		{"https://example.com", "hello-v1.0.0.pkg"},
+	}
+	for _, tt := range tests {
+		r := &Result{Entry: Entry{Name: "hello", Version: "v1.0.0", URL: tt.url}}
+		if got := packageFileName(r); got != tt.want {
+			t.Errorf("packageFileName(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
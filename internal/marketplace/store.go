@@ -0,0 +1,250 @@
+package marketplace
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"nexusvalet/internal/version"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// RefreshInterval 索引自动刷新间隔
+	RefreshInterval = 24 * time.Hour
+	// maxIndexSize 索引文件大小上限
+	maxIndexSize = 4 << 20
+	// maxPackageSize 插件包大小上限
+	maxPackageSize = 50 << 20
+)
+
+// cachedIndex 缓存的索引
+type cachedIndex struct {
+	manifest *Manifest
+	fetched  time.Time
+	lastErr  error
+}
+
+// IndexStatus 索引状态，用于展示缓存年龄和最近一次刷新错误
+type IndexStatus struct {
+	URL     string
+	Name    string
+	Fetched time.Time
+	Plugins int
+	Err     error
+}
+
+// Result 搜索结果，附带来源索引
+type Result struct {
+	Entry
+	Index string
+}
+
+// Store 管理插件索引的获取、校验和缓存
+type Store struct {
+	db      *sql.DB
+	urls    []string
+	keys    []ed25519.PublicKey
+	client  *http.Client
+	indexes map[string]*cachedIndex
+	mutex   sync.RWMutex
+}
+
+// NewStore 创建索引存储并加载数据库中的缓存
+func NewStore(db *sql.DB, urls []string, keys []ed25519.PublicKey) (*Store, error) {
+	s := &Store{
+		db:      db,
+		urls:    urls,
+		keys:    keys,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		indexes: make(map[string]*cachedIndex),
+	}
+
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS apt_index_cache (
+		url TEXT PRIMARY KEY,
+		data BLOB NOT NULL,
+		fetched INTEGER NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create index cache table: %w", err)
+	}
+
+	for _, url := range urls {
+		var data []byte
+		var fetched int64
+		err := db.QueryRow("SELECT data, fetched FROM apt_index_cache WHERE url = ?", url).Scan(&data, &fetched)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			logger.Warnf("Failed to load cached index %s: %v", url, err)
+			continue
+		}
+		// 缓存同样需要通过签名校验，公钥变更后旧缓存失效
+		manifest, err := ParseIndex(data, keys)
+		if err != nil {
+			logger.Warnf("Discarding cached index %s: %v", url, err)
+			continue
+		}
+		s.indexes[url] = &cachedIndex{manifest: manifest, fetched: time.Unix(fetched, 0)}
+	}
+
+	return s, nil
+}
+
+// Configured 是否配置了索引
+func (s *Store) Configured() bool {
+	return len(s.urls) > 0
+}
+
+// Stale 是否有索引需要刷新
+func (s *Store) Stale() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, url := range s.urls {
+		idx, ok := s.indexes[url]
+		if !ok || time.Since(idx.fetched) > RefreshInterval {
+			return true
+		}
+	}
+	return false
+}
+
+// Refresh 刷新索引。force为false时只刷新超过 RefreshInterval 的索引
+// 获取失败时保留原有缓存，错误记录在状态中
+func (s *Store) Refresh(ctx context.Context, force bool) {
+	for _, url := range s.urls {
+		s.mutex.RLock()
+		idx, ok := s.indexes[url]
+		s.mutex.RUnlock()
+		if !force && ok && time.Since(idx.fetched) <= RefreshInterval {
+			continue
+		}
+
+		data, err := s.fetch(ctx, url, maxIndexSize)
+		var manifest *Manifest
+		if err == nil {
+			manifest, err = ParseIndex(data, s.keys)
+		}
+
+		s.mutex.Lock()
+		if err != nil {
+			logger.Warnf("Failed to refresh plugin index %s: %v", url, err)
+			if ok {
+				idx.lastErr = err
+			} else {
+				s.indexes[url] = &cachedIndex{lastErr: err}
+			}
+			s.mutex.Unlock()
+			continue
+		}
+		now := time.Now()
+		s.indexes[url] = &cachedIndex{manifest: manifest, fetched: now}
+		s.mutex.Unlock()
+
+		if _, err := s.db.Exec("INSERT OR REPLACE INTO apt_index_cache (url, data, fetched) VALUES (?, ?, ?)", url, data, now.Unix()); err != nil {
+			logger.Warnf("Failed to cache plugin index %s: %v", url, err)
+		}
+		logger.Infof("Plugin index %s refreshed: %d plugins", url, len(manifest.Plugins))
+	}
+}
+
+// Status 返回各索引状态
+func (s *Store) Status() []IndexStatus {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	statuses := make([]IndexStatus, 0, len(s.urls))
+	for _, url := range s.urls {
+		status := IndexStatus{URL: url}
+		if idx, ok := s.indexes[url]; ok {
+			status.Fetched = idx.fetched
+			status.Err = idx.lastErr
+			if idx.manifest != nil {
+				status.Name = idx.manifest.Name
+				status.Plugins = len(idx.manifest.Plugins)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Search 在缓存的索引中搜索关键字，按名称排序
+func (s *Store) Search(keyword string) []Result {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var results []Result
+	for _, url := range s.urls {
+		idx, ok := s.indexes[url]
+		if !ok || idx.manifest == nil {
+			continue
+		}
+		for _, e := range idx.manifest.Plugins {
+			if keyword == "" || e.Matches(keyword) {
+				results = append(results, Result{Entry: e, Index: url})
+			}
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+// Find 按名称查找插件，多个索引同时提供时取最高版本
+func (s *Store) Find(name string) (*Result, bool) {
+	var best *Result
+	for _, r := range s.Search("") {
+		if r.Name != name {
+			continue
+		}
+		r := r
+		if best == nil || version.Compare(r.Version, best.Version) > 0 {
+			best = &r
+		}
+	}
+	return best, best != nil
+}
+
+// Download 下载插件包并校验 sha256
+func (s *Store) Download(ctx context.Context, entry *Entry) ([]byte, error) {
+	data, err := s.fetch(ctx, entry.URL, maxPackageSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifySHA256(data, entry.SHA256); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// fetch 获取URL内容，限制最大大小
+func (s *Store) fetch(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("response exceeds %d bytes", limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,328 @@
+package mediacompress
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// Level 压缩级别
+type Level string
+
+const (
+	Off        Level = "off"
+	Balanced   Level = "balanced"
+	Aggressive Level = "aggressive"
+)
+
+// ParseLevel 解析配置中的压缩级别，空字符串视为 off
+func ParseLevel(s string) (Level, error) {
+	switch Level(strings.ToLower(strings.TrimSpace(s))) {
+	case "", Off:
+		return Off, nil
+	case Balanced:
+		return Balanced, nil
+	case Aggressive:
+		return Aggressive, nil
+	}
+	return Off, fmt.Errorf("unknown media compression level %q (off|balanced|aggressive)", s)
+}
+
+// maxPixels 解码前检查的最大像素数，超过时不处理，避免超大图片耗尽内存
+const maxPixels = 50_000_000
+
+// Options 压缩参数
+type Options struct {
+	Level        Level
+	JPEGQuality  int     // JPEG重新编码的质量(1-100)
+	MaxDimension int     // 长边超过该值时缩小，0表示不限制
+	MinSavings   float64 // 只缩减了不到该比例时保留原文件
+	ConvertPNG   bool    // 允许把不透明的PNG转换为JPEG(仅用于会被Telegram重新编码的图片)
+	ConvertMin   float64 // PNG转换为JPEG需要达到的最小缩减比例
+}
+
+// OptionsFor 返回压缩级别的默认参数
+func OptionsFor(level Level) Options {
+	switch level {
+	case Balanced:
+		return Options{Level: Balanced, JPEGQuality: 85, MaxDimension: 2560, MinSavings: 0.05}
+	case Aggressive:
+		return Options{Level: Aggressive, JPEGQuality: 70, MaxDimension: 1920, MinSavings: 0.02, ConvertPNG: true, ConvertMin: 0.2}
+	}
+	return Options{Level: Off}
+}
+
+// Enabled 是否启用压缩
+func (o Options) Enabled() bool {
+	return o.Level != "" && o.Level != Off
+}
+
+// Format 文件格式
+type Format string
+
+const (
+	Unknown Format = ""
+	PNG     Format = "png"
+	JPEG    Format = "jpeg"
+	GIF     Format = "gif"
+	WEBP    Format = "webp"
+)
+
+// Sniff 根据文件头识别格式
+func Sniff(data []byte) Format {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return JPEG
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return GIF
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return WEBP
+	}
+	return Unknown
+}
+
+// Ext 格式对应的文件扩展名
+func (f Format) Ext() string {
+	switch f {
+	case JPEG:
+		return ".jpg"
+	case Unknown:
+		return ""
+	}
+	return "." + string(f)
+}
+
+// MimeType 格式对应的MIME类型
+func (f Format) MimeType() string {
+	if f == Unknown {
+		return "application/octet-stream"
+	}
+	return "image/" + string(f)
+}
+
+// RenameFor 把文件名的扩展名替换为格式对应的扩展名
+func RenameFor(name string, f Format) string {
+	ext := f.Ext()
+	if ext == "" || strings.EqualFold(filepath.Ext(name), ext) {
+		return name
+	}
+	if f == JPEG && strings.EqualFold(filepath.Ext(name), ".jpeg") {
+		return name
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ext
+}
+
+// Result 压缩结果。Changed 为false时 Data 即原文件
+type Result struct {
+	Data       []byte
+	Format     Format
+	Original   int
+	Compressed int
+	Changed    bool
+	Resized    bool
+	Reason     string // 保留原文件或采用压缩结果的原因
+}
+
+// Savings 节省的字节数
+func (r Result) Savings() int {
+	return r.Original - r.Compressed
+}
+
+// Compress 按参数压缩图片。只处理PNG和JPEG，其他格式原样返回；
+// 结果不会比原文件大，缩减不足 MinSavings 时也返回原文件
+func Compress(data []byte, opts Options) Result {
+	keep := func(f Format, reason string) Result {
+		return Result{Data: data, Format: f, Original: len(data), Compressed: len(data), Reason: reason}
+	}
+
+	format := Sniff(data)
+	if !opts.Enabled() {
+		return keep(format, "disabled")
+	}
+	if format != PNG && format != JPEG {
+		return keep(format, "unsupported format")
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return keep(format, "decode failed")
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return keep(format, "image too large")
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return keep(format, "decode failed")
+	}
+
+	resized := false
+	if w, h, ok := CapDimensions(cfg.Width, cfg.Height, opts.MaxDimension); ok {
+		img = Downscale(img, w, h)
+		resized = true
+	}
+
+	quality := opts.JPEGQuality
+	if quality <= 0 || quality > 100 {
+		quality = 85
+	}
+
+	best := keep(format, "no savings")
+	consider := func(out []byte, f Format, minSavings float64, reason string) {
+		if out == nil || len(out) >= len(best.Data) {
+			return
+		}
+		// 缩小了尺寸时任何缩减都采用，否则要达到最小缩减比例
+		if !resized && float64(len(data)-len(out)) < minSavings*float64(len(data)) {
+			return
+		}
+		best = Result{Data: out, Format: f, Original: len(data), Compressed: len(out), Changed: true, Resized: resized, Reason: reason}
+	}
+
+	switch format {
+	case PNG:
+		consider(encodePNG(img), PNG, opts.MinSavings, "png recompressed")
+		if opts.ConvertPNG && isOpaque(img) {
+			minSavings := opts.ConvertMin
+			if minSavings < opts.MinSavings {
+				minSavings = opts.MinSavings
+			}
+			consider(encodeJPEG(img, quality), JPEG, minSavings, "png converted to jpeg")
+		}
+	case JPEG:
+		consider(encodeJPEG(img, quality), JPEG, opts.MinSavings, fmt.Sprintf("jpeg re-encoded at q%d", quality))
+	}
+	return best
+}
+
+// CapDimensions 计算长边不超过 max 的尺寸，保持宽高比。不需要缩小时ok为false
+func CapDimensions(width, height, max int) (int, int, bool) {
+	if max <= 0 || (width <= max && height <= max) {
+		return width, height, false
+	}
+	if width >= height {
+		h := (height*max + width/2) / width
+		if h < 1 {
+			h = 1
+		}
+		return max, h, true
+	}
+	w := (width*max + height/2) / height
+	if w < 1 {
+		w = 1
+	}
+	return w, max, true
+}
+
+// Downscale 使用区域平均缩小图片
+func Downscale(src image.Image, width, height int) *image.RGBA {
+	b := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	}
+	sw, sh := b.Dx(), b.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					bl += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8((r + n/2) / n)
+			dst.Pix[i+1] = uint8((g + n/2) / n)
+			dst.Pix[i+2] = uint8((bl + n/2) / n)
+			dst.Pix[i+3] = uint8((a + n/2) / n)
+		}
+	}
+	return dst
+}
+
+// isOpaque 图片是否完全不透明，不透明的PNG转换为JPEG不会丢失信息
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// encodePNG 以最高压缩率编码PNG
+func encodePNG(img image.Image) []byte {
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// encodeJPEG 以指定质量编码JPEG
+func encodeJPEG(img image.Image, quality int) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// Stats 累计的压缩统计，可并发更新
+type Stats struct {
+	files      atomic.Int64
+	compressed atomic.Int64
+	original   atomic.Int64
+	saved      atomic.Int64
+}
+
+// Record 记录一次压缩结果
+func (s *Stats) Record(r Result) {
+	s.files.Add(1)
+	s.original.Add(int64(r.Original))
+	if r.Changed {
+		s.compressed.Add(1)
+		s.saved.Add(int64(r.Savings()))
+	}
+}
+
+// StatsSnapshot 统计快照
+type StatsSnapshot struct {
+	Files      int64 // 经过压缩流程的图片数
+	Compressed int64 // 实际采用压缩结果的图片数
+	Original   int64 // 原始总字节数
+	Saved      int64 // 节省的总字节数
+}
+
+// Snapshot 返回当前统计
+func (s *Stats) Snapshot() StatsSnapshot {
+	return StatsSnapshot{
+		Files:      s.files.Load(),
+		Compressed: s.compressed.Load(),
+		Original:   s.original.Load(),
+		Saved:      s.saved.Load(),
+	}
+}
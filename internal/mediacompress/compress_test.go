@@ -0,0 +1,419 @@
+package mediacompress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readFixture 读取 testdata 中的图片
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// decodedSize 返回图片数据的尺寸
+func decodedSize(t *testing.T, data []byte) (int, int) {
+	t.Helper()
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("output does not decode: %v", err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+// fixtures testdata 中的图片：
+//   - screenshot_uncompressed.png 128x128 渐变，未压缩编码
+//   - noise_opaque.png 128x128 不透明随机噪点，最高压缩率编码
+//   - noise_alpha.png 128x128 带透明度的随机噪点
+//   - banner_wide.png 200x100 渐变，未压缩编码
+//   - photo_q100.jpg / photo_q40.jpg 128x128 带噪点的渐变，质量100/40
+var fixtures = []string{
+	"screenshot_uncompressed.png",
+	"noise_opaque.png",
+	"noise_alpha.png",
+	"banner_wide.png",
+	"photo_q100.jpg",
+	"photo_q40.jpg",
+}
+
+// photoOptions 作为照片发送时的参数，允许转换格式
+func photoOptions(level Level) Options {
+	return OptionsFor(level)
+}
+
+// documentOptions 作为文档发送时的参数，保持原格式
+func documentOptions(level Level) Options {
+	o := OptionsFor(level)
+	o.ConvertPNG = false
+	return o
+}
+
+// withMaxDimension 覆盖最大边长
+func withMaxDimension(o Options, max int) Options {
+	o.MaxDimension = max
+	return o
+}
+
+func TestCompressGolden(t *testing.T) {
+	tests := []struct {
+		fixture       string
+		name          string
+		opts          Options
+		format        Format
+		changed       bool
+		resized       bool
+		reason        string
+		width, height int
+	}{
+		{"screenshot_uncompressed.png", "balanced", documentOptions(Balanced), PNG, true, false, "png recompressed", 128, 128},
+		{"screenshot_uncompressed.png", "aggressive photo", photoOptions(Aggressive), PNG, true, false, "png recompressed", 128, 128},
+		{"screenshot_uncompressed.png", "capped", withMaxDimension(documentOptions(Balanced), 64), PNG, true, true, "png recompressed", 64, 64},
+
+		{"noise_opaque.png", "balanced", documentOptions(Balanced), PNG, false, false, "no savings", 128, 128},
+		{"noise_opaque.png", "aggressive document", documentOptions(Aggressive), PNG, false, false, "no savings", 128, 128},
+		{"noise_opaque.png", "aggressive photo", photoOptions(Aggressive), JPEG, true, false, "png converted to jpeg", 128, 128},
+		{"noise_opaque.png", "capped", withMaxDimension(documentOptions(Balanced), 64), PNG, true, true, "png recompressed", 64, 64},
+
+		// 带透明度的PNG不会转换为JPEG
+		{"noise_alpha.png", "aggressive photo", photoOptions(Aggressive), PNG, false, false, "no savings", 128, 128},
+		{"noise_alpha.png", "capped", withMaxDimension(photoOptions(Aggressive), 64), PNG, true, true, "png recompressed", 64, 64},
+
+		{"banner_wide.png", "balanced", documentOptions(Balanced), PNG, true, false, "png recompressed", 200, 100},
+		{"banner_wide.png", "capped keeps aspect", withMaxDimension(documentOptions(Balanced), 64), PNG, true, true, "png recompressed", 64, 32},
+
+		{"photo_q100.jpg", "balanced", documentOptions(Balanced), JPEG, true, false, "jpeg re-encoded at q85", 128, 128},
+		{"photo_q100.jpg", "aggressive", photoOptions(Aggressive), JPEG, true, false, "jpeg re-encoded at q70", 128, 128},
+		{"photo_q100.jpg", "capped", withMaxDimension(documentOptions(Balanced), 64), JPEG, true, true, "jpeg re-encoded at q85", 64, 64},
+
+		// 已经高度压缩的JPEG按更高的质量重新编码只会变大
+		{"photo_q40.jpg", "balanced", documentOptions(Balanced), JPEG, false, false, "no savings", 128, 128},
+		{"photo_q40.jpg", "aggressive", photoOptions(Aggressive), JPEG, false, false, "no savings", 128, 128},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture+"/"+tt.name, func(t *testing.T) {
+			data := readFixture(t, tt.fixture)
+			r := Compress(data, tt.opts)
+			if r.Format != tt.format || r.Changed != tt.changed || r.Resized != tt.resized || r.Reason != tt.reason {
+				t.Errorf("Compress = format %q changed %v resized %v reason %q; want %q %v %v %q",
+					r.Format, r.Changed, r.Resized, r.Reason, tt.format, tt.changed, tt.resized, tt.reason)
+			}
+			if w, h := decodedSize(t, r.Data); w != tt.width || h != tt.height {
+				t.Errorf("output size = %dx%d, want %dx%d", w, h, tt.width, tt.height)
+			}
+			if Sniff(r.Data) != r.Format {
+				t.Errorf("output sniffs as %q, result says %q", Sniff(r.Data), r.Format)
+			}
+			if r.Original != len(data) || r.Compressed != len(r.Data) {
+				t.Errorf("sizes = %d -> %d, data %d -> %d", r.Original, r.Compressed, len(data), len(r.Data))
+			}
+			if !r.Changed && !bytes.Equal(r.Data, data) {
+				t.Error("unchanged result should return the original bytes")
+			}
+		})
+	}
+}
+
+func TestCompressNeverLarger(t *testing.T) {
+	var optionSets []Options
+	for _, level := range []Level{Balanced, Aggressive} {
+		for _, max := range []int{0, 1, 50, 100, 127, 128, 4096} {
+			for _, quality := range []int{0, 1, 50, 100} {
+				o := withMaxDimension(photoOptions(level), max)
+				o.JPEGQuality = quality
+				optionSets = append(optionSets, o)
+				o.ConvertPNG = false
+				optionSets = append(optionSets, o)
+			}
+		}
+	}
+
+	for _, fixture := range fixtures {
+		data := readFixture(t, fixture)
+		w, h := decodedSize(t, data)
+		for _, o := range optionSets {
+			r := Compress(data, o)
+			if len(r.Data) > len(data) {
+				t.Fatalf("%s %+v: output %d bytes larger than original %d", fixture, o, len(r.Data), len(data))
+			}
+			if r.Changed && r.Savings() <= 0 {
+				t.Fatalf("%s %+v: changed without savings (%d)", fixture, o, r.Savings())
+			}
+			if !r.Changed && (r.Savings() != 0 || !bytes.Equal(r.Data, data)) {
+				t.Fatalf("%s %+v: unchanged result differs from the original", fixture, o)
+			}
+			if !o.ConvertPNG && r.Format != Sniff(data) {
+				t.Fatalf("%s %+v: format changed to %q without ConvertPNG", fixture, o, r.Format)
+			}
+			// 采用了缩小的结果时长边不超过限制
+			if r.Resized {
+				ow, oh := decodedSize(t, r.Data)
+				if o.MaxDimension <= 0 || ow > o.MaxDimension || oh > o.MaxDimension || (ow >= w && oh >= h) {
+					t.Fatalf("%s %+v: resized to %dx%d from %dx%d", fixture, o, ow, oh, w, h)
+				}
+			}
+		}
+	}
+}
+
+func TestCompressSavingsThreshold(t *testing.T) {
+	data := readFixture(t, "photo_q100.jpg")
+	r := Compress(data, documentOptions(Balanced))
+	if !r.Changed {
+		t.Fatal("fixture should compress at balanced level")
+	}
+	ratio := float64(r.Savings()) / float64(len(data))
+
+	// 最小缩减比例高于实际缩减时保留原文件
+	o := documentOptions(Balanced)
+	o.MinSavings = ratio + 0.01
+	if r := Compress(data, o); r.Changed || r.Reason != "no savings" {
+		t.Errorf("MinSavings above the ratio: changed %v reason %q", r.Changed, r.Reason)
+	}
+	o.MinSavings = ratio - 0.01
+	if r := Compress(data, o); !r.Changed {
+		t.Error("MinSavings below the ratio should accept the result")
+	}
+
+	// 缩小了尺寸时不检查最小缩减比例
+	o = withMaxDimension(documentOptions(Balanced), 64)
+	o.MinSavings = 0.99
+	if r := Compress(data, o); !r.Changed || !r.Resized {
+		t.Errorf("resized result rejected by MinSavings: %+v", r.Reason)
+	}
+
+	// PNG转换为JPEG使用 ConvertMin 和 MinSavings 中较大的比例
+	noise := readFixture(t, "noise_opaque.png")
+	o = photoOptions(Aggressive)
+	o.ConvertMin = 0.99
+	if r := Compress(noise, o); r.Changed {
+		t.Errorf("conversion below ConvertMin accepted: %q", r.Reason)
+	}
+	o.ConvertMin, o.MinSavings = 0, 0.99
+	if r := Compress(noise, o); r.Changed {
+		t.Errorf("conversion below MinSavings accepted: %q", r.Reason)
+	}
+}
+
+func TestCompressInvalidQualityUsesDefault(t *testing.T) {
+	data := readFixture(t, "photo_q100.jpg")
+	for _, quality := range []int{0, -5, 101} {
+		o := documentOptions(Balanced)
+		o.JPEGQuality = quality
+		if r := Compress(data, o); r.Reason != "jpeg re-encoded at q85" {
+			t.Errorf("quality %d: reason %q", quality, r.Reason)
+		}
+	}
+}
+
+// pngWithSize 返回IHDR中声明了指定尺寸的PNG，只能用于 DecodeConfig
+func pngWithSize(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// 签名(8) + 长度(4) + "IHDR"(4) 之后是宽高，CRC覆盖类型和13字节的数据
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestCompressKeepsOriginal(t *testing.T) {
+	jpegData := readFixture(t, "photo_q100.jpg")
+	gif := append([]byte("GIF89a"), make([]byte, 64)...)
+	webp := append([]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), make([]byte, 64)...)
+	tests := []struct {
+		name   string
+		data   []byte
+		opts   Options
+		format Format
+		reason string
+	}{
+		{"disabled", jpegData, OptionsFor(Off), JPEG, "disabled"},
+		{"zero options", jpegData, Options{}, JPEG, "disabled"},
+		{"document", []byte("%PDF-1.7 not an image"), photoOptions(Aggressive), Unknown, "unsupported format"},
+		{"gif", gif, photoOptions(Aggressive), GIF, "unsupported format"},
+		{"webp", webp, photoOptions(Aggressive), WEBP, "unsupported format"},
+		{"empty", nil, photoOptions(Aggressive), Unknown, "unsupported format"},
+		{"corrupt png", []byte("\x89PNG\r\n\x1a\ngarbage"), photoOptions(Aggressive), PNG, "decode failed"},
+		{"truncated jpeg", jpegData[:len(jpegData)/2], photoOptions(Aggressive), JPEG, "decode failed"},
+		{"too many pixels", pngWithSize(t, 10000, 10000), photoOptions(Aggressive), PNG, "image too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Compress(tt.data, tt.opts)
+			if r.Changed || !bytes.Equal(r.Data, tt.data) {
+				t.Error("data should be returned unchanged")
+			}
+			if r.Format != tt.format || r.Reason != tt.reason {
+				t.Errorf("format %q reason %q, want %q %q", r.Format, r.Reason, tt.format, tt.reason)
+			}
+		})
+	}
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		data string
+		want Format
+	}{
+		{"\x89PNG\r\n\x1a\n....", PNG},
+		{"\xff\xd8\xff\xe0", JPEG},
+		{"GIF87a", GIF},
+		{"GIF89a", GIF},
+		{"RIFF\x10\x00\x00\x00WEBP", WEBP},
+		{"RIFF\x10\x00\x00\x00WAVE", Unknown},
+		{"RIFF", Unknown},
+		{"\x89PNG", Unknown},
+		{"\xff\xd8", Unknown},
+		{"", Unknown},
+	}
+	for _, tt := range tests {
+		if got := Sniff([]byte(tt.data)); got != tt.want {
+			t.Errorf("Sniff(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestFormatNames(t *testing.T) {
+	tests := []struct {
+		format    Format
+		ext, mime string
+	}{
+		{PNG, ".png", "image/png"},
+		{JPEG, ".jpg", "image/jpeg"},
+		{GIF, ".gif", "image/gif"},
+		{WEBP, ".webp", "image/webp"},
+		{Unknown, "", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if tt.format.Ext() != tt.ext || tt.format.MimeType() != tt.mime {
+			t.Errorf("%q: Ext %q MimeType %q", tt.format, tt.format.Ext(), tt.format.MimeType())
+		}
+	}
+
+	renames := []struct {
+		name   string
+		format Format
+		want   string
+	}{
+		{"speedtest_1.png", JPEG, "speedtest_1.jpg"},
+		{"photo.jpeg", JPEG, "photo.jpeg"},
+		{"photo.JPG", JPEG, "photo.JPG"},
+		{"image.png", PNG, "image.png"},
+		{"noext", PNG, "noext.png"},
+		{"archive.tar.gz", JPEG, "archive.tar.jpg"},
+		{"data.bin", Unknown, "data.bin"},
+	}
+	for _, tt := range renames {
+		if got := RenameFor(tt.name, tt.format); got != tt.want {
+			t.Errorf("RenameFor(%q, %q) = %q, want %q", tt.name, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Level
+		ok   bool
+	}{
+		{"", Off, true},
+		{"off", Off, true},
+		{" Balanced ", Balanced, true},
+		{"AGGRESSIVE", Aggressive, true},
+		{"max", Off, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.in)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParseLevel(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+	if OptionsFor(Off).Enabled() || !OptionsFor(Balanced).Enabled() || (Options{}).Enabled() {
+		t.Error("Enabled mismatch")
+	}
+	if OptionsFor(Balanced).ConvertPNG || !OptionsFor(Aggressive).ConvertPNG {
+		t.Error("only aggressive should convert PNG")
+	}
+}
+
+func TestCapDimensions(t *testing.T) {
+	tests := []struct {
+		w, h, max    int
+		wantW, wantH int
+		ok           bool
+	}{
+		{100, 50, 0, 100, 50, false},
+		{100, 50, 100, 100, 50, false},
+		{200, 100, 100, 100, 50, true},
+		{100, 200, 100, 50, 100, true},
+		{3000, 2000, 1920, 1920, 1280, true},
+		{2000, 3000, 1920, 1280, 1920, true},
+		{333, 100, 100, 100, 30, true},
+		{100, 333, 100, 30, 100, true},
+		{10000, 1, 100, 100, 1, true},
+		{1, 10000, 100, 1, 100, true},
+		{101, 101, 100, 100, 100, true},
+	}
+	for _, tt := range tests {
+		w, h, ok := CapDimensions(tt.w, tt.h, tt.max)
+		if w != tt.wantW || h != tt.wantH || ok != tt.ok {
+			t.Errorf("CapDimensions(%d, %d, %d) = %d, %d, %v; want %d, %d, %v", tt.w, tt.h, tt.max, w, h, ok, tt.wantW, tt.wantH, tt.ok)
+		}
+	}
+}
+
+func TestDownscaleAverages(t *testing.T) {
+	// 左半黑右半白的4x2图片缩小为2x1后，每个像素是对应区域的平均值
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			c := color.NRGBA{A: 255}
+			if x >= 2 {
+				c = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+			}
+			if x == 1 {
+				c = color.NRGBA{R: 100, A: 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	dst := Downscale(src, 2, 1)
+	if got := dst.RGBAAt(0, 0); got != (color.RGBA{R: 50, A: 255}) {
+		t.Errorf("left pixel = %v", got)
+	}
+	if got := dst.RGBAAt(1, 0); got != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("right pixel = %v", got)
+	}
+
+	// 起点不为原点的子图按自身的范围缩小
+	sub := src.SubImage(image.Rect(2, 0, 4, 2))
+	if got := Downscale(sub, 1, 1).RGBAAt(0, 0); got != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("sub image pixel = %v", got)
+	}
+}
+
+func TestStats(t *testing.T) {
+	var s Stats
+	s.Record(Result{Original: 1000, Compressed: 400, Changed: true})
+	s.Record(Result{Original: 500, Compressed: 500})
+	s.Record(Result{Original: 300, Compressed: 200, Changed: true})
+	want := StatsSnapshot{Files: 3, Compressed: 2, Original: 1800, Saved: 700}
+	if got := s.Snapshot(); got != want {
+		t.Errorf("Snapshot = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// durationBuckets 命令耗时直方图的上界(秒)
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// histogram 一组标签下的耗时分布，counts[i] 为不超过 durationBuckets[i] 的次数(非累计)
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Collector 收集导出到 /metrics 的指标。所有方法都可以在 nil 上调用，
+// 未启用指标时调用方不需要判断
+type Collector struct {
+	mutex     sync.Mutex
+	updates   map[string]uint64     // 更新类型 -> 次数
+	commands  map[string]*histogram // 命令名 -> 耗时分布
+	apiErrors map[[2]string]uint64  // {错误码, 错误类型} -> 次数
+	lookups   map[[2]string]uint64  // {peer 类型, hit|miss} -> 次数
+	started   time.Time
+}
+
+// NewCollector 创建指标收集器
+func NewCollector() *Collector {
+	return &Collector{
+		updates:   make(map[string]uint64),
+		commands:  make(map[string]*histogram),
+		apiErrors: make(map[[2]string]uint64),
+		lookups:   make(map[[2]string]uint64),
+		started:   time.Now(),
+	}
+}
+
+// UpdateReceived 记录收到的一个更新，按 TL 类型名统计
+func (c *Collector) UpdateReceived(update tg.UpdateClass) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	c.updates[update.TypeName()]++
+	c.mutex.Unlock()
+}
+
+// CommandExecuted 记录一次命令执行的耗时
+func (c *Collector) CommandExecuted(command string, d time.Duration) {
+	if c == nil {
+		return
+	}
+	seconds := d.Seconds()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	h := c.commands[command]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		c.commands[command] = h
+	}
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// AccessHashLookup 记录一次 access_hash 查找，hit 表示无需请求 Telegram 即可得到
+func (c *Collector) AccessHashLookup(kind string, hit bool) {
+	if c == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	c.mutex.Lock()
+	c.lookups[[2]string{kind, result}]++
+	c.mutex.Unlock()
+}
+
+// Middleware 返回Telegram客户端中间件，按RPC错误码和错误类型统计失败的请求
+func (c *Collector) Middleware() telegram.Middleware {
+	return telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			err := next.Invoke(ctx, input, output)
+			if rpcErr, ok := tgerr.As(err); ok && c != nil {
+				key := [2]string{strconv.Itoa(rpcErr.Code), rpcErr.Type}
+				c.mutex.Lock()
+				c.apiErrors[key]++
+				c.mutex.Unlock()
+			}
+			return err
+		}
+	})
+}
+
+// WriteText 以 Prometheus 文本格式写出所有指标
+func (c *Collector) WriteText(w io.Writer) error {
+	var b strings.Builder
+	c.mutex.Lock()
+
+	b.WriteString("# HELP nexusvalet_uptime_seconds Seconds since the metrics collector was created.\n")
+	b.WriteString("# TYPE nexusvalet_uptime_seconds gauge\n")
+	fmt.Fprintf(&b, "nexusvalet_uptime_seconds %s\n", formatFloat(time.Since(c.started).Seconds()))
+
+	b.WriteString("# HELP nexusvalet_updates_received_total Telegram updates received, by update type.\n")
+	b.WriteString("# TYPE nexusvalet_updates_received_total counter\n")
+	for _, name := range sortedKeys(c.updates) {
+		fmt.Fprintf(&b, "nexusvalet_updates_received_total{type=%s} %d\n", quote(name), c.updates[name])
+	}
+
+	b.WriteString("# HELP nexusvalet_command_duration_seconds Command handler execution time.\n")
+	b.WriteString("# TYPE nexusvalet_command_duration_seconds histogram\n")
+	for _, name := range sortedKeys(c.commands) {
+		h := c.commands[name]
+		var cumulative uint64
+		for i, le := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "nexusvalet_command_duration_seconds_bucket{command=%s,le=%s} %d\n", quote(name), quote(formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(&b, "nexusvalet_command_duration_seconds_bucket{command=%s,le=\"+Inf\"} %d\n", quote(name), h.count)
+		fmt.Fprintf(&b, "nexusvalet_command_duration_seconds_sum{command=%s} %s\n", quote(name), formatFloat(h.sum))
+		fmt.Fprintf(&b, "nexusvalet_command_duration_seconds_count{command=%s} %d\n", quote(name), h.count)
+	}
+
+	b.WriteString("# HELP nexusvalet_api_errors_total Telegram RPC errors, by error code and type.\n")
+	b.WriteString("# TYPE nexusvalet_api_errors_total counter\n")
+	for _, key := range sortedPairs(c.apiErrors) {
+		fmt.Fprintf(&b, "nexusvalet_api_errors_total{code=%s,type=%s} %d\n", quote(key[0]), quote(key[1]), c.apiErrors[key])
+	}
+
+	b.WriteString("# HELP nexusvalet_access_hash_lookups_total access_hash lookups, by peer kind and cache result.\n")
+	b.WriteString("# TYPE nexusvalet_access_hash_lookups_total counter\n")
+	kinds := make(map[string][2]uint64) // kind -> {hit, miss}
+	for _, key := range sortedPairs(c.lookups) {
+		n := c.lookups[key]
+		fmt.Fprintf(&b, "nexusvalet_access_hash_lookups_total{kind=%s,result=%s} %d\n", quote(key[0]), quote(key[1]), n)
+		counts := kinds[key[0]]
+		if key[1] == "hit" {
+			counts[0] += n
+		} else {
+			counts[1] += n
+		}
+		kinds[key[0]] = counts
+	}
+	c.mutex.Unlock()
+
+	b.WriteString("# HELP nexusvalet_access_hash_hit_ratio Share of access_hash lookups served from cache.\n")
+	b.WriteString("# TYPE nexusvalet_access_hash_hit_ratio gauge\n")
+	for _, kind := range sortedKeys(kinds) {
+		counts := kinds[kind]
+		fmt.Fprintf(&b, "nexusvalet_access_hash_hit_ratio{kind=%s} %s\n", quote(kind), formatFloat(float64(counts[0])/float64(counts[0]+counts[1])))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// sortedKeys 返回按字典序排列的键，保证输出稳定
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedPairs 返回按字典序排列的二元标签键
+func sortedPairs(m map[[2]string]uint64) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
+
+// quote 按文本格式的规则转义并加引号
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"nexusvalet/pkg/logger"
+	"time"
+)
+
+// DefaultAddr 未配置 metrics.addr 时的监听地址，只监听本机
+const DefaultAddr = "127.0.0.1:9464"
+
+// Server 在 /metrics 上以 Prometheus 文本格式导出 Collector 的指标
+type Server struct {
+	server *http.Server
+}
+
+// NewServer 创建指标服务，addr 为空时使用 DefaultAddr
+func NewServer(addr string, collector *Collector) *Server {
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := collector.WriteText(w); err != nil {
+			logger.Debugf("Failed to write metrics: %v", err)
+		}
+	})
+	return &Server{server: &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}}
+}
+
+// Start 开始监听。监听失败时直接返回错误，之后在后台处理请求
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Metrics endpoint listening on http://%s/metrics", listener.Addr())
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Metrics endpoint stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop 关闭监听，最多等待 ctx 结束，超时后强制关闭仍未完成的连接
+func (s *Server) Stop(ctx context.Context) {
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.server.Close()
+	}
+}
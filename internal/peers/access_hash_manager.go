@@ -4,8 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"nexusvalet/internal/cache"
+	"nexusvalet/internal/metrics"
+	"nexusvalet/internal/storage"
 	"nexusvalet/pkg/logger"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gotd/td/tg"
@@ -25,19 +29,36 @@ type UserInfo struct {
 type AccessHashManager struct {
 	api          *tg.Client
 	db           *sql.DB
-	userCache    map[int64]*UserInfo
-	mutex        sync.RWMutex
+	userCache    *cache.Cache[int64, *UserInfo]
+	channelCache *cache.Cache[int64, *ChannelInfo]
+	fullUsers    *cache.Cache[int64, *FullUserInfo]
+	notMembers   *cache.Cache[memberKey, struct{}]
 	cacheExpiry  time.Duration
 	failureCount map[int64]int
 	failureMutex sync.RWMutex
 	persistent   bool
+	warmed       atomic.Bool
+	fetchUsers   usersFetcher // 为空时使用 api.UsersGetUsers
+	scanLimit    int          // 搜索群组成员时最多遍历的成员数，0表示默认值
+	metrics      *metrics.Collector
+}
+
+// accessHashCacheSize 内存中最多缓存的用户数
+const accessHashCacheSize = 50000
+
+// newUserCache 创建用户缓存，过期时间与 cacheExpiry 一致
+func newUserCache(expiry time.Duration) *cache.Cache[int64, *UserInfo] {
+	return cache.New[int64, *UserInfo]("access_hash", cache.Options{TTL: expiry, MaxEntries: accessHashCacheSize})
 }
 
 // NewAccessHashManager 创建新的AccessHashManager
 func NewAccessHashManager(api *tg.Client) *AccessHashManager {
 	return &AccessHashManager{
 		api:          api,
-		userCache:    make(map[int64]*UserInfo),
+		userCache:    newUserCache(12 * time.Hour),
+		channelCache: newChannelCache(12 * time.Hour),
+		fullUsers:    newFullUserCache(),
+		notMembers:   newNotMemberCache(),
 		cacheExpiry:  12 * time.Hour,
 		failureCount: make(map[int64]int),
 		persistent:   false,
@@ -49,24 +70,44 @@ func NewAccessHashManagerWithDB(api *tg.Client, db *sql.DB) *AccessHashManager {
 	ahm := &AccessHashManager{
 		api:          api,
 		db:           db,
-		userCache:    make(map[int64]*UserInfo),
+		userCache:    newUserCache(12 * time.Hour),
+		channelCache: newChannelCache(12 * time.Hour),
+		fullUsers:    newFullUserCache(),
+		notMembers:   newNotMemberCache(),
 		cacheExpiry:  12 * time.Hour,
 		failureCount: make(map[int64]int),
 		persistent:   true,
 	}
 
+	// 启动时只建表，不加载整表：缓存未命中时按需查询数据库，整表预热由 WarmFromDatabase 在后台完成
 	if err := ahm.initDatabase(); err != nil {
 		logger.Errorf("Failed to initialize access_hash database: %v", err)
 		ahm.persistent = false
-	} else {
-		if err := ahm.loadFromDatabase(); err != nil {
-			logger.Errorf("Failed to load access_hash from database: %v", err)
-		}
 	}
 
 	return ahm
 }
 
+// WarmFromDatabase 将数据库中未过期的用户和频道 access_hash 全部加载到内存缓存
+func (ahm *AccessHashManager) WarmFromDatabase() error {
+	if !ahm.persistent {
+		return nil
+	}
+	if err := ahm.loadFromDatabase(); err != nil {
+		return err
+	}
+	if err := ahm.loadChannelsFromDatabase(); err != nil {
+		return err
+	}
+	ahm.warmed.Store(true)
+	return nil
+}
+
+// SetMetrics 设置指标收集器，记录缓存(含数据库)命中与需要请求 Telegram 的查找
+func (ahm *AccessHashManager) SetMetrics(collector *metrics.Collector) {
+	ahm.metrics = collector
+}
+
 // GetInputPeer 统一根据 peerID 返回可用的 tg.InputPeerClass。
 func (ahm *AccessHashManager) GetInputPeer(ctx context.Context, peerID int64) (tg.InputPeerClass, error) {
 	if peerID > 0 {
@@ -85,7 +126,9 @@ func (ahm *AccessHashManager) GetInputPeer(ctx context.Context, peerID int64) (t
 
 // GetUserPeer 获取用户的InputPeerUser
 func (ahm *AccessHashManager) GetUserPeer(ctx context.Context, userID int64) (*tg.InputPeerUser, error) {
-	if userInfo := ahm.getCachedUser(userID); userInfo != nil {
+	userInfo := ahm.getCachedUser(userID)
+	ahm.metrics.AccessHashLookup("user", userInfo != nil)
+	if userInfo != nil {
 		logger.Debugf("从缓存获取用户%d的access_hash: %d", userID, userInfo.AccessHash)
 		return &tg.InputPeerUser{UserID: userInfo.ID, AccessHash: userInfo.AccessHash}, nil
 	}
@@ -127,34 +170,6 @@ func (ahm *AccessHashManager) GetUserPeerWithFallback(ctx context.Context, userI
 	return nil, fmt.Errorf("无法获取用户%d的有效AccessHash，请重新建立与该用户的连接", userID)
 }
 
-func (ahm *AccessHashManager) searchUserInChannel(ctx context.Context, channelPeer tg.InputChannelClass, userID int64) (*tg.InputPeerUser, error) {
-	participants, err := ahm.api.ChannelsGetParticipants(ctx, &tg.ChannelsGetParticipantsRequest{
-		Channel: channelPeer,
-		Filter:  &tg.ChannelParticipantsRecent{},
-		Offset:  0,
-		Limit:   200,
-		Hash:    0,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("获取频道参与者失败: %v", err)
-	}
-	var users []tg.UserClass
-	switch p := participants.(type) {
-	case *tg.ChannelsChannelParticipants:
-		users = p.Users
-	default:
-		return nil, fmt.Errorf("不支持的参与者类型")
-	}
-	for _, u := range users {
-		if user, ok := u.(*tg.User); ok && user.ID == userID {
-			ahm.cacheUser(user)
-			logger.Infof("通过搜索频道成员找到用户%d的access_hash: %d", userID, user.AccessHash)
-			return &tg.InputPeerUser{UserID: user.ID, AccessHash: user.AccessHash}, nil
-		}
-	}
-	return nil, fmt.Errorf("在频道成员中未找到用户%d", userID)
-}
-
 // GetUserPeerFromMessage 从消息中获取用户信息
 func (ahm *AccessHashManager) GetUserPeerFromMessage(ctx context.Context, peer tg.InputPeerClass, msgID int, userID int64) (*tg.InputPeerUser, error) {
 	inputUser := &tg.InputUserFromMessage{Peer: peer, MsgID: msgID, UserID: userID}
@@ -196,27 +211,43 @@ func (ahm *AccessHashManager) GetUserPeerFromParticipant(ctx context.Context, ch
 func (ahm *AccessHashManager) UpdateUserFromMessage(message *tg.Message) {}
 
 func (ahm *AccessHashManager) CacheUsersFromUpdate(users []tg.UserClass) {
-	ahm.mutex.Lock()
-	defer ahm.mutex.Unlock()
 	for _, u := range users {
 		if user, ok := u.(*tg.User); ok {
-			ahm.userCache[user.ID] = &UserInfo{ID: user.ID, AccessHash: user.AccessHash, Username: user.Username, FirstName: user.FirstName, LastName: user.LastName, UpdatedAt: time.Now()}
+			ahm.userCache.Set(user.ID, &UserInfo{ID: user.ID, AccessHash: user.AccessHash, Username: user.Username, FirstName: user.FirstName, LastName: user.LastName, UpdatedAt: time.Now()})
 			logger.Debugf("从更新缓存用户%d的access_hash: %d", user.ID, user.AccessHash)
 		}
 	}
 }
 
 func (ahm *AccessHashManager) getCachedUser(userID int64) *UserInfo {
-	ahm.mutex.RLock()
-	defer ahm.mutex.RUnlock()
-	userInfo, exists := ahm.userCache[userID]
+	userInfo, exists := ahm.userCache.Get(userID)
 	if !exists {
+		if ahm.persistent && !ahm.warmed.Load() {
+			return ahm.loadUserFromDatabase(userID)
+		}
 		return nil
 	}
-	if time.Since(userInfo.UpdatedAt) > ahm.cacheExpiry {
+	return userInfo
+}
+
+// loadUserFromDatabase 预热完成前缓存未命中时，从数据库读取单个用户
+func (ahm *AccessHashManager) loadUserFromDatabase(userID int64) *UserInfo {
+	var userInfo UserInfo
+	var updatedAtStr string
+	err := ahm.db.QueryRow(`
+		SELECT user_id, access_hash, username, first_name, last_name, updated_at
+		FROM access_hash_cache WHERE user_id = ?
+	`, userID).Scan(&userInfo.ID, &userInfo.AccessHash, &userInfo.Username, &userInfo.FirstName, &userInfo.LastName, &updatedAtStr)
+	if err != nil {
 		return nil
 	}
-	return userInfo
+	t, err := parseUpdatedAt(updatedAtStr)
+	if err != nil || time.Since(t) > ahm.cacheExpiry {
+		return nil
+	}
+	userInfo.UpdatedAt = t
+	ahm.userCache.SetUntil(userInfo.ID, &userInfo, t.Add(ahm.cacheExpiry))
+	return &userInfo
 }
 
 func (ahm *AccessHashManager) fetchAndCacheUser(ctx context.Context, userID int64) (*UserInfo, error) {
@@ -259,8 +290,10 @@ func (ahm *AccessHashManager) fetchUserFromDialogs(ctx context.Context, userID i
 	var users []tg.UserClass
 	if ds, ok := dialogs.(*tg.MessagesDialogs); ok {
 		users = ds.Users
+		ahm.CacheChatsFromUpdate(ds.Chats)
 	} else if ds, ok := dialogs.(*tg.MessagesDialogsSlice); ok {
 		users = ds.Users
+		ahm.CacheChatsFromUpdate(ds.Chats)
 	}
 	for _, u := range users {
 		if user, ok := u.(*tg.User); ok && user.ID == userID {
@@ -306,10 +339,8 @@ func (ahm *AccessHashManager) fetchBotByUsername(ctx context.Context, userID int
 }
 
 func (ahm *AccessHashManager) cacheUser(user *tg.User) *UserInfo {
-	ahm.mutex.Lock()
-	defer ahm.mutex.Unlock()
 	userInfo := &UserInfo{ID: user.ID, AccessHash: user.AccessHash, Username: user.Username, FirstName: user.FirstName, LastName: user.LastName, UpdatedAt: time.Now()}
-	ahm.userCache[user.ID] = userInfo
+	ahm.userCache.Set(user.ID, userInfo)
 	if ahm.persistent {
 		if err := ahm.saveToDatabase(userInfo); err != nil {
 			logger.Errorf("Failed to save user %d to database: %v", user.ID, err)
@@ -323,26 +354,18 @@ func (ahm *AccessHashManager) GetCachedUserInfo(userID int64) *UserInfo {
 }
 
 func (ahm *AccessHashManager) ClearExpiredCache() {
-	ahm.mutex.Lock()
-	defer ahm.mutex.Unlock()
-	now := time.Now()
-	for userID, userInfo := range ahm.userCache {
-		if now.Sub(userInfo.UpdatedAt) > ahm.cacheExpiry {
-			delete(ahm.userCache, userID)
-		}
-	}
+	ahm.userCache.Purge()
+	ahm.channelCache.Purge()
 }
 
 func (ahm *AccessHashManager) GetCacheStats() (total int, expired int) {
-	ahm.mutex.RLock()
-	defer ahm.mutex.RUnlock()
-	now := time.Now()
-	for _, userInfo := range ahm.userCache {
+	ahm.userCache.Range(func(_ int64, _ *UserInfo, isExpired bool) bool {
 		total++
-		if now.Sub(userInfo.UpdatedAt) > ahm.cacheExpiry {
+		if isExpired {
 			expired++
 		}
-	}
+		return true
+	})
 	return
 }
 
@@ -366,9 +389,8 @@ func (ahm *AccessHashManager) resetFailureCount(userID int64) {
 func (ahm *AccessHashManager) FailureCount(userID int64) int { return ahm.getFailureCount(userID) }
 
 func (ahm *AccessHashManager) ClearUserCache(userID int64) {
-	ahm.mutex.Lock()
-	defer ahm.mutex.Unlock()
-	delete(ahm.userCache, userID)
+	ahm.userCache.Delete(userID)
+	ahm.fullUsers.Delete(userID)
 	ahm.resetFailureCount(userID)
 	if ahm.persistent && ahm.db != nil {
 		_, err := ahm.db.Exec("DELETE FROM access_hash_cache WHERE user_id = ?", userID)
@@ -395,7 +417,10 @@ func (ahm *AccessHashManager) initDatabase() error {
 	if err != nil {
 		return fmt.Errorf("failed to create access_hash_cache table: %w", err)
 	}
-	return nil
+	if err := ahm.initFullUserTable(); err != nil {
+		return err
+	}
+	return ahm.initChannelTable()
 }
 
 func (ahm *AccessHashManager) loadFromDatabase() error {
@@ -410,21 +435,20 @@ func (ahm *AccessHashManager) loadFromDatabase() error {
 		return fmt.Errorf("failed to query access_hash_cache: %w", err)
 	}
 	defer rows.Close()
-	ahm.mutex.Lock()
-	defer ahm.mutex.Unlock()
 	for rows.Next() {
 		var userInfo UserInfo
 		var updatedAtStr string
 		if err := rows.Scan(&userInfo.ID, &userInfo.AccessHash, &userInfo.Username, &userInfo.FirstName, &userInfo.LastName, &updatedAtStr); err != nil {
 			continue
 		}
-		if t, err := time.Parse("2006-01-02 15:04:05", updatedAtStr); err == nil {
+		if t, err := parseUpdatedAt(updatedAtStr); err == nil {
 			userInfo.UpdatedAt = t
 		} else {
 			userInfo.UpdatedAt = time.Now()
 		}
 		if time.Since(userInfo.UpdatedAt) <= ahm.cacheExpiry {
-			ahm.userCache[userInfo.ID] = &userInfo
+			info := userInfo
+			ahm.userCache.SetUntil(info.ID, &info, info.UpdatedAt.Add(ahm.cacheExpiry))
 		}
 	}
 	return nil
@@ -434,7 +458,7 @@ func (ahm *AccessHashManager) saveToDatabase(userInfo *UserInfo) error {
 	if !ahm.persistent || ahm.db == nil {
 		return nil
 	}
-	_, err := ahm.db.Exec(`
+	_, err := storage.Exec(ahm.db, `
 		INSERT OR REPLACE INTO access_hash_cache 
 		(user_id, access_hash, username, first_name, last_name, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?)
@@ -450,14 +474,35 @@ func (ahm *AccessHashManager) CleanExpiredFromDatabase() error {
 	_, err := ahm.db.Exec(`
 		DELETE FROM access_hash_cache WHERE updated_at < ?
 	`, expiredTime.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return err
+	}
+	_, err = ahm.db.Exec(`
+		DELETE FROM channel_hash_cache WHERE updated_at < ?
+	`, expiredTime.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return err
+	}
+	_, err = ahm.db.Exec(`
+		DELETE FROM full_user_cache WHERE updated_at < ?
+	`, time.Now().Add(-fullUserExpiry).Format("2006-01-02 15:04:05"))
 	return err
 }
 
-// 频道解析
+// 频道解析：优先使用缓存，未命中时依次尝试 ChannelsGetChannels 和对话列表，
+// 途中返回的所有频道都会写入缓存
 func (ahm *AccessHashManager) getChannelPeer(ctx context.Context, channelID int64) (tg.InputPeerClass, error) {
+	info := ahm.getCachedChannel(channelID)
+	ahm.metrics.AccessHashLookup("channel", info != nil)
+	if info != nil {
+		logger.Debugf("从缓存获取频道%d的access_hash: %d", channelID, info.AccessHash)
+		return &tg.InputPeerChannel{ChannelID: info.ID, AccessHash: info.AccessHash}, nil
+	}
+
 	channels, err := ahm.api.ChannelsGetChannels(ctx, []tg.InputChannelClass{&tg.InputChannel{ChannelID: channelID, AccessHash: 0}})
 	if err == nil {
 		if chats, ok := channels.(*tg.MessagesChats); ok {
+			ahm.CacheChatsFromUpdate(chats.Chats)
 			for _, c := range chats.Chats {
 				if ch, ok := c.(*tg.Channel); ok && ch.ID == channelID {
 					return &tg.InputPeerChannel{ChannelID: ch.ID, AccessHash: ch.AccessHash}, nil
@@ -483,18 +528,28 @@ func (ahm *AccessHashManager) getChannelPeer(ctx context.Context, channelID int6
 }
 
 func (ahm *AccessHashManager) searchChannelInDialogs(dialogs tg.MessagesDialogsClass, channelID int64) tg.InputPeerClass {
+	var chats []tg.ChatClass
 	if ds, ok := dialogs.(*tg.MessagesDialogs); ok {
-		for _, chat := range ds.Chats {
-			if ch, ok := chat.(*tg.Channel); ok && ch.ID == channelID {
-				return &tg.InputPeerChannel{ChannelID: ch.ID, AccessHash: ch.AccessHash}
-			}
-		}
+		chats = ds.Chats
 	} else if ds, ok := dialogs.(*tg.MessagesDialogsSlice); ok {
-		for _, chat := range ds.Chats {
-			if ch, ok := chat.(*tg.Channel); ok && ch.ID == channelID {
-				return &tg.InputPeerChannel{ChannelID: ch.ID, AccessHash: ch.AccessHash}
-			}
+		chats = ds.Chats
+	}
+	ahm.CacheChatsFromUpdate(chats)
+	for _, chat := range chats {
+		if ch, ok := chat.(*tg.Channel); ok && ch.ID == channelID {
+			return &tg.InputPeerChannel{ChannelID: ch.ID, AccessHash: ch.AccessHash}
 		}
 	}
 	return nil
 }
+
+// parseUpdatedAt 解析 updated_at 列。写入时按本地时间格式化为 "2006-01-02 15:04:05"，
+// 但SQLite驱动读取 DATETIME 列时会返回 RFC3339 格式并标记为UTC，两种格式都按本地时间解释
+func parseUpdatedAt(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid updated_at: %q", s)
+}
@@ -0,0 +1,99 @@
+package peers
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+	_ "modernc.org/sqlite"
+)
+
+func openPeersDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "peers.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestAccessHashLazyLoadBeforeWarmUp(t *testing.T) {
+	db := openPeersDB(t)
+	first := NewAccessHashManagerWithDB(nil, db)
+	first.cacheUser(&tg.User{ID: 7, AccessHash: 70, Username: "alice"})
+	first.cacheUser(&tg.User{ID: 8, AccessHash: 80})
+
+	// 启动时不加载整表，缓存未命中时按需读取单个用户
+	ahm := NewAccessHashManagerWithDB(nil, db)
+	if ahm.userCache.Len() != 0 {
+		t.Fatalf("cache len = %d at startup, want 0", ahm.userCache.Len())
+	}
+	info := ahm.GetCachedUserInfo(7)
+	if info == nil || info.AccessHash != 70 || info.Username != "alice" {
+		t.Fatalf("GetCachedUserInfo(7) = %+v, want loaded from database", info)
+	}
+	if ahm.userCache.Len() != 1 {
+		t.Errorf("cache len = %d, want only the looked-up user", ahm.userCache.Len())
+	}
+	if ahm.GetCachedUserInfo(9) != nil {
+		t.Error("unknown user should be a miss")
+	}
+
+	if err := ahm.WarmFromDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	if ahm.userCache.Len() != 2 {
+		t.Errorf("cache len after warm-up = %d, want 2", ahm.userCache.Len())
+	}
+
+	// 预热完成后不再逐条查询数据库
+	first.cacheUser(&tg.User{ID: 10, AccessHash: 100})
+	if ahm.GetCachedUserInfo(10) != nil {
+		t.Error("after warm-up, misses should not query the database")
+	}
+}
+
+func TestAccessHashWarmUpWithoutDatabase(t *testing.T) {
+	ahm := NewAccessHashManager(nil)
+	if err := ahm.WarmFromDatabase(); err != nil {
+		t.Errorf("WarmFromDatabase without persistence = %v", err)
+	}
+	if ahm.GetCachedUserInfo(7) != nil {
+		t.Error("memory-only manager should not find unknown users")
+	}
+}
+
+func TestParseUpdatedAt(t *testing.T) {
+	want := time.Date(2026, 10, 14, 9, 30, 0, 0, time.Local)
+	for _, s := range []string{"2026-10-14 09:30:00", "2026-10-14T09:30:00Z"} {
+		if got, err := parseUpdatedAt(s); err != nil || !got.Equal(want) {
+			t.Errorf("parseUpdatedAt(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := parseUpdatedAt("yesterday"); err == nil {
+		t.Error("invalid time should fail")
+	}
+}
+
+func TestChannelLazyLoadBeforeWarmUp(t *testing.T) {
+	db := openPeersDB(t)
+	NewAccessHashManagerWithDB(nil, db).CacheChatsFromUpdate([]tg.ChatClass{
+		&tg.Channel{ID: 5, AccessHash: 50, Title: "news"},
+		&tg.Channel{ID: 6, AccessHash: 60, Min: true},
+	})
+
+	ahm := NewAccessHashManagerWithDB(nil, db)
+	if info := ahm.GetCachedChannelInfo(5); info == nil || info.AccessHash != 50 || info.Title != "news" {
+		t.Errorf("GetCachedChannelInfo(5) = %+v, want loaded from database", info)
+	}
+	if info := ahm.GetCachedChannelInfo(6); info != nil {
+		t.Errorf("min channel = %+v, should not be persisted", info)
+	}
+	if err := ahm.WarmFromDatabase(); err != nil || ahm.channelCache.Len() != 1 {
+		t.Errorf("warm-up = %v, channel cache len %d", err, ahm.channelCache.Len())
+	}
+}
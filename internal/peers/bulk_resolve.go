@@ -0,0 +1,148 @@
+package peers
+
+import (
+	"context"
+	"time"
+
+	"nexusvalet/pkg/logger"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// bulkResolveBatchSizes 每轮尝试使用的批大小。首轮按API上限100个一批，
+// 失败的子集在后续轮次中用更小的批次重试，以便隔离导致整批失败的ID
+var bulkResolveBatchSizes = []int{100, 10, 1}
+
+// bulkResolveMaxFloodWait 单次等待FLOOD_WAIT的上限，超过则放弃本轮
+const bulkResolveMaxFloodWait = 60 * time.Second
+
+// bulkResolveBackoff 重试轮次之间的基础退避时间，第n轮重试前等待n倍
+var bulkResolveBackoff = time.Second
+
+// usersFetcher 批量获取用户，默认使用 UsersGetUsers
+type usersFetcher func(ctx context.Context, users []tg.InputUserClass) ([]tg.UserClass, error)
+
+// BulkResolveUsers 批量解析用户。优先使用缓存，其余按≤100个一批调用UsersGetUsers，
+// 结果合并回缓存；失败的子集带退避重试。返回已解析的用户和无法解析的ID
+func (ahm *AccessHashManager) BulkResolveUsers(ctx context.Context, ids []int64) (map[int64]*UserInfo, []int64) {
+	resolved := make(map[int64]*UserInfo, len(ids))
+	seen := make(map[int64]bool, len(ids))
+	var pending []int64
+
+	for _, id := range ids {
+		if id <= 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if info := ahm.getCachedUser(id); info != nil {
+			resolved[id] = info
+			continue
+		}
+		pending = append(pending, id)
+	}
+
+	if len(pending) > 0 {
+		logger.Debugf("BulkResolveUsers: %d cached, %d to fetch", len(resolved), len(pending))
+	}
+
+	for attempt, batchSize := range bulkResolveBatchSizes {
+		if len(pending) == 0 {
+			break
+		}
+		if attempt > 0 {
+			// 递增退避
+			if !sleepContext(ctx, time.Duration(attempt)*bulkResolveBackoff) {
+				break
+			}
+			logger.Debugf("BulkResolveUsers: retrying %d users in batches of %d", len(pending), batchSize)
+		}
+
+		var failed []int64
+		for _, batch := range partitionIDs(pending, batchSize) {
+			if ctx.Err() != nil {
+				failed = append(failed, batch...)
+				continue
+			}
+			users, err := ahm.fetchUsersBatch(ctx, batch)
+			if err != nil {
+				if wait, ok := tgerr.AsFloodWait(err); ok && wait <= bulkResolveMaxFloodWait {
+					logger.Warnf("BulkResolveUsers: FLOOD_WAIT %s, waiting before next batch", wait)
+					sleepContext(ctx, wait)
+				} else {
+					logger.Debugf("BulkResolveUsers: batch of %d failed: %v", len(batch), err)
+				}
+				failed = append(failed, batch...)
+				continue
+			}
+
+			got := make(map[int64]bool, len(users))
+			for _, u := range users {
+				if user, ok := u.(*tg.User); ok {
+					resolved[user.ID] = ahm.cacheUser(user)
+					got[user.ID] = true
+				}
+			}
+			for _, id := range batch {
+				if !got[id] {
+					failed = append(failed, id)
+				}
+			}
+		}
+		pending = failed
+	}
+
+	for _, id := range pending {
+		ahm.incrementFailureCount(id)
+	}
+	if len(pending) > 0 {
+		logger.Warnf("BulkResolveUsers: %d users could not be resolved", len(pending))
+	}
+
+	return resolved, pending
+}
+
+// fetchUsersBatch 获取一批用户，优先使用已缓存(可能已过期)的access_hash
+func (ahm *AccessHashManager) fetchUsersBatch(ctx context.Context, ids []int64) ([]tg.UserClass, error) {
+	input := make([]tg.InputUserClass, 0, len(ids))
+	for _, id := range ids {
+		var accessHash int64
+		if info, ok := ahm.userCache.GetStale(id); ok {
+			accessHash = info.AccessHash
+		}
+		input = append(input, &tg.InputUser{UserID: id, AccessHash: accessHash})
+	}
+
+	if ahm.fetchUsers != nil {
+		return ahm.fetchUsers(ctx, input)
+	}
+	return ahm.api.UsersGetUsers(ctx, input)
+}
+
+// partitionIDs 将ID切分为不超过size个一组
+func partitionIDs(ids []int64, size int) [][]int64 {
+	if size <= 0 {
+		size = 1
+	}
+	batches := make([][]int64, 0, (len(ids)+size-1)/size)
+	for start := 0; start < len(ids); start += size {
+		end := start + size
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batches = append(batches, ids[start:end])
+	}
+	return batches
+}
+
+// sleepContext 等待d或直到ctx取消，正常等待完成返回true
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,204 @@
+package peers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// fakeUsers 伪造的 UsersGetUsers：bad 中的ID使整批失败，missing 中的ID不返回
+type fakeUsers struct {
+	mu      sync.Mutex
+	bad     map[int64]bool
+	missing map[int64]bool
+	flood   int // 前flood次调用返回 FLOOD_WAIT
+	calls   [][]int64
+	hashes  map[int64]int64 // 请求中携带的 access_hash
+}
+
+func (f *fakeUsers) fetch(_ context.Context, users []tg.InputUserClass) ([]tg.UserClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := make([]int64, 0, len(users))
+	for _, u := range users {
+		in := u.(*tg.InputUser)
+		ids = append(ids, in.UserID)
+		if f.hashes == nil {
+			f.hashes = make(map[int64]int64)
+		}
+		f.hashes[in.UserID] = in.AccessHash
+	}
+	f.calls = append(f.calls, ids)
+
+	if f.flood > 0 {
+		f.flood--
+		return nil, tgerr.New(420, "FLOOD_WAIT_0")
+	}
+	var result []tg.UserClass
+	for _, id := range ids {
+		if f.bad[id] {
+			return nil, tgerr.New(400, "USER_ID_INVALID")
+		}
+		if !f.missing[id] {
+			result = append(result, &tg.User{ID: id, AccessHash: id * 10})
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeUsers) batchSizes() []int {
+	sizes := make([]int, 0, len(f.calls))
+	for _, c := range f.calls {
+		sizes = append(sizes, len(c))
+	}
+	return sizes
+}
+
+func newBulkManager(t *testing.T, f *fakeUsers) *AccessHashManager {
+	t.Helper()
+	old := bulkResolveBackoff
+	bulkResolveBackoff = 0
+	t.Cleanup(func() { bulkResolveBackoff = old })
+
+	ahm := NewAccessHashManager(nil)
+	ahm.fetchUsers = f.fetch
+	return ahm
+}
+
+func idRange(from, to int64) []int64 {
+	ids := make([]int64, 0, to-from+1)
+	for id := from; id <= to; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestPartitionIDs(t *testing.T) {
+	tests := []struct {
+		n, size int
+		want    []int
+	}{
+		{0, 100, []int{}},
+		{5, 100, []int{5}},
+		{100, 100, []int{100}},
+		{250, 100, []int{100, 100, 50}},
+		{3, 0, []int{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		ids := idRange(1, int64(tt.n))
+		batches := partitionIDs(ids, tt.size)
+		sizes := make([]int, 0, len(batches))
+		var joined []int64
+		for _, b := range batches {
+			sizes = append(sizes, len(b))
+			joined = append(joined, b...)
+		}
+		if !reflect.DeepEqual(sizes, tt.want) {
+			t.Errorf("partitionIDs(%d ids, %d) sizes = %v, want %v", tt.n, tt.size, sizes, tt.want)
+		}
+		if len(joined) != len(ids) || (len(ids) > 0 && !reflect.DeepEqual(joined, ids)) {
+			t.Errorf("partitionIDs(%d ids, %d) lost or reordered IDs", tt.n, tt.size)
+		}
+	}
+}
+
+func TestBulkResolveBatchesAndCache(t *testing.T) {
+	f := &fakeUsers{}
+	ahm := newBulkManager(t, f)
+	ahm.userCache.Set(5, &UserInfo{ID: 5, AccessHash: 555})
+
+	// 重复和非正数ID被忽略，已缓存的不请求
+	ids := append(idRange(1, 250), 3, 0, -7)
+	resolved, failed := ahm.BulkResolveUsers(context.Background(), ids)
+	if len(failed) != 0 {
+		t.Fatalf("failed = %v", failed)
+	}
+	if len(resolved) != 250 {
+		t.Fatalf("resolved %d users, want 250", len(resolved))
+	}
+	if got := f.batchSizes(); !reflect.DeepEqual(got, []int{100, 100, 49}) {
+		t.Errorf("batch sizes = %v, want [100 100 49]", got)
+	}
+	if resolved[5].AccessHash != 555 || resolved[42].AccessHash != 420 {
+		t.Errorf("resolved[5] = %+v, resolved[42] = %+v", resolved[5], resolved[42])
+	}
+	// 结果合并回缓存，再次解析不发请求
+	f.calls = nil
+	if _, failed := ahm.BulkResolveUsers(context.Background(), idRange(1, 250)); len(failed) != 0 || len(f.calls) != 0 {
+		t.Errorf("second resolve made %d calls, failed %v", len(f.calls), failed)
+	}
+}
+
+func TestBulkResolveIsolatesBadIDs(t *testing.T) {
+	f := &fakeUsers{bad: map[int64]bool{137: true}, missing: map[int64]bool{212: true}}
+	ahm := newBulkManager(t, f)
+
+	resolved, failed := ahm.BulkResolveUsers(context.Background(), idRange(1, 250))
+	sort.Slice(failed, func(i, j int) bool { return failed[i] < failed[j] })
+	if !reflect.DeepEqual(failed, []int64{137, 212}) {
+		t.Fatalf("failed = %v, want [137 212]", failed)
+	}
+	if len(resolved) != 248 {
+		t.Errorf("resolved %d users, want 248", len(resolved))
+	}
+
+	// 第一轮3批(101-200整批失败，212缺失)；第二轮101个ID拆为11批(131-140失败)；
+	// 第三轮131-140和212逐个重试
+	want := []int{100, 100, 50, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 1}
+	for i := 0; i < 11; i++ {
+		want = append(want, 1)
+	}
+	if got := f.batchSizes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("batch sizes = %v, want %v", got, want)
+	}
+	if ahm.FailureCount(137) != 1 || ahm.FailureCount(212) != 1 || ahm.FailureCount(136) != 0 {
+		t.Errorf("failure counts = %d, %d, %d", ahm.FailureCount(137), ahm.FailureCount(212), ahm.FailureCount(136))
+	}
+}
+
+func TestBulkResolveFloodWaitRetries(t *testing.T) {
+	f := &fakeUsers{flood: 1}
+	ahm := newBulkManager(t, f)
+
+	resolved, failed := ahm.BulkResolveUsers(context.Background(), idRange(1, 30))
+	if len(failed) != 0 || len(resolved) != 30 {
+		t.Fatalf("resolved %d, failed %v", len(resolved), failed)
+	}
+	if got := f.batchSizes(); !reflect.DeepEqual(got, []int{30, 10, 10, 10}) {
+		t.Errorf("batch sizes = %v, want [30 10 10 10]", got)
+	}
+}
+
+func TestBulkResolveUsesStaleAccessHash(t *testing.T) {
+	f := &fakeUsers{}
+	ahm := newBulkManager(t, f)
+	ahm.userCache.SetUntil(9, &UserInfo{ID: 9, AccessHash: 999}, time.Now().Add(-time.Minute))
+
+	if _, failed := ahm.BulkResolveUsers(context.Background(), []int64{9, 10}); len(failed) != 0 {
+		t.Fatalf("failed = %v", failed)
+	}
+	if f.hashes[9] != 999 || f.hashes[10] != 0 {
+		t.Errorf("request access hashes = %v, want 9:999 10:0", f.hashes)
+	}
+	if info := ahm.GetCachedUserInfo(9); info == nil || info.AccessHash != 90 {
+		t.Errorf("cache after refresh = %+v", info)
+	}
+}
+
+func TestBulkResolveCancelled(t *testing.T) {
+	f := &fakeUsers{}
+	ahm := newBulkManager(t, f)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	resolved, failed := ahm.BulkResolveUsers(ctx, idRange(1, 5))
+	if len(resolved) != 0 || len(failed) != 5 || len(f.calls) != 0 {
+		t.Errorf("resolved %d, failed %v, calls %d", len(resolved), failed, len(f.calls))
+	}
+}
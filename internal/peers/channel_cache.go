@@ -0,0 +1,159 @@
+package peers
+
+import (
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/cache"
+	"nexusvalet/internal/storage"
+	"nexusvalet/pkg/logger"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// ChannelInfo 存储频道/超级群组的信息和access_hash
+type ChannelInfo struct {
+	ID         int64
+	AccessHash int64
+	Title      string
+	Username   string
+	UpdatedAt  time.Time
+}
+
+// channelCacheSize 内存中最多缓存的频道数
+const channelCacheSize = 10000
+
+// newChannelCache 创建频道缓存，过期时间与用户缓存一致
+func newChannelCache(expiry time.Duration) *cache.Cache[int64, *ChannelInfo] {
+	return cache.New[int64, *ChannelInfo]("channel_access_hash", cache.Options{TTL: expiry, MaxEntries: channelCacheSize})
+}
+
+// CacheChatsFromUpdate 缓存对话列表、更新等返回中的频道access_hash
+func (ahm *AccessHashManager) CacheChatsFromUpdate(chats []tg.ChatClass) {
+	var infos []*ChannelInfo
+	for _, c := range chats {
+		// min频道的access_hash只能在特定上下文中使用，不缓存
+		if ch, ok := c.(*tg.Channel); ok && !ch.Min && ch.AccessHash != 0 {
+			// 每条频道消息的更新都带有频道信息，没有变化时不重复写入数据库
+			if cached, exists := ahm.channelCache.Get(ch.ID); exists && cached.AccessHash == ch.AccessHash && cached.Title == ch.Title && cached.Username == ch.Username {
+				continue
+			}
+			info := &ChannelInfo{ID: ch.ID, AccessHash: ch.AccessHash, Title: ch.Title, Username: ch.Username, UpdatedAt: time.Now()}
+			ahm.channelCache.Set(ch.ID, info)
+			infos = append(infos, info)
+		}
+	}
+	if len(infos) > 0 && ahm.persistent {
+		if err := ahm.saveChannelsToDatabase(infos); err != nil {
+			logger.Errorf("Failed to save %d channels to database: %v", len(infos), err)
+		}
+	}
+}
+
+// GetCachedChannelInfo 返回缓存的频道信息，不存在或已过期时返回nil
+func (ahm *AccessHashManager) GetCachedChannelInfo(channelID int64) *ChannelInfo {
+	return ahm.getCachedChannel(channelID)
+}
+
+// ClearChannelCache 清除频道的缓存，access_hash失效(如CHANNEL_INVALID)时使用
+func (ahm *AccessHashManager) ClearChannelCache(channelID int64) {
+	ahm.channelCache.Delete(channelID)
+	if ahm.persistent && ahm.db != nil {
+		_, err := ahm.db.Exec("DELETE FROM channel_hash_cache WHERE channel_id = ?", channelID)
+		if err != nil {
+			logger.Errorf("Failed to delete channel %d from database: %v", channelID, err)
+		}
+	}
+}
+
+func (ahm *AccessHashManager) getCachedChannel(channelID int64) *ChannelInfo {
+	info, exists := ahm.channelCache.Get(channelID)
+	if !exists {
+		if ahm.persistent && !ahm.warmed.Load() {
+			return ahm.loadChannelFromDatabase(channelID)
+		}
+		return nil
+	}
+	return info
+}
+
+// loadChannelFromDatabase 预热完成前缓存未命中时，从数据库读取单个频道
+func (ahm *AccessHashManager) loadChannelFromDatabase(channelID int64) *ChannelInfo {
+	var info ChannelInfo
+	var updatedAtStr string
+	err := ahm.db.QueryRow(`
+		SELECT channel_id, access_hash, title, username, updated_at
+		FROM channel_hash_cache WHERE channel_id = ?
+	`, channelID).Scan(&info.ID, &info.AccessHash, &info.Title, &info.Username, &updatedAtStr)
+	if err != nil {
+		return nil
+	}
+	t, err := parseUpdatedAt(updatedAtStr)
+	if err != nil || time.Since(t) > ahm.cacheExpiry {
+		return nil
+	}
+	info.UpdatedAt = t
+	ahm.channelCache.SetUntil(info.ID, &info, t.Add(ahm.cacheExpiry))
+	return &info
+}
+
+func (ahm *AccessHashManager) initChannelTable() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS channel_hash_cache (
+		channel_id INTEGER PRIMARY KEY,
+		access_hash INTEGER NOT NULL,
+		title TEXT,
+		username TEXT,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+	_, err := ahm.db.Exec(createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create channel_hash_cache table: %w", err)
+	}
+	return nil
+}
+
+func (ahm *AccessHashManager) loadChannelsFromDatabase() error {
+	rows, err := ahm.db.Query(`
+		SELECT channel_id, access_hash, title, username, updated_at
+		FROM channel_hash_cache
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query channel_hash_cache: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var info ChannelInfo
+		var updatedAtStr string
+		if err := rows.Scan(&info.ID, &info.AccessHash, &info.Title, &info.Username, &updatedAtStr); err != nil {
+			continue
+		}
+		t, err := parseUpdatedAt(updatedAtStr)
+		if err != nil || time.Since(t) > ahm.cacheExpiry {
+			continue
+		}
+		info.UpdatedAt = t
+		ahm.channelCache.SetUntil(info.ID, &info, t.Add(ahm.cacheExpiry))
+	}
+	return nil
+}
+
+// saveChannelsToDatabase 在一个事务中保存多个频道，对话列表一次会返回上百个
+func (ahm *AccessHashManager) saveChannelsToDatabase(infos []*ChannelInfo) error {
+	if !ahm.persistent || ahm.db == nil {
+		return nil
+	}
+	return storage.Tx(ahm.db, func(tx *sql.Tx) error {
+		for _, info := range infos {
+			_, err := tx.Exec(`
+				INSERT OR REPLACE INTO channel_hash_cache
+				(channel_id, access_hash, title, username, updated_at)
+				VALUES (?, ?, ?, ?, ?)
+			`, info.ID, info.AccessHash, info.Title, info.Username, info.UpdatedAt.Format("2006-01-02 15:04:05"))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
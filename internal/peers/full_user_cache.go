@@ -0,0 +1,144 @@
+package peers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/cache"
+	"nexusvalet/internal/storage"
+	"nexusvalet/pkg/logger"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// FullUserInfo 存储 users.getFullUser 返回的用户资料
+type FullUserInfo struct {
+	ID               int64
+	About            string
+	CommonChatsCount int
+	PhotoCount       int // 头像数量，-1 表示未知
+	PhotoDCID        int // 当前头像所在的DC，0 表示没有头像
+	UpdatedAt        time.Time
+}
+
+const (
+	// fullUserCacheSize 内存中最多缓存的完整用户资料数
+	fullUserCacheSize = 5000
+	// fullUserExpiry 完整用户资料的缓存时间，简介和共同群组变化比access_hash频繁
+	fullUserExpiry = time.Hour
+)
+
+// newFullUserCache 创建完整用户资料缓存
+func newFullUserCache() *cache.Cache[int64, *FullUserInfo] {
+	return cache.New[int64, *FullUserInfo]("full_user", cache.Options{TTL: fullUserExpiry, MaxEntries: fullUserCacheSize})
+}
+
+// GetFullUser 返回用户的完整资料，优先使用缓存(含数据库)，未命中时请求 users.getFullUser
+// 和 photos.getUserPhotos 并写入缓存。user 需要带有效的access_hash
+func (ahm *AccessHashManager) GetFullUser(ctx context.Context, user tg.InputUserClass, userID int64) (*FullUserInfo, error) {
+	if info := ahm.getCachedFullUser(userID); info != nil {
+		ahm.metrics.AccessHashLookup("full_user", true)
+		return info, nil
+	}
+	ahm.metrics.AccessHashLookup("full_user", false)
+
+	full, err := ahm.api.UsersGetFullUser(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户%d的完整资料失败: %w", userID, err)
+	}
+	ahm.CacheUsersFromUpdate(full.Users)
+	ahm.CacheChatsFromUpdate(full.Chats)
+
+	info := &FullUserInfo{
+		ID:               userID,
+		About:            full.FullUser.About,
+		CommonChatsCount: full.FullUser.CommonChatsCount,
+		PhotoCount:       -1,
+		UpdatedAt:        time.Now(),
+	}
+	if photo, ok := full.FullUser.ProfilePhoto.(*tg.Photo); ok {
+		info.PhotoDCID = photo.DCID
+	}
+	if photos, err := ahm.api.PhotosGetUserPhotos(ctx, &tg.PhotosGetUserPhotosRequest{UserID: user, Limit: 1}); err == nil {
+		switch p := photos.(type) {
+		case *tg.PhotosPhotos:
+			info.PhotoCount = len(p.Photos)
+		case *tg.PhotosPhotosSlice:
+			info.PhotoCount = p.Count
+		}
+	} else {
+		logger.Debugf("获取用户%d的头像数量失败: %v", userID, err)
+	}
+
+	ahm.fullUsers.Set(userID, info)
+	if ahm.persistent {
+		if err := ahm.saveFullUserToDatabase(info); err != nil {
+			logger.Errorf("Failed to save full user %d to database: %v", userID, err)
+		}
+	}
+	return info, nil
+}
+
+func (ahm *AccessHashManager) getCachedFullUser(userID int64) *FullUserInfo {
+	info, exists := ahm.fullUsers.Get(userID)
+	if exists {
+		return info
+	}
+	if !ahm.persistent || ahm.db == nil {
+		return nil
+	}
+	return ahm.loadFullUserFromDatabase(userID)
+}
+
+// loadFullUserFromDatabase 从数据库读取未过期的完整用户资料
+func (ahm *AccessHashManager) loadFullUserFromDatabase(userID int64) *FullUserInfo {
+	var info FullUserInfo
+	var updatedAtStr string
+	err := ahm.db.QueryRow(`
+		SELECT user_id, about, common_chats, photo_count, photo_dc, updated_at
+		FROM full_user_cache WHERE user_id = ?
+	`, userID).Scan(&info.ID, &info.About, &info.CommonChatsCount, &info.PhotoCount, &info.PhotoDCID, &updatedAtStr)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Debugf("Failed to load full user %d from database: %v", userID, err)
+		}
+		return nil
+	}
+	t, err := parseUpdatedAt(updatedAtStr)
+	if err != nil || time.Since(t) > fullUserExpiry {
+		return nil
+	}
+	info.UpdatedAt = t
+	ahm.fullUsers.SetUntil(info.ID, &info, t.Add(fullUserExpiry))
+	return &info
+}
+
+func (ahm *AccessHashManager) initFullUserTable() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS full_user_cache (
+		user_id INTEGER PRIMARY KEY,
+		about TEXT NOT NULL DEFAULT '',
+		common_chats INTEGER NOT NULL DEFAULT 0,
+		photo_count INTEGER NOT NULL DEFAULT -1,
+		photo_dc INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+	_, err := ahm.db.Exec(createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create full_user_cache table: %w", err)
+	}
+	return nil
+}
+
+func (ahm *AccessHashManager) saveFullUserToDatabase(info *FullUserInfo) error {
+	if !ahm.persistent || ahm.db == nil {
+		return nil
+	}
+	_, err := storage.Exec(ahm.db, `
+		INSERT OR REPLACE INTO full_user_cache
+		(user_id, about, common_chats, photo_count, photo_dc, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, info.ID, info.About, info.CommonChatsCount, info.PhotoCount, info.PhotoDCID, info.UpdatedAt.Format("2006-01-02 15:04:05"))
+	return err
+}
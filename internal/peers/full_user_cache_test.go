@@ -0,0 +1,61 @@
+package peers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// fullUserInvoker 返回固定完整资料和头像列表的 tg.Invoker
+type fullUserInvoker struct {
+	photo    tg.PhotoClass
+	photos   int
+	requests int
+}
+
+func (f *fullUserInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	switch req := input.(type) {
+	case *tg.UsersGetFullUserRequest:
+		f.requests++
+		full := tg.UserFull{ID: req.ID.(*tg.InputUser).UserID, About: "about", CommonChatsCount: 2}
+		if f.photo != nil {
+			full.SetProfilePhoto(f.photo)
+		}
+		*output.(*tg.UsersUserFull) = tg.UsersUserFull{FullUser: full}
+	case *tg.PhotosGetUserPhotosRequest:
+		output.(*tg.PhotosPhotosBox).Photos = &tg.PhotosPhotosSlice{Count: f.photos}
+	default:
+		return errors.New("unexpected request")
+	}
+	return nil
+}
+
+func TestGetFullUserPhotoDC(t *testing.T) {
+	tests := []struct {
+		name  string
+		photo tg.PhotoClass
+		want  int
+	}{
+		{"photo", &tg.Photo{ID: 1, DCID: 4}, 4},
+		{"empty photo", &tg.PhotoEmpty{ID: 1}, 0},
+		{"no photo", nil, 0},
+	}
+	for _, tt := range tests {
+		inv := &fullUserInvoker{photo: tt.photo, photos: 3}
+		ahm := NewAccessHashManager(tg.NewClient(inv))
+		info, err := ahm.GetFullUser(context.Background(), &tg.InputUser{UserID: 42, AccessHash: 1}, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.PhotoDCID != tt.want || info.PhotoCount != 3 || info.CommonChatsCount != 2 {
+			t.Errorf("%s: info = %+v, want photo DC %d", tt.name, info, tt.want)
+		}
+		// 之后使用缓存
+		if _, err := ahm.GetFullUser(context.Background(), &tg.InputUser{UserID: 42, AccessHash: 1}, 42); err != nil || inv.requests != 1 {
+			t.Errorf("%s: users.getFullUser called %d times, want the cached result", tt.name, inv.requests)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package peers
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/cache"
+	"nexusvalet/pkg/logger"
+	"strconv"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// participantPageSize 每次 channels.getParticipants 请求的成员数，服务端上限为200
+	participantPageSize = 200
+	// defaultParticipantScanLimit 默认最多遍历的成员数
+	defaultParticipantScanLimit = 10000
+	// notMemberExpiry 在群组成员中找不到用户的结果缓存时间，避免重复遍历整个群组
+	notMemberExpiry = 5 * time.Minute
+)
+
+// memberKey 群组成员查找的缓存键
+type memberKey struct {
+	ChannelID int64
+	UserID    int64
+}
+
+// newNotMemberCache 创建找不到成员的结果缓存
+func newNotMemberCache() *cache.Cache[memberKey, struct{}] {
+	return cache.New[memberKey, struct{}]("not_member", cache.Options{TTL: notMemberExpiry, MaxEntries: 10000})
+}
+
+// SetParticipantScanLimit 设置搜索群组成员时最多遍历的成员数，n<=0时使用默认值
+func (ahm *AccessHashManager) SetParticipantScanLimit(n int) {
+	ahm.scanLimit = n
+}
+
+// searchUserInChannel 在群组成员中查找用户：先按用户ID搜索成员，找不到时按最近成员分页遍历，
+// 最多遍历 scanLimit 个成员。找不到的结果缓存 notMemberExpiry，期间直接返回错误
+func (ahm *AccessHashManager) searchUserInChannel(ctx context.Context, channelPeer tg.InputChannelClass, userID int64) (*tg.InputPeerUser, error) {
+	key := memberKey{ChannelID: inputChannelID(channelPeer), UserID: userID}
+	if _, cached := ahm.notMembers.Get(key); cached {
+		return nil, fmt.Errorf("最近已在频道成员中查找过用户%d，未找到", userID)
+	}
+
+	user, err := ahm.findParticipant(ctx, channelPeer, &tg.ChannelParticipantsSearch{Q: strconv.FormatInt(userID, 10)}, userID, participantPageSize)
+	if err == nil && user == nil {
+		user, err = ahm.findParticipant(ctx, channelPeer, &tg.ChannelParticipantsRecent{}, userID, ahm.participantScanLimit())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		ahm.notMembers.Set(key, struct{}{})
+		return nil, fmt.Errorf("在频道成员中未找到用户%d", userID)
+	}
+
+	ahm.cacheUser(user)
+	logger.Infof("通过搜索频道成员找到用户%d的access_hash: %d", userID, user.AccessHash)
+	return &tg.InputPeerUser{UserID: user.ID, AccessHash: user.AccessHash}, nil
+}
+
+// findParticipant 按filter分页获取成员，找到用户后立即返回，遍历完limit个成员或全部成员仍未找到时返回nil。
+// 途中返回的用户都写入内存缓存
+func (ahm *AccessHashManager) findParticipant(ctx context.Context, channelPeer tg.InputChannelClass, filter tg.ChannelParticipantsFilterClass, userID int64, limit int) (*tg.User, error) {
+	for offset := 0; offset < limit; {
+		result, err := ahm.api.ChannelsGetParticipants(ctx, &tg.ChannelsGetParticipantsRequest{
+			Channel: channelPeer,
+			Filter:  filter,
+			Offset:  offset,
+			Limit:   participantPageSize,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("获取频道参与者失败: %v", err)
+		}
+		page, ok := result.(*tg.ChannelsChannelParticipants)
+		if !ok {
+			return nil, fmt.Errorf("不支持的参与者类型")
+		}
+		ahm.CacheUsersFromUpdate(page.Users)
+		for _, u := range page.Users {
+			if user, ok := u.(*tg.User); ok && user.ID == userID {
+				return user, nil
+			}
+		}
+
+		offset += len(page.Participants)
+		if len(page.Participants) == 0 || offset >= page.Count {
+			break
+		}
+	}
+	return nil, nil
+}
+
+func (ahm *AccessHashManager) participantScanLimit() int {
+	if ahm.scanLimit > 0 {
+		return ahm.scanLimit
+	}
+	return defaultParticipantScanLimit
+}
+
+// inputChannelID 返回InputChannel中的频道ID，无法识别时返回0
+func inputChannelID(channel tg.InputChannelClass) int64 {
+	switch c := channel.(type) {
+	case *tg.InputChannel:
+		return c.ChannelID
+	case *tg.InputChannelFromMessage:
+		return c.ChannelID
+	}
+	return 0
+}
@@ -22,6 +22,16 @@ func NewResolver(provider AccessHashProvider) *Resolver {
 	return &Resolver{provider: provider}
 }
 
+// Manager 返回解析器使用的 AccessHashManager，插件通过它共享同一份用户/频道缓存。
+// 解析器为nil或提供者不是 AccessHashManager 时返回nil
+func (r *Resolver) Manager() *AccessHashManager {
+	if r == nil {
+		return nil
+	}
+	manager, _ := r.provider.(*AccessHashManager)
+	return manager
+}
+
 // ResolveFromChatID 根据 chatID 返回可用的 InputPeer。
 // 规则：chatID>0 用户；-x 普通群；-100... 为频道/超级群。
 func (r *Resolver) ResolveFromChatID(ctx context.Context, chatID int64) (tg.InputPeerClass, error) {
@@ -0,0 +1,41 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gotd/td/tg"
+)
+
+// isChatAdmin 检查当前账号是否为群组、超级群组或频道的创建者或管理员
+func isChatAdmin(ctx context.Context, api *tg.Client, peer tg.InputPeerClass) (bool, error) {
+	switch p := peer.(type) {
+	case *tg.InputPeerChannel:
+		participant, err := api.ChannelsGetParticipant(ctx, &tg.ChannelsGetParticipantRequest{
+			Channel:     &tg.InputChannel{ChannelID: p.ChannelID, AccessHash: p.AccessHash},
+			Participant: &tg.InputPeerSelf{},
+		})
+		if err != nil {
+			return false, err
+		}
+		switch participant.Participant.(type) {
+		case *tg.ChannelParticipantCreator, *tg.ChannelParticipantAdmin:
+			return true, nil
+		}
+		return false, nil
+	case *tg.InputPeerChat:
+		chats, err := api.MessagesGetChats(ctx, []int64{p.ChatID})
+		if err != nil {
+			return false, err
+		}
+		for _, c := range chats.GetChats() {
+			if chat, ok := c.(*tg.Chat); ok && chat.ID == p.ChatID {
+				_, hasRights := chat.GetAdminRights()
+				return chat.Creator || hasRights, nil
+			}
+		}
+		return false, fmt.Errorf("无法获取群组信息")
+	default:
+		return false, fmt.Errorf("不是群组或频道")
+	}
+}
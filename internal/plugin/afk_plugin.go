@@ -0,0 +1,421 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"nexusvalet/pkg/logger"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// afkReplyCooldown 同一对话中两次自动回复之间的最短间隔
+	afkReplyCooldown = time.Hour
+	// afkSummaryLimit 离开结束时汇总中最多列出的提及数
+	afkSummaryLimit = 30
+	// afkReplyPrefix 自动回复的开头，自己发出的以此开头的消息不结束离开状态
+	afkReplyPrefix = "💤 我从 "
+)
+
+// afkMention 离开期间收到的一次私聊或提及
+type afkMention struct {
+	ChatID    int64
+	UserID    int64
+	MessageID int
+	Text      string
+	Time      time.Time
+}
+
+// AFKPlugin 离开状态：离开期间自动回复私聊和提及自己的群消息，回来后汇总期间的提及
+type AFKPlugin struct {
+	*BasePlugin
+	db           *sql.DB
+	telegramAPI  *tg.Client
+	peerResolver *peers.Resolver
+	parser       *command.Parser
+
+	mutex    sync.Mutex
+	active   bool
+	since    time.Time
+	reason   string
+	cooldown map[int64]time.Time // 对话ID -> 上次自动回复时间
+	selfID   int64
+	username string // 自己的用户名，小写，没有时为空
+}
+
+// NewAFKPlugin 创建离开状态插件
+func NewAFKPlugin(db *sql.DB) *AFKPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "afk",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "离开状态，自动回复私聊和提及，回来后汇总期间的提及",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &AFKPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+		cooldown:   make(map[int64]time.Time),
+	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+	plugin.loadState()
+
+	return plugin
+}
+
+// initDatabase 初始化数据库表
+func (ap *AFKPlugin) initDatabase() {
+	createTablesSQL := `
+	CREATE TABLE IF NOT EXISTS afk_state (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		reason TEXT NOT NULL DEFAULT '',
+		since INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS afk_mentions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		text TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	);`
+
+	_, err := ap.db.Exec(createTablesSQL)
+	if err != nil {
+		logger.Errorf("Failed to create afk tables: %v", err)
+	}
+}
+
+// loadState 从数据库恢复离开状态
+func (ap *AFKPlugin) loadState() {
+	var since int64
+	err := ap.db.QueryRow("SELECT reason, since FROM afk_state WHERE id = 1").Scan(&ap.reason, &since)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		logger.Errorf("Failed to load afk state: %v", err)
+		return
+	}
+	ap.active = true
+	ap.since = time.Unix(since, 0)
+}
+
+// SetTelegramClient 设置Telegram客户端和Peer解析器
+func (ap *AFKPlugin) SetTelegramClient(client *tg.Client, peerResolver *peers.Resolver) {
+	ap.telegramAPI = client
+	ap.peerResolver = peerResolver
+}
+
+// InitializeAfterConnect 实现PostConnectPlugin接口，获取自己的用户ID和用户名用于识别提及
+func (ap *AFKPlugin) InitializeAfterConnect(ctx context.Context) error {
+	if ap.telegramAPI == nil {
+		return fmt.Errorf("telegram client not available")
+	}
+	users, err := ap.telegramAPI.UsersGetUsers(ctx, []tg.InputUserClass{&tg.InputUserSelf{}})
+	if err != nil {
+		return fmt.Errorf("failed to get self user: %w", err)
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("failed to get self user: empty response")
+	}
+	self, ok := users[0].(*tg.User)
+	if !ok {
+		return fmt.Errorf("failed to get self user: unexpected type %T", users[0])
+	}
+
+	ap.mutex.Lock()
+	ap.selfID = self.ID
+	ap.username = strings.ToLower(self.Username)
+	ap.mutex.Unlock()
+	return nil
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (ap *AFKPlugin) RegisterCommands(parser *command.Parser) error {
+	ap.parser = parser
+	parser.RegisterCommand("afk", "进入离开状态，自动回复私聊和提及：[原因]", ap.info.Name, ap.handleAFK)
+	parser.RegisterCommand("unafk", "结束离开状态并汇总期间的私聊和提及", ap.info.Name, ap.handleUnAFK)
+	logger.Infof("AFK commands registered successfully")
+	return nil
+}
+
+// RegisterEventHandlers 实现EventPlugin接口，收到的消息用于自动回复，自己发出的消息结束离开状态
+func (ap *AFKPlugin) RegisterEventHandlers(dispatcher *core.EventDispatcher) error {
+	if err := dispatcher.RegisterMessageListenerWithFilter("afk_incoming", "", ap.handleIncoming, 50, core.ListenerFilter{Incoming: true}); err != nil {
+		return err
+	}
+	return dispatcher.RegisterMessageListenerWithFilter("afk_outgoing", "", ap.handleOutgoing, 50, core.ListenerFilter{Outgoing: true})
+}
+
+// handleAFK 处理afk命令，已处于离开状态时更新原因，保留开始时间和已记录的提及
+func (ap *AFKPlugin) handleAFK(ctx *command.CommandContext) error {
+	reason := ctx.ArgsString()
+
+	ap.mutex.Lock()
+	since := ap.since
+	if !ap.active {
+		since = time.Now()
+	}
+	_, err := ap.db.Exec("INSERT OR REPLACE INTO afk_state (id, reason, since) VALUES (1, ?, ?)", reason, since.Unix())
+	if err == nil && !ap.active {
+		if _, err := ap.db.Exec("DELETE FROM afk_mentions"); err != nil {
+			logger.Ctx(ctx.Context).Warnf("Failed to clear afk mentions: %v", err)
+		}
+		ap.cooldown = make(map[int64]time.Time)
+	}
+	if err == nil {
+		ap.active, ap.since, ap.reason = true, since, reason
+	}
+	ap.mutex.Unlock()
+	if err != nil {
+		return ap.sendResponse(ctx, fmt.Sprintf("❌ 保存离开状态失败: %v", err))
+	}
+
+	message := "💤 已进入离开状态"
+	if reason != "" {
+		message += "\n\n原因: " + reason
+	}
+	return ap.sendResponse(ctx, message+"\n\n私聊和提及我的消息将自动回复（每个对话每小时一次），发送任意消息或 .unafk 结束")
+}
+
+// handleUnAFK 处理unafk命令
+func (ap *AFKPlugin) handleUnAFK(ctx *command.CommandContext) error {
+	summary, ok, err := ap.leave()
+	if err != nil {
+		return ap.sendResponse(ctx, fmt.Sprintf("❌ 结束离开状态失败: %v", err))
+	}
+	if !ok {
+		return ap.sendResponse(ctx, "当前不在离开状态")
+	}
+	_, err = ctx.Respond(summary, format.HTML)
+	return err
+}
+
+// handleIncoming 离开期间收到私聊或提及自己的群消息时记录并自动回复
+func (ap *AFKPlugin) handleIncoming(ctx context.Context, event interface{}) error {
+	msgEvent, ok := event.(*core.MessageEvent)
+	if !ok || msgEvent.Message == nil || msgEvent.UserID == 0 {
+		return nil
+	}
+
+	ap.mutex.Lock()
+	active, since, reason := ap.active, ap.since, ap.reason
+	selfID, username := ap.selfID, ap.username
+	ap.mutex.Unlock()
+	if !active || msgEvent.UserID == selfID {
+		return nil
+	}
+	if msgEvent.ChatID < 0 && !afkMentioned(msgEvent.Message, selfID, username) {
+		return nil
+	}
+
+	if _, err := ap.db.Exec("INSERT INTO afk_mentions (chat_id, user_id, message_id, text, created_at) VALUES (?, ?, ?, ?, ?)",
+		msgEvent.ChatID, msgEvent.UserID, msgEvent.Message.ID, msgEvent.Text, time.Now().Unix()); err != nil {
+		logger.Ctx(ctx).Warnf("Failed to record afk mention: %v", err)
+	}
+
+	ap.mutex.Lock()
+	if last, ok := ap.cooldown[msgEvent.ChatID]; ok && time.Since(last) < afkReplyCooldown {
+		ap.mutex.Unlock()
+		return nil
+	}
+	ap.cooldown[msgEvent.ChatID] = time.Now()
+	ap.mutex.Unlock()
+
+	if err := ap.send(ctx, msgEvent.ChatID, msgEvent.Message.ID, afkReplyText(since, reason)); err != nil {
+		return fmt.Errorf("failed to send afk reply: %w", err)
+	}
+	return nil
+}
+
+// handleOutgoing 离开期间自己发出普通消息(不是命令，也不是自动回复)时结束离开状态，汇总发到收藏夹
+func (ap *AFKPlugin) handleOutgoing(ctx context.Context, event interface{}) error {
+	msgEvent, ok := event.(*core.MessageEvent)
+	if !ok || msgEvent.Message == nil {
+		return nil
+	}
+	if strings.HasPrefix(msgEvent.Text, afkReplyPrefix) || (ap.parser != nil && ap.parser.IsCommand(msgEvent.Text)) {
+		return nil
+	}
+
+	summary, ok, err := ap.leave()
+	if err != nil || !ok {
+		return err
+	}
+	logger.Ctx(ctx).Infof("AFK ended by outgoing message in chat %d", msgEvent.ChatID)
+	if ap.telegramAPI == nil {
+		return nil
+	}
+
+	plain, entities := format.Parse(format.HTML, summary)
+	request := &tg.MessagesSendMessageRequest{
+		Peer:     &tg.InputPeerSelf{},
+		Message:  plain,
+		RandomID: time.Now().UnixNano(),
+	}
+	if len(entities) > 0 {
+		request.SetEntities(entities)
+	}
+	_, err = flood.Call(ctx, ap.floodLimiter(), ap.selfID, func() (tg.UpdatesClass, error) {
+		return ap.telegramAPI.MessagesSendMessage(ctx, request)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send afk summary: %w", err)
+	}
+	return nil
+}
+
+// leave 结束离开状态并清除记录，返回期间提及的汇总。不在离开状态时ok为false
+func (ap *AFKPlugin) leave() (summary string, ok bool, err error) {
+	ap.mutex.Lock()
+	defer ap.mutex.Unlock()
+	if !ap.active {
+		return "", false, nil
+	}
+
+	mentions, err := ap.loadMentions()
+	if err != nil {
+		return "", false, fmt.Errorf("读取提及记录失败: %w", err)
+	}
+	if _, err := ap.db.Exec("DELETE FROM afk_state"); err != nil {
+		return "", false, fmt.Errorf("保存离开状态失败: %w", err)
+	}
+	if _, err := ap.db.Exec("DELETE FROM afk_mentions"); err != nil {
+		logger.Warnf("Failed to clear afk mentions: %v", err)
+	}
+
+	since := ap.since
+	ap.active, ap.reason = false, ""
+	ap.cooldown = make(map[int64]time.Time)
+	return afkSummary(since, mentions), true, nil
+}
+
+// loadMentions 按时间顺序读取离开期间的提及
+func (ap *AFKPlugin) loadMentions() ([]afkMention, error) {
+	rows, err := ap.db.Query("SELECT chat_id, user_id, message_id, text, created_at FROM afk_mentions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mentions []afkMention
+	for rows.Next() {
+		var m afkMention
+		var created int64
+		if err := rows.Scan(&m.ChatID, &m.UserID, &m.MessageID, &m.Text, &created); err != nil {
+			return nil, err
+		}
+		m.Time = time.Unix(created, 0)
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
+
+// send 在对话中回复消息
+func (ap *AFKPlugin) send(ctx context.Context, chatID int64, replyTo int, message string) error {
+	if ap.telegramAPI == nil || ap.peerResolver == nil {
+		return fmt.Errorf("telegram client not available")
+	}
+	peer, err := ap.peerResolver.ResolveFromChatID(ctx, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+
+	_, err = flood.Call(ctx, ap.floodLimiter(), chatID, func() (tg.UpdatesClass, error) {
+		return ap.telegramAPI.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+			Peer:     peer,
+			Message:  message,
+			ReplyTo:  &tg.InputReplyToMessage{ReplyToMsgID: replyTo},
+			RandomID: time.Now().UnixNano(),
+		})
+	})
+	return err
+}
+
+// floodLimiter 返回全局的请求频率限制器
+func (ap *AFKPlugin) floodLimiter() *flood.Limiter {
+	if goManager, ok := ap.manager.(*GoManager); ok {
+		return goManager.GetFloodLimiter()
+	}
+	return nil
+}
+
+// afkMentioned 判断群消息是否提及自己：回复自己的消息(Telegram标记为mentioned)、
+// 文字提及自己的用户ID，或 @用户名
+func afkMentioned(msg *tg.Message, selfID int64, username string) bool {
+	if msg.Mentioned {
+		return true
+	}
+	for _, entity := range msg.Entities {
+		switch e := entity.(type) {
+		case *tg.MessageEntityMentionName:
+			if selfID != 0 && e.UserID == selfID {
+				return true
+			}
+		case *tg.MessageEntityMention:
+			if username != "" && strings.EqualFold(utf16Slice(msg.Message, e.Offset, e.Length), "@"+username) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// afkReplyText 自动回复的内容
+func afkReplyText(since time.Time, reason string) string {
+	message := fmt.Sprintf(afkReplyPrefix+"%s 起暂时离开（%s前）", since.Format("2006-01-02 15:04"), formatTTL(time.Since(since).Round(time.Minute)))
+	if reason != "" {
+		return message + "\n原因: " + reason
+	}
+	return message + "，稍后回复"
+}
+
+// afkSummary 离开期间提及的汇总，HTML格式
+func afkSummary(since time.Time, mentions []afkMention) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("👋 离开状态已结束，共离开 %s", formatTTL(time.Since(since).Round(time.Minute))))
+	if len(mentions) == 0 {
+		b.WriteString("\n\n期间没有人私聊或提及你")
+		return b.String()
+	}
+
+	b.WriteString(fmt.Sprintf("\n\n期间收到 %d 条私聊或提及:\n", len(mentions)))
+	for i, m := range mentions {
+		if i == afkSummaryLimit {
+			b.WriteString(fmt.Sprintf("\n… 还有 %d 条", len(mentions)-afkSummaryLimit))
+			break
+		}
+		where := "私聊"
+		if m.ChatID < 0 {
+			where = fmt.Sprintf("群组 <code>%d</code>", m.ChatID)
+			if channelID := -m.ChatID - 1000000000000; channelID > 0 {
+				where = fmt.Sprintf(`<a href="https://t.me/c/%d/%d">群组 %d</a>`, channelID, m.MessageID, m.ChatID)
+			}
+		}
+		b.WriteString(fmt.Sprintf("\n%s <a href=\"tg://user?id=%d\">%d</a> 在%s: %s",
+			m.Time.Format("01-02 15:04"), m.UserID, m.UserID, where, format.EscapeHTML(tplPreview(m.Text))))
+	}
+	return b.String()
+}
+
+// sendResponse 发送响应消息
+func (ap *AFKPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,579 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/capability"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"nexusvalet/internal/storage"
+	"nexusvalet/pkg/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// antifloodDefaultMute 触发刷屏保护时默认的禁言时长
+	antifloodDefaultMute = 10 * time.Minute
+	// antifloodMaxMessages 窗口内允许设置的最大消息数
+	antifloodMaxMessages = 100
+	// antifloodMaxWindow 允许设置的最长窗口
+	antifloodMaxWindow = time.Hour
+	// antifloodAdminTTL 群组管理员列表的缓存时间
+	antifloodAdminTTL = 10 * time.Minute
+	// antifloodLogLimit .antiflood status 显示的最近记录数
+	antifloodLogLimit = 5
+)
+
+// floodRing 用户在窗口内最近N条消息的时间，写满后覆盖最早的一条
+type floodRing struct {
+	times []time.Time
+	next  int
+	count int
+}
+
+// add 记录一条消息，返回加入前最近N条消息中最早的一条是否仍在窗口内，即加入后窗口内超过N条
+func (r *floodRing) add(now time.Time, window time.Duration) bool {
+	exceeded := r.count == len(r.times) && now.Sub(r.times[r.next]) < window
+	r.times[r.next] = now
+	r.next = (r.next + 1) % len(r.times)
+	if r.count < len(r.times) {
+		r.count++
+	}
+	return exceeded
+}
+
+// last 返回最近一条消息的时间
+func (r *floodRing) last() time.Time {
+	return r.times[(r.next+len(r.times)-1)%len(r.times)]
+}
+
+// floodChat 一个开启刷屏保护的群组的设置和计数状态
+type floodChat struct {
+	maxMessages int
+	window      time.Duration
+	mute        time.Duration
+	whitelist   map[int64]bool
+	users       map[int64]*floodRing
+	admins      map[int64]bool
+	adminsAt    time.Time
+	lastPrune   time.Time
+}
+
+// AntifloodPlugin 刷屏保护：群组中用户在窗口内发送的消息超过上限时临时禁言
+type AntifloodPlugin struct {
+	*BasePlugin
+	db           *sql.DB
+	telegramAPI  *tg.Client
+	peerResolver *peers.Resolver
+	chats        map[int64]*floodChat // chat_id -> 刷屏保护状态
+	mutex        sync.Mutex
+}
+
+// NewAntifloodPlugin 创建刷屏保护插件
+func NewAntifloodPlugin(db *sql.DB) *AntifloodPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "antiflood",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "群组中刷屏的用户自动临时禁言",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &AntifloodPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+		chats:      make(map[int64]*floodChat),
+	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+	plugin.loadChats()
+
+	return plugin
+}
+
+// initDatabase 初始化数据库表
+func (ap *AntifloodPlugin) initDatabase() {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS antiflood_chats (
+		chat_id INTEGER PRIMARY KEY,
+		max_messages INTEGER NOT NULL,
+		window_seconds INTEGER NOT NULL,
+		mute_seconds INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS antiflood_whitelist (
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		PRIMARY KEY (chat_id, user_id)
+	);
+	CREATE TABLE IF NOT EXISTS antiflood_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		messages INTEGER NOT NULL,
+		muted_until INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_antiflood_log_chat ON antiflood_log(chat_id, created_at);`
+
+	_, err := ap.db.Exec(createTableSQL)
+	if err != nil {
+		logger.Errorf("Failed to create antiflood tables: %v", err)
+	}
+}
+
+// loadChats 从数据库读取开启刷屏保护的群组和白名单
+func (ap *AntifloodPlugin) loadChats() {
+	rows, err := ap.db.Query("SELECT chat_id, max_messages, window_seconds, mute_seconds FROM antiflood_chats")
+	if err != nil {
+		logger.Errorf("Failed to load antiflood chats: %v", err)
+		return
+	}
+	chats := make(map[int64]*floodChat)
+	for rows.Next() {
+		var chatID, window, mute int64
+		var maxMessages int
+		if err := rows.Scan(&chatID, &maxMessages, &window, &mute); err != nil {
+			logger.Errorf("Failed to scan antiflood chat: %v", err)
+			continue
+		}
+		chats[chatID] = newFloodChat(maxMessages, time.Duration(window)*time.Second, time.Duration(mute)*time.Second)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Errorf("Failed to load antiflood chats: %v", err)
+	}
+	rows.Close()
+
+	rows, err = ap.db.Query("SELECT chat_id, user_id FROM antiflood_whitelist")
+	if err != nil {
+		logger.Errorf("Failed to load antiflood whitelist: %v", err)
+	} else {
+		for rows.Next() {
+			var chatID, userID int64
+			if err := rows.Scan(&chatID, &userID); err != nil {
+				logger.Errorf("Failed to scan antiflood whitelist entry: %v", err)
+				continue
+			}
+			if chat, ok := chats[chatID]; ok {
+				chat.whitelist[userID] = true
+			}
+		}
+		rows.Close()
+	}
+
+	ap.mutex.Lock()
+	ap.chats = chats
+	ap.mutex.Unlock()
+	if len(chats) > 0 {
+		logger.Infof("Loaded %d antiflood chats", len(chats))
+	}
+}
+
+// newFloodChat 创建群组的刷屏保护状态
+func newFloodChat(maxMessages int, window, mute time.Duration) *floodChat {
+	return &floodChat{
+		maxMessages: maxMessages,
+		window:      window,
+		mute:        mute,
+		whitelist:   make(map[int64]bool),
+		users:       make(map[int64]*floodRing),
+	}
+}
+
+// SetTelegramClient 设置Telegram客户端和Peer解析器
+func (ap *AntifloodPlugin) SetTelegramClient(client *tg.Client, peerResolver *peers.Resolver) {
+	ap.telegramAPI = client
+	ap.peerResolver = peerResolver
+}
+
+// Capabilities 实现CapabilityPlugin接口，声明禁言和获取管理员列表所需的接口
+func (ap *AntifloodPlugin) Capabilities() []capability.Requirement {
+	return []capability.Requirement{
+		capability.Require((*tg.Client)(nil), "ChannelsGetParticipant", "ChannelsGetParticipants", "ChannelsEditBanned"),
+		capability.Require(tg.ChannelsEditBannedRequest{}, "Channel", "Participant", "BannedRights"),
+		capability.Require(tg.ChatBannedRights{}, "SendMessages", "UntilDate"),
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (ap *AntifloodPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("antiflood", "刷屏保护：on <条数> <秒数> [禁言时长] | off | status | allow | unallow", ap.info.Name, ap.handleAntiflood)
+	logger.Infof("Antiflood commands registered successfully")
+	return nil
+}
+
+// RegisterEventHandlers 实现EventPlugin接口，监听群组中收到的消息
+func (ap *AntifloodPlugin) RegisterEventHandlers(dispatcher *core.EventDispatcher) error {
+	return dispatcher.RegisterMessageListenerWithFilter("antiflood_count", "", ap.handleIncoming, 60, core.ListenerFilter{Incoming: true, GroupsOnly: true})
+}
+
+// handleAntiflood 处理antiflood命令
+func (ap *AntifloodPlugin) handleAntiflood(ctx *command.CommandContext) error {
+	if len(ctx.Args) == 0 {
+		return ap.sendResponse(ctx, ap.helpText())
+	}
+
+	switch ctx.Args[0] {
+	case "on":
+		return ap.handleOn(ctx)
+	case "off":
+		return ap.handleOff(ctx)
+	case "status":
+		return ap.handleStatus(ctx)
+	case "allow":
+		return ap.handleWhitelist(ctx, true)
+	case "unallow":
+		return ap.handleWhitelist(ctx, false)
+	}
+	return ap.sendResponse(ctx, ap.helpText())
+}
+
+// checkAdminPermission 检查当前账号是否为超级群组的管理员，禁言只支持超级群组
+func (ap *AntifloodPlugin) checkAdminPermission(ctx *command.CommandContext) (bool, error) {
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := peer.(*tg.InputPeerChannel); !ok {
+		return false, fmt.Errorf("不是超级群组")
+	}
+	return isChatAdmin(ctx.Context, ctx.API, peer)
+}
+
+// handleOn 开启刷屏保护，已开启时更新设置并清空计数
+func (ap *AntifloodPlugin) handleOn(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 3 {
+		return ap.sendResponse(ctx, "用法: .antiflood on <条数> <秒数> [禁言时长]\n例如: .antiflood on 5 10 30m")
+	}
+	maxMessages, err := strconv.Atoi(ctx.Args[1])
+	if err != nil || maxMessages < 2 || maxMessages > antifloodMaxMessages {
+		return ap.sendResponse(ctx, fmt.Sprintf("❌ 无效的条数: %s，应在 2 到 %d 之间", ctx.Args[1], antifloodMaxMessages))
+	}
+	seconds, err := strconv.Atoi(ctx.Args[2])
+	window := time.Duration(seconds) * time.Second
+	if err != nil || window < time.Second || window > antifloodMaxWindow {
+		return ap.sendResponse(ctx, fmt.Sprintf("❌ 无效的秒数: %s，应在 1 到 %d 之间", ctx.Args[2], int(antifloodMaxWindow.Seconds())))
+	}
+	mute := antifloodDefaultMute
+	if len(ctx.Args) > 3 {
+		// Telegram 把少于30秒或多于366天的限制视为永久，这里限制在该范围内
+		mute, err = parseWindowDuration(ctx.Args[3])
+		if err != nil || mute < time.Minute || mute > 366*24*time.Hour {
+			return ap.sendResponse(ctx, fmt.Sprintf("❌ 无效的禁言时长: %s，应在 1m 到 366d 之间", ctx.Args[3]))
+		}
+	}
+
+	hasPermission, err := ap.checkAdminPermission(ctx)
+	if err != nil {
+		return ap.sendResponse(ctx, fmt.Sprintf("❌ 权限检查失败\n\n⚠️ 错误信息: %v", err))
+	}
+	if !hasPermission {
+		return ap.sendResponse(ctx, "❌ 权限不足\n\n🔒 您需要管理员权限才能开启刷屏保护")
+	}
+
+	chatID := ctx.Message.ChatID
+	_, err = storage.Exec(ap.db, `INSERT INTO antiflood_chats (chat_id, max_messages, window_seconds, mute_seconds, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(chat_id) DO UPDATE SET max_messages = excluded.max_messages, window_seconds = excluded.window_seconds, mute_seconds = excluded.mute_seconds`,
+		chatID, maxMessages, int64(window/time.Second), int64(mute/time.Second), time.Now().Unix())
+	if err != nil {
+		return ap.sendResponse(ctx, fmt.Sprintf("❌ 开启刷屏保护失败: %v", err))
+	}
+
+	chat := newFloodChat(maxMessages, window, mute)
+	ap.mutex.Lock()
+	if old, ok := ap.chats[chatID]; ok {
+		chat.whitelist = old.whitelist
+	}
+	ap.chats[chatID] = chat
+	ap.mutex.Unlock()
+
+	return ap.sendResponse(ctx, fmt.Sprintf("🛡️ 已开启刷屏保护\n\n%d 秒内发送超过 %d 条消息的用户将被禁言 %s，管理员和白名单用户除外",
+		seconds, maxMessages, formatTTL(mute)))
+}
+
+// handleOff 关闭刷屏保护并清除群组的计数状态，白名单保留
+func (ap *AntifloodPlugin) handleOff(ctx *command.CommandContext) error {
+	chatID := ctx.Message.ChatID
+	result, err := storage.Exec(ap.db, "DELETE FROM antiflood_chats WHERE chat_id = ?", chatID)
+	if err != nil {
+		return ap.sendResponse(ctx, fmt.Sprintf("❌ 关闭刷屏保护失败: %v", err))
+	}
+
+	ap.mutex.Lock()
+	_, wasOn := ap.chats[chatID]
+	delete(ap.chats, chatID)
+	ap.mutex.Unlock()
+
+	if n, _ := result.RowsAffected(); n == 0 && !wasOn {
+		return ap.sendResponse(ctx, "此群组未开启刷屏保护")
+	}
+	return ap.sendResponse(ctx, "✅ 已关闭刷屏保护")
+}
+
+// handleStatus 显示群组的刷屏保护设置和最近的禁言记录
+func (ap *AntifloodPlugin) handleStatus(ctx *command.CommandContext) error {
+	chatID := ctx.Message.ChatID
+	ap.mutex.Lock()
+	chat, ok := ap.chats[chatID]
+	var b strings.Builder
+	if ok {
+		b.WriteString(fmt.Sprintf("🛡️ 刷屏保护: 已开启\n\n上限: %d 秒内 %d 条\n禁言时长: %s\n白名单用户: %d\n正在计数的用户: %d",
+			int(chat.window.Seconds()), chat.maxMessages, formatTTL(chat.mute), len(chat.whitelist), len(chat.users)))
+	}
+	ap.mutex.Unlock()
+	if !ok {
+		return ap.sendResponse(ctx, "刷屏保护: 未开启")
+	}
+
+	rows, err := ap.db.Query("SELECT user_id, messages, muted_until, created_at FROM antiflood_log WHERE chat_id = ? ORDER BY created_at DESC, id DESC LIMIT ?",
+		chatID, antifloodLogLimit)
+	if err != nil {
+		return ap.sendResponse(ctx, fmt.Sprintf("❌ 读取禁言记录失败: %v", err))
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var uid, mutedUntil, createdAt int64
+		var messages int
+		if err := rows.Scan(&uid, &messages, &mutedUntil, &createdAt); err != nil {
+			return ap.sendResponse(ctx, fmt.Sprintf("❌ 读取禁言记录失败: %v", err))
+		}
+		if count == 0 {
+			b.WriteString("\n\n最近的禁言:")
+		}
+		b.WriteString(fmt.Sprintf("\n• %s 用户 %d 发送 %d 条，禁言至 %s",
+			time.Unix(createdAt, 0).Format("01-02 15:04"), uid, messages, time.Unix(mutedUntil, 0).Format("01-02 15:04")))
+		count++
+	}
+	return ap.sendResponse(ctx, b.String())
+}
+
+// handleWhitelist 把回复的消息的发送者或指定的用户ID加入或移出白名单
+func (ap *AntifloodPlugin) handleWhitelist(ctx *command.CommandContext, allow bool) error {
+	chatID := ctx.Message.ChatID
+	var uid int64
+	if len(ctx.Args) > 1 {
+		id, err := strconv.ParseInt(ctx.Args[1], 10, 64)
+		if err != nil || id <= 0 {
+			return ap.sendResponse(ctx, "❌ 无效的用户ID")
+		}
+		uid = id
+	} else if reply, err := fetchReplyMessage(ctx); err == nil {
+		if from, ok := reply.FromID.(*tg.PeerUser); ok {
+			uid = from.UserID
+		}
+	}
+	if uid == 0 {
+		return ap.sendResponse(ctx, fmt.Sprintf("用法: 回复一条消息发送 .antiflood %s，或 .antiflood %s <用户ID>", ctx.Args[0], ctx.Args[0]))
+	}
+
+	var err error
+	if allow {
+		_, err = storage.Exec(ap.db, "INSERT OR IGNORE INTO antiflood_whitelist (chat_id, user_id) VALUES (?, ?)", chatID, uid)
+	} else {
+		_, err = storage.Exec(ap.db, "DELETE FROM antiflood_whitelist WHERE chat_id = ? AND user_id = ?", chatID, uid)
+	}
+	if err != nil {
+		return ap.sendResponse(ctx, fmt.Sprintf("❌ 更新白名单失败: %v", err))
+	}
+
+	ap.mutex.Lock()
+	if chat, ok := ap.chats[chatID]; ok {
+		if allow {
+			chat.whitelist[uid] = true
+			delete(chat.users, uid)
+		} else {
+			delete(chat.whitelist, uid)
+		}
+	}
+	ap.mutex.Unlock()
+
+	if allow {
+		return ap.sendResponse(ctx, fmt.Sprintf("✅ 已将用户 %d 加入刷屏保护白名单", uid))
+	}
+	return ap.sendResponse(ctx, fmt.Sprintf("✅ 已将用户 %d 移出刷屏保护白名单", uid))
+}
+
+// handleIncoming 统计开启刷屏保护的群组中每个用户的消息，超过上限时禁言
+func (ap *AntifloodPlugin) handleIncoming(ctx context.Context, event interface{}) error {
+	msgEvent, ok := event.(*core.MessageEvent)
+	if !ok || msgEvent.Message == nil || msgEvent.UserID == 0 || ap.telegramAPI == nil || ap.peerResolver == nil {
+		return nil
+	}
+
+	chatID, uid := msgEvent.ChatID, msgEvent.UserID
+	now := time.Now()
+
+	ap.mutex.Lock()
+	chat, enabled := ap.chats[chatID]
+	if !enabled || chat.whitelist[uid] {
+		ap.mutex.Unlock()
+		return nil
+	}
+	chat.prune(now)
+	ring, ok := chat.users[uid]
+	if !ok {
+		ring = &floodRing{times: make([]time.Time, chat.maxMessages)}
+		chat.users[uid] = ring
+	}
+	exceeded := ring.add(now, chat.window)
+	if exceeded {
+		// 重新开始计数，避免禁言生效前到达的消息重复触发
+		delete(chat.users, uid)
+	}
+	ap.mutex.Unlock()
+	if !exceeded {
+		return nil
+	}
+
+	return ap.mute(ctx, chatID, uid, msgEvent.Message.ID, chat)
+}
+
+// prune 删除窗口内没有消息的用户，每个窗口最多清理一次
+func (fc *floodChat) prune(now time.Time) {
+	if now.Sub(fc.lastPrune) < fc.window {
+		return
+	}
+	fc.lastPrune = now
+	for uid, ring := range fc.users {
+		if now.Sub(ring.last()) >= fc.window {
+			delete(fc.users, uid)
+		}
+	}
+}
+
+// mute 临时禁止用户在群组中发言，发送通知并记录
+func (ap *AntifloodPlugin) mute(ctx context.Context, chatID, uid int64, msgID int, chat *floodChat) error {
+	peer, err := ap.peerResolver.ResolveFromChatID(ctx, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+	channelPeer, ok := peer.(*tg.InputPeerChannel)
+	if !ok {
+		return nil
+	}
+	channel := &tg.InputChannel{ChannelID: channelPeer.ChannelID, AccessHash: channelPeer.AccessHash}
+
+	isAdmin, err := ap.isAdmin(ctx, chatID, channel, uid)
+	if err != nil {
+		return fmt.Errorf("failed to check admins of chat %d: %w", chatID, err)
+	}
+	if isAdmin {
+		return nil
+	}
+
+	userPeer, err := ap.peerResolver.ResolveUserFromMessage(ctx, peer, msgID, uid)
+	if err != nil {
+		return fmt.Errorf("failed to resolve user %d: %w", uid, err)
+	}
+	until := time.Now().Add(chat.mute)
+	_, err = ap.telegramAPI.ChannelsEditBanned(ctx, &tg.ChannelsEditBannedRequest{
+		Channel:      channel,
+		Participant:  userPeer,
+		BannedRights: tg.ChatBannedRights{SendMessages: true, UntilDate: int(until.Unix())},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mute user %d in chat %d: %w", uid, chatID, err)
+	}
+	logger.Ctx(ctx).Infof("Antiflood muted user %d in chat %d until %s", uid, chatID, until.Format(time.RFC3339))
+
+	if _, err := storage.Exec(ap.db, "INSERT INTO antiflood_log (chat_id, user_id, messages, muted_until, created_at) VALUES (?, ?, ?, ?, ?)",
+		chatID, uid, chat.maxMessages+1, until.Unix(), time.Now().Unix()); err != nil {
+		logger.Ctx(ctx).Errorf("Failed to record antiflood action: %v", err)
+	}
+
+	var limiter *flood.Limiter
+	if goManager, ok := ap.manager.(*GoManager); ok {
+		limiter = goManager.GetFloodLimiter()
+	}
+	notice := fmt.Sprintf("🛡️ 用户 %d 在 %d 秒内发送了超过 %d 条消息，已禁言 %s",
+		uid, int(chat.window.Seconds()), chat.maxMessages, formatTTL(chat.mute))
+	_, err = flood.Call(ctx, limiter, chatID, func() (tg.UpdatesClass, error) {
+		return ap.telegramAPI.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+			Peer:     peer,
+			Message:  notice,
+			ReplyTo:  &tg.InputReplyToMessage{ReplyToMsgID: msgID},
+			RandomID: time.Now().UnixNano(),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send antiflood notice: %w", err)
+	}
+	return nil
+}
+
+// isAdmin 检查用户是否为群组的管理员，管理员列表缓存 antifloodAdminTTL
+func (ap *AntifloodPlugin) isAdmin(ctx context.Context, chatID int64, channel *tg.InputChannel, uid int64) (bool, error) {
+	ap.mutex.Lock()
+	chat, ok := ap.chats[chatID]
+	if ok && chat.admins != nil && time.Since(chat.adminsAt) < antifloodAdminTTL {
+		isAdmin := chat.admins[uid]
+		ap.mutex.Unlock()
+		return isAdmin, nil
+	}
+	ap.mutex.Unlock()
+
+	result, err := ap.telegramAPI.ChannelsGetParticipants(ctx, &tg.ChannelsGetParticipantsRequest{
+		Channel: channel,
+		Filter:  &tg.ChannelParticipantsAdmins{},
+		Limit:   200,
+	})
+	if err != nil {
+		return false, err
+	}
+	participants, ok := result.(*tg.ChannelsChannelParticipants)
+	if !ok {
+		return false, fmt.Errorf("unexpected participants response %T", result)
+	}
+	admins := make(map[int64]bool)
+	for _, p := range participants.Participants {
+		switch a := p.(type) {
+		case *tg.ChannelParticipantCreator:
+			admins[a.UserID] = true
+		case *tg.ChannelParticipantAdmin:
+			admins[a.UserID] = true
+		}
+	}
+
+	ap.mutex.Lock()
+	if chat, ok := ap.chats[chatID]; ok {
+		chat.admins = admins
+		chat.adminsAt = time.Now()
+	}
+	ap.mutex.Unlock()
+	return admins[uid], nil
+}
+
+// helpText 返回帮助信息
+func (ap *AntifloodPlugin) helpText() string {
+	return fmt.Sprintf(`🛡️ 刷屏保护
+
+• .antiflood on <条数> <秒数> [禁言时长] - 在当前超级群组开启，秒数内发送超过条数的用户被禁言，默认禁言 %s
+• .antiflood off - 关闭并清除计数
+• .antiflood status - 查看设置和最近的禁言记录
+• .antiflood allow [用户ID] - 把回复的消息的发送者或指定用户加入白名单
+• .antiflood unallow [用户ID] - 移出白名单
+
+需要当前账号是群组管理员，群组管理员和白名单用户不计数。
+示例: .antiflood on 5 10 30m`, formatTTL(antifloodDefaultMute))
+}
+
+// sendResponse 发送响应消息
+func (ap *AntifloodPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,214 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/marketplace"
+	"nexusvalet/internal/version"
+	"strings"
+	"time"
+)
+
+// marketplaceStore 获取已配置的插件索引
+func (ap *APTPlugin) marketplaceStore() (*marketplace.Store, string, error) {
+	goManager, ok := ap.manager.(*GoManager)
+	if !ok {
+		return nil, "", fmt.Errorf("Unsupported plugin manager type")
+	}
+	store, dir := goManager.GetMarketplace()
+	if store == nil || !store.Configured() {
+		return nil, "", fmt.Errorf("No plugin index configured (set apt.indexes and apt.public_keys in config.json)")
+	}
+	return store, dir, nil
+}
+
+// ensureFresh 索引超过一天未刷新时自动刷新，失败时继续使用缓存
+func (ap *APTPlugin) ensureFresh(ctx *command.CommandContext, store *marketplace.Store) {
+	if !store.Stale() {
+		return
+	}
+	refreshCtx, cancel := context.WithTimeout(ctx.Context, 30*time.Second)
+	defer cancel()
+	store.Refresh(refreshCtx, false)
+}
+
+// indexWarnings 列出刷新失败、正在使用缓存的索引及其缓存年龄
+func indexWarnings(store *marketplace.Store) string {
+	var b strings.Builder
+	for _, st := range store.Status() {
+		if st.Err == nil {
+			continue
+		}
+		if st.Fetched.IsZero() {
+			b.WriteString(fmt.Sprintf("⚠️ %s unavailable: %v\n", st.URL, st.Err))
+		} else {
+			b.WriteString(fmt.Sprintf("⚠️ %s unreachable, using cache from %s ago\n", st.URL, time.Since(st.Fetched).Round(time.Minute)))
+		}
+	}
+	return b.String()
+}
+
+// handleSearch 处理搜索插件索引
+func (ap *APTPlugin) handleSearch(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return ap.sendResponse(ctx, "Usage: .apt search <keyword>")
+	}
+
+	store, _, err := ap.marketplaceStore()
+	if err != nil {
+		return ap.sendResponse(ctx, err.Error())
+	}
+	ap.ensureFresh(ctx, store)
+
+	keyword := strings.Join(ctx.Args[1:], " ")
+	results := store.Search(keyword)
+
+	var response strings.Builder
+	response.WriteString(indexWarnings(store))
+	if len(results) == 0 {
+		response.WriteString(fmt.Sprintf("No plugins found for \"%s\"", keyword))
+		return ap.sendResponse(ctx, response.String())
+	}
+
+	response.WriteString(fmt.Sprintf("Found %d plugins:\n", len(results)))
+	for _, r := range results {
+		response.WriteString(fmt.Sprintf("• %s v%s - %s\n", r.Name, r.Version, r.Description))
+	}
+	return ap.sendResponse(ctx, response.String())
+}
+
+// handleShow 处理显示插件详情，包括安装前需确认的权限
+func (ap *APTPlugin) handleShow(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return ap.sendResponse(ctx, "Usage: .apt show <plugin_name>")
+	}
+
+	store, _, err := ap.marketplaceStore()
+	if err != nil {
+		return ap.sendResponse(ctx, err.Error())
+	}
+	ap.ensureFresh(ctx, store)
+
+	result, ok := store.Find(ctx.Args[1])
+	if !ok {
+		return ap.sendResponse(ctx, indexWarnings(store)+fmt.Sprintf("Plugin %s not found in index", ctx.Args[1]))
+	}
+
+	var response strings.Builder
+	response.WriteString(indexWarnings(store))
+	response.WriteString(fmt.Sprintf("📦 %s v%s\n", result.Name, result.Version))
+	response.WriteString(fmt.Sprintf("Description: %s\n", result.Description))
+	if result.MinBotVersion != "" {
+		compat := "✅"
+		if !result.Compatible(version.Get().Version) {
+			compat = "❌"
+		}
+		response.WriteString(fmt.Sprintf("Min bot version: %s %s\n", result.MinBotVersion, compat))
+	}
+	if len(result.Permissions) > 0 {
+		response.WriteString(fmt.Sprintf("Requested permissions: %s\n", strings.Join(result.Permissions, ", ")))
+	} else {
+		response.WriteString("Requested permissions: none\n")
+	}
+	response.WriteString(fmt.Sprintf("SHA256: %s\n", result.SHA256))
+	response.WriteString(fmt.Sprintf("Source: %s", result.Index))
+	return ap.sendResponse(ctx, response.String())
+}
+
+// handleInstall 处理通过索引安装插件
+func (ap *APTPlugin) handleInstall(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return ap.sendResponse(ctx, "Usage: .apt install <plugin_name>")
+	}
+
+	store, dir, err := ap.marketplaceStore()
+	if err != nil {
+		return ap.sendResponse(ctx, err.Error())
+	}
+	ap.ensureFresh(ctx, store)
+
+	result, ok := store.Find(ctx.Args[1])
+	if !ok {
+		return ap.sendResponse(ctx, fmt.Sprintf("Plugin %s not found in index", ctx.Args[1]))
+	}
+	if !result.Compatible(version.Get().Version) {
+		return ap.sendResponse(ctx, fmt.Sprintf("Plugin %s requires bot version %s or newer (current: %s)",
+			result.Name, result.MinBotVersion, version.Get().Version))
+	}
+
+	ap.sendResponse(ctx, fmt.Sprintf("Downloading %s v%s...", result.Name, result.Version))
+
+	downloadCtx, cancel := context.WithTimeout(ctx.Context, 2*time.Minute)
+	defer cancel()
+	data, err := store.Download(downloadCtx, &result.Entry)
+	if err != nil {
+		return ap.sendResponse(ctx, fmt.Sprintf("Failed to install %s: %v", result.Name, err))
+	}
+
+	pluginDir, err := marketplace.Stage(dir, result, data)
+	if err != nil {
+		return ap.sendResponse(ctx, fmt.Sprintf("Failed to install %s: %v", result.Name, err))
+	}
+
+	var response strings.Builder
+	// 还没有从 plugins_dir 加载插件的机制，这里只是校验并暂存
+	response.WriteString(fmt.Sprintf("Plugin %s v%s verified and staged in %s\n", result.Name, result.Version, pluginDir))
+	response.WriteString("Not loaded: plugins in plugins_dir cannot be loaded yet, restart and .apt enable do not load it\n")
+	if len(result.Permissions) > 0 {
+		response.WriteString(fmt.Sprintf("Requested permissions (not granted): %s", strings.Join(result.Permissions, ", ")))
+	}
+	return ap.sendResponse(ctx, strings.TrimRight(response.String(), "\n"))
+}
+
+// handleRemove 处理删除通过索引安装的插件
+func (ap *APTPlugin) handleRemove(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return ap.sendResponse(ctx, "Usage: .apt remove <plugin_name>")
+	}
+
+	goManager, ok := ap.manager.(*GoManager)
+	if !ok {
+		return ap.sendResponse(ctx, "Unsupported plugin manager type")
+	}
+	// 删除插件不需要索引，索引配置已移除时也可以删除
+	_, dir := goManager.GetMarketplace()
+	if dir == "" {
+		return ap.sendResponse(ctx, "Plugin directory not available")
+	}
+	if err := marketplace.Remove(dir, ctx.Args[1]); err != nil {
+		return ap.sendResponse(ctx, fmt.Sprintf("Failed to remove %s: %v", ctx.Args[1], err))
+	}
+	return ap.sendResponse(ctx, fmt.Sprintf("Plugin %s removed", ctx.Args[1]))
+}
+
+// handleUpdateIndex 处理强制刷新插件索引
+func (ap *APTPlugin) handleUpdateIndex(ctx *command.CommandContext) error {
+	store, _, err := ap.marketplaceStore()
+	if err != nil {
+		return ap.sendResponse(ctx, err.Error())
+	}
+
+	refreshCtx, cancel := context.WithTimeout(ctx.Context, time.Minute)
+	defer cancel()
+	store.Refresh(refreshCtx, true)
+
+	var response strings.Builder
+	response.WriteString("Plugin indexes:\n")
+	for _, st := range store.Status() {
+		name := st.Name
+		if name == "" {
+			name = st.URL
+		}
+		switch {
+		case st.Err == nil:
+			response.WriteString(fmt.Sprintf("✅ %s - %d plugins\n", name, st.Plugins))
+		case st.Fetched.IsZero():
+			response.WriteString(fmt.Sprintf("❌ %s - %v\n", name, st.Err))
+		default:
+			response.WriteString(fmt.Sprintf("⚠️ %s - %v (using cache from %s ago, %d plugins)\n",
+				name, st.Err, time.Since(st.Fetched).Round(time.Minute), st.Plugins))
+		}
+	}
+	return ap.sendResponse(ctx, strings.TrimRight(response.String(), "\n"))
+}
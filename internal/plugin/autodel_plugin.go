@@ -0,0 +1,275 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/deletion"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/storage"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// autodelSource 自动删除安排的删除在 pending_deletions 中的来源标记
+	autodelSource = "autodel"
+	// autodelMaxTTL 允许设置的最长TTL
+	autodelMaxTTL = 30 * 24 * time.Hour
+)
+
+// AutoDeletePlugin 自动删除插件，开启后自己在对话中发送的每条消息在TTL后删除
+type AutoDeletePlugin struct {
+	*BasePlugin
+	db    *sql.DB
+	chats map[int64]time.Duration // chat_id -> TTL
+	mutex sync.RWMutex
+}
+
+// NewAutoDeletePlugin 创建自动删除插件
+func NewAutoDeletePlugin(db *sql.DB) *AutoDeletePlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "autodel",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "自己在对话中发送的消息在TTL后自动删除",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &AutoDeletePlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+		chats:      make(map[int64]time.Duration),
+	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+	plugin.loadChats()
+
+	return plugin
+}
+
+// initDatabase 初始化数据库表
+func (ap *AutoDeletePlugin) initDatabase() {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS autodel_chats (
+		chat_id INTEGER PRIMARY KEY,
+		ttl_seconds INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);`
+
+	_, err := ap.db.Exec(createTableSQL)
+	if err != nil {
+		logger.Errorf("Failed to create autodel_chats table: %v", err)
+	}
+}
+
+// loadChats 从数据库读取开启自动删除的对话
+func (ap *AutoDeletePlugin) loadChats() {
+	rows, err := ap.db.Query("SELECT chat_id, ttl_seconds FROM autodel_chats")
+	if err != nil {
+		logger.Errorf("Failed to load autodel chats: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	chats := make(map[int64]time.Duration)
+	for rows.Next() {
+		var chatID, seconds int64
+		if err := rows.Scan(&chatID, &seconds); err != nil {
+			logger.Errorf("Failed to scan autodel chat: %v", err)
+			continue
+		}
+		chats[chatID] = time.Duration(seconds) * time.Second
+	}
+	if err := rows.Err(); err != nil {
+		logger.Errorf("Failed to load autodel chats: %v", err)
+	}
+
+	ap.mutex.Lock()
+	ap.chats = chats
+	ap.mutex.Unlock()
+	if len(chats) > 0 {
+		logger.Infof("Loaded %d autodel chats", len(chats))
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (ap *AutoDeletePlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("autodel", "自动删除自己的消息：on <TTL> | off | status", ap.info.Name, ap.handleAutodel)
+	logger.Infof("Autodel commands registered successfully")
+	return nil
+}
+
+// RegisterEventHandlers 实现EventPlugin接口，监听自己发送的消息
+func (ap *AutoDeletePlugin) RegisterEventHandlers(dispatcher *core.EventDispatcher) error {
+	return dispatcher.RegisterMessageListenerWithFilter("autodel_schedule", "", ap.handleOutgoing, 50, core.ListenerFilter{Outgoing: true})
+}
+
+// scheduler 获取持久化的延迟删除服务
+func (ap *AutoDeletePlugin) scheduler() *deletion.Scheduler {
+	if goManager, ok := ap.manager.(*GoManager); ok {
+		return goManager.GetDeletionScheduler()
+	}
+	return nil
+}
+
+// handleOutgoing 开启自动删除的对话中，安排在TTL后删除自己发送的消息。
+// 命令消息也会经过这里，因此开启后发送的命令同样会被删除
+func (ap *AutoDeletePlugin) handleOutgoing(ctx context.Context, event interface{}) error {
+	msgEvent, ok := event.(*core.MessageEvent)
+	if !ok || msgEvent.Message == nil {
+		return nil
+	}
+	ap.mutex.RLock()
+	ttl, enabled := ap.chats[msgEvent.ChatID]
+	ap.mutex.RUnlock()
+	if !enabled {
+		return nil
+	}
+	ap.schedule(ctx, msgEvent.ChatID, msgEvent.Message.ID, ttl)
+	return nil
+}
+
+// schedule 安排在ttl后删除消息，失败只写日志
+func (ap *AutoDeletePlugin) schedule(ctx context.Context, chatID int64, msgID int, ttl time.Duration) {
+	scheduler := ap.scheduler()
+	if scheduler == nil {
+		return
+	}
+	if err := scheduler.Schedule(chatID, []int{msgID}, time.Now().Add(ttl), autodelSource); err != nil {
+		logger.Ctx(ctx).Errorf("Failed to schedule autodel of message %d in chat %d: %v", msgID, chatID, err)
+	}
+}
+
+// handleAutodel 处理autodel命令
+func (ap *AutoDeletePlugin) handleAutodel(ctx *command.CommandContext) error {
+	if ap.scheduler() == nil {
+		return ap.sendResponse(ctx, "延迟删除服务不可用")
+	}
+	if len(ctx.Args) == 0 {
+		return ap.sendResponse(ctx, ap.usage())
+	}
+
+	chatID := ctx.Message.ChatID
+	switch ctx.Args[0] {
+	case "on":
+		if len(ctx.Args) < 2 {
+			return ap.sendResponse(ctx, "用法: .autodel on <TTL>，例如 30s、10m、1h、1d")
+		}
+		ttl, err := parseWindowDuration(ctx.Args[1])
+		if err != nil || ttl < time.Second || ttl > autodelMaxTTL {
+			return ap.sendResponse(ctx, fmt.Sprintf("❌ 无效的TTL: %s，应在 1s 到 %s 之间", ctx.Args[1], formatTTL(autodelMaxTTL)))
+		}
+		if err := ap.enable(chatID, ttl); err != nil {
+			return ap.sendResponse(ctx, fmt.Sprintf("❌ 开启自动删除失败: %v", err))
+		}
+		ap.schedule(ctx.Context, chatID, ctx.Message.Message.ID, ttl)
+		return ap.sendResponse(ctx, fmt.Sprintf("🗑️ 已开启自动删除，自己在此对话中发送的消息将在 %s 后删除", formatTTL(ttl)))
+	case "off":
+		ttl, wasOn, err := ap.disable(chatID)
+		if err != nil {
+			return ap.sendResponse(ctx, fmt.Sprintf("❌ 关闭自动删除失败: %v", err))
+		}
+		if !wasOn {
+			return ap.sendResponse(ctx, "此对话未开启自动删除")
+		}
+		// 关闭命令本身按原来的TTL删除
+		ap.schedule(ctx.Context, chatID, ctx.Message.Message.ID, ttl)
+		return ap.sendResponse(ctx, "✅ 已关闭自动删除，已安排的删除仍会执行")
+	case "status":
+		return ap.sendResponse(ctx, ap.status(chatID))
+	default:
+		return ap.sendResponse(ctx, ap.usage())
+	}
+}
+
+// enable 开启对话的自动删除，已开启时更新TTL
+func (ap *AutoDeletePlugin) enable(chatID int64, ttl time.Duration) error {
+	_, err := storage.Exec(ap.db, `INSERT INTO autodel_chats (chat_id, ttl_seconds, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(chat_id) DO UPDATE SET ttl_seconds = excluded.ttl_seconds`,
+		chatID, int64(ttl/time.Second), time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	ap.mutex.Lock()
+	ap.chats[chatID] = ttl
+	ap.mutex.Unlock()
+	return nil
+}
+
+// disable 关闭对话的自动删除，返回原来的TTL。已安排的删除不受影响
+func (ap *AutoDeletePlugin) disable(chatID int64) (time.Duration, bool, error) {
+	if _, err := storage.Exec(ap.db, "DELETE FROM autodel_chats WHERE chat_id = ?", chatID); err != nil {
+		return 0, false, err
+	}
+	ap.mutex.Lock()
+	ttl, ok := ap.chats[chatID]
+	delete(ap.chats, chatID)
+	ap.mutex.Unlock()
+	return ttl, ok, nil
+}
+
+// status 返回开启自动删除的对话及各自待删除的消息数量，当前对话排在最前
+func (ap *AutoDeletePlugin) status(chatID int64) string {
+	scheduler := ap.scheduler()
+	ap.mutex.RLock()
+	chats := make(map[int64]time.Duration, len(ap.chats))
+	for id, ttl := range ap.chats {
+		chats[id] = ttl
+	}
+	ap.mutex.RUnlock()
+
+	var b strings.Builder
+	if ttl, ok := chats[chatID]; ok {
+		b.WriteString(fmt.Sprintf("🗑️ 当前对话: 已开启，TTL %s", formatTTL(ttl)))
+	} else {
+		b.WriteString("当前对话: 未开启")
+	}
+	if pending, err := scheduler.Pending(chatID, autodelSource); err == nil {
+		b.WriteString(fmt.Sprintf("\n待删除消息: %d", pending))
+	}
+
+	ids := make([]int64, 0, len(chats))
+	for id := range chats {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	b.WriteString(fmt.Sprintf("\n\n开启自动删除的对话 (%d):", len(ids)))
+	if len(ids) == 0 {
+		b.WriteString("\n无")
+	}
+	for _, id := range ids {
+		line := fmt.Sprintf("\n• %d - TTL %s", id, formatTTL(chats[id]))
+		if pending, err := scheduler.Pending(id, autodelSource); err == nil {
+			line += fmt.Sprintf("，待删除 %d 条", pending)
+		}
+		b.WriteString(line)
+	}
+	if total, err := scheduler.Pending(0, autodelSource); err == nil {
+		b.WriteString(fmt.Sprintf("\n\n共 %d 条消息待删除", total))
+	}
+	return b.String()
+}
+
+// usage 返回用法说明
+func (ap *AutoDeletePlugin) usage() string {
+	return `用法:
+• .autodel on <TTL> - 自己在此对话中发送的消息在TTL后删除，例如 30s、10m、1h、1d
+• .autodel off - 关闭自动删除，已安排的删除仍会执行
+• .autodel status - 查看开启自动删除的对话和待删除消息数量`
+}
+
+// sendResponse 发送响应消息
+func (ap *AutoDeletePlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,143 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"nexusvalet/internal/peers"
+	"nexusvalet/internal/session"
+	"nexusvalet/internal/storage"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// TestConcurrentWritersShareDatabase 定时任务的写入和 access_hash 缓存的写入同时进行时，
+// 按程序实际打开数据库的方式(WAL、busy_timeout、多个连接)不应出现数据库被锁的错误
+func TestConcurrentWritersShareDatabase(t *testing.T) {
+	manager, err := session.NewManager(filepath.Join(t.TempDir(), "nexusvalet.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { manager.Close() })
+	if err := manager.CheckVersion(false); err != nil {
+		t.Fatal(err)
+	}
+	db := manager.GetDB()
+
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Fatalf("journal_mode = %q, %v; want wal", mode, err)
+	}
+
+	asp := NewAutoSendPlugin(db)
+	for _, init := range []func() error{asp.initDatabase, asp.initHistoryTables} {
+		if err := init(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ahm := peers.NewAccessHashManagerWithDB(nil, db)
+
+	const (
+		tasks       = 4
+		runsPerTask = 60
+		inserters   = 4
+		inserts     = 25
+		cacheRounds = 40
+		channels    = 20
+	)
+	taskList := make([]*AutoSendTask, tasks)
+	for i := range taskList {
+		result, err := db.Exec(`INSERT INTO autosend_tasks (chat_id, message, cron_expr, enabled) VALUES (?, ?, '0 * * * * *', 1)`, -100-i, "hi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := result.LastInsertId()
+		taskList[i] = &AutoSendTask{ID: id}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, inserters*inserts)
+
+	// 任务执行：更新任务、写入执行记录和失败记录
+	for _, task := range taskList {
+		wg.Add(1)
+		go func(task *AutoSendTask) {
+			defer wg.Done()
+			for i := 0; i < runsPerTask; i++ {
+				var runErr error
+				if i%3 == 0 {
+					runErr = errors.New("send failed")
+					asp.recordTaskFailure(task.ID, runErr)
+				}
+				asp.recordRun(task, runErr, 1, time.Millisecond)
+			}
+		}(task)
+	}
+
+	// 创建任务
+	for g := 0; g < inserters; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < inserts; i++ {
+				if _, err := storage.Exec(db, `INSERT INTO autosend_tasks (chat_id, message, cron_expr, enabled) VALUES (?, ?, '0 * * * * *', 1)`,
+					-1000-g, fmt.Sprintf("task %d-%d", g, i)); err != nil {
+					errs <- err
+				}
+			}
+		}(g)
+	}
+
+	// 更新中的频道信息，每轮 access_hash 变化，都需要写入数据库
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for round := 1; round <= cacheRounds; round++ {
+			chats := make([]tg.ChatClass, 0, channels)
+			for c := 1; c <= channels; c++ {
+				chats = append(chats, &tg.Channel{ID: int64(c), AccessHash: int64(round*1000 + c), Title: "channel"})
+			}
+			ahm.CacheChatsFromUpdate(chats)
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("insert failed: %v", err)
+	}
+
+	count := func(query string, args ...interface{}) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+
+	// 所有写入都已生效：任何一次因锁失败都只会被记录日志，这里通过计数检查
+	if n := count("SELECT COUNT(*) FROM autosend_tasks"); n != tasks+inserters*inserts {
+		t.Errorf("autosend_tasks has %d rows, want %d", n, tasks+inserters*inserts)
+	}
+	for _, task := range taskList {
+		if n := count("SELECT run_count FROM autosend_tasks WHERE id = ?", task.ID); n != runsPerTask {
+			t.Errorf("task %d run_count = %d, want %d", task.ID, n, runsPerTask)
+		}
+		if n := count("SELECT COUNT(*) FROM autosend_runs WHERE task_id = ?", task.ID); n != autosendRunsKept {
+			t.Errorf("task %d has %d runs, want %d", task.ID, n, autosendRunsKept)
+		}
+		if n := count("SELECT COUNT(*) FROM autosend_task_failures WHERE task_id = ?", task.ID); n != runsPerTask/3 {
+			t.Errorf("task %d has %d failure records, want %d", task.ID, n, runsPerTask/3)
+		}
+	}
+	if n := count("SELECT COUNT(*) FROM channel_hash_cache"); n != channels {
+		t.Errorf("channel_hash_cache has %d rows, want %d", n, channels)
+	}
+	if n := count("SELECT access_hash FROM channel_hash_cache WHERE channel_id = 7"); n != cacheRounds*1000+7 {
+		t.Errorf("channel 7 access_hash = %d, want the last round", n)
+	}
+}
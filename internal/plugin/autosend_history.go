@@ -0,0 +1,237 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// autosendMaxConsecutiveFailures 连续失败达到该次数后自动禁用任务
+	autosendMaxConsecutiveFailures = 5
+	// autosendRunsKept 每个任务保留的执行记录数
+	autosendRunsKept = 50
+	// autosendHistoryDefault .autosend history 默认显示的记录数
+	autosendHistoryDefault = 10
+)
+
+// 执行结果
+const (
+	autosendRunSuccess = "success"
+	autosendRunFailed  = "failed"
+)
+
+// autosendRun 一次任务执行记录
+type autosendRun struct {
+	RunAt    time.Time
+	Status   string
+	Error    string
+	Attempts int
+	Duration time.Duration
+}
+
+// initHistoryTables 创建执行记录表，任务表中的执行状态列由 initDatabase 和数据库迁移添加
+func (asp *AutoSendPlugin) initHistoryTables() error {
+	_, err := asp.db.Exec(`
+	CREATE TABLE IF NOT EXISTS autosend_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		run_at DATETIME NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT,
+		attempts INTEGER NOT NULL DEFAULT 1,
+		duration_ms INTEGER NOT NULL DEFAULT 0
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = asp.db.Exec("CREATE INDEX IF NOT EXISTS idx_autosend_runs_task ON autosend_runs(task_id, id)")
+	return err
+}
+
+// recordRun 保存一次执行的结果并返回连续失败次数
+func (asp *AutoSendPlugin) recordRun(task *AutoSendTask, runErr error, attempts int, duration time.Duration) int {
+	now := time.Now()
+	status := autosendRunSuccess
+	errMsg := ""
+	if runErr != nil {
+		status = autosendRunFailed
+		errMsg = runErr.Error()
+	}
+
+	asp.tasksMutex.Lock()
+	task.LastRun = now
+	task.LastStatus = status
+	task.LastError = errMsg
+	task.RunCount++
+	if runErr != nil {
+		task.ConsecutiveFailures++
+	} else {
+		task.ConsecutiveFailures = 0
+	}
+	failures := task.ConsecutiveFailures
+	asp.tasksMutex.Unlock()
+
+	runAt := now.Format("2006-01-02 15:04:05")
+	if _, err := storage.Exec(asp.db, `
+		UPDATE autosend_tasks SET last_run = ?, last_status = ?, last_error = ?, run_count = run_count + 1, consecutive_failures = ?
+		WHERE id = ?
+	`, runAt, status, errMsg, failures, task.ID); err != nil {
+		autosendLog.Errorf("Failed to update last run of task %d: %v", task.ID, err)
+	}
+
+	if _, err := storage.Exec(asp.db, `
+		INSERT INTO autosend_runs (task_id, run_at, status, error, attempts, duration_ms) VALUES (?, ?, ?, ?, ?, ?)
+	`, task.ID, runAt, status, errMsg, attempts, duration.Milliseconds()); err != nil {
+		autosendLog.Errorf("Failed to record run of task %d: %v", task.ID, err)
+		return failures
+	}
+
+	// 只保留最近的执行记录
+	if _, err := asp.db.Exec(`
+		DELETE FROM autosend_runs WHERE task_id = ? AND id NOT IN (
+			SELECT id FROM autosend_runs WHERE task_id = ? ORDER BY id DESC LIMIT ?
+		)
+	`, task.ID, task.ID, autosendRunsKept); err != nil {
+		autosendLog.Warnf("Failed to prune run history of task %d: %v", task.ID, err)
+	}
+	return failures
+}
+
+// disableFailingTask 连续失败次数过多时禁用任务
+func (asp *AutoSendPlugin) disableFailingTask(ctx context.Context, task *AutoSendTask, failures int) {
+	asp.tasksMutex.Lock()
+	defer asp.tasksMutex.Unlock()
+
+	if !task.Enabled {
+		return
+	}
+	if task.cronID != 0 {
+		asp.cronScheduler.Remove(task.cronID)
+		task.cronID = 0
+	}
+	task.Enabled = false
+
+	if _, err := asp.db.Exec("UPDATE autosend_tasks SET enabled = 0 WHERE id = ?", task.ID); err != nil {
+		autosendLog.Ctx(ctx).Errorf("Failed to disable task %d: %v", task.ID, err)
+	}
+	autosendLog.Ctx(ctx).Warnf("Task %d (chat %d) disabled after %d consecutive failures, last error: %s",
+		task.ID, task.ChatID, failures, task.LastError)
+}
+
+// loadRuns 读取任务最近的执行记录，新的在前
+func (asp *AutoSendPlugin) loadRuns(taskID int64, limit int) ([]autosendRun, error) {
+	rows, err := asp.db.Query(`
+		SELECT run_at, status, COALESCE(error, ''), attempts, duration_ms
+		FROM autosend_runs WHERE task_id = ? ORDER BY id DESC LIMIT ?
+	`, taskID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []autosendRun
+	for rows.Next() {
+		var r autosendRun
+		var runAt string
+		var durationMs int64
+		if err := rows.Scan(&runAt, &r.Status, &r.Error, &r.Attempts, &durationMs); err != nil {
+			return nil, err
+		}
+		r.RunAt, _ = asp.parseFlexibleTimeString(runAt)
+		r.Duration = time.Duration(durationMs) * time.Millisecond
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// handleHistory 显示任务最近的执行记录
+func (asp *AutoSendPlugin) handleHistory(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return asp.sendResponse(ctx, "用法: .autosend history <任务ID> [数量]")
+	}
+
+	taskID, err := strconv.ParseInt(ctx.Args[1], 10, 64)
+	if err != nil {
+		return asp.sendResponse(ctx, "无效的任务ID")
+	}
+	limit := autosendHistoryDefault
+	if len(ctx.Args) > 2 {
+		n, err := strconv.Atoi(ctx.Args[2])
+		if err != nil || n <= 0 {
+			return asp.sendResponse(ctx, "无效的数量")
+		}
+		limit = min(n, autosendRunsKept)
+	}
+
+	// 禁用的任务不在内存中，从数据库读取汇总信息
+	var runCount int64
+	var failures int
+	var enabled bool
+	err = asp.db.QueryRow("SELECT run_count, consecutive_failures, enabled FROM autosend_tasks WHERE id = ?", taskID).
+		Scan(&runCount, &failures, &enabled)
+	if err == sql.ErrNoRows {
+		return asp.sendResponse(ctx, "任务不存在")
+	}
+	if err != nil {
+		return asp.sendResponse(ctx, "读取任务失败: "+err.Error())
+	}
+
+	runs, err := asp.loadRuns(taskID, limit)
+	if err != nil {
+		return asp.sendResponse(ctx, "读取执行记录失败: "+err.Error())
+	}
+
+	var response strings.Builder
+	response.WriteString(fmt.Sprintf("📜 任务 %d 执行记录\n", taskID))
+	response.WriteString(fmt.Sprintf("共执行 %d 次，连续失败 %d 次", runCount, failures))
+	if !enabled {
+		response.WriteString("，已禁用")
+	}
+	response.WriteString("\n")
+
+	if len(runs) == 0 {
+		response.WriteString("\n暂无执行记录")
+		return asp.sendResponse(ctx, response.String())
+	}
+
+	response.WriteString(fmt.Sprintf("\n最近 %d 次:\n", len(runs)))
+	for _, r := range runs {
+		icon := "✅"
+		if r.Status != autosendRunSuccess {
+			icon = "❌"
+		}
+		line := fmt.Sprintf("%s %s · 尝试%d次 · %s", icon, r.RunAt.Format("2006-01-02 15:04:05"), r.Attempts, r.Duration.Round(time.Millisecond))
+		if r.Error != "" {
+			line += "\n    " + truncateRunes(r.Error, 120)
+		}
+		response.WriteString(line + "\n")
+	}
+
+	return asp.sendResponse(ctx, response.String())
+}
+
+// formatLastRun 格式化任务上次执行的结果
+func formatLastRun(task *AutoSendTask) string {
+	if task.LastRun.IsZero() {
+		return "尚未运行"
+	}
+	line := task.LastRun.Format("2006-01-02 15:04:05")
+	if task.LastStatus == autosendRunSuccess {
+		line += " ✅ 成功"
+	} else {
+		line += " ❌ 失败"
+		if task.ConsecutiveFailures > 1 {
+			line += fmt.Sprintf("(连续%d次)", task.ConsecutiveFailures)
+		}
+		if task.LastError != "" {
+			line += ": " + truncateRunes(task.LastError, 80)
+		}
+	}
+	return line + fmt.Sprintf("，共 %d 次", task.RunCount)
+}
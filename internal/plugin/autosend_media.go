@@ -0,0 +1,153 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/storage"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// 媒体任务发送的媒体类型
+const (
+	autosendMediaPhoto    = "photo"
+	autosendMediaDocument = "document"
+)
+
+// autosendMediaRef 媒体任务保存的文件引用，只保存引用，不保存文件内容
+type autosendMediaRef struct {
+	ID            int64  `json:"id"`
+	AccessHash    int64  `json:"access_hash"`
+	FileReference []byte `json:"file_reference"`
+}
+
+// setMedia 把消息中的图片或文件记录到任务，消息没有图片或文件时返回错误
+func (task *AutoSendTask) setMedia(msg *tg.Message) error {
+	switch m := msg.Media.(type) {
+	case *tg.MessageMediaPhoto:
+		if photo, ok := m.Photo.(*tg.Photo); ok {
+			task.MediaType = autosendMediaPhoto
+			task.MediaRef = &autosendMediaRef{ID: photo.ID, AccessHash: photo.AccessHash, FileReference: photo.FileReference}
+			return nil
+		}
+	case *tg.MessageMediaDocument:
+		if doc, ok := m.Document.(*tg.Document); ok {
+			task.MediaType = autosendMediaDocument
+			task.MediaRef = &autosendMediaRef{ID: doc.ID, AccessHash: doc.AccessHash, FileReference: doc.FileReference}
+			return nil
+		}
+	}
+	return fmt.Errorf("被回复的消息没有图片或文件")
+}
+
+// HasMedia 是否为发送图片或文件的任务
+func (task *AutoSendTask) HasMedia() bool {
+	return task.MediaType != "" && task.MediaRef != nil
+}
+
+// inputMedia 按保存的引用构造要发送的媒体
+func (task *AutoSendTask) inputMedia() tg.InputMediaClass {
+	ref := task.MediaRef
+	if task.MediaType == autosendMediaPhoto {
+		return &tg.InputMediaPhoto{ID: &tg.InputPhoto{ID: ref.ID, AccessHash: ref.AccessHash, FileReference: ref.FileReference}}
+	}
+	return &tg.InputMediaDocument{ID: &tg.InputDocument{ID: ref.ID, AccessHash: ref.AccessHash, FileReference: ref.FileReference}}
+}
+
+// encodeMediaRef 返回保存到 media_ref 列的内容，纯文本任务为空字符串
+func encodeMediaRef(ref *autosendMediaRef) string {
+	if ref == nil {
+		return ""
+	}
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// decodeMediaRef 解析 media_ref 列，为空时返回nil
+func decodeMediaRef(value string) (*autosendMediaRef, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var ref autosendMediaRef
+	if err := json.Unmarshal([]byte(value), &ref); err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// sendTaskMedia 以任务消息为说明发送媒体。文件引用过期时重新获取来源消息以得到新的引用，
+// 保存后重试一次
+func (asp *AutoSendPlugin) sendTaskMedia(ctx context.Context, task *AutoSendTask, peer tg.InputPeerClass) error {
+	send := func() error {
+		asp.tasksMutex.RLock()
+		media := task.inputMedia()
+		asp.tasksMutex.RUnlock()
+		_, err := flood.Call(ctx, asp.floodLimiter(), task.ChatID, func() (tg.UpdatesClass, error) {
+			return asp.telegramAPI.MessagesSendMedia(ctx, &tg.MessagesSendMediaRequest{
+				Peer:     peer,
+				Media:    media,
+				Message:  task.Message,
+				RandomID: time.Now().UnixNano(),
+			})
+		})
+		return err
+	}
+
+	err := send()
+	if !tgerr.Is(err, "FILE_REFERENCE_EXPIRED", "FILE_REFERENCE_INVALID") {
+		return err
+	}
+	autosendLog.Ctx(ctx).Infof("File reference of task %d expired, refetching source message %d in chat %d", task.ID, task.SourceMsgID, task.SourceChatID)
+	if refreshErr := asp.refreshMedia(ctx, task); refreshErr != nil {
+		return fmt.Errorf("%w (failed to refresh file reference: %v)", err, refreshErr)
+	}
+	return send()
+}
+
+// refreshMedia 重新获取来源消息，更新任务的文件引用
+func (asp *AutoSendPlugin) refreshMedia(ctx context.Context, task *AutoSendTask) error {
+	if task.SourceChatID == 0 || task.SourceMsgID == 0 {
+		return fmt.Errorf("task has no source message")
+	}
+	peer, err := asp.peerResolver.ResolveFromChatID(ctx, task.SourceChatID)
+	if err != nil {
+		return err
+	}
+	msg, _, _, err := fetchPeerMessage(ctx, asp.telegramAPI, peer, task.SourceMsgID)
+	if err != nil {
+		return err
+	}
+
+	refreshed := AutoSendTask{}
+	if err := refreshed.setMedia(msg); err != nil {
+		return err
+	}
+	asp.tasksMutex.Lock()
+	task.MediaType, task.MediaRef = refreshed.MediaType, refreshed.MediaRef
+	asp.tasksMutex.Unlock()
+
+	if _, err := storage.Exec(asp.db, "UPDATE autosend_tasks SET media_type = ?, media_ref = ? WHERE id = ?",
+		refreshed.MediaType, encodeMediaRef(refreshed.MediaRef), task.ID); err != nil {
+		autosendLog.Ctx(ctx).Warnf("Failed to save refreshed file reference of task %d: %v", task.ID, err)
+	}
+	return nil
+}
+
+// mediaMarker 返回列表中媒体任务的标记，纯文本任务为空字符串
+func mediaMarker(task *AutoSendTask) string {
+	switch {
+	case !task.HasMedia():
+		return ""
+	case task.MediaType == autosendMediaPhoto:
+		return " 📎 图片"
+	default:
+		return " 📎 文件"
+	}
+}
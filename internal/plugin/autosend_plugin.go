@@ -4,8 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"nexusvalet/internal/cache"
 	"nexusvalet/internal/command"
+	"nexusvalet/internal/errctx"
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/format"
 	"nexusvalet/internal/peers"
+	"nexusvalet/internal/storage"
+	"nexusvalet/internal/version"
 	"nexusvalet/pkg/logger"
 	"strconv"
 	"strings"
@@ -13,6 +19,7 @@ import (
 	"time"
 
 	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
 	"github.com/robfig/cron/v3"
 )
 
@@ -20,14 +27,32 @@ import (
 type AutoSendTask struct {
 	ID       int64        `json:"id"`
 	ChatID   int64        `json:"chat_id"`
-	Message  string       `json:"message"`
+	Message  string       `json:"message"`   // 消息内容，媒体任务中作为说明
 	CronExpr string       `json:"cron_expr"` // cron表达式
+	Timezone string       `json:"timezone"`  // 按该IANA时区解析cron表达式，为空时使用 plugins.autosend.timezone
 	NextRun  time.Time    `json:"next_run"`  // 下次运行时间（仅用于显示）
 	Enabled  bool         `json:"enabled"`
+	DeferOK  bool         `json:"defer_ok"` // 维护窗口期间延迟到窗口结束后补发
 	Created  time.Time    `json:"created"`
 	cronID   cron.EntryID // cron任务ID，用于管理任务
+
+	// 媒体任务发送的图片或文件，纯文本任务为空。来源消息用于在文件引用过期时重新获取
+	MediaType    string            `json:"media_type"`
+	MediaRef     *autosendMediaRef `json:"media_ref"`
+	SourceChatID int64             `json:"source_chat_id"`
+	SourceMsgID  int               `json:"source_msg_id"`
+
+	// 执行记录，每次执行后更新
+	LastRun             time.Time `json:"last_run"`
+	LastStatus          string    `json:"last_status"`
+	LastError           string    `json:"last_error"`
+	RunCount            int64     `json:"run_count"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
 }
 
+// autosendLog 自动发送插件的日志，可以通过 logger.modules.autosend 单独设置级别
+var autosendLog = logger.Named("autosend")
+
 // AutoSendPlugin 自动发送插件
 type AutoSendPlugin struct {
 	*BasePlugin
@@ -75,7 +100,16 @@ func (asp *AutoSendPlugin) Initialize(ctx context.Context, manager interface{})
 	if err := asp.initDatabase(); err != nil {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
+	if err := asp.initHistoryTables(); err != nil {
+		return fmt.Errorf("failed to initialize run history: %w", err)
+	}
 
+	autosendLog.Infof("AutoSend plugin initialized successfully")
+	return nil
+}
+
+// InitializeAfterConnect 实现PostConnectPlugin接口，连接后加载任务并启动定时器
+func (asp *AutoSendPlugin) InitializeAfterConnect(ctx context.Context) error {
 	// 加载现有任务
 	if err := asp.loadTasks(); err != nil {
 		return fmt.Errorf("failed to load tasks: %w", err)
@@ -83,14 +117,26 @@ func (asp *AutoSendPlugin) Initialize(ctx context.Context, manager interface{})
 
 	// 启动定时器
 	asp.startScheduler()
-
-	logger.Infof("AutoSend plugin initialized successfully")
 	return nil
 }
 
-// Shutdown 关闭插件
+// Shutdown 关闭插件，等待正在执行的任务完成后清空调度器，
+// 以便重新加载时 InitializeAfterConnect 从数据库重新加载任务而不会重复调度
 func (asp *AutoSendPlugin) Shutdown(ctx context.Context) error {
-	asp.stopScheduler()
+	err := asp.stopScheduler(ctx)
+
+	asp.tasksMutex.Lock()
+	for _, task := range asp.tasks {
+		if task.cronID != 0 {
+			asp.cronScheduler.Remove(task.cronID)
+		}
+	}
+	asp.tasks = make(map[int64]*AutoSendTask)
+	asp.tasksMutex.Unlock()
+
+	if err != nil {
+		return err
+	}
 	return asp.BasePlugin.Shutdown(ctx)
 }
 
@@ -98,21 +144,67 @@ func (asp *AutoSendPlugin) Shutdown(ctx context.Context) error {
 func (asp *AutoSendPlugin) SetTelegramClient(client *tg.Client, peerResolver *peers.Resolver) {
 	asp.telegramAPI = client
 	asp.peerResolver = peerResolver
-	// 使用带数据库持久化的AccessHashManager（来自 peers 包）
-	asp.accessHashManager = peers.NewAccessHashManagerWithDB(client, asp.db)
+	// 与解析器共用同一个AccessHashManager，缓存和失败计数在插件间共享
+	asp.accessHashManager = peerResolver.Manager()
 }
 
+// autoSendLongHelp .help autosend 显示的详细帮助
+const autoSendLongHelp = `🤖 AutoSend 定时发送插件详细帮助
+
+📝 基本命令:
+  • .autosend add <秒> <分> <时> <日> <月> <周> <消息内容> - 创建定时发送任务
+  • 回复图片或文件 .autosend add --media <cron...> [说明] - 定时发送该图片或文件
+  • .autosend add tz=Asia/Shanghai <cron...> <消息内容> - 按指定时区执行
+  • .autosend list - 列出所有任务
+  • .autosend remove <ID> - 删除任务
+  • .autosend enable <ID> - 启用任务
+  • .autosend disable <ID> - 禁用任务
+
+📋 Cron表达式格式: 秒 分 时 日 月 周
+  • 每天0点: 0 0 0 * * *
+  • 每天12:30: 0 30 12 * * *
+  • 每10分钟: 0 */10 * * * *
+  • 每小时: 0 0 * * * *
+  • 工作日9点: 0 0 9 * * 1-5
+  • 每周日22点: 0 0 22 * * 0
+
+📋 使用示例:
+  • .autosend add 0 0 0 * * * 🌅 新的一天开始了！
+  • .autosend add 0 30 12 * * * 🍽️ 午餐时间到了！
+  • .autosend add 0 0 22 * * * 🌙 该休息了，晚安~
+  • .as add 0 */30 * * * * 📊 半小时状态检查
+  • .autosend add 0 0 9 * * 1-5 ☕ 工作日早安！
+  • .autosend add 0 0 18 * * 1-5 🏠 下班时间到了！
+  • .autosend list - 查看所有任务
+  • .autosend remove 1 - 删除ID为1的任务
+
+✨ 特色功能:
+  • 使用强大的cron表达式，支持复杂定时规则
+  • 支持秒级精度的定时任务
+  • 完全自定义消息内容，支持emoji表情 🎉
+  • 支持多行文本和特殊字符
+  • 可用于工作提醒、生活助手、娱乐互动等
+
+⚠️ 注意事项:
+  • 使用标准cron表达式，支持秒级精度
+  • 无需使用引号，直接输入6个字段
+  • 消息内容完全由您自定义
+  • 任务会在当前聊天中执行
+  • 重启后任务会自动恢复
+  • 使用.as作为简写命令`
+
 // RegisterCommands 注册命令
 func (asp *AutoSendPlugin) RegisterCommands(parser *command.Parser) error {
 	// 注册主命令
 	parser.RegisterCommand("autosend", "定时自动发送消息管理", asp.info.Name, asp.handleAutoSend)
 	parser.RegisterCommand("as", "autosend简写命令", asp.info.Name, asp.handleAutoSend)
+	parser.RegisterLongHelp(asp.info.Name, autoSendLongHelp)
 
-	logger.Infof("AutoSend commands registered successfully")
+	autosendLog.Infof("AutoSend commands registered successfully")
 	return nil
 }
 
-// initDatabase 初始化数据库表
+// initDatabase 初始化数据库表。新表包含所有列，旧表缺少的列由 session 中的数据库迁移添加
 func (asp *AutoSendPlugin) initDatabase() error {
 	// 首先检查表是否存在
 	var count int
@@ -131,7 +223,18 @@ func (asp *AutoSendPlugin) initDatabase() error {
 			cron_expr TEXT NOT NULL,
 			next_run DATETIME,
 			enabled BOOLEAN NOT NULL DEFAULT 1,
-			created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			defer_ok BOOLEAN NOT NULL DEFAULT 0,
+			created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_run DATETIME,
+			last_status TEXT,
+			last_error TEXT,
+			run_count INTEGER NOT NULL DEFAULT 0,
+			consecutive_failures INTEGER NOT NULL DEFAULT 0,
+			media_type TEXT,
+			media_ref TEXT,
+			source_chat_id INTEGER NOT NULL DEFAULT 0,
+			source_msg_id INTEGER NOT NULL DEFAULT 0,
+			timezone TEXT NOT NULL DEFAULT ''
 		);
 		`
 		_, err = asp.db.Exec(createTableSQL)
@@ -156,60 +259,22 @@ func (asp *AutoSendPlugin) initDatabase() error {
 		}
 
 		return nil
-	} else {
-		// 检查是否需要添加新列或迁移数据
-		rows, err := asp.db.Query("PRAGMA table_info(autosend_tasks)")
-		if err != nil {
-			return err
-		}
-		defer rows.Close()
-
-		hasCronExprColumn := false
-		hasOldColumns := false
-
-		for rows.Next() {
-			var cid int
-			var name, dataType string
-			var notNull, pk bool
-			var defaultValue interface{}
-
-			err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk)
-			if err != nil {
-				continue
-			}
-
-			if name == "cron_expr" {
-				hasCronExprColumn = true
-			}
-			if name == "type" || name == "interval_seconds" || name == "daily_at" {
-				hasOldColumns = true
-			}
-		}
-
-		// 如果没有cron_expr列，需要迁移
-		if !hasCronExprColumn {
-			// 添加新列
-			_, err = asp.db.Exec("ALTER TABLE autosend_tasks ADD COLUMN cron_expr TEXT")
-			if err != nil {
-				return err
-			}
-
-			// 如果有旧列，进行数据迁移
-			if hasOldColumns {
-				err = asp.migrateOldTasks()
-				if err != nil {
-					logger.Warnf("Failed to migrate old tasks: %v", err)
-				}
+	}
 
-				// 迁移完成后，为旧字段设置默认值以避免NOT NULL约束问题
-				_, err = asp.db.Exec("UPDATE autosend_tasks SET interval_seconds = 0 WHERE interval_seconds IS NULL")
-				if err != nil {
-					logger.Warnf("Failed to update interval_seconds default values: %v", err)
-				}
-			}
-		}
+	// 旧版本的间隔/每日任务转换为cron表达式，cron_expr 列由数据库迁移添加
+	var oldColumns int
+	err = asp.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('autosend_tasks') WHERE name IN ('type', 'interval_seconds', 'daily_at')").Scan(&oldColumns)
+	if err != nil || oldColumns == 0 {
+		return err
+	}
+	if err := asp.migrateOldTasks(); err != nil {
+		autosendLog.Warnf("Failed to migrate old tasks: %v", err)
 	}
 
+	// 迁移完成后，为旧字段设置默认值以避免NOT NULL约束问题
+	if _, err := asp.db.Exec("UPDATE autosend_tasks SET interval_seconds = 0 WHERE interval_seconds IS NULL"); err != nil {
+		autosendLog.Warnf("Failed to update interval_seconds default values: %v", err)
+	}
 	return nil
 }
 
@@ -259,9 +324,9 @@ func (asp *AutoSendPlugin) migrateOldTasks() error {
 			if cronExpr == "" {
 				_, err = asp.db.Exec("DELETE FROM autosend_tasks WHERE id = ?", id)
 				if err != nil {
-					logger.Errorf("Failed to delete unconvertible task %d: %v", id, err)
+					autosendLog.Errorf("Failed to delete unconvertible task %d: %v", id, err)
 				}
-				logger.Infof("Deleted unconvertible interval task %d (%d seconds)", id, intervalSeconds)
+				autosendLog.Infof("Deleted unconvertible interval task %d (%d seconds)", id, intervalSeconds)
 				continue
 			}
 		}
@@ -270,9 +335,9 @@ func (asp *AutoSendPlugin) migrateOldTasks() error {
 			// 更新任务的cron表达式
 			_, err = asp.db.Exec("UPDATE autosend_tasks SET cron_expr = ? WHERE id = ?", cronExpr, id)
 			if err != nil {
-				logger.Errorf("Failed to update task %d with cron expression: %v", id, err)
+				autosendLog.Errorf("Failed to update task %d with cron expression: %v", id, err)
 			} else {
-				logger.Infof("Migrated task %d to cron expression: %s", id, cronExpr)
+				autosendLog.Infof("Migrated task %d to cron expression: %s", id, cronExpr)
 			}
 		}
 	}
@@ -283,7 +348,9 @@ func (asp *AutoSendPlugin) migrateOldTasks() error {
 // loadTasks 从数据库加载任务
 func (asp *AutoSendPlugin) loadTasks() error {
 	rows, err := asp.db.Query(`
-		SELECT id, chat_id, message, cron_expr, enabled, created, COALESCE(next_run, '') as next_run
+		SELECT id, chat_id, message, cron_expr, enabled, COALESCE(defer_ok, 0) as defer_ok, created, COALESCE(next_run, '') as next_run,
+			COALESCE(last_run, ''), COALESCE(last_status, ''), COALESCE(last_error, ''), run_count, consecutive_failures,
+			COALESCE(media_type, ''), COALESCE(media_ref, ''), source_chat_id, source_msg_id, COALESCE(timezone, '')
 		FROM autosend_tasks WHERE enabled = 1 AND cron_expr IS NOT NULL AND cron_expr != ''
 	`)
 	if err != nil {
@@ -296,39 +363,49 @@ func (asp *AutoSendPlugin) loadTasks() error {
 
 	for rows.Next() {
 		var task AutoSendTask
-		var createdStr, nextRunStr string
+		var createdStr, nextRunStr, lastRunStr, mediaRef string
 
-		err := rows.Scan(&task.ID, &task.ChatID, &task.Message, &task.CronExpr, &task.Enabled, &createdStr, &nextRunStr)
+		err := rows.Scan(&task.ID, &task.ChatID, &task.Message, &task.CronExpr, &task.Enabled, &task.DeferOK, &createdStr, &nextRunStr,
+			&lastRunStr, &task.LastStatus, &task.LastError, &task.RunCount, &task.ConsecutiveFailures,
+			&task.MediaType, &mediaRef, &task.SourceChatID, &task.SourceMsgID, &task.Timezone)
 		if err != nil {
-			logger.Errorf("Failed to scan task: %v", err)
+			autosendLog.Errorf("Failed to scan task: %v", err)
+			continue
+		}
+		if task.MediaRef, err = decodeMediaRef(mediaRef); err != nil {
+			autosendLog.Errorf("Failed to decode media of task %d: %v", task.ID, err)
 			continue
 		}
 
 		// 解析创建时间 - 支持多种时间格式
 		task.Created, err = asp.parseFlexibleTimeString(createdStr)
 		if err != nil {
-			logger.Errorf("Failed to parse created time: %v", err)
+			autosendLog.Errorf("Failed to parse created time: %v", err)
 			continue
 		}
 
 		// 解析下次运行时间，如果解析失败则计算新的
 		if nextRunStr != "" {
 			if task.NextRun, err = asp.parseFlexibleTimeString(nextRunStr); err != nil {
-				logger.Warnf("Failed to parse next_run time for task %d: %v", task.ID, err)
+				autosendLog.Warnf("Failed to parse next_run time for task %d: %v", task.ID, err)
 			}
 		}
 
+		if lastRunStr != "" {
+			task.LastRun, _ = asp.parseFlexibleTimeString(lastRunStr)
+		}
+
 		// 如果NextRun为空或已过期，重新计算
 		if task.NextRun.IsZero() || task.NextRun.Before(time.Now()) {
-			task.NextRun = asp.calculateNextRunTime(task.CronExpr)
+			task.NextRun = asp.calculateNextRunTime(asp.taskSpec(&task))
 		}
 
 		// 添加到cron调度器
-		cronID, err := asp.cronScheduler.AddFunc(task.CronExpr, func() {
+		cronID, err := asp.cronScheduler.AddFunc(asp.taskSpec(&task), func() {
 			asp.executeTask(&task)
 		})
 		if err != nil {
-			logger.Errorf("Failed to add cron task %d: %v", task.ID, err)
+			autosendLog.Errorf("Failed to add cron task %d: %v", task.ID, err)
 			continue
 		}
 
@@ -336,7 +413,7 @@ func (asp *AutoSendPlugin) loadTasks() error {
 		asp.tasks[task.ID] = &task
 	}
 
-	logger.Infof("Loaded %d autosend tasks", len(asp.tasks))
+	autosendLog.Infof("Loaded %d autosend tasks", len(asp.tasks))
 	return nil
 }
 
@@ -348,86 +425,123 @@ func (asp *AutoSendPlugin) startScheduler() {
 
 	asp.running = true
 	asp.cronScheduler.Start()
-	logger.Infof("AutoSend cron scheduler started")
+	autosendLog.Infof("AutoSend cron scheduler started")
 }
 
-// stopScheduler 停止调度器
-func (asp *AutoSendPlugin) stopScheduler() {
+// stopScheduler 停止调度器并等待正在执行的任务完成，ctx结束时不再等待
+func (asp *AutoSendPlugin) stopScheduler(ctx context.Context) error {
 	if !asp.running {
-		return
+		return nil
 	}
 
 	asp.running = false
-	if asp.cronScheduler != nil {
-		asp.cronScheduler.Stop()
-		logger.Infof("AutoSend cron scheduler stopped")
+	if asp.cronScheduler == nil {
+		return nil
+	}
+	select {
+	case <-asp.cronScheduler.Stop().Done():
+		autosendLog.Infof("AutoSend cron scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for running autosend tasks: %w", ctx.Err())
 	}
 }
 
 // executeTask 执行单个任务
 func (asp *AutoSendPlugin) executeTask(task *AutoSendTask) {
 	if asp.telegramAPI == nil || asp.peerResolver == nil {
-		logger.Errorf("Telegram API or peer resolver not available")
+		autosendLog.Errorf("Telegram API or peer resolver not available")
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// 维护窗口期间跳过发送，defer_ok的任务在窗口结束后补发
+	if goManager, ok := asp.manager.(*GoManager); ok {
+		var flush func()
+		if task.DeferOK {
+			flush = func() { asp.executeTask(task) }
+		}
+		if goManager.GetMaintenanceGate().Suppress("autosend", fmt.Sprintf("autosend:%d", task.ID), flush) {
+			return
+		}
+	}
+
+	// 定时任务不经过更新处理流程，单独分配关联ID
+	ctx, cancel := context.WithTimeout(logger.WithFields(context.Background(), logger.Fields{
+		CorrelationID: logger.NewCorrelationID(),
+		ChatID:        task.ChatID,
+		Command:       fmt.Sprintf("autosend#%d", task.ID),
+	}), 30*time.Second)
 	defer cancel()
 
-	// 尝试发送消息，带重试机制
-	success := asp.sendMessageWithRetry(ctx, task)
-	if success {
-		logger.Infof("AutoSend task %d executed successfully (cron: %s)", task.ID, task.CronExpr)
+	// 尝试发送消息，带重试机制，并记录本次执行结果
+	start := time.Now()
+	attempts, err := asp.sendMessageWithRetry(ctx, task)
+	failures := asp.recordRun(task, err, attempts, time.Since(start))
+	if err == nil {
+		autosendLog.Ctx(ctx).Infof("AutoSend task %d executed successfully (cron: %s)", task.ID, task.CronExpr)
 	} else {
-		logger.Errorf("AutoSend task %d failed after all retry attempts", task.ID)
-		// 可选：禁用失败的任务以避免持续错误
-		asp.handleFailedTask(task)
+		autosendLog.Ctx(ctx).Errorf("AutoSend task %d failed after all retry attempts: %v", task.ID, err)
+		asp.handleFailedTask(ctx, task, err, failures)
 	}
 }
 
-// sendMessageWithRetry 带重试机制的消息发送
-func (asp *AutoSendPlugin) sendMessageWithRetry(ctx context.Context, task *AutoSendTask) bool {
+// sendMessageWithRetry 带重试机制的消息发送，返回尝试次数和最后一次的错误
+func (asp *AutoSendPlugin) sendMessageWithRetry(ctx context.Context, task *AutoSendTask) (int, error) {
 	maxRetries := 3
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		// 解析聊天ID为peer，针对机器人用户使用特殊处理
 		peer, err := asp.resolvePeerForTask(ctx, task.ChatID)
 		if err != nil {
-			logger.Errorf("Attempt %d: Failed to resolve peer for chat %d: %v", attempt, task.ChatID, err)
+			autosendLog.Ctx(ctx).Errorf("Attempt %d: Failed to resolve peer for chat %d: %v", attempt, task.ChatID, err)
 			if attempt < maxRetries {
 				time.Sleep(time.Duration(attempt) * time.Second) // 递增延迟
 				continue
 			}
-			return false
+			return attempt, err
 		}
 
-		// 发送消息
-		_, err = asp.telegramAPI.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
-			Peer:     peer,
-			Message:  task.Message,
-			RandomID: time.Now().UnixNano(),
-		})
+		// 发送消息，FLOOD_WAIT由限流器等待后重试
+		if task.HasMedia() {
+			err = asp.sendTaskMedia(ctx, task, peer)
+		} else {
+			_, err = flood.Call(ctx, asp.floodLimiter(), task.ChatID, func() (tg.UpdatesClass, error) {
+				return asp.telegramAPI.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+					Peer:     peer,
+					Message:  task.Message,
+					RandomID: time.Now().UnixNano(),
+				})
+			})
+		}
 
 		if err != nil {
 			errStr := err.Error()
-			logger.Errorf("Attempt %d: Failed to send autosend message to chat %d: %v", attempt, task.ChatID, err)
+			autosendLog.Ctx(ctx).Errorf("Attempt %d: Failed to send autosend message to chat %d: %v", attempt, task.ChatID, err)
 
-			// 检查是否是可重试的错误
-			if asp.isRetryableError(errStr) && attempt < maxRetries {
-				logger.Infof("Retryable error detected, waiting before retry...")
+			// 检查是否是可重试的错误，等待时间过长的FLOOD_WAIT不再重试
+			if !flood.IsWaitTooLong(err) && asp.isRetryableError(errStr) && attempt < maxRetries {
+				autosendLog.Ctx(ctx).Infof("Retryable error detected, waiting before retry...")
 				time.Sleep(time.Duration(attempt*2) * time.Second) // 递增延迟
 				continue
 			}
 
 			// 不可重试的错误或已达到最大重试次数
-			return false
+			return attempt, err
 		}
 
 		// 成功发送
-		return true
+		return attempt, nil
 	}
 
-	return false
+	return maxRetries, fmt.Errorf("failed after %d attempts", maxRetries)
+}
+
+// floodLimiter 返回管理器的发送频率限制，没有时返回nil
+func (asp *AutoSendPlugin) floodLimiter() *flood.Limiter {
+	if goManager, ok := asp.manager.(*GoManager); ok {
+		return goManager.GetFloodLimiter()
+	}
+	return nil
 }
 
 // resolvePeerForTask 为任务解析peer，针对机器人用户使用特殊处理
@@ -437,17 +551,17 @@ func (asp *AutoSendPlugin) resolvePeerForTask(ctx context.Context, chatID int64)
 		// 尝试使用AccessHashManager获取正确的AccessHash
 		userPeer, err := asp.accessHashManager.GetUserPeerWithFallback(ctx, chatID, nil)
 		if err == nil {
-			logger.Debugf("Successfully resolved user %d with AccessHashManager", chatID)
+			autosendLog.Ctx(ctx).Debugf("Successfully resolved user %d with AccessHashManager", chatID)
 			return userPeer, nil
 		}
 
 		// 如果AccessHashManager失败，检查是否是失败次数过多
 		if strings.Contains(err.Error(), "失败次数过多") {
-			logger.Errorf("User %d AccessHash获取失败次数过多，需要重新建立连接", chatID)
-			return nil, fmt.Errorf("用户%d的AccessHash已失效，请重新建立连接", chatID)
+			autosendLog.Ctx(ctx).Errorf("User %d AccessHash获取失败次数过多，需要重新建立连接", chatID)
+			return nil, errctx.Wrap(ctx, fmt.Errorf("用户%d的AccessHash已失效，请重新建立连接", chatID))
 		}
 
-		logger.Warnf("AccessHashManager failed for user %d: %v, falling back to standard resolver", chatID, err)
+		autosendLog.Ctx(ctx).Warnf("AccessHashManager failed for user %d: %v, falling back to standard resolver", chatID, err)
 	}
 
 	// 回退到标准的peer resolver
@@ -475,27 +589,34 @@ func (asp *AutoSendPlugin) isRetryableError(errStr string) bool {
 	return false
 }
 
-// handleFailedTask 处理失败的任务
-func (asp *AutoSendPlugin) handleFailedTask(task *AutoSendTask) {
+// handleFailedTask 处理失败的任务，failures为记录的连续失败次数
+func (asp *AutoSendPlugin) handleFailedTask(ctx context.Context, task *AutoSendTask, err error, failures int) {
 	// 记录失败次数
-	logger.Warnf("Task %d failed multiple times, consider checking chat ID %d validity", task.ID, task.ChatID)
+	autosendLog.Ctx(ctx).Warnf("Task %d failed multiple times, consider checking chat ID %d validity", task.ID, task.ChatID)
 
-	// 如果是用户（正数chatID），清除其AccessHash缓存
+	// 清除用户（正数chatID）或频道的AccessHash缓存
 	if task.ChatID > 0 && asp.accessHashManager != nil {
 		asp.accessHashManager.ClearUserCache(task.ChatID)
-		logger.Infof("Cleared AccessHash cache for user %d due to task failure", task.ChatID)
+		autosendLog.Ctx(ctx).Infof("Cleared AccessHash cache for user %d due to task failure", task.ChatID)
+	} else if task.ChatID < -1000000000000 && asp.accessHashManager != nil {
+		channelID := -task.ChatID - 1000000000000
+		asp.accessHashManager.ClearChannelCache(channelID)
+		autosendLog.Ctx(ctx).Infof("Cleared AccessHash cache for channel %d due to task failure", channelID)
 	}
 
-	// 不再自动禁用任务，而是记录失败并继续尝试
-	// 这样可以避免因为临时的网络问题或AccessHash失效而永久停止任务
-	logger.Warnf("Task %d (chat %d) will continue to retry despite failures", task.ID, task.ChatID)
+	// 增加失败计数到数据库，用于监控
+	asp.recordTaskFailure(task.ID, err)
 
-	// 可选：增加失败计数到数据库，用于监控
-	asp.recordTaskFailure(task.ID)
+	// 只有连续多次失败才自动禁用，单次的FLOOD_WAIT或网络问题不会停止任务
+	if failures >= autosendMaxConsecutiveFailures {
+		asp.disableFailingTask(ctx, task, failures)
+		return
+	}
+	autosendLog.Ctx(ctx).Warnf("Task %d (chat %d) failed %d time(s) in a row, will continue to retry", task.ID, task.ChatID, failures)
 }
 
 // recordTaskFailure 记录任务失败
-func (asp *AutoSendPlugin) recordTaskFailure(taskID int64) {
+func (asp *AutoSendPlugin) recordTaskFailure(taskID int64, taskErr error) {
 	// 检查失败记录表是否存在
 	var count int
 	err := asp.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='autosend_task_failures'").Scan(&count)
@@ -513,22 +634,22 @@ func (asp *AutoSendPlugin) recordTaskFailure(taskID int64) {
 		`
 		_, err = asp.db.Exec(createFailureTableSQL)
 		if err != nil {
-			logger.Errorf("Failed to create failure table: %v", err)
+			autosendLog.Errorf("Failed to create failure table: %v", err)
 			return
 		}
 	}
 
 	// 更新或插入失败记录
-	_, err = asp.db.Exec(`
+	_, err = storage.Exec(asp.db, `
 		INSERT OR REPLACE INTO autosend_task_failures 
 		(task_id, failure_count, last_failure, last_error)
 		VALUES (?, 
 			COALESCE((SELECT failure_count FROM autosend_task_failures WHERE task_id = ?), 0) + 1,
 			?, ?)
-	`, taskID, taskID, time.Now().Format("2006-01-02 15:04:05"), "Task execution failed")
+	`, taskID, taskID, time.Now().Format("2006-01-02 15:04:05"), taskErr.Error())
 
 	if err != nil {
-		logger.Errorf("Failed to record task failure for task %d: %v", taskID, err)
+		autosendLog.Errorf("Failed to record task failure for task %d: %v", taskID, err)
 	}
 }
 
@@ -560,6 +681,12 @@ func (asp *AutoSendPlugin) handleAutoSend(ctx *command.CommandContext) error {
 		return asp.handleStats(ctx)
 	case "next":
 		return asp.handleNext(ctx)
+	case "defer":
+		return asp.handleDefer(ctx)
+	case "edit":
+		return asp.handleEdit(ctx)
+	case "history":
+		return asp.handleHistory(ctx)
 	case "help":
 		return asp.sendHelp(ctx)
 	default:
@@ -569,43 +696,81 @@ func (asp *AutoSendPlugin) handleAutoSend(ctx *command.CommandContext) error {
 
 // handleAdd 处理添加任务
 func (asp *AutoSendPlugin) handleAdd(ctx *command.CommandContext) error {
-	if len(ctx.Args) < 2 {
-		return asp.sendResponse(ctx, "用法: .autosend add <cron表达式> <消息内容>\n例如: .autosend add 0 0 0 * * * 每天0点发送消息\n\nCron表达式格式: 秒 分 时 日 月 周\n常用示例:\n• 0 0 0 * * * - 每天0点\n• 0 30 12 * * * - 每天12:30\n• 0 */10 * * * * - 每10分钟\n\n注意: 不需要使用引号包围cron表达式")
+	// 可选的 --chat <chatID|@username> 指定发送目标，默认发送到当前对话
+	target, ok := ctx.Flag("chat")
+	if ok && target == "" {
+		return asp.sendResponse(ctx, "用法: .autosend add --chat <chatID|@username> <秒> <分> <时> <日> <月> <周> <消息内容>")
+	}
+	args := ctx.Args
+
+	if len(args) < 2 {
+		return asp.sendResponse(ctx, "用法: .autosend add [--chat <chatID|@username>] [--media] <cron表达式> <消息内容>\n例如: .autosend add 0 0 0 * * * 每天0点发送消息\n\nCron表达式格式: 秒 分 时 日 月 周\n常用示例:\n• 0 0 0 * * * - 每天0点\n• 0 30 12 * * * - 每天12:30\n• 0 */10 * * * * - 每10分钟\n\n注意: 不需要使用引号包围cron表达式")
+	}
+
+	// 可选的 tz=<时区> 指定按哪个时区解析cron表达式
+	tz, hasTZ, err := parseTimezoneArg(args[1])
+	if err != nil {
+		return asp.sendResponse(ctx, "❌ "+err.Error())
+	}
+	first := 1
+	if hasTZ {
+		first = 2
 	}
 
 	// 重新组合cron表达式和消息
-	// 假设cron表达式是前6个参数，剩余的是消息内容
-	if len(ctx.Args) < 7 {
-		return asp.sendResponse(ctx, "参数不足。用法: .autosend add <秒> <分> <时> <日> <月> <周> <消息内容>\n例如: .autosend add 0 0 0 * * * 每天0点签到")
+	// 假设cron表达式是时区之后的6个参数，剩余的是消息内容
+	if len(args) < first+6 {
+		return asp.sendResponse(ctx, "参数不足。用法: .autosend add [--chat <chatID|@username>] [--media] [tz=<时区>] <秒> <分> <时> <日> <月> <周> <消息内容>\n例如: .autosend add 0 0 0 * * * 每天0点签到")
 	}
 
-	// 构建cron表达式（前6个参数）
-	cronFields := ctx.Args[1:7]
+	// 构建cron表达式（6个参数）
+	cronFields := args[first : first+6]
 	cronExpr := strings.Join(cronFields, " ")
 
 	// 验证cron表达式 - 使用支持秒字段的解析器
 	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	_, err := parser.Parse(cronExpr)
+	_, err = parser.Parse(cronExpr)
 	if err != nil {
 		return asp.sendResponse(ctx, "无效的cron表达式: "+err.Error()+"\n\n格式: 秒 分 时 日 月 周\n示例:\n• 0 0 0 * * * - 每天0点\n• 0 30 12 * * * - 每天12:30\n• 0 */10 * * * * - 每10分钟")
 	}
 
-	// 组合消息内容（第7个参数开始）
-	message := strings.Join(ctx.Args[7:], " ")
-	if len(message) == 0 {
+	// --media 发送被回复消息中的图片或文件，消息内容作为说明，可以为空
+	task := &AutoSendTask{CronExpr: cronExpr, Timezone: tz, Enabled: true}
+	if ctx.HasFlag("media") {
+		source, err := fetchReplyMessage(ctx)
+		if err != nil {
+			return asp.sendResponse(ctx, "❌ 使用 --media 时请回复包含图片或文件的消息")
+		}
+		if err := task.setMedia(source); err != nil {
+			return asp.sendResponse(ctx, "❌ "+err.Error())
+		}
+		task.SourceChatID, task.SourceMsgID = ctx.Message.ChatID, source.ID
+	}
+
+	// 消息内容为cron表达式之后的原始文本，保留引号和换行
+	message := ctx.ArgsStringFrom(first + 6)
+	if len(message) == 0 && !task.HasMedia() {
 		return asp.sendResponse(ctx, "消息内容不能为空")
 	}
 
-	// 创建任务
+	// 创建任务，指定了目标时先确认能解析到该对话再写入数据库
 	chatID := ctx.Message.ChatID
+	if target != "" {
+		resolved, err := asp.resolveTarget(ctx.Context, target)
+		if err != nil {
+			return asp.sendResponse(ctx, fmt.Sprintf("❌ 无法解析目标对话 %s: %v", target, err))
+		}
+		chatID = resolved
+	}
 
 	// 计算下次运行时间（用于显示，实际调度由cron管理）
-	nextRun := asp.calculateNextRunTime(cronExpr)
+	nextRun := asp.calculateNextRunTime(asp.taskSpec(task))
 
-	result, err := asp.db.Exec(`
-		INSERT INTO autosend_tasks (chat_id, message, cron_expr, enabled, next_run)
-		VALUES (?, ?, ?, 1, ?)
-	`, chatID, message, cronExpr, nextRun.Format("2006-01-02 15:04:05"))
+	result, err := storage.Exec(asp.db, `
+		INSERT INTO autosend_tasks (chat_id, message, cron_expr, enabled, next_run, media_type, media_ref, source_chat_id, source_msg_id, timezone)
+		VALUES (?, ?, ?, 1, ?, ?, ?, ?, ?, ?)
+	`, chatID, message, cronExpr, nextRun.Local().Format("2006-01-02 15:04:05"),
+		task.MediaType, encodeMediaRef(task.MediaRef), task.SourceChatID, task.SourceMsgID, tz)
 
 	if err != nil {
 		return asp.sendResponse(ctx, "创建任务失败: "+err.Error())
@@ -613,19 +778,15 @@ func (asp *AutoSendPlugin) handleAdd(ctx *command.CommandContext) error {
 
 	taskID, _ := result.LastInsertId()
 
-	// 创建任务对象
-	task := &AutoSendTask{
-		ID:       taskID,
-		ChatID:   chatID,
-		Message:  message,
-		CronExpr: cronExpr,
-		NextRun:  nextRun,
-		Enabled:  true,
-		Created:  time.Now(),
-	}
+	// 补全任务对象
+	task.ID = taskID
+	task.ChatID = chatID
+	task.Message = message
+	task.NextRun = nextRun
+	task.Created = time.Now()
 
 	// 添加到cron调度器
-	cronID, err := asp.cronScheduler.AddFunc(cronExpr, func() {
+	cronID, err := asp.cronScheduler.AddFunc(asp.taskSpec(task), func() {
 		asp.executeTask(task)
 	})
 	if err != nil {
@@ -646,74 +807,14 @@ func (asp *AutoSendPlugin) handleAdd(ctx *command.CommandContext) error {
 		"任务ID: %d\n"+
 		"发送到: %s\n"+
 		"Cron表达式: %s\n"+
-		"消息: %s\n"+
+		"时区: %s\n"+
+		"消息: %s%s\n"+
 		"下次运行: %s\n"+
 		"创建时间: %s",
-		taskID, chatInfo, cronExpr, message, nextRun.Format("2006-01-02 15:04:05"), time.Now().Format("2006-01-02 15:04:05"))
-
-	// 发送响应
-	err = asp.sendResponse(ctx, response)
-	if err != nil {
-		return err
-	}
-
-	// 15秒后自动删除原始命令消息
-	go func() {
-		time.Sleep(15 * time.Second)
-		asp.deleteMessageWithRetry(ctx)
-	}()
-
-	return nil
-}
-
-// deleteMessage 删除消息的辅助函数
-func (asp *AutoSendPlugin) deleteMessage(ctx *command.CommandContext) {
-	deleteCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	logger.Debugf("Attempting to delete command message %d in chat %d", ctx.Message.Message.ID, ctx.Message.ChatID)
-
-	// 解析聊天ID为peer
-	peer, err := asp.peerResolver.ResolveFromChatID(deleteCtx, ctx.Message.ChatID)
-	if err != nil {
-		logger.Debugf("Failed to resolve peer for message deletion: %v", err)
-		return
-	}
-
-	// 根据聊天类型选择不同的删除方法
-	if ctx.Message.ChatID > 0 {
-		// 私聊 - 使用普通删除
-		_, err = asp.telegramAPI.MessagesDeleteMessages(deleteCtx, &tg.MessagesDeleteMessagesRequest{
-			ID: []int{ctx.Message.Message.ID},
-		})
-	} else {
-		// 群聊/频道 - 使用带peer的删除
-		_, err = asp.telegramAPI.MessagesDeleteHistory(deleteCtx, &tg.MessagesDeleteHistoryRequest{
-			Peer:      peer,
-			MaxID:     ctx.Message.Message.ID,
-			JustClear: false,
-		})
-	}
+		taskID, chatInfo, cronExpr, asp.timezoneLabel(task), message, mediaMarker(task), asp.nextRunInTimezone(task).Format("2006-01-02 15:04:05"), time.Now().Format("2006-01-02 15:04:05"))
 
-	if err != nil {
-		logger.Infof("Failed to delete command message %d: %v", ctx.Message.Message.ID, err)
-	} else {
-		logger.Infof("Successfully deleted command message %d", ctx.Message.Message.ID)
-	}
-}
-
-// deleteMessageWithRetry 带重试机制的删除消息函数
-func (asp *AutoSendPlugin) deleteMessageWithRetry(ctx *command.CommandContext) {
-	logger.Debugf("Starting 15-second countdown to delete command message %d", ctx.Message.Message.ID)
-
-	// 简单检查，如果API不可用则直接跳过
-	if asp.telegramAPI == nil || asp.peerResolver == nil {
-		logger.Infof("Skipping message deletion: Telegram API not available")
-		return
-	}
-
-	// 调用原始删除函数
-	asp.deleteMessage(ctx)
+	// 发送响应，15秒后自动删除
+	return asp.sendEphemeral(ctx, response)
 }
 
 // parseFlexibleTimeString 解析时间字符串，支持多种格式
@@ -743,10 +844,10 @@ func (asp *AutoSendPlugin) parseFlexibleTimeString(timeStr string) (time.Time, e
 	return time.Time{}, fmt.Errorf("unable to parse time string: %s", timeStr)
 }
 
-// calculateNextRunTime 动态计算下次运行时间
-func (asp *AutoSendPlugin) calculateNextRunTime(cronExpr string) time.Time {
+// calculateNextRunTime 动态计算下次运行时间，spec可以带有 CRON_TZ 前缀
+func (asp *AutoSendPlugin) calculateNextRunTime(spec string) time.Time {
 	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	schedule, err := parser.Parse(cronExpr)
+	schedule, err := parser.Parse(spec)
 	if err != nil {
 		// 如果解析失败，返回当前时间（表示无法计算）
 		return time.Now()
@@ -778,23 +879,31 @@ func (asp *AutoSendPlugin) handleList(ctx *command.CommandContext) error {
 		chatInfo := asp.getChatInfo(task.ChatID)
 
 		// 动态计算下次运行时间
-		nextRunTime := asp.calculateNextRunTime(task.CronExpr)
+		nextRunTime := asp.nextRunInTimezone(task)
 		relativeTime := asp.formatRelativeTime(nextRunTime, time.Now())
 
-		response.WriteString(fmt.Sprintf("ID: %d %s\n", task.ID, status))
+		response.WriteString(fmt.Sprintf("ID: %d %s%s\n", task.ID, status, mediaMarker(task)))
 		response.WriteString(fmt.Sprintf("发送到: %s\n", chatInfo))
 		response.WriteString(fmt.Sprintf("Cron表达式: %s\n", task.CronExpr))
+		response.WriteString(fmt.Sprintf("时区: %s\n", asp.timezoneLabel(task)))
 		response.WriteString(fmt.Sprintf("消息: %s\n", task.Message))
 		response.WriteString(fmt.Sprintf("下次运行: %s (%s)\n",
 			nextRunTime.Format("2006-01-02 15:04:05"), relativeTime))
 		response.WriteString(fmt.Sprintf("创建时间: %s\n", task.Created.Format("2006-01-02 15:04:05")))
+		response.WriteString(fmt.Sprintf("上次运行: %s\n", formatLastRun(task)))
 		response.WriteString("─────────────\n")
 	}
 
 	return asp.sendResponse(ctx, response.String())
 }
 
-// getChatInfo 获取聊天信息
+// chatTitles 对话标题缓存，避免每次列出任务时都请求API
+var chatTitles = cache.New[int64, string]("autosend_chat_titles", cache.Options{
+	TTL:        time.Hour,
+	MaxEntries: 500,
+})
+
+// getChatInfo 获取任务目标对话的描述，包括类型和标题
 func (asp *AutoSendPlugin) getChatInfo(chatID int64) string {
 	// 如果没有peerResolver，返回chatID
 	if asp.peerResolver == nil {
@@ -802,28 +911,132 @@ func (asp *AutoSendPlugin) getChatInfo(chatID int64) string {
 	}
 
 	// 尝试解析聊天信息
-	ctx := context.Background()
-	peer, err := asp.peerResolver.ResolveFromChatID(ctx, chatID)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	peer, err := asp.resolvePeerForTask(ctx, chatID)
 	if err != nil {
 		return fmt.Sprintf("Chat ID: %d", chatID)
 	}
 
+	title, _ := chatTitles.Fill(chatID, func() (string, time.Duration, error) {
+		title, err := fetchPeerTitle(ctx, asp.telegramAPI, peer)
+		return title, 0, err
+	})
+	if title != "" {
+		title = " " + title
+	}
+
 	// 根据peer类型返回不同的信息
 	switch peer.(type) {
 	case *tg.InputPeerUser:
 		// 私聊用户
-		return fmt.Sprintf("私聊用户 (ID: %d)", chatID)
+		return fmt.Sprintf("私聊用户%s (ID: %d)", title, chatID)
 	case *tg.InputPeerChat:
 		// 普通群聊
-		return fmt.Sprintf("群聊 (ID: %d)", chatID)
+		return fmt.Sprintf("群聊%s (ID: %d)", title, chatID)
 	case *tg.InputPeerChannel:
 		// 频道或超级群
-		return fmt.Sprintf("频道/超级群 (ID: %d)", chatID)
+		return fmt.Sprintf("频道/超级群%s (ID: %d)", title, chatID)
 	default:
 		return fmt.Sprintf("Chat ID: %d", chatID)
 	}
 }
 
+// resolveTarget 解析 --chat 指定的目标对话(chatID 或 @username)，
+// 通过API获取对话信息确认可以访问，返回项目使用的chatID
+func (asp *AutoSendPlugin) resolveTarget(ctx context.Context, target string) (int64, error) {
+	if asp.telegramAPI == nil || asp.peerResolver == nil {
+		return 0, fmt.Errorf("Telegram API 未就绪")
+	}
+
+	chatID, err := strconv.ParseInt(target, 10, 64)
+	if err != nil {
+		resolved, err := resolveUsername(ctx, asp.telegramAPI, target)
+		if err != nil {
+			return 0, explainPeerError(err)
+		}
+		if asp.accessHashManager != nil {
+			asp.accessHashManager.CacheUsersFromUpdate(resolved.Users)
+			asp.accessHashManager.CacheChatsFromUpdate(resolved.Chats)
+		}
+		chatID = peerToChatID(resolved.Peer)
+		if chatID == 0 {
+			return 0, fmt.Errorf("不支持的对话类型")
+		}
+	}
+
+	peer, err := asp.resolvePeerForTask(ctx, chatID)
+	if err != nil {
+		return 0, explainPeerError(err)
+	}
+	title, err := fetchPeerTitle(ctx, asp.telegramAPI, peer)
+	if err != nil {
+		return 0, explainPeerError(err)
+	}
+	chatTitles.Set(chatID, title)
+	return chatID, nil
+}
+
+// explainPeerError 为常见的对话解析错误附加说明
+func explainPeerError(err error) error {
+	switch {
+	case tgerr.Is(err, "PEER_ID_INVALID"):
+		return fmt.Errorf("%w (对话不存在，或尚未与该对话建立联系)", err)
+	case tgerr.Is(err, "CHANNEL_PRIVATE", "CHANNEL_INVALID", "CHAT_ID_INVALID"):
+		return fmt.Errorf("%w (不在该群组/频道中或无权访问)", err)
+	case tgerr.Is(err, "USERNAME_NOT_OCCUPIED", "USERNAME_INVALID"):
+		return fmt.Errorf("%w (用户名不存在)", err)
+	}
+	return err
+}
+
+// fetchPeerTitle 获取对话的标题，用户返回其名字
+func fetchPeerTitle(ctx context.Context, api *tg.Client, peer tg.InputPeerClass) (string, error) {
+	if api == nil {
+		return "", fmt.Errorf("Telegram API 未就绪")
+	}
+
+	switch p := peer.(type) {
+	case *tg.InputPeerSelf:
+		return "收藏夹", nil
+	case *tg.InputPeerUser:
+		users, err := api.UsersGetUsers(ctx, []tg.InputUserClass{&tg.InputUser{UserID: p.UserID, AccessHash: p.AccessHash}})
+		if err != nil {
+			return "", err
+		}
+		for _, u := range users {
+			if user, ok := u.(*tg.User); ok && user.ID == p.UserID {
+				name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+				if user.Username != "" {
+					name = strings.TrimSpace(name + " @" + user.Username)
+				}
+				return name, nil
+			}
+		}
+	case *tg.InputPeerChat:
+		chats, err := api.MessagesGetChats(ctx, []int64{p.ChatID})
+		if err != nil {
+			return "", err
+		}
+		for _, c := range chats.GetChats() {
+			if chat, ok := c.(*tg.Chat); ok && chat.ID == p.ChatID {
+				return chat.Title, nil
+			}
+		}
+	case *tg.InputPeerChannel:
+		chats, err := api.ChannelsGetChannels(ctx, []tg.InputChannelClass{&tg.InputChannel{ChannelID: p.ChannelID, AccessHash: p.AccessHash}})
+		if err != nil {
+			return "", err
+		}
+		for _, c := range chats.GetChats() {
+			if channel, ok := c.(*tg.Channel); ok && channel.ID == p.ChannelID {
+				return channel.Title, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("对话不存在")
+}
+
 // handleRemove 处理删除任务
 func (asp *AutoSendPlugin) handleRemove(ctx *command.CommandContext) error {
 	if len(ctx.Args) < 2 {
@@ -853,23 +1066,15 @@ func (asp *AutoSendPlugin) handleRemove(ctx *command.CommandContext) error {
 	if err != nil {
 		return asp.sendResponse(ctx, "删除任务失败: "+err.Error())
 	}
+	if _, err := asp.db.Exec("DELETE FROM autosend_runs WHERE task_id = ?", taskID); err != nil {
+		autosendLog.Warnf("Failed to delete run history of task %d: %v", taskID, err)
+	}
 
 	// 从内存删除
 	delete(asp.tasks, taskID)
 
-	// 发送响应
-	err = asp.sendResponse(ctx, fmt.Sprintf("✅ 任务 %d 已删除", taskID))
-	if err != nil {
-		return err
-	}
-
-	// 15秒后自动删除原始命令消息
-	go func() {
-		time.Sleep(15 * time.Second)
-		asp.deleteMessageWithRetry(ctx)
-	}()
-
-	return nil
+	// 发送响应，15秒后自动删除
+	return asp.sendEphemeral(ctx, fmt.Sprintf("✅ 任务 %d 已删除", taskID))
 }
 
 // handleEnable 处理启用任务
@@ -895,14 +1100,14 @@ func (asp *AutoSendPlugin) handleEnable(ctx *command.CommandContext) error {
 		return asp.sendResponse(ctx, "任务已经是启用状态")
 	}
 
-	// 更新数据库
-	_, err = asp.db.Exec("UPDATE autosend_tasks SET enabled = 1 WHERE id = ?", taskID)
+	// 更新数据库，重新启用时清零连续失败次数
+	_, err = asp.db.Exec("UPDATE autosend_tasks SET enabled = 1, consecutive_failures = 0 WHERE id = ?", taskID)
 	if err != nil {
 		return asp.sendResponse(ctx, "启用任务失败: "+err.Error())
 	}
 
 	// 重新添加到cron调度器
-	cronID, err := asp.cronScheduler.AddFunc(task.CronExpr, func() {
+	cronID, err := asp.cronScheduler.AddFunc(asp.taskSpec(task), func() {
 		asp.executeTask(task)
 	})
 	if err != nil {
@@ -912,19 +1117,170 @@ func (asp *AutoSendPlugin) handleEnable(ctx *command.CommandContext) error {
 	// 更新内存
 	task.Enabled = true
 	task.cronID = cronID
+	task.ConsecutiveFailures = 0
+
+	// 发送响应，15秒后自动删除
+	return asp.sendEphemeral(ctx, fmt.Sprintf("✅ 任务 %d 已启用", taskID))
+}
+
+// handleDefer 设置任务在维护窗口期间是否延迟补发
+func (asp *AutoSendPlugin) handleDefer(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 3 || (ctx.Args[2] != "on" && ctx.Args[2] != "off") {
+		return asp.sendResponse(ctx, "用法: .autosend defer <任务ID> <on|off>")
+	}
 
-	// 发送响应
-	err = asp.sendResponse(ctx, fmt.Sprintf("✅ 任务 %d 已启用", taskID))
+	taskID, err := strconv.ParseInt(ctx.Args[1], 10, 64)
 	if err != nil {
-		return err
+		return asp.sendResponse(ctx, "无效的任务ID")
 	}
 
-	// 15秒后自动删除原始命令消息
-	go func() {
-		time.Sleep(15 * time.Second)
-		asp.deleteMessageWithRetry(ctx)
-	}()
+	deferOK := ctx.Args[2] == "on"
 
+	asp.tasksMutex.Lock()
+	defer asp.tasksMutex.Unlock()
+
+	task, exists := asp.tasks[taskID]
+	if !exists {
+		return asp.sendResponse(ctx, "任务不存在")
+	}
+
+	// 更新数据库
+	_, err = asp.db.Exec("UPDATE autosend_tasks SET defer_ok = ? WHERE id = ?", deferOK, taskID)
+	if err != nil {
+		return asp.sendResponse(ctx, "更新任务失败: "+err.Error())
+	}
+
+	// 更新内存
+	task.DeferOK = deferOK
+
+	if deferOK {
+		return asp.sendResponse(ctx, fmt.Sprintf("✅ 任务 %d 在维护窗口期间将延迟到窗口结束后补发", taskID))
+	}
+	return asp.sendResponse(ctx, fmt.Sprintf("✅ 任务 %d 在维护窗口期间将被跳过", taskID))
+}
+
+// handleEdit 修改任务的cron表达式或消息内容，保留任务ID和历史记录
+func (asp *AutoSendPlugin) handleEdit(ctx *command.CommandContext) error {
+	usage := "用法:\n• .autosend edit <任务ID> cron <秒> <分> <时> <日> <月> <周>\n• .autosend edit <任务ID> message <新消息内容>"
+	if len(ctx.Args) < 4 {
+		return asp.sendResponse(ctx, usage)
+	}
+
+	taskID, err := strconv.ParseInt(ctx.Args[1], 10, 64)
+	if err != nil {
+		return asp.sendResponse(ctx, "无效的任务ID")
+	}
+
+	var response string
+	switch ctx.Args[2] {
+	case "cron":
+		if len(ctx.Args) != 9 {
+			return asp.sendResponse(ctx, "cron表达式需要6个字段: 秒 分 时 日 月 周\n例如: .autosend edit "+ctx.Args[1]+" cron 0 30 12 * * *")
+		}
+		response, err = asp.editCron(taskID, strings.Join(ctx.Args[3:9], " "))
+	case "message", "msg":
+		response, err = asp.editMessage(taskID, ctx.ArgsStringFrom(3))
+	default:
+		return asp.sendResponse(ctx, usage)
+	}
+	if err != nil {
+		return asp.sendResponse(ctx, "❌ "+err.Error())
+	}
+
+	// 发送响应，15秒后自动删除
+	return asp.sendEphemeral(ctx, response)
+}
+
+// editCron 修改任务的cron表达式。启用的任务先添加新的调度再移除旧的，
+// 整个替换过程持有tasksMutex，任何时刻调度器中都只有该任务的一个有效条目
+func (asp *AutoSendPlugin) editCron(taskID int64, cronExpr string) (string, error) {
+	// 验证cron表达式 - 使用支持秒字段的解析器
+	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+	if _, err := parser.Parse(cronExpr); err != nil {
+		return "", fmt.Errorf("无效的cron表达式: %v", err)
+	}
+
+	asp.tasksMutex.Lock()
+	defer asp.tasksMutex.Unlock()
+
+	task, exists := asp.tasks[taskID]
+	if !exists {
+		// 启动时只加载启用的任务，禁用的任务只需要更新数据库
+		stored := &AutoSendTask{CronExpr: cronExpr}
+		asp.db.QueryRow("SELECT COALESCE(timezone, '') FROM autosend_tasks WHERE id = ?", taskID).Scan(&stored.Timezone)
+		nextRun := asp.calculateNextRunTime(asp.taskSpec(stored))
+		if err := asp.updateStoredTask(taskID, "UPDATE autosend_tasks SET cron_expr = ?, next_run = ? WHERE id = ?",
+			cronExpr, nextRun.Local().Format("2006-01-02 15:04:05"), taskID); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("✅ 任务 %d 的cron表达式已更新为 %s\n任务已禁用，启用后生效", taskID, cronExpr), nil
+	}
+
+	spec := cronSpec(cronExpr, asp.effectiveTimezone(task))
+	nextRun := asp.calculateNextRunTime(spec)
+	var newID cron.EntryID
+	if task.Enabled {
+		var err error
+		newID, err = asp.cronScheduler.AddFunc(spec, func() {
+			asp.executeTask(task)
+		})
+		if err != nil {
+			return "", fmt.Errorf("添加到调度器失败: %v", err)
+		}
+	}
+
+	if err := asp.updateStoredTask(taskID, "UPDATE autosend_tasks SET cron_expr = ?, next_run = ? WHERE id = ?",
+		cronExpr, nextRun.Local().Format("2006-01-02 15:04:05"), taskID); err != nil {
+		if newID != 0 {
+			asp.cronScheduler.Remove(newID)
+		}
+		return "", err
+	}
+
+	if task.Enabled {
+		if task.cronID != 0 {
+			asp.cronScheduler.Remove(task.cronID)
+		}
+		task.cronID = newID
+	}
+	oldExpr := task.CronExpr
+	task.CronExpr = cronExpr
+	task.NextRun = nextRun
+
+	if !task.Enabled {
+		return fmt.Sprintf("✅ 任务 %d 的cron表达式已更新\n%s → %s\n任务已禁用，启用后生效", taskID, oldExpr, cronExpr), nil
+	}
+	return fmt.Sprintf("✅ 任务 %d 的cron表达式已更新\n%s → %s\n下次运行: %s",
+		taskID, oldExpr, cronExpr, nextRun.Format("2006-01-02 15:04:05")), nil
+}
+
+// editMessage 修改任务的消息内容
+func (asp *AutoSendPlugin) editMessage(taskID int64, message string) (string, error) {
+	if strings.TrimSpace(message) == "" {
+		return "", fmt.Errorf("消息内容不能为空")
+	}
+
+	asp.tasksMutex.Lock()
+	defer asp.tasksMutex.Unlock()
+
+	if err := asp.updateStoredTask(taskID, "UPDATE autosend_tasks SET message = ? WHERE id = ?", message, taskID); err != nil {
+		return "", err
+	}
+	if task, exists := asp.tasks[taskID]; exists {
+		task.Message = message
+	}
+	return fmt.Sprintf("✅ 任务 %d 的消息已更新为:\n%s", taskID, message), nil
+}
+
+// updateStoredTask 更新数据库中的任务，任务不存在时返回错误
+func (asp *AutoSendPlugin) updateStoredTask(taskID int64, query string, args ...interface{}) error {
+	result, err := storage.Exec(asp.db, query, args...)
+	if err != nil {
+		return fmt.Errorf("更新任务失败: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("任务不存在")
+	}
 	return nil
 }
 
@@ -966,19 +1322,8 @@ func (asp *AutoSendPlugin) handleDisable(ctx *command.CommandContext) error {
 	// 更新内存
 	task.Enabled = false
 
-	// 发送响应
-	err = asp.sendResponse(ctx, fmt.Sprintf("✅ 任务 %d 已禁用", taskID))
-	if err != nil {
-		return err
-	}
-
-	// 15秒后自动删除原始命令消息
-	go func() {
-		time.Sleep(15 * time.Second)
-		asp.deleteMessageWithRetry(ctx)
-	}()
-
-	return nil
+	// 发送响应，15秒后自动删除
+	return asp.sendEphemeral(ctx, fmt.Sprintf("✅ 任务 %d 已禁用", taskID))
 }
 
 // handleCheck 处理检查任务有效性
@@ -1285,7 +1630,7 @@ func (asp *AutoSendPlugin) handleNext(ctx *command.CommandContext) error {
 		}
 
 		// 动态计算下次运行时间
-		nextRunTime := asp.calculateNextRunTime(task.CronExpr)
+		nextRunTime := asp.nextRunInTimezone(task)
 
 		// 计算相对时间
 		relativeTime := asp.formatRelativeTime(nextRunTime, now)
@@ -1295,7 +1640,7 @@ func (asp *AutoSendPlugin) handleNext(ctx *command.CommandContext) error {
 
 		response.WriteString(fmt.Sprintf("ID: %d\n", task.ID))
 		response.WriteString(fmt.Sprintf("发送到: %s\n", chatInfo))
-		response.WriteString(fmt.Sprintf("Cron表达式: %s\n", task.CronExpr))
+		response.WriteString(fmt.Sprintf("Cron表达式: %s (%s)\n", task.CronExpr, asp.timezoneLabel(task)))
 		response.WriteString(fmt.Sprintf("下次运行: %s (%s)\n",
 			nextRunTime.Format("2006-01-02 15:04:05"), relativeTime))
 		response.WriteString(fmt.Sprintf("消息: %s\n", task.Message))
@@ -1335,6 +1680,9 @@ func (asp *AutoSendPlugin) sendHelp(ctx *command.CommandContext) error {
 
 📝 基本命令:
 • .autosend add <秒> <分> <时> <日> <月> <周> <消息内容> - 创建定时发送任务
+• .autosend add --chat <chatID|@username> <cron...> <消息内容> - 发送到指定对话
+• 回复图片或文件 .autosend add --media <cron...> [说明] - 定时发送该图片或文件，消息内容作为说明
+• .autosend add tz=<时区> <cron...> <消息内容> - 按指定时区(如 Asia/Shanghai)解析cron表达式
 • .autosend list - 列出所有任务
 • .autosend next - 显示任务下次运行时间（含相对时间）
 • .autosend remove <ID> - 删除任务
@@ -1344,6 +1692,10 @@ func (asp *AutoSendPlugin) sendHelp(ctx *command.CommandContext) error {
 • .autosend resolve <用户ID> - 解析用户/机器人的AccessHash
 • .autosend clear <用户ID> - 清除用户AccessHash缓存
 • .autosend stats - 查看任务统计和失败信息
+• .autosend defer <ID> <on|off> - 维护窗口期间延迟补发/跳过
+• .autosend edit <ID> cron <6个字段> - 修改任务的cron表达式
+• .autosend edit <ID> message <消息内容> - 修改任务的消息内容
+• .autosend history <ID> [数量] - 查看任务最近的执行记录
 
 📋 Cron表达式格式: 秒 分 时 日 月 周
 • 每天0点: 0 0 0 * * *
@@ -1376,45 +1728,25 @@ func (asp *AutoSendPlugin) sendHelp(ctx *command.CommandContext) error {
 • 使用 .autosend clear <用户ID> 清除缓存
 • 重新发送消息给该用户/机器人
 • 使用 .autosend resolve <用户ID> 重新解析
-• 任务失败后不会自动禁用，会继续重试
+• 任务连续失败5次后自动禁用，单次失败会继续重试
 • 使用 .autosend stats 查看失败统计信息
 
 🔌 插件信息:
 • 名称: autosend
-• 版本: v1.0.0
+• 版本: ` + version.String() + `
 • 描述: 基于cron表达式的定时自动发送消息插件`
 
 	return asp.sendResponse(ctx, helpMsg)
 }
 
-// sendResponse 发送响应消息
+// sendResponse 发送响应消息，过长时拆分为多条
 func (asp *AutoSendPlugin) sendResponse(ctx *command.CommandContext, message string) error {
-	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-	if err != nil {
-		return fmt.Errorf("failed to resolve peer: %w", err)
-	}
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
 
-	// 私聊：编辑消息，群聊：先尝试编辑，失败则发送新消息
-	if ctx.Message.ChatID > 0 {
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: message,
-		})
-		return err
-	} else {
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: message,
-		})
-		if err != nil {
-			_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-				Peer:     peer,
-				Message:  message,
-				RandomID: time.Now().UnixNano(),
-			})
-		}
-		return err
-	}
+// sendEphemeral 发送响应消息，15秒后自动删除
+func (asp *AutoSendPlugin) sendEphemeral(ctx *command.CommandContext, message string) error {
+	_, err := ctx.RespondEphemeral(message, format.Plain, 15*time.Second)
+	return err
 }
@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// 内置时区数据库，系统没有安装 tzdata 时也能解析 Asia/Shanghai 等时区
+	_ "time/tzdata"
+)
+
+// autosendTimezoneArg .autosend add 中指定任务时区的参数前缀，例如 tz=Asia/Shanghai
+const autosendTimezoneArg = "tz="
+
+// parseTimezoneArg 解析 tz=<时区> 参数，不是时区参数时ok为false
+func parseTimezoneArg(arg string) (tz string, ok bool, err error) {
+	name, ok := strings.CutPrefix(arg, autosendTimezoneArg)
+	if !ok {
+		return "", false, nil
+	}
+	if name == "" {
+		return "", true, fmt.Errorf("时区不能为空，例如 tz=Asia/Shanghai")
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return "", true, fmt.Errorf("无效的时区 %s，请使用IANA时区名称，例如 Asia/Shanghai", name)
+	}
+	return name, true, nil
+}
+
+// defaultTimezone 返回 plugins.autosend.timezone，未配置时为空字符串(服务器时区)
+func (asp *AutoSendPlugin) defaultTimezone() string {
+	if goManager, ok := asp.manager.(*GoManager); ok {
+		if cfg := goManager.GetConfig(); cfg != nil {
+			return cfg.Plugins.Autosend.Timezone
+		}
+	}
+	return ""
+}
+
+// effectiveTimezone 返回任务实际使用的时区，为空表示服务器时区
+func (asp *AutoSendPlugin) effectiveTimezone(task *AutoSendTask) string {
+	if task.Timezone != "" {
+		return task.Timezone
+	}
+	return asp.defaultTimezone()
+}
+
+// cronSpec 返回交给调度器的表达式，使用 CRON_TZ 前缀指定时区
+func cronSpec(cronExpr, tz string) string {
+	if tz == "" {
+		return cronExpr
+	}
+	return "CRON_TZ=" + tz + " " + cronExpr
+}
+
+// taskSpec 返回任务交给调度器的表达式
+func (asp *AutoSendPlugin) taskSpec(task *AutoSendTask) string {
+	return cronSpec(task.CronExpr, asp.effectiveTimezone(task))
+}
+
+// timezoneLabel 返回列表中显示的时区说明
+func (asp *AutoSendPlugin) timezoneLabel(task *AutoSendTask) string {
+	tz := asp.effectiveTimezone(task)
+	switch {
+	case tz == "":
+		return "服务器时区 " + time.Now().Format("MST")
+	case task.Timezone == "":
+		return tz + " (默认)"
+	default:
+		return tz
+	}
+}
+
+// nextRunInTimezone 返回任务的下次运行时间，以任务的时区表示
+func (asp *AutoSendPlugin) nextRunInTimezone(task *AutoSendTask) time.Time {
+	next := asp.calculateNextRunTime(asp.taskSpec(task))
+	if tz := asp.effectiveTimezone(task); tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return next.In(loc)
+		}
+	}
+	return next
+}
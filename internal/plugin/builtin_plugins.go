@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/version"
 	"nexusvalet/pkg/logger"
 	"os/exec"
+	"regexp"
 	"runtime"
 	"strings"
 	"time"
@@ -18,7 +21,8 @@ var startTime = time.Now() // 启动时间
 // CoreCommandsPlugin 核心命令插件
 type CoreCommandsPlugin struct {
 	*BasePlugin
-	telegramAPI *TelegramAPI // Telegram API用于获取账号信息
+	telegramAPI *TelegramAPI    // Telegram API用于获取账号信息
+	parser      *command.Parser // 用于生成帮助信息
 }
 
 // TelegramAPI 包装Telegram API调用
@@ -95,21 +99,44 @@ func (cp *CoreCommandsPlugin) getTelegramAccountInfo() string {
 
 // RegisterCommands 实现CommandPlugin接口
 func (cp *CoreCommandsPlugin) RegisterCommands(parser *command.Parser) error {
+	cp.parser = parser
+
 	// 注册status命令
 	parser.RegisterCommand("status", "显示系统状态信息", cp.info.Name, cp.handleStatus)
 
 	// 注册help命令
 	parser.RegisterCommand("help", "显示帮助信息", cp.info.Name, cp.handleHelp)
 
+	// 注册version命令
+	parser.RegisterCommand("version", "显示版本与构建信息", cp.info.Name, cp.handleVersion)
+
+	// 注册长时间任务管理命令
+	parser.RegisterCommand("cancel", "取消当前对话中正在运行的任务", cp.info.Name, cp.handleCancel)
+	parser.RegisterCommand("tasks", "列出正在运行的任务", cp.info.Name, cp.handleTasks)
+	parser.RegisterCommand("cache", "显示缓存统计或清理缓存", cp.info.Name, cp.handleCache)
+	parser.RegisterCommand("deprecations", "列出正在使用的已弃用命令和配置项", cp.info.Name, cp.handleDeprecations)
+	parser.RegisterOwnerCommand("sudo", "管理可以触发命令的其他账号", cp.info.Name, cp.handleSudo)
+	parser.RegisterOwnerCommand("config", "显示或重新加载配置", cp.info.Name, cp.handleConfig)
+	parser.RegisterOwnerCommand("logs", "显示最近的日志", cp.info.Name, cp.handleLogs)
+	parser.RegisterOwnerCommand("restart", "重新启动程序", cp.info.Name, cp.handleRestart)
+	parser.RegisterOwnerCommand("shutdown", "停止程序", cp.info.Name, cp.handleShutdown)
+	parser.RegisterOwnerCommand("update", "检查并安装新版本", cp.info.Name, cp.handleUpdate)
+	parser.RegisterCommand("share", "执行命令并把输出发送到其他对话", cp.info.Name, cp.handleShare)
+	parser.RegisterCommand("file", "查看回复的媒体消息的类型、大小、分辨率、时长和文件ID", cp.info.Name, cp.handleFile)
+
 	logger.Infof("Core commands registered successfully")
 	return nil
 }
 
 // handleStatus 处理status命令
 func (cp *CoreCommandsPlugin) handleStatus(ctx *command.CommandContext) error {
+	if len(ctx.Args) > 0 && ctx.Args[0] == "live" {
+		return cp.handleStatusLive(ctx, ctx.Args[1:])
+	}
+
 	// 获取系统信息
-	version := "v1.0.0"
-	goVersion := runtime.Version()
+	buildInfo := version.Get()
+	goVersion := buildInfo.GoVersion
 	currentTime := time.Now().Format("2006-01-02 15:04:05")
 	uptime := time.Since(startTime)
 
@@ -126,15 +153,27 @@ func (cp *CoreCommandsPlugin) handleStatus(ctx *command.CommandContext) error {
 
 	// 插件信息
 	pluginCount := 0
+	maintenanceLine := "🔧 当前无生效的维护窗口"
+	selfTestLine := "未执行"
+	startupLine := "无记录"
+	initLine := "无记录"
 	if goManager, ok := cp.manager.(*GoManager); ok {
 		pluginCount = len(goManager.GetAllPlugins())
+		maintenanceLine = formatMaintenanceWindows(goManager.GetMaintenanceGate(), false)
+		if report := goManager.GetSelfTestReport(); report != nil {
+			selfTestLine = report.Short()
+		}
+		if report := goManager.GetStartupReport(); report != nil {
+			startupLine = report.Summary()
+		}
+		initLine = formatInitTimings(goManager.InitTimings(), 5)
 	}
 
 	// 格式化运行时间
 	uptimeStr := cp.formatUptime(uptime)
 
 	// 格式化内存大小
-	sysStr := cp.formatMemorySize(m.Sys)
+	sysStr := formatMemorySize(m.Sys)
 
 	// 获取Telegram账号信息
 	accountLine := cp.getTelegramAccountInfo()
@@ -148,585 +187,149 @@ func (cp *CoreCommandsPlugin) handleStatus(ctx *command.CommandContext) error {
    • 系统: %s/%s
    • Kernel 版本: %s
    • NexusValet版本: %s
+   • 构建信息: %s
 内存使用:
    • 系统占用: %s
 插件状态:
    • 已加载插件: %d 个
+维护窗口:
+   • %s
+启动自检:
+   • %s
+启动耗时:
+   • %s
+   • 插件初始化: %s
+账号限制:
+   • %s
+媒体压缩:
+   • %s
 状态检查时间: %s`,
-		accountLine, uptimeStr, goVersion, systemOS, systemArch, kernelVersion, version,
-		sysStr, pluginCount, currentTime)
+		accountLine, uptimeStr, goVersion, systemOS, systemArch, kernelVersion, buildInfo.Version, cp.formatBuildInfo(buildInfo),
+		sysStr, pluginCount, maintenanceLine, selfTestLine, startupLine, initLine, formatLimits(), formatMediaStats(), currentTime)
 
-	// 直接使用gotd API发送响应
-	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-	if err != nil {
-		return fmt.Errorf("failed to resolve peer: %w", err)
-	}
-
-	// 私聊：编辑消息，群聊：先尝试编辑，失败则发送新消息
-	if ctx.Message.ChatID > 0 {
-		// 私聊：编辑原消息
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: statusMsg,
-		})
-		return err
-	} else {
-		// 群聊：先尝试编辑
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: statusMsg,
-		})
-		if err != nil {
-			// 编辑失败，发送新消息
-			_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-				Peer:     peer,
-				Message:  statusMsg,
-				RandomID: time.Now().UnixNano(),
-			})
-		}
-		return err
-	}
+	return cp.sendResponse(ctx, statusMsg)
 }
 
-// handleHelp 处理help命令
+// handleVersion 处理version命令
+func (cp *CoreCommandsPlugin) handleVersion(ctx *command.CommandContext) error {
+	buildInfo := version.Get()
+	versionMsg := fmt.Sprintf("NexusValet %s\n构建信息: %s", buildInfo.Version, cp.formatBuildInfo(buildInfo))
+	return cp.sendResponse(ctx, versionMsg)
+}
+
+// handleHelp 处理help命令：按插件分组列出已注册的命令，.help <插件名|命令名> 显示插件的详细帮助
 func (cp *CoreCommandsPlugin) handleHelp(ctx *command.CommandContext) error {
+	if cp.parser == nil {
+		return cp.sendResponse(ctx, "命令解析器不可用")
+	}
 	if len(ctx.Args) == 0 {
-		// 显示所有命令
-		helpMsg := `📖 NexusValet 帮助信息
-
-🔧 可用命令:
-• .status - 显示系统状态信息
-• .help - 显示此帮助信息
-• .help <插件名> - 显示特定插件的帮助
-• .st [服务器ID] - 网络速度测试
-• .st list - 列出附近的测速服务器
-• .sb [用户ID/用户名] [不删除消息] - 超级封禁用户并删除消息历史
-• .gemini <问题> - Gemini AI智能问答(自动识别文本/图片)
-• .gm <问题> - Gemini简写命令
-• .autosend <命令> - 基于cron表达式的定时发送
-• .as <命令> - autosend简写命令
-• .dme [数量] - 删除当前对话中您发送的特定数量消息
-• .ids [用户ID/用户名] - 查询用户ID信息，包括等级、DC位置等
-• .getstickers - 获取整个贴纸包的贴纸
-• .gs - 获取整个贴纸包的贴纸(简写)
-
-💡 提示: 使用 .help core 或 .help autosend 查看详细信息
-🚀 新版本: 现在使用Go插件系统，性能更佳！`
-
-		// 直接使用gotd API发送响应
-		peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-		if err != nil {
-			return fmt.Errorf("failed to resolve peer: %w", err)
-		}
-
-		// 私聊：编辑消息，群聊：先尝试编辑，失败则发送新消息
-		if ctx.Message.ChatID > 0 {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: helpMsg,
-			})
-			return err
-		} else {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: helpMsg,
-			})
-			if err != nil {
-				_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-					Peer:     peer,
-					Message:  helpMsg,
-					RandomID: time.Now().UnixNano(),
-				})
-			}
-			return err
-		}
+		return cp.sendResponse(ctx, withCommandPrefix(cp.helpOverview(), ctx.Prefix))
 	}
 
-	// 显示特定插件帮助
-	pluginName := ctx.Args[0]
-	if pluginName == "core" {
-		detailedHelp := `📋 核心命令插件详细帮助
-
-🔍 .status 命令:
-  显示 NexusValet 的系统状态信息，包括:
-  • 应用版本号
-  • Go 运行时版本
-  • 当前系统时间
-  • 运行状态
-  • 内存使用情况
-
-❓ .help 命令:
-  • .help - 显示所有可用命令列表
-  • .help <插件名> - 显示特定插件的详细帮助信息
-
-🔌 插件信息:
-  • 名称: core
-  • 版本: v1.0.0 (Go插件版本)
-  • 作者: NexusValet
-  • 描述: 提供基础的系统命令功能`
-
-		// 直接使用gotd API发送响应
-		peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-		if err != nil {
-			return fmt.Errorf("failed to resolve peer: %w", err)
-		}
-
-		if ctx.Message.ChatID > 0 {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: detailedHelp,
-			})
-			return err
-		} else {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: detailedHelp,
-			})
-			if err != nil {
-				_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-					Peer:     peer,
-					Message:  detailedHelp,
-					RandomID: time.Now().UnixNano(),
-				})
-			}
-			return err
-		}
-	} else if pluginName == "sb" {
-		sbHelp := `🚫 超级封禁插件详细帮助
-
-🚫 .sb 命令:
-  超级封禁用户并清除消息历史，功能包括:
-  • 🔒 永久封禁指定用户
-  • 🗑️ 清除用户消息历史（可选）
-  • 🎯 支持多种用户指定方式
-  • 🛡️ 自动权限验证
-
-📝 使用方法:
-  • .sb - 回复消息封禁该用户（推荐）
-  • .sb <用户ID> - 通过用户ID封禁
-  • .sb @<用户名> - 通过用户名封禁
-  • .sb <用户ID/用户名> 0 - 仅封禁不删除历史
-
-⚠️ 注意事项:
-  • 仅限群组使用
-  • 需要管理员权限
-  • 默认会删除该用户的所有消息历史
-  • 支持封禁用户
-
-🔌 插件信息:
-  • 名称: sb
-  • 版本: v1.0.0 (Go插件版本)  
-  • 作者: NexusValet
-  • 描述: 超级封禁插件，支持封禁用户并删除消息历史`
-
-		// 直接使用gotd API发送响应
-		peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-		if err != nil {
-			return fmt.Errorf("failed to resolve peer: %w", err)
-		}
+	name := strings.TrimPrefix(ctx.Args[0], ctx.Prefix)
+	text, ok := cp.pluginHelp(name)
+	if !ok {
+		return cp.sendResponse(ctx, "未找到该插件的帮助信息: "+name)
+	}
+	return cp.sendResponse(ctx, withCommandPrefix(text, ctx.Prefix))
+}
 
-		if ctx.Message.ChatID > 0 {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: sbHelp,
-			})
-			return err
-		} else {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: sbHelp,
-			})
-			if err != nil {
-				_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-					Peer:     peer,
-					Message:  sbHelp,
-					RandomID: time.Now().UnixNano(),
-				})
-			}
-			return err
-		}
-	} else if pluginName == "gemini" {
-		geminiHelp := `🤖 Gemini AI插件详细帮助
-
-🚀 智能命令 (自动识别模式):
-  • .gemini <问题> - 智能问答，自动识别文本/图片
-  • .gm <问题> - 简写命令，功能同上
-
-✨ 智能功能:
-  • 📝 文本问答 - 直接提问即可
-  • 🖼️ 图片分析 - 发送图片时自动启用vision模式
-  • 🔄 回复模式 - 添加 "reply" 或 "r" 参数回复原消息
-  • 💬 上下文对话 - 回复消息后提问
-
-⚙️ 配置命令:
-  • .gemini config - 查看当前配置
-  • .gemini key <API密钥> - 设置API密钥
-  • .gemini model <模型名> - 设置模型(默认: gemini-1.5-flash)
-  • .gemini auto <True/False> - 设置自动删除空提问
-
-📝 使用示例:
-  • .gemini 什么是人工智能？
-  • .gm 解释这个概念
-  • .gemini reply 请详细说明 (回复到原消息)
-  • .gm r 分析这张图片 (发送图片+回复模式)
-  • .gemini config (查看配置)
-  • .gemini key AIza... (设置API密钥)
-
-🔌 插件信息:
-  • 名称: gemini  
-  • 版本: v1.0.0
-  • 描述: 简化的Gemini AI智能问答插件`
-
-		// 直接使用gotd API发送响应
-		peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-		if err != nil {
-			return fmt.Errorf("failed to resolve peer: %w", err)
+// helpGroups 按插件分组已注册的命令，插件按其第一个命令的注册顺序排列
+func (cp *CoreCommandsPlugin) helpGroups() ([]string, map[string][]*command.Command) {
+	var plugins []string
+	groups := make(map[string][]*command.Command)
+	for _, cmd := range cp.parser.CommandList() {
+		if _, ok := groups[cmd.Plugin]; !ok {
+			plugins = append(plugins, cmd.Plugin)
 		}
+		groups[cmd.Plugin] = append(groups[cmd.Plugin], cmd)
+	}
+	return plugins, groups
+}
 
-		if ctx.Message.ChatID > 0 {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: geminiHelp,
-			})
-			return err
-		} else {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: geminiHelp,
-			})
-			if err != nil {
-				_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-					Peer:     peer,
-					Message:  geminiHelp,
-					RandomID: time.Now().UnixNano(),
-				})
-			}
-			return err
-		}
-	} else if pluginName == "autosend" {
-		autoSendHelp := `🤖 AutoSend 定时发送插件详细帮助
-
-📝 基本命令:
-  • .autosend add <秒> <分> <时> <日> <月> <周> <消息内容> - 创建定时发送任务
-  • .autosend list - 列出所有任务
-  • .autosend remove <ID> - 删除任务
-  • .autosend enable <ID> - 启用任务
-  • .autosend disable <ID> - 禁用任务
-
-📋 Cron表达式格式: 秒 分 时 日 月 周
-  • 每天0点: 0 0 0 * * *
-  • 每天12:30: 0 30 12 * * *
-  • 每10分钟: 0 */10 * * * *
-  • 每小时: 0 0 * * * *
-  • 工作日9点: 0 0 9 * * 1-5
-  • 每周日22点: 0 0 22 * * 0
-
-📋 使用示例:
-  • .autosend add 0 0 0 * * * 🌅 新的一天开始了！
-  • .autosend add 0 30 12 * * * 🍽️ 午餐时间到了！
-  • .autosend add 0 0 22 * * * 🌙 该休息了，晚安~
-  • .as add 0 */30 * * * * 📊 半小时状态检查
-  • .autosend add 0 0 9 * * 1-5 ☕ 工作日早安！
-  • .autosend add 0 0 18 * * 1-5 🏠 下班时间到了！
-  • .autosend list - 查看所有任务
-  • .autosend remove 1 - 删除ID为1的任务
-
-✨ 特色功能:
-  • 使用强大的cron表达式，支持复杂定时规则
-  • 支持秒级精度的定时任务
-  • 完全自定义消息内容，支持emoji表情 🎉
-  • 支持多行文本和特殊字符
-  • 可用于工作提醒、生活助手、娱乐互动等
-
-⚠️ 注意事项:
-  • 使用标准cron表达式，支持秒级精度
-  • 无需使用引号，直接输入6个字段
-  • 消息内容完全由您自定义
-  • 任务会在当前聊天中执行
-  • 重启后任务会自动恢复
-  • 使用.as作为简写命令
-
-🔌 插件信息:
-  • 名称: autosend
-  • 版本: v1.0.0
-  • 作者: NexusValet
-  • 描述: 基于cron表达式的定时自动发送消息插件`
-
-		// 直接使用gotd API发送响应
-		peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-		if err != nil {
-			return fmt.Errorf("failed to resolve peer: %w", err)
-		}
+// helpOverview 列出所有插件及其命令
+func (cp *CoreCommandsPlugin) helpOverview() string {
+	plugins, groups := cp.helpGroups()
 
-		if ctx.Message.ChatID > 0 {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: autoSendHelp,
-			})
-			return err
-		} else {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: autoSendHelp,
-			})
-			if err != nil {
-				_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-					Peer:     peer,
-					Message:  autoSendHelp,
-					RandomID: time.Now().UnixNano(),
-				})
-			}
-			return err
-		}
-	} else if pluginName == "dme" {
-		dmeHelp := `🗑️ DeleteMyMessages 删除我的消息插件详细帮助
-
-🗑️ .dme 命令:
-  删除当前对话中您发送的特定数量消息，功能包括:
-  • 🎯 精确删除指定数量的您发送的消息
-  • 🔍 自动筛选您发送的消息
-  • ⚡ 高效批量删除处理
-  • 🛡️ 防误操作保护机制
-
-📝 使用方法:
-  • .dme - 删除您发送的最近1条消息
-  • .dme 5 - 删除您发送的最近5条消息  
-  • .dme 20 - 删除您发送的最近20条消息
-
-⚠️ 注意事项:
-  • 只会删除您自己发送的消息，不影响他人消息
-  • 一次最多删除100条消息（防止误操作）
-  • 删除操作不可撤销，请谨慎使用
-  • 支持私聊、群聊、频道等所有聊天类型
-  • 删除过程异步进行，不会阻塞其他操作
-
-💡 使用场景:
-  • 清理测试消息
-  • 删除错误发送的内容
-  • 批量清理聊天记录
-  • 保护隐私信息
-
-🔌 插件信息:
-  • 名称: dme
-  • 版本: v1.0.0
-  • 作者: NexusValet
-  • 描述: 删除当前对话中您发送的特定数量的消息插件`
-
-		// 直接使用gotd API发送响应
-		peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-		if err != nil {
-			return fmt.Errorf("failed to resolve peer: %w", err)
+	var b strings.Builder
+	b.WriteString("📖 NexusValet 帮助信息")
+	for _, name := range plugins {
+		b.WriteString("\n\n🔌 " + name)
+		if info := cp.pluginInfo(name); info != nil && info.Description != "" {
+			b.WriteString(" - " + info.Description)
 		}
+		writeHelpCommands(&b, groups[name])
+	}
+	b.WriteString("\n\n💡 提示: 使用 .help <插件名> 或 .help <命令> 查看详细信息")
+	return b.String()
+}
 
-		if ctx.Message.ChatID > 0 {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: dmeHelp,
-			})
-			return err
-		} else {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: dmeHelp,
-			})
-			if err != nil {
-				_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-					Peer:     peer,
-					Message:  dmeHelp,
-					RandomID: time.Now().UnixNano(),
-				})
-			}
-			return err
-		}
-	} else if pluginName == "ids" {
-		idsHelp := `🆔 Ids 用户信息查询插件详细帮助
-
-🆔 .ids 命令:
-  查询用户ID信息，包括等级、DC位置等，功能包括:
-         • 🎯 支持多种用户指定方式
-         • 📊 显示用户等级估算
-         • 🌍 显示DC位置信息
-         • 🔗 生成用户链接
-
-📝 使用方法:
-  • .ids - 查询自己的信息
-  • .ids <用户ID> - 通过用户ID查询
-  • .ids @<用户名> - 通过用户名查询
-  • .ids <用户名> - 通过用户名查询（无需@符号）
-  • .ids - 回复消息查询该用户信息（推荐）
-
-📋 显示信息:
-  • ID: 用户唯一标识符
-  • DC: 数据中心编号和位置（自己查询显示真实DC，其他用户通过头像获取）
-  • 昵称: 用户显示名称（可点击）
-  • 等级: 基于ID范围的等级估算
-  • 用户名: Telegram用户名
-  • TG链接: 用户链接
-
-🎯 等级系统 (游戏风格):
-  • 👑 终极BOSS (无敌存在): ID < 50,000,000
-  • 🌌 创世之神 (开天辟地): 50,000,000 ≤ ID < 100,000,000
-  • ⚡ 神话至尊 (威震寰宇): 100,000,000 ≤ ID < 500,000,000
-  • 🔥 史诗霸主 (独霸一方): 500,000,000 ≤ ID < 1,000,000,000
-  • 🌟 传奇英雄 (威震八方): 1,000,000,000 ≤ ID < 2,075,484,114
-  • 👑 王者传说 (名震天下): 2,075,484,114 ≤ ID < 3,000,000,000
-  • 💎 钻石大师 (威名远扬): 3,000,000,000 ≤ ID < 4,000,000,000
-  • 🏆 黄金勇者 (声名鹊起): 4,000,000,000 ≤ ID < 5,000,000,000
-  • 🛡️ 白银骑士 (小有名气): 5,000,000,000 ≤ ID < 6,000,000,000
-  • ⚔️ 青铜战士 (初出茅庐): 6,000,000,000 ≤ ID < 7,000,000,000
-  • 🆕 新手村村民 (刚入坑): ID ≥ 7,000,000,000
-
-🔌 插件信息:
-  • 名称: ids
-  • 版本: v1.0.0
-  • 作者: NexusValet
-         • 描述: 查询用户ID信息，包括等级、DC位置等`
-
-		// 直接使用gotd API发送响应
-		peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-		if err != nil {
-			return fmt.Errorf("failed to resolve peer: %w", err)
+// pluginHelp 返回插件的详细帮助，name 可以是插件名或命令名。
+// 插件没有注册详细帮助时列出它的命令
+func (cp *CoreCommandsPlugin) pluginHelp(name string) (string, bool) {
+	_, groups := cp.helpGroups()
+	if _, ok := groups[name]; !ok {
+		cmd, exists := cp.parser.GetCommand(name)
+		if !exists {
+			return "", false
 		}
+		name = cmd.Plugin
+	}
 
-		if ctx.Message.ChatID > 0 {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: idsHelp,
-			})
-			return err
-		} else {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: idsHelp,
-			})
-			if err != nil {
-				_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-					Peer:     peer,
-					Message:  idsHelp,
-					RandomID: time.Now().UnixNano(),
-				})
-			}
-			return err
-		}
-	} else if pluginName == "sticker" {
-		stickerHelp := `🎭 Sticker 贴纸包下载插件详细帮助
-
-🎭 .getstickers / .gs 命令:
-  获取整个贴纸包的贴纸，功能包括:
-  • 📦 下载整个贴纸包的所有贴纸
-  • 🎨 保持贴纸的emoji表情信息
-  • 📁 自动打包为ZIP文件
-  • 🚀 支持多种贴纸格式(webp/tgs/mp4)
-  • 📋 生成pack.txt配置文件
-
-📝 使用方法:
-  • .getstickers - 回复贴纸包中的任意贴纸
-  • .gs - 简写命令，功能同上
-
-✨ 功能特色:
-  • 🎯 自动识别贴纸包中的所有贴纸
-  • 🎨 保留每个贴纸对应的emoji表情
-  • 📦 自动打包为ZIP文件便于分享
-  • 🚀 支持静态贴纸(webp)、动画贴纸(tgs)、视频贴纸(mp4)
-  • 📋 生成pack.txt文件，包含贴纸文件名和emoji映射
-  • ⚡ 高效并发下载，快速完成
-
-📋 输出文件:
-  • 贴纸文件: 001.webp, 002.tgs, 003.mp4 等
-  • 配置文件: pack.txt (包含文件名和emoji映射)
-  • 打包文件: 贴纸包名.zip
-
-⚠️ 注意事项:
-  • 需要回复贴纸包中的贴纸
-  • 贴纸必须属于某个贴纸包
-  • 下载过程可能需要一些时间
-  • 大贴纸包可能需要更多时间处理
-
-🔌 插件信息:
-  • 名称: sticker
-  • 版本: v1.0.0
-  • 作者: NexusValet
-  • 描述: 获取整个贴纸包的贴纸插件`
-
-		// 直接使用gotd API发送响应
-		peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-		if err != nil {
-			return fmt.Errorf("failed to resolve peer: %w", err)
-		}
+	var b strings.Builder
+	if text, ok := cp.parser.LongHelp(name); ok {
+		b.WriteString(text)
+	} else {
+		b.WriteString("📖 " + name + " 插件帮助\n\n📝 命令:")
+		writeHelpCommands(&b, groups[name])
+	}
 
-		if ctx.Message.ChatID > 0 {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: stickerHelp,
-			})
-			return err
-		} else {
-			_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-				Peer:    peer,
-				ID:      ctx.Message.Message.ID,
-				Message: stickerHelp,
-			})
-			if err != nil {
-				_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-					Peer:     peer,
-					Message:  stickerHelp,
-					RandomID: time.Now().UnixNano(),
-				})
-			}
-			return err
-		}
+	if info := cp.pluginInfo(name); info != nil {
+		fmt.Fprintf(&b, "\n\n🔌 插件信息:\n  • 名称: %s\n  • 版本: v%s\n  • 作者: %s\n  • 描述: %s",
+			info.Name, info.Version, info.Author, info.Description)
 	}
+	return b.String(), true
+}
 
-	// 直接使用gotd API发送响应
-	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-	if err != nil {
-		return fmt.Errorf("failed to resolve peer: %w", err)
+// pluginInfo 返回插件信息，插件不存在时返回nil
+func (cp *CoreCommandsPlugin) pluginInfo(name string) *PluginInfo {
+	goManager, ok := cp.manager.(*GoManager)
+	if !ok {
+		return nil
 	}
+	plugin, ok := goManager.GetPlugin(name)
+	if !ok {
+		return nil
+	}
+	return plugin.GetInfo()
+}
 
-	errorMsg := "未找到该插件的帮助信息: " + pluginName
-	if ctx.Message.ChatID > 0 {
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: errorMsg,
-		})
-		return err
-	} else {
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: errorMsg,
-		})
-		if err != nil {
-			_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-				Peer:     peer,
-				Message:  errorMsg,
-				RandomID: time.Now().UnixNano(),
-			})
+// writeHelpCommands 写入命令列表，每行一个命令及其说明
+func writeHelpCommands(b *strings.Builder, commands []*command.Command) {
+	for _, cmd := range commands {
+		b.WriteString("\n• ." + cmd.Name)
+		if cmd.Description != "" {
+			b.WriteString(" - " + cmd.Description)
 		}
-		return err
 	}
 }
 
 // 辅助函数
 
+// helpCommandPattern 帮助文本中的命令，如 "• .status"、"使用 .help"
+var helpCommandPattern = regexp.MustCompile(`(^|[\s/(（])\.[a-z]`)
+
+// withCommandPrefix 把帮助文本中以 "." 开头的命令换成触发本次命令的前缀
+func withCommandPrefix(text, prefix string) string {
+	if prefix == "" || prefix == "." {
+		return text
+	}
+	return helpCommandPattern.ReplaceAllStringFunc(text, func(m string) string {
+		i := strings.LastIndex(m, ".")
+		return m[:i] + prefix + m[i+1:]
+	})
+}
+
 func (cp *CoreCommandsPlugin) formatUptime(uptime time.Duration) string {
 	seconds := int(uptime.Seconds())
 	days := seconds / 86400
@@ -751,7 +354,22 @@ func (cp *CoreCommandsPlugin) formatUptime(uptime time.Duration) string {
 	return strings.Join(parts, " ")
 }
 
-func (cp *CoreCommandsPlugin) formatMemorySize(bytes uint64) string {
+func (cp *CoreCommandsPlugin) formatBuildInfo(info version.Info) string {
+	commit := info.Commit
+	if commit == "" {
+		commit = "unknown"
+	} else if info.Modified {
+		commit += "-dirty"
+	}
+	buildDate := info.BuildDate
+	if buildDate == "" {
+		buildDate = "unknown"
+	}
+	return fmt.Sprintf("commit %s, 构建于 %s", commit, buildDate)
+}
+
+// formatMemorySize 以1024为进制把字节数格式化为 B、KB、MB 等可读形式
+func formatMemorySize(bytes uint64) string {
 	const unit = 1024
 	if bytes < unit {
 		return fmt.Sprintf("%d B", bytes)
@@ -811,7 +429,8 @@ func NewAPTPlugin() *APTPlugin {
 
 // RegisterCommands 实现CommandPlugin接口
 func (ap *APTPlugin) RegisterCommands(parser *command.Parser) error {
-	parser.RegisterCommand("apt", "Plugin management commands", ap.info.Name, ap.handleAPT)
+	parser.RegisterOwnerCommand("apt", "Plugin management commands", ap.info.Name, ap.handleAPT)
+	parser.RegisterOwnerCommand("reload", "Reload a plugin without restarting", ap.info.Name, ap.handleReload)
 	logger.Infof("APT commands registered successfully")
 	return nil
 }
@@ -819,7 +438,7 @@ func (ap *APTPlugin) RegisterCommands(parser *command.Parser) error {
 // handleAPT 处理apt命令
 func (ap *APTPlugin) handleAPT(ctx *command.CommandContext) error {
 	if len(ctx.Args) == 0 {
-		return ap.sendResponse(ctx, "Usage: .apt <list|enable|disable> [plugin_name]")
+		return ap.sendResponse(ctx, "Usage: .apt <list|enable|disable|search|show|install|remove|update-index|capabilities> [plugin_name]")
 	}
 
 	subcommand := ctx.Args[0]
@@ -830,40 +449,27 @@ func (ap *APTPlugin) handleAPT(ctx *command.CommandContext) error {
 		return ap.handleEnable(ctx)
 	case "disable":
 		return ap.handleDisable(ctx)
+	case "search":
+		return ap.handleSearch(ctx)
+	case "show":
+		return ap.handleShow(ctx)
+	case "install":
+		return ap.handleInstall(ctx)
+	case "remove":
+		return ap.handleRemove(ctx)
+	case "update-index":
+		return ap.handleUpdateIndex(ctx)
+	case "capabilities":
+		return ap.handleCapabilities(ctx)
 	default:
 		return ap.sendResponse(ctx, fmt.Sprintf("Unknown subcommand: %s", subcommand))
 	}
 }
 
-// sendResponse APT插件通用响应函数
+// sendResponse APT插件通用响应函数，过长时拆分为多条
 func (ap *APTPlugin) sendResponse(ctx *command.CommandContext, message string) error {
-	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-	if err != nil {
-		return fmt.Errorf("failed to resolve peer: %w", err)
-	}
-
-	if ctx.Message.ChatID > 0 {
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: message,
-		})
-		return err
-	} else {
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: message,
-		})
-		if err != nil {
-			_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-				Peer:     peer,
-				Message:  message,
-				RandomID: time.Now().UnixNano(),
-			})
-		}
-		return err
-	}
+	_, err := ctx.Respond(message, format.Plain)
+	return err
 }
 
 // handleList 处理列出插件
@@ -879,6 +485,11 @@ func (ap *APTPlugin) handleList(ctx *command.CommandContext) error {
 			return ap.sendResponse(ctx, "No plugins installed")
 		}
 
+		disabledHere := make(map[string]bool)
+		for _, name := range goManager.GetChatScope().DisabledIn(ctx.Message.ChatID) {
+			disabledHere[name] = true
+		}
+
 		var response strings.Builder
 		response.WriteString("Installed plugins (Go版本):\n")
 		for name, plugin := range plugins {
@@ -886,6 +497,9 @@ func (ap *APTPlugin) handleList(ctx *command.CommandContext) error {
 			if !plugin.Enabled {
 				status = "disabled"
 			}
+			if disabledHere[name] {
+				status += ", disabled here"
+			}
 			response.WriteString(fmt.Sprintf("• %s v%s (%s) - %s\n",
 				name, plugin.Version, status, plugin.Description))
 		}
@@ -896,14 +510,31 @@ func (ap *APTPlugin) handleList(ctx *command.CommandContext) error {
 	return ap.sendResponse(ctx, "Unsupported plugin manager type")
 }
 
+// handleCapabilities 显示启动时的API能力检查报告
+func (ap *APTPlugin) handleCapabilities(ctx *command.CommandContext) error {
+	goManager, ok := ap.manager.(*GoManager)
+	if !ok {
+		return ap.sendResponse(ctx, "Plugin manager not available")
+	}
+
+	report := goManager.GetCapabilityReport()
+	if report == nil {
+		return ap.sendResponse(ctx, "Capability probe has not run")
+	}
+	return ap.sendResponse(ctx, report.Summary())
+}
+
 // handleEnable 处理启用插件
 func (ap *APTPlugin) handleEnable(ctx *command.CommandContext) error {
 	if len(ctx.Args) < 2 {
-		return ap.sendResponse(ctx, "Usage: .apt enable <plugin_name>")
+		return ap.sendResponse(ctx, "Usage: .apt enable <plugin_name> [here]")
 	}
 
 	pluginName := ctx.Args[1]
 	if goManager, ok := ap.manager.(*GoManager); ok {
+		if isHereScope(ctx.Args) {
+			return ap.setChatScope(ctx, goManager, pluginName, true)
+		}
 		if err := goManager.EnablePlugin(pluginName); err != nil {
 			return ap.sendResponse(ctx, fmt.Sprintf("Failed to enable plugin %s: %v", pluginName, err))
 		}
@@ -916,11 +547,14 @@ func (ap *APTPlugin) handleEnable(ctx *command.CommandContext) error {
 // handleDisable 处理禁用插件
 func (ap *APTPlugin) handleDisable(ctx *command.CommandContext) error {
 	if len(ctx.Args) < 2 {
-		return ap.sendResponse(ctx, "Usage: .apt disable <plugin_name>")
+		return ap.sendResponse(ctx, "Usage: .apt disable <plugin_name> [here]")
 	}
 
 	pluginName := ctx.Args[1]
 	if goManager, ok := ap.manager.(*GoManager); ok {
+		if isHereScope(ctx.Args) {
+			return ap.setChatScope(ctx, goManager, pluginName, false)
+		}
 		if err := goManager.DisablePlugin(pluginName); err != nil {
 			return ap.sendResponse(ctx, fmt.Sprintf("Failed to disable plugin %s: %v", pluginName, err))
 		}
@@ -930,6 +564,38 @@ func (ap *APTPlugin) handleDisable(ctx *command.CommandContext) error {
 	return ap.sendResponse(ctx, "Unsupported plugin manager type")
 }
 
+// isHereScope enable/disable 是否只作用于当前对话
+func isHereScope(args []string) bool {
+	return len(args) > 2 && args[2] == "here"
+}
+
+// setChatScope 在当前对话中启用或禁用插件
+func (ap *APTPlugin) setChatScope(ctx *command.CommandContext, goManager *GoManager, pluginName string, enable bool) error {
+	if _, exists := goManager.GetPlugin(pluginName); !exists {
+		return ap.sendResponse(ctx, fmt.Sprintf("Plugin %s not found", pluginName))
+	}
+
+	scope := goManager.GetChatScope()
+	chatID := ctx.Message.ChatID
+	if enable {
+		if err := scope.Enable(pluginName, chatID); err != nil {
+			return ap.sendResponse(ctx, fmt.Sprintf("Failed to enable plugin %s here: %v", pluginName, err))
+		}
+		logger.Infof("Plugin %s enabled in chat %d", pluginName, chatID)
+		return ap.sendResponse(ctx, fmt.Sprintf("Plugin %s enabled in this chat", pluginName))
+	}
+
+	// 禁用apt后将无法在该对话中重新启用
+	if pluginName == ap.info.Name {
+		return ap.sendResponse(ctx, "The apt plugin cannot be disabled per chat")
+	}
+	if err := scope.Disable(pluginName, chatID); err != nil {
+		return ap.sendResponse(ctx, fmt.Sprintf("Failed to disable plugin %s here: %v", pluginName, err))
+	}
+	logger.Infof("Plugin %s disabled in chat %d", pluginName, chatID)
+	return ap.sendResponse(ctx, fmt.Sprintf("Plugin %s disabled in this chat", pluginName))
+}
+
 // RegisterBuiltinPlugins 注册所有内置插件
 func RegisterBuiltinPlugins(manager *GoManager) error {
 	// 注册核心命令插件
@@ -981,11 +647,176 @@ func RegisterBuiltinPlugins(manager *GoManager) error {
 	}
 
 	// 注册Sticker插件
-	stickerPlugin := NewStickerPlugin()
+	stickerPlugin := NewStickerPlugin(manager.GetDatabase())
 	if err := manager.RegisterPlugin(stickerPlugin); err != nil {
 		return fmt.Errorf("failed to register Sticker plugin: %w", err)
 	}
 
+	// 注册Gif插件
+	gifPlugin := NewGifPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(gifPlugin); err != nil {
+		return fmt.Errorf("failed to register Gif plugin: %w", err)
+	}
+
+	// 注册Maintenance插件
+	maintenancePlugin := NewMaintenancePlugin()
+	if err := manager.RegisterPlugin(maintenancePlugin); err != nil {
+		return fmt.Errorf("failed to register Maintenance plugin: %w", err)
+	}
+
+	// 注册TTS插件
+	ttsPlugin := NewTTSPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(ttsPlugin); err != nil {
+		return fmt.Errorf("failed to register TTS plugin: %w", err)
+	}
+
+	// 注册投票插件
+	votePlugin := NewVotePlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(votePlugin); err != nil {
+		return fmt.Errorf("failed to register Vote plugin: %w", err)
+	}
+
+	// 注册密钥库插件
+	secretsPlugin := NewSecretsPlugin()
+	if err := manager.RegisterPlugin(secretsPlugin); err != nil {
+		return fmt.Errorf("failed to register Secrets plugin: %w", err)
+	}
+
+	// 注册对话串插件
+	threadPlugin := NewThreadPlugin()
+	if err := manager.RegisterPlugin(threadPlugin); err != nil {
+		return fmt.Errorf("failed to register Thread plugin: %w", err)
+	}
+
+	// 注册本地搜索插件
+	lsearchPlugin := NewLSearchPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(lsearchPlugin); err != nil {
+		return fmt.Errorf("failed to register LSearch plugin: %w", err)
+	}
+
+	// 注册短代码模板插件
+	tplPlugin := NewTplPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(tplPlugin); err != nil {
+		return fmt.Errorf("failed to register Tpl plugin: %w", err)
+	}
+
+	// 注册差异比较插件
+	diffPlugin := NewDiffPlugin()
+	if err := manager.RegisterPlugin(diffPlugin); err != nil {
+		return fmt.Errorf("failed to register Diff plugin: %w", err)
+	}
+
+	// 注册阅后即焚插件
+	ephemeralPlugin := NewEphemeralPlugin()
+	if err := manager.RegisterPlugin(ephemeralPlugin); err != nil {
+		return fmt.Errorf("failed to register Ephemeral plugin: %w", err)
+	}
+
+	// 注册动态插件
+	storyPlugin := NewStoryPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(storyPlugin); err != nil {
+		return fmt.Errorf("failed to register Story plugin: %w", err)
+	}
+
+	// 注册掷骰插件
+	rollPlugin := NewRollPlugin()
+	if err := manager.RegisterPlugin(rollPlugin); err != nil {
+		return fmt.Errorf("failed to register Roll plugin: %w", err)
+	}
+
+	// 注册复制消息插件
+	copyPlugin := NewCopyPlugin()
+	if err := manager.RegisterPlugin(copyPlugin); err != nil {
+		return fmt.Errorf("failed to register Copy plugin: %w", err)
+	}
+
+	// 注册下载插件
+	downloadPlugin := NewDownloadPlugin()
+	if err := manager.RegisterPlugin(downloadPlugin); err != nil {
+		return fmt.Errorf("failed to register Download plugin: %w", err)
+	}
+
+	// 注册笔记插件
+	notePlugin := NewNotePlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(notePlugin); err != nil {
+		return fmt.Errorf("failed to register Note plugin: %w", err)
+	}
+
+	// 注册翻译插件
+	translatePlugin := NewTranslatePlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(translatePlugin); err != nil {
+		return fmt.Errorf("failed to register Translate plugin: %w", err)
+	}
+
+	// 注册提醒插件
+	reminderPlugin := NewReminderPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(reminderPlugin); err != nil {
+		return fmt.Errorf("failed to register Reminder plugin: %w", err)
+	}
+
+	// 注册入群请求插件
+	joinRequestPlugin := NewJoinRequestPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(joinRequestPlugin); err != nil {
+		return fmt.Errorf("failed to register JoinRequest plugin: %w", err)
+	}
+
+	// 注册离开状态插件
+	afkPlugin := NewAFKPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(afkPlugin); err != nil {
+		return fmt.Errorf("failed to register AFK plugin: %w", err)
+	}
+
+	// 注册自动回复规则插件
+	filterPlugin := NewFilterPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(filterPlugin); err != nil {
+		return fmt.Errorf("failed to register Filter plugin: %w", err)
+	}
+
+	// 注册天气插件
+	weatherPlugin := NewWeatherPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(weatherPlugin); err != nil {
+		return fmt.Errorf("failed to register Weather plugin: %w", err)
+	}
+
+	// 注册汇率插件
+	ratePlugin := NewRatePlugin()
+	if err := manager.RegisterPlugin(ratePlugin); err != nil {
+		return fmt.Errorf("failed to register Rate plugin: %w", err)
+	}
+
+	// 注册导出聊天记录插件
+	exportPlugin := NewExportPlugin()
+	if err := manager.RegisterPlugin(exportPlugin); err != nil {
+		return fmt.Errorf("failed to register Export plugin: %w", err)
+	}
+
+	// 注册已读管理插件
+	ghostPlugin := NewGhostPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(ghostPlugin); err != nil {
+		return fmt.Errorf("failed to register Ghost plugin: %w", err)
+	}
+
+	// 注册刷屏保护插件
+	antifloodPlugin := NewAntifloodPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(antifloodPlugin); err != nil {
+		return fmt.Errorf("failed to register Antiflood plugin: %w", err)
+	}
+
+	// 注册关键词提醒插件
+	watchPlugin := NewWatchPlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(watchPlugin); err != nil {
+		return fmt.Errorf("failed to register Watch plugin: %w", err)
+	}
+
+	// 注册自动删除插件
+	autodelPlugin := NewAutoDeletePlugin(manager.GetDatabase())
+	if err := manager.RegisterPlugin(autodelPlugin); err != nil {
+		return fmt.Errorf("failed to register Autodel plugin: %w", err)
+	}
+
+	// 检查插件依赖的API能力，禁用缺少依赖的插件
+	manager.ProbeCapabilities()
+
 	logger.Infof("All builtin plugins registered successfully")
 	return nil
 }
@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/cache"
+	"nexusvalet/internal/command"
+	"strings"
+)
+
+// handleCache 处理cache命令：stats 显示各缓存统计，purge 清理过期条目，clear <名称> 清空缓存
+func (cp *CoreCommandsPlugin) handleCache(ctx *command.CommandContext) error {
+	sub := "stats"
+	if len(ctx.Args) > 0 {
+		sub = ctx.Args[0]
+	}
+
+	switch sub {
+	case "stats":
+		return cp.sendResponse(ctx, formatCacheStats(cache.All()))
+	case "purge":
+		return cp.sendResponse(ctx, fmt.Sprintf("🧹 已清理 %d 个过期条目", cache.PurgeAll()))
+	case "clear":
+		if len(ctx.Args) < 2 {
+			return cp.sendResponse(ctx, "用法: .cache clear <缓存名称>")
+		}
+		if !cache.Clear(ctx.Args[1]) {
+			return cp.sendResponse(ctx, fmt.Sprintf("❌ 没有名为 %s 的缓存", ctx.Args[1]))
+		}
+		return cp.sendResponse(ctx, fmt.Sprintf("🗑️ 已清空缓存 %s", ctx.Args[1]))
+	default:
+		return cp.sendResponse(ctx, "用法: .cache [stats|purge|clear <缓存名称>]")
+	}
+}
+
+// formatCacheStats 格式化缓存统计
+func formatCacheStats(stats []cache.Stats) string {
+	if len(stats) == 0 {
+		return "没有已注册的缓存"
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🗃️ 缓存统计 (%d):\n", len(stats)))
+	for _, s := range stats {
+		size := fmt.Sprintf("%d", s.Size)
+		if s.MaxEntries > 0 {
+			size += fmt.Sprintf("/%d", s.MaxEntries)
+		}
+		b.WriteString(fmt.Sprintf("\n• %s - 条目 %s", s.Name, size))
+		if s.TTL > 0 {
+			b.WriteString(fmt.Sprintf(" · TTL %s", s.TTL))
+		}
+		if s.Persistent {
+			b.WriteString(" · 持久化")
+		}
+		b.WriteString(fmt.Sprintf("\n  命中 %d · 未命中 %d · 命中率 %.1f%% · 淘汰 %d · 过期 %d",
+			s.Hits, s.Misses, s.HitRate()*100, s.Evictions, s.Expired))
+	}
+	return b.String()
+}
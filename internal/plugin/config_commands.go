@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/config"
+	"nexusvalet/pkg/logger"
+	"slices"
+	"strings"
+)
+
+// SetConfig 设置配置文件路径和启动时加载的配置，供 .config 使用
+func (gm *GoManager) SetConfig(path string, cfg *config.Config) {
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+	gm.configPath = path
+	gm.config = cfg
+}
+
+// GetConfig 返回当前生效的配置，未设置时返回nil
+func (gm *GoManager) GetConfig() *config.Config {
+	gm.mutex.RLock()
+	defer gm.mutex.RUnlock()
+	return gm.config
+}
+
+// ReloadConfig 重新读取配置文件，立即应用日志级别和命令前缀的修改
+func (gm *GoManager) ReloadConfig() (*config.ReloadResult, error) {
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+	if gm.config == nil {
+		return nil, fmt.Errorf("config not available")
+	}
+
+	result, err := config.Reload(gm.configPath, gm.config)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.SetLevel(logger.ParseLevel(result.Config.Logger.Level))
+	logger.SetModuleLevels(result.Config.Logger.ModuleLevels())
+	if prefixes := result.Config.Bot.CommandPrefixes(); !slices.Equal(prefixes, gm.config.Bot.CommandPrefixes()) {
+		gm.parser.SetPrefixes(prefixes)
+	}
+	gm.config = result.Config
+	logger.Infof("Config reloaded: %d applied, %d require restart", len(result.Applied), len(result.Rejected))
+	return result, nil
+}
+
+// handleConfig 处理config命令：show 显示生效的配置(隐藏密钥)，reload 重新加载配置文件
+func (cp *CoreCommandsPlugin) handleConfig(ctx *command.CommandContext) error {
+	goManager, ok := cp.manager.(*GoManager)
+	if !ok || goManager.GetConfig() == nil {
+		return cp.sendResponse(ctx, "❌ 配置不可用")
+	}
+
+	sub := "show"
+	if len(ctx.Args) > 0 {
+		sub = ctx.Args[0]
+	}
+
+	switch sub {
+	case "show":
+		entries, err := goManager.GetConfig().Entries()
+		if err != nil {
+			return cp.sendResponse(ctx, fmt.Sprintf("❌ 读取配置失败: %v", err))
+		}
+		var b strings.Builder
+		b.WriteString("⚙️ 当前生效的配置:\n")
+		for _, e := range entries {
+			b.WriteString(fmt.Sprintf("\n%s = %s", e.Key, e.Value))
+		}
+		return cp.sendResponse(ctx, b.String())
+	case "reload":
+		result, err := goManager.ReloadConfig()
+		if err != nil {
+			return cp.sendResponse(ctx, fmt.Sprintf("❌ 重新加载配置失败: %v", err))
+		}
+		return cp.sendResponse(ctx, formatReloadResult(result))
+	default:
+		return cp.sendResponse(ctx, "用法: .config [show|reload]")
+	}
+}
+
+// formatReloadResult 格式化重新加载的结果
+func formatReloadResult(result *config.ReloadResult) string {
+	if len(result.Applied) == 0 && len(result.Rejected) == 0 {
+		return "✅ 配置已重新加载，没有修改"
+	}
+
+	var b strings.Builder
+	b.WriteString("✅ 配置已重新加载")
+	if len(result.Applied) > 0 {
+		b.WriteString("\n\n已生效:")
+		for _, key := range result.Applied {
+			b.WriteString("\n• " + key)
+		}
+	}
+	if len(result.Rejected) > 0 {
+		b.WriteString("\n\n⚠️ 以下修改需要重启才能生效:")
+		for _, key := range result.Rejected {
+			b.WriteString("\n• " + key)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"strconv"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// copyMaxRepeat 一次最多复制的次数
+const copyMaxRepeat = 10
+
+// CopyPlugin 复制被回复的消息
+type CopyPlugin struct {
+	*BasePlugin
+}
+
+// NewCopyPlugin 创建复制消息插件
+func NewCopyPlugin() *CopyPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "copy",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "在当前对话中重复发送被回复的消息",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &CopyPlugin{
+		BasePlugin: NewBasePlugin(info),
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (cp *CopyPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("re", "重复发送被回复的消息，.re [次数]", cp.info.Name, cp.handleCopy)
+	parser.RegisterCommand("copy", "re的别名", cp.info.Name, cp.handleCopy)
+	logger.Infof("Copy commands registered successfully")
+	return nil
+}
+
+// handleCopy 处理re/copy命令：复制被回复的消息n次，媒体直接引用原文件，不重新上传
+func (cp *CopyPlugin) handleCopy(ctx *command.CommandContext) error {
+	replyTo, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok || replyTo.ReplyToMsgID == 0 {
+		return cp.sendResponse(ctx, "❌ 请回复要复制的消息\n\n用法: .re [次数]，最多 10 次")
+	}
+
+	count := 1
+	if len(ctx.Args) > 0 {
+		n, err := strconv.Atoi(ctx.Args[0])
+		if err != nil || n <= 0 {
+			return cp.sendResponse(ctx, fmt.Sprintf("❌ 无效的次数: %s\n\n用法: .re [次数]，最多 10 次", ctx.Args[0]))
+		}
+		count = min(n, copyMaxRepeat)
+	}
+
+	msg, err := fetchMessageByID(ctx, replyTo.ReplyToMsgID)
+	if err != nil {
+		return cp.sendResponse(ctx, fmt.Sprintf("❌ 获取被回复的消息失败: %v", err))
+	}
+
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+
+	refetched := false
+	for i := 0; i < count; i++ {
+		err := cp.sendCopy(ctx, peer, msg)
+		// 文件引用过期时重新获取消息以得到新的引用，只重试一次
+		if err != nil && !refetched && tgerr.Is(err, "FILE_REFERENCE_EXPIRED") {
+			refetched = true
+			msg, err = fetchMessageByID(ctx, replyTo.ReplyToMsgID)
+			if err == nil {
+				err = cp.sendCopy(ctx, peer, msg)
+			}
+		}
+		if err != nil {
+			text := fmt.Sprintf("❌ 复制失败: %v", err)
+			if i > 0 {
+				text = fmt.Sprintf("❌ 已复制 %d 次后失败: %v", i, err)
+			}
+			return cp.sendResponse(ctx, text)
+		}
+	}
+
+	if err := deleteCommandMessage(ctx, peer); err != nil {
+		logger.Ctx(ctx.Context).Debugf("Failed to delete copy command message: %v", err)
+	}
+	return nil
+}
+
+// sendCopy 发送消息的一份副本。图片和文件使用原消息中的 id/access_hash/file_reference
+func (cp *CopyPlugin) sendCopy(ctx *command.CommandContext, peer tg.InputPeerClass, msg *tg.Message) error {
+	var media tg.InputMediaClass
+	switch m := msg.Media.(type) {
+	case nil, *tg.MessageMediaWebPage:
+		if msg.Message == "" {
+			return fmt.Errorf("消息没有内容")
+		}
+		_, err := ctx.SendMessage(&tg.MessagesSendMessageRequest{
+			Peer:     peer,
+			Message:  msg.Message,
+			Entities: msg.Entities,
+			RandomID: time.Now().UnixNano(),
+		})
+		return err
+	case *tg.MessageMediaPhoto:
+		photo, ok := m.Photo.(*tg.Photo)
+		if !ok {
+			return fmt.Errorf("图片已不可用")
+		}
+		media = &tg.InputMediaPhoto{
+			ID:      &tg.InputPhoto{ID: photo.ID, AccessHash: photo.AccessHash, FileReference: photo.FileReference},
+			Spoiler: m.Spoiler,
+		}
+	case *tg.MessageMediaDocument:
+		doc, ok := m.Document.(*tg.Document)
+		if !ok {
+			return fmt.Errorf("文件已不可用")
+		}
+		media = &tg.InputMediaDocument{
+			ID:      &tg.InputDocument{ID: doc.ID, AccessHash: doc.AccessHash, FileReference: doc.FileReference},
+			Spoiler: m.Spoiler,
+		}
+	default:
+		return fmt.Errorf("不支持复制此类消息 (%T)", msg.Media)
+	}
+
+	_, err := flood.Call(ctx.Context, ctx.Flood, ctx.Message.ChatID, func() (tg.UpdatesClass, error) {
+		return ctx.API.MessagesSendMedia(ctx.Context, &tg.MessagesSendMediaRequest{
+			Peer:     peer,
+			Media:    media,
+			Message:  msg.Message,
+			Entities: msg.Entities,
+			RandomID: time.Now().UnixNano(),
+		})
+	})
+	return err
+}
+
+// sendResponse 发送响应消息
+func (cp *CopyPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/deprecation"
+	"strings"
+)
+
+// handleDeprecations 处理deprecations命令：默认列出实际使用过的弃用项，all 列出全部
+func (cp *CoreCommandsPlugin) handleDeprecations(ctx *command.CommandContext) error {
+	goManager, ok := cp.manager.(*GoManager)
+	if !ok || goManager.GetDeprecations() == nil {
+		return cp.sendResponse(ctx, "❌ 弃用项记录不可用")
+	}
+
+	usedOnly := true
+	if len(ctx.Args) > 0 {
+		if ctx.Args[0] != "all" {
+			return cp.sendResponse(ctx, "用法: .deprecations [all]")
+		}
+		usedOnly = false
+	}
+	return cp.sendResponse(ctx, formatDeprecations(goManager.GetDeprecations(), usedOnly, goManager.parser.GetPrefix()))
+}
+
+// formatDeprecations 格式化弃用项列表
+func formatDeprecations(registry *deprecation.Registry, usedOnly bool, prefix string) string {
+	entries := registry.Entries(usedOnly)
+	if len(entries) == 0 {
+		if usedOnly {
+			return "✅ 没有使用已弃用的命令或配置项"
+		}
+		return "没有已弃用的命令或配置项"
+	}
+
+	var b strings.Builder
+	if usedOnly {
+		b.WriteString(fmt.Sprintf("⚠️ 正在使用的弃用项 (%d):\n", len(entries)))
+	} else {
+		b.WriteString(fmt.Sprintf("📜 弃用项 (%d):\n", len(entries)))
+	}
+	for _, e := range entries {
+		switch e.Kind {
+		case deprecation.Command:
+			b.WriteString(fmt.Sprintf("\n• 命令 %s%s → %s%s", prefix, e.Old, prefix, e.New))
+		default:
+			b.WriteString(fmt.Sprintf("\n• 配置 %s → %s", e.Old, e.New))
+		}
+		var details []string
+		if e.FirstVersion != "" {
+			details = append(details, "自 "+e.FirstVersion+" 起弃用")
+		}
+		if removal := registry.Removal(e); removal != "" {
+			details = append(details, "将于 "+removal+" 移除")
+		}
+		if e.Uses > 0 {
+			details = append(details, fmt.Sprintf("使用 %d 次，最近 %s", e.Uses, e.LastUsed.Format("2006-01-02 15:04")))
+		}
+		if len(details) > 0 {
+			b.WriteString("\n  " + strings.Join(details, " · "))
+		}
+	}
+	return b.String()
+}
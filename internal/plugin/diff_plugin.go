@@ -0,0 +1,221 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/diff"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// diffMaxInline 超过该长度(UTF-16)的差异以 .patch 文件发送
+	diffMaxInline = 3800
+	// diffMaxLines 每一侧参与比较的最大行数
+	diffMaxLines = 5000
+)
+
+// DiffPlugin 比较两条消息或两段文本的差异
+type DiffPlugin struct {
+	*BasePlugin
+}
+
+// NewDiffPlugin 创建差异比较插件
+func NewDiffPlugin() *DiffPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "diff",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "逐行比较两条消息或两段文本",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &DiffPlugin{
+		BasePlugin: NewBasePlugin(info),
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (dp *DiffPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("diff", "比较两条消息或两段代码块的差异", dp.info.Name, dp.handleDiff)
+	logger.Infof("Diff commands registered successfully")
+	return nil
+}
+
+// handleDiff 处理diff命令
+func (dp *DiffPlugin) handleDiff(ctx *command.CommandContext) error {
+	args := ctx.Args
+	opts := diff.RenderOptions{Context: diff.DefaultContext}
+	if len(args) > 0 && args[0] == "-w" {
+		opts.Words = true
+		args = args[1:]
+	}
+
+	oldText, newText, oldName, newName, err := dp.collectInputs(ctx, args)
+	if err != nil {
+		return dp.sendResponse(ctx, "❌ "+err.Error()+"\n\n"+dp.usage())
+	}
+	if len(diff.SplitLines(oldText)) > diffMaxLines || len(diff.SplitLines(newText)) > diffMaxLines {
+		return dp.sendResponse(ctx, fmt.Sprintf("❌ 文本过长，每一侧最多比较 %d 行", diffMaxLines))
+	}
+
+	lines := diff.Lines(oldText, newText)
+	if !diff.Changed(lines) {
+		return dp.sendResponse(ctx, fmt.Sprintf("✅ %s 与 %s 内容相同", oldName, newName))
+	}
+
+	added, removed := 0, 0
+	for _, l := range lines {
+		switch l.Op {
+		case diff.Insert:
+			added++
+		case diff.Delete:
+			removed++
+		}
+	}
+	header := fmt.Sprintf("🔀 %s → %s (+%d −%d)\n", oldName, newName, added, removed)
+	body := diff.Render(lines, opts)
+
+	if utf16Len(header)+utf16Len(body) > diffMaxInline {
+		peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+		if err != nil {
+			return fmt.Errorf("failed to resolve peer: %w", err)
+		}
+		patch := diff.Unified(lines, oldName, newName, diff.DefaultContext)
+		if err := sendDocument(ctx, peer, MediaUpload{
+			FileName: "diff.patch",
+			Data:     []byte(patch),
+			MimeType: "text/x-diff",
+			Caption:  strings.TrimSpace(header) + "\n差异过长，已作为文件发送",
+			ReplyTo:  replyTargetFromContext(ctx),
+		}); err != nil {
+			return dp.sendResponse(ctx, "❌ "+err.Error())
+		}
+		return deleteCommandMessage(ctx, peer)
+	}
+
+	return dp.sendCode(ctx, header, body)
+}
+
+// collectInputs 按以下顺序确定比较的两段文本：
+// 命令中的两个代码块；回复消息与参数中的消息ID；参数中的两个消息ID
+func (dp *DiffPlugin) collectInputs(ctx *command.CommandContext, args []string) (string, string, string, string, error) {
+	if blocks := codeBlocks(ctx.Message.Message); len(blocks) >= 2 {
+		return blocks[0], blocks[1], "代码块1", "代码块2", nil
+	}
+
+	var ids []int
+	for _, arg := range args {
+		id, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+		if err != nil || id <= 0 {
+			return "", "", "", "", fmt.Errorf("无效的消息ID: %s", arg)
+		}
+		ids = append(ids, id)
+	}
+	if replyTo, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader); ok && replyTo.ReplyToMsgID != 0 {
+		ids = append([]int{replyTo.ReplyToMsgID}, ids...)
+	}
+	if len(ids) != 2 {
+		return "", "", "", "", fmt.Errorf("需要两条消息或两个代码块")
+	}
+
+	// 较早的消息作为修改前的版本
+	if ids[0] > ids[1] {
+		ids[0], ids[1] = ids[1], ids[0]
+	}
+	var texts [2]string
+	for i, id := range ids {
+		msg, err := fetchMessageByID(ctx, id)
+		if err != nil {
+			return "", "", "", "", fmt.Errorf("获取消息 #%d 失败: %v", id, err)
+		}
+		texts[i] = msg.Message
+	}
+	return texts[0], texts[1], fmt.Sprintf("#%d", ids[0]), fmt.Sprintf("#%d", ids[1]), nil
+}
+
+// codeBlocks 提取命令消息中的代码块。Telegram客户端通常把 ``` 转换为Pre实体，
+// 没有实体时再按原始 ``` 围栏解析
+func codeBlocks(msg *tg.Message) []string {
+	var blocks []string
+	for _, entity := range msg.Entities {
+		if _, ok := entity.(*tg.MessageEntityPre); ok {
+			blocks = append(blocks, utf16Slice(msg.Message, entity.GetOffset(), entity.GetLength()))
+		}
+	}
+	if len(blocks) >= 2 {
+		return blocks
+	}
+
+	parts := strings.Split(msg.Message, "```")
+	blocks = blocks[:0]
+	for i := 1; i+1 < len(parts); i += 2 {
+		block := parts[i]
+		// 去掉围栏后的语言标记行
+		if nl := strings.IndexByte(block, '\n'); nl >= 0 && !strings.ContainsAny(block[:nl], " \t") {
+			block = block[nl+1:]
+		}
+		blocks = append(blocks, strings.Trim(block, "\n"))
+	}
+	return blocks
+}
+
+// utf16Len 返回字符串的UTF-16长度，与消息实体的偏移单位一致
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// utf16Slice 按UTF-16偏移截取字符串
+func utf16Slice(s string, offset, length int) string {
+	units := utf16.Encode([]rune(s))
+	if offset < 0 || offset > len(units) {
+		return ""
+	}
+	end := offset + length
+	if end > len(units) {
+		end = len(units)
+	}
+	return string(utf16.Decode(units[offset:end]))
+}
+
+// usage 返回用法说明
+func (dp *DiffPlugin) usage() string {
+	return `用法:
+• 回复消息 .diff <消息ID> - 比较被回复的消息与指定消息
+• .diff <消息ID1> <消息ID2> - 比较两条消息
+• .diff 后附两个代码块 - 比较两段文本
+• 加 -w 参数对修改的行做单词级标记`
+}
+
+// sendCode 将差异放在代码块中编辑命令消息
+func (dp *DiffPlugin) sendCode(ctx *command.CommandContext, header, body string) error {
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+
+	req := &tg.MessagesEditMessageRequest{
+		Peer:    peer,
+		ID:      ctx.Message.Message.ID,
+		Message: header + body,
+	}
+	req.SetEntities([]tg.MessageEntityClass{
+		&tg.MessageEntityPre{Offset: utf16Len(header), Length: utf16Len(body), Language: "diff"},
+	})
+	_, err = ctx.API.MessagesEditMessage(ctx.Context, req)
+	return err
+}
+
+// sendResponse 发送响应消息
+func (dp *DiffPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -3,20 +3,37 @@ package plugin
 import (
 	"context"
 	"fmt"
+	"nexusvalet/internal/capability"
 	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
 	"nexusvalet/pkg/logger"
+	"slices"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gotd/td/tg"
 )
 
+// dmeDefaultStatusDelay 删除完成后状态消息默认显示的时间
+const dmeDefaultStatusDelay = 5 * time.Second
+
+// dmeStatusDelay 删除完成后状态消息显示的时间，为负数时不显示状态
+var dmeStatusDelay atomic.Int64
+
+func init() {
+	dmeStatusDelay.Store(int64(dmeDefaultStatusDelay))
+}
+
 // DeleteMyMessagesPlugin 删除我的消息插件
 type DeleteMyMessagesPlugin struct {
 	*BasePlugin
 	telegramAPI *tg.Client
-	deleteMutex sync.Mutex // 防止并发删除操作
+	deleteMutex sync.Mutex              // 防止并发删除操作
+	purges      map[int64]*purgeRequest // chat_id -> 等待确认的 .purgefrom
+	purgeMutex  sync.Mutex
 }
 
 // NewDeleteMyMessagesPlugin 创建删除我的消息插件
@@ -34,6 +51,7 @@ func NewDeleteMyMessagesPlugin() *DeleteMyMessagesPlugin {
 
 	plugin := &DeleteMyMessagesPlugin{
 		BasePlugin: NewBasePlugin(info),
+		purges:     make(map[int64]*purgeRequest),
 	}
 
 	return plugin
@@ -60,21 +78,74 @@ func (dmp *DeleteMyMessagesPlugin) SetTelegramClient(client *tg.Client) {
 	logger.Infof("DeleteMyMessages plugin: Telegram client set successfully")
 }
 
+// dmeLongHelp .help dme 显示的详细帮助
+const dmeLongHelp = `🗑️ DeleteMyMessages 删除我的消息插件详细帮助
+
+🗑️ .dme 命令:
+  删除当前对话中您发送的特定数量消息，功能包括:
+  • 🎯 精确删除指定数量的您发送的消息
+  • 🔍 自动筛选您发送的消息
+  • ⚡ 高效批量删除处理
+  • 🛡️ 防误操作保护机制
+
+📝 使用方法:
+  • .dme - 删除您发送的最近1条消息
+  • .dme 5 - 删除您发送的最近5条消息
+  • .dme 20 - 删除您发送的最近20条消息
+
+⚠️ 注意事项:
+  • 只会删除您自己发送的消息，不影响他人消息
+  • 以匿名管理员身份发送的消息、转发的帖子和服务消息也会删除
+  • 完成后显示删除数量，几秒后自动删除
+  • 一次最多删除100条消息（防止误操作）
+  • 删除操作不可撤销，请谨慎使用
+  • 支持私聊、群聊、频道等所有聊天类型
+  • 删除过程异步进行，不会阻塞其他操作
+
+🧹 .purgefrom 命令:
+  回复一条消息发送 .purgefrom，删除从该消息到命令消息(含)之间的所有人的消息
+  • 需要当前账号是群组管理员
+  • 超过200条时需要在1分钟内发送 .purgefrom confirm 确认
+  • 一次最多删除1000条，可通过 plugins.purge.max_messages 修改
+  • 完成后显示删除数量，几秒后自动删除
+
+💡 使用场景:
+  • 清理测试消息
+  • 删除错误发送的内容
+  • 批量清理聊天记录
+  • 保护隐私信息`
+
 // RegisterCommands 注册命令
 func (dmp *DeleteMyMessagesPlugin) RegisterCommands(parser *command.Parser) error {
 	// 注册主命令
 	parser.RegisterCommand("dme", "删除当前对话中您发送的特定数量的消息", dmp.info.Name, dmp.handleDeleteMyMessages)
+	parser.RegisterCommand("purgefrom", "删除从回复的消息到命令消息之间的所有消息，超过200条时需 .purgefrom confirm 确认", dmp.info.Name, dmp.handlePurgeFrom)
+	parser.RegisterLongHelp(dmp.info.Name, dmeLongHelp)
 
 	logger.Infof("DeleteMyMessages commands registered successfully")
 	return nil
 }
 
+// Capabilities 实现CapabilityPlugin接口，声明历史查询和删除消息接口
+func (dmp *DeleteMyMessagesPlugin) Capabilities() []capability.Requirement {
+	return []capability.Requirement{
+		capability.Require((*tg.Client)(nil), "MessagesGetHistory", "MessagesSearch", "MessagesDeleteMessages", "ChannelsDeleteMessages", "ChannelsGetParticipant", "MessagesGetChats"),
+		capability.Require(tg.MessagesGetHistoryRequest{}, "Peer", "OffsetID", "Limit", "MinID"),
+		capability.Require(tg.MessagesSearchRequest{}, "Peer", "FromID", "Filter", "OffsetID", "Limit"),
+		capability.Require(tg.MessagesDeleteMessagesRequest{}, "ID", "Revoke"),
+		capability.Require(tg.ChannelsDeleteMessagesRequest{}, "Channel", "ID"),
+	}
+}
+
 // handleDeleteMyMessages 处理删除我的消息命令
 func (dmp *DeleteMyMessagesPlugin) handleDeleteMyMessages(ctx *command.CommandContext) error {
 	// 检查Telegram API是否可用
 	if dmp.telegramAPI == nil {
 		return nil
 	}
+	if botMode.Load() {
+		return dmp.sendResponse(ctx, "❌ 机器人账号不能搜索和删除自己在对话中的历史消息，.dme 只能在用户账号下使用")
+	}
 
 	// 防止并发删除操作
 	dmp.deleteMutex.Lock()
@@ -109,17 +180,50 @@ func (dmp *DeleteMyMessagesPlugin) handleDeleteMyMessages(ctx *command.CommandCo
 		return nil
 	}
 
-	// 异步执行：先删除命令消息，再删除用户历史消息，不发送任何提示
-	go func() {
-		asyncCtx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-		defer cancel()
+	// sudo用户的命令消息不能编辑，也不能按"自己发送"筛选
+	self := !ctx.Message.Sudo
+	statusDelay := time.Duration(dmeStatusDelay.Load())
 
-		// 删除命令消息本身
-		_ = dmp.deleteCommandMessage(asyncCtx, resolvedPeer, commandMsgID)
+	// 异步执行：删除用户历史消息后把命令消息编辑为删除结果，显示几秒后删除
+	run := func(taskCtx context.Context, progress core.ProgressFunc) (string, error) {
+		// 不显示状态时先删除命令消息本身
+		showStatus := self && statusDelay >= 0
+		if !showStatus {
+			_ = dmp.deleteCommandMessage(taskCtx, resolvedPeer, commandMsgID)
+		}
 
 		// 后台删除指定数量的用户消息（排除命令消息）
-		_ = dmp.deleteMyMessagesAsync(asyncCtx, resolvedPeer, currentUserID, chatID, commandMsgID, deleteCount)
-	}()
+		deleted := dmp.deleteMyMessagesAsync(taskCtx, resolvedPeer, currentUserID, chatID, commandMsgID, deleteCount, self)
+		progress(deleted, deleteCount, "")
+		result := fmt.Sprintf("已删除 %d 条消息", deleted)
+
+		if showStatus {
+			status := fmt.Sprintf("🧹 已删除 %d/%d 条消息", deleted, deleteCount)
+			if err := dmp.updateCommandMessage(taskCtx, resolvedPeer, commandMsgID, status); err != nil {
+				logger.Debugf("Failed to show dme status: %v", err)
+				_ = dmp.deleteCommandMessage(taskCtx, resolvedPeer, commandMsgID)
+				return result, nil
+			}
+			scheduleDeletion(ctx, dmp.GetManager(), []int{commandMsgID}, statusDelay, "dme")
+		}
+		return result, nil
+	}
+
+	// 通过任务管理器运行，可以使用 .cancel 取消；删除命令消息后不编辑状态
+	runner := taskRunnerFrom(dmp.GetManager())
+	if runner == nil {
+		go func() {
+			asyncCtx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+			_, _ = run(asyncCtx, func(int, int, string) {})
+		}()
+		return nil
+	}
+	runner.Start(context.Background(), core.TaskOptions{
+		ChatID:  chatID,
+		Name:    "dme",
+		Timeout: 2 * time.Minute,
+	}, run)
 
 	return nil
 }
@@ -140,11 +244,11 @@ func (dmp *DeleteMyMessagesPlugin) deleteMyMessages(ctx *command.CommandContext,
 		return 0
 	}
 
-	return dmp.findAndDeleteMessages(ctx.Context, peer, userID, ctx.Message.ChatID, ctx.Message.Message.ID, count)
+	return dmp.findAndDeleteMessages(ctx.Context, peer, userID, ctx.Message.ChatID, ctx.Message.Message.ID, count, !ctx.Message.Sudo)
 }
 
 // deleteMyMessagesAsync 删除指定数量的我的消息（异步版本，用于后台操作）
-func (dmp *DeleteMyMessagesPlugin) deleteMyMessagesAsync(ctx context.Context, peer tg.InputPeerClass, userID int64, chatID int64, excludeMessageID int, count int) int {
+func (dmp *DeleteMyMessagesPlugin) deleteMyMessagesAsync(ctx context.Context, peer tg.InputPeerClass, userID int64, chatID int64, excludeMessageID int, count int, self bool) int {
 	if dmp.telegramAPI == nil {
 		logger.Errorf("Telegram API is nil")
 		return 0
@@ -152,13 +256,110 @@ func (dmp *DeleteMyMessagesPlugin) deleteMyMessagesAsync(ctx context.Context, pe
 
 	logger.Debugf("Starting async deletion process for user %d in chat %d, count %d", userID, chatID, count)
 
-	return dmp.findAndDeleteMessages(ctx, peer, userID, chatID, excludeMessageID, count)
+	return dmp.findAndDeleteMessages(ctx, peer, userID, chatID, excludeMessageID, count, self)
 }
 
-// findAndDeleteMessages 查找并删除消息（共享逻辑）
-func (dmp *DeleteMyMessagesPlugin) findAndDeleteMessages(ctx context.Context, peer tg.InputPeerClass, userID int64, chatID int64, excludeMessageID int, count int) int {
+// findAndDeleteMessages 查找并删除消息（共享逻辑）。self为true时userID是当前账号，
+// 先用 MessagesSearch 获取自己发送的消息，再逐批扫描历史补上搜索不到的消息
+func (dmp *DeleteMyMessagesPlugin) findAndDeleteMessages(ctx context.Context, peer tg.InputPeerClass, userID int64, chatID int64, excludeMessageID int, count int, self bool) int {
 	logger.Infof("Finding messages from user %d in chat %d, target count: %d", userID, chatID, count)
 
+	var myMessages []int
+	if self {
+		var err error
+		myMessages, err = dmp.searchMyMessages(ctx, peer, excludeMessageID, count)
+		if err != nil {
+			logger.Infof("Message search unavailable in chat %d, scanning history: %v", chatID, err)
+		}
+	}
+	// 匿名管理员身份发送的消息搜索不到，只能从历史中按 Out 标记查找，与搜索结果合并
+	if ctx.Err() == nil {
+		myMessages = mergeMessageIDs(myMessages, dmp.scanMyMessages(ctx, peer, userID, excludeMessageID, count, self), count)
+	}
+
+	if len(myMessages) == 0 {
+		logger.Infof("No messages found to delete")
+		return 0
+	}
+
+	// 删除消息
+	deleted := dmp.deleteMessageBatchAsync(ctx, peer, myMessages)
+
+	logger.Infof("Successfully deleted %d messages out of %d found", deleted, len(myMessages))
+	return deleted
+}
+
+// mergeMessageIDs 合并两组消息ID，去重后从新到旧保留最多count条
+func mergeMessageIDs(a, b []int, count int) []int {
+	merged := slices.Concat(a, b)
+	slices.SortFunc(merged, func(x, y int) int { return y - x })
+	merged = slices.Compact(merged)
+	if len(merged) > count {
+		merged = merged[:count]
+	}
+	return merged
+}
+
+// searchMyMessages 通过 MessagesSearch 按发送者为自己分批查找消息，比逐批获取整个历史的请求少得多
+func (dmp *DeleteMyMessagesPlugin) searchMyMessages(ctx context.Context, peer tg.InputPeerClass, excludeMessageID int, count int) ([]int, error) {
+	var myMessages []int
+	maxBatchSize := 100 // 每批获取的消息数量
+	maxBatches := 10    // 最多获取的批次数
+	lastMessageID := 0  // 用于分页
+
+	for batch := 0; batch < maxBatches && len(myMessages) < count && ctx.Err() == nil; batch++ {
+		resp, err := dmp.telegramAPI.MessagesSearch(ctx, &tg.MessagesSearchRequest{
+			Peer:     peer,
+			Q:        "",
+			FromID:   &tg.InputPeerSelf{},
+			Filter:   &tg.InputMessagesFilterEmpty{},
+			OffsetID: lastMessageID,
+			Limit:    maxBatchSize,
+		})
+		if err != nil {
+			return myMessages, fmt.Errorf("failed to search messages: %w", err)
+		}
+
+		messages := notEmptyMessages(resp)
+		if len(messages) == 0 {
+			break
+		}
+		lastMessageID = messages[len(messages)-1].GetID()
+
+		for _, msg := range messages {
+			if msg.GetID() == excludeMessageID {
+				continue
+			}
+			myMessages = append(myMessages, msg.GetID())
+			if len(myMessages) >= count {
+				break
+			}
+		}
+		logger.Debugf("Search batch %d: %d messages, %d collected", batch+1, len(messages), len(myMessages))
+
+		if len(messages) < maxBatchSize {
+			break
+		}
+	}
+	return myMessages, nil
+}
+
+// isMyMessage 消息是否由userID发送。self为true时自己发出的消息(Out)也计入，
+// 包括以匿名管理员身份发送、发送者为群组本身的消息，以及服务消息
+func isMyMessage(msg tg.NotEmptyMessage, userID int64, self bool) bool {
+	if self && msg.GetOut() {
+		return true
+	}
+	fromID, ok := msg.GetFromID()
+	if !ok {
+		return false
+	}
+	peerUser, ok := fromID.(*tg.PeerUser)
+	return ok && peerUser.UserID == userID
+}
+
+// scanMyMessages 逐批获取消息历史并筛选用户发送的消息
+func (dmp *DeleteMyMessagesPlugin) scanMyMessages(ctx context.Context, peer tg.InputPeerClass, userID int64, excludeMessageID int, count int, self bool) []int {
 	// 获取消息历史并筛选用户消息
 	var myMessages []int
 	maxBatchSize := 100 // 每批获取的消息数量
@@ -167,8 +368,8 @@ func (dmp *DeleteMyMessagesPlugin) findAndDeleteMessages(ctx context.Context, pe
 
 	// 分批获取消息历史
 	for batch := 0; batch < maxBatches; batch++ {
-		// 如果已经找到足够的消息，停止搜索
-		if len(myMessages) >= count {
+		// 如果已经找到足够的消息或任务被取消，停止搜索
+		if len(myMessages) >= count || ctx.Err() != nil {
 			break
 		}
 
@@ -186,25 +387,23 @@ func (dmp *DeleteMyMessagesPlugin) findAndDeleteMessages(ctx context.Context, pe
 		}
 
 		// 记录最后一条消息的ID，用于下一批查询
-		lastMessageID = messages[len(messages)-1].ID
+		lastMessageID = messages[len(messages)-1].GetID()
 
 		// 筛选当前用户发送的消息
 		foundInBatch := 0
 		for _, msg := range messages {
 			// 排除命令消息，避免后续无法编辑/删除提示
-			if excludeMessageID != 0 && msg.ID == excludeMessageID {
+			if excludeMessageID != 0 && msg.GetID() == excludeMessageID {
 				continue
 			}
 			// 检查是否是当前用户发送的消息
-			if msg.FromID != nil {
-				if peerUser, ok := msg.FromID.(*tg.PeerUser); ok && peerUser.UserID == userID {
-					myMessages = append(myMessages, msg.ID)
-					foundInBatch++
-
-					// 如果已经找到足够的消息，停止搜索
-					if len(myMessages) >= count {
-						break
-					}
+			if isMyMessage(msg, userID, self) {
+				myMessages = append(myMessages, msg.GetID())
+				foundInBatch++
+
+				// 如果已经找到足够的消息，停止搜索
+				if len(myMessages) >= count {
+					break
 				}
 			}
 		}
@@ -219,27 +418,16 @@ func (dmp *DeleteMyMessagesPlugin) findAndDeleteMessages(ctx context.Context, pe
 		}
 	}
 
-	if len(myMessages) == 0 {
-		logger.Infof("No messages found to delete")
-		return 0
-	}
-
-	// 删除消息
-	deleted := dmp.deleteMessageBatchAsync(ctx, peer, myMessages)
-
-	logger.Infof("Successfully deleted %d messages out of %d found", deleted, len(myMessages))
-	return deleted
+	return myMessages
 }
 
-// getRecentMessagesAsync 获取最近的消息，支持分页（异步版本）
-func (dmp *DeleteMyMessagesPlugin) getRecentMessagesAsync(ctx context.Context, peer tg.InputPeerClass, limit int, offsetID int) ([]*tg.Message, error) {
+// getRecentMessagesAsync 获取最近的消息（包括服务消息），支持分页（异步版本）
+func (dmp *DeleteMyMessagesPlugin) getRecentMessagesAsync(ctx context.Context, peer tg.InputPeerClass, limit int, offsetID int) ([]tg.NotEmptyMessage, error) {
 	// 限制单次获取数量，防止API限制
 	if limit > 100 {
 		limit = 100
 	}
 
-	var messages []*tg.Message
-
 	// 构建通用的请求参数
 	req := &tg.MessagesGetHistoryRequest{
 		Peer:       peer,
@@ -263,50 +451,49 @@ func (dmp *DeleteMyMessagesPlugin) getRecentMessagesAsync(ctx context.Context, p
 		return nil, fmt.Errorf("failed to get message history: %w", err)
 	}
 
+	messages := notEmptyMessages(resp)
+	logger.Debugf("Retrieved %d messages", len(messages))
+	return messages, nil
+}
+
+// notEmptyMessages 从历史或搜索的返回中取出普通消息和服务消息
+func notEmptyMessages(resp tg.MessagesMessagesClass) []tg.NotEmptyMessage {
+	var raw []tg.MessageClass
+
 	// 根据不同的响应类型处理结果
 	switch result := resp.(type) {
 	case *tg.MessagesChannelMessages:
 		// 频道/超级群组消息
 		logger.Debugf("Got channel messages: %d total, %d messages in response",
 			result.Count, len(result.Messages))
-
-		for _, msg := range result.Messages {
-			if message, ok := msg.(*tg.Message); ok {
-				messages = append(messages, message)
-			}
-		}
+		raw = result.Messages
 
 	case *tg.MessagesMessages:
 		// 普通群组或私聊消息
 		logger.Debugf("Got regular messages: %d messages in response", len(result.Messages))
-
-		for _, msg := range result.Messages {
-			if message, ok := msg.(*tg.Message); ok {
-				messages = append(messages, message)
-			}
-		}
+		raw = result.Messages
 
 	case *tg.MessagesMessagesSlice:
 		// 消息切片（部分结果）
 		logger.Debugf("Got message slice: %d total, %d messages in response",
 			result.Count, len(result.Messages))
-
-		for _, msg := range result.Messages {
-			if message, ok := msg.(*tg.Message); ok {
-				messages = append(messages, message)
-			}
-		}
+		raw = result.Messages
 
 	default:
 		logger.Warnf("Unknown response type: %T", resp)
 	}
 
-	logger.Debugf("Retrieved %d messages", len(messages))
-	return messages, nil
+	messages := make([]tg.NotEmptyMessage, 0, len(raw))
+	for _, msg := range raw {
+		if message, ok := msg.AsNotEmpty(); ok {
+			messages = append(messages, message)
+		}
+	}
+	return messages
 }
 
 // getRecentMessages 获取最近的消息，支持分页（同步版本，保留兼容性）
-func (dmp *DeleteMyMessagesPlugin) getRecentMessages(ctx *command.CommandContext, peer tg.InputPeerClass, limit int, offsetID int) ([]*tg.Message, error) {
+func (dmp *DeleteMyMessagesPlugin) getRecentMessages(ctx *command.CommandContext, peer tg.InputPeerClass, limit int, offsetID int) ([]tg.NotEmptyMessage, error) {
 	return dmp.getRecentMessagesAsync(ctx.Context, peer, limit, offsetID)
 }
 
@@ -331,9 +518,13 @@ func (dmp *DeleteMyMessagesPlugin) deleteMessageBatchAsync(ctx context.Context,
 			deleted += len(batch)
 		}
 
-		// 添加延迟避免API限制
+		// 添加延迟避免API限制，任务被取消时停止
 		if end < len(messageIDs) {
-			time.Sleep(100 * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				return deleted
+			case <-time.After(100 * time.Millisecond):
+			}
 		}
 	}
 
@@ -401,29 +592,9 @@ func (dmp *DeleteMyMessagesPlugin) deleteMessage(ctx *command.CommandContext, me
 	}
 }
 
-// sendResponse 发送响应消息（编辑原始消息）
+// sendResponse 发送响应消息（编辑原始消息），命令消息不可编辑时回复命令消息
 func (dmp *DeleteMyMessagesPlugin) sendResponse(ctx *command.CommandContext, message string) error {
-	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-	if err != nil {
-		return fmt.Errorf("failed to resolve peer: %w", err)
-	}
-
-	// 尝试编辑消息，如果失败则发送新消息
-	_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-		Peer:    peer,
-		ID:      ctx.Message.Message.ID,
-		Message: message,
-	})
-
-	if err != nil {
-		// 编辑失败，发送新消息
-		_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-			Peer:     peer,
-			Message:  message,
-			RandomID: time.Now().UnixNano(),
-		})
-	}
-
+	_, err := ctx.Respond(message, format.Plain)
 	return err
 }
 
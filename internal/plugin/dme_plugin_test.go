@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// dmeHistory 超级群中从新到旧的消息：自己(用户1)发送的、以匿名管理员身份发送的和其他人发送的。
+// 10 为命令消息
+func dmeHistory() []tg.MessageClass {
+	me := &tg.PeerUser{UserID: 1}
+	anonymous := &tg.PeerChannel{ChannelID: 123}
+	other := &tg.PeerUser{UserID: 5}
+	msg := func(id int, from tg.PeerClass, out bool) *tg.Message {
+		m := &tg.Message{ID: id, Message: "m"}
+		m.SetOut(out)
+		m.SetFromID(from)
+		return m
+	}
+	return []tg.MessageClass{
+		msg(12, anonymous, true),
+		msg(11, other, false),
+		msg(10, me, true),
+		msg(9, me, true),
+		msg(8, anonymous, true),
+		msg(7, other, false),
+		msg(6, me, true),
+	}
+}
+
+// olderThan 返回ID小于offsetID的消息，offsetID为0时返回全部
+func olderThan(msgs []tg.MessageClass, offsetID int) []tg.MessageClass {
+	var out []tg.MessageClass
+	for _, m := range msgs {
+		if offsetID == 0 || m.GetID() < offsetID {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func TestFindAndDeleteMessagesMixedHistory(t *testing.T) {
+	history := dmeHistory()
+	tests := []struct {
+		name       string
+		count      int
+		searchFail bool
+		want       []int
+	}{
+		// 搜索只能找到用户1发送的消息，匿名管理员的消息从历史中补上
+		{"search and scan", 3, false, []int{12, 9, 8}},
+		{"all", 10, false, []int{12, 9, 8, 6}},
+		{"search unavailable", 10, true, []int{12, 9, 8, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := &fakeInvoker{handle: func(input bin.Encoder, output bin.Decoder) error {
+				box, _ := output.(*tg.MessagesMessagesBox)
+				switch req := input.(type) {
+				case *tg.MessagesSearchRequest:
+					if tt.searchFail {
+						return tgerr.New(400, "SEARCH_QUERY_EMPTY")
+					}
+					var mine []tg.MessageClass
+					for _, m := range olderThan(history, req.OffsetID) {
+						if from, ok := m.(*tg.Message).GetFromID(); ok && reflect.DeepEqual(from, &tg.PeerUser{UserID: 1}) {
+							mine = append(mine, m)
+						}
+					}
+					box.Messages = &tg.MessagesChannelMessages{Messages: mine}
+				case *tg.MessagesGetHistoryRequest:
+					box.Messages = &tg.MessagesChannelMessages{Messages: olderThan(history, req.OffsetID)}
+				default:
+					return errUnhandled
+				}
+				return nil
+			}}
+			dmp := NewDeleteMyMessagesPlugin()
+			dmp.telegramAPI = tg.NewClient(inv)
+			peer := &tg.InputPeerChannel{ChannelID: 123}
+
+			if deleted := dmp.findAndDeleteMessages(context.Background(), peer, 1, -1000000000123, 10, tt.count, true); deleted != len(tt.want) {
+				t.Errorf("deleted = %d, want %d", deleted, len(tt.want))
+			}
+			var got []int
+			for _, req := range requests[*tg.ChannelsDeleteMessagesRequest](inv) {
+				got = append(got, req.ID...)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deleted IDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/flood"
+	"nexusvalet/pkg/logger"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// purgeDefaultMax .purgefrom 一次最多删除的消息数，可通过 plugins.purge.max_messages 修改
+	purgeDefaultMax = 1000
+	// purgeConfirmThreshold 超过该数量时需要发送 .purgefrom confirm 确认
+	purgeConfirmThreshold = 200
+	// purgeConfirmTTL 等待确认的时间
+	purgeConfirmTTL = time.Minute
+	// purgeBatchSize 每次删除请求的消息数
+	purgeBatchSize = 100
+)
+
+// purgeRequest 一次 .purgefrom 删除的范围
+type purgeRequest struct {
+	peer    tg.InputPeerClass
+	fromID  int
+	toID    int
+	ids     []int // 普通群中范围内实际存在的消息ID；频道/超级群为nil，直接按ID范围删除
+	count   int
+	expires time.Time
+}
+
+// batches 把删除范围按 purgeBatchSize 分批，从最早的消息开始
+func (r *purgeRequest) batches() [][]int {
+	ids := r.ids
+	if ids == nil {
+		ids = make([]int, 0, r.count)
+		for id := r.fromID; id <= r.toID; id++ {
+			ids = append(ids, id)
+		}
+	}
+	var batches [][]int
+	for start := 0; start < len(ids); start += purgeBatchSize {
+		batches = append(batches, ids[start:min(start+purgeBatchSize, len(ids))])
+	}
+	return batches
+}
+
+// purgeMax 返回 plugins.purge.max_messages，未配置时为默认值
+func (dmp *DeleteMyMessagesPlugin) purgeMax() int {
+	if goManager, ok := dmp.manager.(*GoManager); ok {
+		if cfg := goManager.GetConfig(); cfg != nil && cfg.Plugins.Purge.MaxMessages > 0 {
+			return cfg.Plugins.Purge.MaxMessages
+		}
+	}
+	return purgeDefaultMax
+}
+
+// handlePurgeFrom 处理purgefrom命令：删除从回复的消息到命令消息(含)之间的所有消息
+func (dmp *DeleteMyMessagesPlugin) handlePurgeFrom(ctx *command.CommandContext) error {
+	if dmp.telegramAPI == nil {
+		return nil
+	}
+	if len(ctx.Args) > 0 && ctx.Args[0] == "confirm" {
+		return dmp.confirmPurge(ctx)
+	}
+
+	replyTo, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok || replyTo.ReplyToMsgID == 0 {
+		return dmp.sendResponse(ctx, "❌ 请回复要开始删除的消息\n\n💡 使用方法: 回复一条消息发送 .purgefrom，删除从该消息到命令消息之间的所有消息")
+	}
+
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return dmp.sendResponse(ctx, fmt.Sprintf("❌ 无法解析当前对话: %v", err))
+	}
+	isAdmin, err := isChatAdmin(ctx.Context, ctx.API, peer)
+	if err != nil {
+		return dmp.sendResponse(ctx, fmt.Sprintf("❌ 权限检查失败\n\n⚠️ 错误信息: %v", err))
+	}
+	if !isAdmin {
+		return dmp.sendResponse(ctx, "❌ 权限不足\n\n🔒 您需要管理员权限才能删除群组中的消息")
+	}
+
+	req := &purgeRequest{peer: peer, fromID: replyTo.ReplyToMsgID, toID: ctx.Message.Message.ID}
+	if req.fromID > req.toID {
+		return dmp.sendResponse(ctx, "❌ 回复的消息不能晚于命令消息")
+	}
+	maxMessages := dmp.purgeMax()
+	if _, ok := peer.(*tg.InputPeerChannel); ok {
+		req.count = req.toID - req.fromID + 1
+	} else {
+		// 普通群的消息ID在账号的所有对话中连续编号，不能按范围删除，需要先取出范围内的消息
+		if botMode.Load() {
+			return dmp.sendResponse(ctx, "❌ 机器人账号不能获取普通群的消息历史，.purgefrom 在普通群中只能在用户账号下使用")
+		}
+		req.ids, err = dmp.collectPurgeIDs(ctx.Context, peer, req.fromID, req.toID, maxMessages+1)
+		if err != nil {
+			return dmp.sendResponse(ctx, fmt.Sprintf("❌ 获取消息历史失败: %v", err))
+		}
+		req.count = len(req.ids)
+	}
+
+	if req.count > maxMessages {
+		return dmp.sendResponse(ctx, fmt.Sprintf("❌ 范围内有超过 %d 条消息，请回复更近的消息\n\n可通过 plugins.purge.max_messages 修改上限", maxMessages))
+	}
+	if req.count > purgeConfirmThreshold {
+		req.expires = time.Now().Add(purgeConfirmTTL)
+		dmp.purgeMutex.Lock()
+		dmp.purges[ctx.Message.ChatID] = req
+		dmp.purgeMutex.Unlock()
+		return dmp.sendResponse(ctx, fmt.Sprintf("⚠️ 将删除 %d 条消息（#%d - #%d）\n\n请在 %d 秒内发送 .purgefrom confirm 确认",
+			req.count, req.fromID, req.toID, int(purgeConfirmTTL.Seconds())))
+	}
+
+	dmp.startPurge(ctx, req, nil)
+	return nil
+}
+
+// confirmPurge 执行当前对话中等待确认的删除，确认命令消息也一起删除
+func (dmp *DeleteMyMessagesPlugin) confirmPurge(ctx *command.CommandContext) error {
+	chatID := ctx.Message.ChatID
+	dmp.purgeMutex.Lock()
+	req, ok := dmp.purges[chatID]
+	delete(dmp.purges, chatID)
+	dmp.purgeMutex.Unlock()
+	if !ok || time.Now().After(req.expires) {
+		return dmp.sendResponse(ctx, "❌ 没有等待确认的删除，请重新回复消息发送 .purgefrom")
+	}
+
+	dmp.startPurge(ctx, req, []int{ctx.Message.Message.ID})
+	return nil
+}
+
+// collectPurgeIDs 分批获取 fromID 到 toID(含)之间实际存在的消息ID，最多取limit条
+func (dmp *DeleteMyMessagesPlugin) collectPurgeIDs(ctx context.Context, peer tg.InputPeerClass, fromID, toID, limit int) ([]int, error) {
+	var ids []int
+	offsetID := toID + 1
+	for len(ids) < limit && ctx.Err() == nil {
+		resp, err := dmp.telegramAPI.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
+			Peer:     peer,
+			OffsetID: offsetID,
+			Limit:    purgeBatchSize,
+			MinID:    fromID - 1,
+		})
+		if err != nil {
+			return nil, err
+		}
+		messages := notEmptyMessages(resp)
+		if len(messages) == 0 {
+			break
+		}
+		for _, msg := range messages {
+			if id := msg.GetID(); id >= fromID && id <= toID {
+				ids = append(ids, id)
+			}
+		}
+		offsetID = messages[len(messages)-1].GetID()
+		if len(messages) < purgeBatchSize || offsetID <= fromID {
+			break
+		}
+	}
+	return ids, ctx.Err()
+}
+
+// startPurge 在后台分批删除消息，完成后发送删除数量，状态消息几秒后自动删除。
+// extra 为删除范围之外需要一起删除的消息(如确认命令)，不计入删除数量
+func (dmp *DeleteMyMessagesPlugin) startPurge(ctx *command.CommandContext, req *purgeRequest, extra []int) {
+	chatID := ctx.Message.ChatID
+	statusDelay := time.Duration(dmeStatusDelay.Load())
+
+	run := func(taskCtx context.Context, progress core.ProgressFunc) (string, error) {
+		deleted, done := 0, 0
+		for _, batch := range req.batches() {
+			if taskCtx.Err() != nil {
+				break
+			}
+			n, err := dmp.purgeBatch(taskCtx, req.peer, chatID, batch)
+			if err != nil {
+				logger.Errorf("Failed to purge messages %d-%d in chat %d: %v", batch[0], batch[len(batch)-1], chatID, err)
+				break
+			}
+			deleted += n
+			done += len(batch)
+			progress(done, req.count, "")
+		}
+		if len(extra) > 0 {
+			if _, err := dmp.purgeBatch(taskCtx, req.peer, chatID, extra); err != nil {
+				logger.Debugf("Failed to delete purge confirmation: %v", err)
+			}
+		}
+		logger.Infof("Purged %d messages from %d to %d in chat %d", deleted, req.fromID, req.toID, chatID)
+
+		result := fmt.Sprintf("已删除 %d 条消息", deleted)
+		if statusDelay >= 0 {
+			dmp.sendPurgeStatus(ctx, taskCtx, req.peer, fmt.Sprintf("🧹 已删除 %d 条消息", deleted), statusDelay)
+		}
+		return result, nil
+	}
+
+	// 通过任务管理器运行，可以使用 .cancel 取消；命令消息在删除范围内，不编辑状态
+	runner := taskRunnerFrom(dmp.GetManager())
+	if runner == nil {
+		go func() {
+			asyncCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+			_, _ = run(asyncCtx, func(int, int, string) {})
+		}()
+		return
+	}
+	runner.Start(context.Background(), core.TaskOptions{
+		ChatID:  chatID,
+		Name:    "purgefrom",
+		Timeout: 5 * time.Minute,
+	}, run)
+}
+
+// purgeBatch 删除一批消息，返回实际删除的数量。已经不存在的消息ID不算错误，也不计入数量
+func (dmp *DeleteMyMessagesPlugin) purgeBatch(ctx context.Context, peer tg.InputPeerClass, chatID int64, ids []int) (int, error) {
+	var affected *tg.MessagesAffectedMessages
+	del := func() error {
+		var err error
+		if channel, ok := peer.(*tg.InputPeerChannel); ok {
+			affected, err = dmp.telegramAPI.ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{
+				Channel: &tg.InputChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash},
+				ID:      ids,
+			})
+		} else {
+			affected, err = dmp.telegramAPI.MessagesDeleteMessages(ctx, &tg.MessagesDeleteMessagesRequest{
+				ID:     ids,
+				Revoke: true,
+			})
+		}
+		return err
+	}
+
+	var err error
+	if limiter := dmp.floodLimiter(); limiter != nil {
+		err = limiter.Retry(ctx, chatID, del)
+	} else {
+		err = del()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return affected.PtsCount, nil
+}
+
+// floodLimiter 返回管理器的发送频率限制
+func (dmp *DeleteMyMessagesPlugin) floodLimiter() *flood.Limiter {
+	if goManager, ok := dmp.manager.(*GoManager); ok {
+		return goManager.GetFloodLimiter()
+	}
+	return nil
+}
+
+// sendPurgeStatus 发送删除结果，delay后删除该消息
+func (dmp *DeleteMyMessagesPlugin) sendPurgeStatus(ctx *command.CommandContext, taskCtx context.Context, peer tg.InputPeerClass, text string, delay time.Duration) {
+	updates, err := flood.Call(taskCtx, dmp.floodLimiter(), ctx.Message.ChatID, func() (tg.UpdatesClass, error) {
+		return dmp.telegramAPI.MessagesSendMessage(taskCtx, &tg.MessagesSendMessageRequest{
+			Peer:     peer,
+			Message:  text,
+			RandomID: time.Now().UnixNano(),
+		})
+	})
+	if err != nil {
+		logger.Debugf("Failed to send purge status: %v", err)
+		return
+	}
+	if id := command.SentMessageID(updates); id != 0 {
+		scheduleDeletion(ctx, dmp.GetManager(), []int{id}, delay, "dme")
+	}
+}
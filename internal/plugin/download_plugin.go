@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/capability"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// downloadDefaultDir 未配置 media.download_dir 时的下载目录
+	downloadDefaultDir = "downloads"
+	// downloadProgressInterval 两次更新下载进度之间的最短间隔
+	downloadProgressInterval = 3 * time.Second
+)
+
+// DownloadPlugin 把回复的照片或文件下载到本地目录
+type DownloadPlugin struct {
+	*BasePlugin
+}
+
+// NewDownloadPlugin 创建下载插件
+func NewDownloadPlugin() *DownloadPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "download",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "下载回复的照片或文件到本地目录",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &DownloadPlugin{
+		BasePlugin: NewBasePlugin(info),
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (dp *DownloadPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("dl", "回复消息使用，下载其中的照片或文件到本地", dp.info.Name, dp.handleDownload)
+	logger.Infof("Download commands registered successfully")
+	return nil
+}
+
+// Capabilities 实现CapabilityPlugin接口
+func (dp *DownloadPlugin) Capabilities() []capability.Requirement {
+	return []capability.Requirement{
+		capability.Require((*tg.Client)(nil), "UploadGetFile"),
+		capability.Require(tg.UploadGetFileRequest{}, "Location", "Offset", "Limit"),
+	}
+}
+
+// handleDownload 处理dl命令：先下载到临时文件，完成后改为原文件名
+func (dp *DownloadPlugin) handleDownload(ctx *command.CommandContext) error {
+	msg, err := fetchReplyMessage(ctx)
+	if err != nil {
+		return dp.sendResponse(ctx, "❌ 请回复包含照片或文件的消息")
+	}
+	if _, err := mediaFileFromMessage(msg); err != nil {
+		return dp.sendResponse(ctx, fmt.Sprintf("❌ %v", err))
+	}
+
+	dir := dp.downloadDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return dp.sendResponse(ctx, fmt.Sprintf("❌ 创建下载目录失败: %v", err))
+	}
+	tmp, err := os.CreateTemp(dir, ".dl-*.part")
+	if err != nil {
+		return dp.sendResponse(ctx, fmt.Sprintf("❌ 创建文件失败: %v", err))
+	}
+	defer os.Remove(tmp.Name())
+
+	dp.showProgress(ctx, "⬇️ 正在下载...")
+	start := time.Now()
+	lastUpdate := start
+	file, n, err := downloadMessageMedia(ctx, msg, tmp, func(done, total int64) {
+		if time.Since(lastUpdate) < downloadProgressInterval || total == 0 {
+			return
+		}
+		lastUpdate = time.Now()
+		dp.showProgress(ctx, fmt.Sprintf("⬇️ 正在下载 %d%% (%s / %s)", done*100/total, formatBytes(done), formatBytes(total)))
+	})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return dp.sendResponse(ctx, fmt.Sprintf("❌ 下载失败: %v", err))
+	}
+
+	path := uniqueDownloadPath(dir, file.Name)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return dp.sendResponse(ctx, fmt.Sprintf("❌ 保存文件失败: %v", err))
+	}
+	logger.Ctx(ctx.Context).Infof("Downloaded %s (%d bytes) in %s", path, n, time.Since(start).Round(time.Millisecond))
+	return dp.sendResponse(ctx, fmt.Sprintf("✅ 已下载到 %s\n\n大小: %s，用时 %s",
+		path, formatBytes(n), time.Since(start).Round(100*time.Millisecond)))
+}
+
+// downloadDir 返回配置的下载目录
+func (dp *DownloadPlugin) downloadDir() string {
+	if goManager, ok := dp.manager.(*GoManager); ok {
+		if cfg := goManager.GetConfig(); cfg != nil && cfg.Media.DownloadDir != "" {
+			return cfg.Media.DownloadDir
+		}
+	}
+	return downloadDefaultDir
+}
+
+// uniqueDownloadPath 返回目录中不与已有文件重名的路径，重名时在文件名后加序号
+func uniqueDownloadPath(dir, name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		name = "file"
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	path := filepath.Join(dir, name)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s_%d%s", base, i, ext))
+	}
+}
+
+// showProgress 把命令消息编辑为下载进度，编辑失败时不发送新消息
+func (dp *DownloadPlugin) showProgress(ctx *command.CommandContext, message string) {
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return
+	}
+	if _, err := ctx.EditMessage(&tg.MessagesEditMessageRequest{
+		Peer:    peer,
+		ID:      ctx.Message.Message.ID,
+		Message: message,
+	}); err != nil {
+		logger.Ctx(ctx.Context).Debugf("Failed to update download progress: %v", err)
+	}
+}
+
+// sendResponse 发送响应消息
+func (dp *DownloadPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
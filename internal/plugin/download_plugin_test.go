@@ -0,0 +1,224 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"nexusvalet/internal/config"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/download"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// downloadTest 注册了dl命令的测试环境，回复的消息(ID 20)包含一个文件
+type downloadTest struct {
+	env       *testEnv
+	dir       string
+	name      string // 文件名属性
+	data      []byte
+	reference string // 服务器当前接受的文件引用
+	fetches   int    // 获取回复消息的次数
+}
+
+func newDownloadTest(t *testing.T, name string, size int) *downloadTest {
+	t.Helper()
+	dt := &downloadTest{env: newTestEnv(), dir: t.TempDir(), name: name, data: bytes.Repeat([]byte("nexus"), size/5), reference: "ref1"}
+	dt.env.inv.handle = dt.handle
+	gm := NewGoManager(dt.env.parser, core.NewEventDispatcher(), core.NewHookManager(), openPluginDB(t))
+	t.Cleanup(func() { gm.Shutdown() })
+	gm.config = &config.Config{Media: config.MediaConfig{DownloadDir: dt.dir}}
+	if err := gm.RegisterPlugin(NewDownloadPlugin()); err != nil {
+		t.Fatal(err)
+	}
+	return dt
+}
+
+func (dt *downloadTest) handle(input bin.Encoder, output bin.Decoder) error {
+	switch req := input.(type) {
+	case *tg.MessagesGetMessagesRequest:
+		dt.fetches++
+		var msgs []tg.MessageClass
+		if id := req.ID[0].(*tg.InputMessageID).ID; id == 20 {
+			msgs = append(msgs, &tg.Message{ID: 20, Media: &tg.MessageMediaDocument{Document: &tg.Document{
+				ID:            7,
+				AccessHash:    8,
+				FileReference: []byte(dt.reference),
+				Size:          int64(len(dt.data)),
+				Attributes:    []tg.DocumentAttributeClass{&tg.DocumentAttributeFilename{FileName: dt.name}},
+			}}})
+		}
+		output.(*tg.MessagesMessagesBox).Messages = &tg.MessagesMessages{Messages: msgs}
+	case *tg.UploadGetFileRequest:
+		loc := req.Location.(*tg.InputDocumentFileLocation)
+		if string(loc.FileReference) != dt.reference {
+			return tgerr.New(400, "FILE_REFERENCE_EXPIRED")
+		}
+		return serveFile(dt.data, req, output)
+	default:
+		return errUnhandled
+	}
+	return nil
+}
+
+// serveFile 按请求的偏移返回文件内容
+func serveFile(data []byte, req *tg.UploadGetFileRequest, output bin.Decoder) error {
+	start := min(int(req.Offset), len(data))
+	end := min(start+req.Limit, len(data))
+	output.(*tg.UploadFileBox).File = &tg.UploadFile{Bytes: data[start:end]}
+	return nil
+}
+
+// reply 回复ID为20的消息执行dl命令，返回最终显示的内容
+func (dt *downloadTest) reply(t *testing.T) string {
+	t.Helper()
+	msgEvent := &core.MessageEvent{ChatID: -100, UserID: 1, Message: &tg.Message{ID: 10, ReplyTo: &tg.MessageReplyHeader{ReplyToMsgID: 20}}}
+	out, err := dt.env.run(msgEvent, "dl")
+	if err != nil || out == nil {
+		t.Fatalf("dl = %+v, %v", out, err)
+	}
+	return out.Text
+}
+
+func TestDownloadCommandSavesReplyMedia(t *testing.T) {
+	dt := newDownloadTest(t, "../report.pdf", 3*download.ChunkSize/2)
+
+	// 文件名去掉路径，重名时加序号
+	for _, name := range []string{"report.pdf", "report_1.pdf"} {
+		got := dt.reply(t)
+		path := filepath.Join(dt.dir, name)
+		if !strings.HasPrefix(got, "✅ 已下载到 "+path+"\n\n大小: ") {
+			t.Errorf("result = %q, want %s", got, path)
+		}
+		if data, err := os.ReadFile(path); err != nil || !bytes.Equal(data, dt.data) {
+			t.Errorf("%s: %d bytes, %v", name, len(data), err)
+		}
+	}
+	// 不留下临时文件
+	entries, _ := os.ReadDir(dt.dir)
+	if len(entries) != 2 {
+		t.Errorf("download dir has %d entries, want 2", len(entries))
+	}
+	// 捕获模式下进度编辑也被捕获，不编辑来源对话中的消息
+	if edits := editedTexts(dt.env); len(edits) != 0 {
+		t.Errorf("edits = %q, want none while captured", edits)
+	}
+}
+
+func TestDownloadCommandRefetchesExpiredReference(t *testing.T) {
+	dt := newDownloadTest(t, "a.bin", 1000)
+	// 获取消息后文件引用过期，重新获取消息得到新引用
+	fetch := dt.handle
+	dt.env.inv.handle = func(input bin.Encoder, output bin.Decoder) error {
+		err := fetch(input, output)
+		if _, ok := input.(*tg.MessagesGetMessagesRequest); ok && dt.fetches == 1 {
+			dt.reference = "ref2"
+		}
+		return err
+	}
+
+	if got := dt.reply(t); !strings.HasPrefix(got, "✅ 已下载到 ") {
+		t.Fatalf("result = %q", got)
+	}
+	if dt.fetches != 2 {
+		t.Errorf("message fetched %d times, want once more after the reference expired", dt.fetches)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dt.dir, "a.bin")); !bytes.Equal(data, dt.data) {
+		t.Errorf("downloaded %d bytes, want %d", len(data), len(dt.data))
+	}
+}
+
+func TestDownloadCommandErrors(t *testing.T) {
+	dt := newDownloadTest(t, "a.bin", 1000)
+
+	if out, err := dt.env.run(nil, "dl"); err != nil || out == nil || out.Text != "❌ 请回复包含照片或文件的消息" {
+		t.Errorf("without reply = %+v, %v", out, err)
+	}
+
+	// 文件在其他DC且没有配置共用的下载器时报告错误，不留下部分文件
+	dt.env.inv.handle = func(input bin.Encoder, output bin.Decoder) error {
+		if _, ok := input.(*tg.UploadGetFileRequest); ok {
+			return tgerr.New(303, "FILE_MIGRATE_3")
+		}
+		return dt.handle(input, output)
+	}
+	if got := dt.reply(t); !strings.HasPrefix(got, "❌ 下载失败: 连接到 DC 3 失败") {
+		t.Errorf("migrate without dialer = %q", got)
+	}
+	if entries, _ := os.ReadDir(dt.dir); len(entries) != 0 {
+		t.Errorf("download dir has %d entries after failure", len(entries))
+	}
+}
+
+// dcInvoker 其他DC上提供文件的连接
+type dcInvoker struct {
+	data []byte
+}
+
+func (d *dcInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	return serveFile(d.data, input.(*tg.UploadGetFileRequest), output)
+}
+
+func (d *dcInvoker) Close() error { return nil }
+
+// dcDialer 把所有DC连接到同一个 dcInvoker
+type dcDialer struct {
+	dc  *dcInvoker
+	dcs []int
+}
+
+func (d *dcDialer) DC(_ context.Context, dc int, _ int64) (telegram.CloseInvoker, error) {
+	d.dcs = append(d.dcs, dc)
+	return d.dc, nil
+}
+
+func TestDownloadCommandUsesSharedDownloader(t *testing.T) {
+	dt := newDownloadTest(t, "big.bin", 2*download.ChunkSize+1)
+	dt.env.inv.handle = func(input bin.Encoder, output bin.Decoder) error {
+		if _, ok := input.(*tg.UploadGetFileRequest); ok {
+			return tgerr.New(303, "FILE_MIGRATE_2")
+		}
+		return dt.handle(input, output)
+	}
+	dialer := &dcDialer{dc: &dcInvoker{data: dt.data}}
+	d := download.New(tg.NewClient(dt.env.inv), dialer)
+	mediaDownloader.Store(d)
+	t.Cleanup(func() { mediaDownloader.Store(nil) })
+
+	if got := dt.reply(t); !strings.HasPrefix(got, "✅ 已下载到 ") {
+		t.Fatalf("result = %q", got)
+	}
+	if len(dialer.dcs) != 1 || dialer.dcs[0] != 2 {
+		t.Errorf("dialed %v, want DC 2", dialer.dcs)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dt.dir, "big.bin")); !bytes.Equal(data, dt.data) {
+		t.Errorf("downloaded %d bytes, want %d", len(data), len(dt.data))
+	}
+}
+
+func TestUniqueDownloadPath(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0o600)
+	os.WriteFile(filepath.Join(dir, "a_1.txt"), nil, 0o600)
+	tests := []struct {
+		name, want string
+	}{
+		{"b.txt", "b.txt"},
+		{"a.txt", "a_2.txt"},
+		{"dir/sub/b.txt", "b.txt"},
+		{`..\..\evil.sh`, "evil.sh"},
+		{"..", "file"},
+		{"", "file"},
+	}
+	for _, tt := range tests {
+		if got := uniqueDownloadPath(dir, tt.name); got != filepath.Join(dir, tt.want) {
+			t.Errorf("uniqueDownloadPath(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/ephemeral"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"strings"
+	"time"
+)
+
+// ephemeralCommandGrace 未被编辑为响应的命令消息在命令结束后多久删除，
+// 留出时间给仍在发送的响应
+const ephemeralCommandGrace = 2 * time.Second
+
+// EphemeralPlugin 阅后即焚插件，开启后对话中机器人发送或编辑的所有消息在TTL后自动删除
+type EphemeralPlugin struct {
+	*BasePlugin
+}
+
+// NewEphemeralPlugin 创建阅后即焚插件
+func NewEphemeralPlugin() *EphemeralPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "ephemeral",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "阅后即焚，对话中机器人发送的消息在TTL后自动删除",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &EphemeralPlugin{
+		BasePlugin: NewBasePlugin(info),
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (ep *EphemeralPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("ephemeral", "阅后即焚：on <TTL> | off | status", ep.info.Name, ep.handleEphemeral)
+	logger.Infof("Ephemeral commands registered successfully")
+	return nil
+}
+
+// RegisterHooks 实现HookPlugin接口，命令结束后清理未被编辑为响应的命令消息
+func (ep *EphemeralPlugin) RegisterHooks(hookManager *core.HookManager) error {
+	hookManager.RegisterHook(core.AfterCommand, "ephemeral_cleanup", ep.afterCommand, 0)
+	return nil
+}
+
+// tracker 获取阅后即焚记录器
+func (ep *EphemeralPlugin) tracker() *ephemeral.Tracker {
+	if goManager, ok := ep.manager.(*GoManager); ok {
+		return goManager.GetEphemeralTracker()
+	}
+	return nil
+}
+
+// afterCommand 开启阅后即焚的对话中，命令消息已被编辑为响应时随响应一起在TTL后删除，
+// 否则在命令结束后立即删除。仍有任务在运行时，命令消息稍后会被编辑为任务结果，不做处理
+func (ep *EphemeralPlugin) afterCommand(hc *core.HookContext) error {
+	tracker := ep.tracker()
+	if tracker == nil {
+		return nil
+	}
+	msgEvent, ok := hc.Data["message"].(*core.MessageEvent)
+	if !ok || msgEvent.Message == nil {
+		return nil
+	}
+	if _, enabled := tracker.TTL(msgEvent.ChatID); !enabled {
+		return nil
+	}
+	if tracker.Tracked(msgEvent.ChatID, msgEvent.Message.ID) {
+		return nil
+	}
+	if runner := taskRunnerFrom(ep.manager); runner != nil && len(runner.List(msgEvent.ChatID)) > 0 {
+		return nil
+	}
+
+	tracker.DeleteNow(msgEvent.ChatID, []int{msgEvent.Message.ID}, ephemeralCommandGrace)
+	return nil
+}
+
+// handleEphemeral 处理ephemeral命令
+func (ep *EphemeralPlugin) handleEphemeral(ctx *command.CommandContext) error {
+	tracker := ep.tracker()
+	if tracker == nil {
+		return ep.sendResponse(ctx, "阅后即焚服务不可用")
+	}
+
+	if len(ctx.Args) == 0 {
+		return ep.sendResponse(ctx, ep.usage())
+	}
+
+	chatID := ctx.Message.ChatID
+	switch ctx.Args[0] {
+	case "on":
+		if len(ctx.Args) < 2 {
+			return ep.sendResponse(ctx, "用法: .ephemeral on <TTL>，例如 30s、10m、1h")
+		}
+		ttl, err := parseWindowDuration(ctx.Args[1])
+		if err != nil || ttl < time.Second {
+			return ep.sendResponse(ctx, fmt.Sprintf("❌ 无效的TTL: %s", ctx.Args[1]))
+		}
+		if err := tracker.Enable(chatID, ttl); err != nil {
+			return ep.sendResponse(ctx, fmt.Sprintf("❌ 开启阅后即焚失败: %v", err))
+		}
+		return ep.sendResponse(ctx, fmt.Sprintf("🔥 已开启阅后即焚，机器人在此对话中发送的消息将在 %s 后删除", formatTTL(ttl)))
+	case "off":
+		wasOn, err := tracker.Disable(chatID)
+		if err != nil {
+			return ep.sendResponse(ctx, fmt.Sprintf("❌ 关闭阅后即焚失败: %v", err))
+		}
+		if !wasOn {
+			return ep.sendResponse(ctx, "此对话未开启阅后即焚")
+		}
+		return ep.sendResponse(ctx, "✅ 已关闭阅后即焚，已安排的删除仍会执行")
+	case "status":
+		return ep.sendResponse(ctx, ep.status(tracker, chatID))
+	default:
+		return ep.sendResponse(ctx, ep.usage())
+	}
+}
+
+// status 返回对话的阅后即焚状态
+func (ep *EphemeralPlugin) status(tracker *ephemeral.Tracker, chatID int64) string {
+	var b strings.Builder
+	if ttl, ok := tracker.TTL(chatID); ok {
+		b.WriteString(fmt.Sprintf("🔥 阅后即焚: 已开启\nTTL: %s", formatTTL(ttl)))
+	} else {
+		b.WriteString("阅后即焚: 未开启")
+	}
+	if pending, err := tracker.Pending(chatID); err == nil {
+		b.WriteString(fmt.Sprintf("\n待删除消息: %d", pending))
+	}
+	return b.String()
+}
+
+// usage 返回用法说明
+func (ep *EphemeralPlugin) usage() string {
+	return `用法:
+• .ephemeral on <TTL> - 开启阅后即焚，例如 30s、10m、1h、1d
+• .ephemeral off - 关闭阅后即焚
+• .ephemeral status - 查看TTL和待删除消息数量`
+}
+
+// formatTTL 格式化TTL，去掉 time.Duration 字符串末尾多余的零值单位
+func formatTTL(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// sendResponse 发送响应消息
+func (ep *EphemeralPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"nexusvalet/internal/core"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestEphemeralCommands(t *testing.T) {
+	env := newTestEnv()
+	gm := NewGoManager(env.parser, core.NewEventDispatcher(), core.NewHookManager(), openPluginDB(t))
+	t.Cleanup(func() { gm.Shutdown() })
+	ep := NewEphemeralPlugin()
+	if err := gm.RegisterPlugin(ep); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		command, want string
+	}{
+		{"ephemeral status", "阅后即焚: 未开启\n待删除消息: 0"},
+		{"ephemeral on", "用法: .ephemeral on <TTL>，例如 30s、10m、1h"},
+		{"ephemeral on 0s", "❌ 无效的TTL: 0s"},
+		{"ephemeral on soon", "❌ 无效的TTL: soon"},
+		{"ephemeral on 10m", "🔥 已开启阅后即焚，机器人在此对话中发送的消息将在 10m 后删除"},
+		{"ephemeral status", "🔥 阅后即焚: 已开启\nTTL: 10m\n待删除消息: 0"},
+		{"ephemeral off", "✅ 已关闭阅后即焚，已安排的删除仍会执行"},
+		{"ephemeral off", "此对话未开启阅后即焚"},
+	}
+	for _, tt := range tests {
+		if got := env.runText(t, nil, tt.command); got != tt.want {
+			t.Errorf("%s =\n%s\nwant\n%s", tt.command, got, tt.want)
+		}
+	}
+
+	// 再次开启时更新TTL
+	env.run(nil, "ephemeral on 1h")
+	if ttl, ok := gm.GetEphemeralTracker().TTL(-100); !ok || ttl != time.Hour {
+		t.Errorf("TTL = %v, %v; want 1h", ttl, ok)
+	}
+}
+
+func TestEphemeralAfterCommand(t *testing.T) {
+	env := newTestEnv()
+	gm := NewGoManager(env.parser, core.NewEventDispatcher(), core.NewHookManager(), openPluginDB(t))
+	t.Cleanup(func() { gm.Shutdown() })
+	ep := NewEphemeralPlugin()
+	if err := gm.RegisterPlugin(ep); err != nil {
+		t.Fatal(err)
+	}
+	tracker := gm.GetEphemeralTracker()
+	hook := func(id int) {
+		msgEvent := &core.MessageEvent{ChatID: -100, Message: &tg.Message{ID: id}}
+		if err := ep.afterCommand(&core.HookContext{Data: map[string]interface{}{"message": msgEvent}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 未开启时不删除命令消息
+	hook(10)
+	if tracker.Tracked(-100, 10) {
+		t.Error("command message should be kept when ephemeral mode is off")
+	}
+
+	tracker.Enable(-100, time.Hour)
+	hook(11)
+	if !tracker.Tracked(-100, 11) {
+		t.Error("command message should be deleted after the command")
+	}
+
+	// 已作为响应记录的命令消息不重复安排
+	tracker.Track(-100, []int{12})
+	hook(12)
+	if n, _ := tracker.Pending(-100); n != 2 {
+		t.Errorf("Pending = %d, want 2", n)
+	}
+	if got := ep.status(tracker, -100); got != "🔥 阅后即焚: 已开启\nTTL: 1h\n待删除消息: 2" {
+		t.Errorf("status = %q", got)
+	}
+}
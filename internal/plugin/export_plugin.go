@@ -0,0 +1,471 @@
+package plugin
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"nexusvalet/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// exportDefaultMaxMessages 未配置 plugins.export.max_messages 时一次最多导出的消息数
+	exportDefaultMaxMessages = 10000
+	// exportDefaultCount 没有指定数量时导出的消息数
+	exportDefaultCount = 1000
+	// exportProgressEvery 每获取多少条消息更新一次进度
+	exportProgressEvery = 500
+	// exportPageSize 每次获取的消息数，MessagesGetHistory 单次最多返回100条
+	exportPageSize = 100
+	// exportMaxPhotoSize --media 时单张图片的大小上限，超过时只记录元数据
+	exportMaxPhotoSize = 5 << 20
+)
+
+// exportedMessage 导出的一条消息
+type exportedMessage struct {
+	ID       int            `json:"id"`
+	Date     time.Time      `json:"date"`
+	SenderID int64          `json:"sender_id,omitempty"`
+	Sender   string         `json:"sender"`
+	Text     string         `json:"text,omitempty"`
+	ReplyTo  int            `json:"reply_to,omitempty"`
+	Service  string         `json:"service,omitempty"` // 服务消息的类型，如 ChatAddUser
+	Media    *exportedMedia `json:"media,omitempty"`
+}
+
+// exportedMedia 消息中媒体的元数据，File 为下载后在压缩包中的路径
+type exportedMedia struct {
+	Type     string `json:"type"`
+	FileName string `json:"file_name,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	File     string `json:"file,omitempty"`
+}
+
+// exportArchive 导出文件的内容，消息按时间从早到晚排列
+type exportArchive struct {
+	ChatID     int64             `json:"chat_id"`
+	Title      string            `json:"title"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Messages   []exportedMessage `json:"messages"`
+}
+
+// exportOptions export命令的参数
+type exportOptions struct {
+	limit int  // 最多导出的消息数
+	all   bool // 导出全部消息，进度不显示总数
+	html  bool
+	media bool
+}
+
+// ExportPlugin 导出聊天记录插件
+type ExportPlugin struct {
+	*BasePlugin
+}
+
+// NewExportPlugin 创建导出聊天记录插件
+func NewExportPlugin() *ExportPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "export",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "把当前对话的聊天记录导出为压缩包",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+	return &ExportPlugin{BasePlugin: NewBasePlugin(info)}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (ep *ExportPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterOwnerCommand("export", "导出当前对话的聊天记录，.export [数量|all] [--html] [--media]", ep.info.Name, ep.handleExport)
+	logger.Infof("Export commands registered successfully")
+	return nil
+}
+
+// maxMessages 返回 plugins.export.max_messages，未配置时为默认值
+func (ep *ExportPlugin) maxMessages() int {
+	if goManager, ok := ep.manager.(*GoManager); ok {
+		if cfg := goManager.GetConfig(); cfg != nil && cfg.Plugins.Export.MaxMessages > 0 {
+			return cfg.Plugins.Export.MaxMessages
+		}
+	}
+	return exportDefaultMaxMessages
+}
+
+// handleExport 处理export命令，在后台分页获取消息，完成后把压缩包发送到当前对话
+func (ep *ExportPlugin) handleExport(ctx *command.CommandContext) error {
+	maxMessages := ep.maxMessages()
+	opts := exportOptions{limit: exportDefaultCount, html: ctx.HasFlag("html"), media: ctx.HasFlag("media")}
+	if len(ctx.Args) > 0 {
+		switch arg := ctx.Args[0]; arg {
+		case "all":
+			opts.limit, opts.all = maxMessages, true
+		case "help":
+			return ep.sendResponse(ctx, ep.usage(maxMessages))
+		default:
+			n, err := strconv.Atoi(arg)
+			if err != nil || n <= 0 {
+				return ep.sendResponse(ctx, ep.usage(maxMessages))
+			}
+			opts.limit = n
+		}
+	}
+	opts.limit = min(opts.limit, maxMessages)
+
+	runner := taskRunnerFrom(ep.GetManager())
+	if runner == nil {
+		return ep.sendResponse(ctx, "任务管理器不可用")
+	}
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+	status, err := commandStatusEditor(ctx)
+	if err != nil {
+		return err
+	}
+
+	runner.Start(context.Background(), core.TaskOptions{
+		ChatID: ctx.Message.ChatID,
+		Name:   "export",
+		Status: status,
+	}, func(taskCtx context.Context, report core.ProgressFunc) (string, error) {
+		// 任务在命令返回后继续运行，使用任务的上下文
+		tc := *ctx
+		tc.Context = taskCtx
+		return ep.runExport(&tc, peer, opts, report)
+	})
+	return nil
+}
+
+// runExport 获取消息、打包并上传
+func (ep *ExportPlugin) runExport(ctx *command.CommandContext, peer tg.InputPeerClass, opts exportOptions, report core.ProgressFunc) (string, error) {
+	archive := &exportArchive{ChatID: ctx.Message.ChatID, ExportedAt: time.Now()}
+	if title, err := fetchPeerTitle(ctx.Context, ctx.API, peer); err == nil {
+		archive.Title = title
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	photos := 0
+	total := opts.limit
+	if opts.all {
+		total = 0
+	}
+	err := ep.collect(ctx, peer, opts.limit, total, report, func(msg tg.NotEmptyMessage, users []tg.UserClass, chats []tg.ChatClass) error {
+		exported := exportMessage(ctx.PeerResolver.Manager(), msg, users, chats)
+		if m, ok := msg.(*tg.Message); ok && opts.media && exported.Media != nil && exported.Media.Type == "photo" {
+			file, err := exportPhoto(ctx, zw, m)
+			if err != nil {
+				logger.Ctx(ctx.Context).Warnf("Failed to export photo of message %d: %v", m.ID, err)
+			} else if file != "" {
+				exported.Media.File = file
+				photos++
+			}
+		}
+		archive.Messages = append(archive.Messages, exported)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(archive.Messages) == 0 {
+		return "当前对话没有可导出的消息", nil
+	}
+	// 消息按从新到旧获取，导出时按时间顺序排列
+	for i, j := 0, len(archive.Messages)-1; i < j; i, j = i+1, j-1 {
+		archive.Messages[i], archive.Messages[j] = archive.Messages[j], archive.Messages[i]
+	}
+
+	report(len(archive.Messages), 0, "正在打包...")
+	if err := writeExportFiles(zw, archive, opts.html); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("打包失败: %w", err)
+	}
+
+	summary := fmt.Sprintf("已导出 %d 条消息 (%s)", len(archive.Messages), formatBytes(int64(buf.Len())))
+	if photos > 0 {
+		summary += fmt.Sprintf("，包含 %d 张图片", photos)
+	}
+	report(len(archive.Messages), 0, "正在上传...")
+	err = sendDocument(ctx, peer, MediaUpload{
+		FileName:     fmt.Sprintf("export_%d_%s.zip", archive.ChatID, archive.ExportedAt.Format("20060102_150405")),
+		Data:         buf.Bytes(),
+		MimeType:     "application/zip",
+		Caption:      "📦 " + summary,
+		KeepOriginal: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	return summary, nil
+}
+
+// collect 从最新的消息开始分页获取历史，对每条消息调用fn，最多limit条。
+// 命令消息本身不导出。total 为进度显示的总数，0表示不显示进度条
+func (ep *ExportPlugin) collect(ctx *command.CommandContext, peer tg.InputPeerClass, limit, total int, report core.ProgressFunc,
+	fn func(msg tg.NotEmptyMessage, users []tg.UserClass, chats []tg.ChatClass) error) error {
+	count, offsetID := 0, 0
+	for count < limit {
+		if err := ctx.Context.Err(); err != nil {
+			return err
+		}
+		messages, users, chats, err := ep.historyPage(ctx, peer, offsetID)
+		if err != nil {
+			return fmt.Errorf("获取消息历史失败: %w", err)
+		}
+		if len(messages) == 0 {
+			break
+		}
+		if manager := ctx.PeerResolver.Manager(); manager != nil {
+			manager.CacheUsersFromUpdate(users)
+			manager.CacheChatsFromUpdate(chats)
+		}
+		offsetID = messages[len(messages)-1].GetID()
+
+		for _, msg := range messages {
+			if msg.GetID() == ctx.Message.Message.ID || count >= limit {
+				continue
+			}
+			if err := fn(msg, users, chats); err != nil {
+				return err
+			}
+			count++
+			if count%exportProgressEvery == 0 {
+				report(count, total, "")
+			}
+		}
+	}
+	return nil
+}
+
+// historyPage 获取offsetID之前的一页消息，offsetID为0时从最新的消息开始。
+// 遇到FLOOD_WAIT时等待后重试
+func (ep *ExportPlugin) historyPage(ctx *command.CommandContext, peer tg.InputPeerClass, offsetID int) ([]tg.NotEmptyMessage, []tg.UserClass, []tg.ChatClass, error) {
+	var resp tg.MessagesMessagesClass
+	get := func() error {
+		var err error
+		resp, err = ctx.API.MessagesGetHistory(ctx.Context, &tg.MessagesGetHistoryRequest{
+			Peer:     peer,
+			OffsetID: offsetID,
+			Limit:    exportPageSize,
+		})
+		return err
+	}
+	var err error
+	if ctx.Flood != nil {
+		err = ctx.Flood.Retry(ctx.Context, ctx.Message.ChatID, get)
+	} else {
+		err = get()
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var users []tg.UserClass
+	var chats []tg.ChatClass
+	switch r := resp.(type) {
+	case *tg.MessagesMessages:
+		users, chats = r.Users, r.Chats
+	case *tg.MessagesMessagesSlice:
+		users, chats = r.Users, r.Chats
+	case *tg.MessagesChannelMessages:
+		users, chats = r.Users, r.Chats
+	}
+	return notEmptyMessages(resp), users, chats, nil
+}
+
+// exportMessage 转换为导出的格式。用户发送者的名字从 access hash 缓存中读取，
+// 缓存中没有时使用本页返回的用户和对话信息
+func exportMessage(manager *peers.AccessHashManager, msg tg.NotEmptyMessage, users []tg.UserClass, chats []tg.ChatClass) exportedMessage {
+	// senderDisplayName 只需要发送者和所在对话
+	lookup := &tg.Message{PeerID: msg.GetPeerID()}
+	if from, ok := msg.GetFromID(); ok {
+		lookup.FromID = from
+	}
+	exported := exportedMessage{
+		ID:     msg.GetID(),
+		Date:   time.Unix(int64(msg.GetDate()), 0),
+		Sender: exportSenderName(manager, lookup, users, chats),
+	}
+	if lookup.FromID != nil {
+		exported.SenderID = peerToChatID(lookup.FromID)
+	} else {
+		exported.SenderID = peerToChatID(lookup.PeerID)
+	}
+	if reply, ok := msg.GetReplyTo(); ok {
+		if header, ok := reply.(*tg.MessageReplyHeader); ok {
+			exported.ReplyTo = header.ReplyToMsgID
+		}
+	}
+
+	switch m := msg.(type) {
+	case *tg.Message:
+		exported.Text = m.Message
+		exported.Media = exportMediaInfo(m.Media)
+	case *tg.MessageService:
+		exported.Service = strings.TrimPrefix(fmt.Sprintf("%T", m.Action), "*tg.MessageAction")
+	}
+	return exported
+}
+
+// exportSenderName 返回发送者的显示名称
+func exportSenderName(manager *peers.AccessHashManager, msg *tg.Message, users []tg.UserClass, chats []tg.ChatClass) string {
+	if from, ok := msg.FromID.(*tg.PeerUser); ok && manager != nil {
+		if info := manager.GetCachedUserInfo(from.UserID); info != nil {
+			name := strings.TrimSpace(info.FirstName + " " + info.LastName)
+			if name == "" {
+				name = fmt.Sprintf("用户 %d", info.ID)
+			}
+			if info.Username != "" {
+				name += " (@" + info.Username + ")"
+			}
+			return name
+		}
+	}
+	return senderDisplayName(msg, users, chats)
+}
+
+// exportMediaInfo 返回媒体的元数据，没有媒体时返回nil
+func exportMediaInfo(media tg.MessageMediaClass) *exportedMedia {
+	switch m := media.(type) {
+	case nil:
+		return nil
+	case *tg.MessageMediaPhoto:
+		info := &exportedMedia{Type: "photo", MimeType: "image/jpeg"}
+		if file, err := mediaFileFromMessage(&tg.Message{Media: m}); err == nil {
+			info.FileName, info.Size = file.Name, file.Size
+		}
+		return info
+	case *tg.MessageMediaDocument:
+		info := &exportedMedia{Type: "document"}
+		if doc, ok := m.Document.(*tg.Document); ok {
+			info.MimeType, info.Size = doc.MimeType, doc.Size
+			for _, attr := range doc.Attributes {
+				if fn, ok := attr.(*tg.DocumentAttributeFilename); ok {
+					info.FileName = fn.FileName
+				}
+			}
+		}
+		return info
+	default:
+		return &exportedMedia{Type: strings.TrimPrefix(fmt.Sprintf("%T", media), "*tg.MessageMedia")}
+	}
+}
+
+// exportPhoto 下载不超过大小上限的图片并写入压缩包的 media 目录，返回压缩包中的路径。
+// 超过上限时返回空字符串
+func exportPhoto(ctx *command.CommandContext, zw *zip.Writer, msg *tg.Message) (string, error) {
+	file, err := mediaFileFromMessage(msg)
+	if err != nil {
+		return "", err
+	}
+	if file.Size > exportMaxPhotoSize {
+		return "", nil
+	}
+
+	var data bytes.Buffer
+	if _, _, err := downloadMessageMedia(ctx, msg, &data, nil); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("media/%d_%s", msg.ID, file.Name)
+	w, err := zw.Create(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(data.Bytes()); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// writeExportFiles 把 messages.json 和可选的 messages.html 写入压缩包
+func writeExportFiles(zw *zip.Writer, archive *exportArchive, withHTML bool) error {
+	w, err := zw.Create("messages.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(archive); err != nil {
+		return fmt.Errorf("序列化消息失败: %w", err)
+	}
+
+	if !withHTML {
+		return nil
+	}
+	w, err = zw.Create("messages.html")
+	if err != nil {
+		return err
+	}
+	if err := exportHTML.Execute(w, archive); err != nil {
+		return fmt.Errorf("生成HTML失败: %w", err)
+	}
+	return nil
+}
+
+// exportHTML 不依赖外部资源的HTML页面，图片引用压缩包中 media 目录下的文件
+var exportHTML = template.Must(template.New("export").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh">
+<head>
+<meta charset="utf-8">
+<title>{{if .Title}}{{.Title}}{{else}}{{.ChatID}}{{end}} - 聊天记录</title>
+<style>
+body{font-family:-apple-system,"Segoe UI",sans-serif;background:#f4f4f5;margin:0;padding:16px}
+h1{font-size:18px}
+.msg{background:#fff;border-radius:8px;padding:8px 12px;margin:6px 0;max-width:720px}
+.meta{color:#888;font-size:12px}
+.sender{font-weight:600;color:#3b82f6}
+.text{white-space:pre-wrap;word-wrap:break-word;margin-top:4px}
+.service{color:#888;font-style:italic}
+img{max-width:100%;border-radius:4px;margin-top:4px}
+</style>
+</head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}{{.ChatID}}{{end}}</h1>
+<p class="meta">对话 ID {{.ChatID}} · 导出于 {{time .ExportedAt}} · {{len .Messages}} 条消息</p>
+{{range .Messages}}<div class="msg" id="m{{.ID}}">
+<div class="meta"><span class="sender">{{.Sender}}</span> · {{time .Date}} · #{{.ID}}{{if .ReplyTo}} · 回复 <a href="#m{{.ReplyTo}}">#{{.ReplyTo}}</a>{{end}}</div>
+{{if .Service}}<div class="service">[{{.Service}}]</div>{{end}}
+{{if .Media}}{{if .Media.File}}<img src="{{.Media.File}}" alt="">{{else}}<div class="meta">[{{.Media.Type}}{{if .Media.FileName}} {{.Media.FileName}}{{end}}]</div>{{end}}{{end}}
+{{if .Text}}<div class="text">{{.Text}}</div>{{end}}
+</div>
+{{end}}</body>
+</html>
+`))
+
+// usage 返回export命令的用法
+func (ep *ExportPlugin) usage(maxMessages int) string {
+	return fmt.Sprintf(`用法:
+• .export [数量] - 导出当前对话最近的消息，默认 %d 条
+• .export all - 导出全部消息，最多 %d 条
+• --html - 同时生成可直接打开的 messages.html
+• --media - 同时下载不超过 %s 的图片
+
+导出结果为包含 messages.json 的压缩包，完成后发送到当前对话，可使用 .cancel 取消`,
+		exportDefaultCount, maxMessages, formatBytes(exportMaxPhotoSize))
+}
+
+// sendResponse 发送响应消息
+func (ep *ExportPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"encoding/hex"
+	"fmt"
+	"nexusvalet/internal/command"
+	"strings"
+	"time"
+)
+
+// handleFile 处理file命令：显示回复的媒体消息的类型、大小、分辨率、时长和文件ID等信息，
+// 原始ID、access hash 和 file reference 用于排查 FILE_REFERENCE 相关错误
+func (cp *CoreCommandsPlugin) handleFile(ctx *command.CommandContext) error {
+	msg, err := fetchReplyMessage(ctx)
+	if err != nil {
+		return cp.sendResponse(ctx, "❌ 请回复一条包含照片、文件、语音、视频或贴纸的消息")
+	}
+	info, err := inspectMedia(msg)
+	if err != nil {
+		return cp.sendResponse(ctx, fmt.Sprintf("❌ %v", err))
+	}
+	return cp.sendResponse(ctx, formatMediaInfo(info))
+}
+
+// formatMediaInfo 把媒体元数据格式化为纯文本，没有的字段不显示
+func formatMediaInfo(info *mediaInfo) string {
+	var b strings.Builder
+	b.WriteString("📎 媒体信息\n\n")
+	b.WriteString(fmt.Sprintf("类型: %s\n", info.Kind))
+	if info.MimeType != "" {
+		b.WriteString(fmt.Sprintf("MIME: %s\n", info.MimeType))
+	}
+	b.WriteString(fmt.Sprintf("大小: %s (%d 字节)\n", formatMemorySize(uint64(info.Size)), info.Size))
+	if info.Width > 0 && info.Height > 0 {
+		b.WriteString(fmt.Sprintf("分辨率: %d×%d\n", info.Width, info.Height))
+	}
+	if info.Duration > 0 {
+		b.WriteString(fmt.Sprintf("时长: %s\n", formatMediaDuration(info.Duration)))
+	}
+	if info.FileName != "" {
+		b.WriteString(fmt.Sprintf("文件名: %s\n", info.FileName))
+	}
+	if info.Emoji != "" {
+		b.WriteString(fmt.Sprintf("表情: %s\n", info.Emoji))
+	}
+	if info.Performer != "" {
+		b.WriteString(fmt.Sprintf("表演者: %s\n", info.Performer))
+	}
+	if info.Title != "" {
+		b.WriteString(fmt.Sprintf("标题: %s\n", info.Title))
+	}
+	b.WriteString(fmt.Sprintf("\nDC: %d\n", info.DCID))
+	b.WriteString(fmt.Sprintf("ID: %d\n", info.ID))
+	b.WriteString(fmt.Sprintf("AccessHash: %d\n", info.AccessHash))
+	b.WriteString(fmt.Sprintf("FileReference (%d 字节): %s", len(info.FileReference), hex.EncodeToString(info.FileReference)))
+	return b.String()
+}
+
+// formatMediaDuration 把媒体时长格式化为 m:ss 或 h:mm:ss，不足1秒的视频保留一位小数
+func formatMediaDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%.1f秒", d.Seconds())
+	}
+	total := int(d.Round(time.Second) / time.Second)
+	if h := total / 3600; h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, total%3600/60, total%60)
+	}
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
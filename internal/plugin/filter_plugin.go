@@ -0,0 +1,365 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"nexusvalet/pkg/logger"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// filterMaxRules 每个对话最多的规则数
+	filterMaxRules = 20
+	// filterCooldown 同一条规则两次回复之间的最短间隔，避免刷屏时连续回复
+	filterCooldown = 30 * time.Second
+	// filterMaxAge 超过该时长的消息不再回复(如重连后补收的旧消息)
+	filterMaxAge = time.Minute
+)
+
+// filterRule 一条自动回复规则
+type filterRule struct {
+	ID       int64
+	ChatID   int64
+	Pattern  string
+	Response string
+	re       *regexp.Regexp
+}
+
+// FilterPlugin 自动回复规则：收到的消息匹配对话中的规则时回复设置的内容
+type FilterPlugin struct {
+	*BasePlugin
+	db           *sql.DB
+	telegramAPI  *tg.Client
+	peerResolver *peers.Resolver
+	rules        map[int64][]*filterRule // chat_id -> 按ID排序的规则
+	lastReply    map[int64]time.Time     // 规则ID -> 上次回复时间
+	mutex        sync.RWMutex
+}
+
+// NewFilterPlugin 创建自动回复规则插件
+func NewFilterPlugin(db *sql.DB) *FilterPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "filter",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "收到的消息匹配正则时自动回复",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &FilterPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+		rules:      make(map[int64][]*filterRule),
+		lastReply:  make(map[int64]time.Time),
+	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+	plugin.loadRules()
+
+	return plugin
+}
+
+// initDatabase 初始化数据库表
+func (fp *FilterPlugin) initDatabase() {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS filter_rules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		pattern TEXT NOT NULL,
+		response TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	);`
+
+	_, err := fp.db.Exec(createTableSQL)
+	if err != nil {
+		logger.Errorf("Failed to create filter_rules table: %v", err)
+	}
+}
+
+// loadRules 从数据库读取并编译所有规则，无法编译的规则跳过
+func (fp *FilterPlugin) loadRules() {
+	rows, err := fp.db.Query("SELECT id, chat_id, pattern, response FROM filter_rules ORDER BY id")
+	if err != nil {
+		logger.Errorf("Failed to load filter rules: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	rules := make(map[int64][]*filterRule)
+	count := 0
+	for rows.Next() {
+		var rule filterRule
+		if err := rows.Scan(&rule.ID, &rule.ChatID, &rule.Pattern, &rule.Response); err != nil {
+			logger.Errorf("Failed to scan filter rule: %v", err)
+			continue
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			logger.Warnf("Skipping filter rule %d with invalid pattern: %v", rule.ID, err)
+			continue
+		}
+		rule.re = re
+		rules[rule.ChatID] = append(rules[rule.ChatID], &rule)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		logger.Errorf("Failed to load filter rules: %v", err)
+	}
+
+	fp.mutex.Lock()
+	fp.rules = rules
+	fp.mutex.Unlock()
+	if count > 0 {
+		logger.Infof("Loaded %d filter rules", count)
+	}
+}
+
+// SetTelegramClient 设置Telegram客户端和Peer解析器
+func (fp *FilterPlugin) SetTelegramClient(client *tg.Client, peerResolver *peers.Resolver) {
+	fp.telegramAPI = client
+	fp.peerResolver = peerResolver
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (fp *FilterPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("filter", "管理当前对话的自动回复规则：add \"正则\" <回复> | list | del <ID>", fp.info.Name, fp.handleFilter)
+	logger.Infof("Filter commands registered successfully")
+	return nil
+}
+
+// RegisterEventHandlers 实现EventPlugin接口，监听收到的消息
+func (fp *FilterPlugin) RegisterEventHandlers(dispatcher *core.EventDispatcher) error {
+	return dispatcher.RegisterMessageListenerWithFilter("filter_reply", "", fp.handleIncoming, 40, core.ListenerFilter{Incoming: true})
+}
+
+// handleFilter 处理filter命令
+func (fp *FilterPlugin) handleFilter(ctx *command.CommandContext) error {
+	if len(ctx.Args) == 0 {
+		return fp.sendResponse(ctx, fp.helpText())
+	}
+
+	switch ctx.Args[0] {
+	case "add":
+		return fp.handleAdd(ctx)
+	case "list":
+		return fp.handleList(ctx)
+	case "del":
+		return fp.handleDel(ctx)
+	}
+	return fp.sendResponse(ctx, fp.helpText())
+}
+
+// handleAdd 添加规则，正则中有空格时需要用引号括起来
+func (fp *FilterPlugin) handleAdd(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 3 {
+		return fp.sendResponse(ctx, "用法: .filter add \"正则\" <回复内容>")
+	}
+	pattern := ctx.Args[1]
+	response := ctx.ArgsStringFrom(2)
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fp.sendResponse(ctx, fmt.Sprintf("❌ 无效的正则表达式: %v", err))
+	}
+
+	rule := &filterRule{ChatID: ctx.Message.ChatID, Pattern: pattern, Response: response, re: re}
+	if err := fp.addRule(rule); err != nil {
+		return fp.sendResponse(ctx, fmt.Sprintf("❌ %v", err))
+	}
+	return fp.sendResponse(ctx, fmt.Sprintf("✅ 已添加规则 #%d\n\n正则: %s\n回复: %s", rule.ID, pattern, tplPreview(response)))
+}
+
+// addRule 保存规则并加入对话的规则列表，超过每个对话的上限时返回错误
+func (fp *FilterPlugin) addRule(rule *filterRule) error {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+	if len(fp.rules[rule.ChatID]) >= filterMaxRules {
+		return fmt.Errorf("每个对话最多 %d 条规则，请先删除不需要的规则", filterMaxRules)
+	}
+
+	result, err := fp.db.Exec("INSERT INTO filter_rules (chat_id, pattern, response, created_at) VALUES (?, ?, ?, ?)",
+		rule.ChatID, rule.Pattern, rule.Response, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("保存规则失败: %w", err)
+	}
+	rule.ID, _ = result.LastInsertId()
+	fp.rules[rule.ChatID] = append(fp.rules[rule.ChatID], rule)
+	return nil
+}
+
+// handleList 列出当前对话的规则
+func (fp *FilterPlugin) handleList(ctx *command.CommandContext) error {
+	fp.mutex.RLock()
+	rules := fp.rules[ctx.Message.ChatID]
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🔁 当前对话的自动回复规则 (%d/%d):\n", len(rules), filterMaxRules))
+	for _, rule := range rules {
+		b.WriteString(fmt.Sprintf("\n#%d %s\n   → %s", rule.ID, rule.Pattern, tplPreview(rule.Response)))
+	}
+	fp.mutex.RUnlock()
+
+	if len(rules) == 0 {
+		return fp.sendResponse(ctx, "🔁 当前对话没有自动回复规则")
+	}
+	return fp.sendResponse(ctx, b.String())
+}
+
+// handleDel 删除当前对话中的规则
+func (fp *FilterPlugin) handleDel(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return fp.sendResponse(ctx, "用法: .filter del <ID>")
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(ctx.Args[1], "#"), 10, 64)
+	if err != nil {
+		return fp.sendResponse(ctx, "❌ 无效的规则ID")
+	}
+
+	removed, err := fp.removeRule(ctx.Message.ChatID, id)
+	if err != nil {
+		return fp.sendResponse(ctx, fmt.Sprintf("❌ 删除规则失败: %v", err))
+	}
+	if !removed {
+		return fp.sendResponse(ctx, fmt.Sprintf("❌ 当前对话中没有规则 #%d", id))
+	}
+	return fp.sendResponse(ctx, fmt.Sprintf("🗑️ 已删除规则 #%d", id))
+}
+
+// removeRule 删除对话中的规则，规则不存在时返回false
+func (fp *FilterPlugin) removeRule(chatID, id int64) (bool, error) {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+	result, err := fp.db.Exec("DELETE FROM filter_rules WHERE id = ? AND chat_id = ?", id, chatID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	rules := fp.rules[chatID]
+	for i, rule := range rules {
+		if rule.ID == id {
+			fp.rules[chatID] = append(rules[:i:i], rules[i+1:]...)
+			break
+		}
+	}
+	if len(fp.rules[chatID]) == 0 {
+		delete(fp.rules, chatID)
+	}
+	delete(fp.lastReply, id)
+	return true, nil
+}
+
+// handleIncoming 收到的消息匹配当前对话的规则时回复，每条消息只使用第一条匹配且不在冷却中的规则
+func (fp *FilterPlugin) handleIncoming(ctx context.Context, event interface{}) error {
+	msgEvent, ok := event.(*core.MessageEvent)
+	if !ok || msgEvent.Message == nil || fp.telegramAPI == nil || fp.peerResolver == nil {
+		return nil
+	}
+	if time.Since(time.Unix(int64(msgEvent.Message.Date), 0)) > filterMaxAge {
+		return nil
+	}
+
+	rule := fp.match(msgEvent.ChatID, msgEvent.Text)
+	if rule == nil {
+		return nil
+	}
+
+	peer, err := fp.peerResolver.ResolveFromChatID(ctx, msgEvent.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+	response := rule.Response
+	if strings.Contains(response, "{name}") {
+		response = strings.ReplaceAll(response, "{name}", fp.senderName(ctx, peer, msgEvent))
+	}
+	response = strings.ReplaceAll(response, "{text}", msgEvent.Text)
+
+	var limiter *flood.Limiter
+	if goManager, ok := fp.manager.(*GoManager); ok {
+		limiter = goManager.GetFloodLimiter()
+	}
+	_, err = flood.Call(ctx, limiter, msgEvent.ChatID, func() (tg.UpdatesClass, error) {
+		return fp.telegramAPI.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+			Peer:     peer,
+			Message:  response,
+			ReplyTo:  &tg.InputReplyToMessage{ReplyToMsgID: msgEvent.Message.ID},
+			RandomID: time.Now().UnixNano(),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send filter reply for rule %d: %w", rule.ID, err)
+	}
+	logger.Ctx(ctx).Debugf("Filter rule %d replied to message %d", rule.ID, msgEvent.Message.ID)
+	return nil
+}
+
+// match 返回第一条匹配文本且不在冷却中的规则，并记录回复时间
+func (fp *FilterPlugin) match(chatID int64, text string) *filterRule {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+	now := time.Now()
+	for _, rule := range fp.rules[chatID] {
+		if !rule.re.MatchString(text) {
+			continue
+		}
+		if last, ok := fp.lastReply[rule.ID]; ok && now.Sub(last) < filterCooldown {
+			continue
+		}
+		fp.lastReply[rule.ID] = now
+		return rule
+	}
+	return nil
+}
+
+// senderName 返回发送者的名字，缓存中没有时通过消息获取，都失败时使用用户ID
+func (fp *FilterPlugin) senderName(ctx context.Context, peer tg.InputPeerClass, msgEvent *core.MessageEvent) string {
+	manager := fp.peerResolver.Manager()
+	if manager == nil {
+		return strconv.FormatInt(msgEvent.UserID, 10)
+	}
+	info := manager.GetCachedUserInfo(msgEvent.UserID)
+	if info == nil {
+		if _, err := fp.peerResolver.ResolveUserFromMessage(ctx, peer, msgEvent.Message.ID, msgEvent.UserID); err == nil {
+			info = manager.GetCachedUserInfo(msgEvent.UserID)
+		}
+	}
+	if info == nil {
+		return strconv.FormatInt(msgEvent.UserID, 10)
+	}
+	return strings.TrimSpace(info.FirstName + " " + info.LastName)
+}
+
+// helpText 返回帮助信息
+func (fp *FilterPlugin) helpText() string {
+	return fmt.Sprintf(`🔁 自动回复规则
+
+• .filter add "正则" <回复内容> - 收到匹配正则的消息时回复该内容
+• .filter list - 列出当前对话的规则
+• .filter del <ID> - 删除规则
+
+规则只在添加时所在的对话生效，每个对话最多 %d 条，同一条规则 %d 秒内只回复一次。
+回复内容中 {name} 替换为发送者名字，{text} 替换为收到的消息。
+示例: .filter add "(?i)^早安" 早安 {name}！`, filterMaxRules, int(filterCooldown.Seconds()))
+}
+
+// sendResponse 发送响应消息
+func (fp *FilterPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/secrets"
+	"nexusvalet/pkg/logger"
+	"strings"
+)
+
+// ocrPrompt 文字识别使用的固定提示
+const ocrPrompt = "逐字提取图片中的所有文字，保留原有的换行，不要翻译、总结或添加任何说明，只输出提取的文字。图片中没有文字时只输出：（无文字）"
+
+// handleOCR 处理ocr命令：识别回复的图片(或命令消息附带的图片)中的文字，结果放在代码块中。
+// 结果不受 gemini_auto_remove 影响，始终保留
+func (gp *GeminiPlugin) handleOCR(ctx *command.CommandContext) error {
+	apiKey, err := gp.getAPIKey()
+	if errors.Is(err, secrets.ErrLocked) {
+		return gp.sendResponse(ctx, "❌ "+secretsLockedMessage, false)
+	}
+	if err != nil || apiKey == "" {
+		return gp.sendResponse(ctx, "❌ 未设置 Gemini API key，文字识别需要使用 Gemini\n\n使用方法：`.gemini key 你的API密钥`", false)
+	}
+	model, err := gp.getConfig("gemini_model")
+	if err != nil || model == "" {
+		model = "gemini-1.5-flash" // 默认模型
+	}
+
+	// 优先使用命令消息附带的图片，其次使用被回复消息的图片
+	mediaMsg := ctx.Message.Message
+	if !hasImage(mediaMsg) {
+		replyMsg, err := fetchReplyMessage(ctx)
+		if err != nil || !hasImage(replyMsg) {
+			return gp.sendResponse(ctx, "❌ 请回复一张图片或图片文件使用 .ocr", false)
+		}
+		mediaMsg = replyMsg
+	}
+
+	// 编辑原消息显示处理状态，sudo用户的消息不能编辑
+	if !ctx.Message.Sudo {
+		if _, err := ctx.Respond("🔍 识别文字中...", format.Plain); err != nil {
+			logger.Errorf("Failed to edit message: %v", err)
+		}
+	}
+
+	mediaData, err := gp.downloadAndProcessImage(ctx, mediaMsg)
+	if err != nil {
+		return gp.sendResponse(ctx, fmt.Sprintf("❌ 图片处理失败：%v", err), false)
+	}
+	text, err := gp.callGeminiAPI(apiKey, model, ocrPrompt, mediaData, true)
+	if err != nil {
+		return gp.showError(ctx, err, false)
+	}
+
+	text = stripCodeFence(text)
+	if text == "" {
+		text = "（无文字）"
+	}
+
+	// 超过单条消息长度时 Respond 会拆分为多条，每段仍在代码块中
+	_, err = ctx.Respond("<pre>"+format.EscapeHTML(text)+"</pre>", format.HTML)
+	return err
+}
+
+// stripCodeFence 去掉模型有时仍会加上的 ``` 围栏和语言标记行
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") || len(text) < 6 {
+		return text
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "```"), "```")
+	if nl := strings.IndexByte(text, '\n'); nl >= 0 && !strings.ContainsAny(text[:nl], " \t") {
+		text = text[nl+1:]
+	}
+	return strings.Trim(text, "\n")
+}
@@ -2,15 +2,20 @@ package plugin
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"image/png"
 	"io"
 	"net/http"
 	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/secrets"
+	"nexusvalet/internal/selftest"
 	"nexusvalet/pkg/logger"
 	"os"
 	"path/filepath"
@@ -28,13 +33,21 @@ import (
 // GeminiPlugin Gemini AI插件
 type GeminiPlugin struct {
 	*BasePlugin
-	db         *sql.DB
-	httpClient *http.Client
+	db           *sql.DB
+	httpClient   *http.Client
+	streamClient *http.Client // 流式请求不限制总时长，只限制等待响应头的时间
 }
 
 // GeminiRequest 发送给Gemini API的请求结构
 type GeminiRequest struct {
-	Contents []GeminiContent `json:"contents"`
+	Contents         []GeminiContent         `json:"contents"`
+	GenerationConfig *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// GeminiGenerationConfig 生成参数
+type GeminiGenerationConfig struct {
+	MaxOutputTokens  int    `json:"maxOutputTokens,omitempty"`
+	ResponseMimeType string `json:"responseMimeType,omitempty"`
 }
 
 // GeminiContent 内容结构
@@ -89,6 +102,12 @@ func NewGeminiPlugin(db *sql.DB) *GeminiPlugin {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		streamClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: 30 * time.Second,
+			},
+		},
 	}
 
 	// 初始化数据库表
@@ -97,7 +116,8 @@ func NewGeminiPlugin(db *sql.DB) *GeminiPlugin {
 	return plugin
 }
 
-// initDatabase 初始化数据库表
+// initDatabase 初始化数据库表。gemini_config 只保存未启用密钥库时的明文API key，
+// 其他配置保存在插件共用的键值存储中
 func (gp *GeminiPlugin) initDatabase() {
 	createTableSQL := `
 	CREATE TABLE IF NOT EXISTS gemini_config (
@@ -111,11 +131,94 @@ func (gp *GeminiPlugin) initDatabase() {
 	}
 }
 
+// Initialize 初始化插件，把旧版本保存在 gemini_config 中的配置移到键值存储
+func (gp *GeminiPlugin) Initialize(ctx context.Context, manager interface{}) error {
+	if err := gp.BasePlugin.Initialize(ctx, manager); err != nil {
+		return err
+	}
+	if err := gp.migrateConfig(); err != nil {
+		logger.Errorf("Failed to migrate gemini config: %v", err)
+	}
+	return nil
+}
+
+// migrateConfig 把 gemini_config 中除API key以外的配置移到键值存储，键值存储中已有的值不覆盖
+func (gp *GeminiPlugin) migrateConfig() error {
+	store := pluginStorage(gp.manager)
+	if store == nil {
+		return nil
+	}
+	rows, err := gp.db.Query("SELECT key, value FROM gemini_config WHERE key != 'gemini_key'")
+	if err != nil {
+		return err
+	}
+	var keys, values []string
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		keys, values = append(keys, key), append(values, value)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, key := range keys {
+		if _, ok, err := store.Get(gp.info.Name, key); err != nil {
+			return err
+		} else if !ok {
+			if err := store.Set(gp.info.Name, key, values[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := gp.db.Exec("DELETE FROM gemini_config WHERE key = ?", key); err != nil {
+			return err
+		}
+	}
+	if len(keys) > 0 {
+		logger.Infof("Migrated %d gemini config values to plugin storage", len(keys))
+	}
+	return nil
+}
+
+// geminiLongHelp .help gemini 显示的详细帮助
+const geminiLongHelp = `🤖 Gemini AI插件详细帮助
+
+🚀 智能命令 (自动识别模式):
+  • .gemini <问题> - 智能问答，自动识别文本/图片
+  • .gm <问题> - 简写命令，功能同上
+
+✨ 智能功能:
+  • 📝 文本问答 - 直接提问即可
+  • 🖼️ 图片分析 - 发送图片时自动启用vision模式
+  • 🔄 回复模式 - 第一个参数为 "reply" 或 "r" 时回复原消息
+  • 💬 上下文对话 - 回复消息后提问
+  • 🔍 文字识别 - 回复图片发送 .ocr，提取图片中的文字
+
+⚙️ 配置命令:
+  • .gemini config - 查看当前配置
+  • .gemini key <API密钥> - 设置API密钥
+  • .gemini model <模型名> - 设置模型(默认: gemini-1.5-flash)
+  • .gemini auto <True/False> - 设置自动删除空提问
+
+📝 使用示例:
+  • .gemini 什么是人工智能？
+  • .gm 解释这个概念
+  • .gemini reply 请详细说明 (回复到原消息)
+  • .gm r 分析这张图片 (发送图片+回复模式)
+  • .gemini config (查看配置)
+  • .gemini key AIza... (设置API密钥)`
+
 // RegisterCommands 实现CommandPlugin接口
 func (gp *GeminiPlugin) RegisterCommands(parser *command.Parser) error {
 	// 注册简化的gemini命令 - 智能判断文本/图片模式
 	parser.RegisterCommand("gemini", "Gemini AI智能问答 - 自动识别文本/图片", gp.info.Name, gp.handleGeminiSmart)
 	parser.RegisterCommand("gm", "Gemini AI智能问答 - gemini的简写", gp.info.Name, gp.handleGeminiSmart)
+	parser.RegisterCommand("ocr", "识别回复的图片中的文字", gp.info.Name, gp.handleOCR)
+	parser.RegisterLongHelp(gp.info.Name, geminiLongHelp)
 
 	logger.Infof("Gemini commands registered successfully")
 	return nil
@@ -126,28 +229,19 @@ func (gp *GeminiPlugin) handleGeminiSmart(ctx *command.CommandContext) error {
 	// 智能判断是否为图片模式
 	hasMedia := ctx.Message.Message.Media != nil
 
-	// 判断是否为回复模式 - 检查参数中是否有 "reply" 或 "r"
-	shouldReply := false
-	for _, arg := range ctx.Args {
-		if arg == "reply" || arg == "r" {
-			shouldReply = true
-			// 从参数中移除 reply/r 标记
-			newArgs := make([]string, 0, len(ctx.Args)-1)
-			for _, a := range ctx.Args {
-				if a != "reply" && a != "r" {
-					newArgs = append(newArgs, a)
-				}
-			}
-			ctx.Args = newArgs
-			break
-		}
+	// 判断是否为回复模式 - 第一个参数为 "reply" 或 "r"
+	shouldReply := len(ctx.Args) > 0 && (ctx.Args[0] == "reply" || ctx.Args[0] == "r")
+	prompt := ctx.ArgsString()
+	if shouldReply {
+		prompt = ctx.ArgsStringFrom(1)
+		ctx.Args = ctx.Args[1:]
 	}
 
-	return gp.processGeminiRequest(ctx, hasMedia, shouldReply)
+	return gp.processGeminiRequest(ctx, hasMedia, shouldReply, prompt)
 }
 
-// processGeminiRequest 处理Gemini请求的核心逻辑
-func (gp *GeminiPlugin) processGeminiRequest(ctx *command.CommandContext, isVision bool, shouldReply bool) error {
+// processGeminiRequest 处理Gemini请求的核心逻辑，prompt 为问题的原始文本
+func (gp *GeminiPlugin) processGeminiRequest(ctx *command.CommandContext, isVision bool, shouldReply bool, prompt string) error {
 	// 处理设置命令 - 简化语法
 	if len(ctx.Args) >= 1 {
 		switch ctx.Args[0] {
@@ -166,13 +260,21 @@ func (gp *GeminiPlugin) processGeminiRequest(ctx *command.CommandContext, isVisi
 				return gp.setAutoRemove(ctx, ctx.Args[1])
 			}
 			return gp.sendResponse(ctx, "❌ 请提供设置值\n\n使用方法：`.gemini auto True` 或 `.gemini auto False`", false)
+		case "stream", "s":
+			if len(ctx.Args) >= 2 {
+				return gp.setStream(ctx, ctx.Args[1])
+			}
+			return gp.sendResponse(ctx, "❌ 请提供设置值\n\n使用方法：`.gemini stream True` 或 `.gemini stream False`", false)
 		case "config", "c":
 			return gp.showConfig(ctx)
 		}
 	}
 
 	// 获取配置
-	apiKey, err := gp.getConfig("gemini_key")
+	apiKey, err := gp.getAPIKey()
+	if errors.Is(err, secrets.ErrLocked) {
+		return gp.sendResponse(ctx, "❌ "+secretsLockedMessage, false)
+	}
 	if err != nil || apiKey == "" {
 		return gp.sendResponse(ctx, "❌ 错误：未设置 API key\n\n使用方法：`.gemini key 你的API密钥`", false)
 	}
@@ -185,31 +287,41 @@ func (gp *GeminiPlugin) processGeminiRequest(ctx *command.CommandContext, isVisi
 	autoRemove, _ := gp.getConfig("gemini_auto_remove")
 
 	// 获取问题文本和媒体
-	text := strings.Join(ctx.Args, " ")
+	text := prompt
 	var mediaData string
 	var questionType string
 	var replyText string
 	var replyUserInfo string
 
-	// 处理回复消息
-	if ctx.Message.Message.ReplyTo != nil {
-		if replyToMsg, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader); ok {
-			// 这里需要通过API获取被回复的消息
-			// 为了简化，我们先跳过回复消息的处理
-			replyUserInfo = fmt.Sprintf("回复消息ID: %d", replyToMsg.ReplyToMsgID)
+	// 处理回复消息：被回复消息的文字和发送者作为上下文
+	var replyMsg *tg.Message
+	if replyTo, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader); ok && replyTo.ReplyToMsgID != 0 {
+		msg, sender, err := fetchMessageWithSender(ctx, replyTo.ReplyToMsgID)
+		if err != nil {
+			logger.Ctx(ctx.Context).Warnf("Failed to fetch replied message %d: %v", replyTo.ReplyToMsgID, err)
+		} else {
+			replyMsg = msg
+			replyText = strings.TrimSpace(msg.Message)
+			replyUserInfo = sender
 		}
 	}
 
+	// 被回复的消息只有图片时自动切换为图片模式
+	if !isVision && replyMsg != nil && replyText == "" && hasImage(replyMsg) {
+		isVision = true
+	}
+
 	// 处理图片模式
 	if isVision {
 		var mediaMsg *tg.Message
 
-		// 检查当前消息是否有媒体
+		// 优先使用当前消息的图片，其次使用被回复消息的图片
 		if ctx.Message.Message.Media != nil {
 			mediaMsg = ctx.Message.Message
+		} else if replyMsg != nil && hasImage(replyMsg) {
+			mediaMsg = replyMsg
 		} else {
-			// 简化处理：如果当前消息没有媒体，返回错误
-			return gp.sendResponse(ctx, "❌ 请直接带图提问", false)
+			return gp.sendResponse(ctx, "❌ 请直接带图提问或回复一张图片", false)
 		}
 
 		// 下载并处理图片
@@ -235,9 +347,13 @@ func (gp *GeminiPlugin) processGeminiRequest(ctx *command.CommandContext, isVisi
 
 	// 构建问题
 	question := text
-	if replyText != "" && questionType != "empty" {
+	switch {
+	case replyText != "" && questionType != "empty":
 		question = fmt.Sprintf("%s: \n%s\n\n------\n\n%s", replyUserInfo, replyText, text)
-	} else if questionType == "empty" {
+	case replyText != "" && !isVision:
+		// 只回复了消息没有提问时，针对被回复的内容作答
+		question = fmt.Sprintf("%s: \n%s\n\n------\n\n尽可能简短地回答", replyUserInfo, replyText)
+	case questionType == "empty":
 		question = "尽可能简短地回答"
 	}
 
@@ -252,69 +368,69 @@ func (gp *GeminiPlugin) processGeminiRequest(ctx *command.CommandContext, isVisi
 		return fmt.Errorf("failed to resolve peer: %w", err)
 	}
 
-	// 编辑原消息显示处理状态
-	_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-		Peer:    peer,
-		ID:      ctx.Message.Message.ID,
-		Message: processingMsg,
-	})
-	if err != nil {
-		logger.Errorf("Failed to edit message: %v", err)
-	}
-
-	// 调用Gemini API
-	answer, err := gp.callGeminiAPI(apiKey, model, question, mediaData, isVision)
-	if err != nil {
-		errorMsg := fmt.Sprintf("❌ 错误：%v", err)
-
-		// 编辑消息显示错误
-		_, editErr := ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
+	// 编辑原消息显示处理状态，sudo用户的消息不能编辑
+	if !ctx.Message.Sudo {
+		_, err = ctx.EditMessage(&tg.MessagesEditMessageRequest{
 			Peer:    peer,
 			ID:      ctx.Message.Message.ID,
-			Message: errorMsg,
+			Message: processingMsg,
 		})
+		if err != nil {
+			logger.Errorf("Failed to edit message: %v", err)
+		}
+	}
 
-		if editErr != nil {
-			// 如果编辑失败，发送新消息
-			_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-				Peer:     peer,
-				Message:  errorMsg,
-				RandomID: time.Now().UnixNano(),
-			})
+	// 回复模式下回答作为新消息回复被回复的消息
+	replyToID := 0
+	if shouldReply {
+		if replyTo, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader); ok {
+			replyToID = replyTo.ReplyToMsgID
 		}
+	}
+	if replyToID == 0 && ctx.Message.Sudo {
+		// sudo用户的命令消息不能编辑，回答回复该消息
+		replyToID = ctx.Message.Message.ID
+	}
+	removeQuestion := autoRemove == "True" && questionType == "empty"
 
-		// 延迟删除错误消息
-		go func() {
-			time.Sleep(10 * time.Second)
-			ctx.API.MessagesDeleteMessages(ctx.Context, &tg.MessagesDeleteMessagesRequest{
-				ID: []int{ctx.Message.Message.ID},
-			})
-		}()
-
-		// 自动删除空提问
-		if autoRemove == "True" && questionType == "empty" {
-			go func() {
-				time.Sleep(1 * time.Second)
-				ctx.API.MessagesDeleteMessages(ctx.Context, &tg.MessagesDeleteMessagesRequest{
-					ID: []int{ctx.Message.Message.ID},
-				})
-			}()
+	// 流式回答，边生成边编辑消息
+	if stream, _ := gp.getConfig("gemini_stream"); stream != "False" {
+		shown, err := gp.streamAnswer(ctx, peer, apiKey, model, question, mediaData, isVision, replyToID)
+		if err != nil && !shown {
+			return gp.showError(ctx, err, removeQuestion)
 		}
+		if err != nil {
+			logger.Ctx(ctx.Context).Warnf("Gemini stream interrupted: %v", err)
+		}
+		switch {
+		case ctx.Message.Sudo:
+			// 保留sudo用户的命令消息
+		case replyToID != 0:
+			// 删除处理消息
+			ctx.DeleteMessages(peer, []int{ctx.Message.Message.ID})
+		case removeQuestion:
+			scheduleDeletion(ctx, gp.manager, []int{ctx.Message.Message.ID}, time.Second, "gemini")
+		}
+		return nil
+	}
 
-		return err
+	// 调用Gemini API
+	answer, err := gp.callGeminiAPI(apiKey, model, question, mediaData, isVision)
+	if err != nil {
+		return gp.showError(ctx, err, removeQuestion)
 	}
 
 	// 发送回答
 	if shouldReply && ctx.Message.Message.ReplyTo != nil {
 		// 回复到原消息
 		if replyToMsg, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader); ok {
-			_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
+			_, err = ctx.SendFormatted(&tg.MessagesSendMessageRequest{
 				Peer:      peer,
 				Message:   answer,
 				RandomID:  time.Now().UnixNano(),
 				ReplyTo:   &tg.InputReplyToMessage{ReplyToMsgID: replyToMsg.ReplyToMsgID},
 				NoWebpage: true,
-			})
+			}, format.Markdown)
 		}
 
 		// 删除处理消息
@@ -322,32 +438,30 @@ func (gp *GeminiPlugin) processGeminiRequest(ctx *command.CommandContext, isVisi
 			ID: []int{ctx.Message.Message.ID},
 		})
 	} else {
-		// 编辑原消息显示回答
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: answer,
-		})
+		// 编辑原消息显示回答，过长时拆分为多条，与回复模式一样不显示链接预览
+		_, err = ctx.RespondNoPreview(answer, format.Markdown)
+	}
 
-		if err != nil {
-			// 如果编辑失败，发送新消息
-			_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-				Peer:      peer,
-				Message:   answer,
-				RandomID:  time.Now().UnixNano(),
-				NoWebpage: true,
-			})
-		}
+	// 自动删除空提问
+	if removeQuestion {
+		scheduleDeletion(ctx, gp.manager, []int{ctx.Message.Message.ID}, time.Second, "gemini")
+	}
+
+	return err
+}
+
+// showError 在命令消息中显示请求错误并延迟删除
+func (gp *GeminiPlugin) showError(ctx *command.CommandContext, err error, removeQuestion bool) error {
+	errorMsg := fmt.Sprintf("❌ 错误：%v", err)
+
+	// 编辑消息显示错误，命令消息不可编辑时回复命令消息，10秒后删除
+	if _, respondErr := ctx.RespondEphemeral(errorMsg, format.Plain, 10*time.Second); respondErr != nil {
+		err = respondErr
 	}
 
 	// 自动删除空提问
-	if autoRemove == "True" && questionType == "empty" {
-		go func() {
-			time.Sleep(1 * time.Second)
-			ctx.API.MessagesDeleteMessages(ctx.Context, &tg.MessagesDeleteMessagesRequest{
-				ID: []int{ctx.Message.Message.ID},
-			})
-		}()
+	if removeQuestion {
+		scheduleDeletion(ctx, gp.manager, []int{ctx.Message.Message.ID}, time.Second, "gemini")
 	}
 
 	return err
@@ -356,7 +470,12 @@ func (gp *GeminiPlugin) processGeminiRequest(ctx *command.CommandContext, isVisi
 // setAPIKey 设置API密钥
 func (gp *GeminiPlugin) setAPIKey(ctx *command.CommandContext, key string) error {
 	key = strings.TrimSpace(key)
-	err := gp.setConfig("gemini_key", key)
+	err := saveSecret(gp.manager, "gemini.api_key", key, func(value string) error {
+		return gp.setPlainAPIKey(value)
+	})
+	if errors.Is(err, secrets.ErrLocked) {
+		return gp.sendResponse(ctx, "❌ "+secretsLockedMessage, true)
+	}
 	if err != nil {
 		return gp.sendResponse(ctx, fmt.Sprintf("❌ 设置API密钥失败：%v", err), true)
 	}
@@ -386,6 +505,17 @@ func (gp *GeminiPlugin) setAutoRemove(ctx *command.CommandContext, autoRemove st
 	return gp.sendResponse(ctx, fmt.Sprintf("✅ 已设置自动删除空提问: `%s`", autoRemove), true)
 }
 
+// setStream 设置流式回答
+func (gp *GeminiPlugin) setStream(ctx *command.CommandContext, stream string) error {
+	stream = strings.TrimSpace(stream)
+	err := gp.setConfig("gemini_stream", stream)
+	if err != nil {
+		return gp.sendResponse(ctx, fmt.Sprintf("❌ 设置流式回答失败：%v", err), true)
+	}
+
+	return gp.sendResponse(ctx, fmt.Sprintf("✅ 已设置流式回答: `%s`", stream), true)
+}
+
 // downloadAndProcessImage 下载并处理图片
 func (gp *GeminiPlugin) downloadAndProcessImage(ctx *command.CommandContext, mediaMsg *tg.Message) (string, error) {
 	// 创建临时文件
@@ -393,19 +523,13 @@ func (gp *GeminiPlugin) downloadAndProcessImage(ctx *command.CommandContext, med
 	defer os.Remove(tmpFile)
 
 	// 下载媒体文件
-	location, err := gp.getMediaLocation(mediaMsg)
-	if err != nil {
-		return "", fmt.Errorf("获取媒体位置失败: %w", err)
-	}
-
-	// 下载文件
-	fileBytes, err := gp.downloadFile(ctx, location)
-	if err != nil {
+	var buf bytes.Buffer
+	if _, _, err := downloadMessageMedia(ctx, mediaMsg, &buf, nil); err != nil {
 		return "", fmt.Errorf("下载文件失败: %w", err)
 	}
 
 	// 解码图片
-	img, _, err := image.Decode(bytes.NewReader(fileBytes))
+	img, _, err := image.Decode(&buf)
 	if err != nil {
 		return "", fmt.Errorf("解码图片失败: %w", err)
 	}
@@ -431,89 +555,24 @@ func (gp *GeminiPlugin) downloadAndProcessImage(ctx *command.CommandContext, med
 	return base64.StdEncoding.EncodeToString(imageData), nil
 }
 
-// getMediaLocation 获取媒体文件位置
-func (gp *GeminiPlugin) getMediaLocation(msg *tg.Message) (tg.InputFileLocationClass, error) {
-	if msg.Media == nil {
-		return nil, fmt.Errorf("消息不包含媒体")
-	}
-
+// hasImage 消息是否包含图片(照片或图片文件)
+func hasImage(msg *tg.Message) bool {
 	switch media := msg.Media.(type) {
 	case *tg.MessageMediaPhoto:
-		if photo, ok := media.Photo.(*tg.Photo); ok {
-			if len(photo.Sizes) > 0 {
-				// 获取最大尺寸的图片
-				var maxSize *tg.PhotoSize
-				for _, size := range photo.Sizes {
-					if photoSize, ok := size.(*tg.PhotoSize); ok {
-						if maxSize == nil || photoSize.Size > maxSize.Size {
-							maxSize = photoSize
-						}
-					}
-				}
-				if maxSize != nil {
-					return &tg.InputPhotoFileLocation{
-						ID:            photo.ID,
-						AccessHash:    photo.AccessHash,
-						FileReference: photo.FileReference,
-						ThumbSize:     maxSize.Type,
-					}, nil
-				}
-			}
-		}
+		_, ok := media.Photo.(*tg.Photo)
+		return ok
 	case *tg.MessageMediaDocument:
-		if doc, ok := media.Document.(*tg.Document); ok {
-			return &tg.InputDocumentFileLocation{
-				ID:            doc.ID,
-				AccessHash:    doc.AccessHash,
-				FileReference: doc.FileReference,
-			}, nil
-		}
+		doc, ok := media.Document.(*tg.Document)
+		return ok && strings.HasPrefix(doc.MimeType, "image/")
 	}
-
-	return nil, fmt.Errorf("不支持的媒体类型")
+	return false
 }
 
-// downloadFile 下载文件
-func (gp *GeminiPlugin) downloadFile(ctx *command.CommandContext, location tg.InputFileLocationClass) ([]byte, error) {
-	// 使用gotd API下载文件
-	const chunkSize = 512 * 1024 // 512KB chunks
-
-	var result []byte
-	offset := 0
-
-	for {
-		resp, err := ctx.API.UploadGetFile(ctx.Context, &tg.UploadGetFileRequest{
-			Location: location,
-			Offset:   int64(offset),
-			Limit:    chunkSize,
-		})
-		if err != nil {
-			return nil, err
-		}
-
-		if file, ok := resp.(*tg.UploadFile); ok {
-			result = append(result, file.Bytes...)
-			if len(file.Bytes) < chunkSize {
-				break // 最后一块
-			}
-			offset += len(file.Bytes)
-		} else {
-			return nil, fmt.Errorf("意外的响应类型")
-		}
-	}
-
-	return result, nil
-}
-
-// callGeminiAPI 调用Gemini API
-func (gp *GeminiPlugin) callGeminiAPI(apiKey, model, question, mediaData string, isVision bool) (string, error) {
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, apiKey)
-
-	var request GeminiRequest
-
+// buildGeminiRequest 构建请求内容
+func buildGeminiRequest(question, mediaData string, isVision bool) GeminiRequest {
 	if isVision && mediaData != "" {
 		// 图片模式
-		request = GeminiRequest{
+		return GeminiRequest{
 			Contents: []GeminiContent{
 				{
 					Parts: []GeminiPart{
@@ -528,19 +587,24 @@ func (gp *GeminiPlugin) callGeminiAPI(apiKey, model, question, mediaData string,
 				},
 			},
 		}
-	} else {
-		// 文本模式
-		request = GeminiRequest{
-			Contents: []GeminiContent{
-				{Role: "user", Parts: []GeminiPart{{Text: "尽可能简单且快速地回答"}}},
-				{Role: "model", Parts: []GeminiPart{{Text: "好的 我会尽可能简单且快速地回答"}}},
-				{Role: "user", Parts: []GeminiPart{{Text: question}}},
-			},
-		}
 	}
 
+	// 文本模式
+	return GeminiRequest{
+		Contents: []GeminiContent{
+			{Role: "user", Parts: []GeminiPart{{Text: "尽可能简单且快速地回答"}}},
+			{Role: "model", Parts: []GeminiPart{{Text: "好的 我会尽可能简单且快速地回答"}}},
+			{Role: "user", Parts: []GeminiPart{{Text: question}}},
+		},
+	}
+}
+
+// callGeminiAPI 调用Gemini API
+func (gp *GeminiPlugin) callGeminiAPI(apiKey, model, question, mediaData string, isVision bool) (string, error) {
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, apiKey)
+
 	// 序列化请求
-	jsonData, err := json.Marshal(request)
+	jsonData, err := json.Marshal(buildGeminiRequest(question, mediaData, isVision))
 	if err != nil {
 		return "", fmt.Errorf("序列化请求失败: %w", err)
 	}
@@ -593,63 +657,118 @@ func (gp *GeminiPlugin) callGeminiAPI(apiKey, model, question, mediaData string,
 	return answer, nil
 }
 
-// sendResponse 发送响应消息
+// sendResponse 发送响应消息，过长时拆分为多条
 func (gp *GeminiPlugin) sendResponse(ctx *command.CommandContext, message string, autoDelete bool) error {
-	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-	if err != nil {
-		return fmt.Errorf("failed to resolve peer: %w", err)
-	}
-
-	// 编辑原消息
-	_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-		Peer:    peer,
-		ID:      ctx.Message.Message.ID,
-		Message: message,
-	})
-
-	if err != nil {
-		// 如果编辑失败，发送新消息
-		_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-			Peer:     peer,
-			Message:  message,
-			RandomID: time.Now().UnixNano(),
-		})
-	}
-
-	// 自动删除消息
+	var err error
 	if autoDelete {
-		go func() {
-			time.Sleep(5 * time.Second)
-			ctx.API.MessagesDeleteMessages(ctx.Context, &tg.MessagesDeleteMessagesRequest{
-				ID: []int{ctx.Message.Message.ID},
-			})
-		}()
+		// 5秒后自动删除响应
+		_, err = ctx.RespondEphemeral(message, format.Markdown, 5*time.Second)
+	} else {
+		_, err = ctx.Respond(message, format.Markdown)
 	}
-
 	return err
 }
 
-// getConfig 获取配置
+// getConfig 从键值存储获取配置，未设置时返回空字符串
 func (gp *GeminiPlugin) getConfig(key string) (string, error) {
+	value, _, err := pluginStorage(gp.manager).Get(gp.info.Name, key)
+	return value, err
+}
+
+// getPlainAPIKey 读取未启用密钥库时以明文保存的API key
+func (gp *GeminiPlugin) getPlainAPIKey() (string, error) {
 	var value string
-	err := gp.db.QueryRow("SELECT value FROM gemini_config WHERE key = ?", key).Scan(&value)
+	err := gp.db.QueryRow("SELECT value FROM gemini_config WHERE key = 'gemini_key'").Scan(&value)
 	if err == sql.ErrNoRows {
 		return "", nil
 	}
 	return value, err
 }
 
-// setConfig 设置配置
+// SelfTestChecks 实现SelfTestPlugin接口，使用1个token的请求验证API key
+func (gp *GeminiPlugin) SelfTestChecks() []selftest.Check {
+	return []selftest.Check{{
+		Name:    "gemini",
+		Timeout: 20 * time.Second,
+		Run: func(ctx context.Context) error {
+			apiKey, err := gp.getAPIKey()
+			if errors.Is(err, secrets.ErrLocked) {
+				return selftest.Skipf("%s", secretsLockedMessage)
+			}
+			if err != nil {
+				return err
+			}
+			if apiKey == "" {
+				return selftest.Skipf("未设置 API key")
+			}
+			model, _ := gp.getConfig("gemini_model")
+			if model == "" {
+				model = "gemini-1.5-flash"
+			}
+			return gp.verifyAPIKey(ctx, apiKey, model)
+		},
+	}}
+}
+
+// verifyAPIKey 发送最大输出为1个token的请求验证API key和模型是否可用
+func (gp *GeminiPlugin) verifyAPIKey(ctx context.Context, apiKey, model string) error {
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, apiKey)
+	request := GeminiRequest{
+		Contents:         []GeminiContent{{Role: "user", Parts: []GeminiPart{{Text: "ping"}}}},
+		GenerationConfig: &GeminiGenerationConfig{MaxOutputTokens: 1},
+	}
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := gp.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送HTTP请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		var errorResp GeminiResponse
+		if err := json.Unmarshal(body, &errorResp); err == nil && errorResp.Error != nil {
+			return fmt.Errorf("%s", errorResp.Error.Message)
+		}
+		return fmt.Errorf("响应异常 (状态码: %d)", resp.StatusCode)
+	}
+	return nil
+}
+
+// getAPIKey 获取API密钥，启用密钥库后从密钥库读取
+func (gp *GeminiPlugin) getAPIKey() (string, error) {
+	return loadSecret(gp.manager, "gemini.api_key", func() (string, error) {
+		return gp.getPlainAPIKey()
+	})
+}
+
+// setConfig 在键值存储中设置配置
 func (gp *GeminiPlugin) setConfig(key, value string) error {
-	_, err := gp.db.Exec("INSERT OR REPLACE INTO gemini_config (key, value) VALUES (?, ?)", key, value)
+	return pluginStorage(gp.manager).Set(gp.info.Name, key, value)
+}
+
+// setPlainAPIKey 未启用密钥库时以明文保存API key
+func (gp *GeminiPlugin) setPlainAPIKey(value string) error {
+	_, err := gp.db.Exec("INSERT OR REPLACE INTO gemini_config (key, value) VALUES ('gemini_key', ?)", value)
 	return err
 }
 
 // showConfig 显示当前配置
 func (gp *GeminiPlugin) showConfig(ctx *command.CommandContext) error {
-	apiKey, _ := gp.getConfig("gemini_key")
+	apiKey, keyErr := gp.getAPIKey()
 	model, _ := gp.getConfig("gemini_model")
 	autoRemove, _ := gp.getConfig("gemini_auto_remove")
+	stream, _ := gp.getConfig("gemini_stream")
 
 	if model == "" {
 		model = "gemini-1.5-flash (默认)"
@@ -657,10 +776,15 @@ func (gp *GeminiPlugin) showConfig(ctx *command.CommandContext) error {
 	if autoRemove == "" {
 		autoRemove = "False (默认)"
 	}
+	if stream == "" {
+		stream = "True (默认)"
+	}
 
 	// 隐藏API密钥的大部分内容
 	maskedKey := "未设置"
-	if apiKey != "" {
+	if errors.Is(keyErr, secrets.ErrLocked) {
+		maskedKey = "🔒 " + secretsLockedMessage
+	} else if apiKey != "" {
 		if len(apiKey) > 8 {
 			maskedKey = apiKey[:4] + "****" + apiKey[len(apiKey)-4:]
 		} else {
@@ -673,11 +797,13 @@ func (gp *GeminiPlugin) showConfig(ctx *command.CommandContext) error {
 🔑 API密钥: %s
 🧠 模型: %s  
 🗑️ 自动删除: %s
+⚡ 流式回答: %s
 
 💡 修改配置:
 • .gemini key <新密钥>
 • .gemini model <新模型>  
-• .gemini auto <True/False>`, maskedKey, model, autoRemove)
+• .gemini auto <True/False>
+• .gemini stream <True/False>`, maskedKey, model, autoRemove, stream)
 
 	return gp.sendResponse(ctx, configMsg, false)
 }
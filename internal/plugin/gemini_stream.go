@@ -0,0 +1,234 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// geminiEditInterval 流式回答时两次编辑消息的最小间隔
+	geminiEditInterval = 1500 * time.Millisecond
+	// geminiStreamTimeout 一次流式回答的最长时间
+	geminiStreamTimeout = 5 * time.Minute
+	// geminiCursor 回答生成中时显示在末尾的光标
+	geminiCursor = " ▌"
+)
+
+// streamGeminiAPI 通过 streamGenerateContent 接口流式获取回答，每收到一段文本就以累计的回答调用onText
+func (gp *GeminiPlugin) streamGeminiAPI(ctx context.Context, apiKey, model, question, mediaData string, isVision bool, onText func(text string)) (string, error) {
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:streamGenerateContent?alt=sse&key=%s", model, apiKey)
+
+	jsonData, err := json.Marshal(buildGeminiRequest(question, mediaData, isVision))
+	if err != nil {
+		return "", fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, geminiStreamTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := gp.streamClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("发送HTTP请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		var errorResp GeminiResponse
+		if err := json.Unmarshal(body, &errorResp); err == nil && errorResp.Error != nil {
+			return "", fmt.Errorf("%s", errorResp.Error.Message)
+		}
+		return "", fmt.Errorf("响应异常 (状态码: %d)", resp.StatusCode)
+	}
+
+	// SSE 每个事件为一行 "data: {...}"，内容是一个完整的 GeminiResponse
+	var answer strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "" {
+			continue
+		}
+
+		var chunk GeminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return answer.String(), fmt.Errorf("解析JSON出错: %w", err)
+		}
+		if chunk.Error != nil {
+			return answer.String(), fmt.Errorf("%s", chunk.Error.Message)
+		}
+		if len(chunk.Candidates) == 0 {
+			continue
+		}
+
+		added := false
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.Text != "" {
+				answer.WriteString(part.Text)
+				added = true
+			}
+		}
+		if added {
+			onText(answer.String())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return answer.String(), fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	if answer.Len() == 0 {
+		return "", fmt.Errorf("回答为空，可能是未通过谷歌的审核")
+	}
+	return answer.String(), nil
+}
+
+// geminiStream 把流式回答显示到消息中：按间隔编辑消息，超过长度限制时后续内容发送为新消息
+type geminiStream struct {
+	ctx     *command.CommandContext
+	peer    tg.InputPeerClass
+	replyTo int // 回复模式下回答所回复的消息，为0时回答显示在命令消息中
+
+	messages []int          // 显示回答的消息ID，依次对应解析后拆分的各段
+	shown    []format.Chunk // 各条消息最后一次显示的内容
+	lastEdit time.Time
+}
+
+// newGeminiStream 创建流式显示。replyTo不为0时回答作为新消息回复该消息，否则编辑命令消息
+func newGeminiStream(ctx *command.CommandContext, peer tg.InputPeerClass, replyTo int) *geminiStream {
+	s := &geminiStream{ctx: ctx, peer: peer, replyTo: replyTo}
+	if replyTo == 0 {
+		s.messages = []int{ctx.Message.Message.ID}
+		s.shown = []format.Chunk{{}}
+	}
+	return s
+}
+
+// update 显示累计的回答。回答先按 Markdown 解析再拆分，与 Respond 一致，
+// 拆分位置不会落在格式标记中间。距上次编辑不足间隔时跳过，final为true时总是更新且不显示光标
+func (s *geminiStream) update(answer string, final bool) error {
+	if !final && time.Since(s.lastEdit) < geminiEditInterval {
+		return nil
+	}
+	s.lastEdit = time.Now()
+
+	text, entities := format.Parse(format.Markdown, answer)
+	chunks := format.Split(text, entities, format.MaxMessageLength)
+	last := &chunks[len(chunks)-1]
+	if !final && utf16Len(last.Text)+utf16Len(geminiCursor) <= format.MaxMessageLength {
+		last.Text += geminiCursor
+	}
+	// 之前的段在回答继续生成时可能变化(如代码块闭合)，只编辑内容不同的消息
+	for i, chunk := range chunks {
+		if i > len(s.messages) {
+			// 没有得到上一段消息的ID，下次更新时重新发送
+			break
+		}
+		if err := s.show(i, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// show 把第i段显示到对应的消息，还没有该消息时发送新消息
+func (s *geminiStream) show(i int, chunk format.Chunk) error {
+	if strings.TrimSpace(chunk.Text) == "" {
+		return nil
+	}
+
+	if i < len(s.messages) {
+		if reflect.DeepEqual(chunk, s.shown[i]) {
+			return nil
+		}
+		_, err := s.ctx.EditMessage(&tg.MessagesEditMessageRequest{
+			Peer:      s.peer,
+			ID:        s.messages[i],
+			Message:   chunk.Text,
+			Entities:  chunk.Entities,
+			NoWebpage: true,
+		})
+		if err != nil && !tg.IsMessageNotModified(err) {
+			return err
+		}
+		s.shown[i] = chunk
+		return nil
+	}
+
+	req := &tg.MessagesSendMessageRequest{
+		Peer:      s.peer,
+		Message:   chunk.Text,
+		Entities:  chunk.Entities,
+		RandomID:  time.Now().UnixNano(),
+		NoWebpage: true,
+	}
+	if s.replyTo != 0 {
+		req.ReplyTo = &tg.InputReplyToMessage{ReplyToMsgID: s.replyTo}
+	}
+	updates, err := s.ctx.SendMessage(req)
+	if err != nil {
+		return err
+	}
+	id := command.SentMessageID(updates)
+	if id == 0 {
+		logger.Ctx(s.ctx.Context).Warnf("Failed to get ID of sent Gemini message")
+		return nil
+	}
+	s.messages = append(s.messages, id)
+	s.shown = append(s.shown, chunk)
+	return nil
+}
+
+// streamAnswer 流式获取并显示回答。返回的shown表示是否已有部分回答显示出来，
+// 此时错误已附加在回答末尾，调用方不需要再显示错误
+func (gp *GeminiPlugin) streamAnswer(ctx *command.CommandContext, peer tg.InputPeerClass, apiKey, model, question, mediaData string, isVision bool, replyTo int) (shown bool, err error) {
+	stream := newGeminiStream(ctx, peer, replyTo)
+	var displayErr error
+	answer, err := gp.streamGeminiAPI(ctx.Context, apiKey, model, question, mediaData, isVision, func(text string) {
+		if displayErr == nil {
+			displayErr = stream.update(text, false)
+			shown = displayErr == nil
+		}
+	})
+	if displayErr != nil {
+		logger.Ctx(ctx.Context).Warnf("Failed to show streaming Gemini answer: %v", displayErr)
+	}
+
+	if err != nil {
+		if answer == "" || !shown {
+			return false, err
+		}
+		answer += fmt.Sprintf("\n\n⚠️ 回答中断：%s", format.EscapeMarkdown(err.Error()))
+	}
+
+	if updateErr := stream.update(answer, true); updateErr != nil {
+		if !shown {
+			return false, updateErr
+		}
+		logger.Ctx(ctx.Context).Warnf("Failed to show final Gemini answer: %v", updateErr)
+	}
+	return true, err
+}
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"context"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// newStreamTest 创建在命令消息(ID 10)中显示回答的 geminiStream，发送的消息ID从100开始
+func newStreamTest() (*geminiStream, *fakeInvoker) {
+	nextID := 100
+	inv := &fakeInvoker{handle: func(input bin.Encoder, output bin.Decoder) error {
+		if _, ok := input.(*tg.MessagesSendMessageRequest); ok {
+			output.(*tg.UpdatesBox).Updates = &tg.UpdateShortSentMessage{ID: nextID}
+			nextID++
+			return nil
+		}
+		return errUnhandled
+	}}
+	ctx := &command.CommandContext{
+		Context:      context.Background(),
+		API:          tg.NewClient(inv),
+		PeerResolver: peers.NewResolver(fakePeers{}),
+		Message:      &core.MessageEvent{ChatID: -100, UserID: 1, Message: &tg.Message{ID: 10}},
+	}
+	return newGeminiStream(ctx, &tg.InputPeerChat{ChatID: 100}, 0), inv
+}
+
+// boldRange 返回唯一的粗体实体的范围
+func boldRange(t *testing.T, entities []tg.MessageEntityClass) (int, int) {
+	t.Helper()
+	if len(entities) != 1 {
+		t.Fatalf("entities = %v, want one bold entity", entities)
+	}
+	bold, ok := entities[0].(*tg.MessageEntityBold)
+	if !ok {
+		t.Fatalf("entity = %T, want bold", entities[0])
+	}
+	return bold.Offset, bold.Length
+}
+
+func TestGeminiStreamSplitsParsedAnswer(t *testing.T) {
+	s, inv := newStreamTest()
+	// 粗体跨越拆分位置，先拆分原文会在第一段留下未闭合的标记
+	answer := "**" + strings.Repeat("a", 5000) + "**"
+
+	if err := s.update(answer[:3000], false); err != nil {
+		t.Fatal(err)
+	}
+	edits := requests[*tg.MessagesEditMessageRequest](inv)
+	if len(edits) != 1 || edits[0].ID != 10 || edits[0].Message != "**"+strings.Repeat("a", 2998)+geminiCursor {
+		t.Fatalf("intermediate edits = %d", len(edits))
+	}
+
+	if err := s.update(answer, true); err != nil {
+		t.Fatal(err)
+	}
+	edits = requests[*tg.MessagesEditMessageRequest](inv)
+	sends := requests[*tg.MessagesSendMessageRequest](inv)
+	if len(edits) != 2 || len(sends) != 1 {
+		t.Fatalf("final: %d edits, %d sends", len(edits), len(sends))
+	}
+	first, second := edits[1], sends[0]
+	if first.ID != 10 || first.Message != strings.Repeat("a", format.MaxMessageLength) {
+		t.Errorf("first message = %d chars in message %d", len(first.Message), first.ID)
+	}
+	if offset, length := boldRange(t, first.Entities); offset != 0 || length != format.MaxMessageLength {
+		t.Errorf("first bold = %d+%d", offset, length)
+	}
+	if second.Message != strings.Repeat("a", 5000-format.MaxMessageLength) {
+		t.Errorf("second message = %d chars", len(second.Message))
+	}
+	if offset, length := boldRange(t, second.Entities); offset != 0 || length != 5000-format.MaxMessageLength {
+		t.Errorf("second bold = %d+%d", offset, length)
+	}
+
+	// 内容不变时不再编辑或发送
+	if err := s.update(answer, true); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(inv.calls); n != 3 {
+		t.Errorf("%d requests after an unchanged update, want 3", n)
+	}
+}
@@ -0,0 +1,358 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"nexusvalet/internal/storage"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// ghostDefaultDelay 自动已读默认的延迟
+	ghostDefaultDelay = 5 * time.Second
+	// ghostMaxDelay 自动已读允许的最长延迟
+	ghostMaxDelay = time.Hour
+	// ghostReadTimeout 一次标记已读请求的超时时间
+	ghostReadTimeout = 30 * time.Second
+)
+
+// ghostPending 对话中等待标记已读的消息
+type ghostPending struct {
+	timer *time.Timer
+	maxID int // 已收到的最新消息ID
+}
+
+// GhostPlugin 已读管理：.read 立即把当前对话标记为已读，.ghost 开启后收到的消息在延迟后自动标记为已读
+type GhostPlugin struct {
+	*BasePlugin
+	db           *sql.DB
+	telegramAPI  *tg.Client
+	peerResolver *peers.Resolver
+	chats        map[int64]time.Duration // chat_id -> 自动已读延迟
+	pending      map[int64]*ghostPending // chat_id -> 等待标记已读的消息
+	mutex        sync.Mutex
+}
+
+// NewGhostPlugin 创建已读管理插件
+func NewGhostPlugin(db *sql.DB) *GhostPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "ghost",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "标记对话为已读，或在收到消息后自动标记已读",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &GhostPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+		chats:      make(map[int64]time.Duration),
+		pending:    make(map[int64]*ghostPending),
+	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+	plugin.loadChats()
+
+	return plugin
+}
+
+// initDatabase 初始化数据库表
+func (gp *GhostPlugin) initDatabase() {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS ghost_chats (
+		chat_id INTEGER PRIMARY KEY,
+		delay_seconds INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);`
+
+	_, err := gp.db.Exec(createTableSQL)
+	if err != nil {
+		logger.Errorf("Failed to create ghost_chats table: %v", err)
+	}
+}
+
+// loadChats 从数据库读取开启自动已读的对话
+func (gp *GhostPlugin) loadChats() {
+	rows, err := gp.db.Query("SELECT chat_id, delay_seconds FROM ghost_chats")
+	if err != nil {
+		logger.Errorf("Failed to load ghost chats: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	chats := make(map[int64]time.Duration)
+	for rows.Next() {
+		var chatID, seconds int64
+		if err := rows.Scan(&chatID, &seconds); err != nil {
+			logger.Errorf("Failed to scan ghost chat: %v", err)
+			continue
+		}
+		chats[chatID] = time.Duration(seconds) * time.Second
+	}
+	if err := rows.Err(); err != nil {
+		logger.Errorf("Failed to load ghost chats: %v", err)
+	}
+
+	gp.mutex.Lock()
+	gp.chats = chats
+	gp.mutex.Unlock()
+	if len(chats) > 0 {
+		logger.Infof("Loaded %d ghost chats", len(chats))
+	}
+}
+
+// SetTelegramClient 设置Telegram客户端和Peer解析器
+func (gp *GhostPlugin) SetTelegramClient(client *tg.Client, peerResolver *peers.Resolver) {
+	gp.telegramAPI = client
+	gp.peerResolver = peerResolver
+}
+
+// Shutdown 停止等待中的自动已读，未标记的消息保持未读
+func (gp *GhostPlugin) Shutdown(ctx context.Context) error {
+	gp.mutex.Lock()
+	for chatID, p := range gp.pending {
+		p.timer.Stop()
+		delete(gp.pending, chatID)
+	}
+	gp.mutex.Unlock()
+	return gp.BasePlugin.Shutdown(ctx)
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (gp *GhostPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("read", "把当前对话标记为已读", gp.info.Name, gp.handleRead)
+	parser.RegisterCommand("ghost", "自动已读：on [延迟] | off | status | list", gp.info.Name, gp.handleGhost)
+	logger.Infof("Ghost commands registered successfully")
+	return nil
+}
+
+// RegisterEventHandlers 实现EventPlugin接口，监听收到的消息
+func (gp *GhostPlugin) RegisterEventHandlers(dispatcher *core.EventDispatcher) error {
+	return dispatcher.RegisterMessageListenerWithFilter("ghost_read", "", gp.handleIncoming, 90, core.ListenerFilter{Incoming: true})
+}
+
+// handleRead 把当前对话中到命令消息为止的消息标记为已读
+func (gp *GhostPlugin) handleRead(ctx *command.CommandContext) error {
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return gp.sendResponse(ctx, fmt.Sprintf("❌ 无法解析当前对话: %v", err))
+	}
+	if err := gp.markRead(ctx.Context, ctx.API, peer, ctx.Message.ChatID, ctx.Message.Message.ID); err != nil {
+		return gp.sendResponse(ctx, fmt.Sprintf("❌ 标记已读失败: %v", err))
+	}
+	return gp.sendResponse(ctx, "✅ 已将当前对话标记为已读")
+}
+
+// handleGhost 处理ghost命令
+func (gp *GhostPlugin) handleGhost(ctx *command.CommandContext) error {
+	if len(ctx.Args) == 0 {
+		return gp.sendResponse(ctx, gp.helpText())
+	}
+
+	chatID := ctx.Message.ChatID
+	switch ctx.Args[0] {
+	case "on":
+		delay := ghostDefaultDelay
+		if len(ctx.Args) > 1 {
+			d, err := parseWindowDuration(ctx.Args[1])
+			if err != nil || d < 0 || d > ghostMaxDelay {
+				return gp.sendResponse(ctx, fmt.Sprintf("❌ 无效的延迟: %s，应在 0s 到 %s 之间", ctx.Args[1], formatTTL(ghostMaxDelay)))
+			}
+			delay = d.Truncate(time.Second)
+		}
+		if err := gp.enable(chatID, delay); err != nil {
+			return gp.sendResponse(ctx, fmt.Sprintf("❌ 开启自动已读失败: %v", err))
+		}
+		return gp.sendResponse(ctx, fmt.Sprintf("👻 已开启自动已读，此对话收到的消息将在 %s 后标记为已读", formatTTL(delay)))
+	case "off":
+		wasOn, err := gp.disable(chatID)
+		if err != nil {
+			return gp.sendResponse(ctx, fmt.Sprintf("❌ 关闭自动已读失败: %v", err))
+		}
+		if !wasOn {
+			return gp.sendResponse(ctx, "此对话未开启自动已读")
+		}
+		return gp.sendResponse(ctx, "✅ 已关闭自动已读")
+	case "status":
+		gp.mutex.Lock()
+		delay, ok := gp.chats[chatID]
+		gp.mutex.Unlock()
+		if !ok {
+			return gp.sendResponse(ctx, "自动已读: 未开启")
+		}
+		return gp.sendResponse(ctx, fmt.Sprintf("👻 自动已读: 已开启\n延迟: %s", formatTTL(delay)))
+	case "list":
+		return gp.sendResponse(ctx, gp.listChats())
+	}
+	return gp.sendResponse(ctx, gp.helpText())
+}
+
+// enable 开启对话的自动已读，已开启时更新延迟
+func (gp *GhostPlugin) enable(chatID int64, delay time.Duration) error {
+	_, err := storage.Exec(gp.db, `INSERT INTO ghost_chats (chat_id, delay_seconds, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(chat_id) DO UPDATE SET delay_seconds = excluded.delay_seconds`,
+		chatID, int64(delay/time.Second), time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	gp.mutex.Lock()
+	gp.chats[chatID] = delay
+	gp.mutex.Unlock()
+	return nil
+}
+
+// disable 关闭对话的自动已读并取消等待中的标记，未开启时返回false
+func (gp *GhostPlugin) disable(chatID int64) (bool, error) {
+	result, err := storage.Exec(gp.db, "DELETE FROM ghost_chats WHERE chat_id = ?", chatID)
+	if err != nil {
+		return false, err
+	}
+
+	gp.mutex.Lock()
+	_, wasOn := gp.chats[chatID]
+	delete(gp.chats, chatID)
+	if p, ok := gp.pending[chatID]; ok {
+		p.timer.Stop()
+		delete(gp.pending, chatID)
+	}
+	gp.mutex.Unlock()
+
+	if n, _ := result.RowsAffected(); n > 0 {
+		wasOn = true
+	}
+	return wasOn, nil
+}
+
+// listChats 列出开启自动已读的对话
+func (gp *GhostPlugin) listChats() string {
+	gp.mutex.Lock()
+	ids := make([]int64, 0, len(gp.chats))
+	for chatID := range gp.chats {
+		ids = append(ids, chatID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("👻 开启自动已读的对话 (%d):\n", len(ids)))
+	for _, chatID := range ids {
+		b.WriteString(fmt.Sprintf("\n• %d - 延迟 %s", chatID, formatTTL(gp.chats[chatID])))
+	}
+	gp.mutex.Unlock()
+
+	if len(ids) == 0 {
+		return "👻 没有开启自动已读的对话"
+	}
+	return b.String()
+}
+
+// handleIncoming 开启自动已读的对话收到消息时安排标记已读。
+// 延迟内连续收到的消息合并为一次请求，标记到其中最新的消息为止
+func (gp *GhostPlugin) handleIncoming(ctx context.Context, event interface{}) error {
+	msgEvent, ok := event.(*core.MessageEvent)
+	if !ok || msgEvent.Message == nil || gp.telegramAPI == nil || gp.peerResolver == nil {
+		return nil
+	}
+	chatID := msgEvent.ChatID
+
+	gp.mutex.Lock()
+	defer gp.mutex.Unlock()
+	delay, enabled := gp.chats[chatID]
+	if !enabled {
+		return nil
+	}
+	if p, ok := gp.pending[chatID]; ok {
+		p.maxID = max(p.maxID, msgEvent.Message.ID)
+		return nil
+	}
+	gp.pending[chatID] = &ghostPending{
+		timer: time.AfterFunc(delay, func() { gp.flush(chatID) }),
+		maxID: msgEvent.Message.ID,
+	}
+	return nil
+}
+
+// flush 把对话中等待的消息标记为已读
+func (gp *GhostPlugin) flush(chatID int64) {
+	gp.mutex.Lock()
+	p, ok := gp.pending[chatID]
+	delete(gp.pending, chatID)
+	gp.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ghostReadTimeout)
+	defer cancel()
+	peer, err := gp.peerResolver.ResolveFromChatID(ctx, chatID)
+	if err != nil {
+		logger.Warnf("Failed to resolve peer for ghost read in chat %d: %v", chatID, err)
+		return
+	}
+	if err := gp.markRead(ctx, gp.telegramAPI, peer, chatID, p.maxID); err != nil {
+		logger.Warnf("Failed to mark chat %d as read up to %d: %v", chatID, p.maxID, err)
+		return
+	}
+	logger.Debugf("Ghost marked chat %d as read up to message %d", chatID, p.maxID)
+}
+
+// markRead 把对话中到maxID为止的消息标记为已读，频道和超级群使用 channels.readHistory
+func (gp *GhostPlugin) markRead(ctx context.Context, api *tg.Client, peer tg.InputPeerClass, chatID int64, maxID int) error {
+	read := func() error {
+		switch p := peer.(type) {
+		case *tg.InputPeerChannel:
+			_, err := api.ChannelsReadHistory(ctx, &tg.ChannelsReadHistoryRequest{
+				Channel: &tg.InputChannel{ChannelID: p.ChannelID, AccessHash: p.AccessHash},
+				MaxID:   maxID,
+			})
+			return err
+		case *tg.InputPeerUser, *tg.InputPeerChat, *tg.InputPeerSelf:
+			_, err := api.MessagesReadHistory(ctx, &tg.MessagesReadHistoryRequest{
+				Peer:  peer,
+				MaxID: maxID,
+			})
+			return err
+		default:
+			return fmt.Errorf("不支持的对话类型")
+		}
+	}
+
+	if goManager, ok := gp.manager.(*GoManager); ok {
+		if limiter := goManager.GetFloodLimiter(); limiter != nil {
+			return limiter.Retry(ctx, chatID, read)
+		}
+	}
+	return read()
+}
+
+// helpText 返回帮助信息
+func (gp *GhostPlugin) helpText() string {
+	return fmt.Sprintf(`👻 已读管理
+
+• .read - 把当前对话标记为已读
+• .ghost on [延迟] - 开启自动已读，收到的消息在延迟后标记为已读，默认 %s，例如 0s、30s、5m
+• .ghost off - 关闭当前对话的自动已读
+• .ghost status - 查看当前对话的自动已读状态
+• .ghost list - 列出开启自动已读的对话
+
+延迟内连续收到的多条消息只发送一次已读请求，延迟最长 %s。`, formatTTL(ghostDefaultDelay), formatTTL(ghostMaxDelay))
+}
+
+// sendResponse 发送响应消息
+func (gp *GhostPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,466 @@
+package plugin
+
+import (
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/capability"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// savedGifsCacheTTL 已保存GIF列表的缓存时间
+const savedGifsCacheTTL = 10 * time.Minute
+
+// defaultGifInlineBot 默认的GIF内联机器人
+const defaultGifInlineBot = "gif"
+
+// GifPlugin GIF搜索与发送插件
+type GifPlugin struct {
+	*BasePlugin
+	db *sql.DB
+
+	// 已保存GIF缓存
+	savedGifs   []*tg.Document
+	savedGifsAt time.Time
+	cacheMutex  sync.Mutex
+}
+
+// NewGifPlugin 创建GIF插件
+func NewGifPlugin(db *sql.DB) *GifPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "gif",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "搜索已保存的GIF并通过内联机器人回退发送",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &GifPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+
+	return plugin
+}
+
+// initDatabase 初始化数据库表
+func (gp *GifPlugin) initDatabase() {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS gif_config (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`
+
+	_, err := gp.db.Exec(createTableSQL)
+	if err != nil {
+		logger.Errorf("Failed to create gif_config table: %v", err)
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (gp *GifPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("gif", "搜索并发送GIF", gp.info.Name, gp.handleGif)
+	logger.Infof("Gif commands registered successfully")
+	return nil
+}
+
+// Capabilities 实现CapabilityPlugin接口，声明内联机器人和已保存GIF接口
+func (gp *GifPlugin) Capabilities() []capability.Requirement {
+	return []capability.Requirement{
+		capability.Require((*tg.Client)(nil), "MessagesGetInlineBotResults", "MessagesSendInlineBotResult", "MessagesSaveGif", "MessagesGetSavedGifs"),
+		capability.Require(tg.MessagesSendInlineBotResultRequest{}, "Peer", "QueryID", "ID", "RandomID"),
+		capability.Require(tg.MessagesSaveGifRequest{}, "ID", "Unsave"),
+	}
+}
+
+// handleGif 处理gif命令
+func (gp *GifPlugin) handleGif(ctx *command.CommandContext) error {
+	// 先取出 --n，避免 "--n 2" 中的序号留在关键词中
+	n, err := ctx.FlagInt("n", 0)
+	if err != nil || n < 0 {
+		return gp.sendResponse(ctx, "❌ --n 需要一个正整数，例如 .gif --n=2 cat")
+	}
+	if len(ctx.Args) == 0 {
+		return gp.sendResponse(ctx, gifUsage)
+	}
+
+	switch ctx.Args[0] {
+	case "save":
+		return gp.handleSave(ctx)
+	case "bot":
+		return gp.handleBot(ctx)
+	}
+
+	index, query := parseGifArgs(ctx.Args)
+	if n > 0 {
+		index = n - 1
+	}
+	return gp.handleSearch(ctx, query, index)
+}
+
+// gifUsage gif命令的用法
+const gifUsage = "用法: .gif [#序号] <关键词> | .gif --n=<序号> <关键词> | .gif save | .gif bot [用户名]"
+
+// parseGifArgs 解析参数，返回结果序号(从0开始)和搜索关键词。
+// 序号需要明确标记："#3" 写在关键词的第一个或最后一个词，如 ".gif #3 cat" 或 ".gif cat #3"；
+// 也可以使用 --n=3(由 handleGif 读取)。没有标记的数字是关键词的一部分，如 ".gif 2012"
+func parseGifArgs(args []string) (int, string) {
+	index := 0
+	words := args
+
+	if len(words) > 0 {
+		if n, ok := gifIndexMarker(words[0]); ok {
+			index = n - 1
+			words = words[1:]
+		} else if n, ok := gifIndexMarker(words[len(words)-1]); ok {
+			index = n - 1
+			words = words[:len(words)-1]
+		}
+	}
+
+	return index, strings.Join(words, " ")
+}
+
+// gifIndexMarker 解析 "#3" 形式的序号标记
+func gifIndexMarker(word string) (int, bool) {
+	digits, ok := strings.CutPrefix(word, "#")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// handleSearch 先搜索已保存的GIF，未命中时回退到内联机器人
+func (gp *GifPlugin) handleSearch(ctx *command.CommandContext, query string, index int) error {
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+
+	replyTo := replyTargetFromContext(ctx)
+
+	// 1. 已保存的GIF
+	saved, err := gp.getSavedGifs(ctx)
+	if err != nil {
+		logger.Warnf("获取已保存GIF失败: %v", err)
+	}
+	if doc := selectGif(matchSavedGifs(saved, query), index); doc != nil {
+		_, err = ctx.API.MessagesSendMedia(ctx.Context, &tg.MessagesSendMediaRequest{
+			Peer: peer,
+			Media: &tg.InputMediaDocument{
+				ID: &tg.InputDocument{
+					ID:            doc.ID,
+					AccessHash:    doc.AccessHash,
+					FileReference: doc.FileReference,
+				},
+			},
+			RandomID: time.Now().UnixNano(),
+			ReplyTo:  replyTo,
+		})
+		if err != nil {
+			return gp.sendResponse(ctx, gp.friendlyErrorMessage(err))
+		}
+		gp.cleanupCommand(ctx, peer)
+		return nil
+	}
+
+	// 2. 内联机器人回退
+	if query == "" {
+		return gp.sendResponse(ctx, "未找到已保存的GIF，请提供关键词")
+	}
+
+	if err := gp.sendInlineResult(ctx, peer, query, index, replyTo); err != nil {
+		return gp.sendResponse(ctx, gp.friendlyErrorMessage(err))
+	}
+	gp.cleanupCommand(ctx, peer)
+	return nil
+}
+
+// sendInlineResult 通过内联机器人搜索并发送第index个结果
+func (gp *GifPlugin) sendInlineResult(ctx *command.CommandContext, peer tg.InputPeerClass, query string, index int, replyTo tg.InputReplyToClass) error {
+	botName := gp.getInlineBot()
+
+	resolved, err := ctx.API.ContactsResolveUsername(ctx.Context, &tg.ContactsResolveUsernameRequest{
+		Username: botName,
+	})
+	if err != nil {
+		return fmt.Errorf("解析内联机器人 @%s 失败: %w", botName, err)
+	}
+
+	var bot *tg.InputUser
+	for _, u := range resolved.Users {
+		if user, ok := u.(*tg.User); ok && user.Bot {
+			bot = &tg.InputUser{UserID: user.ID, AccessHash: user.AccessHash}
+			break
+		}
+	}
+	if bot == nil {
+		return fmt.Errorf("@%s 不是机器人", botName)
+	}
+
+	results, err := ctx.API.MessagesGetInlineBotResults(ctx.Context, &tg.MessagesGetInlineBotResultsRequest{
+		Bot:   bot,
+		Peer:  peer,
+		Query: query,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(results.Results) == 0 {
+		return fmt.Errorf("没有找到与 \"%s\" 相关的GIF", query)
+	}
+	if index >= len(results.Results) {
+		index = len(results.Results) - 1
+	}
+
+	_, err = ctx.API.MessagesSendInlineBotResult(ctx.Context, &tg.MessagesSendInlineBotResultRequest{
+		Peer:     peer,
+		ReplyTo:  replyTo,
+		RandomID: time.Now().UnixNano(),
+		QueryID:  results.QueryID,
+		ID:       results.Results[index].GetID(),
+	})
+	return err
+}
+
+// handleSave 将回复的GIF保存到已保存GIF
+func (gp *GifPlugin) handleSave(ctx *command.CommandContext) error {
+	if ctx.Message.Message.ReplyTo == nil {
+		return gp.sendResponse(ctx, "请回复一个GIF。")
+	}
+
+	replyMsg, err := fetchReplyMessage(ctx)
+	if err != nil {
+		return gp.sendResponse(ctx, fmt.Sprintf("获取回复消息失败: %v", err))
+	}
+
+	doc := gifDocumentFromMessage(replyMsg)
+	if doc == nil {
+		return gp.sendResponse(ctx, "回复的消息不是GIF。")
+	}
+
+	// 已达到当前账号的上限时，Telegram会移除最早保存的GIF
+	notice := ""
+	if saved, err := gp.getSavedGifs(ctx); err == nil {
+		limits := currentLimits()
+		if len(saved) >= limits.SavedGifCap {
+			notice = fmt.Sprintf("\n⚠️ 已达到已保存GIF上限 %d 个，最早保存的GIF将被移除", limits.SavedGifCap)
+			if !accountPremium.Load() {
+				notice += fmt.Sprintf("(Premium上限 %d 个)", premiumLimits.SavedGifCap)
+			}
+		}
+	}
+
+	_, err = ctx.API.MessagesSaveGif(ctx.Context, &tg.MessagesSaveGifRequest{
+		ID: &tg.InputDocument{
+			ID:            doc.ID,
+			AccessHash:    doc.AccessHash,
+			FileReference: doc.FileReference,
+		},
+		Unsave: false,
+	})
+	if err != nil {
+		return gp.sendResponse(ctx, fmt.Sprintf("保存GIF失败: %v", err))
+	}
+
+	// 使缓存失效
+	gp.cacheMutex.Lock()
+	gp.savedGifs = nil
+	gp.savedGifsAt = time.Time{}
+	gp.cacheMutex.Unlock()
+
+	return gp.sendResponse(ctx, "✅ GIF已保存"+notice)
+}
+
+// handleBot 查看或设置内联机器人
+func (gp *GifPlugin) handleBot(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return gp.sendResponse(ctx, fmt.Sprintf("当前内联机器人: @%s", gp.getInlineBot()))
+	}
+
+	botName := strings.TrimPrefix(ctx.Args[1], "@")
+	if _, err := gp.db.Exec("INSERT OR REPLACE INTO gif_config (key, value) VALUES (?, ?)", "inline_bot", botName); err != nil {
+		return gp.sendResponse(ctx, fmt.Sprintf("保存配置失败: %v", err))
+	}
+
+	return gp.sendResponse(ctx, fmt.Sprintf("✅ 内联机器人已设置为 @%s", botName))
+}
+
+// getInlineBot 获取配置的内联机器人用户名
+func (gp *GifPlugin) getInlineBot() string {
+	var value string
+	err := gp.db.QueryRow("SELECT value FROM gif_config WHERE key = ?", "inline_bot").Scan(&value)
+	if err != nil || value == "" {
+		return defaultGifInlineBot
+	}
+	return value
+}
+
+// getSavedGifs 获取已保存的GIF列表，结果缓存10分钟
+func (gp *GifPlugin) getSavedGifs(ctx *command.CommandContext) ([]*tg.Document, error) {
+	gp.cacheMutex.Lock()
+	defer gp.cacheMutex.Unlock()
+
+	if gp.savedGifs != nil && time.Since(gp.savedGifsAt) < savedGifsCacheTTL {
+		return gp.savedGifs, nil
+	}
+
+	result, err := ctx.API.MessagesGetSavedGifs(ctx.Context, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, ok := result.(*tg.MessagesSavedGifs)
+	if !ok {
+		// MessagesSavedGifsNotModified，继续使用旧缓存
+		gp.savedGifsAt = time.Now()
+		return gp.savedGifs, nil
+	}
+
+	docs := make([]*tg.Document, 0, len(saved.Gifs))
+	for _, g := range saved.Gifs {
+		if doc, ok := g.(*tg.Document); ok {
+			docs = append(docs, doc)
+		}
+	}
+
+	gp.savedGifs = docs
+	gp.savedGifsAt = time.Now()
+	logger.Debugf("Cached %d saved GIFs", len(docs))
+
+	return docs, nil
+}
+
+// matchSavedGifs 使用可用的替代文本对已保存GIF做模糊匹配，空关键词匹配全部
+func matchSavedGifs(docs []*tg.Document, query string) []*tg.Document {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return docs
+	}
+
+	words := strings.Fields(query)
+	var matched []*tg.Document
+	for _, doc := range docs {
+		alt := strings.ToLower(gifAltText(doc))
+		if alt == "" {
+			continue
+		}
+
+		ok := true
+		for _, w := range words {
+			if !strings.Contains(alt, w) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, doc)
+		}
+	}
+
+	return matched
+}
+
+// selectGif 选择第index个结果，超出范围时取最后一个，没有结果返回nil
+func selectGif(docs []*tg.Document, index int) *tg.Document {
+	if len(docs) == 0 {
+		return nil
+	}
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(docs) {
+		index = len(docs) - 1
+	}
+	return docs[index]
+}
+
+// gifAltText 收集文档上可用的替代文本
+func gifAltText(doc *tg.Document) string {
+	var parts []string
+	for _, attr := range doc.Attributes {
+		switch a := attr.(type) {
+		case *tg.DocumentAttributeFilename:
+			parts = append(parts, a.FileName)
+		case *tg.DocumentAttributeSticker:
+			parts = append(parts, a.Alt)
+		case *tg.DocumentAttributeCustomEmoji:
+			parts = append(parts, a.Alt)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// gifDocumentFromMessage 从消息中提取GIF文档
+func gifDocumentFromMessage(msg *tg.Message) *tg.Document {
+	if msg == nil || msg.Media == nil {
+		return nil
+	}
+
+	media, ok := msg.Media.(*tg.MessageMediaDocument)
+	if !ok {
+		return nil
+	}
+
+	doc, ok := media.Document.(*tg.Document)
+	if !ok {
+		return nil
+	}
+
+	for _, attr := range doc.Attributes {
+		if _, ok := attr.(*tg.DocumentAttributeAnimated); ok {
+			return doc
+		}
+	}
+	if doc.MimeType == "image/gif" {
+		return doc
+	}
+
+	return nil
+}
+
+// cleanupCommand 发送成功后删除命令消息
+func (gp *GifPlugin) cleanupCommand(ctx *command.CommandContext, peer tg.InputPeerClass) {
+	if err := deleteCommandMessage(ctx, peer); err != nil {
+		logger.Warnf("删除命令消息失败: %v", err)
+	}
+}
+
+// friendlyErrorMessage 将常见错误转换为友好提示
+func (gp *GifPlugin) friendlyErrorMessage(err error) string {
+	errStr := err.Error()
+	if strings.Contains(errStr, "BOT_INLINE_DISABLED") || strings.Contains(errStr, "CHAT_SEND_INLINE_FORBIDDEN") {
+		return "❌ 当前对话不允许使用内联机器人"
+	}
+	if strings.Contains(errStr, "CHAT_SEND_GIFS_FORBIDDEN") {
+		return "❌ 当前对话不允许发送GIF"
+	}
+	if strings.Contains(errStr, "USERNAME_NOT_OCCUPIED") || strings.Contains(errStr, "USERNAME_INVALID") {
+		return fmt.Sprintf("❌ 内联机器人 @%s 不存在，请使用 .gif bot <用户名> 重新设置", gp.getInlineBot())
+	}
+	return fmt.Sprintf("❌ 发送GIF失败: %v", err)
+}
+
+// sendResponse 发送响应消息，命令消息不可编辑时回复命令消息
+func (gp *GifPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,213 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+func TestParseGifArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		index int
+		query string
+	}{
+		{"plain query", []string{"cat"}, 0, "cat"},
+		{"leading marker", []string{"#3", "cat", "dance"}, 2, "cat dance"},
+		{"trailing marker", []string{"cat", "#2"}, 1, "cat"},
+		{"marker only", []string{"#4"}, 3, ""},
+		{"bare number is a query", []string{"2012"}, 0, "2012"},
+		{"leading bare number is a query", []string{"3", "cat"}, 0, "3 cat"},
+		{"trailing bare number is a query", []string{"happy", "2024"}, 0, "happy 2024"},
+		{"hashtag is a query", []string{"#cat"}, 0, "#cat"},
+		{"zero marker is a query", []string{"#0", "cat"}, 0, "#0 cat"},
+		{"negative marker is a query", []string{"cat", "#-1"}, 0, "cat #-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, query := parseGifArgs(tt.args)
+			if index != tt.index || query != tt.query {
+				t.Errorf("parseGifArgs(%q) = %d, %q; want %d, %q", tt.args, index, query, tt.index, tt.query)
+			}
+		})
+	}
+}
+
+func TestSelectGif(t *testing.T) {
+	docs := []*tg.Document{{ID: 1}, {ID: 2}, {ID: 3}}
+	for index, want := range map[int]int64{-1: 1, 0: 1, 1: 2, 2: 3, 10: 3} {
+		if got := selectGif(docs, index); got.ID != want {
+			t.Errorf("selectGif(%d) = %d, want %d", index, got.ID, want)
+		}
+	}
+	if selectGif(nil, 0) != nil {
+		t.Error("selectGif without results should return nil")
+	}
+}
+
+func gifDoc(id int64, name string) *tg.Document {
+	return &tg.Document{ID: id, Attributes: []tg.DocumentAttributeClass{&tg.DocumentAttributeFilename{FileName: name}}}
+}
+
+func TestMatchSavedGifs(t *testing.T) {
+	docs := []*tg.Document{gifDoc(1, "Cat_Dance.mp4"), gifDoc(2, "dog.mp4"), {ID: 3}, gifDoc(4, "cat-sleep.mp4")}
+	ids := func(docs []*tg.Document) []int64 {
+		var out []int64
+		for _, d := range docs {
+			out = append(out, d.ID)
+		}
+		return out
+	}
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"", []int64{1, 2, 3, 4}},
+		{"cat", []int64{1, 4}},
+		{"CAT dance", []int64{1}},
+		{"bird", nil},
+	}
+	for _, tt := range tests {
+		got := ids(matchSavedGifs(docs, tt.query))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("matchSavedGifs(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// newGifEnv 创建gif插件的测试环境：已保存 saved，内联机器人返回 inline 个结果
+func newGifEnv(t *testing.T, saved []tg.DocumentClass, inline int) *testEnv {
+	t.Helper()
+	env := newTestEnv()
+	gp := NewGifPlugin(openPluginDB(t))
+	if err := gp.RegisterCommands(env.parser); err != nil {
+		t.Fatal(err)
+	}
+	env.inv.handle = func(input bin.Encoder, output bin.Decoder) error {
+		switch o := output.(type) {
+		case *tg.MessagesSavedGifsBox:
+			o.SavedGifs = &tg.MessagesSavedGifs{Gifs: saved}
+		case *tg.ContactsResolvedPeer:
+			o.Peer = &tg.PeerUser{UserID: 99}
+			o.Users = []tg.UserClass{&tg.User{ID: 99, AccessHash: 7, Bot: true, Username: "gif"}}
+		case *tg.MessagesBotResults:
+			o.QueryID = 555
+			for i := 0; i < inline; i++ {
+				o.Results = append(o.Results, &tg.BotInlineResult{ID: string(rune('a' + i)), Type: "gif"})
+			}
+		default:
+			return errUnhandled
+		}
+		return nil
+	}
+	return env
+}
+
+func sentSavedGif(t *testing.T, env *testEnv) int64 {
+	t.Helper()
+	sent := requests[*tg.MessagesSendMediaRequest](env.inv)
+	if len(sent) != 1 {
+		t.Fatalf("got %d sendMedia requests, want 1", len(sent))
+	}
+	return sent[0].Media.(*tg.InputMediaDocument).ID.(*tg.InputDocument).ID
+}
+
+func TestGifPrefersSavedGifs(t *testing.T) {
+	saved := []tg.DocumentClass{gifDoc(1, "cat-a.mp4"), gifDoc(2, "cat-b.mp4"), gifDoc(3, "dog.mp4")}
+	tests := []struct {
+		command string
+		want    int64
+	}{
+		{"gif cat", 1},
+		{"gif #2 cat", 2},
+		{"gif cat #2", 2},
+		{"gif --n=2 cat", 2},
+		{"gif --n 2 cat", 2},
+		{"gif #9 cat", 2}, // 超出范围时取最后一个
+		{"gif #3", 3},     // 没有关键词时按序号选择已保存的GIF
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			env := newGifEnv(t, saved, 3)
+			if _, err := env.run(nil, tt.command); err != nil {
+				t.Fatal(err)
+			}
+			if got := sentSavedGif(t, env); got != tt.want {
+				t.Errorf("sent saved GIF %d, want %d", got, tt.want)
+			}
+			if n := len(requests[*tg.MessagesGetInlineBotResultsRequest](env.inv)); n != 0 {
+				t.Errorf("queried the inline bot %d times although a saved GIF matched", n)
+			}
+			if n := len(requests[*tg.MessagesDeleteMessagesRequest](env.inv)); n != 1 {
+				t.Errorf("command message deleted %d times, want 1", n)
+			}
+		})
+	}
+}
+
+func TestGifFallsBackToInlineBot(t *testing.T) {
+	saved := []tg.DocumentClass{gifDoc(1, "dog.mp4")}
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"gif cat", "a"},
+		{"gif #2 cat", "b"},
+		{"gif 2012", "a"}, // 没有标记的数字作为关键词
+		{"gif #9 cat", "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			env := newGifEnv(t, saved, 3)
+			if _, err := env.run(nil, tt.command); err != nil {
+				t.Fatal(err)
+			}
+			queries := requests[*tg.MessagesGetInlineBotResultsRequest](env.inv)
+			if len(queries) != 1 {
+				t.Fatalf("got %d inline queries, want 1", len(queries))
+			}
+			_, wantQuery := parseGifArgs(strings.Fields(tt.command)[1:])
+			if queries[0].Query != wantQuery {
+				t.Errorf("inline query = %q, want %q", queries[0].Query, wantQuery)
+			}
+			sent := requests[*tg.MessagesSendInlineBotResultRequest](env.inv)
+			if len(sent) != 1 || sent[0].ID != tt.want || sent[0].QueryID != 555 {
+				t.Fatalf("sent inline results %+v, want ID %q", sent, tt.want)
+			}
+			if n := len(requests[*tg.MessagesSendMediaRequest](env.inv)); n != 0 {
+				t.Errorf("sent %d saved GIFs, want none", n)
+			}
+		})
+	}
+}
+
+func TestGifErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		saved   []tg.DocumentClass
+		inline  int
+		want    string
+	}{
+		{"no saved gifs and no query", "gif #2", nil, 3, "未找到已保存的GIF"},
+		{"no inline results", "gif cat", nil, 0, "没有找到"},
+		{"invalid --n", "gif --n=x cat", nil, 3, "--n 需要一个正整数"},
+		{"usage", "gif --n=2", nil, 3, "用法"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newGifEnv(t, tt.saved, tt.inline)
+			out, err := env.run(nil, tt.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out == nil || !strings.Contains(out.Text, tt.want) {
+				t.Errorf("response = %+v, want it to contain %q", out, tt.want)
+			}
+		})
+	}
+}
@@ -4,11 +4,30 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"nexusvalet/internal/capability"
+	"nexusvalet/internal/chatscope"
 	"nexusvalet/internal/command"
+	"nexusvalet/internal/config"
 	"nexusvalet/internal/core"
+	"nexusvalet/internal/deletion"
+	"nexusvalet/internal/deprecation"
+	"nexusvalet/internal/download"
+	"nexusvalet/internal/ephemeral"
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/maintenance"
+	"nexusvalet/internal/marketplace"
+	"nexusvalet/internal/mediacompress"
 	"nexusvalet/internal/peers"
+	"nexusvalet/internal/secrets"
+	"nexusvalet/internal/selftest"
+	"nexusvalet/internal/storage"
+	"nexusvalet/internal/sudo"
 	"nexusvalet/pkg/logger"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gotd/td/tg"
 )
@@ -21,17 +40,84 @@ type GoManager struct {
 	hookManager  *core.HookManager
 	db           *sql.DB
 	peerResolver *peers.Resolver
+	maintenance  *maintenance.Gate
+	marketplace  *marketplace.Store
+	pluginsDir   string
+	secrets      *secrets.Store
+	storage      *storage.Store
+	selfTest     *selftest.Report
+	capabilities *capability.Report
+	tasks        *core.TaskRunner
+	deletions    *deletion.Scheduler
+	ephemeral    *ephemeral.Tracker
+	deprecations *deprecation.Registry
+	flood        *flood.Limiter
+	chatScope    *chatscope.Registry
+	sudo         *sudo.Registry
+	initTimes    map[string]time.Duration  // 连接前初始化耗时
+	inits        map[string]*pluginInit    // 连接后初始化的插件
+	handlers     map[string]pluginHandlers // 插件注册的监听器和钩子
+	panics       map[string][]time.Time    // 插件最近的panic时间
+	crashed      map[string]bool           // 因多次panic被自动停用的插件
+	panicMutex   sync.Mutex
+	stop         chan bool // .restart/.shutdown 的停止请求，true 表示停止后重新启动
+	initCtx      context.Context
+	startup      *core.StartupReport
+	client       *tg.Client
+	configPath   string
+	config       *config.Config // 当前生效的配置，.config reload 时替换
 	mutex        sync.RWMutex
+	reloadMutex  sync.Mutex // 同一时间只重新加载一个插件
 }
 
 // NewGoManager 创建一个新的Go插件管理器
 func NewGoManager(parser *command.Parser, dispatcher *core.EventDispatcher, hookManager *core.HookManager, db *sql.DB) *GoManager {
 	manager := &GoManager{
-		plugins:     make(map[string]Plugin),
-		parser:      parser,
-		dispatcher:  dispatcher,
-		hookManager: hookManager,
-		db:          db,
+		plugins:      make(map[string]Plugin),
+		parser:       parser,
+		dispatcher:   dispatcher,
+		hookManager:  hookManager,
+		db:           db,
+		maintenance:  maintenance.NewGate(db),
+		tasks:        core.NewTaskRunner(),
+		deletions:    deletion.NewScheduler(db),
+		deprecations: deprecation.NewRegistry(db),
+		flood:        flood.NewLimiter(flood.DefaultOptions()),
+		chatScope:    chatscope.NewRegistry(db),
+		sudo:         sudo.NewRegistry(db),
+		storage:      storage.NewStore(db),
+		initTimes:    make(map[string]time.Duration),
+		inits:        make(map[string]*pluginInit),
+		handlers:     make(map[string]pluginHandlers),
+		panics:       make(map[string][]time.Time),
+		crashed:      make(map[string]bool),
+		stop:         make(chan bool, 1),
+	}
+	manager.ephemeral = ephemeral.NewTracker(db, manager.deletions)
+	parser.SetDeprecations(manager.deprecations)
+	parser.SetFloodLimiter(manager.flood)
+	parser.SetDeletionScheduler(manager.deletions)
+	parser.SetChatScope(manager.chatScope)
+	parser.SetPanicHandler(manager.handlePanic)
+	dispatcher.SetPanicHandler(manager.handlePanic)
+	hookManager.SetPanicHandler(manager.handlePanic)
+
+	// 命令执行前确保所属插件已完成连接后的初始化
+	hookManager.RegisterHook(core.BeforeCommand, "plugin_lazy_init", manager.lazyInitHook, 1000)
+
+	// 启动维护窗口检查
+	manager.maintenance.Run()
+
+	// 初始化密钥库并登记需要迁移的明文密钥
+	if store, err := secrets.NewStore(db); err != nil {
+		logger.Errorf("Failed to initialize secret store: %v", err)
+	} else {
+		for _, ls := range legacySecrets {
+			if err := store.RegisterLegacy(ls); err != nil {
+				logger.Errorf("Failed to register legacy secret %s: %v", ls.Name, err)
+			}
+		}
+		manager.secrets = store
 	}
 
 	logger.Debugf("Go plugin manager initialized")
@@ -53,11 +139,16 @@ func (gm *GoManager) RegisterPlugin(plugin Plugin) error {
 		return fmt.Errorf("plugin %s already registered", pluginName)
 	}
 
-	// 初始化插件
+	// 初始化插件，耗时的工作由 PostConnectPlugin 推迟到连接之后
 	ctx := context.Background()
+	initStart := time.Now()
 	if err := plugin.Initialize(ctx, gm); err != nil {
 		return fmt.Errorf("failed to initialize plugin %s: %w", pluginName, err)
 	}
+	gm.initTimes[pluginName] = time.Since(initStart)
+	if postConnect, ok := plugin.(PostConnectPlugin); ok {
+		gm.inits[pluginName] = &pluginInit{plugin: postConnect, done: make(chan struct{})}
+	}
 
 	// 注册命令
 	if cmdPlugin, ok := plugin.(CommandPlugin); ok {
@@ -66,19 +157,12 @@ func (gm *GoManager) RegisterPlugin(plugin Plugin) error {
 		}
 	}
 
-	// 注册事件处理器
-	if eventPlugin, ok := plugin.(EventPlugin); ok {
-		if err := eventPlugin.RegisterEventHandlers(gm.dispatcher); err != nil {
-			return fmt.Errorf("failed to register event handlers for plugin %s: %w", pluginName, err)
-		}
-	}
-
-	// 注册钩子
-	if hookPlugin, ok := plugin.(HookPlugin); ok {
-		if err := hookPlugin.RegisterHooks(gm.hookManager); err != nil {
-			return fmt.Errorf("failed to register hooks for plugin %s: %w", pluginName, err)
-		}
+	// 注册事件处理器和钩子
+	handlers, err := gm.registerHandlers(pluginName, plugin)
+	if err != nil {
+		return err
 	}
+	gm.handlers[pluginName] = handlers
 
 	gm.plugins[pluginName] = plugin
 	logger.Infof("Plugin %s registered successfully", pluginName)
@@ -104,6 +188,10 @@ func (gm *GoManager) UnregisterPlugin(name string) error {
 	// 从命令解析器中注销命令
 	gm.parser.UnregisterPluginCommands(name)
 
+	// 移除监听器和钩子
+	gm.unregisterHandlers(gm.handlers[name])
+	delete(gm.handlers, name)
+
 	// 删除插件
 	delete(gm.plugins, name)
 
@@ -121,6 +209,14 @@ func (gm *GoManager) EnablePlugin(name string) error {
 		return fmt.Errorf("plugin %s not found", name)
 	}
 
+	if crashed, err := gm.enableCrashed(name, plugin); crashed {
+		if err != nil {
+			return err
+		}
+		logger.Infof("Plugin %s re-enabled after being disabled for panics", name)
+		return nil
+	}
+
 	if plugin.IsEnabled() {
 		return fmt.Errorf("plugin %s is already enabled", name)
 	}
@@ -206,6 +302,9 @@ func (gm *GoManager) Shutdown() error {
 		}
 	}
 
+	gm.maintenance.Stop()
+	gm.deletions.Stop()
+
 	logger.Infof("All plugins shutdown")
 	return nil
 }
@@ -215,6 +314,221 @@ func (gm *GoManager) GetDatabase() *sql.DB {
 	return gm.db
 }
 
+// GetMaintenanceGate 返回维护窗口服务
+func (gm *GoManager) GetMaintenanceGate() *maintenance.Gate {
+	return gm.maintenance
+}
+
+// GetDeletionScheduler 返回持久化的延迟删除服务
+func (gm *GoManager) GetDeletionScheduler() *deletion.Scheduler {
+	return gm.deletions
+}
+
+// GetDeprecations 返回弃用项注册表
+func (gm *GoManager) GetDeprecations() *deprecation.Registry {
+	return gm.deprecations
+}
+
+// GetFloodLimiter 返回按对话的发送频率限制
+func (gm *GoManager) GetFloodLimiter() *flood.Limiter {
+	return gm.flood
+}
+
+// GetChatScope 返回对话级插件开关
+func (gm *GoManager) GetChatScope() *chatscope.Registry {
+	return gm.chatScope
+}
+
+// GetMetrics 获取消息和命令的运行时计数，插件也可以用 Add 记录自己的计数
+func (gm *GoManager) GetMetrics() *core.Metrics {
+	return gm.dispatcher.Metrics()
+}
+
+// GetSudo 返回可以触发命令的sudo用户列表
+func (gm *GoManager) GetSudo() *sudo.Registry {
+	return gm.sudo
+}
+
+// GetEphemeralTracker 返回阅后即焚记录器
+func (gm *GoManager) GetEphemeralTracker() *ephemeral.Tracker {
+	return gm.ephemeral
+}
+
+// SetMarketplace 设置插件索引和插件安装目录
+func (gm *GoManager) SetMarketplace(store *marketplace.Store, pluginsDir string) {
+	gm.marketplace = store
+	gm.pluginsDir = pluginsDir
+}
+
+// GetMarketplace 获取插件索引和插件安装目录
+func (gm *GoManager) GetMarketplace() (*marketplace.Store, string) {
+	return gm.marketplace, gm.pluginsDir
+}
+
+// SelfTestChecks 收集已启用插件提供的自检项
+func (gm *GoManager) SelfTestChecks() []selftest.Check {
+	gm.mutex.RLock()
+	defer gm.mutex.RUnlock()
+
+	var checks []selftest.Check
+	for _, plugin := range gm.plugins {
+		if stPlugin, ok := plugin.(SelfTestPlugin); ok && plugin.IsEnabled() {
+			checks = append(checks, stPlugin.SelfTestChecks()...)
+		}
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+	return checks
+}
+
+// SetSelfTestReport 保存最近一次自检结果
+func (gm *GoManager) SetSelfTestReport(report *selftest.Report) {
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+	gm.selfTest = report
+}
+
+// GetSelfTestReport 获取最近一次自检结果，未执行时返回nil
+func (gm *GoManager) GetSelfTestReport() *selftest.Report {
+	gm.mutex.RLock()
+	defer gm.mutex.RUnlock()
+	return gm.selfTest
+}
+
+// ProbeCapabilities 检查已注册插件声明的API依赖，禁用缺少依赖的插件。
+// 被禁用插件的命令会替换为提示缺失能力的响应，而不是在执行中途出错
+func (gm *GoManager) ProbeCapabilities() *capability.Report {
+	gm.mutex.RLock()
+	var manifests []capability.Manifest
+	for name, plugin := range gm.plugins {
+		if capPlugin, ok := plugin.(CapabilityPlugin); ok {
+			manifests = append(manifests, capability.Manifest{Plugin: name, Requirements: capPlugin.Capabilities()})
+		}
+	}
+	gm.mutex.RUnlock()
+
+	report := capability.Probe(manifests)
+
+	gm.mutex.Lock()
+	gm.capabilities = report
+	gm.mutex.Unlock()
+
+	if report.OK() {
+		logger.Infof("Capability probe passed (%d members checked)", report.Checked)
+		return report
+	}
+
+	logger.Warnf("Capability probe found missing API members:\n%s", report.Summary())
+	for _, name := range report.Affected() {
+		plugin, exists := gm.GetPlugin(name)
+		if !exists {
+			continue
+		}
+		plugin.SetEnabled(false)
+
+		notice := capabilityNotice(name, report.Missing[name])
+		for cmdName, cmd := range gm.parser.GetCommandsByPlugin(name) {
+			gm.parser.RegisterCommand(cmdName, cmd.Description, name, noticeHandler(notice))
+		}
+		logger.Warnf("Plugin %s disabled due to missing API capabilities", name)
+	}
+	return report
+}
+
+// capabilityNotice 返回插件因缺少能力被禁用的提示
+func capabilityNotice(plugin string, missing []capability.Missing) string {
+	items := make([]string, 0, len(missing))
+	for _, m := range missing {
+		items = append(items, m.String())
+	}
+	return fmt.Sprintf("⚠️ 插件 %s 已被禁用：当前gotd版本缺少 %s\n使用 .apt capabilities 查看完整报告", plugin, strings.Join(items, ", "))
+}
+
+// GetCapabilityReport 获取启动时的能力检查结果，未执行时返回nil
+func (gm *GoManager) GetCapabilityReport() *capability.Report {
+	gm.mutex.RLock()
+	defer gm.mutex.RUnlock()
+	return gm.capabilities
+}
+
+// GetTaskRunner 获取长时间任务管理器
+func (gm *GoManager) GetTaskRunner() *core.TaskRunner {
+	return gm.tasks
+}
+
+// taskRunnerFrom 从插件的manager获取任务管理器
+func taskRunnerFrom(manager interface{}) *core.TaskRunner {
+	if gm, ok := manager.(*GoManager); ok {
+		return gm.tasks
+	}
+	return nil
+}
+
+// SetPremium 更新当前账号的Premium状态，决定生效的限制
+func (gm *GoManager) SetPremium(premium bool) {
+	if accountPremium.Swap(premium) != premium {
+		logger.Infof("Account premium status: %v", premium)
+	}
+}
+
+// SetMediaCompression 设置上传前的图片压缩参数
+func (gm *GoManager) SetMediaCompression(opts mediacompress.Options) {
+	mediaCompression.Store(&opts)
+	if opts.Enabled() {
+		logger.Infof("Media compression enabled: %s (jpeg quality %d, max dimension %d)", opts.Level, opts.JPEGQuality, opts.MaxDimension)
+	}
+}
+
+// SetDownloader 设置插件下载文件使用的下载器
+func (gm *GoManager) SetDownloader(d *download.Downloader) {
+	mediaDownloader.Store(d)
+}
+
+// SetDmeStatusDelay 设置 .dme 删除完成后结果的显示时间，为负数时不显示
+func (gm *GoManager) SetDmeStatusDelay(d time.Duration) {
+	dmeStatusDelay.Store(int64(d))
+}
+
+// botMode 是否以机器人账号运行，机器人不能使用 dme、sb 删除历史等需要用户账号的功能
+var botMode atomic.Bool
+
+// SetBotMode 设置是否以机器人账号运行
+func (gm *GoManager) SetBotMode(enabled bool) {
+	botMode.Store(enabled)
+}
+
+// IsBotMode 是否以机器人账号运行
+func (gm *GoManager) IsBotMode() bool {
+	return botMode.Load()
+}
+
+// IsPremium 当前账号是否为Premium
+func (gm *GoManager) IsPremium() bool {
+	return accountPremium.Load()
+}
+
+// GetSecretStore 获取密钥库
+func (gm *GoManager) GetSecretStore() *secrets.Store {
+	return gm.secrets
+}
+
+// RequestStop 请求停止程序，restart 为true时停止后重新启动。已有未处理的请求时忽略
+func (gm *GoManager) RequestStop(restart bool) {
+	select {
+	case gm.stop <- restart:
+	default:
+	}
+}
+
+// StopRequests 返回 RequestStop 发出的停止请求
+func (gm *GoManager) StopRequests() <-chan bool {
+	return gm.stop
+}
+
+// GetStorage 获取插件共用的键值存储
+func (gm *GoManager) GetStorage() *storage.Store {
+	return gm.storage
+}
+
 // SetPeerResolver 设置Peer解析器
 func (gm *GoManager) SetPeerResolver(peerResolver *peers.Resolver) {
 	gm.peerResolver = peerResolver
@@ -222,37 +536,105 @@ func (gm *GoManager) SetPeerResolver(peerResolver *peers.Resolver) {
 
 // SetTelegramClient 为所有支持的插件设置Telegram客户端
 func (gm *GoManager) SetTelegramClient(client *tg.Client) {
+	// 记录客户端，重新加载插件时重新注入
+	gm.mutex.Lock()
+	gm.client = client
+	gm.mutex.Unlock()
+
 	gm.mutex.RLock()
 	defer gm.mutex.RUnlock()
 
+	// 客户端就绪后开始执行延迟删除，包括重启前未完成的删除
+	if gm.peerResolver != nil {
+		resolver := gm.peerResolver
+		gm.deletions.Start(func(ctx context.Context, chatID int64, ids []int) error {
+			return deleteMessagesInChat(ctx, client, resolver, chatID, ids)
+		})
+	}
+
 	for name, plugin := range gm.plugins {
-		// 检查插件是否是CoreCommandsPlugin类型
-		if corePlugin, ok := plugin.(*CoreCommandsPlugin); ok {
-			corePlugin.SetTelegramClient(client)
-			logger.Debugf("Set Telegram client for plugin %s", name)
-		}
-		// 检查插件是否是SBPlugin类型
-		if sbPlugin, ok := plugin.(*SBPlugin); ok {
-			sbPlugin.SetTelegramClient(client)
-			logger.Debugf("Set Telegram client for SB plugin %s", name)
-		}
-		// 检查插件是否是AutoSendPlugin类型
-		if autoSendPlugin, ok := plugin.(*AutoSendPlugin); ok {
-			// 需要peer resolver
-			if gm.peerResolver != nil {
-				autoSendPlugin.SetTelegramClient(client, gm.peerResolver)
-				logger.Debugf("Set Telegram client for AutoSend plugin %s", name)
-			}
-		}
-		// 检查插件是否是DeleteMyMessagesPlugin类型
-		if dmePlugin, ok := plugin.(*DeleteMyMessagesPlugin); ok {
-			dmePlugin.SetTelegramClient(client)
-			logger.Debugf("Set Telegram client for DeleteMyMessages plugin %s", name)
-		}
-		// 检查插件是否是IdsPlugin类型
-		if idsPlugin, ok := plugin.(*IdsPlugin); ok {
-			idsPlugin.SetTelegramClient(client)
-			logger.Debugf("Set Telegram client for Ids plugin %s", name)
+		gm.setPluginClient(name, plugin, client)
+	}
+}
+
+// setPluginClient 为单个插件设置Telegram客户端
+func (gm *GoManager) setPluginClient(name string, plugin Plugin, client *tg.Client) {
+	// 检查插件是否是CoreCommandsPlugin类型
+	if corePlugin, ok := plugin.(*CoreCommandsPlugin); ok {
+		corePlugin.SetTelegramClient(client)
+		logger.Debugf("Set Telegram client for plugin %s", name)
+	}
+	// 检查插件是否是SBPlugin类型
+	if sbPlugin, ok := plugin.(*SBPlugin); ok {
+		sbPlugin.SetTelegramClient(client)
+		logger.Debugf("Set Telegram client for SB plugin %s", name)
+	}
+	// 检查插件是否是AutoSendPlugin类型
+	if autoSendPlugin, ok := plugin.(*AutoSendPlugin); ok {
+		// 需要peer resolver
+		if gm.peerResolver != nil {
+			autoSendPlugin.SetTelegramClient(client, gm.peerResolver)
+			logger.Debugf("Set Telegram client for AutoSend plugin %s", name)
 		}
 	}
+	// 检查插件是否是DeleteMyMessagesPlugin类型
+	if dmePlugin, ok := plugin.(*DeleteMyMessagesPlugin); ok {
+		dmePlugin.SetTelegramClient(client)
+		logger.Debugf("Set Telegram client for DeleteMyMessages plugin %s", name)
+	}
+	// 检查插件是否是IdsPlugin类型
+	if idsPlugin, ok := plugin.(*IdsPlugin); ok && gm.peerResolver != nil {
+		idsPlugin.SetTelegramClient(client, gm.peerResolver)
+		logger.Debugf("Set Telegram client for Ids plugin %s", name)
+	}
+	// 检查插件是否是VotePlugin类型
+	if votePlugin, ok := plugin.(*VotePlugin); ok {
+		votePlugin.SetTelegramClient(client)
+		logger.Debugf("Set Telegram client for Vote plugin %s", name)
+	}
+	// 检查插件是否是StoryPlugin类型
+	if storyPlugin, ok := plugin.(*StoryPlugin); ok {
+		storyPlugin.SetTelegramClient(client)
+		logger.Debugf("Set Telegram client for Story plugin %s", name)
+	}
+	// 检查插件是否是TplPlugin类型
+	if tplPlugin, ok := plugin.(*TplPlugin); ok && gm.peerResolver != nil {
+		tplPlugin.SetTelegramClient(client, gm.peerResolver)
+		logger.Debugf("Set Telegram client for Tpl plugin %s", name)
+	}
+	// 检查插件是否是JoinRequestPlugin类型
+	if joinRequestPlugin, ok := plugin.(*JoinRequestPlugin); ok && gm.peerResolver != nil {
+		joinRequestPlugin.SetTelegramClient(client, gm.peerResolver)
+		logger.Debugf("Set Telegram client for JoinRequest plugin %s", name)
+	}
+	// 检查插件是否是ReminderPlugin类型
+	if reminderPlugin, ok := plugin.(*ReminderPlugin); ok && gm.peerResolver != nil {
+		reminderPlugin.SetTelegramClient(client, gm.peerResolver)
+		logger.Debugf("Set Telegram client for Reminder plugin %s", name)
+	}
+	// 检查插件是否是AFKPlugin类型
+	if afkPlugin, ok := plugin.(*AFKPlugin); ok && gm.peerResolver != nil {
+		afkPlugin.SetTelegramClient(client, gm.peerResolver)
+		logger.Debugf("Set Telegram client for AFK plugin %s", name)
+	}
+	// 检查插件是否是FilterPlugin类型
+	if filterPlugin, ok := plugin.(*FilterPlugin); ok && gm.peerResolver != nil {
+		filterPlugin.SetTelegramClient(client, gm.peerResolver)
+		logger.Debugf("Set Telegram client for Filter plugin %s", name)
+	}
+	// 检查插件是否是GhostPlugin类型
+	if ghostPlugin, ok := plugin.(*GhostPlugin); ok && gm.peerResolver != nil {
+		ghostPlugin.SetTelegramClient(client, gm.peerResolver)
+		logger.Debugf("Set Telegram client for Ghost plugin %s", name)
+	}
+	// 检查插件是否是AntifloodPlugin类型
+	if antifloodPlugin, ok := plugin.(*AntifloodPlugin); ok && gm.peerResolver != nil {
+		antifloodPlugin.SetTelegramClient(client, gm.peerResolver)
+		logger.Debugf("Set Telegram client for Antiflood plugin %s", name)
+	}
+	// 检查插件是否是WatchPlugin类型
+	if watchPlugin, ok := plugin.(*WatchPlugin); ok && gm.peerResolver != nil {
+		watchPlugin.SetTelegramClient(client, gm.peerResolver)
+		logger.Debugf("Set Telegram client for Watch plugin %s", name)
+	}
 }
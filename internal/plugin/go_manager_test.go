@@ -0,0 +1,111 @@
+package plugin
+
+import (
+	"nexusvalet/internal/capability"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"reflect"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+// capTestPlugin 声明指定依赖的测试插件，注册一个与插件同名的命令
+type capTestPlugin struct {
+	*BasePlugin
+	requirements []capability.Requirement
+}
+
+func newCapTestPlugin(name string, requirements ...capability.Requirement) *capTestPlugin {
+	info := &PluginInfo{PluginVersion: &PluginVersion{Name: name, Version: "1.0.0"}, Dir: "builtin", Enabled: true}
+	return &capTestPlugin{BasePlugin: NewBasePlugin(info), requirements: requirements}
+}
+
+func (p *capTestPlugin) Capabilities() []capability.Requirement {
+	return p.requirements
+}
+
+func (p *capTestPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand(p.info.Name, "测试", p.info.Name, func(ctx *command.CommandContext) error {
+		_, err := ctx.Respond(p.info.Name+" ok", format.Plain)
+		return err
+	})
+	return nil
+}
+
+func TestBuiltinCapabilitiesSatisfied(t *testing.T) {
+	// 当前依赖的gotd版本应满足所有内置插件声明的依赖
+	plugins := map[string]CapabilityPlugin{
+		"antiflood": &AntifloodPlugin{},
+		"dme":       &DeleteMyMessagesPlugin{},
+		"download":  &DownloadPlugin{},
+		"gif":       &GifPlugin{},
+		"ids":       &IdsPlugin{},
+		"sb":        &SBPlugin{},
+		"sticker":   &StickerPlugin{},
+		"thread":    &ThreadPlugin{},
+		"vote":      &VotePlugin{},
+	}
+	var manifests []capability.Manifest
+	for name, p := range plugins {
+		manifests = append(manifests, capability.Manifest{Plugin: name, Requirements: p.Capabilities()})
+	}
+	if report := capability.Probe(manifests); !report.OK() {
+		t.Errorf("builtin capabilities missing:\n%s", report.Summary())
+	}
+}
+
+func TestProbeCapabilitiesDisablesAffectedPlugins(t *testing.T) {
+	env := newTestEnv()
+	gm := NewGoManager(env.parser, core.NewEventDispatcher(), core.NewHookManager(), openPluginDB(t))
+	t.Cleanup(func() { gm.Shutdown() })
+
+	good := newCapTestPlugin("good", capability.Require(tg.MessagesSendMessageRequest{}, "Peer", "Message", "RandomID"))
+	broken := newCapTestPlugin("broken",
+		capability.Require(tg.ChannelsEditBannedRequest{}, "Channel", "BannedRights.NoSuchRight"),
+		capability.Require((*tg.Client)(nil), "MessagesSendMessage", "MessagesNoSuchMethod"),
+	)
+	for _, p := range []Plugin{NewAPTPlugin(), good, broken} {
+		if err := gm.RegisterPlugin(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if gm.GetCapabilityReport() != nil {
+		t.Fatal("report should be nil before the probe runs")
+	}
+	if out, _ := env.run(nil, "apt capabilities"); out.Text != "Capability probe has not run" {
+		t.Errorf("apt capabilities before probe = %q", out.Text)
+	}
+
+	report := gm.ProbeCapabilities()
+	if report.Checked != 7 || !reflect.DeepEqual(report.Affected(), []string{"broken"}) {
+		t.Fatalf("report = %+v", report)
+	}
+	if gm.GetCapabilityReport() != report {
+		t.Error("GetCapabilityReport should return the probe result")
+	}
+	if broken.IsEnabled() || !good.IsEnabled() {
+		t.Errorf("enabled: broken=%v good=%v; want only broken disabled", broken.IsEnabled(), good.IsEnabled())
+	}
+
+	// 被禁用插件的命令改为提示缺失的能力，其他插件不受影响
+	tests := []struct {
+		command, want string
+	}{
+		{"good", "good ok"},
+		{"broken", "⚠️ 插件 broken 已被禁用：当前gotd版本缺少 tg.ChannelsEditBannedRequest.BannedRights.NoSuchRight, tg.Client.MessagesNoSuchMethod\n" +
+			"使用 .apt capabilities 查看完整报告"},
+		{"apt capabilities", "⚠️ API能力检查: 1 个插件缺少依赖 (共检查 7 项)\n\n" +
+			"• broken: tg.ChannelsEditBannedRequest.BannedRights.NoSuchRight, tg.Client.MessagesNoSuchMethod"},
+	}
+	for _, tt := range tests {
+		out, err := env.run(nil, tt.command)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.command, err)
+		}
+		if out.Text != tt.want {
+			t.Errorf("%s =\n%s\nwant\n%s", tt.command, out.Text, tt.want)
+		}
+	}
+}
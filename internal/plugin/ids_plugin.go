@@ -3,24 +3,24 @@ package plugin
 import (
 	"context"
 	"fmt"
+	"nexusvalet/internal/capability"
 	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
 	"nexusvalet/internal/peers"
 	"nexusvalet/pkg/logger"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gotd/td/tg"
 )
 
-// DC编号到国家的映射
+// DC编号到位置的映射，DC1/DC3 位于美国迈阿密，DC2/DC4 位于荷兰阿姆斯特丹，DC5 位于新加坡
 var dcCountryMapping = map[int]string{
 	1: "Miami, USA",
 	2: "Amsterdam, NLD",
 	3: "Miami, USA",
 	4: "Amsterdam, NLD",
-	5: "Singapore",
-	// 可以在这里添加更多的映射
+	5: "Singapore, SGP",
 }
 
 // IdsPlugin ID查询插件
@@ -46,14 +46,14 @@ func NewIdsPlugin() *IdsPlugin {
 	return &IdsPlugin{
 		BasePlugin:        NewBasePlugin(info),
 		telegramAPI:       &TelegramAPI{},
-		accessHashManager: nil, // 将在SetTelegramClient中初始化
+		accessHashManager: nil, // 将在SetTelegramClient中设置
 	}
 }
 
-// SetTelegramClient 设置Telegram客户端
-func (ip *IdsPlugin) SetTelegramClient(client *tg.Client) {
+// SetTelegramClient 设置Telegram客户端，使用解析器共享的AccessHashManager
+func (ip *IdsPlugin) SetTelegramClient(client *tg.Client, peerResolver *peers.Resolver) {
 	ip.telegramAPI.client = client
-	ip.accessHashManager = peers.NewAccessHashManager(client)
+	ip.accessHashManager = peerResolver.Manager()
 }
 
 // estimateLevel 根据用户ID估算等级
@@ -365,9 +365,7 @@ func (ip *IdsPlugin) getUserFromGroupMembers(ctx context.Context, userID int64)
 // getUserByUsername 通过用户名获取用户信息
 func (ip *IdsPlugin) getUserByUsername(ctx context.Context, username string) (*tg.User, error) {
 	// 使用ContactsResolveUsername解析用户名
-	resolved, err := ip.telegramAPI.client.ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{
-		Username: username,
-	})
+	resolved, err := resolveUsername(ctx, ip.telegramAPI.client, username)
 	if err != nil {
 		return nil, fmt.Errorf("用户名无效或者并未被使用: %w", err)
 	}
@@ -384,15 +382,64 @@ func (ip *IdsPlugin) getUserByUsername(ctx context.Context, username string) (*t
 	return nil, fmt.Errorf("未找到用户: %s", username)
 }
 
+// idsLongHelp .help ids 显示的详细帮助
+const idsLongHelp = `🆔 Ids 用户信息查询插件详细帮助
+
+🆔 .ids 命令:
+  查询用户ID信息，包括等级、DC位置等，功能包括:
+  • 🎯 支持多种用户指定方式
+  • 📊 显示用户等级估算
+  • 🌍 显示DC位置信息
+  • 🔗 生成用户链接
+
+📝 使用方法:
+  • .ids - 查询自己的信息
+  • .ids <用户ID> - 通过用户ID查询
+  • .ids @<用户名> - 通过用户名查询
+  • .ids <用户名> - 通过用户名查询（无需@符号）
+  • .ids - 回复消息查询该用户信息（推荐）
+
+📋 显示信息:
+  • ID: 用户唯一标识符
+  • DC: 数据中心编号和位置（自己查询显示当前连接的DC，其他用户通过头像所在的DC获取，没有头像时显示未知）
+  • 昵称: 用户显示名称（可点击）
+  • 等级: 基于ID范围的等级估算
+  • 用户名: Telegram用户名
+  • TG链接: 用户链接
+  • 标记: 机器人、Premium、已认证、受限等账号标记
+  • 简介、共同群组数和头像数量: 能获取到用户的access_hash时显示，结果缓存1小时
+
+🎯 等级系统 (游戏风格):
+  • 👑 终极BOSS (无敌存在): ID < 50,000,000
+  • 🌌 创世之神 (开天辟地): 50,000,000 ≤ ID < 100,000,000
+  • ⚡ 神话至尊 (威震寰宇): 100,000,000 ≤ ID < 500,000,000
+  • 🔥 史诗霸主 (独霸一方): 500,000,000 ≤ ID < 1,000,000,000
+  • 🌟 传奇英雄 (威震八方): 1,000,000,000 ≤ ID < 2,075,484,114
+  • 👑 王者传说 (名震天下): 2,075,484,114 ≤ ID < 3,000,000,000
+  • 💎 钻石大师 (威名远扬): 3,000,000,000 ≤ ID < 4,000,000,000
+  • 🏆 黄金勇者 (声名鹊起): 4,000,000,000 ≤ ID < 5,000,000,000
+  • 🛡️ 白银骑士 (小有名气): 5,000,000,000 ≤ ID < 6,000,000,000
+  • ⚔️ 青铜战士 (初出茅庐): 6,000,000,000 ≤ ID < 7,000,000,000
+  • 🆕 新手村村民 (刚入坑): ID ≥ 7,000,000,000`
+
 // RegisterCommands 实现CommandPlugin接口
 func (ip *IdsPlugin) RegisterCommands(parser *command.Parser) error {
 	// 注册ids命令
 	parser.RegisterCommand("ids", "查询用户ID信息，包括等级、DC位置等", ip.info.Name, ip.handleIds)
+	parser.RegisterLongHelp(ip.info.Name, idsLongHelp)
 
 	logger.Infof("Ids commands registered successfully")
 	return nil
 }
 
+// Capabilities 实现CapabilityPlugin接口，声明用户和对话查询接口
+func (ip *IdsPlugin) Capabilities() []capability.Requirement {
+	return []capability.Requirement{
+		capability.Require((*tg.Client)(nil), "UsersGetUsers", "ContactsSearch", "MessagesGetDialogs", "ContactsResolveUsername"),
+		capability.Require(tg.User{}, "ID", "AccessHash", "Username", "FirstName"),
+	}
+}
+
 // handleIds 处理ids命令
 func (ip *IdsPlugin) handleIds(ctx *command.CommandContext) error {
 	// 解析用户
@@ -418,8 +465,11 @@ func (ip *IdsPlugin) handleIds(ctx *command.CommandContext) error {
 
 	userLevel := estimateLevel(userID)
 
+	// 有access_hash时获取完整资料，获取不到时只显示基本信息
+	full := ip.getFullUser(ctx.Context, user)
+
 	// 获取DC信息
-	dc, country := ip.getDCInfo(ctx.Context, user)
+	dc, country := ip.getDCInfo(ctx.Context, user, full)
 
 	// 构建响应消息
 	response := fmt.Sprintf(`ID: %d
@@ -430,42 +480,73 @@ DC%s: %s
 TG链接: tg://user?id=%d`,
 		userID, dc, country, nickname, userLevel, username, userID)
 
+	if flags := userFlags(user); flags != "" {
+		response += "\n标记: " + flags
+	}
+	if full != nil {
+		if full.About != "" {
+			response += "\n简介: " + full.About
+		}
+		response += fmt.Sprintf("\n共同群组: %d", full.CommonChatsCount)
+		if full.PhotoCount >= 0 {
+			response += fmt.Sprintf("\n头像数量: %d", full.PhotoCount)
+		}
+	}
+
 	return ip.sendResponse(ctx, response)
 }
 
-// sendResponse 发送响应消息
-func (ip *IdsPlugin) sendResponse(ctx *command.CommandContext, message string) error {
-	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+// getFullUser 获取用户的完整资料(简介、共同群组、头像数量)，没有access_hash或获取失败时返回nil
+func (ip *IdsPlugin) getFullUser(ctx context.Context, user *tg.User) *peers.FullUserInfo {
+	if ip.accessHashManager == nil {
+		return nil
+	}
+	var input tg.InputUserClass = &tg.InputUser{UserID: user.ID, AccessHash: user.AccessHash}
+	if user.Self {
+		input = &tg.InputUserSelf{}
+	} else if user.AccessHash == 0 || user.Min {
+		return nil
+	}
+
+	full, err := ip.accessHashManager.GetFullUser(ctx, input, user.ID)
 	if err != nil {
-		return fmt.Errorf("failed to resolve peer: %w", err)
+		logger.Ctx(ctx).Debugf("Failed to get full user %d: %v", user.ID, err)
+		return nil
 	}
+	return full
+}
 
-	// 私聊：编辑消息，群聊：先尝试编辑，失败则发送新消息
-	if ctx.Message.ChatID > 0 {
-		// 私聊：编辑原消息
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: message,
-		})
-		return err
-	} else {
-		// 群聊：先尝试编辑
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: message,
-		})
-		if err != nil {
-			// 编辑失败，发送新消息
-			_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-				Peer:     peer,
-				Message:  message,
-				RandomID: time.Now().UnixNano(),
-			})
-		}
-		return err
+// userFlags 返回账号的机器人/Premium/认证/受限等标记，没有时返回空字符串
+func userFlags(user *tg.User) string {
+	var flags []string
+	if user.Bot {
+		flags = append(flags, "🤖 机器人")
+	}
+	if user.Premium {
+		flags = append(flags, "⭐ Premium")
+	}
+	if user.Verified {
+		flags = append(flags, "✅ 已认证")
+	}
+	if user.Restricted {
+		flags = append(flags, "🚫 受限")
 	}
+	if user.Scam {
+		flags = append(flags, "⚠️ 诈骗")
+	}
+	if user.Fake {
+		flags = append(flags, "⚠️ 冒充")
+	}
+	if user.Deleted {
+		flags = append(flags, "🗑️ 已注销")
+	}
+	return strings.Join(flags, " ")
+}
+
+// sendResponse 发送响应消息
+func (ip *IdsPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
 }
 
 // sendErrorResponse 发送错误响应
@@ -473,62 +554,36 @@ func (ip *IdsPlugin) sendErrorResponse(ctx *command.CommandContext, errorMsg str
 	return ip.sendResponse(ctx, "❌ "+errorMsg)
 }
 
-// getDCInfo 获取DC信息
-func (ip *IdsPlugin) getDCInfo(ctx context.Context, user *tg.User) (string, string) {
-	// 如果是查询自己的信息，尝试获取真实的DC信息
+// getDCInfo 获取DC编号和位置：自己使用当前连接的DC，其他用户使用头像所在的DC，
+// 基本信息中没有头像时使用完整资料中的头像。都没有时返回 "" 和 "未知"，不做推测
+func (ip *IdsPlugin) getDCInfo(ctx context.Context, user *tg.User, full *peers.FullUserInfo) (string, string) {
+	dc := 0
 	if user.Self {
 		if nearestDC, err := ip.telegramAPI.client.HelpGetNearestDC(ctx); err == nil {
-			dc := fmt.Sprintf("%d", nearestDC.ThisDC)
-			country := dcCountryMapping[nearestDC.ThisDC]
-			if country == "" {
-				country = "未知"
-			}
-			return dc, country
+			dc = nearestDC.ThisDC
 		}
 	}
-
-	// 对于其他用户，优先尝试通过头像获取DC信息
-	if user.Photo != nil {
+	if dc == 0 {
 		if photo, ok := user.Photo.(*tg.UserProfilePhoto); ok {
-			dc := photo.DCID
-			country := dcCountryMapping[dc]
-			if country == "" {
-				country = "未知"
-			}
-			return fmt.Sprintf("%d", dc), country
+			dc = photo.DCID
 		}
 	}
-
-	// 如果头像信息不可用，尝试通过AccessHash推断DC信息
-	// 这是一个简化的方法，实际DC分配更复杂
-	dc := ip.inferDCFromAccessHash(user.AccessHash)
-	country := dcCountryMapping[dc]
-	if country == "" {
-		country = "未知"
+	if dc == 0 && full != nil {
+		dc = full.PhotoDCID
 	}
-
-	return fmt.Sprintf("%d", dc), country
+	return dcLocation(dc)
 }
 
-// inferDCFromAccessHash 通过AccessHash推断DC信息
-// 这是一个简化的推断方法，实际DC分配基于用户注册时的手机号国家代码
-func (ip *IdsPlugin) inferDCFromAccessHash(accessHash int64) int {
-	// 这是一个简化的推断方法
-	// 实际应用中，DC信息通常基于用户注册时的手机号国家代码
-	// 这里我们使用AccessHash的一些位来推断，但这不是100%准确的
-
-	if accessHash == 0 {
-		return 0 // 无法推断
+// dcLocation 返回DC编号和位置，dc为0或未知编号时位置为 "未知"
+func dcLocation(dc int) (string, string) {
+	if dc == 0 {
+		return "", "未知"
 	}
-
-	// 使用AccessHash的低位来推断DC
-	// 这是一个简化的方法，实际DC分配更复杂
-	dc := int((accessHash&0xFF)%5) + 1
-	if dc > 5 {
-		dc = 5
+	country, ok := dcCountryMapping[dc]
+	if !ok {
+		country = "未知"
 	}
-
-	return dc
+	return strconv.Itoa(dc), country
 }
 
 // extractUserFromMessage 从消息中提取用户信息
@@ -601,6 +656,7 @@ func (ip *IdsPlugin) getReplyMessage(ctx *command.CommandContext, msgID int) (*t
 				msg = m
 				// 缓存用户信息到AccessHashManager
 				ip.accessHashManager.CacheUsersFromUpdate(messagesSlice.Users)
+				ip.accessHashManager.CacheChatsFromUpdate(messagesSlice.Chats)
 			}
 		}
 	} else if channelMessages, ok := messages.(*tg.MessagesChannelMessages); ok {
@@ -609,6 +665,7 @@ func (ip *IdsPlugin) getReplyMessage(ctx *command.CommandContext, msgID int) (*t
 				msg = m
 				// 缓存用户信息到AccessHashManager
 				ip.accessHashManager.CacheUsersFromUpdate(channelMessages.Users)
+				ip.accessHashManager.CacheChatsFromUpdate(channelMessages.Chats)
 			}
 		}
 	}
@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"context"
+	"nexusvalet/internal/peers"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+func TestDCCountryMapping(t *testing.T) {
+	// DC1/DC3 在迈阿密，DC2/DC4 在阿姆斯特丹，DC5 在新加坡
+	want := map[int]string{
+		1: "Miami, USA",
+		2: "Amsterdam, NLD",
+		3: "Miami, USA",
+		4: "Amsterdam, NLD",
+		5: "Singapore, SGP",
+	}
+	if len(dcCountryMapping) != len(want) {
+		t.Errorf("dcCountryMapping has %d entries, want %d", len(dcCountryMapping), len(want))
+	}
+	for dc, location := range want {
+		if got := dcCountryMapping[dc]; got != location {
+			t.Errorf("DC%d = %q, want %q", dc, got, location)
+		}
+	}
+}
+
+func TestDCLocation(t *testing.T) {
+	tests := []struct {
+		dc           int
+		wantDC, want string
+	}{
+		{0, "", "未知"},
+		{1, "1", "Miami, USA"},
+		{2, "2", "Amsterdam, NLD"},
+		{4, "4", "Amsterdam, NLD"},
+		{5, "5", "Singapore, SGP"},
+		{6, "6", "未知"}, // 编号有效但不在映射中时只显示编号
+	}
+	for _, tt := range tests {
+		dc, location := dcLocation(tt.dc)
+		if dc != tt.wantDC || location != tt.want {
+			t.Errorf("dcLocation(%d) = %q, %q; want %q, %q", tt.dc, dc, location, tt.wantDC, tt.want)
+		}
+	}
+}
+
+func TestGetDCInfo(t *testing.T) {
+	nearest := 0 // help.getNearestDC 返回的当前DC，0 表示请求失败
+	inv := &fakeInvoker{handle: func(input bin.Encoder, output bin.Decoder) error {
+		if _, ok := input.(*tg.HelpGetNearestDCRequest); !ok {
+			return errUnhandled
+		}
+		if nearest == 0 {
+			return tgerr.New(500, "INTERNAL")
+		}
+		*output.(*tg.NearestDC) = tg.NearestDC{Country: "NL", ThisDC: nearest, NearestDC: 4}
+		return nil
+	}}
+	ip := NewIdsPlugin()
+	ip.telegramAPI.client = tg.NewClient(inv)
+
+	photo := &tg.UserProfilePhoto{PhotoID: 1, DCID: 2}
+	tests := []struct {
+		name         string
+		user         *tg.User
+		full         *peers.FullUserInfo
+		nearest      int
+		wantDC, want string
+	}{
+		{"self uses the connected DC", &tg.User{Self: true, Photo: photo}, nil, 5, "5", "Singapore, SGP"},
+		{"self falls back to photo", &tg.User{Self: true, Photo: photo}, nil, 0, "2", "Amsterdam, NLD"},
+		{"user photo", &tg.User{Photo: photo}, &peers.FullUserInfo{PhotoDCID: 1}, 5, "2", "Amsterdam, NLD"},
+		{"full user photo", &tg.User{}, &peers.FullUserInfo{PhotoDCID: 1}, 5, "1", "Miami, USA"},
+		{"empty photo", &tg.User{Photo: &tg.UserProfilePhotoEmpty{}}, &peers.FullUserInfo{}, 5, "", "未知"},
+		{"nothing known", &tg.User{ID: 0xABCDEF, AccessHash: 0x1234}, nil, 5, "", "未知"},
+	}
+	for _, tt := range tests {
+		nearest = tt.nearest
+		before := len(requests[*tg.HelpGetNearestDCRequest](inv))
+		dc, location := ip.getDCInfo(context.Background(), tt.user, tt.full)
+		if dc != tt.wantDC || location != tt.want {
+			t.Errorf("%s: getDCInfo = %q, %q; want %q, %q", tt.name, dc, location, tt.wantDC, tt.want)
+		}
+		// 只有自己需要查询当前连接的DC
+		if asked := len(requests[*tg.HelpGetNearestDCRequest](inv)) > before; asked != tt.user.Self {
+			t.Errorf("%s: asked for nearest DC = %v", tt.name, asked)
+		}
+	}
+}
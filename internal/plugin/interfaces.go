@@ -2,8 +2,10 @@ package plugin
 
 import (
 	"context"
+	"nexusvalet/internal/capability"
 	"nexusvalet/internal/command"
 	"nexusvalet/internal/core"
+	"nexusvalet/internal/selftest"
 )
 
 // PluginVersion 代表插件版本信息
@@ -63,6 +65,32 @@ type HookPlugin interface {
 	RegisterHooks(hookManager *core.HookManager) error
 }
 
+// PostConnectPlugin 是初始化较重、可以推迟到连接之后的插件接口。
+// Initialize 只做连接前必须完成的工作(如建表)，其余工作放在 InitializeAfterConnect，
+// 由插件管理器在连接后并发执行，或在插件的命令首次使用时执行
+type PostConnectPlugin interface {
+	Plugin
+
+	// InitializeAfterConnect 连接后的初始化，只会执行一次
+	InitializeAfterConnect(ctx context.Context) error
+}
+
+// SelfTestPlugin 是提供启动自检项的插件接口
+type SelfTestPlugin interface {
+	Plugin
+
+	// SelfTestChecks 返回插件依赖的外部服务检查项
+	SelfTestChecks() []selftest.Check
+}
+
+// CapabilityPlugin 是声明依赖的TL类型成员的插件接口
+type CapabilityPlugin interface {
+	Plugin
+
+	// Capabilities 返回插件依赖的gotd类型字段和方法，缺失时插件在启动时被禁用
+	Capabilities() []capability.Requirement
+}
+
 // BasePlugin 提供插件的基础实现
 type BasePlugin struct {
 	info    *PluginInfo
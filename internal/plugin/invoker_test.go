@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/peers"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	_ "modernc.org/sqlite"
+)
+
+// fakeInvoker 记录所有请求的 tg.Invoker。handle 为nil或返回 errUnhandled 时
+// 按请求的结果类型返回空的成功结果
+type fakeInvoker struct {
+	mu     sync.Mutex
+	calls  []bin.Encoder
+	handle func(input bin.Encoder, output bin.Decoder) error
+}
+
+// errUnhandled handle 不处理该请求，使用默认结果
+var errUnhandled = fmt.Errorf("unhandled request")
+
+func (f *fakeInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, input)
+	handle := f.handle
+	f.mu.Unlock()
+
+	if handle != nil {
+		if err := handle(input, output); err != errUnhandled {
+			return err
+		}
+	}
+	switch o := output.(type) {
+	case *tg.BoolBox:
+		o.Bool = &tg.BoolTrue{}
+	case *tg.UpdatesBox:
+		o.Updates = &tg.Updates{}
+	case *tg.MessagesAffectedMessages:
+	default:
+		return fmt.Errorf("fakeInvoker: unexpected request %T", input)
+	}
+	return nil
+}
+
+// requests 返回类型为T的请求
+func requests[T bin.Encoder](f *fakeInvoker) []T {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []T
+	for _, call := range f.calls {
+		if req, ok := call.(T); ok {
+			out = append(out, req)
+		}
+	}
+	return out
+}
+
+// fakePeers 不需要 access_hash 的 AccessHashProvider，按ID的规则返回对应的 InputPeer
+type fakePeers struct{}
+
+func (fakePeers) GetInputPeer(_ context.Context, peerID int64) (tg.InputPeerClass, error) {
+	switch {
+	case peerID > 0:
+		return &tg.InputPeerUser{UserID: peerID}, nil
+	case peerID < -1000000000000:
+		return &tg.InputPeerChannel{ChannelID: -peerID - 1000000000000}, nil
+	default:
+		return &tg.InputPeerChat{ChatID: -peerID}, nil
+	}
+}
+
+func (fakePeers) GetUserPeerWithFallback(_ context.Context, userID int64, _ tg.InputChannelClass) (*tg.InputPeerUser, error) {
+	return &tg.InputPeerUser{UserID: userID}, nil
+}
+
+func (fakePeers) GetUserPeerFromMessage(_ context.Context, _ tg.InputPeerClass, _ int, userID int64) (*tg.InputPeerUser, error) {
+	return &tg.InputPeerUser{UserID: userID}, nil
+}
+
+// testEnv 插件测试使用的命令解析器，Telegram请求发送到 fakeInvoker
+type testEnv struct {
+	inv    *fakeInvoker
+	parser *command.Parser
+}
+
+func newTestEnv() *testEnv {
+	inv := &fakeInvoker{}
+	parser := command.NewParser(".", core.NewEventDispatcher(), core.NewHookManager())
+	parser.SetTelegramAPI(tg.NewClient(inv), peers.NewResolver(fakePeers{}))
+	return &testEnv{inv: inv, parser: parser}
+}
+
+// run 在捕获模式下执行命令，返回 Respond 的内容。msgEvent 为nil时使用自己在普通群组中发送的消息
+func (e *testEnv) run(msgEvent *core.MessageEvent, text string) (*command.Output, error) {
+	if msgEvent == nil {
+		msgEvent = &core.MessageEvent{ChatID: -100, UserID: 1}
+	}
+	if msgEvent.Message == nil {
+		msgEvent.Message = &tg.Message{ID: 10}
+	}
+	outer := &command.CommandContext{Context: context.Background(), Message: msgEvent, Prefix: "."}
+	return e.parser.RunCaptured(outer, text)
+}
+
+// runText 执行命令并返回 Respond 的文本，命令出错或没有输出时测试失败
+func (e *testEnv) runText(t *testing.T, msgEvent *core.MessageEvent, text string) string {
+	t.Helper()
+	out, err := e.run(msgEvent, text)
+	if err != nil {
+		t.Fatalf("%s: %v", text, err)
+	}
+	if out == nil {
+		t.Fatalf("%s: no response", text)
+	}
+	return out.Text
+}
+
+// openPluginDB 打开测试用的临时数据库
+func openPluginDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "plugin.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,675 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+const (
+	// joinRequestsPageSize 每页显示的入群请求数
+	joinRequestsPageSize = 10
+	// joinRequestsConfirmAbove 批量操作超过该数量时需要确认
+	joinRequestsConfirmAbove = 20
+	// joinRequestsFetchLimit 最多获取的入群请求数
+	joinRequestsFetchLimit = 500
+	// joinRequestPacing 批量处理时两次请求之间的间隔
+	joinRequestPacing = 500 * time.Millisecond
+	// joinRequestMaxFloodWait 批量处理时愿意等待的FLOOD_WAIT上限，超过则停止
+	joinRequestMaxFloodWait = 60 * time.Second
+	// joinRuleMutual 自动通过与我有共同群组的申请人
+	joinRuleMutual = "mutual"
+)
+
+// joinRequester 待审核的入群申请人
+type joinRequester struct {
+	UserID     int64
+	AccessHash int64
+	Name       string
+	Username   string
+	About      string
+	Date       time.Time
+}
+
+// JoinRequestPlugin 管理自己是管理员的群组中的入群请求
+type JoinRequestPlugin struct {
+	*BasePlugin
+	db           *sql.DB
+	telegramAPI  *tg.Client
+	peerResolver *peers.Resolver
+	rules        map[int64]string          // 对话ID -> 自动通过规则
+	listed       map[int64][]joinRequester // 对话ID -> 最近一次列出的请求，序号以此为准
+	evaluating   map[int64]bool            // 正在评估自动通过规则的对话
+	mutex        sync.Mutex
+
+	now func() time.Time
+}
+
+// NewJoinRequestPlugin 创建入群请求插件
+func NewJoinRequestPlugin(db *sql.DB) *JoinRequestPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "requests",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "查看、批准或拒绝入群请求，可按规则自动通过",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &JoinRequestPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+		rules:      make(map[int64]string),
+		listed:     make(map[int64][]joinRequester),
+		evaluating: make(map[int64]bool),
+		now:        time.Now,
+	}
+}
+
+// Initialize 初始化插件
+func (jp *JoinRequestPlugin) Initialize(ctx context.Context, manager interface{}) error {
+	if err := jp.BasePlugin.Initialize(ctx, manager); err != nil {
+		return err
+	}
+
+	if err := jp.initDatabase(); err != nil {
+		return fmt.Errorf("failed to initialize join request database: %w", err)
+	}
+	if err := jp.loadRules(); err != nil {
+		return fmt.Errorf("failed to load join request rules: %w", err)
+	}
+
+	logger.Infof("Join request plugin initialized successfully")
+	return nil
+}
+
+// SetTelegramClient 设置Telegram客户端和Peer解析器
+func (jp *JoinRequestPlugin) SetTelegramClient(client *tg.Client, peerResolver *peers.Resolver) {
+	jp.telegramAPI = client
+	jp.peerResolver = peerResolver
+}
+
+// initDatabase 创建自动通过规则表
+func (jp *JoinRequestPlugin) initDatabase() error {
+	_, err := jp.db.Exec(`
+	CREATE TABLE IF NOT EXISTS join_request_rules (
+		chat_id INTEGER PRIMARY KEY,
+		rule TEXT NOT NULL,
+		created INTEGER NOT NULL
+	)`)
+	return err
+}
+
+// loadRules 加载自动通过规则
+func (jp *JoinRequestPlugin) loadRules() error {
+	rows, err := jp.db.Query("SELECT chat_id, rule FROM join_request_rules")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	jp.mutex.Lock()
+	defer jp.mutex.Unlock()
+	for rows.Next() {
+		var chatID int64
+		var rule string
+		if err := rows.Scan(&chatID, &rule); err != nil {
+			return err
+		}
+		jp.rules[chatID] = rule
+	}
+	return rows.Err()
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (jp *JoinRequestPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("requests", "入群请求：[页码] | approve|deny <序号|all> | auto mutual|off", jp.info.Name, jp.handleRequests)
+	logger.Infof("Join request commands registered successfully")
+	return nil
+}
+
+// RegisterEventHandlers 实现EventPlugin接口
+func (jp *JoinRequestPlugin) RegisterEventHandlers(dispatcher *core.EventDispatcher) error {
+	dispatcher.RegisterRawListener("join_request_auto", jp.onUpdate, 0)
+	return nil
+}
+
+// handleRequests 处理requests命令
+func (jp *JoinRequestPlugin) handleRequests(ctx *command.CommandContext) error {
+	if ctx.Message.ChatID > 0 {
+		return jp.sendResponse(ctx, "❌ 请在群组中使用此命令")
+	}
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+	admin, err := isChatAdmin(ctx.Context, ctx.API, peer)
+	if err != nil {
+		return jp.sendResponse(ctx, fmt.Sprintf("❌ 权限检查失败: %v", err))
+	}
+	if !admin {
+		return jp.sendResponse(ctx, "❌ 权限不足，需要管理员权限才能管理入群请求")
+	}
+
+	sub := ""
+	if len(ctx.Args) > 0 {
+		sub = ctx.Args[0]
+	}
+	switch sub {
+	case "approve", "deny":
+		return jp.handleDecision(ctx, peer, sub == "approve", ctx.Args[1:])
+	case "auto":
+		return jp.handleAuto(ctx, ctx.Args[1:])
+	case "help":
+		return jp.sendResponse(ctx, jp.usage())
+	}
+
+	page := 1
+	if sub != "" {
+		n, err := strconv.Atoi(sub)
+		if err != nil || n < 1 {
+			return jp.sendResponse(ctx, jp.usage())
+		}
+		page = n
+	}
+
+	requesters, total, err := fetchJoinRequests(ctx.Context, ctx.API, peer)
+	if err != nil {
+		return jp.sendResponse(ctx, fmt.Sprintf("❌ 获取入群请求失败: %v", err))
+	}
+	jp.mutex.Lock()
+	jp.listed[ctx.Message.ChatID] = requesters
+	jp.mutex.Unlock()
+	return jp.sendResponse(ctx, formatJoinRequests(requesters, total, page, jp.now()))
+}
+
+// handleDecision 批准或拒绝入群请求
+func (jp *JoinRequestPlugin) handleDecision(ctx *command.CommandContext, peer tg.InputPeerClass, approve bool, args []string) error {
+	action := "拒绝"
+	if approve {
+		action = "批准"
+	}
+	if len(args) == 0 {
+		return jp.sendResponse(ctx, jp.usage())
+	}
+	confirmed := len(args) > 1 && args[len(args)-1] == "confirm"
+
+	if args[0] == "all" {
+		_, total, err := fetchJoinRequests(ctx.Context, ctx.API, peer)
+		if err != nil {
+			return jp.sendResponse(ctx, fmt.Sprintf("❌ 获取入群请求失败: %v", err))
+		}
+		if total == 0 {
+			return jp.sendResponse(ctx, "📭 没有待处理的入群请求")
+		}
+		if total > joinRequestsConfirmAbove && !confirmed {
+			return jp.sendResponse(ctx, fmt.Sprintf("⚠️ 将%s全部 %d 个入群请求，确认请发送 .requests %s all confirm", action, total, ctx.Args[0]))
+		}
+		if _, err := ctx.API.MessagesHideAllChatJoinRequests(ctx.Context, &tg.MessagesHideAllChatJoinRequestsRequest{
+			Peer:     peer,
+			Approved: approve,
+		}); err != nil {
+			return jp.sendResponse(ctx, fmt.Sprintf("❌ %s失败: %v", action, err))
+		}
+		jp.forgetListed(ctx.Message.ChatID)
+		return jp.sendResponse(ctx, fmt.Sprintf("✅ 已%s全部 %d 个入群请求", action, total))
+	}
+
+	// 序号以最近一次列出的请求为准，没有列出过时获取当前的请求
+	requesters := jp.listedRequests(ctx.Message.ChatID)
+	if requesters == nil {
+		var err error
+		if requesters, _, err = fetchJoinRequests(ctx.Context, ctx.API, peer); err != nil {
+			return jp.sendResponse(ctx, fmt.Sprintf("❌ 获取入群请求失败: %v", err))
+		}
+	}
+	indexes, err := parseRequestSelection(args[0], len(requesters))
+	if err != nil {
+		return jp.sendResponse(ctx, "❌ "+err.Error())
+	}
+	if len(indexes) > joinRequestsConfirmAbove && !confirmed {
+		return jp.sendResponse(ctx, fmt.Sprintf("⚠️ 将%s %d 个入群请求，确认请发送 .requests %s %s confirm", action, len(indexes), ctx.Args[0], args[0]))
+	}
+	selected := make([]joinRequester, len(indexes))
+	for i, idx := range indexes {
+		selected[i] = requesters[idx]
+	}
+
+	if len(selected) == 1 {
+		if err := hideJoinRequest(ctx.Context, ctx.API, peer, selected[0], approve); err != nil {
+			return jp.sendResponse(ctx, fmt.Sprintf("❌ %s %s 失败: %v", action, requesterLabel(selected[0]), err))
+		}
+		return jp.sendResponse(ctx, fmt.Sprintf("✅ 已%s %s", action, requesterLabel(selected[0])))
+	}
+
+	// 多个请求逐个处理，通过任务管理器运行以显示进度并支持取消
+	runner := taskRunnerFrom(jp.GetManager())
+	if runner == nil {
+		return jp.sendResponse(ctx, "任务管理器不可用")
+	}
+	status, err := commandStatusEditor(ctx)
+	if err != nil {
+		return err
+	}
+	api := ctx.API
+	chatID := ctx.Message.ChatID
+	runner.Start(context.Background(), core.TaskOptions{
+		ChatID: chatID,
+		Name:   action + "入群请求",
+		Status: status,
+	}, func(taskCtx context.Context, report core.ProgressFunc) (string, error) {
+		return hideJoinRequests(taskCtx, api, peer, selected, approve, report), nil
+	})
+	return nil
+}
+
+// handleAuto 设置或查看自动通过规则
+func (jp *JoinRequestPlugin) handleAuto(ctx *command.CommandContext, args []string) error {
+	chatID := ctx.Message.ChatID
+	if len(args) == 0 {
+		jp.mutex.Lock()
+		rule := jp.rules[chatID]
+		jp.mutex.Unlock()
+		if rule == "" {
+			return jp.sendResponse(ctx, "当前对话未设置自动通过规则")
+		}
+		return jp.sendResponse(ctx, "当前自动通过规则: "+describeJoinRule(rule))
+	}
+
+	switch args[0] {
+	case joinRuleMutual:
+		if _, err := jp.db.Exec(`INSERT INTO join_request_rules (chat_id, rule, created) VALUES (?, ?, ?)
+			ON CONFLICT(chat_id) DO UPDATE SET rule = excluded.rule`, chatID, joinRuleMutual, jp.now().Unix()); err != nil {
+			return jp.sendResponse(ctx, fmt.Sprintf("❌ 保存规则失败: %v", err))
+		}
+		jp.mutex.Lock()
+		jp.rules[chatID] = joinRuleMutual
+		jp.mutex.Unlock()
+		return jp.sendResponse(ctx, "✅ 已开启自动通过: "+describeJoinRule(joinRuleMutual))
+	case "off":
+		if _, err := jp.db.Exec("DELETE FROM join_request_rules WHERE chat_id = ?", chatID); err != nil {
+			return jp.sendResponse(ctx, fmt.Sprintf("❌ 删除规则失败: %v", err))
+		}
+		jp.mutex.Lock()
+		delete(jp.rules, chatID)
+		jp.mutex.Unlock()
+		return jp.sendResponse(ctx, "✅ 已关闭自动通过")
+	default:
+		return jp.sendResponse(ctx, jp.usage())
+	}
+}
+
+// listedRequests 返回最近一次列出的请求。逐个处理后仍保留，序号与列出时一致
+func (jp *JoinRequestPlugin) listedRequests(chatID int64) []joinRequester {
+	jp.mutex.Lock()
+	defer jp.mutex.Unlock()
+	return jp.listed[chatID]
+}
+
+// forgetListed 全部处理后清除列出的请求
+func (jp *JoinRequestPlugin) forgetListed(chatID int64) {
+	jp.mutex.Lock()
+	defer jp.mutex.Unlock()
+	delete(jp.listed, chatID)
+}
+
+// onUpdate 收到新的入群请求时按规则自动通过
+func (jp *JoinRequestPlugin) onUpdate(ctx context.Context, event interface{}) error {
+	var peer tg.PeerClass
+	switch u := event.(type) {
+	case *tg.UpdatePendingJoinRequests:
+		if u.RequestsPending == 0 {
+			return nil
+		}
+		peer = u.Peer
+	case *tg.UpdateBotChatInviteRequester:
+		peer = u.Peer
+	default:
+		return nil
+	}
+
+	chatID := peerToChatID(peer)
+	jp.mutex.Lock()
+	rule := jp.rules[chatID]
+	busy := jp.evaluating[chatID]
+	if rule != "" && !busy {
+		jp.evaluating[chatID] = true
+	}
+	jp.mutex.Unlock()
+	if rule == "" || busy || jp.telegramAPI == nil || jp.peerResolver == nil {
+		return nil
+	}
+
+	// 评估需要多次API请求，放到后台执行，避免阻塞更新处理
+	go func() {
+		defer func() {
+			jp.mutex.Lock()
+			delete(jp.evaluating, chatID)
+			jp.mutex.Unlock()
+		}()
+		evalCtx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		if f, ok := logger.FieldsFrom(ctx); ok {
+			evalCtx = logger.WithFields(evalCtx, logger.Fields{CorrelationID: f.CorrelationID, ChatID: chatID})
+		}
+		jp.applyRule(evalCtx, chatID, rule)
+	}()
+	return nil
+}
+
+// applyRule 对当前所有待处理请求评估自动通过规则
+func (jp *JoinRequestPlugin) applyRule(ctx context.Context, chatID int64, rule string) {
+	log := logger.Ctx(ctx)
+	peer, err := jp.peerResolver.ResolveFromChatID(ctx, chatID)
+	if err != nil {
+		log.Errorf("Failed to resolve chat for join request rule: %v", err)
+		return
+	}
+	requesters, _, err := fetchJoinRequests(ctx, jp.telegramAPI, peer)
+	if err != nil {
+		log.Errorf("Failed to fetch join requests: %v", err)
+		return
+	}
+
+	for _, r := range requesters {
+		if ctx.Err() != nil {
+			return
+		}
+		common, err := countCommonChats(ctx, jp.telegramAPI, r)
+		if err != nil {
+			log.Warnf("Failed to get common chats with %d: %v", r.UserID, err)
+			continue
+		}
+		if !joinRuleAllows(rule, common) {
+			continue
+		}
+		if err := hideJoinRequest(ctx, jp.telegramAPI, peer, r, true); err != nil {
+			log.Warnf("Failed to auto-approve join request from %d: %v", r.UserID, err)
+			continue
+		}
+		log.Infof("Auto-approved join request from %d (%d common chats)", r.UserID, common)
+		if !sleepWithContext(ctx, joinRequestPacing) {
+			return
+		}
+	}
+}
+
+// joinRuleAllows 判断申请人是否满足自动通过规则
+func joinRuleAllows(rule string, commonChats int) bool {
+	switch rule {
+	case joinRuleMutual:
+		return commonChats > 0
+	}
+	return false
+}
+
+// describeJoinRule 返回规则的说明
+func describeJoinRule(rule string) string {
+	switch rule {
+	case joinRuleMutual:
+		return "与我至少有一个共同群组的申请人"
+	}
+	return rule
+}
+
+// fetchJoinRequests 获取对话中待处理的入群请求，按申请时间从新到旧排列
+func fetchJoinRequests(ctx context.Context, api *tg.Client, peer tg.InputPeerClass) ([]joinRequester, int, error) {
+	var (
+		requesters []joinRequester
+		total      int
+		offsetDate int
+		offsetUser tg.InputUserClass = &tg.InputUserEmpty{}
+	)
+	for len(requesters) < joinRequestsFetchLimit {
+		result, err := api.MessagesGetChatInviteImporters(ctx, &tg.MessagesGetChatInviteImportersRequest{
+			Requested:  true,
+			Peer:       peer,
+			OffsetDate: offsetDate,
+			OffsetUser: offsetUser,
+			Limit:      100,
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		total = result.Count
+
+		users := make(map[int64]*tg.User, len(result.Users))
+		for _, u := range result.Users {
+			if user, ok := u.(*tg.User); ok {
+				users[user.ID] = user
+			}
+		}
+		for _, imp := range result.Importers {
+			r := joinRequester{UserID: imp.UserID, About: imp.About, Date: time.Unix(int64(imp.Date), 0)}
+			if user, ok := users[imp.UserID]; ok {
+				r.AccessHash = user.AccessHash
+				r.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+				r.Username = user.Username
+			}
+			requesters = append(requesters, r)
+		}
+
+		if len(result.Importers) < 100 {
+			break
+		}
+		last := requesters[len(requesters)-1]
+		offsetDate = int(last.Date.Unix())
+		offsetUser = &tg.InputUser{UserID: last.UserID, AccessHash: last.AccessHash}
+	}
+	return requesters, total, nil
+}
+
+// hideJoinRequest 批准或拒绝一个入群请求
+func hideJoinRequest(ctx context.Context, api *tg.Client, peer tg.InputPeerClass, r joinRequester, approve bool) error {
+	_, err := api.MessagesHideChatJoinRequest(ctx, &tg.MessagesHideChatJoinRequestRequest{
+		Approved: approve,
+		Peer:     peer,
+		UserID:   &tg.InputUser{UserID: r.UserID, AccessHash: r.AccessHash},
+	})
+	return err
+}
+
+// hideJoinRequests 逐个处理入群请求并返回每一项的结果。
+// 每次请求之间留出间隔，遇到FLOOD_WAIT时等待后重试，等待过长时停止
+func hideJoinRequests(ctx context.Context, api *tg.Client, peer tg.InputPeerClass, requesters []joinRequester, approve bool, report core.ProgressFunc) string {
+	var lines []string
+	done, failed := 0, 0
+	for i, r := range requesters {
+		report(i, len(requesters), "")
+		if ctx.Err() != nil {
+			break
+		}
+
+		err := hideJoinRequest(ctx, api, peer, r, approve)
+		if wait, ok := tgerr.AsFloodWait(err); ok {
+			if wait > joinRequestMaxFloodWait {
+				lines = append(lines, fmt.Sprintf("⏸️ 需要等待 %s，已停止，剩余 %d 个未处理", wait, len(requesters)-i))
+				break
+			}
+			report(i, len(requesters), fmt.Sprintf("请求过于频繁，等待 %s", wait))
+			if !sleepWithContext(ctx, wait) {
+				break
+			}
+			err = hideJoinRequest(ctx, api, peer, r, approve)
+		}
+
+		if err != nil {
+			failed++
+			lines = append(lines, fmt.Sprintf("❌ %s: %v", requesterLabel(r), err))
+		} else {
+			done++
+			lines = append(lines, "✅ "+requesterLabel(r))
+		}
+		if i < len(requesters)-1 && !sleepWithContext(ctx, joinRequestPacing) {
+			break
+		}
+	}
+	report(done+failed, len(requesters), "")
+	return fmt.Sprintf("成功 %d · 失败 %d\n%s", done, failed, strings.Join(lines, "\n"))
+}
+
+// countCommonChats 返回与申请人的共同群组数量(最多统计1个即可判断)
+func countCommonChats(ctx context.Context, api *tg.Client, r joinRequester) (int, error) {
+	result, err := api.MessagesGetCommonChats(ctx, &tg.MessagesGetCommonChatsRequest{
+		UserID: &tg.InputUser{UserID: r.UserID, AccessHash: r.AccessHash},
+		Limit:  1,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(result.GetChats()), nil
+}
+
+// sleepWithContext 等待指定时间，ctx取消时返回false
+func sleepWithContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// parseRequestSelection 解析从1开始的序号选择，支持 "3"、"1,4"、"2-5"，返回去重排序后的下标
+func parseRequestSelection(arg string, count int) ([]int, error) {
+	if count == 0 {
+		return nil, fmt.Errorf("没有待处理的入群请求，请先使用 .requests 查看")
+	}
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(arg, ",") {
+		part = strings.TrimSpace(part)
+		from, to := part, part
+		if i := strings.IndexByte(part, '-'); i > 0 {
+			from, to = part[:i], part[i+1:]
+		}
+		a, errA := strconv.Atoi(from)
+		b, errB := strconv.Atoi(to)
+		if errA != nil || errB != nil || a < 1 || b < a {
+			return nil, fmt.Errorf("无效的序号: %s", part)
+		}
+		if b > count {
+			return nil, fmt.Errorf("序号 %d 超出范围(共 %d 个请求)", b, count)
+		}
+		for n := a; n <= b; n++ {
+			seen[n-1] = true
+		}
+	}
+
+	indexes := make([]int, 0, len(seen))
+	for idx := range seen {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
+
+// joinRequestPage 计算分页范围，page从1开始，超出范围时取最后一页
+func joinRequestPage(count, page int) (start, end, pages int) {
+	pages = (count + joinRequestsPageSize - 1) / joinRequestsPageSize
+	if pages == 0 {
+		return 0, 0, 0
+	}
+	if page > pages {
+		page = pages
+	}
+	start = (page - 1) * joinRequestsPageSize
+	end = start + joinRequestsPageSize
+	if end > count {
+		end = count
+	}
+	return start, end, pages
+}
+
+// formatJoinRequests 格式化一页入群请求
+func formatJoinRequests(requesters []joinRequester, total, page int, now time.Time) string {
+	if len(requesters) == 0 {
+		return "📭 没有待处理的入群请求"
+	}
+	start, end, pages := joinRequestPage(len(requesters), page)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("📨 入群请求 (%d)", total))
+	if pages > 1 {
+		b.WriteString(fmt.Sprintf(" · 第 %d/%d 页", start/joinRequestsPageSize+1, pages))
+	}
+	b.WriteString("\n")
+	for i := start; i < end; i++ {
+		r := requesters[i]
+		b.WriteString(fmt.Sprintf("\n%d. %s · %s前", i+1, requesterLabel(r), formatRequestAge(now.Sub(r.Date))))
+		if about := strings.TrimSpace(r.About); about != "" {
+			b.WriteString("\n   " + truncateRunes(strings.ReplaceAll(about, "\n", " "), 60))
+		}
+	}
+	if total > len(requesters) {
+		b.WriteString(fmt.Sprintf("\n\n仅显示最近的 %d 个请求", len(requesters)))
+	}
+	b.WriteString("\n\n使用 .requests approve|deny <序号|all> 处理")
+	return b.String()
+}
+
+// requesterLabel 返回申请人的显示名称
+func requesterLabel(r joinRequester) string {
+	label := r.Name
+	if label == "" {
+		label = strconv.FormatInt(r.UserID, 10)
+	}
+	if r.Username != "" {
+		label += " (@" + r.Username + ")"
+	}
+	return label
+}
+
+// formatRequestAge 格式化申请时长
+func formatRequestAge(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%d分钟", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d小时", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d天", int(d.Hours()/24))
+	}
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
+
+// usage 返回用法说明
+func (jp *JoinRequestPlugin) usage() string {
+	return `用法:
+• .requests [页码] - 列出待处理的入群请求
+• .requests approve <序号|all> - 批准请求，序号可写作 3、1,4 或 2-5
+• .requests deny <序号|all> - 拒绝请求
+• .requests auto mutual - 自动通过与我有共同群组的申请人
+• .requests auto off - 关闭自动通过
+超过 20 个请求的批量操作需要在末尾加 confirm`
+}
+
+// sendResponse 发送响应消息
+func (jp *JoinRequestPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
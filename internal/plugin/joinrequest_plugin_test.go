@@ -0,0 +1,528 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/peers"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// joinRequestChat 测试中使用的超级群组
+const joinRequestChat = -1000000000777
+
+// joinRequestBase 申请时间的基准，第i个申请人在此之前i分钟提交
+var joinRequestBase = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// joinRequestServer 模拟入群请求相关的API。申请人按时间从新到旧排列，
+// 分页时返回 offset 之后的请求
+type joinRequestServer struct {
+	mu         sync.Mutex
+	requesters []*tg.ChatInviteImporter
+	users      map[int64]*tg.User
+	common     map[int64]int   // 用户ID -> 共同群组数
+	fail       map[int64]error // 用户ID -> 处理请求时返回的错误，返回一次后清除
+	admin      bool
+	hidden     []*tg.MessagesHideChatJoinRequestRequest
+	hideAll    []*tg.MessagesHideAllChatJoinRequestsRequest
+	pages      []*tg.MessagesGetChatInviteImportersRequest
+}
+
+// newJoinRequestServer 创建有n个待处理请求的服务器，用户ID从1开始
+func newJoinRequestServer(n int) *joinRequestServer {
+	s := &joinRequestServer{users: make(map[int64]*tg.User), common: make(map[int64]int), fail: make(map[int64]error), admin: true}
+	for i := 1; i <= n; i++ {
+		id := int64(i)
+		s.requesters = append(s.requesters, &tg.ChatInviteImporter{
+			UserID:    id,
+			Requested: true,
+			Date:      int(joinRequestBase.Add(-time.Duration(i) * time.Minute).Unix()),
+		})
+		s.users[id] = &tg.User{ID: id, AccessHash: id * 1000, FirstName: fmt.Sprintf("用户%d", i)}
+	}
+	return s
+}
+
+func (s *joinRequestServer) handle(input bin.Encoder, output bin.Decoder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch req := input.(type) {
+	case *tg.ChannelsGetParticipantRequest:
+		var participant tg.ChannelParticipantClass = &tg.ChannelParticipant{UserID: 99}
+		if s.admin {
+			participant = &tg.ChannelParticipantAdmin{UserID: 99}
+		}
+		*output.(*tg.ChannelsChannelParticipant) = tg.ChannelsChannelParticipant{Participant: participant}
+	case *tg.MessagesGetChatInviteImportersRequest:
+		s.pages = append(s.pages, req)
+		start := 0
+		if u, ok := req.OffsetUser.(*tg.InputUser); ok {
+			for i, r := range s.requesters {
+				if r.UserID == u.UserID && r.Date == req.OffsetDate {
+					start = i + 1
+				}
+			}
+		}
+		end := start + req.Limit
+		if end > len(s.requesters) {
+			end = len(s.requesters)
+		}
+		result := output.(*tg.MessagesChatInviteImporters)
+		result.Count = len(s.requesters)
+		for _, r := range s.requesters[start:end] {
+			result.Importers = append(result.Importers, *r)
+			result.Users = append(result.Users, s.users[r.UserID])
+		}
+	case *tg.MessagesHideChatJoinRequestRequest:
+		userID := req.UserID.(*tg.InputUser).UserID
+		if err, ok := s.fail[userID]; ok {
+			delete(s.fail, userID)
+			return err
+		}
+		s.hidden = append(s.hidden, req)
+		s.remove(userID)
+		output.(*tg.UpdatesBox).Updates = &tg.Updates{}
+	case *tg.MessagesHideAllChatJoinRequestsRequest:
+		s.hideAll = append(s.hideAll, req)
+		s.requesters = nil
+		output.(*tg.UpdatesBox).Updates = &tg.Updates{}
+	case *tg.MessagesGetCommonChatsRequest:
+		userID := req.UserID.(*tg.InputUser).UserID
+		if err, ok := s.fail[-userID]; ok {
+			return err
+		}
+		var chats []tg.ChatClass
+		for i := 0; i < s.common[userID] && i < req.Limit; i++ {
+			chats = append(chats, &tg.Chat{ID: int64(500 + i)})
+		}
+		output.(*tg.MessagesChatsBox).Chats = &tg.MessagesChats{Chats: chats}
+	default:
+		return errUnhandled
+	}
+	return nil
+}
+
+// remove 删除已处理的请求，调用方需持有锁
+func (s *joinRequestServer) remove(userID int64) {
+	for i, r := range s.requesters {
+		if r.UserID == userID {
+			s.requesters = append(s.requesters[:i], s.requesters[i+1:]...)
+			return
+		}
+	}
+}
+
+// hiddenUsers 返回已处理请求的用户ID和是否批准
+func (s *joinRequestServer) hiddenUsers() (ids []int64, approved []bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, req := range s.hidden {
+		ids = append(ids, req.UserID.(*tg.InputUser).UserID)
+		approved = append(approved, req.Approved)
+	}
+	return ids, approved
+}
+
+// joinRequestTest 注册了requests命令的插件和测试环境
+type joinRequestTest struct {
+	jp     *JoinRequestPlugin
+	env    *testEnv
+	server *joinRequestServer
+}
+
+func newJoinRequestTest(t *testing.T, server *joinRequestServer) *joinRequestTest {
+	t.Helper()
+	jp := NewJoinRequestPlugin(openPluginDB(t))
+	jp.now = func() time.Time { return joinRequestBase }
+	if err := jp.Initialize(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	env := newTestEnv()
+	env.inv.handle = server.handle
+	jp.SetTelegramClient(tg.NewClient(env.inv), peers.NewResolver(fakePeers{}))
+	if err := jp.RegisterCommands(env.parser); err != nil {
+		t.Fatal(err)
+	}
+	return &joinRequestTest{jp: jp, env: env, server: server}
+}
+
+// run 在测试群组中执行命令，返回命令的响应
+func (jt *joinRequestTest) run(t *testing.T, text string) string {
+	t.Helper()
+	return jt.env.runText(t, &core.MessageEvent{ChatID: joinRequestChat, UserID: 1}, text)
+}
+
+func TestFetchJoinRequestsPagination(t *testing.T) {
+	tests := []struct {
+		pending   int
+		wantCalls int
+		wantCount int
+	}{
+		{0, 1, 0},
+		{7, 1, 7},
+		{100, 2, 100},
+		{250, 3, 250},
+		{700, 5, joinRequestsFetchLimit},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.pending), func(t *testing.T) {
+			server := newJoinRequestServer(tt.pending)
+			inv := &fakeInvoker{handle: server.handle}
+			requesters, total, err := fetchJoinRequests(context.Background(), tg.NewClient(inv), &tg.InputPeerChannel{ChannelID: 777})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != tt.pending || len(requesters) != tt.wantCount || len(server.pages) != tt.wantCalls {
+				t.Fatalf("got %d of total %d in %d calls; want %d in %d calls", len(requesters), total, len(server.pages), tt.wantCount, tt.wantCalls)
+			}
+			// 按时间从新到旧，没有重复或遗漏
+			for i, r := range requesters {
+				if r.UserID != int64(i+1) || r.AccessHash != r.UserID*1000 || r.Name != fmt.Sprintf("用户%d", i+1) {
+					t.Fatalf("requester %d = %+v", i, r)
+				}
+			}
+			// 之后每页以上一页最后一个请求为起点
+			for i, page := range server.pages {
+				if !page.Requested || page.Limit != 100 {
+					t.Errorf("page %d: requested %v limit %d", i, page.Requested, page.Limit)
+				}
+				if i == 0 {
+					if _, ok := page.OffsetUser.(*tg.InputUserEmpty); !ok || page.OffsetDate != 0 {
+						t.Errorf("first page offset = %v, %d", page.OffsetUser, page.OffsetDate)
+					}
+					continue
+				}
+				last := requesters[i*100-1]
+				if u := page.OffsetUser.(*tg.InputUser); u.UserID != last.UserID || u.AccessHash != last.AccessHash || page.OffsetDate != int(last.Date.Unix()) {
+					t.Errorf("page %d offset = %+v @%d, want user %d @%d", i, u, page.OffsetDate, last.UserID, last.Date.Unix())
+				}
+			}
+		})
+	}
+}
+
+func TestJoinRequestPage(t *testing.T) {
+	tests := []struct {
+		count, page            int
+		wantStart, wantEnd, np int
+	}{
+		{0, 1, 0, 0, 0},
+		{5, 1, 0, 5, 1},
+		{10, 1, 0, 10, 1},
+		{11, 1, 0, 10, 2},
+		{11, 2, 10, 11, 2},
+		{25, 2, 10, 20, 3},
+		{25, 3, 20, 25, 3},
+		{25, 9, 20, 25, 3}, // 超出范围时取最后一页
+	}
+	for _, tt := range tests {
+		start, end, pages := joinRequestPage(tt.count, tt.page)
+		if start != tt.wantStart || end != tt.wantEnd || pages != tt.np {
+			t.Errorf("joinRequestPage(%d, %d) = %d, %d, %d; want %d, %d, %d", tt.count, tt.page, start, end, pages, tt.wantStart, tt.wantEnd, tt.np)
+		}
+	}
+}
+
+func TestFormatJoinRequests(t *testing.T) {
+	now := joinRequestBase
+	requesters := []joinRequester{
+		{UserID: 1, Name: "Alice", Username: "alice", About: "第一行\n第二行", Date: now.Add(-5 * time.Minute)},
+		{UserID: 2, Date: now.Add(-3 * time.Hour)},
+		{UserID: 3, Name: "Bob", About: strings.Repeat("长", 70), Date: now.Add(-50 * time.Hour)},
+	}
+	want := "📨 入群请求 (3)\n" +
+		"\n1. Alice (@alice) · 5分钟前\n   第一行 第二行" +
+		"\n2. 2 · 3小时前" +
+		"\n3. Bob · 2天前\n   " + strings.Repeat("长", 60) + "…" +
+		"\n\n使用 .requests approve|deny <序号|all> 处理"
+	if got := formatJoinRequests(requesters, 3, 1, now); got != want {
+		t.Errorf("formatJoinRequests =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := formatJoinRequests(nil, 0, 1, now); got != "📭 没有待处理的入群请求" {
+		t.Errorf("empty = %q", got)
+	}
+
+	// 分页标题、超出获取上限的提示
+	var many []joinRequester
+	for i := 1; i <= 23; i++ {
+		many = append(many, joinRequester{UserID: int64(i), Date: now.Add(-time.Duration(i) * time.Minute)})
+	}
+	page := formatJoinRequests(many, 600, 3, now)
+	if !strings.HasPrefix(page, "📨 入群请求 (600) · 第 3/3 页\n\n21. 21 · 21分钟前\n22. ") {
+		t.Errorf("page 3 =\n%s", page)
+	}
+	if strings.Contains(page, "\n20. ") || !strings.Contains(page, "\n23. 23") || !strings.Contains(page, "仅显示最近的 23 个请求") {
+		t.Errorf("page 3 =\n%s", page)
+	}
+}
+
+func TestParseRequestSelection(t *testing.T) {
+	tests := []struct {
+		arg   string
+		count int
+		want  []int
+		err   string
+	}{
+		{"3", 5, []int{2}, ""},
+		{"1,4", 5, []int{0, 3}, ""},
+		{"2-4", 5, []int{1, 2, 3}, ""},
+		{"4, 1-2,2", 5, []int{0, 1, 3}, ""},
+		{"5-5", 5, []int{4}, ""},
+		{"6", 5, nil, "序号 6 超出范围(共 5 个请求)"},
+		{"2-9", 5, nil, "序号 9 超出范围(共 5 个请求)"},
+		{"0", 5, nil, "无效的序号: 0"},
+		{"4-2", 5, nil, "无效的序号: 4-2"},
+		{"-2", 5, nil, "无效的序号: -2"},
+		{"x", 5, nil, "无效的序号: x"},
+		{"1,", 5, nil, "无效的序号: "},
+		{"1", 0, nil, "没有待处理的入群请求，请先使用 .requests 查看"},
+	}
+	for _, tt := range tests {
+		got, err := parseRequestSelection(tt.arg, tt.count)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("parseRequestSelection(%q, %d) error = %v, want %q", tt.arg, tt.count, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRequestSelection(%q, %d) = %v, %v; want %v", tt.arg, tt.count, got, err, tt.want)
+		}
+	}
+}
+
+func TestRequestsCommandListAndDecide(t *testing.T) {
+	jt := newJoinRequestTest(t, newJoinRequestServer(12))
+
+	page2 := jt.run(t, "requests 2")
+	if !strings.HasPrefix(page2, "📨 入群请求 (12) · 第 2/2 页\n\n11. 用户11 · 11分钟前\n12. 用户12 · 12分钟前") {
+		t.Errorf("page 2 =\n%s", page2)
+	}
+
+	// 序号以列出时为准，处理后不会变化
+	if got := jt.run(t, "requests approve 11"); got != "✅ 已批准 用户11" {
+		t.Errorf("approve 11 = %q", got)
+	}
+	if got := jt.run(t, "requests deny 12"); got != "✅ 已拒绝 用户12" {
+		t.Errorf("deny 12 = %q", got)
+	}
+	ids, approved := jt.server.hiddenUsers()
+	if !reflect.DeepEqual(ids, []int64{11, 12}) || !reflect.DeepEqual(approved, []bool{true, false}) {
+		t.Errorf("hidden = %v %v", ids, approved)
+	}
+	if req := jt.server.hidden[0]; req.UserID.(*tg.InputUser).AccessHash != 11000 {
+		t.Errorf("approve used access hash %d", req.UserID.(*tg.InputUser).AccessHash)
+	}
+
+	jt.server.fail[3] = tgerr.New(400, "USER_CHANNELS_TOO_MUCH")
+	if got := jt.run(t, "requests approve 3"); !strings.HasPrefix(got, "❌ 批准 用户3 失败: ") || !strings.Contains(got, "USER_CHANNELS_TOO_MUCH") {
+		t.Errorf("failed approve = %q", got)
+	}
+	if got := jt.run(t, "requests approve 13"); got != "❌ 序号 13 超出范围(共 12 个请求)" {
+		t.Errorf("out of range = %q", got)
+	}
+}
+
+func TestRequestsCommandBulkConfirmation(t *testing.T) {
+	jt := newJoinRequestTest(t, newJoinRequestServer(25))
+
+	// 超过20个的批量操作需要确认
+	if got := jt.run(t, "requests approve all"); got != "⚠️ 将批准全部 25 个入群请求，确认请发送 .requests approve all confirm" {
+		t.Errorf("approve all = %q", got)
+	}
+	if got := jt.run(t, "requests deny 1-21"); got != "⚠️ 将拒绝 21 个入群请求，确认请发送 .requests deny 1-21 confirm" {
+		t.Errorf("deny 1-21 = %q", got)
+	}
+	if len(jt.server.hidden) != 0 || len(jt.server.hideAll) != 0 {
+		t.Fatal("nothing should be hidden before confirmation")
+	}
+
+	if got := jt.run(t, "requests approve all confirm"); got != "✅ 已批准全部 25 个入群请求" {
+		t.Errorf("approve all confirm = %q", got)
+	}
+	if len(jt.server.hideAll) != 1 || !jt.server.hideAll[0].Approved {
+		t.Errorf("hideAll = %+v", jt.server.hideAll)
+	}
+	if got := jt.run(t, "requests deny all"); got != "📭 没有待处理的入群请求" {
+		t.Errorf("deny all with nothing pending = %q", got)
+	}
+}
+
+func TestRequestsCommandChecks(t *testing.T) {
+	server := newJoinRequestServer(3)
+	jt := newJoinRequestTest(t, server)
+
+	if got := jt.env.runText(t, &core.MessageEvent{ChatID: 42, UserID: 1}, "requests"); got != "❌ 请在群组中使用此命令" {
+		t.Errorf("private chat = %q", got)
+	}
+
+	server.admin = false
+	if got := jt.run(t, "requests"); got != "❌ 权限不足，需要管理员权限才能管理入群请求" {
+		t.Errorf("not admin = %q", got)
+	}
+	if len(server.pages) != 0 {
+		t.Error("requests should not be fetched without admin rights")
+	}
+	server.admin = true
+	if got := jt.run(t, "requests nope"); got != jt.jp.usage() {
+		t.Errorf("unknown argument = %q", got)
+	}
+}
+
+func TestHideJoinRequestsReportsEachItem(t *testing.T) {
+	server := newJoinRequestServer(4)
+	server.fail[2] = tgerr.New(400, "HIDE_REQUESTER_MISSING")
+	server.fail[3] = tgerr.New(420, "FLOOD_WAIT_1") // 等待后重试成功
+	inv := &fakeInvoker{handle: server.handle}
+	requesters, _, _ := fetchJoinRequests(context.Background(), tg.NewClient(inv), &tg.InputPeerChannel{ChannelID: 777})
+
+	var progress []string
+	report := func(done, total int, note string) {
+		progress = append(progress, fmt.Sprintf("%d/%d %s", done, total, note))
+	}
+	got := hideJoinRequests(context.Background(), tg.NewClient(inv), &tg.InputPeerChannel{ChannelID: 777}, requesters[:3], true, report)
+	if !strings.HasPrefix(got, "成功 2 · 失败 1\n✅ 用户1\n❌ 用户2: ") || !strings.HasSuffix(got, "\n✅ 用户3") {
+		t.Errorf("result =\n%s", got)
+	}
+	want := []string{"0/3 ", "1/3 ", "2/3 ", "2/3 请求过于频繁，等待 1s", "3/3 "}
+	if !reflect.DeepEqual(progress, want) {
+		t.Errorf("progress = %q, want %q", progress, want)
+	}
+	if ids, _ := server.hiddenUsers(); !reflect.DeepEqual(ids, []int64{1, 3}) {
+		t.Errorf("hidden = %v", ids)
+	}
+}
+
+func TestHideJoinRequestsStopsOnLongFloodWait(t *testing.T) {
+	server := newJoinRequestServer(3)
+	server.fail[1] = tgerr.New(420, "FLOOD_WAIT_120")
+	inv := &fakeInvoker{handle: server.handle}
+	requesters, _, _ := fetchJoinRequests(context.Background(), tg.NewClient(inv), &tg.InputPeerChannel{ChannelID: 777})
+
+	got := hideJoinRequests(context.Background(), tg.NewClient(inv), &tg.InputPeerChannel{ChannelID: 777}, requesters, false, func(int, int, string) {})
+	if got != "成功 0 · 失败 0\n⏸️ 需要等待 2m0s，已停止，剩余 3 个未处理" {
+		t.Errorf("result = %q", got)
+	}
+
+	// 取消后不再处理剩余的请求
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := hideJoinRequests(ctx, tg.NewClient(inv), &tg.InputPeerChannel{ChannelID: 777}, requesters, false, func(int, int, string) {}); got != "成功 0 · 失败 0\n" {
+		t.Errorf("cancelled result = %q", got)
+	}
+	if len(server.hidden) != 0 {
+		t.Errorf("hidden %d requests, want none", len(server.hidden))
+	}
+}
+
+func TestJoinRuleAllows(t *testing.T) {
+	tests := []struct {
+		rule   string
+		common int
+		want   bool
+	}{
+		{joinRuleMutual, 0, false},
+		{joinRuleMutual, 1, true},
+		{joinRuleMutual, 5, true},
+		{"", 3, false},
+		{"unknown", 3, false},
+	}
+	for _, tt := range tests {
+		if got := joinRuleAllows(tt.rule, tt.common); got != tt.want {
+			t.Errorf("joinRuleAllows(%q, %d) = %v, want %v", tt.rule, tt.common, got, tt.want)
+		}
+	}
+}
+
+func TestApplyMutualRule(t *testing.T) {
+	server := newJoinRequestServer(3)
+	server.common[1] = 0
+	server.common[2] = 3
+	server.fail[-3] = tgerr.New(400, "USER_ID_INVALID") // 获取共同群组失败时跳过
+	jt := newJoinRequestTest(t, server)
+
+	jt.jp.applyRule(context.Background(), joinRequestChat, joinRuleMutual)
+	ids, approved := server.hiddenUsers()
+	if !reflect.DeepEqual(ids, []int64{2}) || !approved[0] {
+		t.Errorf("auto-approved %v %v, want only user 2", ids, approved)
+	}
+
+	// 共同群组只需要查询1个
+	for _, req := range requests[*tg.MessagesGetCommonChatsRequest](jt.env.inv) {
+		if req.Limit != 1 {
+			t.Errorf("getCommonChats limit = %d, want 1", req.Limit)
+		}
+	}
+}
+
+// waitHidden 等待后台评估处理了n个请求
+func waitHidden(t *testing.T, server *joinRequestServer, n int) []int64 {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ids, _ := server.hiddenUsers()
+		if len(ids) >= n || time.Now().After(deadline) {
+			return ids
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAutoRuleEvaluatedOnUpdate(t *testing.T) {
+	server := newJoinRequestServer(2)
+	server.common[2] = 1
+	jt := newJoinRequestTest(t, server)
+	update := &tg.UpdatePendingJoinRequests{Peer: &tg.PeerChannel{ChannelID: 777}, RequestsPending: 2}
+
+	// 没有规则时不处理
+	if err := jt.jp.onUpdate(context.Background(), update); err != nil {
+		t.Fatal(err)
+	}
+	if got := jt.run(t, "requests auto"); got != "当前对话未设置自动通过规则" {
+		t.Errorf("auto without rule = %q", got)
+	}
+
+	if got := jt.run(t, "requests auto mutual"); got != "✅ 已开启自动通过: 与我至少有一个共同群组的申请人" {
+		t.Errorf("auto mutual = %q", got)
+	}
+	// 没有待处理请求和其他对话的更新不触发评估
+	jt.jp.onUpdate(context.Background(), &tg.UpdatePendingJoinRequests{Peer: &tg.PeerChannel{ChannelID: 777}})
+	jt.jp.onUpdate(context.Background(), &tg.UpdatePendingJoinRequests{Peer: &tg.PeerChannel{ChannelID: 888}, RequestsPending: 1})
+	if len(requests[*tg.MessagesGetChatInviteImportersRequest](jt.env.inv)) != 0 {
+		t.Fatal("rule should not be evaluated without pending requests in the ruled chat")
+	}
+
+	if err := jt.jp.onUpdate(context.Background(), update); err != nil {
+		t.Fatal(err)
+	}
+	if ids := waitHidden(t, server, 1); !reflect.DeepEqual(ids, []int64{2}) {
+		t.Errorf("auto-approved %v, want [2]", ids)
+	}
+
+	// 规则在重启后保留
+	restarted := NewJoinRequestPlugin(jt.jp.db)
+	if err := restarted.Initialize(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.rules[joinRequestChat] != joinRuleMutual {
+		t.Errorf("rules after restart = %v", restarted.rules)
+	}
+
+	if got := jt.run(t, "requests auto off"); got != "✅ 已关闭自动通过" {
+		t.Errorf("auto off = %q", got)
+	}
+	restarted = NewJoinRequestPlugin(jt.jp.db)
+	restarted.Initialize(context.Background(), nil)
+	if len(restarted.rules) != 0 {
+		t.Errorf("rules after off = %v", restarted.rules)
+	}
+}
@@ -0,0 +1,231 @@
+package plugin
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/stickerpack"
+	"nexusvalet/pkg/logger"
+	"strings"
+
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// kangMaxRolls 一次添加中最多尝试的贴纸包数量(已满或短名称被占用时换下一个)
+const kangMaxRolls = 5
+
+// kangItem 要添加到贴纸包的贴纸
+type kangItem struct {
+	Document tg.InputDocumentClass
+	Emoji    string
+}
+
+// initKangDatabase 创建自动管理的贴纸包表
+func (sp *StickerPlugin) initKangDatabase() error {
+	_, err := sp.db.Exec(`
+	CREATE TABLE IF NOT EXISTS sticker_kang (
+		short_name TEXT PRIMARY KEY,
+		pack_index INTEGER NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// handleKang 处理kang命令：把回复的贴纸或图片添加到自己的贴纸包，贴纸包满时自动创建下一个
+func (sp *StickerPlugin) handleKang(ctx *command.CommandContext) error {
+	msg, err := fetchReplyMessage(ctx)
+	if err != nil {
+		return sp.sendResponse(ctx, "请回复一张贴纸或图片。")
+	}
+	emoji := ""
+	if len(ctx.Args) > 0 {
+		emoji = strings.Join(ctx.Args, "")
+	}
+
+	if err := sp.sendResponse(ctx, "正在添加贴纸..."); err != nil {
+		logger.Warnf("发送状态消息失败: %v", err)
+	}
+	item, err := sp.kangItemFromMessage(ctx, msg, emoji)
+	if err != nil {
+		return sp.sendResponse(ctx, fmt.Sprintf("❌ %v", err))
+	}
+
+	users, err := ctx.API.UsersGetUsers(ctx.Context, []tg.InputUserClass{&tg.InputUserSelf{}})
+	if err != nil || len(users) == 0 {
+		return sp.sendResponse(ctx, fmt.Sprintf("❌ 获取账号信息失败: %v", err))
+	}
+	self, ok := users[0].(*tg.User)
+	if !ok {
+		return sp.sendResponse(ctx, "❌ 获取账号信息失败")
+	}
+
+	shortName, err := sp.kangAdd(ctx, self, item)
+	if err != nil {
+		return sp.sendResponse(ctx, fmt.Sprintf("❌ 添加贴纸失败: %v", err))
+	}
+	return sp.sendResponse(ctx, fmt.Sprintf("✅ 已添加到贴纸包 %s\nhttps://t.me/addstickers/%s", item.Emoji, shortName))
+}
+
+// kangItemFromMessage 从消息中取出贴纸：贴纸直接使用原文件，
+// 照片和图片文件缩放为512像素的PNG后上传
+func (sp *StickerPlugin) kangItemFromMessage(ctx *command.CommandContext, msg *tg.Message, emoji string) (*kangItem, error) {
+	if media, ok := msg.Media.(*tg.MessageMediaDocument); ok {
+		if doc, ok := media.Document.(*tg.Document); ok {
+			for _, attr := range doc.Attributes {
+				if sticker, ok := attr.(*tg.DocumentAttributeSticker); ok {
+					if emoji == "" {
+						emoji = sticker.Alt
+					}
+					return &kangItem{Document: doc.AsInput(), Emoji: kangEmoji(emoji)}, nil
+				}
+			}
+		}
+	}
+	if !hasImage(msg) {
+		return nil, fmt.Errorf("请回复一张贴纸或图片")
+	}
+
+	var buf bytes.Buffer
+	file, _, err := downloadMessageMedia(ctx, msg, &buf, nil)
+	if err != nil {
+		return nil, fmt.Errorf("下载图片失败: %w", err)
+	}
+	sticker, err := stickerpack.Normalize(file.Name, buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("转换图片失败: %w", err)
+	}
+
+	uploaded, err := uploader.NewUploader(ctx.API).FromBytes(ctx.Context, sticker.FileName, sticker.Data)
+	if err != nil {
+		return nil, fmt.Errorf("上传文件失败: %w", err)
+	}
+	media, err := ctx.API.MessagesUploadMedia(ctx.Context, &tg.MessagesUploadMediaRequest{
+		Peer: &tg.InputPeerSelf{},
+		Media: &tg.InputMediaUploadedDocument{
+			File:       uploaded,
+			MimeType:   sticker.MimeType,
+			ForceFile:  true,
+			Attributes: []tg.DocumentAttributeClass{&tg.DocumentAttributeFilename{FileName: sticker.FileName}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("上传文件失败: %w", err)
+	}
+	docMedia, ok := media.(*tg.MessageMediaDocument)
+	if !ok {
+		return nil, fmt.Errorf("上传文件失败: 意外的响应类型 %T", media)
+	}
+	doc, ok := docMedia.Document.(*tg.Document)
+	if !ok {
+		return nil, fmt.Errorf("上传文件失败: 没有返回文件")
+	}
+	return &kangItem{Document: doc.AsInput(), Emoji: kangEmoji(emoji)}, nil
+}
+
+// kangEmoji 返回贴纸的emoji，没有时使用默认emoji
+func kangEmoji(emoji string) string {
+	if emoji == "" {
+		return stickerpack.DefaultEmoji
+	}
+	return emoji
+}
+
+// kangAdd 把贴纸添加到最新的贴纸包。贴纸包已满或短名称被占用时换用下一个序号，
+// 贴纸包被删除时重新创建。返回贴纸包的短名称
+func (sp *StickerPlugin) kangAdd(ctx *command.CommandContext, self *tg.User, item *kangItem) (string, error) {
+	index, exists, err := sp.lastKangPack()
+	if err != nil {
+		return "", err
+	}
+	sticker := tg.InputStickerSetItem{Document: item.Document, Emoji: item.Emoji}
+
+	for roll := 0; roll < kangMaxRolls; roll++ {
+		shortName := kangShortName(self, index)
+		if !exists {
+			_, err := ctx.API.StickersCreateStickerSet(ctx.Context, &tg.StickersCreateStickerSetRequest{
+				UserID:    &tg.InputUserSelf{},
+				Title:     kangTitle(self, index),
+				ShortName: shortName,
+				Stickers:  []tg.InputStickerSetItem{sticker},
+			})
+			if tgerr.Is(err, "SHORTNAME_OCCUPY_FAILED", "STICKER_SHORTNAME_INVALID") {
+				logger.Infof("Sticker pack short name %s is taken, trying next", shortName)
+				index++
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			if _, err := sp.db.Exec("INSERT OR REPLACE INTO sticker_kang (short_name, pack_index, count) VALUES (?, ?, 1)", shortName, index); err != nil {
+				logger.Warnf("Failed to save kang pack %s: %v", shortName, err)
+			}
+			return shortName, nil
+		}
+
+		_, err := ctx.API.StickersAddStickerToSet(ctx.Context, &tg.StickersAddStickerToSetRequest{
+			Stickerset: &tg.InputStickerSetShortName{ShortName: shortName},
+			Sticker:    sticker,
+		})
+		switch {
+		case tgerr.Is(err, "STICKERS_TOO_MUCH", "STICKERPACK_STICKERS_TOO_MUCH"):
+			logger.Infof("Sticker pack %s is full, rolling to next pack", shortName)
+			index, exists = index+1, false
+			continue
+		case tgerr.Is(err, "STICKERSET_INVALID"):
+			// 贴纸包已在Telegram中删除，使用同一个短名称重新创建
+			if _, err := sp.db.Exec("DELETE FROM sticker_kang WHERE short_name = ?", shortName); err != nil {
+				logger.Warnf("Failed to delete kang pack %s: %v", shortName, err)
+			}
+			exists = false
+			continue
+		case err != nil:
+			return "", err
+		}
+		if _, err := sp.db.Exec("UPDATE sticker_kang SET count = count + 1 WHERE short_name = ?", shortName); err != nil {
+			logger.Warnf("Failed to update kang pack %s: %v", shortName, err)
+		}
+		return shortName, nil
+	}
+	return "", fmt.Errorf("连续 %d 个贴纸包都无法使用", kangMaxRolls)
+}
+
+// lastKangPack 返回最新的贴纸包序号，没有时为1且exists为false
+func (sp *StickerPlugin) lastKangPack() (index int, exists bool, err error) {
+	err = sp.db.QueryRow("SELECT pack_index FROM sticker_kang ORDER BY pack_index DESC LIMIT 1").Scan(&index)
+	if err == sql.ErrNoRows {
+		return 1, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("读取贴纸包记录失败: %w", err)
+	}
+	return index, true, nil
+}
+
+// kangShortName 贴纸包短名称：用户名_pack_序号，没有用户名时使用 u用户ID
+func kangShortName(self *tg.User, index int) string {
+	owner := self.Username
+	if owner == "" {
+		owner = fmt.Sprintf("u%d", self.ID)
+	}
+	return fmt.Sprintf("%s_pack_%d", owner, index)
+}
+
+// kangTitle 贴纸包标题
+func kangTitle(self *tg.User, index int) string {
+	owner := self.FirstName
+	if self.Username != "" {
+		owner = "@" + self.Username
+	}
+	title := fmt.Sprintf("%s 的贴纸包", owner)
+	if index > 1 {
+		title = fmt.Sprintf("%s %d", title, index)
+	}
+	if runes := []rune(title); len(runes) > 64 {
+		title = string(runes[:64])
+	}
+	return title
+}
@@ -0,0 +1,97 @@
+package plugin
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Limits 当前账号适用的Telegram限制
+type Limits struct {
+	MaxCaptionLength int   // 媒体说明最大字符数
+	MaxUploadSize    int64 // 单个文件最大字节数
+	MaxAboutLength   int   // 个人简介最大字符数
+	SavedGifCap      int   // 已保存GIF数量上限
+}
+
+var (
+	// standardLimits 普通账号的限制
+	standardLimits = Limits{
+		MaxCaptionLength: 1024,
+		MaxUploadSize:    2000 << 20,
+		MaxAboutLength:   70,
+		SavedGifCap:      200,
+	}
+	// premiumLimits Premium账号的限制
+	premiumLimits = Limits{
+		MaxCaptionLength: 4096,
+		MaxUploadSize:    4000 << 20,
+		MaxAboutLength:   140,
+		SavedGifCap:      400,
+	}
+)
+
+// accountPremium 当前账号是否为Premium，连接时及自身用户信息变化时更新
+var accountPremium atomic.Bool
+
+// LimitsFor 返回对应账号类型的限制
+func LimitsFor(premium bool) Limits {
+	if premium {
+		return premiumLimits
+	}
+	return standardLimits
+}
+
+// currentLimits 返回当前账号的限制
+func currentLimits() Limits {
+	return LimitsFor(accountPremium.Load())
+}
+
+// limitError 超出限制的错误，说明当前限制以及Premium是否可以放宽
+func limitError(what string, actual, limit, premiumLimit int64, format func(int64) string) error {
+	if accountPremium.Load() || premiumLimit <= limit {
+		return fmt.Errorf("%s超出当前账号限制: %s / %s", what, format(actual), format(limit))
+	}
+	hint := "Premium账号也不支持"
+	if actual <= premiumLimit {
+		hint = "Premium账号可支持"
+	}
+	return fmt.Errorf("%s超出当前账号限制: %s / %s (Premium上限 %s，%s)", what, format(actual), format(limit), format(premiumLimit), hint)
+}
+
+// checkUploadSize 检查上传大小是否超出当前账号限制
+func checkUploadSize(size int64) error {
+	limits := currentLimits()
+	if size <= limits.MaxUploadSize {
+		return nil
+	}
+	return limitError("文件大小", size, limits.MaxUploadSize, premiumLimits.MaxUploadSize, formatBytes)
+}
+
+// trimCaption 将说明截断到当前账号允许的长度
+func trimCaption(caption string) string {
+	limit := currentLimits().MaxCaptionLength
+	runes := []rune(caption)
+	if len(runes) <= limit {
+		return caption
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// formatLimits 格式化账号类型和生效限制，用于 .status
+func formatLimits() string {
+	limits := currentLimits()
+	account := "普通账号"
+	if accountPremium.Load() {
+		account = "Premium"
+	}
+	return fmt.Sprintf("%s (说明 %d 字, 上传 %s, 简介 %d 字, 已保存GIF %d)",
+		account, limits.MaxCaptionLength, formatBytes(limits.MaxUploadSize), limits.MaxAboutLength, limits.SavedGifCap)
+}
+
+// formatBytes 以MiB/GiB格式化字节数
+func formatBytes(n int64) string {
+	if n >= 1<<30 {
+		return fmt.Sprintf("%.1fGiB", float64(n)/float64(1<<30))
+	}
+	return fmt.Sprintf("%.1fMiB", float64(n)/float64(1<<20))
+}
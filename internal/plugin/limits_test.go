@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"context"
+	"nexusvalet/internal/command"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gotd/td/tg"
+)
+
+// setPremium 在测试期间切换账号的Premium状态
+func setPremium(t *testing.T, premium bool) {
+	t.Helper()
+	old := accountPremium.Swap(premium)
+	t.Cleanup(func() { accountPremium.Store(old) })
+}
+
+func TestSendDocumentCaptionFollowsPremium(t *testing.T) {
+	caption := strings.Repeat("说", 3000)
+	tests := []struct {
+		premium bool
+		want    int
+	}{
+		{false, standardLimits.MaxCaptionLength},
+		{true, 3000}, // 未超过Premium上限，不截断
+	}
+	for _, tt := range tests {
+		setPremium(t, tt.premium)
+		inv := &fakeInvoker{}
+		ctx := &command.CommandContext{Context: context.Background(), API: tg.NewClient(inv)}
+		err := sendDocument(ctx, &tg.InputPeerSelf{}, MediaUpload{
+			FileName:     "a.txt",
+			Data:         []byte("data"),
+			MimeType:     "text/plain",
+			Caption:      caption,
+			KeepOriginal: true,
+		})
+		if err != nil {
+			t.Fatalf("premium=%v: sendDocument: %v", tt.premium, err)
+		}
+		sent := requests[*tg.MessagesSendMediaRequest](inv)
+		if len(sent) != 1 {
+			t.Fatalf("premium=%v: got %d sendMedia requests", tt.premium, len(sent))
+		}
+		if n := utf8.RuneCountInString(sent[0].Message); n != tt.want {
+			t.Errorf("premium=%v: caption has %d runes, want %d", tt.premium, n, tt.want)
+		}
+	}
+}
+
+func TestTrimCaption(t *testing.T) {
+	setPremium(t, false)
+	exact := strings.Repeat("a", 1024)
+	if got := trimCaption(exact); got != exact {
+		t.Error("caption at the limit should not be trimmed")
+	}
+	got := trimCaption(strings.Repeat("😀", 1500))
+	if n := utf8.RuneCountInString(got); n != 1024 || !strings.HasSuffix(got, "…") {
+		t.Errorf("trimmed caption has %d runes, suffix %q", n, got[len(got)-3:])
+	}
+
+	accountPremium.Store(true)
+	long := strings.Repeat("a", 4097)
+	if n := utf8.RuneCountInString(trimCaption(long)); n != premiumLimits.MaxCaptionLength {
+		t.Errorf("premium caption has %d runes, want %d", n, premiumLimits.MaxCaptionLength)
+	}
+}
+
+func TestCheckUploadSize(t *testing.T) {
+	setPremium(t, false)
+	if err := checkUploadSize(standardLimits.MaxUploadSize); err != nil {
+		t.Errorf("upload at the standard limit: %v", err)
+	}
+	err := checkUploadSize(3000 << 20)
+	if err == nil || !strings.Contains(err.Error(), "Premium账号可支持") {
+		t.Errorf("3000MiB upload on standard account: err = %v, want Premium hint", err)
+	}
+	err = checkUploadSize(5000 << 20)
+	if err == nil || !strings.Contains(err.Error(), "Premium账号也不支持") {
+		t.Errorf("5000MiB upload on standard account: err = %v", err)
+	}
+
+	accountPremium.Store(true)
+	if err := checkUploadSize(3000 << 20); err != nil {
+		t.Errorf("3000MiB upload on premium account: %v", err)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0.0MiB"},
+		{5 << 20, "5.0MiB"},
+		{1000 << 20, "1000.0MiB"},
+		{1 << 30, "1.0GiB"},
+		{2000 << 20, "2.0GiB"},
+		{4000 << 20, "3.9GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultLogLines .logs 默认显示的日志行数
+	defaultLogLines = 50
+	// maxLogLines .logs 最多显示的日志行数，与内存中保留的行数相同
+	maxLogLines = 500
+)
+
+// handleLogs 处理logs命令：.logs [行数] [模块] 显示最近的日志，超过单条消息长度时作为文件发送
+func (cp *CoreCommandsPlugin) handleLogs(ctx *command.CommandContext) error {
+	n, module := defaultLogLines, ""
+	for _, arg := range ctx.Args {
+		if v, err := strconv.Atoi(arg); err == nil {
+			n = v
+		} else {
+			module = arg
+		}
+	}
+	if n <= 0 || n > maxLogLines {
+		return cp.sendResponse(ctx, fmt.Sprintf("用法: .logs [行数(1-%d)] [模块]", maxLogLines))
+	}
+
+	lines := logger.Recent(n, module)
+	if len(lines) == 0 {
+		if module != "" {
+			return cp.sendResponse(ctx, fmt.Sprintf("📜 没有模块 %s 的日志", module))
+		}
+		return cp.sendResponse(ctx, "📜 没有日志")
+	}
+
+	var body strings.Builder
+	for _, line := range lines {
+		body.WriteString(line.String())
+		body.WriteString("\n")
+	}
+	header := fmt.Sprintf("📜 最近 %d 行日志", len(lines))
+	if module != "" {
+		header = fmt.Sprintf("📜 模块 %s 最近 %d 行日志", module, len(lines))
+	}
+
+	text := header + "\n\n" + strings.TrimRight(body.String(), "\n")
+	if utf16Len(text) <= format.MaxMessageLength {
+		return cp.sendResponse(ctx, text)
+	}
+
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+	if err := sendDocument(ctx, peer, MediaUpload{
+		FileName:     "logs-" + time.Now().Format("20060102-150405") + ".txt",
+		Data:         []byte(body.String()),
+		MimeType:     "text/plain",
+		Caption:      header,
+		ReplyTo:      replyTargetFromContext(ctx),
+		KeepOriginal: true,
+	}); err != nil {
+		return cp.sendResponse(ctx, "❌ "+err.Error())
+	}
+	return deleteCommandMessage(ctx, peer)
+}
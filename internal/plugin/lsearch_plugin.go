@@ -0,0 +1,242 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/search"
+	"nexusvalet/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// lsearchMaxResults 单次搜索显示的结果数
+const lsearchMaxResults = 10
+
+// LSearchPlugin 本地消息全文索引插件
+type LSearchPlugin struct {
+	*BasePlugin
+	db     *sql.DB
+	index  *search.Index
+	parser *command.Parser
+}
+
+// NewLSearchPlugin 创建本地搜索插件
+func NewLSearchPlugin(db *sql.DB) *LSearchPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "lsearch",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "本地消息索引与全文搜索",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &LSearchPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+	}
+}
+
+// Initialize 初始化插件
+func (lp *LSearchPlugin) Initialize(ctx context.Context, manager interface{}) error {
+	if err := lp.BasePlugin.Initialize(ctx, manager); err != nil {
+		return err
+	}
+
+	index, err := search.NewIndex(lp.db, search.DefaultChatCap)
+	if err != nil {
+		return fmt.Errorf("failed to initialize search index: %w", err)
+	}
+	lp.index = index
+	lp.index.Run()
+
+	logger.Infof("LSearch plugin initialized successfully")
+	return nil
+}
+
+// Shutdown 关闭插件
+func (lp *LSearchPlugin) Shutdown(ctx context.Context) error {
+	if lp.index != nil {
+		lp.index.Stop()
+	}
+	return lp.BasePlugin.Shutdown(ctx)
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (lp *LSearchPlugin) RegisterCommands(parser *command.Parser) error {
+	lp.parser = parser
+	parser.RegisterCommand("lsearch", "在本地索引中搜索当前对话的消息", lp.info.Name, lp.handleLSearch)
+	logger.Infof("LSearch commands registered successfully")
+	return nil
+}
+
+// RegisterEventHandlers 实现EventPlugin接口，将启用对话的新消息加入索引队列
+func (lp *LSearchPlugin) RegisterEventHandlers(dispatcher *core.EventDispatcher) error {
+	dispatcher.RegisterRawListener("lsearch_indexer", lp.handleRawUpdate, 10)
+	return nil
+}
+
+// handleRawUpdate 处理新消息和编辑消息更新
+func (lp *LSearchPlugin) handleRawUpdate(ctx context.Context, event interface{}) error {
+	var msg tg.MessageClass
+	edited := false
+	switch update := event.(type) {
+	case *tg.UpdateNewMessage:
+		msg = update.Message
+	case *tg.UpdateNewChannelMessage:
+		msg = update.Message
+	case *tg.UpdateEditMessage:
+		msg, edited = update.Message, true
+	case *tg.UpdateEditChannelMessage:
+		msg, edited = update.Message, true
+	default:
+		return nil
+	}
+
+	m, ok := msg.(*tg.Message)
+	if !ok || m.Message == "" {
+		return nil
+	}
+
+	// 不索引自己发出的命令，命令消息随后会被编辑为命令输出
+	if m.Out && lp.parser != nil && lp.parser.IsCommand(m.Message) {
+		return nil
+	}
+
+	lp.index.Enqueue(search.Doc{
+		ChatID:   peerToChatID(m.PeerID),
+		MsgID:    m.ID,
+		SenderID: messageSenderID(m),
+		Date:     time.Unix(int64(m.Date), 0),
+		Text:     m.Message,
+		Edited:   edited,
+	})
+	return nil
+}
+
+// messageSenderID 返回消息发送者ID；私聊中自己发出的消息没有FromID，返回0
+func messageSenderID(m *tg.Message) int64 {
+	if m.FromID != nil {
+		return peerToChatID(m.FromID)
+	}
+	if m.Out {
+		return 0
+	}
+	return peerToChatID(m.PeerID)
+}
+
+// handleLSearch 处理lsearch命令
+func (lp *LSearchPlugin) handleLSearch(ctx *command.CommandContext) error {
+	if len(ctx.Args) == 0 {
+		return lp.sendResponse(ctx, `用法:
+• .lsearch enable - 为当前对话启用本地索引
+• .lsearch disable - 禁用并删除当前对话的索引
+• .lsearch status - 查看索引状态
+• .lsearch <关键词> [sender:<ID|@用户名>] [after:YYYY-MM-DD] [before:YYYY-MM-DD] - 搜索`)
+	}
+
+	chatID := ctx.Message.ChatID
+	switch ctx.Args[0] {
+	case "enable":
+		if err := lp.index.Enable(chatID); err != nil {
+			return lp.sendResponse(ctx, fmt.Sprintf("❌ 启用索引失败: %v", err))
+		}
+		return lp.sendResponse(ctx, "✅ 已为当前对话启用本地索引，之后的新消息会被索引")
+	case "disable":
+		if err := lp.index.Disable(chatID); err != nil {
+			return lp.sendResponse(ctx, fmt.Sprintf("❌ 禁用索引失败: %v", err))
+		}
+		return lp.sendResponse(ctx, "✅ 已禁用当前对话的本地索引并删除索引数据")
+	case "status":
+		if !lp.index.Enabled(chatID) {
+			return lp.sendResponse(ctx, "当前对话未启用本地索引")
+		}
+		count, err := lp.index.Count(chatID)
+		if err != nil {
+			return lp.sendResponse(ctx, fmt.Sprintf("❌ 查询失败: %v", err))
+		}
+		return lp.sendResponse(ctx, fmt.Sprintf("🔎 当前对话已索引 %d 条消息 (上限 %d)", count, search.DefaultChatCap))
+	}
+
+	if !lp.index.Enabled(chatID) {
+		return lp.sendResponse(ctx, "当前对话未启用本地索引，请先使用 .lsearch enable")
+	}
+
+	query, err := search.ParseQuery(strings.Join(ctx.Args, " "))
+	if err != nil {
+		return lp.sendResponse(ctx, "❌ "+err.Error())
+	}
+
+	var senderID int64
+	if query.Sender != "" {
+		senderID, err = lp.resolveSender(ctx, query.Sender)
+		if err != nil {
+			return lp.sendResponse(ctx, "❌ "+err.Error())
+		}
+	}
+
+	hits, err := lp.index.Search(chatID, query, senderID, lsearchMaxResults)
+	if err != nil {
+		return lp.sendResponse(ctx, fmt.Sprintf("❌ 搜索失败: %v", err))
+	}
+	if len(hits) == 0 {
+		return lp.sendResponse(ctx, "🔎 没有找到匹配的消息")
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🔎 找到 %d 条结果:\n", len(hits)))
+	for _, hit := range hits {
+		sender := "我"
+		if hit.SenderID != 0 {
+			sender = strconv.FormatInt(hit.SenderID, 10)
+		}
+		if hit.Sender != "" {
+			sender = hit.Sender
+		}
+		b.WriteString(fmt.Sprintf("\n• [%s] %s: %s", hit.Date.Format("2006-01-02 15:04"), sender, hit.Snippet))
+		if link := messageLink(chatID, hit.MsgID); link != "" {
+			b.WriteString("\n  " + link)
+		}
+	}
+	return lp.sendResponse(ctx, b.String())
+}
+
+// resolveSender 解析 sender: 过滤条件
+func (lp *LSearchPlugin) resolveSender(ctx *command.CommandContext, sender string) (int64, error) {
+	if id, err := strconv.ParseInt(sender, 10, 64); err == nil {
+		return id, nil
+	}
+
+	username := strings.TrimPrefix(sender, "@")
+	resolved, err := resolveUsername(ctx.Context, ctx.API, username)
+	if err != nil {
+		return 0, fmt.Errorf("无法解析用户 @%s: %v", username, err)
+	}
+	if peer, ok := resolved.Peer.(*tg.PeerUser); ok {
+		return peer.UserID, nil
+	}
+	return peerToChatID(resolved.Peer), nil
+}
+
+// messageLink 返回消息的t.me链接，只有超级群组和频道有链接
+func messageLink(chatID int64, msgID int) string {
+	if chatID > -1000000000000 {
+		return ""
+	}
+	return fmt.Sprintf("https://t.me/c/%d/%d", -1000000000000-chatID, msgID)
+}
+
+// sendResponse 发送响应消息
+func (lp *LSearchPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,276 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/maintenance"
+	"nexusvalet/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaintenancePlugin 维护窗口管理插件
+type MaintenancePlugin struct {
+	*BasePlugin
+}
+
+// NewMaintenancePlugin 创建维护窗口插件
+func NewMaintenancePlugin() *MaintenancePlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "maintenance",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "维护窗口，在指定时段内静默非关键的自动化消息",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &MaintenancePlugin{
+		BasePlugin: NewBasePlugin(info),
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (mp *MaintenancePlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("maintenance", "维护窗口管理", mp.info.Name, mp.handleMaintenance)
+	parser.RegisterCommand("mt", "maintenance简写命令", mp.info.Name, mp.handleMaintenance)
+	logger.Infof("Maintenance commands registered successfully")
+	return nil
+}
+
+// gate 获取维护窗口服务
+func (mp *MaintenancePlugin) gate() *maintenance.Gate {
+	if goManager, ok := mp.manager.(*GoManager); ok {
+		return goManager.GetMaintenanceGate()
+	}
+	return nil
+}
+
+// handleMaintenance 处理maintenance命令
+func (mp *MaintenancePlugin) handleMaintenance(ctx *command.CommandContext) error {
+	gate := mp.gate()
+	if gate == nil {
+		return mp.sendResponse(ctx, "维护窗口服务不可用")
+	}
+
+	if len(ctx.Args) == 0 {
+		return mp.sendResponse(ctx, mp.usage())
+	}
+
+	switch ctx.Args[0] {
+	case "start":
+		return mp.handleStart(ctx, gate)
+	case "schedule":
+		return mp.handleSchedule(ctx, gate)
+	case "stop":
+		return mp.handleStop(ctx, gate)
+	case "remove", "rm":
+		return mp.handleRemove(ctx, gate)
+	case "list", "ls":
+		return mp.sendResponse(ctx, formatMaintenanceWindows(gate, true))
+	default:
+		return mp.sendResponse(ctx, mp.usage())
+	}
+}
+
+// usage 返回用法说明
+func (mp *MaintenancePlugin) usage() string {
+	return `用法:
+• .maintenance start <时长> [--only=插件,...] [原因] - 立即开始维护窗口，例如 2h、30m、1d
+• .maintenance schedule <秒> <分> <时> <日> <月> <周> <时长> [--only=插件,...] [原因] - 周期维护窗口
+  --only 只静默指定插件(如 autosend)的消息，不指定时静默所有插件
+• .maintenance stop [ID] - 提前结束当前(或指定)窗口
+• .maintenance remove <ID> - 删除窗口
+• .maintenance list - 查看窗口`
+}
+
+// windowSources 读取 --only 指定的来源列表，未指定时返回nil
+func windowSources(ctx *command.CommandContext) ([]string, error) {
+	only, ok := ctx.Flag("only")
+	if !ok {
+		return nil, nil
+	}
+	sources := maintenance.ParseSources(only)
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("--only 需要至少一个插件名，例如 --only=autosend")
+	}
+	return sources, nil
+}
+
+// handleStart 开始一次性窗口
+func (mp *MaintenancePlugin) handleStart(ctx *command.CommandContext, gate *maintenance.Gate) error {
+	sources, err := windowSources(ctx)
+	if err != nil {
+		return mp.sendResponse(ctx, "❌ "+err.Error())
+	}
+	if len(ctx.Args) < 2 {
+		return mp.sendResponse(ctx, "用法: .maintenance start <时长> [--only=插件,...] [原因]")
+	}
+
+	d, err := parseWindowDuration(ctx.Args[1])
+	if err != nil {
+		return mp.sendResponse(ctx, fmt.Sprintf("❌ 无效的时长: %s", ctx.Args[1]))
+	}
+
+	w, err := gate.Open(d, sources, strings.Join(ctx.Args[2:], " "))
+	if err != nil {
+		return mp.sendResponse(ctx, fmt.Sprintf("❌ 创建维护窗口失败: %v", err))
+	}
+
+	return mp.sendResponse(ctx, fmt.Sprintf("🔧 维护窗口 #%d 已开始，将于 %s 结束\n静默: %s",
+		w.ID, w.EndAt.Format("2006-01-02 15:04:05"), formatWindowSources(w)))
+}
+
+// handleSchedule 创建周期窗口
+func (mp *MaintenancePlugin) handleSchedule(ctx *command.CommandContext, gate *maintenance.Gate) error {
+	sources, err := windowSources(ctx)
+	if err != nil {
+		return mp.sendResponse(ctx, "❌ "+err.Error())
+	}
+	if len(ctx.Args) < 8 {
+		return mp.sendResponse(ctx, "用法: .maintenance schedule <秒> <分> <时> <日> <月> <周> <时长> [--only=插件,...] [原因]")
+	}
+
+	cronExpr := strings.Join(ctx.Args[1:7], " ")
+	d, err := parseWindowDuration(ctx.Args[7])
+	if err != nil {
+		return mp.sendResponse(ctx, fmt.Sprintf("❌ 无效的时长: %s", ctx.Args[7]))
+	}
+
+	w, err := gate.Schedule(cronExpr, d, sources, strings.Join(ctx.Args[8:], " "))
+	if err != nil {
+		return mp.sendResponse(ctx, fmt.Sprintf("❌ 创建维护窗口失败: %v", err))
+	}
+
+	next := w.NextStart(time.Now())
+	return mp.sendResponse(ctx, fmt.Sprintf("🔧 周期维护窗口 #%d 已创建\nCron: %s\n时长: %s\n静默: %s\n下次开始: %s",
+		w.ID, cronExpr, d, formatWindowSources(w), next.Format("2006-01-02 15:04:05")))
+}
+
+// handleStop 提前结束窗口
+func (mp *MaintenancePlugin) handleStop(ctx *command.CommandContext, gate *maintenance.Gate) error {
+	var id int64
+	if len(ctx.Args) >= 2 {
+		parsed, err := strconv.ParseInt(ctx.Args[1], 10, 64)
+		if err != nil {
+			return mp.sendResponse(ctx, "❌ 无效的窗口ID")
+		}
+		id = parsed
+	} else {
+		w, _, active := gate.Active()
+		if !active {
+			return mp.sendResponse(ctx, "当前没有生效的维护窗口")
+		}
+		id = w.ID
+	}
+
+	deferred := gate.DeferredCount()
+	if err := gate.End(id); err != nil {
+		return mp.sendResponse(ctx, fmt.Sprintf("❌ %v", err))
+	}
+
+	return mp.sendResponse(ctx, fmt.Sprintf("✅ 维护窗口 #%d 已结束，补发 %d 项延迟任务", id, deferred))
+}
+
+// handleRemove 删除窗口
+func (mp *MaintenancePlugin) handleRemove(ctx *command.CommandContext, gate *maintenance.Gate) error {
+	if len(ctx.Args) < 2 {
+		return mp.sendResponse(ctx, "用法: .maintenance remove <ID>")
+	}
+
+	id, err := strconv.ParseInt(ctx.Args[1], 10, 64)
+	if err != nil {
+		return mp.sendResponse(ctx, "❌ 无效的窗口ID")
+	}
+
+	if err := gate.Remove(id); err != nil {
+		return mp.sendResponse(ctx, fmt.Sprintf("❌ %v", err))
+	}
+
+	return mp.sendResponse(ctx, fmt.Sprintf("✅ 维护窗口 #%d 已删除", id))
+}
+
+// formatMaintenanceWindows 格式化维护窗口状态，detailed为false时仅输出当前与下一个窗口
+func formatMaintenanceWindows(gate *maintenance.Gate, detailed bool) string {
+	now := time.Now()
+	var b strings.Builder
+
+	if w, end, active := gate.Active(); active {
+		b.WriteString(fmt.Sprintf("🔧 生效中: #%d，剩余 %s", w.ID, end.Sub(now).Round(time.Second)))
+		if len(w.Sources) > 0 {
+			b.WriteString("，仅 " + formatWindowSources(w))
+		}
+		if w.Reason != "" {
+			b.WriteString(fmt.Sprintf(" (%s)", w.Reason))
+		}
+		if n := gate.DeferredCount(); n > 0 {
+			b.WriteString(fmt.Sprintf("，延迟 %d 项", n))
+		}
+	} else {
+		b.WriteString("🔧 当前无生效的维护窗口")
+	}
+
+	if !detailed {
+		if w, start, ok := gate.Upcoming(); ok {
+			b.WriteString(fmt.Sprintf("；下一个: #%d 于 %s", w.ID, start.Format("2006-01-02 15:04:05")))
+		}
+		return b.String()
+	}
+
+	windows := gate.List()
+	if len(windows) == 0 {
+		return b.String()
+	}
+
+	b.WriteString("\n\n📋 维护窗口列表:\n")
+	for _, w := range windows {
+		if w.Recurring() {
+			b.WriteString(fmt.Sprintf("• #%d 周期 `%s` 持续 %s", w.ID, w.CronExpr, w.Duration))
+			if next := w.NextStart(now); !next.IsZero() {
+				b.WriteString(fmt.Sprintf("，下次 %s", next.Format("2006-01-02 15:04:05")))
+			}
+		} else {
+			b.WriteString(fmt.Sprintf("• #%d %s ~ %s", w.ID,
+				w.StartAt.Format("01-02 15:04:05"), w.EndAt.Format("01-02 15:04:05")))
+		}
+		if len(w.Sources) > 0 {
+			b.WriteString("，仅 " + formatWindowSources(w))
+		}
+		if w.Reason != "" {
+			b.WriteString(fmt.Sprintf(" - %s", w.Reason))
+		}
+		b.WriteString("\n")
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// formatWindowSources 格式化窗口静默的插件
+func formatWindowSources(w *maintenance.Window) string {
+	if len(w.Sources) == 0 {
+		return "所有插件"
+	}
+	return strings.Join(w.Sources, ", ")
+}
+
+// parseWindowDuration 解析时长，在 time.ParseDuration 基础上支持天(d)
+func parseWindowDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// sendResponse 发送响应消息
+func (mp *MaintenancePlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
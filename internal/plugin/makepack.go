@@ -0,0 +1,417 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/stickerpack"
+	"nexusvalet/pkg/logger"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// stickersBotUsername 官方贴纸机器人
+	stickersBotUsername = "Stickers"
+	// stickersReplyTimeout 等待 @Stickers 回复的最长时间
+	stickersReplyTimeout = 30 * time.Second
+	// makepackMaxArchive 压缩包的最大字节数
+	makepackMaxArchive = 50 * 1024 * 1024
+)
+
+// packShortName 贴纸包短名称：字母开头，只包含字母、数字和下划线
+var packShortName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{4,63}$`)
+
+// makepackProgress 持久化的创建进度，中断后再次执行同一命令时从这里继续
+type makepackProgress struct {
+	Title     string
+	Digest    string
+	Total     int
+	Done      int
+	Published bool
+}
+
+// initMakepackDatabase 创建进度表
+func (sp *StickerPlugin) initMakepackDatabase() error {
+	_, err := sp.db.Exec(`
+	CREATE TABLE IF NOT EXISTS sticker_makepack (
+		short_name TEXT PRIMARY KEY,
+		title TEXT NOT NULL,
+		digest TEXT NOT NULL,
+		total INTEGER NOT NULL,
+		done INTEGER NOT NULL DEFAULT 0,
+		published INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// loadProgress 读取进度，不存在时返回nil
+func (sp *StickerPlugin) loadProgress(shortName string) (*makepackProgress, error) {
+	var p makepackProgress
+	err := sp.db.QueryRow("SELECT title, digest, total, done, published FROM sticker_makepack WHERE short_name = ?", shortName).
+		Scan(&p.Title, &p.Digest, &p.Total, &p.Done, &p.Published)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// saveProgress 保存进度
+func (sp *StickerPlugin) saveProgress(shortName string, p *makepackProgress) error {
+	_, err := sp.db.Exec(`
+	INSERT INTO sticker_makepack (short_name, title, digest, total, done, published, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(short_name) DO UPDATE SET
+		title = excluded.title, digest = excluded.digest, total = excluded.total,
+		done = excluded.done, published = excluded.published, updated_at = CURRENT_TIMESTAMP`,
+		shortName, p.Title, p.Digest, p.Total, p.Done, p.Published)
+	return err
+}
+
+// handleMakePack 处理makepack命令：回复贴纸压缩包，通过 @Stickers 创建新的贴纸包
+func (sp *StickerPlugin) handleMakePack(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return sp.sendResponse(ctx, "用法: 回复贴纸压缩包 .makepack <短名称> <标题>")
+	}
+	shortName := ctx.Args[0]
+	title := strings.Join(ctx.Args[1:], " ")
+	if !packShortName.MatchString(shortName) {
+		return sp.sendResponse(ctx, "❌ 短名称需以字母开头，只能包含字母、数字和下划线，长度5-64")
+	}
+	if len([]rune(title)) > 64 {
+		return sp.sendResponse(ctx, "❌ 标题不能超过64个字符")
+	}
+
+	doc, err := ctx.GetDocument()
+	if err != nil || !isZipDocument(doc) {
+		return sp.sendResponse(ctx, "请回复一个贴纸压缩包(.zip)")
+	}
+	if doc.Size > makepackMaxArchive {
+		return sp.sendResponse(ctx, fmt.Sprintf("❌ 压缩包超过 %dMB", makepackMaxArchive/1024/1024))
+	}
+
+	if err := sp.sendResponse(ctx, "正在下载并校验压缩包..."); err != nil {
+		logger.Warnf("发送状态消息失败: %v", err)
+	}
+	data, err := ctx.DownloadFile(doc)
+	if err != nil {
+		return sp.sendResponse(ctx, fmt.Sprintf("❌ 下载压缩包失败: %v", err))
+	}
+	archive, err := stickerpack.ReadArchive(data)
+	if err != nil {
+		return sp.sendResponse(ctx, "❌ "+err.Error())
+	}
+	if len(archive.Problems) > 0 {
+		return sp.sendResponse(ctx, formatProblems(archive.Problems))
+	}
+	if len(archive.Items) == 0 {
+		return sp.sendResponse(ctx, "❌ 压缩包中没有可用的图片")
+	}
+
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	progress, err := sp.loadProgress(shortName)
+	if err != nil {
+		return sp.sendResponse(ctx, fmt.Sprintf("❌ 读取进度失败: %v", err))
+	}
+	switch {
+	case progress == nil:
+		progress = &makepackProgress{Title: title, Digest: digest, Total: len(archive.Items)}
+	case progress.Digest != digest:
+		return sp.sendResponse(ctx, fmt.Sprintf("❌ 短名称 %s 已用于另一个压缩包的创建记录，请换一个短名称", shortName))
+	case progress.Published && progress.Done >= progress.Total:
+		return sp.sendResponse(ctx, "✅ 该贴纸包已创建: https://t.me/addstickers/"+shortName)
+	case !progress.Published:
+		// 发布前中断时 @Stickers 的对话状态无法恢复，从头开始
+		progress.Done = 0
+	}
+
+	runner := taskRunnerFrom(sp.GetManager())
+	if runner == nil {
+		return sp.sendResponse(ctx, "任务管理器不可用")
+	}
+	status, err := commandStatusEditor(ctx)
+	if err != nil {
+		return err
+	}
+	api := ctx.API
+	runner.Start(context.Background(), core.TaskOptions{
+		ChatID: ctx.Message.ChatID,
+		Name:   "makepack " + shortName,
+		Status: status,
+	}, func(taskCtx context.Context, report core.ProgressFunc) (string, error) {
+		return sp.runMakePack(taskCtx, api, shortName, archive.Items, progress, report)
+	})
+	return nil
+}
+
+// runMakePack 依次上传贴纸。先用第一张贴纸创建并发布贴纸包，
+// 之后通过 /addsticker 添加，每张成功后保存进度
+func (sp *StickerPlugin) runMakePack(ctx context.Context, api *tg.Client, shortName string, items []stickerpack.Item, progress *makepackProgress, report core.ProgressFunc) (string, error) {
+	bot, err := newStickersBot(ctx, api)
+	if err != nil {
+		return "", err
+	}
+	total := len(items)
+	report(progress.Done, total, "")
+
+	if !progress.Published {
+		report(0, total, "正在创建贴纸包...")
+		if err := bot.createPack(ctx, progress.Title, shortName, items[0]); err != nil {
+			return "", err
+		}
+		progress.Done, progress.Published = 1, true
+		if err := sp.saveProgress(shortName, progress); err != nil {
+			logger.Warnf("Failed to save makepack progress: %v", err)
+		}
+	}
+
+	if progress.Done < total {
+		if err := bot.beginAdd(ctx, shortName); err != nil {
+			return "", err
+		}
+		for i := progress.Done; i < total; i++ {
+			report(i, total, "正在上传 "+items[i].Name)
+			if err := bot.addSticker(ctx, items[i]); err != nil {
+				return "", fmt.Errorf("上传 %s 失败: %w\n已完成 %d/%d，再次执行相同命令可继续", items[i].Name, err, i, total)
+			}
+			progress.Done = i + 1
+			if err := sp.saveProgress(shortName, progress); err != nil {
+				logger.Warnf("Failed to save makepack progress: %v", err)
+			}
+		}
+		if _, err := bot.exchange(ctx, "/done"); err != nil {
+			logger.Warnf("Failed to finish @Stickers conversation: %v", err)
+		}
+	}
+
+	return fmt.Sprintf("已上传 %d 张贴纸\nhttps://t.me/addstickers/%s", total, shortName), nil
+}
+
+// isZipDocument 文档是否为zip压缩包
+func isZipDocument(doc *tg.Document) bool {
+	if doc.MimeType == "application/zip" || doc.MimeType == "application/x-zip-compressed" {
+		return true
+	}
+	for _, attr := range doc.Attributes {
+		if name, ok := attr.(*tg.DocumentAttributeFilename); ok {
+			return strings.HasSuffix(strings.ToLower(name.FileName), ".zip")
+		}
+	}
+	return false
+}
+
+// formatProblems 列出所有无法使用的文件
+func formatProblems(problems []stickerpack.Problem) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("❌ 有 %d 个文件不符合贴纸要求，请修正后重试:\n", len(problems)))
+	for i, problem := range problems {
+		if i == 30 {
+			b.WriteString(fmt.Sprintf("\n… 另有 %d 个", len(problems)-i))
+			break
+		}
+		b.WriteString(fmt.Sprintf("\n• %s: %s", problem.Name, problem.Reason))
+	}
+	return b.String()
+}
+
+// stickersBot 与 @Stickers 机器人的对话，通过轮询历史消息获取回复
+type stickersBot struct {
+	api    *tg.Client
+	peer   *tg.InputPeerUser
+	lastID int
+}
+
+// newStickersBot 解析 @Stickers 并记录当前最新的消息ID
+func newStickersBot(ctx context.Context, api *tg.Client) (*stickersBot, error) {
+	resolved, err := api.ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{Username: stickersBotUsername})
+	if err != nil {
+		return nil, fmt.Errorf("解析 @%s 失败: %w", stickersBotUsername, err)
+	}
+	bot := &stickersBot{api: api}
+	for _, u := range resolved.Users {
+		if user, ok := u.(*tg.User); ok && user.Bot {
+			bot.peer = &tg.InputPeerUser{UserID: user.ID, AccessHash: user.AccessHash}
+		}
+	}
+	if bot.peer == nil {
+		return nil, fmt.Errorf("未找到 @%s", stickersBotUsername)
+	}
+
+	messages, err := bot.history(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		bot.lastID = max(bot.lastID, msg.ID)
+	}
+	return bot, nil
+}
+
+// createPack 创建并发布只含第一张贴纸的贴纸包
+func (b *stickersBot) createPack(ctx context.Context, title, shortName string, first stickerpack.Item) error {
+	// 重置可能残留的对话状态
+	b.exchange(ctx, "/cancel")
+
+	for _, step := range []string{"/newpack", title} {
+		if _, err := b.exchange(ctx, step); err != nil {
+			return err
+		}
+	}
+	if err := b.addSticker(ctx, first); err != nil {
+		return fmt.Errorf("上传 %s 失败: %w", first.Name, err)
+	}
+	// 发布，跳过图标设置，最后提交短名称
+	for _, step := range []string{"/publish", "/skip"} {
+		if _, err := b.exchange(ctx, step); err != nil {
+			return err
+		}
+	}
+	reply, err := b.exchange(ctx, shortName)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(reply, "addstickers/") {
+		return fmt.Errorf("@%s: %s", stickersBotUsername, reply)
+	}
+	return nil
+}
+
+// beginAdd 开始向已有贴纸包添加贴纸
+func (b *stickersBot) beginAdd(ctx context.Context, shortName string) error {
+	b.exchange(ctx, "/cancel")
+	for _, step := range []string{"/addsticker", shortName} {
+		if _, err := b.exchange(ctx, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addSticker 发送贴纸文件及其emoji
+func (b *stickersBot) addSticker(ctx context.Context, item stickerpack.Item) error {
+	sticker := item.Sticker
+	file, err := uploader.NewUploader(b.api).FromBytes(ctx, sticker.FileName, sticker.Data)
+	if err != nil {
+		return fmt.Errorf("上传文件失败: %w", err)
+	}
+	if _, err := b.api.MessagesSendMedia(ctx, &tg.MessagesSendMediaRequest{
+		Peer: b.peer,
+		Media: &tg.InputMediaUploadedDocument{
+			File:       file,
+			MimeType:   sticker.MimeType,
+			ForceFile:  true,
+			Attributes: []tg.DocumentAttributeClass{&tg.DocumentAttributeFilename{FileName: sticker.FileName}},
+		},
+		RandomID: time.Now().UnixNano(),
+	}); err != nil {
+		return fmt.Errorf("发送文件失败: %w", err)
+	}
+	if _, err := b.await(ctx); err != nil {
+		return err
+	}
+	_, err = b.exchange(ctx, item.Emojis)
+	return err
+}
+
+// exchange 发送一条文本并等待回复
+func (b *stickersBot) exchange(ctx context.Context, text string) (string, error) {
+	if _, err := b.api.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+		Peer:     b.peer,
+		Message:  text,
+		RandomID: time.Now().UnixNano(),
+	}); err != nil {
+		return "", fmt.Errorf("发送消息失败: %w", err)
+	}
+	return b.await(ctx)
+}
+
+// await 等待机器人的新回复，合并短时间内连续发来的多条消息。
+// 以 Sorry 开头或包含 invalid 的回复视为失败
+func (b *stickersBot) await(ctx context.Context) (string, error) {
+	deadline := time.Now().Add(stickersReplyTimeout)
+	var replies []*tg.Message
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Second):
+		}
+
+		messages, err := b.history(ctx)
+		if err != nil {
+			return "", err
+		}
+		fresh := 0
+		for _, msg := range messages {
+			if msg.ID <= b.lastID {
+				continue
+			}
+			b.lastID = max(b.lastID, msg.ID)
+			if !msg.Out {
+				replies = append(replies, msg)
+				fresh++
+			}
+		}
+		// 收到回复后再等一轮，没有新消息时认为回复结束
+		if len(replies) > 0 && fresh == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			if len(replies) > 0 {
+				break
+			}
+			return "", fmt.Errorf("等待 @%s 回复超时", stickersBotUsername)
+		}
+	}
+
+	sort.Slice(replies, func(i, j int) bool { return replies[i].ID < replies[j].ID })
+	var texts []string
+	for _, msg := range replies {
+		texts = append(texts, msg.Message)
+	}
+	reply := strings.Join(texts, "\n")
+	if strings.HasPrefix(reply, "Sorry") || strings.Contains(strings.ToLower(reply), "invalid") {
+		return reply, fmt.Errorf("@%s: %s", stickersBotUsername, reply)
+	}
+	return reply, nil
+}
+
+// history 获取与机器人的最近消息
+func (b *stickersBot) history(ctx context.Context) ([]*tg.Message, error) {
+	result, err := b.api.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
+		Peer:  b.peer,
+		Limit: 10,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取 @%s 消息失败: %w", stickersBotUsername, err)
+	}
+
+	var list []tg.MessageClass
+	switch m := result.(type) {
+	case *tg.MessagesMessages:
+		list = m.Messages
+	case *tg.MessagesMessagesSlice:
+		list = m.Messages
+	}
+	var messages []*tg.Message
+	for _, item := range list {
+		if msg, ok := item.(*tg.Message); ok {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
@@ -0,0 +1,344 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/download"
+	"nexusvalet/internal/mediacompress"
+	"nexusvalet/internal/peers"
+	"nexusvalet/pkg/logger"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+)
+
+// fetchReplyMessage 获取命令消息所回复的消息
+func fetchReplyMessage(ctx *command.CommandContext) (*tg.Message, error) {
+	replyTo, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok || replyTo.ReplyToMsgID == 0 {
+		return nil, fmt.Errorf("没有回复消息")
+	}
+	return fetchMessageByID(ctx, replyTo.ReplyToMsgID)
+}
+
+// fetchMessageByID 获取当前对话中指定ID的消息
+func fetchMessageByID(ctx *command.CommandContext, msgID int) (*tg.Message, error) {
+	msg, _, err := fetchMessageWithSender(ctx, msgID)
+	return msg, err
+}
+
+// fetchMessageWithSender 获取当前对话中指定ID的消息及其发送者的显示名称
+func fetchMessageWithSender(ctx *command.CommandContext, msgID int) (*tg.Message, string, error) {
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return nil, "", err
+	}
+	msg, users, chats, err := fetchPeerMessage(ctx.Context, ctx.API, peer, msgID)
+	if err != nil {
+		return nil, "", err
+	}
+	return msg, senderDisplayName(msg, users, chats), nil
+}
+
+// fetchPeerMessage 获取peer中指定ID的消息，以及响应中附带的用户和对话
+func fetchPeerMessage(ctx context.Context, api *tg.Client, peer tg.InputPeerClass, msgID int) (*tg.Message, []tg.UserClass, []tg.ChatClass, error) {
+	// 根据peer类型获取消息
+	var messages tg.MessagesMessagesClass
+	var err error
+	if channelPeer, ok := peer.(*tg.InputPeerChannel); ok {
+		channelInput := &tg.InputChannel{ChannelID: channelPeer.ChannelID, AccessHash: channelPeer.AccessHash}
+		messages, err = api.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+			Channel: channelInput,
+			ID:      []tg.InputMessageClass{&tg.InputMessageID{ID: msgID}},
+		})
+	} else {
+		messages, err = api.MessagesGetMessages(ctx, []tg.InputMessageClass{&tg.InputMessageID{ID: msgID}})
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var msgList []tg.MessageClass
+	var users []tg.UserClass
+	var chats []tg.ChatClass
+	switch m := messages.(type) {
+	case *tg.MessagesMessages:
+		msgList, users, chats = m.Messages, m.Users, m.Chats
+	case *tg.MessagesMessagesSlice:
+		msgList, users, chats = m.Messages, m.Users, m.Chats
+	case *tg.MessagesChannelMessages:
+		msgList, users, chats = m.Messages, m.Users, m.Chats
+	}
+
+	if len(msgList) > 0 {
+		if msg, ok := msgList[0].(*tg.Message); ok {
+			return msg, users, chats, nil
+		}
+	}
+
+	return nil, nil, nil, fmt.Errorf("消息不存在")
+}
+
+// senderDisplayName 返回消息发送者的显示名称。频道消息和匿名管理员使用对话名称
+func senderDisplayName(msg *tg.Message, users []tg.UserClass, chats []tg.ChatClass) string {
+	from := msg.FromID
+	if from == nil {
+		from = msg.PeerID
+	}
+
+	switch p := from.(type) {
+	case *tg.PeerUser:
+		for _, u := range users {
+			if user, ok := u.(*tg.User); ok && user.ID == p.UserID {
+				name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+				if name == "" {
+					name = fmt.Sprintf("用户 %d", user.ID)
+				}
+				if user.Username != "" {
+					name += " (@" + user.Username + ")"
+				}
+				return name
+			}
+		}
+		return fmt.Sprintf("用户 %d", p.UserID)
+	case *tg.PeerChannel:
+		for _, c := range chats {
+			if channel, ok := c.(*tg.Channel); ok && channel.ID == p.ChannelID {
+				return channel.Title
+			}
+		}
+	case *tg.PeerChat:
+		for _, c := range chats {
+			if chat, ok := c.(*tg.Chat); ok && chat.ID == p.ChatID {
+				return chat.Title
+			}
+		}
+	}
+	return "未知发送者"
+}
+
+// replyTargetFromContext 如果命令回复了某条消息，返回指向该消息的InputReplyTo
+func replyTargetFromContext(ctx *command.CommandContext) tg.InputReplyToClass {
+	if replyTo, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader); ok && replyTo.ReplyToMsgID != 0 {
+		return &tg.InputReplyToMessage{ReplyToMsgID: replyTo.ReplyToMsgID}
+	}
+	return nil
+}
+
+// MediaUpload 待上传发送的文档
+type MediaUpload struct {
+	FileName   string
+	Data       []byte
+	MimeType   string
+	Caption    string
+	Attributes []tg.DocumentAttributeClass
+	ReplyTo    tg.InputReplyToClass
+	// KeepOriginal 不压缩图片，用于需要保持原样的文件
+	KeepOriginal bool
+}
+
+// sendDocument 上传文件并作为文档发送到peer
+// 文件大小和说明长度按当前账号(普通/Premium)的限制检查，过长的说明会被截断
+func sendDocument(ctx *command.CommandContext, peer tg.InputPeerClass, media MediaUpload) error {
+	if !media.KeepOriginal {
+		media.FileName, media.Data = compressImage(media.FileName, media.Data, false)
+	}
+	if err := checkUploadSize(int64(len(media.Data))); err != nil {
+		return err
+	}
+	media.Caption = trimCaption(media.Caption)
+
+	file, err := uploader.NewUploader(ctx.API).FromBytes(ctx.Context, media.FileName, media.Data)
+	if err != nil {
+		return fmt.Errorf("上传文件失败: %w", err)
+	}
+
+	attrs := append([]tg.DocumentAttributeClass{
+		&tg.DocumentAttributeFilename{FileName: media.FileName},
+	}, media.Attributes...)
+
+	_, err = ctx.API.MessagesSendMedia(ctx.Context, &tg.MessagesSendMediaRequest{
+		Peer: peer,
+		Media: &tg.InputMediaUploadedDocument{
+			File:       file,
+			MimeType:   media.MimeType,
+			Attributes: attrs,
+		},
+		Message:  media.Caption,
+		RandomID: time.Now().UnixNano(),
+		ReplyTo:  media.ReplyTo,
+	})
+	if err != nil {
+		return fmt.Errorf("发送文件失败: %w", err)
+	}
+	return nil
+}
+
+// uploadPhoto 压缩并上传作为照片发送的图片。照片会被Telegram重新编码，
+// 因此允许把PNG转换为JPEG
+func uploadPhoto(ctx context.Context, api *tg.Client, name string, data []byte) (tg.InputFileClass, error) {
+	name, data = compressImage(name, data, true)
+	if err := checkUploadSize(int64(len(data))); err != nil {
+		return nil, err
+	}
+	return uploader.NewUploader(api).FromBytes(ctx, name, data)
+}
+
+// mediaDownloader 共用的下载器，为nil时使用不处理跨DC文件的临时下载器
+var mediaDownloader atomic.Pointer[download.Downloader]
+
+// mediaFile 消息中可下载的照片或文件
+type mediaFile struct {
+	Location tg.InputFileLocationClass
+	Size     int64
+	Name     string // 文件名，照片和没有文件名的文件按ID生成
+}
+
+// mediaFileFromMessage 获取消息中照片(最大尺寸)或文件的位置
+func mediaFileFromMessage(msg *tg.Message) (*mediaFile, error) {
+	info, err := inspectMedia(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &info.mediaFile, nil
+}
+
+// downloadFile 使用共用的下载器把文件写入w，返回写入的字节数
+func downloadFile(ctx *command.CommandContext, location tg.InputFileLocationClass, w io.Writer, opts download.Options) (int64, error) {
+	d := mediaDownloader.Load()
+	if d == nil {
+		d = download.New(ctx.API, nil)
+	}
+	return d.Download(ctx.Context, location, w, opts)
+}
+
+// downloadMessageMedia 下载当前对话中消息的照片或文件，文件引用过期时重新获取该消息
+func downloadMessageMedia(ctx *command.CommandContext, msg *tg.Message, w io.Writer, progress download.Progress) (*mediaFile, int64, error) {
+	file, err := mediaFileFromMessage(msg)
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := downloadFile(ctx, file.Location, w, download.Options{
+		Size:     file.Size,
+		Progress: progress,
+		Refresh: func(context.Context) (tg.InputFileLocationClass, error) {
+			fresh, err := fetchMessageByID(ctx, msg.ID)
+			if err != nil {
+				return nil, err
+			}
+			refreshed, err := mediaFileFromMessage(fresh)
+			if err != nil {
+				return nil, err
+			}
+			return refreshed.Location, nil
+		},
+	})
+	return file, n, err
+}
+
+var (
+	// mediaCompression 上传前的图片压缩参数，为nil时不压缩
+	mediaCompression atomic.Pointer[mediacompress.Options]
+	// mediaStats 图片压缩的累计统计
+	mediaStats mediacompress.Stats
+)
+
+// compressImage 按配置压缩图片，非图片文件和未启用压缩时原样返回。
+// photo为false时保持原格式
+func compressImage(name string, data []byte, photo bool) (string, []byte) {
+	opts := mediaCompression.Load()
+	if opts == nil || !opts.Enabled() {
+		return name, data
+	}
+	o := *opts
+	if !photo {
+		o.ConvertPNG = false
+	}
+
+	result := mediacompress.Compress(data, o)
+	if result.Format != mediacompress.PNG && result.Format != mediacompress.JPEG {
+		return name, data
+	}
+	mediaStats.Record(result)
+	logger.Debugf("Media compression %s: %s -> %s (%s)", name, formatBytes(int64(result.Original)), formatBytes(int64(result.Compressed)), result.Reason)
+	if !result.Changed {
+		return name, data
+	}
+	return mediacompress.RenameFor(name, result.Format), result.Data
+}
+
+// formatMediaStats 格式化图片压缩的累计节省
+func formatMediaStats() string {
+	opts := mediaCompression.Load()
+	if opts == nil || !opts.Enabled() {
+		return "未启用"
+	}
+	stats := mediaStats.Snapshot()
+	line := fmt.Sprintf("%s, 已压缩 %d/%d 个图片", opts.Level, stats.Compressed, stats.Files)
+	if stats.Saved > 0 {
+		line += fmt.Sprintf(", 节省 %s (%.0f%%)", formatBytes(stats.Saved), float64(stats.Saved)*100/float64(stats.Original))
+	}
+	return line
+}
+
+// deleteCommandMessage 删除命令消息
+func deleteCommandMessage(ctx *command.CommandContext, peer tg.InputPeerClass) error {
+	return deleteMessages(ctx.Context, ctx.API, peer, []int{ctx.Message.Message.ID})
+}
+
+// deleteMessages 删除对话中的消息，超级群组和频道需要使用 ChannelsDeleteMessages
+func deleteMessages(ctx context.Context, api *tg.Client, peer tg.InputPeerClass, ids []int) error {
+	var err error
+	if channelPeer, ok := peer.(*tg.InputPeerChannel); ok {
+		_, err = api.ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{
+			Channel: &tg.InputChannel{ChannelID: channelPeer.ChannelID, AccessHash: channelPeer.AccessHash},
+			ID:      ids,
+		})
+	} else {
+		_, err = api.MessagesDeleteMessages(ctx, &tg.MessagesDeleteMessagesRequest{
+			ID:     ids,
+			Revoke: true,
+		})
+	}
+	return err
+}
+
+// deleteMessagesInChat 按对话ID删除消息，供延迟删除服务使用
+func deleteMessagesInChat(ctx context.Context, api *tg.Client, resolver *peers.Resolver, chatID int64, ids []int) error {
+	peer, err := resolver.ResolveFromChatID(ctx, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+	return deleteMessages(ctx, api, peer, ids)
+}
+
+// scheduleDeletion 安排在delay后删除当前对话中的消息。优先使用持久化的延迟删除服务，
+// 重启后仍会执行；服务不可用时在后台等待后删除
+func scheduleDeletion(ctx *command.CommandContext, manager interface{}, ids []int, delay time.Duration, source string) {
+	if goManager, ok := manager.(*GoManager); ok {
+		err := goManager.GetDeletionScheduler().Schedule(ctx.Message.ChatID, ids, time.Now().Add(delay), source)
+		if err == nil {
+			return
+		}
+		logger.Ctx(ctx.Context).Warnf("Failed to schedule deletion of messages %v: %v", ids, err)
+	}
+
+	ctx.Go(func() {
+		ctx.Delay(delay)
+		// 使用独立的超时上下文，避免命令上下文被取消导致删除失败
+		deleteCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		peer, err := ctx.PeerResolver.ResolveFromChatID(deleteCtx, ctx.Message.ChatID)
+		if err == nil {
+			err = deleteMessages(deleteCtx, ctx.API, peer, ids)
+		}
+		if err != nil {
+			logger.Ctx(ctx.Context).Warnf("Failed to delete messages %v: %v", ids, err)
+		}
+	})
+}
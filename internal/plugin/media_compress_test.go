@@ -0,0 +1,163 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/mediacompress"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+// setTestCompression 设置图片压缩参数并清空统计，测试结束后恢复为不压缩
+func setTestCompression(t *testing.T, level mediacompress.Level) {
+	t.Helper()
+	opts := mediacompress.OptionsFor(level)
+	mediaCompression.Store(&opts)
+	mediaStats = mediacompress.Stats{}
+	t.Cleanup(func() {
+		mediaCompression.Store(nil)
+		mediaStats = mediacompress.Stats{}
+	})
+}
+
+// testPNG 编码64x64的不透明PNG。noise为true时是随机噪点，否则是未压缩编码的渐变
+func testPNG(t *testing.T, noise bool) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	level := png.NoCompression
+	if noise {
+		rand.New(rand.NewSource(1)).Read(img.Pix)
+		level = png.BestCompression
+	}
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			if !noise {
+				img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), A: 255})
+			}
+			img.Pix[y*img.Stride+x*4+3] = 255
+		}
+	}
+	var buf bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: level}).Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// uploadedFile 返回上传的文件名和内容
+func uploadedFile(t *testing.T, inv *fakeInvoker) (string, []byte) {
+	t.Helper()
+	var data []byte
+	for _, part := range requests[*tg.UploadSaveFilePartRequest](inv) {
+		data = append(data, part.Bytes...)
+	}
+	media := requests[*tg.MessagesSendMediaRequest](inv)
+	if len(media) != 1 {
+		t.Fatalf("sendMedia requests = %d, want 1", len(media))
+	}
+	doc := media[0].Media.(*tg.InputMediaUploadedDocument)
+	file := doc.File.(*tg.InputFile)
+	attr := doc.Attributes[0].(*tg.DocumentAttributeFilename)
+	if attr.FileName != file.Name {
+		t.Errorf("filename attribute %q, uploaded as %q", attr.FileName, file.Name)
+	}
+	return file.Name, data
+}
+
+// sendTestDocument 通过 sendDocument 发送文件，返回实际上传的文件名和内容
+func sendTestDocument(t *testing.T, media MediaUpload) (string, []byte) {
+	t.Helper()
+	inv := &fakeInvoker{}
+	ctx := &command.CommandContext{
+		Context: context.Background(),
+		API:     tg.NewClient(inv),
+		Message: &core.MessageEvent{ChatID: -100, Message: &tg.Message{ID: 10}},
+	}
+	if err := sendDocument(ctx, &tg.InputPeerChat{ChatID: 100}, media); err != nil {
+		t.Fatal(err)
+	}
+	return uploadedFile(t, inv)
+}
+
+func TestSendDocumentCompression(t *testing.T) {
+	screenshot := testPNG(t, false)
+	doc := []byte("%PDF-1.7 report")
+
+	// 未启用时原样上传
+	if name, data := sendTestDocument(t, MediaUpload{FileName: "a.png", Data: screenshot}); name != "a.png" || !bytes.Equal(data, screenshot) {
+		t.Errorf("disabled: uploaded %s (%d bytes)", name, len(data))
+	}
+	if got := formatMediaStats(); got != "未启用" {
+		t.Errorf("stats when disabled = %q", got)
+	}
+
+	setTestCompression(t, mediacompress.Aggressive)
+	name, data := sendTestDocument(t, MediaUpload{FileName: "a.png", Data: screenshot})
+	if name != "a.png" || mediacompress.Sniff(data) != mediacompress.PNG || len(data) >= len(screenshot) {
+		t.Errorf("compressed document = %s, %q, %d bytes (original %d)", name, mediacompress.Sniff(data), len(data), len(screenshot))
+	}
+
+	// 文档保持原格式，不透明的噪点PNG不会转换为JPEG
+	noise := testPNG(t, true)
+	if name, data := sendTestDocument(t, MediaUpload{FileName: "noise.png", Data: noise}); name != "noise.png" || !bytes.Equal(data, noise) {
+		t.Errorf("incompressible document = %s (%d bytes), want original", name, len(data))
+	}
+
+	// 不需要压缩的文件和非图片文件原样上传
+	if _, data := sendTestDocument(t, MediaUpload{FileName: "sticker.png", Data: screenshot, KeepOriginal: true}); !bytes.Equal(data, screenshot) {
+		t.Error("KeepOriginal should upload the original bytes")
+	}
+	if _, data := sendTestDocument(t, MediaUpload{FileName: "report.pdf", Data: doc}); !bytes.Equal(data, doc) {
+		t.Error("documents should be uploaded unchanged")
+	}
+
+	// 只统计经过压缩流程的图片
+	stats := mediaStats.Snapshot()
+	if stats.Files != 2 || stats.Compressed != 1 || stats.Original != int64(len(screenshot)+len(noise)) || stats.Saved <= 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if got := formatMediaStats(); !strings.HasPrefix(got, "aggressive, 已压缩 1/2 个图片, 节省 ") || !strings.HasSuffix(got, "%)") {
+		t.Errorf("formatMediaStats = %q", got)
+	}
+}
+
+func TestUploadPhotoConvertsOpaquePNG(t *testing.T) {
+	noise := testPNG(t, true)
+	inv := &fakeInvoker{}
+
+	setTestCompression(t, mediacompress.Balanced)
+	if _, err := uploadPhoto(context.Background(), tg.NewClient(inv), "speedtest_1.png", noise); err != nil {
+		t.Fatal(err)
+	}
+	setTestCompression(t, mediacompress.Aggressive)
+	file, err := uploadPhoto(context.Background(), tg.NewClient(inv), "speedtest_2.png", noise)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// balanced 只重新压缩PNG，aggressive 把照片转换为JPEG并修改扩展名
+	var parts [][]byte
+	for _, part := range requests[*tg.UploadSaveFilePartRequest](inv) {
+		parts = append(parts, part.Bytes)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("uploaded parts = %d, want 2", len(parts))
+	}
+	if !bytes.Equal(parts[0], noise) {
+		t.Error("balanced photo should keep the incompressible PNG")
+	}
+	if mediacompress.Sniff(parts[1]) != mediacompress.JPEG || len(parts[1]) >= len(noise) {
+		t.Errorf("aggressive photo = %q, %d bytes (original %d)", mediacompress.Sniff(parts[1]), len(parts[1]), len(noise))
+	}
+	if name := file.(*tg.InputFile).Name; name != "speedtest_2.jpg" {
+		t.Errorf("converted photo name = %q", name)
+	}
+}
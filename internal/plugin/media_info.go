@@ -0,0 +1,187 @@
+package plugin
+
+import (
+	"fmt"
+	"mime"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// 媒体类型，用于显示
+const (
+	mediaKindPhoto        = "照片"
+	mediaKindFile         = "文件"
+	mediaKindImage        = "图片文件"
+	mediaKindVideo        = "视频"
+	mediaKindVideoNote    = "圆形视频"
+	mediaKindAnimation    = "GIF动画"
+	mediaKindAudio        = "音频"
+	mediaKindVoice        = "语音"
+	mediaKindSticker      = "贴纸"
+	mediaKindAnimSticker  = "动画贴纸"
+	mediaKindVideoSticker = "视频贴纸"
+	mediaKindCustomEmoji  = "自定义表情"
+)
+
+const (
+	// mediaMimeAnimSticker 动画贴纸(Lottie)的MIME类型
+	mediaMimeAnimSticker = "application/x-tgsticker"
+	// mediaMimeVideoSticker 视频贴纸的MIME类型
+	mediaMimeVideoSticker = "video/webm"
+)
+
+// mediaInfo 消息中照片或文件的元数据，mediaFile 部分用于下载
+type mediaInfo struct {
+	mediaFile
+	Kind          string
+	MimeType      string
+	FileName      string // 文件属性中的原始文件名，没有时为空
+	Width         int
+	Height        int
+	Duration      time.Duration
+	Emoji         string // 贴纸对应的emoji
+	Performer     string
+	Title         string
+	DCID          int
+	ID            int64
+	AccessHash    int64
+	FileReference []byte
+}
+
+// inspectMedia 获取消息中照片(最大尺寸)或文件的位置和元数据，支持照片、文件、语音、
+// 圆形视频、贴纸(包括动画和视频贴纸)等
+func inspectMedia(msg *tg.Message) (*mediaInfo, error) {
+	switch media := msg.Media.(type) {
+	case nil:
+		return nil, fmt.Errorf("消息不包含媒体")
+	case *tg.MessageMediaPhoto:
+		photo, ok := media.Photo.(*tg.Photo)
+		if !ok {
+			break
+		}
+		return inspectPhoto(photo)
+	case *tg.MessageMediaDocument:
+		doc, ok := media.Document.(*tg.Document)
+		if !ok {
+			break
+		}
+		return inspectDocument(doc), nil
+	}
+	return nil, fmt.Errorf("不支持的媒体类型")
+}
+
+// inspectPhoto 获取照片最大尺寸的位置和分辨率
+func inspectPhoto(photo *tg.Photo) (*mediaInfo, error) {
+	info := &mediaInfo{
+		Kind:          mediaKindPhoto,
+		MimeType:      "image/jpeg",
+		DCID:          photo.DCID,
+		ID:            photo.ID,
+		AccessHash:    photo.AccessHash,
+		FileReference: photo.FileReference,
+	}
+	var thumb string
+	for _, s := range photo.Sizes {
+		switch ps := s.(type) {
+		case *tg.PhotoSize:
+			if thumb == "" || int64(ps.Size) > info.Size {
+				thumb, info.Size = ps.Type, int64(ps.Size)
+				info.Width, info.Height = ps.W, ps.H
+			}
+		case *tg.PhotoSizeProgressive:
+			if n := len(ps.Sizes); n > 0 && (thumb == "" || int64(ps.Sizes[n-1]) > info.Size) {
+				thumb, info.Size = ps.Type, int64(ps.Sizes[n-1])
+				info.Width, info.Height = ps.W, ps.H
+			}
+		}
+	}
+	if thumb == "" {
+		return nil, fmt.Errorf("不支持的媒体类型")
+	}
+	info.Location = &tg.InputPhotoFileLocation{
+		ID:            photo.ID,
+		AccessHash:    photo.AccessHash,
+		FileReference: photo.FileReference,
+		ThumbSize:     thumb,
+	}
+	info.Name = fmt.Sprintf("photo_%d.jpg", photo.ID)
+	return info, nil
+}
+
+// inspectDocument 根据文件属性判断文件的类型并读取分辨率、时长和文件名
+func inspectDocument(doc *tg.Document) *mediaInfo {
+	info := &mediaInfo{
+		Kind:          mediaKindFile,
+		MimeType:      doc.MimeType,
+		DCID:          doc.DCID,
+		ID:            doc.ID,
+		AccessHash:    doc.AccessHash,
+		FileReference: doc.FileReference,
+	}
+	info.Location = &tg.InputDocumentFileLocation{
+		ID:            doc.ID,
+		AccessHash:    doc.AccessHash,
+		FileReference: doc.FileReference,
+	}
+	info.Size = doc.Size
+
+	var animated, sticker, customEmoji bool
+	for _, attr := range doc.Attributes {
+		switch a := attr.(type) {
+		case *tg.DocumentAttributeFilename:
+			info.FileName = a.FileName
+		case *tg.DocumentAttributeImageSize:
+			info.Width, info.Height = a.W, a.H
+			if info.Kind == mediaKindFile {
+				info.Kind = mediaKindImage
+			}
+		case *tg.DocumentAttributeVideo:
+			info.Width, info.Height = a.W, a.H
+			info.Duration = time.Duration(a.Duration * float64(time.Second))
+			info.Kind = mediaKindVideo
+			if a.RoundMessage {
+				info.Kind = mediaKindVideoNote
+			}
+		case *tg.DocumentAttributeAudio:
+			info.Duration = time.Duration(a.Duration) * time.Second
+			info.Performer, info.Title = a.Performer, a.Title
+			info.Kind = mediaKindAudio
+			if a.Voice {
+				info.Kind = mediaKindVoice
+			}
+		case *tg.DocumentAttributeAnimated:
+			animated = true
+		case *tg.DocumentAttributeSticker:
+			sticker = true
+			info.Emoji = a.Alt
+		case *tg.DocumentAttributeCustomEmoji:
+			customEmoji = true
+			info.Emoji = a.Alt
+		}
+	}
+
+	// 贴纸和GIF同时带有图片或视频属性，最后按标记属性确定类型
+	switch {
+	case customEmoji:
+		info.Kind = mediaKindCustomEmoji
+	case sticker && info.MimeType == mediaMimeAnimSticker:
+		info.Kind = mediaKindAnimSticker
+	case sticker && info.MimeType == mediaMimeVideoSticker:
+		info.Kind = mediaKindVideoSticker
+	case sticker:
+		info.Kind = mediaKindSticker
+	case animated && info.Kind == mediaKindVideo:
+		info.Kind = mediaKindAnimation
+	}
+
+	info.Name = info.FileName
+	if info.Name == "" {
+		ext := ".bin"
+		if exts, _ := mime.ExtensionsByType(doc.MimeType); len(exts) > 0 {
+			ext = exts[0]
+		}
+		info.Name = fmt.Sprintf("file_%d%s", doc.ID, ext)
+	}
+	return info
+}
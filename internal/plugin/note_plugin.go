@@ -0,0 +1,306 @@
+package plugin
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+const (
+	// noteGlobalChat 全局笔记使用的chat_id
+	noteGlobalChat int64 = 0
+
+	noteMediaPhoto    = "photo"
+	noteMediaDocument = "document"
+)
+
+// note 保存的一条笔记，媒体只保存文件引用，不保存文件内容
+type note struct {
+	Name          string
+	Text          string
+	MediaType     string // 为空表示纯文本
+	MediaID       int64
+	AccessHash    int64
+	FileReference []byte
+}
+
+// NotePlugin 按名称保存和发送消息片段
+type NotePlugin struct {
+	*BasePlugin
+	db *sql.DB
+}
+
+// NewNotePlugin 创建笔记插件
+func NewNotePlugin(db *sql.DB) *NotePlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "note",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "按名称保存消息，之后在任意对话中发送",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &NotePlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+
+	return plugin
+}
+
+// initDatabase 初始化数据库表
+func (np *NotePlugin) initDatabase() {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS notes (
+		chat_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		text TEXT NOT NULL,
+		media_type TEXT NOT NULL DEFAULT '',
+		media_id INTEGER NOT NULL DEFAULT 0,
+		access_hash INTEGER NOT NULL DEFAULT 0,
+		file_reference BLOB,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (chat_id, name)
+	);`
+
+	_, err := np.db.Exec(createTableSQL)
+	if err != nil {
+		logger.Errorf("Failed to create notes table: %v", err)
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (np *NotePlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("save", "回复消息使用，按名称保存为笔记，.save <名称> [--local]", np.info.Name, np.handleSave)
+	parser.RegisterCommand("note", "发送保存的笔记，.note <名称>", np.info.Name, np.handleNote)
+	parser.RegisterCommand("notes", "列出保存的笔记", np.info.Name, np.handleList)
+	parser.RegisterCommand("clear", "删除笔记，.clear <名称> [--local]", np.info.Name, np.handleClear)
+	logger.Infof("Note commands registered successfully")
+	return nil
+}
+
+// parseNoteArgs 解析笔记名称和 --local 参数，--local 可以出现在任意位置
+func parseNoteArgs(ctx *command.CommandContext) (name string, local bool) {
+	if len(ctx.Args) > 0 {
+		name = ctx.Args[0]
+	}
+	return name, ctx.HasFlag("local")
+}
+
+// noteScopeChat 返回笔记保存的chat_id：--local 时为当前对话，否则为全局
+func noteScopeChat(ctx *command.CommandContext, local bool) int64 {
+	if local {
+		return ctx.Message.ChatID
+	}
+	return noteGlobalChat
+}
+
+// handleSave 处理save命令：保存被回复消息的文本和图片/文件引用
+func (np *NotePlugin) handleSave(ctx *command.CommandContext) error {
+	name, local := parseNoteArgs(ctx)
+	if name == "" {
+		return np.sendResponse(ctx, "用法: 回复一条消息 .save <名称> [--local]\n\n--local 只在当前对话中可用")
+	}
+
+	msg, err := fetchReplyMessage(ctx)
+	if err != nil {
+		return np.sendResponse(ctx, "❌ 请回复要保存的消息")
+	}
+
+	n := note{Name: name, Text: msg.Message}
+	switch m := msg.Media.(type) {
+	case *tg.MessageMediaPhoto:
+		if photo, ok := m.Photo.(*tg.Photo); ok {
+			n.MediaType, n.MediaID, n.AccessHash, n.FileReference = noteMediaPhoto, photo.ID, photo.AccessHash, photo.FileReference
+		}
+	case *tg.MessageMediaDocument:
+		if doc, ok := m.Document.(*tg.Document); ok {
+			n.MediaType, n.MediaID, n.AccessHash, n.FileReference = noteMediaDocument, doc.ID, doc.AccessHash, doc.FileReference
+		}
+	}
+	if n.Text == "" && n.MediaType == "" {
+		return np.sendResponse(ctx, "❌ 该消息没有可保存的文本、图片或文件")
+	}
+
+	_, err = np.db.Exec(`INSERT OR REPLACE INTO notes (chat_id, name, text, media_type, media_id, access_hash, file_reference, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		noteScopeChat(ctx, local), n.Name, n.Text, n.MediaType, n.MediaID, n.AccessHash, n.FileReference, time.Now().Unix())
+	if err != nil {
+		return np.sendResponse(ctx, fmt.Sprintf("❌ 保存笔记失败: %v", err))
+	}
+
+	scope := "全局"
+	if local {
+		scope = "当前对话"
+	}
+	return np.sendResponse(ctx, fmt.Sprintf("📝 已保存笔记 %s (%s)", name, scope))
+}
+
+// handleNote 处理note命令：在当前对话中发送笔记，当前对话的笔记优先于同名的全局笔记
+func (np *NotePlugin) handleNote(ctx *command.CommandContext) error {
+	name, _ := parseNoteArgs(ctx)
+	if name == "" {
+		return np.sendResponse(ctx, "用法: .note <名称>")
+	}
+
+	n, err := np.lookup(ctx.Message.ChatID, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return np.sendResponse(ctx, fmt.Sprintf("❌ 没有名为 %s 的笔记", name))
+	}
+	if err != nil {
+		return np.sendResponse(ctx, fmt.Sprintf("❌ 读取笔记失败: %v", err))
+	}
+
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+
+	if err := np.sendNote(ctx, peer, n); err != nil {
+		return np.sendResponse(ctx, fmt.Sprintf("❌ 发送笔记失败: %v", err))
+	}
+	if err := deleteCommandMessage(ctx, peer); err != nil {
+		logger.Ctx(ctx.Context).Debugf("Failed to delete note command message: %v", err)
+	}
+	return nil
+}
+
+// sendNote 发送笔记，命令回复了消息时回复同一条消息。媒体引用已失效时只发送文本
+func (np *NotePlugin) sendNote(ctx *command.CommandContext, peer tg.InputPeerClass, n *note) error {
+	text := n.Text
+	if n.MediaType != "" {
+		_, err := flood.Call(ctx.Context, ctx.Flood, ctx.Message.ChatID, func() (tg.UpdatesClass, error) {
+			return ctx.API.MessagesSendMedia(ctx.Context, &tg.MessagesSendMediaRequest{
+				Peer:     peer,
+				Media:    n.inputMedia(),
+				Message:  n.Text,
+				RandomID: time.Now().UnixNano(),
+				ReplyTo:  replyTargetFromContext(ctx),
+			})
+		})
+		if !tgerr.Is(err, "FILE_REFERENCE_EXPIRED", "FILE_REFERENCE_INVALID", "MEDIA_EMPTY") {
+			return err
+		}
+		logger.Ctx(ctx.Context).Infof("Media of note %s is no longer available: %v", n.Name, err)
+		text = strings.TrimSpace(text + "\n\n⚠️ 笔记中的媒体已失效，只发送了文本")
+	}
+
+	_, err := ctx.SendMessage(&tg.MessagesSendMessageRequest{
+		Peer:     peer,
+		Message:  text,
+		RandomID: time.Now().UnixNano(),
+		ReplyTo:  replyTargetFromContext(ctx),
+	})
+	return err
+}
+
+// inputMedia 按保存的引用构造要发送的媒体
+func (n *note) inputMedia() tg.InputMediaClass {
+	if n.MediaType == noteMediaPhoto {
+		return &tg.InputMediaPhoto{ID: &tg.InputPhoto{ID: n.MediaID, AccessHash: n.AccessHash, FileReference: n.FileReference}}
+	}
+	return &tg.InputMediaDocument{ID: &tg.InputDocument{ID: n.MediaID, AccessHash: n.AccessHash, FileReference: n.FileReference}}
+}
+
+// lookup 查找笔记，先查当前对话，再查全局
+func (np *NotePlugin) lookup(chatID int64, name string) (*note, error) {
+	var n note
+	err := np.db.QueryRow(`SELECT name, text, media_type, media_id, access_hash, file_reference FROM notes
+		WHERE name = ? AND chat_id IN (?, ?) ORDER BY chat_id = ? DESC LIMIT 1`,
+		name, chatID, noteGlobalChat, chatID).Scan(&n.Name, &n.Text, &n.MediaType, &n.MediaID, &n.AccessHash, &n.FileReference)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// handleList 处理notes命令：列出全局笔记和当前对话的笔记
+func (np *NotePlugin) handleList(ctx *command.CommandContext) error {
+	rows, err := np.db.Query("SELECT chat_id, name, media_type FROM notes WHERE chat_id IN (?, ?) ORDER BY name",
+		noteGlobalChat, ctx.Message.ChatID)
+	if err != nil {
+		return np.sendResponse(ctx, fmt.Sprintf("❌ 读取笔记失败: %v", err))
+	}
+	defer rows.Close()
+
+	var global, local []string
+	for rows.Next() {
+		var chatID int64
+		var name, mediaType string
+		if err := rows.Scan(&chatID, &name, &mediaType); err != nil {
+			return np.sendResponse(ctx, fmt.Sprintf("❌ 读取笔记失败: %v", err))
+		}
+		if mediaType != "" {
+			name += " 📎"
+		}
+		if chatID == noteGlobalChat {
+			global = append(global, name)
+		} else {
+			local = append(local, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return np.sendResponse(ctx, fmt.Sprintf("❌ 读取笔记失败: %v", err))
+	}
+
+	if len(global) == 0 && len(local) == 0 {
+		return np.sendResponse(ctx, "📝 还没有保存的笔记\n\n回复一条消息 .save <名称> 保存")
+	}
+
+	var b strings.Builder
+	b.WriteString("📝 保存的笔记:")
+	if len(global) > 0 {
+		b.WriteString(fmt.Sprintf("\n\n全局 (%d):", len(global)))
+		for _, name := range global {
+			b.WriteString("\n• " + name)
+		}
+	}
+	if len(local) > 0 {
+		b.WriteString(fmt.Sprintf("\n\n当前对话 (%d):", len(local)))
+		for _, name := range local {
+			b.WriteString("\n• " + name)
+		}
+	}
+	return np.sendResponse(ctx, b.String())
+}
+
+// handleClear 处理clear命令：删除全局笔记，--local 时删除当前对话的笔记
+func (np *NotePlugin) handleClear(ctx *command.CommandContext) error {
+	name, local := parseNoteArgs(ctx)
+	if name == "" {
+		return np.sendResponse(ctx, "用法: .clear <名称> [--local]")
+	}
+
+	result, err := np.db.Exec("DELETE FROM notes WHERE chat_id = ? AND name = ?", noteScopeChat(ctx, local), name)
+	if err != nil {
+		return np.sendResponse(ctx, fmt.Sprintf("❌ 删除笔记失败: %v", err))
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if local {
+			return np.sendResponse(ctx, fmt.Sprintf("❌ 当前对话中没有名为 %s 的笔记", name))
+		}
+		return np.sendResponse(ctx, fmt.Sprintf("❌ 没有名为 %s 的全局笔记，当前对话的笔记请使用 --local", name))
+	}
+	return np.sendResponse(ctx, fmt.Sprintf("🗑️ 已删除笔记 %s", name))
+}
+
+// sendResponse 发送响应消息
+func (np *NotePlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,161 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"slices"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// pluginPanicLimit 插件在 pluginPanicWindow 内panic达到该次数后自动停用
+	pluginPanicLimit = 3
+	// pluginPanicWindow 统计panic次数的时间窗口
+	pluginPanicWindow = 10 * time.Minute
+)
+
+// protectedPlugins 不会被自动停用的插件，停用后就无法再用 .apt enable 恢复
+var protectedPlugins = map[string]bool{"core": true, "apt": true}
+
+// handlePanic 记录插件的panic，短时间内多次panic的插件自动停用
+func (gm *GoManager) handlePanic(ctx context.Context, info core.PanicInfo) {
+	name := info.Plugin
+	if name == "" {
+		name = gm.handlerOwner(info.Kind, info.Name)
+	}
+	if name == "" {
+		return
+	}
+	gm.GetMetrics().Add("panics."+name, 1)
+	if protectedPlugins[name] {
+		return
+	}
+
+	now := time.Now()
+	gm.panicMutex.Lock()
+	recent := gm.panics[name][:0]
+	for _, t := range gm.panics[name] {
+		if now.Sub(t) < pluginPanicWindow {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	gm.panics[name] = recent
+	trip := len(recent) >= pluginPanicLimit && !gm.crashed[name]
+	if trip {
+		gm.crashed[name] = true
+		delete(gm.panics, name)
+	}
+	gm.panicMutex.Unlock()
+
+	// 当前仍在插件的处理函数中，在其他goroutine中移除命令和监听器
+	if trip {
+		go gm.disableCrashed(name)
+	}
+}
+
+// handlerOwner 返回注册了该监听器或钩子的插件名，找不到时返回空字符串
+func (gm *GoManager) handlerOwner(kind, name string) string {
+	gm.mutex.RLock()
+	defer gm.mutex.RUnlock()
+	for plugin, handlers := range gm.handlers {
+		switch kind {
+		case "listener":
+			for _, names := range handlers.listeners {
+				if slices.Contains(names, name) {
+					return plugin
+				}
+			}
+		case "hook":
+			for _, names := range handlers.hooks {
+				if slices.Contains(names, name) {
+					return plugin
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// disableCrashed 停用多次panic的插件：移除监听器和钩子，命令改为回复停用提示，并通知到收藏夹
+func (gm *GoManager) disableCrashed(name string) {
+	plugin, exists := gm.GetPlugin(name)
+	if !exists {
+		return
+	}
+	plugin.SetEnabled(false)
+
+	gm.mutex.Lock()
+	handlers := gm.handlers[name]
+	delete(gm.handlers, name)
+	client := gm.client
+	gm.mutex.Unlock()
+	gm.unregisterHandlers(handlers)
+
+	notice := crashNotice(name)
+	for cmdName, cmd := range gm.parser.GetCommandsByPlugin(name) {
+		if cmd.OwnerOnly {
+			gm.parser.RegisterOwnerCommand(cmdName, cmd.Description, name, noticeHandler(notice))
+		} else {
+			gm.parser.RegisterCommand(cmdName, cmd.Description, name, noticeHandler(notice))
+		}
+	}
+	logger.Warnf("Plugin %s disabled after %d panics within %s", name, pluginPanicLimit, pluginPanicWindow)
+
+	if client == nil {
+		return
+	}
+	if _, err := client.MessagesSendMessage(context.Background(), &tg.MessagesSendMessageRequest{
+		Peer:     &tg.InputPeerSelf{},
+		Message:  notice,
+		RandomID: time.Now().UnixNano(),
+	}); err != nil {
+		logger.Warnf("Failed to post crash notice for plugin %s: %v", name, err)
+	}
+}
+
+// enableCrashed 重新启用被自动停用的插件，插件不是被自动停用时返回false。
+// 停用时移除了命令和监听器，通过重新加载恢复，同时重置插件的状态
+func (gm *GoManager) enableCrashed(name string, plugin Plugin) (bool, error) {
+	gm.panicMutex.Lock()
+	crashed := gm.crashed[name]
+	delete(gm.crashed, name)
+	delete(gm.panics, name)
+	gm.panicMutex.Unlock()
+	if !crashed {
+		return false, nil
+	}
+
+	steps, err := gm.ReloadPlugin(context.Background(), name)
+	if err != nil {
+		return true, err
+	}
+	for _, step := range steps {
+		if step.Err != nil {
+			return true, fmt.Errorf("failed to reload plugin %s: %s: %w", name, step.Name, step.Err)
+		}
+	}
+	plugin.SetEnabled(true)
+	return true, nil
+}
+
+// crashNotice 返回插件因多次panic被停用的提示
+func crashNotice(plugin string) string {
+	return fmt.Sprintf("⚠️ 插件 %s 在 %d 分钟内崩溃 %d 次，已自动停用\n查看日志后使用 .apt enable %s 重新启用",
+		plugin, int(pluginPanicWindow.Minutes()), pluginPanicLimit, plugin)
+}
+
+// noticeHandler 返回响应notice的命令处理函数，用于代替被停用插件的命令。
+// 使用 Respond，sudo用户的命令和在 .share 中执行时同样可以看到提示
+func noticeHandler(notice string) command.CommandHandler {
+	return func(ctx *command.CommandContext) error {
+		_, err := ctx.Respond(notice, format.Plain)
+		return err
+	}
+}
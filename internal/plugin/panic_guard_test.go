@@ -0,0 +1,30 @@
+package plugin
+
+import (
+	"nexusvalet/internal/core"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestNoticeHandlerResponds(t *testing.T) {
+	env := newTestEnv()
+	notice := crashNotice("weather")
+	env.parser.RegisterCommand("weather", "天气", "weather", noticeHandler(notice))
+
+	for _, msgEvent := range []*core.MessageEvent{
+		{ChatID: -100, UserID: 1},
+		{ChatID: -100, UserID: 42, Sudo: true}, // sudo用户的消息不能编辑，同样收到提示
+	} {
+		out, err := env.run(msgEvent, "weather 北京")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out == nil || out.Text != notice {
+			t.Errorf("sudo=%v: response = %+v, want %q", msgEvent.Sudo, out, notice)
+		}
+	}
+	if n := len(requests[*tg.MessagesEditMessageRequest](env.inv)); n != 0 {
+		t.Errorf("notice edited %d messages directly instead of using Respond", n)
+	}
+}
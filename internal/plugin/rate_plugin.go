@@ -0,0 +1,481 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"nexusvalet/internal/cache"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// rateDefaultTarget 对话没有设置默认目标货币时使用的货币
+	rateDefaultTarget = "CNY"
+	// rateFallbackTarget 源货币与默认目标货币相同时使用的目标货币
+	rateFallbackTarget = "USD"
+	// rateMaxSuggestions 未知代码时最多提示的相近代码数
+	rateMaxSuggestions = 5
+)
+
+// rateCodePattern 货币或币种代码
+var rateCodePattern = regexp.MustCompile(`^[A-Za-z0-9]{2,10}$`)
+
+// errUnknownCode 来源不支持该代码，继续尝试下一个来源
+var errUnknownCode = errors.New("unknown currency code")
+
+// rateSource 汇率来源。所有来源都以美元计价，不同来源的货币之间通过美元换算
+type rateSource interface {
+	// Name 来源名称，显示在结果中
+	Name() string
+	// USDPrice 返回1单位code的美元价格，不支持该代码时返回 errUnknownCode
+	USDPrice(ctx context.Context, code string) (float64, error)
+	// Codes 返回来源支持的代码，用于提示相近的代码
+	Codes(ctx context.Context) []string
+}
+
+// ratePrice 某个代码的美元价格及其来源
+type ratePrice struct {
+	usd    float64
+	source rateSource
+}
+
+// RatePlugin 汇率插件，法币使用 open.er-api.com，加密货币使用币安的公开行情
+type RatePlugin struct {
+	*BasePlugin
+	httpClient *http.Client
+	sources    []rateSource
+}
+
+// NewRatePlugin 创建汇率插件
+func NewRatePlugin() *RatePlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "rate",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "换算法币和加密货币",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &RatePlugin{
+		BasePlugin: NewBasePlugin(info),
+		httpClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+	plugin.sources = []rateSource{
+		&fiatRateSource{client: plugin.httpClient},
+		&cryptoRateSource{client: plugin.httpClient},
+	}
+	return plugin
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (rp *RatePlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("rate", "换算货币，.rate [数量] <货币> [目标货币] | .rate default <货币>", rp.info.Name, rp.handleRate)
+	logger.Infof("Rate commands registered successfully")
+	return nil
+}
+
+// handleRate 处理rate命令
+func (rp *RatePlugin) handleRate(ctx *command.CommandContext) error {
+	args := ctx.Args
+	if len(args) > 0 && args[0] == "default" {
+		return rp.handleDefault(ctx)
+	}
+	if len(args) == 0 || args[0] == "help" {
+		return rp.sendResponse(ctx, rp.usage(ctx))
+	}
+
+	// 第一个参数是数字时作为数量，否则数量为1
+	amount := 1.0
+	if value, err := strconv.ParseFloat(strings.ReplaceAll(args[0], ",", ""), 64); err == nil {
+		if value <= 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+			return rp.sendResponse(ctx, "❌ 数量必须是正数")
+		}
+		amount = value
+		args = args[1:]
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return rp.sendResponse(ctx, rp.usage(ctx))
+	}
+	from := strings.ToUpper(args[0])
+	to := rp.defaultTarget(ctx.Message.ChatID)
+	if len(args) == 2 {
+		to = strings.ToUpper(args[1])
+	} else if to == from {
+		to = rateFallbackTarget
+	}
+	for _, code := range []string{from, to} {
+		if !rateCodePattern.MatchString(code) {
+			return rp.sendResponse(ctx, fmt.Sprintf("❌ 无效的货币代码 %s，例如 USD、CNY、BTC", code))
+		}
+	}
+
+	fromPrice, err := rp.price(ctx.Context, from)
+	if err != nil {
+		return rp.sendResponse(ctx, rp.explainError(ctx.Context, from, err))
+	}
+	toPrice, err := rp.price(ctx.Context, to)
+	if err != nil {
+		return rp.sendResponse(ctx, rp.explainError(ctx.Context, to, err))
+	}
+
+	rate := fromPrice.usd / toPrice.usd
+	sources := fromPrice.source.Name()
+	if toPrice.source != fromPrice.source {
+		sources += " + " + toPrice.source.Name()
+	}
+	return rp.sendResponse(ctx, fmt.Sprintf("💱 %s %s = %s %s\n\n1 %s = %s %s\n来源: %s",
+		formatAmount(amount, from), from, formatAmount(amount*rate, to), to,
+		from, formatRate(rate), to, sources))
+}
+
+// handleDefault 查看或设置当前对话的默认目标货币
+func (rp *RatePlugin) handleDefault(ctx *command.CommandContext) error {
+	chatID := ctx.Message.ChatID
+	if len(ctx.Args) < 2 {
+		return rp.sendResponse(ctx, fmt.Sprintf("当前对话的默认目标货币: %s\n\n用法: .rate default <货币>", rp.defaultTarget(chatID)))
+	}
+
+	code := strings.ToUpper(ctx.Args[1])
+	if !rateCodePattern.MatchString(code) {
+		return rp.sendResponse(ctx, fmt.Sprintf("❌ 无效的货币代码 %s，例如 USD、CNY、BTC", code))
+	}
+	// 先确认代码可用，避免保存拼写错误的代码
+	if _, err := rp.price(ctx.Context, code); err != nil {
+		return rp.sendResponse(ctx, rp.explainError(ctx.Context, code, err))
+	}
+	if err := pluginStorage(rp.manager).SetChat(rp.info.Name, chatID, "default_target", code); err != nil {
+		return rp.sendResponse(ctx, fmt.Sprintf("❌ 保存设置失败: %v", err))
+	}
+	return rp.sendResponse(ctx, fmt.Sprintf("✅ 当前对话的默认目标货币已设置为 %s", code))
+}
+
+// defaultTarget 返回对话的默认目标货币
+func (rp *RatePlugin) defaultTarget(chatID int64) string {
+	code, ok, err := pluginStorage(rp.manager).GetChat(rp.info.Name, chatID, "default_target")
+	if err != nil || !ok || code == "" {
+		return rateDefaultTarget
+	}
+	return code
+}
+
+// price 依次在各个来源中查找代码的美元价格
+func (rp *RatePlugin) price(ctx context.Context, code string) (*ratePrice, error) {
+	for _, source := range rp.sources {
+		usd, err := source.USDPrice(ctx, code)
+		if errors.Is(err, errUnknownCode) {
+			continue
+		}
+		if err != nil {
+			logger.Ctx(ctx).Warnf("Rate source %s failed for %s: %v", source.Name(), code, err)
+			return nil, fmt.Errorf("%s: %w", source.Name(), err)
+		}
+		return &ratePrice{usd: usd, source: source}, nil
+	}
+	return nil, errUnknownCode
+}
+
+// explainError 返回查询失败的说明，未知代码时提示相近的代码
+func (rp *RatePlugin) explainError(ctx context.Context, code string, err error) string {
+	if !errors.Is(err, errUnknownCode) {
+		return fmt.Sprintf("❌ 查询 %s 的汇率失败: %v", code, err)
+	}
+	var codes []string
+	for _, source := range rp.sources {
+		codes = append(codes, source.Codes(ctx)...)
+	}
+	text := fmt.Sprintf("❌ 未知的货币代码 %s", code)
+	if suggestions := closeCodes(code, codes); len(suggestions) > 0 {
+		text += "，你是不是想输入: " + strings.Join(suggestions, "、")
+	}
+	return text
+}
+
+// closeCodes 返回与code编辑距离不超过1的代码，按字母顺序排列
+func closeCodes(code string, codes []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, candidate := range codes {
+		if seen[candidate] || candidate == code {
+			continue
+		}
+		seen[candidate] = true
+		if editDistance(code, candidate) <= 1 {
+			result = append(result, candidate)
+		}
+	}
+	sort.Strings(result)
+	if len(result) > rateMaxSuggestions {
+		result = result[:rateMaxSuggestions]
+	}
+	return result
+}
+
+// editDistance 返回两个代码之间的编辑距离(插入、删除、替换)
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// currencyDecimals 法币的小数位数(ISO 4217)，未列出的法币为2位
+var currencyDecimals = map[string]int{
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0, "PYG": 0, "UGX": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0, "KMF": 0, "RWF": 0, "GNF": 0, "VUV": 0, "BIF": 0, "DJF": 0,
+	"BHD": 3, "KWD": 3, "OMR": 3, "JOD": 3, "TND": 3, "LYD": 3, "IQD": 3,
+}
+
+// cryptoDecimals 加密货币显示的最大小数位数
+const cryptoDecimals = 8
+
+// formatAmount 按货币的小数位数格式化金额。加密货币最多显示8位小数并去掉末尾的0；
+// 金额小于该货币的最小单位时保留4位有效数字，避免显示为0
+func formatAmount(value float64, code string) string {
+	decimals, fiat := currencyDecimals[code]
+	if !fiat {
+		if _, crypto := cryptoPairs[code]; crypto {
+			decimals = cryptoDecimals
+		} else {
+			decimals = 2
+		}
+	}
+	if value != 0 && math.Abs(value) < math.Pow10(-decimals) {
+		return formatRate(value)
+	}
+	text := strconv.FormatFloat(value, 'f', decimals, 64)
+	if decimals == cryptoDecimals {
+		text = trimZeros(text)
+	}
+	return text
+}
+
+// formatRate 格式化单位汇率，保留至少4位有效数字
+func formatRate(rate float64) string {
+	decimals := 2
+	if rate > 0 {
+		decimals = max(2, 3-int(math.Floor(math.Log10(rate))))
+	}
+	return trimZeros(strconv.FormatFloat(rate, 'f', min(decimals, 12), 64))
+}
+
+// trimZeros 去掉小数末尾的0
+func trimZeros(text string) string {
+	if !strings.Contains(text, ".") {
+		return text
+	}
+	return strings.TrimSuffix(strings.TrimRight(text, "0"), ".")
+}
+
+// usage 返回rate命令的用法
+func (rp *RatePlugin) usage(ctx *command.CommandContext) string {
+	return fmt.Sprintf(`用法:
+• .rate <数量> <货币> <目标货币> - 换算，例如 .rate 100 USD CNY、.rate 0.5 BTC USD
+• .rate [数量] <货币> - 换算为当前对话的默认目标货币
+• .rate default <货币> - 设置当前对话的默认目标货币(当前: %s)
+
+法币使用 ISO 4217 代码，加密货币使用币种代码，例如 USD、CNY、EUR、BTC、ETH`, rp.defaultTarget(ctx.Message.ChatID))
+}
+
+// sendResponse 发送响应消息
+func (rp *RatePlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
+
+// fiatRates 法币汇率表(1美元可以兑换的各货币数量)
+var fiatRates = cache.New[string, map[string]float64]("rate_fiat", cache.Options{
+	TTL:        5 * time.Minute,
+	MaxEntries: 1,
+})
+
+// fiatRateSource 法币汇率，使用不需要API key的 open.er-api.com
+type fiatRateSource struct {
+	client *http.Client
+}
+
+// Name 实现rateSource接口
+func (f *fiatRateSource) Name() string {
+	return "ExchangeRate-API"
+}
+
+// USDPrice 实现rateSource接口
+func (f *fiatRateSource) USDPrice(ctx context.Context, code string) (float64, error) {
+	rates, err := f.rates(ctx)
+	if err != nil {
+		return 0, err
+	}
+	perUSD, ok := rates[code]
+	if !ok || perUSD <= 0 {
+		return 0, errUnknownCode
+	}
+	return 1 / perUSD, nil
+}
+
+// Codes 实现rateSource接口，汇率表获取失败时返回nil
+func (f *fiatRateSource) Codes(ctx context.Context) []string {
+	rates, err := f.rates(ctx)
+	if err != nil {
+		return nil
+	}
+	codes := make([]string, 0, len(rates))
+	for code := range rates {
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// rates 返回以美元为基准的汇率表，缓存5分钟
+func (f *fiatRateSource) rates(ctx context.Context) (map[string]float64, error) {
+	return fiatRates.Fill("USD", func() (map[string]float64, time.Duration, error) {
+		body, err := rateGet(ctx, f.client, "https://open.er-api.com/v6/latest/USD")
+		if err != nil {
+			return nil, 0, err
+		}
+		rates, err := parseFiatRates(body)
+		return rates, 0, err
+	})
+}
+
+// parseFiatRates 解析 open.er-api.com 的响应：{"result": "success", "rates": {"CNY": 7.1, ...}}
+func parseFiatRates(body []byte) (map[string]float64, error) {
+	var response struct {
+		Result    string             `json:"result"`
+		ErrorType string             `json:"error-type"`
+		Rates     map[string]float64 `json:"rates"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("解析JSON出错: %w", err)
+	}
+	if response.Result != "success" {
+		return nil, fmt.Errorf("查询失败: %s", response.ErrorType)
+	}
+	if len(response.Rates) == 0 {
+		return nil, fmt.Errorf("汇率表为空")
+	}
+	return response.Rates, nil
+}
+
+// cryptoPairs 常见的加密货币，用于判断小数位数和提示相近的代码。
+// 不在列表中的代码也会向币安查询
+var cryptoPairs = map[string]struct{}{
+	"BTC": {}, "ETH": {}, "USDT": {}, "USDC": {}, "BNB": {}, "SOL": {}, "XRP": {}, "DOGE": {},
+	"TON": {}, "ADA": {}, "TRX": {}, "AVAX": {}, "DOT": {}, "LINK": {}, "LTC": {}, "BCH": {},
+	"SHIB": {}, "UNI": {}, "ETC": {}, "XLM": {}, "ATOM": {}, "FIL": {}, "NEAR": {}, "APT": {},
+}
+
+// cryptoPrices 加密货币的美元价格，缓存2分钟
+var cryptoPrices = cache.New[string, float64]("rate_crypto", cache.Options{
+	TTL:        2 * time.Minute,
+	MaxEntries: 200,
+})
+
+// cryptoRateSource 加密货币价格，使用币安 <币种>USDT 交易对的最新成交价，
+// USDT 按1美元计算
+type cryptoRateSource struct {
+	client *http.Client
+}
+
+// Name 实现rateSource接口
+func (c *cryptoRateSource) Name() string {
+	return "Binance"
+}
+
+// USDPrice 实现rateSource接口
+func (c *cryptoRateSource) USDPrice(ctx context.Context, code string) (float64, error) {
+	if code == "USDT" {
+		return 1, nil
+	}
+	return cryptoPrices.Fill(code, func() (float64, time.Duration, error) {
+		body, err := rateGet(ctx, c.client, "https://api.binance.com/api/v3/ticker/price?symbol="+code+"USDT")
+		if err != nil {
+			return 0, 0, err
+		}
+		price, err := parseBinancePrice(body)
+		return price, 0, err
+	})
+}
+
+// Codes 实现rateSource接口
+func (c *cryptoRateSource) Codes(ctx context.Context) []string {
+	codes := make([]string, 0, len(cryptoPairs))
+	for code := range cryptoPairs {
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// parseBinancePrice 解析币安行情接口的响应：{"symbol": "BTCUSDT", "price": "65000.00"}，
+// 交易对不存在时为 {"code": -1121, "msg": "Invalid symbol."}
+func parseBinancePrice(body []byte) (float64, error) {
+	var response struct {
+		Price string `json:"price"`
+		Code  int    `json:"code"`
+		Msg   string `json:"msg"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return 0, fmt.Errorf("解析JSON出错: %w", err)
+	}
+	if response.Code == -1121 {
+		return 0, errUnknownCode
+	}
+	if response.Msg != "" {
+		return 0, fmt.Errorf("%s", response.Msg)
+	}
+	price, err := strconv.ParseFloat(response.Price, 64)
+	if err != nil || price <= 0 {
+		return 0, fmt.Errorf("无效的价格 %q", response.Price)
+	}
+	return price, nil
+}
+
+// rateGet 请求汇率接口，返回响应内容。币安对无效的交易对返回400，内容仍需解析
+func rateGet(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送HTTP请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != 200 && resp.StatusCode != 400 {
+		return nil, fmt.Errorf("响应异常 (状态码: %d)", resp.StatusCode)
+	}
+	return body, nil
+}
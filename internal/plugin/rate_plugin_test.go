@@ -0,0 +1,296 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/storage"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const (
+	erAPIHost   = "open.er-api.com"
+	binanceHost = "api.binance.com"
+)
+
+// newRateTest 创建使用样例响应的汇率插件，对话设置保存在临时数据库中
+func newRateTest(t *testing.T) (*RatePlugin, *fixtureTransport, *testEnv) {
+	t.Helper()
+	transport := &fixtureTransport{bodies: map[string][]byte{
+		erAPIHost:                            readFixture(t, "er_api_latest_usd.json"),
+		binanceHost:                          readFixture(t, "binance_invalid_symbol.json"),
+		binanceHost + "?symbol=BTCUSDT":      readFixture(t, "binance_btcusdt.json"),
+		binanceHost + "?symbol=ETHUSDT":      []byte(`{"symbol":"ETHUSDT","price":"3000.5"}`),
+		binanceHost + "?symbol=BROKENUSDT":   []byte(`{"code":-1003,"msg":"Too many requests."}`),
+		binanceHost + "?symbol=NOPRICEUSDT":  []byte(`{"symbol":"NOPRICEUSDT","price":"0"}`),
+		binanceHost + "?symbol=UNKNOWNXUSDT": readFixture(t, "binance_invalid_symbol.json"),
+	}, statuses: map[string]int{binanceHost: http.StatusBadRequest}}
+
+	rp := NewRatePlugin()
+	rp.httpClient.Transport = transport
+	if err := rp.Initialize(context.Background(), &GoManager{storage: storage.NewStore(openPluginDB(t))}); err != nil {
+		t.Fatal(err)
+	}
+	env := newTestEnv()
+	rp.RegisterCommands(env.parser)
+
+	clear := func() {
+		fiatRates.Clear()
+		cryptoPrices.Clear()
+	}
+	clear()
+	t.Cleanup(clear)
+	return rp, transport, env
+}
+
+// hostRequests 返回发往host的请求数
+func (f *fixtureTransport) hostRequests(host string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, req := range f.requests {
+		if req.URL.Host == host {
+			n++
+		}
+	}
+	return n
+}
+
+func TestParseFiatRates(t *testing.T) {
+	rates, err := parseFiatRates(readFixture(t, "er_api_latest_usd.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"USD": 1, "CNY": 7.2346, "EUR": 0.92, "GBP": 0.79, "HKD": 7.82, "JPY": 151.5, "KWD": 0.3075}
+	if !reflect.DeepEqual(rates, want) {
+		t.Errorf("rates = %v, want %v", rates, want)
+	}
+
+	tests := []struct {
+		name, body, want string
+	}{
+		{"api error", string(readFixture(t, "er_api_error.json")), "查询失败: unsupported-code"},
+		{"empty rates", `{"result": "success", "rates": {}}`, "汇率表为空"},
+	}
+	for _, tt := range tests {
+		if _, err := parseFiatRates([]byte(tt.body)); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := parseFiatRates([]byte("not json")); err == nil {
+		t.Error("invalid JSON should fail")
+	}
+}
+
+func TestParseBinancePrice(t *testing.T) {
+	price, err := parseBinancePrice(readFixture(t, "binance_btcusdt.json"))
+	if err != nil || price != 65000 {
+		t.Fatalf("price = %v, %v; want 65000", price, err)
+	}
+	if _, err := parseBinancePrice(readFixture(t, "binance_invalid_symbol.json")); !errors.Is(err, errUnknownCode) {
+		t.Errorf("invalid symbol: err = %v, want errUnknownCode", err)
+	}
+	tests := []struct {
+		body, want string
+	}{
+		{`{"code": -1003, "msg": "Too many requests."}`, "Too many requests."},
+		{`{"symbol": "XUSDT", "price": "0"}`, `无效的价格 "0"`},
+		{`{"symbol": "XUSDT", "price": "abc"}`, `无效的价格 "abc"`},
+	}
+	for _, tt := range tests {
+		if _, err := parseBinancePrice([]byte(tt.body)); err == nil || err.Error() != tt.want {
+			t.Errorf("parseBinancePrice(%s): err = %v, want %q", tt.body, err, tt.want)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		value float64
+		code  string
+		want  string
+	}{
+		{100, "USD", "100.00"},
+		{723.456, "CNY", "723.46"},
+		{15150.4, "JPY", "15150"},
+		{1.2346, "KWD", "1.235"},
+		{0.5, "BTC", "0.5"},
+		{32500, "BTC", "32500"},
+		{0.123456789, "ETH", "0.12345679"},
+		{2.5, "XYZ", "2.50"}, // 未知的代码按2位小数
+		{0.00123456, "USD", "0.001235"},
+		{0.4, "JPY", "0.4"},
+		{0, "USD", "0.00"},
+	}
+	for _, tt := range tests {
+		if got := formatAmount(tt.value, tt.code); got != tt.want {
+			t.Errorf("formatAmount(%v, %s) = %q, want %q", tt.value, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	tests := []struct {
+		rate float64
+		want string
+	}{
+		{7.2346, "7.235"},
+		{65000, "65000"},
+		{151.5, "151.5"},
+		{0.1382, "0.1382"},
+		{0.92, "0.92"},
+		{0.0066006, "0.006601"},
+		{1e-15, "0"}, // 最多12位小数
+		{0, "0"},
+	}
+	for _, tt := range tests {
+		if got := formatRate(tt.rate); got != tt.want {
+			t.Errorf("formatRate(%v) = %q, want %q", tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestCloseCodes(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"USD", "USDT", 1},
+		{"CNY", "CNH", 1},
+		{"BTC", "ETH", 2},
+		{"", "AB", 2},
+		{"EUR", "EUR", 0},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	// 去重、排除自身、按字母顺序并限制数量
+	if got := closeCodes("USX", []string{"USDT", "USD", "UZS", "USD", "USX"}); !reflect.DeepEqual(got, []string{"USD"}) {
+		t.Errorf("closeCodes(USX) = %q", got)
+	}
+	got := closeCodes("AAA", []string{"AAG", "AAF", "AAE", "AAD", "AAC", "AAB"})
+	if want := []string{"AAB", "AAC", "AAD", "AAE", "AAF"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("closeCodes(AAA) = %q, want %q", got, want)
+	}
+}
+
+func TestRateCommandConverts(t *testing.T) {
+	_, transport, env := newRateTest(t)
+
+	tests := []struct {
+		command, want string
+	}{
+		{"rate 100 USD CNY", "💱 100.00 USD = 723.46 CNY\n\n1 USD = 7.235 CNY\n来源: ExchangeRate-API"},
+		{"rate 0.5 btc usd", "💱 0.5 BTC = 32500.00 USD\n\n1 BTC = 65000 USD\n来源: Binance + ExchangeRate-API"},
+		{"rate 1,000 JPY USD", "💱 1000 JPY = 6.60 USD\n\n1 JPY = 0.006601 USD\n来源: ExchangeRate-API"},
+		{"rate 2 ETH BTC", "💱 2 ETH = 0.09232308 BTC\n\n1 ETH = 0.04616 BTC\n来源: Binance"},
+		{"rate 10 USDT", "💱 10 USDT = 72.35 CNY\n\n1 USDT = 7.235 CNY\n来源: Binance + ExchangeRate-API"},
+		{"rate CNY", "💱 1.00 CNY = 0.14 USD\n\n1 CNY = 0.1382 USD\n来源: ExchangeRate-API"},
+	}
+	for _, tt := range tests {
+		out, err := env.run(nil, tt.command)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.command, err)
+		}
+		if out.Text != tt.want {
+			t.Errorf("%s =\n%s\nwant\n%s", tt.command, out.Text, tt.want)
+		}
+	}
+
+	// 法币汇率表和币安价格都在缓存时间内只请求一次
+	if n := transport.hostRequests(erAPIHost); n != 1 {
+		t.Errorf("made %d requests to %s, want 1", n, erAPIHost)
+	}
+	var symbols []string
+	for _, req := range transport.requests {
+		if req.URL.Host == binanceHost {
+			symbols = append(symbols, req.URL.Query().Get("symbol"))
+		}
+	}
+	sort.Strings(symbols)
+	if want := []string{"BTCUSDT", "ETHUSDT"}; !reflect.DeepEqual(symbols, want) {
+		t.Errorf("binance symbols = %q, want %q", symbols, want)
+	}
+}
+
+func TestRateCommandErrors(t *testing.T) {
+	_, _, env := newRateTest(t)
+
+	tests := []struct {
+		command, want string
+	}{
+		{"rate -5 USD", "❌ 数量必须是正数"},
+		{"rate 0 USD", "❌ 数量必须是正数"},
+		{"rate 1 US$ CNY", "❌ 无效的货币代码 US$，例如 USD、CNY、BTC"},
+		{"rate 1 USDX CNY", "❌ 未知的货币代码 USDX，你是不是想输入: USD、USDC、USDT"},
+		{"rate 1 USD UNKNOWNX", "❌ 未知的货币代码 UNKNOWNX"},
+		{"rate 1 BROKEN USD", "❌ 查询 BROKEN 的汇率失败: Binance: Too many requests."},
+		{"rate 1 NOPRICE USD", `❌ 查询 NOPRICE 的汇率失败: Binance: 无效的价格 "0"`},
+	}
+	for _, tt := range tests {
+		out, err := env.run(nil, tt.command)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.command, err)
+		}
+		if out.Text != tt.want {
+			t.Errorf("%s = %q, want %q", tt.command, out.Text, tt.want)
+		}
+	}
+}
+
+func TestRateFiatSourceUnavailable(t *testing.T) {
+	_, transport, env := newRateTest(t)
+	transport.statuses[erAPIHost] = http.StatusBadGateway
+
+	out, _ := env.run(nil, "rate 1 USD CNY")
+	if want := "❌ 查询 USD 的汇率失败: ExchangeRate-API: 响应异常 (状态码: 502)"; out.Text != want {
+		t.Errorf("output = %q, want %q", out.Text, want)
+	}
+
+	// 失败的结果不缓存，服务恢复后重新请求
+	delete(transport.statuses, erAPIHost)
+	out, _ = env.run(nil, "rate 1 USD CNY")
+	if want := "💱 1.00 USD = 7.23 CNY\n\n1 USD = 7.235 CNY\n来源: ExchangeRate-API"; out.Text != want {
+		t.Errorf("output after recovery = %q, want %q", out.Text, want)
+	}
+	if n := transport.hostRequests(erAPIHost); n != 2 {
+		t.Errorf("made %d requests, want 2", n)
+	}
+}
+
+func TestRateDefaultTarget(t *testing.T) {
+	_, _, env := newRateTest(t)
+	otherChat := func() *core.MessageEvent { return &core.MessageEvent{ChatID: -200, UserID: 1} }
+
+	tests := []struct {
+		msgEvent *core.MessageEvent
+		command  string
+		want     string
+	}{
+		{nil, "rate default", "当前对话的默认目标货币: CNY\n\n用法: .rate default <货币>"},
+		{nil, "rate default usdx", "❌ 未知的货币代码 USDX，你是不是想输入: USD、USDC、USDT"},
+		{nil, "rate default eur", "✅ 当前对话的默认目标货币已设置为 EUR"},
+		{nil, "rate default", "当前对话的默认目标货币: EUR\n\n用法: .rate default <货币>"},
+		{nil, "rate 10 USD", "💱 10.00 USD = 9.20 EUR\n\n1 USD = 0.92 EUR\n来源: ExchangeRate-API"},
+		// 源货币与默认目标货币相同时换算为美元
+		{nil, "rate EUR", "💱 1.00 EUR = 1.09 USD\n\n1 EUR = 1.087 USD\n来源: ExchangeRate-API"},
+		// 其他对话不受影响
+		{otherChat(), "rate default", "当前对话的默认目标货币: CNY\n\n用法: .rate default <货币>"},
+		{otherChat(), "rate 10 USD", "💱 10.00 USD = 72.35 CNY\n\n1 USD = 7.235 CNY\n来源: ExchangeRate-API"},
+	}
+	for _, tt := range tests {
+		out, err := env.run(tt.msgEvent, tt.command)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.command, err)
+		}
+		if out.Text != tt.want {
+			t.Errorf("%s =\n%s\nwant\n%s", tt.command, out.Text, tt.want)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/pkg/logger"
+	"strings"
+	"time"
+)
+
+// reloadShutdownTimeout 重新加载时等待插件关闭(包括正在执行的后台任务)的最长时间
+const reloadShutdownTimeout = 30 * time.Second
+
+// pluginHandlers 插件注册的监听器和钩子，重新加载时据此移除
+type pluginHandlers struct {
+	listeners map[core.ListenerType][]string
+	hooks     map[core.HookType][]string
+}
+
+// registerHandlers 注册插件的事件处理器和钩子，并记录新增的监听器和钩子
+func (gm *GoManager) registerHandlers(name string, plugin Plugin) (pluginHandlers, error) {
+	var handlers pluginHandlers
+
+	if eventPlugin, ok := plugin.(EventPlugin); ok {
+		before := listenerSet(gm.dispatcher)
+		err := eventPlugin.RegisterEventHandlers(gm.dispatcher)
+		handlers.listeners = make(map[core.ListenerType][]string)
+		for listenerType, listeners := range gm.dispatcher.GetAllListeners() {
+			for _, l := range listeners {
+				if !before[l] {
+					handlers.listeners[listenerType] = append(handlers.listeners[listenerType], l.Name)
+				}
+			}
+		}
+		if err != nil {
+			return handlers, fmt.Errorf("failed to register event handlers for plugin %s: %w", name, err)
+		}
+	}
+
+	if hookPlugin, ok := plugin.(HookPlugin); ok {
+		before := hookSet(gm.hookManager)
+		err := hookPlugin.RegisterHooks(gm.hookManager)
+		handlers.hooks = make(map[core.HookType][]string)
+		for hookType, hooks := range gm.hookManager.GetAllHooks() {
+			for _, h := range hooks {
+				if !before[h] {
+					handlers.hooks[hookType] = append(handlers.hooks[hookType], h.Name)
+				}
+			}
+		}
+		if err != nil {
+			return handlers, fmt.Errorf("failed to register hooks for plugin %s: %w", name, err)
+		}
+	}
+
+	return handlers, nil
+}
+
+// unregisterHandlers 移除插件注册的监听器和钩子
+func (gm *GoManager) unregisterHandlers(handlers pluginHandlers) {
+	for listenerType, names := range handlers.listeners {
+		for _, name := range names {
+			gm.dispatcher.UnregisterListener(listenerType, name)
+		}
+	}
+	for hookType, names := range handlers.hooks {
+		for _, name := range names {
+			gm.hookManager.UnregisterHook(hookType, name)
+		}
+	}
+}
+
+// listenerSet 当前已注册的监听器
+func listenerSet(dispatcher *core.EventDispatcher) map[*core.Listener]bool {
+	set := make(map[*core.Listener]bool)
+	for _, listeners := range dispatcher.GetAllListeners() {
+		for _, l := range listeners {
+			set[l] = true
+		}
+	}
+	return set
+}
+
+// hookSet 当前已注册的钩子
+func hookSet(hookManager *core.HookManager) map[*core.Hook]bool {
+	set := make(map[*core.Hook]bool)
+	for _, hooks := range hookManager.GetAllHooks() {
+		for _, h := range hooks {
+			set[h] = true
+		}
+	}
+	return set
+}
+
+// ReloadStep 重新加载插件的一个步骤
+type ReloadStep struct {
+	Name    string
+	Err     error
+	Skipped bool
+}
+
+// ReloadPlugin 在不重启的情况下重新加载插件：移除命令和监听器、关闭插件、
+// 重新初始化并注册命令，再注入Telegram客户端和执行连接后的初始化。
+// 插件不存在时返回错误，其余每个步骤的结果都记录在返回的步骤列表中。
+// 执行过程中不持有命令解析器和管理器的锁，正在执行的命令处理函数会继续使用旧的状态运行完
+func (gm *GoManager) ReloadPlugin(ctx context.Context, name string) ([]ReloadStep, error) {
+	gm.reloadMutex.Lock()
+	defer gm.reloadMutex.Unlock()
+
+	gm.mutex.RLock()
+	plugin, exists := gm.plugins[name]
+	client := gm.client
+	initCtx := gm.initCtx
+	gm.mutex.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("plugin %s not found", name)
+	}
+
+	log := logger.Ctx(ctx)
+	log.Infof("Reloading plugin %s", name)
+
+	var steps []ReloadStep
+	record := func(step string, err error) bool {
+		steps = append(steps, ReloadStep{Name: step, Err: err})
+		if err != nil {
+			log.Errorf("Reload plugin %s: %s failed: %v", name, step, err)
+		}
+		return err == nil
+	}
+	skip := func(step string) {
+		steps = append(steps, ReloadStep{Name: step, Skipped: true})
+	}
+
+	// 先移除命令和监听器，关闭期间不再接收新的命令和事件
+	enabled := plugin.IsEnabled()
+	gm.parser.UnregisterPluginCommands(name)
+	gm.mutex.Lock()
+	handlers := gm.handlers[name]
+	delete(gm.handlers, name)
+	delete(gm.inits, name)
+	gm.mutex.Unlock()
+	gm.unregisterHandlers(handlers)
+	record("unregister", nil)
+
+	// 关闭失败时仍然继续，插件自己的后台任务可能已处于异常状态
+	shutdownCtx, cancel := context.WithTimeout(ctx, reloadShutdownTimeout)
+	record("shutdown", plugin.Shutdown(shutdownCtx))
+	cancel()
+
+	initStart := time.Now()
+	if !record("initialize", plugin.Initialize(context.Background(), gm)) {
+		return steps, nil
+	}
+	plugin.SetEnabled(enabled)
+
+	// 在注册命令前登记连接后的初始化，命令首次使用时会等待初始化完成
+	var pi *pluginInit
+	gm.mutex.Lock()
+	gm.initTimes[name] = time.Since(initStart)
+	if postConnect, ok := plugin.(PostConnectPlugin); ok {
+		pi = &pluginInit{plugin: postConnect, done: make(chan struct{})}
+		gm.inits[name] = pi
+	}
+	gm.mutex.Unlock()
+
+	if cmdPlugin, ok := plugin.(CommandPlugin); ok {
+		record("commands", cmdPlugin.RegisterCommands(gm.parser))
+	} else {
+		skip("commands")
+	}
+
+	_, isEvent := plugin.(EventPlugin)
+	_, isHook := plugin.(HookPlugin)
+	if isEvent || isHook {
+		handlers, err := gm.registerHandlers(name, plugin)
+		gm.mutex.Lock()
+		gm.handlers[name] = handlers
+		gm.mutex.Unlock()
+		record("handlers", err)
+	} else {
+		skip("handlers")
+	}
+
+	if client != nil {
+		gm.setPluginClient(name, plugin, client)
+		record("client", nil)
+	} else {
+		skip("client")
+	}
+
+	// 还未连接时由 StartPostConnectInit 统一执行
+	if pi != nil && initCtx != nil {
+		record("post_connect", pi.run(initCtx, name))
+	} else {
+		skip("post_connect")
+	}
+
+	log.Infof("Plugin %s reloaded", name)
+	return steps, nil
+}
+
+// reloadStepNames 重新加载步骤的显示名称
+var reloadStepNames = map[string]string{
+	"unregister":   "Unregister commands and listeners",
+	"shutdown":     "Shutdown",
+	"initialize":   "Initialize",
+	"commands":     "Register commands",
+	"handlers":     "Register event handlers and hooks",
+	"client":       "Inject Telegram client",
+	"post_connect": "Post-connect initialization",
+}
+
+// formatReloadSteps 格式化重新加载的结果
+func formatReloadSteps(name string, steps []ReloadStep, elapsed time.Duration) string {
+	failed := 0
+	var b strings.Builder
+	for _, s := range steps {
+		label := reloadStepNames[s.Name]
+		if label == "" {
+			label = s.Name
+		}
+		switch {
+		case s.Skipped:
+			b.WriteString(fmt.Sprintf("\n➖ %s (skipped)", label))
+		case s.Err != nil:
+			failed++
+			b.WriteString(fmt.Sprintf("\n❌ %s: %v", label, s.Err))
+		default:
+			b.WriteString(fmt.Sprintf("\n✅ %s", label))
+		}
+	}
+
+	header := fmt.Sprintf("🔄 Plugin %s reloaded in %s", name, elapsed.Round(time.Millisecond))
+	if failed > 0 {
+		header = fmt.Sprintf("⚠️ Plugin %s reloaded with %d error(s)", name, failed)
+	}
+	return header + "\n" + b.String()
+}
+
+// handleReload 处理reload命令
+func (ap *APTPlugin) handleReload(ctx *command.CommandContext) error {
+	if len(ctx.Args) != 1 {
+		return ap.sendResponse(ctx, "Usage: .reload <plugin_name>")
+	}
+
+	goManager, ok := ap.manager.(*GoManager)
+	if !ok {
+		return ap.sendResponse(ctx, "Unsupported plugin manager type")
+	}
+
+	pluginName := ctx.Args[0]
+	if _, exists := goManager.GetPlugin(pluginName); !exists {
+		return ap.sendResponse(ctx, fmt.Sprintf("Plugin %s not found", pluginName))
+	}
+	if err := ap.sendResponse(ctx, fmt.Sprintf("🔄 Reloading plugin %s...", pluginName)); err != nil {
+		logger.Ctx(ctx.Context).Warnf("Failed to send reload progress: %v", err)
+	}
+
+	start := time.Now()
+	steps, err := goManager.ReloadPlugin(ctx.Context, pluginName)
+	if err != nil {
+		return ap.sendResponse(ctx, fmt.Sprintf("Failed to reload plugin %s: %v", pluginName, err))
+	}
+	return ap.sendResponse(ctx, formatReloadSteps(pluginName, steps, time.Since(start)))
+}
@@ -0,0 +1,398 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"nexusvalet/pkg/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// reminderLateAfter 超过原定时间多久才在提醒中标记 (late)
+	reminderLateAfter = time.Minute
+	// reminderMaxAttempts 发送失败时最多尝试的次数，之后放弃并删除提醒
+	reminderMaxAttempts = 3
+	// reminderRetryDelay 发送失败后再次尝试的间隔
+	reminderRetryDelay = time.Minute
+)
+
+// reminder 一条一次性提醒
+type reminder struct {
+	ID      int64
+	ChatID  int64
+	ReplyTo int // 提醒回复的消息ID，0表示不回复
+	Text    string
+	FireAt  time.Time
+}
+
+// ReminderPlugin 一次性提醒，在指定时间后或指定时刻在原对话中发送提醒
+type ReminderPlugin struct {
+	*BasePlugin
+	db           *sql.DB
+	telegramAPI  *tg.Client
+	peerResolver *peers.Resolver
+	timers       map[int64]*time.Timer // 提醒ID -> 定时器
+	mutex        sync.Mutex
+}
+
+// NewReminderPlugin 创建提醒插件
+func NewReminderPlugin(db *sql.DB) *ReminderPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "remind",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "一次性提醒，到时间后在原对话中回复提醒",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &ReminderPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+		timers:     make(map[int64]*time.Timer),
+	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+
+	return plugin
+}
+
+// initDatabase 初始化数据库表
+func (rp *ReminderPlugin) initDatabase() {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS reminders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		reply_to INTEGER NOT NULL DEFAULT 0,
+		text TEXT NOT NULL,
+		fire_at INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);`
+
+	_, err := rp.db.Exec(createTableSQL)
+	if err != nil {
+		logger.Errorf("Failed to create reminders table: %v", err)
+	}
+}
+
+// SetTelegramClient 设置Telegram客户端和Peer解析器
+func (rp *ReminderPlugin) SetTelegramClient(client *tg.Client, peerResolver *peers.Resolver) {
+	rp.telegramAPI = client
+	rp.peerResolver = peerResolver
+}
+
+// InitializeAfterConnect 实现PostConnectPlugin接口，连接后从数据库重建定时器，
+// 程序未运行期间已到期的提醒立即发送
+func (rp *ReminderPlugin) InitializeAfterConnect(ctx context.Context) error {
+	reminders, err := rp.loadReminders("SELECT id, chat_id, reply_to, text, fire_at FROM reminders ORDER BY fire_at")
+	if err != nil {
+		return fmt.Errorf("failed to load reminders: %w", err)
+	}
+	for _, r := range reminders {
+		rp.schedule(r)
+	}
+	if len(reminders) > 0 {
+		logger.Infof("Scheduled %d pending reminders", len(reminders))
+	}
+	return nil
+}
+
+// Shutdown 停止所有定时器，重新加载时由 InitializeAfterConnect 从数据库重建
+func (rp *ReminderPlugin) Shutdown(ctx context.Context) error {
+	rp.mutex.Lock()
+	for id, timer := range rp.timers {
+		timer.Stop()
+		delete(rp.timers, id)
+	}
+	rp.mutex.Unlock()
+	return rp.BasePlugin.Shutdown(ctx)
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (rp *ReminderPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("remind", "一次性提醒：<时长|日期 时间> <内容> | list | cancel <ID>", rp.info.Name, rp.handleRemind)
+	logger.Infof("Reminder commands registered successfully")
+	return nil
+}
+
+// handleRemind 处理remind命令
+func (rp *ReminderPlugin) handleRemind(ctx *command.CommandContext) error {
+	if len(ctx.Args) == 0 {
+		return rp.sendResponse(ctx, rp.usage())
+	}
+
+	switch ctx.Args[0] {
+	case "list":
+		return rp.handleList(ctx)
+	case "cancel":
+		return rp.handleCancel(ctx)
+	case "help":
+		return rp.sendResponse(ctx, rp.usage())
+	}
+	return rp.handleAdd(ctx)
+}
+
+// handleAdd 添加提醒，回复消息使用时提醒回复该消息，否则回复命令消息
+func (rp *ReminderPlugin) handleAdd(ctx *command.CommandContext) error {
+	fireAt, used, err := parseReminderTime(ctx.Args, time.Now())
+	if err != nil {
+		return rp.sendResponse(ctx, fmt.Sprintf("❌ %v\n\n%s", err, rp.usage()))
+	}
+	text := ctx.ArgsStringFrom(used)
+	if text == "" {
+		return rp.sendResponse(ctx, "❌ 请输入提醒内容\n\n"+rp.usage())
+	}
+
+	r := &reminder{
+		ChatID:  ctx.Message.ChatID,
+		ReplyTo: ctx.Message.Message.ID,
+		Text:    text,
+		FireAt:  fireAt,
+	}
+	if replyTo, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader); ok && replyTo.ReplyToMsgID != 0 {
+		r.ReplyTo = replyTo.ReplyToMsgID
+	}
+
+	result, err := rp.db.Exec("INSERT INTO reminders (chat_id, reply_to, text, fire_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		r.ChatID, r.ReplyTo, r.Text, r.FireAt.Unix(), time.Now().Unix())
+	if err != nil {
+		return rp.sendResponse(ctx, fmt.Sprintf("❌ 保存提醒失败: %v", err))
+	}
+	r.ID, _ = result.LastInsertId()
+	rp.schedule(r)
+
+	return rp.sendResponse(ctx, fmt.Sprintf("⏰ 提醒 #%d 已设置\n\n时间: %s (%s后)\n内容: %s",
+		r.ID, r.FireAt.Format("2006-01-02 15:04:05"), formatTTL(time.Until(r.FireAt).Round(time.Second)), r.Text))
+}
+
+// handleList 列出当前对话中未触发的提醒
+func (rp *ReminderPlugin) handleList(ctx *command.CommandContext) error {
+	reminders, err := rp.loadReminders("SELECT id, chat_id, reply_to, text, fire_at FROM reminders WHERE chat_id = ? ORDER BY fire_at", ctx.Message.ChatID)
+	if err != nil {
+		return rp.sendResponse(ctx, fmt.Sprintf("❌ 读取提醒失败: %v", err))
+	}
+	if len(reminders) == 0 {
+		return rp.sendResponse(ctx, "⏰ 当前对话没有待发送的提醒")
+	}
+
+	now := time.Now()
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("⏰ 待发送的提醒 (%d):\n", len(reminders)))
+	for _, r := range reminders {
+		remaining := "即将发送"
+		if d := r.FireAt.Sub(now); d > 0 {
+			remaining = formatTTL(d.Round(time.Second)) + "后"
+		}
+		b.WriteString(fmt.Sprintf("\n#%d %s (%s)\n   %s", r.ID, r.FireAt.Format("2006-01-02 15:04"), remaining, tplPreview(r.Text)))
+	}
+	return rp.sendResponse(ctx, b.String())
+}
+
+// handleCancel 取消当前对话中的提醒
+func (rp *ReminderPlugin) handleCancel(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return rp.sendResponse(ctx, "用法: .remind cancel <ID>")
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(ctx.Args[1], "#"), 10, 64)
+	if err != nil {
+		return rp.sendResponse(ctx, "❌ 无效的提醒ID")
+	}
+
+	result, err := rp.db.Exec("DELETE FROM reminders WHERE id = ? AND chat_id = ?", id, ctx.Message.ChatID)
+	if err != nil {
+		return rp.sendResponse(ctx, fmt.Sprintf("❌ 取消提醒失败: %v", err))
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return rp.sendResponse(ctx, fmt.Sprintf("❌ 当前对话中没有提醒 #%d", id))
+	}
+	rp.stopTimer(id)
+	return rp.sendResponse(ctx, fmt.Sprintf("🗑️ 已取消提醒 #%d", id))
+}
+
+// loadReminders 按查询读取提醒
+func (rp *ReminderPlugin) loadReminders(query string, args ...interface{}) ([]*reminder, error) {
+	rows, err := rp.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []*reminder
+	for rows.Next() {
+		var r reminder
+		var fireAt int64
+		if err := rows.Scan(&r.ID, &r.ChatID, &r.ReplyTo, &r.Text, &fireAt); err != nil {
+			return nil, err
+		}
+		r.FireAt = time.Unix(fireAt, 0)
+		reminders = append(reminders, &r)
+	}
+	return reminders, rows.Err()
+}
+
+// schedule 为提醒创建定时器，已到期的提醒立即发送
+func (rp *ReminderPlugin) schedule(r *reminder) {
+	rp.scheduleAttempt(r, time.Until(r.FireAt), 1)
+}
+
+// scheduleAttempt 在delay后进行第attempt次发送
+func (rp *ReminderPlugin) scheduleAttempt(r *reminder, delay time.Duration, attempt int) {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+	if old, ok := rp.timers[r.ID]; ok {
+		old.Stop()
+	}
+	rp.timers[r.ID] = time.AfterFunc(max(delay, 0), func() { rp.fire(r, attempt) })
+}
+
+// stopTimer 停止并移除提醒的定时器
+func (rp *ReminderPlugin) stopTimer(id int64) {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+	if timer, ok := rp.timers[id]; ok {
+		timer.Stop()
+		delete(rp.timers, id)
+	}
+}
+
+// fire 发送提醒，成功后删除；失败时隔一段时间重试，超过次数后放弃
+func (rp *ReminderPlugin) fire(r *reminder, attempt int) {
+	// 定时提醒不经过更新处理流程，单独分配关联ID
+	ctx, cancel := context.WithTimeout(logger.WithFields(context.Background(), logger.Fields{
+		CorrelationID: logger.NewCorrelationID(),
+		ChatID:        r.ChatID,
+		Command:       fmt.Sprintf("remind#%d", r.ID),
+	}), 30*time.Second)
+	defer cancel()
+
+	err := rp.send(ctx, r)
+	if err != nil && attempt < reminderMaxAttempts {
+		logger.Ctx(ctx).Warnf("Reminder %d attempt %d failed, retrying in %s: %v", r.ID, attempt, reminderRetryDelay, err)
+		rp.scheduleAttempt(r, reminderRetryDelay, attempt+1)
+		return
+	}
+
+	if err != nil {
+		logger.Ctx(ctx).Errorf("Reminder %d dropped after %d attempts: %v", r.ID, attempt, err)
+	} else {
+		logger.Ctx(ctx).Infof("Reminder %d sent", r.ID)
+	}
+	rp.mutex.Lock()
+	delete(rp.timers, r.ID)
+	rp.mutex.Unlock()
+	if _, err := rp.db.Exec("DELETE FROM reminders WHERE id = ?", r.ID); err != nil {
+		logger.Ctx(ctx).Errorf("Failed to delete reminder %d: %v", r.ID, err)
+	}
+}
+
+// send 在原对话中发送提醒，被回复的消息已删除时不带回复再发送一次
+func (rp *ReminderPlugin) send(ctx context.Context, r *reminder) error {
+	if rp.telegramAPI == nil || rp.peerResolver == nil {
+		return fmt.Errorf("telegram client not available")
+	}
+	peer, err := rp.peerResolver.ResolveFromChatID(ctx, r.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+
+	message := "⏰ 提醒: " + r.Text
+	if late := time.Since(r.FireAt); late > reminderLateAfter {
+		message = fmt.Sprintf("⏰ 提醒 (late, 原定 %s): %s", r.FireAt.Format("2006-01-02 15:04"), r.Text)
+	}
+
+	request := &tg.MessagesSendMessageRequest{
+		Peer:     peer,
+		Message:  message,
+		RandomID: time.Now().UnixNano(),
+	}
+	if r.ReplyTo != 0 {
+		request.ReplyTo = &tg.InputReplyToMessage{ReplyToMsgID: r.ReplyTo}
+	}
+
+	var limiter *flood.Limiter
+	if goManager, ok := rp.manager.(*GoManager); ok {
+		limiter = goManager.GetFloodLimiter()
+	}
+	_, err = flood.Call(ctx, limiter, r.ChatID, func() (tg.UpdatesClass, error) {
+		return rp.telegramAPI.MessagesSendMessage(ctx, request)
+	})
+	if err != nil && r.ReplyTo != 0 {
+		logger.Ctx(ctx).Debugf("Reminder %d failed to reply to message %d, sending without reply: %v", r.ID, r.ReplyTo, err)
+		request.ReplyTo = nil
+		request.RandomID = time.Now().UnixNano()
+		_, err = flood.Call(ctx, limiter, r.ChatID, func() (tg.UpdatesClass, error) {
+			return rp.telegramAPI.MessagesSendMessage(ctx, request)
+		})
+	}
+	return err
+}
+
+// parseReminderTime 解析提醒时间，返回时间和使用的参数个数。支持：
+// 时长(30m、2h30m、1d)、时刻(09:00，已过去则为明天)、日期和时刻(2024-06-01 09:00)
+func parseReminderTime(args []string, now time.Time) (time.Time, int, error) {
+	if len(args) == 0 {
+		return time.Time{}, 0, fmt.Errorf("请指定提醒时间")
+	}
+
+	if len(args) >= 2 {
+		for _, layout := range []string{"2006-01-02 15:04", "2006-01-02 15:04:05"} {
+			t, err := time.ParseInLocation(layout, args[0]+" "+args[1], time.Local)
+			if err != nil {
+				continue
+			}
+			if !t.After(now) {
+				return time.Time{}, 0, fmt.Errorf("提醒时间 %s 已经过去", t.Format(layout))
+			}
+			return t, 2, nil
+		}
+	}
+
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		clock, err := time.ParseInLocation(layout, args[0], time.Local)
+		if err != nil {
+			continue
+		}
+		t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, time.Local)
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, 1, nil
+	}
+
+	d, err := parseWindowDuration(args[0])
+	if err != nil || d <= 0 {
+		return time.Time{}, 0, fmt.Errorf("无法识别的时间: %s", args[0])
+	}
+	return now.Add(d), 1, nil
+}
+
+// usage 返回remind命令的用法
+func (rp *ReminderPlugin) usage() string {
+	return `用法:
+• .remind <时长> <内容> - 例如 .remind 2h30m 开会，时长支持 s、m、h、d
+• .remind <日期> <时间> <内容> - 例如 .remind 2024-06-01 09:00 交报告
+• .remind <时间> <内容> - 例如 .remind 09:00 晨会，已过去则为明天
+• .remind list - 列出当前对话的提醒
+• .remind cancel <ID> - 取消提醒
+
+回复消息使用时，提醒会回复该消息`
+}
+
+// sendResponse 发送响应消息
+func (rp *ReminderPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// restartKey 重启前记录 .restart 响应消息的键，重启后据此编辑该消息
+const restartKey = "restart_message"
+
+// restartRecord 等待重启完成后编辑的消息
+type restartRecord struct {
+	ChatID    int64 `json:"chat_id"`
+	MessageID int   `json:"message_id"`
+	Requested int64 `json:"requested"` // 请求重启的时间(unix毫秒)
+}
+
+// handleRestart 处理restart命令：记录响应消息后请求重新启动，启动完成后编辑该消息
+func (cp *CoreCommandsPlugin) handleRestart(ctx *command.CommandContext) error {
+	goManager, ok := cp.manager.(*GoManager)
+	if !ok {
+		return cp.sendResponse(ctx, "❌ 插件管理器不可用")
+	}
+
+	msgID, err := ctx.Respond("🔄 正在重启...", format.Plain)
+	if err != nil {
+		return err
+	}
+	record := restartRecord{ChatID: ctx.Message.ChatID, MessageID: msgID, Requested: time.Now().UnixMilli()}
+	if err := goManager.GetStorage().SetJSON(cp.info.Name, restartKey, record); err != nil {
+		logger.Warnf("Failed to save restart message, it will not be updated after restart: %v", err)
+	}
+	goManager.RequestStop(true)
+	return nil
+}
+
+// handleShutdown 处理shutdown命令：正常停止程序，不重新启动
+func (cp *CoreCommandsPlugin) handleShutdown(ctx *command.CommandContext) error {
+	goManager, ok := cp.manager.(*GoManager)
+	if !ok {
+		return cp.sendResponse(ctx, "❌ 插件管理器不可用")
+	}
+	if err := cp.sendResponse(ctx, "👋 正在关闭..."); err != nil {
+		return err
+	}
+	goManager.RequestStop(false)
+	return nil
+}
+
+// InitializeAfterConnect 实现PostConnectPlugin接口，由 .restart 重启时把记录的消息编辑为完成提示
+func (cp *CoreCommandsPlugin) InitializeAfterConnect(ctx context.Context) error {
+	goManager, ok := cp.manager.(*GoManager)
+	if !ok {
+		return nil
+	}
+	store := goManager.GetStorage()
+	var record restartRecord
+	found, err := store.GetJSON(cp.info.Name, restartKey, &record)
+	if err != nil || !found {
+		return nil
+	}
+	if err := store.Delete(cp.info.Name, restartKey); err != nil {
+		logger.Warnf("Failed to clear restart message: %v", err)
+	}
+
+	if cp.telegramAPI.client == nil || goManager.peerResolver == nil {
+		return nil
+	}
+	peer, err := goManager.peerResolver.ResolveFromChatID(ctx, record.ChatID)
+	if err != nil {
+		logger.Warnf("Failed to resolve chat of restart message: %v", err)
+		return nil
+	}
+	elapsed := time.Since(time.UnixMilli(record.Requested))
+	if _, err := cp.telegramAPI.client.MessagesEditMessage(ctx, &tg.MessagesEditMessageRequest{
+		Peer:    peer,
+		ID:      record.MessageID,
+		Message: fmt.Sprintf("✅ 重启完成，用时 %.1fs", elapsed.Seconds()),
+	}); err != nil {
+		logger.Warnf("Failed to edit restart message: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/dice"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"strings"
+
+	"github.com/gotd/td/tg"
+)
+
+// RollPlugin 掷骰和随机选择
+type RollPlugin struct {
+	*BasePlugin
+	source *dice.Source
+}
+
+// NewRollPlugin 创建掷骰插件
+func NewRollPlugin() *RollPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "roll",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "掷骰子和从选项中随机选择",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &RollPlugin{
+		BasePlugin: NewBasePlugin(info),
+		source:     dice.NewSource(nil),
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (rp *RollPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("roll", "掷骰子，支持 3d6+2、adv/dis 等写法", rp.info.Name, rp.handleRoll)
+	parser.RegisterCommand("choose", "从 | 分隔的选项中随机选择一个", rp.info.Name, rp.handleChoose)
+	logger.Infof("Roll commands registered successfully")
+	return nil
+}
+
+// handleRoll 处理roll命令
+func (rp *RollPlugin) handleRoll(ctx *command.CommandContext) error {
+	expr, err := dice.Parse(strings.Join(ctx.Args, " "))
+	if err != nil {
+		return rp.sendResponse(ctx, fmt.Sprintf("❌ %v\n\n用法: .roll [NdM±K] [adv|dis]，例如 .roll 3d6+2、.roll d20 adv", err))
+	}
+
+	result, err := expr.Roll(rp.source)
+	if err != nil {
+		return err
+	}
+	return rp.sendResponse(ctx, result.Format())
+}
+
+// handleChoose 处理choose命令。没有参数时从被回复消息的各行中选择
+func (rp *RollPlugin) handleChoose(ctx *command.CommandContext) error {
+	text := ctx.ArgsString()
+	if text == "" {
+		if replyTo, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader); ok && replyTo.ReplyToMsgID != 0 {
+			msg, err := fetchMessageByID(ctx, replyTo.ReplyToMsgID)
+			if err != nil {
+				return rp.sendResponse(ctx, fmt.Sprintf("❌ 获取被回复的消息失败: %v", err))
+			}
+			text = msg.Message
+		}
+	}
+
+	options := dice.SplitOptions(text)
+	if len(options) < 2 {
+		return rp.sendResponse(ctx, "❌ 至少需要两个选项\n\n用法: .choose 火锅 | 烧烤 | 日料，或回复每行一个选项的消息")
+	}
+
+	idx, err := rp.source.Choose(options)
+	if err != nil {
+		return err
+	}
+	return rp.sendResponse(ctx, fmt.Sprintf("🤔 %s\n👉 %s", strings.Join(options, " | "), options[idx]))
+}
+
+// sendResponse 发送响应消息
+func (rp *RollPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/dice"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// rollTestEnv 创建注册了roll命令的测试环境，随机数依次为 values，getMessages 返回 replies 中的消息
+func rollTestEnv(t *testing.T, replies map[int]string, values ...uint64) *testEnv {
+	t.Helper()
+	var buf []byte
+	for _, v := range values {
+		buf = binary.BigEndian.AppendUint64(buf, v)
+	}
+	rp := NewRollPlugin()
+	rp.source = dice.NewSource(bytes.NewReader(buf))
+
+	env := newTestEnv()
+	env.inv.handle = func(input bin.Encoder, output bin.Decoder) error {
+		req, ok := input.(*tg.MessagesGetMessagesRequest)
+		if !ok {
+			return errUnhandled
+		}
+		id := req.ID[0].(*tg.InputMessageID).ID
+		var msgs []tg.MessageClass
+		if text, ok := replies[id]; ok {
+			msgs = append(msgs, &tg.Message{ID: id, Message: text})
+		}
+		output.(*tg.MessagesMessagesBox).Messages = &tg.MessagesMessages{Messages: msgs}
+		return nil
+	}
+	if err := rp.RegisterCommands(env.parser); err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestRollCommand(t *testing.T) {
+	env := rollTestEnv(t, nil, 41, 0, 4, 5, 3, 10)
+	var got []string
+	for _, command := range []string{"roll", "roll 3d6+2", "roll d20 adv", "roll 101d6", "roll 3d6*2"} {
+		got = append(got, env.runText(t, nil, command))
+	}
+
+	usage := "\n\n用法: .roll [NdM±K] [adv|dis]，例如 .roll 3d6+2、.roll d20 adv"
+	want := []string{
+		"🎲 1d100\n42",
+		"🎲 3d6+2\n[1, 5, 6] + 2 = 14",
+		"🎲 1d20 优势\n▫️ 4\n✅ 11\n结果: 11",
+		"❌ 骰子太多了(101)，一次最多掷 100 颗" + usage,
+		`❌ 无效的骰子面数 "6*2"` + usage,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("responses =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestChooseCommand(t *testing.T) {
+	env := rollTestEnv(t, map[int]string{5: "周一\n\n周二\n周三"}, 2, 1)
+	reply := &core.MessageEvent{ChatID: -100, UserID: 1, Message: &tg.Message{ID: 10, ReplyTo: &tg.MessageReplyHeader{ReplyToMsgID: 5}}}
+	missing := &core.MessageEvent{ChatID: -100, UserID: 1, Message: &tg.Message{ID: 10, ReplyTo: &tg.MessageReplyHeader{ReplyToMsgID: 6}}}
+
+	var texts []string
+	for _, tt := range []struct {
+		msgEvent *core.MessageEvent
+		command  string
+	}{
+		{nil, "choose 火锅 | 烧烤 | 日料"},
+		{reply, "choose"},
+		{nil, "choose 只有一个"},
+		{nil, "choose"},
+		{missing, "choose"},
+	} {
+		texts = append(texts, env.runText(t, tt.msgEvent, tt.command))
+	}
+
+	if want := "🤔 火锅 | 烧烤 | 日料\n👉 日料"; texts[0] != want {
+		t.Errorf("choose = %q, want %q", texts[0], want)
+	}
+	if want := "🤔 周一 | 周二 | 周三\n👉 周二"; texts[1] != want {
+		t.Errorf("choose from reply = %q, want %q", texts[1], want)
+	}
+	for _, text := range texts[2:4] {
+		if !strings.HasPrefix(text, "❌ 至少需要两个选项") {
+			t.Errorf("too few options = %q", text)
+		}
+	}
+	if !strings.HasPrefix(texts[4], "❌ 获取被回复的消息失败") {
+		t.Errorf("missing reply = %q", texts[4])
+	}
+}
@@ -0,0 +1,252 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/errctx"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/telegram/query/dialogs"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+const (
+	// sbGroupsCacheTTL 管理群组列表的缓存时间
+	sbGroupsCacheTTL = 10 * time.Minute
+	// sbGroupPacing 跨群封禁时两个群组之间的间隔
+	sbGroupPacing = 500 * time.Millisecond
+	// sbMaxFloodWait 跨群封禁时愿意等待的FLOOD_WAIT上限，超过则停止
+	sbMaxFloodWait = 60 * time.Second
+)
+
+// sbGroupResult 单个群组的跨群封禁结果
+type sbGroupResult int
+
+const (
+	sbGroupBanned sbGroupResult = iota
+	sbGroupSkipped
+	sbGroupFailed
+)
+
+// getAdminGroups 返回我有封禁权限的超级群组。对话列表中的频道信息带有我的管理员权限，
+// 不需要逐个查询参与者；结果缓存一段时间，连续封禁多个用户时不重复遍历对话
+func (sp *SBPlugin) getAdminGroups(ctx *command.CommandContext) ([]*tg.Channel, error) {
+	sp.groupsMutex.Lock()
+	defer sp.groupsMutex.Unlock()
+
+	if sp.adminGroups != nil && time.Since(sp.adminGroupsTime) < sbGroupsCacheTTL {
+		return sp.adminGroups, nil
+	}
+
+	var chats []tg.ChatClass
+	groups := []*tg.Channel{}
+	seen := make(map[int64]bool)
+	err := dialogs.NewQueryBuilder(ctx.API).GetDialogs().BatchSize(100).ForEach(ctx.Context, func(_ context.Context, elem dialogs.Elem) error {
+		p, ok := elem.Peer.(*tg.InputPeerChannel)
+		if !ok || seen[p.ChannelID] {
+			return nil
+		}
+		seen[p.ChannelID] = true
+
+		channel, ok := elem.Entities.Channel(p.ChannelID)
+		if !ok {
+			return nil
+		}
+		chats = append(chats, channel)
+		if channel.Megagroup && !channel.Left && canBanInChannel(channel) {
+			groups = append(groups, channel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if manager := ctx.PeerResolver.Manager(); manager != nil {
+		manager.CacheChatsFromUpdate(chats)
+	}
+	logger.Ctx(ctx.Context).Infof("找到 %d 个有封禁权限的群组", len(groups))
+
+	sp.adminGroups = groups
+	sp.adminGroupsTime = time.Now()
+	return groups, nil
+}
+
+// canBanInChannel 我是否可以在频道中封禁用户
+func canBanInChannel(channel *tg.Channel) bool {
+	if channel.Creator {
+		return true
+	}
+	rights, ok := channel.GetAdminRights()
+	return ok && rights.BanUsers
+}
+
+// handleUserBanAll 在所有我管理的群组中封禁用户，用户不在其中的群组直接跳过
+func (sp *SBPlugin) handleUserBanAll(ctx *command.CommandContext, uid int64, deleteAll bool, targetUser *tg.User) error {
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return errctx.Wrap(ctx.Context, fmt.Errorf("解析群组失败: %w", err))
+	}
+
+	// 用户的access_hash对所有群组通用，在当前群组解析一次即可
+	_, userPeer, err := sp.resolveTargetPeer(ctx, peer, uid)
+	if err != nil {
+		return sp.sendResponse(ctx, sp.friendlyErrorMessage(err))
+	}
+
+	groups, err := sp.getAdminGroups(ctx)
+	if err != nil {
+		return sp.sendResponse(ctx, fmt.Sprintf("❌ 获取管理的群组失败: %v", err))
+	}
+	if err := sp.sendResponse(ctx, fmt.Sprintf("⏳ 正在 %d 个群组中封禁用户...", len(groups))); err != nil {
+		logger.Ctx(ctx.Context).Warnf("Failed to show sb progress: %v", err)
+	}
+
+	banned, skipped := 0, 0
+	failures := make(map[string]int)
+	stopped := ""
+	for i, channel := range groups {
+		if ctx.Context.Err() != nil {
+			stopped = "⏸️ 命令已取消"
+			break
+		}
+		if i > 0 && !sleepWithContext(ctx.Context, sbGroupPacing) {
+			stopped = "⏸️ 命令已取消"
+			break
+		}
+
+		result, err := sp.banInChannel(ctx, channel, userPeer, deleteAll)
+		if wait, ok := tgerr.AsFloodWait(err); ok {
+			stopped = fmt.Sprintf("⏸️ 需要等待 %s，已停止，剩余 %d 个群组未处理", wait, len(groups)-i)
+			break
+		}
+		switch result {
+		case sbGroupBanned:
+			banned++
+		case sbGroupSkipped:
+			skipped++
+		case sbGroupFailed:
+			logger.Ctx(ctx.Context).Warnf("在群组 %s(%d) 中封禁用户%d失败: %v", channel.Title, channel.ID, uid, err)
+			failures[sp.friendlyErrorMessage(err)]++
+		}
+	}
+
+	// 在最后才获取用户信息用于显示
+	if targetUser == nil {
+		if user, err := sp.getUserInfo(ctx, uid); err == nil {
+			targetUser = user
+		}
+	}
+	target := fmt.Sprintf("🆔 用户ID: %d", uid)
+	if targetUser != nil {
+		target = "👤 目标用户: " + format.EscapeHTML(sp.getUserMention(targetUser))
+	}
+
+	actionText := "🚫 已封禁用户"
+	if deleteAll {
+		actionText = "🚫 已封禁用户并清除消息历史"
+	}
+	failed := 0
+	for _, n := range failures {
+		failed += n
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%s\n\n%s\n📍 在 %d/%d 个群组中封禁成功", actionText, target, banned, banned+failed))
+	if skipped > 0 {
+		b.WriteString(fmt.Sprintf("\n⏭️ %d 个群组中没有该用户，已跳过", skipped))
+	}
+	if failed > 0 {
+		// 相同原因的失败合并为一行
+		reasons := make([]string, 0, len(failures))
+		for reason := range failures {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool { return failures[reasons[i]] > failures[reasons[j]] })
+		b.WriteString(fmt.Sprintf("\n\n%d 个群组封禁失败:", failed))
+		for _, reason := range reasons {
+			b.WriteString(fmt.Sprintf("\n• %s × %d", format.EscapeHTML(reason), failures[reason]))
+		}
+	}
+	if stopped != "" {
+		b.WriteString("\n\n" + stopped)
+	}
+	b.WriteString(fmt.Sprintf("\n⏰ 操作时间: %s", time.Now().Format("15:04:05")))
+
+	text := b.String()
+	plainText, _ := format.Parse(format.HTML, text)
+	logger.Ctx(ctx.Context).Infof("%s\nuid: %d", plainText, uid)
+
+	// 有成功的封禁时30秒后自动删除
+	deleteAfter := 0
+	if banned > 0 {
+		deleteAfter = 30
+	}
+	return sp.sendFormattedWithAutoDelete(ctx, text, format.HTML, deleteAfter)
+}
+
+// banInChannel 在一个群组中封禁用户。先确认用户是群组成员，不是成员时跳过；
+// 遇到不超过上限的FLOOD_WAIT时等待后重试一次，仍为FLOOD_WAIT时返回该错误
+func (sp *SBPlugin) banInChannel(ctx *command.CommandContext, channel *tg.Channel, userPeer *tg.InputPeerUser, deleteAll bool) (sbGroupResult, error) {
+	inputChannel := &tg.InputChannel{ChannelID: channel.ID, AccessHash: channel.AccessHash}
+
+	var participant *tg.ChannelsChannelParticipant
+	err := sp.retryFloodWait(ctx, func() error {
+		var err error
+		participant, err = ctx.API.ChannelsGetParticipant(ctx.Context, &tg.ChannelsGetParticipantRequest{
+			Channel:     inputChannel,
+			Participant: userPeer,
+		})
+		return err
+	})
+	if tgerr.Is(err, "USER_NOT_PARTICIPANT", "PARTICIPANT_ID_INVALID") {
+		return sbGroupSkipped, nil
+	}
+	if err != nil {
+		return sbGroupFailed, err
+	}
+	switch participant.Participant.(type) {
+	case *tg.ChannelParticipantLeft, *tg.ChannelParticipantBanned:
+		// 已离开或已被封禁
+		return sbGroupSkipped, nil
+	}
+
+	err = sp.retryFloodWait(ctx, func() error {
+		_, err := ctx.API.ChannelsEditBanned(ctx.Context, &tg.ChannelsEditBannedRequest{
+			Channel:      inputChannel,
+			Participant:  userPeer,
+			BannedRights: sbBannedRights,
+		})
+		return err
+	})
+	if err != nil {
+		return sbGroupFailed, err
+	}
+
+	chatID := -1000000000000 - channel.ID
+	sp.recordAction(ctx, chatID, userPeer.UserID, sbActionBan)
+	if deleteAll {
+		sp.deleteUserHistory(ctx, &tg.InputPeerChannel{ChannelID: channel.ID, AccessHash: channel.AccessHash}, userPeer.UserID)
+	}
+	return sbGroupBanned, nil
+}
+
+// retryFloodWait 执行请求，遇到不超过上限的FLOOD_WAIT时等待后重试一次
+func (sp *SBPlugin) retryFloodWait(ctx *command.CommandContext, call func() error) error {
+	err := call()
+	wait, ok := tgerr.AsFloodWait(err)
+	if !ok || wait > sbMaxFloodWait {
+		return err
+	}
+	logger.Ctx(ctx.Context).Warnf("跨群封禁遇到 FLOOD_WAIT，等待 %s 后重试", wait)
+	if !sleepWithContext(ctx.Context, wait) {
+		return ctx.Context.Err()
+	}
+	return call()
+}
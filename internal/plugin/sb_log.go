@@ -0,0 +1,176 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/errctx"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	sbActionBan   = "ban"
+	sbActionUnban = "unban"
+
+	// sbLogLimit .sb log 显示的最近记录数
+	sbLogLimit = 20
+)
+
+// initDatabase 初始化数据库表
+func (sp *SBPlugin) initDatabase() {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS sb_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		by_user INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_sb_log_chat ON sb_log(chat_id, created_at);`
+
+	_, err := sp.db.Exec(createTableSQL)
+	if err != nil {
+		logger.Errorf("Failed to create sb_log table: %v", err)
+	}
+}
+
+// recordAction 记录群组中的一次封禁/解封，记录失败只写日志
+func (sp *SBPlugin) recordAction(ctx *command.CommandContext, chatID, uid int64, action string) {
+	_, err := sp.db.Exec("INSERT INTO sb_log (chat_id, user_id, action, by_user, created_at) VALUES (?, ?, ?, ?, ?)",
+		chatID, uid, action, ctx.Message.UserID, time.Now().Unix())
+	if err != nil {
+		logger.Ctx(ctx.Context).Errorf("记录%s操作失败: %v", action, err)
+	}
+}
+
+// showLog 显示当前群组最近的封禁/解封记录
+func (sp *SBPlugin) showLog(ctx *command.CommandContext) error {
+	rows, err := sp.db.Query("SELECT user_id, action, by_user, created_at FROM sb_log WHERE chat_id = ? ORDER BY created_at DESC, id DESC LIMIT ?",
+		ctx.Message.ChatID, sbLogLimit)
+	if err != nil {
+		return sp.sendResponse(ctx, fmt.Sprintf("❌ 读取封禁记录失败: %v", err))
+	}
+	defer rows.Close()
+
+	var b strings.Builder
+	count := 0
+	for rows.Next() {
+		var uid, by, createdAt int64
+		var action string
+		if err := rows.Scan(&uid, &action, &by, &createdAt); err != nil {
+			return sp.sendResponse(ctx, fmt.Sprintf("❌ 读取封禁记录失败: %v", err))
+		}
+
+		icon := "🚫 封禁"
+		if action == sbActionUnban {
+			icon = "✅ 解封"
+		}
+		b.WriteString(fmt.Sprintf("\n%s %s %s\n   操作者: %s",
+			time.Unix(createdAt, 0).Format("01-02 15:04"), icon, sp.cachedUserName(ctx, uid), sp.cachedUserName(ctx, by)))
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return sp.sendResponse(ctx, fmt.Sprintf("❌ 读取封禁记录失败: %v", err))
+	}
+
+	if count == 0 {
+		return sp.sendResponse(ctx, "📋 本群暂无封禁记录")
+	}
+	return sp.sendResponse(ctx, fmt.Sprintf("📋 本群最近 %d 条封禁记录:\n%s", count, b.String()))
+}
+
+// cachedUserName 用缓存中的用户信息显示用户，没有缓存时只显示ID
+func (sp *SBPlugin) cachedUserName(ctx *command.CommandContext, uid int64) string {
+	if manager := ctx.PeerResolver.Manager(); manager != nil {
+		if info := manager.GetCachedUserInfo(uid); info != nil {
+			name := strings.TrimSpace(info.FirstName + " " + info.LastName)
+			if info.Username != "" {
+				return fmt.Sprintf("%s (@%s)", name, info.Username)
+			}
+			if name != "" {
+				return fmt.Sprintf("%s (ID: %d)", name, uid)
+			}
+		}
+	}
+	return fmt.Sprintf("ID: %d", uid)
+}
+
+// handleUnban 处理解除封禁命令
+func (sp *SBPlugin) handleUnban(ctx *command.CommandContext) error {
+	// 检查是否在群组中
+	if ctx.Message.ChatID > 0 {
+		return sp.sendResponse(ctx, "❌ 使用限制\n\n💬 此命令只能在群组中使用")
+	}
+
+	// 检查是否有管理员权限
+	hasPermission, err := sp.checkAdminPermission(ctx)
+	if err != nil {
+		return sp.sendResponse(ctx, fmt.Sprintf("❌ 权限检查失败\n\n⚠️ 错误信息: %v", err))
+	}
+	if !hasPermission {
+		return sp.sendResponse(ctx, "❌ 权限不足\n\n🔒 您需要管理员权限才能使用此命令")
+	}
+
+	// 获取目标用户信息，解封不涉及消息历史
+	uid, _, targetUser, err := sp.getTargetUser(ctx, ctx.Args)
+	if err != nil {
+		return sp.sendResponse(ctx, fmt.Sprintf("参数错误：%v", err))
+	}
+	if uid == 0 {
+		return sp.sendResponse(ctx, "❌ 参数错误\n\n📝 请回复一条消息或提供用户ID/用户名\n\n💡 使用方法:\n• 回复消息: .unsb\n• 用户ID: .unsb 123456789\n• 用户名: .unsb @username")
+	}
+
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return errctx.Wrap(ctx.Context, fmt.Errorf("解析群组失败: %w", err))
+	}
+	unbanErr := sp.unbanUserInGroup(ctx, peer, uid)
+
+	if targetUser == nil {
+		if user, err := sp.getUserInfo(ctx, uid); err == nil {
+			targetUser = user
+		}
+	}
+	target := fmt.Sprintf("🆔 用户ID: %d", uid)
+	if targetUser != nil {
+		target = "👤 目标用户: " + format.EscapeHTML(sp.getUserMention(targetUser))
+	}
+
+	if unbanErr != nil {
+		logger.Ctx(ctx.Context).Infof("解除封禁失败\nuid: %d\n错误: %v", uid, unbanErr)
+		text := fmt.Sprintf("❌ 解除封禁失败\n\n%s\n\n%s", target, format.EscapeHTML(sp.friendlyErrorMessage(unbanErr)))
+		return sp.sendFormattedWithAutoDelete(ctx, text, format.HTML, 0)
+	}
+
+	text := fmt.Sprintf("✅ 已解除封禁\n\n%s\n📍 群组: %s\n⏰ 操作时间: %s",
+		target, sp.getGroupName(ctx), time.Now().Format("15:04:05"))
+	// 成功消息30秒后自动删除
+	return sp.sendFormattedWithAutoDelete(ctx, text, format.HTML, 30)
+}
+
+// unbanUserInGroup 以空的封禁权限解除用户在群组中的限制
+func (sp *SBPlugin) unbanUserInGroup(ctx *command.CommandContext, peer tg.InputPeerClass, uid int64) error {
+	channelPeer, userPeer, err := sp.resolveTargetPeer(ctx, peer, uid)
+	if err != nil {
+		return err
+	}
+
+	_, err = ctx.API.ChannelsEditBanned(ctx.Context, &tg.ChannelsEditBannedRequest{
+		Channel:      channelPeer,
+		Participant:  userPeer,
+		BannedRights: tg.ChatBannedRights{},
+	})
+	if err != nil {
+		logger.Ctx(ctx.Context).Warnf("解除封禁用户%d失败: %v", uid, err)
+		return err
+	}
+
+	logger.Ctx(ctx.Context).Infof("成功解除封禁用户%d", uid)
+	sp.recordAction(ctx, ctx.Message.ChatID, uid, sbActionUnban)
+	return nil
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"nexusvalet/internal/capability"
 	"nexusvalet/internal/command"
+	"nexusvalet/internal/errctx"
+	"nexusvalet/internal/format"
 	"nexusvalet/pkg/logger"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gotd/td/tg"
@@ -17,6 +21,27 @@ import (
 type SBPlugin struct {
 	*BasePlugin
 	db *sql.DB
+
+	// 跨群封禁使用的管理群组缓存
+	groupsMutex     sync.Mutex
+	adminGroups     []*tg.Channel
+	adminGroupsTime time.Time
+}
+
+// sbBannedRights 封禁时设置的权限：禁止查看消息等全部权限，永久有效
+var sbBannedRights = tg.ChatBannedRights{
+	ViewMessages: true,
+	SendMessages: true,
+	SendMedia:    true,
+	SendStickers: true,
+	SendGifs:     true,
+	SendGames:    true,
+	SendInline:   true,
+	SendPolls:    true,
+	ChangeInfo:   true,
+	InviteUsers:  true,
+	PinMessages:  true,
+	UntilDate:    0, // 永久封禁
 }
 
 // NewSBPlugin 创建超级封禁插件
@@ -32,10 +57,15 @@ func NewSBPlugin(db *sql.DB) *SBPlugin {
 		Enabled: true,
 	}
 
-	return &SBPlugin{
+	plugin := &SBPlugin{
 		BasePlugin: NewBasePlugin(info),
 		db:         db,
 	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+
+	return plugin
 }
 
 // Initialize 初始化插件时设置AccessHashManager
@@ -51,13 +81,47 @@ func (sp *SBPlugin) Initialize(ctx context.Context, manager interface{}) error {
 // SetTelegramClient 保持兼容接口（不再在插件内部管理 access_hash）
 func (sp *SBPlugin) SetTelegramClient(client *tg.Client) {}
 
+// sbLongHelp .help sb 显示的详细帮助
+const sbLongHelp = `🚫 超级封禁插件详细帮助
+
+🚫 .sb 命令:
+  超级封禁用户并清除消息历史，功能包括:
+  • 🔒 永久封禁指定用户
+  • 🗑️ 清除用户消息历史（可选）
+  • 🎯 支持多种用户指定方式
+  • 🛡️ 自动权限验证
+
+📝 使用方法:
+  • .sb - 回复消息封禁该用户（推荐）
+  • .sb <用户ID> - 通过用户ID封禁
+  • .sb @<用户名> - 通过用户名封禁
+  • .sb <用户ID/用户名> 0 - 仅封禁不删除历史
+
+⚠️ 注意事项:
+  • 仅限群组使用
+  • 需要管理员权限
+  • 默认会删除该用户的所有消息历史
+  • 支持封禁用户`
+
 // RegisterCommands 实现CommandPlugin接口
 func (sp *SBPlugin) RegisterCommands(parser *command.Parser) error {
 	parser.RegisterCommand("sb", "超级封禁用户并删除消息历史", sp.info.Name, sp.handleSuperBan)
+	parser.RegisterCommand("unsb", "解除超级封禁", sp.info.Name, sp.handleUnban)
+	parser.RegisterLongHelp(sp.info.Name, sbLongHelp)
 	logger.Infof("SB commands registered successfully")
 	return nil
 }
 
+// Capabilities 实现CapabilityPlugin接口，声明封禁、清理历史和遍历管理群组所需的接口
+func (sp *SBPlugin) Capabilities() []capability.Requirement {
+	return []capability.Requirement{
+		capability.Require((*tg.Client)(nil), "ChannelsGetParticipant", "ChannelsEditBanned", "ChannelsDeleteParticipantHistory", "ChannelsGetMessages", "ChannelsDeleteMessages", "MessagesGetDialogs"),
+		capability.Require(tg.ChannelsEditBannedRequest{}, "Channel", "Participant", "BannedRights"),
+		capability.Require(tg.ChatBannedRights{}, "ViewMessages", "SendMessages", "SendMedia", "UntilDate"),
+		capability.Require(tg.ChannelsDeleteParticipantHistoryRequest{}, "Channel", "Participant"),
+	}
+}
+
 // handleSuperBan 处理超级封禁命令
 func (sp *SBPlugin) handleSuperBan(ctx *command.CommandContext) error {
 	// 检查是否在群组中
@@ -65,6 +129,11 @@ func (sp *SBPlugin) handleSuperBan(ctx *command.CommandContext) error {
 		return sp.sendResponse(ctx, "❌ 使用限制\n\n💬 此命令只能在群组中使用")
 	}
 
+	// .sb log 查看本群的封禁记录
+	if len(ctx.Args) == 1 && ctx.Args[0] == "log" && ctx.Message.Message.ReplyTo == nil {
+		return sp.showLog(ctx)
+	}
+
 	// 检查是否有管理员权限
 	hasPermission, err := sp.checkAdminPermission(ctx)
 	if err != nil {
@@ -74,22 +143,40 @@ func (sp *SBPlugin) handleSuperBan(ctx *command.CommandContext) error {
 		return sp.sendResponse(ctx, "❌ 权限不足\n\n🔒 您需要管理员权限才能使用此命令")
 	}
 
+	// 最后一个参数为 all 时在所有我管理的群组中封禁
+	args := ctx.Args
+	allGroups := false
+	if n := len(args); n > 0 && args[n-1] == "all" {
+		allGroups = true
+		args = args[:n-1]
+	}
+	if allGroups && !ctx.Message.IsOwner() {
+		return sp.sendResponse(ctx, "⛔ sudo 用户不能在所有管理的群组中封禁，请去掉 all 只在当前群组封禁")
+	}
+
 	// 获取目标用户信息
-	uid, deleteAll, targetUser, err := sp.getTargetUser(ctx)
+	uid, deleteAll, targetUser, err := sp.getTargetUser(ctx, args)
 	if err != nil {
 		return sp.sendResponse(ctx, fmt.Sprintf("参数错误：%v", err))
 	}
 
 	if uid == 0 {
-		return sp.sendResponse(ctx, "❌ 参数错误\n\n📝 请回复一条消息或提供用户ID/用户名\n\n💡 使用方法:\n• 回复消息: .sb\n• 用户ID: .sb 123456789\n• 用户名: .sb @username")
+		return sp.sendResponse(ctx, "❌ 参数错误\n\n📝 请回复一条消息或提供用户ID/用户名\n\n💡 使用方法:\n• 回复消息: .sb\n• 用户ID: .sb 123456789\n• 用户名: .sb @username\n• 所有管理的群组: .sb @username all")
+	}
+
+	if deleteAll && botMode.Load() {
+		return sp.sendResponse(ctx, "❌ 机器人账号不能删除用户的消息历史\n\n💡 在命令末尾加任意参数只封禁不删除，如 .sb 123456789 1")
 	}
 
 	// 处理用户封禁
+	if allGroups {
+		return sp.handleUserBanAll(ctx, uid, deleteAll, targetUser)
+	}
 	return sp.handleUserBan(ctx, uid, deleteAll, targetUser)
 }
 
-// getTargetUser 获取目标用户信息
-func (sp *SBPlugin) getTargetUser(ctx *command.CommandContext) (int64, bool, *tg.User, error) {
+// getTargetUser 从回复的消息或参数中获取目标用户信息
+func (sp *SBPlugin) getTargetUser(ctx *command.CommandContext, args []string) (int64, bool, *tg.User, error) {
 	var uid int64
 	var deleteAll = true
 	var targetUser *tg.User
@@ -119,20 +206,20 @@ func (sp *SBPlugin) getTargetUser(ctx *command.CommandContext) (int64, bool, *tg
 			}
 
 			// 如果有额外参数，则不删除所有消息
-			if len(ctx.Args) > 0 {
+			if len(args) > 0 {
 				deleteAll = false
 			}
 		}
-	} else if len(ctx.Args) >= 1 {
+	} else if len(args) >= 1 {
 		// 解析用户ID或用户名
 		var err error
-		uid, err = sp.checkUID(ctx, ctx.Args[0])
+		uid, err = sp.checkUID(ctx, args[0])
 		if err != nil {
 			return 0, false, nil, err
 		}
 
 		// 如果有第二个参数，则不删除所有消息
-		if len(ctx.Args) >= 2 {
+		if len(args) >= 2 {
 			deleteAll = false
 		} else {
 			deleteAll = true
@@ -155,9 +242,7 @@ func (sp *SBPlugin) checkUID(ctx *command.CommandContext, input string) (int64,
 	} else {
 		// 尝试解析为用户名
 		username := strings.TrimPrefix(input, "@")
-		resolved, err := ctx.API.ContactsResolveUsername(ctx.Context, &tg.ContactsResolveUsernameRequest{
-			Username: username,
-		})
+		resolved, err := resolveUsername(ctx.Context, ctx.API, username)
 		if err != nil {
 			return 0, fmt.Errorf("无法解析用户名: %v", err)
 		}
@@ -184,52 +269,18 @@ func (sp *SBPlugin) checkAdminPermission(ctx *command.CommandContext) (bool, err
 		return false, err
 	}
 
-	// 获取自己的用户信息
-	self, err := ctx.API.UsersGetUsers(ctx.Context, []tg.InputUserClass{&tg.InputUserSelf{}})
-	if err != nil {
-		return false, err
-	}
-
-	if len(self) == 0 {
-		return false, fmt.Errorf("无法获取自己的用户信息")
-	}
-
-	selfUser, ok := self[0].(*tg.User)
-	if !ok {
-		return false, fmt.Errorf("用户信息格式错误")
-	}
-
-	// 检查在群组中的权限
-	var channelPeer tg.InputChannelClass
-	switch p := peer.(type) {
-	case *tg.InputPeerChannel:
-		channelPeer = &tg.InputChannel{ChannelID: p.ChannelID, AccessHash: p.AccessHash}
-	default:
+	// 只支持频道和超级群组
+	if _, ok := peer.(*tg.InputPeerChannel); !ok {
 		return false, fmt.Errorf("不是频道或超级群组")
 	}
-
-	participant, err := ctx.API.ChannelsGetParticipant(ctx.Context, &tg.ChannelsGetParticipantRequest{
-		Channel:     channelPeer,
-		Participant: &tg.InputPeerUser{UserID: selfUser.ID, AccessHash: selfUser.AccessHash},
-	})
-	if err != nil {
-		return false, err
-	}
-
-	// 检查是否是管理员或创建者
-	switch participant.Participant.(type) {
-	case *tg.ChannelParticipantCreator, *tg.ChannelParticipantAdmin:
-		return true, nil
-	default:
-		return false, nil
-	}
+	return isChatAdmin(ctx.Context, ctx.API, peer)
 }
 
 // handleUserBan 处理用户封禁
 func (sp *SBPlugin) handleUserBan(ctx *command.CommandContext, uid int64, deleteAll bool, targetUser *tg.User) error {
 	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
 	if err != nil {
-		return fmt.Errorf("解析群组失败: %v", err)
+		return errctx.Wrap(ctx.Context, fmt.Errorf("解析群组失败: %w", err))
 	}
 
 	count := 0
@@ -251,10 +302,10 @@ func (sp *SBPlugin) handleUserBan(ctx *command.CommandContext, uid int64, delete
 		}
 	}
 
-	// 构建响应消息
+	// 构建响应消息(HTML)，群组名称带有链接
 	var text string
 	if targetUser != nil {
-		userMention := sp.getUserMention(targetUser)
+		userMention := format.EscapeHTML(sp.getUserMention(targetUser))
 		if count == 0 {
 			text = fmt.Sprintf("❌ 封禁失败\n\n👤 目标用户: %s", userMention)
 		} else {
@@ -266,8 +317,8 @@ func (sp *SBPlugin) handleUserBan(ctx *command.CommandContext, uid int64, delete
 				actionText = "🚫 已封禁用户"
 			}
 
-			text = fmt.Sprintf("%s\n\n👤 目标用户: %s\n⏰ 操作时间: %s",
-				actionText, userMention, time.Now().Format("15:04:05"))
+			text = fmt.Sprintf("%s\n\n👤 目标用户: %s\n📍 群组: %s\n⏰ 操作时间: %s",
+				actionText, userMention, groupName, time.Now().Format("15:04:05"))
 		}
 	} else {
 		if count == 0 {
@@ -281,40 +332,42 @@ func (sp *SBPlugin) handleUserBan(ctx *command.CommandContext, uid int64, delete
 				actionText = "🚫 已封禁用户"
 			}
 
-			text = fmt.Sprintf("%s\n\n🆔 用户ID: %d\n⏰ 操作时间: %s",
-				actionText, uid, time.Now().Format("15:04:05"))
+			text = fmt.Sprintf("%s\n\n🆔 用户ID: %d\n📍 群组: %s\n⏰ 操作时间: %s",
+				actionText, uid, groupName, time.Now().Format("15:04:05"))
 		}
 	}
 
 	// 记录详细日志（包括错误信息）
+	plainText, _ := format.Parse(format.HTML, text)
 	groupsInfo := ""
 	if len(groups) > 0 {
-		groupsInfo = fmt.Sprintf("\n封禁群组:\n%s", strings.Join(groups, "\n"))
+		plainGroups, _ := format.Parse(format.HTML, strings.Join(groups, "\n"))
+		groupsInfo = fmt.Sprintf("\n封禁群组:\n%s", plainGroups)
 	}
 	if banError != nil {
-		logger.Infof("%s\nuid: %d\n错误: %v%s", text, uid, banError, groupsInfo)
+		logger.Ctx(ctx.Context).Infof("%s\nuid: %d\n错误: %v%s", plainText, uid, banError, groupsInfo)
 	} else {
-		logger.Infof("%s\nuid: %d%s", text, uid, groupsInfo)
+		logger.Ctx(ctx.Context).Infof("%s\nuid: %d%s", plainText, uid, groupsInfo)
 	}
 
-	// 如果是成功的封禁消息，30秒后自动删除
+	// 如果是成功的封禁消息，30秒后自动删除；错误消息不自动删除
+	deleteAfter := 0
 	if count > 0 {
-		return sp.sendResponseWithAutoDelete(ctx, text, 30)
+		deleteAfter = 30
 	}
-	// 错误消息不自动删除
-	return sp.sendResponse(ctx, text)
+	return sp.sendFormattedWithAutoDelete(ctx, text, format.HTML, deleteAfter)
 }
 
-// banUserInGroupWithError 在指定群组中封禁用户，返回详细错误信息
-func (sp *SBPlugin) banUserInGroupWithError(ctx *command.CommandContext, peer tg.InputPeerClass, uid int64, deleteAll bool) (bool, error) {
+// resolveTargetPeer 解析群组和目标用户，优先通过回复的消息解析用户，其次在群组参与者中查找
+func (sp *SBPlugin) resolveTargetPeer(ctx *command.CommandContext, peer tg.InputPeerClass, uid int64) (tg.InputChannelClass, *tg.InputPeerUser, error) {
 	// 转换为ChannelClass
 	var channelPeer tg.InputChannelClass
 	switch p := peer.(type) {
 	case *tg.InputPeerChannel:
 		channelPeer = &tg.InputChannel{ChannelID: p.ChannelID, AccessHash: p.AccessHash}
 	default:
-		logger.Warnf("不支持的群组类型进行封禁操作")
-		return false, fmt.Errorf("不支持的群组类型")
+		logger.Ctx(ctx.Context).Warnf("不支持的群组类型进行封禁/解封操作")
+		return nil, nil, fmt.Errorf("不支持的群组类型")
 	}
 
 	// 优先：若为回复消息，从消息中解析用户（最可靠）
@@ -330,39 +383,36 @@ func (sp *SBPlugin) banUserInGroupWithError(ctx *command.CommandContext, peer tg
 		userPeerGeneric, err = ctx.PeerResolver.ResolveUserInChannel(ctx.Context, channelPeer, uid)
 	}
 	if err != nil {
-		return false, fmt.Errorf("解析用户失败: %v", err)
+		return nil, nil, fmt.Errorf("解析用户失败: %v", err)
 	}
 	userPeer, ok := userPeerGeneric.(*tg.InputPeerUser)
 	if !ok {
-		return false, fmt.Errorf("解析到的对等体不是用户类型")
+		return nil, nil, fmt.Errorf("解析到的对等体不是用户类型")
+	}
+	return channelPeer, userPeer, nil
+}
+
+// banUserInGroupWithError 在指定群组中封禁用户，返回详细错误信息
+func (sp *SBPlugin) banUserInGroupWithError(ctx *command.CommandContext, peer tg.InputPeerClass, uid int64, deleteAll bool) (bool, error) {
+	channelPeer, userPeer, err := sp.resolveTargetPeer(ctx, peer, uid)
+	if err != nil {
+		return false, err
 	}
 
 	// 封禁用户
 	_, err = ctx.API.ChannelsEditBanned(ctx.Context, &tg.ChannelsEditBannedRequest{
-		Channel:     channelPeer,
-		Participant: userPeer,
-		BannedRights: tg.ChatBannedRights{
-			ViewMessages: true,
-			SendMessages: true,
-			SendMedia:    true,
-			SendStickers: true,
-			SendGifs:     true,
-			SendGames:    true,
-			SendInline:   true,
-			SendPolls:    true,
-			ChangeInfo:   true,
-			InviteUsers:  true,
-			PinMessages:  true,
-			UntilDate:    0, // 永久封禁
-		},
+		Channel:      channelPeer,
+		Participant:  userPeer,
+		BannedRights: sbBannedRights,
 	})
 
 	if err != nil {
-		logger.Warnf("封禁用户%d失败: %v", uid, err)
+		logger.Ctx(ctx.Context).Warnf("封禁用户%d失败: %v", uid, err)
 		return false, err
 	}
 
-	logger.Infof("成功封禁用户%d", uid)
+	logger.Ctx(ctx.Context).Infof("成功封禁用户%d", uid)
+	sp.recordAction(ctx, ctx.Message.ChatID, uid, sbActionBan)
 
 	// 删除消息历史
 	if deleteAll {
@@ -386,7 +436,7 @@ func (sp *SBPlugin) deleteUserHistory(ctx *command.CommandContext, peer tg.Input
 	case *tg.InputPeerChannel:
 		channelPeer = &tg.InputChannel{ChannelID: p.ChannelID, AccessHash: p.AccessHash}
 	default:
-		logger.Warnf("不支持的群组类型进行删除消息历史操作")
+		logger.Ctx(ctx.Context).Warnf("不支持的群组类型进行删除消息历史操作")
 		return
 	}
 
@@ -394,13 +444,13 @@ func (sp *SBPlugin) deleteUserHistory(ctx *command.CommandContext, peer tg.Input
 	userPeerGeneric, err := ctx.PeerResolver.ResolveUserInChannel(ctx.Context, channelPeer, uid)
 	var userPeer *tg.InputPeerUser
 	if err != nil {
-		logger.Warnf("删除消息历史时解析用户%d失败，使用默认AccessHash: %v", uid, err)
+		logger.Ctx(ctx.Context).Warnf("删除消息历史时解析用户%d失败，使用默认AccessHash: %v", uid, err)
 		userPeer = &tg.InputPeerUser{UserID: uid, AccessHash: 0}
 	} else {
 		if up, ok := userPeerGeneric.(*tg.InputPeerUser); ok {
 			userPeer = up
 		} else {
-			logger.Warnf("删除消息历史时解析到的对等体不是用户类型，使用默认AccessHash")
+			logger.Ctx(ctx.Context).Warnf("删除消息历史时解析到的对等体不是用户类型，使用默认AccessHash")
 			userPeer = &tg.InputPeerUser{UserID: uid, AccessHash: 0}
 		}
 	}
@@ -411,9 +461,9 @@ func (sp *SBPlugin) deleteUserHistory(ctx *command.CommandContext, peer tg.Input
 	})
 
 	if err != nil {
-		logger.Errorf("删除用户%d消息历史失败: %v", uid, err)
+		logger.Ctx(ctx.Context).Errorf("删除用户%d消息历史失败: %v", uid, err)
 	} else {
-		logger.Infof("成功删除用户%d的消息历史", uid)
+		logger.Ctx(ctx.Context).Infof("成功删除用户%d的消息历史", uid)
 	}
 }
 
@@ -532,7 +582,7 @@ func (sp *SBPlugin) getUserMention(user *tg.User) string {
 	return fmt.Sprintf("%s (ID: %d)", name, user.ID)
 }
 
-// getGroupName 获取群组名称
+// getGroupName 获取群组名称(HTML)
 func (sp *SBPlugin) getGroupName(ctx *command.CommandContext) string {
 	// 尝试获取群组信息
 	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
@@ -548,9 +598,9 @@ func (sp *SBPlugin) getGroupName(ctx *command.CommandContext) string {
 			if chatSlice, ok := chats.(*tg.MessagesChats); ok && len(chatSlice.Chats) > 0 {
 				if channel, ok := chatSlice.Chats[0].(*tg.Channel); ok {
 					if channel.Username != "" {
-						return fmt.Sprintf(`<a href="https://t.me/%s">%s</a>`, channel.Username, channel.Title)
+						return fmt.Sprintf(`<a href="https://t.me/%s">%s</a>`, channel.Username, format.EscapeHTML(channel.Title))
 					}
-					return fmt.Sprintf(`<code>%s</code>`, channel.Title)
+					return fmt.Sprintf(`<code>%s</code>`, format.EscapeHTML(channel.Title))
 				}
 			}
 		}
@@ -596,119 +646,16 @@ func (sp *SBPlugin) sendResponse(ctx *command.CommandContext, message string) er
 
 // sendResponseWithAutoDelete 发送响应消息并支持自动删除
 func (sp *SBPlugin) sendResponseWithAutoDelete(ctx *command.CommandContext, message string, deleteAfterSeconds int) error {
-	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-	if err != nil {
-		return fmt.Errorf("failed to resolve peer: %w", err)
-	}
-
-	var messageID int
-	var isNewMessage bool
-
-	// 尝试编辑原消息
-	_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-		Peer:    peer,
-		ID:      ctx.Message.Message.ID,
-		Message: message,
-	})
-	if err != nil {
-		// 编辑失败，发送新消息
-		result, err := ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-			Peer:     peer,
-			Message:  message,
-			RandomID: time.Now().UnixNano(),
-		})
-		if err != nil {
-			return err
-		}
-
-		// 获取新消息的ID（支持多种 UpdatesClass）
-		switch up := result.(type) {
-		case *tg.Updates:
-			for _, u := range up.Updates {
-				switch v := u.(type) {
-				case *tg.UpdateNewMessage:
-					if msg, ok := v.Message.(*tg.Message); ok {
-						messageID = msg.ID
-						isNewMessage = true
-					}
-				case *tg.UpdateNewChannelMessage:
-					if msg, ok := v.Message.(*tg.Message); ok {
-						messageID = msg.ID
-						isNewMessage = true
-					}
-				}
-			}
-		case *tg.UpdatesCombined:
-			for _, u := range up.Updates {
-				switch v := u.(type) {
-				case *tg.UpdateNewMessage:
-					if msg, ok := v.Message.(*tg.Message); ok {
-						messageID = msg.ID
-						isNewMessage = true
-					}
-				case *tg.UpdateNewChannelMessage:
-					if msg, ok := v.Message.(*tg.Message); ok {
-						messageID = msg.ID
-						isNewMessage = true
-					}
-				}
-			}
-		case *tg.UpdateShortSentMessage:
-			messageID = up.ID
-			isNewMessage = true
-		}
-	} else {
-		// 编辑成功，使用原消息ID
-		messageID = ctx.Message.Message.ID
-	}
-
-	// 如果需要自动删除消息
-	if deleteAfterSeconds > 0 && messageID != 0 {
-		go sp.scheduleMessageDeletion(ctx, peer, messageID, deleteAfterSeconds, isNewMessage)
-	}
-
-	return nil
+	return sp.sendFormattedWithAutoDelete(ctx, message, format.Plain, deleteAfterSeconds)
 }
 
-// scheduleMessageDeletion 安排消息删除
-func (sp *SBPlugin) scheduleMessageDeletion(ctx *command.CommandContext, peer tg.InputPeerClass, messageID int, seconds int, isNewMessage bool) {
-	// 等待指定时间
-	time.Sleep(time.Duration(seconds) * time.Second)
-
+// sendFormattedWithAutoDelete 按mode解析格式标记后发送响应消息，并支持自动删除
+func (sp *SBPlugin) sendFormattedWithAutoDelete(ctx *command.CommandContext, message string, mode format.Mode, deleteAfterSeconds int) error {
 	var err error
-	// 使用独立的超时上下文，避免命令上下文被取消导致删除失败
-	deleteCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	// 根据群组类型选择不同的删除方法
-	switch p := peer.(type) {
-	case *tg.InputPeerChannel:
-		// 超级群组/频道使用ChannelsDeleteMessages
-		channelPeer := &tg.InputChannel{ChannelID: p.ChannelID, AccessHash: p.AccessHash}
-		_, err = ctx.API.ChannelsDeleteMessages(deleteCtx, &tg.ChannelsDeleteMessagesRequest{
-			Channel: channelPeer,
-			ID:      []int{messageID},
-		})
-	case *tg.InputPeerChat:
-		// 普通群组使用MessagesDeleteMessages
-		_, err = ctx.API.MessagesDeleteMessages(deleteCtx, &tg.MessagesDeleteMessagesRequest{
-			ID:     []int{messageID},
-			Revoke: true, // 对所有人删除
-		})
-	case *tg.InputPeerUser:
-		// 私聊使用MessagesDeleteMessages
-		_, err = ctx.API.MessagesDeleteMessages(deleteCtx, &tg.MessagesDeleteMessagesRequest{
-			ID:     []int{messageID},
-			Revoke: true, // 对所有人删除
-		})
-	default:
-		logger.Warnf("不支持的peer类型进行消息删除")
-		return
-	}
-
-	if err != nil {
-		logger.Warnf("自动删除消息%d失败: %v", messageID, err)
+	if deleteAfterSeconds > 0 {
+		_, err = ctx.RespondEphemeral(message, mode, time.Duration(deleteAfterSeconds)*time.Second)
 	} else {
-		logger.Debugf("成功自动删除消息%d", messageID)
+		_, err = ctx.Respond(message, mode)
 	}
+	return err
 }
@@ -0,0 +1,169 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/secrets"
+	"nexusvalet/internal/storage"
+	"nexusvalet/pkg/logger"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// secretsLockedMessage 密钥库未解锁时的统一提示
+const secretsLockedMessage = "密钥库未解锁，请使用 .unlock"
+
+// legacySecrets 内置插件中以明文保存的敏感配置，解锁密钥库时迁移并覆盖原值
+var legacySecrets = []secrets.LegacySecret{
+	{Name: "gemini.api_key", Table: "gemini_config", Key: "gemini_key"},
+	{Name: "tts.key", Table: "tts_config", Key: "key"},
+}
+
+// secretStore 从插件管理器获取密钥库
+func secretStore(manager interface{}) *secrets.Store {
+	if goManager, ok := manager.(*GoManager); ok {
+		return goManager.GetSecretStore()
+	}
+	return nil
+}
+
+// pluginStorage 从插件管理器获取插件共用的键值存储，获取不到时返回nil(读取返回不存在，写入返回错误)
+func pluginStorage(manager interface{}) *storage.Store {
+	if goManager, ok := manager.(*GoManager); ok {
+		return goManager.GetStorage()
+	}
+	return nil
+}
+
+// loadSecret 读取敏感配置。未启用加密时回退到插件自己的配置表
+func loadSecret(manager interface{}, name string, fallback func() (string, error)) (string, error) {
+	store := secretStore(manager)
+	if store == nil {
+		return fallback()
+	}
+	value, err := store.GetSecret(name)
+	if errors.Is(err, secrets.ErrDisabled) {
+		return fallback()
+	}
+	return value, err
+}
+
+// saveSecret 写入敏感配置。未启用加密时回退到插件自己的配置表
+func saveSecret(manager interface{}, name, value string, fallback func(string) error) error {
+	store := secretStore(manager)
+	if store == nil {
+		return fallback(value)
+	}
+	err := store.SetSecret(name, value)
+	if errors.Is(err, secrets.ErrDisabled) {
+		return fallback(value)
+	}
+	return err
+}
+
+// SecretsPlugin 密钥库解锁命令
+type SecretsPlugin struct {
+	*BasePlugin
+}
+
+// NewSecretsPlugin 创建密钥库插件
+func NewSecretsPlugin() *SecretsPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "secrets",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "敏感配置加密存储",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &SecretsPlugin{
+		BasePlugin: NewBasePlugin(info),
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (sp *SecretsPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterOwnerCommand("unlock", "解锁密钥库(仅限收藏夹)", sp.info.Name, sp.handleUnlock)
+	parser.RegisterOwnerCommand("lock", "锁定密钥库", sp.info.Name, sp.handleLock)
+	logger.Infof("Secrets commands registered successfully")
+	return nil
+}
+
+// handleUnlock 处理unlock命令。口令只接受在收藏夹中输入，且命令消息会被立即删除
+func (sp *SecretsPlugin) handleUnlock(ctx *command.CommandContext) error {
+	if ctx.Message.ChatID != ctx.Message.UserID {
+		return sp.sendResponse(ctx, "❌ 为避免口令泄露，请在收藏夹(Saved Messages)中使用 .unlock")
+	}
+
+	store := secretStore(sp.manager)
+	if store == nil {
+		return sp.sendResponse(ctx, "❌ 密钥库不可用")
+	}
+
+	passphrase := ctx.ArgsString()
+	if passphrase == "" {
+		status := "未启用(首次解锁时设置口令并启用加密)"
+		if store.Enabled() {
+			status = "已锁定"
+			if !store.Locked() {
+				status = "已解锁"
+			}
+		}
+		return sp.sendResponse(ctx, fmt.Sprintf("🔐 密钥库状态: %s\n用法: .unlock <口令>", status))
+	}
+
+	// 先删除含口令的命令消息，再发送结果
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+	if err := deleteCommandMessage(ctx, peer); err != nil {
+		logger.Warnf("Failed to delete unlock command message: %v", err)
+	}
+
+	firstTime := !store.Enabled()
+	migrated, err := store.Unlock(passphrase)
+	var message string
+	switch {
+	case errors.Is(err, secrets.ErrWrongPassphrase):
+		message = "❌ 口令错误"
+	case err != nil:
+		message = fmt.Sprintf("❌ 解锁失败: %v", err)
+	case firstTime:
+		message = "✅ 已启用密钥库加密并解锁"
+	default:
+		message = "✅ 密钥库已解锁"
+	}
+	if err == nil && migrated > 0 {
+		message += fmt.Sprintf("\n已迁移 %d 项明文密钥", migrated)
+	}
+
+	_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
+		Peer:     peer,
+		Message:  message,
+		RandomID: time.Now().UnixNano(),
+	})
+	return err
+}
+
+// handleLock 处理lock命令
+func (sp *SecretsPlugin) handleLock(ctx *command.CommandContext) error {
+	store := secretStore(sp.manager)
+	if store == nil || !store.Enabled() {
+		return sp.sendResponse(ctx, "密钥库未启用")
+	}
+	store.Lock()
+	return sp.sendResponse(ctx, "🔒 密钥库已锁定")
+}
+
+// sendResponse 发送响应消息
+func (sp *SecretsPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
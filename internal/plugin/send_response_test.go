@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"context"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/peers"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// TestSendResponseRepliesWhenEditFails 各插件的 sendResponse 经过 ctx.Respond，
+// 无法编辑命令消息或sudo执行时回复命令消息
+func TestSendResponseRepliesWhenEditFails(t *testing.T) {
+	helpers := map[string]func(*command.CommandContext, string) error{
+		"copy":        (&CopyPlugin{}).sendResponse,
+		"diff":        (&DiffPlugin{}).sendResponse,
+		"download":    (&DownloadPlugin{}).sendResponse,
+		"ephemeral":   (&EphemeralPlugin{}).sendResponse,
+		"joinrequest": (&JoinRequestPlugin{}).sendResponse,
+		"lsearch":     (&LSearchPlugin{}).sendResponse,
+		"maintenance": (&MaintenancePlugin{}).sendResponse,
+		"note":        (&NotePlugin{}).sendResponse,
+		"reminder":    (&ReminderPlugin{}).sendResponse,
+		"roll":        (&RollPlugin{}).sendResponse,
+		"secrets":     (&SecretsPlugin{}).sendResponse,
+		"story":       (&StoryPlugin{}).sendResponse,
+		"thread":      (&ThreadPlugin{}).sendResponse,
+		"tpl":         (&TplPlugin{}).sendResponse,
+		"tts":         (&TTSPlugin{}).sendResponse,
+		"vote":        (&VotePlugin{}).sendResponse,
+	}
+	for name, send := range helpers {
+		for _, sudo := range []bool{false, true} {
+			inv := &fakeInvoker{handle: func(input bin.Encoder, _ bin.Decoder) error {
+				if _, ok := input.(*tg.MessagesEditMessageRequest); ok {
+					return tgerr.New(400, "MESSAGE_AUTHOR_REQUIRED")
+				}
+				return errUnhandled
+			}}
+			ctx := &command.CommandContext{
+				Context:      context.Background(),
+				API:          tg.NewClient(inv),
+				PeerResolver: peers.NewResolver(fakePeers{}),
+				Message:      &core.MessageEvent{ChatID: -100, UserID: 1, Sudo: sudo, Message: &tg.Message{ID: 10}},
+			}
+			if err := send(ctx, "done"); err != nil {
+				t.Errorf("%s (sudo %v): %v", name, sudo, err)
+				continue
+			}
+			edits := requests[*tg.MessagesEditMessageRequest](inv)
+			sends := requests[*tg.MessagesSendMessageRequest](inv)
+			if sudo && len(edits) != 0 {
+				t.Errorf("%s: sudo should not edit the command message", name)
+			}
+			if len(sends) != 1 || sends[0].Message != "done" {
+				t.Errorf("%s (sudo %v): sent %d messages, want one reply", name, sudo, len(sends))
+				continue
+			}
+			if reply, ok := sends[0].ReplyTo.(*tg.InputReplyToMessage); !ok || reply.ReplyToMsgID != 10 {
+				t.Errorf("%s (sudo %v): reply to %v, want the command message", name, sudo, sends[0].ReplyTo)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// shareUsage share命令的用法
+const shareUsage = "用法: .share <命令> [参数...] to <chat_id|@username>\n例如: .share status to @mychannel"
+
+// handleShare 处理share命令：以捕获模式执行另一条命令，把它的文字输出发送到指定对话
+func (cp *CoreCommandsPlugin) handleShare(ctx *command.CommandContext) error {
+	if cp.parser == nil {
+		return cp.sendResponse(ctx, "❌ 命令解析器未就绪")
+	}
+
+	raw := ctx.ArgsString()
+	i := strings.LastIndex(raw, " to ")
+	if i < 0 {
+		return cp.sendResponse(ctx, shareUsage)
+	}
+	inner := strings.TrimPrefix(strings.TrimSpace(raw[:i]), ctx.Prefix)
+	target := strings.TrimSpace(raw[i+len(" to "):])
+	if inner == "" || target == "" || strings.ContainsAny(target, " \n") {
+		return cp.sendResponse(ctx, shareUsage)
+	}
+	name, _, _ := strings.Cut(inner, " ")
+	if cmd, ok := cp.parser.GetCommand(name); ok && cmd.Name == "share" {
+		return cp.sendResponse(ctx, "❌ 不能分享 share 命令本身")
+	}
+
+	peer, err := cp.resolveShareTarget(ctx, target)
+	if err != nil {
+		return cp.sendResponse(ctx, fmt.Sprintf("❌ 无法解析目标对话 %s: %v", target, err))
+	}
+
+	out, err := cp.parser.RunCaptured(ctx, inner)
+	if err != nil {
+		if veto, ok := core.AsVeto(err); ok && veto.Reason != "" {
+			return cp.sendResponse(ctx, "⛔ "+veto.Reason)
+		}
+		return cp.sendResponse(ctx, fmt.Sprintf("❌ 执行 %s%s 失败: %v", ctx.Prefix, name, err))
+	}
+	if out == nil || strings.TrimSpace(out.Text) == "" {
+		return cp.sendResponse(ctx, fmt.Sprintf("❌ %s%s 没有文字输出（可能只发送了图片或文件），无法分享", ctx.Prefix, name))
+	}
+
+	for _, chunk := range format.Split(out.Text, out.Entities, format.MaxMessageLength) {
+		if _, err := ctx.SendMessage(&tg.MessagesSendMessageRequest{
+			Peer:     peer,
+			Message:  chunk.Text,
+			Entities: chunk.Entities,
+			RandomID: time.Now().UnixNano(),
+		}); err != nil {
+			return cp.sendResponse(ctx, fmt.Sprintf("❌ 发送到 %s 失败: %v", target, explainPeerError(err)))
+		}
+	}
+	return cp.sendResponse(ctx, fmt.Sprintf("✅ 已将 %s%s 的输出分享到 %s", ctx.Prefix, name, target))
+}
+
+// resolveShareTarget 解析分享的目标对话(chatID 或 @username)
+func (cp *CoreCommandsPlugin) resolveShareTarget(ctx *command.CommandContext, target string) (tg.InputPeerClass, error) {
+	if ctx.API == nil || ctx.PeerResolver == nil {
+		return nil, fmt.Errorf("Telegram API 未就绪")
+	}
+
+	chatID, err := strconv.ParseInt(target, 10, 64)
+	if err != nil {
+		resolved, err := resolveUsername(ctx.Context, ctx.API, target)
+		if err != nil {
+			return nil, explainPeerError(err)
+		}
+		if manager := ctx.PeerResolver.Manager(); manager != nil {
+			manager.CacheUsersFromUpdate(resolved.Users)
+			manager.CacheChatsFromUpdate(resolved.Chats)
+		}
+		chatID = peerToChatID(resolved.Peer)
+		if chatID == 0 {
+			return nil, fmt.Errorf("不支持的对话类型")
+		}
+	}
+
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, chatID)
+	if err != nil {
+		return nil, explainPeerError(err)
+	}
+	return peer, nil
+}
@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// legacyResponse 不经过 Respond、直接编辑命令消息的 sendResponse，编辑失败或sudo时回复命令消息
+func legacyResponse(ctx *command.CommandContext, message string) error {
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return err
+	}
+	if !ctx.Message.Sudo {
+		if _, err := ctx.EditMessage(&tg.MessagesEditMessageRequest{Peer: peer, ID: ctx.Message.Message.ID, Message: message}); err == nil {
+			return nil
+		}
+	}
+	_, err = ctx.SendMessage(&tg.MessagesSendMessageRequest{
+		Peer:     peer,
+		Message:  message,
+		ReplyTo:  &tg.InputReplyToMessage{ReplyToMsgID: ctx.Message.Message.ID},
+		RandomID: time.Now().UnixNano(),
+	})
+	return err
+}
+
+// newShareTest 注册了核心命令和使用 legacyResponse 的legacy命令的测试环境
+func newShareTest(t *testing.T) *testEnv {
+	t.Helper()
+	env := newTestEnv()
+	if err := NewCoreCommandsPlugin().RegisterCommands(env.parser); err != nil {
+		t.Fatal(err)
+	}
+	env.parser.RegisterCommand("legacy", "直接编辑命令消息", "legacy", func(ctx *command.CommandContext) error {
+		if err := legacyResponse(ctx, "⏳ 处理中..."); err != nil {
+			return err
+		}
+		return legacyResponse(ctx, "结果 "+strings.Join(ctx.Args, " "))
+	})
+	return env
+}
+
+func TestShareCapturesDirectEdits(t *testing.T) {
+	for _, msgEvent := range []*core.MessageEvent{
+		{ChatID: -100, UserID: 1},
+		{ChatID: -100, UserID: 2, Sudo: true},
+	} {
+		env := newShareTest(t)
+		if got := env.runText(t, msgEvent, "share legacy a b to -200"); got != "✅ 已将 .legacy 的输出分享到 -200" {
+			t.Errorf("sudo %v: share = %q", msgEvent.Sudo, got)
+		}
+		// 中间的编辑和最终结果都被捕获，只有结果发送到目标对话
+		if edits := requests[*tg.MessagesEditMessageRequest](env.inv); len(edits) != 0 {
+			t.Errorf("sudo %v: %d edits reached the source chat", msgEvent.Sudo, len(edits))
+		}
+		sends := requests[*tg.MessagesSendMessageRequest](env.inv)
+		if len(sends) != 1 || sends[0].Message != "结果 a b" {
+			t.Fatalf("sudo %v: sent %d messages, want only the result", msgEvent.Sudo, len(sends))
+		}
+		if peer, ok := sends[0].Peer.(*tg.InputPeerChat); !ok || peer.ChatID != 200 {
+			t.Errorf("sudo %v: sent to %v, want chat -200", msgEvent.Sudo, sends[0].Peer)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package plugin
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/gotd/td/tg"
+)
+
+// maxShortcodes 单条消息最多展开的短代码数
+const maxShortcodes = 10
+
+// templateWeekdays {{weekday}} 使用的星期名称
+var templateWeekdays = [...]string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+// textEdit 展开时的一处替换，偏移和长度以UTF-16代码单元计，与消息实体一致
+type textEdit struct {
+	offset    int
+	length    int
+	newLength int
+}
+
+// textRange 消息中的一段区间(UTF-16)
+type textRange struct {
+	start int
+	end   int
+}
+
+// renderTemplate 替换模板中的占位符：{{1}}..{{n}} 为短代码参数，{{args}} 为全部参数，
+// {{date}}、{{time}}、{{datetime}}、{{weekday}} 为当前时间。缺少的参数替换为空
+func renderTemplate(tpl string, args []string, now time.Time) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(tpl, "{{")
+		if start < 0 {
+			b.WriteString(tpl)
+			break
+		}
+		end := strings.Index(tpl[start+2:], "}}")
+		if end < 0 {
+			b.WriteString(tpl)
+			break
+		}
+		end += start + 2
+
+		b.WriteString(tpl[:start])
+		key := strings.TrimSpace(tpl[start+2 : end])
+		if value, ok := templateValue(key, args, now); ok {
+			b.WriteString(value)
+		} else {
+			b.WriteString(tpl[start : end+2])
+		}
+		tpl = tpl[end+2:]
+	}
+	return b.String()
+}
+
+// templateValue 返回单个占位符的值，未知占位符返回false并保留原文
+func templateValue(key string, args []string, now time.Time) (string, bool) {
+	if n, err := strconv.Atoi(key); err == nil && n > 0 {
+		if n <= len(args) {
+			return args[n-1], true
+		}
+		return "", true
+	}
+	switch strings.ToLower(key) {
+	case "args":
+		return strings.Join(args, " "), true
+	case "date":
+		return now.Format("2006-01-02"), true
+	case "time":
+		return now.Format("15:04"), true
+	case "datetime":
+		return now.Format("2006-01-02 15:04"), true
+	case "weekday":
+		return templateWeekdays[now.Weekday()], true
+	}
+	return "", false
+}
+
+// parseShortcode 解析两个分号之间的内容，格式为 "名称 参数..."。名称只能包含字母、数字和下划线
+func parseShortcode(body string) (string, []string, bool) {
+	fields := strings.Fields(body)
+	if len(fields) == 0 || body[0] == ' ' {
+		return "", nil, false
+	}
+	for _, r := range fields[0] {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return "", nil, false
+		}
+	}
+	return strings.ToLower(fields[0]), fields[1:], true
+}
+
+// expandShortcodes 展开文本中的 ;名称 参数; 短代码，;; 转义为单个分号。
+// lookup 返回模板内容，未知的短代码原样保留；与protected区间(如代码实体)重叠的部分不处理。
+// 返回展开后的文本和替换记录，没有任何变化时替换记录为空
+func expandShortcodes(text string, lookup func(name string) (string, bool), protected []textRange, now time.Time) (string, []textEdit) {
+	if !strings.Contains(text, ";") {
+		return text, nil
+	}
+
+	runes := []rune(text)
+	// pos[i] 为第i个字符的UTF-16偏移
+	pos := make([]int, len(runes)+1)
+	for i, r := range runes {
+		pos[i+1] = pos[i] + utf16.RuneLen(r)
+	}
+	overlaps := func(start, end int) bool {
+		for _, r := range protected {
+			if start < r.end && r.start < end {
+				return true
+			}
+		}
+		return false
+	}
+
+	var b strings.Builder
+	var edits []textEdit
+	expanded := 0
+	for i := 0; i < len(runes); {
+		if runes[i] != ';' || overlaps(pos[i], pos[i+1]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		// ;; 转义
+		if i+1 < len(runes) && runes[i+1] == ';' && !overlaps(pos[i+1], pos[i+2]) {
+			b.WriteRune(';')
+			edits = append(edits, textEdit{offset: pos[i], length: 2, newLength: 1})
+			i += 2
+			continue
+		}
+
+		// 查找同一行内的结束分号
+		end := -1
+		for j := i + 1; j < len(runes) && runes[j] != '\n'; j++ {
+			if runes[j] == ';' {
+				end = j
+				break
+			}
+		}
+		if end < 0 || expanded >= maxShortcodes || overlaps(pos[i], pos[end+1]) {
+			b.WriteRune(';')
+			i++
+			continue
+		}
+
+		name, args, ok := parseShortcode(string(runes[i+1 : end]))
+		var tpl string
+		if ok {
+			tpl, ok = lookup(name)
+		}
+		if !ok {
+			b.WriteRune(';')
+			i++
+			continue
+		}
+
+		value := renderTemplate(tpl, args, now)
+		b.WriteString(value)
+		edits = append(edits, textEdit{offset: pos[i], length: pos[end+1] - pos[i], newLength: len(utf16.Encode([]rune(value)))})
+		expanded++
+		i = end + 1
+	}
+
+	if len(edits) == 0 {
+		return text, nil
+	}
+	return b.String(), edits
+}
+
+// mapOffset 将原文本中的UTF-16偏移映射到展开后的文本。落在替换区间内的偏移，
+// 起点对齐到替换开始，终点对齐到替换结束
+func mapOffset(offset int, edits []textEdit, isEnd bool) int {
+	delta := 0
+	for _, e := range edits {
+		if offset >= e.offset+e.length {
+			delta += e.newLength - e.length
+			continue
+		}
+		if offset <= e.offset {
+			break
+		}
+		if isEnd {
+			return e.offset + delta + e.newLength
+		}
+		return e.offset + delta
+	}
+	return offset + delta
+}
+
+// remapEntities 按替换记录调整消息实体的偏移，长度变为0的实体被丢弃
+func remapEntities(entities []tg.MessageEntityClass, edits []textEdit) []tg.MessageEntityClass {
+	var result []tg.MessageEntityClass
+	for _, entity := range entities {
+		start := mapOffset(entity.GetOffset(), edits, false)
+		end := mapOffset(entity.GetOffset()+entity.GetLength(), edits, true)
+		if end <= start {
+			continue
+		}
+
+		// 所有实体类型都有Offset和Length字段，复制后修改避免改动原消息
+		v := reflect.ValueOf(entity).Elem()
+		clone := reflect.New(v.Type())
+		clone.Elem().Set(v)
+		clone.Elem().FieldByName("Offset").SetInt(int64(start))
+		clone.Elem().FieldByName("Length").SetInt(int64(end - start))
+		result = append(result, clone.Interface().(tg.MessageEntityClass))
+	}
+	return result
+}
+
+// codeRanges 返回消息中代码实体的区间，短代码在这些区间内不展开
+func codeRanges(entities []tg.MessageEntityClass) []textRange {
+	var ranges []textRange
+	for _, entity := range entities {
+		switch entity.(type) {
+		case *tg.MessageEntityCode, *tg.MessageEntityPre:
+			ranges = append(ranges, textRange{start: entity.GetOffset(), end: entity.GetOffset() + entity.GetLength()})
+		}
+	}
+	return ranges
+}
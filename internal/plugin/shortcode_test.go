@@ -0,0 +1,169 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// shortcodeNow 2024-03-05 是星期二
+var shortcodeNow = time.Date(2024, 3, 5, 14, 7, 0, 0, time.UTC)
+
+var testShortcodes = map[string]string{
+	"sig":   "— {{1}}",
+	"hi":    "你好 {{args}}!",
+	"today": "{{date}} {{weekday}}",
+	"x":     "X",
+	"empty": "",
+}
+
+func lookupShortcode(name string) (string, bool) {
+	tpl, ok := testShortcodes[name]
+	return tpl, ok
+}
+
+func TestRenderTemplate(t *testing.T) {
+	tests := []struct {
+		tpl  string
+		args []string
+		want string
+	}{
+		{"{{1}} and {{2}}", []string{"a", "b"}, "a and b"},
+		{"{{ 1 }}", []string{"a"}, "a"},
+		{"missing: [{{3}}]", []string{"a"}, "missing: []"},
+		{"{{args}}", []string{"x", "y", "z"}, "x y z"},
+		{"{{date}} {{time}}", nil, "2024-03-05 14:07"},
+		{"{{DATETIME}} {{weekday}}", nil, "2024-03-05 14:07 星期二"},
+		{"{{foo}} {{0}}", []string{"a"}, "{{foo}} {{0}}"},
+		{"unterminated {{1", []string{"a"}, "unterminated {{1"},
+		{"{{1}}{{1}}", []string{"重复"}, "重复重复"},
+	}
+	for _, tt := range tests {
+		if got := renderTemplate(tt.tpl, tt.args, shortcodeNow); got != tt.want {
+			t.Errorf("renderTemplate(%q, %q) = %q, want %q", tt.tpl, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestParseShortcode(t *testing.T) {
+	tests := []struct {
+		body string
+		name string
+		args []string
+		ok   bool
+	}{
+		{"sig Bob", "sig", []string{"Bob"}, true},
+		{"SIG", "sig", []string{}, true},
+		{"名字 参数", "名字", []string{"参数"}, true},
+		{"a_1  x   y", "a_1", []string{"x", "y"}, true},
+		{" sig", "", nil, false},
+		{"", "", nil, false},
+		{"si-g x", "", nil, false},
+		{"a.b", "", nil, false},
+	}
+	for _, tt := range tests {
+		name, args, ok := parseShortcode(tt.body)
+		if name != tt.name || ok != tt.ok || (ok && !reflect.DeepEqual(args, tt.args)) {
+			t.Errorf("parseShortcode(%q) = %q, %q, %v; want %q, %q, %v", tt.body, name, args, ok, tt.name, tt.args, tt.ok)
+		}
+	}
+}
+
+func TestExpandShortcodes(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		protected []textRange
+		want      string
+		edits     []textEdit
+	}{
+		{"no semicolon", "plain text", nil, "plain text", nil},
+		{"single", "a ;sig Bob; b", nil, "a — Bob b", []textEdit{{2, 9, 5}}},
+		{"case insensitive", ";SIG x;", nil, "— x", []textEdit{{0, 7, 3}}},
+		{"missing argument", ";sig;", nil, "— ", []textEdit{{0, 5, 2}}},
+		{"escape", "a;;b", nil, "a;b", []textEdit{{1, 2, 1}}},
+		{"escape then shortcode", ";;;x;", nil, ";X", []textEdit{{0, 2, 1}, {2, 3, 1}}},
+		{"unknown kept", ";nope; x", nil, ";nope; x", nil},
+		{"unterminated", "a ;sig Bob", nil, "a ;sig Bob", nil},
+		{"not across lines", ";sig\nBob;", nil, ";sig\nBob;", nil},
+		{"leading space is not a shortcode", "; sig;", nil, "; sig;", nil},
+		{"unknown then known", ";nope ;x;", nil, ";nope X", []textEdit{{6, 3, 1}}},
+		{"several args", ";hi 世界 朋友;", nil, "你好 世界 朋友!", []textEdit{{0, 10, 9}}},
+		{"utf16 offsets", "😀;hi 世界;", nil, "😀你好 世界!", []textEdit{{2, 7, 6}}},
+		{"emoji in value length", ";sig 😀;", nil, "— 😀", []textEdit{{0, 8, 4}}},
+		{"time placeholders", "[;today;]", nil, "[2024-03-05 星期二]", []textEdit{{1, 7, 14}}},
+		{"empty template", "a;empty;b", nil, "ab", []textEdit{{1, 7, 0}}},
+		{"protected", "`;sig a;` ;x;", []textRange{{0, 9}}, "`;sig a;` X", []textEdit{{10, 3, 1}}},
+		{"partially protected", ";sig a;", []textRange{{3, 4}}, ";sig a;", nil},
+		{"protected escape", ";;", []textRange{{1, 2}}, ";;", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, edits := expandShortcodes(tt.text, lookupShortcode, tt.protected, shortcodeNow)
+			if got != tt.want {
+				t.Errorf("expandShortcodes(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if !reflect.DeepEqual(edits, tt.edits) {
+				t.Errorf("edits = %+v, want %+v", edits, tt.edits)
+			}
+		})
+	}
+}
+
+func TestExpandShortcodesLimit(t *testing.T) {
+	text := strings.Repeat(";x; ", maxShortcodes+2)
+	got, edits := expandShortcodes(text, lookupShortcode, nil, shortcodeNow)
+	want := strings.Repeat("X ", maxShortcodes) + ";x; ;x; "
+	if got != want || len(edits) != maxShortcodes {
+		t.Errorf("got %q with %d edits, want %q with %d", got, len(edits), want, maxShortcodes)
+	}
+}
+
+func TestRemapEntities(t *testing.T) {
+	// "ab ;sig Bob; cd" 展开为 "ab — Bob cd"
+	_, edits := expandShortcodes("ab ;sig Bob; cd", lookupShortcode, nil, shortcodeNow)
+	original := &tg.MessageEntityBold{Offset: 13, Length: 2}
+	entities := []tg.MessageEntityClass{
+		&tg.MessageEntityItalic{Offset: 0, Length: 2},
+		original,
+		&tg.MessageEntityUnderline{Offset: 0, Length: 15},
+		&tg.MessageEntityTextURL{Offset: 5, Length: 3, URL: "https://example.com"},
+	}
+	want := []tg.MessageEntityClass{
+		&tg.MessageEntityItalic{Offset: 0, Length: 2},
+		&tg.MessageEntityBold{Offset: 9, Length: 2},
+		&tg.MessageEntityUnderline{Offset: 0, Length: 11},
+		// 落在短代码内部的实体覆盖整个替换结果
+		&tg.MessageEntityTextURL{Offset: 3, Length: 5, URL: "https://example.com"},
+	}
+	if got := remapEntities(entities, edits); !reflect.DeepEqual(got, want) {
+		t.Errorf("remapEntities = %#v, want %#v", got, want)
+	}
+	if original.Offset != 13 {
+		t.Error("remapEntities modified the original entity")
+	}
+
+	// 替换为空的短代码内的实体被丢弃
+	_, edits = expandShortcodes("a;empty;b", lookupShortcode, nil, shortcodeNow)
+	got := remapEntities([]tg.MessageEntityClass{
+		&tg.MessageEntityBold{Offset: 2, Length: 3},
+		&tg.MessageEntityItalic{Offset: 8, Length: 1},
+	}, edits)
+	if want := []tg.MessageEntityClass{&tg.MessageEntityItalic{Offset: 1, Length: 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("remapEntities = %#v, want %#v", got, want)
+	}
+}
+
+func TestCodeRanges(t *testing.T) {
+	got := codeRanges([]tg.MessageEntityClass{
+		&tg.MessageEntityBold{Offset: 0, Length: 3},
+		&tg.MessageEntityCode{Offset: 4, Length: 2},
+		&tg.MessageEntityPre{Offset: 10, Length: 5, Language: "go"},
+	})
+	if want := []textRange{{4, 6}, {10, 15}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("codeRanges = %v, want %v", got, want)
+	}
+}
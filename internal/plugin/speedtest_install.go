@@ -0,0 +1,233 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"nexusvalet/pkg/logger"
+)
+
+// speedtestVersion 下载的Ookla Speedtest CLI版本
+const speedtestVersion = "1.2.0"
+
+// speedtestPackages 各平台对应的安装包名后缀，不在表中的平台需要手动安装并设置 plugins.speedtest.path
+var speedtestPackages = map[string]string{
+	"linux/amd64":  "linux-x86_64",
+	"linux/386":    "linux-i386",
+	"linux/arm64":  "linux-aarch64",
+	"linux/arm":    "linux-armhf",
+	"darwin/amd64": "macosx-universal",
+	"darwin/arm64": "macosx-universal",
+}
+
+// speedtestChecksums 已知安装包的SHA-256，以包名为键。没有记录的安装包下载后
+// 在日志中打印实际的校验值，可通过 plugins.speedtest.sha256 固定
+var speedtestChecksums = map[string]string{}
+
+// binaryPath 返回speedtest CLI的路径，配置了 plugins.speedtest.path 时使用配置的路径
+func (st *SpeedTestPlugin) binaryPath() string {
+	if goManager, ok := st.manager.(*GoManager); ok {
+		if cfg := goManager.GetConfig(); cfg != nil && cfg.Plugins.Speedtest.Path != "" {
+			return cfg.Plugins.Speedtest.Path
+		}
+	}
+	return st.speedtestPath
+}
+
+// expectedChecksum 返回安装包应有的SHA-256，配置优先，未知时返回空字符串
+func (st *SpeedTestPlugin) expectedChecksum(pkg string) string {
+	if goManager, ok := st.manager.(*GoManager); ok {
+		if cfg := goManager.GetConfig(); cfg != nil && cfg.Plugins.Speedtest.SHA256 != "" {
+			return strings.ToLower(cfg.Plugins.Speedtest.SHA256)
+		}
+	}
+	return speedtestChecksums[pkg]
+}
+
+// speedtestPackage 返回当前平台的安装包名
+func speedtestPackage() (string, error) {
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	suffix, ok := speedtestPackages[platform]
+	if !ok {
+		return "", fmt.Errorf("Ookla 没有提供 %s 平台的 speedtest CLI 安装包，请手动安装后通过 plugins.speedtest.path 指定路径", platform)
+	}
+	return fmt.Sprintf("ookla-speedtest-%s-%s.tgz", speedtestVersion, suffix), nil
+}
+
+// getDownloadURL 获取下载URL
+func (st *SpeedTestPlugin) getDownloadURL() (string, error) {
+	pkg, err := speedtestPackage()
+	if err != nil {
+		return "", err
+	}
+	return "https://install.speedtest.net/app/cli/" + pkg, nil
+}
+
+// ensureSpeedTestCLI 确保speedtest CLI存在。force为true时重新下载；
+// 已安装的文件与安装时记录的校验值不符时也会重新下载
+func (st *SpeedTestPlugin) ensureSpeedTestCLI(force bool) error {
+	st.installMu.Lock()
+	defer st.installMu.Unlock()
+
+	path := st.binaryPath()
+	if !force {
+		if _, err := os.Stat(path); err == nil {
+			err := verifyInstalledBinary(path)
+			if err == nil {
+				return nil
+			}
+			logger.Warnf("Speedtest CLI at %s failed verification, downloading again: %v", path, err)
+		}
+	}
+
+	logger.Infof("Downloading Speedtest CLI to %s...", path)
+	downloadURL, err := st.getDownloadURL()
+	if err != nil {
+		return err
+	}
+	pkg, _ := speedtestPackage()
+	if err := st.downloadAndInstall(downloadURL, st.expectedChecksum(pkg), path); err != nil {
+		return err
+	}
+
+	logger.Infof("Speedtest CLI installed successfully")
+	return nil
+}
+
+// downloadAndInstall 下载安装包，校验后只把 speedtest 可执行文件放到path，
+// 安装包中的说明文件等随临时目录一起删除
+func (st *SpeedTestPlugin) downloadAndInstall(url, expected, path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(dir, ".speedtest-")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("下载失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("下载失败，状态码: %d", resp.StatusCode)
+	}
+
+	archive := filepath.Join(tmpDir, "speedtest.tgz")
+	sum, err := saveWithChecksum(archive, resp.Body)
+	if err != nil {
+		return fmt.Errorf("保存文件失败: %w", err)
+	}
+	if expected == "" {
+		logger.Warnf("No known SHA-256 for %s, downloaded archive is %s; set plugins.speedtest.sha256 to pin it", filepath.Base(url), sum)
+	} else if sum != expected {
+		return fmt.Errorf("安装包校验失败: SHA-256 应为 %s，实际为 %s", expected, sum)
+	}
+
+	if err := st.extractTarGz(archive, tmpDir); err != nil {
+		return fmt.Errorf("解压失败: %w", err)
+	}
+	binary := filepath.Join(tmpDir, "speedtest")
+	if _, err := os.Stat(binary); err != nil {
+		return fmt.Errorf("安装包中没有 speedtest 可执行文件")
+	}
+	if err := os.Chmod(binary, 0755); err != nil {
+		return fmt.Errorf("设置执行权限失败: %w", err)
+	}
+	if err := os.Rename(binary, path); err != nil {
+		return fmt.Errorf("安装到 %s 失败: %w", path, err)
+	}
+	return recordBinaryChecksum(path)
+}
+
+// extractTarGz 解压tar.gz文件
+func (st *SpeedTestPlugin) extractTarGz(src, dest string) error {
+	// 使用系统命令解压
+	cmd := exec.Command("tar", "-xzf", src, "-C", dest)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("解压命令失败: %w", err)
+	}
+
+	return nil
+}
+
+// saveWithChecksum 把r写入path并返回内容的SHA-256
+func saveWithChecksum(path string, r io.Reader) (string, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hash), r); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fileChecksum 计算文件的SHA-256
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// recordBinaryChecksum 在可执行文件旁记录其SHA-256，之后每次使用前核对
+func recordBinaryChecksum(path string) error {
+	sum, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+".sha256", []byte(sum+"\n"), 0644)
+}
+
+// verifyInstalledBinary 核对可执行文件与安装时记录的SHA-256，
+// 没有记录(手动安装或旧版本安装)时不校验
+func verifyInstalledBinary(path string) error {
+	recorded, err := os.ReadFile(path + ".sha256")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sum, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+	if sum != strings.TrimSpace(string(recorded)) {
+		return fmt.Errorf("文件已被修改")
+	}
+	return nil
+}
+
+// execError 把执行speedtest的错误转换为说明，权限不足时提示目录可能以noexec挂载
+func execError(path string, err error) error {
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("无法执行 %s，所在目录可能以 noexec 挂载，请通过 plugins.speedtest.path 指定其他位置: %w", path, err)
+	}
+	return err
+}
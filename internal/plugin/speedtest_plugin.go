@@ -3,6 +3,7 @@ package plugin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"image/png"
@@ -10,22 +11,23 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/selftest"
 	"nexusvalet/pkg/logger"
 
-	"github.com/gotd/td/telegram/uploader"
 	"github.com/gotd/td/tg"
 )
 
 // SpeedTestPlugin 网速测试插件
 type SpeedTestPlugin struct {
 	*BasePlugin
-	speedtestPath string
+	speedtestPath string     // 默认的CLI路径，可通过 plugins.speedtest.path 修改
+	installMu     sync.Mutex // 防止同时下载安装
 }
 
 // SpeedTestResult 测速结果结构体
@@ -82,40 +84,21 @@ func NewSpeedTestPlugin() *SpeedTestPlugin {
 
 // RegisterCommands 实现CommandPlugin接口
 func (st *SpeedTestPlugin) RegisterCommands(parser *command.Parser) error {
-	parser.RegisterCommand("st", "网络速度测试", st.info.Name, st.handleSpeedTest)
+	parser.RegisterCommand("speedtest", "网络速度测试", st.info.Name, st.handleSpeedTest)
+	parser.RegisterDeprecatedAlias("st", "speedtest")
 	logger.Infof("SpeedTest plugin commands registered successfully")
 	return nil
 }
 
 // sendResponse SpeedTest插件通用响应函数
 func (st *SpeedTestPlugin) sendResponse(ctx *command.CommandContext, message string) error {
-	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-	if err != nil {
-		return fmt.Errorf("failed to resolve peer: %w", err)
-	}
+	return st.sendFormatted(ctx, message, format.Plain)
+}
 
-	if ctx.Message.ChatID > 0 {
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: message,
-		})
-		return err
-	} else {
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: message,
-		})
-		if err != nil {
-			_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-				Peer:     peer,
-				Message:  message,
-				RandomID: time.Now().UnixNano(),
-			})
-		}
-		return err
-	}
+// sendFormatted 按mode解析格式标记后发送响应
+func (st *SpeedTestPlugin) sendFormatted(ctx *command.CommandContext, message string, mode format.Mode) error {
+	_, err := ctx.Respond(message, mode)
+	return err
 }
 
 // editWithPhoto 编辑消息为图片
@@ -132,8 +115,7 @@ func (st *SpeedTestPlugin) editWithPhoto(ctx *command.CommandContext, imagePath
 	}
 
 	// 上传图片文件
-	uploader := uploader.NewUploader(ctx.API)
-	file, err := uploader.FromBytes(ctx.Context, fmt.Sprintf("speedtest_%d.png", time.Now().Unix()), imageData)
+	file, err := uploadPhoto(ctx.Context, ctx.API, fmt.Sprintf("speedtest_%d.png", time.Now().Unix()), imageData)
 	if err != nil {
 		return fmt.Errorf("failed to upload image: %w", err)
 	}
@@ -162,12 +144,15 @@ func (st *SpeedTestPlugin) handleSpeedTest(ctx *command.CommandContext) error {
 	if len(ctx.Args) > 0 && ctx.Args[0] == "list" {
 		return st.handleListServers(ctx)
 	}
+	if len(ctx.Args) > 0 && ctx.Args[0] == "update" {
+		return st.handleUpdate(ctx)
+	}
 
 	// 开始测速
 	st.sendResponse(ctx, "🚀 开始网速测试，请稍候...")
 
 	// 确保speedtest CLI存在
-	if err := st.ensureSpeedTestCLI(); err != nil {
+	if err := st.ensureSpeedTestCLI(false); err != nil {
 		return st.sendResponse(ctx, fmt.Sprintf("❌ 初始化测速工具失败: %v", err))
 	}
 
@@ -177,7 +162,16 @@ func (st *SpeedTestPlugin) handleSpeedTest(ctx *command.CommandContext) error {
 		serverID = ctx.Args[0]
 	}
 
-	result, err := st.runSpeedTest(serverID)
+	result, err := st.runSpeedTestWithProgress(serverID, func(text string) {
+		if err := st.sendResponse(ctx, text); err != nil {
+			logger.Debugf("Failed to edit speedtest progress: %v", err)
+		}
+	})
+	if errors.Is(err, errSpeedtestNoProgress) {
+		// 不支持进度输出的CLI，回退到一次性输出结果
+		logger.Warnf("Speedtest CLI did not report progress, running without it")
+		result, err = st.runSpeedTest(serverID)
+	}
 	if err != nil {
 		return st.sendResponse(ctx, fmt.Sprintf("❌ 测速失败: %v", err))
 	}
@@ -214,7 +208,7 @@ func (st *SpeedTestPlugin) handleSpeedTest(ctx *command.CommandContext) error {
 func (st *SpeedTestPlugin) handleListServers(ctx *command.CommandContext) error {
 	st.sendResponse(ctx, "🔍 获取附近的测速服务器...")
 
-	if err := st.ensureSpeedTestCLI(); err != nil {
+	if err := st.ensureSpeedTestCLI(false); err != nil {
 		return st.sendResponse(ctx, fmt.Sprintf("❌ 初始化测速工具失败: %v", err))
 	}
 
@@ -251,128 +245,54 @@ func (st *SpeedTestPlugin) handleListServers(ctx *command.CommandContext) error
 			serverID = fmt.Sprintf("%v", id)
 		}
 		response.WriteString(fmt.Sprintf("• `%s` - %s - %s\n",
-			serverID, server.Name, server.Location))
+			serverID, format.EscapeMarkdown(server.Name), format.EscapeMarkdown(server.Location)))
 	}
 
 	if len(servers.Servers) > 10 {
 		response.WriteString(fmt.Sprintf("\n... 还有 %d 个服务器\n", len(servers.Servers)-10))
 	}
 
-	response.WriteString("\n💡 使用 `.st <服务器ID>` 指定服务器测速")
+	response.WriteString("\n💡 使用 `.speedtest <服务器ID>` 指定服务器测速")
 
-	return st.sendResponse(ctx, response.String())
+	return st.sendFormatted(ctx, response.String(), format.Markdown)
 }
 
-// ensureSpeedTestCLI 确保speedtest CLI存在
-func (st *SpeedTestPlugin) ensureSpeedTestCLI() error {
-	// 检查是否已存在
-	if _, err := os.Stat(st.speedtestPath); err == nil {
-		return nil
-	}
+// handleUpdate 重新下载speedtest CLI
+func (st *SpeedTestPlugin) handleUpdate(ctx *command.CommandContext) error {
+	st.sendResponse(ctx, "⬇️ 正在重新下载测速工具...")
 
-	logger.Infof("Downloading Speedtest CLI...")
-
-	// 创建目录
-	dir := filepath.Dir(st.speedtestPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("创建目录失败: %w", err)
-	}
-
-	// 根据系统架构下载对应版本
-	downloadURL, err := st.getDownloadURL()
-	if err != nil {
-		return err
+	if err := st.ensureSpeedTestCLI(true); err != nil {
+		return st.sendResponse(ctx, fmt.Sprintf("❌ 下载测速工具失败: %v", err))
 	}
 
-	// 下载并安装
-	if err := st.downloadAndInstall(downloadURL); err != nil {
-		return err
+	pkg, _ := speedtestPackage()
+	verified := "⚠️ 没有该版本的已知校验值，未校验安装包"
+	if st.expectedChecksum(pkg) != "" {
+		verified = "✅ 安装包SHA-256校验通过"
 	}
-
-	// 设置执行权限
-	if err := os.Chmod(st.speedtestPath, 0755); err != nil {
-		return fmt.Errorf("设置执行权限失败: %w", err)
-	}
-
-	logger.Infof("Speedtest CLI installed successfully")
-	return nil
+	return st.sendResponse(ctx, fmt.Sprintf("✅ 已安装 Speedtest CLI %s 到 %s\n%s", speedtestVersion, st.binaryPath(), verified))
 }
 
-// getDownloadURL 获取下载URL
-func (st *SpeedTestPlugin) getDownloadURL() (string, error) {
-	version := "1.2.0"
-	machine := runtime.GOARCH
-
-	// 映射架构名称
-	switch machine {
-	case "amd64":
-		machine = "x86_64"
-	case "arm64":
-		machine = "aarch64"
-	}
-
-	var osName string
-	switch runtime.GOOS {
-	case "linux":
-		osName = "linux"
-	case "darwin":
-		osName = "macosx"
-	case "windows":
-		osName = "win64"
-	default:
-		return "", fmt.Errorf("不支持的操作系统: %s", runtime.GOOS)
-	}
-
-	filename := fmt.Sprintf("ookla-speedtest-%s-%s-%s.tgz", version, osName, machine)
-	url := fmt.Sprintf("https://install.speedtest.net/app/cli/%s", filename)
-
-	return url, nil
-}
-
-// downloadAndInstall 下载并安装
-func (st *SpeedTestPlugin) downloadAndInstall(url string) error {
-	// 下载文件
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("下载失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("下载失败，状态码: %d", resp.StatusCode)
-	}
-
-	// 保存到临时文件
-	tmpFile := st.speedtestPath + ".tgz"
-	file, err := os.Create(tmpFile)
-	if err != nil {
-		return fmt.Errorf("创建临时文件失败: %w", err)
-	}
-	defer file.Close()
-	defer os.Remove(tmpFile)
-
-	_, err = io.Copy(file, resp.Body)
-	if err != nil {
-		return fmt.Errorf("保存文件失败: %w", err)
-	}
-
-	// 解压文件
-	if err := st.extractTarGz(tmpFile, filepath.Dir(st.speedtestPath)); err != nil {
-		return fmt.Errorf("解压失败: %w", err)
-	}
-
-	return nil
-}
-
-// extractTarGz 解压tar.gz文件
-func (st *SpeedTestPlugin) extractTarGz(src, dest string) error {
-	// 使用系统命令解压
-	cmd := exec.Command("tar", "-xzf", src, "-C", dest)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("解压命令失败: %w", err)
-	}
-
-	return nil
+// SelfTestChecks 实现SelfTestPlugin接口，检查speedtest CLI是否可用
+func (st *SpeedTestPlugin) SelfTestChecks() []selftest.Check {
+	return []selftest.Check{{
+		Name:    "speedtest",
+		Timeout: 5 * time.Second,
+		Run: func(ctx context.Context) error {
+			path := st.binaryPath()
+			if info, err := os.Stat(path); err == nil {
+				if info.Mode()&0111 == 0 {
+					return fmt.Errorf("%s 没有执行权限", path)
+				}
+				return verifyInstalledBinary(path)
+			}
+			// 未下载时确认当前平台有可用的版本
+			if _, err := st.getDownloadURL(); err != nil {
+				return err
+			}
+			return selftest.Skipf("speedtest CLI 未下载，首次使用时自动下载")
+		},
+	}}
 }
 
 // runSpeedTest 运行速度测试
@@ -385,10 +305,11 @@ func (st *SpeedTestPlugin) runSpeedTest(serverID string) (*SpeedTestResult, erro
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, st.speedtestPath, args...)
+	path := st.binaryPath()
+	cmd := exec.CommandContext(ctx, path, args...)
 	output, err := cmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("执行测速命令失败: %w", err)
+		return nil, fmt.Errorf("执行测速命令失败: %w", execError(path, err))
 	}
 
 	var result SpeedTestResult
@@ -404,10 +325,11 @@ func (st *SpeedTestPlugin) getServerList() (*SpeedTestServers, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, st.speedtestPath, "-f", "json", "-L")
+	path := st.binaryPath()
+	cmd := exec.CommandContext(ctx, path, "-f", "json", "-L")
 	output, err := cmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("获取服务器列表失败: %w", err)
+		return nil, fmt.Errorf("获取服务器列表失败: %w", execError(path, err))
 	}
 
 	var servers SpeedTestServers
@@ -498,16 +420,13 @@ func (st *SpeedTestPlugin) downloadAndCropImage(resultURL string) (string, error
 		return "", fmt.Errorf("下载图片失败，状态码: %d", resp.StatusCode)
 	}
 
-	// 创建临时文件
-	tmpDir := filepath.Dir(st.speedtestPath)
-	imagePath := filepath.Join(tmpDir, "speedtest_result.png")
-
-	// 保存原始图片
-	file, err := os.Create(imagePath)
+	// 保存原始图片到临时文件，CLI的目录可能不可写
+	file, err := os.CreateTemp("", "speedtest_result_*.png")
 	if err != nil {
 		return "", fmt.Errorf("创建图片文件失败: %w", err)
 	}
 	defer file.Close()
+	imagePath := file.Name()
 
 	_, err = io.Copy(file, resp.Body)
 	if err != nil {
@@ -0,0 +1,172 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// speedtestProgressInterval 两次编辑测速进度的最短间隔
+const speedtestProgressInterval = 2 * time.Second
+
+// errSpeedtestNoProgress CLI没有输出可以解析的进度事件，调用方回退到一次性输出结果的方式
+var errSpeedtestNoProgress = errors.New("speedtest CLI 没有输出进度")
+
+// speedtestEvent -f jsonl --progress=yes 输出的一行事件，type为result时整行即为测速结果
+type speedtestEvent struct {
+	Type string `json:"type"`
+	Ping struct {
+		Latency  float64 `json:"latency"`
+		Progress float64 `json:"progress"`
+	} `json:"ping"`
+	Download struct {
+		Bandwidth int64   `json:"bandwidth"`
+		Progress  float64 `json:"progress"`
+	} `json:"download"`
+	Upload struct {
+		Bandwidth int64   `json:"bandwidth"`
+		Progress  float64 `json:"progress"`
+	} `json:"upload"`
+}
+
+// speedtestProgress 当前的测速进度
+type speedtestProgress struct {
+	phase      string // ping、download 或 upload，为空表示尚未开始
+	ping       float64
+	download   int64
+	downPct    float64
+	upload     int64
+	upPct      float64
+	lastEdit   time.Time
+	lastText   string
+	onProgress func(text string)
+	now        func() time.Time
+}
+
+// newSpeedtestProgress 创建进度，开始后的 speedtestProgressInterval 内不编辑，避免覆盖开始提示
+func newSpeedtestProgress(onProgress func(text string), now func() time.Time) *speedtestProgress {
+	return &speedtestProgress{lastEdit: now(), onProgress: onProgress, now: now}
+}
+
+// update 记录一个进度事件，按 speedtestProgressInterval 节流调用回调
+func (p *speedtestProgress) update(st *SpeedTestPlugin, event *speedtestEvent) {
+	switch event.Type {
+	case "ping":
+		p.phase, p.ping = "ping", event.Ping.Latency
+	case "download":
+		p.phase, p.download, p.downPct = "download", event.Download.Bandwidth, event.Download.Progress
+	case "upload":
+		p.phase, p.upload, p.upPct = "upload", event.Upload.Bandwidth, event.Upload.Progress
+	default:
+		return
+	}
+	now := p.now()
+	if now.Sub(p.lastEdit) < speedtestProgressInterval {
+		return
+	}
+	text := p.format(st)
+	if text == p.lastText {
+		return
+	}
+	p.lastEdit, p.lastText = now, text
+	p.onProgress(text)
+}
+
+// format 返回进度说明，已完成的阶段显示结果，进行中的阶段显示目前的速度和百分比
+func (p *speedtestProgress) format(st *SpeedTestPlugin) string {
+	var b strings.Builder
+	b.WriteString("🚀 正在测速...\n\n")
+
+	switch p.phase {
+	case "ping":
+		fmt.Fprintf(&b, "延迟: %.2f ms ⏳\n", p.ping)
+	default:
+		fmt.Fprintf(&b, "延迟: %.2f ms ✅\n", p.ping)
+	}
+
+	switch p.phase {
+	case "ping":
+		b.WriteString("下载: 等待中\n")
+	case "download":
+		fmt.Fprintf(&b, "下载: %s (%.0f%%) ⏳\n", st.unitConvert(p.download), p.downPct*100)
+	default:
+		fmt.Fprintf(&b, "下载: %s ✅\n", st.unitConvert(p.download))
+	}
+
+	if p.phase == "upload" {
+		fmt.Fprintf(&b, "上传: %s (%.0f%%) ⏳", st.unitConvert(p.upload), p.upPct*100)
+	} else {
+		b.WriteString("上传: 等待中")
+	}
+	return b.String()
+}
+
+// runSpeedTestWithProgress 以 jsonl 格式运行测速，每收到进度事件按节流调用onProgress。
+// 没有解析到任何事件时返回 errSpeedtestNoProgress
+func (st *SpeedTestPlugin) runSpeedTestWithProgress(serverID string, onProgress func(text string)) (*SpeedTestResult, error) {
+	args := []string{"--accept-license", "--accept-gdpr", "-f", "jsonl", "--progress=yes"}
+	if serverID != "" {
+		args = append(args, "-s", serverID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	path := st.binaryPath()
+	cmd := exec.CommandContext(ctx, path, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("执行测速命令失败: %w", execError(path, err))
+	}
+
+	result, events := st.readSpeedtestEvents(stdout, newSpeedtestProgress(onProgress, time.Now))
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("执行测速命令超时")
+		}
+		if events == 0 {
+			return nil, errSpeedtestNoProgress
+		}
+		return nil, fmt.Errorf("执行测速命令失败: %w", err)
+	}
+	if events == 0 {
+		return nil, errSpeedtestNoProgress
+	}
+	if result == nil {
+		return nil, fmt.Errorf("解析测速结果失败: 没有收到结果")
+	}
+	return result, nil
+}
+
+// readSpeedtestEvents 逐行读取 jsonl 输出，把进度事件交给progress，返回测速结果和解析到的事件数。
+// 无法解析的行被忽略，没有结果行或结果无法解析时result为nil
+func (st *SpeedTestPlugin) readSpeedtestEvents(r io.Reader, progress *speedtestProgress) (result *SpeedTestResult, events int) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var event speedtestEvent
+		if err := json.Unmarshal(line, &event); err != nil || event.Type == "" {
+			continue
+		}
+		events++
+		if event.Type == "result" {
+			result = &SpeedTestResult{}
+			if err := json.Unmarshal(line, result); err != nil {
+				result = nil
+			}
+			continue
+		}
+		progress.update(st, &event)
+	}
+	return result, events
+}
@@ -0,0 +1,165 @@
+package plugin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// speedtestClock 测速进度测试使用的可调时间
+type speedtestClock struct {
+	now time.Time
+}
+
+func (c *speedtestClock) get() time.Time { return c.now }
+
+func TestSpeedtestProgressThrottle(t *testing.T) {
+	st := NewSpeedTestPlugin()
+	clock := &speedtestClock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	var edits []string
+	p := newSpeedtestProgress(func(text string) { edits = append(edits, text) }, clock.get)
+
+	ping := &speedtestEvent{Type: "ping"}
+	ping.Ping.Latency = 10.25
+	download := &speedtestEvent{Type: "download"}
+	download.Download.Bandwidth, download.Download.Progress = 50000000, 0.4
+	upload := &speedtestEvent{Type: "upload"}
+	upload.Upload.Bandwidth, upload.Upload.Progress = 20000000, 0.25
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		event   *speedtestEvent
+		edit    bool
+	}{
+		{"right after start", time.Second, ping, false},
+		{"interval elapsed", time.Second, ping, true},
+		{"unknown type is ignored", 5 * time.Second, &speedtestEvent{Type: "log"}, false},
+		{"download after interval", 0, download, true},
+		{"within interval", time.Second, download, false},
+		{"same text", 5 * time.Second, download, false},
+		{"upload", 0, upload, true},
+		{"just under interval", 2*time.Second - time.Millisecond, upload, false},
+	}
+	for _, s := range steps {
+		clock.now = clock.now.Add(s.advance)
+		before := len(edits)
+		p.update(st, s.event)
+		if edited := len(edits) > before; edited != s.edit {
+			t.Errorf("%s: edited = %v, want %v", s.name, edited, s.edit)
+		}
+	}
+
+	want := []string{
+		"🚀 正在测速...\n\n延迟: 10.25 ms ⏳\n下载: 等待中\n上传: 等待中",
+		"🚀 正在测速...\n\n延迟: 10.25 ms ✅\n下载: 50.00 Mbps (40%) ⏳\n上传: 等待中",
+		"🚀 正在测速...\n\n延迟: 10.25 ms ✅\n下载: 50.00 Mbps ✅\n上传: 20.00 Mbps (25%) ⏳",
+	}
+	if !reflect.DeepEqual(edits, want) {
+		t.Errorf("edits =\n%q\nwant\n%q", edits, want)
+	}
+}
+
+func TestReadSpeedtestEvents(t *testing.T) {
+	st := NewSpeedTestPlugin()
+	f, err := os.Open(filepath.Join("testdata", "speedtest_progress.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// 每个事件前进3秒，每次都超过节流间隔
+	clock := &speedtestClock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	var edits []string
+	p := newSpeedtestProgress(func(text string) { edits = append(edits, text) }, func() time.Time {
+		clock.now = clock.now.Add(3 * time.Second)
+		return clock.now
+	})
+	result, events := st.readSpeedtestEvents(f, p)
+
+	// 非JSON的行不计入
+	if events != 8 {
+		t.Errorf("events = %d, want 8", events)
+	}
+	if result == nil || result.Download.Bandwidth != 93750000 || result.Upload.Bandwidth != 31250000 ||
+		result.Ping.Latency != 10.25 || result.Server.Name != "Example" || result.Result.URL != "https://www.speedtest.net/result/c/abc" {
+		t.Fatalf("result = %+v", result)
+	}
+	if len(edits) != 6 {
+		t.Fatalf("edits = %d, want one per progress event:\n%q", len(edits), edits)
+	}
+	if last := edits[len(edits)-1]; last != "🚀 正在测速...\n\n延迟: 10.25 ms ✅\n下载: 93.75 Mbps ✅\n上传: 31.25 Mbps (100%) ⏳" {
+		t.Errorf("last edit = %q", last)
+	}
+
+	// 结果行无法解析时没有结果
+	result, events = st.readSpeedtestEvents(strings.NewReader(`{"type":"result","timestamp":5}`), p)
+	if result != nil || events != 1 {
+		t.Errorf("invalid result = %+v, %d events", result, events)
+	}
+}
+
+// fakeSpeedtestCLI 创建输出script内容的假 speedtest CLI，参数写入 args.log
+func fakeSpeedtestCLI(t *testing.T, st *SpeedTestPlugin, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tools are shell scripts")
+	}
+	dir := t.TempDir()
+	st.speedtestPath = filepath.Join(dir, "speedtest")
+	content := "#!/bin/sh\necho \"$@\" > \"" + dir + "/args.log\"\n" + script
+	if err := os.WriteFile(st.speedtestPath, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRunSpeedTestWithProgress(t *testing.T) {
+	fixture, err := filepath.Abs(filepath.Join("testdata", "speedtest_progress.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := NewSpeedTestPlugin()
+	dir := fakeSpeedtestCLI(t, st, "cat \""+fixture+"\"\n")
+
+	result, err := st.runSpeedTestWithProgress("12345", func(string) {})
+	if err != nil || result == nil || result.Download.Bandwidth != 93750000 {
+		t.Fatalf("runSpeedTestWithProgress = %+v, %v", result, err)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args.log"))
+	if got := strings.TrimSpace(string(args)); got != "--accept-license --accept-gdpr -f jsonl --progress=yes -s 12345" {
+		t.Errorf("args = %q", got)
+	}
+}
+
+func TestRunSpeedTestWithProgressErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		// 旧版CLI不支持 jsonl 时回退到一次性输出
+		{"plain output", "echo 'Speedtest by Ookla'\necho 'Download: 100 Mbps'\n", errSpeedtestNoProgress.Error()},
+		{"unknown option", "echo 'unrecognised option' >&2\nexit 1\n", errSpeedtestNoProgress.Error()},
+		{"no result", `echo '{"type":"ping","ping":{"latency":3}}'` + "\n", "解析测速结果失败: 没有收到结果"},
+		{"failed midway", `echo '{"type":"ping","ping":{"latency":3}}'` + "\nexit 3\n", "执行测速命令失败: exit status 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := NewSpeedTestPlugin()
+			fakeSpeedtestCLI(t, st, tt.script)
+			result, err := st.runSpeedTestWithProgress("", func(string) {})
+			if err == nil || err.Error() != tt.want || result != nil {
+				t.Errorf("runSpeedTestWithProgress = %+v, %v; want %q", result, err, tt.want)
+			}
+			if tt.want == errSpeedtestNoProgress.Error() && !errors.Is(err, errSpeedtestNoProgress) {
+				t.Errorf("err = %v, want errSpeedtestNoProgress for the fallback", err)
+			}
+		})
+	}
+}
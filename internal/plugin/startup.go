@@ -0,0 +1,198 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/core"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultInitWorkers 连接后并发初始化插件的数量
+const defaultInitWorkers = 4
+
+// pluginInit 插件的初始化状态。连接后的初始化只执行一次，
+// 后台初始化和命令首次使用时的初始化共用同一个结果
+type pluginInit struct {
+	plugin   PostConnectPlugin
+	once     sync.Once
+	done     chan struct{}
+	err      error
+	duration time.Duration
+}
+
+// PluginInitTiming 插件初始化耗时
+type PluginInitTiming struct {
+	Name        string
+	PreConnect  time.Duration
+	PostConnect time.Duration
+	Pending     bool // 连接后的初始化尚未完成
+	Err         error
+}
+
+// Total 初始化总耗时
+func (t PluginInitTiming) Total() time.Duration {
+	return t.PreConnect + t.PostConnect
+}
+
+// run 执行连接后的初始化
+func (pi *pluginInit) run(ctx context.Context, name string) error {
+	pi.once.Do(func() {
+		start := time.Now()
+		pi.err = pi.plugin.InitializeAfterConnect(ctx)
+		pi.duration = time.Since(start)
+		close(pi.done)
+		if pi.err != nil {
+			logger.Errorf("Plugin %s failed to initialize after connect: %v", name, pi.err)
+		} else {
+			logger.Infof("Plugin %s initialized after connect in %s", name, pi.duration.Round(time.Millisecond))
+		}
+	})
+	return pi.err
+}
+
+// finished 是否已完成连接后的初始化
+func (pi *pluginInit) finished() bool {
+	select {
+	case <-pi.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// StartPostConnectInit 在后台并发执行所有插件连接后的初始化，workers为并发数。
+// 不等待完成，已初始化完成的插件和不需要连接后初始化的插件的命令可以立即使用
+func (gm *GoManager) StartPostConnectInit(ctx context.Context, workers int) {
+	if workers <= 0 {
+		workers = defaultInitWorkers
+	}
+
+	gm.mutex.Lock()
+	gm.initCtx = ctx
+	gm.mutex.Unlock()
+
+	gm.mutex.RLock()
+	names := make([]string, 0, len(gm.inits))
+	for name := range gm.inits {
+		names = append(names, name)
+	}
+	gm.mutex.RUnlock()
+	sort.Strings(names)
+
+	start := time.Now()
+	go func() {
+		sem := make(chan struct{}, workers)
+		var wg sync.WaitGroup
+		for _, name := range names {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(name string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				gm.ensureInitialized(name)
+			}(name)
+		}
+		wg.Wait()
+
+		if gm.startup != nil {
+			gm.startup.Record("post_connect_init", time.Since(start))
+		}
+		logger.Infof("Post-connect initialization of %d plugins finished in %s", len(names), time.Since(start).Round(time.Millisecond))
+	}()
+}
+
+// ensureInitialized 确保插件已完成连接后的初始化，需要时在当前goroutine执行并等待。
+// 初始化使用连接的上下文而不是命令的上下文，避免命令结束时中断初始化
+func (gm *GoManager) ensureInitialized(name string) error {
+	gm.mutex.RLock()
+	pi, ok := gm.inits[name]
+	ctx := gm.initCtx
+	gm.mutex.RUnlock()
+	if !ok {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return pi.run(ctx, name)
+}
+
+// lazyInitHook 命令执行前确保所属插件已完成初始化，初始化失败时否决命令
+func (gm *GoManager) lazyInitHook(hc *core.HookContext) error {
+	name, _ := hc.Data["plugin"].(string)
+	if name == "" {
+		return nil
+	}
+	if err := gm.ensureInitialized(name); err != nil {
+		return core.Veto(fmt.Sprintf("插件 %s 初始化失败: %v", name, err))
+	}
+	return nil
+}
+
+// InitTimings 返回插件初始化耗时，按总耗时从高到低排序
+func (gm *GoManager) InitTimings() []PluginInitTiming {
+	gm.mutex.RLock()
+	defer gm.mutex.RUnlock()
+
+	timings := make([]PluginInitTiming, 0, len(gm.plugins))
+	for name := range gm.plugins {
+		t := PluginInitTiming{Name: name, PreConnect: gm.initTimes[name]}
+		if pi, ok := gm.inits[name]; ok {
+			if pi.finished() {
+				t.PostConnect = pi.duration
+				t.Err = pi.err
+			} else {
+				t.Pending = true
+			}
+		}
+		timings = append(timings, t)
+	}
+	sort.Slice(timings, func(i, j int) bool {
+		if timings[i].Total() != timings[j].Total() {
+			return timings[i].Total() > timings[j].Total()
+		}
+		return timings[i].Name < timings[j].Name
+	})
+	return timings
+}
+
+// SetStartupReport 设置启动耗时报告
+func (gm *GoManager) SetStartupReport(report *core.StartupReport) {
+	gm.startup = report
+}
+
+// GetStartupReport 返回启动耗时报告
+func (gm *GoManager) GetStartupReport() *core.StartupReport {
+	return gm.startup
+}
+
+// formatInitTimings 格式化耗时最长的几个插件的初始化耗时
+func formatInitTimings(timings []PluginInitTiming, limit int) string {
+	var parts []string
+	pending := 0
+	for _, t := range timings {
+		if t.Pending {
+			pending++
+			continue
+		}
+		if len(parts) < limit && t.Total() > 0 {
+			part := fmt.Sprintf("%s %s", t.Name, t.Total().Round(time.Millisecond))
+			if t.Err != nil {
+				part += "(失败)"
+			}
+			parts = append(parts, part)
+		}
+	}
+	line := strings.Join(parts, ", ")
+	if line == "" {
+		line = "无记录"
+	}
+	if pending > 0 {
+		line += fmt.Sprintf(" (%d 个插件初始化中)", pending)
+	}
+	return line
+}
@@ -0,0 +1,276 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// lazyTestPlugin 连接后初始化的测试插件，初始化阻塞到 release 关闭，注册一个与插件同名的命令
+type lazyTestPlugin struct {
+	*BasePlugin
+	release chan struct{}
+	err     error
+	inits   atomic.Int32
+	// running 和 peak 由所有插件共用，记录同时进行的初始化数量
+	running, peak *atomic.Int32
+}
+
+func newLazyTestPlugin(name string, running, peak *atomic.Int32) *lazyTestPlugin {
+	info := &PluginInfo{PluginVersion: &PluginVersion{Name: name, Version: "1.0.0"}, Dir: "builtin", Enabled: true}
+	return &lazyTestPlugin{BasePlugin: NewBasePlugin(info), release: make(chan struct{}), running: running, peak: peak}
+}
+
+func (p *lazyTestPlugin) InitializeAfterConnect(ctx context.Context) error {
+	p.inits.Add(1)
+	n := p.running.Add(1)
+	defer p.running.Add(-1)
+	for {
+		old := p.peak.Load()
+		if n <= old || p.peak.CompareAndSwap(old, n) {
+			break
+		}
+	}
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.err
+}
+
+func (p *lazyTestPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand(p.info.Name, "测试", p.info.Name, func(ctx *command.CommandContext) error {
+		_, err := ctx.Respond(p.info.Name+" ok", format.Plain)
+		return err
+	})
+	return nil
+}
+
+// startupTest 解析器与插件管理器共用钩子，命令执行前会经过 plugin_lazy_init
+type startupTest struct {
+	*testEnv
+	gm            *GoManager
+	running, peak atomic.Int32
+}
+
+func newStartupTest(t *testing.T) *startupTest {
+	t.Helper()
+	inv := &fakeInvoker{}
+	hooks := core.NewHookManager()
+	dispatcher := core.NewEventDispatcher()
+	parser := command.NewParser(".", dispatcher, hooks)
+	parser.SetTelegramAPI(tg.NewClient(inv), peers.NewResolver(fakePeers{}))
+	st := &startupTest{testEnv: &testEnv{inv: inv, parser: parser}}
+	st.gm = NewGoManager(parser, dispatcher, hooks, openPluginDB(t))
+	t.Cleanup(func() { st.gm.Shutdown() })
+	return st
+}
+
+func (st *startupTest) lazy(t *testing.T, name string) *lazyTestPlugin {
+	t.Helper()
+	p := newLazyTestPlugin(name, &st.running, &st.peak)
+	if err := st.gm.RegisterPlugin(p); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		select {
+		case <-p.release:
+		default:
+			close(p.release)
+		}
+	})
+	return p
+}
+
+// pending 返回连接后初始化尚未完成的插件数
+func (st *startupTest) pending() int {
+	n := 0
+	for _, timing := range st.gm.InitTimings() {
+		if timing.Pending {
+			n++
+		}
+	}
+	return n
+}
+
+// waitFor 等待条件成立，超时后失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFirstCommandServedBeforeLazyPluginsFinish(t *testing.T) {
+	st := newStartupTest(t)
+	if err := st.gm.RegisterPlugin(newCapTestPlugin("fast")); err != nil {
+		t.Fatal(err)
+	}
+	slowA, slowB := st.lazy(t, "slow_a"), st.lazy(t, "slow_b")
+
+	start := time.Now()
+	st.gm.StartPostConnectInit(context.Background(), 1)
+	waitFor(t, "background init to start", func() bool { return st.running.Load() == 1 })
+
+	// 慢插件的初始化仍阻塞时，不需要连接后初始化的插件的命令可以立即执行
+	out, err := st.run(nil, "fast")
+	if err != nil || out.Text != "fast ok" {
+		t.Fatalf("fast = %v, %v", out, err)
+	}
+	firstCommand := time.Since(start)
+	if n := st.pending(); n != 2 {
+		t.Fatalf("pending = %d after the first command, want both lazy plugins still initializing", n)
+	}
+	t.Logf("first command served after %s with %d plugins still initializing", firstCommand, st.pending())
+
+	// 慢插件的命令等待自己的初始化完成，不等待其他插件
+	done := make(chan string, 1)
+	go func() {
+		out, err := st.run(nil, "slow_b")
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		done <- out.Text
+	}()
+	select {
+	case got := <-done:
+		t.Fatalf("slow_b finished before its init: %q", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(slowB.release)
+	if got := <-done; got != "slow_b ok" {
+		t.Errorf("slow_b = %q", got)
+	}
+	if n := st.pending(); n != 1 {
+		t.Errorf("pending = %d, want only slow_a", n)
+	}
+
+	close(slowA.release)
+	waitFor(t, "all inits", func() bool { return st.pending() == 0 })
+
+	// 后台初始化和命令触发的初始化共用一次执行
+	for _, p := range []*lazyTestPlugin{slowA, slowB} {
+		if n := p.inits.Load(); n != 1 {
+			t.Errorf("%s initialized %d times, want 1", p.info.Name, n)
+		}
+	}
+	if out, err := st.run(nil, "slow_a"); err != nil || out.Text != "slow_a ok" {
+		t.Errorf("slow_a = %v, %v", out, err)
+	}
+}
+
+func TestPostConnectInitBoundedConcurrency(t *testing.T) {
+	st := newStartupTest(t)
+	st.gm.SetStartupReport(core.NewStartupReport())
+	var plugins []*lazyTestPlugin
+	for i := 0; i < 6; i++ {
+		plugins = append(plugins, st.lazy(t, fmt.Sprintf("lazy_%d", i)))
+	}
+
+	st.gm.StartPostConnectInit(context.Background(), 2)
+	waitFor(t, "two inits running", func() bool { return st.running.Load() == 2 })
+	time.Sleep(20 * time.Millisecond)
+	if n := st.running.Load(); n != 2 {
+		t.Fatalf("running = %d, want at most 2 workers", n)
+	}
+	for _, p := range plugins {
+		close(p.release)
+	}
+	waitFor(t, "all inits", func() bool { return st.pending() == 0 })
+	waitFor(t, "post_connect_init phase", func() bool { return st.gm.GetStartupReport().Has("post_connect_init") })
+	if peak := st.peak.Load(); peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peak)
+	}
+}
+
+func TestLazyInitFailureVetoesCommand(t *testing.T) {
+	st := newStartupTest(t)
+	broken := st.lazy(t, "broken")
+	broken.err = errors.New("boom")
+	close(broken.release)
+
+	// 未启动后台初始化时，首次使用命令触发初始化
+	_, err := st.run(nil, "broken")
+	if err == nil || !strings.Contains(err.Error(), "插件 broken 初始化失败: boom") {
+		t.Fatalf("err = %v, want init failure veto", err)
+	}
+	if n := broken.inits.Load(); n != 1 {
+		t.Errorf("inits = %d, want 1", n)
+	}
+	// 失败也只执行一次，之后的命令直接否决
+	st.run(nil, "broken")
+	if n := broken.inits.Load(); n != 1 {
+		t.Errorf("inits after retry = %d, want 1", n)
+	}
+	timings := st.gm.InitTimings()
+	if len(timings) != 1 || timings[0].Pending || timings[0].Err == nil {
+		t.Errorf("timings = %+v", timings)
+	}
+}
+
+func TestFormatInitTimings(t *testing.T) {
+	timings := []PluginInitTiming{
+		{Name: "autosend", PreConnect: 2 * time.Millisecond, PostConnect: 120 * time.Millisecond},
+		{Name: "vote", PostConnect: 40 * time.Millisecond, Err: errors.New("x")},
+		{Name: "ids", PreConnect: 3 * time.Millisecond},
+		{Name: "idle"},
+		{Name: "pending", Pending: true},
+	}
+	tests := []struct {
+		limit int
+		want  string
+	}{
+		{5, "autosend 122ms, vote 40ms(失败), ids 3ms (1 个插件初始化中)"},
+		{1, "autosend 122ms (1 个插件初始化中)"},
+	}
+	for _, tt := range tests {
+		if got := formatInitTimings(timings, tt.limit); got != tt.want {
+			t.Errorf("limit %d = %q, want %q", tt.limit, got, tt.want)
+		}
+	}
+	if got := formatInitTimings(nil, 5); got != "无记录" {
+		t.Errorf("empty = %q", got)
+	}
+}
+
+func TestInitTimingsOrder(t *testing.T) {
+	st := newStartupTest(t)
+	for _, name := range []string{"b", "a", "c"} {
+		if err := st.gm.RegisterPlugin(newCapTestPlugin(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lazy := st.lazy(t, "e")
+	close(lazy.release)
+	st.gm.ensureInitialized("e")
+
+	st.gm.mutex.Lock()
+	st.gm.initTimes["a"], st.gm.initTimes["b"], st.gm.initTimes["c"], st.gm.initTimes["e"] = 5*time.Millisecond, 5*time.Millisecond, 10*time.Millisecond, 0
+	st.gm.inits["e"].duration = 20 * time.Millisecond
+	st.gm.mutex.Unlock()
+
+	var names []string
+	for _, timing := range st.gm.InitTimings() {
+		names = append(names, timing.Name)
+	}
+	// 按连接前后的总耗时从高到低，相同时按名称排序
+	if got := strings.Join(names, ","); got != "e,c,a,b" {
+		t.Errorf("order = %s, want e,c,a,b", got)
+	}
+}
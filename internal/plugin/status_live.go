@@ -0,0 +1,169 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/flood"
+	"nexusvalet/pkg/logger"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// statusLiveInterval 实时状态的刷新间隔
+	statusLiveInterval = 5 * time.Second
+	// statusLiveMax 实时状态最长的刷新时间
+	statusLiveMax = time.Minute
+)
+
+// handleStatusLive 处理 .status live [秒数]：在同一条消息中定时刷新运行状态，
+// 到时、任务被取消或消息无法编辑(如已被删除)时停止
+func (cp *CoreCommandsPlugin) handleStatusLive(ctx *command.CommandContext, args []string) error {
+	duration := statusLiveMax
+	if len(args) > 0 {
+		seconds, err := strconv.Atoi(args[0])
+		if err != nil || seconds <= 0 {
+			return cp.sendResponse(ctx, "用法: .status live [秒数]，最长 60 秒")
+		}
+		duration = min(time.Duration(seconds)*time.Second, statusLiveMax)
+	}
+
+	goManager, ok := cp.manager.(*GoManager)
+	if !ok {
+		return cp.sendResponse(ctx, "❌ 运行时计数不可用")
+	}
+	metrics := goManager.GetMetrics()
+
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+
+	deadline := time.Now().Add(duration)
+	render := func(stopped bool) string {
+		return cp.formatLiveStatus(metrics.Snapshot(), time.Until(deadline), stopped)
+	}
+
+	// 先显示第一帧，命令消息不可编辑时发送新消息并刷新新消息
+	messageID := ctx.Message.Message.ID
+	edit := func(editCtx context.Context, text string) error {
+		_, err := flood.Call(editCtx, ctx.Flood, ctx.Message.ChatID, func() (tg.UpdatesClass, error) {
+			return ctx.API.MessagesEditMessage(editCtx, &tg.MessagesEditMessageRequest{
+				Peer:    peer,
+				ID:      messageID,
+				Message: text,
+			})
+		})
+		if tg.IsMessageNotModified(err) {
+			return nil
+		}
+		return err
+	}
+	if ctx.Message.Sudo || edit(ctx.Context, render(false)) != nil {
+		updates, err := ctx.SendMessage(&tg.MessagesSendMessageRequest{
+			Peer:     peer,
+			Message:  render(false),
+			RandomID: time.Now().UnixNano(),
+			ReplyTo:  &tg.InputReplyToMessage{ReplyToMsgID: ctx.Message.Message.ID},
+		})
+		if err != nil {
+			return err
+		}
+		if messageID = command.SentMessageID(updates); messageID == 0 {
+			return nil
+		}
+	}
+
+	run := func(taskCtx context.Context, _ core.ProgressFunc) (string, error) {
+		ticker := time.NewTicker(statusLiveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-taskCtx.Done():
+				// 被取消时用独立的上下文显示最终状态
+				finalCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				_ = edit(finalCtx, render(true))
+				return "", nil
+			case now := <-ticker.C:
+				final := !now.Before(deadline)
+				if err := edit(taskCtx, render(final)); err != nil {
+					logger.Ctx(ctx.Context).Debugf("Live status stopped: %v", err)
+					return "", nil
+				}
+				if final {
+					return "", nil
+				}
+			}
+		}
+	}
+
+	runner := goManager.GetTaskRunner()
+	if runner == nil {
+		_, err := run(ctx.Context, func(int, int, string) {})
+		return err
+	}
+	runner.Start(context.Background(), core.TaskOptions{
+		ChatID:  ctx.Message.ChatID,
+		Name:    "status live",
+		Timeout: duration + statusLiveInterval,
+	}, run)
+	return nil
+}
+
+// formatLiveStatus 格式化实时状态。remaining为剩余的刷新时间，stopped为true时显示已停止
+func (cp *CoreCommandsPlugin) formatLiveStatus(snapshot core.MetricsSnapshot, remaining time.Duration, stopped bool) string {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	var b strings.Builder
+	b.WriteString("📈 NexusValet 实时状态\n")
+	b.WriteString(fmt.Sprintf("运行时间: %s\n", cp.formatUptime(time.Since(startTime))))
+	b.WriteString(fmt.Sprintf("Goroutine: %d\n", runtime.NumGoroutine()))
+	b.WriteString(fmt.Sprintf("内存: 堆 %s / 系统 %s\n", formatMemorySize(m.HeapAlloc), formatMemorySize(m.Sys)))
+	b.WriteString(fmt.Sprintf("消息处理: 最近一分钟 %d 条 · 累计 %d 条\n", snapshot.MessagesPerMinute, snapshot.Messages))
+
+	b.WriteString("命令调用:")
+	b.WriteString(formatCounts(snapshot.Commands))
+	if len(snapshot.Counters) > 0 {
+		b.WriteString("\n其他计数:")
+		b.WriteString(formatCounts(snapshot.Counters))
+	}
+
+	if stopped || remaining <= 0 {
+		b.WriteString("\n\n⏹ 已停止刷新")
+	} else {
+		b.WriteString(fmt.Sprintf("\n\n🔴 每 %d 秒刷新，剩余 %d 秒", int(statusLiveInterval.Seconds()), int(remaining.Round(time.Second).Seconds())))
+	}
+	return b.String()
+}
+
+// formatCounts 按次数从多到少列出计数，没有计数时显示"无"
+func formatCounts(counts map[string]int64) string {
+	if len(counts) == 0 {
+		return "\n   • 无"
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(fmt.Sprintf("\n   • %s: %d", name, counts[name]))
+	}
+	return b.String()
+}
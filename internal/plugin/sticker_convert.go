@@ -0,0 +1,160 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"image/png"
+	"nexusvalet/internal/command"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"golang.org/x/image/webp"
+)
+
+// stickerConvertTimeout 转换单个动画贴纸的最长时间
+const stickerConvertTimeout = 60 * time.Second
+
+// stickerConvertOptions .gs 下载贴纸包时的格式转换选项
+type stickerConvertOptions struct {
+	PNG bool // 静态WEBP贴纸转换为PNG
+	GIF bool // 动画TGS贴纸使用配置的转换器转换为GIF
+	// TGSConverter 转换TGS的命令，{input} 和 {output} 替换为文件路径，为空时不转换
+	TGSConverter string
+}
+
+// stickerConvertStats 转换结果统计
+type stickerConvertStats struct {
+	Converted int
+	Failed    int // 转换失败，保留了原文件
+	Skipped   int // 未配置转换器，保留了原文件
+}
+
+// parseStickerConvertFlags 解析 --png/--gif 参数
+func parseStickerConvertFlags(ctx *command.CommandContext) (stickerConvertOptions, error) {
+	var opts stickerConvertOptions
+	for _, name := range ctx.FlagNames() {
+		switch name {
+		case "png":
+			opts.PNG = true
+		case "gif":
+			opts.GIF = true
+		default:
+			return opts, fmt.Errorf("未知参数: --%s", name)
+		}
+	}
+	if len(ctx.Args) > 0 {
+		return opts, fmt.Errorf("未知参数: %s", ctx.Args[0])
+	}
+	return opts, nil
+}
+
+// stickerFileExt 按MIME类型返回贴纸文件的扩展名
+func stickerFileExt(document *tg.Document) string {
+	switch document.MimeType {
+	case "application/x-tgsticker":
+		return "tgs"
+	case "video/webm":
+		return "webm"
+	case "video/mp4":
+		return "mp4"
+	}
+	return "webp"
+}
+
+// convert 按选项转换下载的贴纸，返回最终使用的文件路径。
+// 转换失败时返回原文件路径和错误，原文件保留
+func (o stickerConvertOptions) convert(ctx context.Context, path string, stats *stickerConvertStats) (string, error) {
+	ext := filepath.Ext(path)
+	target := strings.TrimSuffix(path, ext)
+
+	var err error
+	switch {
+	case ext == ".webp" && o.PNG:
+		target += ".png"
+		err = convertWebPToPNG(path, target)
+	case ext == ".tgs" && o.GIF:
+		if o.TGSConverter == "" {
+			stats.Skipped++
+			return path, nil
+		}
+		target += ".gif"
+		err = runStickerConverter(ctx, o.TGSConverter, path, target)
+	default:
+		return path, nil
+	}
+
+	if err != nil {
+		os.Remove(target)
+		stats.Failed++
+		return path, err
+	}
+	os.Remove(path)
+	stats.Converted++
+	return target, nil
+}
+
+// convertWebPToPNG 把静态WEBP图片转换为PNG
+func convertWebPToPNG(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	img, err := webp.Decode(in)
+	if err != nil {
+		return fmt.Errorf("解码WEBP失败: %w", err)
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(out, img); err != nil {
+		out.Close()
+		return fmt.Errorf("编码PNG失败: %w", err)
+	}
+	return out.Close()
+}
+
+// runStickerConverter 执行外部转换命令，命令按空白拆分，不经过shell
+func runStickerConverter(ctx context.Context, template, src, dst string) error {
+	fields := strings.Fields(template)
+	if len(fields) == 0 {
+		return fmt.Errorf("转换命令为空")
+	}
+	for i, field := range fields {
+		field = strings.ReplaceAll(field, "{input}", src)
+		fields[i] = strings.ReplaceAll(field, "{output}", dst)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, stickerConvertTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, fields[0], fields[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	if info, err := os.Stat(dst); err != nil || info.Size() == 0 {
+		return fmt.Errorf("转换命令没有生成 %s", filepath.Base(dst))
+	}
+	return nil
+}
+
+// summary 转换结果的说明，没有转换时返回空字符串
+func (s stickerConvertStats) summary() string {
+	var parts []string
+	if s.Converted > 0 {
+		parts = append(parts, fmt.Sprintf("已转换 %d 个", s.Converted))
+	}
+	if s.Failed > 0 {
+		parts = append(parts, fmt.Sprintf("%d 个转换失败，保留原文件", s.Failed))
+	}
+	if s.Skipped > 0 {
+		parts = append(parts, fmt.Sprintf("%d 个动画贴纸未转换(未配置 media.tgs_converter)", s.Skipped))
+	}
+	return strings.Join(parts, "，")
+}
@@ -2,9 +2,14 @@ package plugin
 
 import (
 	"archive/zip"
+	"context"
+	"database/sql"
 	"fmt"
 	"io"
+	"nexusvalet/internal/capability"
 	"nexusvalet/internal/command"
+	"nexusvalet/internal/download"
+	"nexusvalet/internal/format"
 	"nexusvalet/pkg/logger"
 	"os"
 	"path/filepath"
@@ -17,6 +22,7 @@ import (
 // StickerPlugin 贴纸包下载插件
 type StickerPlugin struct {
 	*BasePlugin
+	db *sql.DB
 }
 
 // StickerSetInfo 贴纸包信息
@@ -27,13 +33,13 @@ type StickerSetInfo struct {
 }
 
 // NewStickerPlugin 创建贴纸插件
-func NewStickerPlugin() *StickerPlugin {
+func NewStickerPlugin(db *sql.DB) *StickerPlugin {
 	info := &PluginInfo{
 		PluginVersion: &PluginVersion{
 			Name:        "sticker",
 			Version:     "1.0.0",
 			Author:      "NexusValet",
-			Description: "获取整个贴纸包的贴纸",
+			Description: "下载整个贴纸包、从压缩包创建贴纸包，或把贴纸添加到自己的贴纸包",
 		},
 		Dir:     "builtin",
 		Enabled: true,
@@ -41,19 +47,109 @@ func NewStickerPlugin() *StickerPlugin {
 
 	return &StickerPlugin{
 		BasePlugin: NewBasePlugin(info),
+		db:         db,
 	}
 }
 
+// Initialize 初始化插件
+func (sp *StickerPlugin) Initialize(ctx context.Context, manager interface{}) error {
+	if err := sp.BasePlugin.Initialize(ctx, manager); err != nil {
+		return err
+	}
+
+	if err := sp.initMakepackDatabase(); err != nil {
+		return fmt.Errorf("failed to initialize makepack database: %w", err)
+	}
+	if err := sp.initKangDatabase(); err != nil {
+		return fmt.Errorf("failed to initialize kang database: %w", err)
+	}
+
+	logger.Infof("Sticker plugin initialized successfully")
+	return nil
+}
+
+// stickerLongHelp .help sticker 显示的详细帮助
+const stickerLongHelp = `🎭 Sticker 贴纸包下载插件详细帮助
+
+🎭 .getstickers / .gs 命令:
+  获取整个贴纸包的贴纸，功能包括:
+  • 📦 下载整个贴纸包的所有贴纸
+  • 🎨 保持贴纸的emoji表情信息
+  • 📁 自动打包为ZIP文件
+  • 🚀 支持多种贴纸格式(webp/tgs/mp4)
+  • 📋 生成pack.txt配置文件
+
+📝 使用方法:
+  • .getstickers - 回复贴纸包中的任意贴纸
+  • .gs - 简写命令，功能同上
+  • .gs --png - 静态贴纸(webp)转换为PNG
+  • .gs --gif - 动画贴纸(tgs)使用配置的 media.tgs_converter 转换为GIF
+
+✨ 功能特色:
+  • 🎯 自动识别贴纸包中的所有贴纸
+  • 🎨 保留每个贴纸对应的emoji表情
+  • 📦 自动打包为ZIP文件便于分享
+  • 🚀 支持静态贴纸(webp)、动画贴纸(tgs)、视频贴纸(mp4)
+  • 📋 生成pack.txt文件，包含贴纸文件名和emoji映射
+  • ⚡ 高效并发下载，快速完成
+
+📋 输出文件:
+  • 贴纸文件: 001.webp, 002.tgs, 003.mp4 等
+  • 配置文件: pack.txt (包含文件名和emoji映射)
+  • 打包文件: 贴纸包名.zip
+  • 使用 --png/--gif 时 pack.txt 中的文件名为转换后的文件，转换失败的贴纸保留原文件
+
+📤 .makepack <短名称> <标题> 命令:
+  回复 .getstickers 生成的压缩包(或任意图片压缩包)，通过 @Stickers 创建新的贴纸包:
+  • 🖼️ PNG/JPEG/GIF 自动缩放为512像素PNG，符合要求的WEBP直接使用
+  • 😀 emoji取自压缩包中的pack.txt，没有对应条目时使用 😀
+  • 📋 所有不符合要求的文件会一次列出，修正后重新执行
+  • 🔁 中断后对同一压缩包再次执行相同命令，从上次成功的贴纸继续
+  • ⛔ 上传过程中可用 .cancel 取消
+
+🦘 .kang [emoji] 命令:
+  回复贴纸或图片，添加到自动管理的个人贴纸包(用户名_pack_1):
+  • 🖼️ 贴纸直接使用原文件，照片和图片缩放为512像素PNG后上传
+  • 😀 未指定emoji时使用贴纸原来的emoji，图片使用 😀
+  • 📦 贴纸包已满时自动创建 用户名_pack_2、用户名_pack_3 …
+
+⚠️ 注意事项:
+  • 需要回复贴纸包中的贴纸
+  • 贴纸必须属于某个贴纸包
+  • 下载过程可能需要一些时间
+  • 大贴纸包可能需要更多时间处理
+  • .makepack 暂不支持动画(tgs)和视频贴纸`
+
 // RegisterCommands 实现CommandPlugin接口
 func (sp *StickerPlugin) RegisterCommands(parser *command.Parser) error {
 	parser.RegisterCommand("getstickers", "获取整个贴纸包的贴纸", sp.info.Name, sp.handleGetStickers)
 	parser.RegisterCommand("gs", "获取整个贴纸包的贴纸(简写)", sp.info.Name, sp.handleGetStickers)
+	parser.RegisterCommand("makepack", "从贴纸压缩包创建新的贴纸包", sp.info.Name, sp.handleMakePack)
+	parser.RegisterCommand("kang", "把回复的贴纸或图片添加到自己的贴纸包，.kang [emoji]", sp.info.Name, sp.handleKang)
+	parser.RegisterLongHelp(sp.info.Name, stickerLongHelp)
 	logger.Infof("Sticker commands registered successfully")
 	return nil
 }
 
+// Capabilities 实现CapabilityPlugin接口，声明下载贴纸、发送媒体、与 @Stickers 对话以及管理贴纸包所需的接口
+func (sp *StickerPlugin) Capabilities() []capability.Requirement {
+	return []capability.Requirement{
+		capability.Require((*tg.Client)(nil), "MessagesGetStickerSet", "UploadGetFile", "MessagesSendMedia",
+			"ContactsResolveUsername", "MessagesGetHistory", "MessagesSendMessage",
+			"MessagesUploadMedia", "StickersCreateStickerSet", "StickersAddStickerToSet"),
+		capability.Require(tg.UploadGetFileRequest{}, "Location", "Offset", "Limit"),
+		capability.Require(tg.MessagesSendMediaRequest{}, "Peer", "Media", "RandomID", "ReplyTo"),
+	}
+}
+
 // handleGetStickers 处理获取贴纸包命令
 func (sp *StickerPlugin) handleGetStickers(ctx *command.CommandContext) error {
+	convert, err := parseStickerConvertFlags(ctx)
+	if err != nil {
+		return sp.sendResponse(ctx, fmt.Sprintf("%v\n\n用法: 回复一张贴纸 .gs [--png] [--gif]", err))
+	}
+	convert.TGSConverter = sp.tgsConverter()
+
 	// 检查是否有回复消息
 	if ctx.Message.Message.ReplyTo == nil {
 		return sp.sendResponse(ctx, "请回复一张贴纸。")
@@ -105,7 +201,7 @@ func (sp *StickerPlugin) handleGetStickers(ctx *command.CommandContext) error {
 	}
 
 	// 下载贴纸包
-	return sp.downloadStickerSet(ctx, stickerSetInfo)
+	return sp.downloadStickerSet(ctx, stickerSetInfo, convert)
 }
 
 // getReplyMessage 获取回复的消息
@@ -234,8 +330,8 @@ func (sp *StickerPlugin) getStickerSetInfo(ctx *command.CommandContext, stickerS
 	}, nil
 }
 
-// downloadStickerSet 下载贴纸包
-func (sp *StickerPlugin) downloadStickerSet(ctx *command.CommandContext, stickerSetInfo *StickerSetInfo) error {
+// downloadStickerSet 下载贴纸包。单个贴纸格式转换失败时记录日志并保留原文件，不中止整个贴纸包
+func (sp *StickerPlugin) downloadStickerSet(ctx *command.CommandContext, stickerSetInfo *StickerSetInfo, convert stickerConvertOptions) error {
 	// 创建临时目录
 	tempDir := filepath.Join(os.TempDir(), "sticker_download", stickerSetInfo.Set.ShortName)
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
@@ -258,25 +354,10 @@ func (sp *StickerPlugin) downloadStickerSet(ctx *command.CommandContext, sticker
 	}
 
 	// 下载所有贴纸
+	var stats stickerConvertStats
 	for i, document := range stickerSetInfo.Documents {
-		// 确定文件扩展名
-		ext := "webp"
-		for _, attr := range document.Attributes {
-			if stickerAttr, ok := attr.(*tg.DocumentAttributeSticker); ok {
-				if stickerAttr.Mask {
-					// 这是动画贴纸
-					ext = "tgs"
-				}
-			}
-		}
-
-		// 检查是否是视频贴纸
-		if document.MimeType == "video/mp4" {
-			ext = "mp4"
-		}
-
 		// 下载贴纸
-		filename := fmt.Sprintf("%03d.%s", i, ext)
+		filename := fmt.Sprintf("%03d.%s", i, stickerFileExt(document))
 		filePath := filepath.Join(tempDir, filename)
 
 		if err := sp.downloadSticker(ctx, document, filePath); err != nil {
@@ -284,6 +365,13 @@ func (sp *StickerPlugin) downloadStickerSet(ctx *command.CommandContext, sticker
 			continue
 		}
 
+		// 按参数转换格式，pack.txt 中使用转换后的文件名
+		converted, err := convert.convert(ctx.Context, filePath, &stats)
+		if err != nil {
+			logger.Warnf("转换贴纸 %s 失败，保留原文件: %v", filename, err)
+		}
+		filename = filepath.Base(converted)
+
 		// 写入pack.txt文件
 		packFile := filepath.Join(tempDir, "pack.txt")
 		emoji := emojiMap[document.ID]
@@ -298,7 +386,11 @@ func (sp *StickerPlugin) downloadStickerSet(ctx *command.CommandContext, sticker
 	}
 
 	// 打包并上传
-	return sp.packageAndUpload(ctx, tempDir, stickerSetInfo.Set.ShortName)
+	caption := stickerSetInfo.Set.ShortName
+	if summary := stats.summary(); summary != "" {
+		caption += "\n" + summary
+	}
+	return sp.packageAndUpload(ctx, tempDir, stickerSetInfo.Set.ShortName, caption)
 }
 
 // downloadSticker 下载单个贴纸
@@ -310,40 +402,14 @@ func (sp *StickerPlugin) downloadSticker(ctx *command.CommandContext, document *
 	}
 	defer file.Close()
 
-	// 使用gotd API下载文件
 	location := &tg.InputDocumentFileLocation{
 		ID:            document.ID,
 		AccessHash:    document.AccessHash,
 		FileReference: document.FileReference,
 	}
-
-	const chunkSize = 512 * 1024 // 512KB chunks
-	offset := int64(0)
-
-	for {
-		resp, err := ctx.API.UploadGetFile(ctx.Context, &tg.UploadGetFileRequest{
-			Location: location,
-			Offset:   offset,
-			Limit:    chunkSize,
-		})
-		if err != nil {
-			return fmt.Errorf("下载文件失败: %w", err)
-		}
-
-		if fileResp, ok := resp.(*tg.UploadFile); ok {
-			if _, err := file.Write(fileResp.Bytes); err != nil {
-				return fmt.Errorf("写入文件失败: %w", err)
-			}
-
-			if len(fileResp.Bytes) < chunkSize {
-				break // 最后一块
-			}
-			offset += int64(len(fileResp.Bytes))
-		} else {
-			return fmt.Errorf("意外的响应类型")
-		}
+	if _, err := downloadFile(ctx, location, file, download.Options{Size: document.Size}); err != nil {
+		return fmt.Errorf("下载文件失败: %w", err)
 	}
-
 	return nil
 }
 
@@ -360,7 +426,7 @@ func (sp *StickerPlugin) appendToFile(filepath, content string) error {
 }
 
 // packageAndUpload 打包并上传
-func (sp *StickerPlugin) packageAndUpload(ctx *command.CommandContext, tempDir, setName string) error {
+func (sp *StickerPlugin) packageAndUpload(ctx *command.CommandContext, tempDir, setName, caption string) error {
 	// 更新状态消息
 	if err := sp.sendResponse(ctx, "下载完毕，打包上传中。"); err != nil {
 		logger.Warnf("发送状态消息失败: %v", err)
@@ -388,7 +454,7 @@ func (sp *StickerPlugin) packageAndUpload(ctx *command.CommandContext, tempDir,
 	zipFile.Close()
 
 	// 上传ZIP文件
-	err = sp.uploadZipFile(ctx, zipPath, setName)
+	err = sp.uploadZipFile(ctx, zipPath, setName, caption)
 
 	// 上传完成后删除临时文件
 	os.Remove(zipPath)
@@ -436,7 +502,7 @@ func (sp *StickerPlugin) addFilesToZip(zipWriter *zip.Writer, basePath, zipPath
 }
 
 // uploadZipFile 上传ZIP文件
-func (sp *StickerPlugin) uploadZipFile(ctx *command.CommandContext, zipPath, setName string) error {
+func (sp *StickerPlugin) uploadZipFile(ctx *command.CommandContext, zipPath, setName, caption string) error {
 	// 获取peer
 	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
 	if err != nil {
@@ -448,6 +514,9 @@ func (sp *StickerPlugin) uploadZipFile(ctx *command.CommandContext, zipPath, set
 	if err != nil {
 		return fmt.Errorf("读取ZIP文件失败: %w", err)
 	}
+	if err := checkUploadSize(int64(len(zipData))); err != nil {
+		return err
+	}
 
 	// 使用uploader上传文件
 	uploader := uploader.NewUploader(ctx.API)
@@ -468,7 +537,7 @@ func (sp *StickerPlugin) uploadZipFile(ctx *command.CommandContext, zipPath, set
 				},
 			},
 		},
-		Message:  setName,
+		Message:  caption,
 		RandomID: time.Now().UnixNano(),
 		ReplyTo: &tg.InputReplyToMessage{
 			ReplyToMsgID: ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader).ReplyToMsgID,
@@ -490,36 +559,18 @@ func (sp *StickerPlugin) uploadZipFile(ctx *command.CommandContext, zipPath, set
 	return nil
 }
 
-// sendResponse 发送响应消息
-func (sp *StickerPlugin) sendResponse(ctx *command.CommandContext, message string) error {
-	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
-	if err != nil {
-		return fmt.Errorf("解析peer失败: %w", err)
-	}
-
-	if ctx.Message.ChatID > 0 {
-		// 私聊：编辑消息
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: message,
-		})
-		return err
-	} else {
-		// 群聊：先尝试编辑
-		_, err = ctx.API.MessagesEditMessage(ctx.Context, &tg.MessagesEditMessageRequest{
-			Peer:    peer,
-			ID:      ctx.Message.Message.ID,
-			Message: message,
-		})
-		if err != nil {
-			// 编辑失败，发送新消息
-			_, err = ctx.API.MessagesSendMessage(ctx.Context, &tg.MessagesSendMessageRequest{
-				Peer:     peer,
-				Message:  message,
-				RandomID: time.Now().UnixNano(),
-			})
+// tgsConverter 返回配置的TGS转换命令
+func (sp *StickerPlugin) tgsConverter() string {
+	if goManager, ok := sp.manager.(*GoManager); ok {
+		if cfg := goManager.GetConfig(); cfg != nil {
+			return cfg.Media.TGSConverter
 		}
-		return err
 	}
+	return ""
+}
+
+// sendResponse 发送响应消息，命令消息不可编辑时回复命令消息
+func (sp *StickerPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
 }
@@ -0,0 +1,412 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// storyWatch 关注动态的用户
+type storyWatch struct {
+	UserID       int64
+	Username     string
+	LastNotified string // 最近一次通知的日期(本地时间 2006-01-02)，用于每日去重
+}
+
+// StoryPlugin 动态(Stories)插件，关注用户发布新动态时通知到收藏夹
+type StoryPlugin struct {
+	*BasePlugin
+	db          *sql.DB
+	telegramAPI *tg.Client
+	watches     map[int64]*storyWatch
+	mutex       sync.Mutex
+
+	now func() time.Time
+}
+
+// NewStoryPlugin 创建动态插件
+func NewStoryPlugin(db *sql.DB) *StoryPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "story",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "关注用户的动态(Stories)并查看动态信息",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &StoryPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+		watches:    make(map[int64]*storyWatch),
+		now:        time.Now,
+	}
+}
+
+// Initialize 初始化插件
+func (sp *StoryPlugin) Initialize(ctx context.Context, manager interface{}) error {
+	if err := sp.BasePlugin.Initialize(ctx, manager); err != nil {
+		return err
+	}
+
+	if err := sp.initDatabase(); err != nil {
+		return fmt.Errorf("failed to initialize story database: %w", err)
+	}
+	if err := sp.loadWatches(); err != nil {
+		return fmt.Errorf("failed to load story watches: %w", err)
+	}
+
+	logger.Infof("Story plugin initialized successfully")
+	return nil
+}
+
+// SetTelegramClient 设置Telegram客户端
+func (sp *StoryPlugin) SetTelegramClient(client *tg.Client) {
+	sp.telegramAPI = client
+}
+
+// initDatabase 创建关注列表表
+func (sp *StoryPlugin) initDatabase() error {
+	_, err := sp.db.Exec(`
+	CREATE TABLE IF NOT EXISTS story_watches (
+		user_id INTEGER PRIMARY KEY,
+		username TEXT NOT NULL DEFAULT '',
+		last_notified TEXT NOT NULL DEFAULT '',
+		created INTEGER NOT NULL
+	)`)
+	return err
+}
+
+// loadWatches 加载关注列表
+func (sp *StoryPlugin) loadWatches() error {
+	rows, err := sp.db.Query("SELECT user_id, username, last_notified FROM story_watches")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	for rows.Next() {
+		w := &storyWatch{}
+		if err := rows.Scan(&w.UserID, &w.Username, &w.LastNotified); err != nil {
+			return err
+		}
+		sp.watches[w.UserID] = w
+	}
+	return rows.Err()
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (sp *StoryPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("storywatch", "关注用户的动态：add|del <用户> | list", sp.info.Name, sp.handleStoryWatch)
+	parser.RegisterCommand("storyinfo", "回复分享的动态，显示动态信息", sp.info.Name, sp.handleStoryInfo)
+	logger.Infof("Story commands registered successfully")
+	return nil
+}
+
+// RegisterEventHandlers 实现EventPlugin接口
+func (sp *StoryPlugin) RegisterEventHandlers(dispatcher *core.EventDispatcher) error {
+	dispatcher.RegisterStoryListener("story_watch", sp.onStory, 0)
+	return nil
+}
+
+// onStory 关注的用户发布新动态时通知到收藏夹，每个用户每天最多通知一次
+func (sp *StoryPlugin) onStory(ctx context.Context, event interface{}) error {
+	storyEvent, ok := event.(*core.StoryEvent)
+	if !ok || storyEvent.Deleted || storyEvent.Mention {
+		return nil
+	}
+
+	w, notify := sp.markNotified(storyEvent.AuthorID)
+	if !notify || sp.telegramAPI == nil {
+		return nil
+	}
+
+	_, err := sp.telegramAPI.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+		Peer:     &tg.InputPeerSelf{},
+		Message:  formatStoryNotice(w, storyEvent),
+		RandomID: time.Now().UnixNano(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send story notice: %w", err)
+	}
+	return nil
+}
+
+// markNotified 判断是否需要通知关注用户的新动态，需要时记录今天已通知
+func (sp *StoryPlugin) markNotified(userID int64) (storyWatch, bool) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	w, ok := sp.watches[userID]
+	if !ok {
+		return storyWatch{}, false
+	}
+	today := sp.now().Format("2006-01-02")
+	if w.LastNotified == today {
+		return *w, false
+	}
+	w.LastNotified = today
+	if _, err := sp.db.Exec("UPDATE story_watches SET last_notified = ? WHERE user_id = ?", today, userID); err != nil {
+		logger.Errorf("Failed to save story notice date: %v", err)
+	}
+	return *w, true
+}
+
+// formatStoryNotice 格式化新动态通知
+func formatStoryNotice(w storyWatch, event *core.StoryEvent) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("📖 %s 发布了新动态 #%d", storyWatchName(w), event.StoryID))
+	if event.HasMedia() {
+		b.WriteString(fmt.Sprintf("\n类型: %s", event.MediaType))
+	}
+	if !event.Expires.IsZero() && event.Expires.Unix() > 0 {
+		b.WriteString(fmt.Sprintf("\n过期时间: %s", event.Expires.Format("2006-01-02 15:04:05")))
+	}
+	if w.Username != "" {
+		b.WriteString(fmt.Sprintf("\nhttps://t.me/%s/s/%d", w.Username, event.StoryID))
+	}
+	return b.String()
+}
+
+// storyWatchName 返回关注用户的显示名称
+func storyWatchName(w storyWatch) string {
+	if w.Username != "" {
+		return "@" + w.Username
+	}
+	return strconv.FormatInt(w.UserID, 10)
+}
+
+// handleStoryWatch 处理storywatch命令
+func (sp *StoryPlugin) handleStoryWatch(ctx *command.CommandContext) error {
+	if len(ctx.Args) == 0 {
+		return sp.sendResponse(ctx, sp.usage())
+	}
+
+	switch ctx.Args[0] {
+	case "add":
+		if len(ctx.Args) < 2 {
+			return sp.sendResponse(ctx, "用法: .storywatch add <@用户名|用户ID>")
+		}
+		w, err := sp.resolveWatch(ctx, ctx.Args[1])
+		if err != nil {
+			return sp.sendResponse(ctx, fmt.Sprintf("❌ 无法解析用户: %v", err))
+		}
+		if _, err := sp.db.Exec("INSERT OR REPLACE INTO story_watches (user_id, username, last_notified, created) VALUES (?, ?, '', ?)",
+			w.UserID, w.Username, time.Now().Unix()); err != nil {
+			return sp.sendResponse(ctx, fmt.Sprintf("❌ 保存失败: %v", err))
+		}
+		sp.mutex.Lock()
+		sp.watches[w.UserID] = w
+		sp.mutex.Unlock()
+		return sp.sendResponse(ctx, fmt.Sprintf("✅ 已关注 %s 的动态，新动态将通知到收藏夹", storyWatchName(*w)))
+	case "del", "rm":
+		if len(ctx.Args) < 2 {
+			return sp.sendResponse(ctx, "用法: .storywatch del <@用户名|用户ID>")
+		}
+		userID, ok := sp.findWatch(ctx.Args[1])
+		if !ok {
+			return sp.sendResponse(ctx, fmt.Sprintf("未关注 %s", ctx.Args[1]))
+		}
+		if _, err := sp.db.Exec("DELETE FROM story_watches WHERE user_id = ?", userID); err != nil {
+			return sp.sendResponse(ctx, fmt.Sprintf("❌ 删除失败: %v", err))
+		}
+		sp.mutex.Lock()
+		delete(sp.watches, userID)
+		sp.mutex.Unlock()
+		return sp.sendResponse(ctx, fmt.Sprintf("✅ 已取消关注 %s", ctx.Args[1]))
+	case "list", "ls":
+		return sp.sendResponse(ctx, sp.formatWatches())
+	default:
+		return sp.sendResponse(ctx, sp.usage())
+	}
+}
+
+// resolveWatch 将参数解析为关注记录，支持 @用户名 和用户ID
+func (sp *StoryPlugin) resolveWatch(ctx *command.CommandContext, arg string) (*storyWatch, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		if id <= 0 {
+			return nil, fmt.Errorf("只能关注用户")
+		}
+		return &storyWatch{UserID: id}, nil
+	}
+
+	resolved, err := resolveUsername(ctx.Context, ctx.API, arg)
+	if err != nil {
+		return nil, err
+	}
+	peerUser, ok := resolved.Peer.(*tg.PeerUser)
+	if !ok {
+		return nil, fmt.Errorf("只能关注用户")
+	}
+	w := &storyWatch{UserID: peerUser.UserID, Username: strings.TrimPrefix(arg, "@")}
+	for _, u := range resolved.Users {
+		if user, ok := u.(*tg.User); ok && user.ID == peerUser.UserID && user.Username != "" {
+			w.Username = user.Username
+		}
+	}
+	return w, nil
+}
+
+// findWatch 按用户ID或用户名查找关注记录
+func (sp *StoryPlugin) findWatch(arg string) (int64, bool) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		_, ok := sp.watches[id]
+		return id, ok
+	}
+	name := strings.ToLower(strings.TrimPrefix(arg, "@"))
+	for id, w := range sp.watches {
+		if strings.ToLower(w.Username) == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// formatWatches 格式化关注列表
+func (sp *StoryPlugin) formatWatches() string {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	if len(sp.watches) == 0 {
+		return "没有关注任何用户的动态"
+	}
+	ids := make([]int64, 0, len(sp.watches))
+	for id := range sp.watches {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("📖 关注的动态 (%d):\n", len(ids)))
+	for _, id := range ids {
+		w := sp.watches[id]
+		line := fmt.Sprintf("\n• %s", storyWatchName(*w))
+		if w.Username != "" {
+			line += fmt.Sprintf(" (%d)", w.UserID)
+		}
+		if w.LastNotified != "" {
+			line += fmt.Sprintf(" - 最近通知 %s", w.LastNotified)
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// handleStoryInfo 处理storyinfo命令，显示被回复的动态分享消息中的动态信息
+func (sp *StoryPlugin) handleStoryInfo(ctx *command.CommandContext) error {
+	msg, err := fetchReplyMessage(ctx)
+	if err != nil {
+		return sp.sendResponse(ctx, "❌ 请回复一条分享动态的消息")
+	}
+	media, ok := msg.Media.(*tg.MessageMediaStory)
+	if !ok {
+		return sp.sendResponse(ctx, "❌ 被回复的消息不是动态")
+	}
+
+	authorID := peerToChatID(media.Peer)
+	event := &core.StoryEvent{StoryID: media.ID}
+	item, hasItem := media.GetStory()
+	if !hasItem {
+		item, hasItem = sp.fetchStory(ctx, authorID, media.ID)
+	}
+	if hasItem {
+		if parsed := core.StoryFromItem(item); parsed != nil {
+			event = parsed
+		}
+	}
+	event.AuthorID = authorID
+	event.Mention = media.ViaMention
+
+	return sp.sendResponse(ctx, formatStoryInfo(event, hasItem))
+}
+
+// fetchStory 消息中没有附带动态内容时向服务器查询
+func (sp *StoryPlugin) fetchStory(ctx *command.CommandContext, authorID int64, storyID int) (tg.StoryItemClass, bool) {
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, authorID)
+	if err != nil {
+		logger.Debugf("Failed to resolve story author %d: %v", authorID, err)
+		return nil, false
+	}
+	stories, err := ctx.API.StoriesGetStoriesByID(ctx.Context, &tg.StoriesGetStoriesByIDRequest{
+		Peer: peer,
+		ID:   []int{storyID},
+	})
+	if err != nil || len(stories.Stories) == 0 {
+		logger.Debugf("Failed to get story %d of %d: %v", storyID, authorID, err)
+		return nil, false
+	}
+	return stories.Stories[0], true
+}
+
+// formatStoryInfo 格式化动态信息
+func formatStoryInfo(event *core.StoryEvent, known bool) string {
+	var b strings.Builder
+	b.WriteString("📖 动态信息\n")
+	b.WriteString(fmt.Sprintf("\n发布者ID: %d", event.AuthorID))
+	b.WriteString(fmt.Sprintf("\n动态ID: %d", event.StoryID))
+	if event.Mention {
+		b.WriteString("\n来源: 提及了您")
+	}
+	switch {
+	case !known:
+		b.WriteString("\n无法获取动态内容(可能已过期或无权查看)")
+	case event.Deleted:
+		b.WriteString("\n状态: 已删除")
+	default:
+		if event.HasMedia() {
+			b.WriteString(fmt.Sprintf("\n类型: %s", event.MediaType))
+		}
+		if event.Date.Unix() > 0 {
+			b.WriteString(fmt.Sprintf("\n发布时间: %s", event.Date.Format("2006-01-02 15:04:05")))
+		}
+		if event.Expires.Unix() > 0 {
+			state := "有效"
+			if time.Now().After(event.Expires) {
+				state = "已过期"
+			}
+			b.WriteString(fmt.Sprintf("\n过期时间: %s (%s)", event.Expires.Format("2006-01-02 15:04:05"), state))
+		}
+		if event.Item != nil {
+			if event.Item.Pinned {
+				b.WriteString("\n已置顶到主页")
+			}
+			if event.Item.Caption != "" {
+				b.WriteString("\n说明: " + event.Item.Caption)
+			}
+		}
+	}
+	return b.String()
+}
+
+// usage 返回用法说明
+func (sp *StoryPlugin) usage() string {
+	return `用法:
+• .storywatch add <@用户名|用户ID> - 关注用户的动态，新动态通知到收藏夹(每人每天一次)
+• .storywatch del <@用户名|用户ID> - 取消关注
+• .storywatch list - 查看关注列表
+• .storyinfo - 回复分享的动态，显示动态信息`
+}
+
+// sendResponse 发送响应消息
+func (sp *StoryPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,231 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"nexusvalet/internal/core"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// storyTest 注册了动态插件的测试环境，动态事件经由 dispatcher 分发
+type storyTest struct {
+	*testEnv
+	sp         *StoryPlugin
+	dispatcher *core.EventDispatcher
+	now        time.Time
+}
+
+// newStoryTest 在db上创建动态插件。@alice 解析为用户7，@news 解析为频道
+func newStoryTest(t *testing.T, db *sql.DB) *storyTest {
+	t.Helper()
+	st := &storyTest{testEnv: newTestEnv(), dispatcher: core.NewEventDispatcher(), now: time.Date(2026, 10, 14, 9, 0, 0, 0, time.Local)}
+	st.inv.handle = func(input bin.Encoder, output bin.Decoder) error {
+		switch req := input.(type) {
+		case *tg.ContactsResolveUsernameRequest:
+			resolved := output.(*tg.ContactsResolvedPeer)
+			switch strings.ToLower(req.Username) {
+			case "alice":
+				*resolved = tg.ContactsResolvedPeer{Peer: &tg.PeerUser{UserID: 7}, Users: []tg.UserClass{&tg.User{ID: 7, Username: "Alice"}}}
+			case "news":
+				*resolved = tg.ContactsResolvedPeer{Peer: &tg.PeerChannel{ChannelID: 5}}
+			default:
+				return tgerr.New(400, "USERNAME_NOT_OCCUPIED")
+			}
+			return nil
+		}
+		return errUnhandled
+	}
+	usernameMisses.Clear()
+	t.Cleanup(usernameMisses.Clear)
+
+	gm := NewGoManager(st.parser, st.dispatcher, core.NewHookManager(), db)
+	t.Cleanup(func() { gm.Shutdown() })
+	st.sp = NewStoryPlugin(db)
+	st.sp.now = func() time.Time { return st.now }
+	if err := gm.RegisterPlugin(st.sp); err != nil {
+		t.Fatal(err)
+	}
+	st.sp.SetTelegramClient(tg.NewClient(st.inv))
+	return st
+}
+
+// command 执行命令并返回响应
+func (st *storyTest) command(t *testing.T, text string) string {
+	t.Helper()
+	return st.runText(t, nil, text)
+}
+
+// publish 分发关注用户发布动态的更新，返回发往收藏夹的通知
+func (st *storyTest) publish(t *testing.T, update tg.UpdateClass) []string {
+	t.Helper()
+	before := len(requests[*tg.MessagesSendMessageRequest](st.inv))
+	if event, ok := core.ParseStoryUpdate(update); ok {
+		if err := st.dispatcher.DispatchStory(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var notices []string
+	for _, req := range requests[*tg.MessagesSendMessageRequest](st.inv)[before:] {
+		if _, ok := req.Peer.(*tg.InputPeerSelf); !ok {
+			t.Errorf("notice sent to %v, want Saved Messages", req.Peer)
+		}
+		notices = append(notices, req.Message)
+	}
+	return notices
+}
+
+func newStory(userID int64, storyID int) *tg.UpdateStory {
+	return &tg.UpdateStory{Peer: &tg.PeerUser{UserID: userID}, Story: &tg.StoryItem{
+		ID: storyID, Media: &tg.MessageMediaPhoto{},
+		ExpireDate: int(time.Date(2026, 10, 15, 9, 0, 0, 0, time.Local).Unix()),
+	}}
+}
+
+func TestStoryWatchCommands(t *testing.T) {
+	st := newStoryTest(t, openPluginDB(t))
+	tests := []struct {
+		command, want string
+	}{
+		{"storywatch list", "没有关注任何用户的动态"},
+		{"storywatch add", "用法: .storywatch add <@用户名|用户ID>"},
+		{"storywatch add @alice", "✅ 已关注 @Alice 的动态，新动态将通知到收藏夹"},
+		{"storywatch add 42", "✅ 已关注 42 的动态，新动态将通知到收藏夹"},
+		{"storywatch add -100", "❌ 无法解析用户: 只能关注用户"},
+		{"storywatch add @news", "❌ 无法解析用户: 只能关注用户"},
+		{"storywatch add @ghost", "❌ 无法解析用户: rpc error code 400: USERNAME_NOT_OCCUPIED"},
+		{"storywatch list", "📖 关注的动态 (2):\n\n• @Alice (7)\n• 42"},
+		{"storywatch del ALICE", "✅ 已取消关注 ALICE"},
+		{"storywatch del @bob", "未关注 @bob"},
+		{"storywatch rm 42", "✅ 已取消关注 42"},
+		{"storywatch ls", "没有关注任何用户的动态"},
+	}
+	for _, tt := range tests {
+		if got := st.command(t, tt.command); got != tt.want {
+			t.Errorf("%s =\n%s\nwant\n%s", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestStoryWatchNotifiesOncePerDay(t *testing.T) {
+	db := openPluginDB(t)
+	st := newStoryTest(t, db)
+	st.command(t, "storywatch add @alice")
+
+	notices := st.publish(t, newStory(7, 1))
+	want := "📖 @Alice 发布了新动态 #1\n类型: photo\n过期时间: 2026-10-15 09:00:00\nhttps://t.me/Alice/s/1"
+	if len(notices) != 1 || notices[0] != want {
+		t.Fatalf("notices = %q, want %q", notices, want)
+	}
+
+	// 同一天的其他动态、未关注的用户、删除和提及都不通知
+	for _, update := range []tg.UpdateClass{
+		newStory(7, 2),
+		newStory(8, 3),
+		&tg.UpdateStory{Peer: &tg.PeerUser{UserID: 7}, Story: &tg.StoryItemDeleted{ID: 1}},
+		&tg.UpdateNewMessage{Message: &tg.Message{ID: 50, Media: &tg.MessageMediaStory{ViaMention: true, Peer: &tg.PeerUser{UserID: 7}, ID: 4}}},
+	} {
+		if notices := st.publish(t, update); len(notices) != 0 {
+			t.Errorf("%T: unexpected notices %q", update, notices)
+		}
+	}
+	if got := st.command(t, "storywatch list"); got != "📖 关注的动态 (1):\n\n• @Alice (7) - 最近通知 2026-10-14" {
+		t.Errorf("list = %q", got)
+	}
+
+	// 去重日期持久化，重启后当天仍不重复通知，次日再次通知
+	restarted := newStoryTest(t, db)
+	restarted.now = st.now.Add(10 * time.Hour)
+	if notices := restarted.publish(t, newStory(7, 5)); len(notices) != 0 {
+		t.Errorf("notices after restart = %q, want none on the same day", notices)
+	}
+	restarted.now = st.now.Add(24 * time.Hour)
+	if notices := restarted.publish(t, newStory(7, 6)); len(notices) != 1 || !strings.HasPrefix(notices[0], "📖 @Alice 发布了新动态 #6") {
+		t.Errorf("next day notices = %q", notices)
+	}
+}
+
+func TestStoryNoticeWithoutMedia(t *testing.T) {
+	st := newStoryTest(t, openPluginDB(t))
+	st.command(t, "storywatch add 42")
+	notices := st.publish(t, &tg.UpdateStory{Peer: &tg.PeerUser{UserID: 42}, Story: &tg.StoryItemSkipped{ID: 3}})
+	if len(notices) != 1 || notices[0] != "📖 42 发布了新动态 #3" {
+		t.Errorf("notices = %q", notices)
+	}
+}
+
+func TestStoryInfo(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	posted := time.Date(2026, 10, 14, 8, 0, 0, 0, time.Local)
+	item := &tg.StoryItem{ID: 9, Date: int(posted.Unix()), ExpireDate: int(expires.Unix()), Media: &tg.MessageMediaPhoto{}, Pinned: true, Caption: "早安"}
+	withStory := &tg.MessageMediaStory{Peer: &tg.PeerUser{UserID: 7}, ID: 9}
+	withStory.SetStory(item)
+	replies := map[int]tg.MessageMediaClass{
+		20: withStory,
+		21: &tg.MessageMediaStory{Peer: &tg.PeerUser{UserID: 7}, ID: 9, ViaMention: true},
+		22: &tg.MessageMediaStory{Peer: &tg.PeerUser{UserID: 8}, ID: 10},
+		23: &tg.MessageMediaPhoto{},
+	}
+
+	st := newStoryTest(t, openPluginDB(t))
+	st.inv.handle = func(input bin.Encoder, output bin.Decoder) error {
+		switch req := input.(type) {
+		case *tg.MessagesGetMessagesRequest:
+			id := req.ID[0].(*tg.InputMessageID).ID
+			var msgs []tg.MessageClass
+			if media, ok := replies[id]; ok {
+				msgs = append(msgs, &tg.Message{ID: id, Media: media})
+			}
+			output.(*tg.MessagesMessagesBox).Messages = &tg.MessagesMessages{Messages: msgs}
+			return nil
+		case *tg.StoriesGetStoriesByIDRequest:
+			// 消息中没有附带内容时按ID查询，用户8的动态已过期
+			stories := output.(*tg.StoriesStories)
+			if req.Peer.(*tg.InputPeerUser).UserID == 7 {
+				stories.Stories = []tg.StoryItemClass{item}
+			}
+			return nil
+		}
+		return errUnhandled
+	}
+
+	info := "📖 动态信息\n\n发布者ID: 7\n动态ID: 9"
+	details := "\n类型: photo\n发布时间: 2026-10-14 08:00:00\n过期时间: " + expires.Format("2006-01-02 15:04:05") + " (有效)\n已置顶到主页\n说明: 早安"
+	tests := []struct {
+		reply int
+		want  string
+	}{
+		{20, info + details},
+		{21, info + "\n来源: 提及了您" + details},
+		{22, "📖 动态信息\n\n发布者ID: 8\n动态ID: 10\n无法获取动态内容(可能已过期或无权查看)"},
+		{23, "❌ 被回复的消息不是动态"},
+		{0, "❌ 请回复一条分享动态的消息"},
+	}
+	for _, tt := range tests {
+		msg := &tg.Message{ID: 10}
+		if tt.reply != 0 {
+			msg.ReplyTo = &tg.MessageReplyHeader{ReplyToMsgID: tt.reply}
+		}
+		if got := st.runText(t, &core.MessageEvent{ChatID: -100, UserID: 1, Message: msg}, "storyinfo"); got != tt.want {
+			t.Errorf("reply %d =\n%s\nwant\n%s", tt.reply, got, tt.want)
+		}
+	}
+	if n := len(requests[*tg.StoriesGetStoriesByIDRequest](st.inv)); n != 2 {
+		t.Errorf("GetStoriesByID called %d times, want 2", n)
+	}
+}
+
+func TestFormatStoryInfoDeletedAndExpired(t *testing.T) {
+	if got := formatStoryInfo(&core.StoryEvent{AuthorID: 7, StoryID: 1, Deleted: true}, true); got != "📖 动态信息\n\n发布者ID: 7\n动态ID: 1\n状态: 已删除" {
+		t.Errorf("deleted = %q", got)
+	}
+	expired := &core.StoryEvent{AuthorID: 7, StoryID: 2, Expires: time.Now().Add(-time.Minute), Date: time.Unix(0, 0)}
+	if got := formatStoryInfo(expired, true); !strings.HasSuffix(got, "(已过期)") {
+		t.Errorf("expired = %q", got)
+	}
+}
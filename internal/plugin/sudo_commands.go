@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	"fmt"
+	"nexusvalet/internal/command"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/tg"
+)
+
+// handleSudo 处理sudo命令：add/remove <user_id|@username> 管理可以触发命令的账号，list 列出sudo用户。
+// 注册为只限所有者的命令，sudo用户自己不能管理列表
+func (cp *CoreCommandsPlugin) handleSudo(ctx *command.CommandContext) error {
+	goManager, ok := cp.manager.(*GoManager)
+	if !ok || goManager.GetSudo() == nil {
+		return cp.sendResponse(ctx, "❌ sudo 列表不可用")
+	}
+	registry := goManager.GetSudo()
+
+	sub := "list"
+	if len(ctx.Args) > 0 {
+		sub = ctx.Args[0]
+	}
+
+	switch sub {
+	case "list":
+		return cp.sendResponse(ctx, cp.formatSudoList(ctx, registry.List()))
+	case "add", "remove":
+		if len(ctx.Args) < 2 {
+			return cp.sendResponse(ctx, fmt.Sprintf("用法: .sudo %s <user_id|@username>", sub))
+		}
+		userID, err := cp.resolveSudoUser(ctx, ctx.Args[1])
+		if err != nil {
+			return cp.sendResponse(ctx, fmt.Sprintf("❌ 无法解析用户 %s: %v", ctx.Args[1], err))
+		}
+		if sub == "add" {
+			if err := registry.Add(userID); err != nil {
+				return cp.sendResponse(ctx, fmt.Sprintf("❌ 添加失败: %v", err))
+			}
+			return cp.sendResponse(ctx, fmt.Sprintf("✅ 已添加 sudo 用户 %d，该账号发送的命令将被执行", userID))
+		}
+		if err := registry.Remove(userID); err != nil {
+			return cp.sendResponse(ctx, fmt.Sprintf("❌ 移除失败: %v", err))
+		}
+		return cp.sendResponse(ctx, fmt.Sprintf("🗑️ 已移除 sudo 用户 %d", userID))
+	default:
+		return cp.sendResponse(ctx, "用法: .sudo [list|add <user_id|@username>|remove <user_id|@username>]")
+	}
+}
+
+// resolveSudoUser 解析用户ID或用户名
+func (cp *CoreCommandsPlugin) resolveSudoUser(ctx *command.CommandContext, target string) (int64, error) {
+	if userID, err := strconv.ParseInt(target, 10, 64); err == nil {
+		if userID <= 0 {
+			return 0, fmt.Errorf("不是用户ID")
+		}
+		return userID, nil
+	}
+	if ctx.API == nil {
+		return 0, fmt.Errorf("Telegram API 未就绪")
+	}
+
+	resolved, err := resolveUsername(ctx.Context, ctx.API, target)
+	if err != nil {
+		return 0, explainPeerError(err)
+	}
+	if manager := ctx.PeerResolver.Manager(); manager != nil {
+		manager.CacheUsersFromUpdate(resolved.Users)
+	}
+	user, ok := resolved.Peer.(*tg.PeerUser)
+	if !ok {
+		return 0, fmt.Errorf("%s 不是用户", target)
+	}
+	return user.UserID, nil
+}
+
+// formatSudoList 格式化sudo用户列表，缓存中有用户信息时显示名字
+func (cp *CoreCommandsPlugin) formatSudoList(ctx *command.CommandContext, users []int64) string {
+	if len(users) == 0 {
+		return "没有 sudo 用户\n\n使用 .sudo add <user_id|@username> 添加"
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("👥 sudo 用户 (%d):\n", len(users)))
+	for _, userID := range users {
+		b.WriteString(fmt.Sprintf("\n• %d", userID))
+		if manager := ctx.PeerResolver.Manager(); manager != nil {
+			if info := manager.GetCachedUserInfo(userID); info != nil {
+				name := strings.TrimSpace(info.FirstName + " " + info.LastName)
+				if info.Username != "" {
+					name += " (@" + info.Username + ")"
+				}
+				b.WriteString(" - " + name)
+			}
+		}
+	}
+	return b.String()
+}
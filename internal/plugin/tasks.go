@@ -0,0 +1,97 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// commandStatusEditor 返回编辑命令消息的状态编辑器，供 TaskRunner 报告进度
+func commandStatusEditor(ctx *command.CommandContext) (core.StatusEditor, error) {
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve peer: %w", err)
+	}
+	api := ctx.API
+	msgID := ctx.Message.Message.ID
+	return func(editCtx context.Context, text string) error {
+		_, err := api.MessagesEditMessage(editCtx, &tg.MessagesEditMessageRequest{
+			Peer:    peer,
+			ID:      msgID,
+			Message: text,
+		})
+		return err
+	}, nil
+}
+
+// handleCancel 处理cancel命令，取消当前对话中的长时间任务
+func (cp *CoreCommandsPlugin) handleCancel(ctx *command.CommandContext) error {
+	runner := taskRunnerFrom(cp.GetManager())
+	if runner == nil {
+		return cp.sendResponse(ctx, "任务管理器不可用")
+	}
+
+	id := 0
+	if len(ctx.Args) > 0 {
+		n, err := strconv.Atoi(strings.TrimPrefix(ctx.Args[0], "#"))
+		if err != nil || n <= 0 {
+			return cp.sendResponse(ctx, "用法: .cancel [任务ID]")
+		}
+		id = n
+	}
+
+	task, ok := runner.Cancel(ctx.Message.ChatID, id)
+	if !ok {
+		if id != 0 {
+			return cp.sendResponse(ctx, fmt.Sprintf("当前对话中没有任务 #%d", id))
+		}
+		return cp.sendResponse(ctx, "当前对话中没有正在运行的任务")
+	}
+	return cp.sendResponse(ctx, fmt.Sprintf("⛔ 已请求取消 %s (#%d)", task.Name, task.ID))
+}
+
+// handleTasks 处理tasks命令，列出正在运行的任务。.tasks all 列出所有对话的任务
+func (cp *CoreCommandsPlugin) handleTasks(ctx *command.CommandContext) error {
+	runner := taskRunnerFrom(cp.GetManager())
+	if runner == nil {
+		return cp.sendResponse(ctx, "任务管理器不可用")
+	}
+
+	chatID := ctx.Message.ChatID
+	if len(ctx.Args) > 0 && ctx.Args[0] == "all" {
+		chatID = 0
+	}
+
+	tasks := runner.List(chatID)
+	if len(tasks) == 0 {
+		return cp.sendResponse(ctx, "没有正在运行的任务")
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("⏳ 正在运行的任务 (%d):\n", len(tasks)))
+	for _, task := range tasks {
+		line := fmt.Sprintf("\n• #%d %s - 已运行 %s", task.ID, task.Name, runner.Age(task).Round(time.Second))
+		if done, total, _ := task.Progress(); total > 0 {
+			line += fmt.Sprintf(" (%d/%d)", done, total)
+		}
+		if chatID == 0 {
+			line += fmt.Sprintf(" [对话 %d]", task.ChatID)
+		}
+		b.WriteString(line)
+	}
+	b.WriteString("\n\n使用 .cancel <任务ID> 取消")
+	return cp.sendResponse(ctx, b.String())
+}
+
+// sendResponse 发送响应消息，过长时拆分为多条
+func (cp *CoreCommandsPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
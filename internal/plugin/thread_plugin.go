@@ -0,0 +1,444 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"nexusvalet/internal/capability"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// threadMaxDepth 向上追溯的最大层数
+	threadMaxDepth = 50
+	// threadBatchSize 单次批量获取的消息数(API上限)
+	threadBatchSize = 100
+	// threadHistoryWindow 向下查找回复时扫描的最近消息数
+	threadHistoryWindow = 300
+	// threadMaxInline 超过该长度时以文档形式发送
+	threadMaxInline = 3500
+)
+
+// ThreadMessage 对话串中的一条消息
+type ThreadMessage struct {
+	ID       int       `json:"id"`
+	ReplyTo  int       `json:"reply_to,omitempty"`
+	SenderID int64     `json:"sender_id,omitempty"`
+	Sender   string    `json:"sender,omitempty"`
+	Date     time.Time `json:"date"`
+	Text     string    `json:"text"`
+	Deleted  bool      `json:"deleted,omitempty"`
+}
+
+// messageBatch 一次获取到的消息及相关用户和对话
+type messageBatch struct {
+	Messages []tg.MessageClass
+	Users    []tg.UserClass
+	Chats    []tg.ChatClass
+}
+
+// threadFetcher 获取消息的接口，便于替换为伪造实现
+type threadFetcher interface {
+	// FetchIDs 按ID批量获取消息
+	FetchIDs(ctx context.Context, ids []int) (*messageBatch, error)
+	// FetchHistory 获取offsetID之前的一页历史消息
+	FetchHistory(ctx context.Context, offsetID, limit int) (*messageBatch, error)
+}
+
+// apiThreadFetcher 基于Telegram API的threadFetcher
+type apiThreadFetcher struct {
+	api  *tg.Client
+	peer tg.InputPeerClass
+}
+
+// FetchIDs 实现threadFetcher
+func (f *apiThreadFetcher) FetchIDs(ctx context.Context, ids []int) (*messageBatch, error) {
+	input := make([]tg.InputMessageClass, 0, len(ids))
+	for _, id := range ids {
+		input = append(input, &tg.InputMessageID{ID: id})
+	}
+
+	var resp tg.MessagesMessagesClass
+	var err error
+	if channelPeer, ok := f.peer.(*tg.InputPeerChannel); ok {
+		resp, err = f.api.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+			Channel: &tg.InputChannel{ChannelID: channelPeer.ChannelID, AccessHash: channelPeer.AccessHash},
+			ID:      input,
+		})
+	} else {
+		resp, err = f.api.MessagesGetMessages(ctx, input)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toMessageBatch(resp), nil
+}
+
+// FetchHistory 实现threadFetcher
+func (f *apiThreadFetcher) FetchHistory(ctx context.Context, offsetID, limit int) (*messageBatch, error) {
+	resp, err := f.api.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
+		Peer:     f.peer,
+		OffsetID: offsetID,
+		Limit:    limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toMessageBatch(resp), nil
+}
+
+// toMessageBatch 统一不同类型的消息响应
+func toMessageBatch(resp tg.MessagesMessagesClass) *messageBatch {
+	switch m := resp.(type) {
+	case *tg.MessagesMessages:
+		return &messageBatch{Messages: m.Messages, Users: m.Users, Chats: m.Chats}
+	case *tg.MessagesMessagesSlice:
+		return &messageBatch{Messages: m.Messages, Users: m.Users, Chats: m.Chats}
+	case *tg.MessagesChannelMessages:
+		return &messageBatch{Messages: m.Messages, Users: m.Users, Chats: m.Chats}
+	}
+	return &messageBatch{}
+}
+
+// threadBuilder 重建对话串，缓存已获取的消息以减少请求次数
+type threadBuilder struct {
+	fetcher  threadFetcher
+	chatID   int64
+	messages map[int]tg.MessageClass
+	names    map[int64]string
+	requests int
+}
+
+// newThreadBuilder 创建threadBuilder
+func newThreadBuilder(fetcher threadFetcher, chatID int64) *threadBuilder {
+	return &threadBuilder{
+		fetcher:  fetcher,
+		chatID:   chatID,
+		messages: make(map[int]tg.MessageClass),
+		names:    make(map[int64]string),
+	}
+}
+
+// absorb 将一批消息加入缓存
+func (tb *threadBuilder) absorb(batch *messageBatch) {
+	// 非频道对话的消息ID是账号全局的，按ID批量获取时可能混入其他对话的消息
+	for _, msg := range batch.Messages {
+		switch m := msg.(type) {
+		case *tg.Message:
+			if peerToChatID(m.PeerID) == tb.chatID {
+				tb.messages[m.ID] = m
+			}
+		case *tg.MessageService:
+			if peerToChatID(m.PeerID) == tb.chatID {
+				tb.messages[m.ID] = m
+			}
+		}
+	}
+	for _, u := range batch.Users {
+		if user, ok := u.(*tg.User); ok {
+			name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+			if name == "" && user.Username != "" {
+				name = "@" + user.Username
+			}
+			tb.names[user.ID] = name
+		}
+	}
+	for _, c := range batch.Chats {
+		switch chat := c.(type) {
+		case *tg.Chat:
+			tb.names[-chat.ID] = chat.Title
+		case *tg.Channel:
+			tb.names[-1000000000000-chat.ID] = chat.Title
+		}
+	}
+}
+
+// prefetchHistory 预取最近的历史消息，向上追溯和向下查找都使用这部分缓存
+func (tb *threadBuilder) prefetchHistory(ctx context.Context, window int) {
+	offsetID := 0
+	for fetched := 0; fetched < window; {
+		batch, err := tb.fetcher.FetchHistory(ctx, offsetID, threadBatchSize)
+		tb.requests++
+		if err != nil {
+			logger.Warnf("Failed to fetch history for thread: %v", err)
+			return
+		}
+		tb.absorb(batch)
+		if len(batch.Messages) == 0 {
+			return
+		}
+		fetched += len(batch.Messages)
+		offsetID = batch.Messages[len(batch.Messages)-1].GetID()
+	}
+}
+
+// lookup 获取消息，缓存未命中时一次性获取该ID及其之前的一整批消息
+// 回复链中的上级消息通常就在附近，这样多跳追溯只需少量请求
+func (tb *threadBuilder) lookup(ctx context.Context, id int) (tg.MessageClass, bool) {
+	if msg, ok := tb.messages[id]; ok {
+		return msg, true
+	}
+
+	ids := make([]int, 0, threadBatchSize)
+	for i := id; i > 0 && len(ids) < threadBatchSize; i-- {
+		if _, cached := tb.messages[i]; !cached {
+			ids = append(ids, i)
+		}
+	}
+	batch, err := tb.fetcher.FetchIDs(ctx, ids)
+	tb.requests++
+	if err != nil {
+		logger.Warnf("Failed to fetch messages for thread: %v", err)
+		return nil, false
+	}
+	tb.absorb(batch)
+
+	msg, ok := tb.messages[id]
+	return msg, ok
+}
+
+// walkUp 从起始消息向上追溯到根消息，返回按从根到起点排序的ID
+func (tb *threadBuilder) walkUp(ctx context.Context, startID int) []int {
+	var chain []int
+	visited := make(map[int]bool)
+
+	id := startID
+	for depth := 0; id != 0 && depth < threadMaxDepth; depth++ {
+		if visited[id] {
+			// 回复成环
+			break
+		}
+		visited[id] = true
+		chain = append(chain, id)
+
+		msg, ok := tb.lookup(ctx, id)
+		if !ok {
+			break
+		}
+		m, ok := msg.(*tg.Message)
+		if !ok {
+			// 已删除的消息无法继续追溯
+			break
+		}
+		id = replyToID(m)
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// walkDown 在已缓存的消息中查找回复进对话串的消息
+func (tb *threadBuilder) walkDown(chain []int, exclude int) []int {
+	inThread := make(map[int]bool, len(chain))
+	for _, id := range chain {
+		inThread[id] = true
+	}
+
+	ids := make([]int, 0, len(tb.messages))
+	for id := range tb.messages {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	// 按ID升序遍历，回复的回复也能被收集
+	var replies []int
+	for _, id := range ids {
+		if inThread[id] || id == exclude {
+			continue
+		}
+		m, ok := tb.messages[id].(*tg.Message)
+		if !ok {
+			continue
+		}
+		if parent := replyToID(m); parent != 0 && parent < id && inThread[parent] {
+			inThread[id] = true
+			replies = append(replies, id)
+		}
+	}
+	return replies
+}
+
+// Build 重建对话串。down为true时同时收集后续回复
+func (tb *threadBuilder) Build(ctx context.Context, startID, commandID int, down bool) []ThreadMessage {
+	tb.prefetchHistory(ctx, threadHistoryWindow)
+
+	ids := tb.walkUp(ctx, startID)
+	if down {
+		ids = append(ids, tb.walkDown(ids, commandID)...)
+	}
+	sort.Ints(ids)
+
+	thread := make([]ThreadMessage, 0, len(ids))
+	for _, id := range ids {
+		thread = append(thread, tb.render(id))
+	}
+	return thread
+}
+
+// render 将消息转换为ThreadMessage，缺失或已删除的消息标记为已删除
+func (tb *threadBuilder) render(id int) ThreadMessage {
+	m, ok := tb.messages[id].(*tg.Message)
+	if !ok {
+		return ThreadMessage{ID: id, Text: "[已删除]", Deleted: true}
+	}
+
+	tm := ThreadMessage{
+		ID:      id,
+		ReplyTo: replyToID(m),
+		Date:    time.Unix(int64(m.Date), 0),
+		Text:    m.Message,
+	}
+	if tm.Text == "" && m.Media != nil {
+		tm.Text = "[媒体]"
+	}
+
+	from := m.FromID
+	if from == nil {
+		from = m.PeerID
+	}
+	tm.SenderID = peerToChatID(from)
+	tm.Sender = tb.names[tm.SenderID]
+	if tm.Sender == "" {
+		tm.Sender = fmt.Sprintf("%d", tm.SenderID)
+	}
+	return tm
+}
+
+// replyToID 返回消息回复的消息ID
+func replyToID(m *tg.Message) int {
+	if header, ok := m.ReplyTo.(*tg.MessageReplyHeader); ok {
+		return header.ReplyToMsgID
+	}
+	return 0
+}
+
+// formatThread 将对话串格式化为文本
+func formatThread(thread []ThreadMessage) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🧵 对话串 (%d 条)\n\n", len(thread)))
+	for _, tm := range thread {
+		if tm.Deleted {
+			b.WriteString(fmt.Sprintf("#%d %s\n", tm.ID, tm.Text))
+			continue
+		}
+		reply := ""
+		if tm.ReplyTo != 0 {
+			reply = fmt.Sprintf(" ↩#%d", tm.ReplyTo)
+		}
+		b.WriteString(fmt.Sprintf("#%d%s [%s] %s: %s\n", tm.ID, reply, tm.Date.Format("01-02 15:04"), tm.Sender, tm.Text))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// ThreadPlugin 回复链重建插件
+type ThreadPlugin struct {
+	*BasePlugin
+}
+
+// NewThreadPlugin 创建对话串插件
+func NewThreadPlugin() *ThreadPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "thread",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "显示和导出完整的回复链",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &ThreadPlugin{
+		BasePlugin: NewBasePlugin(info),
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (tp *ThreadPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("thread", "显示或导出回复链", tp.info.Name, tp.handleThread)
+	logger.Infof("Thread commands registered successfully")
+	return nil
+}
+
+// Capabilities 实现CapabilityPlugin接口，声明读取回复链所需的接口
+func (tp *ThreadPlugin) Capabilities() []capability.Requirement {
+	return []capability.Requirement{
+		capability.Require((*tg.Client)(nil), "MessagesGetHistory", "MessagesGetMessages", "ChannelsGetMessages"),
+		capability.Require(tg.Message{}, "ReplyTo", "FromID", "Date"),
+		capability.Require(tg.MessageReplyHeader{}, "ReplyToMsgID"),
+	}
+}
+
+// handleThread 处理thread命令
+func (tp *ThreadPlugin) handleThread(ctx *command.CommandContext) error {
+	replyTo, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok || replyTo.ReplyToMsgID == 0 {
+		return tp.sendResponse(ctx, "用法: 回复一条消息使用 .thread [up|export]\n• .thread - 显示完整对话串\n• .thread up - 只向上追溯到根消息\n• .thread export - 导出为JSON文件")
+	}
+
+	mode := ""
+	if len(ctx.Args) > 0 {
+		mode = ctx.Args[0]
+	}
+	if mode != "" && mode != "up" && mode != "export" {
+		return tp.sendResponse(ctx, "未知子命令: "+mode)
+	}
+
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+
+	tp.sendResponse(ctx, "🧵 正在重建对话串...")
+
+	builder := newThreadBuilder(&apiThreadFetcher{api: ctx.API, peer: peer}, ctx.Message.ChatID)
+	thread := builder.Build(ctx.Context, replyTo.ReplyToMsgID, ctx.Message.Message.ID, mode != "up")
+	logger.Debugf("Thread rebuilt with %d messages using %d requests", len(thread), builder.requests)
+
+	if mode == "export" {
+		data, err := json.MarshalIndent(thread, "", "  ")
+		if err != nil {
+			return tp.sendResponse(ctx, fmt.Sprintf("❌ 导出失败: %v", err))
+		}
+		return tp.sendFile(ctx, peer, fmt.Sprintf("thread_%d.json", replyTo.ReplyToMsgID), "application/json", data, len(thread))
+	}
+
+	text := formatThread(thread)
+	if len([]rune(text)) <= threadMaxInline {
+		return tp.sendResponse(ctx, text)
+	}
+	return tp.sendFile(ctx, peer, fmt.Sprintf("thread_%d.txt", replyTo.ReplyToMsgID), "text/plain", []byte(text), len(thread))
+}
+
+// sendFile 以文档形式发送对话串，并删除命令消息
+func (tp *ThreadPlugin) sendFile(ctx *command.CommandContext, peer tg.InputPeerClass, name, mimeType string, data []byte, count int) error {
+	err := sendDocument(ctx, peer, MediaUpload{
+		FileName: name,
+		Data:     data,
+		MimeType: mimeType,
+		Caption:  fmt.Sprintf("🧵 对话串 (%d 条)", count),
+		ReplyTo:  replyTargetFromContext(ctx),
+	})
+	if err != nil {
+		return tp.sendResponse(ctx, "❌ "+err.Error())
+	}
+	if err := deleteCommandMessage(ctx, peer); err != nil {
+		logger.Warnf("Failed to delete thread command message: %v", err)
+	}
+	return nil
+}
+
+// sendResponse 发送响应消息
+func (tp *ThreadPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,215 @@
+package plugin
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+const threadChatID = -55
+
+// fakeThreadFetcher 伪造的消息来源，记录每次请求
+type fakeThreadFetcher struct {
+	messages  map[int]tg.MessageClass
+	users     []tg.UserClass
+	noHistory bool    // 为true时历史消息为空，强制走按ID获取
+	idCalls   [][]int // 每次 FetchIDs 请求的ID
+	histCalls int
+}
+
+func newFakeThreadFetcher(msgs ...tg.MessageClass) *fakeThreadFetcher {
+	f := &fakeThreadFetcher{messages: make(map[int]tg.MessageClass)}
+	for _, m := range msgs {
+		f.messages[m.GetID()] = m
+	}
+	return f
+}
+
+func (f *fakeThreadFetcher) FetchIDs(_ context.Context, ids []int) (*messageBatch, error) {
+	f.idCalls = append(f.idCalls, ids)
+	batch := &messageBatch{Users: f.users}
+	for _, id := range ids {
+		if m, ok := f.messages[id]; ok {
+			batch.Messages = append(batch.Messages, m)
+		}
+	}
+	return batch, nil
+}
+
+func (f *fakeThreadFetcher) FetchHistory(_ context.Context, offsetID, limit int) (*messageBatch, error) {
+	f.histCalls++
+	batch := &messageBatch{Users: f.users}
+	if f.noHistory {
+		return batch, nil
+	}
+	ids := make([]int, 0, len(f.messages))
+	for id := range f.messages {
+		if offsetID == 0 || id < offsetID {
+			ids = append(ids, id)
+		}
+	}
+	// 历史消息从新到旧
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	for _, id := range ids {
+		batch.Messages = append(batch.Messages, f.messages[id])
+	}
+	return batch, nil
+}
+
+// threadMsg 创建当前对话中的消息，replyTo为0时不是回复
+func threadMsg(id, replyTo int, from int64, text string) *tg.Message {
+	m := &tg.Message{ID: id, PeerID: &tg.PeerChat{ChatID: -threadChatID}, Message: text, Date: 1700000000 + id}
+	if replyTo != 0 {
+		m.ReplyTo = &tg.MessageReplyHeader{ReplyToMsgID: replyTo}
+	}
+	if from != 0 {
+		m.FromID = &tg.PeerUser{UserID: from}
+	}
+	return m
+}
+
+func threadIDs(thread []ThreadMessage) []int {
+	ids := make([]int, 0, len(thread))
+	for _, tm := range thread {
+		ids = append(ids, tm.ID)
+	}
+	return ids
+}
+
+func TestThreadWalkUpAndDown(t *testing.T) {
+	fetcher := newFakeThreadFetcher(
+		threadMsg(10, 0, 1, "root"),
+		threadMsg(11, 0, 2, "unrelated"),
+		threadMsg(12, 10, 2, "reply"),
+		threadMsg(13, 11, 1, "other thread"),
+		threadMsg(15, 12, 1, "reply to reply"),
+		threadMsg(17, 15, 2, "deeper"),
+		threadMsg(20, 12, 1, ".thread"),
+	)
+	fetcher.users = []tg.UserClass{&tg.User{ID: 1, FirstName: "Alice"}, &tg.User{ID: 2, Username: "bob"}}
+
+	up := newThreadBuilder(fetcher, threadChatID).Build(context.Background(), 12, 20, false)
+	if got := threadIDs(up); !reflect.DeepEqual(got, []int{10, 12}) {
+		t.Fatalf("up = %v, want [10 12]", got)
+	}
+
+	// 向下收集回复的回复，命令消息本身不算在内
+	full := newThreadBuilder(fetcher, threadChatID).Build(context.Background(), 12, 20, true)
+	if got := threadIDs(full); !reflect.DeepEqual(got, []int{10, 12, 15, 17}) {
+		t.Fatalf("full = %v, want [10 12 15 17]", got)
+	}
+	if full[0].Sender != "Alice" || full[1].Sender != "@bob" || full[1].ReplyTo != 10 {
+		t.Errorf("rendered = %+v", full[:2])
+	}
+	// 已全部在历史缓存中，不需要按ID获取
+	if len(fetcher.idCalls) != 0 {
+		t.Errorf("FetchIDs called %d times, want 0", len(fetcher.idCalls))
+	}
+}
+
+func TestThreadCycle(t *testing.T) {
+	fetcher := newFakeThreadFetcher(
+		threadMsg(3, 5, 1, "a"),
+		threadMsg(5, 3, 1, "b"),
+		threadMsg(8, 5, 1, "start"),
+	)
+	thread := newThreadBuilder(fetcher, threadChatID).Build(context.Background(), 8, 0, true)
+	if got := threadIDs(thread); !reflect.DeepEqual(got, []int{3, 5, 8}) {
+		t.Fatalf("thread = %v, want [3 5 8]", got)
+	}
+}
+
+func TestThreadMissingMessages(t *testing.T) {
+	fetcher := newFakeThreadFetcher(
+		threadMsg(7, 4, 1, "parent was deleted"),
+		&tg.MessageService{ID: 9, PeerID: &tg.PeerChat{ChatID: -threadChatID}},
+		threadMsg(12, 9, 1, "reply to service message"),
+	)
+
+	thread := newThreadBuilder(fetcher, threadChatID).Build(context.Background(), 7, 0, false)
+	if got := threadIDs(thread); !reflect.DeepEqual(got, []int{4, 7}) {
+		t.Fatalf("thread = %v, want [4 7]", got)
+	}
+	if !thread[0].Deleted || thread[0].Text != "[已删除]" || thread[1].Deleted {
+		t.Errorf("thread = %+v", thread)
+	}
+	text := formatThread(thread)
+	if !strings.Contains(text, "#4 [已删除]") || !strings.Contains(text, "#7 ↩#4") {
+		t.Errorf("formatThread = %q", text)
+	}
+
+	// 服务消息无法继续追溯，同样显示为已删除
+	thread = newThreadBuilder(fetcher, threadChatID).Build(context.Background(), 12, 0, false)
+	if got := threadIDs(thread); !reflect.DeepEqual(got, []int{9, 12}) || !thread[0].Deleted {
+		t.Errorf("thread = %+v", thread)
+	}
+}
+
+func TestThreadBatchedLookup(t *testing.T) {
+	fetcher := newFakeThreadFetcher(
+		threadMsg(120, 0, 1, "root"),
+		threadMsg(150, 120, 1, "b"),
+		threadMsg(200, 150, 1, "c"),
+		threadMsg(250, 200, 1, "start"),
+	)
+	fetcher.noHistory = true
+
+	builder := newThreadBuilder(fetcher, threadChatID)
+	thread := builder.Build(context.Background(), 250, 0, false)
+	if got := threadIDs(thread); !reflect.DeepEqual(got, []int{120, 150, 200, 250}) {
+		t.Fatalf("thread = %v", got)
+	}
+	// 250 取回 151-250(含200)，150 取回 51-150(含120)
+	if len(fetcher.idCalls) != 2 {
+		t.Fatalf("FetchIDs called %d times, want 2: %v", len(fetcher.idCalls), fetcher.idCalls)
+	}
+	for i, want := range [][2]int{{250, 151}, {150, 51}} {
+		ids := fetcher.idCalls[i]
+		if len(ids) != threadBatchSize || ids[0] != want[0] || ids[len(ids)-1] != want[1] {
+			t.Errorf("call %d requested %d..%d (%d ids), want %d..%d", i, ids[0], ids[len(ids)-1], len(ids), want[0], want[1])
+		}
+	}
+	if builder.requests != 3 {
+		t.Errorf("requests = %d, want 3", builder.requests)
+	}
+}
+
+func TestThreadIgnoresOtherChats(t *testing.T) {
+	// 非频道消息ID是账号全局的，按ID获取可能返回其他对话的同ID消息
+	foreign := threadMsg(4, 0, 1, "other chat")
+	foreign.PeerID = &tg.PeerUser{UserID: 99}
+	fetcher := newFakeThreadFetcher(threadMsg(7, 4, 1, "start"), foreign)
+	fetcher.noHistory = true
+
+	thread := newThreadBuilder(fetcher, threadChatID).Build(context.Background(), 7, 0, false)
+	if len(thread) != 2 || !thread[0].Deleted {
+		t.Fatalf("thread = %+v, want message 4 rendered as deleted", thread)
+	}
+}
+
+func TestThreadHistoryPaging(t *testing.T) {
+	var msgs []tg.MessageClass
+	for id := 1; id <= 350; id++ {
+		msgs = append(msgs, threadMsg(id, 0, 1, "m"))
+	}
+	fetcher := newFakeThreadFetcher(msgs...)
+	builder := newThreadBuilder(fetcher, threadChatID)
+	builder.prefetchHistory(context.Background(), threadHistoryWindow)
+
+	if fetcher.histCalls != 3 {
+		t.Errorf("FetchHistory called %d times, want 3", fetcher.histCalls)
+	}
+	if len(builder.messages) != threadHistoryWindow {
+		t.Errorf("cached %d messages, want %d", len(builder.messages), threadHistoryWindow)
+	}
+	if _, ok := builder.messages[51]; !ok {
+		t.Error("oldest message in the window is missing")
+	}
+}
@@ -0,0 +1,398 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// tplGlobalChat 全局模板使用的chat_id
+	tplGlobalChat int64 = 0
+	// tplTimeBudget 展开并编辑消息的时间预算
+	tplTimeBudget = 3 * time.Second
+	// tplMaxAge 超过该时长的消息不再展开(如重连后补收的旧消息)
+	tplMaxAge = 30 * time.Second
+)
+
+// TplPlugin 发出消息时展开 ;短代码; 模板
+type TplPlugin struct {
+	*BasePlugin
+	db           *sql.DB
+	telegramAPI  *tg.Client
+	peerResolver *peers.Resolver
+	parser       *command.Parser
+	templates    map[int64]map[string]string // chat_id -> 名称 -> 内容
+	enabled      map[int64]bool
+	mutex        sync.RWMutex
+}
+
+// NewTplPlugin 创建模板插件
+func NewTplPlugin(db *sql.DB) *TplPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "tpl",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "发出消息时展开短代码模板",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &TplPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+		templates:  make(map[int64]map[string]string),
+		enabled:    make(map[int64]bool),
+	}
+}
+
+// Initialize 初始化插件
+func (tp *TplPlugin) Initialize(ctx context.Context, manager interface{}) error {
+	if err := tp.BasePlugin.Initialize(ctx, manager); err != nil {
+		return err
+	}
+
+	if err := tp.initDatabase(); err != nil {
+		return fmt.Errorf("failed to initialize tpl database: %w", err)
+	}
+	if err := tp.loadTemplates(); err != nil {
+		return fmt.Errorf("failed to load templates: %w", err)
+	}
+
+	logger.Infof("Tpl plugin initialized successfully")
+	return nil
+}
+
+// SetTelegramClient 设置Telegram客户端
+func (tp *TplPlugin) SetTelegramClient(client *tg.Client, peerResolver *peers.Resolver) {
+	tp.telegramAPI = client
+	tp.peerResolver = peerResolver
+}
+
+// initDatabase 创建模板表
+func (tp *TplPlugin) initDatabase() error {
+	if _, err := tp.db.Exec(`
+	CREATE TABLE IF NOT EXISTS tpl_templates (
+		chat_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		content TEXT NOT NULL,
+		PRIMARY KEY (chat_id, name)
+	)`); err != nil {
+		return err
+	}
+	_, err := tp.db.Exec(`
+	CREATE TABLE IF NOT EXISTS tpl_chats (
+		chat_id INTEGER PRIMARY KEY
+	)`)
+	return err
+}
+
+// loadTemplates 将模板和启用状态加载到内存，展开时不访问数据库
+func (tp *TplPlugin) loadTemplates() error {
+	rows, err := tp.db.Query("SELECT chat_id, name, content FROM tpl_templates")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+	for rows.Next() {
+		var chatID int64
+		var name, content string
+		if err := rows.Scan(&chatID, &name, &content); err != nil {
+			return err
+		}
+		if tp.templates[chatID] == nil {
+			tp.templates[chatID] = make(map[string]string)
+		}
+		tp.templates[chatID][name] = content
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	chatRows, err := tp.db.Query("SELECT chat_id FROM tpl_chats")
+	if err != nil {
+		return err
+	}
+	defer chatRows.Close()
+	for chatRows.Next() {
+		var chatID int64
+		if err := chatRows.Scan(&chatID); err != nil {
+			return err
+		}
+		tp.enabled[chatID] = true
+	}
+	return chatRows.Err()
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (tp *TplPlugin) RegisterCommands(parser *command.Parser) error {
+	tp.parser = parser
+	parser.RegisterCommand("tpl", "管理发出消息时展开的短代码模板", tp.info.Name, tp.handleTpl)
+	logger.Infof("Tpl commands registered successfully")
+	return nil
+}
+
+// RegisterEventHandlers 实现EventPlugin接口，监听自己发出的消息
+func (tp *TplPlugin) RegisterEventHandlers(dispatcher *core.EventDispatcher) error {
+	return dispatcher.RegisterMessageListenerWithFilter("tpl_expand", "", tp.handleOutgoing, 80, core.ListenerFilter{Outgoing: true})
+}
+
+// lookup 查找模板，优先使用当前对话的模板，其次为全局模板
+func (tp *TplPlugin) lookup(chatID int64) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		tp.mutex.RLock()
+		defer tp.mutex.RUnlock()
+		if content, ok := tp.templates[chatID][name]; ok {
+			return content, true
+		}
+		content, ok := tp.templates[tplGlobalChat][name]
+		return content, ok
+	}
+}
+
+// handleOutgoing 展开消息中的短代码并编辑原消息
+func (tp *TplPlugin) handleOutgoing(ctx context.Context, event interface{}) error {
+	msgEvent, ok := event.(*core.MessageEvent)
+	if !ok || msgEvent.Message == nil || tp.telegramAPI == nil || tp.peerResolver == nil {
+		return nil
+	}
+
+	tp.mutex.RLock()
+	enabled := tp.enabled[msgEvent.ChatID]
+	tp.mutex.RUnlock()
+	if !enabled || !strings.Contains(msgEvent.Text, ";") {
+		return nil
+	}
+	if tp.parser != nil && tp.parser.IsCommand(msgEvent.Text) {
+		return nil
+	}
+	if time.Since(time.Unix(int64(msgEvent.Message.Date), 0)) > tplMaxAge {
+		return nil
+	}
+
+	entities := msgEvent.Message.Entities
+	text, edits := expandShortcodes(msgEvent.Text, tp.lookup(msgEvent.ChatID), codeRanges(entities), time.Now())
+	if len(edits) == 0 {
+		return nil
+	}
+	if len([]rune(text)) > 4096 {
+		logger.Warnf("Template expansion in chat %d exceeds message length, skipped", msgEvent.ChatID)
+		return nil
+	}
+
+	editCtx, cancel := context.WithTimeout(ctx, tplTimeBudget)
+	defer cancel()
+
+	peer, err := tp.peerResolver.ResolveFromChatID(editCtx, msgEvent.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+	req := &tg.MessagesEditMessageRequest{
+		Peer:    peer,
+		ID:      msgEvent.Message.ID,
+		Message: text,
+	}
+	if len(entities) > 0 {
+		req.SetEntities(remapEntities(entities, edits))
+	}
+	if _, err := tp.telegramAPI.MessagesEditMessage(editCtx, req); err != nil {
+		return fmt.Errorf("failed to edit message with expanded templates: %w", err)
+	}
+	return nil
+}
+
+// handleTpl 处理tpl命令
+func (tp *TplPlugin) handleTpl(ctx *command.CommandContext) error {
+	if len(ctx.Args) == 0 {
+		return tp.sendResponse(ctx, tp.helpText())
+	}
+
+	chatID := ctx.Message.ChatID
+	args := ctx.Args[1:]
+	skip := 1
+	if len(args) > 0 && args[0] == "-g" {
+		chatID = tplGlobalChat
+		args = args[1:]
+		skip++
+	}
+
+	switch ctx.Args[0] {
+	case "on", "off":
+		return tp.handleToggle(ctx, ctx.Args[0] == "on")
+	case "set":
+		if len(args) < 2 {
+			return tp.sendResponse(ctx, "用法: .tpl set [-g] <名称> <内容>")
+		}
+		name := strings.ToLower(args[0])
+		if _, _, ok := parseShortcode(name); !ok {
+			return tp.sendResponse(ctx, "❌ 模板名称只能包含字母、数字和下划线")
+		}
+		content := ctx.ArgsStringFrom(skip + 1)
+		return tp.handleSet(ctx, chatID, name, content)
+	case "del", "rm":
+		if len(args) < 1 {
+			return tp.sendResponse(ctx, "用法: .tpl del [-g] <名称>")
+		}
+		return tp.handleDel(ctx, chatID, strings.ToLower(args[0]))
+	case "list":
+		return tp.handleList(ctx)
+	default:
+		return tp.sendResponse(ctx, tp.helpText())
+	}
+}
+
+// handleToggle 为当前对话启用或禁用短代码展开
+func (tp *TplPlugin) handleToggle(ctx *command.CommandContext, on bool) error {
+	chatID := ctx.Message.ChatID
+	var err error
+	if on {
+		_, err = tp.db.Exec("INSERT OR IGNORE INTO tpl_chats (chat_id) VALUES (?)", chatID)
+	} else {
+		_, err = tp.db.Exec("DELETE FROM tpl_chats WHERE chat_id = ?", chatID)
+	}
+	if err != nil {
+		return tp.sendResponse(ctx, fmt.Sprintf("❌ 保存失败: %v", err))
+	}
+
+	tp.mutex.Lock()
+	if on {
+		tp.enabled[chatID] = true
+	} else {
+		delete(tp.enabled, chatID)
+	}
+	tp.mutex.Unlock()
+
+	if on {
+		return tp.sendResponse(ctx, "✅ 已在当前对话启用短代码展开")
+	}
+	return tp.sendResponse(ctx, "✅ 已在当前对话禁用短代码展开")
+}
+
+// handleSet 保存模板
+func (tp *TplPlugin) handleSet(ctx *command.CommandContext, chatID int64, name, content string) error {
+	if content == "" {
+		return tp.sendResponse(ctx, "❌ 模板内容不能为空")
+	}
+	if _, err := tp.db.Exec("INSERT OR REPLACE INTO tpl_templates (chat_id, name, content) VALUES (?, ?, ?)", chatID, name, content); err != nil {
+		return tp.sendResponse(ctx, fmt.Sprintf("❌ 保存模板失败: %v", err))
+	}
+
+	tp.mutex.Lock()
+	if tp.templates[chatID] == nil {
+		tp.templates[chatID] = make(map[string]string)
+	}
+	tp.templates[chatID][name] = content
+	enabled := tp.enabled[ctx.Message.ChatID]
+	tp.mutex.Unlock()
+
+	scope := "当前对话"
+	if chatID == tplGlobalChat {
+		scope = "全局"
+	}
+	response := fmt.Sprintf("✅ 已保存%s模板 ;%s;", scope, name)
+	if !enabled {
+		response += "\n提示: 当前对话未启用展开，使用 .tpl on 启用"
+	}
+	return tp.sendResponse(ctx, response)
+}
+
+// handleDel 删除模板
+func (tp *TplPlugin) handleDel(ctx *command.CommandContext, chatID int64, name string) error {
+	result, err := tp.db.Exec("DELETE FROM tpl_templates WHERE chat_id = ? AND name = ?", chatID, name)
+	if err != nil {
+		return tp.sendResponse(ctx, fmt.Sprintf("❌ 删除模板失败: %v", err))
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return tp.sendResponse(ctx, fmt.Sprintf("❌ 模板 %s 不存在", name))
+	}
+
+	tp.mutex.Lock()
+	delete(tp.templates[chatID], name)
+	tp.mutex.Unlock()
+
+	return tp.sendResponse(ctx, fmt.Sprintf("✅ 已删除模板 %s", name))
+}
+
+// handleList 列出当前对话可用的模板
+func (tp *TplPlugin) handleList(ctx *command.CommandContext) error {
+	chatID := ctx.Message.ChatID
+
+	tp.mutex.RLock()
+	enabled := tp.enabled[chatID]
+	var b strings.Builder
+	if enabled {
+		b.WriteString("📝 短代码模板 (当前对话已启用)\n")
+	} else {
+		b.WriteString("📝 短代码模板 (当前对话未启用)\n")
+	}
+	count := 0
+	for _, scope := range []struct {
+		label  string
+		chatID int64
+	}{{"当前对话", chatID}, {"全局", tplGlobalChat}} {
+		names := make([]string, 0, len(tp.templates[scope.chatID]))
+		for name := range tp.templates[scope.chatID] {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+		b.WriteString(fmt.Sprintf("\n%s:\n", scope.label))
+		for _, name := range names {
+			b.WriteString(fmt.Sprintf("• ;%s; → %s\n", name, tplPreview(tp.templates[scope.chatID][name])))
+			count++
+		}
+	}
+	tp.mutex.RUnlock()
+
+	if count == 0 {
+		b.WriteString("\n暂无模板，使用 .tpl set <名称> <内容> 添加")
+	}
+	return tp.sendResponse(ctx, b.String())
+}
+
+// helpText 返回帮助信息
+func (tp *TplPlugin) helpText() string {
+	return `📝 短代码模板
+
+• .tpl on/off - 在当前对话启用/禁用展开 (默认禁用)
+• .tpl set [-g] <名称> <内容> - 保存模板，-g 为全局模板
+• .tpl del [-g] <名称> - 删除模板
+• .tpl list - 列出可用模板
+
+发送消息时 ;名称 参数...; 会被替换为模板内容，;; 表示一个分号。
+占位符: {{1}} {{2}}... 为参数，{{args}} 为全部参数，{{date}} {{time}} {{datetime}} {{weekday}} 为当前时间
+示例: .tpl set eta 预计 {{1}} 分钟后到达，发送 ;eta 10; 即可`
+}
+
+// tplPreview 模板内容的单行预览
+func tplPreview(content string) string {
+	runes := []rune(strings.ReplaceAll(content, "\n", " "))
+	if len(runes) > 40 {
+		return string(runes[:40]) + "…"
+	}
+	return string(runes)
+}
+
+// sendResponse 发送响应消息
+func (tp *TplPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
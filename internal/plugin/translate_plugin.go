@@ -0,0 +1,394 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/secrets"
+	"nexusvalet/pkg/logger"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// translateDefaultTarget 未设置默认目标语言时使用的语言
+	translateDefaultTarget = "zh-CN"
+	// translateChunkSize 单次请求翻译的最大长度，超过时按换行拆分后分别翻译
+	translateChunkSize = 4500
+)
+
+// translateLangPattern 语言代码，如 en、zh、zh-TW
+var translateLangPattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z]{2,4})?$`)
+
+// errTranslatorUnavailable 后端未配置，跳过而不作为错误
+var errTranslatorUnavailable = errors.New("translator unavailable")
+
+// translator 翻译后端
+type translator interface {
+	// Name 后端名称，显示在翻译结果中
+	Name() string
+	// Translate 把text翻译为target语言，返回译文和检测到的源语言
+	Translate(ctx context.Context, text, target string) (translated, source string, err error)
+}
+
+// TranslatePlugin 翻译插件，默认使用谷歌翻译，失败时使用已配置的Gemini API key
+type TranslatePlugin struct {
+	*BasePlugin
+	db         *sql.DB
+	httpClient *http.Client
+	backends   []translator
+}
+
+// NewTranslatePlugin 创建翻译插件
+func NewTranslatePlugin(db *sql.DB) *TranslatePlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "translate",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "翻译文本或回复的消息",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &TranslatePlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+	plugin.backends = []translator{
+		&googleTranslator{client: plugin.httpClient},
+		&geminiTranslator{client: plugin.httpClient, plugin: plugin},
+	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+
+	return plugin
+}
+
+// initDatabase 初始化数据库表
+func (tp *TranslatePlugin) initDatabase() {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS translate_config (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`
+
+	_, err := tp.db.Exec(createTableSQL)
+	if err != nil {
+		logger.Errorf("Failed to create translate_config table: %v", err)
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (tp *TranslatePlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("tr", "翻译文本或回复的消息，.tr [语言] [文本] | .tr set <语言>", tp.info.Name, tp.handleTranslate)
+	logger.Infof("Translate commands registered successfully")
+	return nil
+}
+
+// handleTranslate 处理tr命令
+func (tp *TranslatePlugin) handleTranslate(ctx *command.CommandContext) error {
+	if len(ctx.Args) > 0 && ctx.Args[0] == "set" {
+		return tp.handleSet(ctx)
+	}
+	if len(ctx.Args) > 0 && ctx.Args[0] == "help" {
+		return tp.sendResponse(ctx, tp.usage())
+	}
+
+	// 第一个参数是语言代码时作为目标语言，否则使用默认目标语言
+	target := tp.defaultTarget()
+	skip := 0
+	if len(ctx.Args) > 0 && translateLangPattern.MatchString(ctx.Args[0]) {
+		target = ctx.Args[0]
+		skip = 1
+	}
+
+	text := ctx.ArgsStringFrom(skip)
+	if text == "" {
+		msg, err := fetchReplyMessage(ctx)
+		if err != nil || msg.Message == "" {
+			return tp.sendResponse(ctx, tp.usage())
+		}
+		text = msg.Message
+	}
+
+	translated, source, backend, err := tp.translate(ctx.Context, text, target)
+	if err != nil {
+		return tp.sendResponse(ctx, fmt.Sprintf("❌ 翻译失败: %v", err))
+	}
+	return tp.sendResponse(ctx, fmt.Sprintf("🌐 %s → %s (%s)\n\n%s", source, target, backend, translated))
+}
+
+// handleSet 设置默认目标语言
+func (tp *TranslatePlugin) handleSet(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return tp.sendResponse(ctx, fmt.Sprintf("当前默认目标语言: %s\n\n用法: .tr set <语言>", tp.defaultTarget()))
+	}
+	lang := ctx.Args[1]
+	if !translateLangPattern.MatchString(lang) {
+		return tp.sendResponse(ctx, "❌ 无效的语言代码，例如 en、zh、zh-TW、ja")
+	}
+	if _, err := tp.db.Exec("INSERT OR REPLACE INTO translate_config (key, value) VALUES (?, ?)", "target_lang", lang); err != nil {
+		return tp.sendResponse(ctx, fmt.Sprintf("❌ 保存设置失败: %v", err))
+	}
+	return tp.sendResponse(ctx, fmt.Sprintf("✅ 默认目标语言已设置为 %s", lang))
+}
+
+// defaultTarget 返回默认目标语言
+func (tp *TranslatePlugin) defaultTarget() string {
+	var lang string
+	err := tp.db.QueryRow("SELECT value FROM translate_config WHERE key = ?", "target_lang").Scan(&lang)
+	if err != nil || lang == "" {
+		return translateDefaultTarget
+	}
+	return lang
+}
+
+// translate 依次尝试各个后端，过长的文本拆分后分别翻译。返回译文、源语言和使用的后端
+func (tp *TranslatePlugin) translate(ctx context.Context, text, target string) (string, string, string, error) {
+	chunks := splitTranslateText(text, translateChunkSize)
+
+	var errs []string
+	for _, backend := range tp.backends {
+		translated, source, err := translateChunks(ctx, backend, chunks, target)
+		if err == nil {
+			return translated, source, backend.Name(), nil
+		}
+		if errors.Is(err, errTranslatorUnavailable) {
+			continue
+		}
+		logger.Ctx(ctx).Warnf("Translate backend %s failed: %v", backend.Name(), err)
+		errs = append(errs, fmt.Sprintf("%s: %v", backend.Name(), err))
+	}
+	if len(errs) == 0 {
+		return "", "", "", fmt.Errorf("没有可用的翻译后端")
+	}
+	return "", "", "", errors.New(strings.Join(errs, "; "))
+}
+
+// translateChunks 使用同一个后端依次翻译每一段，源语言以第一段为准
+func translateChunks(ctx context.Context, backend translator, chunks []string, target string) (string, string, error) {
+	var b strings.Builder
+	var source string
+	for i, chunk := range chunks {
+		translated, detected, err := backend.Translate(ctx, chunk, target)
+		if err != nil {
+			return "", "", err
+		}
+		if i == 0 {
+			source = detected
+		} else {
+			b.WriteString("\n")
+		}
+		b.WriteString(translated)
+	}
+	return b.String(), source, nil
+}
+
+// splitTranslateText 把文本拆分为长度不超过limit的多段，尽量在换行处拆分
+func splitTranslateText(text string, limit int) []string {
+	var chunks []string
+	for text != "" {
+		cut := format.SplitIndex(text, limit)
+		chunks = append(chunks, strings.TrimSuffix(text[:cut], "\n"))
+		text = text[cut:]
+	}
+	return chunks
+}
+
+// googleTranslator 谷歌翻译的免费接口
+type googleTranslator struct {
+	client *http.Client
+}
+
+// Name 实现translator接口
+func (g *googleTranslator) Name() string {
+	return "Google"
+}
+
+// Translate 实现translator接口
+func (g *googleTranslator) Translate(ctx context.Context, text, target string) (string, string, error) {
+	params := url.Values{
+		"client": {"gtx"},
+		"sl":     {"auto"},
+		"tl":     {target},
+		"dt":     {"t"},
+		"q":      {text},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://translate.googleapis.com/translate_a/single",
+		strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", "", fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("发送HTTP请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		return "", "", fmt.Errorf("响应异常 (状态码: %d)", resp.StatusCode)
+	}
+	return parseGoogleTranslate(body)
+}
+
+// parseGoogleTranslate 解析谷歌翻译的响应：[[["译文","原文",...],...],null,"源语言",...]
+func parseGoogleTranslate(body []byte) (string, string, error) {
+	var response []json.RawMessage
+	if err := json.Unmarshal(body, &response); err != nil || len(response) == 0 {
+		return "", "", fmt.Errorf("解析JSON出错: %v", err)
+	}
+
+	var sentences [][]interface{}
+	if err := json.Unmarshal(response[0], &sentences); err != nil {
+		return "", "", fmt.Errorf("解析JSON出错: %w", err)
+	}
+	var b strings.Builder
+	for _, sentence := range sentences {
+		if len(sentence) > 0 {
+			if s, ok := sentence[0].(string); ok {
+				b.WriteString(s)
+			}
+		}
+	}
+	if b.Len() == 0 {
+		return "", "", fmt.Errorf("翻译结果为空")
+	}
+
+	var source string
+	if len(response) > 2 {
+		json.Unmarshal(response[2], &source)
+	}
+	return b.String(), source, nil
+}
+
+// geminiTranslator 使用gemini插件保存的API key和模型翻译
+type geminiTranslator struct {
+	client *http.Client
+	plugin *TranslatePlugin
+}
+
+// geminiTranslation 要求Gemini返回的JSON结构
+type geminiTranslation struct {
+	Source      string `json:"source"`
+	Translation string `json:"translation"`
+}
+
+// Name 实现translator接口
+func (g *geminiTranslator) Name() string {
+	return "Gemini"
+}
+
+// Translate 实现translator接口，未设置API key时返回errTranslatorUnavailable
+func (g *geminiTranslator) Translate(ctx context.Context, text, target string) (string, string, error) {
+	apiKey, err := loadSecret(g.plugin.manager, "gemini.api_key", func() (string, error) {
+		return g.config("gemini_key")
+	})
+	if errors.Is(err, secrets.ErrLocked) || (err == nil && apiKey == "") {
+		return "", "", errTranslatorUnavailable
+	}
+	if err != nil {
+		return "", "", err
+	}
+	model, _, _ := pluginStorage(g.plugin.manager).Get("gemini", "gemini_model")
+	if model == "" {
+		model = "gemini-1.5-flash"
+	}
+
+	prompt := fmt.Sprintf("Translate the text below into the language with code %q. "+
+		"Reply with JSON only: {\"source\": \"<ISO 639-1 code of the source language>\", \"translation\": \"<translated text>\"}. "+
+		"Keep line breaks and do not add explanations.\n\n%s", target, text)
+	request := GeminiRequest{
+		Contents:         []GeminiContent{{Role: "user", Parts: []GeminiPart{{Text: prompt}}}},
+		GenerationConfig: &GeminiGenerationConfig{ResponseMimeType: "application/json"},
+	}
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return "", "", fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	apiURL := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, apiKey)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", "", fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("发送HTTP请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("读取响应失败: %w", err)
+	}
+	var response GeminiResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", "", fmt.Errorf("解析JSON出错: %w", err)
+	}
+	if response.Error != nil {
+		return "", "", fmt.Errorf("%s", response.Error.Message)
+	}
+	if resp.StatusCode != 200 {
+		return "", "", fmt.Errorf("响应异常 (状态码: %d)", resp.StatusCode)
+	}
+	if len(response.Candidates) == 0 || len(response.Candidates[0].Content.Parts) == 0 {
+		return "", "", fmt.Errorf("有响应但是无法获取翻译，可能是未通过谷歌的审核")
+	}
+
+	answer := strings.TrimSpace(response.Candidates[0].Content.Parts[0].Text)
+	answer = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(answer, "```json"), "```"), "```")
+	var result geminiTranslation
+	if err := json.Unmarshal([]byte(answer), &result); err != nil || result.Translation == "" {
+		return "", "", fmt.Errorf("无法解析翻译结果")
+	}
+	return result.Translation, result.Source, nil
+}
+
+// config 读取gemini插件以明文保存的配置(未启用密钥库时的API key)
+func (g *geminiTranslator) config(key string) (string, error) {
+	var value string
+	err := g.plugin.db.QueryRow("SELECT value FROM gemini_config WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+// usage 返回tr命令的用法
+func (tp *TranslatePlugin) usage() string {
+	return fmt.Sprintf(`用法:
+• .tr [语言] <文本> - 翻译文本
+• .tr [语言] - 回复消息使用，翻译该消息
+• .tr set <语言> - 设置默认目标语言(当前: %s)
+
+语言使用语言代码，例如 en、zh、zh-TW、ja；省略时使用默认目标语言`, tp.defaultTarget())
+}
+
+// sendResponse 发送响应消息，过长时拆分为多条
+func (tp *TranslatePlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
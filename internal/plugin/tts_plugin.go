@@ -0,0 +1,551 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/secrets"
+	"nexusvalet/pkg/logger"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// ttsMaxChars 单次合成的最大字符数
+	ttsMaxChars = 1000
+	// ttsMaxDuration 合成语音的最大时长
+	ttsMaxDuration = 5 * time.Minute
+	// ttsDefaultVoice 默认音色
+	ttsDefaultVoice = "zh-CN-XiaoxiaoNeural"
+	// ttsWaveformSamples 语音波形采样点数量
+	ttsWaveformSamples = 100
+)
+
+// TTSProvider 语音合成后端
+type TTSProvider interface {
+	// Name 返回后端名称
+	Name() string
+	// Synthesize 合成语音，返回音频数据(任意ffmpeg可识别的格式)
+	Synthesize(ctx context.Context, text, voice string) ([]byte, error)
+}
+
+// EdgeTTSProvider 兼容 edge-tts HTTP 服务(OpenAI /v1/audio/speech 格式)的后端
+type EdgeTTSProvider struct {
+	BaseURL    string
+	APIKey     string
+	httpClient *http.Client
+}
+
+// NewEdgeTTSProvider 创建 edge-tts HTTP 后端
+func NewEdgeTTSProvider(baseURL, apiKey string) *EdgeTTSProvider {
+	return &EdgeTTSProvider{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		APIKey:  apiKey,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// Name 返回后端名称
+func (p *EdgeTTSProvider) Name() string {
+	return "edge"
+}
+
+// Synthesize 通过HTTP接口合成语音
+func (p *EdgeTTSProvider) Synthesize(ctx context.Context, text, voice string) ([]byte, error) {
+	if p.BaseURL == "" {
+		return nil, fmt.Errorf("未配置 edge-tts 服务地址，请使用 .tts config url <地址>")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model":           "tts-1",
+		"input":           text,
+		"voice":           voice,
+		"response_format": "mp3",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+"/v1/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 edge-tts 服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取 edge-tts 响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("edge-tts 服务返回状态码 %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("edge-tts 服务返回空音频")
+	}
+
+	return data, nil
+}
+
+// PiperProvider 本地 piper 可执行文件后端，voice 为模型文件路径
+type PiperProvider struct {
+	BinaryPath string
+}
+
+// DetectPiperProvider 在PATH中查找piper，找不到返回nil
+func DetectPiperProvider() *PiperProvider {
+	path, err := exec.LookPath("piper")
+	if err != nil {
+		return nil
+	}
+	return &PiperProvider{BinaryPath: path}
+}
+
+// Name 返回后端名称
+func (p *PiperProvider) Name() string {
+	return "piper"
+}
+
+// Synthesize 调用piper合成WAV
+func (p *PiperProvider) Synthesize(ctx context.Context, text, voice string) ([]byte, error) {
+	if voice == "" || !strings.HasSuffix(voice, ".onnx") {
+		return nil, fmt.Errorf("piper 需要模型文件路径作为音色，例如 .tts config voice /path/zh_CN-huayan-medium.onnx")
+	}
+
+	out, err := os.CreateTemp("", "nexusvalet_tts_*.wav")
+	if err != nil {
+		return nil, err
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	cmd := exec.CommandContext(ctx, p.BinaryPath, "--model", voice, "--output_file", out.Name())
+	cmd.Stdin = strings.NewReader(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("piper 执行失败: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return os.ReadFile(out.Name())
+}
+
+// VoiceNote 转换后的语音消息
+type VoiceNote struct {
+	Data     []byte
+	Duration time.Duration
+	Waveform []byte
+}
+
+// voiceNoteAttributes 构造语音消息的文档属性
+func voiceNoteAttributes(note *VoiceNote) []tg.DocumentAttributeClass {
+	return []tg.DocumentAttributeClass{
+		&tg.DocumentAttributeAudio{
+			Voice:    true,
+			Duration: int(math.Ceil(note.Duration.Seconds())),
+			Waveform: note.Waveform,
+		},
+	}
+}
+
+// encodeWaveform 将0-31的采样值按5位打包为Telegram语音波形格式
+func encodeWaveform(samples []byte) []byte {
+	bitCount := len(samples) * 5
+	out := make([]byte, (bitCount+7)/8)
+	for i, v := range samples {
+		v &= 0x1f
+		bit := i * 5
+		for j := 0; j < 5; j++ {
+			if v&(1<<j) != 0 {
+				out[(bit+j)/8] |= 1 << ((bit + j) % 8)
+			}
+		}
+	}
+	return out
+}
+
+// waveformFromPCM 从16位单声道PCM计算波形采样(0-31)
+func waveformFromPCM(pcm []int16, count int) []byte {
+	samples := make([]byte, count)
+	if len(pcm) == 0 || count == 0 {
+		return samples
+	}
+
+	peaks := make([]float64, count)
+	maxPeak := 0.0
+	for i := 0; i < count; i++ {
+		start := i * len(pcm) / count
+		end := (i + 1) * len(pcm) / count
+		if end <= start {
+			end = start + 1
+		}
+		if end > len(pcm) {
+			end = len(pcm)
+		}
+		for _, s := range pcm[start:end] {
+			if a := math.Abs(float64(s)); a > peaks[i] {
+				peaks[i] = a
+			}
+		}
+		if peaks[i] > maxPeak {
+			maxPeak = peaks[i]
+		}
+	}
+
+	if maxPeak == 0 {
+		return samples
+	}
+	for i, p := range peaks {
+		samples[i] = byte(math.Round(p / maxPeak * 31))
+	}
+	return samples
+}
+
+// convertToVoiceNote 使用ffmpeg将音频转换为OGG/OPUS并计算时长和波形
+func convertToVoiceNote(ctx context.Context, audio []byte) (*VoiceNote, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, fmt.Errorf("未找到 ffmpeg，无法转换为语音消息，请先安装 ffmpeg")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "nexusvalet_tts")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	input := filepath.Join(tmpDir, "input")
+	output := filepath.Join(tmpDir, "voice.ogg")
+	if err := os.WriteFile(input, audio, 0644); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, ffmpeg, "-y", "-i", input, "-c:a", "libopus", "-b:a", "32k", "-ar", "48000", "-ac", "1", output)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg 转换失败: %v", err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		return nil, err
+	}
+
+	// 解码为8kHz单声道PCM以计算时长和波形
+	const sampleRate = 8000
+	pcmCmd := exec.CommandContext(ctx, ffmpeg, "-i", output, "-f", "s16le", "-ac", "1", "-ar", strconv.Itoa(sampleRate), "-")
+	raw, err := pcmCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg 解码失败: %v", err)
+	}
+
+	pcm := make([]int16, len(raw)/2)
+	for i := range pcm {
+		pcm[i] = int16(binary.LittleEndian.Uint16(raw[i*2:]))
+	}
+
+	return &VoiceNote{
+		Data:     data,
+		Duration: time.Duration(len(pcm)) * time.Second / sampleRate,
+		Waveform: encodeWaveform(waveformFromPCM(pcm, ttsWaveformSamples)),
+	}, nil
+}
+
+// TTSPlugin 文字转语音插件
+type TTSPlugin struct {
+	*BasePlugin
+	db *sql.DB
+}
+
+// NewTTSPlugin 创建文字转语音插件
+func NewTTSPlugin(db *sql.DB) *TTSPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "tts",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "文字转语音，以语音消息发送",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &TTSPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+
+	return plugin
+}
+
+// initDatabase 初始化数据库表
+func (tp *TTSPlugin) initDatabase() {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS tts_config (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`
+
+	_, err := tp.db.Exec(createTableSQL)
+	if err != nil {
+		logger.Errorf("Failed to create tts_config table: %v", err)
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (tp *TTSPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("tts", "文字转语音", tp.info.Name, tp.handleTTS)
+	logger.Infof("TTS commands registered successfully")
+	return nil
+}
+
+// handleTTS 处理tts命令
+func (tp *TTSPlugin) handleTTS(ctx *command.CommandContext) error {
+	if len(ctx.Args) > 0 && ctx.Args[0] == "config" {
+		return tp.handleConfig(ctx)
+	}
+
+	text := strings.TrimSpace(strings.Join(ctx.Args, " "))
+	if text == "" && ctx.Message.Message.ReplyTo != nil {
+		replyMsg, err := fetchReplyMessage(ctx)
+		if err != nil {
+			return tp.sendResponse(ctx, fmt.Sprintf("❌ 获取回复消息失败: %v", err))
+		}
+		text = strings.TrimSpace(replyMsg.Message)
+	}
+
+	if text == "" {
+		return tp.sendResponse(ctx, "用法: .tts <文本>，或回复一条消息使用 .tts\n配置: .tts config")
+	}
+	if n := len([]rune(text)); n > ttsMaxChars {
+		return tp.sendResponse(ctx, fmt.Sprintf("❌ 文本过长(%d字)，最多 %d 字", n, ttsMaxChars))
+	}
+
+	provider, err := tp.provider()
+	if err != nil {
+		return tp.sendResponse(ctx, fmt.Sprintf("❌ %v", err))
+	}
+
+	tp.sendResponse(ctx, "🔊 正在合成语音...")
+
+	synthCtx, cancel := context.WithTimeout(ctx.Context, 2*time.Minute)
+	defer cancel()
+
+	voice := tp.voiceFor(ctx.Message.ChatID)
+	audio, err := provider.Synthesize(synthCtx, text, voice)
+	if err != nil {
+		return tp.sendResponse(ctx, fmt.Sprintf("❌ 语音合成失败(%s): %v", provider.Name(), err))
+	}
+
+	note, err := convertToVoiceNote(synthCtx, audio)
+	if err != nil {
+		return tp.sendResponse(ctx, fmt.Sprintf("❌ %v", err))
+	}
+	if note.Duration > ttsMaxDuration {
+		return tp.sendResponse(ctx, fmt.Sprintf("❌ 语音时长 %s 超过上限 %s", note.Duration.Round(time.Second), ttsMaxDuration))
+	}
+
+	peer, err := ctx.PeerResolver.ResolveFromChatID(ctx.Context, ctx.Message.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+
+	err = sendDocument(ctx, peer, MediaUpload{
+		FileName:   "voice.ogg",
+		Data:       note.Data,
+		MimeType:   "audio/ogg",
+		Attributes: voiceNoteAttributes(note),
+		ReplyTo:    replyTargetFromContext(ctx),
+	})
+	if err != nil {
+		return tp.sendResponse(ctx, fmt.Sprintf("❌ %v", err))
+	}
+
+	if err := deleteCommandMessage(ctx, peer); err != nil {
+		logger.Warnf("删除命令消息失败: %v", err)
+	}
+	return nil
+}
+
+// serviceKey 获取edge-tts服务密钥，启用密钥库后从密钥库读取
+func (tp *TTSPlugin) serviceKey() (string, error) {
+	key, err := loadSecret(tp.manager, "tts.key", func() (string, error) {
+		return tp.getConfig("key"), nil
+	})
+	if errors.Is(err, secrets.ErrLocked) {
+		return "", errors.New(secretsLockedMessage)
+	}
+	return key, err
+}
+
+// handleConfig 处理tts配置
+func (tp *TTSPlugin) handleConfig(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return tp.showConfig(ctx)
+	}
+
+	key := ctx.Args[1]
+	value := strings.Join(ctx.Args[2:], " ")
+
+	switch key {
+	case "voice":
+		if value == "" {
+			return tp.sendResponse(ctx, "用法: .tts config voice <音色>")
+		}
+		tp.setConfig("voice", value)
+		return tp.sendResponse(ctx, fmt.Sprintf("✅ 默认音色已设置为 %s", value))
+	case "chatvoice":
+		chatKey := fmt.Sprintf("voice:%d", ctx.Message.ChatID)
+		if value == "" || value == "reset" {
+			tp.db.Exec("DELETE FROM tts_config WHERE key = ?", chatKey)
+			return tp.sendResponse(ctx, "✅ 已清除当前对话的音色设置")
+		}
+		tp.setConfig(chatKey, value)
+		return tp.sendResponse(ctx, fmt.Sprintf("✅ 当前对话音色已设置为 %s", value))
+	case "provider":
+		if value != "edge" && value != "piper" && value != "auto" {
+			return tp.sendResponse(ctx, "用法: .tts config provider <auto|edge|piper>")
+		}
+		tp.setConfig("provider", value)
+		return tp.sendResponse(ctx, fmt.Sprintf("✅ 语音后端已设置为 %s", value))
+	case "url":
+		tp.setConfig("url", value)
+		return tp.sendResponse(ctx, "✅ edge-tts 服务地址已设置")
+	case "key":
+		err := saveSecret(tp.manager, "tts.key", value, func(v string) error {
+			tp.setConfig("key", v)
+			return nil
+		})
+		if errors.Is(err, secrets.ErrLocked) {
+			return tp.sendResponse(ctx, "❌ "+secretsLockedMessage)
+		}
+		if err != nil {
+			return tp.sendResponse(ctx, fmt.Sprintf("❌ 保存密钥失败: %v", err))
+		}
+		return tp.sendResponse(ctx, "✅ edge-tts 服务密钥已设置")
+	default:
+		return tp.sendResponse(ctx, "未知配置项: "+key+"\n可用: voice, chatvoice, provider, url, key")
+	}
+}
+
+// showConfig 显示当前配置
+func (tp *TTSPlugin) showConfig(ctx *command.CommandContext) error {
+	provider := tp.getConfig("provider")
+	if provider == "" {
+		provider = "auto"
+	}
+	url := tp.getConfig("url")
+	if url == "" {
+		url = "(未设置)"
+	}
+	piper := "未检测到"
+	if p := DetectPiperProvider(); p != nil {
+		piper = p.BinaryPath
+	}
+
+	return tp.sendResponse(ctx, fmt.Sprintf(`🔊 TTS 配置
+• 后端: %s
+• 默认音色: %s
+• 当前对话音色: %s
+• edge-tts 地址: %s
+• piper: %s
+
+设置: .tts config <voice|chatvoice|provider|url|key> <值>`,
+		provider, tp.voiceFor(0), tp.voiceFor(ctx.Message.ChatID), url, piper))
+}
+
+// provider 根据配置选择语音后端，auto 时优先使用已配置的HTTP服务，其次本地piper
+func (tp *TTSPlugin) provider() (TTSProvider, error) {
+	mode := tp.getConfig("provider")
+	url := tp.getConfig("url")
+
+	switch mode {
+	case "edge":
+		key, err := tp.serviceKey()
+		if err != nil {
+			return nil, err
+		}
+		return NewEdgeTTSProvider(url, key), nil
+	case "piper":
+		if p := DetectPiperProvider(); p != nil {
+			return p, nil
+		}
+		return nil, fmt.Errorf("未在PATH中找到 piper")
+	}
+
+	if url != "" {
+		key, err := tp.serviceKey()
+		if err != nil {
+			return nil, err
+		}
+		return NewEdgeTTSProvider(url, key), nil
+	}
+	if p := DetectPiperProvider(); p != nil {
+		return p, nil
+	}
+	return nil, fmt.Errorf("没有可用的语音后端，请使用 .tts config url <edge-tts地址> 或安装 piper")
+}
+
+// voiceFor 返回对话使用的音色，对话设置优先于全局设置
+func (tp *TTSPlugin) voiceFor(chatID int64) string {
+	if chatID != 0 {
+		if v := tp.getConfig(fmt.Sprintf("voice:%d", chatID)); v != "" {
+			return v
+		}
+	}
+	if v := tp.getConfig("voice"); v != "" {
+		return v
+	}
+	return ttsDefaultVoice
+}
+
+// getConfig 获取配置
+func (tp *TTSPlugin) getConfig(key string) string {
+	var value string
+	if err := tp.db.QueryRow("SELECT value FROM tts_config WHERE key = ?", key).Scan(&value); err != nil {
+		return ""
+	}
+	return value
+}
+
+// setConfig 设置配置
+func (tp *TTSPlugin) setConfig(key, value string) {
+	if _, err := tp.db.Exec("INSERT OR REPLACE INTO tts_config (key, value) VALUES (?, ?)", key, value); err != nil {
+		logger.Errorf("Failed to save tts config %s: %v", key, err)
+	}
+}
+
+// sendResponse 发送响应消息
+func (tp *TTSPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
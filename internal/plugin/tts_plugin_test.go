@@ -0,0 +1,481 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"nexusvalet/internal/core"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// ttsSamplePCM 读取样例WAV(8kHz单声道16位，4400个采样)的PCM数据。
+// 100段各44个采样，第i段的峰值为 (i%32)*1000
+func ttsSamplePCM(t *testing.T) []int16 {
+	t.Helper()
+	data := readFixture(t, "tts_sample.wav")
+	raw := data[44:]
+	pcm := make([]int16, len(raw)/2)
+	for i := range pcm {
+		pcm[i] = int16(binary.LittleEndian.Uint16(raw[i*2:]))
+	}
+	return pcm
+}
+
+// decodeWaveform 按5位一个采样解出波形，用于检查 encodeWaveform
+func decodeWaveform(data []byte, count int) []byte {
+	samples := make([]byte, count)
+	for i := range samples {
+		for j := 0; j < 5; j++ {
+			bit := i*5 + j
+			if data[bit/8]&(1<<(bit%8)) != 0 {
+				samples[i] |= 1 << j
+			}
+		}
+	}
+	return samples
+}
+
+func TestEncodeWaveform(t *testing.T) {
+	tests := []struct {
+		samples []byte
+		want    []byte
+	}{
+		{[]byte{1, 2, 31}, []byte{0x41, 0x7c}},
+		{bytes.Repeat([]byte{31}, 8), bytes.Repeat([]byte{0xff}, 5)},
+		{[]byte{0x3f}, []byte{0x1f}}, // 超过5位的部分被丢弃
+		{nil, []byte{}},
+	}
+	for _, tt := range tests {
+		if got := encodeWaveform(tt.samples); !bytes.Equal(got, tt.want) {
+			t.Errorf("encodeWaveform(%v) = %x, want %x", tt.samples, got, tt.want)
+		}
+	}
+
+	samples := make([]byte, ttsWaveformSamples)
+	for i := range samples {
+		samples[i] = byte(i*7) % 32
+	}
+	encoded := encodeWaveform(samples)
+	if len(encoded) != 63 {
+		t.Errorf("100 samples encoded to %d bytes, want 63", len(encoded))
+	}
+	if got := decodeWaveform(encoded, len(samples)); !bytes.Equal(got, samples) {
+		t.Errorf("decoded waveform = %v, want %v", got, samples)
+	}
+}
+
+func TestWaveformFromPCM(t *testing.T) {
+	want := make([]byte, ttsWaveformSamples)
+	for i := range want {
+		want[i] = byte(i % 32)
+	}
+	if got := waveformFromPCM(ttsSamplePCM(t), ttsWaveformSamples); !bytes.Equal(got, want) {
+		t.Errorf("waveform = %v, want %v", got, want)
+	}
+
+	// 静音、空数据和采样少于点数时不出错
+	if got := waveformFromPCM(make([]int16, 500), 10); !bytes.Equal(got, make([]byte, 10)) {
+		t.Errorf("silent waveform = %v", got)
+	}
+	if got := waveformFromPCM(nil, 10); !bytes.Equal(got, make([]byte, 10)) {
+		t.Errorf("empty waveform = %v", got)
+	}
+	if got := waveformFromPCM([]int16{-100, 50, 0}, 5); !bytes.Equal(got, []byte{31, 31, 16, 16, 0}) {
+		t.Errorf("short waveform = %v", got)
+	}
+}
+
+func TestVoiceNoteAttributes(t *testing.T) {
+	waveform := encodeWaveform([]byte{1, 2, 3})
+	tests := []struct {
+		duration time.Duration
+		want     int
+	}{
+		{550 * time.Millisecond, 1},
+		{2 * time.Second, 2},
+		{2001 * time.Millisecond, 3},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		attrs := voiceNoteAttributes(&VoiceNote{Duration: tt.duration, Waveform: waveform})
+		want := []tg.DocumentAttributeClass{&tg.DocumentAttributeAudio{Voice: true, Duration: tt.want, Waveform: waveform}}
+		if !reflect.DeepEqual(attrs, want) {
+			t.Errorf("attributes for %s = %#v, want %#v", tt.duration, attrs, want)
+		}
+	}
+}
+
+func TestEdgeTTSProvider(t *testing.T) {
+	audio := readFixture(t, "tts_sample.wav")
+	var got struct {
+		path, auth string
+		body       map[string]interface{}
+	}
+	status := http.StatusOK
+	response := audio
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.path, got.auth = r.URL.Path, r.Header.Get("Authorization")
+		data, _ := io.ReadAll(r.Body)
+		got.body = nil
+		json.Unmarshal(data, &got.body)
+		w.WriteHeader(status)
+		w.Write(response)
+	}))
+	defer server.Close()
+
+	p := NewEdgeTTSProvider(server.URL+"/", "secret")
+	var provider TTSProvider = p
+	if provider.Name() != "edge" {
+		t.Errorf("Name = %q", provider.Name())
+	}
+	data, err := provider.Synthesize(context.Background(), "你好", "zh-CN-YunxiNeural")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, audio) {
+		t.Error("Synthesize should return the response body")
+	}
+	if got.path != "/v1/audio/speech" || got.auth != "Bearer secret" {
+		t.Errorf("request path = %q, auth = %q", got.path, got.auth)
+	}
+	wantBody := map[string]interface{}{"model": "tts-1", "input": "你好", "voice": "zh-CN-YunxiNeural", "response_format": "mp3"}
+	if !reflect.DeepEqual(got.body, wantBody) {
+		t.Errorf("request body = %v, want %v", got.body, wantBody)
+	}
+
+	// 没有密钥时不发送 Authorization
+	if _, err := NewEdgeTTSProvider(server.URL, "").Synthesize(context.Background(), "x", "v"); err != nil || got.auth != "" {
+		t.Errorf("without key: err = %v, auth = %q", err, got.auth)
+	}
+
+	status, response = http.StatusServiceUnavailable, []byte("overloaded\n")
+	if _, err := p.Synthesize(context.Background(), "x", "v"); err == nil || err.Error() != "edge-tts 服务返回状态码 503: overloaded" {
+		t.Errorf("error status: err = %v", err)
+	}
+	status, response = http.StatusOK, nil
+	if _, err := p.Synthesize(context.Background(), "x", "v"); err == nil || err.Error() != "edge-tts 服务返回空音频" {
+		t.Errorf("empty audio: err = %v", err)
+	}
+	if _, err := NewEdgeTTSProvider("", "").Synthesize(context.Background(), "x", "v"); err == nil || !strings.Contains(err.Error(), ".tts config url") {
+		t.Errorf("without url: err = %v", err)
+	}
+}
+
+// fakeTTSTools 在临时目录中创建假的 piper 和 ffmpeg，并把该目录设为PATH。
+// piper 把收到的文本和参数写入 piper.log 并输出样例WAV；ffmpeg 转换时原样复制输入，
+// 解码时输出 $FAKE_FFMPEG_PCM 或输入WAV的PCM数据
+func fakeTTSTools(t *testing.T, piper, ffmpeg bool) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tools are shell scripts")
+	}
+	dir := t.TempDir()
+	sample, err := filepath.Abs(filepath.Join("testdata", "tts_sample.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scripts := map[string]string{}
+	if piper {
+		scripts["piper"] = `#!/bin/sh
+out=""; prev=""
+for a in "$@"; do [ "$prev" = "--output_file" ] && out="$a"; prev="$a"; done
+echo "$@" > "` + dir + `/piper.log"
+cat >> "` + dir + `/piper.log"
+case "$*" in *broken.onnx*) echo "model not found" >&2; exit 1;; esac
+cp "` + sample + `" "$out"
+`
+	}
+	if ffmpeg {
+		scripts["ffmpeg"] = `#!/bin/sh
+in=""; prev=""; last=""
+for a in "$@"; do [ "$prev" = "-i" ] && in="$a"; prev="$a"; last="$a"; done
+if [ "$last" != "-" ]; then cp "$in" "$last"; exit 0; fi
+if [ -n "$FAKE_FFMPEG_PCM" ]; then cat "$FAKE_FFMPEG_PCM"; else tail -c +45 "$in"; fi
+`
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+"/bin"+string(os.PathListSeparator)+"/usr/bin")
+	return dir
+}
+
+func TestPiperProvider(t *testing.T) {
+	dir := fakeTTSTools(t, true, false)
+
+	p := DetectPiperProvider()
+	if p == nil || p.BinaryPath != filepath.Join(dir, "piper") {
+		t.Fatalf("DetectPiperProvider = %+v", p)
+	}
+	data, err := p.Synthesize(context.Background(), "你好，今天的会议改到三点", "/models/zh_CN-huayan-medium.onnx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, readFixture(t, "tts_sample.wav")) {
+		t.Error("Synthesize should return the WAV written by piper")
+	}
+	log, _ := os.ReadFile(filepath.Join(dir, "piper.log"))
+	lines := strings.SplitN(string(log), "\n", 2)
+	if !strings.HasPrefix(lines[0], "--model /models/zh_CN-huayan-medium.onnx --output_file ") || lines[1] != "你好，今天的会议改到三点" {
+		t.Errorf("piper log = %q", log)
+	}
+
+	for _, voice := range []string{"", "zh-CN-XiaoxiaoNeural"} {
+		if _, err := p.Synthesize(context.Background(), "x", voice); err == nil || !strings.Contains(err.Error(), "模型文件路径") {
+			t.Errorf("voice %q: err = %v", voice, err)
+		}
+	}
+	if _, err := p.Synthesize(context.Background(), "x", "broken.onnx"); err == nil || !strings.Contains(err.Error(), "model not found") {
+		t.Errorf("failing piper: err = %v", err)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if DetectPiperProvider() != nil {
+		t.Error("DetectPiperProvider should return nil without piper on PATH")
+	}
+}
+
+func TestConvertToVoiceNote(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := convertToVoiceNote(context.Background(), []byte("audio")); err == nil || !strings.Contains(err.Error(), "未找到 ffmpeg") {
+		t.Fatalf("without ffmpeg: err = %v", err)
+	}
+
+	fakeTTSTools(t, false, true)
+	audio := readFixture(t, "tts_sample.wav")
+	note, err := convertToVoiceNote(context.Background(), audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(note.Data, audio) {
+		t.Error("Data should be the converted file")
+	}
+	if note.Duration != 550*time.Millisecond {
+		t.Errorf("Duration = %s, want 550ms", note.Duration)
+	}
+	want := make([]byte, ttsWaveformSamples)
+	for i := range want {
+		want[i] = byte(i % 32)
+	}
+	if got := decodeWaveform(note.Waveform, ttsWaveformSamples); !bytes.Equal(got, want) {
+		t.Errorf("waveform = %v, want %v", got, want)
+	}
+}
+
+func TestTTSProviderSelection(t *testing.T) {
+	tp := NewTTSPlugin(openPluginDB(t))
+	t.Setenv("PATH", t.TempDir())
+
+	if _, err := tp.provider(); err == nil || !strings.HasPrefix(err.Error(), "没有可用的语音后端") {
+		t.Errorf("no backend: err = %v", err)
+	}
+	tp.setConfig("provider", "piper")
+	if _, err := tp.provider(); err == nil || err.Error() != "未在PATH中找到 piper" {
+		t.Errorf("piper without binary: err = %v", err)
+	}
+
+	// auto 时优先使用已配置的HTTP服务，未启用密钥库时密钥保存在配置表中
+	fakeTTSTools(t, true, false)
+	tp.setConfig("provider", "auto")
+	if p, err := tp.provider(); err != nil || p.Name() != "piper" {
+		t.Errorf("auto with piper = %v, %v", p, err)
+	}
+	tp.setConfig("url", "http://tts.local/")
+	tp.setConfig("key", "k")
+	p, err := tp.provider()
+	edge, ok := p.(*EdgeTTSProvider)
+	if err != nil || !ok || edge.BaseURL != "http://tts.local" || edge.APIKey != "k" {
+		t.Errorf("auto with url = %#v, %v", p, err)
+	}
+	tp.setConfig("provider", "piper")
+	if p, err := tp.provider(); err != nil || p.Name() != "piper" {
+		t.Errorf("forced piper = %v, %v", p, err)
+	}
+	tp.setConfig("provider", "edge")
+	tp.setConfig("url", "")
+	if p, err := tp.provider(); err != nil || p.Name() != "edge" {
+		t.Errorf("forced edge = %v, %v", p, err)
+	}
+}
+
+// ttsTestEnv 创建注册了tts命令的测试环境，getMessages 返回 replies 中的消息
+func ttsTestEnv(t *testing.T, replies map[int]string) (*TTSPlugin, *testEnv) {
+	t.Helper()
+	tp := NewTTSPlugin(openPluginDB(t))
+	env := newTestEnv()
+	env.inv.handle = func(input bin.Encoder, output bin.Decoder) error {
+		req, ok := input.(*tg.MessagesGetMessagesRequest)
+		if !ok {
+			return errUnhandled
+		}
+		id := req.ID[0].(*tg.InputMessageID).ID
+		var msgs []tg.MessageClass
+		if text, ok := replies[id]; ok {
+			msgs = append(msgs, &tg.Message{ID: id, Message: text})
+		}
+		output.(*tg.MessagesMessagesBox).Messages = &tg.MessagesMessages{Messages: msgs}
+		return nil
+	}
+	tp.RegisterCommands(env.parser)
+	return tp, env
+}
+
+// editedTexts 返回编辑消息请求的内容
+func editedTexts(env *testEnv) []string {
+	var texts []string
+	for _, req := range requests[*tg.MessagesEditMessageRequest](env.inv) {
+		texts = append(texts, req.Message)
+	}
+	return texts
+}
+
+func TestTTSVoiceConfig(t *testing.T) {
+	tp, env := ttsTestEnv(t, nil)
+	otherChat := &core.MessageEvent{ChatID: -200, UserID: 1}
+
+	if tp.voiceFor(-100) != ttsDefaultVoice {
+		t.Errorf("default voice = %q", tp.voiceFor(-100))
+	}
+	var responses []string
+	for _, command := range []string{
+		"tts config voice zh-CN-YunxiNeural",
+		"tts config chatvoice zh-CN-XiaoyiNeural",
+		"tts config provider bogus",
+	} {
+		responses = append(responses, env.runText(t, nil, command))
+	}
+	if got := tp.voiceFor(-100); got != "zh-CN-XiaoyiNeural" {
+		t.Errorf("chat voice = %q", got)
+	}
+	if got := tp.voiceFor(-200); got != "zh-CN-YunxiNeural" {
+		t.Errorf("other chat voice = %q", got)
+	}
+	if got := tp.voiceFor(0); got != "zh-CN-YunxiNeural" {
+		t.Errorf("global voice = %q", got)
+	}
+
+	// 其他对话清除设置不影响当前对话
+	responses = append(responses, env.runText(t, otherChat, "tts config chatvoice reset"))
+	if got := tp.voiceFor(-100); got != "zh-CN-XiaoyiNeural" {
+		t.Errorf("chat voice after other chat reset = %q", got)
+	}
+	responses = append(responses, env.runText(t, nil, "tts config chatvoice reset"))
+	if got := tp.voiceFor(-100); got != "zh-CN-YunxiNeural" {
+		t.Errorf("chat voice after reset = %q", got)
+	}
+
+	want := []string{
+		"✅ 默认音色已设置为 zh-CN-YunxiNeural",
+		"✅ 当前对话音色已设置为 zh-CN-XiaoyiNeural",
+		"用法: .tts config provider <auto|edge|piper>",
+		"✅ 已清除当前对话的音色设置",
+		"✅ 已清除当前对话的音色设置",
+	}
+	if !reflect.DeepEqual(responses, want) {
+		t.Errorf("responses = %q, want %q", responses, want)
+	}
+}
+
+func TestTTSCommandSendsVoiceNote(t *testing.T) {
+	dir := fakeTTSTools(t, true, true)
+	tp, env := ttsTestEnv(t, map[int]string{7: "  被回复的消息  "})
+	tp.setConfig("provider", "piper")
+	tp.setConfig("voice", "/models/zh.onnx")
+
+	if _, err := env.run(nil, "tts 你好，今天的会议改到三点"); err != nil {
+		t.Fatal(err)
+	}
+	sent := requests[*tg.MessagesSendMediaRequest](env.inv)
+	if len(sent) != 1 {
+		t.Fatalf("sent %d media, want 1", len(sent))
+	}
+	doc, ok := sent[0].Media.(*tg.InputMediaUploadedDocument)
+	if !ok || doc.MimeType != "audio/ogg" {
+		t.Fatalf("media = %#v", sent[0].Media)
+	}
+	want := make([]byte, ttsWaveformSamples)
+	for i := range want {
+		want[i] = byte(i % 32)
+	}
+	wantAttrs := []tg.DocumentAttributeClass{
+		&tg.DocumentAttributeFilename{FileName: "voice.ogg"},
+		&tg.DocumentAttributeAudio{Voice: true, Duration: 1, Waveform: encodeWaveform(want)},
+	}
+	if !reflect.DeepEqual(doc.Attributes, wantAttrs) {
+		t.Errorf("attributes = %#v, want %#v", doc.Attributes, wantAttrs)
+	}
+	if sent[0].ReplyTo != nil {
+		t.Errorf("ReplyTo = %#v, want nil", sent[0].ReplyTo)
+	}
+	if n := len(requests[*tg.MessagesDeleteMessagesRequest](env.inv)); n != 1 {
+		t.Errorf("deleted command message %d times, want 1", n)
+	}
+
+	// 回复消息时合成被回复消息的文字，语音回复同一条消息
+	reply := &core.MessageEvent{ChatID: -100, UserID: 1, Message: &tg.Message{ID: 10, ReplyTo: &tg.MessageReplyHeader{ReplyToMsgID: 7}}}
+	if _, err := env.run(reply, "tts"); err != nil {
+		t.Fatal(err)
+	}
+	log, _ := os.ReadFile(filepath.Join(dir, "piper.log"))
+	if !strings.HasSuffix(string(log), "\n被回复的消息") {
+		t.Errorf("piper input = %q", log)
+	}
+	sent = requests[*tg.MessagesSendMediaRequest](env.inv)
+	if len(sent) != 2 || !reflect.DeepEqual(sent[1].ReplyTo, &tg.InputReplyToMessage{ReplyToMsgID: 7}) {
+		t.Errorf("reply voice note = %#v", sent[len(sent)-1].ReplyTo)
+	}
+}
+
+func TestTTSCommandLimits(t *testing.T) {
+	dir := fakeTTSTools(t, true, true)
+	tp, env := ttsTestEnv(t, map[int]string{8: ""})
+	tp.setConfig("provider", "piper")
+	tp.setConfig("voice", "/models/zh.onnx")
+
+	// 解码得到 5分1秒 的静音
+	long := filepath.Join(dir, "long.pcm")
+	if err := os.WriteFile(long, make([]byte, 8000*2*301), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		msgEvent *core.MessageEvent
+		command  string
+		pcm      string
+		want     string
+	}{
+		{nil, "tts", "", "用法: .tts <文本>，或回复一条消息使用 .tts\n配置: .tts config"},
+		{&core.MessageEvent{ChatID: -100, UserID: 1, Message: &tg.Message{ID: 10, ReplyTo: &tg.MessageReplyHeader{ReplyToMsgID: 8}}}, "tts", "",
+			"用法: .tts <文本>，或回复一条消息使用 .tts\n配置: .tts config"},
+		{nil, "tts " + strings.Repeat("字", ttsMaxChars+1), "", "❌ 文本过长(1001字)，最多 1000 字"},
+		{nil, "tts x", long, "❌ 语音时长 5m1s 超过上限 5m0s"},
+	}
+	for _, tt := range tests {
+		t.Setenv("FAKE_FFMPEG_PCM", tt.pcm)
+		out, err := env.run(tt.msgEvent, tt.command)
+		if err != nil {
+			t.Fatalf("%.20s: %v", tt.command, err)
+		}
+		if out == nil || out.Text != tt.want {
+			t.Errorf("%.20s: response %+v, want %q", tt.command, out, tt.want)
+		}
+	}
+	if n := len(requests[*tg.MessagesSendMediaRequest](env.inv)); n != 0 {
+		t.Errorf("sent %d voice notes, want 0", n)
+	}
+}
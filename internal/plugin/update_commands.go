@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/update"
+	"nexusvalet/internal/version"
+	"nexusvalet/pkg/logger"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxChangelogLength 更新说明中显示的更新日志最大长度(字符)
+const maxChangelogLength = 1500
+
+// handleUpdate 处理update命令：check 检查GitHub上是否有新版本，apply 下载并替换当前程序后重启
+func (cp *CoreCommandsPlugin) handleUpdate(ctx *command.CommandContext) error {
+	sub := "check"
+	if len(ctx.Args) > 0 {
+		sub = ctx.Args[0]
+	}
+	if sub != "check" && sub != "apply" {
+		return cp.sendResponse(ctx, "用法: .update [check|apply]")
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx.Context, 5*time.Minute)
+	defer cancel()
+
+	checker := update.NewChecker(update.DefaultRepo)
+	rel, err := checker.Latest(checkCtx)
+	if err != nil {
+		return cp.sendResponse(ctx, fmt.Sprintf("❌ 检查更新失败: %v", err))
+	}
+
+	current := version.String()
+	newer := version.Valid(current) && version.Compare(current, rel.TagName) < 0
+	if sub == "check" {
+		return cp.sendResponse(ctx, formatRelease(rel, current, newer))
+	}
+
+	if !newer && !ctx.HasFlag("force") {
+		return cp.sendResponse(ctx, fmt.Sprintf("✅ 当前版本 %s 不低于最新发布 %s，无需更新（开发版本或需要重新安装时使用 --force）", current, rel.TagName))
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return cp.sendResponse(ctx, fmt.Sprintf("❌ 无法确定当前程序的路径: %v", err))
+	}
+
+	if err := cp.sendResponse(ctx, fmt.Sprintf("⬇️ 正在下载 %s...", rel.TagName)); err != nil {
+		logger.Warnf("Failed to send update progress: %v", err)
+	}
+	if err := checker.Apply(checkCtx, rel, exe); err != nil {
+		return cp.sendResponse(ctx, fmt.Sprintf("❌ 更新失败: %v", err))
+	}
+	logger.Infof("Updated executable %s to %s, restarting", exe, rel.TagName)
+	return cp.handleRestart(ctx)
+}
+
+// formatRelease 格式化检查更新的结果
+func formatRelease(rel *update.Release, current string, newer bool) string {
+	var b strings.Builder
+	switch {
+	case newer:
+		b.WriteString(fmt.Sprintf("🆕 发现新版本 %s（当前 %s）", rel.TagName, current))
+	case !version.Valid(current):
+		b.WriteString(fmt.Sprintf("ℹ️ 当前为开发版本 %s，最新发布为 %s", current, rel.TagName))
+	default:
+		b.WriteString(fmt.Sprintf("✅ 已是最新版本 %s（最新发布 %s）", current, rel.TagName))
+	}
+	if !rel.Published.IsZero() {
+		b.WriteString("\n发布时间: " + rel.Published.Local().Format("2006-01-02 15:04"))
+	}
+	if newer {
+		if changelog := strings.TrimSpace(rel.Body); changelog != "" {
+			if runes := []rune(changelog); len(runes) > maxChangelogLength {
+				changelog = string(runes[:maxChangelogLength]) + "..."
+			}
+			b.WriteString("\n\n更新内容:\n" + changelog)
+		}
+		b.WriteString("\n\n使用 .update apply 下载并重启")
+	}
+	if rel.HTMLURL != "" {
+		b.WriteString("\n" + rel.HTMLURL)
+	}
+	return b.String()
+}
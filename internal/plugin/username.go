@@ -0,0 +1,35 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"nexusvalet/internal/cache"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// usernameMisses 不存在的用户名的负缓存，避免反复查询同一个无效用户名触发FloodWait
+var usernameMisses = cache.New[string, string]("username_negative", cache.Options{
+	TTL:        10 * time.Minute,
+	MaxEntries: 1000,
+})
+
+// resolveUsername 解析用户名。近期已确认不存在的用户名直接返回错误，不再请求API
+func resolveUsername(ctx context.Context, api *tg.Client, username string) (*tg.ContactsResolvedPeer, error) {
+	key := strings.ToLower(strings.TrimPrefix(username, "@"))
+	if reason, ok := usernameMisses.Get(key); ok {
+		return nil, fmt.Errorf("%s (缓存)", reason)
+	}
+
+	resolved, err := api.ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{Username: key})
+	if err != nil {
+		if tgerr.Is(err, "USERNAME_NOT_OCCUPIED", "USERNAME_INVALID") {
+			usernameMisses.Set(key, err.Error())
+		}
+		return nil, err
+	}
+	return resolved, nil
+}
@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+func TestResolveUsernameNegativeCache(t *testing.T) {
+	usernameMisses.Clear()
+	t.Cleanup(usernameMisses.Clear)
+
+	inv := &fakeInvoker{handle: func(input bin.Encoder, output bin.Decoder) error {
+		req, ok := input.(*tg.ContactsResolveUsernameRequest)
+		if !ok {
+			return errUnhandled
+		}
+		switch req.Username {
+		case "ghost":
+			return tgerr.New(400, "USERNAME_NOT_OCCUPIED")
+		case "flaky":
+			return tgerr.New(420, "FLOOD_WAIT_5")
+		}
+		*output.(*tg.ContactsResolvedPeer) = tg.ContactsResolvedPeer{Peer: &tg.PeerUser{UserID: 7}}
+		return nil
+	}}
+	api := tg.NewClient(inv)
+	ctx := context.Background()
+
+	// 不存在的用户名只查询一次，之后直接返回缓存的错误；大小写和@前缀视为同一个用户名
+	for _, name := range []string{"ghost", "@Ghost", "GHOST"} {
+		_, err := resolveUsername(ctx, api, name)
+		if err == nil || !strings.Contains(err.Error(), "USERNAME_NOT_OCCUPIED") {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	if n := len(requests[*tg.ContactsResolveUsernameRequest](inv)); n != 1 {
+		t.Errorf("ghost resolved %d times, want 1", n)
+	}
+	if _, err := resolveUsername(ctx, api, "ghost"); !strings.HasSuffix(err.Error(), "(缓存)") {
+		t.Errorf("cached err = %v, want (缓存) suffix", err)
+	}
+
+	// 其他错误和成功结果不缓存
+	for i := 0; i < 2; i++ {
+		resolveUsername(ctx, api, "flaky")
+		if resolved, err := resolveUsername(ctx, api, "alice"); err != nil || resolved.Peer.(*tg.PeerUser).UserID != 7 {
+			t.Fatalf("alice = %v, %v", resolved, err)
+		}
+	}
+	if n := len(requests[*tg.ContactsResolveUsernameRequest](inv)); n != 5 {
+		t.Errorf("total requests = %d, want 5", n)
+	}
+	if s := usernameMisses.Stats(); s.Size != 1 {
+		t.Errorf("negative cache size = %d, want 1", s.Size)
+	}
+}
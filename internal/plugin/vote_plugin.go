@@ -0,0 +1,701 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"nexusvalet/internal/capability"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/format"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// voteMaxPerChat 每个对话同时进行的投票上限
+	voteMaxPerChat = 5
+	// voteLiveInterval 实时计票刷新间隔
+	voteLiveInterval = 3 * time.Minute
+)
+
+// VoteOption 投票选项
+type VoteOption struct {
+	Emoji string `json:"emoji"`
+	Label string `json:"label"`
+}
+
+// Vote 一个基于表情回应的投票
+type Vote struct {
+	ID          int64
+	ChatID      int64
+	MsgID       int // 被统计回应的消息
+	StatusMsgID int // 显示投票状态的消息(命令消息)
+	Options     []VoteOption
+	Deadline    time.Time
+	Live        bool
+	Counts      map[string]int
+	Created     time.Time
+
+	timer *time.Timer
+}
+
+// VoteResult 计票结果
+type VoteResult struct {
+	Counts  map[string]int
+	Winners []VoteOption // 票数最高的选项，多个表示平票
+	Total   int
+}
+
+// VotePlugin 表情回应投票插件
+type VotePlugin struct {
+	*BasePlugin
+	db          *sql.DB
+	telegramAPI *tg.Client
+	votes       map[int64]*Vote
+	votesMutex  sync.Mutex
+	stopCh      chan struct{}
+}
+
+// NewVotePlugin 创建投票插件
+func NewVotePlugin(db *sql.DB) *VotePlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "vote",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "基于表情回应的投票统计",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	return &VotePlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+		votes:      make(map[int64]*Vote),
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Initialize 初始化插件
+func (vp *VotePlugin) Initialize(ctx context.Context, manager interface{}) error {
+	if err := vp.BasePlugin.Initialize(ctx, manager); err != nil {
+		return err
+	}
+
+	if err := vp.initDatabase(); err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	// 重新加载时上一次的 Shutdown 已关闭 stopCh
+	if vp.stopCh == nil {
+		vp.stopCh = make(chan struct{})
+	}
+
+	logger.Infof("Vote plugin initialized successfully")
+	return nil
+}
+
+// InitializeAfterConnect 实现PostConnectPlugin接口，连接后恢复进行中的投票并开始刷新实时结果
+func (vp *VotePlugin) InitializeAfterConnect(ctx context.Context) error {
+	if err := vp.loadVotes(); err != nil {
+		logger.Errorf("Failed to load votes: %v", err)
+	}
+
+	go vp.liveLoop(vp.stopCh)
+	return nil
+}
+
+// Shutdown 关闭插件
+func (vp *VotePlugin) Shutdown(ctx context.Context) error {
+	if vp.stopCh != nil {
+		close(vp.stopCh)
+		vp.stopCh = nil
+	}
+
+	vp.votesMutex.Lock()
+	for _, v := range vp.votes {
+		if v.timer != nil {
+			v.timer.Stop()
+		}
+	}
+	vp.votesMutex.Unlock()
+
+	return vp.BasePlugin.Shutdown(ctx)
+}
+
+// SetTelegramClient 设置Telegram客户端
+func (vp *VotePlugin) SetTelegramClient(client *tg.Client) {
+	vp.telegramAPI = client
+
+	// 客户端就绪后处理离线期间已到期的投票
+	vp.votesMutex.Lock()
+	var due []int64
+	for id, v := range vp.votes {
+		if !time.Now().Before(v.Deadline) {
+			due = append(due, id)
+		}
+	}
+	vp.votesMutex.Unlock()
+
+	for _, id := range due {
+		go vp.finishVote(id)
+	}
+}
+
+// initDatabase 初始化数据库表
+func (vp *VotePlugin) initDatabase() error {
+	_, err := vp.db.Exec(`
+	CREATE TABLE IF NOT EXISTS votes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		msg_id INTEGER NOT NULL,
+		status_msg_id INTEGER NOT NULL,
+		options TEXT NOT NULL,
+		deadline INTEGER NOT NULL,
+		live BOOLEAN NOT NULL DEFAULT 0,
+		created INTEGER NOT NULL
+	)`)
+	return err
+}
+
+// loadVotes 从数据库加载进行中的投票
+func (vp *VotePlugin) loadVotes() error {
+	rows, err := vp.db.Query("SELECT id, chat_id, msg_id, status_msg_id, options, deadline, live, created FROM votes")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	vp.votesMutex.Lock()
+	defer vp.votesMutex.Unlock()
+
+	for rows.Next() {
+		var v Vote
+		var optionsJSON string
+		var deadline, created int64
+		if err := rows.Scan(&v.ID, &v.ChatID, &v.MsgID, &v.StatusMsgID, &optionsJSON, &deadline, &v.Live, &created); err != nil {
+			logger.Errorf("Failed to scan vote: %v", err)
+			continue
+		}
+		if err := json.Unmarshal([]byte(optionsJSON), &v.Options); err != nil {
+			logger.Errorf("Failed to parse options for vote %d: %v", v.ID, err)
+			continue
+		}
+		v.Deadline = time.Unix(deadline, 0)
+		v.Created = time.Unix(created, 0)
+		v.Counts = make(map[string]int)
+
+		vp.votes[v.ID] = &v
+		vp.scheduleLocked(&v)
+	}
+
+	logger.Infof("Loaded %d votes", len(vp.votes))
+	return rows.Err()
+}
+
+// scheduleLocked 为投票设置截止定时器，调用方需持有锁
+func (vp *VotePlugin) scheduleLocked(v *Vote) {
+	wait := time.Until(v.Deadline)
+	if wait < 0 {
+		// 已到期的投票在Telegram客户端就绪后处理
+		return
+	}
+	id := v.ID
+	v.timer = time.AfterFunc(wait, func() { vp.finishVote(id) })
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (vp *VotePlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("vote", "基于表情回应的投票", vp.info.Name, vp.handleVote)
+	logger.Infof("Vote commands registered successfully")
+	return nil
+}
+
+// Capabilities 实现CapabilityPlugin接口，声明读取消息回应所需的接口
+func (vp *VotePlugin) Capabilities() []capability.Requirement {
+	return []capability.Requirement{
+		capability.Require((*tg.Client)(nil), "MessagesGetMessagesReactions"),
+		capability.Require(tg.MessagesGetMessagesReactionsRequest{}, "Peer", "ID"),
+		capability.Require(tg.MessageReactions{}, "Results"),
+		capability.Require(tg.ReactionCount{}, "Reaction", "Count", "ChosenOrder"),
+	}
+}
+
+// RegisterEventHandlers 实现EventPlugin接口，监听表情回应更新
+func (vp *VotePlugin) RegisterEventHandlers(dispatcher *core.EventDispatcher) error {
+	dispatcher.RegisterRawListener("vote_reactions", vp.handleRawUpdate, 50)
+	return nil
+}
+
+// handleRawUpdate 处理表情回应更新
+func (vp *VotePlugin) handleRawUpdate(ctx context.Context, event interface{}) error {
+	update, ok := event.(*tg.UpdateMessageReactions)
+	if !ok {
+		return nil
+	}
+	vp.applyReactions(peerToChatID(update.Peer), update.MsgID, update.Reactions)
+	return nil
+}
+
+// applyReactions 将回应统计写入匹配的投票
+func (vp *VotePlugin) applyReactions(chatID int64, msgID int, reactions tg.MessageReactions) {
+	vp.votesMutex.Lock()
+	defer vp.votesMutex.Unlock()
+
+	for _, v := range vp.votes {
+		if v.ChatID == chatID && v.MsgID == msgID {
+			v.Counts = tallyReactions(v.Options, reactions)
+		}
+	}
+}
+
+// tallyReactions 按选项统计回应数，排除自己的回应
+// 回应更新携带的是消息当前的汇总数量，因此用户更换选项时旧选项会自动减少
+func tallyReactions(options []VoteOption, reactions tg.MessageReactions) map[string]int {
+	counts := make(map[string]int, len(options))
+	for _, opt := range options {
+		counts[opt.Emoji] = 0
+	}
+
+	for _, rc := range reactions.Results {
+		emoji, ok := rc.Reaction.(*tg.ReactionEmoji)
+		if !ok {
+			continue
+		}
+		if _, tracked := counts[emoji.Emoticon]; !tracked {
+			continue
+		}
+		n := rc.Count
+		if _, chosen := rc.GetChosenOrder(); chosen {
+			n--
+		}
+		if n < 0 {
+			n = 0
+		}
+		counts[emoji.Emoticon] = n
+	}
+
+	return counts
+}
+
+// computeResult 计算结果与胜出选项，平票时返回多个胜出者
+func computeResult(options []VoteOption, counts map[string]int) VoteResult {
+	result := VoteResult{Counts: counts}
+	best := 0
+	for _, opt := range options {
+		n := counts[opt.Emoji]
+		result.Total += n
+		switch {
+		case n > best:
+			best = n
+			result.Winners = []VoteOption{opt}
+		case n == best && n > 0:
+			result.Winners = append(result.Winners, opt)
+		}
+	}
+	return result
+}
+
+// parseVoteOptions 解析 "👍=A" 形式的选项
+func parseVoteOptions(args []string) ([]VoteOption, error) {
+	var options []VoteOption
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("无效的选项: %s，格式应为 表情=名称", arg)
+		}
+		if seen[parts[0]] {
+			return nil, fmt.Errorf("重复的表情: %s", parts[0])
+		}
+		seen[parts[0]] = true
+		options = append(options, VoteOption{Emoji: parts[0], Label: parts[1]})
+	}
+	if len(options) < 2 {
+		return nil, fmt.Errorf("至少需要两个选项")
+	}
+	return options, nil
+}
+
+// handleVote 处理vote命令
+func (vp *VotePlugin) handleVote(ctx *command.CommandContext) error {
+	if len(ctx.Args) == 0 {
+		return vp.sendResponse(ctx, "用法:\n• .vote start <时长> <表情=选项>... [live] - 开始投票(可回复消息)\n• .vote cancel [ID] - 取消投票\n• .vote list - 查看当前对话的投票")
+	}
+
+	switch ctx.Args[0] {
+	case "start":
+		return vp.handleStart(ctx)
+	case "cancel":
+		return vp.handleCancel(ctx)
+	case "list", "ls":
+		return vp.handleList(ctx)
+	default:
+		return vp.sendResponse(ctx, "未知子命令: "+ctx.Args[0])
+	}
+}
+
+// handleStart 开始投票
+func (vp *VotePlugin) handleStart(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 4 {
+		return vp.sendResponse(ctx, "用法: .vote start <时长> <表情=选项> <表情=选项>... [live]")
+	}
+
+	d, err := parseWindowDuration(ctx.Args[1])
+	if err != nil || d <= 0 {
+		return vp.sendResponse(ctx, fmt.Sprintf("❌ 无效的时长: %s", ctx.Args[1]))
+	}
+
+	optionArgs := ctx.Args[2:]
+	live := false
+	if optionArgs[len(optionArgs)-1] == "live" {
+		live = true
+		optionArgs = optionArgs[:len(optionArgs)-1]
+	}
+
+	options, err := parseVoteOptions(optionArgs)
+	if err != nil {
+		return vp.sendResponse(ctx, "❌ "+err.Error())
+	}
+
+	// 回复时统计被回复的消息，否则统计命令消息本身
+	msgID := ctx.Message.Message.ID
+	if replyTo, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader); ok && replyTo.ReplyToMsgID != 0 {
+		msgID = replyTo.ReplyToMsgID
+	}
+
+	now := time.Now()
+	v := &Vote{
+		ChatID:      ctx.Message.ChatID,
+		MsgID:       msgID,
+		StatusMsgID: ctx.Message.Message.ID,
+		Options:     options,
+		Deadline:    now.Add(d),
+		Live:        live,
+		Counts:      make(map[string]int),
+		Created:     now,
+	}
+
+	vp.votesMutex.Lock()
+	active := 0
+	for _, existing := range vp.votes {
+		if existing.ChatID == v.ChatID {
+			active++
+		}
+		if existing.ChatID == v.ChatID && existing.MsgID == v.MsgID {
+			vp.votesMutex.Unlock()
+			return vp.sendResponse(ctx, fmt.Sprintf("❌ 该消息已有进行中的投票 #%d", existing.ID))
+		}
+	}
+	if active >= voteMaxPerChat {
+		vp.votesMutex.Unlock()
+		return vp.sendResponse(ctx, fmt.Sprintf("❌ 当前对话已有 %d 个进行中的投票，最多 %d 个", active, voteMaxPerChat))
+	}
+
+	optionsJSON, _ := json.Marshal(options)
+	result, err := vp.db.Exec("INSERT INTO votes (chat_id, msg_id, status_msg_id, options, deadline, live, created) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		v.ChatID, v.MsgID, v.StatusMsgID, string(optionsJSON), v.Deadline.Unix(), v.Live, v.Created.Unix())
+	if err != nil {
+		vp.votesMutex.Unlock()
+		return vp.sendResponse(ctx, fmt.Sprintf("❌ 保存投票失败: %v", err))
+	}
+	v.ID, _ = result.LastInsertId()
+	vp.votes[v.ID] = v
+	vp.scheduleLocked(v)
+	vp.votesMutex.Unlock()
+
+	return vp.sendResponse(ctx, vp.formatStatus(v, false))
+}
+
+// handleCancel 取消投票
+func (vp *VotePlugin) handleCancel(ctx *command.CommandContext) error {
+	vp.votesMutex.Lock()
+	var target *Vote
+	if len(ctx.Args) >= 2 {
+		id, err := strconv.ParseInt(ctx.Args[1], 10, 64)
+		if err != nil {
+			vp.votesMutex.Unlock()
+			return vp.sendResponse(ctx, "❌ 无效的投票ID")
+		}
+		if v, ok := vp.votes[id]; ok && v.ChatID == ctx.Message.ChatID {
+			target = v
+		}
+	} else {
+		// 优先取消被回复消息上的投票，否则取消最新的一个
+		replyMsgID := 0
+		if replyTo, ok := ctx.Message.Message.ReplyTo.(*tg.MessageReplyHeader); ok {
+			replyMsgID = replyTo.ReplyToMsgID
+		}
+		for _, v := range vp.votes {
+			if v.ChatID != ctx.Message.ChatID {
+				continue
+			}
+			if replyMsgID != 0 && (v.MsgID == replyMsgID || v.StatusMsgID == replyMsgID) {
+				target = v
+				break
+			}
+			if target == nil || v.ID > target.ID {
+				target = v
+			}
+		}
+	}
+	if target == nil {
+		vp.votesMutex.Unlock()
+		return vp.sendResponse(ctx, "当前对话没有进行中的投票")
+	}
+	vp.removeLocked(target.ID)
+	vp.votesMutex.Unlock()
+
+	vp.editMessage(context.Background(), target.ChatID, target.StatusMsgID, fmt.Sprintf("🗳 投票 #%d 已取消", target.ID))
+	if target.StatusMsgID != ctx.Message.Message.ID {
+		return vp.sendResponse(ctx, fmt.Sprintf("✅ 投票 #%d 已取消", target.ID))
+	}
+	return nil
+}
+
+// handleList 列出当前对话的投票
+func (vp *VotePlugin) handleList(ctx *command.CommandContext) error {
+	vp.votesMutex.Lock()
+	var list []*Vote
+	for _, v := range vp.votes {
+		if v.ChatID == ctx.Message.ChatID {
+			list = append(list, v)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	var b strings.Builder
+	b.WriteString("🗳 进行中的投票:\n")
+	for _, v := range list {
+		var labels []string
+		for _, opt := range v.Options {
+			labels = append(labels, fmt.Sprintf("%s%s(%d)", opt.Emoji, opt.Label, v.Counts[opt.Emoji]))
+		}
+		b.WriteString(fmt.Sprintf("• #%d 剩余 %s: %s\n", v.ID, time.Until(v.Deadline).Round(time.Second), strings.Join(labels, " ")))
+	}
+	vp.votesMutex.Unlock()
+
+	if len(list) == 0 {
+		return vp.sendResponse(ctx, "当前对话没有进行中的投票")
+	}
+	return vp.sendResponse(ctx, strings.TrimRight(b.String(), "\n"))
+}
+
+// removeLocked 从内存和数据库移除投票，调用方需持有锁
+func (vp *VotePlugin) removeLocked(id int64) {
+	if v, ok := vp.votes[id]; ok && v.timer != nil {
+		v.timer.Stop()
+	}
+	delete(vp.votes, id)
+	if _, err := vp.db.Exec("DELETE FROM votes WHERE id = ?", id); err != nil {
+		logger.Errorf("Failed to delete vote %d: %v", id, err)
+	}
+}
+
+// finishVote 截止时重新拉取回应并公布结果
+func (vp *VotePlugin) finishVote(id int64) {
+	if vp.telegramAPI == nil {
+		return
+	}
+
+	vp.votesMutex.Lock()
+	v, ok := vp.votes[id]
+	if !ok {
+		vp.votesMutex.Unlock()
+		return
+	}
+	vp.votesMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// 重新获取回应，避免遗漏离线期间的更新
+	vp.refreshReactions(ctx, v)
+
+	vp.votesMutex.Lock()
+	if _, ok := vp.votes[id]; !ok {
+		vp.votesMutex.Unlock()
+		return
+	}
+	final := vp.formatStatus(v, true)
+	vp.removeLocked(id)
+	vp.votesMutex.Unlock()
+
+	vp.editMessage(ctx, v.ChatID, v.StatusMsgID, final)
+
+	peer, err := vp.resolvePeer(ctx, v.ChatID)
+	if err != nil {
+		logger.Errorf("Failed to resolve peer for vote %d: %v", id, err)
+		return
+	}
+	_, err = vp.telegramAPI.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+		Peer:     peer,
+		Message:  vp.formatFinal(v),
+		RandomID: time.Now().UnixNano(),
+		ReplyTo:  &tg.InputReplyToMessage{ReplyToMsgID: v.MsgID},
+	})
+	if err != nil {
+		logger.Errorf("Failed to post result for vote %d: %v", id, err)
+	}
+}
+
+// refreshReactions 通过MessagesGetMessagesReactions刷新计票
+func (vp *VotePlugin) refreshReactions(ctx context.Context, v *Vote) {
+	peer, err := vp.resolvePeer(ctx, v.ChatID)
+	if err != nil {
+		logger.Warnf("Failed to resolve peer for vote %d: %v", v.ID, err)
+		return
+	}
+
+	updates, err := vp.telegramAPI.MessagesGetMessagesReactions(ctx, &tg.MessagesGetMessagesReactionsRequest{
+		Peer: peer,
+		ID:   []int{v.MsgID},
+	})
+	if err != nil {
+		logger.Warnf("Failed to refresh reactions for vote %d: %v", v.ID, err)
+		return
+	}
+
+	if u, ok := updates.(*tg.Updates); ok {
+		for _, upd := range u.Updates {
+			if r, ok := upd.(*tg.UpdateMessageReactions); ok && r.MsgID == v.MsgID {
+				vp.votesMutex.Lock()
+				v.Counts = tallyReactions(v.Options, r.Reactions)
+				vp.votesMutex.Unlock()
+			}
+		}
+	}
+}
+
+// liveLoop 定期刷新开启实时计票的投票，直到stop被关闭
+func (vp *VotePlugin) liveLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(voteLiveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if vp.telegramAPI == nil {
+			continue
+		}
+
+		vp.votesMutex.Lock()
+		var live []*Vote
+		for _, v := range vp.votes {
+			if v.Live {
+				live = append(live, v)
+			}
+		}
+		vp.votesMutex.Unlock()
+
+		for _, v := range live {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			vp.refreshReactions(ctx, v)
+			vp.votesMutex.Lock()
+			status := vp.formatStatus(v, false)
+			vp.votesMutex.Unlock()
+			vp.editMessage(ctx, v.ChatID, v.StatusMsgID, status)
+			cancel()
+		}
+	}
+}
+
+// formatStatus 格式化投票状态
+func (vp *VotePlugin) formatStatus(v *Vote, final bool) string {
+	var b strings.Builder
+	if final {
+		b.WriteString(fmt.Sprintf("🗳 投票 #%d 已结束\n", v.ID))
+	} else {
+		b.WriteString(fmt.Sprintf("🗳 投票 #%d 进行中，截止 %s\n", v.ID, v.Deadline.Format("01-02 15:04:05")))
+		b.WriteString("请使用对应表情回应进行投票:\n")
+	}
+	for _, opt := range v.Options {
+		b.WriteString(fmt.Sprintf("%s %s: %d\n", opt.Emoji, opt.Label, v.Counts[opt.Emoji]))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// formatFinal 格式化最终结果
+func (vp *VotePlugin) formatFinal(v *Vote) string {
+	result := computeResult(v.Options, v.Counts)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🏁 投票结果 (共 %d 票)\n", result.Total))
+	for _, opt := range v.Options {
+		b.WriteString(fmt.Sprintf("%s %s: %d\n", opt.Emoji, opt.Label, result.Counts[opt.Emoji]))
+	}
+
+	switch len(result.Winners) {
+	case 0:
+		b.WriteString("\n无人投票")
+	case 1:
+		b.WriteString(fmt.Sprintf("\n🏆 胜出: %s %s", result.Winners[0].Emoji, result.Winners[0].Label))
+	default:
+		var names []string
+		for _, w := range result.Winners {
+			names = append(names, w.Emoji+" "+w.Label)
+		}
+		b.WriteString(fmt.Sprintf("\n🤝 平票: %s", strings.Join(names, "、")))
+	}
+	return b.String()
+}
+
+// resolvePeer 解析chatID对应的peer
+func (vp *VotePlugin) resolvePeer(ctx context.Context, chatID int64) (tg.InputPeerClass, error) {
+	goManager, ok := vp.manager.(*GoManager)
+	if !ok || goManager.peerResolver == nil {
+		return nil, fmt.Errorf("peer resolver not available")
+	}
+	return goManager.peerResolver.ResolveFromChatID(ctx, chatID)
+}
+
+// editMessage 编辑指定消息
+func (vp *VotePlugin) editMessage(ctx context.Context, chatID int64, msgID int, text string) {
+	if vp.telegramAPI == nil {
+		return
+	}
+	peer, err := vp.resolvePeer(ctx, chatID)
+	if err != nil {
+		logger.Warnf("Failed to resolve peer %d: %v", chatID, err)
+		return
+	}
+	_, err = vp.telegramAPI.MessagesEditMessage(ctx, &tg.MessagesEditMessageRequest{
+		Peer:    peer,
+		ID:      msgID,
+		Message: text,
+	})
+	if err != nil && !strings.Contains(err.Error(), "MESSAGE_NOT_MODIFIED") {
+		logger.Warnf("Failed to edit vote message %d: %v", msgID, err)
+	}
+}
+
+// peerToChatID 将Peer转换为项目使用的chatID
+func peerToChatID(peer tg.PeerClass) int64 {
+	switch p := peer.(type) {
+	case *tg.PeerUser:
+		return p.UserID
+	case *tg.PeerChat:
+		return -p.ChatID
+	case *tg.PeerChannel:
+		return -1000000000000 - p.ChannelID
+	}
+	return 0
+}
+
+// sendResponse 发送响应消息
+func (vp *VotePlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,384 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/peers"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// reactionCount 构造回应统计，mine 表示其中包含自己的回应
+func reactionCount(emoji string, count int, mine bool) tg.ReactionCount {
+	rc := tg.ReactionCount{Reaction: &tg.ReactionEmoji{Emoticon: emoji}, Count: count}
+	if mine {
+		rc.SetChosenOrder(0)
+	}
+	return rc
+}
+
+// reactionUpdate 构造普通群组 chatID 中 msgID 的回应更新，携带消息当前的汇总数量
+func reactionUpdate(chatID int64, msgID int, results ...tg.ReactionCount) *tg.UpdateMessageReactions {
+	return &tg.UpdateMessageReactions{
+		Peer:      &tg.PeerChat{ChatID: -chatID},
+		MsgID:     msgID,
+		Reactions: tg.MessageReactions{Results: results},
+	}
+}
+
+var testVoteOptions = []VoteOption{{Emoji: "👍", Label: "火锅"}, {Emoji: "🎉", Label: "烧烤"}}
+
+func TestTallyReactions(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []tg.ReactionCount
+		want    map[string]int
+	}{
+		{"no reactions", nil, map[string]int{"👍": 0, "🎉": 0}},
+		{"counts per option", []tg.ReactionCount{reactionCount("👍", 2, false), reactionCount("🎉", 1, false)}, map[string]int{"👍": 2, "🎉": 1}},
+		{"own reaction excluded", []tg.ReactionCount{reactionCount("👍", 3, true), reactionCount("🎉", 1, true)}, map[string]int{"👍": 2, "🎉": 0}},
+		{"untracked emoji ignored", []tg.ReactionCount{reactionCount("❤", 5, false), reactionCount("🎉", 1, false)}, map[string]int{"👍": 0, "🎉": 1}},
+		{"custom emoji ignored", []tg.ReactionCount{{Reaction: &tg.ReactionCustomEmoji{DocumentID: 1}, Count: 4}}, map[string]int{"👍": 0, "🎉": 0}},
+		{"own reaction never negative", []tg.ReactionCount{reactionCount("👍", 0, true)}, map[string]int{"👍": 0, "🎉": 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tallyReactions(testVoteOptions, tg.MessageReactions{Results: tt.results})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tallyReactions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeResult(t *testing.T) {
+	options := append(append([]VoteOption(nil), testVoteOptions...), VoteOption{Emoji: "😴", Label: "不吃"})
+	tests := []struct {
+		name    string
+		counts  map[string]int
+		winners []VoteOption
+		total   int
+	}{
+		{"single winner", map[string]int{"👍": 1, "🎉": 3, "😴": 2}, []VoteOption{options[1]}, 6},
+		{"tie in option order", map[string]int{"👍": 2, "🎉": 1, "😴": 2}, []VoteOption{options[0], options[2]}, 5},
+		{"all tied", map[string]int{"👍": 1, "🎉": 1, "😴": 1}, options, 3},
+		{"no votes", map[string]int{}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := computeResult(options, tt.counts)
+			if !reflect.DeepEqual(result.Winners, tt.winners) || result.Total != tt.total {
+				t.Errorf("computeResult = %v (total %d), want %v (total %d)", result.Winners, result.Total, tt.winners, tt.total)
+			}
+		})
+	}
+}
+
+func TestParseVoteOptions(t *testing.T) {
+	options, err := parseVoteOptions([]string{"👍=火锅", "🎉=烧烤=BBQ"})
+	want := []VoteOption{{Emoji: "👍", Label: "火锅"}, {Emoji: "🎉", Label: "烧烤=BBQ"}}
+	if err != nil || !reflect.DeepEqual(options, want) {
+		t.Errorf("parseVoteOptions = %v, %v; want %v", options, err, want)
+	}
+	for args, wantErr := range map[string]string{
+		"👍=A":       "至少需要两个选项",
+		"👍=A 👍=B":   "重复的表情: 👍",
+		"👍=A B":     "无效的选项: B，格式应为 表情=名称",
+		"👍=A =B":    "无效的选项: =B，格式应为 表情=名称",
+		"👍=A 🎉=":    "无效的选项: 🎉=，格式应为 表情=名称",
+		"👍=A 🎉=B 😴": "无效的选项: 😴，格式应为 表情=名称",
+	} {
+		if _, err := parseVoteOptions(strings.Fields(args)); err == nil || err.Error() != wantErr {
+			t.Errorf("parseVoteOptions(%q) err = %v, want %q", args, err, wantErr)
+		}
+	}
+}
+
+// voteTest 投票插件的测试环境，命令和截止后的消息都发送到同一个 fakeInvoker
+type voteTest struct {
+	vp  *VotePlugin
+	db  *sql.DB
+	env *testEnv
+	// reactions 为 getMessagesReactions 返回的回应，键为消息ID
+	reactions map[int][]tg.ReactionCount
+}
+
+func newVoteTest(t *testing.T, db *sql.DB) *voteTest {
+	t.Helper()
+	vt := &voteTest{db: db, env: newTestEnv(), reactions: make(map[int][]tg.ReactionCount)}
+	vt.env.inv.handle = func(input bin.Encoder, output bin.Decoder) error {
+		req, ok := input.(*tg.MessagesGetMessagesReactionsRequest)
+		if !ok {
+			return errUnhandled
+		}
+		chatID := -req.Peer.(*tg.InputPeerChat).ChatID
+		var updates []tg.UpdateClass
+		for _, id := range req.ID {
+			updates = append(updates, reactionUpdate(chatID, id, vt.reactions[id]...))
+		}
+		output.(*tg.UpdatesBox).Updates = &tg.Updates{Updates: updates}
+		return nil
+	}
+
+	vt.vp = NewVotePlugin(db)
+	manager := &GoManager{}
+	manager.SetPeerResolver(peers.NewResolver(fakePeers{}))
+	if err := vt.vp.Initialize(context.Background(), manager); err != nil {
+		t.Fatal(err)
+	}
+	if err := vt.vp.InitializeAfterConnect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { vt.vp.Shutdown(context.Background()) })
+	vt.vp.RegisterCommands(vt.env.parser)
+	return vt
+}
+
+// run 在 chatID 中以ID为msgID的消息执行命令，replyTo 不为0时回复该消息，返回命令的响应
+func (vt *voteTest) run(t *testing.T, chatID int64, msgID, replyTo int, text string) string {
+	t.Helper()
+	msg := &tg.Message{ID: msgID}
+	if replyTo != 0 {
+		msg.ReplyTo = &tg.MessageReplyHeader{ReplyToMsgID: replyTo}
+	}
+	return vt.env.runText(t, &core.MessageEvent{ChatID: chatID, UserID: 1, Message: msg}, text)
+}
+
+// lastEdit 返回最后一次编辑消息的内容
+func (vt *voteTest) lastEdit() (int, string) {
+	edits := requests[*tg.MessagesEditMessageRequest](vt.env.inv)
+	if len(edits) == 0 {
+		return 0, ""
+	}
+	last := edits[len(edits)-1]
+	return last.ID, last.Message
+}
+
+// only 返回对话中唯一的投票
+func (vt *voteTest) only(t *testing.T) *Vote {
+	t.Helper()
+	vt.vp.votesMutex.Lock()
+	defer vt.vp.votesMutex.Unlock()
+	if len(vt.vp.votes) != 1 {
+		t.Fatalf("have %d votes, want 1", len(vt.vp.votes))
+	}
+	for _, v := range vt.vp.votes {
+		return v
+	}
+	return nil
+}
+
+// counts 返回投票当前的计票
+func (vt *voteTest) counts(v *Vote) map[string]int {
+	vt.vp.votesMutex.Lock()
+	defer vt.vp.votesMutex.Unlock()
+	return v.Counts
+}
+
+func TestVoteTalliesReactionUpdates(t *testing.T) {
+	vt := newVoteTest(t, openPluginDB(t))
+	text := vt.run(t, -100, 20, 15, "vote start 30m 👍=火锅 🎉=烧烤")
+	v := vt.only(t)
+	if v.MsgID != 15 || v.StatusMsgID != 20 || v.Live {
+		t.Fatalf("vote = %+v", v)
+	}
+	if !strings.HasPrefix(text, "🗳 投票 #1 进行中，截止 ") || !strings.HasSuffix(text, "请使用对应表情回应进行投票:\n👍 火锅: 0\n🎉 烧烤: 0") {
+		t.Errorf("status = %q", text)
+	}
+
+	steps := []struct {
+		name   string
+		update interface{}
+		want   map[string]int
+	}{
+		{"two users vote", reactionUpdate(-100, 15, reactionCount("👍", 1, false), reactionCount("🎉", 1, false)), map[string]int{"👍": 1, "🎉": 1}},
+		{"third user and my own reaction", reactionUpdate(-100, 15, reactionCount("👍", 3, true), reactionCount("🎉", 1, false)), map[string]int{"👍": 2, "🎉": 1}},
+		// 有人从 👍 换到 🎉：更新携带的是汇总数量，旧选项减少
+		{"user switches option", reactionUpdate(-100, 15, reactionCount("👍", 2, true), reactionCount("🎉", 2, false)), map[string]int{"👍": 1, "🎉": 2}},
+		{"other message ignored", reactionUpdate(-100, 20, reactionCount("👍", 9, false)), map[string]int{"👍": 1, "🎉": 2}},
+		{"other chat ignored", reactionUpdate(-200, 15, reactionCount("👍", 9, false)), map[string]int{"👍": 1, "🎉": 2}},
+		{"other update ignored", &tg.UpdateNewMessage{}, map[string]int{"👍": 1, "🎉": 2}},
+		{"switching back and removing own", reactionUpdate(-100, 15, reactionCount("👍", 2, false), reactionCount("🎉", 1, false)), map[string]int{"👍": 2, "🎉": 1}},
+	}
+	for _, step := range steps {
+		if err := vt.vp.handleRawUpdate(context.Background(), step.update); err != nil {
+			t.Fatal(err)
+		}
+		if got := vt.counts(v); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: counts = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestVoteDeadlinePostsResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		reactions []tg.ReactionCount
+		status    string
+		final     string
+	}{
+		{
+			name:      "winner",
+			reactions: []tg.ReactionCount{reactionCount("👍", 1, false), reactionCount("🎉", 3, true)},
+			status:    "🗳 投票 #1 已结束\n👍 火锅: 1\n🎉 烧烤: 2",
+			final:     "🏁 投票结果 (共 3 票)\n👍 火锅: 1\n🎉 烧烤: 2\n\n🏆 胜出: 🎉 烧烤",
+		},
+		{
+			name:      "tie",
+			reactions: []tg.ReactionCount{reactionCount("👍", 2, false), reactionCount("🎉", 3, true)},
+			status:    "🗳 投票 #1 已结束\n👍 火锅: 2\n🎉 烧烤: 2",
+			final:     "🏁 投票结果 (共 4 票)\n👍 火锅: 2\n🎉 烧烤: 2\n\n🤝 平票: 👍 火锅、🎉 烧烤",
+		},
+		{
+			name:      "only my own reaction",
+			reactions: []tg.ReactionCount{reactionCount("👍", 1, true)},
+			status:    "🗳 投票 #1 已结束\n👍 火锅: 0\n🎉 烧烤: 0",
+			final:     "🏁 投票结果 (共 0 票)\n👍 火锅: 0\n🎉 烧烤: 0\n\n无人投票",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vt := newVoteTest(t, openPluginDB(t))
+			vt.vp.SetTelegramClient(tg.NewClient(vt.env.inv))
+			vt.run(t, -100, 20, 0, "vote start 30m 👍=火锅 🎉=烧烤")
+			v := vt.only(t)
+			if v.MsgID != 20 {
+				t.Fatalf("without reply the command message is voted on, MsgID = %d", v.MsgID)
+			}
+
+			// 截止前的更新被截止时重新拉取的结果覆盖
+			vt.vp.handleRawUpdate(context.Background(), reactionUpdate(-100, 20, reactionCount("👍", 7, false)))
+			vt.reactions[20] = tt.reactions
+			vt.vp.finishVote(v.ID)
+
+			if id, text := vt.lastEdit(); id != 20 || text != tt.status {
+				t.Errorf("status edit %d = %q, want %q", id, text, tt.status)
+			}
+			sent := requests[*tg.MessagesSendMessageRequest](vt.env.inv)
+			if len(sent) != 1 || sent[0].Message != tt.final {
+				t.Fatalf("sent %d messages, want final result %q", len(sent), tt.final)
+			}
+			if !reflect.DeepEqual(sent[0].ReplyTo, &tg.InputReplyToMessage{ReplyToMsgID: 20}) {
+				t.Errorf("result ReplyTo = %#v", sent[0].ReplyTo)
+			}
+			if n := countVoteRows(t, vt.db); n != 0 {
+				t.Errorf("%d vote rows left after finishing", n)
+			}
+
+			// 已结束的投票再次到期时不重复公布
+			vt.vp.finishVote(v.ID)
+			if n := len(requests[*tg.MessagesSendMessageRequest](vt.env.inv)); n != 1 {
+				t.Errorf("sent %d results, want 1", n)
+			}
+		})
+	}
+}
+
+func countVoteRows(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM votes").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestVotePersistsAcrossRestart(t *testing.T) {
+	db := openPluginDB(t)
+	first := newVoteTest(t, db)
+	first.run(t, -100, 20, 15, "vote start 2h 👍=火锅 🎉=烧烤 live")
+	first.run(t, -100, 21, 16, "vote start 1h 👍=A 🎉=B")
+	first.vp.Shutdown(context.Background())
+
+	// 重启后恢复投票，离线期间到期的投票在客户端就绪后公布结果
+	if _, err := db.Exec("UPDATE votes SET deadline = ? WHERE msg_id = 16", time.Now().Add(-time.Minute).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	second := newVoteTest(t, db)
+	second.vp.votesMutex.Lock()
+	restored := second.vp.votes[1]
+	count := len(second.vp.votes)
+	second.vp.votesMutex.Unlock()
+	if count != 2 || restored == nil {
+		t.Fatalf("restored %d votes", count)
+	}
+	if restored.ChatID != -100 || restored.MsgID != 15 || restored.StatusMsgID != 20 || !restored.Live ||
+		!reflect.DeepEqual(restored.Options, testVoteOptions) || time.Until(restored.Deadline) < 119*time.Minute {
+		t.Errorf("restored vote = %+v", restored)
+	}
+
+	second.reactions[16] = []tg.ReactionCount{reactionCount("🎉", 1, false)}
+	second.vp.SetTelegramClient(tg.NewClient(second.env.inv))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(requests[*tg.MessagesSendMessageRequest](second.env.inv)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expired vote was not finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sent := requests[*tg.MessagesSendMessageRequest](second.env.inv)
+	if want := "🏁 投票结果 (共 1 票)\n👍 A: 0\n🎉 B: 1\n\n🏆 胜出: 🎉 B"; sent[0].Message != want {
+		t.Errorf("result = %q, want %q", sent[0].Message, want)
+	}
+	if v := second.only(t); v.ID != 1 {
+		t.Errorf("remaining vote = #%d, want #1", v.ID)
+	}
+}
+
+func TestVoteLimitsAndCancel(t *testing.T) {
+	vt := newVoteTest(t, openPluginDB(t))
+	for i := 0; i < voteMaxPerChat; i++ {
+		vt.run(t, -100, 100+i, 0, "vote start 30m 👍=A 🎉=B")
+	}
+	if text := vt.run(t, -100, 200, 0, "vote start 30m 👍=A 🎉=B"); text != "❌ 当前对话已有 5 个进行中的投票，最多 5 个" {
+		t.Errorf("sixth vote = %q", text)
+	}
+	// 其他对话不受限制，同一条消息不能重复投票
+	vt.run(t, -300, 100, 0, "vote start 30m 👍=A 🎉=B")
+	if text := vt.run(t, -300, 101, 100, "vote start 30m 👍=A 🎉=B"); text != "❌ 该消息已有进行中的投票 #6" {
+		t.Errorf("duplicate vote = %q", text)
+	}
+
+	tests := []struct {
+		chatID        int64
+		msgID, reply  int
+		command       string
+		wantCancelled int64
+		want          string
+	}{
+		{-100, 300, 0, "vote cancel 2", 2, "✅ 投票 #2 已取消"},
+		{-100, 301, 0, "vote cancel", 5, "✅ 投票 #5 已取消"},
+		{-100, 302, 102, "vote cancel", 3, "✅ 投票 #3 已取消"},
+		// 回复的消息上没有进行中的投票时取消最新的一个
+		{-100, 303, 101, "vote cancel", 4, "✅ 投票 #4 已取消"},
+		{-100, 304, 0, "vote cancel 6", 0, "当前对话没有进行中的投票"},
+		{-100, 305, 0, "vote cancel x", 0, "❌ 无效的投票ID"},
+	}
+	for _, tt := range tests {
+		if text := vt.run(t, tt.chatID, tt.msgID, tt.reply, tt.command); text != tt.want {
+			t.Errorf("%s (reply %d) = %q, want %q", tt.command, tt.reply, text, tt.want)
+		}
+		if tt.wantCancelled == 0 {
+			continue
+		}
+		vt.vp.votesMutex.Lock()
+		_, still := vt.vp.votes[tt.wantCancelled]
+		vt.vp.votesMutex.Unlock()
+		if still {
+			t.Errorf("%s: vote #%d still active", tt.command, tt.wantCancelled)
+		}
+	}
+	if text := vt.run(t, -100, 306, 0, "vote list"); !strings.HasPrefix(text, "🗳 进行中的投票:\n• #1 剩余 ") || strings.Count(text, "\n• ") != 1 {
+		t.Errorf("list = %q", text)
+	}
+	if n := countVoteRows(t, vt.db); n != 2 {
+		t.Errorf("%d vote rows, want 2", n)
+	}
+}
@@ -0,0 +1,389 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/core"
+	"nexusvalet/internal/flood"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/peers"
+	"nexusvalet/internal/storage"
+	"nexusvalet/pkg/logger"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// watchMaxPatterns 最多的关键词规则数
+	watchMaxPatterns = 50
+	// watchRateLimit 每个 watchRateWindow 内最多转发的消息数，超过的消息跳过
+	watchRateLimit = 20
+	// watchRateWindow 转发限速的窗口
+	watchRateWindow = time.Minute
+	// watchMaxAge 超过该时长的消息不再转发(如重连后补收的旧消息)
+	watchMaxAge = time.Minute
+)
+
+// watchPattern 一条关键词规则，ChatID 为0时匹配所有群组
+type watchPattern struct {
+	ID      int64
+	Pattern string
+	ChatID  int64
+	re      *regexp.Regexp
+}
+
+// WatchPlugin 关键词提醒：群组中收到匹配规则的消息时转发到收藏夹
+type WatchPlugin struct {
+	*BasePlugin
+	db           *sql.DB
+	telegramAPI  *tg.Client
+	peerResolver *peers.Resolver
+	patterns     []*watchPattern // 按ID排序的规则
+	forwarded    []time.Time     // 窗口内的转发时间
+	skipped      int             // 因限速跳过、尚未报告的消息数
+	mutex        sync.Mutex
+}
+
+// NewWatchPlugin 创建关键词提醒插件
+func NewWatchPlugin(db *sql.DB) *WatchPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "watch",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "群组消息匹配关键词时转发到收藏夹",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &WatchPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+	plugin.loadPatterns()
+
+	return plugin
+}
+
+// initDatabase 初始化数据库表
+func (wp *WatchPlugin) initDatabase() {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS watch_patterns (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		pattern TEXT NOT NULL,
+		chat_id INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL
+	);`
+
+	_, err := wp.db.Exec(createTableSQL)
+	if err != nil {
+		logger.Errorf("Failed to create watch_patterns table: %v", err)
+	}
+}
+
+// loadPatterns 从数据库读取并编译所有规则，无法编译的规则跳过
+func (wp *WatchPlugin) loadPatterns() {
+	rows, err := wp.db.Query("SELECT id, pattern, chat_id FROM watch_patterns ORDER BY id")
+	if err != nil {
+		logger.Errorf("Failed to load watch patterns: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var patterns []*watchPattern
+	for rows.Next() {
+		var p watchPattern
+		if err := rows.Scan(&p.ID, &p.Pattern, &p.ChatID); err != nil {
+			logger.Errorf("Failed to scan watch pattern: %v", err)
+			continue
+		}
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			logger.Warnf("Skipping watch pattern %d with invalid regex: %v", p.ID, err)
+			continue
+		}
+		p.re = re
+		patterns = append(patterns, &p)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Errorf("Failed to load watch patterns: %v", err)
+	}
+
+	wp.mutex.Lock()
+	wp.patterns = patterns
+	wp.mutex.Unlock()
+	if len(patterns) > 0 {
+		logger.Infof("Loaded %d watch patterns", len(patterns))
+	}
+}
+
+// SetTelegramClient 设置Telegram客户端和Peer解析器
+func (wp *WatchPlugin) SetTelegramClient(client *tg.Client, peerResolver *peers.Resolver) {
+	wp.telegramAPI = client
+	wp.peerResolver = peerResolver
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (wp *WatchPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("watch", "关键词提醒：add \"正则\" [--chat <chat_id|here>] | list | del <ID>", wp.info.Name, wp.handleWatch)
+	logger.Infof("Watch commands registered successfully")
+	return nil
+}
+
+// RegisterEventHandlers 实现EventPlugin接口，监听群组中收到的消息
+func (wp *WatchPlugin) RegisterEventHandlers(dispatcher *core.EventDispatcher) error {
+	return dispatcher.RegisterMessageListenerWithFilter("watch_forward", "", wp.handleIncoming, 70, core.ListenerFilter{Incoming: true, GroupsOnly: true})
+}
+
+// handleWatch 处理watch命令
+func (wp *WatchPlugin) handleWatch(ctx *command.CommandContext) error {
+	// --chat 的值从 Args 中移除，需在读取 Args 之前获取
+	chatFlag, hasChat := ctx.Flag("chat")
+	if len(ctx.Args) == 0 {
+		return wp.sendResponse(ctx, wp.helpText())
+	}
+
+	switch ctx.Args[0] {
+	case "add":
+		return wp.handleAdd(ctx, chatFlag, hasChat)
+	case "list":
+		return wp.handleList(ctx)
+	case "del":
+		return wp.handleDel(ctx)
+	}
+	return wp.sendResponse(ctx, wp.helpText())
+}
+
+// handleAdd 添加规则，正则中有空格时需要用引号括起来
+func (wp *WatchPlugin) handleAdd(ctx *command.CommandContext, chatFlag string, hasChat bool) error {
+	if len(ctx.Args) < 2 {
+		return wp.sendResponse(ctx, "用法: .watch add \"正则\" [--chat <chat_id|here>]")
+	}
+	pattern := ctx.Args[1]
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return wp.sendResponse(ctx, fmt.Sprintf("❌ 无效的正则表达式: %v", err))
+	}
+
+	var chatID int64
+	if hasChat {
+		if chatFlag == "here" {
+			chatID = ctx.Message.ChatID
+		} else if chatID, err = strconv.ParseInt(chatFlag, 10, 64); err != nil {
+			return wp.sendResponse(ctx, fmt.Sprintf("❌ 无效的对话ID: %s", chatFlag))
+		}
+		if chatID >= 0 {
+			return wp.sendResponse(ctx, "❌ 只能监听群组，对话ID应为负数")
+		}
+	}
+
+	p := &watchPattern{Pattern: pattern, ChatID: chatID, re: re}
+	if err := wp.addPattern(p); err != nil {
+		return wp.sendResponse(ctx, fmt.Sprintf("❌ %v", err))
+	}
+	return wp.sendResponse(ctx, fmt.Sprintf("✅ 已添加关键词提醒 #%d\n\n正则: %s\n范围: %s", p.ID, pattern, watchScope(p.ChatID)))
+}
+
+// addPattern 保存规则并加入规则列表，超过上限时返回错误
+func (wp *WatchPlugin) addPattern(p *watchPattern) error {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	if len(wp.patterns) >= watchMaxPatterns {
+		return fmt.Errorf("最多 %d 条关键词提醒，请先删除不需要的规则", watchMaxPatterns)
+	}
+
+	result, err := storage.Exec(wp.db, "INSERT INTO watch_patterns (pattern, chat_id, created_at) VALUES (?, ?, ?)",
+		p.Pattern, p.ChatID, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("保存规则失败: %w", err)
+	}
+	p.ID, _ = result.LastInsertId()
+	wp.patterns = append(wp.patterns, p)
+	return nil
+}
+
+// handleList 列出所有规则
+func (wp *WatchPlugin) handleList(ctx *command.CommandContext) error {
+	wp.mutex.Lock()
+	patterns := wp.patterns
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🔔 关键词提醒 (%d/%d):\n", len(patterns), watchMaxPatterns))
+	for _, p := range patterns {
+		b.WriteString(fmt.Sprintf("\n#%d %s\n   范围: %s", p.ID, p.Pattern, watchScope(p.ChatID)))
+	}
+	wp.mutex.Unlock()
+
+	if len(patterns) == 0 {
+		return wp.sendResponse(ctx, "🔔 没有关键词提醒")
+	}
+	return wp.sendResponse(ctx, b.String())
+}
+
+// handleDel 删除规则
+func (wp *WatchPlugin) handleDel(ctx *command.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return wp.sendResponse(ctx, "用法: .watch del <ID>")
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(ctx.Args[1], "#"), 10, 64)
+	if err != nil {
+		return wp.sendResponse(ctx, "❌ 无效的规则ID")
+	}
+
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	result, err := storage.Exec(wp.db, "DELETE FROM watch_patterns WHERE id = ?", id)
+	if err != nil {
+		return wp.sendResponse(ctx, fmt.Sprintf("❌ 删除规则失败: %v", err))
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return wp.sendResponse(ctx, fmt.Sprintf("❌ 没有关键词提醒 #%d", id))
+	}
+	for i, p := range wp.patterns {
+		if p.ID == id {
+			wp.patterns = append(wp.patterns[:i:i], wp.patterns[i+1:]...)
+			break
+		}
+	}
+	return wp.sendResponse(ctx, fmt.Sprintf("🗑️ 已删除关键词提醒 #%d", id))
+}
+
+// handleIncoming 群组中收到的消息匹配规则时，把消息和一条说明转发到收藏夹
+func (wp *WatchPlugin) handleIncoming(ctx context.Context, event interface{}) error {
+	msgEvent, ok := event.(*core.MessageEvent)
+	if !ok || msgEvent.Message == nil || msgEvent.Text == "" || wp.telegramAPI == nil || wp.peerResolver == nil {
+		return nil
+	}
+	if time.Since(time.Unix(int64(msgEvent.Message.Date), 0)) > watchMaxAge {
+		return nil
+	}
+
+	p := wp.match(msgEvent.ChatID, msgEvent.Text)
+	if p == nil {
+		return nil
+	}
+	skipped, allowed := wp.allow()
+	if !allowed {
+		logger.Ctx(ctx).Debugf("Watch pattern %d matched message %d in chat %d but the forward rate limit is reached", p.ID, msgEvent.Message.ID, msgEvent.ChatID)
+		return nil
+	}
+
+	peer, err := wp.peerResolver.ResolveFromChatID(ctx, msgEvent.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve peer: %w", err)
+	}
+	title, _ := chatTitles.Fill(msgEvent.ChatID, func() (string, time.Duration, error) {
+		title, err := fetchPeerTitle(ctx, wp.telegramAPI, peer)
+		return title, 0, err
+	})
+	if title == "" {
+		title = strconv.FormatInt(msgEvent.ChatID, 10)
+	}
+
+	note := fmt.Sprintf("🔔 关键词提醒 #%d\n群组: %s\n正则: %s", p.ID, title, p.Pattern)
+	if channel, ok := peer.(*tg.InputPeerChannel); ok {
+		note += fmt.Sprintf("\n链接: https://t.me/c/%d/%d", channel.ChannelID, msgEvent.Message.ID)
+	}
+	if skipped > 0 {
+		note += fmt.Sprintf("\n\n⚠️ 转发过于频繁，之前有 %d 条匹配的消息未转发", skipped)
+	}
+
+	var limiter *flood.Limiter
+	if goManager, ok := wp.manager.(*GoManager); ok {
+		limiter = goManager.GetFloodLimiter()
+	}
+	self := &tg.InputPeerSelf{}
+	if _, err := flood.Call(ctx, limiter, 0, func() (tg.UpdatesClass, error) {
+		return wp.telegramAPI.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+			Peer:     self,
+			Message:  note,
+			RandomID: time.Now().UnixNano(),
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to send watch note: %w", err)
+	}
+	if _, err := flood.Call(ctx, limiter, 0, func() (tg.UpdatesClass, error) {
+		return wp.telegramAPI.MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
+			FromPeer: peer,
+			ID:       []int{msgEvent.Message.ID},
+			RandomID: []int64{time.Now().UnixNano()},
+			ToPeer:   self,
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to forward message %d for watch pattern %d: %w", msgEvent.Message.ID, p.ID, err)
+	}
+	logger.Ctx(ctx).Debugf("Watch pattern %d forwarded message %d from chat %d", p.ID, msgEvent.Message.ID, msgEvent.ChatID)
+	return nil
+}
+
+// match 返回第一条在该群组生效且匹配文本的规则
+func (wp *WatchPlugin) match(chatID int64, text string) *watchPattern {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	for _, p := range wp.patterns {
+		if (p.ChatID == 0 || p.ChatID == chatID) && p.re.MatchString(text) {
+			return p
+		}
+	}
+	return nil
+}
+
+// allow 检查全局转发限速，允许时记录本次转发并返回之前因限速跳过的消息数
+func (wp *WatchPlugin) allow() (int, bool) {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	now := time.Now()
+	kept := wp.forwarded[:0]
+	for _, t := range wp.forwarded {
+		if now.Sub(t) < watchRateWindow {
+			kept = append(kept, t)
+		}
+	}
+	wp.forwarded = kept
+	if len(wp.forwarded) >= watchRateLimit {
+		wp.skipped++
+		return 0, false
+	}
+	wp.forwarded = append(wp.forwarded, now)
+	skipped := wp.skipped
+	wp.skipped = 0
+	return skipped, true
+}
+
+// watchScope 返回规则生效范围的描述
+func watchScope(chatID int64) string {
+	if chatID == 0 {
+		return "所有群组"
+	}
+	return strconv.FormatInt(chatID, 10)
+}
+
+// helpText 返回帮助信息
+func (wp *WatchPlugin) helpText() string {
+	return fmt.Sprintf(`🔔 关键词提醒
+
+• .watch add "正则" - 任意群组中收到匹配的消息时转发到收藏夹
+• .watch add "正则" --chat <chat_id|here> - 只在指定群组中匹配，here 表示当前群组
+• .watch list - 列出所有规则
+• .watch del <ID> - 删除规则
+
+转发前会先发送一条说明，包括群组名称和匹配的规则；每条消息只转发一次。
+最多 %d 条规则，每分钟最多转发 %d 条消息，超过的消息跳过并在下一次转发时提示。
+示例: .watch add "(?i)nexusvalet|自动回复"`, watchMaxPatterns, watchRateLimit)
+}
+
+// sendResponse 发送响应消息
+func (wp *WatchPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
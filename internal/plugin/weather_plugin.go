@@ -0,0 +1,449 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"nexusvalet/internal/cache"
+	"nexusvalet/internal/command"
+	"nexusvalet/internal/format"
+	"nexusvalet/internal/storage"
+	"nexusvalet/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// weatherGeocodingURL Open-Meteo 地理编码接口，把城市名解析为经纬度
+	weatherGeocodingURL = "https://geocoding-api.open-meteo.com/v1/search"
+	// weatherForecastURL Open-Meteo 天气预报接口
+	weatherForecastURL = "https://api.open-meteo.com/v1/forecast"
+	// weatherForecastDays 显示的预报天数
+	weatherForecastDays = 3
+)
+
+// weatherReports 按城市缓存的天气，避免短时间内重复请求
+var weatherReports = cache.New[string, *weatherReport]("weather", cache.Options{
+	TTL:        10 * time.Minute,
+	MaxEntries: 200,
+})
+
+// weatherPlace 地理编码得到的地点
+type weatherPlace struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Country   string  `json:"country"`
+	Admin1    string  `json:"admin1"`
+}
+
+// weatherCurrent 当前天气
+type weatherCurrent struct {
+	Time          string  `json:"time"`
+	Temperature   float64 `json:"temperature_2m"`
+	FeelsLike     float64 `json:"apparent_temperature"`
+	Humidity      float64 `json:"relative_humidity_2m"`
+	WindSpeed     float64 `json:"wind_speed_10m"`
+	WindDirection float64 `json:"wind_direction_10m"`
+	WeatherCode   int     `json:"weather_code"`
+}
+
+// weatherDaily 每日预报，各字段按日期对齐
+type weatherDaily struct {
+	Time        []string  `json:"time"`
+	WeatherCode []int     `json:"weather_code"`
+	Max         []float64 `json:"temperature_2m_max"`
+	Min         []float64 `json:"temperature_2m_min"`
+}
+
+// weatherForecast 天气预报接口的响应
+type weatherForecast struct {
+	Current weatherCurrent `json:"current"`
+	Daily   weatherDaily   `json:"daily"`
+}
+
+// weatherReport 一个城市的天气
+type weatherReport struct {
+	Place     weatherPlace
+	Forecast  weatherForecast
+	FetchedAt time.Time
+}
+
+// WeatherPlugin 天气插件，使用不需要API key的 Open-Meteo
+type WeatherPlugin struct {
+	*BasePlugin
+	db         *sql.DB
+	httpClient *http.Client
+}
+
+// NewWeatherPlugin 创建天气插件
+func NewWeatherPlugin(db *sql.DB) *WeatherPlugin {
+	info := &PluginInfo{
+		PluginVersion: &PluginVersion{
+			Name:        "weather",
+			Version:     "1.0.0",
+			Author:      "NexusValet",
+			Description: "查询城市的天气和预报",
+		},
+		Dir:     "builtin",
+		Enabled: true,
+	}
+
+	plugin := &WeatherPlugin{
+		BasePlugin: NewBasePlugin(info),
+		db:         db,
+		httpClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+
+	// 初始化数据库表
+	plugin.initDatabase()
+
+	return plugin
+}
+
+// initDatabase 初始化数据库表
+func (wp *WeatherPlugin) initDatabase() {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS weather_defaults (
+		user_id INTEGER PRIMARY KEY,
+		city TEXT NOT NULL
+	);`
+
+	_, err := wp.db.Exec(createTableSQL)
+	if err != nil {
+		logger.Errorf("Failed to create weather_defaults table: %v", err)
+	}
+}
+
+// RegisterCommands 实现CommandPlugin接口
+func (wp *WeatherPlugin) RegisterCommands(parser *command.Parser) error {
+	parser.RegisterCommand("weather", "查询天气，.weather [城市] | .weather set <城市>", wp.info.Name, wp.handleWeather)
+	logger.Infof("Weather commands registered successfully")
+	return nil
+}
+
+// handleWeather 处理weather命令
+func (wp *WeatherPlugin) handleWeather(ctx *command.CommandContext) error {
+	if len(ctx.Args) > 0 && ctx.Args[0] == "set" {
+		return wp.handleSet(ctx)
+	}
+	if len(ctx.Args) > 0 && ctx.Args[0] == "help" {
+		return wp.sendResponse(ctx, wp.usage())
+	}
+
+	city := strings.TrimSpace(ctx.ArgsString())
+	if city == "" {
+		city = wp.defaultCity(ctx.Message.UserID)
+	}
+	if city == "" {
+		return wp.sendResponse(ctx, wp.usage())
+	}
+
+	report, stale, err := wp.report(ctx.Context, city)
+	if err != nil {
+		return wp.sendResponse(ctx, fmt.Sprintf("❌ 查询 %s 的天气失败: %v", city, explainWeatherError(err)))
+	}
+	text := formatWeather(report)
+	if stale {
+		text += fmt.Sprintf("\n\n⚠️ 天气服务暂时无法访问，以上为 %s 获取的数据", report.FetchedAt.Format("15:04"))
+	}
+	return wp.sendResponse(ctx, text)
+}
+
+// handleSet 设置当前用户的默认城市
+func (wp *WeatherPlugin) handleSet(ctx *command.CommandContext) error {
+	city := strings.TrimSpace(ctx.ArgsStringFrom(1))
+	if city == "" {
+		current := wp.defaultCity(ctx.Message.UserID)
+		if current == "" {
+			current = "未设置"
+		}
+		return wp.sendResponse(ctx, fmt.Sprintf("当前默认城市: %s\n\n用法: .weather set <城市>", current))
+	}
+
+	// 先确认城市存在，避免保存拼写错误的城市
+	report, _, err := wp.report(ctx.Context, city)
+	if err != nil {
+		return wp.sendResponse(ctx, fmt.Sprintf("❌ 无法设置默认城市 %s: %v", city, explainWeatherError(err)))
+	}
+	if _, err := storage.Exec(wp.db, "INSERT OR REPLACE INTO weather_defaults (user_id, city) VALUES (?, ?)", ctx.Message.UserID, city); err != nil {
+		return wp.sendResponse(ctx, fmt.Sprintf("❌ 保存设置失败: %v", err))
+	}
+	return wp.sendResponse(ctx, fmt.Sprintf("✅ 默认城市已设置为 %s，之后可以直接使用 .weather", placeLabel(report.Place)))
+}
+
+// defaultCity 返回用户的默认城市，未设置时为空字符串
+func (wp *WeatherPlugin) defaultCity(userID int64) string {
+	var city string
+	if err := wp.db.QueryRow("SELECT city FROM weather_defaults WHERE user_id = ?", userID).Scan(&city); err != nil {
+		return ""
+	}
+	return city
+}
+
+// report 返回城市的天气，优先使用缓存。请求失败但有过期的缓存时返回过期的数据，stale为true
+func (wp *WeatherPlugin) report(ctx context.Context, city string) (report *weatherReport, stale bool, err error) {
+	key := strings.ToLower(city)
+	report, err = weatherReports.Fill(key, func() (*weatherReport, time.Duration, error) {
+		report, err := wp.fetch(ctx, city)
+		return report, 0, err
+	})
+	if err == nil {
+		return report, false, nil
+	}
+	if old, ok := weatherReports.GetStale(key); ok && isNetworkError(err) {
+		logger.Ctx(ctx).Warnf("Failed to fetch weather for %s, using cached data: %v", city, err)
+		return old, true, nil
+	}
+	return nil, false, err
+}
+
+// fetch 解析城市并获取天气
+func (wp *WeatherPlugin) fetch(ctx context.Context, city string) (*weatherReport, error) {
+	body, err := wp.get(ctx, weatherGeocodingURL, url.Values{
+		"name":     {city},
+		"count":    {"1"},
+		"language": {"zh"},
+		"format":   {"json"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	place, err := parseGeocoding(body)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err = wp.get(ctx, weatherForecastURL, url.Values{
+		"latitude":      {strconv.FormatFloat(place.Latitude, 'f', 4, 64)},
+		"longitude":     {strconv.FormatFloat(place.Longitude, 'f', 4, 64)},
+		"current":       {"temperature_2m,apparent_temperature,relative_humidity_2m,wind_speed_10m,wind_direction_10m,weather_code"},
+		"daily":         {"weather_code,temperature_2m_max,temperature_2m_min"},
+		"timezone":      {"auto"},
+		"forecast_days": {strconv.Itoa(weatherForecastDays)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	forecast, err := parseForecast(body)
+	if err != nil {
+		return nil, err
+	}
+	return &weatherReport{Place: *place, Forecast: *forecast, FetchedAt: time.Now()}, nil
+}
+
+// get 请求 Open-Meteo 接口，返回响应内容
+func (wp *WeatherPlugin) get(ctx context.Context, endpoint string, params url.Values) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+
+	resp, err := wp.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送HTTP请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		// 参数错误时返回 {"error": true, "reason": "..."}
+		var apiErr struct {
+			Reason string `json:"reason"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Reason != "" {
+			return nil, fmt.Errorf("%s", apiErr.Reason)
+		}
+		return nil, fmt.Errorf("响应异常 (状态码: %d)", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// parseGeocoding 解析地理编码接口的响应，返回第一个结果
+func parseGeocoding(body []byte) (*weatherPlace, error) {
+	var response struct {
+		Results []weatherPlace `json:"results"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("解析JSON出错: %w", err)
+	}
+	if len(response.Results) == 0 {
+		return nil, fmt.Errorf("找不到该城市")
+	}
+	return &response.Results[0], nil
+}
+
+// parseForecast 解析天气预报接口的响应
+func parseForecast(body []byte) (*weatherForecast, error) {
+	var forecast weatherForecast
+	if err := json.Unmarshal(body, &forecast); err != nil {
+		return nil, fmt.Errorf("解析JSON出错: %w", err)
+	}
+	if forecast.Current.Time == "" {
+		return nil, fmt.Errorf("响应中没有当前天气")
+	}
+	return &forecast, nil
+}
+
+// formatWeather 格式化天气：当前温度、体感、湿度、风，以及每日最低/最高温度
+func formatWeather(r *weatherReport) string {
+	c := r.Forecast.Current
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%s %s\n", weatherIcon(c.WeatherCode), placeLabel(r.Place)))
+	b.WriteString(fmt.Sprintf("\n🌡 %.1f°C %s，体感 %.1f°C", c.Temperature, weatherDescription(c.WeatherCode), c.FeelsLike))
+	b.WriteString(fmt.Sprintf("\n💧 湿度 %.0f%%", c.Humidity))
+	b.WriteString(fmt.Sprintf("\n💨 %s风 %.1f km/h", windDirection(c.WindDirection), c.WindSpeed))
+
+	d := r.Forecast.Daily
+	if len(d.Time) > 0 {
+		b.WriteString("\n\n📅 预报:")
+	}
+	for i, day := range d.Time {
+		if i >= len(d.Max) || i >= len(d.Min) {
+			break
+		}
+		code := 0
+		if i < len(d.WeatherCode) {
+			code = d.WeatherCode[i]
+		}
+		label := day
+		if t, err := time.Parse("2006-01-02", day); err == nil {
+			label = t.Format("01-02") + " " + weekdayNames[t.Weekday()]
+		}
+		b.WriteString(fmt.Sprintf("\n%s %s %s %.0f~%.0f°C", label, weatherIcon(code), weatherDescription(code), d.Min[i], d.Max[i]))
+	}
+	return b.String()
+}
+
+// weekdayNames 星期的中文名称
+var weekdayNames = [...]string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+
+// placeLabel 返回地点的显示名称，如 "杭州, 浙江, 中国"
+func placeLabel(p weatherPlace) string {
+	parts := []string{p.Name}
+	if p.Admin1 != "" && p.Admin1 != p.Name {
+		parts = append(parts, p.Admin1)
+	}
+	if p.Country != "" {
+		parts = append(parts, p.Country)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// weatherDescription 返回WMO天气代码的说明
+func weatherDescription(code int) string {
+	switch code {
+	case 0:
+		return "晴"
+	case 1:
+		return "大部晴朗"
+	case 2:
+		return "多云"
+	case 3:
+		return "阴"
+	case 45, 48:
+		return "雾"
+	case 51, 53, 55:
+		return "毛毛雨"
+	case 56, 57:
+		return "冻毛毛雨"
+	case 61:
+		return "小雨"
+	case 63:
+		return "中雨"
+	case 65:
+		return "大雨"
+	case 66, 67:
+		return "冻雨"
+	case 71:
+		return "小雪"
+	case 73:
+		return "中雪"
+	case 75:
+		return "大雪"
+	case 77:
+		return "雪粒"
+	case 80, 81, 82:
+		return "阵雨"
+	case 85, 86:
+		return "阵雪"
+	case 95:
+		return "雷暴"
+	case 96, 99:
+		return "雷暴伴有冰雹"
+	}
+	return "未知"
+}
+
+// weatherIcon 返回WMO天气代码对应的图标
+func weatherIcon(code int) string {
+	switch {
+	case code == 0:
+		return "☀️"
+	case code == 1 || code == 2:
+		return "⛅"
+	case code == 3:
+		return "☁️"
+	case code == 45 || code == 48:
+		return "🌫"
+	case code >= 71 && code <= 77, code == 85 || code == 86:
+		return "❄️"
+	case code >= 95:
+		return "⛈"
+	case code >= 51:
+		return "🌧"
+	}
+	return "🌡"
+}
+
+// windDirection 把风向角度转换为方位，风向为风吹来的方向
+func windDirection(degrees float64) string {
+	directions := [...]string{"北", "东北", "东", "东南", "南", "西南", "西", "西北"}
+	i := int((degrees+22.5)/45) % len(directions)
+	if i < 0 {
+		i += len(directions)
+	}
+	return directions[i]
+}
+
+// isNetworkError 是否为无法连接天气服务导致的错误
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// explainWeatherError 为网络错误附加说明
+func explainWeatherError(err error) error {
+	if isNetworkError(err) {
+		return fmt.Errorf("无法连接天气服务，请检查网络后稍后再试 (%w)", err)
+	}
+	return err
+}
+
+// usage 返回weather命令的用法
+func (wp *WeatherPlugin) usage() string {
+	return `用法:
+• .weather <城市> - 查询城市的当前天气和 3 天预报
+• .weather - 查询默认城市的天气
+• .weather set <城市> - 设置自己的默认城市
+
+城市可以使用中文或英文，例如 .weather 杭州、.weather London`
+}
+
+// sendResponse 发送响应消息
+func (wp *WeatherPlugin) sendResponse(ctx *command.CommandContext, message string) error {
+	_, err := ctx.Respond(message, format.Plain)
+	return err
+}
@@ -0,0 +1,271 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readFixture 读取 testdata 中的响应样例
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// fixtureTransport 按请求的主机(或主机加查询参数)返回样例响应，并记录请求
+type fixtureTransport struct {
+	mu       sync.Mutex
+	bodies   map[string][]byte // 主机或 主机?查询参数 -> 响应内容
+	statuses map[string]int    // 主机 -> 状态码，默认200
+	err      error             // 非nil时所有请求失败
+	requests []*http.Request
+}
+
+func (f *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	if f.err != nil {
+		return nil, f.err
+	}
+	// 先按主机加查询参数查找，再按主机查找
+	key := req.URL.Host + "?" + req.URL.RawQuery
+	body, ok := f.bodies[key]
+	if !ok {
+		key = req.URL.Host
+		body, ok = f.bodies[key]
+	}
+	if !ok {
+		return nil, errors.New("unexpected host " + req.URL.Host)
+	}
+	status := f.statuses[key]
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewReader(body)), Header: make(http.Header), Request: req}, nil
+}
+
+func (f *fixtureTransport) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+const (
+	geocodingHost = "geocoding-api.open-meteo.com"
+	forecastHost  = "api.open-meteo.com"
+)
+
+// newWeatherTest 创建使用样例响应的天气插件，city 的缓存在测试前后清除
+func newWeatherTest(t *testing.T, cities ...string) (*WeatherPlugin, *fixtureTransport) {
+	t.Helper()
+	transport := &fixtureTransport{bodies: map[string][]byte{
+		geocodingHost: readFixture(t, "open_meteo_geocoding.json"),
+		forecastHost:  readFixture(t, "open_meteo_forecast.json"),
+	}, statuses: map[string]int{}}
+	wp := NewWeatherPlugin(openPluginDB(t))
+	wp.httpClient = &http.Client{Transport: transport}
+	clear := func() {
+		for _, city := range cities {
+			weatherReports.Delete(strings.ToLower(city))
+		}
+	}
+	clear()
+	t.Cleanup(clear)
+	return wp, transport
+}
+
+const hangzhouWeather = "⛅ 杭州, 浙江, 中国\n\n" +
+	"🌡 22.4°C 多云，体感 21.9°C\n" +
+	"💧 湿度 58%\n" +
+	"💨 东南风 11.2 km/h\n\n" +
+	"📅 预报:\n" +
+	"05-01 周三 ⛅ 多云 15~25°C\n" +
+	"05-02 周四 🌧 小雨 15~20°C\n" +
+	"05-03 周五 ☀️ 晴 16~28°C"
+
+func TestParseOpenMeteoFixtures(t *testing.T) {
+	place, err := parseGeocoding(readFixture(t, "open_meteo_geocoding.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *place != (weatherPlace{Name: "杭州", Latitude: 30.29366, Longitude: 120.16142, Country: "中国", Admin1: "浙江"}) {
+		t.Errorf("place = %+v", place)
+	}
+	if _, err := parseGeocoding(readFixture(t, "open_meteo_geocoding_empty.json")); err == nil || err.Error() != "找不到该城市" {
+		t.Errorf("empty geocoding = %v", err)
+	}
+
+	forecast, err := parseForecast(readFixture(t, "open_meteo_forecast.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := forecast.Current; c.Temperature != 22.4 || c.FeelsLike != 21.9 || c.Humidity != 58 || c.WindDirection != 135 || c.WeatherCode != 2 {
+		t.Errorf("current = %+v", c)
+	}
+	if len(forecast.Daily.Time) != 3 || forecast.Daily.Min[1] != 14.6 || forecast.Daily.WeatherCode[1] != 61 {
+		t.Errorf("daily = %+v", forecast.Daily)
+	}
+
+	for _, body := range []string{`{"daily": {}}`, `not json`} {
+		if _, err := parseForecast([]byte(body)); err == nil {
+			t.Errorf("parseForecast(%q) should fail", body)
+		}
+	}
+
+	if got := formatWeather(&weatherReport{Place: *place, Forecast: *forecast}); got != hangzhouWeather {
+		t.Errorf("formatWeather =\n%s\nwant\n%s", got, hangzhouWeather)
+	}
+}
+
+func TestFormatWeatherShortDaily(t *testing.T) {
+	// 缺少每日天气代码时按代码0显示
+	r := &weatherReport{
+		Place: weatherPlace{Name: "London", Admin1: "London", Country: "United Kingdom"},
+		Forecast: weatherForecast{
+			Current: weatherCurrent{Time: "2024-05-01T14:00", Temperature: -1.25, FeelsLike: -5, Humidity: 90.4, WindSpeed: 3, WindDirection: 350, WeatherCode: 73},
+			Daily:   weatherDaily{Time: []string{"2024-05-01", "2024-05-02"}, Max: []float64{1, 2}, Min: []float64{-3, -2}},
+		},
+	}
+	want := "❄️ London, United Kingdom\n\n🌡 -1.2°C 中雪，体感 -5.0°C\n💧 湿度 90%\n💨 北风 3.0 km/h\n\n📅 预报:\n" +
+		"05-01 周三 ☀️ 晴 -3~1°C\n05-02 周四 ☀️ 晴 -2~2°C"
+	if got := formatWeather(r); got != want {
+		t.Errorf("formatWeather =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWindDirection(t *testing.T) {
+	tests := map[float64]string{0: "北", 22.4: "北", 22.5: "东北", 90: "东", 135: "东南", 180: "南", 225: "西南", 270: "西", 315: "西北", 337.5: "北", 359.9: "北"}
+	for degrees, want := range tests {
+		if got := windDirection(degrees); got != want {
+			t.Errorf("windDirection(%v) = %s, want %s", degrees, got, want)
+		}
+	}
+}
+
+func TestWeatherCommandUsesFixtures(t *testing.T) {
+	wp, transport := newWeatherTest(t, "杭州")
+	env := newTestEnv()
+	wp.RegisterCommands(env.parser)
+
+	out, err := env.run(nil, "weather 杭州")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Text != hangzhouWeather {
+		t.Errorf("output =\n%s\nwant\n%s", out.Text, hangzhouWeather)
+	}
+
+	if transport.count() != 2 {
+		t.Fatalf("made %d requests, want 2", transport.count())
+	}
+	geo, forecast := transport.requests[0].URL.Query(), transport.requests[1].URL.Query()
+	if geo.Get("name") != "杭州" || geo.Get("count") != "1" || geo.Get("language") != "zh" {
+		t.Errorf("geocoding query = %v", geo)
+	}
+	if forecast.Get("latitude") != "30.2937" || forecast.Get("longitude") != "120.1614" || forecast.Get("forecast_days") != "3" || forecast.Get("timezone") != "auto" {
+		t.Errorf("forecast query = %v", forecast)
+	}
+
+	// 缓存命中时不再请求
+	if _, err := env.run(nil, "weather 杭州"); err != nil {
+		t.Fatal(err)
+	}
+	if transport.count() != 2 {
+		t.Errorf("cached lookup made %d requests, want 2", transport.count())
+	}
+}
+
+func TestWeatherDefaultCity(t *testing.T) {
+	wp, _ := newWeatherTest(t, "杭州")
+	env := newTestEnv()
+	wp.RegisterCommands(env.parser)
+
+	out, err := env.run(nil, "weather")
+	if err != nil || !strings.HasPrefix(out.Text, "用法:") {
+		t.Fatalf("weather without default = %+v, %v", out, err)
+	}
+	out, err = env.run(nil, "weather set 杭州")
+	if err != nil || out.Text != "✅ 默认城市已设置为 杭州, 浙江, 中国，之后可以直接使用 .weather" {
+		t.Fatalf("weather set = %+v, %v", out, err)
+	}
+	out, err = env.run(nil, "weather")
+	if err != nil || out.Text != hangzhouWeather {
+		t.Fatalf("weather with default = %+v, %v", out, err)
+	}
+	out, _ = env.run(nil, "weather set")
+	if !strings.HasPrefix(out.Text, "当前默认城市: 杭州") {
+		t.Errorf("weather set without city = %q", out.Text)
+	}
+}
+
+func TestWeatherErrors(t *testing.T) {
+	wp, transport := newWeatherTest(t, "nowhere", "bad")
+	env := newTestEnv()
+	wp.RegisterCommands(env.parser)
+
+	transport.bodies[geocodingHost] = readFixture(t, "open_meteo_geocoding_empty.json")
+	out, _ := env.run(nil, "weather nowhere")
+	if out.Text != "❌ 查询 nowhere 的天气失败: 找不到该城市" {
+		t.Errorf("unknown city = %q", out.Text)
+	}
+
+	// 参数错误时显示接口返回的原因
+	transport.bodies[geocodingHost] = readFixture(t, "open_meteo_geocoding.json")
+	transport.bodies[forecastHost] = readFixture(t, "open_meteo_error.json")
+	transport.statuses[forecastHost] = http.StatusBadRequest
+	out, _ = env.run(nil, "weather bad")
+	if out.Text != "❌ 查询 bad 的天气失败: Latitude must be in range of -90 to 90°. Given: 91.0." {
+		t.Errorf("api error = %q", out.Text)
+	}
+
+	transport.bodies[forecastHost] = []byte("<html>bad gateway</html>")
+	transport.statuses[forecastHost] = http.StatusBadGateway
+	if _, _, err := wp.report(context.Background(), "bad"); err == nil || err.Error() != "响应异常 (状态码: 502)" {
+		t.Errorf("bad gateway = %v", err)
+	}
+}
+
+func TestWeatherStaleFallback(t *testing.T) {
+	wp, transport := newWeatherTest(t, "杭州")
+	ctx := context.Background()
+
+	fresh, stale, err := wp.report(ctx, "杭州")
+	if err != nil || stale {
+		t.Fatalf("report = %v, %v", stale, err)
+	}
+	// 缓存过期后服务无法访问时返回过期的数据
+	weatherReports.SetUntil("杭州", fresh, time.Now().Add(-time.Minute))
+	transport.err = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	report, stale, err := wp.report(ctx, "杭州")
+	if err != nil || !stale || report != fresh {
+		t.Fatalf("report while offline = %p, %v, %v; want cached report", report, stale, err)
+	}
+
+	// 没有缓存时返回网络错误并附加说明
+	weatherReports.Delete("杭州")
+	_, _, err = wp.report(ctx, "杭州")
+	if !isNetworkError(err) {
+		t.Fatalf("report without cache = %v, want network error", err)
+	}
+	if msg := explainWeatherError(err).Error(); !strings.HasPrefix(msg, "无法连接天气服务，请检查网络后稍后再试") {
+		t.Errorf("explainWeatherError = %q", msg)
+	}
+	if explainWeatherError(errors.New("x")).Error() != "x" {
+		t.Error("other errors should be returned unchanged")
+	}
+}
@@ -0,0 +1,277 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"nexusvalet/pkg/logger"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultChatCap 每个对话最多保留的索引消息数，超出时删除最早的消息
+	DefaultChatCap = 20000
+	// queueSize 索引队列长度，队列满时丢弃新消息而不阻塞更新处理
+	queueSize = 1000
+	// pruneEvery 每写入多少条消息检查一次容量
+	pruneEvery = 200
+)
+
+// Doc 待索引的消息
+type Doc struct {
+	ChatID   int64
+	MsgID    int
+	SenderID int64
+	Sender   string
+	Date     time.Time
+	Text     string
+	Edited   bool // 编辑后的消息只更新已索引的记录
+}
+
+// Hit 搜索结果
+type Hit struct {
+	Doc
+	Snippet string
+}
+
+// Index 基于SQLite FTS5的本地消息索引。只索引显式启用的对话
+type Index struct {
+	db      *sql.DB
+	cap     int
+	enabled map[int64]bool
+	written map[int64]int
+	queue   chan Doc
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+	mutex   sync.RWMutex
+}
+
+// NewIndex 创建索引并加载已启用的对话
+func NewIndex(db *sql.DB, chatCap int) (*Index, error) {
+	if chatCap <= 0 {
+		chatCap = DefaultChatCap
+	}
+	idx := &Index{
+		db:      db,
+		cap:     chatCap,
+		enabled: make(map[int64]bool),
+		written: make(map[int64]int),
+		queue:   make(chan Doc, queueSize),
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS lsearch_chats (
+		chat_id INTEGER PRIMARY KEY,
+		enabled_at INTEGER NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create lsearch_chats table: %w", err)
+	}
+	if _, err := db.Exec(`
+	CREATE VIRTUAL TABLE IF NOT EXISTS lsearch_fts USING fts5(
+		tokens,
+		text UNINDEXED,
+		chat_id UNINDEXED,
+		msg_id UNINDEXED,
+		sender_id UNINDEXED,
+		sender UNINDEXED,
+		date UNINDEXED
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create lsearch_fts table: %w", err)
+	}
+
+	rows, err := db.Query("SELECT chat_id FROM lsearch_chats")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, err
+		}
+		idx.enabled[chatID] = true
+	}
+	return idx, rows.Err()
+}
+
+// Run 启动后台索引协程
+func (idx *Index) Run() {
+	go func() {
+		defer close(idx.doneCh)
+		for {
+			select {
+			case <-idx.stopCh:
+				return
+			case doc := <-idx.queue:
+				var err error
+				if doc.Edited {
+					err = idx.Update(doc)
+				} else {
+					err = idx.Add(doc)
+				}
+				if err != nil {
+					logger.Warnf("Failed to index message %d in chat %d: %v", doc.MsgID, doc.ChatID, err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止后台索引协程
+func (idx *Index) Stop() {
+	close(idx.stopCh)
+	<-idx.doneCh
+}
+
+// Enabled 对话是否启用了索引
+func (idx *Index) Enabled(chatID int64) bool {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	return idx.enabled[chatID]
+}
+
+// Enable 为对话启用索引
+func (idx *Index) Enable(chatID int64) error {
+	if _, err := idx.db.Exec("INSERT OR REPLACE INTO lsearch_chats (chat_id, enabled_at) VALUES (?, ?)", chatID, time.Now().Unix()); err != nil {
+		return err
+	}
+	idx.mutex.Lock()
+	idx.enabled[chatID] = true
+	idx.mutex.Unlock()
+	return nil
+}
+
+// Disable 禁用对话索引并删除该对话的所有索引数据
+func (idx *Index) Disable(chatID int64) error {
+	idx.mutex.Lock()
+	delete(idx.enabled, chatID)
+	delete(idx.written, chatID)
+	idx.mutex.Unlock()
+
+	if _, err := idx.db.Exec("DELETE FROM lsearch_chats WHERE chat_id = ?", chatID); err != nil {
+		return err
+	}
+	_, err := idx.db.Exec("DELETE FROM lsearch_fts WHERE chat_id = ?", chatID)
+	return err
+}
+
+// Enqueue 将消息加入索引队列。未启用的对话直接忽略，队列满时丢弃
+func (idx *Index) Enqueue(doc Doc) {
+	if strings.TrimSpace(doc.Text) == "" || !idx.Enabled(doc.ChatID) {
+		return
+	}
+	select {
+	case idx.queue <- doc:
+	default:
+		logger.Warnf("Search index queue full, dropping message %d in chat %d", doc.MsgID, doc.ChatID)
+	}
+}
+
+// Add 写入一条消息，已存在的同ID消息(如被编辑)会被替换
+func (idx *Index) Add(doc Doc) error {
+	if !idx.Enabled(doc.ChatID) {
+		return nil
+	}
+
+	tokens := strings.Join(Tokenize(doc.Text), " ")
+	if tokens == "" {
+		return nil
+	}
+
+	if _, err := idx.db.Exec("DELETE FROM lsearch_fts WHERE chat_id = ? AND msg_id = ?", doc.ChatID, doc.MsgID); err != nil {
+		return err
+	}
+	if _, err := idx.db.Exec("INSERT INTO lsearch_fts (tokens, text, chat_id, msg_id, sender_id, sender, date) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		tokens, doc.Text, doc.ChatID, doc.MsgID, doc.SenderID, doc.Sender, doc.Date.Unix()); err != nil {
+		return err
+	}
+
+	idx.mutex.Lock()
+	idx.written[doc.ChatID]++
+	shouldPrune := idx.written[doc.ChatID]%pruneEvery == 1
+	idx.mutex.Unlock()
+
+	if shouldPrune {
+		return idx.prune(doc.ChatID)
+	}
+	return nil
+}
+
+// Update 更新已索引的消息(如被编辑)，未索引过的消息不会被新增
+func (idx *Index) Update(doc Doc) error {
+	var count int
+	if err := idx.db.QueryRow("SELECT count(*) FROM lsearch_fts WHERE chat_id = ? AND msg_id = ?", doc.ChatID, doc.MsgID).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+	return idx.Add(doc)
+}
+
+// prune 删除超出容量的最早消息
+func (idx *Index) prune(chatID int64) error {
+	var count int
+	if err := idx.db.QueryRow("SELECT count(*) FROM lsearch_fts WHERE chat_id = ?", chatID).Scan(&count); err != nil {
+		return err
+	}
+	if count <= idx.cap {
+		return nil
+	}
+	_, err := idx.db.Exec(`DELETE FROM lsearch_fts WHERE rowid IN (
+		SELECT rowid FROM lsearch_fts WHERE chat_id = ? ORDER BY date ASC LIMIT ?
+	)`, chatID, count-idx.cap)
+	if err == nil {
+		logger.Debugf("Pruned %d indexed messages in chat %d", count-idx.cap, chatID)
+	}
+	return err
+}
+
+// Count 返回对话已索引的消息数
+func (idx *Index) Count(chatID int64) (int, error) {
+	var count int
+	err := idx.db.QueryRow("SELECT count(*) FROM lsearch_fts WHERE chat_id = ?", chatID).Scan(&count)
+	return count, err
+}
+
+// Search 在对话中执行按相关度排序的搜索。senderID非0时只返回该发送者的消息
+func (idx *Index) Search(chatID int64, q *Query, senderID int64, limit int) ([]Hit, error) {
+	where := []string{"lsearch_fts MATCH ?", "chat_id = ?"}
+	args := []interface{}{q.MatchExpression(), chatID}
+	if senderID != 0 {
+		where = append(where, "sender_id = ?")
+		args = append(args, senderID)
+	}
+	if !q.After.IsZero() {
+		where = append(where, "date >= ?")
+		args = append(args, q.After.Unix())
+	}
+	if !q.Before.IsZero() {
+		where = append(where, "date < ?")
+		args = append(args, q.Before.Unix())
+	}
+	args = append(args, limit)
+
+	rows, err := idx.db.Query(fmt.Sprintf(`SELECT msg_id, sender_id, sender, date, text FROM lsearch_fts
+		WHERE %s ORDER BY rank LIMIT ?`, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []Hit
+	for rows.Next() {
+		hit := Hit{Doc: Doc{ChatID: chatID}}
+		var date int64
+		if err := rows.Scan(&hit.MsgID, &hit.SenderID, &hit.Sender, &date, &hit.Text); err != nil {
+			return nil, err
+		}
+		hit.Date = time.Unix(date, 0)
+		hit.Snippet = Snippet(hit.Text, q.Terms, 30)
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
@@ -0,0 +1,165 @@
+package search
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const testChat = -1001
+
+func newTestIndex(t *testing.T, chatCap int) *Index {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "search.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	idx, err := NewIndex(db, chatCap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Enable(testChat); err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+var baseDate = time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+
+func addDocs(t *testing.T, idx *Index, texts ...string) {
+	t.Helper()
+	for i, text := range texts {
+		doc := Doc{ChatID: testChat, MsgID: i + 1, SenderID: int64(100 + i%2), Date: baseDate.AddDate(0, 0, i), Text: text}
+		if err := idx.Add(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func searchIDs(t *testing.T, idx *Index, input string, senderID int64) []int {
+	t.Helper()
+	q, err := ParseQuery(input)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q): %v", input, err)
+	}
+	hits, err := idx.Search(testChat, q, senderID, 50)
+	if err != nil {
+		t.Fatalf("Search(%q): %v", input, err)
+	}
+	ids := []int{}
+	for _, h := range hits {
+		ids = append(ids, h.MsgID)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func TestIndexSearchMixedText(t *testing.T) {
+	idx := newTestIndex(t, 0)
+	addDocs(t, idx,
+		"今天用Go写代码",         // 1, sender 100
+		"北京天气很好",           // 2, sender 101
+		"Python和Go都不错",     // 3, sender 100
+		"我在北京用python",      // 4, sender 101
+		"代码审查 code review", // 5, sender 100
+	)
+
+	tests := []struct {
+		query    string
+		senderID int64
+		want     []int
+	}{
+		{"go", 0, []int{1, 3}},
+		{"GO", 0, []int{1, 3}},
+		{"北京", 0, []int{2, 4}},
+		{"北", 0, []int{2, 4}},
+		{"北京 python", 0, []int{4}},
+		{"写代码", 0, []int{1}},
+		{"代码", 0, []int{1, 5}},
+		{"代写", 0, []int{}},
+		{"code-review", 0, []int{5}},
+		{"review code", 0, []int{5}},
+		{"go", 100, []int{1, 3}},
+		{"北京", 100, []int{}},
+		{"python after:2024-05-04", 0, []int{4}},
+		{"python before:2024-05-04", 0, []int{3}},
+	}
+	for _, tt := range tests {
+		if got := searchIDs(t, idx, tt.query, tt.senderID); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search %q (sender %d) = %v, want %v", tt.query, tt.senderID, got, tt.want)
+		}
+	}
+}
+
+func TestIndexSnippetInHits(t *testing.T) {
+	idx := newTestIndex(t, 0)
+	addDocs(t, idx, "今天用Go写代码")
+	q, _ := ParseQuery("写代码")
+	hits, err := idx.Search(testChat, q, 0, 10)
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("Search = %v, %v", hits, err)
+	}
+	if hits[0].Snippet != "今天用Go【写代码】" || hits[0].SenderID != 100 || !hits[0].Date.Equal(baseDate) {
+		t.Errorf("hit = %+v", hits[0])
+	}
+}
+
+func TestIndexEnableUpdateDisable(t *testing.T) {
+	idx := newTestIndex(t, 0)
+
+	// 未启用的对话不写入
+	if err := idx.Add(Doc{ChatID: 42, MsgID: 1, Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := idx.Count(42); n != 0 {
+		t.Errorf("disabled chat has %d docs", n)
+	}
+
+	addDocs(t, idx, "old text")
+	// 编辑替换原记录
+	if err := idx.Update(Doc{ChatID: testChat, MsgID: 1, Date: baseDate, Text: "new words"}); err != nil {
+		t.Fatal(err)
+	}
+	// 未索引过的消息被编辑时不新增
+	if err := idx.Update(Doc{ChatID: testChat, MsgID: 99, Date: baseDate, Text: "new words"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchIDs(t, idx, "new", 0); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("search new = %v, want [1]", got)
+	}
+	if got := searchIDs(t, idx, "old", 0); len(got) != 0 {
+		t.Errorf("search old = %v, want none", got)
+	}
+
+	if err := idx.Disable(testChat); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := idx.Count(testChat); n != 0 || idx.Enabled(testChat) {
+		t.Errorf("after Disable: %d docs, enabled %v", n, idx.Enabled(testChat))
+	}
+}
+
+func TestIndexPrunesOldest(t *testing.T) {
+	idx := newTestIndex(t, 3)
+	// 第1条写入时检查一次容量，之后每 pruneEvery 条检查一次
+	texts := make([]string, pruneEvery+1)
+	for i := range texts {
+		texts[i] = "msg"
+	}
+	addDocs(t, idx, texts...)
+	if n, _ := idx.Count(testChat); n != 3 {
+		t.Fatalf("Count = %d, want 3", n)
+	}
+	got := searchIDs(t, idx, "msg", 0)
+	if want := []int{pruneEvery - 1, pruneEvery, pruneEvery + 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept %v, want newest %v", got, want)
+	}
+}
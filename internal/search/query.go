@@ -0,0 +1,133 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Query 解析后的搜索请求
+type Query struct {
+	Terms  []string  // 关键词(原文)，用于生成FTS表达式和高亮
+	Sender string    // sender: 过滤，用户ID或@用户名
+	Before time.Time // before: 过滤(不含当天)
+	After  time.Time // after: 过滤(含当天)
+}
+
+// dateLayout before:/after: 使用的日期格式
+const dateLayout = "2006-01-02"
+
+// ParseQuery 解析查询字符串，支持 sender:、before:、after: 过滤
+func ParseQuery(input string) (*Query, error) {
+	q := &Query{}
+	for _, field := range strings.Fields(input) {
+		key, value, found := strings.Cut(field, ":")
+		if found && value != "" {
+			switch strings.ToLower(key) {
+			case "sender", "from":
+				q.Sender = value
+				continue
+			case "before":
+				t, err := time.ParseInLocation(dateLayout, value, time.Local)
+				if err != nil {
+					return nil, fmt.Errorf("无效的日期 %s，格式应为 YYYY-MM-DD", value)
+				}
+				q.Before = t
+				continue
+			case "after":
+				t, err := time.ParseInLocation(dateLayout, value, time.Local)
+				if err != nil {
+					return nil, fmt.Errorf("无效的日期 %s，格式应为 YYYY-MM-DD", value)
+				}
+				q.After = t
+				continue
+			}
+		}
+		q.Terms = append(q.Terms, field)
+	}
+
+	if len(q.Terms) == 0 {
+		return nil, fmt.Errorf("查询关键词为空")
+	}
+	if q.MatchExpression() == "" {
+		return nil, fmt.Errorf("查询中没有可搜索的文字")
+	}
+	return q, nil
+}
+
+// MatchExpression 生成FTS5 MATCH表达式：每个关键词切分为词元后作为短语，关键词之间为AND
+// 以单个CJK字结尾的短语使用前缀匹配，这样单字也能匹配到索引中的二元组
+func (q *Query) MatchExpression() string {
+	var parts []string
+	for _, term := range q.Terms {
+		tokens := Tokenize(term)
+		if len(tokens) == 0 {
+			continue
+		}
+		phrase := `"` + strings.Join(tokens, " ") + `"`
+		last := []rune(tokens[len(tokens)-1])
+		if len(last) == 1 && isCJK(last[0]) {
+			phrase += "*"
+		}
+		parts = append(parts, phrase)
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// Snippet 截取文本中第一个命中关键词附近的片段，并用【】标记命中部分
+func Snippet(text string, terms []string, radius int) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// 少数字符小写后长度不同，此时退回区分大小写的匹配
+		lower = runes
+	}
+
+	start, length := -1, 0
+	for _, term := range terms {
+		t := []rune(strings.ToLower(term))
+		if idx := indexRunes(lower, t); idx >= 0 && (start < 0 || idx < start) {
+			start, length = idx, len(t)
+		}
+	}
+
+	if start < 0 {
+		if len(runes) > radius*2 {
+			return string(runes[:radius*2]) + "…"
+		}
+		return text
+	}
+
+	from := start - radius
+	prefix := "…"
+	if from <= 0 {
+		from, prefix = 0, ""
+	}
+	to := start + length + radius
+	suffix := "…"
+	if to >= len(runes) {
+		to, suffix = len(runes), ""
+	}
+
+	return prefix + string(runes[from:start]) + "【" + string(runes[start:start+length]) + "】" + string(runes[start+length:to]) + suffix
+}
+
+// indexRunes 在rune切片中查找子串
+func indexRunes(s, sub []rune) int {
+	if len(sub) == 0 {
+		return -1
+	}
+	for i := 0; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,91 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		terms []string
+		want  string
+	}{
+		{[]string{"hello"}, `"hello"`},
+		{[]string{"Hello"}, `"hello"`},
+		{[]string{"北京"}, `"北京"`},
+		{[]string{"北"}, `"北"*`},
+		{[]string{"我爱北京", "go"}, `"我爱 爱北 北京" AND "go"`},
+		{[]string{"用Go写"}, `"用 go 写"*`},
+		{[]string{"go-lang"}, `"go lang"`},
+		{[]string{"!!!", "ok"}, `"ok"`},
+		{[]string{"!!!"}, ""},
+	}
+	for _, tt := range tests {
+		q := &Query{Terms: tt.terms}
+		if got := q.MatchExpression(); got != tt.want {
+			t.Errorf("MatchExpression(%q) = %s, want %s", tt.terms, got, tt.want)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery("北京 sender:@bob After:2024-01-02 before:2024-02-01 from: url:x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"北京", "from:", "url:x"}; !reflect.DeepEqual(q.Terms, want) {
+		t.Errorf("Terms = %q, want %q", q.Terms, want)
+	}
+	if q.Sender != "@bob" {
+		t.Errorf("Sender = %q", q.Sender)
+	}
+	if want := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local); !q.After.Equal(want) {
+		t.Errorf("After = %v, want %v", q.After, want)
+	}
+	if want := time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local); !q.Before.Equal(want) {
+		t.Errorf("Before = %v, want %v", q.Before, want)
+	}
+
+	if q, err := ParseQuery("from:123 hi"); err != nil || q.Sender != "123" {
+		t.Errorf("from: alias = %+v, %v", q, err)
+	}
+
+	for input, want := range map[string]string{
+		"sender:@bob":      "查询关键词为空",
+		"":                 "查询关键词为空",
+		"!!! ???":          "没有可搜索的文字",
+		"hi before:2024/1": "无效的日期 2024/1",
+		"hi after:昨天":      "无效的日期 昨天",
+	} {
+		if _, err := ParseQuery(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseQuery(%q) = %v, want error containing %q", input, err, want)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		terms  []string
+		radius int
+		want   string
+	}{
+		{"cjk match in the middle", "abcdefghij北京xyz", []string{"北京"}, 3, "…hij【北京】xyz"},
+		{"case insensitive keeps original case", "Hello World", []string{"world"}, 20, "Hello 【World】"},
+		{"earliest term wins", "abc", []string{"c", "a"}, 0, "【a】…"},
+		{"both sides cut", "0123456789目标0123456789", []string{"目标"}, 2, "…89【目标】01…"},
+		{"no match long text", "abcdefgh", []string{"zz"}, 2, "abcd…"},
+		{"no match short text", "短文本", []string{"zz"}, 5, "短文本"},
+		{"empty term ignored", "abc", []string{""}, 5, "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Snippet(tt.text, tt.terms, tt.radius); got != tt.want {
+				t.Errorf("Snippet(%q, %q, %d) = %q, want %q", tt.text, tt.terms, tt.radius, got, tt.want)
+			}
+		})
+	}
+}
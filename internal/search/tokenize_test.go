@@ -0,0 +1,37 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"latin words lowercased", "Hello World", []string{"hello", "world"}},
+		{"punctuation splits words", "foo,bar.baz", []string{"foo", "bar", "baz"}},
+		{"digits", "GPT-4o 2024", []string{"gpt", "4o", "2024"}},
+		{"accented letters", "Café ÄBC", []string{"café", "äbc"}},
+		{"single cjk character", "中", []string{"中"}},
+		{"cjk bigrams", "我爱北京", []string{"我爱", "爱北", "北京"}},
+		{"cjk and latin mixed", "用Go写代码", []string{"用", "go", "写代", "代码"}},
+		{"cjk next to digits", "第3章节", []string{"第", "3", "章节"}},
+		{"cjk runs split by punctuation", "你好，世界", []string{"你好", "世界"}},
+		{"hiragana", "こんにちは", []string{"こん", "んに", "にち", "ちは"}},
+		{"katakana", "カタカナ", []string{"カタ", "タカ", "カナ"}},
+		{"hangul", "한국어", []string{"한국", "국어"}},
+		{"emoji ignored", "emoji 😀 测试", []string{"emoji", "测试"}},
+		{"only symbols", "!!! ??? 😀", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tokenize(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
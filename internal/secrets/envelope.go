@@ -0,0 +1,109 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// envelopePrefix 信封格式前缀，包含格式版本
+	envelopePrefix = "nvs1:"
+	// KeySize 主密钥长度(AES-256)
+	KeySize = 32
+	// SaltSize 密钥派生使用的盐长度
+	SaltSize = 16
+	// kdfIterations PBKDF2-SHA256 迭代次数
+	kdfIterations = 600000
+)
+
+// ErrDecrypt 解密失败(密钥错误或数据被篡改)
+var ErrDecrypt = errors.New("secrets: decryption failed")
+
+// DeriveKey 使用 PBKDF2-SHA256 从口令派生主密钥
+func DeriveKey(passphrase string, salt []byte) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("secrets: empty passphrase")
+	}
+	return pbkdf2.Key(sha256.New, passphrase, salt, kdfIterations, KeySize)
+}
+
+// NewSalt 生成随机盐
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// Seal 使用 AES-GCM 和随机 nonce 加密明文，返回信封字符串
+// 格式: nvs1:base64(nonce || ciphertext)，附加数据为 name，防止密文在不同条目间被替换
+func Seal(key []byte, name, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return sealWithNonce(gcm, nonce, name, plaintext), nil
+}
+
+// sealWithNonce 使用指定的 nonce 加密，nonce 不能重复使用
+func sealWithNonce(gcm cipher.AEAD, nonce []byte, name, plaintext string) string {
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(name))
+	return envelopePrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// Open 解密信封字符串
+func Open(key []byte, name, envelope string) (string, error) {
+	if !IsEnvelope(envelope) {
+		return "", fmt.Errorf("secrets: unsupported envelope format")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(envelope, envelopePrefix))
+	if err != nil {
+		return "", fmt.Errorf("secrets: invalid envelope encoding: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize()+gcm.Overhead() {
+		return "", ErrDecrypt
+	}
+
+	nonce, ciphertext := raw[:gcm.NonceSize()], raw[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plaintext), nil
+}
+
+// IsEnvelope 判断值是否为加密信封
+func IsEnvelope(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
+
+// newGCM 创建 AES-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secrets: invalid key size %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
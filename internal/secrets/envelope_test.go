@@ -0,0 +1,178 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+// 期望值使用 Python hashlib.pbkdf2_hmac('sha256', ..., 600000, 32) 独立计算
+func TestDeriveKeyVectors(t *testing.T) {
+	tests := []struct {
+		passphrase string
+		salt       []byte
+		want       string
+	}{
+		{
+			passphrase: "correct horse battery staple",
+			salt:       []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+			want:       "ef177144eec9420cbc1093d2a8b344a92bc506d0d4ec9c028dd19f8324d8c1e6",
+		},
+		{
+			passphrase: "口令-测试",
+			salt:       []byte("nexusvalet-salt!"),
+			want:       "c7671e69d54e3ce0507528b81a1f27cd709d6f91291b024193e70f20ba797b9e",
+		},
+	}
+	for _, tt := range tests {
+		key, err := DeriveKey(tt.passphrase, tt.salt)
+		if err != nil {
+			t.Fatalf("DeriveKey(%q): %v", tt.passphrase, err)
+		}
+		if got := hex.EncodeToString(key); got != tt.want {
+			t.Errorf("DeriveKey(%q) = %s, want %s", tt.passphrase, got, tt.want)
+		}
+	}
+}
+
+func TestDeriveKeyEmptyPassphrase(t *testing.T) {
+	if _, err := DeriveKey("", []byte("salt")); err == nil {
+		t.Fatal("DeriveKey with empty passphrase should fail")
+	}
+}
+
+// gcmVector AES-256-GCM 的公开测试向量(McGrew & Viega, Test Case 16)，附加数据作为条目名称
+var gcmVector = struct {
+	key, nonce, aad, plaintext, ciphertext, tag string
+}{
+	key:        "feffe9928665731c6d6a8f9467308308feffe9928665731c6d6a8f9467308308",
+	nonce:      "cafebabefacedbaddecaf888",
+	aad:        "feedfacedeadbeeffeedfacedeadbeefabaddad2",
+	plaintext:  "d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39",
+	ciphertext: "522dc1f099567d07f47f37a32a84427d643a8cdcbfe5c0c97598a2bd2555d1aa8cb08e48590dbb3da7b08b1056828838c5f61e6393ba7a0abcc9f662",
+	tag:        "76fc6ece0f4e1768cddf8853bb2d551b",
+}
+
+func TestSealVector(t *testing.T) {
+	key := mustHex(t, gcmVector.key)
+	gcm, err := newGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := string(mustHex(t, gcmVector.aad))
+	plaintext := string(mustHex(t, gcmVector.plaintext))
+
+	got := sealWithNonce(gcm, mustHex(t, gcmVector.nonce), name, plaintext)
+	want := "nvs1:yv66vvrO263eyviIUi3B8JlWfQf0fzejKoRCfWQ6jNy/5cDJdZiivSVV0aqMsI5IWQ27PaewixBWgog4xfYeY5O6egq8yfZidvxuzg9OF2jN34hTuy1VGw=="
+	if got != want {
+		t.Fatalf("sealWithNonce = %s, want %s", got, want)
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(got, envelopePrefix))
+	wantRaw := mustHex(t, gcmVector.nonce+gcmVector.ciphertext+gcmVector.tag)
+	if !bytes.Equal(raw, wantRaw) {
+		t.Fatalf("envelope payload = %x, want nonce||ciphertext||tag %x", raw, wantRaw)
+	}
+
+	opened, err := Open(key, name, want)
+	if err != nil {
+		t.Fatalf("Open vector: %v", err)
+	}
+	if opened != plaintext {
+		t.Fatalf("Open vector = %x, want %s", opened, gcmVector.plaintext)
+	}
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+	for _, value := range []string{"", "AIzaSy-example", "中文密钥🔑"} {
+		envelope, err := Seal(key, "gemini.api_key", value)
+		if err != nil {
+			t.Fatalf("Seal(%q): %v", value, err)
+		}
+		if !IsEnvelope(envelope) {
+			t.Fatalf("Seal(%q) = %q is not an envelope", value, envelope)
+		}
+		got, err := Open(key, "gemini.api_key", envelope)
+		if err != nil || got != value {
+			t.Fatalf("Open(Seal(%q)) = %q, %v", value, got, err)
+		}
+	}
+}
+
+func TestSealUsesRandomNonce(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+	a, _ := Seal(key, "name", "value")
+	b, _ := Seal(key, "name", "value")
+	if a == b {
+		t.Fatal("two Seal calls produced the same envelope")
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	key := mustHex(t, gcmVector.key)
+	name := "tts.key"
+	envelope, err := Seal(key, name, "secret-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(envelope, envelopePrefix))
+
+	// 依次翻转 nonce、密文和认证标签中的一位
+	for _, i := range []int{0, 12, len(raw) - 1} {
+		tampered := append([]byte(nil), raw...)
+		tampered[i] ^= 0x01
+		_, err := Open(key, name, envelopePrefix+base64.StdEncoding.EncodeToString(tampered))
+		if !errors.Is(err, ErrDecrypt) {
+			t.Errorf("Open with byte %d flipped: err = %v, want ErrDecrypt", i, err)
+		}
+	}
+
+	// 截断到不足 nonce+标签 的长度
+	short := envelopePrefix + base64.StdEncoding.EncodeToString(raw[:20])
+	if _, err := Open(key, name, short); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Open truncated envelope: err = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestOpenRejectsWrongNameAndKey(t *testing.T) {
+	key := mustHex(t, gcmVector.key)
+	envelope, err := Seal(key, "gemini.api_key", "secret-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 附加数据为名称，密文不能被挪到其他条目下使用
+	if _, err := Open(key, "tts.key", envelope); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Open with wrong name: err = %v, want ErrDecrypt", err)
+	}
+
+	wrongKey := bytes.Repeat([]byte{1}, KeySize)
+	if _, err := Open(wrongKey, "gemini.api_key", envelope); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Open with wrong key: err = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestOpenRejectsMalformedEnvelope(t *testing.T) {
+	key := mustHex(t, gcmVector.key)
+	for _, envelope := range []string{"plaintext", "nvs2:AAAA", "nvs1:not base64!"} {
+		if _, err := Open(key, "name", envelope); err == nil {
+			t.Errorf("Open(%q) should fail", envelope)
+		}
+	}
+	if _, err := Seal([]byte("short"), "name", "value"); err == nil {
+		t.Error("Seal with invalid key size should fail")
+	}
+}
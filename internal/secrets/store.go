@@ -0,0 +1,285 @@
+package secrets
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"nexusvalet/pkg/logger"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrLocked 密钥库已启用但尚未解锁
+	ErrLocked = errors.New("secrets: store is locked")
+	// ErrDisabled 尚未启用加密，调用方应回退到原有的明文存储
+	ErrDisabled = errors.New("secrets: encryption not enabled")
+	// ErrWrongPassphrase 口令错误
+	ErrWrongPassphrase = errors.New("secrets: wrong passphrase")
+)
+
+// verifierName/verifierText 用于校验口令的已知明文
+const (
+	verifierName = "__verifier__"
+	verifierText = "nexusvalet-secret-store"
+)
+
+// identifierPattern 只允许合法的表名/键名，遗留表名会被拼接进SQL
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LegacySecret 描述插件配置表中的明文敏感值，解锁时迁移到密钥库
+type LegacySecret struct {
+	Name  string // 密钥库中的名称，例如 gemini.api_key
+	Table string // 原配置表，要求为 (key, value) 结构
+	Key   string // 原配置表中的键
+}
+
+// Store 加密的密钥库。主密钥只保存在内存中
+type Store struct {
+	db     *sql.DB
+	key    []byte
+	legacy []LegacySecret
+	mutex  sync.RWMutex
+}
+
+// NewStore 创建密钥库
+func NewStore(db *sql.DB) (*Store, error) {
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS secret_meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create secret_meta table: %w", err)
+	}
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS secrets (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create secrets table: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Enabled 是否已启用加密(已设置过口令)
+func (s *Store) Enabled() bool {
+	_, err := s.meta("salt")
+	return err == nil
+}
+
+// Locked 是否未解锁
+func (s *Store) Locked() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.key == nil
+}
+
+// Unlock 使用口令解锁。首次解锁时启用加密并生成盐，随后迁移已注册的明文敏感值
+// 返回本次迁移的条目数
+func (s *Store) Unlock(passphrase string) (int, error) {
+	enabled := s.Enabled()
+
+	var salt []byte
+	if enabled {
+		encoded, err := s.meta("salt")
+		if err != nil {
+			return 0, err
+		}
+		salt, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return 0, fmt.Errorf("invalid stored salt: %w", err)
+		}
+	} else {
+		var err error
+		salt, err = NewSalt()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	key, err := DeriveKey(passphrase, salt)
+	if err != nil {
+		return 0, err
+	}
+
+	if enabled {
+		verifier, err := s.meta("verifier")
+		if err != nil {
+			return 0, err
+		}
+		if text, err := Open(key, verifierName, verifier); err != nil || text != verifierText {
+			return 0, ErrWrongPassphrase
+		}
+	} else {
+		verifier, err := Seal(key, verifierName, verifierText)
+		if err != nil {
+			return 0, err
+		}
+		if err := s.setMeta("verifier", verifier); err != nil {
+			return 0, err
+		}
+		if err := s.setMeta("salt", base64.StdEncoding.EncodeToString(salt)); err != nil {
+			return 0, err
+		}
+		logger.Infof("Secret store encryption enabled")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.key = key
+
+	migrated := 0
+	for _, ls := range s.legacy {
+		ok, err := s.migrateLocked(ls)
+		if err != nil {
+			logger.Errorf("Failed to migrate secret %s: %v", ls.Name, err)
+			continue
+		}
+		if ok {
+			migrated++
+		}
+	}
+	return migrated, nil
+}
+
+// Lock 清除内存中的主密钥
+func (s *Store) Lock() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := range s.key {
+		s.key[i] = 0
+	}
+	s.key = nil
+}
+
+// RegisterLegacy 注册明文敏感值的原位置。已解锁时立即迁移，否则在下次解锁时迁移
+func (s *Store) RegisterLegacy(ls LegacySecret) error {
+	if !identifierPattern.MatchString(ls.Table) {
+		return fmt.Errorf("invalid legacy table name %q", ls.Table)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.legacy = append(s.legacy, ls)
+	if s.key != nil {
+		if _, err := s.migrateLocked(ls); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSecret 读取敏感值，不存在时返回空字符串
+func (s *Store) GetSecret(name string) (string, error) {
+	if !s.Enabled() {
+		return "", ErrDisabled
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.key == nil {
+		return "", ErrLocked
+	}
+
+	var envelope string
+	err := s.db.QueryRow("SELECT value FROM secrets WHERE name = ?", name).Scan(&envelope)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return Open(s.key, name, envelope)
+}
+
+// SetSecret 写入敏感值，空值表示删除
+func (s *Store) SetSecret(name, value string) error {
+	if !s.Enabled() {
+		return ErrDisabled
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.key == nil {
+		return ErrLocked
+	}
+	return s.setSecretLocked(name, value)
+}
+
+// setSecretLocked 写入敏感值，调用方需持有锁且已解锁
+func (s *Store) setSecretLocked(name, value string) error {
+	if value == "" {
+		_, err := s.db.Exec("DELETE FROM secrets WHERE name = ?", name)
+		return err
+	}
+	envelope, err := Seal(s.key, name, value)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("INSERT OR REPLACE INTO secrets (name, value) VALUES (?, ?)", name, envelope)
+	return err
+}
+
+// migrateLocked 将明文值加密写入密钥库并覆盖删除原值，调用方需持有写锁
+func (s *Store) migrateLocked(ls LegacySecret) (bool, error) {
+	ctx := context.Background()
+	// 使用同一连接，保证 secure_delete 对后续覆盖和删除生效
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	var value string
+	err = conn.QueryRowContext(ctx, fmt.Sprintf("SELECT value FROM %s WHERE key = ?", ls.Table), ls.Key).Scan(&value)
+	if err == sql.ErrNoRows || (err == nil && value == "") {
+		return false, nil
+	}
+	if err != nil {
+		// 插件表尚未创建
+		if strings.Contains(err.Error(), "no such table") {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !IsEnvelope(value) {
+		envelope, err := Seal(s.key, ls.Name, value)
+		if err != nil {
+			return false, err
+		}
+		if _, err := conn.ExecContext(ctx, "INSERT OR REPLACE INTO secrets (name, value) VALUES (?, ?)", ls.Name, envelope); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA secure_delete = ON"); err != nil {
+		logger.Warnf("Failed to enable secure_delete: %v", err)
+	}
+	overwrite := strings.Repeat("0", len(value))
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET value = ? WHERE key = ?", ls.Table), overwrite, ls.Key); err != nil {
+		return false, err
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE key = ?", ls.Table), ls.Key); err != nil {
+		return false, err
+	}
+
+	logger.Infof("Migrated plaintext secret %s from %s", ls.Name, ls.Table)
+	return true, nil
+}
+
+// meta 读取元数据
+func (s *Store) meta(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow("SELECT value FROM secret_meta WHERE key = ?", key).Scan(&value)
+	return value, err
+}
+
+// setMeta 写入元数据
+func (s *Store) setMeta(key, value string) error {
+	_, err := s.db.Exec("INSERT OR REPLACE INTO secret_meta (key, value) VALUES (?, ?)", key, value)
+	return err
+}
@@ -0,0 +1,215 @@
+package secrets
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	legacyGeminiKey = "AIzaSyLegacyPlaintextGeminiKey0123456789"
+	legacyTTSKey    = "tts-legacy-plaintext-key-abcdef"
+)
+
+// openFixtureDB 创建包含旧版明文密钥的数据库：gemini_config.gemini_key 和 tts_config.key
+func openFixtureDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fixture.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	for _, stmt := range []string{
+		`CREATE TABLE gemini_config (key TEXT PRIMARY KEY, value TEXT NOT NULL)`,
+		`CREATE TABLE tts_config (key TEXT PRIMARY KEY, value TEXT NOT NULL)`,
+		`INSERT INTO gemini_config (key, value) VALUES ('gemini_key', '` + legacyGeminiKey + `')`,
+		`INSERT INTO gemini_config (key, value) VALUES ('gemini_model', 'gemini-1.5-flash')`,
+		`INSERT INTO tts_config (key, value) VALUES ('key', '` + legacyTTSKey + `')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return db, path
+}
+
+func newFixtureStore(t *testing.T, db *sql.DB) *Store {
+	t.Helper()
+	store, err := NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ls := range []LegacySecret{
+		{Name: "gemini.api_key", Table: "gemini_config", Key: "gemini_key"},
+		{Name: "tts.key", Table: "tts_config", Key: "key"},
+	} {
+		if err := store.RegisterLegacy(ls); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func countRows(t *testing.T, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestUnlockMigratesLegacyPlaintext(t *testing.T) {
+	db, path := openFixtureDB(t)
+	store := newFixtureStore(t, db)
+
+	if _, err := store.GetSecret("gemini.api_key"); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("GetSecret before first unlock: err = %v, want ErrDisabled", err)
+	}
+
+	migrated, err := store.Unlock("passphrase")
+	if err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if migrated != 2 {
+		t.Fatalf("Unlock migrated %d secrets, want 2", migrated)
+	}
+
+	for name, want := range map[string]string{"gemini.api_key": legacyGeminiKey, "tts.key": legacyTTSKey} {
+		got, err := store.GetSecret(name)
+		if err != nil || got != want {
+			t.Errorf("GetSecret(%s) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	// 原明文行被删除，同表的其他配置保留
+	if n := countRows(t, db, "SELECT COUNT(*) FROM gemini_config WHERE key = 'gemini_key'"); n != 0 {
+		t.Errorf("gemini_config.gemini_key still has %d rows", n)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM tts_config WHERE key = 'key'"); n != 0 {
+		t.Errorf("tts_config.key still has %d rows", n)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM gemini_config WHERE key = 'gemini_model'"); n != 1 {
+		t.Errorf("unrelated gemini_config row was removed")
+	}
+
+	// 密钥库中只保存信封，不保存明文
+	rows, err := db.Query("SELECT value FROM secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			t.Fatal(err)
+		}
+		if !IsEnvelope(value) {
+			t.Errorf("secrets row %q is not an envelope", value)
+		}
+	}
+	rows.Close()
+
+	// 覆盖写和 secure_delete 之后，数据库文件中不再有明文
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{legacyGeminiKey, legacyTTSKey} {
+		if bytes.Contains(data, []byte(plain)) {
+			t.Errorf("database file still contains plaintext %q", plain)
+		}
+	}
+}
+
+func TestUnlockAgainAndWrongPassphrase(t *testing.T) {
+	db, _ := openFixtureDB(t)
+	store := newFixtureStore(t, db)
+	if _, err := store.Unlock("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Lock()
+	if !store.Locked() {
+		t.Fatal("store should be locked after Lock")
+	}
+	if _, err := store.GetSecret("gemini.api_key"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("GetSecret while locked: err = %v, want ErrLocked", err)
+	}
+	if err := store.SetSecret("gemini.api_key", "x"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("SetSecret while locked: err = %v, want ErrLocked", err)
+	}
+
+	if _, err := store.Unlock("wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("Unlock with wrong passphrase: err = %v, want ErrWrongPassphrase", err)
+	}
+	if !store.Locked() {
+		t.Fatal("store unlocked with wrong passphrase")
+	}
+
+	// 再次解锁时没有需要迁移的明文
+	migrated, err := store.Unlock("passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 0 {
+		t.Fatalf("second Unlock migrated %d secrets, want 0", migrated)
+	}
+	if got, _ := store.GetSecret("tts.key"); got != legacyTTSKey {
+		t.Fatalf("GetSecret(tts.key) after re-unlock = %q", got)
+	}
+}
+
+func TestRegisterLegacyWhileUnlocked(t *testing.T) {
+	db, _ := openFixtureDB(t)
+	store, err := NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Unlock("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 插件在解锁后才注册时立即迁移
+	if err := store.RegisterLegacy(LegacySecret{Name: "tts.key", Table: "tts_config", Key: "key"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.GetSecret("tts.key"); got != legacyTTSKey {
+		t.Fatalf("GetSecret(tts.key) = %q, want %q", got, legacyTTSKey)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM tts_config"); n != 0 {
+		t.Fatalf("tts_config still has %d rows", n)
+	}
+
+	// 表尚未创建时跳过，不报错
+	if err := store.RegisterLegacy(LegacySecret{Name: "missing.key", Table: "missing_config", Key: "key"}); err != nil {
+		t.Fatalf("RegisterLegacy for missing table: %v", err)
+	}
+	if err := store.RegisterLegacy(LegacySecret{Name: "bad", Table: "bad; DROP TABLE secrets", Key: "key"}); err == nil {
+		t.Fatal("RegisterLegacy should reject invalid table names")
+	}
+}
+
+func TestSetSecretEmptyDeletes(t *testing.T) {
+	db, _ := openFixtureDB(t)
+	store := newFixtureStore(t, db)
+	if _, err := store.Unlock("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetSecret("gemini.api_key", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.GetSecret("gemini.api_key"); err != nil || got != "" {
+		t.Fatalf("GetSecret after delete = %q, %v", got, err)
+	}
+}
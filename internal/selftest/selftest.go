@@ -0,0 +1,197 @@
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout 未指定超时的检查使用的超时时间
+const DefaultTimeout = 15 * time.Second
+
+// Check 一个命名的检查项
+type Check struct {
+	Name     string
+	Critical bool // 关键检查失败时调用方应中止启动
+	Timeout  time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Status 检查结果状态
+type Status int
+
+const (
+	// Passed 检查通过
+	Passed Status = iota
+	// Failed 检查失败
+	Failed
+	// Skipped 检查被跳过(例如依赖未配置)
+	Skipped
+)
+
+// Result 单项检查结果
+type Result struct {
+	Name     string
+	Critical bool
+	Status   Status
+	Err      error
+	Duration time.Duration
+}
+
+// Report 一次自检的结果
+type Report struct {
+	Started  time.Time
+	Duration time.Duration
+	Results  []Result
+}
+
+// skipError 表示检查被跳过
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string {
+	return e.reason
+}
+
+// Skipf 在检查中返回，表示该检查不适用而被跳过
+func Skipf(format string, args ...interface{}) error {
+	return &skipError{reason: fmt.Sprintf(format, args...)}
+}
+
+// Run 依次执行检查，每项检查有独立的超时，单项的panic不会影响其他检查
+func Run(ctx context.Context, checks []Check) *Report {
+	report := &Report{Started: time.Now()}
+	for _, check := range checks {
+		report.Results = append(report.Results, runOne(ctx, check))
+	}
+	report.Duration = time.Since(report.Started)
+	return report
+}
+
+// runOne 执行单项检查
+func runOne(ctx context.Context, check Check) Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- check.Run(checkCtx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-checkCtx.Done():
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	result := Result{
+		Name:     check.Name,
+		Critical: check.Critical,
+		Err:      err,
+		Duration: time.Since(start),
+	}
+	var skip *skipError
+	switch {
+	case err == nil:
+		result.Status = Passed
+	case errors.As(err, &skip):
+		result.Status = Skipped
+	default:
+		result.Status = Failed
+	}
+	return result
+}
+
+// Passed 是否所有检查都通过(跳过的不算失败)
+func (r *Report) Passed() bool {
+	for _, res := range r.Results {
+		if res.Status == Failed {
+			return false
+		}
+	}
+	return true
+}
+
+// CriticalFailure 返回第一个失败的关键检查的错误
+func (r *Report) CriticalFailure() error {
+	for _, res := range r.Results {
+		if res.Critical && res.Status == Failed {
+			return fmt.Errorf("critical check %s failed: %w", res.Name, res.Err)
+		}
+	}
+	return nil
+}
+
+// Counts 返回通过、失败和跳过的数量
+func (r *Report) Counts() (passed, failed, skipped int) {
+	for _, res := range r.Results {
+		switch res.Status {
+		case Passed:
+			passed++
+		case Failed:
+			failed++
+		case Skipped:
+			skipped++
+		}
+	}
+	return
+}
+
+// Summary 格式化为多行的 ✅/❌ 摘要
+func (r *Report) Summary() string {
+	var b strings.Builder
+	passed, failed, skipped := r.Counts()
+	b.WriteString(fmt.Sprintf("🩺 自检完成: %d 通过, %d 失败, %d 跳过 (%s)\n", passed, failed, skipped, r.Duration.Round(time.Millisecond)))
+	for _, res := range r.Results {
+		switch res.Status {
+		case Passed:
+			b.WriteString(fmt.Sprintf("✅ %s (%s)\n", res.Name, res.Duration.Round(time.Millisecond)))
+		case Skipped:
+			b.WriteString(fmt.Sprintf("⏭️ %s: %v\n", res.Name, res.Err))
+		default:
+			mark := "❌"
+			if res.Critical {
+				mark = "🛑"
+			}
+			b.WriteString(fmt.Sprintf("%s %s: %v\n", mark, res.Name, res.Err))
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// Short 单行摘要，用于 .status
+func (r *Report) Short() string {
+	passed, failed, skipped := r.Counts()
+	mark := "✅"
+	if failed > 0 {
+		mark = "❌"
+	}
+	var failedNames []string
+	for _, res := range r.Results {
+		if res.Status == Failed {
+			failedNames = append(failedNames, res.Name)
+		}
+	}
+	s := fmt.Sprintf("%s %d/%d 通过", mark, passed, passed+failed)
+	if skipped > 0 {
+		s += fmt.Sprintf(", %d 跳过", skipped)
+	}
+	if len(failedNames) > 0 {
+		s += " (失败: " + strings.Join(failedNames, ", ") + ")"
+	}
+	return s + " @ " + r.Started.Format("01-02 15:04")
+}
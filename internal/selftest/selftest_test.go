@@ -0,0 +1,133 @@
+package selftest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stub 返回固定结果的检查
+func stub(name string, critical bool, err error) Check {
+	return Check{Name: name, Critical: critical, Run: func(context.Context) error { return err }}
+}
+
+func TestRunStatuses(t *testing.T) {
+	report := Run(context.Background(), []Check{
+		stub("ok", true, nil),
+		stub("broken", false, errors.New("boom")),
+		stub("optional", false, Skipf("未配置 %s", "api key")),
+		{Name: "panics", Run: func(context.Context) error { panic("oops") }},
+		{Name: "slow", Timeout: 20 * time.Millisecond, Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}},
+	})
+
+	want := []struct {
+		name   string
+		status Status
+		err    string
+	}{
+		{"ok", Passed, ""},
+		{"broken", Failed, "boom"},
+		{"optional", Skipped, "未配置 api key"},
+		{"panics", Failed, "panic: oops"},
+		{"slow", Failed, "timed out after 20ms"},
+	}
+	if len(report.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(report.Results), len(want))
+	}
+	for i, w := range want {
+		res := report.Results[i]
+		if res.Name != w.name || res.Status != w.status {
+			t.Errorf("result %d = %s/%v, want %s/%v", i, res.Name, res.Status, w.name, w.status)
+		}
+		if (w.err == "") != (res.Err == nil) || (res.Err != nil && res.Err.Error() != w.err) {
+			t.Errorf("%s: err = %v, want %q", w.name, res.Err, w.err)
+		}
+	}
+
+	if passed, failed, skipped := report.Counts(); passed != 1 || failed != 3 || skipped != 1 {
+		t.Errorf("Counts = %d/%d/%d, want 1/3/1", passed, failed, skipped)
+	}
+	if report.Passed() {
+		t.Error("report with failures should not pass")
+	}
+}
+
+func TestRunPassesCheckContext(t *testing.T) {
+	type key struct{}
+	parent := context.WithValue(context.Background(), key{}, "v")
+	var deadline bool
+	Run(parent, []Check{{Name: "ctx", Run: func(ctx context.Context) error {
+		if ctx.Value(key{}) != "v" {
+			t.Error("check context should derive from the parent")
+		}
+		_, deadline = ctx.Deadline()
+		return nil
+	}}})
+	if !deadline {
+		t.Error("check without Timeout should get DefaultTimeout")
+	}
+}
+
+func TestCriticalFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Check
+		want   string
+	}{
+		{"all passed", []Check{stub("a", true, nil)}, ""},
+		{"non critical failure", []Check{stub("a", false, errors.New("x"))}, ""},
+		{"critical skip", []Check{stub("a", true, Skipf("n/a"))}, ""},
+		{"first critical failure", []Check{
+			stub("a", false, errors.New("x")),
+			stub("db", true, errors.New("locked")),
+			stub("schema", true, errors.New("old")),
+		}, "critical check db failed: locked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Run(context.Background(), tt.checks).CriticalFailure()
+			if (tt.want == "") != (err == nil) || (err != nil && err.Error() != tt.want) {
+				t.Errorf("CriticalFailure = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummaryAndShort(t *testing.T) {
+	report := &Report{
+		Started: time.Date(2024, 3, 5, 14, 30, 0, 0, time.Local),
+		Results: []Result{
+			{Name: "database", Critical: true, Status: Passed, Duration: 3 * time.Millisecond},
+			{Name: "messages", Status: Failed, Err: errors.New("FLOOD_WAIT")},
+			{Name: "schema", Critical: true, Status: Failed, Err: errors.New("pending")},
+			{Name: "gemini", Status: Skipped, Err: Skipf("no key")},
+		},
+	}
+
+	summary := report.Summary()
+	for _, line := range []string{
+		"🩺 自检完成: 1 通过, 2 失败, 1 跳过",
+		"✅ database (3ms)",
+		"❌ messages: FLOOD_WAIT",
+		"🛑 schema: pending",
+		"⏭️ gemini: no key",
+	} {
+		if !strings.Contains(summary, line) {
+			t.Errorf("Summary missing %q:\n%s", line, summary)
+		}
+	}
+	if want := "❌ 1/3 通过, 1 跳过 (失败: messages, schema) @ 03-05 14:30"; report.Short() != want {
+		t.Errorf("Short = %q, want %q", report.Short(), want)
+	}
+
+	ok := &Report{Started: report.Started, Results: []Result{{Name: "a", Status: Passed}}}
+	if want := "✅ 1/1 通过 @ 03-05 14:30"; ok.Short() != want {
+		t.Errorf("Short = %q, want %q", ok.Short(), want)
+	}
+}
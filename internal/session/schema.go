@@ -0,0 +1,232 @@
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"nexusvalet/internal/version"
+	"nexusvalet/pkg/logger"
+	"strconv"
+)
+
+// SchemaVersion is the database schema version this binary understands.
+// Bump it together with a new entry in migrations.
+const SchemaVersion = 7
+
+// migration upgrades the schema from version-1 to version
+type migration struct {
+	version int
+	apply   func(tx *sql.Tx) error
+}
+
+// migrations holds all schema migrations in ascending order. The baseline
+// creates the tables owned by this package; tables owned by other packages
+// (peers, secrets, plugin storage, ...) are still created by their owners when
+// they open the database, with all current columns. Later migrations only add
+// the columns those tables gained since, and skip tables that don't exist yet.
+var migrations = []migration{
+	{version: 1, apply: createSessionsTable},
+	{version: 2, apply: addColumns("autosend_tasks", column{"defer_ok", "BOOLEAN NOT NULL DEFAULT 0"})},
+	// old interval/daily tasks are converted to cron_expr by the autosend plugin
+	{version: 3, apply: addColumns("autosend_tasks", column{"cron_expr", "TEXT"})},
+	{version: 4, apply: addColumns("autosend_tasks",
+		column{"last_run", "DATETIME"},
+		column{"last_status", "TEXT"},
+		column{"last_error", "TEXT"},
+		column{"run_count", "INTEGER NOT NULL DEFAULT 0"},
+		column{"consecutive_failures", "INTEGER NOT NULL DEFAULT 0"},
+	)},
+	{version: 5, apply: addColumns("autosend_tasks",
+		column{"media_type", "TEXT"},
+		column{"media_ref", "TEXT"},
+		column{"source_chat_id", "INTEGER NOT NULL DEFAULT 0"},
+		column{"source_msg_id", "INTEGER NOT NULL DEFAULT 0"},
+	)},
+	{version: 6, apply: addColumns("autosend_tasks", column{"timezone", "TEXT NOT NULL DEFAULT ''"})},
+	{version: 7, apply: addColumns("maintenance_windows", column{"sources", "TEXT NOT NULL DEFAULT ''"})},
+}
+
+// createSessionsTable is the baseline migration creating the sessions table
+func createSessionsTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS sessions (
+		user_id INTEGER,
+		chat_id INTEGER,
+		context TEXT,
+		timestamp INTEGER,
+		PRIMARY KEY (user_id, chat_id)
+	)`)
+	return err
+}
+
+// column is a column added to an existing table
+type column struct{ name, def string }
+
+// addColumns returns a migration adding the missing columns to table. Databases
+// where the table doesn't exist yet are skipped; its owner creates it with the columns.
+// Columns that already exist are skipped too, for databases upgraded by the
+// owners before the migration was registered
+func addColumns(table string, columns ...column) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+		if err != nil {
+			return err
+		}
+		existing := make(map[string]bool)
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			existing[name] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			return nil
+		}
+
+		for _, c := range columns {
+			if existing[c.name] {
+				continue
+			}
+			if _, err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + c.name + " " + c.def); err != nil {
+				return fmt.Errorf("failed to add %s.%s: %w", table, c.name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// ErrDowngrade is returned when the database was migrated by a newer binary
+type ErrDowngrade struct {
+	RecordedSchema int
+	BinarySchema   int
+	LastVersion    string
+}
+
+func (e *ErrDowngrade) Error() string {
+	return fmt.Sprintf("database schema version %d (last written by %s) is newer than this binary supports (%d); "+
+		"upgrade NexusValet or start with --allow-downgrade", e.RecordedSchema, e.LastVersion, e.BinarySchema)
+}
+
+// VersionRecord is the version metadata stored in the database
+type VersionRecord struct {
+	SchemaVersion int
+	LastVersion   string
+}
+
+// initMeta creates the schema_meta table if it doesn't exist
+func (m *Manager) initMeta() error {
+	_, err := m.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`)
+	return err
+}
+
+// GetVersionRecord reads the recorded schema version and last-run binary version
+func (m *Manager) GetVersionRecord() (*VersionRecord, error) {
+	if err := m.initMeta(); err != nil {
+		return nil, fmt.Errorf("failed to create schema_meta table: %w", err)
+	}
+
+	record := &VersionRecord{}
+	rows, err := m.db.Query("SELECT key, value FROM schema_meta")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		switch key {
+		case "schema_version":
+			record.SchemaVersion, _ = strconv.Atoi(value)
+		case "last_version":
+			record.LastVersion = value
+		}
+	}
+	return record, rows.Err()
+}
+
+// CheckVersion compares the database version record with the running binary.
+// A downgrade is refused unless allowDowngrade is set; an upgrade runs pending
+// migrations. The record is updated to the current binary on success.
+// It must run before anything else uses the database.
+func (m *Manager) CheckVersion(allowDowngrade bool) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	record, err := m.GetVersionRecord()
+	if err != nil {
+		return err
+	}
+
+	current := version.String()
+	if err := CheckDowngrade(record, SchemaVersion); err != nil {
+		if !allowDowngrade {
+			return err
+		}
+		logger.Warnf("%v (continuing because --allow-downgrade was passed)", err)
+		return m.writeVersionRecord(record.SchemaVersion, current)
+	}
+
+	if record.LastVersion != "" && version.Compare(record.LastVersion, current) < 0 {
+		logger.Infof("Upgraded NexusValet %s -> %s", record.LastVersion, current)
+	} else if record.LastVersion != "" && version.Compare(record.LastVersion, current) > 0 {
+		logger.Warnf("Running NexusValet %s, older than last run %s", current, record.LastVersion)
+	}
+
+	schema := record.SchemaVersion
+	for _, mig := range migrations {
+		if mig.version <= schema {
+			continue
+		}
+		logger.Infof("Applying database migration %d", mig.version)
+		tx, err := m.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", mig.version, err)
+		}
+		if err := mig.apply(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", mig.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", mig.version, err)
+		}
+		schema = mig.version
+	}
+
+	return m.writeVersionRecord(schema, current)
+}
+
+// CheckDowngrade reports an ErrDowngrade when the recorded schema is newer
+// than binarySchema
+func CheckDowngrade(record *VersionRecord, binarySchema int) error {
+	if record == nil || record.SchemaVersion <= binarySchema {
+		return nil
+	}
+	last := record.LastVersion
+	if last == "" {
+		last = "an unknown version"
+	}
+	return &ErrDowngrade{
+		RecordedSchema: record.SchemaVersion,
+		BinarySchema:   binarySchema,
+		LastVersion:    last,
+	}
+}
+
+// writeVersionRecord stores the schema version and the running binary version
+func (m *Manager) writeVersionRecord(schema int, binaryVersion string) error {
+	_, err := m.db.Exec("INSERT OR REPLACE INTO schema_meta (key, value) VALUES (?, ?), (?, ?)",
+		"schema_version", strconv.Itoa(schema), "last_version", binaryVersion)
+	return err
+}
@@ -0,0 +1,203 @@
+package session
+
+import (
+	"errors"
+	"nexusvalet/internal/version"
+	"testing"
+)
+
+// newTestManager 打开内存数据库，不执行 CheckVersion
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := NewManager(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+// seedRecord 写入伪造的版本记录，模拟其他版本的程序运行过
+func seedRecord(t *testing.T, m *Manager, schema int, last string) {
+	t.Helper()
+	if err := m.initMeta(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.writeVersionRecord(schema, last); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readRecord(t *testing.T, m *Manager) *VersionRecord {
+	t.Helper()
+	record, err := m.GetVersionRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestCheckDowngrade(t *testing.T) {
+	tests := []struct {
+		name   string
+		record *VersionRecord
+		want   bool
+	}{
+		{"no record", nil, false},
+		{"fresh database", &VersionRecord{}, false},
+		{"same schema", &VersionRecord{SchemaVersion: 3, LastVersion: "v1.2.0"}, false},
+		{"older schema", &VersionRecord{SchemaVersion: 2, LastVersion: "v1.0.0"}, false},
+		{"newer schema", &VersionRecord{SchemaVersion: 4, LastVersion: "v2.0.0"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckDowngrade(tt.record, 3)
+			var downgrade *ErrDowngrade
+			if got := errors.As(err, &downgrade); got != tt.want {
+				t.Fatalf("CheckDowngrade = %v, want downgrade %v", err, tt.want)
+			}
+			if tt.want && (downgrade.RecordedSchema != 4 || downgrade.BinarySchema != 3 || downgrade.LastVersion != "v2.0.0") {
+				t.Errorf("ErrDowngrade = %+v", downgrade)
+			}
+		})
+	}
+
+	err := CheckDowngrade(&VersionRecord{SchemaVersion: 9}, 1)
+	var downgrade *ErrDowngrade
+	if !errors.As(err, &downgrade) || downgrade.LastVersion != "an unknown version" {
+		t.Errorf("missing last version: %v", err)
+	}
+}
+
+func TestCheckVersionFreshDatabase(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CheckVersion(false); err != nil {
+		t.Fatal(err)
+	}
+	record := readRecord(t, m)
+	if record.SchemaVersion != SchemaVersion || record.LastVersion != version.String() {
+		t.Errorf("record = %+v, want schema %d and %s", record, SchemaVersion, version.String())
+	}
+	// 基线迁移创建了 sessions 表
+	if err := m.SaveSession(&Session{UserID: 1, ChatID: 2, Context: map[string]interface{}{"k": "v"}}); err != nil {
+		t.Fatalf("SaveSession after migrations: %v", err)
+	}
+}
+
+func TestCheckVersionRefusesDowngrade(t *testing.T) {
+	m := newTestManager(t)
+	seedRecord(t, m, SchemaVersion+1, "v99.0.0")
+
+	err := m.CheckVersion(false)
+	var downgrade *ErrDowngrade
+	if !errors.As(err, &downgrade) {
+		t.Fatalf("CheckVersion = %v, want ErrDowngrade", err)
+	}
+	// 拒绝时不修改记录
+	if record := readRecord(t, m); record.SchemaVersion != SchemaVersion+1 || record.LastVersion != "v99.0.0" {
+		t.Errorf("record changed after refused downgrade: %+v", record)
+	}
+}
+
+func TestCheckVersionAllowDowngrade(t *testing.T) {
+	m := newTestManager(t)
+	seedRecord(t, m, SchemaVersion+1, "v99.0.0")
+
+	if err := m.CheckVersion(true); err != nil {
+		t.Fatalf("CheckVersion(allowDowngrade) = %v", err)
+	}
+	// 保留较新的结构版本，之后较新的程序不会重新迁移
+	record := readRecord(t, m)
+	if record.SchemaVersion != SchemaVersion+1 || record.LastVersion != version.String() {
+		t.Errorf("record = %+v", record)
+	}
+}
+
+func TestCheckVersionUpgrade(t *testing.T) {
+	m := newTestManager(t)
+	seedRecord(t, m, 0, "v0.1.0")
+
+	if err := m.CheckVersion(false); err != nil {
+		t.Fatal(err)
+	}
+	if record := readRecord(t, m); record.SchemaVersion != SchemaVersion || record.LastVersion != version.String() {
+		t.Errorf("record after upgrade = %+v", record)
+	}
+}
+
+func TestMigrationsAscending(t *testing.T) {
+	if len(migrations) == 0 || migrations[len(migrations)-1].version != SchemaVersion {
+		t.Fatalf("last migration must be SchemaVersion %d", SchemaVersion)
+	}
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version <= migrations[i-1].version {
+			t.Errorf("migration %d is not after %d", migrations[i].version, migrations[i-1].version)
+		}
+	}
+}
+
+// columns 返回表的列名，表不存在时为空
+func columns(t *testing.T, m *Manager, table string) map[string]bool {
+	t.Helper()
+	rows, err := m.db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names[name] = true
+	}
+	return names
+}
+
+func TestCheckVersionAddsColumnsToOwnerTables(t *testing.T) {
+	m := newTestManager(t)
+	seedRecord(t, m, 1, "v0.1.0")
+	// 旧版本插件创建的表，autosend_tasks 已经由插件自己加过 defer_ok 列
+	for _, stmt := range []string{
+		"CREATE TABLE autosend_tasks (id INTEGER PRIMARY KEY, chat_id INTEGER NOT NULL, message TEXT NOT NULL, type TEXT, defer_ok BOOLEAN NOT NULL DEFAULT 0)",
+		"INSERT INTO autosend_tasks (chat_id, message, type) VALUES (1, 'hi', 'daily')",
+		"CREATE TABLE maintenance_windows (id INTEGER PRIMARY KEY, reason TEXT NOT NULL DEFAULT '', created INTEGER NOT NULL)",
+	} {
+		if _, err := m.db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.CheckVersion(false); err != nil {
+		t.Fatal(err)
+	}
+	tasks := columns(t, m, "autosend_tasks")
+	for _, name := range []string{"defer_ok", "cron_expr", "last_run", "consecutive_failures", "media_ref", "source_msg_id", "timezone"} {
+		if !tasks[name] {
+			t.Errorf("autosend_tasks has no %s column after migration", name)
+		}
+	}
+	if !columns(t, m, "maintenance_windows")["sources"] {
+		t.Error("maintenance_windows has no sources column after migration")
+	}
+	// 新列的默认值适用于已有的行
+	var timezone string
+	var failures int
+	if err := m.db.QueryRow("SELECT timezone, consecutive_failures FROM autosend_tasks").Scan(&timezone, &failures); err != nil || timezone != "" || failures != 0 {
+		t.Errorf("existing row = %q, %d, %v", timezone, failures, err)
+	}
+}
+
+func TestCheckVersionSkipsMissingOwnerTables(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CheckVersion(false); err != nil {
+		t.Fatal(err)
+	}
+	// 表由所属的插件创建，迁移不会创建只有新列的表
+	for _, table := range []string{"autosend_tasks", "maintenance_windows"} {
+		if cols := columns(t, m, table); len(cols) != 0 {
+			t.Errorf("migration created %s: %v", table, cols)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"nexusvalet/pkg/logger"
+	"strings"
 	"sync"
 
 	_ "modernc.org/sqlite"
@@ -24,38 +25,52 @@ type Manager struct {
 	mutex sync.RWMutex
 }
 
-// NewManager creates a new session manager
+// connectionPragmas are applied to every connection in the pool. WAL lets readers
+// run alongside the single writer, busy_timeout makes a writer wait for the lock
+// instead of failing with "database is locked", and _txlock=immediate takes the
+// write lock at BEGIN so two transactions can't deadlock upgrading their read locks.
+const connectionPragmas = "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_pragma=synchronous(NORMAL)&_txlock=immediate"
+
+// maxOpenConns caps the pool; writes are serialized by SQLite anyway and more
+// connections only add lock contention
+const maxOpenConns = 4
+
+// NewManager creates a new session manager. Call CheckVersion before using it,
+// it creates the tables and refuses databases migrated by a newer binary
 func NewManager(dbPath string) (*Manager, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := sql.Open("sqlite", dataSourceName(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	if dbPath == ":memory:" {
+		// every connection would get its own empty in-memory database
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(maxOpenConns)
+	}
+	db.SetMaxIdleConns(maxOpenConns)
 
-	manager := &Manager{
-		db: db,
+	var journalMode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	logger.Debugf("Database journal mode: %s", journalMode)
 
-	if err := manager.initDatabase(); err != nil {
-		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	manager := &Manager{
+		db: db,
 	}
 
 	logger.Debugf("Session manager initialized with database: %s", dbPath)
 	return manager, nil
 }
 
-// initDatabase creates the sessions table if it doesn't exist
-func (m *Manager) initDatabase() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS sessions (
-		user_id INTEGER,
-		chat_id INTEGER,
-		context TEXT,
-		timestamp INTEGER,
-		PRIMARY KEY (user_id, chat_id)
-	)`
-
-	_, err := m.db.Exec(query)
-	return err
+// dataSourceName appends the connection pragmas to the database path
+func dataSourceName(dbPath string) string {
+	if strings.Contains(dbPath, "?") {
+		return dbPath + "&" + connectionPragmas
+	}
+	return dbPath + "?" + connectionPragmas
 }
 
 // GetSession retrieves a session for the given user and chat
@@ -0,0 +1,109 @@
+package stickerpack
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxStickers 一个贴纸包最多包含的贴纸数
+	MaxStickers = 120
+	// maxEntrySize 压缩包内单个文件解压后的最大字节数
+	maxEntrySize = 10 * 1024 * 1024
+)
+
+// Item 压缩包中的一张贴纸
+type Item struct {
+	Name    string
+	Emojis  string
+	Sticker *Sticker
+}
+
+// Problem 无法使用的文件及原因
+type Problem struct {
+	Name   string
+	Reason string
+}
+
+// Archive 解析后的贴纸压缩包
+type Archive struct {
+	Items    []Item
+	Problems []Problem
+}
+
+// ReadArchive 读取压缩包，按文件名顺序校验并转换所有图片。
+// 单个文件的问题记录在 Problems 中，不会中止解析
+func ReadArchive(data []byte) (*Archive, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("无法读取压缩包: %w", err)
+	}
+
+	var emojis map[string]string
+	var files []*zip.File
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() || strings.HasPrefix(path.Base(file.Name), ".") || strings.HasPrefix(file.Name, "__MACOSX/") {
+			continue
+		}
+		if strings.EqualFold(path.Base(file.Name), "pack.txt") {
+			content, err := readEntry(file)
+			if err != nil {
+				return nil, fmt.Errorf("读取pack.txt失败: %w", err)
+			}
+			emojis = EmojiMap(ParsePackTxt(string(content)))
+			continue
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	archive := &Archive{}
+	for _, file := range files {
+		content, err := readEntry(file)
+		if err != nil {
+			archive.Problems = append(archive.Problems, Problem{Name: file.Name, Reason: err.Error()})
+			continue
+		}
+		sticker, err := Normalize(file.Name, content)
+		if err != nil {
+			archive.Problems = append(archive.Problems, Problem{Name: file.Name, Reason: err.Error()})
+			continue
+		}
+		emoji := emojis[path.Base(file.Name)]
+		if emoji == "" {
+			emoji = DefaultEmoji
+		}
+		archive.Items = append(archive.Items, Item{Name: file.Name, Emojis: emoji, Sticker: sticker})
+	}
+
+	if len(archive.Items) > MaxStickers {
+		for _, item := range archive.Items[MaxStickers:] {
+			archive.Problems = append(archive.Problems, Problem{Name: item.Name, Reason: fmt.Sprintf("超过每个贴纸包 %d 张的上限", MaxStickers)})
+		}
+		archive.Items = archive.Items[:MaxStickers]
+	}
+	return archive, nil
+}
+
+// readEntry 读取压缩包中的文件，限制解压后的大小
+func readEntry(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(io.LimitReader(rc, maxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxEntrySize {
+		return nil, fmt.Errorf("文件超过 %dMB", maxEntrySize/1024/1024)
+	}
+	return content, nil
+}
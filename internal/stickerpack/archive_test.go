@@ -0,0 +1,191 @@
+package stickerpack
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// zipFiles 按给定顺序将文件写入压缩包
+func zipFiles(t *testing.T, files ...string) func(contents ...[]byte) []byte {
+	return func(contents ...[]byte) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		for i, name := range files {
+			f, err := w.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write(contents[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+}
+
+type itemSummary struct {
+	Name, Emojis, FileName, MimeType string
+	Width, Height                    int
+}
+
+func summarize(items []Item) []itemSummary {
+	var out []itemSummary
+	for _, item := range items {
+		out = append(out, itemSummary{item.Name, item.Emojis, item.Sticker.FileName, item.Sticker.MimeType, item.Sticker.Width, item.Sticker.Height})
+	}
+	return out
+}
+
+func TestReadArchiveGetStickersExport(t *testing.T) {
+	archive, err := ReadArchive(readFixture(t, "getstickers.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 压缩包中的顺序为 003 000 001 002，按文件名排序；003.gif 不在 pack.txt 中使用默认emoji
+	want := []itemSummary{
+		{"000.png", "😀", "000.png", "image/png", 512, 256},
+		{"001.webp", "😂😍", "001.webp", "image/webp", 512, 384},
+		{"002.jpg", "👍", "002.png", "image/png", 512, 256},
+		{"003.gif", DefaultEmoji, "003.png", "image/png", 128, 512},
+	}
+	if got := summarize(archive.Items); !reflect.DeepEqual(got, want) {
+		t.Errorf("items =\n%v\nwant\n%v", got, want)
+	}
+	if len(archive.Problems) != 0 {
+		t.Errorf("problems = %v, want none", archive.Problems)
+	}
+
+	// 转换后的PNG保留原来的颜色
+	colors := map[string][3]uint32{"000.png": {255, 0, 0}, "002.jpg": {0, 0, 255}, "003.gif": {0, 255, 0}}
+	for _, item := range archive.Items {
+		want, ok := colors[item.Name]
+		if !ok {
+			continue
+		}
+		img, err := png.Decode(bytes.NewReader(item.Sticker.Data))
+		if err != nil {
+			t.Fatalf("%s: %v", item.Name, err)
+		}
+		r, g, b, _ := img.At(item.Sticker.Width/2, item.Sticker.Height/2).RGBA()
+		got := [3]uint32{r >> 8, g >> 8, b >> 8}
+		for i := range got {
+			if diff := int(got[i]) - int(want[i]); diff < -8 || diff > 8 {
+				t.Errorf("%s: center = %v, want about %v", item.Name, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestReadArchiveMixed(t *testing.T) {
+	archive, err := ReadArchive(readFixture(t, "mixed.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 目录、隐藏文件和 __MACOSX 被忽略；PACK.TXT 不区分大小写，带BOM也能解析
+	wantItems := []itemSummary{
+		{"stickers/a.png", "👍", "a.png", "image/png", 512, 512},
+		{"stickers/b.png", "🎉🎊", "b.png", "image/png", 512, 100},
+	}
+	if got := summarize(archive.Items); !reflect.DeepEqual(got, wantItems) {
+		t.Errorf("items =\n%v\nwant\n%v", got, wantItems)
+	}
+	wantProblems := []Problem{
+		{"stickers/anim.tgs", "动画和视频贴纸: unsupported format"},
+		{"stickers/big.webp", "WEBP尺寸为 1024x1024，需要一边为512像素且另一边不超过512像素"},
+		{"stickers/notes.txt", "无法识别图片: unsupported format"},
+		{"stickers/truncated.webp", "WEBP文件不完整"},
+	}
+	if !reflect.DeepEqual(archive.Problems, wantProblems) {
+		t.Errorf("problems =\n%v\nwant\n%v", archive.Problems, wantProblems)
+	}
+
+	// 半透明图片不改变尺寸，透明度保留
+	img, err := png.Decode(bytes.NewReader(archive.Items[1].Sticker.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a == 0xffff {
+		t.Error("b.png alpha should be preserved")
+	}
+}
+
+func TestReadArchiveLimit(t *testing.T) {
+	var names []string
+	var contents [][]byte
+	for i := 0; i < MaxStickers+2; i++ {
+		names = append(names, fmt.Sprintf("%03d.webp", i))
+		contents = append(contents, webpHeader("VP8X", 512, 512))
+	}
+	archive, err := ReadArchive(zipFiles(t, names...)(contents...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.Items) != MaxStickers || archive.Items[MaxStickers-1].Name != "119.webp" {
+		t.Fatalf("got %d items, want the first %d", len(archive.Items), MaxStickers)
+	}
+	want := []Problem{
+		{"120.webp", "超过每个贴纸包 120 张的上限"},
+		{"121.webp", "超过每个贴纸包 120 张的上限"},
+	}
+	if !reflect.DeepEqual(archive.Problems, want) {
+		t.Errorf("problems = %v, want %v", archive.Problems, want)
+	}
+}
+
+func TestReadArchiveEntryTooLarge(t *testing.T) {
+	var small bytes.Buffer
+	if err := png.Encode(&small, image.NewNRGBA(image.Rect(0, 0, 512, 512))); err != nil {
+		t.Fatal(err)
+	}
+	huge := make([]byte, maxEntrySize+1)
+	archive, err := ReadArchive(zipFiles(t, "huge.png", "ok.png")(huge, small.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.Items) != 1 || archive.Items[0].Name != "ok.png" {
+		t.Errorf("items = %v, want only ok.png", summarize(archive.Items))
+	}
+	if want := []Problem{{"huge.png", "文件超过 10MB"}}; !reflect.DeepEqual(archive.Problems, want) {
+		t.Errorf("problems = %v, want %v", archive.Problems, want)
+	}
+
+	// pack.txt 过大时整个压缩包无法使用
+	_, err = ReadArchive(zipFiles(t, "pack.txt")(huge))
+	if err == nil || err.Error() != "读取pack.txt失败: 文件超过 10MB" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestReadArchiveNotZip(t *testing.T) {
+	_, err := ReadArchive([]byte("not a zip"))
+	if err == nil || !strings.HasPrefix(err.Error(), "无法读取压缩包: ") {
+		t.Errorf("err = %v, want 无法读取压缩包", err)
+	}
+
+	archive, err := ReadArchive(zipFiles(t)())
+	if err != nil || len(archive.Items) != 0 || len(archive.Problems) != 0 {
+		t.Errorf("empty zip = %+v, %v", archive, err)
+	}
+}
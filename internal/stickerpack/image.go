@@ -0,0 +1,216 @@
+package stickerpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"path"
+	"strings"
+)
+
+const (
+	// StickerSide 静态贴纸的边长要求：一边为512像素，另一边不超过512像素
+	StickerSide = 512
+	// MaxStickerSize 静态贴纸文件的最大字节数
+	MaxStickerSize = 512 * 1024
+)
+
+// ErrUnsupported 不支持的贴纸格式
+var ErrUnsupported = errors.New("unsupported format")
+
+// Sticker 符合上传要求的贴纸文件
+type Sticker struct {
+	FileName string
+	MimeType string
+	Data     []byte
+	Width    int
+	Height   int
+}
+
+// Normalize 将图片转换为静态贴纸要求：PNG/JPEG/GIF 缩放到最长边512像素并编码为PNG，
+// 已符合要求的WEBP原样使用。动画(tgs)和视频贴纸不支持
+func Normalize(name string, data []byte) (*Sticker, error) {
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+
+	if isWebP(data) {
+		w, h, err := webpSize(data)
+		if err != nil {
+			return nil, err
+		}
+		if !validSide(w, h) {
+			return nil, fmt.Errorf("WEBP尺寸为 %dx%d，需要一边为%d像素且另一边不超过%d像素", w, h, StickerSide, StickerSide)
+		}
+		if len(data) > MaxStickerSize {
+			return nil, fmt.Errorf("文件大小 %dKB 超过 %dKB", len(data)/1024, MaxStickerSize/1024)
+		}
+		return &Sticker{FileName: base + ".webp", MimeType: "image/webp", Data: data, Width: w, Height: h}, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		switch strings.ToLower(path.Ext(name)) {
+		case ".tgs", ".webm", ".mp4":
+			return nil, fmt.Errorf("动画和视频贴纸: %w", ErrUnsupported)
+		}
+		return nil, fmt.Errorf("无法识别图片: %w", ErrUnsupported)
+	}
+
+	b := src.Bounds()
+	w, h := fitSide(b.Dx(), b.Dy())
+	var dst image.Image = src
+	if w != b.Dx() || h != b.Dy() {
+		dst = resize(src, w, h)
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, dst); err != nil {
+		return nil, fmt.Errorf("编码PNG失败: %w", err)
+	}
+	if buf.Len() > MaxStickerSize {
+		return nil, fmt.Errorf("转换后大小 %dKB 超过 %dKB", buf.Len()/1024, MaxStickerSize/1024)
+	}
+	return &Sticker{FileName: base + ".png", MimeType: "image/png", Data: buf.Bytes(), Width: w, Height: h}, nil
+}
+
+// validSide 尺寸是否满足一边为512、另一边不超过512
+func validSide(w, h int) bool {
+	return w > 0 && h > 0 && w <= StickerSide && h <= StickerSide && (w == StickerSide || h == StickerSide)
+}
+
+// fitSide 等比缩放使最长边为512像素
+func fitSide(w, h int) (int, int) {
+	if w >= h {
+		return StickerSide, max(1, (h*StickerSide+w/2)/w)
+	}
+	return max(1, (w*StickerSide+h/2)/h), StickerSide
+}
+
+// resize 缩放图片：缩小时对覆盖的源像素取平均，放大时使用双线性插值
+func resize(src image.Image, w, h int) *image.NRGBA {
+	sb := src.Bounds()
+	rgba := image.NewNRGBA(sb)
+	draw.Draw(rgba, sb, src, sb.Min, draw.Src)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	sw, sh := sb.Dx(), sb.Dy()
+	scaleX, scaleY := float64(sw)/float64(w), float64(sh)/float64(h)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var c color.NRGBA
+			if scaleX > 1 || scaleY > 1 {
+				c = boxSample(rgba, int(float64(x)*scaleX), int(float64(y)*scaleY),
+					max(1, int(float64(x+1)*scaleX)), max(1, int(float64(y+1)*scaleY)))
+			} else {
+				c = bilinearSample(rgba, (float64(x)+0.5)*scaleX-0.5, (float64(y)+0.5)*scaleY-0.5)
+			}
+			dst.SetNRGBA(x, y, c)
+		}
+	}
+	return dst
+}
+
+// boxSample 计算 [x0,x1)×[y0,y1) 区域的平均颜色，按alpha加权避免透明边缘发黑
+func boxSample(img *image.NRGBA, x0, y0, x1, y1 int) color.NRGBA {
+	b := img.Bounds()
+	x1, y1 = min(max(x1, x0+1), b.Dx()), min(max(y1, y0+1), b.Dy())
+	var r, g, bl, a, n uint64
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			p := img.NRGBAAt(b.Min.X+x, b.Min.Y+y)
+			pa := uint64(p.A)
+			r += uint64(p.R) * pa
+			g += uint64(p.G) * pa
+			bl += uint64(p.B) * pa
+			a += pa
+			n++
+		}
+	}
+	if a == 0 {
+		return color.NRGBA{}
+	}
+	return color.NRGBA{R: uint8(r / a), G: uint8(g / a), B: uint8(bl / a), A: uint8(a / n)}
+}
+
+// bilinearSample 在源图片坐标 (fx, fy) 处做双线性插值
+func bilinearSample(img *image.NRGBA, fx, fy float64) color.NRGBA {
+	b := img.Bounds()
+	clamp := func(v, hi int) int { return min(max(v, 0), hi-1) }
+	x0, y0 := int(fx), int(fy)
+	if fx < 0 {
+		x0 = -1
+	}
+	if fy < 0 {
+		y0 = -1
+	}
+	tx, ty := fx-float64(x0), fy-float64(y0)
+
+	var acc [4]float64
+	for dy := 0; dy <= 1; dy++ {
+		for dx := 0; dx <= 1; dx++ {
+			wx, wy := 1-tx, 1-ty
+			if dx == 1 {
+				wx = tx
+			}
+			if dy == 1 {
+				wy = ty
+			}
+			p := img.NRGBAAt(b.Min.X+clamp(x0+dx, b.Dx()), b.Min.Y+clamp(y0+dy, b.Dy()))
+			weight := wx * wy * float64(p.A)
+			acc[0] += float64(p.R) * weight
+			acc[1] += float64(p.G) * weight
+			acc[2] += float64(p.B) * weight
+			acc[3] += wx * wy * float64(p.A)
+		}
+	}
+	if acc[3] == 0 {
+		return color.NRGBA{}
+	}
+	return color.NRGBA{
+		R: uint8(acc[0]/acc[3] + 0.5),
+		G: uint8(acc[1]/acc[3] + 0.5),
+		B: uint8(acc[2]/acc[3] + 0.5),
+		A: uint8(acc[3] + 0.5),
+	}
+}
+
+// isWebP 是否为RIFF/WEBP文件
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+// webpSize 从WEBP文件头读取画布尺寸(支持VP8/VP8L/VP8X)
+func webpSize(data []byte) (int, int, error) {
+	if len(data) < 30 {
+		return 0, 0, fmt.Errorf("WEBP文件不完整")
+	}
+	switch string(data[12:16]) {
+	case "VP8 ":
+		// 关键帧起始码之后为14位宽高
+		if data[23] != 0x9d || data[24] != 0x01 || data[25] != 0x2a {
+			return 0, 0, fmt.Errorf("无效的VP8数据")
+		}
+		w := int(binary.LittleEndian.Uint16(data[26:28]) & 0x3fff)
+		h := int(binary.LittleEndian.Uint16(data[28:30]) & 0x3fff)
+		return w, h, nil
+	case "VP8L":
+		if data[20] != 0x2f {
+			return 0, 0, fmt.Errorf("无效的VP8L数据")
+		}
+		bits := binary.LittleEndian.Uint32(data[21:25])
+		return int(bits&0x3fff) + 1, int((bits>>14)&0x3fff) + 1, nil
+	case "VP8X":
+		w := int(data[24]) | int(data[25])<<8 | int(data[26])<<16
+		h := int(data[27]) | int(data[28])<<8 | int(data[29])<<16
+		return w + 1, h + 1, nil
+	}
+	return 0, 0, fmt.Errorf("未知的WEBP格式")
+}
@@ -0,0 +1,278 @@
+package stickerpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// webpHeader 构造只包含文件头的WEBP数据，足以读取尺寸
+func webpHeader(chunk string, w, h int) []byte {
+	data := make([]byte, 30)
+	copy(data[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(data[4:8], 22)
+	copy(data[8:12], "WEBP")
+	copy(data[12:16], chunk)
+	binary.LittleEndian.PutUint32(data[16:20], 10)
+	switch chunk {
+	case "VP8 ":
+		copy(data[23:26], []byte{0x9d, 0x01, 0x2a})
+		binary.LittleEndian.PutUint16(data[26:28], uint16(w))
+		binary.LittleEndian.PutUint16(data[28:30], uint16(h))
+	case "VP8L":
+		data[20] = 0x2f
+		binary.LittleEndian.PutUint32(data[21:25], uint32(w-1)|uint32(h-1)<<14)
+	case "VP8X":
+		data[24], data[25], data[26] = byte(w-1), byte((w-1)>>8), byte((w-1)>>16)
+		data[27], data[28], data[29] = byte(h-1), byte((h-1)>>8), byte((h-1)>>16)
+	}
+	return data
+}
+
+// solidImage 创建纯色图片
+func solidImage(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeImage(t *testing.T, format string, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFitSide(t *testing.T) {
+	tests := []struct{ w, h, wantW, wantH int }{
+		{256, 128, 512, 256},
+		{1024, 512, 512, 256},
+		{100, 400, 128, 512},
+		{512, 512, 512, 512},
+		{600, 600, 512, 512},
+		{3, 2, 512, 341},
+		{2000, 1, 512, 1},
+		{1, 2000, 1, 512},
+	}
+	for _, tt := range tests {
+		if w, h := fitSide(tt.w, tt.h); w != tt.wantW || h != tt.wantH {
+			t.Errorf("fitSide(%d, %d) = %d, %d; want %d, %d", tt.w, tt.h, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestValidSide(t *testing.T) {
+	tests := []struct {
+		w, h int
+		want bool
+	}{
+		{512, 512, true},
+		{512, 1, true},
+		{100, 512, true},
+		{511, 511, false},
+		{513, 512, false},
+		{512, 0, false},
+		{1024, 1024, false},
+	}
+	for _, tt := range tests {
+		if got := validSide(tt.w, tt.h); got != tt.want {
+			t.Errorf("validSide(%d, %d) = %v, want %v", tt.w, tt.h, got, tt.want)
+		}
+	}
+}
+
+func TestWebpSize(t *testing.T) {
+	for _, chunk := range []string{"VP8 ", "VP8L", "VP8X"} {
+		w, h, err := webpSize(webpHeader(chunk, 512, 384))
+		if err != nil || w != 512 || h != 384 {
+			t.Errorf("%s: webpSize = %d, %d, %v; want 512, 384", chunk, w, h, err)
+		}
+	}
+
+	badVP8 := webpHeader("VP8 ", 512, 512)
+	badVP8[23] = 0
+	badVP8L := webpHeader("VP8L", 512, 512)
+	badVP8L[20] = 0
+	unknown := webpHeader("ALPH", 512, 512)
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"truncated", webpHeader("VP8X", 512, 512)[:16], "WEBP文件不完整"},
+		{"bad VP8 start code", badVP8, "无效的VP8数据"},
+		{"bad VP8L signature", badVP8L, "无效的VP8L数据"},
+		{"unknown chunk", unknown, "未知的WEBP格式"},
+	}
+	for _, tt := range tests {
+		if _, _, err := webpSize(tt.data); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	tests := []struct {
+		name          string
+		file          string
+		data          []byte
+		wantName      string
+		wantMime      string
+		wantW, wantH  int
+		wantUnchanged bool
+	}{
+		{"png upscaled", "dir/a.png", encodeImage(t, "png", solidImage(256, 128, red)), "a.png", "image/png", 512, 256, false},
+		{"jpeg downscaled", "b.jpg", encodeImage(t, "jpeg", solidImage(1024, 512, red)), "b.png", "image/png", 512, 256, false},
+		{"gif tall", "c.gif", encodeImage(t, "gif", solidImage(100, 400, red)), "c.png", "image/png", 128, 512, false},
+		{"png already valid", "d.png", encodeImage(t, "png", solidImage(512, 100, red)), "d.png", "image/png", 512, 100, false},
+		{"webp passthrough", "e.webp", webpHeader("VP8X", 512, 384), "e.webp", "image/webp", 512, 384, true},
+		{"webp detected by content", "f.bin", webpHeader("VP8L", 200, 512), "f.webp", "image/webp", 200, 512, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sticker, err := Normalize(tt.file, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sticker.FileName != tt.wantName || sticker.MimeType != tt.wantMime || sticker.Width != tt.wantW || sticker.Height != tt.wantH {
+				t.Fatalf("sticker = %s %s %dx%d; want %s %s %dx%d",
+					sticker.FileName, sticker.MimeType, sticker.Width, sticker.Height, tt.wantName, tt.wantMime, tt.wantW, tt.wantH)
+			}
+			if tt.wantUnchanged {
+				if !bytes.Equal(sticker.Data, tt.data) {
+					t.Error("valid WEBP should be used as is")
+				}
+				return
+			}
+			img, err := png.Decode(bytes.NewReader(sticker.Data))
+			if err != nil {
+				t.Fatalf("output is not PNG: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+				t.Errorf("decoded size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+			}
+			r, g, b, a := img.At(tt.wantW/2, tt.wantH/2).RGBA()
+			if r>>8 < 240 || g>>8 > 15 || b>>8 > 15 || a>>8 != 255 {
+				t.Errorf("center pixel = %d,%d,%d,%d; want red", r>>8, g>>8, b>>8, a>>8)
+			}
+		})
+	}
+}
+
+func TestNormalizeErrors(t *testing.T) {
+	// 无法压缩的噪点图片编码后超过512KB
+	noise := image.NewNRGBA(image.Rect(0, 0, StickerSide, StickerSide))
+	rand.New(rand.NewSource(1)).Read(noise.Pix)
+	bigWebP := append(webpHeader("VP8X", 512, 512), make([]byte, MaxStickerSize)...)
+
+	tests := []struct {
+		name        string
+		file        string
+		data        []byte
+		want        string
+		unsupported bool
+	}{
+		{"animated sticker", "anim.tgs", []byte{0x1f, 0x8b, 0x08}, "动画和视频贴纸: unsupported format", true},
+		{"video sticker", "clip.WEBM", []byte{0x1a, 0x45, 0xdf, 0xa3}, "动画和视频贴纸: unsupported format", true},
+		{"not an image", "notes.txt", []byte("hello"), "无法识别图片: unsupported format", true},
+		{"webp wrong size", "big.webp", webpHeader("VP8L", 1024, 1024), "WEBP尺寸为 1024x1024，需要一边为512像素且另一边不超过512像素", false},
+		{"webp too large", "large.webp", bigWebP, "文件大小 512KB 超过 512KB", false},
+		{"png too large after conversion", "noise.png", encodeImage(t, "png", noise), "转换后大小", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Normalize(tt.file, tt.data)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want prefix %q", err, tt.want)
+			}
+			if errors.Is(err, ErrUnsupported) != tt.unsupported {
+				t.Errorf("errors.Is(err, ErrUnsupported) = %v, want %v", !tt.unsupported, tt.unsupported)
+			}
+		})
+	}
+}
+
+func TestResizeBoxAverage(t *testing.T) {
+	// 左半红右半蓝缩小为一列像素时取平均
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			c := color.NRGBA{R: 200, A: 255}
+			if x >= 2 {
+				c = color.NRGBA{B: 100, A: 255}
+			}
+			src.SetNRGBA(x, y, c)
+		}
+	}
+	if got, want := resize(src, 1, 1).NRGBAAt(0, 0), (color.NRGBA{R: 100, B: 50, A: 255}); got != want {
+		t.Errorf("1x1 = %v, want %v", got, want)
+	}
+	dst := resize(src, 2, 1)
+	if got := dst.NRGBAAt(0, 0); got != (color.NRGBA{R: 200, A: 255}) {
+		t.Errorf("left = %v, want pure red", got)
+	}
+	if got := dst.NRGBAAt(1, 0); got != (color.NRGBA{B: 100, A: 255}) {
+		t.Errorf("right = %v, want pure blue", got)
+	}
+}
+
+func TestResizeKeepsTransparentEdgesBright(t *testing.T) {
+	// 透明像素的颜色不参与平均，白色与全透明相邻时不会变灰
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	src.SetNRGBA(0, 0, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	src.SetNRGBA(1, 1, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	if got, want := resize(src, 1, 1).NRGBAAt(0, 0), (color.NRGBA{R: 255, G: 255, B: 255, A: 127}); got != want {
+		t.Errorf("downscale = %v, want %v", got, want)
+	}
+
+	up := resize(src, 4, 4)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if c := up.NRGBAAt(x, y); c.A != 0 && (c.R != 255 || c.G != 255 || c.B != 255) {
+				t.Fatalf("upscale pixel (%d,%d) = %v, want white", x, y, c)
+			}
+		}
+	}
+
+	transparent := resize(image.NewNRGBA(image.Rect(0, 0, 4, 4)), 2, 2)
+	if got := transparent.NRGBAAt(0, 0); got != (color.NRGBA{}) {
+		t.Errorf("fully transparent = %v, want zero", got)
+	}
+}
+
+func TestResizeUpscaleSolid(t *testing.T) {
+	c := color.NRGBA{R: 10, G: 20, B: 30, A: 255}
+	dst := resize(solidImage(3, 2, c), 512, 341)
+	if b := dst.Bounds(); b.Dx() != 512 || b.Dy() != 341 {
+		t.Fatalf("size = %v", b)
+	}
+	for _, p := range []image.Point{{0, 0}, {511, 340}, {256, 170}} {
+		if got := dst.NRGBAAt(p.X, p.Y); got != c {
+			t.Errorf("pixel %v = %v, want %v", p, got, c)
+		}
+	}
+}
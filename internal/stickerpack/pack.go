@@ -0,0 +1,92 @@
+package stickerpack
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultEmoji pack.txt 中没有对应条目时使用的emoji
+const DefaultEmoji = "😀"
+
+// Entry pack.txt 中的一条映射
+type Entry struct {
+	File   string
+	Emojis string
+}
+
+var (
+	// entryBlock 匹配 .getstickers 生成的 {'image_file': '000.webp','emojis':😀}, 形式
+	entryBlock = regexp.MustCompile(`\{([^{}]*)\}`)
+	// entryField 匹配块内的 key: value，值可以带引号或为列表
+	entryField = regexp.MustCompile(`['"]?(image_file|emojis)['"]?\s*:\s*(\[[^\]]*\]|'[^']*'|"[^"]*"|[^,}]*)`)
+)
+
+// ParsePackTxt 解析 pack.txt 的文件名到emoji映射。支持 .getstickers 生成的字典格式，
+// 也支持每行 "文件名 emoji" 或 "文件名: emoji" 的简单格式。无法解析的行会被忽略
+func ParsePackTxt(data string) []Entry {
+	data = strings.TrimPrefix(data, "\ufeff")
+	if blocks := entryBlock.FindAllStringSubmatch(data, -1); len(blocks) > 0 {
+		var entries []Entry
+		for _, block := range blocks {
+			var entry Entry
+			for _, field := range entryField.FindAllStringSubmatch(block[1], -1) {
+				switch field[1] {
+				case "image_file":
+					entry.File = unquote(field[2])
+				case "emojis":
+					entry.Emojis = joinEmojis(field[2])
+				}
+			}
+			if entry.File != "" {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+
+	var entries []Entry
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sep := strings.IndexAny(line, ": \t")
+		if sep <= 0 {
+			continue
+		}
+		entry := Entry{
+			File:   strings.TrimSpace(line[:sep]),
+			Emojis: joinEmojis(strings.TrimSpace(line[sep+1:])),
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// EmojiMap 返回按文件名(不含目录)索引的emoji映射
+func EmojiMap(entries []Entry) map[string]string {
+	result := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if entry.Emojis != "" {
+			result[path.Base(entry.File)] = entry.Emojis
+		}
+	}
+	return result
+}
+
+// unquote 去掉值两侧的引号和空白
+func unquote(value string) string {
+	return strings.Trim(strings.TrimSpace(value), `'"`)
+}
+
+// joinEmojis 将 ['😀', '😂'] 或 '😀😂' 形式的值合并为emoji字符串
+func joinEmojis(value string) string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	var b strings.Builder
+	for _, part := range strings.Split(value, ",") {
+		b.WriteString(strings.Join(strings.Fields(unquote(part)), ""))
+	}
+	return b.String()
+}
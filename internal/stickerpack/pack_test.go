@@ -0,0 +1,66 @@
+package stickerpack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePackTxt(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Entry
+	}{
+		{
+			name: "getstickers format",
+			in:   "{'image_file': '000.webp','emojis':😀},{'image_file': '001.webp','emojis':😂😍},",
+			want: []Entry{{"000.webp", "😀"}, {"001.webp", "😂😍"}},
+		},
+		{
+			name: "one entry per line",
+			in:   "{'image_file': '000.png','emojis':👍},\n{'image_file': '001.png','emojis':🎉},\n",
+			want: []Entry{{"000.png", "👍"}, {"001.png", "🎉"}},
+		},
+		{
+			name: "emoji list and double quotes",
+			in:   `{"image_file": "a.png", "emojis": ["😀", "😂"]}, {'emojis': '🔥', 'image_file': 'b.png'}`,
+			want: []Entry{{"a.png", "😀😂"}, {"b.png", "🔥"}},
+		},
+		{
+			name: "block without file is dropped",
+			in:   "{'emojis':😀},{'image_file': 'x.png','emojis':}",
+			want: []Entry{{"x.png", ""}},
+		},
+		{
+			name: "simple lines",
+			in:   "\ufeff# 注释\na.png 👍\nb.png: 🎉 🎊\nc.png\t😡\n\nnoemoji\n:😀\n",
+			want: []Entry{{"a.png", "👍"}, {"b.png", "🎉🎊"}, {"c.png", "😡"}},
+		},
+		{
+			name: "windows line endings",
+			in:   "a.png 👍\r\nb.png 🎉\r\n",
+			want: []Entry{{"a.png", "👍"}, {"b.png", "🎉"}},
+		},
+		{
+			name: "empty",
+			in:   "",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParsePackTxt(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePackTxt(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmojiMap(t *testing.T) {
+	got := EmojiMap([]Entry{{"dir/a.png", "👍"}, {"b.png", ""}, {"c.png", "🎉"}, {"other/a.png", "😀"}})
+	// 按文件名索引，后出现的同名条目覆盖之前的，没有emoji的条目不加入
+	want := map[string]string{"a.png": "😀", "c.png": "🎉"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EmojiMap = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"nexusvalet/pkg/logger"
+	"strconv"
+	"time"
+)
+
+// globalChat 不属于任何对话的键使用的chat_id
+const globalChat int64 = 0
+
+// Store 供插件使用的键值存储，按插件名区分，也可以再按对话区分。
+// 所有插件共用一张表，简单的配置不需要各自建表
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore 创建键值存储。db为nil或Store为nil时所有读取返回不存在，写入返回错误
+func NewStore(db *sql.DB) *Store {
+	s := &Store{db: db}
+	if db != nil {
+		if err := s.initDatabase(); err != nil {
+			logger.Errorf("Failed to create plugin_kv table: %v", err)
+		}
+	}
+	return s
+}
+
+// initDatabase 初始化数据库表，主键即为按插件、对话查询使用的索引
+func (s *Store) initDatabase() error {
+	_, err := s.db.Exec(`
+	CREATE TABLE IF NOT EXISTS plugin_kv (
+		plugin TEXT NOT NULL,
+		chat_id INTEGER NOT NULL DEFAULT 0,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		updated_at INTEGER NOT NULL,
+		PRIMARY KEY (plugin, chat_id, key)
+	) WITHOUT ROWID`)
+	return err
+}
+
+// Get 读取插件的键，不存在时ok为false
+func (s *Store) Get(plugin, key string) (string, bool, error) {
+	return s.GetChat(plugin, globalChat, key)
+}
+
+// Set 写入插件的键
+func (s *Store) Set(plugin, key, value string) error {
+	return s.SetChat(plugin, globalChat, key, value)
+}
+
+// Delete 删除插件的键，键不存在时不返回错误
+func (s *Store) Delete(plugin, key string) error {
+	return s.DeleteChat(plugin, globalChat, key)
+}
+
+// GetChat 读取插件在对话中的键，不存在时ok为false
+func (s *Store) GetChat(plugin string, chatID int64, key string) (string, bool, error) {
+	if s == nil || s.db == nil {
+		return "", false, nil
+	}
+	var value string
+	err := s.db.QueryRow("SELECT value FROM plugin_kv WHERE plugin = ? AND chat_id = ? AND key = ?", plugin, chatID, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s/%s: %w", plugin, key, err)
+	}
+	return value, true, nil
+}
+
+// SetChat 写入插件在对话中的键
+func (s *Store) SetChat(plugin string, chatID int64, key, value string) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("storage not available")
+	}
+	_, err := Exec(s.db, "INSERT OR REPLACE INTO plugin_kv (plugin, chat_id, key, value, updated_at) VALUES (?, ?, ?, ?, ?)",
+		plugin, chatID, key, value, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to write %s/%s: %w", plugin, key, err)
+	}
+	return nil
+}
+
+// DeleteChat 删除插件在对话中的键，键不存在时不返回错误
+func (s *Store) DeleteChat(plugin string, chatID int64, key string) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("storage not available")
+	}
+	if _, err := Exec(s.db, "DELETE FROM plugin_kv WHERE plugin = ? AND chat_id = ? AND key = ?", plugin, chatID, key); err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", plugin, key, err)
+	}
+	return nil
+}
+
+// GetInt 读取整数，不存在时返回def，值不是整数时返回def和错误
+func (s *Store) GetInt(plugin, key string, def int) (int, error) {
+	value, ok, err := s.Get(plugin, key)
+	if err != nil || !ok {
+		return def, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def, fmt.Errorf("%s/%s is not an integer: %q", plugin, key, value)
+	}
+	return n, nil
+}
+
+// GetBool 读取布尔值，接受 strconv.ParseBool 的各种写法(true/false、1/0、True/False)，
+// 不存在时返回def，无法解析时返回def和错误
+func (s *Store) GetBool(plugin, key string, def bool) (bool, error) {
+	value, ok, err := s.Get(plugin, key)
+	if err != nil || !ok {
+		return def, err
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return def, fmt.Errorf("%s/%s is not a boolean: %q", plugin, key, value)
+	}
+	return b, nil
+}
+
+// GetJSON 把键的JSON值解析到v，不存在时ok为false且v不变
+func (s *Store) GetJSON(plugin, key string, v interface{}) (bool, error) {
+	value, ok, err := s.Get(plugin, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(value), v); err != nil {
+		return false, fmt.Errorf("failed to decode %s/%s: %w", plugin, key, err)
+	}
+	return true, nil
+}
+
+// SetJSON 把v编码为JSON后写入
+func (s *Store) SetJSON(plugin, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s/%s: %w", plugin, key, err)
+	}
+	return s.Set(plugin, key, string(data))
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// busyRetryDelay 数据库被锁时重试前等待的时间。连接已设置 busy_timeout，
+// 这里只处理等待超时后仍然被锁的少数情况
+const busyRetryDelay = 100 * time.Millisecond
+
+// IsBusy 判断错误是否为数据库被锁(SQLITE_BUSY、SQLITE_LOCKED及其扩展错误码)
+func IsBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// Exec 执行写入语句，数据库被锁时等待片刻后重试一次
+func Exec(db *sql.DB, query string, args ...interface{}) (sql.Result, error) {
+	result, err := db.Exec(query, args...)
+	if IsBusy(err) {
+		time.Sleep(busyRetryDelay)
+		result, err = db.Exec(query, args...)
+	}
+	return result, err
+}
+
+// Tx 在事务中执行fn，fn返回错误时回滚。数据库被锁时整个事务重试一次，
+// 因此fn可能执行两次，只应包含数据库操作
+func Tx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	err := runTx(db, fn)
+	if IsBusy(err) {
+		time.Sleep(busyRetryDelay)
+		err = runTx(db, fn)
+	}
+	return err
+}
+
+func runTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// openConn 打开只有一个连接、不等待锁的数据库，便于制造 SQLITE_BUSY
+func openConn(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(0)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestExecRetriesBusyWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "busy.db")
+	holder := openConn(t, path)
+	writer := openConn(t, path)
+	if _, err := holder.Exec("CREATE TABLE t (v INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := holder.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 另一个连接持有写锁时直接写入失败
+	_, err = writer.Exec("INSERT INTO t VALUES (2)")
+	if !IsBusy(err) {
+		t.Fatalf("write while locked: err = %v, want busy", err)
+	}
+
+	// 锁在重试前释放时，第二次写入成功
+	go func() {
+		time.Sleep(busyRetryDelay / 4)
+		tx.Commit()
+	}()
+	if _, err := Exec(writer, "INSERT INTO t VALUES (3)"); err != nil {
+		t.Fatalf("Exec after lock released: %v", err)
+	}
+
+	var n int
+	if err := writer.QueryRow("SELECT COUNT(*) FROM t").Scan(&n); err != nil || n != 2 {
+		t.Fatalf("rows = %d, %v; want 2", n, err)
+	}
+}
+
+func TestTxRetriesBusyTransaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "busy.db")
+	holder := openConn(t, path)
+	writer := openConn(t, path)
+	if _, err := holder.Exec("CREATE TABLE t (v INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := holder.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Exec("INSERT INTO t VALUES (1)")
+	go func() {
+		time.Sleep(busyRetryDelay / 4)
+		tx.Commit()
+	}()
+
+	runs := 0
+	err = Tx(writer, func(tx *sql.Tx) error {
+		runs++
+		_, err := tx.Exec("INSERT INTO t VALUES (2)")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Tx: %v", err)
+	}
+	if runs != 2 {
+		t.Errorf("fn ran %d times, want 2", runs)
+	}
+}
+
+func TestIsBusy(t *testing.T) {
+	if IsBusy(nil) || IsBusy(errors.New("database is locked")) {
+		t.Error("only sqlite errors with a busy or locked code are busy")
+	}
+}
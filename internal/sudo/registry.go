@@ -0,0 +1,118 @@
+package sudo
+
+import (
+	"database/sql"
+	"fmt"
+	"nexusvalet/pkg/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registry 记录可以触发命令的其他账号(sudo用户)。全部数据在启动时加载到内存，每条消息只查询内存
+type Registry struct {
+	db    *sql.DB
+	users map[int64]bool
+	mutex sync.RWMutex
+}
+
+// NewRegistry 创建sudo用户列表，db为nil时只在内存中记录
+func NewRegistry(db *sql.DB) *Registry {
+	r := &Registry{
+		db:    db,
+		users: make(map[int64]bool),
+	}
+
+	if db != nil {
+		if err := r.initDatabase(); err != nil {
+			logger.Errorf("Failed to create sudo_users table: %v", err)
+		} else if err := r.load(); err != nil {
+			logger.Errorf("Failed to load sudo users: %v", err)
+		}
+	}
+
+	return r
+}
+
+// initDatabase 初始化数据库表
+func (r *Registry) initDatabase() error {
+	_, err := r.db.Exec(`
+	CREATE TABLE IF NOT EXISTS sudo_users (
+		user_id INTEGER PRIMARY KEY,
+		added_at INTEGER NOT NULL
+	)`)
+	return err
+}
+
+// load 从数据库加载sudo用户
+func (r *Registry) load() error {
+	rows, err := r.db.Query("SELECT user_id FROM sudo_users")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return err
+		}
+		r.users[userID] = true
+	}
+	return rows.Err()
+}
+
+// Add 添加sudo用户
+func (r *Registry) Add(userID int64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.users[userID] {
+		return fmt.Errorf("user %d is already a sudo user", userID)
+	}
+	if r.db != nil {
+		if _, err := r.db.Exec("INSERT OR REPLACE INTO sudo_users (user_id, added_at) VALUES (?, ?)",
+			userID, time.Now().Unix()); err != nil {
+			return err
+		}
+	}
+	r.users[userID] = true
+	return nil
+}
+
+// Remove 移除sudo用户
+func (r *Registry) Remove(userID int64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.users[userID] {
+		return fmt.Errorf("user %d is not a sudo user", userID)
+	}
+	if r.db != nil {
+		if _, err := r.db.Exec("DELETE FROM sudo_users WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+	}
+	delete(r.users, userID)
+	return nil
+}
+
+// IsSudo 用户是否为sudo用户
+func (r *Registry) IsSudo(userID int64) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.users[userID]
+}
+
+// List 返回所有sudo用户，按ID排序
+func (r *Registry) List() []int64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	users := make([]int64, 0, len(r.users))
+	for userID := range r.users {
+		users = append(users, userID)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	return users
+}
@@ -0,0 +1,289 @@
+package update
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRepo 检查更新的GitHub仓库
+	DefaultRepo = "uki0xc/NexusValet"
+	// maxReleaseSize 发布信息和校验文件的大小上限
+	maxReleaseSize = 1 << 20
+	// maxBinarySize 可执行文件的大小上限
+	maxBinarySize = 200 << 20
+)
+
+// Asset 发布附带的文件
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+// Release GitHub上的一个发布
+type Release struct {
+	TagName   string    `json:"tag_name"`
+	Name      string    `json:"name"`
+	Body      string    `json:"body"`
+	HTMLURL   string    `json:"html_url"`
+	Published time.Time `json:"published_at"`
+	Assets    []Asset   `json:"assets"`
+}
+
+// Checker 通过 GitHub releases API 检查和下载新版本
+type Checker struct {
+	repo   string
+	api    string
+	client *http.Client
+}
+
+// NewChecker 创建检查repo(owner/name)发布的Checker
+func NewChecker(repo string) *Checker {
+	return &Checker{
+		repo:   repo,
+		api:    "https://api.github.com",
+		client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Latest 返回最新的正式发布
+func (c *Checker) Latest(ctx context.Context) (*Release, error) {
+	data, err := c.fetch(ctx, fmt.Sprintf("%s/repos/%s/releases/latest", c.api, c.repo), maxReleaseSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latest release: %w", err)
+	}
+	var rel Release
+	if err := json.Unmarshal(data, &rel); err != nil {
+		return nil, fmt.Errorf("failed to decode release: %w", err)
+	}
+	if rel.TagName == "" {
+		return nil, fmt.Errorf("release has no tag")
+	}
+	return &rel, nil
+}
+
+// PlatformAsset 返回发布中当前平台的可执行文件
+func (r *Release) PlatformAsset() (*Asset, error) {
+	return r.assetFor(runtime.GOOS, runtime.GOARCH)
+}
+
+// Apply 下载发布中当前平台的可执行文件，校验SHA-256后替换exe。
+// 发布中没有对应的校验值时不会替换
+func (c *Checker) Apply(ctx context.Context, rel *Release, exe string) error {
+	asset, err := rel.PlatformAsset()
+	if err != nil {
+		return err
+	}
+	expected, err := c.checksum(ctx, rel, asset.Name)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".nexusvalet-update-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	sum, err := c.download(ctx, asset.URL, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", asset.Name, err)
+	}
+	if sum != expected {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", asset.Name, expected, sum)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	return replaceExecutable(tmp.Name(), exe)
+}
+
+// assetFor 按文件名中的系统和架构查找可执行文件。文件名没有架构时视为 amd64，
+// 与 Makefile 中 build-linux 等目标的命名一致
+func (r *Release) assetFor(goos, goarch string) (*Asset, error) {
+	osNames := []string{goos}
+	if goos == "darwin" {
+		osNames = append(osNames, "macos", "mac")
+	}
+
+	var fallback *Asset
+	for i := range r.Assets {
+		a := &r.Assets[i]
+		name := strings.ToLower(a.Name)
+		if isChecksumFile(name) || !containsAny(name, osNames) {
+			continue
+		}
+		switch arch := archOf(name); {
+		case arch == goarch:
+			return a, nil
+		case arch == "" && goarch == "amd64" && fallback == nil:
+			fallback = a
+		}
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, fmt.Errorf("release %s has no binary for %s/%s", r.TagName, goos, goarch)
+}
+
+// archAliases 文件名中各架构的写法
+var archAliases = map[string][]string{
+	"amd64": {"amd64", "x86_64"},
+	"arm64": {"arm64", "aarch64"},
+	"386":   {"386", "i386"},
+	"arm":   {"armv7", "armhf"},
+}
+
+// archOf 返回文件名中的架构，没有时返回空字符串
+func archOf(name string) string {
+	for arch, aliases := range archAliases {
+		if containsAny(name, aliases) {
+			return arch
+		}
+	}
+	return ""
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// isChecksumFile 是否为校验文件而不是可执行文件
+func isChecksumFile(name string) bool {
+	return strings.HasSuffix(name, ".sha256") || strings.Contains(name, "checksum") || strings.Contains(name, "sha256sums")
+}
+
+// checksum 从发布的校验文件中查找name的SHA-256：优先使用 <name>.sha256，
+// 其次为 checksums.txt 等 sha256sum 格式的汇总文件
+func (c *Checker) checksum(ctx context.Context, rel *Release, name string) (string, error) {
+	var candidates []Asset
+	for _, a := range rel.Assets {
+		if a.Name == name+".sha256" {
+			candidates = append([]Asset{a}, candidates...)
+		} else if isChecksumFile(strings.ToLower(a.Name)) {
+			candidates = append(candidates, a)
+		}
+	}
+
+	for _, a := range candidates {
+		data, err := c.fetch(ctx, a.URL, maxReleaseSize)
+		if err != nil {
+			return "", fmt.Errorf("failed to download %s: %w", a.Name, err)
+		}
+		if sum, ok := findChecksum(data, name, a.Name == name+".sha256"); ok {
+			return sum, nil
+		}
+	}
+	return "", fmt.Errorf("release %s has no SHA-256 checksum for %s, refusing to install", rel.TagName, name)
+}
+
+// findChecksum 在 "<sha256>  <文件名>" 格式的内容中查找name的校验值，
+// single为true时内容只对应一个文件，可以省略文件名
+func findChecksum(data []byte, name string, single bool) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+			continue
+		}
+		if _, err := hex.DecodeString(fields[0]); err != nil {
+			continue
+		}
+		if (single && len(fields) == 1) || (len(fields) > 1 && strings.TrimPrefix(fields[1], "*") == name) {
+			return strings.ToLower(fields[0]), true
+		}
+	}
+	return "", false
+}
+
+// download 把URL的内容写入w并返回SHA-256
+func (c *Checker) download(ctx context.Context, url string, w io.Writer) (string, error) {
+	resp, err := c.get(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, hash), io.LimitReader(resp.Body, maxBinarySize+1))
+	if err != nil {
+		return "", err
+	}
+	if n > maxBinarySize {
+		return "", fmt.Errorf("file exceeds %d bytes", maxBinarySize)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fetch 获取URL内容，限制最大大小
+func (c *Checker) fetch(ctx context.Context, url string, limit int64) ([]byte, error) {
+	resp, err := c.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("response exceeds %d bytes", limit)
+	}
+	return data, nil
+}
+
+func (c *Checker) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "NexusValet")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// replaceExecutable 用newPath替换exe。Windows 不能覆盖正在运行的文件，
+// 先把旧文件改名为 .old，下次更新时删除
+func replaceExecutable(newPath, exe string) error {
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return fmt.Errorf("failed to move current executable: %w", err)
+		}
+	}
+	if err := os.Rename(newPath, exe); err != nil {
+		return fmt.Errorf("failed to replace executable: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// 以下变量在构建时通过 ldflags 注入，例如:
+//
+//	go build -ldflags "-X nexusvalet/internal/version.Version=v1.2.0 -X nexusvalet/internal/version.Commit=abc1234"
+var (
+	Version   = ""
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info 构建信息
+type Info struct {
+	Version   string
+	Commit    string
+	BuildDate string
+	GoVersion string
+	Modified  bool
+}
+
+// Get 返回当前二进制的构建信息，ldflags 未注入的字段从 debug.ReadBuildInfo 补全
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if len(info.Commit) > 7 {
+		info.Commit = info.Commit[:7]
+	}
+
+	return info
+}
+
+// String 返回短版本号，例如 v1.2.0
+func String() string {
+	return Get().Version
+}
+
+// Full 返回包含提交、构建时间和Go版本的完整描述
+func (i Info) Full() string {
+	var b strings.Builder
+	b.WriteString(i.Version)
+	if i.Commit != "" {
+		b.WriteString(" (" + i.Commit)
+		if i.Modified {
+			b.WriteString("-dirty")
+		}
+		b.WriteString(")")
+	}
+	if i.BuildDate != "" {
+		b.WriteString(" built " + i.BuildDate)
+	}
+	b.WriteString(" " + i.GoVersion)
+	return b.String()
+}
+
+// Compare 比较两个语义化版本号，a<b 返回-1，a==b 返回0，a>b 返回1
+// 无法解析的版本(如 dev)视为最新，从而不会误判为降级
+func Compare(a, b string) int {
+	pa, okA := parse(a)
+	pb, okB := parse(b)
+
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return 1
+	case !okB:
+		return -1
+	}
+
+	for i := 0; i < 3; i++ {
+		if pa[i] < pb[i] {
+			return -1
+		}
+		if pa[i] > pb[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Valid 版本号是否可以解析为 vX.Y.Z
+func Valid(v string) bool {
+	_, ok := parse(v)
+	return ok
+}
+
+// BumpMinor 返回次版本号增加n后的版本，例如 BumpMinor("v1.2.3", 2) 为 "v1.4.0"
+func BumpMinor(v string, n int) (string, bool) {
+	p, ok := parse(v)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("v%d.%d.0", p[0], p[1]+n), true
+}
+
+// parse 解析 vX.Y.Z 形式的版本号，忽略预发布和构建元数据
+func parse(v string) ([3]int, bool) {
+	var out [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	if v == "" {
+		return out, false
+	}
+
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return out, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return out, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
+
+// AppVersion 返回用于 Telegram DeviceConfig 的应用版本
+func AppVersion() string {
+	info := Get()
+	if info.Commit != "" {
+		return fmt.Sprintf("%s (%s)", info.Version, info.Commit)
+	}
+	return info.Version
+}
@@ -0,0 +1,126 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Fields 请求级别的日志字段。更新进入处理流程时创建，随 context 传递到命令和插件
+type Fields struct {
+	CorrelationID string
+	ChatID        int64
+	MessageID     int
+	Command       string
+}
+
+// String 返回 "cid=… chat=… msg=… cmd=…" 形式，省略零值字段
+func (f Fields) String() string {
+	var parts []string
+	if f.CorrelationID != "" {
+		parts = append(parts, "cid="+f.CorrelationID)
+	}
+	if f.ChatID != 0 {
+		parts = append(parts, fmt.Sprintf("chat=%d", f.ChatID))
+	}
+	if f.MessageID != 0 {
+		parts = append(parts, fmt.Sprintf("msg=%d", f.MessageID))
+	}
+	if f.Command != "" {
+		parts = append(parts, "cmd="+f.Command)
+	}
+	return strings.Join(parts, " ")
+}
+
+// fieldsKey Fields 在 context 中的键
+type fieldsKey struct{}
+
+// WithFields 返回携带日志字段的 context
+func WithFields(ctx context.Context, f Fields) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, f)
+}
+
+// FieldsFrom 读取 context 中的日志字段
+func FieldsFrom(ctx context.Context) (Fields, bool) {
+	if ctx == nil {
+		return Fields{}, false
+	}
+	f, ok := ctx.Value(fieldsKey{}).(Fields)
+	return f, ok
+}
+
+// WithCommand 在已有字段上补充命令名称
+func WithCommand(ctx context.Context, command string) context.Context {
+	f, _ := FieldsFrom(ctx)
+	f.Command = command
+	return WithFields(ctx, f)
+}
+
+// NewCorrelationID 生成8位十六进制的关联ID
+func NewCorrelationID() string {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "00000000"
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// Entry 自动在日志前加上 context 中字段的日志记录器
+type Entry struct {
+	prefix string
+	module *Module // 为nil时使用未命名的日志
+}
+
+// Ctx 返回带有 context 字段前缀的日志记录器，context 中没有字段时与全局函数相同
+func Ctx(ctx context.Context) *Entry {
+	return &Entry{prefix: contextPrefix(ctx)}
+}
+
+// contextPrefix 返回 context 中字段的日志前缀，没有字段时为空
+func contextPrefix(ctx context.Context) string {
+	f, ok := FieldsFrom(ctx)
+	if !ok {
+		return ""
+	}
+	if s := f.String(); s != "" {
+		return "[" + s + "] "
+	}
+	return ""
+}
+
+// logf 以带前缀的形式记录日志
+func (e *Entry) logf(level LogLevel, format string, args ...interface{}) {
+	args = append([]interface{}{e.prefix}, args...)
+	if e.module != nil {
+		e.module.logf(level, "%s"+format, args...)
+		return
+	}
+	defaultLogger.logf(level, "%s"+format, args...)
+}
+
+// Debugf logs a debug message
+func (e *Entry) Debugf(format string, args ...interface{}) {
+	e.logf(DEBUG, format, args...)
+}
+
+// Infof logs an info message
+func (e *Entry) Infof(format string, args ...interface{}) {
+	e.logf(INFO, format, args...)
+}
+
+// Warnf logs a warning message
+func (e *Entry) Warnf(format string, args ...interface{}) {
+	e.logf(WARN, format, args...)
+}
+
+// Errorf logs an error message
+func (e *Entry) Errorf(format string, args ...interface{}) {
+	e.logf(ERROR, format, args...)
+}
+
+// IsDebug 当前是否为 DEBUG 日志级别
+func IsDebug() bool {
+	return LogLevel(defaultLogger.level.Load()) <= DEBUG
+}
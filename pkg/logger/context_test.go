@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFieldsString(t *testing.T) {
+	tests := []struct {
+		fields Fields
+		want   string
+	}{
+		{Fields{}, ""},
+		{Fields{CorrelationID: "deadbeef"}, "cid=deadbeef"},
+		{Fields{ChatID: -1001234, Command: "sb"}, "chat=-1001234 cmd=sb"},
+		{Fields{CorrelationID: "deadbeef", ChatID: 7, MessageID: 10, Command: "help"}, "cid=deadbeef chat=7 msg=10 cmd=help"},
+	}
+	for _, tt := range tests {
+		if got := tt.fields.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.fields, got, tt.want)
+		}
+	}
+}
+
+func TestContextFields(t *testing.T) {
+	if _, ok := FieldsFrom(context.Background()); ok {
+		t.Error("background context should have no fields")
+	}
+	if _, ok := FieldsFrom(nil); ok {
+		t.Error("nil context should have no fields")
+	}
+
+	ctx := WithFields(context.Background(), Fields{CorrelationID: "deadbeef", ChatID: 7})
+	ctx = WithCommand(ctx, "sb")
+	f, ok := FieldsFrom(ctx)
+	if !ok || f != (Fields{CorrelationID: "deadbeef", ChatID: 7, Command: "sb"}) {
+		t.Errorf("FieldsFrom = %+v, %v", f, ok)
+	}
+
+	// 没有字段的 context 上 WithCommand 只带命令名称
+	if f, _ := FieldsFrom(WithCommand(context.Background(), "help")); f != (Fields{Command: "help"}) {
+		t.Errorf("WithCommand on empty context = %+v", f)
+	}
+}
+
+func TestNewCorrelationID(t *testing.T) {
+	format := regexp.MustCompile(`^[0-9a-f]{8}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := NewCorrelationID()
+		if !format.MatchString(id) {
+			t.Fatalf("NewCorrelationID() = %q, want 8 hex digits", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) < 99 {
+		t.Errorf("only %d distinct IDs out of 100", len(seen))
+	}
+}
+
+// lastLine 返回模块最近输出的一行日志
+func lastLine(t *testing.T, module string) Line {
+	t.Helper()
+	lines := Recent(1, module)
+	if len(lines) != 1 {
+		t.Fatalf("no log line for module %s", module)
+	}
+	return lines[0]
+}
+
+func TestCtxPrefixesLogLines(t *testing.T) {
+	m := Named(fmt.Sprintf("ctxtest-%d", time.Now().UnixNano()))
+	ctx := WithFields(context.Background(), Fields{CorrelationID: "deadbeef", ChatID: -100, MessageID: 10})
+
+	m.Ctx(ctx).Infof("handled %d", 1)
+	if got := lastLine(t, m.Name()); got.Text != "[cid=deadbeef chat=-100 msg=10] handled 1" || got.Level != INFO {
+		t.Errorf("line = %+v", got)
+	}
+
+	m.Ctx(WithCommand(ctx, "sb")).Errorf("failed: %v", "boom")
+	if got := lastLine(t, m.Name()); got.Text != "[cid=deadbeef chat=-100 msg=10 cmd=sb] failed: boom" || got.Level != ERROR {
+		t.Errorf("line = %+v", got)
+	}
+
+	// 没有字段时不加前缀，参数中的 % 不会被当作格式
+	m.Ctx(context.Background()).Warnf("plain %s", "100%")
+	if got := lastLine(t, m.Name()); got.Text != "plain 100%" {
+		t.Errorf("line without fields = %q", got.Text)
+	}
+
+	// 未命名的日志同样带前缀
+	Ctx(ctx).Errorf("unnamed %s", "entry")
+	found := false
+	for _, line := range Recent(historySize, "") {
+		if line.Module == "" && line.Text == "[cid=deadbeef chat=-100 msg=10] unnamed entry" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("unnamed Ctx log line missing the field prefix")
+	}
+
+	// 低于级别的日志不输出
+	m.Ctx(ctx).Debugf("hidden")
+	if got := lastLine(t, m.Name()); strings.Contains(got.Text, "hidden") {
+		t.Error("debug line should be filtered at INFO level")
+	}
+}
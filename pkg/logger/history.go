@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+// historySize 内存中保留的最近日志行数
+const historySize = 500
+
+// Line 一行已输出的日志
+type Line struct {
+	Time   time.Time
+	Level  LogLevel
+	Module string // 未命名的日志为空
+	Text   string
+}
+
+// String 返回 "15:04:05 INFO [模块] 内容" 形式
+func (l Line) String() string {
+	s := l.Time.Format("15:04:05") + " " + levelStrings[l.Level] + " "
+	if l.Module != "" {
+		s += "[" + l.Module + "] "
+	}
+	return s + l.Text
+}
+
+// ring 固定大小的最近日志
+type ring struct {
+	mutex sync.Mutex
+	lines [historySize]Line
+	next  int
+	count int
+}
+
+var history ring
+
+func (r *ring) add(line Line) {
+	r.mutex.Lock()
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % historySize
+	if r.count < historySize {
+		r.count++
+	}
+	r.mutex.Unlock()
+}
+
+// Recent 返回最近输出的最多n行日志，按时间先后排列。module非空时只返回该模块的日志
+func Recent(n int, module string) []Line {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	var lines []Line
+	for i := 0; i < history.count && len(lines) < n; i++ {
+		line := history.lines[(history.next-1-i+historySize)%historySize]
+		if module == "" || line.Module == module {
+			lines = append(lines, line)
+		}
+	}
+	// 从新到旧收集，翻转为时间顺序
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,35 +24,32 @@ var levelStrings = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
 
 // Logger 是一个简单的日志记录器实现
 type Logger struct {
-	level  LogLevel
+	level  atomic.Int32 // 可以在运行时修改，见 SetLevel
 	logger *log.Logger
 }
 
 var defaultLogger *Logger
 
 func init() {
-	defaultLogger = &Logger{
-		level:  INFO,
-		logger: log.New(os.Stdout, "", 0),
-	}
+	defaultLogger = NewLogger(INFO)
 }
 
 // NewLogger 创建一个新的日志记录器实例
 func NewLogger(level LogLevel) *Logger {
-	return &Logger{
-		level:  level,
-		logger: log.New(os.Stdout, "", 0),
-	}
+	l := &Logger{logger: log.New(os.Stdout, "", 0)}
+	l.level.Store(int32(level))
+	return l
 }
 
-// SetLevel 设置日志级别
+// SetLevel 设置日志级别，可以在记录日志的同时调用
 func SetLevel(level LogLevel) {
-	defaultLogger.level = level
+	defaultLogger.level.Store(int32(level))
 }
 
 // ParseLevel 解析字符串日志级别并返回相应的 LogLevel
+// 不区分大小写，无法识别时返回 INFO
 func ParseLevel(levelStr string) LogLevel {
-	switch levelStr {
+	switch strings.ToUpper(levelStr) {
 	case "DEBUG":
 		return DEBUG
 	case "INFO":
@@ -68,14 +67,21 @@ func ParseLevel(levelStr string) LogLevel {
 
 // logf formats and logs a message at the specified level
 func (l *Logger) logf(level LogLevel, format string, args ...interface{}) {
-	if level < l.level {
+	if int32(level) < l.level.Load() {
 		return
 	}
+	l.write(level, "", fmt.Sprintf(format, args...))
+}
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	prefix := fmt.Sprintf("[%s] [%s] ", timestamp, levelStrings[level])
-	message := fmt.Sprintf(format, args...)
+// write 输出一行已通过级别检查的日志，并记入最近日志，module为空表示未命名的日志
+func (l *Logger) write(level LogLevel, module, message string) {
+	now := time.Now()
+	prefix := fmt.Sprintf("[%s] [%s] ", now.Format("2006-01-02 15:04:05"), levelStrings[level])
+	if module != "" {
+		prefix += "[" + module + "] "
+	}
 	l.logger.Print(prefix + message)
+	history.add(Line{Time: now, Level: level, Module: module, Text: message})
 }
 
 // Debugf logs a debug message
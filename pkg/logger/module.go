@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Module 按模块命名的日志记录器。输出带 [模块名] 前缀，可以通过 SetModuleLevels
+// 单独设置级别，没有设置时使用全局级别
+type Module struct {
+	name string
+}
+
+var (
+	modules      sync.Map                            // 模块名 -> *Module
+	moduleLevels atomic.Pointer[map[string]LogLevel] // 单独设置了级别的模块
+)
+
+// Named 返回名为name的日志记录器，同名的调用返回同一个实例
+func Named(name string) *Module {
+	m, _ := modules.LoadOrStore(name, &Module{name: name})
+	return m.(*Module)
+}
+
+// SetModuleLevels 设置各模块的日志级别，替换之前的设置，可以在记录日志的同时调用
+func SetModuleLevels(levels map[string]LogLevel) {
+	copied := make(map[string]LogLevel, len(levels))
+	for name, level := range levels {
+		copied[name] = level
+	}
+	moduleLevels.Store(&copied)
+}
+
+// Name 返回模块名
+func (m *Module) Name() string {
+	return m.name
+}
+
+// level 返回模块生效的日志级别
+func (m *Module) level() LogLevel {
+	if levels := moduleLevels.Load(); levels != nil {
+		if level, ok := (*levels)[m.name]; ok {
+			return level
+		}
+	}
+	return LogLevel(defaultLogger.level.Load())
+}
+
+// IsDebug 模块当前是否输出 DEBUG 日志
+func (m *Module) IsDebug() bool {
+	return m.level() <= DEBUG
+}
+
+// logf 按模块的级别记录日志
+func (m *Module) logf(level LogLevel, format string, args ...interface{}) {
+	if level < m.level() {
+		return
+	}
+	defaultLogger.write(level, m.name, fmt.Sprintf(format, args...))
+}
+
+// Ctx 返回带有 context 字段前缀的模块日志记录器
+func (m *Module) Ctx(ctx context.Context) *Entry {
+	return &Entry{prefix: contextPrefix(ctx), module: m}
+}
+
+// Debugf logs a debug message
+func (m *Module) Debugf(format string, args ...interface{}) {
+	m.logf(DEBUG, format, args...)
+}
+
+// Infof logs an info message
+func (m *Module) Infof(format string, args ...interface{}) {
+	m.logf(INFO, format, args...)
+}
+
+// Warnf logs a warning message
+func (m *Module) Warnf(format string, args ...interface{}) {
+	m.logf(WARN, format, args...)
+}
+
+// Errorf logs an error message
+func (m *Module) Errorf(format string, args ...interface{}) {
+	m.logf(ERROR, format, args...)
+}